@@ -37,7 +37,7 @@
             return Promise.resolve(cachedProducts);
         }
         if (!_productFetchPromise) {
-            _productFetchPromise = fetch('/api/products')
+            _productFetchPromise = fetch('/api/products?status=active')
                 .then(function (res) { return res.json(); })
                 .then(function (data) {
                     cachedProducts = data.products || [];
@@ -89,6 +89,15 @@
         // OAuth callback is handled in init(), skip routing
         if (route === '/oauth/callback') return;
 
+        // A debug link from an admin turns on search diagnostics for this tab
+        var debugParams = new URLSearchParams(window.location.search);
+        if (debugParams.get('debug_token')) {
+            sessionStorage.setItem('askflow_debug_token', debugParams.get('debug_token'));
+            debugParams.delete('debug_token');
+            var debugQuery = debugParams.toString();
+            window.history.replaceState({}, '', window.location.pathname + (debugQuery ? '?' + debugQuery : ''));
+        }
+
         // If system is not ready (API keys not configured), show setup page
         // except for admin login/panel routes so admin can configure the system
         if (!systemReady) {
@@ -113,6 +122,8 @@
                 showPage('admin');
                 initAdmin();
             } else {
+                // Keep deep links (e.g. from chat notifications) across the login
+                if (window.location.search) sessionStorage.setItem('admin_deep_link', window.location.search);
                 navigate(adminLoginRoute);
             }
         } else if (route === '/login') {
@@ -185,6 +196,16 @@
         localStorage.removeItem(USER_KEY);
     }
 
+    // Ends a session on the server, which also revokes the operation tokens
+    // of its user. The local session is cleared whether or not this succeeds.
+    function endServerSession(token) {
+        if (!token) return;
+        fetch('/api/auth/logout', {
+            method: 'POST',
+            headers: { 'Authorization': 'Bearer ' + token }
+        }).catch(function () {});
+    }
+
     function getUser() {
         try {
             var data = localStorage.getItem(USER_KEY);
@@ -234,6 +255,76 @@
         }
     }
 
+    // --- Session Expiry ---
+    // The server extends a session on every authenticated request and reports
+    // the new expiry in response headers. The stored session is kept in sync
+    // so it is not dropped early, and a banner warns before it runs out.
+
+    var SESSION_WARN_MS = 5 * 60 * 1000;
+    var nativeFetch = window.fetch.bind(window);
+
+    window.fetch = function (url, options) {
+        return nativeFetch(url, options).then(function (res) {
+            noteSessionExpiry(options, res);
+            return res;
+        });
+    };
+
+    function noteSessionExpiry(options, res) {
+        var expiresAt = res.headers.get('X-Session-Expires-At');
+        var auth = options && options.headers && options.headers['Authorization'];
+        if (!expiresAt || !auth) return;
+        var token = auth.replace(/^Bearer /, '');
+        var maxExpiresAt = res.headers.get('X-Session-Max-Expires-At');
+        [SESSION_KEY, ADMIN_SESSION_KEY].forEach(function (key) {
+            try {
+                var session = JSON.parse(localStorage.getItem(key) || 'null');
+                if (!session || (session.id || session.session_id) !== token) return;
+                session.expires_at = expiresAt;
+                if (maxExpiresAt) session.max_expires_at = maxExpiresAt;
+                localStorage.setItem(key, JSON.stringify(session));
+            } catch (e) { /* ignore malformed storage */ }
+        });
+        checkSessionExpiry();
+    }
+
+    // activeSession returns the session of the page being shown, if any.
+    function activeSession() {
+        var adminPage = document.getElementById('page-admin');
+        if (adminPage && !adminPage.classList.contains('hidden')) return getAdminSession();
+        var chatPage = document.getElementById('page-chat');
+        if (chatPage && !chatPage.classList.contains('hidden')) return getSession();
+        return null;
+    }
+
+    function checkSessionExpiry() {
+        var banner = document.getElementById('session-expiry-banner');
+        if (!banner) return;
+        var session = activeSession();
+        var left = session && session.expires_at ? new Date(session.expires_at) - new Date() : Infinity;
+        if (left > SESSION_WARN_MS || left <= 0) {
+            banner.classList.add('hidden');
+            return;
+        }
+        // At the maximum lifetime activity no longer helps; only warn
+        var atMax = session.max_expires_at && new Date(session.max_expires_at) <= new Date(session.expires_at);
+        var minutes = Math.max(1, Math.ceil(left / 60000));
+        document.getElementById('session-expiry-text').textContent =
+            i18n.t(atMax ? 'session_expiring_max' : 'session_expiring', { minutes: minutes });
+        document.getElementById('session-expiry-extend').classList.toggle('hidden', !!atMax);
+        banner.classList.remove('hidden');
+    }
+
+    window.extendSession = function () {
+        var session = activeSession();
+        if (!session) return;
+        fetch('/api/auth/session', {
+            headers: { 'Authorization': 'Bearer ' + (session.id || session.session_id) }
+        }).then(checkSessionExpiry, checkSessionExpiry);
+    };
+
+    setInterval(checkSessionExpiry, 30000);
+
     // --- Toast Notifications ---
 
     var toastTimer = null;
@@ -295,6 +386,8 @@
         var loginForm = document.getElementById('user-login-form');
         var registerForm = document.getElementById('user-register-form');
         var forgotForm = document.getElementById('user-forgot-password-form');
+        var externalForm = document.getElementById('user-external-login-form');
+        if (externalForm) externalForm.classList.add('hidden');
         if (loginForm) loginForm.classList.add('hidden');
         if (registerForm) registerForm.classList.remove('hidden');
         if (forgotForm) forgotForm.classList.add('hidden');
@@ -305,6 +398,8 @@
         var loginForm = document.getElementById('user-login-form');
         var registerForm = document.getElementById('user-register-form');
         var forgotForm = document.getElementById('user-forgot-password-form');
+        var externalForm = document.getElementById('user-external-login-form');
+        if (externalForm) externalForm.classList.add('hidden');
         if (loginForm) loginForm.classList.remove('hidden');
         if (registerForm) registerForm.classList.add('hidden');
         if (forgotForm) forgotForm.classList.add('hidden');
@@ -315,6 +410,8 @@
         var loginForm = document.getElementById('user-login-form');
         var registerForm = document.getElementById('user-register-form');
         var forgotForm = document.getElementById('user-forgot-password-form');
+        var externalForm = document.getElementById('user-external-login-form');
+        if (externalForm) externalForm.classList.add('hidden');
         if (loginForm) loginForm.classList.add('hidden');
         if (registerForm) registerForm.classList.add('hidden');
         if (forgotForm) forgotForm.classList.remove('hidden');
@@ -324,6 +421,62 @@
         if (successEl) successEl.classList.add('hidden');
     };
 
+    window.showExternalLoginForm = function () {
+        ['user-login-form', 'user-register-form', 'user-forgot-password-form'].forEach(function (id) {
+            var el = document.getElementById(id);
+            if (el) el.classList.add('hidden');
+        });
+        var externalForm = document.getElementById('user-external-login-form');
+        if (externalForm) externalForm.classList.remove('hidden');
+        var errorEl = document.getElementById('external-login-error');
+        if (errorEl) errorEl.classList.add('hidden');
+    };
+
+    window.handleExternalLogin = function () {
+        var usernameInput = document.getElementById('external-login-username');
+        var passwordInput = document.getElementById('external-login-password');
+        var errorEl = document.getElementById('external-login-error');
+        var submitBtn = document.querySelector('#user-external-login-form .admin-submit-btn');
+        if (!usernameInput || !passwordInput) return;
+        var username = usernameInput.value.trim();
+        var password = passwordInput.value;
+        if (!username || !password) {
+            if (errorEl) { errorEl.textContent = i18n.t('external_login_error_empty'); errorEl.classList.remove('hidden'); }
+            return;
+        }
+        if (errorEl) errorEl.classList.add('hidden');
+        if (submitBtn) submitBtn.disabled = true;
+
+        fetch('/api/auth/external-login', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ credentials: { username: username, password: password } })
+        })
+        .then(function (res) {
+            if (!res.ok) {
+                return res.text().then(function (text) {
+                    var msg = i18n.t('login_failed');
+                    try { var d = JSON.parse(text); if (d.error) msg = d.error; } catch (e) { /* non-JSON response */ }
+                    throw new Error(msg);
+                });
+            }
+            return res.json();
+        })
+        .then(function (data) {
+            if (data.session) {
+                saveSession(data.session, data.user);
+                passwordInput.value = '';
+                navigate('/chat');
+            }
+        })
+        .catch(function (err) {
+            if (errorEl) { errorEl.textContent = err.message; errorEl.classList.remove('hidden'); }
+        })
+        .finally(function () {
+            if (submitBtn) submitBtn.disabled = false;
+        });
+    };
+
     window.handleForgotPassword = function () {
         var emailInput = document.getElementById('forgot-email');
         var errorEl = document.getElementById('forgot-password-error');
@@ -405,7 +558,6 @@
         var confirm = confirmInput.value;
 
         if (!password) { if (errorEl) { errorEl.textContent = i18n.t('reset_error_password'); errorEl.classList.remove('hidden'); } return; }
-        if (password.length < 8) { if (errorEl) { errorEl.textContent = i18n.t('reset_error_password_length'); errorEl.classList.remove('hidden'); } return; }
         if (password !== confirm) { if (errorEl) { errorEl.textContent = i18n.t('reset_error_password_mismatch'); errorEl.classList.remove('hidden'); } return; }
 
         if (errorEl) errorEl.classList.add('hidden');
@@ -526,7 +678,6 @@
 
         if (!email) { if (errorEl) { errorEl.textContent = i18n.t('register_error_email'); errorEl.classList.remove('hidden'); } return; }
         if (!password) { if (errorEl) { errorEl.textContent = i18n.t('register_error_password'); errorEl.classList.remove('hidden'); } return; }
-        if (password.length < 8) { if (errorEl) { errorEl.textContent = i18n.t('register_error_password_length'); errorEl.classList.remove('hidden'); } return; }
         if (password !== confirm) { if (errorEl) { errorEl.textContent = i18n.t('register_error_password_mismatch'); errorEl.classList.remove('hidden'); } return; }
         if (!captchaInput || !captchaInput.value.trim()) { if (errorEl) { errorEl.textContent = i18n.t('register_error_captcha'); errorEl.classList.remove('hidden'); } return; }
 
@@ -654,10 +805,6 @@
             if (errorEl) { errorEl.textContent = i18n.t('admin_error_password'); errorEl.classList.remove('hidden'); }
             return;
         }
-        if (password.length < 6) {
-            if (errorEl) { errorEl.textContent = i18n.t('admin_error_password_length'); errorEl.classList.remove('hidden'); }
-            return;
-        }
         if (password !== confirm) {
             if (errorEl) { errorEl.textContent = i18n.t('admin_error_password_mismatch'); errorEl.classList.remove('hidden'); }
             return;
@@ -739,6 +886,10 @@
                     saveAdminSession(data.session, { username: username, provider: 'admin' });
                     if (data.role) localStorage.setItem('admin_role', data.role);
                     navigate('/admin-panel');
+                    if (data.password_expired) {
+                        alert(i18n.t('admin_password_expired'));
+                        changeAdminPassword(password);
+                    }
                 } else {
                     throw new Error(i18n.t('admin_login_failed'));
                 }
@@ -851,6 +1002,7 @@
     var chatMessages = [];
     var chatLoading = false;
     var chatPendingImage = null; // base64 data URL of pasted image
+    var chatCapabilities = null; // features of the selected product, from /api/products/{id}/capabilities
 
     function getChatUserID() {
         try {
@@ -866,6 +1018,31 @@
         return session ? session.id || session.session_id || '' : '';
     }
 
+    // Mints an operation token for a download or media stream: the browser
+    // then loads path?op_token=... natively, and the request keeps working
+    // if the session expires or is rotated meanwhile.
+    function requestOperationToken(path, sessionToken, method) {
+        return fetch('/api/auth/operation-token', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', 'Authorization': 'Bearer ' + sessionToken },
+            body: JSON.stringify({ method: method || 'GET', path: path })
+        }).then(function (res) {
+            if (!res.ok) throw new Error('operation token');
+            return res.json();
+        }).then(function (data) {
+            return data.token;
+        });
+    }
+
+    function startLinkDownload(url, fileName) {
+        var a = document.createElement('a');
+        a.href = url;
+        a.download = fileName || '';
+        document.body.appendChild(a);
+        a.click();
+        document.body.removeChild(a);
+    }
+
     function initChat() {
         var nameEl = document.getElementById('chat-user-name');
         var loginBtn = document.getElementById('chat-login-btn');
@@ -1042,9 +1219,34 @@
         if (callback) callback();
     }
 
+    // Load the features of the current product and adapt the chat input to them
+    function loadChatCapabilities(productId) {
+        var url = productId ? '/api/products/' + encodeURIComponent(productId) + '/capabilities' : '/api/app-info';
+        fetch(url)
+            .then(function (res) { return res.ok ? res.json() : null; })
+            .then(function (data) {
+                chatCapabilities = data ? (productId ? data : data.capabilities || null) : null;
+                applyChatCapabilities();
+            })
+            .catch(function () { chatCapabilities = null; applyChatCapabilities(); });
+    }
+
+    function chatImagesAllowed() {
+        return !chatCapabilities || chatCapabilities.image_questions !== false;
+    }
+
+    function applyChatCapabilities() {
+        var allowed = chatImagesAllowed();
+        var btn = document.querySelector('.chat-image-upload-btn');
+        if (btn) btn.style.display = allowed ? '' : 'none';
+        if (!allowed && chatPendingImage) window.removeChatImage();
+    }
+
     // Load welcome message for current product
     function loadWelcomeMessage() {
         var productId = localStorage.getItem('askflow_product_id') || '';
+        loadChatCapabilities(productId);
+        loadChatAnnouncements(productId);
         var introUrl = '/api/product-intro' + (productId ? '?product_id=' + encodeURIComponent(productId) : '');
         fetch(introUrl)
             .then(function (res) { return res.json(); })
@@ -1066,12 +1268,141 @@
             });
     }
 
+    // --- Product announcements shown above the chat ---
+
+    var DISMISSED_ANNOUNCEMENTS_KEY = 'askflow_dismissed_announcements';
+
+    function getDismissedAnnouncements() {
+        try {
+            var ids = JSON.parse(localStorage.getItem(DISMISSED_ANNOUNCEMENTS_KEY) || '[]');
+            return Array.isArray(ids) ? ids : [];
+        } catch (e) {
+            return [];
+        }
+    }
+
+    function loadChatAnnouncements(productId) {
+        var container = document.getElementById('chat-announcements');
+        if (!container) return;
+        var url = '/api/announcements' + (productId ? '?product_id=' + encodeURIComponent(productId) : '');
+        fetch(url)
+            .then(function (res) { return res.ok ? res.json() : { announcements: [] }; })
+            .then(function (data) {
+                var dismissed = getDismissedAnnouncements();
+                var list = (data.announcements || []).filter(function (a) { return dismissed.indexOf(a.id) === -1; });
+                var html = '';
+                for (var i = 0; i < list.length; i++) {
+                    var a = list[i];
+                    html += '<div class="chat-announcement">' +
+                        '<div class="chat-announcement-head">' +
+                            '<span class="chat-announcement-title">' + escapeHtml(a.title) + '</span>' +
+                            (a.version ? '<span class="chat-announcement-version">' + escapeHtml(a.version) + '</span>' : '') +
+                            '<button type="button" class="chat-announcement-close" data-id="' + escapeHtml(a.id) + '" onclick="dismissAnnouncement(this.dataset.id)" title="' + escapeHtml(i18n.t('chat_announcement_dismiss')) + '">&times;</button>' +
+                        '</div>' +
+                        '<div class="chat-announcement-content">' + escapeHtml(a.content) + '</div>' +
+                    '</div>';
+                }
+                container.innerHTML = html;
+                container.classList.toggle('hidden', list.length === 0);
+            })
+            .catch(function () {
+                container.classList.add('hidden');
+            });
+    }
+
+    window.dismissAnnouncement = function (id) {
+        var dismissed = getDismissedAnnouncements();
+        if (dismissed.indexOf(id) === -1) dismissed.push(id);
+        // Keep the list bounded; old announcements expire anyway
+        if (dismissed.length > 50) dismissed = dismissed.slice(-50);
+        localStorage.setItem(DISMISSED_ANNOUNCEMENTS_KEY, JSON.stringify(dismissed));
+        loadChatAnnouncements(localStorage.getItem('askflow_product_id') || '');
+    };
+
     // Toggle user profile dropdown
     window.toggleUserDropdown = function () {
         var dropdown = document.getElementById('chat-user-dropdown');
         if (dropdown) dropdown.classList.toggle('hidden');
     };
 
+    // --- Chat history panel: past questions and answers of the current product ---
+
+    var chatHistoryPage = 0;
+
+    window.toggleChatHistory = function () {
+        var panel = document.getElementById('history-panel');
+        var list = document.getElementById('history-panel-list');
+        if (!panel || !list) return;
+        var dropdown = document.getElementById('chat-user-dropdown');
+        if (dropdown) dropdown.classList.add('hidden');
+        panel.classList.toggle('hidden');
+        if (panel.classList.contains('hidden')) return;
+        chatHistoryPage = 0;
+        list.innerHTML = '';
+        loadChatHistory();
+    };
+
+    function loadChatHistory() {
+        var list = document.getElementById('history-panel-list');
+        if (!list) return;
+        var more = list.querySelector('.history-more');
+        if (more) more.remove();
+        var productId = localStorage.getItem('askflow_product_id') || '';
+        fetch('/api/chat/history?page=' + (chatHistoryPage + 1) + '&page_size=20&product_id=' + encodeURIComponent(productId), {
+            headers: { 'Authorization': 'Bearer ' + getChatToken() }
+        })
+        .then(function (res) {
+            if (!res.ok) throw new Error(i18n.t('chat_history_load_failed'));
+            return res.json();
+        })
+        .then(function (data) {
+            chatHistoryPage++;
+            var entries = data.entries || [];
+            if (chatHistoryPage === 1 && entries.length === 0) {
+                list.innerHTML = '<p class="faq-empty">' + escapeHtml(i18n.t('chat_history_empty')) + '</p>';
+                return;
+            }
+            entries.forEach(function (e) { list.appendChild(renderChatHistoryItem(e)); });
+            if (chatHistoryPage * (data.page_size || 20) < (data.total || 0)) {
+                var btn = document.createElement('button');
+                btn.className = 'history-more';
+                btn.textContent = i18n.t('chat_history_more');
+                btn.onclick = loadChatHistory;
+                list.appendChild(btn);
+            }
+        })
+        .catch(function (err) {
+            list.insertAdjacentHTML('beforeend', '<p class="faq-empty">' + escapeHtml(err.message || i18n.t('chat_history_load_failed')) + '</p>');
+        });
+    }
+
+    function renderChatHistoryItem(e) {
+        var item = document.createElement('div');
+        item.className = 'history-item';
+        item.innerHTML = '<div class="history-item-head">' +
+            '<span class="history-item-question">' + escapeHtml(e.question) + '</span>' +
+            '<button class="history-item-delete" title="' + escapeHtml(i18n.t('chat_history_delete')) + '">&times;</button>' +
+            '</div>' +
+            '<div class="history-item-time">' + escapeHtml(new Date(e.created_at).toLocaleString()) + '</div>' +
+            '<div class="history-item-answer hidden">' + linkifyText(escapeHtml(e.answer)) + '</div>';
+        item.querySelector('.history-item-question').onclick = function () {
+            item.querySelector('.history-item-answer').classList.toggle('hidden');
+        };
+        item.querySelector('.history-item-delete').onclick = function () {
+            if (!confirm(i18n.t('chat_history_delete_confirm'))) return;
+            fetch('/api/chat/history/' + encodeURIComponent(e.id), {
+                method: 'DELETE',
+                headers: { 'Authorization': 'Bearer ' + getChatToken() }
+            })
+            .then(function (res) {
+                if (!res.ok) throw new Error();
+                item.remove();
+            })
+            .catch(function () { alert(i18n.t('chat_history_delete_failed')); });
+        };
+        return item;
+    }
+
     // Save default product preference
     window.saveDefaultProduct = function () {
         var select = document.getElementById('chat-default-product');
@@ -1128,6 +1459,7 @@
 
         // Paste image from clipboard
         input.addEventListener('paste', function (e) {
+            if (!chatImagesAllowed()) return;
             var items = (e.clipboardData || e.originalEvent.clipboardData || {}).items;
             if (!items) return;
             for (var i = 0; i < items.length; i++) {
@@ -1164,6 +1496,7 @@
                 e.preventDefault();
                 e.stopPropagation();
                 wrapper.classList.remove('drag-over');
+                if (!chatImagesAllowed()) return;
                 var files = e.dataTransfer && e.dataTransfer.files;
                 if (!files || files.length === 0) return;
                 var file = files[0];
@@ -1209,7 +1542,7 @@
 
     // Handle image file selection from the upload button
     window.handleChatImageFileSelect = function (input) {
-        if (!input.files || input.files.length === 0) return;
+        if (!input.files || input.files.length === 0 || !chatImagesAllowed()) return;
         var file = input.files[0];
         if (file.type.indexOf('image') === -1) {
             alert(i18n.t('image_select_error'));
@@ -1292,6 +1625,43 @@
         }
         html += renderMarkdown(msg.content);
 
+        if (!msg.isPending && msg.degraded) {
+            html += '<div class="chat-msg-degraded">⚠ ' + escapeHtml(i18n.t('chat_degraded_answer')) + '</div>';
+        }
+        if (!msg.isPending && msg.budgetLimited) {
+            html += '<div class="chat-msg-degraded">⚠ ' + escapeHtml(i18n.t('chat_budget_answer')) + '</div>';
+        }
+
+        // Flag sentences the answer check found no support for in the sources
+        var faith = msg.faithfulness;
+        if (!msg.isPending && faith && !faith.removed && faith.unsupported && faith.unsupported.length > 0) {
+            html += '<div class="chat-msg-unsupported" style="margin-top:0.5rem;padding:0.4rem 0.6rem;border-left:3px solid #e67e22;background:#fdf2e9;font-size:0.85em">' +
+                '<div>⚠ ' + escapeHtml(i18n.t('chat_unsupported_claims')) + '</div><ul style="margin:0.25rem 0 0 1rem;padding:0">';
+            for (var u = 0; u < faith.unsupported.length; u++) {
+                html += '<li>' + escapeHtml(faith.unsupported[u]) + '</li>';
+            }
+            html += '</ul></div>';
+        }
+
+        // Guided troubleshooting: routing suggestion, current step options, hand-off
+        if (msg.suggestedFlow) {
+            html += '<div class="chat-flow-suggest" style="margin-top:0.5rem">' +
+                '<button class="btn-secondary btn-sm" onclick="startChatFlow(\'' + escapeHtml(msg.suggestedFlow.id) + '\')">🧭 ' +
+                escapeHtml(i18n.t('chat_flow_start', { title: msg.suggestedFlow.title })) + '</button></div>';
+        }
+        if (msg.flowPos && msg.flowActive) {
+            var node = msg.flowPos.node;
+            html += '<div class="chat-flow-options" style="margin-top:0.5rem;display:flex;flex-wrap:wrap;gap:0.4rem">';
+            if (node.type === 'question') {
+                for (var fo = 0; fo < node.options.length; fo++) {
+                    html += '<button class="btn-secondary btn-sm" onclick="chooseChatFlowOption(' + i + ',' + fo + ')">' + escapeHtml(node.options[fo].label) + '</button>';
+                }
+            } else if (node.type === 'escalate') {
+                html += '<button class="btn-primary btn-sm" onclick="escalateChatFlow(' + i + ')">' + escapeHtml(i18n.t('chat_flow_escalate')) + '</button>';
+            }
+            html += '</div>';
+        }
+
         // Display images as photo wall gallery, video/audio as play buttons
         var _mediaTypes = { video:1, mp4:1, avi:1, mkv:1, mov:1, webm:1, mp3:1, wav:1, ogg:1, flac:1 };
         if (!msg.isPending && msg.sources && msg.sources.length > 0) {
@@ -1319,7 +1689,7 @@
                 html += '<div class="chat-gallery-viewport">';
                 for (var gi = 0; gi < images.length; gi++) {
                     html += '<div class="chat-gallery-slide' + (gi === 0 ? ' active' : '') + '">';
-                    html += '<img src="' + escapeHtml(images[gi].url) + '" alt="' + escapeHtml(images[gi].name) + '" loading="lazy" onclick="window.openGalleryFull(this.src)" />';
+                    html += '<img src="' + escapeHtml(imageVariantURL(images[gi].url, 'medium')) + '" data-full="' + escapeHtml(images[gi].url) + '" alt="' + escapeHtml(images[gi].name) + '" loading="lazy" onclick="window.openGalleryFull(this.getAttribute(\'data-full\') || this.src)" />';
                     html += '</div>';
                 }
                 html += '</div>';
@@ -1340,12 +1710,13 @@
             for (var vi = 0; vi < docIds.length; vi++) {
                 var vDocId = docIds[vi];
                 var seg = videoSegments[vDocId];
-                var mediaUrl = '/api/media/' + encodeURIComponent(vDocId) + '?token=' + encodeURIComponent(getChatToken());
+                var mediaPath = '/api/media/' + encodeURIComponent(vDocId);
+                var mediaUrl = mediaPath + '?token=' + encodeURIComponent(getChatToken());
                 var firstStart = seg.times.length > 0 ? seg.times[0].start : 0;
                 var vExt = (seg.name || '').split('.').pop().toLowerCase();
                 var isAudio = (vExt === 'mp3' || vExt === 'wav' || vExt === 'ogg' || vExt === 'flac');
                 var mediaIdx = window._mediaRegistry.length;
-                window._mediaRegistry.push({ url: mediaUrl, isAudio: isAudio, startTime: firstStart, name: seg.name || 'media', segments: seg.times });
+                window._mediaRegistry.push({ path: mediaPath, url: mediaUrl, isAudio: isAudio, startTime: firstStart, name: seg.name || 'media', segments: seg.times });
                 html += '<div class="chat-media-compact">';
                 html += '<button class="chat-media-play-btn" onclick="window.openMediaModal(' + mediaIdx + ')">';
                 html += '<span class="chat-media-play-icon">' + (isAudio ? '🎵' : '▶') + '</span>';
@@ -1371,18 +1742,22 @@
             html += '<ul id="' + srcId + '" class="chat-sources-list">';
             for (var j = 0; j < msg.sources.length; j++) {
                 var src = msg.sources[j];
-                html += '<li class="chat-source-item">';
+                html += '<li class="chat-source-item" onclick="trackCitationClick(' + i + ',' + j + ')">';
                 var docName = escapeHtml(src.document_name || i18n.t('chat_source_unknown'));
                 var canDownload = msg.allowDownload && src.document_id && src.document_type && downloadableTypes[(src.document_type || '').toLowerCase()];
                 if (canDownload) {
                     var dlToken = getChatToken();
-                    html += '<a class="chat-source-name chat-source-download" href="/api/documents/public-download/' + encodeURIComponent(src.document_id) + '?product_id=' + encodeURIComponent(productId) + '&token=' + encodeURIComponent(dlToken) + '" title="' + i18n.t('chat_source_download') + '">📥 ' + docName + '</a>';
+                    var dlPath = '/api/documents/public-download/' + encodeURIComponent(src.document_id);
+                    html += '<a class="chat-source-name chat-source-download" href="' + dlPath + '?product_id=' + encodeURIComponent(productId) + '&token=' + encodeURIComponent(dlToken) + '" data-path="' + dlPath + '" data-product="' + escapeHtml(productId) + '" onclick="return window.downloadSource(event, this)" title="' + i18n.t('chat_source_download') + '">📥 ' + docName + '</a>';
+                } else if (src.url && /^https?:\/\//i.test(src.url)) {
+                    html += '<a class="chat-source-name" href="' + escapeHtml(src.url) + '" target="_blank" rel="noopener noreferrer" onclick="event.stopPropagation();trackCitationClick(' + i + ',' + j + ')" title="' + i18n.t('chat_source_open_page') + '">🔗 ' + docName + '</a>';
                 } else {
                     html += '<span class="chat-source-name">' + docName + '</span>';
                 }
                 var srcType = (src.document_type || '').toLowerCase();
                 if (_mediaTypes[srcType] && src.document_id) {
-                    var srcMediaUrl = '/api/media/' + encodeURIComponent(src.document_id) + '?token=' + encodeURIComponent(getChatToken());
+                    var srcMediaPath = '/api/media/' + encodeURIComponent(src.document_id);
+                    var srcMediaUrl = srcMediaPath + '?token=' + encodeURIComponent(getChatToken());
                     var srcExt = (src.document_name || '').split('.').pop().toLowerCase();
                     var srcIsAudio = (srcExt === 'mp3' || srcExt === 'wav' || srcExt === 'ogg' || srcExt === 'flac');
                     var srcStart = src.start_time || 0;
@@ -1391,8 +1766,8 @@
                         srcSegs.push({ start: src.start_time || 0, end: src.end_time || 0 });
                     }
                     var srcMediaIdx = window._mediaRegistry.length;
-                    window._mediaRegistry.push({ url: srcMediaUrl, isAudio: srcIsAudio, startTime: srcStart, name: src.document_name || 'media', segments: srcSegs });
-                    html += '<button class="chat-source-play-btn" onclick="event.stopPropagation();window.openMediaModal(' + srcMediaIdx + ')" title="' + (srcIsAudio ? i18n.t('chat_play_audio') : i18n.t('chat_play_video')) + '">' + (srcIsAudio ? '🎵' : '▶️') + '</button>';
+                    window._mediaRegistry.push({ path: srcMediaPath, url: srcMediaUrl, isAudio: srcIsAudio, startTime: srcStart, name: src.document_name || 'media', segments: srcSegs });
+                    html += '<button class="chat-source-play-btn" onclick="event.stopPropagation();trackCitationClick(' + i + ',' + j + ');window.openMediaModal(' + srcMediaIdx + ')" title="' + (srcIsAudio ? i18n.t('chat_play_audio') : i18n.t('chat_play_video')) + '">' + (srcIsAudio ? '🎵' : '▶️') + '</button>';
                 }
                 if (src.start_time > 0 || src.end_time > 0) {
                     var timeLabel = formatMediaTime(src.start_time || 0);
@@ -1463,6 +1838,10 @@
         if (!msg.isPending && !msg.isWelcome && !msg.isError && msg.content) {
             html += '<button class="chat-not-satisfied-btn" onclick="window.handleNotSatisfied(this, ' + i + ')">👎 ' + i18n.t('chat_not_satisfied') + '</button>';
         }
+        // Suggest a correction for a sentence of a logged answer
+        if (!msg.isPending && !msg.isError && msg.queryId) {
+            html += '<button class="chat-not-satisfied-btn" onclick="window.openCorrectionDialog(' + i + ')">✏️ ' + i18n.t('chat_correction_btn') + '</button>';
+        }
 
         html += '</div>';
         return html;
@@ -1474,10 +1853,83 @@
                 '<span class="typing-dot"></span>' +
                 '<span class="typing-dot"></span>' +
                 '<span class="typing-dot"></span>' +
+                '<span class="chat-queue-status" style="margin-left:0.5rem;font-size:0.85em;color:#888">' + queueStatusText() + '</span>' +
             '</div>' +
         '</div>';
     }
 
+    // Generation queue feedback: while a query waits for a free LLM slot the
+    // loading indicator shows its place in line.
+    var chatQueuePosition = 0;
+
+    function queueStatusText() {
+        return chatQueuePosition > 0 ? escapeHtml(i18n.t('chat_queue_position', { n: chatQueuePosition })) : '';
+    }
+
+    function newQueueTicket() {
+        var bytes = new Uint8Array(12);
+        (window.crypto || window.msCrypto).getRandomValues(bytes);
+        return Array.prototype.map.call(bytes, function (b) { return ('0' + b.toString(16)).slice(-2); }).join('');
+    }
+
+    // watchQueuePosition polls the queue position of ticket until the returned stop function is called.
+    function watchQueuePosition(ticket) {
+        var stopped = false;
+        var timer = null;
+        function poll() {
+            fetch('/api/query/queue?ticket=' + encodeURIComponent(ticket), {
+                headers: { 'Authorization': 'Bearer ' + getChatToken() }
+            })
+            .then(function (res) { return res.ok ? res.json() : null; })
+            .then(function (data) {
+                if (stopped || !data) return;
+                chatQueuePosition = data.known ? data.position : 0;
+                var el = document.querySelector('#chat-messages .chat-queue-status');
+                if (el) el.innerHTML = queueStatusText();
+            })
+            .catch(function () {})
+            .finally(function () {
+                if (!stopped) timer = setTimeout(poll, 2000);
+            });
+        }
+        timer = setTimeout(poll, 1500);
+        return function () {
+            stopped = true;
+            clearTimeout(timer);
+            chatQueuePosition = 0;
+        };
+    }
+
+    // Degraded mode: while the embedding service is down, answers come from
+    // keyword search and the chat shows a warning banner.
+    function setDegradedBanner(degraded) {
+        var el = document.getElementById('chat-degraded-banner');
+        if (!el) return;
+        if (degraded) {
+            el.textContent = i18n.t('chat_degraded_banner');
+            el.classList.remove('hidden');
+        } else {
+            el.classList.add('hidden');
+        }
+    }
+
+    // Soft rate limiting: the server flags responses once few questions remain
+    // in the current window, before it starts refusing them with 429.
+    var rateWarningTimer = null;
+
+    function showRateLimitWarning(res) {
+        var el = document.getElementById('chat-rate-warning');
+        if (!el || !res.headers.get('X-RateLimit-Warning')) return;
+        var remaining = parseInt(res.headers.get('X-RateLimit-Remaining'), 10) || 0;
+        var reset = parseInt(res.headers.get('X-RateLimit-Reset'), 10) || 60;
+        el.textContent = i18n.t('chat_rate_warning', { remaining: remaining, seconds: reset });
+        el.classList.remove('hidden');
+        if (rateWarningTimer) clearTimeout(rateWarningTimer);
+        rateWarningTimer = setTimeout(function () {
+            el.classList.add('hidden');
+        }, reset * 1000);
+    }
+
     function scrollChatToBottom() {
         var container = document.getElementById('chat-messages');
         if (container) {
@@ -1543,6 +1995,13 @@
         _gallerySetIndex(gallery, idx);
     };
 
+    // imageVariantURL returns the scaled copy of a locally served image
+    // (size: 'thumb' or 'medium'); other URLs are returned unchanged.
+    function imageVariantURL(url, size) {
+        if (!url || url.indexOf('/api/images/') !== 0 || url.indexOf('?') !== -1) return url;
+        return url + '?size=' + size;
+    }
+
     window.openGalleryFull = function(src) {
         var overlay = document.createElement('div');
         overlay.className = 'gallery-fullscreen-overlay';
@@ -1559,14 +2018,41 @@
     window._mediaRegistry = [];
 
     // Media modal for video/audio playback
+    // Downloads a cited document with an operation token, falling back to
+    // the session link in href.
+    window.downloadSource = function(e, link) {
+        e.preventDefault();
+        var path = link.getAttribute('data-path');
+        var productId = link.getAttribute('data-product') || '';
+        requestOperationToken(path, getChatToken()).then(function (token) {
+            startLinkDownload(path + '?product_id=' + encodeURIComponent(productId) + '&op_token=' + encodeURIComponent(token));
+        }).catch(function () {
+            startLinkDownload(link.href);
+        });
+        return false;
+    };
+
     window.openMediaModal = function(idx) {
+        var info = window._mediaRegistry[idx];
+        if (!info) return;
+        if (!info.path) {
+            showMediaModal(info, info.url);
+            return;
+        }
+        // Seeking issues new range requests long after the player opened,
+        // so the stream gets its own token rather than the session's
+        requestOperationToken(info.path, getChatToken()).then(function (token) {
+            showMediaModal(info, info.path + '?op_token=' + encodeURIComponent(token));
+        }).catch(function () {
+            showMediaModal(info, info.url);
+        });
+    };
+
+    function showMediaModal(info, url) {
         // Close any existing modal first
         if (window._mediaModalOverlay) {
             window.closeMediaModal();
         }
-        var info = window._mediaRegistry[idx];
-        if (!info) return;
-        var url = info.url;
         var isAudio = info.isAudio;
         var startTime = info.startTime;
         var name = info.name;
@@ -1599,7 +2085,7 @@
         });
         document.body.appendChild(overlay);
         window._mediaModalOverlay = overlay;
-    };
+    }
 
     window.closeMediaModal = function() {
         if (window._mediaModalOverlay) {
@@ -1640,9 +2126,15 @@
         if (!str) return '';
         var text = escapeHtml(str);
 
-        // Code blocks (``` ... ```)
-        text = text.replace(/```(\w*)\n([\s\S]*?)```/g, function (m, lang, code) {
-            return '<pre class="md-code-block"><code>' + code.replace(/\n$/, '') + '</code></pre>';
+        // Code blocks (``` ... ```) are set aside so the rules below leave
+        // commands and config snippets alone; each gets its language and a
+        // copy button
+        var codeBlocks = [];
+        text = text.replace(/```([\w+#.-]*)[^\S\n]*\n([\s\S]*?)```/g, function (m, lang, code) {
+            codeBlocks.push('<div class="md-code-wrap"><div class="md-code-head"><span>' + lang + '</span>' +
+                '<button type="button" class="md-code-copy" onclick="copyCodeBlock(this)">' + i18n.t('chat_code_copy') + '</button></div>' +
+                '<pre class="md-code-block"><code>' + code.replace(/\n$/, '') + '</code></pre></div>');
+            return '\u0000' + (codeBlocks.length - 1) + '\u0000';
         });
 
         // Inline code
@@ -1790,9 +2282,36 @@
         text = text.replace(/(<\/ol>)<br>/g, '$1');
         text = text.replace(/(<hr[^>]*>)<br>/g, '$1');
 
+        text = text.replace(/\u0000(\d+)\u0000(<br>)?/g, function (m, i) { return codeBlocks[+i]; });
         return text;
     }
 
+    window.copyCodeBlock = function (btn) {
+        var code = btn.closest('.md-code-wrap').querySelector('code');
+        var copied = function () {
+            btn.textContent = i18n.t('chat_code_copied');
+            setTimeout(function () { btn.textContent = i18n.t('chat_code_copy'); }, 1500);
+        };
+        var fallback = function () {
+            var area = document.createElement('textarea');
+            area.value = code.textContent;
+            area.style.position = 'fixed';
+            area.style.opacity = '0';
+            document.body.appendChild(area);
+            area.select();
+            try {
+                if (document.execCommand('copy')) copied();
+            } finally {
+                document.body.removeChild(area);
+            }
+        };
+        if (navigator.clipboard && window.isSecureContext) {
+            navigator.clipboard.writeText(code.textContent).then(copied, fallback);
+        } else {
+            fallback();
+        }
+    };
+
 
     window.toggleSources = function (id, btn) {
         var list = document.getElementById(id);
@@ -1927,75 +2446,282 @@
         }
     }
 
-    window.sendChatMessage = function () {
-        var input = document.getElementById('chat-input');
-        var sendBtn = document.getElementById('chat-send-btn');
-        if (!input) return;
-
-        var question = input.value.trim();
-        var imageData = chatPendingImage;
-        if ((!question && !imageData) || chatLoading) return;
-
-        // Default question text if only image
-        if (!question && imageData) {
-            question = i18n.t('chat_image_recognize');
-        }
-
-        // Add user message
-        var userMsg = {
-            role: 'user',
-            content: question,
-            timestamp: Date.now()
-        };
-        if (imageData) {
-            userMsg.imageUrl = imageData;
-        }
-        chatMessages.push(userMsg);
-
-        // Clear input, image, and reset height
-        var chatPreview = document.getElementById('chat-image-preview');
-        var hadImage = !!imageData;
-        input.value = '';
-        input.style.height = 'auto';
-        chatPendingImage = null;
-        if (sendBtn) sendBtn.disabled = true;
-
-        // Always hide the chat image preview immediately after sending
-        if (chatPreview) chatPreview.classList.add('hidden');
+    // routeChatFlow asks the server whether a troubleshooting flow of the
+    // current product fits the question. Resolves to the flow summary or null.
+    function routeChatFlow(question) {
+        if (!chatCapabilities || !chatCapabilities.flows || !question) return Promise.resolve(null);
+        return fetch('/api/flows/route', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', 'Authorization': 'Bearer ' + getChatToken() },
+            body: JSON.stringify({ question: question, product_id: localStorage.getItem('askflow_product_id') || '' })
+        })
+        .then(function (res) { return res.ok ? res.json() : null; })
+        .then(function (data) { return data && data.flow ? data.flow : null; })
+        .catch(function () { return null; });
+    }
 
-        // Show loading
+    // walkChatFlow fetches the node reached by path and appends it to the chat.
+    function walkChatFlow(flowId, path) {
         chatLoading = true;
         renderChatMessages();
-
-        // Build request body
-        var reqBody = {
-            question: question,
-            user_id: getChatUserID(),
-            product_id: localStorage.getItem('askflow_product_id') || ''
-        };
-        if (imageData) {
-            reqBody.image_data = imageData;
-        }
-
-        // Call API
-        var token = getChatToken();
-        var controller = new AbortController();
-        var timeoutId = setTimeout(function () { controller.abort(); }, 90000); // 90s timeout
-
-        fetch('/api/query', {
+        fetch('/api/flows/walk', {
             method: 'POST',
-            headers: {
-                'Content-Type': 'application/json',
-                'Authorization': 'Bearer ' + token
-            },
-            body: JSON.stringify(reqBody),
-            signal: controller.signal
+            headers: { 'Content-Type': 'application/json', 'Authorization': 'Bearer ' + getChatToken() },
+            body: JSON.stringify({ flow_id: flowId, path: path })
         })
         .then(function (res) {
-            if (!res.ok) {
-                // Handle 401 Unauthorized - session expired or invalid
-                if (res.status === 401) {
-                    clearSession();
+            return res.json().then(function (data) {
+                if (!res.ok) throw new Error(data.error || i18n.t('chat_request_failed'));
+                return data;
+            });
+        })
+        .then(function (pos) {
+            chatMessages.push({
+                role: 'system',
+                content: (path.length === 0 ? '**' + pos.title + '**\n\n' : '') + pos.node.text,
+                sources: [],
+                flowPos: pos,
+                flowActive: pos.node.type !== 'answer',
+                timestamp: Date.now()
+            });
+        })
+        .catch(function (err) {
+            chatMessages.push({
+                role: 'system',
+                content: i18n.t('chat_error_prefix') + (err.message || i18n.t('chat_error_unknown')) + i18n.t('chat_error_suffix'),
+                sources: [],
+                isError: true,
+                timestamp: Date.now()
+            });
+        })
+        .finally(function () {
+            chatLoading = false;
+            renderChatMessages();
+        });
+    }
+
+    window.startChatFlow = function (flowId) {
+        if (chatLoading) return;
+        walkChatFlow(flowId, []);
+    };
+
+    window.chooseChatFlowOption = function (msgIndex, optIndex) {
+        var msg = chatMessages[msgIndex];
+        if (chatLoading || !msg || !msg.flowPos || !msg.flowActive) return;
+        var opt = msg.flowPos.node.options[optIndex];
+        if (!opt) return;
+        msg.flowActive = false;
+        chatMessages.push({ role: 'user', content: opt.label, timestamp: Date.now() });
+        walkChatFlow(msg.flowPos.flow_id, msg.flowPos.path.concat([optIndex]));
+    };
+
+    window.escalateChatFlow = function (msgIndex) {
+        var msg = chatMessages[msgIndex];
+        if (!msg || !msg.flowPos || !msg.flowActive) return;
+        msg.flowActive = false;
+        fetch('/api/pending/create', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', 'Authorization': 'Bearer ' + getChatToken() },
+            body: JSON.stringify({
+                question: msg.flowPos.summary,
+                user_id: getChatUserID(),
+                product_id: localStorage.getItem('askflow_product_id') || ''
+            })
+        })
+        .then(function (res) {
+            if (!res.ok) throw new Error('failed');
+            chatMessages.push({
+                role: 'system',
+                content: i18n.t('chat_not_satisfied_success'),
+                sources: [],
+                isPending: true,
+                timestamp: Date.now()
+            });
+        })
+        .catch(function () {
+            msg.flowActive = true;
+            alert(i18n.t('chat_not_satisfied_fail'));
+        })
+        .finally(function () { renderChatMessages(); });
+    };
+
+    // trackCitationClick reports that the user opened a cited source, once per
+    // source and answer, for the document usage statistics.
+    window.trackCitationClick = function (msgIndex, srcIndex) {
+        var msg = chatMessages[msgIndex];
+        var src = msg && msg.sources && msg.sources[srcIndex];
+        if (!msg || !msg.queryId || !src || !src.document_id) return;
+        msg.clickedSources = msg.clickedSources || {};
+        if (msg.clickedSources[srcIndex]) return;
+        msg.clickedSources[srcIndex] = true;
+        fetch('/api/query/citation-click', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json', 'Authorization': 'Bearer ' + getChatToken() },
+            body: JSON.stringify({ query_id: msg.queryId, document_id: src.document_id, chunk_index: src.chunk_index || 0 })
+        }).catch(function () {});
+    };
+
+    // openCorrectionDialog lets the user flag a sentence of an answer as wrong
+    // and suggest the correct information. Text selected in the answer is
+    // taken as the sentence; the suggestion may be tied to a cited source.
+    window.openCorrectionDialog = function (msgIndex) {
+        var msg = chatMessages[msgIndex];
+        if (!msg || !msg.queryId) return;
+        var selected = window.getSelection ? String(window.getSelection()).trim() : '';
+        var cited = [];
+        var seen = {};
+        for (var k = 0; msg.sources && k < msg.sources.length; k++) {
+            var src = msg.sources[k];
+            var key = src.document_id + ':' + (src.chunk_index || 0);
+            if (!src.document_id || seen[key]) continue;
+            seen[key] = true;
+            cited.push(src);
+        }
+        var srcOptions = '<option value="">' + escapeHtml(i18n.t('chat_correction_source_unknown')) + '</option>';
+        for (var c = 0; c < cited.length; c++) {
+            srcOptions += '<option value="' + c + '">' + escapeHtml(cited[c].document_name || i18n.t('chat_source_unknown')) +
+                (cited[c].snippet ? ' — ' + escapeHtml(cited[c].snippet.slice(0, 40)) : '') + '</option>';
+        }
+        var overlay = document.createElement('div');
+        overlay.className = 'chat-confirm-overlay';
+        overlay.innerHTML =
+            '<div class="chat-confirm-dialog chat-correction-dialog">' +
+                '<p>' + escapeHtml(i18n.t('chat_correction_title')) + '</p>' +
+                '<label>' + escapeHtml(i18n.t('chat_correction_sentence')) + '</label>' +
+                '<textarea class="chat-correction-sentence" rows="3" maxlength="1000" placeholder="' + escapeHtml(i18n.t('chat_correction_sentence_placeholder')) + '"></textarea>' +
+                '<label>' + escapeHtml(i18n.t('chat_correction_suggestion')) + '</label>' +
+                '<textarea class="chat-correction-suggestion" rows="3" maxlength="2000" placeholder="' + escapeHtml(i18n.t('chat_correction_suggestion_placeholder')) + '"></textarea>' +
+                (cited.length ? '<label>' + escapeHtml(i18n.t('chat_correction_source')) + '</label><select class="chat-correction-source">' + srcOptions + '</select>' : '') +
+                '<div class="chat-confirm-actions">' +
+                    '<button class="chat-confirm-yes">' + i18n.t('chat_correction_submit') + '</button>' +
+                    '<button class="chat-confirm-no">' + i18n.t('chat_not_satisfied_confirm_no') + '</button>' +
+                '</div>' +
+            '</div>';
+        document.body.appendChild(overlay);
+        var sentenceEl = overlay.querySelector('.chat-correction-sentence');
+        sentenceEl.value = selected.slice(0, 1000);
+        sentenceEl.focus();
+
+        overlay.querySelector('.chat-confirm-no').onclick = function () {
+            document.body.removeChild(overlay);
+        };
+        var submitBtn = overlay.querySelector('.chat-confirm-yes');
+        submitBtn.onclick = function () {
+            var sentence = sentenceEl.value.trim();
+            if (!sentence) {
+                showChatToast(i18n.t('chat_correction_sentence_required'), 'error');
+                return;
+            }
+            var body = {
+                query_id: msg.queryId,
+                sentence: sentence,
+                suggestion: overlay.querySelector('.chat-correction-suggestion').value.trim()
+            };
+            var srcSel = overlay.querySelector('.chat-correction-source');
+            if (srcSel && srcSel.value !== '') {
+                var chosen = cited[parseInt(srcSel.value, 10)];
+                body.document_id = chosen.document_id;
+                body.chunk_index = chosen.chunk_index || 0;
+            }
+            submitBtn.disabled = true;
+            fetch('/api/query/correction', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json', 'Authorization': 'Bearer ' + getChatToken() },
+                body: JSON.stringify(body)
+            }).then(function (res) {
+                return res.json().catch(function () { return {}; }).then(function (data) {
+                    if (!res.ok) throw new Error(data.error || i18n.t('chat_correction_failed'));
+                });
+            }).then(function () {
+                document.body.removeChild(overlay);
+                showChatToast(i18n.t('chat_correction_success'), 'success');
+            }).catch(function (err) {
+                submitBtn.disabled = false;
+                showChatToast(err.message || i18n.t('chat_correction_failed'), 'error');
+            });
+        };
+    };
+
+    window.sendChatMessage = function () {
+        var input = document.getElementById('chat-input');
+        var sendBtn = document.getElementById('chat-send-btn');
+        if (!input) return;
+
+        var question = input.value.trim();
+        var imageData = chatPendingImage;
+        if ((!question && !imageData) || chatLoading) return;
+
+        // Default question text if only image
+        if (!question && imageData) {
+            question = i18n.t('chat_image_recognize');
+        }
+
+        // Add user message
+        var userMsg = {
+            role: 'user',
+            content: question,
+            timestamp: Date.now()
+        };
+        if (imageData) {
+            userMsg.imageUrl = imageData;
+        }
+        chatMessages.push(userMsg);
+
+        // Clear input, image, and reset height
+        var chatPreview = document.getElementById('chat-image-preview');
+        var hadImage = !!imageData;
+        input.value = '';
+        input.style.height = 'auto';
+        chatPendingImage = null;
+        if (sendBtn) sendBtn.disabled = true;
+
+        // Always hide the chat image preview immediately after sending
+        if (chatPreview) chatPreview.classList.add('hidden');
+
+        // Show loading
+        chatLoading = true;
+        renderChatMessages();
+
+        // Build request body
+        var reqBody = {
+            question: question,
+            user_id: getChatUserID(),
+            product_id: localStorage.getItem('askflow_product_id') || '',
+            ticket: newQueueTicket()
+        };
+        if (imageData) {
+            reqBody.image_data = imageData;
+        }
+        var stopQueueWatch = watchQueuePosition(reqBody.ticket);
+        var debugToken = sessionStorage.getItem('askflow_debug_token');
+        if (debugToken) reqBody.debug = true;
+
+        // Ask in parallel whether a troubleshooting flow fits the question
+        var flowRoute = imageData ? Promise.resolve(null) : routeChatFlow(question);
+
+        // Call API
+        var token = getChatToken();
+        var controller = new AbortController();
+        var timeoutId = setTimeout(function () { controller.abort(); }, 90000); // 90s timeout
+
+        var queryHeaders = {
+            'Content-Type': 'application/json',
+            'Authorization': 'Bearer ' + token
+        };
+        if (debugToken) queryHeaders['X-Debug-Token'] = debugToken;
+
+        fetch('/api/query', {
+            method: 'POST',
+            headers: queryHeaders,
+            body: JSON.stringify(reqBody),
+            signal: controller.signal
+        })
+        .then(function (res) {
+            showRateLimitWarning(res);
+            if (!res.ok) {
+                // Handle 401 Unauthorized - session expired or invalid
+                if (res.status === 401) {
+                    clearSession();
                     navigate('/login');
                     throw new Error(i18n.t('session_expired') || '会话已过期，请重新登录');
                 }
@@ -2018,13 +2744,21 @@
                 sources: data.sources || [],
                 isPending: !!data.is_pending,
                 allowDownload: !!data.allow_download,
+                faithfulness: data.faithfulness || null,
                 debugInfo: data.debug_info || null,
+                queryId: data.query_id || '',
+                degraded: !!data.degraded,
+                budgetLimited: !!data.budget_limited,
                 timestamp: Date.now()
             };
+            setDegradedBanner(msg.degraded);
             if (data.is_pending) {
                 msg.content = data.message || i18n.t('chat_pending_message');
             }
-            chatMessages.push(msg);
+            return flowRoute.then(function (flow) {
+                if (flow) msg.suggestedFlow = { id: flow.id, title: flow.title };
+                chatMessages.push(msg);
+            });
         })
         .catch(function (err) {
             var errMsg = err.name === 'AbortError'
@@ -2041,6 +2775,7 @@
         })
         .finally(function () {
             clearTimeout(timeoutId);
+            stopQueueWatch();
             chatLoading = false;
             renderChatMessages();
             updateSendBtnState();
@@ -2084,20 +2819,10 @@
     }
 
     function downloadDocument(docId, fileName) {
-        adminFetch('/api/documents/' + encodeURIComponent(docId) + '/download')
-            .then(function(resp) {
-                if (!resp.ok) throw new Error('Download failed');
-                return resp.blob();
-            })
-            .then(function(blob) {
-                var url = URL.createObjectURL(blob);
-                var a = document.createElement('a');
-                a.href = url;
-                a.download = fileName || 'document';
-                document.body.appendChild(a);
-                a.click();
-                document.body.removeChild(a);
-                URL.revokeObjectURL(url);
+        var path = '/api/documents/' + encodeURIComponent(docId) + '/download';
+        requestOperationToken(path, getAdminToken())
+            .then(function(token) {
+                startLinkDownload(path + '?op_token=' + encodeURIComponent(token), fileName || 'document');
             })
             .catch(function(err) {
                 showAdminToast('Download failed: ' + err.message, 'error');
@@ -2134,10 +2859,12 @@
         // Auto-refresh data on tab switch
         if (tab === 'documents') { loadAdminProductSelectors().then(function() { loadDocumentList(); }); }
         if (tab === 'pending') loadPendingQuestions();
-        if (tab === 'knowledge') loadAdminProductSelectors();
+        if (tab === 'review') { loadReviewers(); loadReviewQueue(); }
+        if (tab === 'corrections') loadCorrections();
+        if (tab === 'knowledge') loadAdminProductSelectors().then(function () { loadAdminAnnouncements(); loadAdminKnowledgeEntries(); });
         if (tab === 'settings') { loadAdminSettings(); i18n.applyI18nToPage(); }
         if (tab === 'multimodal') { loadMultimodalSettings(); i18n.applyI18nToPage(); }
-        if (tab === 'users') { loadAdminUsers(); loadProductCheckboxes(); i18n.applyI18nToPage(); }
+        if (tab === 'users') { loadAdminUsers(); loadAPIKeys(); loadProductCheckboxes(); i18n.applyI18nToPage(); }
         if (tab === 'products') { loadProducts(); i18n.applyI18nToPage(); }
         if (tab === 'bans') loadLoginBans();
         if (tab === 'customers') { loadAdminCustomers(); i18n.applyI18nToPage(); }
@@ -2167,6 +2894,12 @@
         // Auto-load logs when switching to logs tab
         if (tabId === 'settings-logs') {
             loadRecentLogs();
+            loadMaintenanceStatus();
+            loadExportStatus();
+            loadBudgetStatus();
+            loadBackupHistory();
+            loadJobs();
+            loadReplaySamples();
         }
     };
 
@@ -2427,7 +3160,18 @@
                 applyAdminRoleVisibility();
             })
             .finally(function () {
-                switchAdminTab('documents');
+                // Deep link: /admin-panel?tab=pending&question=<id> opens the answer dialog
+                var link = new URLSearchParams(window.location.search);
+                if (!link.get('tab')) link = new URLSearchParams(sessionStorage.getItem('admin_deep_link') || '');
+                sessionStorage.removeItem('admin_deep_link');
+                if (link.get('tab') === 'pending') {
+                    pendingFocusID = link.get('question');
+                    switchAdminTab('pending');
+                } else if (link.get('tab') === 'knowledge') {
+                    switchAdminTab('knowledge');
+                } else {
+                    switchAdminTab('documents');
+                }
             });
     }
 
@@ -2560,6 +3304,8 @@
         var formData = new FormData();
         formData.append('file', file);
         formData.append('product_id', getDocProductID());
+        var callRecording = document.getElementById('admin-call-recording');
+        if (callRecording && callRecording.checked) formData.append('call_recording', 'true');
 
         showAdminToast(i18n.t('admin_doc_uploading', { name: file.name }), 'info');
 
@@ -2660,6 +3406,16 @@
             var previewArea = document.getElementById('admin-url-preview-area');
             var previewContent = document.getElementById('admin-url-preview-content');
             if (previewContent) previewContent.textContent = data.text || '';
+            var estimateEl = document.getElementById('admin-url-preview-estimate');
+            if (estimateEl) {
+                var est = data.estimate;
+                if (est && est.duplicate_of) {
+                    estimateEl.textContent = i18n.t('admin_doc_url_duplicate', { id: est.duplicate_of });
+                } else if (est) {
+                    estimateEl.textContent = i18n.t('admin_doc_url_estimate', { chunks: est.chunks, tokens: est.embedding_tokens, cost: est.cost.toFixed(4) });
+                }
+                estimateEl.classList.toggle('hidden', !est);
+            }
             if (previewArea) previewArea.classList.remove('hidden');
             showAdminToast(i18n.t('admin_doc_url_fetched'), 'success');
         })
@@ -2717,6 +3473,63 @@
         if (previewArea) previewArea.classList.add('hidden');
     };
 
+    // --- Site crawl: imports the pages reachable from the URL field, streaming progress ---
+    window.startAdminCrawl = function () {
+        var url = (getVal('admin-url-field') || '').trim();
+        if (!url) {
+            showAdminToast(i18n.t('admin_doc_crawl_url_required'), 'error');
+            return;
+        }
+        var btn = document.getElementById('admin-crawl-btn');
+        var statusEl = document.getElementById('admin-crawl-status');
+        var logEl = document.getElementById('admin-crawl-log');
+        btn.disabled = true;
+        btn.textContent = i18n.t('admin_doc_crawl_running');
+        statusEl.textContent = '';
+        logEl.innerHTML = '';
+        logEl.classList.remove('hidden');
+
+        var body = {
+            url: url,
+            product_id: getDocProductID(),
+            max_depth: parseInt(getVal('admin-crawl-depth'), 10) || 0,
+            max_pages: parseInt(getVal('admin-crawl-max-pages'), 10) || 0,
+            delay_ms: parseInt(getVal('admin-crawl-delay'), 10) || 0,
+            include: splitPatterns(getVal('admin-crawl-include')),
+            exclude: splitPatterns(getVal('admin-crawl-exclude'))
+        };
+        adminFetch('/api/documents/crawl', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        }).then(function (response) {
+            return readBatchSSE(response, function (event, data) {
+                if (event === 'progress') {
+                    statusEl.textContent = i18n.t('admin_doc_crawl_progress', { fetched: data.fetched, queued: data.queued });
+                    var item = document.createElement('div');
+                    item.className = 'log-item';
+                    if (data.status === 'imported') item.className += ' log-success';
+                    if (data.status === 'failed') item.className += ' log-failed';
+                    item.textContent = '[' + data.fetched + '] ' + data.url + ' — ' +
+                        i18n.t('admin_doc_crawl_status_' + data.status) + (data.error ? ': ' + data.error : '');
+                    logEl.appendChild(item);
+                    logEl.scrollTop = logEl.scrollHeight;
+                } else if (event === 'done') {
+                    statusEl.textContent = data.canceled ? i18n.t('admin_doc_crawl_canceled') : i18n.t('admin_doc_crawl_done', data);
+                    loadDocumentList();
+                } else if (event === 'error') {
+                    statusEl.textContent = data.message || '';
+                    showAdminToast(i18n.t('admin_doc_crawl_failed') + ': ' + (data.message || ''), 'error');
+                }
+            });
+        }).catch(function (err) {
+            showAdminToast(i18n.t('admin_doc_crawl_failed') + ': ' + err.message, 'error');
+        }).finally(function () {
+            btn.disabled = false;
+            btn.textContent = i18n.t('admin_doc_crawl_start');
+        });
+    };
+
     // --- Admin Product Selectors (for documents & knowledge) ---
 
     var adminProductsCache = null;
@@ -2728,6 +3541,8 @@
                 adminProductsCache = data.products || [];
                 populateProductSelect('doc-product-select', adminProductsCache);
                 populateProductSelect('knowledge-product-select', adminProductsCache);
+                populateProductSelect('announcement-product-select', adminProductsCache);
+                populateProductSelect('template-product-select', adminProductsCache);
             })
             .catch(function () {
                 adminProductsCache = [];
@@ -2740,9 +3555,12 @@
         var currentVal = select.value;
         select.innerHTML = '<option value="">' + i18n.t('admin_doc_product_public') + '</option>';
         for (var i = 0; i < products.length; i++) {
+            // Archived products take no new knowledge; documents stay browsable
+            if (products[i].archived_at && selectId !== 'doc-product-select') continue;
             var opt = document.createElement('option');
             opt.value = products[i].id;
             opt.textContent = products[i].name;
+            if (products[i].archived_at) opt.textContent += i18n.t('admin_products_archived_suffix');
             select.appendChild(opt);
         }
         // Restore previous selection if still valid
@@ -2779,9 +3597,28 @@
     function loadDocumentList() {
         if (_docListLoading) return;
         _docListLoading = true;
-        var url = '/api/documents';
+        var params = [];
         var pid = getDocProductID();
-        if (pid) url += '?product_id=' + encodeURIComponent(pid);
+        if (pid) params.push('product_id=' + encodeURIComponent(pid));
+        var sortSelect = document.getElementById('admin-doc-sort');
+        if (sortSelect) {
+            if (!sortSelect._boundChange) {
+                sortSelect._boundChange = true;
+                sortSelect.addEventListener('change', function () { loadDocumentList(); });
+            }
+            if (sortSelect.value) params.push('sort=' + encodeURIComponent(sortSelect.value));
+        }
+        ['admin-doc-category', 'admin-doc-tag'].forEach(function (id) {
+            var filterSelect = document.getElementById(id);
+            if (!filterSelect) return;
+            if (!filterSelect._boundChange) {
+                filterSelect._boundChange = true;
+                filterSelect.addEventListener('change', function () { loadDocumentList(); });
+            }
+            if (filterSelect.value) params.push((id === 'admin-doc-tag' ? 'tag=' : 'category=') + encodeURIComponent(filterSelect.value));
+        });
+        loadDocumentTagOptions(pid);
+        var url = '/api/documents' + (params.length ? '?' + params.join('&') : '');
         adminFetch(url)
             .then(function (res) {
                 if (!res.ok) throw new Error(i18n.t('admin_doc_load_failed'));
@@ -2801,6 +3638,54 @@
             });
     }
 
+    // Fill the tag filter with the topic tags and product mentions in use,
+    // keeping the current selection.
+    function loadDocumentTagOptions(pid) {
+        var tagSelect = document.getElementById('admin-doc-tag');
+        if (!tagSelect) return;
+        adminFetch('/api/documents/tags' + (pid ? '?product_id=' + encodeURIComponent(pid) : ''))
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_doc_tags_failed'));
+                return res.json();
+            })
+            .then(function (data) {
+                var current = tagSelect.value;
+                var tags = (data.product_mentions || []).concat(data.tags || []);
+                var html = '<option value="">' + escapeHtml(i18n.t('admin_doc_tag_all')) + '</option>';
+                var seen = {};
+                for (var i = 0; i < tags.length; i++) {
+                    var key = tags[i].tag.toLowerCase();
+                    if (seen[key]) continue;
+                    seen[key] = true;
+                    html += '<option value="' + escapeHtml(tags[i].tag) + '">' + escapeHtml(tags[i].tag) + ' (' + tags[i].count + ')</option>';
+                }
+                if (current && !seen[current.toLowerCase()]) {
+                    html += '<option value="' + escapeHtml(current) + '">' + escapeHtml(current) + '</option>';
+                }
+                tagSelect.innerHTML = html;
+                tagSelect.value = current;
+            })
+            .catch(function () {});
+    }
+
+    // Re-run LLM tagging of a document.
+    window.retagDocument = function (docId) {
+        adminFetch('/api/documents/' + encodeURIComponent(docId) + '/tags', { method: 'POST' })
+            .then(function (res) {
+                return res.json().then(function (data) {
+                    if (!res.ok) throw new Error(data.error || i18n.t('admin_doc_retag_failed'));
+                    return data;
+                });
+            })
+            .then(function () {
+                showAdminToast(i18n.t('admin_doc_retag_success'), 'success');
+                loadDocumentList();
+            })
+            .catch(function (e) {
+                showAdminToast(e.message || i18n.t('admin_doc_retag_failed'), 'error');
+            });
+    };
+
     function scheduleDocPoll(docs) {
         if (_docPollTimer) { clearTimeout(_docPollTimer); _docPollTimer = null; }
         var hasProcessing = false;
@@ -2825,10 +3710,46 @@
         for (var i = 0; i < docs.length; i++) {
             var doc = docs[i];
             var statusClass = 'admin-badge-' + (doc.status || 'processing');
-            var statusMap = { processing: i18n.t('admin_doc_status_processing'), success: i18n.t('admin_doc_status_success'), failed: i18n.t('admin_doc_status_failed') };
+            var statusMap = { processing: i18n.t('admin_doc_status_processing'), success: i18n.t('admin_doc_status_success'), failed: i18n.t('admin_doc_status_failed'), quarantined: i18n.t('admin_doc_status_quarantined') };
             var statusText = statusMap[doc.status] || doc.status;
+            if (doc.status === 'processing' && doc.estimated_completion) {
+                var remainMin = Math.ceil((new Date(doc.estimated_completion) - Date.now()) / 60000);
+                statusText += ' · ' + (remainMin > 0 ? i18n.t('admin_doc_eta_minutes', { n: remainMin }) : i18n.t('admin_doc_eta_soon'));
+                if (doc.queue_position > 1) statusText += ' · ' + i18n.t('admin_doc_queue_position', { n: doc.queue_position });
+            }
             var timeStr = doc.created_at ? new Date(doc.created_at).toLocaleString(i18n.getLang()) : '-';
             var productName = getProductNameByID(doc.product_id || '');
+            var effectiveHtml = '';
+            if (doc.effective_from || doc.effective_until) {
+                var today = new Date().toISOString().slice(0, 10);
+                var expired = (doc.effective_from && doc.effective_from > today) || (doc.effective_until && doc.effective_until < today);
+                effectiveHtml = '<div class="admin-doc-effective" style="font-size:0.8em;color:' + (expired ? '#c0392b' : '#888') + '">' +
+                    escapeHtml(i18n.t('admin_doc_effective_period', { from: doc.effective_from || '…', until: doc.effective_until || '…' })) +
+                    (expired ? ' · ' + escapeHtml(i18n.t('admin_doc_effective_inactive')) : '') + '</div>';
+            }
+            effectiveHtml += scheduleSummaryHtml(doc);
+
+            var reviewHtml = '';
+            if (doc.review_status === 'draft' || doc.review_status === 'in_review') {
+                reviewHtml = ' <span class="admin-badge admin-badge-' + doc.review_status + '">' + escapeHtml(i18n.t('admin_review_status_' + doc.review_status)) + '</span>';
+            }
+            var usageHtml = '';
+            if (doc.cited_count || doc.click_count) {
+                usageHtml = '<div class="admin-doc-usage" style="font-size:0.8em;color:#888">' +
+                    escapeHtml(i18n.t('admin_doc_usage', { cited: doc.cited_count || 0, clicked: doc.click_count || 0 }));
+                if (doc.last_cited_at) {
+                    usageHtml += ' · ' + escapeHtml(i18n.t('admin_doc_last_cited', { time: new Date(doc.last_cited_at).toLocaleDateString(i18n.getLang()) }));
+                }
+                usageHtml += ' · <a href="javascript:void(0)" data-doc-id="' + escapeHtml(doc.id) + '" onclick="showDocCitations(this.dataset.docId, this)">' + escapeHtml(i18n.t('admin_doc_citations_btn')) + '</a></div>';
+            }
+
+            var tagsHtml = '';
+            if (doc.language || doc.category || (doc.tags && doc.tags.length) || (doc.product_mentions && doc.product_mentions.length)) {
+                tagsHtml = '<div class="admin-doc-tags" style="font-size:0.8em;color:#888">';
+                if (doc.language) tagsHtml += '<span class="admin-badge" title="' + escapeHtml(i18n.t('admin_doc_language')) + '">' + escapeHtml(doc.language.toUpperCase()) + '</span> ';
+                if (doc.category) tagsHtml += '<span class="admin-badge">' + escapeHtml(i18n.t('admin_doc_category_' + doc.category)) + '</span> ';
+                tagsHtml += escapeHtml((doc.product_mentions || []).concat(doc.tags || []).join(' · ')) + '</div>';
+            }
 
             var nameCell = '';
             if (doc.type === 'url') {
@@ -2840,10 +3761,10 @@
             }
 
             html += '<tr>' +
-                '<td>' + nameCell + '</td>' +
+                '<td>' + nameCell + tagsHtml + '</td>' +
                 '<td>' + escapeHtml(productName) + '</td>' +
                 '<td>' + escapeHtml(doc.type || '-') + '</td>' +
-                '<td><span class="admin-badge ' + statusClass + '">' + escapeHtml(statusText) + '</span></td>' +
+                '<td><span class="admin-badge ' + statusClass + '">' + escapeHtml(statusText) + '</span>' + reviewHtml + effectiveHtml + usageHtml + '</td>' +
                 '<td>' + escapeHtml(timeStr) + '</td>' +
                 '<td>';
 
@@ -2851,6 +3772,17 @@
             if (doc.status === 'success') {
                 html += '<button class="btn-primary btn-sm" style="margin-right:0.25rem" data-doc-id="' + escapeHtml(doc.id) + '" data-doc-name="' + escapeHtml(doc.name || '') + '" onclick="showReviewDialog(this.dataset.docId, this.dataset.docName)">' + i18n.t('admin_doc_review_btn') + '</button>';
             }
+            if (doc.status === 'success') {
+                html += '<button class="btn-secondary btn-sm" style="margin-right:0.25rem" data-doc-id="' + escapeHtml(doc.id) + '" onclick="retagDocument(this.dataset.docId)">' + i18n.t('admin_doc_retag_btn') + '</button>';
+            }
+            if (doc.status === 'success' && REPLACEABLE_DOC_TYPES[doc.type]) {
+                html += '<button class="btn-secondary btn-sm" style="margin-right:0.25rem" data-doc-id="' + escapeHtml(doc.id) + '" data-doc-name="' + escapeHtml(doc.name || '') + '" onclick="showVersionsDialog(this.dataset.docId, this.dataset.docName)">' + i18n.t('admin_doc_versions_btn') + '</button>';
+            }
+            if (doc.status === 'success') {
+                html += '<button class="btn-secondary btn-sm" style="margin-right:0.25rem" data-doc-id="' + escapeHtml(doc.id) + '" data-doc-name="' + escapeHtml(doc.name || '') + '" onclick="showChunksDialog(this.dataset.docId, this.dataset.docName)">' + i18n.t('admin_doc_chunks_btn') + '</button>';
+            }
+            html += '<button class="btn-secondary btn-sm" style="margin-right:0.25rem" data-doc-id="' + escapeHtml(doc.id) + '" data-doc-name="' + escapeHtml(doc.name || '') + '" data-from="' + escapeHtml(doc.effective_from || '') + '" data-until="' + escapeHtml(doc.effective_until || '') + '" onclick="showEffectiveDialog(this.dataset)">' + i18n.t('admin_doc_effective_btn') + '</button>';
+            html += '<button class="btn-secondary btn-sm" style="margin-right:0.25rem" data-doc-id="' + escapeHtml(doc.id) + '" data-doc-name="' + escapeHtml(doc.name || '') + '" data-publish="' + escapeHtml(doc.publish_at || '') + '" data-unpublish="' + escapeHtml(doc.unpublish_at || '') + '" onclick="showScheduleDialog(this.dataset)">' + i18n.t('admin_schedule_btn') + '</button>';
 
             html += '<button class="btn-danger btn-sm" onclick="showDeleteDialog(\'' + escapeHtml(doc.id) + '\', \'' + escapeHtml(doc.name || '') + '\')">' + i18n.t('admin_doc_delete_btn') + '</button>' +
                 '</td>' +
@@ -2859,6 +3791,34 @@
         tbody.innerHTML = html;
     }
 
+    // Toggle the per-chunk citation stats of a document below its usage line.
+    window.showDocCitations = function (docId, link) {
+        var box = link.parentNode;
+        var existing = box.querySelector('.admin-doc-citations');
+        if (existing) { box.removeChild(existing); return; }
+        adminFetch('/api/documents/' + encodeURIComponent(docId) + '/citations')
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_doc_citations_failed'));
+                return res.json();
+            })
+            .then(function (data) {
+                var chunks = data.chunks || [];
+                var list = document.createElement('ul');
+                list.className = 'admin-doc-citations';
+                list.style.margin = '0.25rem 0 0 1rem';
+                for (var i = 0; i < chunks.length; i++) {
+                    var li = document.createElement('li');
+                    li.textContent = i18n.t('admin_doc_citation_chunk', { n: chunks[i].chunk_index + 1, cited: chunks[i].cited, clicked: chunks[i].clicked }) +
+                        (chunks[i].snippet ? ' — ' + chunks[i].snippet : '');
+                    list.appendChild(li);
+                }
+                box.appendChild(list);
+            })
+            .catch(function (e) {
+                showAdminToast(e.message || i18n.t('admin_doc_citations_failed'), 'error');
+            });
+    };
+
     // --- Delete Document ---
 
     window.showDeleteDialog = function (docId, docName) {
@@ -2893,53 +3853,459 @@
         });
     };
 
-    // --- Document Review ---
+    // --- Document Versions ---
 
-    window.showReviewDialog = function (docId, docName) {
-        var dialog = document.getElementById('admin-review-dialog');
-        var content = document.getElementById('admin-review-content');
-        var title = document.getElementById('admin-review-title');
-        if (!dialog || !content) return;
+    // Document types that can be replaced by a new file (not URLs, entries, videos or recordings)
+    var REPLACEABLE_DOC_TYPES = { pdf: true, word: true, excel: true, ppt: true, markdown: true, html: true };
+    var adminVersionsTargetId = null;
 
-        title.textContent = i18n.t('admin_doc_review_title') + ' - ' + docName;
-        content.innerHTML = '<p>' + i18n.t('admin_doc_review_loading') + '</p>';
-        dialog.classList.remove('hidden');
+    window.showVersionsDialog = function (docId, docName) {
+        adminVersionsTargetId = docId;
+        var title = document.getElementById('admin-versions-title');
+        if (title) title.textContent = i18n.t('admin_doc_versions_title') + ' - ' + docName;
+        document.getElementById('admin-versions-file').value = '';
+        document.getElementById('admin-versions-note').value = '';
+        var dialog = document.getElementById('admin-versions-dialog');
+        if (dialog) dialog.classList.remove('hidden');
+        loadDocumentVersions();
+    };
 
-        // Close on overlay click
-        dialog.onclick = function (e) {
-            if (e.target === dialog) closeReviewDialog();
-        };
+    window.closeVersionsDialog = function () {
+        adminVersionsTargetId = null;
+        var dialog = document.getElementById('admin-versions-dialog');
+        if (dialog) dialog.classList.add('hidden');
+    };
 
-        adminFetch('/api/documents/' + encodeURIComponent(docId) + '/review')
+    function loadDocumentVersions() {
+        var list = document.getElementById('admin-versions-list');
+        if (!list || !adminVersionsTargetId) return;
+        list.innerHTML = '<p style="color:#888">' + escapeHtml(i18n.t('admin_doc_versions_loading')) + '</p>';
+        adminFetch('/api/documents/' + encodeURIComponent(adminVersionsTargetId) + '/versions')
             .then(function (res) {
-                if (!res.ok) throw new Error(i18n.t('admin_doc_review_load_failed'));
+                if (!res.ok) throw new Error(i18n.t('admin_doc_versions_load_failed'));
                 return res.json();
             })
             .then(function (data) {
-                renderReviewContent(content, data);
+                var versions = data.versions || [];
+                if (versions.length === 0) {
+                    list.innerHTML = '<p style="color:#888">' + escapeHtml(i18n.t('admin_doc_versions_empty')) + '</p>';
+                    return;
+                }
+                var html = '<table class="admin-table"><tbody>';
+                for (var i = 0; i < versions.length; i++) {
+                    var v = versions[i];
+                    var state = v.current ? i18n.t('admin_doc_versions_current') : i18n.t('admin_doc_versions_status_' + v.status);
+                    html += '<tr><td>v' + v.version + '</td>' +
+                        '<td>' + escapeHtml(v.name) + (v.note ? '<div style="font-size:0.8em;color:#888">' + escapeHtml(v.note) + '</div>' : '') +
+                        (v.error ? '<div style="font-size:0.8em;color:#c0392b">' + escapeHtml(v.error) + '</div>' : '') + '</td>' +
+                        '<td>' + escapeHtml(new Date(v.created_at).toLocaleString(i18n.getLang())) + '</td>' +
+                        '<td>' + escapeHtml(state) + '</td><td>';
+                    if (!v.current && v.status === 'success') {
+                        html += '<button class="btn-secondary btn-sm" data-version="' + v.version + '" onclick="restoreDocumentVersion(this.dataset.version)">' + escapeHtml(i18n.t('admin_doc_versions_restore')) + '</button>';
+                    }
+                    html += '</td></tr>';
+                }
+                list.innerHTML = html + '</tbody></table>';
             })
             .catch(function (err) {
-                content.innerHTML = '<p class="review-empty">' + escapeHtml(err.message) + '</p>';
+                list.innerHTML = '<p style="color:#c0392b">' + escapeHtml(err.message || i18n.t('admin_doc_versions_load_failed')) + '</p>';
             });
-    };
-
-    window.closeReviewDialog = function () {
-        var dialog = document.getElementById('admin-review-dialog');
-        if (dialog) dialog.classList.add('hidden');
-    };
+    }
 
-    function formatReviewTime(seconds) {
-        if (seconds === undefined || seconds === null) return '';
-        var m = Math.floor(seconds / 60);
-        var s = Math.floor(seconds % 60);
-        return (m < 10 ? '0' : '') + m + ':' + (s < 10 ? '0' : '') + s;
+    // Show the outcome of a replace or restore request and refresh the lists.
+    function handleVersionResponse(res) {
+        return res.json().then(function (data) {
+            if (!res.ok) throw new Error(data.error || i18n.t('admin_doc_versions_failed'));
+            if (data.status === 'failed') {
+                showAdminToast(i18n.t('admin_doc_versions_failed') + ': ' + (data.error || ''), 'error');
+            } else if (data.status === 'processing') {
+                showAdminToast(i18n.t('admin_doc_versions_processing'), 'info');
+            } else {
+                showAdminToast(i18n.t('admin_doc_versions_replaced'), 'success');
+            }
+            loadDocumentVersions();
+            loadDocumentList();
+        });
     }
 
-    function cleanTranscriptNoise(text) {
-        if (!text) return text;
-        // Remove lines that are rs-cli log noise (for old data that wasn't cleaned server-side)
-        var lines = text.split('\n');
-        var cleaned = [];
+    window.uploadDocumentVersion = function () {
+        if (!adminVersionsTargetId) return;
+        var input = document.getElementById('admin-versions-file');
+        var file = input && input.files && input.files[0];
+        if (!file) {
+            showAdminToast(i18n.t('admin_doc_versions_no_file'), 'error');
+            return;
+        }
+        var formData = new FormData();
+        formData.append('file', file);
+        formData.append('note', document.getElementById('admin-versions-note').value.trim());
+        var btn = document.getElementById('admin-versions-upload-btn');
+        if (btn) btn.disabled = true;
+        adminFetch('/api/documents/' + encodeURIComponent(adminVersionsTargetId) + '/replace', {
+            method: 'POST',
+            body: formData
+        })
+        .then(handleVersionResponse)
+        .then(function () {
+            input.value = '';
+            document.getElementById('admin-versions-note').value = '';
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_doc_versions_failed'), 'error');
+        })
+        .then(function () {
+            if (btn) btn.disabled = false;
+        });
+    };
+
+    window.restoreDocumentVersion = function (version) {
+        if (!adminVersionsTargetId) return;
+        if (!confirm(i18n.t('admin_doc_versions_restore_confirm', { n: version }))) return;
+        adminFetch('/api/documents/' + encodeURIComponent(adminVersionsTargetId) + '/versions/' + encodeURIComponent(version) + '/restore', {
+            method: 'POST'
+        })
+        .then(handleVersionResponse)
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_doc_versions_failed'), 'error');
+        });
+    };
+
+    // --- Query Debug Links ---
+
+    window.issueDebugLink = function () {
+        var out = document.getElementById('cfg-debug-token-link');
+        adminFetch('/api/admin/debug-token', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ minutes: 60 })
+        })
+        .then(function (res) {
+            return res.json().then(function (data) {
+                if (!res.ok) throw new Error(data.error || i18n.t('admin_settings_debug_token_failed'));
+                return data;
+            });
+        })
+        .then(function (data) {
+            out.value = window.location.origin + '/chat?debug_token=' + encodeURIComponent(data.token);
+            out.classList.remove('hidden');
+            out.select();
+            showAdminToast(i18n.t('admin_settings_debug_token_issued', { time: new Date(data.expires_at).toLocaleString(i18n.getLang()) }), 'success');
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_settings_debug_token_failed'), 'error');
+        });
+    };
+
+    // --- Document Chunks ---
+
+    var adminChunksTargetId = null;
+    var adminChunksCache = [];
+
+    window.showChunksDialog = function (docId, docName) {
+        adminChunksTargetId = docId;
+        adminChunksCache = [];
+        var title = document.getElementById('admin-chunks-title');
+        if (title) title.textContent = i18n.t('admin_doc_chunks_title') + ' - ' + docName;
+        document.getElementById('admin-chunks-filter').value = '';
+        var dialog = document.getElementById('admin-chunks-dialog');
+        if (dialog) dialog.classList.remove('hidden');
+        loadDocumentChunks();
+    };
+
+    window.closeChunksDialog = function () {
+        adminChunksTargetId = null;
+        adminChunksCache = [];
+        var dialog = document.getElementById('admin-chunks-dialog');
+        if (dialog) dialog.classList.add('hidden');
+    };
+
+    function loadDocumentChunks() {
+        var list = document.getElementById('admin-chunks-list');
+        if (!list || !adminChunksTargetId) return;
+        list.innerHTML = '<p style="color:#888">' + escapeHtml(i18n.t('admin_doc_versions_loading')) + '</p>';
+        adminFetch('/api/documents/' + encodeURIComponent(adminChunksTargetId) + '/chunks')
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_doc_chunks_load_failed'));
+                return res.json();
+            })
+            .then(function (data) {
+                adminChunksCache = data.chunks || [];
+                renderDocumentChunks();
+            })
+            .catch(function (err) {
+                list.innerHTML = '<p style="color:#c0392b">' + escapeHtml(err.message || i18n.t('admin_doc_chunks_load_failed')) + '</p>';
+            });
+    }
+
+    window.renderDocumentChunks = function () {
+        var list = document.getElementById('admin-chunks-list');
+        if (!list) return;
+        var filter = (document.getElementById('admin-chunks-filter').value || '').trim().toLowerCase();
+        var html = '';
+        var shown = 0;
+        for (var i = 0; i < adminChunksCache.length; i++) {
+            var c = adminChunksCache[i];
+            if (filter && c.text.toLowerCase().indexOf(filter) === -1) continue;
+            shown++;
+            var badges = '';
+            if (c.source_index !== undefined && c.source_index !== null) {
+                badges += '<span class="admin-chunk-badge">' + escapeHtml(i18n.t('admin_doc_chunks_translation', { n: c.source_index })) + '</span>';
+            }
+            if (c.image_url) {
+                badges += '<span class="admin-chunk-badge">' + escapeHtml(i18n.t('admin_doc_chunks_image')) + '</span>';
+            }
+            html += '<div class="admin-chunk" id="admin-chunk-' + c.index + '">' +
+                '<div class="admin-chunk-head"><strong>#' + c.index + '</strong>' + badges + '<span class="admin-chunk-actions">' +
+                (c.editable ? '<button class="btn-secondary btn-sm" data-index="' + c.index + '" onclick="editDocumentChunk(this.dataset.index)">' + escapeHtml(i18n.t('admin_doc_chunks_edit')) + '</button> ' : '') +
+                '<button class="btn-danger btn-sm" data-index="' + c.index + '" onclick="deleteDocumentChunk(this.dataset.index)">' + escapeHtml(i18n.t('admin_doc_delete_btn')) + '</button>' +
+                '</span></div>' +
+                (c.image_url ? '<img class="admin-chunk-image" src="' + escapeHtml(c.image_url) + '" alt="">' : '') +
+                '<div class="admin-chunk-text">' + escapeHtml(c.text) + '</div>' +
+            '</div>';
+        }
+        if (shown === 0) {
+            html = '<p style="color:#888">' + escapeHtml(i18n.t('admin_doc_chunks_empty')) + '</p>';
+        }
+        list.innerHTML = html;
+    };
+
+    function findDocumentChunk(index) {
+        for (var i = 0; i < adminChunksCache.length; i++) {
+            if (adminChunksCache[i].index === Number(index)) return adminChunksCache[i];
+        }
+        return null;
+    }
+
+    window.editDocumentChunk = function (index) {
+        var c = findDocumentChunk(index);
+        var el = document.getElementById('admin-chunk-' + index);
+        if (!c || !el) return;
+        var textEl = el.querySelector('.admin-chunk-text');
+        textEl.innerHTML = '<textarea class="admin-input" rows="6" style="width:100%"></textarea>' +
+            '<div class="admin-chunk-edit-actions">' +
+            '<button class="btn-secondary btn-sm" onclick="renderDocumentChunks()">' + escapeHtml(i18n.t('admin_delete_cancel')) + '</button> ' +
+            '<button class="btn-primary btn-sm" data-index="' + c.index + '" onclick="saveDocumentChunk(this)">' + escapeHtml(i18n.t('admin_doc_effective_save')) + '</button>' +
+            '</div>';
+        var textarea = textEl.querySelector('textarea');
+        textarea.value = c.text;
+        textarea.focus();
+    };
+
+    window.saveDocumentChunk = function (btn) {
+        var index = Number(btn.dataset.index);
+        var el = document.getElementById('admin-chunk-' + index);
+        var text = el ? el.querySelector('textarea').value.trim() : '';
+        if (!adminChunksTargetId || !text) {
+            showAdminToast(i18n.t('admin_doc_chunks_text_empty'), 'error');
+            return;
+        }
+        btn.disabled = true;
+        adminFetch('/api/documents/' + encodeURIComponent(adminChunksTargetId) + '/chunks/' + index, {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ text: text })
+        })
+        .then(function (res) {
+            return res.json().then(function (data) {
+                if (!res.ok) throw new Error(data.error || i18n.t('admin_doc_chunks_save_failed'));
+                var c = findDocumentChunk(index);
+                if (c) c.text = data.text;
+                showAdminToast(i18n.t('admin_doc_chunks_saved'), 'success');
+                renderDocumentChunks();
+            });
+        })
+        .catch(function (err) {
+            btn.disabled = false;
+            showAdminToast(err.message || i18n.t('admin_doc_chunks_save_failed'), 'error');
+        });
+    };
+
+    window.deleteDocumentChunk = function (index) {
+        if (!adminChunksTargetId) return;
+        if (!confirm(i18n.t('admin_doc_chunks_delete_confirm', { n: index }))) return;
+        adminFetch('/api/documents/' + encodeURIComponent(adminChunksTargetId) + '/chunks/' + encodeURIComponent(index), {
+            method: 'DELETE'
+        })
+        .then(function (res) {
+            return res.json().then(function (data) {
+                if (!res.ok) throw new Error(data.error || i18n.t('admin_doc_chunks_delete_failed'));
+                adminChunksCache = adminChunksCache.filter(function (c) { return c.index !== Number(index); });
+                showAdminToast(i18n.t('admin_doc_chunks_deleted'), 'success');
+                renderDocumentChunks();
+            });
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_doc_chunks_delete_failed'), 'error');
+        });
+    };
+
+    // --- Document Effective Period ---
+
+    var adminEffectiveTargetId = null;
+
+    window.showEffectiveDialog = function (data) {
+        adminEffectiveTargetId = data.docId;
+        var title = document.getElementById('admin-effective-title');
+        if (title) title.textContent = i18n.t('admin_doc_effective_title') + ' - ' + data.docName;
+        document.getElementById('admin-effective-from').value = data.from || '';
+        document.getElementById('admin-effective-until').value = data.until || '';
+        var dialog = document.getElementById('admin-effective-dialog');
+        if (dialog) dialog.classList.remove('hidden');
+    };
+
+    window.closeEffectiveDialog = function () {
+        adminEffectiveTargetId = null;
+        var dialog = document.getElementById('admin-effective-dialog');
+        if (dialog) dialog.classList.add('hidden');
+    };
+
+    window.saveDocumentEffective = function () {
+        if (!adminEffectiveTargetId) return;
+        var docId = adminEffectiveTargetId;
+        var body = {
+            effective_from: document.getElementById('admin-effective-from').value,
+            effective_until: document.getElementById('admin-effective-until').value
+        };
+        adminFetch('/api/documents/' + encodeURIComponent(docId) + '/effective', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        })
+        .then(function (res) {
+            return res.json().then(function (data) {
+                if (!res.ok) throw new Error(data.error || i18n.t('admin_doc_effective_failed'));
+                return data;
+            });
+        })
+        .then(function () {
+            closeEffectiveDialog();
+            showAdminToast(i18n.t('admin_doc_effective_saved'), 'success');
+            loadDocumentList();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_doc_effective_failed'), 'error');
+        });
+    };
+
+    // --- Document Publish Schedule ---
+
+    // Schedule times are UTC RFC 3339 on the server and local time in
+    // datetime-local inputs.
+    function scheduleToInput(value) {
+        if (!value) return '';
+        var d = new Date(value);
+        if (isNaN(d.getTime())) return '';
+        return new Date(d.getTime() - d.getTimezoneOffset() * 60000).toISOString().slice(0, 16);
+    }
+
+    function scheduleFromInput(value) {
+        if (!value) return '';
+        var d = new Date(value);
+        return isNaN(d.getTime()) ? value : d.toISOString();
+    }
+
+    // One line describing the schedule of a document or knowledge entry.
+    function scheduleSummaryHtml(item) {
+        if (!item.schedule_state) return '';
+        var fmt = function (v) { return v ? new Date(v).toLocaleString(i18n.getLang()) : '…'; };
+        return '<div class="admin-doc-schedule" style="font-size:0.8em;color:' + (item.schedule_state === 'published' ? '#888' : '#c0392b') + '">' +
+            escapeHtml(i18n.t('admin_schedule_period', { from: fmt(item.publish_at), until: fmt(item.unpublish_at) })) +
+            ' · ' + escapeHtml(i18n.t('admin_schedule_state_' + item.schedule_state)) + '</div>';
+    }
+
+    var adminScheduleTargetId = null;
+
+    window.showScheduleDialog = function (data) {
+        adminScheduleTargetId = data.docId;
+        var title = document.getElementById('admin-schedule-title');
+        if (title) title.textContent = i18n.t('admin_schedule_title') + ' - ' + data.docName;
+        document.getElementById('admin-schedule-publish-at').value = scheduleToInput(data.publish);
+        document.getElementById('admin-schedule-unpublish-at').value = scheduleToInput(data.unpublish);
+        var dialog = document.getElementById('admin-schedule-dialog');
+        if (dialog) dialog.classList.remove('hidden');
+    };
+
+    window.closeScheduleDialog = function () {
+        adminScheduleTargetId = null;
+        var dialog = document.getElementById('admin-schedule-dialog');
+        if (dialog) dialog.classList.add('hidden');
+    };
+
+    window.saveDocumentSchedule = function () {
+        if (!adminScheduleTargetId) return;
+        var docId = adminScheduleTargetId;
+        var body = {
+            publish_at: scheduleFromInput(document.getElementById('admin-schedule-publish-at').value),
+            unpublish_at: scheduleFromInput(document.getElementById('admin-schedule-unpublish-at').value)
+        };
+        adminFetch('/api/documents/' + encodeURIComponent(docId) + '/schedule', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        })
+        .then(function (res) {
+            return res.json().then(function (data) {
+                if (!res.ok) throw new Error(data.error || i18n.t('admin_schedule_failed'));
+                return data;
+            });
+        })
+        .then(function () {
+            closeScheduleDialog();
+            showAdminToast(i18n.t('admin_schedule_saved'), 'success');
+            loadDocumentList();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_schedule_failed'), 'error');
+        });
+    };
+
+    // --- Document Review ---
+
+    window.showReviewDialog = function (docId, docName) {
+        var dialog = document.getElementById('admin-review-dialog');
+        var content = document.getElementById('admin-review-content');
+        var title = document.getElementById('admin-review-title');
+        if (!dialog || !content) return;
+
+        title.textContent = i18n.t('admin_doc_review_title') + ' - ' + docName;
+        content.innerHTML = '<p>' + i18n.t('admin_doc_review_loading') + '</p>';
+        dialog.classList.remove('hidden');
+
+        // Close on overlay click
+        dialog.onclick = function (e) {
+            if (e.target === dialog) closeReviewDialog();
+        };
+
+        adminFetch('/api/documents/' + encodeURIComponent(docId) + '/review')
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_doc_review_load_failed'));
+                return res.json();
+            })
+            .then(function (data) {
+                renderReviewContent(content, data);
+            })
+            .catch(function (err) {
+                content.innerHTML = '<p class="review-empty">' + escapeHtml(err.message) + '</p>';
+            });
+    };
+
+    window.closeReviewDialog = function () {
+        var dialog = document.getElementById('admin-review-dialog');
+        if (dialog) dialog.classList.add('hidden');
+    };
+
+    function formatReviewTime(seconds) {
+        if (seconds === undefined || seconds === null) return '';
+        var m = Math.floor(seconds / 60);
+        var s = Math.floor(seconds % 60);
+        return (m < 10 ? '0' : '') + m + ':' + (s < 10 ? '0' : '') + s;
+    }
+
+    function cleanTranscriptNoise(text) {
+        if (!text) return text;
+        // Remove lines that are rs-cli log noise (for old data that wasn't cleaned server-side)
+        var lines = text.split('\n');
+        var cleaned = [];
         for (var i = 0; i < lines.length; i++) {
             var line = lines[i].trim();
             if (!line) continue;
@@ -2966,6 +4332,9 @@
         }
 
         var html = '';
+        if (data.call_candidates) {
+            html += '<p class="admin-form-hint">' + escapeHtml(i18n.t('admin_doc_call_candidates', { n: data.call_candidates })) + '</p>';
+        }
         var slideNum = 0;
         var chunkNum = 0;
         for (var i = 0; i < data.segments.length; i++) {
@@ -3034,9 +4403,67 @@
         loadPendingQuestions();
     };
 
+    // Bulk answer imports run as a background job; the result panel is
+    // polled until the job ends and then lists the rows that did not go in.
+    window.importPendingAnswers = function (input) {
+        var file = input.files && input.files[0];
+        if (!file) return;
+        var resultEl = document.getElementById('admin-pending-import-result');
+        var formData = new FormData();
+        formData.append('file', file);
+        input.value = '';
+        adminFetch('/api/pending/bulk-answer', { method: 'POST', body: formData })
+            .then(function (res) {
+                return res.json().then(function (data) {
+                    if (!res.ok) throw new Error(data.error || i18n.t('admin_pending_import_failed'));
+                    return data;
+                });
+            })
+            .then(function (data) {
+                resultEl.textContent = i18n.t('admin_pending_import_started', { count: data.rows });
+                resultEl.classList.remove('hidden');
+                pollPendingImport(data.job_id);
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_pending_import_failed'), 'error');
+            });
+    };
+
+    function pollPendingImport(jobID) {
+        var resultEl = document.getElementById('admin-pending-import-result');
+        adminFetch('/api/pending/bulk-answer/' + encodeURIComponent(jobID))
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_pending_import_failed'));
+                return res.json();
+            })
+            .then(function (data) {
+                var job = data.job;
+                var counts = { answered: 0, skipped: 0, failed: 0 };
+                (data.results || []).forEach(function (r) { counts[r.status] = (counts[r.status] || 0) + 1; });
+                if (job.status === 'queued' || job.status === 'running') {
+                    resultEl.textContent = i18n.t('admin_pending_import_progress', { progress: job.progress, answered: counts.answered, skipped: counts.skipped, failed: counts.failed });
+                    setTimeout(function () { pollPendingImport(jobID); }, 2000);
+                    return;
+                }
+                var html = escapeHtml(i18n.t('admin_pending_import_done', counts));
+                if (job.error) html += '<br>' + escapeHtml(job.error);
+                (data.results || []).filter(function (r) { return r.status !== 'answered'; }).forEach(function (r) {
+                    html += '<br>' + escapeHtml(i18n.t('admin_pending_import_row', { row: r.row, id: r.question_id || '-', error: r.error }));
+                });
+                resultEl.innerHTML = html;
+                loadPendingQuestions();
+            })
+            .catch(function (err) {
+                resultEl.textContent = err.message || i18n.t('admin_pending_import_failed');
+            });
+    }
+
     function loadPendingQuestions() {
-        var url = '/api/pending';
-        if (adminPendingFilter) url += '?status=' + encodeURIComponent(adminPendingFilter);
+        var params = [];
+        if (adminPendingFilter) params.push('status=' + encodeURIComponent(adminPendingFilter));
+        var ticketSel = document.getElementById('admin-pending-ticket-filter');
+        if (ticketSel && ticketSel.value) params.push('has_external_ref=' + encodeURIComponent(ticketSel.value));
+        var url = '/api/pending' + (params.length ? '?' + params.join('&') : '');
 
         adminFetch(url)
             .then(function (res) {
@@ -3051,6 +4478,26 @@
             });
     }
 
+    window.loadPendingQuestions = loadPendingQuestions;
+
+    // pendingFocusID is a question to open once the pending list is rendered
+    var pendingFocusID = null;
+
+    function setPendingExternalRef(qid, ref) {
+        var opts = ref
+            ? { method: 'PUT', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ external_ref: ref }) }
+            : { method: 'DELETE' };
+        adminFetch('/api/pending/' + encodeURIComponent(qid) + '/external-ref', opts)
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_pending_ticket_failed')); });
+                showAdminToast(i18n.t('admin_pending_ticket_saved'), 'success');
+                loadPendingQuestions();
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_pending_ticket_failed'), 'error');
+            });
+    }
+
     function renderPendingQuestions(questions) {
         var container = document.getElementById('admin-pending-list');
         if (!container) return;
@@ -3077,6 +4524,14 @@
             } else {
                 html += '<span style="background:#F3F4F6;color:#6B7280;padding:2px 8px;border-radius:4px;font-size:0.8rem;">' + i18n.t('admin_doc_product_public') + '</span>';
             }
+            if (q.external_ref) {
+                var ticketLabel = i18n.t('admin_pending_ticket') + ': ' + escapeHtml(q.external_ref);
+                html += '<span style="background:#FEF3C7;color:#92400E;padding:2px 8px;border-radius:4px;font-size:0.8rem;">' +
+                    (q.external_url ? '<a href="' + escapeHtml(q.external_url) + '" target="_blank" rel="noopener noreferrer" style="color:inherit;">' + ticketLabel + '</a>' : ticketLabel) + '</span>';
+            }
+            if (q.origin === 'auto') {
+                html += '<span style="background:#FCE7F3;color:#9D174D;padding:2px 8px;border-radius:4px;font-size:0.8rem;" title="' + escapeHtml(i18n.t('admin_pending_origin_auto_hint')) + '">' + i18n.t('admin_pending_origin_auto') + '</span>';
+            }
             html += '</div>';
             html += '<span class="admin-badge ' + statusClass + '">' + escapeHtml(statusText) + '</span>';
             html += '</div>';
@@ -3086,16 +4541,33 @@
                 html += '<div class="admin-pending-image" style="margin:8px 0"><img src="' + escapeHtml(q.image_data) + '" style="max-width:300px;max-height:200px;border-radius:6px;border:1px solid #e0e0e0;cursor:pointer" onclick="window.open(this.src)" alt="' + i18n.t('chat_user_image_alt') + '" /></div>';
             }
 
+            if (q.missing_summary) {
+                html += '<div class="admin-pending-answer-preview">' + i18n.t('admin_pending_missing') + ': ' + escapeHtml(q.missing_summary) + '</div>';
+            }
+            if (q.context && q.context.length) {
+                html += '<details class="admin-pending-context" style="margin:6px 0;font-size:0.85rem;"><summary>' + i18n.t('admin_pending_context').replace('{n}', q.context.length) + '</summary>';
+                q.context.forEach(function (c) {
+                    html += '<div style="margin:6px 0;padding:6px 8px;background:#F9FAFB;border-radius:4px;">' +
+                        '<div style="color:#6B7280;">' + escapeHtml(c.document_name || c.document_id) + ' #' + (c.chunk_index || 0) + ' · ' + (c.score || 0).toFixed(2) + '</div>' +
+                        '<div>' + escapeHtml(c.text || '') + '</div></div>';
+                });
+                html += '</details>';
+            }
+
             if (q.answer) {
                 html += '<div class="admin-pending-answer-preview">' + i18n.t('admin_pending_answer_prefix') + ': ' + escapeHtml(q.answer) + '</div>';
             }
 
             if (q.status !== 'answered') {
-                html += '<button class="btn-primary btn-sm admin-answer-btn" data-id="' + escapeHtml(q.id) + '" data-question="' + escapeHtml(q.question || '') + '" data-image="' + escapeHtml(q.image_data || '') + '">' + i18n.t('admin_pending_answer_btn') + '</button>';
+                html += '<button class="btn-primary btn-sm admin-answer-btn" data-id="' + escapeHtml(q.id) + '" data-product="' + escapeHtml(q.product_id || '') + '" data-question="' + escapeHtml(q.question || '') + '" data-image="' + escapeHtml(q.image_data || '') + '">' + i18n.t('admin_pending_answer_btn') + '</button>';
             } else {
-                html += '<button class="btn-secondary btn-sm admin-edit-answer-btn" data-id="' + escapeHtml(q.id) + '" data-question="' + escapeHtml(q.question || '') + '" data-answer="' + escapeHtml(q.answer || '') + '" data-image="' + escapeHtml(q.image_data || '') + '">' + i18n.t('admin_pending_edit_btn') + '</button>';
+                html += '<button class="btn-secondary btn-sm admin-edit-answer-btn" data-id="' + escapeHtml(q.id) + '" data-product="' + escapeHtml(q.product_id || '') + '" data-question="' + escapeHtml(q.question || '') + '" data-answer="' + escapeHtml(q.answer || '') + '" data-image="' + escapeHtml(q.image_data || '') + '">' + i18n.t('admin_pending_edit_btn') + '</button>';
             }
 
+            html += ' <button class="btn-secondary btn-sm admin-ticket-pending-btn" data-id="' + escapeHtml(q.id) + '" data-ref="' + escapeHtml(q.external_ref || '') + '">' + i18n.t('admin_pending_ticket_link_btn') + '</button>';
+            if (q.external_ref) {
+                html += ' <button class="btn-secondary btn-sm admin-unticket-pending-btn" data-id="' + escapeHtml(q.id) + '">' + i18n.t('admin_pending_ticket_unlink_btn') + '</button>';
+            }
             html += ' <button class="btn-danger btn-sm admin-delete-pending-btn" data-id="' + escapeHtml(q.id) + '">' + i18n.t('admin_pending_delete_btn') + '</button>';
 
             html += '</div>';
@@ -3107,10 +4579,15 @@
         for (var j = 0; j < answerBtns.length; j++) {
             (function(btn) {
                 btn.addEventListener('click', function() {
-                    showAnswerDialog(btn.getAttribute('data-id'), btn.getAttribute('data-question'), null, btn.getAttribute('data-image'));
+                    showAnswerDialog(btn.getAttribute('data-id'), btn.getAttribute('data-question'), null, btn.getAttribute('data-image'), btn.getAttribute('data-product'));
                 });
             })(answerBtns[j]);
+            if (pendingFocusID && answerBtns[j].getAttribute('data-id') === pendingFocusID) {
+                answerBtns[j].scrollIntoView({ block: 'center' });
+                answerBtns[j].click();
+            }
         }
+        pendingFocusID = null;
 
         // Bind delete button clicks
         var deleteBtns = container.querySelectorAll('.admin-delete-pending-btn');
@@ -3132,6 +4609,20 @@
             })(deleteBtns[k]);
         }
 
+        // Bind ticket link button clicks
+        container.querySelectorAll('.admin-ticket-pending-btn').forEach(function (btn) {
+            btn.addEventListener('click', function () {
+                var ref = prompt(i18n.t('admin_pending_ticket_prompt'), btn.getAttribute('data-ref') || '');
+                if (ref === null || !ref.trim()) return;
+                setPendingExternalRef(btn.getAttribute('data-id'), ref.trim());
+            });
+        });
+        container.querySelectorAll('.admin-unticket-pending-btn').forEach(function (btn) {
+            btn.addEventListener('click', function () {
+                setPendingExternalRef(btn.getAttribute('data-id'), '');
+            });
+        });
+
         // Bind edit button clicks
         var editBtns = container.querySelectorAll('.admin-edit-answer-btn');
         for (var m = 0; m < editBtns.length; m++) {
@@ -3141,7 +4632,8 @@
                         btn.getAttribute('data-id'),
                         btn.getAttribute('data-question'),
                         btn.getAttribute('data-answer'),
-                        btn.getAttribute('data-image')
+                        btn.getAttribute('data-image'),
+                        btn.getAttribute('data-product')
                     );
                 });
             })(editBtns[m]);
@@ -3266,7 +4758,7 @@
         xhr.send(formData);
     }
 
-    window.showAnswerDialog = function (questionId, questionText, existingAnswer, imageData) {
+    window.showAnswerDialog = function (questionId, questionText, existingAnswer, imageData, productId) {
         adminAnswerTargetId = questionId;
         answerIsEdit = !!existingAnswer;
         var textEl = document.getElementById('admin-answer-question-text');
@@ -3301,20 +4793,84 @@
         var dialog = document.getElementById('admin-answer-dialog');
         if (dialog) dialog.classList.remove('hidden');
         initAnswerImageZone();
+        loadAnswerDialogTemplates(productId || '');
     };
 
-    window.closeAnswerDialog = function () {
-        adminAnswerTargetId = null;
-        answerIsEdit = false;
-        answerImageURLs = [];
-        var preview = document.getElementById('answer-image-preview');
-        if (preview) preview.innerHTML = '';
-        var dialog = document.getElementById('admin-answer-dialog');
-        if (dialog) dialog.classList.add('hidden');
-    };
-
-    window.submitAdminAnswer = function () {
-        if (!adminAnswerTargetId) return;
+    function loadAnswerDialogTemplates(productId) {
+        var select = document.getElementById('admin-answer-template');
+        if (!select) return;
+        select.innerHTML = '<option value="">' + i18n.t('admin_answer_template_none') + '</option>';
+        var adapt = document.getElementById('admin-answer-template-adapt');
+        if (adapt) adapt.checked = false;
+        var url = '/api/admin/templates' + (productId ? '?product_id=' + encodeURIComponent(productId) : '');
+        adminFetch(url)
+            .then(function (res) {
+                if (!res.ok) throw new Error('load failed');
+                return res.json();
+            })
+            .then(function (data) {
+                (data.templates || []).forEach(function (t) {
+                    // Without a product only global templates apply
+                    if (!productId && t.product_id) return;
+                    var opt = document.createElement('option');
+                    opt.value = t.id;
+                    opt.textContent = t.name;
+                    select.appendChild(opt);
+                });
+            })
+            .catch(function () {});
+    }
+
+    window.insertAnswerTemplate = function () {
+        var id = (document.getElementById('admin-answer-template') || {}).value;
+        if (!id || !adminAnswerTargetId) {
+            showAdminToast(i18n.t('admin_answer_template_pick'), 'error');
+            return;
+        }
+        var adapt = !!(document.getElementById('admin-answer-template-adapt') || {}).checked;
+        var btn = document.getElementById('admin-answer-template-btn');
+        setBtnLoading(btn, i18n.t(adapt ? 'admin_answer_template_adapting' : 'admin_answer_template_insert'));
+        adminFetch('/api/admin/templates/' + encodeURIComponent(id) + '/render', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ question_id: adminAnswerTargetId, adapt: adapt })
+        })
+        .then(function (res) {
+            return res.json().then(function (data) {
+                if (!res.ok) throw new Error(data.error || i18n.t('admin_answer_template_failed'));
+                return data;
+            });
+        })
+        .then(function (data) {
+            var input = document.getElementById('admin-answer-text');
+            if (input) {
+                input.value = input.value.trim() ? input.value.replace(/\s+$/, '') + '\n\n' + data.text : data.text;
+                input.focus();
+            }
+            if (data.missing && data.missing.length) {
+                showAdminToast(i18n.t('admin_answer_template_missing', { names: data.missing.map(function (n) { return '{' + n + '}'; }).join(', ') }), 'info');
+            }
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_answer_template_failed'), 'error');
+        })
+        .finally(function () {
+            resetBtnLoading(btn);
+        });
+    };
+
+    window.closeAnswerDialog = function () {
+        adminAnswerTargetId = null;
+        answerIsEdit = false;
+        answerImageURLs = [];
+        var preview = document.getElementById('answer-image-preview');
+        if (preview) preview.innerHTML = '';
+        var dialog = document.getElementById('admin-answer-dialog');
+        if (dialog) dialog.classList.add('hidden');
+    };
+
+    window.submitAdminAnswer = function () {
+        if (!adminAnswerTargetId) return;
 
         var text = (document.getElementById('admin-answer-text') || {}).value || '';
         var url = (document.getElementById('admin-answer-url') || {}).value || '';
@@ -3341,7 +4897,10 @@
         })
         .then(function (res) {
             if (!res.ok) throw new Error(i18n.t('admin_answer_failed'));
-            showAdminToast(i18n.t('admin_answer_success'), 'success');
+            return res.json().catch(function () { return {}; });
+        })
+        .then(function (data) {
+            showAdminToast(i18n.t(data.review_status === 'draft' ? 'admin_review_saved_draft' : 'admin_answer_success'), 'success');
             closeAnswerDialog();
             loadPendingQuestions();
         })
@@ -3353,6 +4912,309 @@
         });
     };
 
+    // --- Review Queue ---
+
+    var adminReviewers = [];
+
+    function reviewerName(id) {
+        for (var i = 0; i < adminReviewers.length; i++) {
+            if (adminReviewers[i].id === id) return adminReviewers[i].username;
+        }
+        return id || '-';
+    }
+
+    function loadReviewers() {
+        adminFetch('/api/review/reviewers')
+            .then(function (res) { return res.ok ? res.json() : { reviewers: [] }; })
+            .then(function (data) {
+                adminReviewers = data.reviewers || [];
+                var select = document.getElementById('admin-review-reviewer');
+                if (!select) return;
+                var current = select.value;
+                select.innerHTML = '<option value="">' + escapeHtml(i18n.t('admin_review_pick_reviewer')) + '</option>';
+                for (var i = 0; i < adminReviewers.length; i++) {
+                    var opt = document.createElement('option');
+                    opt.value = adminReviewers[i].id;
+                    opt.textContent = adminReviewers[i].username;
+                    select.appendChild(opt);
+                }
+                if (current) select.value = current;
+            })
+            .catch(function () { /* reviewer list is optional for browsing the queue */ });
+    }
+
+    window.loadReviewQueue = function () {
+        var params = [];
+        var status = getVal('admin-review-status');
+        if (status) params.push('status=' + encodeURIComponent(status));
+        var mine = document.getElementById('admin-review-mine');
+        if (mine && mine.checked) params.push('assigned=me');
+        adminFetch('/api/review' + (params.length ? '?' + params.join('&') : ''))
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_review_load_failed'));
+                return res.json();
+            })
+            .then(function (data) {
+                renderReviewQueue(data.items || []);
+            })
+            .catch(function () {
+                renderReviewQueue([]);
+            });
+    };
+
+    function renderReviewQueue(items) {
+        var container = document.getElementById('admin-review-list');
+        if (!container) return;
+        var selectAll = document.getElementById('admin-review-select-all');
+        if (selectAll) selectAll.checked = false;
+        if (!items.length) {
+            container.innerHTML = '<div class="admin-table-empty">' + i18n.t('admin_review_empty') + '</div>';
+            return;
+        }
+        var html = '';
+        for (var i = 0; i < items.length; i++) {
+            var it = items[i];
+            var timeStr = it.created_at ? new Date(it.created_at).toLocaleString(i18n.getLang()) : '-';
+            html += '<div class="admin-pending-card">';
+            html += '<div class="admin-pending-card-header">';
+            html += '<div class="admin-pending-meta">';
+            html += '<input type="checkbox" class="admin-review-check" value="' + escapeHtml(it.id) + '">';
+            html += '<span>' + escapeHtml(it.name || '-') + '</span>';
+            html += '<span>' + escapeHtml(getProductNameByID(it.product_id || '') || i18n.t('admin_doc_product_public')) + '</span>';
+            html += '<span>' + escapeHtml(i18n.t('admin_review_author')) + ': ' + escapeHtml(reviewerName(it.author)) + '</span>';
+            if (it.reviewer_id) {
+                html += '<span>' + escapeHtml(i18n.t('admin_review_reviewer')) + ': ' + escapeHtml(reviewerName(it.reviewer_id)) + '</span>';
+            }
+            html += '<span>' + escapeHtml(timeStr) + '</span>';
+            html += '</div>';
+            html += '<span class="admin-badge admin-badge-' + escapeHtml(it.review_status) + '">' + escapeHtml(i18n.t('admin_review_status_' + it.review_status)) + '</span>';
+            html += '</div>';
+            html += '<div class="admin-pending-question">' + escapeHtml(it.preview || '') + '</div>';
+            if (it.note) {
+                html += '<div class="admin-pending-answer-preview">' + escapeHtml(i18n.t('admin_review_note_label')) + ': ' + escapeHtml(it.note) + '</div>';
+            }
+            html += '<button class="btn-secondary btn-sm" data-id="' + escapeHtml(it.id) + '" onclick="showReviewContent(this.dataset.id, this)">' + i18n.t('admin_review_view_btn') + '</button>';
+            html += '</div>';
+        }
+        container.innerHTML = html;
+    }
+
+    window.toggleReviewSelectAll = function (checked) {
+        var boxes = document.querySelectorAll('.admin-review-check');
+        boxes.forEach(function (cb) { cb.checked = checked; });
+    };
+
+    // Toggle the full text of a review entry below its card.
+    window.showReviewContent = function (id, btn) {
+        var card = btn.parentNode;
+        var existing = card.querySelector('.admin-review-content');
+        if (existing) { card.removeChild(existing); return; }
+        adminFetch('/api/review/' + encodeURIComponent(id))
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_review_load_failed'));
+                return res.json();
+            })
+            .then(function (item) {
+                var pre = document.createElement('pre');
+                pre.className = 'admin-review-content';
+                pre.style.whiteSpace = 'pre-wrap';
+                pre.style.marginTop = '0.5rem';
+                pre.textContent = item.content || '';
+                card.appendChild(pre);
+            })
+            .catch(function (e) {
+                showAdminToast(e.message, 'error');
+            });
+    };
+
+    window.reviewBulkAction = function (action) {
+        var ids = [];
+        document.querySelectorAll('.admin-review-check').forEach(function (cb) {
+            if (cb.checked) ids.push(cb.value);
+        });
+        if (!ids.length) {
+            showAdminToast(i18n.t('admin_review_select_first'), 'error');
+            return;
+        }
+        var body = { ids: ids, action: action, note: getVal('admin-review-note') };
+        if (action === 'submit') {
+            body.reviewer_id = getVal('admin-review-reviewer');
+            if (!body.reviewer_id) {
+                showAdminToast(i18n.t('admin_review_pick_reviewer'), 'error');
+                return;
+            }
+        }
+        adminFetch('/api/review/action', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        })
+            .then(function (res) {
+                return res.json().then(function (data) {
+                    if (!res.ok) throw new Error(data.error || i18n.t('admin_review_action_failed'));
+                    return data;
+                });
+            })
+            .then(function (data) {
+                var results = data.results || [];
+                var failed = results.filter(function (r) { return r.error; });
+                if (failed.length) {
+                    showAdminToast(i18n.t('admin_review_partial', { ok: results.length - failed.length, failed: failed.length }) + ' ' + failed[0].error, 'error');
+                } else {
+                    showAdminToast(i18n.t('admin_review_done', { n: results.length }), 'success');
+                }
+                var noteInput = document.getElementById('admin-review-note');
+                if (noteInput) noteInput.value = '';
+                loadReviewQueue();
+            })
+            .catch(function (e) {
+                showAdminToast(e.message || i18n.t('admin_review_action_failed'), 'error');
+            });
+    };
+
+    // --- Correction suggestions ---
+
+    window.loadCorrections = function () {
+        var status = getVal('admin-corrections-status');
+        adminFetch('/api/admin/corrections' + (status ? '?status=' + encodeURIComponent(status) : ''))
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_corrections_load_failed'));
+                return res.json();
+            })
+            .then(function (data) {
+                renderCorrections(data.suggestions || []);
+            })
+            .catch(function () {
+                renderCorrections([]);
+            });
+    };
+
+    function renderCorrections(list) {
+        var container = document.getElementById('admin-corrections-list');
+        if (!container) return;
+        if (!list.length) {
+            container.innerHTML = '<div class="admin-table-empty">' + i18n.t('admin_corrections_empty') + '</div>';
+            return;
+        }
+        var html = '';
+        for (var i = 0; i < list.length; i++) {
+            var sg = list[i];
+            var timeStr = sg.created_at ? new Date(sg.created_at).toLocaleString(i18n.getLang()) : '-';
+            html += '<div class="admin-pending-card">';
+            html += '<div class="admin-pending-card-header">';
+            html += '<div class="admin-pending-meta">';
+            html += '<span>' + escapeHtml(getProductNameByID(sg.product_id || '') || i18n.t('admin_doc_product_public')) + '</span>';
+            if (sg.document_id) {
+                html += '<span>' + escapeHtml(i18n.t('admin_corrections_source')) + ': ' + escapeHtml(sg.document_name || sg.document_id) + ' #' + sg.chunk_index + '</span>';
+            }
+            html += '<span>' + escapeHtml(timeStr) + '</span>';
+            html += '</div>';
+            html += '<span class="admin-badge admin-badge-' + escapeHtml(sg.status) + '">' + escapeHtml(i18n.t('admin_corrections_status_' + sg.status)) + '</span>';
+            html += '</div>';
+            if (sg.question) {
+                html += '<div class="admin-pending-answer-preview">' + escapeHtml(i18n.t('admin_corrections_question')) + ': ' + escapeHtml(sg.question) + '</div>';
+            }
+            html += '<div class="admin-pending-question">' + escapeHtml(i18n.t('admin_corrections_sentence')) + ': ' + escapeHtml(sg.sentence) + '</div>';
+            if (sg.suggestion) {
+                html += '<div class="admin-pending-answer-preview">' + escapeHtml(i18n.t('admin_corrections_suggestion')) + ': ' + escapeHtml(sg.suggestion) + '</div>';
+            }
+            if (sg.status !== 'pending') {
+                var outcome = sg.applied_as ? i18n.t('admin_corrections_applied_' + sg.applied_as) : '';
+                if (sg.note) outcome += (outcome ? ' · ' : '') + sg.note;
+                if (outcome) html += '<div class="admin-pending-answer-preview">' + escapeHtml(outcome) + '</div>';
+            } else {
+                html += '<button class="btn-secondary btn-sm" data-id="' + escapeHtml(sg.id) + '" onclick="openCorrectionEditor(this.dataset.id, this)">' + i18n.t('admin_corrections_handle_btn') + '</button>';
+            }
+            html += '</div>';
+        }
+        container.innerHTML = html;
+    }
+
+    // openCorrectionEditor expands a pending suggestion with the cited chunk
+    // so the admin can edit it, add a knowledge entry instead, or reject it.
+    window.openCorrectionEditor = function (id, btn) {
+        var card = btn.parentNode;
+        var existing = card.querySelector('.admin-correction-editor');
+        if (existing) { card.removeChild(existing); return; }
+        adminFetch('/api/admin/corrections/' + encodeURIComponent(id))
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_corrections_load_failed'));
+                return res.json();
+            })
+            .then(function (d) {
+                var canEditChunk = !!(d.chunk_text && d.chunk_editable);
+                var editor = document.createElement('div');
+                editor.className = 'admin-correction-editor';
+                editor.style.marginTop = '0.5rem';
+                editor.innerHTML =
+                    '<div class="admin-form-group"><label>' + escapeHtml(i18n.t('admin_corrections_apply_as')) + '</label>' +
+                        '<select class="login-product-select admin-correction-mode" style="width:auto;display:inline-block;">' +
+                            (canEditChunk ? '<option value="chunk">' + escapeHtml(i18n.t('admin_corrections_applied_chunk')) + '</option>' : '') +
+                            '<option value="knowledge">' + escapeHtml(i18n.t('admin_corrections_applied_knowledge')) + '</option>' +
+                            '<option value="">' + escapeHtml(i18n.t('admin_corrections_apply_none')) + '</option>' +
+                        '</select></div>' +
+                    '<div class="admin-form-group admin-correction-title-group"><label>' + escapeHtml(i18n.t('admin_corrections_entry_title')) + '</label>' +
+                        '<input type="text" class="admin-input admin-correction-title" maxlength="200"></div>' +
+                    '<div class="admin-form-group admin-correction-text-group"><label>' + escapeHtml(i18n.t('admin_corrections_text')) + '</label>' +
+                        '<textarea class="admin-input admin-correction-text" rows="8"></textarea></div>' +
+                    '<div class="admin-form-group"><input type="text" class="admin-input admin-correction-note" maxlength="2000" placeholder="' + escapeHtml(i18n.t('admin_corrections_note_placeholder')) + '"></div>' +
+                    '<div style="display:flex;gap:0.5rem;">' +
+                        '<button class="btn-primary btn-sm admin-correction-accept">' + escapeHtml(i18n.t('admin_corrections_accept_btn')) + '</button>' +
+                        '<button class="btn-danger btn-sm admin-correction-reject">' + escapeHtml(i18n.t('admin_corrections_reject_btn')) + '</button>' +
+                    '</div>';
+                card.appendChild(editor);
+
+                var modeSel = editor.querySelector('.admin-correction-mode');
+                var titleInput = editor.querySelector('.admin-correction-title');
+                var textInput = editor.querySelector('.admin-correction-text');
+                titleInput.value = d.question || '';
+                var syncMode = function () {
+                    var mode = modeSel.value;
+                    editor.querySelector('.admin-correction-title-group').style.display = mode === 'knowledge' ? '' : 'none';
+                    editor.querySelector('.admin-correction-text-group').style.display = mode ? '' : 'none';
+                    textInput.value = mode === 'chunk' ? d.chunk_text : (d.suggestion || '');
+                };
+                modeSel.onchange = syncMode;
+                syncMode();
+
+                editor.querySelector('.admin-correction-accept').onclick = function () {
+                    resolveCorrection(id, 'accept', {
+                        apply_as: modeSel.value,
+                        title: titleInput.value.trim(),
+                        text: textInput.value,
+                        note: editor.querySelector('.admin-correction-note').value.trim()
+                    });
+                };
+                editor.querySelector('.admin-correction-reject').onclick = function () {
+                    resolveCorrection(id, 'reject', { note: editor.querySelector('.admin-correction-note').value.trim() });
+                };
+            })
+            .catch(function (e) {
+                showAdminToast(e.message, 'error');
+            });
+    };
+
+    function resolveCorrection(id, action, body) {
+        adminFetch('/api/admin/corrections/' + encodeURIComponent(id) + '/' + action, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        })
+            .then(function (res) {
+                return res.json().then(function (data) {
+                    if (!res.ok) throw new Error(data.error || i18n.t('admin_corrections_action_failed'));
+                    return data;
+                });
+            })
+            .then(function () {
+                showAdminToast(i18n.t(action === 'accept' ? 'admin_corrections_accepted' : 'admin_corrections_rejected'), 'success');
+                loadCorrections();
+            })
+            .catch(function (e) {
+                showAdminToast(e.message || i18n.t('admin_corrections_action_failed'), 'error');
+            });
+    }
+
     // --- Settings ---
 
     function loadAdminSettings() {
@@ -3369,13 +5231,21 @@
                 var admin = cfg.admin || {};
 
                 setVal('cfg-server-port', server.port);
+                setVal('cfg-server-external-base-url', server.external_base_url);
 
+                setVal('cfg-llm-provider', llm.provider || 'openai');
                 setVal('cfg-llm-endpoint', llm.endpoint);
                 setVal('cfg-llm-model', llm.model_name);
                 setVal('cfg-llm-apikey', '');
                 setPlaceholder('cfg-llm-apikey', llm.api_key ? '***' : i18n.t('admin_settings_not_set'));
                 setVal('cfg-llm-temperature', llm.temperature);
                 setVal('cfg-llm-maxtokens', llm.max_tokens);
+                setVal('cfg-llm-max-concurrency', llm.max_concurrency);
+                setVal('cfg-llm-max-queue', llm.max_queue);
+                setVal('cfg-llm-max-queued-per-user', llm.max_queued_per_user);
+                setVal('cfg-llm-queue-timeout', llm.queue_timeout_sec);
+                setVal('cfg-llm-price', llm.price_per_m_tokens);
+                loadLLMProfiles();
 
                 setVal('cfg-emb-endpoint', emb.endpoint);
                 setVal('cfg-emb-model', emb.model_name);
@@ -3383,6 +5253,16 @@
                 setPlaceholder('cfg-emb-apikey', emb.api_key ? '***' : i18n.t('admin_settings_not_set'));
                 var mmSelect = document.getElementById('cfg-emb-multimodal');
                 if (mmSelect) mmSelect.value = emb.use_multimodal ? 'true' : 'false';
+                setVal('cfg-emb-price', emb.price_per_m_tokens);
+                loadReindexStatus();
+
+                var rerank = cfg.rerank || {};
+                setVal('cfg-rerank-enabled', rerank.enabled ? 'true' : 'false');
+                setVal('cfg-rerank-endpoint', rerank.endpoint);
+                setVal('cfg-rerank-model', rerank.model_name);
+                setVal('cfg-rerank-apikey', '');
+                setPlaceholder('cfg-rerank-apikey', rerank.api_key ? '***' : i18n.t('admin_settings_not_set'));
+                setVal('cfg-rerank-top-n', rerank.top_n || 0);
 
                 setVal('cfg-vec-chunksize', vec.chunk_size);
                 setVal('cfg-vec-overlap', vec.overlap);
@@ -3390,12 +5270,41 @@
                 setVal('cfg-vec-threshold', vec.threshold);
                 var cpSelect = document.getElementById('cfg-vec-content-priority');
                 if (cpSelect) cpSelect.value = vec.content_priority || 'image_text';
+                var lfSelect = document.getElementById('cfg-vec-language-filter');
+                if (lfSelect) lfSelect.value = vec.language_filter || 'off';
                 var tmSelect = document.getElementById('cfg-vec-text-match');
                 if (tmSelect) tmSelect.value = vec.text_match_enabled === false ? 'false' : 'true';
                 var dbgSelect = document.getElementById('cfg-vec-debug-mode');
                 if (dbgSelect) dbgSelect.value = vec.debug_mode ? 'true' : 'false';
+                var verifySelect = document.getElementById('cfg-verify-mode');
+                if (verifySelect) verifySelect.value = (cfg.verify && cfg.verify.mode) || '';
+                setVal('cfg-review-required', (cfg.review && cfg.review.required) ? 'true' : 'false');
+                setVal('cfg-tagging-enabled', (cfg.tagging && cfg.tagging.enabled) ? 'true' : 'false');
+                var audit = cfg.audit || {};
+                setVal('cfg-audit-enabled', audit.disabled ? 'false' : 'true');
+                setVal('cfg-audit-retention', audit.retention_days || 0);
+                setVal('cfg-portal-enabled', (cfg.portal && cfg.portal.enabled) ? 'true' : 'false');
+                var html = cfg.html || {};
+                setVal('cfg-html-main-content', html.main_content_enabled ? 'true' : 'false');
+                var selectorsEl = document.getElementById('cfg-html-selectors');
+                if (selectorsEl) {
+                    selectorsEl.value = Object.keys(html.selectors || {}).sort().map(function (host) {
+                        return host + '=' + html.selectors[host];
+                    }).join('\n');
+                }
 
                 setVal('cfg-admin-login-route', admin.login_route || '/admin');
+                var pw = cfg.password || {};
+                setVal('cfg-password-min-length', pw.min_length || 8);
+                var pwRequire = pw.require || ['letter', 'digit'];
+                document.querySelectorAll('.cfg-password-require').forEach(function (cb) {
+                    cb.checked = pwRequire.indexOf(cb.value) !== -1;
+                });
+                setVal('cfg-password-breach-list', pw.breach_list || '');
+                setVal('cfg-password-max-age', pw.max_age_days || 0);
+                var sess = cfg.session || {};
+                setVal('cfg-session-idle-timeout', sess.idle_timeout_minutes || 1440);
+                setVal('cfg-session-max-lifetime', sess.max_lifetime_hours || 168);
 
                 var anonSelect = document.getElementById('cfg-anon-backend');
                 if (anonSelect) anonSelect.value = admin.anonymous_mode ? 'true' : 'false';
@@ -3405,6 +5314,13 @@
                 setVal('cfg-product-name', cfg.product_name || '');
                 setVal('cfg-product-intro', cfg.product_intro || '');
 
+                var smallTalk = cfg.small_talk || {};
+                setVal('cfg-small-talk-enabled', smallTalk.disabled ? 'false' : 'true');
+                setVal('cfg-small-talk-interval', smallTalk.intro_interval_min || 30);
+                setVal('cfg-small-talk-rules', (smallTalk.rules || []).map(function (r) {
+                    return [r.language || '', r.kind || '', (r.phrases || []).join(','), r.reply || ''].join('|');
+                }).join('\n'));
+
                 setVal('cfg-auth-server', cfg.auth_server || '');
 
                 var smtp = cfg.smtp || {};
@@ -3413,6 +5329,23 @@
                 setVal('cfg-smtp-username', smtp.username);
                 setVal('cfg-smtp-password', '');
                 setPlaceholder('cfg-smtp-password', smtp.password ? '***' : i18n.t('admin_settings_not_set'));
+
+                var emailIngest = cfg.email_ingest || {};
+                setVal('cfg-email-ingest-enabled', emailIngest.enabled ? 'true' : 'false');
+                setVal('cfg-email-ingest-token', '');
+                setPlaceholder('cfg-email-ingest-token', emailIngest.token ? '***' : i18n.t('admin_settings_not_set'));
+                setVal('cfg-email-ingest-recipients', (emailIngest.recipients || []).join(', '));
+                setVal('cfg-email-ingest-senders', (emailIngest.allowed_senders || []).join(', '));
+                setVal('cfg-email-ingest-product', emailIngest.product_id || '');
+                var notifications = cfg.notifications || {};
+                ['slack', 'lark', 'dingtalk'].forEach(function (ch) {
+                    var n = notifications[ch] || {};
+                    setVal('cfg-notify-' + ch + '-enabled', n.enabled ? 'true' : 'false');
+                    setVal('cfg-notify-' + ch + '-webhook', '');
+                    setPlaceholder('cfg-notify-' + ch + '-webhook', n.webhook_url ? '***' : i18n.t('admin_settings_not_set'));
+                    setVal('cfg-notify-' + ch + '-secret', '');
+                    setPlaceholder('cfg-notify-' + ch + '-secret', n.secret ? '***' : i18n.t('admin_settings_not_set'));
+                });
                 setVal('cfg-smtp-from-addr', smtp.from_addr);
                 setVal('cfg-smtp-from-name', smtp.from_name);
                 var tlsSelect = document.getElementById('cfg-smtp-tls');
@@ -3420,6 +5353,15 @@
                 var authMethodSelect = document.getElementById('cfg-smtp-auth-method');
                 if (authMethodSelect) authMethodSelect.value = smtp.auth_method || '';
 
+                var extAuth = cfg.external_auth || {};
+                setVal('cfg-external-auth-enabled', extAuth.enabled ? 'true' : 'false');
+                setVal('cfg-external-auth-label', extAuth.label || '');
+                setVal('cfg-external-auth-name', extAuth.name || '');
+                setVal('cfg-external-auth-url', extAuth.verify_url || '');
+                setVal('cfg-external-auth-secret', '');
+                setPlaceholder('cfg-external-auth-secret', extAuth.secret ? '***' : i18n.t('admin_settings_not_set'));
+                setVal('cfg-external-auth-timeout', extAuth.timeout_sec || '');
+
                 // Load OAuth providers
                 renderOAuthProviderSettings(cfg.oauth || {});
             })
@@ -3507,10 +5449,38 @@
         });
     };
 
+    window.testNotification = function (ch) {
+        var resultEl = document.getElementById('notify-' + ch + '-test-result');
+        var btn = document.getElementById('notify-' + ch + '-test-btn');
+        if (btn) btn.disabled = true;
+        if (resultEl) { resultEl.textContent = i18n.t('admin_settings_notify_test_sending'); resultEl.className = ''; resultEl.classList.remove('hidden'); }
+
+        // Send the entered webhook so testing works before save
+        adminFetch('/api/notifications/test', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ channel: ch, webhook_url: getVal('cfg-notify-' + ch + '-webhook'), secret: getVal('cfg-notify-' + ch + '-secret') })
+        })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_settings_notify_test_failed')); });
+            return res.json();
+        })
+        .then(function () {
+            if (resultEl) { resultEl.textContent = i18n.t('admin_settings_notify_test_success'); resultEl.className = 'success-text'; }
+        })
+        .catch(function (err) {
+            if (resultEl) { resultEl.textContent = err.message; resultEl.className = 'error-text'; }
+        })
+        .finally(function () {
+            if (btn) btn.disabled = false;
+        });
+    };
+
     window.testLLM = function () {
         var btn = document.getElementById('btn-test-llm');
         var result = document.getElementById('test-llm-result');
         var spinner = document.getElementById('spinner-test-llm');
+        var provider = getVal('cfg-llm-provider') || 'openai';
         var endpoint = getVal('cfg-llm-endpoint');
         var apiKey = getVal('cfg-llm-apikey');
         var model = getVal('cfg-llm-model');
@@ -3520,7 +5490,8 @@
         // Allow empty apiKey — backend will fall back to saved config
         var apiKeyEl = document.getElementById('cfg-llm-apikey');
         var hasSavedKey = apiKeyEl && apiKeyEl.placeholder && apiKeyEl.placeholder.indexOf('***') !== -1;
-        if (!endpoint || (!apiKey && !hasSavedKey) || !model) {
+        // A local Ollama server needs no API key
+        if (!endpoint || (!apiKey && !hasSavedKey && provider !== 'ollama') || !model) {
             if (result) { result.textContent = i18n.t('admin_settings_test_missing_fields'); result.style.color = '#e53e3e'; result.classList.remove('hidden'); }
             return;
         }
@@ -3531,7 +5502,7 @@
         adminFetch('/api/test/llm', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ endpoint: endpoint, api_key: apiKey, model_name: model, temperature: temperature, max_tokens: maxTokens })
+            body: JSON.stringify({ provider: provider, endpoint: endpoint, api_key: apiKey, model_name: model, temperature: temperature, max_tokens: maxTokens })
         })
         .then(function (res) {
             if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_settings_test_failed')); });
@@ -3549,6 +5520,176 @@
         });
     };
 
+    // --- LLM profiles and task routes ---
+
+    var llmProfilesCache = [];
+
+    window.loadLLMProfiles = function () {
+        var tbody = document.getElementById('llm-profiles-tbody');
+        if (!tbody) return;
+        adminFetch('/api/llm-profiles')
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_llm_profiles_load_failed')); });
+                return res.json();
+            })
+            .then(function (data) {
+                llmProfilesCache = data.profiles || [];
+                var rows = [{ name: 'default', provider: getVal('cfg-llm-provider'), model_name: getVal('cfg-llm-model'), endpoint: getVal('cfg-llm-endpoint'), priority: 0, main: true }].concat(llmProfilesCache);
+                rows.sort(function (a, b) { return (a.priority || 0) - (b.priority || 0); });
+                var html = '';
+                rows.forEach(function (p) {
+                    var name = escapeHtml(p.name);
+                    var label = p.main ? name + ' (' + i18n.t('admin_llm_profiles_main') + ')' : name;
+                    if (p.disabled) label += ' <span class="admin-form-hint">' + i18n.t('admin_llm_profiles_disabled') + '</span>';
+                    html += '<tr>' +
+                        '<td>' + label + '</td>' +
+                        '<td>' + escapeHtml(p.model_name || '') + (p.provider === 'ollama' ? ' <span class="admin-form-hint">Ollama</span>' : '') + '</td>' +
+                        '<td>' + escapeHtml(p.endpoint || '') + '</td>' +
+                        '<td>' + (p.priority || 0) + '</td>' +
+                        '<td>' +
+                            '<button type="button" class="btn-secondary btn-sm" onclick="testLLMProfile(\'' + name + '\', this)">' + i18n.t('admin_llm_profiles_test') + '</button> ' +
+                            (p.main ? '' :
+                                '<button type="button" class="btn-secondary btn-sm" onclick="editLLMProfile(\'' + name + '\')">' + i18n.t('admin_llm_profiles_edit_btn') + '</button> ' +
+                                '<button type="button" class="btn-danger btn-sm" onclick="deleteLLMProfile(\'' + name + '\')">' + i18n.t('admin_llm_profiles_delete') + '</button>') +
+                        '</td>' +
+                        '</tr>';
+                });
+                tbody.innerHTML = html;
+
+                var routes = data.routes || {};
+                document.querySelectorAll('.llm-route-select').forEach(function (sel) {
+                    var opts = '<option value="">' + i18n.t('admin_llm_routes_by_priority') + '</option>' +
+                        '<option value="default">default</option>';
+                    llmProfilesCache.forEach(function (p) {
+                        if (!p.disabled) opts += '<option value="' + escapeHtml(p.name) + '">' + escapeHtml(p.name) + '</option>';
+                    });
+                    sel.innerHTML = opts;
+                    sel.value = routes[sel.getAttribute('data-task')] || '';
+                });
+            })
+            .catch(function (err) {
+                tbody.innerHTML = '<tr><td colspan="5" class="admin-table-empty">' + escapeHtml(err.message || i18n.t('admin_llm_profiles_load_failed')) + '</td></tr>';
+            });
+    };
+
+    window.editLLMProfile = function (name) {
+        var p = llmProfilesCache.find(function (x) { return x.name === name; });
+        if (!p) return;
+        setVal('llm-profile-name', p.name);
+        setVal('llm-profile-provider', p.provider || 'openai');
+        setVal('llm-profile-endpoint', p.endpoint);
+        setVal('llm-profile-model', p.model_name);
+        setVal('llm-profile-apikey', '');
+        setPlaceholder('llm-profile-apikey', p.api_key ? '***' : i18n.t('admin_settings_not_set'));
+        setVal('llm-profile-priority', p.priority);
+        setVal('llm-profile-temperature', p.temperature);
+        setVal('llm-profile-maxtokens', p.max_tokens);
+        setVal('llm-profile-timeout', p.timeout_sec);
+        document.getElementById('llm-profile-disabled').checked = !!p.disabled;
+    };
+
+    window.saveLLMProfile = function () {
+        var btn = document.getElementById('llm-profile-save-btn');
+        var name = getVal('llm-profile-name').toLowerCase();
+        var apiKey = getVal('llm-profile-apikey');
+        var existing = llmProfilesCache.some(function (p) { return p.name === name; });
+        var body = {
+            name: name,
+            provider: getVal('llm-profile-provider') || 'openai',
+            endpoint: getVal('llm-profile-endpoint'),
+            model_name: getVal('llm-profile-model'),
+            api_key: apiKey || (existing ? '***' : ''),
+            priority: parseInt(getVal('llm-profile-priority'), 10) || 0,
+            temperature: parseFloat(getVal('llm-profile-temperature')) || 0,
+            max_tokens: parseInt(getVal('llm-profile-maxtokens'), 10) || 0,
+            timeout_sec: parseInt(getVal('llm-profile-timeout'), 10) || 0,
+            disabled: document.getElementById('llm-profile-disabled').checked
+        };
+        setBtnLoading(btn);
+        adminFetch('/api/llm-profiles', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_llm_profiles_save_failed')); });
+            showAdminToast(i18n.t('admin_llm_profiles_saved'), 'success');
+            ['llm-profile-name', 'llm-profile-endpoint', 'llm-profile-model', 'llm-profile-apikey', 'llm-profile-temperature', 'llm-profile-maxtokens', 'llm-profile-timeout'].forEach(function (id) { setVal(id, ''); });
+            setPlaceholder('llm-profile-apikey', i18n.t('admin_settings_api_key'));
+            setVal('llm-profile-priority', 1);
+            setVal('llm-profile-provider', 'openai');
+            document.getElementById('llm-profile-disabled').checked = false;
+            loadLLMProfiles();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_llm_profiles_save_failed'), 'error');
+        })
+        .then(function () {
+            resetBtnLoading(btn);
+        });
+    };
+
+    window.deleteLLMProfile = function (name) {
+        if (!confirm(i18n.t('admin_llm_profiles_delete_confirm', { name: name }))) return;
+        adminFetch('/api/llm-profiles/' + encodeURIComponent(name), { method: 'DELETE' })
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_llm_profiles_delete_failed')); });
+                showAdminToast(i18n.t('admin_llm_profiles_deleted'), 'success');
+                loadLLMProfiles();
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_llm_profiles_delete_failed'), 'error');
+            });
+    };
+
+    window.testLLMProfile = function (name, btn) {
+        setBtnLoading(btn);
+        adminFetch('/api/test/llm-profile', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ name: name })
+        })
+        .then(function (res) {
+            return res.json().then(function (d) {
+                if (!res.ok) throw new Error(d.error || i18n.t('admin_settings_test_failed'));
+                return d;
+            });
+        })
+        .then(function (data) {
+            showAdminToast(i18n.t('admin_llm_profiles_test_ok', { name: name, ms: data.latency_ms }) + (data.reply ? ' — ' + data.reply : ''), 'success');
+        })
+        .catch(function (err) {
+            showAdminToast(name + ': ' + (err.message || i18n.t('admin_settings_test_failed')), 'error');
+        })
+        .then(function () {
+            resetBtnLoading(btn);
+        });
+    };
+
+    window.saveLLMRoutes = function () {
+        var btn = document.getElementById('llm-routes-save-btn');
+        var routes = {};
+        document.querySelectorAll('.llm-route-select').forEach(function (sel) {
+            routes[sel.getAttribute('data-task')] = sel.value;
+        });
+        setBtnLoading(btn);
+        adminFetch('/api/llm-routes', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ routes: routes })
+        })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_llm_routes_save_failed')); });
+            showAdminToast(i18n.t('admin_llm_routes_saved'), 'success');
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_llm_routes_save_failed'), 'error');
+        })
+        .then(function () {
+            resetBtnLoading(btn);
+        });
+    };
+
     window.testEmbedding = function () {
         var btn = document.getElementById('btn-test-embedding');
         var result = document.getElementById('test-embedding-result');
@@ -3591,12 +5732,157 @@
         });
     };
 
-    window.saveAdminSettings = function () {
-        var updates = {};
+    // --- Re-embedding after an embedding model change ---
+
+    var reindexWatching = false;
+
+    function renderReindexStatus(st) {
+        var el = document.getElementById('reindex-progress');
+        var btn = document.getElementById('btn-reindex');
+        var cancelBtn = document.getElementById('btn-reindex-cancel');
+        if (!el) return;
+        var running = st.state === 'embedding' || st.state === 'swapping';
+        if (btn) btn.disabled = running;
+        if (cancelBtn) cancelBtn.classList.toggle('hidden', st.state !== 'embedding');
+        if (!st.state || st.state === 'idle') { el.classList.add('hidden'); return; }
+        var text;
+        if (st.state === 'embedding') {
+            text = i18n.t('admin_settings_reindex_embedding', { model: st.model, done: st.done, total: st.total, failed: st.failed });
+        } else if (st.state === 'swapping') {
+            text = i18n.t('admin_settings_reindex_swapping', { model: st.model, done: st.swapped, total: st.total });
+        } else if (st.state === 'done') {
+            text = '✅ ' + i18n.t('admin_settings_reindex_done', { model: st.model, total: st.total });
+        } else if (st.state === 'canceled') {
+            text = i18n.t('admin_settings_reindex_canceled', { done: st.done, total: st.total });
+        } else {
+            text = '❌ ' + i18n.t('admin_settings_reindex_failed') + (st.error ? ': ' + st.error : '');
+        }
+        if (running && st.current) text += ' — ' + st.current;
+        el.textContent = text;
+        el.style.color = st.state === 'failed' ? '#e53e3e' : (st.state === 'done' ? '#38a169' : '#6b7280');
+        el.classList.remove('hidden');
+    }
 
-        var serverPort = getVal('cfg-server-port');
+    function watchReindex() {
+        if (reindexWatching) return;
+        reindexWatching = true;
+        adminFetch('/api/admin/reindex/events')
+            .then(function (res) {
+                return readBatchSSE(res, function (event, data) {
+                    renderReindexStatus(data);
+                    if (event === 'done' && data.state === 'done') loadAdminSettings();
+                });
+            })
+            .catch(function () {})
+            .finally(function () { reindexWatching = false; });
+    }
 
-        var llmEndpoint = getVal('cfg-llm-endpoint');
+    // loadReindexStatus shows the last reindex job and follows a running one.
+    function loadReindexStatus() {
+        adminFetch('/api/admin/reindex')
+            .then(function (res) { return res.ok ? res.json() : null; })
+            .then(function (data) {
+                if (!data || !data.status) return;
+                renderReindexStatus(data.status);
+                if (data.status.state === 'embedding' || data.status.state === 'swapping') watchReindex();
+            })
+            .catch(function () {});
+    }
+
+    window.startReindex = function () {
+        var model = getVal('cfg-emb-model');
+        if (!getVal('cfg-emb-endpoint') || !model) {
+            showAdminToast(i18n.t('admin_settings_test_missing_fields'), 'error');
+            return;
+        }
+        if (!confirm(i18n.t('admin_settings_reindex_confirm', { model: model }))) return;
+        var multimodal = document.getElementById('cfg-emb-multimodal');
+        var btn = document.getElementById('btn-reindex');
+        if (btn) btn.disabled = true;
+        adminFetch('/api/admin/reindex', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                endpoint: getVal('cfg-emb-endpoint'),
+                api_key: getVal('cfg-emb-apikey'),
+                model_name: model,
+                use_multimodal: multimodal ? multimodal.value === 'true' : false
+            })
+        })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_settings_reindex_failed')); });
+            return res.json();
+        })
+        .then(function (st) {
+            renderReindexStatus(st);
+            watchReindex();
+        })
+        .catch(function (err) {
+            if (btn) btn.disabled = false;
+            showAdminToast(err.message || i18n.t('admin_settings_reindex_failed'), 'error');
+        });
+    };
+
+    window.cancelReindex = function () {
+        adminFetch('/api/admin/reindex', { method: 'DELETE' })
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || 'HTTP ' + res.status); });
+            })
+            .catch(function (err) { showAdminToast(err.message, 'error'); });
+    };
+
+    window.testRerank = function () {
+        var btn = document.getElementById('btn-test-rerank');
+        var result = document.getElementById('test-rerank-result');
+        var spinner = document.getElementById('spinner-test-rerank');
+        var endpoint = getVal('cfg-rerank-endpoint');
+        var apiKey = getVal('cfg-rerank-apikey');
+        var model = getVal('cfg-rerank-model');
+
+        // Empty apiKey falls back to the saved key; self-hosted servers may need none
+        if (!endpoint || !model) {
+            if (result) { result.textContent = i18n.t('admin_settings_test_missing_fields'); result.style.color = '#e53e3e'; result.classList.remove('hidden'); }
+            return;
+        }
+        if (btn) btn.disabled = true;
+        if (spinner) spinner.classList.remove('hidden');
+        if (result) { result.textContent = i18n.t('admin_settings_test_testing'); result.style.color = '#6b7280'; result.classList.remove('hidden'); }
+
+        adminFetch('/api/test/rerank', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ endpoint: endpoint, api_key: apiKey, model_name: model })
+        })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_settings_test_failed')); });
+            return res.json();
+        })
+        .then(function (data) {
+            if (!result) return;
+            if (data.ranked_correctly) {
+                result.textContent = '✅ ' + i18n.t('admin_settings_test_success');
+                result.style.color = '#38a169';
+            } else {
+                result.textContent = '⚠️ ' + i18n.t('admin_settings_rerank_test_misranked');
+                result.style.color = '#d69e2e';
+            }
+        })
+        .catch(function (err) {
+            if (result) { result.textContent = '❌ ' + (err.message || i18n.t('admin_settings_test_failed')); result.style.color = '#e53e3e'; }
+        })
+        .finally(function () {
+            if (btn) btn.disabled = false;
+            if (spinner) spinner.classList.add('hidden');
+        });
+    };
+
+    window.saveAdminSettings = function () {
+        var updates = {};
+
+        var serverPort = getVal('cfg-server-port');
+        var externalBaseURL = getVal('cfg-server-external-base-url');
+
+        var llmEndpoint = getVal('cfg-llm-endpoint');
         var llmModel = getVal('cfg-llm-model');
         var llmApiKey = getVal('cfg-llm-apikey');
         var llmTemp = getVal('cfg-llm-temperature');
@@ -3611,18 +5897,42 @@
         var vecTopK = getVal('cfg-vec-topk');
         var vecThreshold = getVal('cfg-vec-threshold');
 
+        var llmProvider = getVal('cfg-llm-provider');
+        if (llmProvider) updates['llm.provider'] = llmProvider;
         if (llmEndpoint) updates['llm.endpoint'] = llmEndpoint;
         if (serverPort !== '') updates['server.port'] = parseInt(serverPort, 10);
+        updates['server.external_base_url'] = externalBaseURL;
         if (llmModel) updates['llm.model_name'] = llmModel;
         if (llmApiKey) updates['llm.api_key'] = llmApiKey;
         if (llmTemp !== '') updates['llm.temperature'] = parseFloat(llmTemp);
         if (llmMaxTokens !== '') updates['llm.max_tokens'] = parseInt(llmMaxTokens, 10);
+        var llmQueueKeys = {
+            'cfg-llm-max-concurrency': 'llm.max_concurrency',
+            'cfg-llm-max-queue': 'llm.max_queue',
+            'cfg-llm-max-queued-per-user': 'llm.max_queued_per_user',
+            'cfg-llm-queue-timeout': 'llm.queue_timeout_sec'
+        };
+        Object.keys(llmQueueKeys).forEach(function (id) {
+            var v = getVal(id);
+            if (v !== '') updates[llmQueueKeys[id]] = parseInt(v, 10);
+        });
+        var llmPrice = getVal('cfg-llm-price');
+        if (llmPrice !== '') updates['llm.price_per_m_tokens'] = parseFloat(llmPrice);
 
         if (embEndpoint) updates['embedding.endpoint'] = embEndpoint;
         if (embModel) updates['embedding.model_name'] = embModel;
         if (embApiKey) updates['embedding.api_key'] = embApiKey;
         var embMultimodal = getVal('cfg-emb-multimodal');
         updates['embedding.use_multimodal'] = embMultimodal === 'true';
+        var embPrice = getVal('cfg-emb-price');
+        if (embPrice !== '') updates['embedding.price_per_m_tokens'] = parseFloat(embPrice);
+
+        updates['rerank.enabled'] = getVal('cfg-rerank-enabled') === 'true';
+        updates['rerank.endpoint'] = getVal('cfg-rerank-endpoint');
+        updates['rerank.model_name'] = getVal('cfg-rerank-model');
+        var rerankApiKey = getVal('cfg-rerank-apikey');
+        if (rerankApiKey) updates['rerank.api_key'] = rerankApiKey;
+        updates['rerank.top_n'] = parseInt(getVal('cfg-rerank-top-n'), 10) || 0;
 
         if (vecChunkSize !== '') updates['vector.chunk_size'] = parseInt(vecChunkSize, 10);
         if (vecOverlap !== '') updates['vector.overlap'] = parseInt(vecOverlap, 10);
@@ -3630,15 +5940,40 @@
         if (vecThreshold !== '') updates['vector.threshold'] = parseFloat(vecThreshold);
         var vecContentPriority = getVal('cfg-vec-content-priority');
         if (vecContentPriority) updates['vector.content_priority'] = vecContentPriority;
+        var vecLanguageFilter = getVal('cfg-vec-language-filter');
+        if (vecLanguageFilter) updates['vector.language_filter'] = vecLanguageFilter;
         var vecTextMatch = getVal('cfg-vec-text-match');
         updates['vector.text_match_enabled'] = vecTextMatch === 'true';
         var vecDebugMode = getVal('cfg-vec-debug-mode');
         updates['vector.debug_mode'] = vecDebugMode === 'true';
+        updates['verify.mode'] = getVal('cfg-verify-mode');
+        updates['review.required'] = getVal('cfg-review-required') === 'true';
+        updates['tagging.enabled'] = getVal('cfg-tagging-enabled') === 'true';
+        updates['audit.disabled'] = getVal('cfg-audit-enabled') === 'false';
+        updates['audit.retention_days'] = parseInt(getVal('cfg-audit-retention')) || 0;
+        updates['portal.enabled'] = getVal('cfg-portal-enabled') === 'true';
+        updates['html.main_content_enabled'] = getVal('cfg-html-main-content') === 'true';
+        var htmlSelectors = {};
+        getVal('cfg-html-selectors').split('\n').forEach(function (line) {
+            var eq = line.indexOf('=');
+            if (eq <= 0) return;
+            var host = line.slice(0, eq).trim().toLowerCase();
+            var selector = line.slice(eq + 1).trim();
+            if (host && selector) htmlSelectors[host] = selector;
+        });
+        updates['html.selectors'] = htmlSelectors;
 
         var adminLoginRouteVal = getVal('cfg-admin-login-route');
         if (adminLoginRouteVal) {
             updates['admin.login_route'] = adminLoginRouteVal;
         }
+        updates['password.min_length'] = parseInt(getVal('cfg-password-min-length'), 10) || 0;
+        updates['password.require'] = Array.prototype.map.call(
+            document.querySelectorAll('.cfg-password-require:checked'), function (cb) { return cb.value; });
+        updates['password.breach_list'] = getVal('cfg-password-breach-list');
+        updates['password.max_age_days'] = parseInt(getVal('cfg-password-max-age'), 10) || 0;
+        updates['session.idle_timeout_minutes'] = parseInt(getVal('cfg-session-idle-timeout'), 10) || 0;
+        updates['session.max_lifetime_hours'] = parseInt(getVal('cfg-session-max-lifetime'), 10) || 0;
 
         var productName = getVal('cfg-product-name');
         updates['product_name'] = productName;
@@ -3646,6 +5981,22 @@
         var productIntro = getVal('cfg-product-intro');
         updates['product_intro'] = productIntro;
 
+        updates['small_talk.disabled'] = getVal('cfg-small-talk-enabled') === 'false';
+        var smallTalkInterval = getVal('cfg-small-talk-interval');
+        if (smallTalkInterval !== '') updates['small_talk.intro_interval_min'] = parseInt(smallTalkInterval, 10);
+        var smallTalkRules = [];
+        getVal('cfg-small-talk-rules').split('\n').forEach(function (line) {
+            var parts = line.split('|');
+            if (parts.length < 3) return;
+            smallTalkRules.push({
+                language: parts[0].trim(),
+                kind: parts[1].trim(),
+                phrases: parts[2].split(/[,，]/).map(function (p) { return p.trim(); }).filter(function (p) { return p; }),
+                reply: parts.slice(3).join('|').trim()
+            });
+        });
+        updates['small_talk.rules'] = smallTalkRules;
+
         var authServer = getVal('cfg-auth-server');
         updates['auth_server'] = authServer;
 
@@ -3667,6 +6018,31 @@
         updates['smtp.use_tls'] = smtpTls === 'true';
         updates['smtp.auth_method'] = smtpAuthMethod || '';
 
+        var splitList = function (s) {
+            return s.split(',').map(function (v) { return v.trim(); }).filter(function (v) { return v; });
+        };
+        updates['email_ingest.enabled'] = getVal('cfg-email-ingest-enabled') === 'true';
+        var emailIngestToken = getVal('cfg-email-ingest-token');
+        if (emailIngestToken) updates['email_ingest.token'] = emailIngestToken;
+        updates['email_ingest.recipients'] = splitList(getVal('cfg-email-ingest-recipients'));
+        updates['email_ingest.allowed_senders'] = splitList(getVal('cfg-email-ingest-senders'));
+        updates['email_ingest.product_id'] = getVal('cfg-email-ingest-product');
+        ['slack', 'lark', 'dingtalk'].forEach(function (ch) {
+            updates['notifications.' + ch + '.enabled'] = getVal('cfg-notify-' + ch + '-enabled') === 'true';
+            var webhook = getVal('cfg-notify-' + ch + '-webhook');
+            if (webhook) updates['notifications.' + ch + '.webhook_url'] = webhook;
+            var secret = getVal('cfg-notify-' + ch + '-secret');
+            if (secret) updates['notifications.' + ch + '.secret'] = secret;
+        });
+
+        updates['external_auth.enabled'] = getVal('cfg-external-auth-enabled') === 'true';
+        updates['external_auth.label'] = getVal('cfg-external-auth-label');
+        updates['external_auth.name'] = getVal('cfg-external-auth-name');
+        updates['external_auth.verify_url'] = getVal('cfg-external-auth-url');
+        var extAuthSecret = getVal('cfg-external-auth-secret');
+        if (extAuthSecret) updates['external_auth.secret'] = extAuthSecret;
+        updates['external_auth.timeout_sec'] = parseInt(getVal('cfg-external-auth-timeout'), 10) || 0;
+
         // Collect OAuth provider settings
         var oauthCards = document.querySelectorAll('.oauth-provider-card');
         oauthCards.forEach(function (card) {
@@ -3742,93 +6118,818 @@
                 return res.json();
             })
             .then(function (data) {
-                var lines = data.lines || [];
-                var rotMB = data.rotation_mb || 100;
-                var rotInput = document.getElementById('cfg-log-rotation-mb');
-                if (rotInput) rotInput.value = rotMB;
-                if (lines.length === 0) {
-                    content.innerHTML = '<span style="color:#94a3b8;">' + i18n.t('admin_logs_empty') + '</span>';
+                var lines = data.lines || [];
+                var rotMB = data.rotation_mb || 100;
+                var rotInput = document.getElementById('cfg-log-rotation-mb');
+                if (rotInput) rotInput.value = rotMB;
+                if (lines.length === 0) {
+                    content.innerHTML = '<span style="color:#94a3b8;">' + i18n.t('admin_logs_empty') + '</span>';
+                    return;
+                }
+                // Render lines with color coding
+                var html = '';
+                lines.forEach(function (line) {
+                    var escaped = line.replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;');
+                    // Highlight timestamp
+                    escaped = escaped.replace(/^(\d{4}\/\d{2}\/\d{2}\s+\d{2}:\d{2}:\d{2})/, '<span class="log-line-time">$1</span>');
+                    // Highlight [ERROR]
+                    escaped = escaped.replace(/\[ERROR\]/, '<span class="log-line-error">[ERROR]</span>');
+                    html += escaped + '\n';
+                });
+                content.innerHTML = html;
+                // Auto-scroll to bottom
+                var viewer = document.getElementById('log-viewer');
+                if (viewer) viewer.scrollTop = viewer.scrollHeight;
+            })
+            .catch(function (err) {
+                content.textContent = i18n.t('admin_logs_load_failed') + ': ' + (err.message || i18n.t('admin_logs_unknown_error'));
+            });
+    };
+
+    window.saveLogRotation = function () {
+        var input = document.getElementById('cfg-log-rotation-mb');
+        if (!input) return;
+        var val = parseInt(input.value, 10);
+        if (isNaN(val) || val < 1 || val > 10240) {
+            showAdminToast(i18n.t('admin_logs_rotation_range_error'), 'error');
+            return;
+        }
+        adminFetch('/api/logs/rotation', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ rotation_mb: val })
+        })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_logs_save_failed')); });
+            showAdminToast(i18n.t('admin_logs_rotation_saved'), 'success');
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_logs_save_failed'), 'error');
+        });
+    };
+
+    window.downloadLogs = function () {
+        requestOperationToken('/api/logs/download', getAdminToken())
+        .then(function (token) {
+            startLinkDownload('/api/logs/download?op_token=' + encodeURIComponent(token), 'error_log.gz');
+            showAdminToast(i18n.t('admin_logs_download_done'), 'success');
+        })
+        .catch(function () {
+            showAdminToast(i18n.t('admin_logs_download_failed'), 'error');
+        });
+    };
+
+    window.confirmClearLogs = function () {
+        if (!confirm(i18n.t('admin_logs_clear_confirm'))) {
+            return;
+        }
+        adminFetch('/api/logs/clear', { method: 'DELETE' })
+        .then(function (res) {
+            if (!res.ok) throw new Error(i18n.t('admin_logs_clear_failed'));
+            return res.json();
+        })
+        .then(function (data) {
+            showAdminToast(i18n.t('admin_logs_clear_done'), 'success');
+            loadRecentLogs();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_logs_clear_failed'), 'error');
+        });
+    };
+
+    // --- Database Maintenance ---
+
+    function formatMaintenanceBytes(n) {
+        if (!n) return '0 B';
+        if (n < 1024) return n + ' B';
+        if (n < 1048576) return (n / 1024).toFixed(1) + ' KB';
+        if (n < 1073741824) return (n / 1048576).toFixed(1) + ' MB';
+        return (n / 1073741824).toFixed(2) + ' GB';
+    }
+
+    window.loadMaintenanceStatus = function () {
+        var tbody = document.getElementById('maintenance-runs-tbody');
+        if (!tbody) return;
+        adminFetch('/api/admin/maintenance')
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_maintenance_load_failed'));
+                return res.json();
+            })
+            .then(function (data) {
+                var cfg = data.config || {};
+                var enabledSel = document.getElementById('cfg-maintenance-enabled');
+                if (enabledSel) enabledSel.value = cfg.disabled ? 'false' : 'true';
+                var startInput = document.getElementById('cfg-maintenance-start');
+                if (startInput && cfg.window_start) startInput.value = cfg.window_start;
+                var endInput = document.getElementById('cfg-maintenance-end');
+                if (endInput && cfg.window_end) endInput.value = cfg.window_end;
+
+                var nextEl = document.getElementById('maintenance-next-run');
+                if (nextEl) {
+                    if (data.running) {
+                        nextEl.textContent = i18n.t('admin_maintenance_running');
+                    } else if (data.next_run) {
+                        nextEl.textContent = i18n.t('admin_maintenance_next_run') + ': ' + new Date(data.next_run).toLocaleString(i18n.getLang());
+                    } else {
+                        nextEl.textContent = '';
+                    }
+                }
+                var runBtn = document.getElementById('maintenance-run-btn');
+                if (runBtn) runBtn.disabled = !!data.running;
+
+                var runs = data.runs || [];
+                if (runs.length === 0) {
+                    tbody.innerHTML = '<tr><td colspan="7" class="admin-table-empty">' + i18n.t('admin_maintenance_empty') + '</td></tr>';
+                } else {
+                    var html = '';
+                    runs.forEach(function (r) {
+                        var result = r.error
+                            ? '<span class="log-line-error">' + escapeHtml(r.error) + '</span>'
+                            : i18n.t(r.full_vacuum ? 'admin_maintenance_full_vacuum' : 'admin_maintenance_ok');
+                        html += '<tr>' +
+                            '<td>' + new Date(r.started_at).toLocaleString(i18n.getLang()) + '</td>' +
+                            '<td>' + i18n.t('admin_maintenance_trigger_' + (r.trigger === 'manual' ? 'manual' : 'scheduled')) + '</td>' +
+                            '<td>' + (r.duration_ms / 1000).toFixed(1) + ' s</td>' +
+                            '<td>' + formatMaintenanceBytes(r.db_size_before) + ' → ' + formatMaintenanceBytes(r.db_size_after) + '</td>' +
+                            '<td>' + formatMaintenanceBytes(r.wal_size_before) + ' → ' + formatMaintenanceBytes(r.wal_size_after) + '</td>' +
+                            '<td>' + (r.freed_pages || 0) + '</td>' +
+                            '<td>' + result + '</td>' +
+                            '</tr>';
+                    });
+                    tbody.innerHTML = html;
+                }
+                // Keep polling while a run is in progress
+                if (data.running) {
+                    setTimeout(loadMaintenanceStatus, 3000);
+                }
+            })
+            .catch(function (err) {
+                tbody.innerHTML = '<tr><td colspan="7" class="admin-table-empty">' + escapeHtml(err.message || i18n.t('admin_maintenance_load_failed')) + '</td></tr>';
+            });
+    };
+
+    window.saveMaintenanceSettings = function () {
+        var enabledSel = document.getElementById('cfg-maintenance-enabled');
+        var startInput = document.getElementById('cfg-maintenance-start');
+        var endInput = document.getElementById('cfg-maintenance-end');
+        if (!enabledSel || !startInput || !endInput) return;
+        adminFetch('/api/config', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                'maintenance.disabled': enabledSel.value === 'false',
+                'maintenance.window_start': startInput.value,
+                'maintenance.window_end': endInput.value
+            })
+        })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_logs_save_failed')); });
+            showAdminToast(i18n.t('admin_maintenance_saved'), 'success');
+            loadMaintenanceStatus();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_logs_save_failed'), 'error');
+        });
+    };
+
+    // --- Background Jobs ---
+
+    var jobsPollTimer = null;
+
+    window.loadJobs = function () {
+        var tbody = document.getElementById('jobs-tbody');
+        if (!tbody) return;
+        if (jobsPollTimer) { clearTimeout(jobsPollTimer); jobsPollTimer = null; }
+        adminFetch('/api/admin/jobs?limit=50')
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_jobs_load_failed'));
+                return res.json();
+            })
+            .then(function (data) {
+                var concurrencyInput = document.getElementById('cfg-jobs-concurrency');
+                if (concurrencyInput && document.activeElement !== concurrencyInput) concurrencyInput.value = data.concurrency || 2;
+                var summaryEl = document.getElementById('jobs-summary');
+                if (summaryEl) summaryEl.textContent = i18n.t('admin_jobs_summary', { running: data.running || 0, queued: data.queued || 0 });
+
+                var list = data.jobs || [];
+                if (list.length === 0) {
+                    tbody.innerHTML = '<tr><td colspan="6" class="admin-table-empty">' + i18n.t('admin_jobs_empty') + '</td></tr>';
+                } else {
+                    var html = '';
+                    list.forEach(function (j) {
+                        var active = j.status === 'queued' || j.status === 'running';
+                        var status = i18n.t('admin_jobs_status_' + j.status);
+                        if (j.error) status += ': <span class="log-line-error">' + escapeHtml(j.error) + '</span>';
+                        var progress = j.status === 'running' ? j.progress + '%' + (j.message ? ' · ' + escapeHtml(j.message) : '') : '';
+                        html += '<tr>' +
+                            '<td>' + new Date(j.created_at).toLocaleString(i18n.getLang()) + '</td>' +
+                            '<td>' + i18n.t('admin_jobs_type_' + j.type) + '</td>' +
+                            '<td>' + escapeHtml(j.label || j.target || '') + '</td>' +
+                            '<td>' + status + '</td>' +
+                            '<td>' + progress + '</td>' +
+                            '<td>' + (active ? '<button type="button" class="btn-danger btn-sm" onclick="cancelJob(\'' + escapeHtml(j.id) + '\')">' + i18n.t('admin_jobs_cancel') + '</button>' : '') + '</td>' +
+                            '</tr>';
+                    });
+                    tbody.innerHTML = html;
+                }
+                // Keep polling while jobs are active and the panel is shown
+                var panel = document.getElementById('settings-panel-settings-logs');
+                if ((data.running || data.queued) && panel && !panel.classList.contains('hidden')) {
+                    jobsPollTimer = setTimeout(loadJobs, 3000);
+                }
+            })
+            .catch(function (err) {
+                tbody.innerHTML = '<tr><td colspan="6" class="admin-table-empty">' + escapeHtml(err.message || i18n.t('admin_jobs_load_failed')) + '</td></tr>';
+            });
+    };
+
+    window.cancelJob = function (id) {
+        if (!confirm(i18n.t('admin_jobs_cancel_confirm'))) return;
+        adminFetch('/api/admin/jobs/' + encodeURIComponent(id) + '/cancel', { method: 'POST' })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_jobs_cancel_failed')); });
+            showAdminToast(i18n.t('admin_jobs_canceled'), 'success');
+            loadJobs();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_jobs_cancel_failed'), 'error');
+        });
+    };
+
+    window.saveJobSettings = function () {
+        var input = document.getElementById('cfg-jobs-concurrency');
+        if (!input) return;
+        var n = parseInt(input.value, 10);
+        if (!(n >= 1 && n <= 16)) {
+            showAdminToast(i18n.t('admin_jobs_concurrency_invalid'), 'error');
+            return;
+        }
+        adminFetch('/api/config', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ 'jobs.concurrency': n })
+        })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_logs_save_failed')); });
+            showAdminToast(i18n.t('admin_jobs_saved'), 'success');
+            loadJobs();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_logs_save_failed'), 'error');
+        });
+    };
+
+    window.runMaintenanceNow = function () {
+        adminFetch('/api/admin/maintenance/run', { method: 'POST' })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_maintenance_failed')); });
+            showAdminToast(i18n.t('admin_maintenance_started'), 'success');
+            loadMaintenanceStatus();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_maintenance_failed'), 'error');
+        });
+    };
+
+    // --- Analytics Export ---
+
+    window.loadExportStatus = function () {
+        var tbody = document.getElementById('export-runs-tbody');
+        if (!tbody) return;
+        adminFetch('/api/admin/export')
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_export_load_failed'));
+                return res.json();
+            })
+            .then(function (data) {
+                var cfg = data.config || {};
+                var setField = function (id, v) {
+                    var el = document.getElementById(id);
+                    if (el) el.value = v;
+                };
+                setField('cfg-export-enabled', cfg.enabled ? 'true' : 'false');
+                setField('cfg-export-interval', cfg.interval_hours || '');
+                setField('cfg-export-format', cfg.format === 'csv' ? 'csv' : 'ndjson');
+                setField('cfg-export-dir', cfg.dir || '');
+                setField('cfg-export-s3', cfg.s3 ? 'true' : 'false');
+                setField('cfg-export-s3-prefix', cfg.s3_prefix || '');
+                setField('cfg-export-webhook', '');
+                setField('cfg-export-secret', '');
+                var webhookInput = document.getElementById('cfg-export-webhook');
+                if (webhookInput) webhookInput.placeholder = cfg.webhook_url ? '***' : i18n.t('admin_settings_not_set');
+                var secretInput = document.getElementById('cfg-export-secret');
+                if (secretInput) secretInput.placeholder = cfg.webhook_secret ? '***' : i18n.t('admin_settings_not_set');
+
+                var nextEl = document.getElementById('export-next-run');
+                if (nextEl) {
+                    if (data.running) {
+                        nextEl.textContent = i18n.t('admin_export_running');
+                    } else if (data.next_run) {
+                        nextEl.textContent = i18n.t('admin_export_next_run') + ': ' + new Date(data.next_run).toLocaleString(i18n.getLang());
+                    } else {
+                        nextEl.textContent = '';
+                    }
+                }
+                var runBtn = document.getElementById('export-run-btn');
+                if (runBtn) runBtn.disabled = !!data.running;
+
+                var runs = data.runs || [];
+                if (runs.length === 0) {
+                    tbody.innerHTML = '<tr><td colspan="6" class="admin-table-empty">' + i18n.t('admin_export_empty') + '</td></tr>';
+                } else {
+                    var html = '';
+                    runs.forEach(function (r) {
+                        var from = r.period_from && r.period_from.indexOf('0001-') !== 0
+                            ? new Date(r.period_from).toLocaleString(i18n.getLang())
+                            : i18n.t('admin_export_period_all');
+                        var result = r.error
+                            ? '<span class="log-line-error">' + escapeHtml(r.error) + '</span>'
+                            : escapeHtml((r.files || []).join('\n')).replace(/\n/g, '<br>');
+                        html += '<tr>' +
+                            '<td>' + new Date(r.started_at).toLocaleString(i18n.getLang()) + '</td>' +
+                            '<td>' + i18n.t('admin_maintenance_trigger_' + (r.trigger === 'manual' ? 'manual' : 'scheduled')) + '</td>' +
+                            '<td>' + from + ' → ' + new Date(r.period_to).toLocaleString(i18n.getLang()) + '</td>' +
+                            '<td>' + i18n.t('admin_export_rows')
+                                .replace('{queries}', r.queries || 0)
+                                .replace('{feedback}', r.feedback || 0)
+                                .replace('{usage}', r.usage_rows || 0) + '</td>' +
+                            '<td>' + (r.duration_ms / 1000).toFixed(1) + ' s</td>' +
+                            '<td>' + result + '</td>' +
+                            '</tr>';
+                    });
+                    tbody.innerHTML = html;
+                }
+                // Keep polling while a run is in progress
+                if (data.running) {
+                    setTimeout(loadExportStatus, 3000);
+                }
+            })
+            .catch(function (err) {
+                tbody.innerHTML = '<tr><td colspan="6" class="admin-table-empty">' + escapeHtml(err.message || i18n.t('admin_export_load_failed')) + '</td></tr>';
+            });
+    };
+
+    window.saveExportSettings = function () {
+        var val = function (id) {
+            var el = document.getElementById(id);
+            return el ? el.value.trim() : '';
+        };
+        var updates = {
+            'export.enabled': val('cfg-export-enabled') === 'true',
+            'export.format': val('cfg-export-format') || 'ndjson',
+            'export.dir': val('cfg-export-dir'),
+            'export.s3': val('cfg-export-s3') === 'true',
+            'export.s3_prefix': val('cfg-export-s3-prefix')
+        };
+        var interval = parseInt(val('cfg-export-interval'), 10);
+        if (interval) updates['export.interval_hours'] = interval;
+        var webhook = val('cfg-export-webhook');
+        if (webhook) updates['export.webhook_url'] = webhook;
+        var secret = val('cfg-export-secret');
+        if (secret) updates['export.webhook_secret'] = secret;
+        adminFetch('/api/config', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(updates)
+        })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_logs_save_failed')); });
+            showAdminToast(i18n.t('admin_export_saved'), 'success');
+            loadExportStatus();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_logs_save_failed'), 'error');
+        });
+    };
+
+    window.runExportNow = function () {
+        adminFetch('/api/admin/export/run', { method: 'POST' })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_export_failed')); });
+            showAdminToast(i18n.t('admin_export_started'), 'success');
+            loadExportStatus();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_export_failed'), 'error');
+        });
+    };
+
+    // --- Model Budget ---
+
+    window.loadBudgetStatus = function () {
+        var tbody = document.getElementById('budget-tbody');
+        if (!tbody) return;
+        Promise.all([
+            adminFetch('/api/admin/budget').then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_budget_load_failed'));
+                return res.json();
+            }),
+            adminFetch('/api/products').then(function (res) {
+                return res.ok ? res.json() : { products: [] };
+            })
+        ])
+        .then(function (results) {
+            var data = results[0];
+            var products = (results[1] && results[1].products) || [];
+            var limitInput = document.getElementById('cfg-budget-limit');
+            if (limitInput) limitInput.value = data.deployment.limit || '';
+            var actionSelect = document.getElementById('cfg-budget-on-limit');
+            if (actionSelect) actionSelect.value = data.on_limit === 'degrade' ? 'degrade' : 'block_optional';
+
+            var scopes = {};
+            (data.products || []).forEach(function (p) { scopes[p.product_id] = p; });
+            var percentCell = function (scope) {
+                if (!scope || !scope.limit) return '<td>-</td>';
+                var text = scope.percent.toFixed(1) + '%';
+                return '<td>' + (scope.limited ? '<span class="log-line-error">' + text + '</span>' : text) + '</td>';
+            };
+            var html = '<tr>' +
+                '<td>' + i18n.t('admin_budget_deployment') + '</td>' +
+                '<td>' + data.deployment.spent.toFixed(2) + '</td>' +
+                '<td>' + (data.deployment.limit ? data.deployment.limit.toFixed(2) : i18n.t('admin_budget_unlimited')) + '</td>' +
+                percentCell(data.deployment) +
+                '</tr>';
+            var listed = {};
+            var addRow = function (id, name) {
+                listed[id] = true;
+                var scope = scopes[id] || { spent: 0, limit: 0 };
+                html += '<tr>' +
+                    '<td>' + escapeHtml(name || id) + '</td>' +
+                    '<td>' + scope.spent.toFixed(2) + '</td>' +
+                    '<td><input type="number" class="budget-product-limit" data-product-id="' + escapeHtml(id) + '" min="0" step="0.01" value="' + (scope.limit || '') + '" placeholder="' + i18n.t('admin_budget_unlimited') + '" style="width:8rem;"></td>' +
+                    percentCell(scope) +
+                    '</tr>';
+            };
+            products.forEach(function (p) { addRow(p.id, p.name); });
+            (data.products || []).forEach(function (p) {
+                if (!listed[p.product_id]) addRow(p.product_id, p.name);
+            });
+            tbody.innerHTML = html;
+
+            var tokens = { llm: 0, embedding: 0 };
+            (data.usage || []).forEach(function (u) { tokens[u.kind] = (tokens[u.kind] || 0) + u.tokens; });
+            var summary = document.getElementById('budget-usage-summary');
+            if (summary) {
+                summary.textContent = i18n.t('admin_budget_summary')
+                    .replace('{month}', data.month)
+                    .replace('{llm}', tokens.llm)
+                    .replace('{embedding}', tokens.embedding);
+            }
+        })
+        .catch(function (err) {
+            tbody.innerHTML = '<tr><td colspan="4" class="admin-table-empty">' + escapeHtml(err.message || i18n.t('admin_budget_load_failed')) + '</td></tr>';
+        });
+    };
+
+    window.saveBudgetSettings = function () {
+        var limitInput = document.getElementById('cfg-budget-limit');
+        var actionSelect = document.getElementById('cfg-budget-on-limit');
+        var productLimits = {};
+        document.querySelectorAll('.budget-product-limit').forEach(function (input) {
+            var v = parseFloat(input.value);
+            if (v > 0) productLimits[input.getAttribute('data-product-id')] = v;
+        });
+        var updates = {
+            'budget.monthly_limit': parseFloat(limitInput && limitInput.value) || 0,
+            'budget.on_limit': actionSelect ? actionSelect.value : 'block_optional',
+            'budget.product_limits': productLimits
+        };
+        adminFetch('/api/config', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(updates)
+        })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_logs_save_failed')); });
+            showAdminToast(i18n.t('admin_budget_saved'), 'success');
+            loadBudgetStatus();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_logs_save_failed'), 'error');
+        });
+    };
+
+    // --- Query Replay ---
+
+    var replaySampleID = '';
+    var replayReportRunID = '';
+    var replayRunsCache = [];
+    var replayReportData = null;
+    var replayPollTimer = null;
+
+    function replayRunLabel(r) {
+        return new Date(r.created_at).toLocaleString(i18n.getLang()) + ' · ' + (r.settings.llm_model || '-');
+    }
+
+    window.loadReplaySamples = function () {
+        var tbody = document.getElementById('replay-samples-tbody');
+        if (!tbody) return;
+        var select = document.getElementById('replay-product-select');
+        if (select) {
+            var current = select.value;
+            select.innerHTML = '<option value="">' + i18n.t('admin_replay_all_products') + '</option>';
+            (adminProductsCache || []).forEach(function (p) {
+                var opt = document.createElement('option');
+                opt.value = p.id;
+                opt.textContent = p.name;
+                select.appendChild(opt);
+            });
+            if (current) select.value = current;
+        }
+        adminFetch('/api/admin/replay/samples')
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_replay_load_failed')); });
+                return res.json();
+            })
+            .then(function (data) {
+                var list = data.samples || [];
+                if (list.length === 0) {
+                    tbody.innerHTML = '<tr><td colspan="5" class="admin-table-empty">' + i18n.t('admin_replay_empty') + '</td></tr>';
+                    return;
+                }
+                var html = '';
+                list.forEach(function (s) {
+                    var id = escapeHtml(s.id);
+                    html += '<tr>' +
+                        '<td>' + new Date(s.created_at).toLocaleString(i18n.getLang()) + '</td>' +
+                        '<td>' + escapeHtml(s.name) + '</td>' +
+                        '<td>' + escapeHtml(s.product_id ? getProductNameByID(s.product_id) : i18n.t('admin_replay_all_products')) + '</td>' +
+                        '<td>' + s.size + '</td>' +
+                        '<td>' +
+                            '<button type="button" class="btn-primary btn-sm" onclick="startReplay(\'' + id + '\')">' + i18n.t('admin_replay_run') + '</button> ' +
+                            '<button type="button" class="btn-secondary btn-sm" onclick="loadReplayRuns(\'' + id + '\')">' + i18n.t('admin_replay_runs') + '</button> ' +
+                            '<button type="button" class="btn-danger btn-sm" onclick="deleteReplaySample(\'' + id + '\')">' + i18n.t('admin_replay_delete') + '</button>' +
+                        '</td>' +
+                        '</tr>';
+                });
+                tbody.innerHTML = html;
+            })
+            .catch(function (err) {
+                tbody.innerHTML = '<tr><td colspan="5" class="admin-table-empty">' + escapeHtml(err.message || i18n.t('admin_replay_load_failed')) + '</td></tr>';
+            });
+    };
+
+    window.createReplaySample = function () {
+        var btn = document.getElementById('replay-create-btn');
+        var body = {
+            name: document.getElementById('replay-name').value.trim(),
+            product_id: document.getElementById('replay-product-select').value,
+            size: parseInt(document.getElementById('replay-size').value, 10) || 0,
+            from: document.getElementById('replay-from').value,
+            to: document.getElementById('replay-to').value
+        };
+        setBtnLoading(btn);
+        adminFetch('/api/admin/replay/samples', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        })
+        .then(function (res) {
+            return res.json().then(function (d) {
+                if (!res.ok) throw new Error(d.error || i18n.t('admin_replay_create_failed'));
+                return d;
+            });
+        })
+        .then(function (sample) {
+            showAdminToast(i18n.t('admin_replay_created', { size: sample.size }), 'success');
+            document.getElementById('replay-name').value = '';
+            loadReplaySamples();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_replay_create_failed'), 'error');
+        })
+        .then(function () {
+            resetBtnLoading(btn);
+        });
+    };
+
+    window.deleteReplaySample = function (id) {
+        if (!confirm(i18n.t('admin_replay_delete_confirm'))) return;
+        adminFetch('/api/admin/replay/samples/' + encodeURIComponent(id), { method: 'DELETE' })
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_replay_delete_failed')); });
+                showAdminToast(i18n.t('admin_replay_deleted'), 'success');
+                if (replaySampleID === id) {
+                    replaySampleID = '';
+                    document.getElementById('replay-runs').classList.add('hidden');
+                    document.getElementById('replay-report').classList.add('hidden');
+                }
+                loadReplaySamples();
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_replay_delete_failed'), 'error');
+            });
+    };
+
+    window.startReplay = function (id) {
+        if (!confirm(i18n.t('admin_replay_run_confirm'))) return;
+        adminFetch('/api/admin/replay/samples/' + encodeURIComponent(id) + '/runs', { method: 'POST' })
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_replay_run_failed')); });
+                showAdminToast(i18n.t('admin_replay_started'), 'success');
+                loadReplayRuns(id);
+                loadJobs();
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_replay_run_failed'), 'error');
+            });
+    };
+
+    window.loadReplayRuns = function (sampleID) {
+        var tbody = document.getElementById('replay-runs-tbody');
+        if (!tbody) return;
+        if (replayPollTimer) { clearTimeout(replayPollTimer); replayPollTimer = null; }
+        if (sampleID !== replaySampleID) {
+            replaySampleID = sampleID;
+            document.getElementById('replay-report').classList.add('hidden');
+        }
+        document.getElementById('replay-runs').classList.remove('hidden');
+        adminFetch('/api/admin/replay/samples/' + encodeURIComponent(sampleID) + '/runs')
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_replay_load_failed')); });
+                return res.json();
+            })
+            .then(function (data) {
+                if (sampleID !== replaySampleID) return;
+                replayRunsCache = data.runs || [];
+                if (replayRunsCache.length === 0) {
+                    tbody.innerHTML = '<tr><td colspan="4" class="admin-table-empty">' + i18n.t('admin_replay_runs_empty') + '</td></tr>';
+                    return;
+                }
+                var active = false;
+                var html = '';
+                replayRunsCache.forEach(function (r) {
+                    var running = r.status === 'queued' || r.status === 'running';
+                    if (running) active = true;
+                    var settings = escapeHtml(r.settings.llm_model || '-') + ' / ' + escapeHtml(r.settings.embedding_model || '-') +
+                        '<br>T=' + r.settings.temperature + ' · top_k=' + r.settings.top_k + ' · ' + i18n.t('admin_replay_threshold') + '=' + r.settings.threshold;
+                    var status = r.status ? i18n.t('admin_jobs_status_' + r.status) : '';
+                    html += '<tr>' +
+                        '<td>' + new Date(r.created_at).toLocaleString(i18n.getLang()) + '</td>' +
+                        '<td>' + settings + '</td>' +
+                        '<td>' + status + (status ? ' · ' : '') + i18n.t('admin_replay_progress', { done: r.replayed }) + '</td>' +
+                        '<td><button type="button" class="btn-secondary btn-sm" onclick="loadReplayReport(\'' + escapeHtml(r.id) + '\', \'\')">' + i18n.t('admin_replay_report') + '</button></td>' +
+                        '</tr>';
+                });
+                tbody.innerHTML = html;
+                // Keep polling while a run is active and the panel is shown
+                var panel = document.getElementById('settings-panel-settings-logs');
+                if (active && panel && !panel.classList.contains('hidden')) {
+                    replayPollTimer = setTimeout(function () { loadReplayRuns(sampleID); }, 3000);
+                }
+            })
+            .catch(function (err) {
+                tbody.innerHTML = '<tr><td colspan="4" class="admin-table-empty">' + escapeHtml(err.message || i18n.t('admin_replay_load_failed')) + '</td></tr>';
+            });
+    };
+
+    window.loadReplayReport = function (runID, baseline) {
+        replayReportRunID = runID;
+        var url = '/api/admin/replay/runs/' + encodeURIComponent(runID);
+        if (baseline) url += '?baseline=' + encodeURIComponent(baseline);
+        adminFetch(url)
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_replay_load_failed')); });
+                return res.json();
+            })
+            .then(function (rep) {
+                replayReportData = rep;
+                var select = document.getElementById('replay-baseline-select');
+                var html = '<option value="original">' + i18n.t('admin_replay_baseline_original') + '</option>';
+                replayRunsCache.forEach(function (r) {
+                    if (r.id === runID) return;
+                    html += '<option value="' + escapeHtml(r.id) + '">' + escapeHtml(replayRunLabel(r)) + '</option>';
+                });
+                select.innerHTML = html;
+                select.value = rep.baseline;
+                document.getElementById('replay-report').classList.remove('hidden');
+                renderReplayReport();
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_replay_load_failed'), 'error');
+            });
+    };
+
+    window.renderReplayReport = function () {
+        var rep = replayReportData;
+        var tbody = document.getElementById('replay-report-tbody');
+        if (!rep || !tbody) return;
+        var sum = rep.summary;
+        document.getElementById('replay-report-summary').textContent = i18n.t('admin_replay_summary', {
+            replayed: sum.replayed,
+            total: sum.total,
+            unchanged: sum.unchanged,
+            answer: sum.answer_changed,
+            sources: sum.sources_changed,
+            pending: sum.newly_pending,
+            answered: sum.newly_answered,
+            failed: sum.failed,
+            similarity: (sum.avg_similarity * 100).toFixed(1) + '%'
+        });
+        var showAll = document.getElementById('replay-show-all').checked;
+        var answerCell = function (text, pending) {
+            if (pending) return '<span class="log-line-error">' + i18n.t('admin_replay_pending') + '</span>' + (text ? '<br>' + escapeHtml(text) : '');
+            return escapeHtml(text || '-');
+        };
+        var html = '';
+        (rep.items || []).forEach(function (it) {
+            var changed = it.answer_changed || it.sources_changed || it.pending !== it.baseline_pending;
+            if (!it.replayed || (!showAll && !changed && !it.error)) return;
+            var sources = (it.added_sources || []).map(function (s) { return '+ ' + escapeHtml(s); })
+                .concat((it.removed_sources || []).map(function (s) { return '− ' + escapeHtml(s); }));
+            html += '<tr>' +
+                '<td>' + escapeHtml(it.question) + '</td>' +
+                '<td>' + answerCell(it.baseline_answer, it.baseline_pending) + '</td>' +
+                '<td>' + (it.error ? '<span class="log-line-error">' + escapeHtml(it.error) + '</span>' : answerCell(it.answer, it.pending)) + '</td>' +
+                '<td>' + (it.error ? '-' : (it.similarity * 100).toFixed(0) + '%') + '</td>' +
+                '<td>' + (sources.length ? sources.join('<br>') : '-') + '</td>' +
+                '</tr>';
+        });
+        tbody.innerHTML = html || '<tr><td colspan="5" class="admin-table-empty">' + i18n.t('admin_replay_no_changes') + '</td></tr>';
+    };
+
+    // --- Online Backup ---
+
+    function formatBackupSize(bytes) {
+        if (bytes >= 1024 * 1024 * 1024) return (bytes / (1024 * 1024 * 1024)).toFixed(2) + ' GB';
+        if (bytes >= 1024 * 1024) return (bytes / (1024 * 1024)).toFixed(1) + ' MB';
+        return (bytes / 1024).toFixed(1) + ' KB';
+    }
+
+    window.loadBackupHistory = function () {
+        var tbody = document.getElementById('backup-runs-tbody');
+        if (!tbody) return;
+        adminFetch('/api/admin/backup')
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_backup_load_failed'));
+                return res.json();
+            })
+            .then(function (data) {
+                var statusEl = document.getElementById('backup-status');
+                if (statusEl) statusEl.textContent = data.running ? i18n.t('admin_backup_running') : '';
+                ['backup-save-btn', 'backup-download-btn'].forEach(function (id) {
+                    var btn = document.getElementById(id);
+                    if (btn) btn.disabled = !!data.running;
+                });
+                var records = data.records || [];
+                if (records.length === 0) {
+                    tbody.innerHTML = '<tr><td colspan="6" class="admin-table-empty">' + i18n.t('admin_backup_empty') + '</td></tr>';
                     return;
                 }
-                // Render lines with color coding
                 var html = '';
-                lines.forEach(function (line) {
-                    var escaped = line.replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;');
-                    // Highlight timestamp
-                    escaped = escaped.replace(/^(\d{4}\/\d{2}\/\d{2}\s+\d{2}:\d{2}:\d{2})/, '<span class="log-line-time">$1</span>');
-                    // Highlight [ERROR]
-                    escaped = escaped.replace(/\[ERROR\]/, '<span class="log-line-error">[ERROR]</span>');
-                    html += escaped + '\n';
+                records.forEach(function (r) {
+                    var result = r.error
+                        ? '<span class="log-line-error">' + escapeHtml(r.error) + '</span>'
+                        : escapeHtml([r.archive_path, r.remote_archive].filter(Boolean).join('\n')).replace(/\n/g, '<br>');
+                    html += '<tr>' +
+                        '<td>' + new Date(r.started_at).toLocaleString(i18n.getLang()) + '</td>' +
+                        '<td>' + i18n.t('admin_backup_mode_' + (r.mode === 'incremental' ? 'incremental' : 'full')) + '</td>' +
+                        '<td>' + i18n.t('admin_backup_target_' + (r.target === 'download' ? 'download' : 'server')) + '</td>' +
+                        '<td>' + formatBackupSize(r.size_bytes || 0) + '</td>' +
+                        '<td>' + (r.duration_ms / 1000).toFixed(1) + ' s</td>' +
+                        '<td>' + result + '</td>' +
+                        '</tr>';
                 });
-                content.innerHTML = html;
-                // Auto-scroll to bottom
-                var viewer = document.getElementById('log-viewer');
-                if (viewer) viewer.scrollTop = viewer.scrollHeight;
+                tbody.innerHTML = html;
             })
             .catch(function (err) {
-                content.textContent = i18n.t('admin_logs_load_failed') + ': ' + (err.message || i18n.t('admin_logs_unknown_error'));
+                tbody.innerHTML = '<tr><td colspan="6" class="admin-table-empty">' + escapeHtml(err.message || i18n.t('admin_backup_load_failed')) + '</td></tr>';
             });
     };
 
-    window.saveLogRotation = function () {
-        var input = document.getElementById('cfg-log-rotation-mb');
-        if (!input) return;
-        var val = parseInt(input.value, 10);
-        if (isNaN(val) || val < 1 || val > 10240) {
-            showAdminToast(i18n.t('admin_logs_rotation_range_error'), 'error');
-            return;
-        }
-        adminFetch('/api/logs/rotation', {
-            method: 'PUT',
+    window.runBackup = function (target) {
+        var modeEl = document.getElementById('backup-mode');
+        var mode = modeEl ? modeEl.value : 'full';
+        var statusEl = document.getElementById('backup-status');
+        if (statusEl) statusEl.textContent = i18n.t('admin_backup_running');
+        ['backup-save-btn', 'backup-download-btn'].forEach(function (id) {
+            var btn = document.getElementById(id);
+            if (btn) btn.disabled = true;
+        });
+        adminFetch('/api/admin/backup', {
+            method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ rotation_mb: val })
+            body: JSON.stringify({ mode: mode, target: target })
         })
         .then(function (res) {
-            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_logs_save_failed')); });
-            showAdminToast(i18n.t('admin_logs_rotation_saved'), 'success');
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_backup_failed')); });
+            if (target !== 'download') return;
+            var disposition = res.headers.get('Content-Disposition') || '';
+            var match = disposition.match(/filename="([^"]+)"/);
+            return res.blob().then(function (blob) {
+                var url = URL.createObjectURL(blob);
+                startLinkDownload(url, match ? match[1] : 'askflow_backup.tar.gz');
+                URL.revokeObjectURL(url);
+            });
         })
-        .catch(function (err) {
-            showAdminToast(err.message || i18n.t('admin_logs_save_failed'), 'error');
-        });
-    };
-
-    window.downloadLogs = function () {
-        adminFetch('/api/logs/download')
-        .then(function (res) {
-            if (!res.ok) throw new Error(i18n.t('admin_logs_download_failed'));
-            return res.blob();
-        })
-        .then(function (blob) {
-            var url = URL.createObjectURL(blob);
-            var a = document.createElement('a');
-            a.href = url;
-            a.download = 'error_log.gz';
-            document.body.appendChild(a);
-            a.click();
-            document.body.removeChild(a);
-            URL.revokeObjectURL(url);
-            showAdminToast(i18n.t('admin_logs_download_done'), 'success');
+        .then(function () {
+            showAdminToast(i18n.t('admin_backup_done'), 'success');
         })
         .catch(function (err) {
-            showAdminToast(err.message || i18n.t('admin_logs_download_failed'), 'error');
-        });
-    };
-
-    window.confirmClearLogs = function () {
-        if (!confirm(i18n.t('admin_logs_clear_confirm'))) {
-            return;
-        }
-        adminFetch('/api/logs/clear', { method: 'DELETE' })
-        .then(function (res) {
-            if (!res.ok) throw new Error(i18n.t('admin_logs_clear_failed'));
-            return res.json();
-        })
-        .then(function (data) {
-            showAdminToast(i18n.t('admin_logs_clear_done'), 'success');
-            loadRecentLogs();
+            showAdminToast(err.message || i18n.t('admin_backup_failed'), 'error');
         })
-        .catch(function (err) {
-            showAdminToast(err.message || i18n.t('admin_logs_clear_failed'), 'error');
+        .then(function () {
+            loadBackupHistory();
         });
     };
 
@@ -3848,6 +6949,9 @@
                 setVal('cfg-video-rapidspeech-model', video.rapidspeech_model || '');
                 setVal('cfg-video-max-upload-size', video.max_upload_size_mb || 500);
                 setVal('cfg-video-processing-timeout', video.processing_timeout_min || 120);
+                setVal('cfg-video-ytdlp-path', video.ytdlp_path || '');
+                setVal('cfg-video-url-max-duration', video.url_max_duration_min || 120);
+                setVal('cfg-video-diarization-command', video.diarization_command || '');
                 checkMultimodalDeps();
             })
             .catch(function () {
@@ -3917,6 +7021,9 @@
         var rapidspeechModel = getVal('cfg-video-rapidspeech-model');
         var maxUploadSize = getVal('cfg-video-max-upload-size');
         var processingTimeout = getVal('cfg-video-processing-timeout');
+        var ytdlpPath = getVal('cfg-video-ytdlp-path');
+        var urlMaxDuration = getVal('cfg-video-url-max-duration');
+        var diarizationCommand = getVal('cfg-video-diarization-command');
 
         updates['video.ffmpeg_path'] = ffmpegPath;
         updates['video.rapidspeech_path'] = rapidspeechPath;
@@ -3924,6 +7031,9 @@
         if (rapidspeechModel) updates['video.rapidspeech_model'] = rapidspeechModel;
         if (maxUploadSize !== '') updates['video.max_upload_size_mb'] = parseInt(maxUploadSize, 10);
         if (processingTimeout !== '') updates['video.processing_timeout_min'] = parseInt(processingTimeout, 10);
+        updates['video.ytdlp_path'] = ytdlpPath;
+        if (urlMaxDuration !== '') updates['video.url_max_duration_min'] = parseInt(urlMaxDuration, 10);
+        updates['video.diarization_command'] = diarizationCommand;
 
         // Pre-save validation for RapidSpeech paths
         var needsValidation = rapidspeechPath || rapidspeechModel;
@@ -4305,11 +7415,11 @@
         facebook: '<svg class="oauth-icon" width="20" height="20" viewBox="0 0 24 24" fill="currentColor"><path d="M24 12.073c0-6.627-5.373-12-12-12s-12 5.373-12 12c0 5.99 4.388 10.954 10.125 11.854v-8.385H7.078v-3.47h3.047V9.43c0-3.007 1.792-4.669 4.533-4.669 1.312 0 2.686.235 2.686.235v2.953H15.83c-1.491 0-1.956.925-1.956 1.874v2.25h3.328l-.532 3.47h-2.796v8.385C19.612 23.027 24 18.062 24 12.073z"/></svg>'
     };
 
-    function renderOAuthLoginButtons(providers) {
+    function renderOAuthLoginButtons(providers, externalLogin) {
         var container = document.getElementById('oauth-login-buttons');
         var divider = document.getElementById('oauth-login-divider');
         if (!container) return;
-        if (!providers || providers.length === 0) {
+        if ((!providers || providers.length === 0) && !externalLogin) {
             container.classList.add('hidden');
             if (divider) divider.classList.add('hidden');
             return;
@@ -4324,6 +7434,18 @@
             btn.onclick = function () { startOAuthLogin(name); };
             container.appendChild(btn);
         });
+        if (externalLogin) {
+            var label = externalLogin.label || i18n.t('external_login_default_label');
+            var btn = document.createElement('button');
+            btn.className = 'oauth-btn oauth-external';
+            btn.innerHTML = '<span>' + escapeHtml(i18n.t('login_oauth_with') + ' ' + label) + '</span>';
+            btn.onclick = function () {
+                var title = document.getElementById('external-login-title');
+                if (title) title.textContent = i18n.t('login_oauth_with') + ' ' + label;
+                showExternalLoginForm();
+            };
+            container.appendChild(btn);
+        }
         container.classList.remove('hidden');
         if (divider) divider.classList.remove('hidden');
     }
@@ -4521,6 +7643,9 @@
                 try { data = JSON.parse(xhr.responseText); } catch (e) { data = {}; }
                 var idx = knowledgeImageURLs.length;
                 knowledgeImageURLs.push(data.url);
+                if (isKnowledgeMarkdown() && data.url) {
+                    insertKnowledgeMarkdown('![' + (file.name || '').replace(/\.[^.]*$/, '').replace(/[\[\]]/g, '') + '](' + data.url + ')');
+                }
 
                 // Add remove button
                 var removeBtn = document.createElement('button');
@@ -4678,7 +7803,25 @@
         xhr.send(formData);
     }
 
+    function isKnowledgeMarkdown() {
+        var cb = document.getElementById('knowledge-markdown');
+        return !!(cb && cb.checked);
+    }
+
+    // Insert a markdown media reference at the cursor of the content editor.
+    function insertKnowledgeMarkdown(ref) {
+        var ta = document.getElementById('knowledge-content');
+        if (!ta) return;
+        var start = ta.selectionStart != null ? ta.selectionStart : ta.value.length;
+        var end = ta.selectionEnd != null ? ta.selectionEnd : start;
+        var before = ta.value.slice(0, start);
+        var text = (before && !/\n$/.test(before) ? '\n' : '') + ref + '\n';
+        ta.value = before + text + ta.value.slice(end);
+        ta.selectionStart = ta.selectionEnd = start + text.length;
+    }
+
     window.submitKnowledgeEntry = function () {
+        var editID = document.getElementById('knowledge-edit-id').value;
         var title = (document.getElementById('knowledge-title') || {}).value || '';
         var content = (document.getElementById('knowledge-content') || {}).value || '';
 
@@ -4700,46 +7843,482 @@
             addProgressOverlay(imgZone, true, 'knowledge-submit-progress');
             imgZone.style.position = 'relative';
         }
-
-        adminFetch('/api/knowledge', {
-            method: 'POST',
+
+        adminFetch(editID ? '/api/knowledge/' + encodeURIComponent(editID) : '/api/knowledge', {
+            method: editID ? 'PUT' : 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                title: title.trim(), content: content.trim(), image_urls: imageURLs, video_urls: videoURLs, product_id: getKnowledgeProductID(), format: isKnowledgeMarkdown() ? 'markdown' : '',
+                publish_at: scheduleFromInput(document.getElementById('knowledge-publish-at').value),
+                unpublish_at: scheduleFromInput(document.getElementById('knowledge-unpublish-at').value)
+            })
+        })
+        .then(function (res) {
+            if (!res.ok) {
+                return res.text().then(function (text) {
+                    var msg = i18n.t('admin_knowledge_failed');
+                    try { var d = JSON.parse(text); msg = d.error || msg; } catch (e) { /* non-JSON response */ }
+                    throw new Error(msg);
+                });
+            }
+            return res.text().then(function (text) {
+                try { return JSON.parse(text); } catch (e) { return {}; }
+            });
+        })
+        .then(function (data) {
+            showAdminToast(i18n.t(data && data.review_status === 'draft' ? 'admin_review_saved_draft' : (editID ? 'admin_knowledge_updated' : 'admin_knowledge_success')), 'success');
+            fillKnowledgeForm(null);
+            loadAdminKnowledgeEntries();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_knowledge_failed'), 'error');
+        })
+        .finally(function () {
+            resetBtnLoading(btn);
+            if (imgZone) removeProgressOverlay(imgZone, 'knowledge-submit-progress');
+        });
+    };
+
+    // --- Knowledge Entry List ---
+
+    var adminKnowledgeCache = [];
+
+    window.loadAdminKnowledgeEntries = loadAdminKnowledgeEntries;
+    function loadAdminKnowledgeEntries() {
+        var productID = getKnowledgeProductID();
+        adminFetch('/api/knowledge' + (productID ? '?product_id=' + encodeURIComponent(productID) : ''))
+            .then(function (res) {
+                if (!res.ok) throw new Error('load failed');
+                return res.json();
+            })
+            .then(function (data) {
+                adminKnowledgeCache = data.entries || [];
+                renderAdminKnowledgeEntries();
+            })
+            .catch(function () {
+                adminKnowledgeCache = [];
+                renderAdminKnowledgeEntries();
+            });
+    }
+
+    function renderAdminKnowledgeEntries() {
+        var tbody = document.getElementById('admin-knowledge-tbody');
+        if (!tbody) return;
+        if (adminKnowledgeCache.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="4" class="admin-table-empty">' + i18n.t('admin_knowledge_list_empty') + '</td></tr>';
+            return;
+        }
+        var html = '';
+        for (var i = 0; i < adminKnowledgeCache.length; i++) {
+            var e = adminKnowledgeCache[i];
+            var reviewHtml = '';
+            if (e.review_status === 'draft' || e.review_status === 'in_review') {
+                reviewHtml = ' <span class="admin-badge admin-badge-' + e.review_status + '">' + escapeHtml(i18n.t('admin_review_status_' + e.review_status)) + '</span>';
+            }
+            html += '<tr>' +
+                '<td>' + escapeHtml(e.title) + reviewHtml +
+                    (e.preview ? '<div style="font-size:0.8em;color:#888">' + escapeHtml(e.preview) + '</div>' : '') + scheduleSummaryHtml(e) + '</td>' +
+                '<td>' + escapeHtml(getProductNameByID(e.product_id)) + '</td>' +
+                '<td>' + escapeHtml(new Date(e.updated_at || e.created_at).toLocaleString(i18n.getLang())) + '</td>' +
+                '<td>' +
+                    '<button class="btn-secondary btn-sm" style="margin-right:0.25rem" data-id="' + escapeHtml(e.id) + '" onclick="editKnowledgeEntry(this.dataset.id)">' + i18n.t('admin_knowledge_edit') + '</button>' +
+                    '<button class="btn-danger btn-sm" data-id="' + escapeHtml(e.id) + '" onclick="deleteKnowledgeEntry(this.dataset.id)">' + i18n.t('admin_doc_delete_btn') + '</button>' +
+                '</td>' +
+            '</tr>';
+        }
+        tbody.innerHTML = html;
+    }
+
+    // Show an image or video already attached to the entry being edited.
+    function addKnowledgeMediaPreview(kind, url) {
+        var preview = document.getElementById('knowledge-' + kind + '-preview');
+        if (!preview) return;
+        var urls = kind === 'image' ? knowledgeImageURLs : knowledgeVideoURLs;
+        var idx = urls.length;
+        urls.push(url);
+        var item = document.createElement('div');
+        item.className = 'knowledge-' + kind + '-item';
+        var media = document.createElement(kind === 'image' ? 'img' : 'video');
+        media.src = url;
+        if (kind === 'video') media.controls = true;
+        item.appendChild(media);
+        var removeBtn = document.createElement('button');
+        removeBtn.className = 'knowledge-' + kind + '-remove';
+        removeBtn.textContent = '×';
+        removeBtn.setAttribute('aria-label', i18n.t(kind + '_remove_label'));
+        removeBtn.onclick = function () {
+            urls[idx] = null;
+            item.remove();
+        };
+        item.appendChild(removeBtn);
+        preview.appendChild(item);
+    }
+
+    // Fill the entry form with a knowledge entry to edit, or clear it for a
+    // new entry. The product of an entry cannot be changed.
+    function fillKnowledgeForm(entry) {
+        document.getElementById('knowledge-edit-id').value = entry ? entry.id : '';
+        document.getElementById('knowledge-title').value = entry ? entry.title : '';
+        document.getElementById('knowledge-content').value = entry ? entry.content : '';
+        var markdown = document.getElementById('knowledge-markdown');
+        if (markdown && entry) markdown.checked = entry.format === 'markdown';
+        document.getElementById('knowledge-publish-at').value = entry ? scheduleToInput(entry.publish_at) : '';
+        document.getElementById('knowledge-unpublish-at').value = entry ? scheduleToInput(entry.unpublish_at) : '';
+        var productSelect = document.getElementById('knowledge-product-select');
+        if (productSelect) {
+            if (entry) productSelect.value = entry.product_id || '';
+            productSelect.disabled = !!entry;
+        }
+        document.getElementById('knowledge-image-preview').innerHTML = '';
+        document.getElementById('knowledge-video-preview').innerHTML = '';
+        knowledgeImageURLs = [];
+        knowledgeVideoURLs = [];
+        if (entry) {
+            (entry.image_urls || []).forEach(function (url) { addKnowledgeMediaPreview('image', url); });
+            (entry.video_urls || []).forEach(function (url) { addKnowledgeMediaPreview('video', url); });
+        }
+        document.getElementById('knowledge-cancel-btn').classList.toggle('hidden', !entry);
+        document.getElementById('knowledge-submit-btn').textContent = i18n.t(entry ? 'admin_knowledge_save_edit' : 'admin_knowledge_submit');
+    }
+
+    window.editKnowledgeEntry = function (id) {
+        adminFetch('/api/knowledge/' + encodeURIComponent(id))
+            .then(function (res) {
+                return res.json().then(function (data) {
+                    if (!res.ok) throw new Error(data.error || i18n.t('admin_knowledge_load_failed'));
+                    return data;
+                });
+            })
+            .then(function (entry) {
+                fillKnowledgeForm(entry);
+                document.getElementById('knowledge-title').focus();
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_knowledge_load_failed'), 'error');
+            });
+    };
+
+    window.cancelKnowledgeEdit = function () {
+        fillKnowledgeForm(null);
+    };
+
+    window.deleteKnowledgeEntry = function (id) {
+        var entry = null;
+        for (var i = 0; i < adminKnowledgeCache.length; i++) {
+            if (adminKnowledgeCache[i].id === id) entry = adminKnowledgeCache[i];
+        }
+        if (!entry) return;
+        if (!confirm(i18n.t('admin_knowledge_delete_confirm', { name: entry.title }))) return;
+        adminFetch('/api/knowledge/' + encodeURIComponent(id), { method: 'DELETE' })
+            .then(function (res) {
+                return res.json().then(function (data) {
+                    if (!res.ok) throw new Error(data.error || i18n.t('admin_knowledge_delete_failed'));
+                });
+            })
+            .then(function () {
+                showAdminToast(i18n.t('admin_knowledge_deleted'), 'success');
+                if (document.getElementById('knowledge-edit-id').value === id) fillKnowledgeForm(null);
+                loadAdminKnowledgeEntries();
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_knowledge_delete_failed'), 'error');
+            });
+    };
+
+    // --- Product Announcements ---
+
+    var adminAnnouncementsCache = [];
+
+    function loadAdminAnnouncements() {
+        adminFetch('/api/admin/announcements')
+            .then(function (res) {
+                if (!res.ok) throw new Error('load failed');
+                return res.json();
+            })
+            .then(function (data) {
+                adminAnnouncementsCache = data.announcements || [];
+                renderAdminAnnouncements();
+            })
+            .catch(function () {
+                adminAnnouncementsCache = [];
+                renderAdminAnnouncements();
+            });
+    }
+
+    function renderAdminAnnouncements() {
+        var tbody = document.getElementById('admin-announcements-tbody');
+        if (!tbody) return;
+        if (adminAnnouncementsCache.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="4" class="admin-table-empty">' + i18n.t('admin_announcement_empty') + '</td></tr>';
+            return;
+        }
+        var html = '';
+        for (var i = 0; i < adminAnnouncementsCache.length; i++) {
+            var a = adminAnnouncementsCache[i];
+            var title = escapeHtml(a.title) + (a.version ? ' <span class="chat-announcement-version">' + escapeHtml(a.version) + '</span>' : '');
+            var period = (a.effective_from || a.effective_until)
+                ? escapeHtml((a.effective_from || '…') + ' ~ ' + (a.effective_until || '…'))
+                : i18n.t('admin_announcement_always');
+            html += '<tr>' +
+                '<td>' + title + '</td>' +
+                '<td>' + escapeHtml(getProductNameByID(a.product_id)) + '</td>' +
+                '<td>' + period + '</td>' +
+                '<td>' +
+                    '<button class="btn-secondary btn-sm" style="margin-right:0.25rem" data-id="' + escapeHtml(a.id) + '" onclick="editAnnouncement(this.dataset.id)">' + i18n.t('admin_announcement_edit') + '</button>' +
+                    '<button class="btn-danger btn-sm" data-id="' + escapeHtml(a.id) + '" onclick="deleteAnnouncement(this.dataset.id)">' + i18n.t('admin_doc_delete_btn') + '</button>' +
+                '</td>' +
+            '</tr>';
+        }
+        tbody.innerHTML = html;
+    }
+
+    function findAdminAnnouncement(id) {
+        for (var i = 0; i < adminAnnouncementsCache.length; i++) {
+            if (adminAnnouncementsCache[i].id === id) return adminAnnouncementsCache[i];
+        }
+        return null;
+    }
+
+    function fillAnnouncementForm(a) {
+        document.getElementById('announcement-edit-id').value = a ? a.id : '';
+        document.getElementById('announcement-product-select').value = a ? (a.product_id || '') : '';
+        document.getElementById('announcement-title').value = a ? a.title : '';
+        document.getElementById('announcement-version').value = a ? (a.version || '') : '';
+        document.getElementById('announcement-effective-from').value = a ? (a.effective_from || '') : '';
+        document.getElementById('announcement-effective-until').value = a ? (a.effective_until || '') : '';
+        document.getElementById('announcement-content').value = a ? a.content : '';
+        document.getElementById('announcement-cancel-btn').classList.toggle('hidden', !a);
+        document.getElementById('announcement-save-btn').textContent = i18n.t(a ? 'admin_announcement_save' : 'admin_announcement_publish');
+    }
+
+    window.editAnnouncement = function (id) {
+        var a = findAdminAnnouncement(id);
+        if (!a) return;
+        fillAnnouncementForm(a);
+        document.getElementById('announcement-title').focus();
+    };
+
+    window.cancelAnnouncementEdit = function () {
+        fillAnnouncementForm(null);
+    };
+
+    window.saveAnnouncement = function () {
+        var id = document.getElementById('announcement-edit-id').value;
+        var body = {
+            product_id: document.getElementById('announcement-product-select').value,
+            title: document.getElementById('announcement-title').value.trim(),
+            version: document.getElementById('announcement-version').value.trim(),
+            effective_from: document.getElementById('announcement-effective-from').value,
+            effective_until: document.getElementById('announcement-effective-until').value,
+            content: document.getElementById('announcement-content').value.trim()
+        };
+        if (!body.title || !body.content) {
+            showAdminToast(i18n.t('admin_announcement_empty_fields'), 'error');
+            return;
+        }
+        var btn = document.getElementById('announcement-save-btn');
+        btn.disabled = true;
+        adminFetch(id ? '/api/admin/announcements/' + encodeURIComponent(id) : '/api/admin/announcements', {
+            method: id ? 'PUT' : 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        })
+        .then(function (res) {
+            return res.json().then(function (data) {
+                if (!res.ok) throw new Error(data.error || i18n.t('admin_announcement_save_failed'));
+                return data;
+            });
+        })
+        .then(function () {
+            showAdminToast(i18n.t('admin_announcement_saved'), 'success');
+            fillAnnouncementForm(null);
+            loadAdminAnnouncements();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_announcement_save_failed'), 'error');
+        })
+        .finally(function () {
+            btn.disabled = false;
+        });
+    };
+
+    window.deleteAnnouncement = function (id) {
+        var a = findAdminAnnouncement(id);
+        if (!a) return;
+        if (!confirm(i18n.t('admin_announcement_delete_confirm', { name: a.title }))) return;
+        adminFetch('/api/admin/announcements/' + encodeURIComponent(id), { method: 'DELETE' })
+            .then(function (res) {
+                return res.json().then(function (data) {
+                    if (!res.ok) throw new Error(data.error || i18n.t('admin_announcement_delete_failed'));
+                });
+            })
+            .then(function () {
+                showAdminToast(i18n.t('admin_announcement_deleted'), 'success');
+                if (document.getElementById('announcement-edit-id').value === id) fillAnnouncementForm(null);
+                loadAdminAnnouncements();
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_announcement_delete_failed'), 'error');
+            });
+    };
+
+    // --- Answer Templates ---
+
+    var adminTemplatesCache = [];
+
+    window.toggleAnswerTemplates = function () {
+        var panel = document.getElementById('admin-templates-panel');
+        if (!panel) return;
+        panel.classList.toggle('hidden');
+        if (!panel.classList.contains('hidden')) {
+            loadAdminProductSelectors().then(function () { loadAnswerTemplates(); });
+        }
+    };
+
+    function loadAnswerTemplates() {
+        adminFetch('/api/admin/templates')
+            .then(function (res) {
+                if (!res.ok) throw new Error('load failed');
+                return res.json();
+            })
+            .then(function (data) {
+                adminTemplatesCache = data.templates || [];
+                renderAnswerTemplates();
+            })
+            .catch(function () {
+                adminTemplatesCache = [];
+                renderAnswerTemplates();
+            });
+    }
+
+    function renderAnswerTemplates() {
+        var tbody = document.getElementById('admin-templates-tbody');
+        if (!tbody) return;
+        if (adminTemplatesCache.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="4" class="admin-table-empty">' + i18n.t('admin_template_empty') + '</td></tr>';
+            return;
+        }
+        var html = '';
+        for (var i = 0; i < adminTemplatesCache.length; i++) {
+            var t = adminTemplatesCache[i];
+            var vars = (t.placeholders || []).map(function (n) {
+                return escapeHtml('{' + n + '}' + (t.variables && t.variables[n] ? ' = ' + t.variables[n] : ''));
+            }).join('<br>');
+            html += '<tr>' +
+                '<td title="' + escapeHtml(t.content) + '">' + escapeHtml(t.name) + '</td>' +
+                '<td>' + escapeHtml(getProductNameByID(t.product_id)) + '</td>' +
+                '<td style="font-size:0.85rem;">' + (vars || '-') + '</td>' +
+                '<td>' +
+                    '<button class="btn-secondary btn-sm" style="margin-right:0.25rem" data-id="' + escapeHtml(t.id) + '" onclick="editAnswerTemplate(this.dataset.id)">' + i18n.t('admin_template_edit') + '</button>' +
+                    '<button class="btn-danger btn-sm" data-id="' + escapeHtml(t.id) + '" onclick="deleteAnswerTemplate(this.dataset.id)">' + i18n.t('admin_doc_delete_btn') + '</button>' +
+                '</td>' +
+            '</tr>';
+        }
+        tbody.innerHTML = html;
+    }
+
+    function findAnswerTemplate(id) {
+        for (var i = 0; i < adminTemplatesCache.length; i++) {
+            if (adminTemplatesCache[i].id === id) return adminTemplatesCache[i];
+        }
+        return null;
+    }
+
+    function fillAnswerTemplateForm(t) {
+        var vars = t && t.variables ? Object.keys(t.variables).map(function (k) { return k + '=' + t.variables[k]; }).join('\n') : '';
+        document.getElementById('template-edit-id').value = t ? t.id : '';
+        document.getElementById('template-product-select').value = t ? (t.product_id || '') : '';
+        document.getElementById('template-name').value = t ? t.name : '';
+        document.getElementById('template-content').value = t ? t.content : '';
+        document.getElementById('template-variables').value = vars;
+        document.getElementById('template-cancel-btn').classList.toggle('hidden', !t);
+        document.getElementById('template-save-btn').textContent = i18n.t(t ? 'admin_template_save' : 'admin_template_create');
+    }
+
+    window.editAnswerTemplate = function (id) {
+        var t = findAnswerTemplate(id);
+        if (!t) return;
+        fillAnswerTemplateForm(t);
+        document.getElementById('template-name').focus();
+    };
+
+    window.cancelAnswerTemplateEdit = function () {
+        fillAnswerTemplateForm(null);
+    };
+
+    window.saveAnswerTemplate = function () {
+        var id = document.getElementById('template-edit-id').value;
+        var variables = {};
+        var lines = document.getElementById('template-variables').value.split('\n');
+        for (var i = 0; i < lines.length; i++) {
+            var line = lines[i].trim();
+            if (!line) continue;
+            var eq = line.indexOf('=');
+            if (eq <= 0) {
+                showAdminToast(i18n.t('admin_template_variables_invalid', { line: line }), 'error');
+                return;
+            }
+            variables[line.slice(0, eq).trim()] = line.slice(eq + 1).trim();
+        }
+        var body = {
+            product_id: document.getElementById('template-product-select').value,
+            name: document.getElementById('template-name').value.trim(),
+            content: document.getElementById('template-content').value.trim(),
+            variables: variables
+        };
+        if (!body.name || !body.content) {
+            showAdminToast(i18n.t('admin_template_empty_fields'), 'error');
+            return;
+        }
+        var btn = document.getElementById('template-save-btn');
+        btn.disabled = true;
+        adminFetch(id ? '/api/admin/templates/' + encodeURIComponent(id) : '/api/admin/templates', {
+            method: id ? 'PUT' : 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ title: title.trim(), content: content.trim(), image_urls: imageURLs, video_urls: videoURLs, product_id: getKnowledgeProductID() })
+            body: JSON.stringify(body)
         })
         .then(function (res) {
-            if (!res.ok) {
-                return res.text().then(function (text) {
-                    var msg = i18n.t('admin_knowledge_failed');
-                    try { var d = JSON.parse(text); msg = d.error || msg; } catch (e) { /* non-JSON response */ }
-                    throw new Error(msg);
-                });
-            }
-            return res.text().then(function (text) {
-                try { return JSON.parse(text); } catch (e) { return {}; }
+            return res.json().then(function (data) {
+                if (!res.ok) throw new Error(data.error || i18n.t('admin_template_save_failed'));
+                return data;
             });
         })
         .then(function () {
-            showAdminToast(i18n.t('admin_knowledge_success'), 'success');
-            if (document.getElementById('knowledge-title')) document.getElementById('knowledge-title').value = '';
-            if (document.getElementById('knowledge-content')) document.getElementById('knowledge-content').value = '';
-            var preview = document.getElementById('knowledge-image-preview');
-            if (preview) preview.innerHTML = '';
-            knowledgeImageURLs = [];
-            var videoPreview = document.getElementById('knowledge-video-preview');
-            if (videoPreview) videoPreview.innerHTML = '';
-            knowledgeVideoURLs = [];
+            showAdminToast(i18n.t('admin_template_saved'), 'success');
+            fillAnswerTemplateForm(null);
+            loadAnswerTemplates();
         })
         .catch(function (err) {
-            showAdminToast(err.message || i18n.t('admin_knowledge_failed'), 'error');
+            showAdminToast(err.message || i18n.t('admin_template_save_failed'), 'error');
         })
         .finally(function () {
-            resetBtnLoading(btn);
-            if (imgZone) removeProgressOverlay(imgZone, 'knowledge-submit-progress');
+            btn.disabled = false;
         });
     };
 
+    window.deleteAnswerTemplate = function (id) {
+        var t = findAnswerTemplate(id);
+        if (!t) return;
+        if (!confirm(i18n.t('admin_template_delete_confirm', { name: t.name }))) return;
+        adminFetch('/api/admin/templates/' + encodeURIComponent(id), { method: 'DELETE' })
+            .then(function (res) {
+                return res.json().then(function (data) {
+                    if (!res.ok) throw new Error(data.error || i18n.t('admin_template_delete_failed'));
+                });
+            })
+            .then(function () {
+                showAdminToast(i18n.t('admin_template_deleted'), 'success');
+                if (document.getElementById('template-edit-id').value === id) fillAnswerTemplateForm(null);
+                loadAnswerTemplates();
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_template_delete_failed'), 'error');
+            });
+    };
+
     // --- Product Management ---
 
+    window.loadProducts = loadProducts;
     function loadProducts() {
         // Manually apply i18n to product tab elements that may not get translated
         var dlLabel = document.getElementById('product-allow-download-label');
@@ -4756,7 +8335,9 @@
                 el.placeholder = i18n.t(el.getAttribute('data-i18n-placeholder'));
             });
         }
-        adminFetch('/api/products')
+        var statusSel = document.getElementById('admin-products-status');
+        var status = statusSel ? statusSel.value : 'all';
+        adminFetch('/api/products?status=' + encodeURIComponent(status))
             .then(function (res) {
                 if (!res.ok) throw new Error('load failed');
                 return res.json();
@@ -4788,13 +8369,16 @@
             var typeLabel = p.type === 'knowledge_base' ? i18n.t('admin_products_type_knowledge') : i18n.t('admin_products_type_service');
             var dlLabel = p.allow_download ? '✅' : '❌';
             html += '<tr>' +
-                '<td>' + escapeHtml(p.name) + '</td>' +
+                '<td>' + escapeHtml(p.name) +
+                    (p.isolated_storage ? ' <span title="' + escapeHtml(i18n.t('admin_products_isolated_storage_badge')) + '">🔒</span>' : '') +
+                    (p.archived_at ? ' <span class="admin-badge" title="' + escapeHtml(new Date(p.archived_at).toLocaleString()) + '">' + i18n.t('admin_products_archived_badge') + '</span>' : '') + '</td>' +
                 '<td>' + escapeHtml(typeLabel) + '</td>' +
                 '<td>' + escapeHtml(p.description || '-') + '</td>' +
                 '<td>' + dlLabel + '</td>' +
                 '<td>' + escapeHtml(createdAt) + '</td>' +
                 '<td>' +
                     '<button class="btn-primary btn-sm" style="margin-right:6px" onclick="editProduct(\'' + escapeHtml(p.id) + '\')">' + i18n.t('admin_products_edit_btn') + '</button>' +
+                    '<button class="btn-secondary btn-sm" style="margin-right:6px" onclick="setProductArchived(\'' + escapeHtml(p.id) + '\', ' + !p.archived_at + ')">' + i18n.t(p.archived_at ? 'admin_products_unarchive_btn' : 'admin_products_archive_btn') + '</button>' +
                     '<button class="btn-danger btn-sm" onclick="deleteProduct(\'' + escapeHtml(p.id) + '\', \'' + escapeHtml(p.name) + '\')">' + i18n.t('admin_products_delete_btn') + '</button>' +
                 '</td>' +
             '</tr>';
@@ -4802,22 +8386,133 @@
         tbody.innerHTML = html;
     }
 
+    window.exportProductsCSV = function () {
+        adminFetch('/api/products/export')
+            .then(function (resp) {
+                if (!resp.ok) throw new Error(i18n.t('admin_products_export_failed'));
+                return resp.blob();
+            })
+            .then(function (blob) {
+                var url = URL.createObjectURL(blob);
+                var a = document.createElement('a');
+                a.href = url;
+                a.download = 'products.csv';
+                document.body.appendChild(a);
+                a.click();
+                document.body.removeChild(a);
+                URL.revokeObjectURL(url);
+            })
+            .catch(function (err) {
+                showAdminToast(err.message, 'error');
+            });
+    };
+
+    // Product CSV import runs as a dry run first; the import itself only
+    // starts once the admin has confirmed the summary.
+    window.importProductsCSV = function () {
+        var input = document.getElementById('product-import-file');
+        var resultEl = document.getElementById('product-import-result');
+        var file = input && input.files && input.files[0];
+        if (!file) {
+            showAdminToast(i18n.t('admin_products_import_no_file'), 'error');
+            return;
+        }
+        var send = function (dryRun) {
+            var formData = new FormData();
+            formData.append('file', file);
+            return adminFetch('/api/products/import' + (dryRun ? '?dry_run=true' : ''), { method: 'POST', body: formData })
+                .then(function (res) {
+                    return res.json().then(function (data) {
+                        if (!res.ok) throw new Error(data.error || i18n.t('admin_products_import_failed'));
+                        return data;
+                    });
+                });
+        };
+        send(true)
+            .then(function (plan) {
+                if (plan.invalid > 0) {
+                    resultEl.innerHTML = escapeHtml(i18n.t('admin_products_import_invalid', { count: plan.invalid })) + '<br>' +
+                        plan.rows.filter(function (row) { return row.action === 'invalid'; }).map(function (row) {
+                            return escapeHtml(i18n.t('admin_products_import_row_error', { line: row.line, name: row.name, message: row.message }));
+                        }).join('<br>');
+                    resultEl.classList.remove('hidden');
+                    return;
+                }
+                resultEl.classList.add('hidden');
+                var summary = { created: plan.created, updated: plan.updated, unchanged: plan.unchanged };
+                if (plan.created + plan.updated === 0) {
+                    showAdminToast(i18n.t('admin_products_import_nothing', summary), 'info');
+                    return;
+                }
+                if (!confirm(i18n.t('admin_products_import_confirm', summary))) return;
+                return send(false).then(function (result) {
+                    showAdminToast(i18n.t('admin_products_import_done', { created: result.created, updated: result.updated, unchanged: result.unchanged }), 'success');
+                    input.value = '';
+                    loadProducts();
+                });
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_products_import_failed'), 'error');
+                loadProducts();
+            });
+    };
+
+    // Reads the disclaimer fields of a product form (ids prefix-disclaimer
+    // and prefix-disclaimer-translations); translations are "lang: text"
+    // lines. Returns null when both are empty, throws on a malformed line.
+    function readProductDisclaimer(prefix) {
+        var textEl = document.getElementById(prefix + '-disclaimer');
+        var trEl = document.getElementById(prefix + '-disclaimer-translations');
+        var text = textEl ? textEl.value.trim() : '';
+        var lines = trEl ? trEl.value.split('\n') : [];
+        var translations = {};
+        var hasTranslations = false;
+        for (var i = 0; i < lines.length; i++) {
+            var line = lines[i].trim();
+            if (!line) continue;
+            var m = line.match(/^([a-z]{2})\s*[:：]\s*(.+)$/);
+            if (!m) throw new Error(i18n.t('admin_products_disclaimer_translation_invalid', { line: i + 1 }));
+            translations[m[1]] = m[2].trim();
+            hasTranslations = true;
+        }
+        if (!text && !hasTranslations) return null;
+        var d = { text: text };
+        if (hasTranslations) d.translations = translations;
+        return d;
+    }
+
+    function formatDisclaimerTranslations(d) {
+        if (!d || !d.translations) return '';
+        return Object.keys(d.translations).sort().map(function (lang) {
+            return lang + ': ' + d.translations[lang];
+        }).join('\n');
+    }
+
     window.createProduct = function () {
         var name = (document.getElementById('product-new-name') || {}).value || '';
         var productType = (document.getElementById('product-new-type') || {}).value || 'service';
         var desc = (document.getElementById('product-new-desc') || {}).value || '';
         var welcome = (document.getElementById('product-new-welcome') || {}).value || '';
         var allowDownload = document.getElementById('product-new-allow-download') ? document.getElementById('product-new-allow-download').checked : false;
+        var isolatedStorage = document.getElementById('product-new-isolated-storage') ? document.getElementById('product-new-isolated-storage').checked : false;
+        var ticketURL = document.getElementById('product-new-ticket-url') ? document.getElementById('product-new-ticket-url').value.trim() : '';
 
         if (!name.trim()) {
             showAdminToast(i18n.t('admin_products_name_required'), 'error');
             return;
         }
+        var disclaimer;
+        try {
+            disclaimer = readProductDisclaimer('product-new');
+        } catch (e) {
+            showAdminToast(e.message, 'error');
+            return;
+        }
 
         adminFetch('/api/products', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ name: name.trim(), type: productType, description: desc.trim(), welcome_message: welcome.trim(), allow_download: allowDownload })
+            body: JSON.stringify({ name: name.trim(), type: productType, description: desc.trim(), welcome_message: welcome.trim(), allow_download: allowDownload, isolated_storage: isolatedStorage, ticket_url_template: ticketURL, disclaimer: disclaimer })
         })
         .then(function (res) {
             if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_products_create_failed')); });
@@ -4830,6 +8525,10 @@
             if (document.getElementById('product-new-desc')) document.getElementById('product-new-desc').value = '';
             if (document.getElementById('product-new-welcome')) document.getElementById('product-new-welcome').value = '';
             if (document.getElementById('product-new-allow-download')) document.getElementById('product-new-allow-download').checked = false;
+            if (document.getElementById('product-new-isolated-storage')) document.getElementById('product-new-isolated-storage').checked = false;
+            if (document.getElementById('product-new-ticket-url')) document.getElementById('product-new-ticket-url').value = '';
+            if (document.getElementById('product-new-disclaimer')) document.getElementById('product-new-disclaimer').value = '';
+            if (document.getElementById('product-new-disclaimer-translations')) document.getElementById('product-new-disclaimer-translations').value = '';
             loadProducts();
         })
         .catch(function (err) {
@@ -4837,6 +8536,25 @@
         });
     };
 
+    window.setProductArchived = function (id, archived) {
+        if (archived && !confirm(i18n.t('admin_products_archive_confirm'))) return;
+
+        adminFetch('/api/products/' + encodeURIComponent(id) + (archived ? '/archive' : '/unarchive'), {
+            method: 'POST'
+        })
+        .then(function (res) {
+            if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_products_archive_failed')); });
+            showAdminToast(i18n.t(archived ? 'admin_products_archived' : 'admin_products_unarchived'), 'success');
+            cachedProducts = null;
+            _productFetchPromise = null;
+            loadProducts();
+            loadAdminProductSelectors();
+        })
+        .catch(function (err) {
+            showAdminToast(err.message || i18n.t('admin_products_archive_failed'), 'error');
+        });
+    };
+
     window.deleteProduct = function (id, name) {
         if (!confirm(i18n.t('admin_products_delete_confirm', { name: name }))) return;
 
@@ -4872,6 +8590,9 @@
         document.getElementById('product-edit-desc').value = p.description || '';
         document.getElementById('product-edit-welcome').value = p.welcome_message || '';
         document.getElementById('product-edit-allow-download').checked = !!p.allow_download;
+        document.getElementById('product-edit-ticket-url').value = p.ticket_url_template || '';
+        document.getElementById('product-edit-disclaimer').value = p.disclaimer ? p.disclaimer.text || '' : '';
+        document.getElementById('product-edit-disclaimer-translations').value = formatDisclaimerTranslations(p.disclaimer);
 
         // Update modal title
         var titleEl = document.getElementById('product-edit-modal-title');
@@ -4909,16 +8630,24 @@
         var desc = document.getElementById('product-edit-desc').value.trim();
         var welcome = document.getElementById('product-edit-welcome').value.trim();
         var allowDownload = document.getElementById('product-edit-allow-download').checked;
+        var ticketURL = document.getElementById('product-edit-ticket-url').value.trim();
 
         if (!name) {
             showAdminToast(i18n.t('admin_products_name_required'), 'error');
             return;
         }
+        var disclaimer;
+        try {
+            disclaimer = readProductDisclaimer('product-edit');
+        } catch (e) {
+            showAdminToast(e.message, 'error');
+            return;
+        }
 
         adminFetch('/api/products/' + encodeURIComponent(id), {
             method: 'PUT',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ name: name, type: productType, description: desc, welcome_message: welcome, allow_download: allowDownload })
+            body: JSON.stringify({ name: name, type: productType, description: desc, welcome_message: welcome, allow_download: allowDownload, ticket_url_template: ticketURL, disclaimer: disclaimer || {} })
         })
         .then(function (res) {
             if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_products_edit_failed')); });
@@ -5039,10 +8768,6 @@
             showAdminToast(i18n.t('admin_users_create_empty'), 'error');
             return;
         }
-        if (password.length < 6) {
-            showAdminToast(i18n.t('admin_users_create_password_short'), 'error');
-            return;
-        }
 
         adminFetch('/api/admin/users', {
             method: 'POST',
@@ -5082,6 +8807,96 @@
         });
     };
 
+    // --- API Keys ---
+
+    function loadAPIKeys() {
+        adminFetch('/api/admin/apikeys')
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_doc_load_failed'));
+                return res.json();
+            })
+            .then(function (data) {
+                renderAPIKeyScopes(data.scopes || []);
+                renderAPIKeys(data.keys || []);
+            })
+            .catch(function () {
+                renderAPIKeys([]);
+            });
+    }
+
+    function renderAPIKeyScopes(scopes) {
+        var box = document.getElementById('apikey-new-scopes');
+        if (!box || box.childElementCount > 0) return;
+        box.innerHTML = scopes.map(function (scope) {
+            return '<label style="display:flex;align-items:center;gap:0.4rem;cursor:pointer;">' +
+                '<input type="checkbox" class="apikey-scope" value="' + escapeHtml(scope) + '">' +
+                '<code>' + escapeHtml(scope) + '</code></label>';
+        }).join('');
+    }
+
+    function renderAPIKeys(keys) {
+        var tbody = document.getElementById('apikeys-tbody');
+        if (!tbody) return;
+        if (keys.length === 0) {
+            tbody.innerHTML = '<tr><td colspan="6" class="admin-table-empty">' + i18n.t('admin_apikeys_empty') + '</td></tr>';
+            return;
+        }
+        var fmt = function (ts) { return ts ? escapeHtml(new Date(ts).toLocaleString(i18n.getLang())) : '-'; };
+        tbody.innerHTML = keys.map(function (k) {
+            return '<tr>' +
+                '<td>' + escapeHtml(k.name) + '</td>' +
+                '<td><code>' + escapeHtml(k.prefix) + '…</code></td>' +
+                '<td>' + k.scopes.map(escapeHtml).join(', ') + '</td>' +
+                '<td>' + fmt(k.last_used_at) + '</td>' +
+                '<td>' + (k.expires_at ? fmt(k.expires_at) : i18n.t('admin_apikeys_never')) + '</td>' +
+                '<td><button class="btn-danger btn-sm" onclick="deleteAPIKey(\'' + escapeHtml(k.id) + '\', \'' + escapeHtml(k.name) + '\')">' + i18n.t('admin_apikeys_revoke_btn') + '</button></td>' +
+            '</tr>';
+        }).join('');
+    }
+
+    window.createAPIKey = function () {
+        var nameEl = document.getElementById('apikey-new-name');
+        var name = nameEl ? nameEl.value.trim() : '';
+        var scopes = Array.prototype.map.call(document.querySelectorAll('.apikey-scope:checked'), function (cb) { return cb.value; });
+        var days = parseInt((document.getElementById('apikey-new-expires') || {}).value, 10) || 0;
+        if (!name || scopes.length === 0) {
+            showAdminToast(i18n.t('admin_apikeys_create_empty'), 'error');
+            return;
+        }
+        adminFetch('/api/admin/apikeys', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ name: name, scopes: scopes, expires_in_days: days })
+        })
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_apikeys_create_failed')); });
+                return res.json();
+            })
+            .then(function (data) {
+                // The secret is only returned now; show it so it can be copied
+                prompt(i18n.t('admin_apikeys_created'), data.key);
+                if (nameEl) nameEl.value = '';
+                document.querySelectorAll('.apikey-scope').forEach(function (cb) { cb.checked = false; });
+                loadAPIKeys();
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_apikeys_create_failed'), 'error');
+            });
+    };
+
+    window.deleteAPIKey = function (id, name) {
+        if (!confirm(i18n.t('admin_apikeys_revoke_confirm', { name: name }))) return;
+        adminFetch('/api/admin/apikeys/' + encodeURIComponent(id), { method: 'DELETE' })
+            .then(function (res) {
+                if (!res.ok) throw new Error(i18n.t('admin_delete_failed'));
+                showAdminToast(i18n.t('admin_apikeys_revoked'), 'success');
+                loadAPIKeys();
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_delete_failed'), 'error');
+            });
+    };
+
     // --- Login Ban Management ---
 
     function loadLoginBans() {
@@ -5191,6 +9006,7 @@
         chatLoading = false;
         localStorage.removeItem('askflow_product_id');
         localStorage.removeItem('askflow_product_name');
+        endServerSession(getChatToken());
         clearSession();
         navigate('/login');
     };
@@ -5233,10 +9049,149 @@
         if (overlay) overlay.parentNode.removeChild(overlay);
     };
 
+    // changeAdminPassword asks for a new password and changes the signed-in
+    // admin's password; currentPassword is asked for too when not given.
+    window.changeAdminPassword = function (currentPassword) {
+        var current = currentPassword || prompt(i18n.t('admin_password_current'));
+        if (!current) return;
+        var next = prompt(i18n.t('admin_password_new'));
+        if (!next) return;
+        if (prompt(i18n.t('admin_password_confirm')) !== next) {
+            showAdminToast(i18n.t('admin_password_mismatch'), 'error');
+            return;
+        }
+        adminFetch('/api/admin/password', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ current_password: current, new_password: next })
+        })
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_password_change_failed')); });
+                showAdminToast(i18n.t('admin_password_changed'), 'success');
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_password_change_failed'), 'error');
+            });
+    };
+
+    // --- Personal notification preferences ---
+
+    // notifyPrefsForm returns the preferences entered in the modal.
+    function notifyPrefsForm() {
+        var events = [];
+        document.querySelectorAll('#notify-prefs-events input[type=checkbox]').forEach(function (cb) {
+            if (cb.checked) events.push(cb.value);
+        });
+        return {
+            events: events,
+            email: getVal('notify-prefs-email'),
+            channel: getVal('notify-prefs-channel'),
+            webhook_url: getVal('notify-prefs-webhook'),
+            secret: getVal('notify-prefs-secret')
+        };
+    }
+
+    function showNotifyPrefsResult(text, cls) {
+        var el = document.getElementById('notify-prefs-result');
+        if (!el) return;
+        el.textContent = text;
+        el.className = cls || '';
+    }
+
+    // openNotifyPrefs shows the signed-in admin's notification preferences.
+    window.openNotifyPrefs = function () {
+        var modal = document.getElementById('notify-prefs-modal');
+        if (!modal) return;
+        adminFetch('/api/admin/notification-prefs')
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_notify_prefs_load_failed')); });
+                return res.json();
+            })
+            .then(function (data) {
+                var prefs = data.prefs || {};
+                var subscribed = prefs.events || [];
+                var box = document.getElementById('notify-prefs-events');
+                box.innerHTML = '<label>' + escapeHtml(i18n.t('admin_notify_prefs_events')) + '</label>' +
+                    (data.events || []).map(function (ev) {
+                        return '<label class="admin-checkbox-label"><input type="checkbox" value="' + escapeHtml(ev) + '"' +
+                            (subscribed.indexOf(ev) >= 0 ? ' checked' : '') + '> <span>' +
+                            escapeHtml(i18n.t('admin_notify_event_' + ev)) + '</span></label>';
+                    }).join('');
+                document.getElementById('notify-prefs-email').value = prefs.email || '';
+                document.getElementById('notify-prefs-channel').value = prefs.channel || 'lark';
+                document.getElementById('notify-prefs-webhook').value = prefs.webhook_url || '';
+                document.getElementById('notify-prefs-secret').value = prefs.secret || '';
+                showNotifyPrefsResult('', 'hidden');
+                modal.querySelectorAll('[data-i18n]').forEach(function (el) {
+                    el.textContent = i18n.t(el.getAttribute('data-i18n'));
+                });
+                modal.querySelectorAll('[data-i18n-placeholder]').forEach(function (el) {
+                    el.placeholder = i18n.t(el.getAttribute('data-i18n-placeholder'));
+                });
+                modal.style.display = 'flex';
+                modal.onclick = function (e) {
+                    if (e.target === modal) window.closeNotifyPrefs();
+                };
+            })
+            .catch(function (err) {
+                showAdminToast(err.message || i18n.t('admin_notify_prefs_load_failed'), 'error');
+            });
+    };
+
+    window.closeNotifyPrefs = function () {
+        var modal = document.getElementById('notify-prefs-modal');
+        if (modal) modal.style.display = 'none';
+    };
+
+    window.saveNotifyPrefs = function () {
+        var btn = document.getElementById('notify-prefs-save-btn');
+        if (btn) btn.disabled = true;
+        adminFetch('/api/admin/notification-prefs', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(notifyPrefsForm())
+        })
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_notify_prefs_save_failed')); });
+                showAdminToast(i18n.t('admin_notify_prefs_saved'), 'success');
+                window.closeNotifyPrefs();
+            })
+            .catch(function (err) {
+                showNotifyPrefsResult(err.message || i18n.t('admin_notify_prefs_save_failed'), 'error-text');
+            })
+            .finally(function () {
+                if (btn) btn.disabled = false;
+            });
+    };
+
+    // testNotifyPrefs sends a test message to the entered email and webhook,
+    // so they can be checked before saving.
+    window.testNotifyPrefs = function () {
+        var btn = document.getElementById('notify-prefs-test-btn');
+        if (btn) btn.disabled = true;
+        showNotifyPrefsResult(i18n.t('admin_settings_notify_test_sending'), '');
+        adminFetch('/api/admin/notification-prefs/test', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(notifyPrefsForm())
+        })
+            .then(function (res) {
+                if (!res.ok) return res.json().then(function (d) { throw new Error(d.error || i18n.t('admin_settings_notify_test_failed')); });
+                showNotifyPrefsResult(i18n.t('admin_settings_notify_test_success'), 'success-text');
+            })
+            .catch(function (err) {
+                showNotifyPrefsResult(err.message, 'error-text');
+            })
+            .finally(function () {
+                if (btn) btn.disabled = false;
+            });
+    };
+
     window.adminLogout = function () {
         adminRole = '';
         adminPermissions = [];
         localStorage.removeItem('admin_role');
+        endServerSession(getAdminToken());
         clearAdminSession();
         navigate(adminLoginRoute);
     };
@@ -5257,8 +9212,8 @@
         fetch('/api/app-info')
             .then(function (res) { return res.json(); })
             .then(function (data) {
-                if (data.oauth_providers) {
-                    renderOAuthLoginButtons(data.oauth_providers);
+                if (data.oauth_providers || data.external_login) {
+                    renderOAuthLoginButtons(data.oauth_providers, data.external_login);
                 }
                 if (data.max_upload_size_mb) {
                     maxUploadSizeMB = data.max_upload_size_mb;
@@ -5269,7 +9224,10 @@
         // system/status and admin/status affect routing, so wait for them before rendering
         var p1 = fetch('/api/system/status')
             .then(function (res) { return res.json(); })
-            .then(function (data) { systemReady = !!data.ready; })
+            .then(function (data) {
+                systemReady = !!data.ready;
+                setDegradedBanner(!!data.degraded);
+            })
             .catch(function () { systemReady = true; });
 
         var p2 = fetch('/api/admin/status')
@@ -5353,6 +9311,7 @@
                 var products = data.products || [];
                 sel.innerHTML = '<option value="">' + i18n.t('batch_product_public') + '</option>';
                 products.forEach(function (p) {
+                    if (p.archived_at) return;
                     sel.innerHTML += '<option value="' + p.id + '">' + p.name + '</option>';
                 });
             })
@@ -5360,18 +9319,24 @@
     }
     window.loadBatchImportProductSelector = loadBatchImportProductSelector;
 
-    window.startBatchImport = function () {
-        var pathInput = document.getElementById('batch-import-path');
-        var importPath = (pathInput.value || '').trim();
-        if (!importPath) {
+    function splitPatterns(value) {
+        return (value || '').split(',').map(function (p) { return p.trim(); }).filter(function (p) { return p; });
+    }
+
+    window.startBatchImport = function (dryRun, assignments) {
+        var body = batchImportRequestBody();
+        if (!body.path) {
             showAdminToast(i18n.t('batch_path_required'), 'error');
             return;
         }
+        body.dry_run = !!dryRun;
+        if (assignments) body.assignments = assignments;
 
-        var productID = document.getElementById('batch-product-select').value || '';
-        var btn = document.getElementById('batch-import-btn');
+        var btn = document.getElementById(dryRun ? 'batch-estimate-btn' : 'batch-import-btn');
+        var otherBtn = document.getElementById(dryRun ? 'batch-import-btn' : 'batch-estimate-btn');
         btn.disabled = true;
-        btn.textContent = i18n.t('batch_importing');
+        if (otherBtn) otherBtn.disabled = true;
+        btn.textContent = i18n.t(dryRun ? 'batch_estimating' : 'batch_importing');
         // Reset UI
         var progressSection = document.getElementById('batch-progress-section');
         var reportSection = document.getElementById('batch-report-section');
@@ -5382,57 +9347,171 @@
         document.getElementById('batch-progress-text').textContent = i18n.t('batch_preparing');
         document.getElementById('batch-progress-percent').textContent = '0%';
 
-        var token = getAdminToken();
-
-        fetch('/api/batch-import', {
-            method: 'POST',
-            headers: {
-                'Content-Type': 'application/json',
-                'Authorization': 'Bearer ' + token
-            },
-            body: JSON.stringify({ path: importPath, product_id: productID })
+        // The stream is authorized with an operation token; signing out
+        // revokes it, which stops the import
+        requestOperationToken('/api/batch-import', getAdminToken(), 'POST').then(function (opToken) {
+            return fetch('/api/batch-import?op_token=' + encodeURIComponent(opToken), {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(body)
+            });
         }).then(function (response) {
-            if (!response.ok) {
-                return response.json().then(function (d) {
-                    throw new Error(d.error || 'HTTP ' + response.status);
-                });
-            }
+            return readBatchSSE(response, handleSSEEvent);
+        }).catch(function (err) {
+            showAdminToast(i18n.t('batch_import_failed') + ': ' + err.message, 'error');
+        }).finally(function () {
+            btn.disabled = false;
+            if (otherBtn) otherBtn.disabled = false;
+            btn.textContent = i18n.t(dryRun ? 'batch_estimate_btn' : 'batch_start_btn');
+        });
+    };
 
-            var reader = response.body.getReader();
-            var decoder = new TextDecoder();
-            var buffer = '';
+    // readBatchSSE reads a batch import SSE response and passes each event to onEvent.
+    function readBatchSSE(response, onEvent) {
+        if (!response.ok) {
+            return response.json().then(function (d) {
+                throw new Error(d.error || 'HTTP ' + response.status);
+            });
+        }
 
-            function processChunk(result) {
-                if (result.done) return;
-                buffer += decoder.decode(result.value, { stream: true });
+        var reader = response.body.getReader();
+        var decoder = new TextDecoder();
+        var buffer = '';
 
-                var lines = buffer.split('\n');
-                buffer = lines.pop(); // keep incomplete line in buffer
+        function processChunk(result) {
+            if (result.done) return;
+            buffer += decoder.decode(result.value, { stream: true });
 
-                var currentEvent = '';
-                for (var i = 0; i < lines.length; i++) {
-                    var line = lines[i];
-                    if (line.indexOf('event: ') === 0) {
-                        currentEvent = line.substring(7);
-                    } else if (line.indexOf('data: ') === 0) {
-                        var jsonStr = line.substring(6);
-                        try {
-                            var data = JSON.parse(jsonStr);
-                            handleSSEEvent(currentEvent, data);
-                        } catch (e) {}
-                    }
-                }
+            var lines = buffer.split('\n');
+            buffer = lines.pop(); // keep incomplete line in buffer
 
-                return reader.read().then(processChunk);
+            var currentEvent = '';
+            for (var i = 0; i < lines.length; i++) {
+                var line = lines[i];
+                if (line.indexOf('event: ') === 0) {
+                    currentEvent = line.substring(7);
+                } else if (line.indexOf('data: ') === 0) {
+                    var jsonStr = line.substring(6);
+                    try {
+                        var data = JSON.parse(jsonStr);
+                        onEvent(currentEvent, data);
+                    } catch (e) {}
+                }
             }
 
             return reader.read().then(processChunk);
+        }
+
+        return reader.read().then(processChunk);
+    }
+
+    function batchImportRequestBody() {
+        return {
+            path: (document.getElementById('batch-import-path').value || '').trim(),
+            product_id: document.getElementById('batch-product-select').value || '',
+            include: splitPatterns(getVal('batch-import-include')),
+            exclude: splitPatterns(getVal('batch-import-exclude')),
+            max_file_size: getVal('batch-import-max-size'),
+            modified_since: getVal('batch-import-modified-since')
+        };
+    }
+
+    // Proposed product of each file from the last classification, reviewed before importing.
+    var batchClassifyRequest = null;
+
+    window.startBatchClassify = function () {
+        var body = batchImportRequestBody();
+        if (!body.path) {
+            showAdminToast(i18n.t('batch_path_required'), 'error');
+            return;
+        }
+        var btn = document.getElementById('batch-classify-btn');
+        btn.disabled = true;
+        btn.textContent = i18n.t('batch_classifying');
+        batchClassifyRequest = null;
+        document.getElementById('batch-classify-section').classList.add('hidden');
+        document.getElementById('batch-report-section').classList.add('hidden');
+        document.getElementById('batch-progress-section').classList.remove('hidden');
+        var logEl = document.getElementById('batch-progress-log');
+        var fillEl = document.getElementById('batch-progress-fill');
+        var textEl = document.getElementById('batch-progress-text');
+        var percentEl = document.getElementById('batch-progress-percent');
+        logEl.innerHTML = '';
+        fillEl.style.width = '0%';
+        textEl.textContent = i18n.t('batch_preparing');
+        percentEl.textContent = '0%';
+
+        fetch('/api/batch-import/classify', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'Authorization': 'Bearer ' + getAdminToken()
+            },
+            body: JSON.stringify(body)
+        }).then(function (response) {
+            return readBatchSSE(response, function (event, data) {
+                if (event === 'start') {
+                    textEl.textContent = i18n.t('batch_classify_start_text', { total: data.total });
+                    if (data.filtered) textEl.textContent += ' ' + i18n.t('batch_filtered_text', { n: data.filtered });
+                } else if (event === 'progress') {
+                    fillEl.style.width = data.percent + '%';
+                    percentEl.textContent = data.percent + '%';
+                    textEl.textContent = '[' + data.index + '/' + data.total + '] ' + data.file;
+                    var item = document.createElement('div');
+                    item.className = 'log-item' + (data.error ? ' log-failed' : '');
+                    item.textContent = '[' + data.index + '/' + data.total + '] ' + data.file + ' → ' +
+                        (data.product_name || i18n.t('batch_product_public')) + (data.error ? ' (' + data.error + ')' : '');
+                    logEl.appendChild(item);
+                    logEl.scrollTop = logEl.scrollHeight;
+                } else if (event === 'done') {
+                    textEl.textContent = i18n.t('batch_classify_done_text');
+                    percentEl.textContent = '100%';
+                    fillEl.style.width = '100%';
+                    batchClassifyRequest = body;
+                    showBatchClassifyReview(data);
+                }
+            });
         }).catch(function (err) {
-            showAdminToast(i18n.t('batch_import_failed') + ': ' + err.message, 'error');
+            showAdminToast(i18n.t('batch_classify_failed') + ': ' + err.message, 'error');
         }).finally(function () {
             btn.disabled = false;
-            btn.textContent = i18n.t('batch_start_btn');
+            btn.textContent = i18n.t('batch_classify_btn');
+        });
+    };
+
+    function showBatchClassifyReview(data) {
+        var section = document.getElementById('batch-classify-section');
+        var list = document.getElementById('batch-classify-list');
+        list.innerHTML = '';
+        var options = '<option value="">' + escapeHtml(i18n.t('batch_product_public')) + '</option>';
+        (data.products || []).forEach(function (p) {
+            options += '<option value="' + escapeHtml(p.id) + '">' + escapeHtml(p.name) + '</option>';
         });
+        (data.files || []).forEach(function (f) {
+            var item = document.createElement('div');
+            item.className = 'batch-failed-item';
+            item.style.display = 'flex';
+            item.style.gap = '0.5rem';
+            item.style.alignItems = 'center';
+            item.innerHTML = '<div class="failed-path" style="flex:1;">' + escapeHtml(f.path) +
+                (f.error ? '<div class="failed-reason">' + escapeHtml(f.error) + '</div>' : '') + '</div>' +
+                '<select class="batch-classify-select">' + options + '</select>';
+            var sel = item.querySelector('select');
+            sel.value = f.product_id || '';
+            sel.setAttribute('data-path', f.path);
+            list.appendChild(item);
+        });
+        section.classList.remove('hidden');
+    }
+
+    window.confirmBatchClassify = function () {
+        if (!batchClassifyRequest) return;
+        var assignments = {};
+        document.querySelectorAll('#batch-classify-list .batch-classify-select').forEach(function (sel) {
+            assignments[sel.getAttribute('data-path')] = sel.value;
+        });
+        document.getElementById('batch-classify-section').classList.add('hidden');
+        startBatchImport(false, assignments);
     };
 
     function handleSSEEvent(event, data) {
@@ -5442,7 +9521,8 @@
         var percentEl = document.getElementById('batch-progress-percent');
 
         if (event === 'start') {
-            textEl.textContent = i18n.t('batch_start_text', { total: data.total });
+            textEl.textContent = i18n.t(data.dry_run ? 'batch_estimate_start_text' : 'batch_start_text', { total: data.total });
+            if (data.filtered) textEl.textContent += ' ' + i18n.t('batch_filtered_text', { n: data.filtered });
         } else if (event === 'progress') {
             var pct = data.percent != null ? data.percent : (data.total > 0 ? Math.round((data.index / data.total) * 100) : 0);
             fillEl.style.width = pct + '%';
@@ -5454,6 +9534,15 @@
             if (data.status === 'success') {
                 item.className += ' log-success';
                 item.textContent = '[' + data.index + '/' + data.total + '] ✅ ' + data.file;
+            } else if (data.status === 'planned') {
+                var est = data.estimate;
+                item.className += ' log-success';
+                item.textContent = '[' + data.index + '/' + data.total + '] ' + data.file + ' — ' +
+                    i18n.t('batch_estimate_line', { chunks: est.chunks, embeddings: est.embeddings, tokens: est.embedding_tokens, cost: est.cost.toFixed(4) }) +
+                    (est.ocr_pages ? i18n.t('batch_estimate_ocr', { pages: est.ocr_pages }) : '') +
+                    (est.note ? ' (' + est.note + ')' : '');
+            } else if (data.status === 'skipped') {
+                item.textContent = '[' + data.index + '/' + data.total + '] ⏭ ' + data.file + ' — ' + data.reason;
             } else {
                 item.className += ' log-failed';
                 item.textContent = '[' + data.index + '/' + data.total + '] ❌ ' + data.file + ' — ' + data.reason;
@@ -5461,7 +9550,7 @@
             logEl.appendChild(item);
             logEl.scrollTop = logEl.scrollHeight;
         } else if (event === 'done') {
-            textEl.textContent = i18n.t('batch_done_text');
+            textEl.textContent = i18n.t(data.dry_run ? 'batch_estimate_done_text' : 'batch_done_text');
             percentEl.textContent = '100%';
             fillEl.style.width = '100%';
             showBatchReport(data);
@@ -5473,10 +9562,27 @@
         reportSection.classList.remove('hidden');
 
         var summary = document.getElementById('batch-report-summary');
-        summary.innerHTML =
-            '<div class="batch-report-stat stat-total"><span class="stat-value">' + data.total + '</span><span class="stat-label">' + i18n.t('batch_report_total') + '</span></div>' +
-            '<div class="batch-report-stat stat-success"><span class="stat-value">' + data.success + '</span><span class="stat-label">' + i18n.t('batch_report_success') + '</span></div>' +
-            '<div class="batch-report-stat stat-failed"><span class="stat-value">' + data.failed + '</span><span class="stat-label">' + i18n.t('batch_report_failed') + '</span></div>';
+        var failedTitle = document.getElementById('batch-report-failed-title');
+        if (failedTitle) failedTitle.textContent = i18n.t(data.dry_run ? 'batch_report_skipped_title' : 'batch_report_failed_title');
+        if (data.dry_run) {
+            var est = data.estimate || {};
+            summary.innerHTML =
+                '<div class="batch-report-stat stat-total"><span class="stat-value">' + data.total + '</span><span class="stat-label">' + i18n.t('batch_report_total') + '</span></div>' +
+                '<div class="batch-report-stat stat-success"><span class="stat-value">' + data.planned + '</span><span class="stat-label">' + i18n.t('batch_report_planned') + '</span></div>' +
+                '<div class="batch-report-stat"><span class="stat-value">' + data.skipped + '</span><span class="stat-label">' + i18n.t('batch_report_skipped') + '</span></div>' +
+                '<div class="batch-report-stat stat-failed"><span class="stat-value">' + data.failed + '</span><span class="stat-label">' + i18n.t('batch_report_failed') + '</span></div>' +
+                '<div class="batch-report-stat stat-total"><span class="stat-value">' + (est.cost || 0).toFixed(4) + '</span><span class="stat-label">' + i18n.t('batch_report_cost') + '</span></div>' +
+                '<div style="flex-basis:100%;font-size:0.85rem;color:#6b7280;">' + escapeHtml(i18n.t('batch_report_estimate_summary', {
+                    chunks: est.chunks || 0, embeddings: est.embeddings || 0, tokens: est.embedding_tokens || 0,
+                    images: est.images || 0, pages: est.ocr_pages || 0, llm: est.llm_tokens || 0
+                })) + '</div>';
+            data.failed_files = data.skipped_files;
+        } else {
+            summary.innerHTML =
+                '<div class="batch-report-stat stat-total"><span class="stat-value">' + data.total + '</span><span class="stat-label">' + i18n.t('batch_report_total') + '</span></div>' +
+                '<div class="batch-report-stat stat-success"><span class="stat-value">' + data.success + '</span><span class="stat-label">' + i18n.t('batch_report_success') + '</span></div>' +
+                '<div class="batch-report-stat stat-failed"><span class="stat-value">' + data.failed + '</span><span class="stat-label">' + i18n.t('batch_report_failed') + '</span></div>';
+        }
 
         var failedSection = document.getElementById('batch-report-failed');
         var failedList = document.getElementById('batch-report-failed-list');
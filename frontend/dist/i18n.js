@@ -46,7 +46,6 @@
             'register_login_link': '登录',
             'register_error_email': '请输入邮箱',
             'register_error_password': '请输入密码',
-            'register_error_password_length': '密码至少8位',
             'register_error_password_mismatch': '两次密码不一致',
             'register_error_captcha': '请输入验证码',
             'register_failed': '注册失败',
@@ -69,7 +68,6 @@
             'reset_confirm_password': '确认新密码',
             'reset_btn': '重置密码',
             'reset_error_password': '请输入新密码',
-            'reset_error_password_length': '密码至少8位',
             'reset_error_password_mismatch': '两次密码不一致',
             'reset_invalid_link': '无效的重置链接',
             'reset_failed': '重置失败',
@@ -97,7 +95,6 @@
             'admin_setup_btn': '创建管理员',
             'admin_error_username': '请输入用户名',
             'admin_error_password': '请输入密码',
-            'admin_error_password_length': '密码至少6位',
             'admin_error_password_mismatch': '两次密码不一致',
             'admin_error_credentials': '请输入用户名和密码',
             'admin_error_captcha': '请输入验证码',
@@ -125,7 +122,26 @@
             'chat_image_upload_title': '上传图片',
             'chat_image_recognize': '请检索与这张图片相关的技术资料',
             'chat_request_failed': '请求失败',
+            'chat_history_btn': '聊天记录',
+            'chat_history_title': '聊天记录',
+            'chat_history_empty': '暂无聊天记录',
+            'chat_history_more': '加载更多',
+            'chat_history_load_failed': '获取聊天记录失败',
+            'chat_history_delete': '删除',
+            'chat_history_delete_confirm': '确定删除这条聊天记录吗？',
+            'chat_history_delete_failed': '删除聊天记录失败',
+            'chat_announcement_dismiss': '不再显示',
+            'chat_degraded_banner': '知识库检索服务暂时不可用，当前回答基于关键词匹配，准确性可能降低',
+            'chat_degraded_answer': '降级模式：本回答基于关键词匹配生成，可能不够准确',
+            'chat_budget_answer': '本月模型预算已用完：本回答直接摘自最相关的资料，未经 AI 整理',
+            'chat_code_copy': '复制',
+            'chat_code_copied': '已复制',
+            'chat_rate_warning': '您发送消息有点快：当前时段还可提问 {remaining} 次，约 {seconds} 秒后恢复额度',
             'chat_no_answer': '暂无回答',
+            'chat_unsupported_claims': '以下内容未能在参考资料中找到依据：',
+            'chat_flow_start': '引导排查：{title}',
+            'chat_flow_escalate': '转人工处理',
+            'chat_queue_position': '排队中，当前第 {n} 位',
             'chat_pending_message': '该问题已转交人工处理，请稍后查看回复',
             'chat_error_prefix': '抱歉，请求出错：',
             'chat_error_suffix': '。请稍后重试。',
@@ -137,6 +153,7 @@
             'chat_source_unknown': '未知文档',
             'chat_source_image': '📷 图片来源',
             'chat_source_download': '点击下载文档',
+            'chat_source_open_page': '打开原网页对应章节',
             'chat_media_seek_hint': '点击跳转到该时间点',
             'chat_play_audio': '播放音频',
             'chat_play_video': '播放视频',
@@ -146,7 +163,22 @@
             'chat_not_satisfied_confirm_no': '取消',
             'chat_not_satisfied_success': '已转为待回答问题，我们会尽快为您解答。',
             'chat_not_satisfied_fail': '操作失败，请稍后重试。',
+            'chat_correction_btn': '纠错',
+            'chat_correction_title': '指出回答中有误的内容',
+            'chat_correction_sentence': '有误的句子',
+            'chat_correction_sentence_placeholder': '在回答中选中有误的句子后点击纠错，或在此粘贴',
+            'chat_correction_sentence_required': '请填写有误的句子',
+            'chat_correction_suggestion': '正确的信息（可选）',
+            'chat_correction_suggestion_placeholder': '如果您知道正确的内容，请在此说明',
+            'chat_correction_source': '相关引用来源',
+            'chat_correction_source_unknown': '不确定',
+            'chat_correction_submit': '提交',
+            'chat_correction_success': '感谢指正，管理员核实后会更新知识库。',
+            'chat_correction_failed': '提交失败，请稍后重试。',
             'session_expired': '会话已过期，请重新登录',
+            'session_expiring': '长时间未操作，登录将在 {minutes} 分钟后过期',
+            'session_expiring_max': '已达到最长登录时长，将在 {minutes} 分钟后退出，请及时保存',
+            'session_extend_btn': '保持登录',
 
             // Admin panel - sidebar
             'admin_panel_title': '管理面板',
@@ -189,8 +221,10 @@
             // Admin - documents
             'admin_doc_title': '文档管理',
             'admin_doc_drop_text': '拖拽文件到此处，或点击选择文件',
-            'admin_doc_drop_hint': '支持 PDF、Word、Excel、PPT、Markdown、视频格式',
-            'admin_doc_url_placeholder': '输入文档URL地址',
+            'admin_doc_drop_hint': '支持 PDF、Word、Excel、PPT、Markdown、TXT、CSV、视频格式',
+            'admin_doc_url_placeholder': '输入文档或视频URL地址',
+            'admin_doc_call_recording': '作为通话录音导入：识别客户问题和客服解答，生成待审核的知识条目（支持 MP3、WAV、M4A 和视频）',
+            'admin_doc_call_candidates': '已从通话中提取 {n} 条候选问答，请在“内容审核”中处理',
             'admin_doc_url_submit': '提交URL',
             'admin_doc_url_preview': '预览内容',
             'admin_doc_url_preview_hint': '以下是从URL获取的内容预览，确认无误后点击提交：',
@@ -199,6 +233,24 @@
             'admin_doc_url_fetching': '正在获取URL内容...',
             'admin_doc_url_fetched': '内容获取成功，请确认后提交',
             'admin_doc_url_fetch_failed': '获取URL内容失败',
+            'admin_doc_crawl_title': '整站抓取：从上方URL出发，导入同一站点内链接到的页面',
+            'admin_doc_crawl_depth': '抓取深度',
+            'admin_doc_crawl_max_pages': '最大页面数',
+            'admin_doc_crawl_delay': '请求间隔（毫秒）',
+            'admin_doc_crawl_include': '仅导入路径',
+            'admin_doc_crawl_exclude': '排除路径',
+            'admin_doc_crawl_hint': '路径模式以逗号分隔，匹配URL路径（不含开头的 /），支持 * 和 **。被排除的页面不会被访问；设置了“仅导入路径”时，其余页面只用于发现链接。站点的 robots.txt 会被遵守。',
+            'admin_doc_crawl_start': '开始抓取',
+            'admin_doc_crawl_running': '抓取中...',
+            'admin_doc_crawl_url_required': '请先在上方输入起始URL',
+            'admin_doc_crawl_progress': '已抓取 {fetched} 页，待抓取 {queued} 页',
+            'admin_doc_crawl_done': '抓取完成：访问 {fetched} 页，导入 {imported} 篇，重复 {duplicates} 篇，跳过 {skipped} 页，失败 {failed} 页',
+            'admin_doc_crawl_canceled': '抓取已取消',
+            'admin_doc_crawl_failed': '整站抓取失败',
+            'admin_doc_crawl_status_imported': '已导入',
+            'admin_doc_crawl_status_duplicate': '内容重复',
+            'admin_doc_crawl_status_skipped': '跳过',
+            'admin_doc_crawl_status_failed': '失败',
             'admin_doc_list_title': '文档列表',
             'admin_doc_th_name': '文档名称',
             'admin_doc_th_type': '文件类型',
@@ -212,8 +264,170 @@
             'admin_doc_status_processing': '处理中',
             'admin_doc_status_success': '成功',
             'admin_doc_status_failed': '失败',
+            'admin_doc_status_quarantined': '已隔离',
+            'admin_doc_eta_minutes': '预计还需 {n} 分钟',
+            'admin_doc_eta_soon': '即将完成',
+            'admin_doc_queue_position': '第 {n} 个',
             'admin_doc_delete_btn': '删除',
             'admin_doc_review_btn': '审看',
+            'admin_doc_chunks_btn': '分块',
+            'admin_doc_chunks_title': '文档分块',
+            'admin_doc_chunks_hint': '可修正识别错误的文字或删除干扰检索的模板内容，修改后的分块会自动重新向量化。图片分块不能编辑文字。',
+            'admin_doc_chunks_filter': '筛选分块内容',
+            'admin_doc_chunks_empty': '没有匹配的分块',
+            'admin_doc_chunks_load_failed': '获取文档分块失败',
+            'admin_doc_chunks_translation': '译文 · 原文 #{n}',
+            'admin_doc_chunks_image': '图片',
+            'admin_doc_chunks_edit': '编辑',
+            'admin_doc_chunks_text_empty': '分块内容不能为空',
+            'admin_doc_chunks_saved': '分块已保存并重新向量化',
+            'admin_doc_chunks_save_failed': '保存分块失败',
+            'admin_doc_chunks_delete_confirm': '确定删除分块 #{n}？删除后该内容不再参与检索。',
+            'admin_doc_chunks_deleted': '分块已删除',
+            'admin_doc_chunks_delete_failed': '删除分块失败',
+            'admin_doc_versions_btn': '版本',
+            'admin_doc_versions_title': '文档版本',
+            'admin_doc_versions_hint': '上传新版本后文档 ID、引用统计和有效期保持不变；新版本处理成功前，回答仍使用当前版本。',
+            'admin_doc_versions_file': '新版本文件',
+            'admin_doc_versions_note': '版本说明（可选）',
+            'admin_doc_versions_upload': '上传新版本',
+            'admin_doc_versions_loading': '加载中...',
+            'admin_doc_versions_empty': '尚未替换过，当前文件即第 1 版。',
+            'admin_doc_versions_load_failed': '获取文档版本失败',
+            'admin_doc_versions_current': '当前版本',
+            'admin_doc_versions_status_success': '历史版本',
+            'admin_doc_versions_status_processing': '处理中',
+            'admin_doc_versions_status_failed': '失败',
+            'admin_doc_versions_restore': '恢复',
+            'admin_doc_versions_restore_confirm': '确定恢复到版本 {n}？将以该版本文件生成一个新版本。',
+            'admin_doc_versions_no_file': '请选择新版本文件',
+            'admin_doc_versions_processing': '新版本已上传，正在后台处理',
+            'admin_doc_versions_replaced': '文档已更新到新版本',
+            'admin_doc_versions_failed': '新版本处理失败',
+            'admin_doc_effective_btn': '有效期',
+            'admin_doc_effective_title': '文档有效期',
+            'admin_doc_effective_hint': '有效期外的文档不再出现在用户回答中，管理员仍可检索。留空表示不限。',
+            'admin_doc_effective_from': '生效日期',
+            'admin_doc_effective_until': '失效日期',
+            'admin_doc_effective_save': '保存',
+            'admin_doc_effective_saved': '有效期已更新',
+            'admin_doc_effective_failed': '更新有效期失败',
+            'admin_doc_effective_period': '有效期 {from} ~ {until}',
+            'admin_doc_effective_inactive': '未生效/已过期',
+            'admin_schedule_btn': '发布计划',
+            'admin_schedule_title': '发布计划',
+            'admin_schedule_label': '发布计划（可选）',
+            'admin_schedule_hint': '发布时间之前和下线时间之后，条目不会出现在用户回答和文档门户中；到点时通过团队通知渠道告知设置人。留空表示不限。',
+            'admin_schedule_publish_at': '发布时间',
+            'admin_schedule_unpublish_at': '下线时间',
+            'admin_schedule_saved': '发布计划已更新',
+            'admin_schedule_failed': '更新发布计划失败',
+            'admin_schedule_period': '发布计划 {from} ~ {until}',
+            'admin_schedule_state_scheduled': '待发布',
+            'admin_schedule_state_published': '已发布',
+            'admin_schedule_state_unpublished': '已下线',
+            'admin_doc_url_estimate': '预计导入：分块 {chunks}，嵌入约 {tokens} tokens，预计费用 {cost}',
+            'admin_doc_url_duplicate': '该内容与已有文档重复（ID: {id}），提交将被拒绝',
+            'admin_settings_llm_price': '单价（每百万 tokens）',
+            'admin_settings_emb_price': '单价（每百万 tokens）',
+            'admin_settings_price_hint': '仅用于导入预估的费用计算，0 表示不计',
+            'admin_nav_review': '内容审核',
+            'admin_nav_corrections': '纠错建议',
+            'admin_review_title': '内容审核',
+            'admin_review_hint': '开启“发布前审核”后，新录入的知识和问题回答会先保存为草稿，提交并经其他管理员审核通过后才会用于回答。',
+            'admin_review_filter_all': '全部未发布',
+            'admin_review_status_draft': '草稿',
+            'admin_review_status_in_review': '审核中',
+            'admin_review_assigned_me': '只看分配给我的',
+            'admin_review_select_all': '全选',
+            'admin_review_pick_reviewer': '请选择审核人',
+            'admin_review_submit_btn': '提交审核',
+            'admin_review_note_placeholder': '审核意见（可选）',
+            'admin_review_approve_btn': '通过并发布',
+            'admin_review_reject_btn': '驳回',
+            'admin_review_empty': '暂无待审核内容',
+            'admin_corrections_title': '纠错建议',
+            'admin_corrections_hint': '用户可在回答下指出有误的句子并提供正确信息。采纳时可直接修改被引用的分块，或新增一条知识条目。',
+            'admin_corrections_empty': '暂无纠错建议',
+            'admin_corrections_filter_all': '全部',
+            'admin_corrections_status_pending': '待处理',
+            'admin_corrections_status_accepted': '已采纳',
+            'admin_corrections_status_rejected': '已驳回',
+            'admin_corrections_load_failed': '获取纠错建议失败',
+            'admin_corrections_source': '引用',
+            'admin_corrections_question': '问题',
+            'admin_corrections_sentence': '有误的句子',
+            'admin_corrections_suggestion': '用户建议',
+            'admin_corrections_handle_btn': '处理',
+            'admin_corrections_apply_as': '采纳方式',
+            'admin_corrections_applied_chunk': '修改引用分块',
+            'admin_corrections_applied_knowledge': '新增知识条目',
+            'admin_corrections_apply_none': '仅标记为已采纳',
+            'admin_corrections_entry_title': '知识条目标题',
+            'admin_corrections_text': '内容',
+            'admin_corrections_note_placeholder': '处理意见（可选）',
+            'admin_corrections_accept_btn': '采纳',
+            'admin_corrections_reject_btn': '驳回',
+            'admin_corrections_accepted': '已采纳纠错建议',
+            'admin_corrections_rejected': '已驳回纠错建议',
+            'admin_corrections_action_failed': '处理纠错建议失败',
+            'admin_review_load_failed': '获取审核队列失败',
+            'admin_review_author': '作者',
+            'admin_review_reviewer': '审核人',
+            'admin_review_note_label': '审核意见',
+            'admin_review_view_btn': '查看全文',
+            'admin_review_select_first': '请先选择条目',
+            'admin_review_action_failed': '审核操作失败',
+            'admin_review_done': '已处理 {n} 个条目',
+            'admin_review_partial': '成功 {ok} 个，失败 {failed} 个：',
+            'admin_review_saved_draft': '已保存为草稿，审核通过后生效',
+            'admin_settings_review_required': '发布前审核',
+            'admin_settings_review_off': '关闭（录入后立即生效）',
+            'admin_settings_review_on': '开启（审核通过后才生效）',
+            'admin_settings_review_hint': '开启后，新录入的知识和问题回答先保存为草稿，需在“内容审核”中提交并由其他管理员审核通过后才会用于回答',
+            'admin_settings_tagging_enabled': '自动标签',
+            'admin_settings_tagging_off': '关闭',
+            'admin_settings_tagging_on': '开启',
+            'admin_settings_tagging_hint': '文档导入完成后调用 LLM 识别文档类型（手册、常见问题、发布说明等）、主题标签和提到的产品，用于文档筛选和限定范围的检索；每个文档会增加一次 LLM 调用费用',
+            'admin_settings_audit_enabled': '回答审计',
+            'admin_settings_audit_on': '开启',
+            'admin_settings_audit_off': '关闭',
+            'admin_settings_audit_hint': '为每次回答保存不可修改的记录（最终提示词、检索到的分段及得分、模型参数和回答），可按请求 ID 通过 /api/admin/audits 查询，用于处理争议',
+            'admin_settings_audit_retention': '审计保留天数',
+            'admin_settings_audit_retention_hint': '超过保留期的审计记录会被自动删除，0 表示永久保留',
+            'admin_settings_portal_enabled': '文档门户',
+            'admin_settings_portal_off': '关闭',
+            'admin_settings_portal_on': '开启（无需登录即可浏览）',
+            'admin_settings_portal_hint': '开启后，已发布且在有效期内的知识录入和 Markdown 文档可通过 /api/portal 接口按产品分类浏览和搜索',
+            'admin_settings_html_main_content': '网页正文提取',
+            'admin_settings_html_main_content_on': '开启（去除导航、横幅和页脚）',
+            'admin_settings_html_main_content_off': '关闭（索引整个页面）',
+            'admin_settings_html_main_content_hint': '导入网址和 HTML 文件时只保留页面正文，避免导航栏、Cookie 提示和页脚混入分段',
+            'admin_settings_html_selectors': '站点正文选择器',
+            'admin_settings_html_selectors_hint': '每行一个“域名=CSS 选择器”，为自动识别不准的站点指定正文区域；域名同时匹配其子域名',
+            'admin_doc_sort_label': '排序',
+            'admin_doc_sort_newest': '最新上传',
+            'admin_doc_sort_cited': '引用最多',
+            'admin_doc_sort_clicked': '点击最多',
+            'admin_doc_sort_least_cited': '引用最少',
+            'admin_doc_category_label': '类型',
+            'admin_doc_category_all': '全部',
+            'admin_doc_category_manual': '产品手册',
+            'admin_doc_category_faq': '常见问题',
+            'admin_doc_category_release_note': '发布说明',
+            'admin_doc_category_troubleshooting': '故障排查',
+            'admin_doc_category_other': '其他',
+            'admin_doc_tag_label': '标签',
+            'admin_doc_tag_all': '全部',
+            'admin_doc_tags_failed': '获取文档标签失败',
+            'admin_doc_retag_btn': '重新标签',
+            'admin_doc_retag_success': '标签已更新',
+            'admin_doc_retag_failed': '标签生成失败',
+            'admin_doc_usage': '引用 {cited} 次 · 点击 {clicked} 次',
+            'admin_doc_last_cited': '最近引用 {time}',
+            'admin_doc_citations_btn': '分段统计',
+            'admin_doc_citations_failed': '获取引用统计失败',
+            'admin_doc_citation_chunk': '第 {n} 段：引用 {cited} 次，点击 {clicked} 次',
             'admin_doc_review_title': '文档分析审看',
             'admin_doc_review_loading': '正在加载分析结果...',
             'admin_doc_review_load_failed': '加载分析结果失败',
@@ -250,14 +464,34 @@
             'admin_pending_filter_all': '全部',
             'admin_pending_filter_pending': '待回答',
             'admin_pending_filter_answered': '已回答',
+            'admin_pending_import_btn': '导入回答',
+            'admin_pending_import_hint': 'CSV 或 JSON，包含 question_id 和 answer 列',
+            'admin_pending_import_started': '已开始导入 {count} 条回答...',
+            'admin_pending_import_progress': '导入中 {progress}%：成功 {answered}，跳过 {skipped}，失败 {failed}',
+            'admin_pending_import_done': '导入完成：成功 {answered}，跳过 {skipped}，失败 {failed}',
+            'admin_pending_import_row': '第 {row} 行（{id}）：{error}',
+            'admin_pending_import_failed': '导入回答失败',
             'admin_pending_empty': '暂无问题',
             'admin_pending_user': '用户',
+            'admin_pending_origin_auto': '自动转入',
+            'admin_pending_origin_auto_hint': '系统无法根据知识库回答，已自动转为待处理问题',
+            'admin_pending_missing': '缺少的信息',
+            'admin_pending_context': '检索到的资料（{n} 条，不足以回答）',
             'admin_pending_answer_prefix': '回答',
             'admin_pending_answer_btn': '回答',
             'admin_pending_edit_btn': '编辑',
             'admin_pending_delete_btn': '删除',
             'admin_pending_delete_confirm': '确定要删除这个问题吗？',
             'admin_pending_deleted': '已删除',
+            'admin_pending_ticket': '工单',
+            'admin_pending_ticket_link_btn': '关联工单',
+            'admin_pending_ticket_unlink_btn': '取消关联',
+            'admin_pending_ticket_prompt': '输入外部工单号',
+            'admin_pending_ticket_saved': '工单关联已更新',
+            'admin_pending_ticket_failed': '更新工单关联失败',
+            'admin_pending_ticket_filter_all': '全部工单状态',
+            'admin_pending_ticket_filter_linked': '已关联工单',
+            'admin_pending_ticket_filter_unlinked': '未关联工单',
 
             // Admin - answer dialog
             'admin_answer_title': '回答问题',
@@ -287,6 +521,10 @@
             'admin_settings_api_key': 'API 密钥',
             'admin_settings_temperature': '温度',
             'admin_settings_max_tokens': '最大Token',
+            'admin_settings_llm_max_concurrency': '最大并发生成数',
+            'admin_settings_llm_max_queue': '最大排队数',
+            'admin_settings_llm_max_queued_per_user': '每用户最大排队数',
+            'admin_settings_llm_queue_timeout': '排队超时（秒）',
             'admin_settings_embedding': 'Embedding 配置',
             'admin_settings_emb_endpoint': 'Embedding 端点',
             'admin_settings_emb_model': 'Embedding 模型',
@@ -296,7 +534,65 @@
             'admin_settings_emb_multimodal_hint': '豆包视觉嵌入模型需开启此选项',
             'admin_settings_get_api_key': '获取 API Key',
             'admin_settings_test_llm': '测试 LLM 连接',
+            'admin_settings_llm_provider': 'LLM 协议',
+            'admin_settings_llm_provider_openai': 'OpenAI 兼容接口',
+            'admin_settings_llm_provider_ollama': 'Ollama（本地模型）',
+            'admin_settings_llm_provider_hint': 'Ollama 使用其原生接口，端点填写服务地址（如 http://localhost:11434），无需 API 密钥，适合离线部署；OCR 需使用支持图片的模型（如 qwen2.5vl、llava）',
+            'admin_llm_profiles_title': 'LLM 备用配置与任务路由',
+            'admin_llm_profiles_hint': '调用超时、网络错误或服务端 5xx 错误时，按优先级（数值小的优先，主配置为 0）自动切换到下一个配置；30 秒内失败过的配置排到最后',
+            'admin_llm_profiles_col_name': '名称',
+            'admin_llm_profiles_col_model': '模型',
+            'admin_llm_profiles_col_endpoint': '端点',
+            'admin_llm_profiles_col_priority': '优先级',
+            'admin_llm_profiles_col_actions': '操作',
+            'admin_llm_profiles_main': '主配置',
+            'admin_llm_profiles_edit': '添加或修改配置',
+            'admin_llm_profiles_name_placeholder': '名称，如 backup',
+            'admin_llm_profiles_model_placeholder': '模型名称',
+            'admin_llm_profiles_timeout': '超时（秒）',
+            'admin_llm_profiles_disabled': '停用',
+            'admin_llm_profiles_save': '保存配置',
+            'admin_llm_profiles_form_hint': '名称相同则覆盖原配置；最大 Token 为 0 时沿用主配置；修改时 API 密钥留空则保留原密钥',
+            'admin_llm_profiles_test': '测试',
+            'admin_llm_profiles_test_ok': '{name} 连接正常，耗时 {ms} ms',
+            'admin_llm_profiles_edit_btn': '编辑',
+            'admin_llm_profiles_delete': '删除',
+            'admin_llm_profiles_delete_confirm': '确定删除 LLM 配置 {name} 吗？路由到该配置的任务将按优先级选择配置。',
+            'admin_llm_profiles_deleted': 'LLM 配置已删除',
+            'admin_llm_profiles_delete_failed': '删除 LLM 配置失败',
+            'admin_llm_profiles_saved': 'LLM 配置已保存',
+            'admin_llm_profiles_save_failed': '保存 LLM 配置失败',
+            'admin_llm_profiles_load_failed': '加载 LLM 配置失败',
+            'admin_llm_routes_title': '任务路由',
+            'admin_llm_task_answer': '生成回答',
+            'admin_llm_task_intent': '意图识别',
+            'admin_llm_task_vision': '图片识别（OCR）',
+            'admin_llm_routes_by_priority': '按优先级',
+            'admin_llm_routes_save': '保存路由',
+            'admin_llm_routes_hint': '任务优先使用所选配置，不可用时再按优先级切换到其他配置。图片识别包括扫描件 OCR、视频关键帧和带图片的提问，应选择支持视觉的模型；产品单独设置了意图识别模型时以产品设置为准',
+            'admin_llm_routes_saved': '任务路由已保存',
+            'admin_llm_routes_save_failed': '保存任务路由失败',
             'admin_settings_test_embedding': '测试 Embedding 连接',
+            'admin_settings_reindex': '用以上设置重建向量索引',
+            'admin_settings_reindex_cancel': '取消重建',
+            'admin_settings_reindex_hint': '更换 Embedding 模型后旧向量不再兼容。重建在后台用以上设置重新计算所有文档的向量，完成前检索继续使用旧向量，完成后自动切换并保存模型设置',
+            'admin_settings_reindex_confirm': '确定用模型 {model} 重新计算所有文档的向量吗？这会为每个分块调用一次 Embedding 接口。',
+            'admin_settings_reindex_embedding': '正在用 {model} 重新向量化：{done}/{total} 个文档，失败 {failed}',
+            'admin_settings_reindex_swapping': '正在切换到 {model} 的新向量：{done}/{total}',
+            'admin_settings_reindex_done': '已切换到 {model}，共 {total} 个文档',
+            'admin_settings_reindex_canceled': '已取消，已完成 {done}/{total} 个文档，再次启动将从断点继续',
+            'admin_settings_reindex_failed': '重建向量索引失败',
+            'admin_settings_rerank': 'Rerank 重排序',
+            'admin_settings_rerank_enabled': '启用重排序',
+            'admin_settings_rerank_off': '关闭',
+            'admin_settings_rerank_on': '开启',
+            'admin_settings_rerank_hint': '检索后用 Rerank 模型对候选分块重新打分，取最相关的 Top-K 生成回答；接口失败时保留向量检索顺序',
+            'admin_settings_rerank_endpoint': 'Rerank 端点',
+            'admin_settings_rerank_model': 'Rerank 模型',
+            'admin_settings_rerank_top_n': '候选数量',
+            'admin_settings_rerank_top_n_hint': '送入重排序的向量检索结果数，0 表示默认（20）',
+            'admin_settings_test_rerank': '测试 Rerank 连接',
+            'admin_settings_rerank_test_misranked': '连接成功，但示例段落排序不正确，请确认模型是否为 Rerank 模型',
             'admin_settings_test_testing': '测试中...',
             'admin_settings_test_success': '连接成功',
             'admin_settings_test_failed': '连接失败',
@@ -307,17 +603,33 @@
             'admin_settings_topk': 'Top-K',
             'admin_settings_threshold': '相似度阈值',
             'admin_settings_content_priority': '内容优先级',
+            'admin_settings_verify_mode': '回答核查',
+            'admin_settings_verify_off': '关闭',
+            'admin_settings_verify_flag': '标记无依据的句子',
+            'admin_settings_verify_remove': '删除无依据的句子',
+            'admin_settings_verify_hint': '生成回答后再调用一次 LLM，逐句核对是否有参考资料支持，并记录可信度得分（会增加 LLM 费用）',
             'admin_settings_priority_image': '优先图文（有图片的结果优先）',
             'admin_settings_priority_text': '优先纯文字（纯文本结果优先）',
             'admin_settings_priority_hint': '设置回答时优先使用图文内容还是纯文字内容',
+            'admin_settings_language_filter': '检索语言过滤',
+            'admin_settings_language_filter_off': '关闭（不区分语言）',
+            'admin_settings_language_filter_prefer': '优先（与提问语言相同的资料优先）',
+            'admin_settings_language_filter_strict': '严格（只用与提问语言相同的资料）',
+            'admin_settings_language_filter_hint': '按导入时识别的文档语言筛选检索结果，避免多语言知识库中其他语言的资料占满英文或中文提问的结果；严格模式下找不到同语言资料时仍使用其他语言的资料',
+            'admin_doc_language': '文档语言（导入时识别）',
             'admin_settings_text_match': '三级文本匹配',
             'admin_settings_text_match_on': '开启（优先文本匹配，节省 API 费用）',
             'admin_settings_text_match_off': '关闭（始终使用完整 RAG 流程）',
             'admin_settings_text_match_hint': '开启后查询三级处理：1级纯文本匹配（免费）→ 2级向量确认缓存复用（仅嵌入费用）→ 3级完整RAG（嵌入+LLM费用）',
             'admin_settings_debug_mode': '调试模式',
             'admin_settings_debug_off': '关闭',
-            'admin_settings_debug_on': '开启（查询结果附带诊断信息）',
-            'admin_settings_debug_hint': '开启后聊天回复会显示三级搜索的详细过程，方便排查问题',
+            'admin_settings_debug_on': '开启（管理员的查询结果附带诊断信息）',
+            'admin_settings_debug_hint': '开启后管理员在对话中提问时默认显示三级搜索的详细过程，方便排查问题；普通用户始终看不到诊断信息',
+            'admin_settings_debug_token': '调试链接',
+            'admin_settings_debug_token_issue': '生成 1 小时调试链接',
+            'admin_settings_debug_token_hint': '用普通用户账号打开此链接提问时，回复会附带检索诊断信息；链接仅在当前浏览器标签页生效，过期后失效',
+            'admin_settings_debug_token_issued': '调试链接已生成，有效期至 {time}',
+            'admin_settings_debug_token_failed': '生成调试链接失败',
             'admin_settings_smtp': '邮件服务器(SMTP)',
             'admin_settings_smtp_host': 'SMTP 服务器',
             'admin_settings_smtp_port': '端口',
@@ -340,13 +652,94 @@
             'admin_settings_smtp_test_sending': '正在发送...',
             'admin_settings_smtp_test_success': '测试邮件已发送，请检查收件箱',
             'admin_settings_smtp_test_failed': '发送失败',
+            'admin_settings_email_ingest': '邮件导入',
+            'admin_settings_email_ingest_hint': '将邮件服务商的入站 Webhook 指向 /api/inbound-email?token=令牌，发送或转发到指定邮箱的邮件会转为知识条目草稿，在“内容审核”中审核通过后发布',
+            'admin_settings_email_ingest_enabled': '邮件导入',
+            'admin_settings_email_ingest_off': '关闭',
+            'admin_settings_email_ingest_on': '开启',
+            'admin_settings_email_ingest_token': 'Webhook 令牌',
+            'admin_settings_email_ingest_token_hint': '至少 16 个字符，留空保持不变',
+            'admin_settings_email_ingest_recipients': '指定邮箱',
+            'admin_settings_email_ingest_recipients_hint': '多个用逗号分隔，只导入发送到这些邮箱的邮件；留空不限',
+            'admin_settings_email_ingest_senders': '允许的发件人',
+            'admin_settings_email_ingest_senders_hint': '多个用逗号分隔，可填写邮箱地址或 @域名；留空不限',
+            'admin_settings_email_ingest_product': '所属产品 ID',
+            'admin_settings_email_ingest_product_placeholder': '留空为公共库',
+            'admin_settings_notify': '待回答问题通知',
+            'admin_settings_notify_hint': '有新的待回答问题时推送消息到团队群聊，包含问题、用户和回答链接（需设置外部访问地址）。Webhook 地址和签名密钥留空保持不变',
+            'admin_settings_notify_slack': 'Slack',
+            'admin_settings_notify_lark': '飞书',
+            'admin_settings_notify_dingtalk': '钉钉',
+            'admin_settings_notify_off': '关闭',
+            'admin_settings_notify_on': '开启',
+            'admin_settings_notify_webhook': 'Webhook 地址',
+            'admin_settings_notify_secret': '签名密钥',
+            'admin_settings_notify_secret_hint': '机器人开启签名校验时填写',
+            'admin_settings_notify_test_btn': '发送测试消息',
+            'admin_settings_notify_test_sending': '正在发送...',
+            'admin_settings_notify_test_success': '测试消息已发送',
+            'admin_settings_notify_test_failed': '发送测试消息失败',
             'admin_settings_admin': '管理员设置',
+            'admin_settings_external_base_url': '外部访问地址',
+            'admin_settings_external_base_url_hint': '部署在反向代理或路径前缀之后时填写，用于邮件链接、OAuth 回调、工单登录跳转和分享链接；留空则根据请求自动推断',
             'admin_settings_login_route': '管理员登录路由',
             'admin_settings_login_route_hint': '访问此隐藏路由可进入管理员登录页面',
+            'admin_settings_password_policy': '密码策略',
+            'admin_settings_password_min_length': '最短长度',
+            'admin_settings_password_require': '必须包含',
+            'admin_settings_password_class_letter': '字母',
+            'admin_settings_password_class_upper': '大写字母',
+            'admin_settings_password_class_lower': '小写字母',
+            'admin_settings_password_class_digit': '数字',
+            'admin_settings_password_class_symbol': '特殊符号',
+            'admin_settings_password_breach_list': '泄露密码库',
+            'admin_settings_password_breach_list_hint': '服务器上按哈希排序的 SHA-1 泄露密码列表（Have I Been Pwned 格式），出现在其中的密码将被拒绝；留空不检查',
+            'admin_settings_password_max_age': '密码有效期（天）',
+            'admin_settings_password_max_age_hint': '超过有效期后，用户需通过“忘记密码”重新设置，管理员登录后需立即修改密码；0 表示不过期',
+            'admin_settings_session': '登录会话',
+            'admin_settings_session_idle': '空闲超时（分钟）',
+            'admin_settings_session_idle_hint': '用户和管理员无操作超过该时长后需重新登录，每次操作都会重新计时',
+            'admin_settings_session_max': '最长登录时长（小时）',
+            'admin_settings_session_max_hint': '无论是否有操作，登录满该时长后都需重新登录',
+            'admin_sidebar_change_password': '修改密码',
+            'admin_sidebar_notify_prefs': '我的通知',
+            'admin_notify_prefs_title': '我的通知',
+            'admin_notify_prefs_hint': '选择要接收的事件，只会收到你负责的产品的通知。不影响系统设置中的团队通知渠道。',
+            'admin_notify_prefs_events': '接收的事件',
+            'admin_notify_prefs_email': '接收邮箱',
+            'admin_notify_prefs_channel': '个人 Webhook 类型',
+            'admin_notify_prefs_webhook': '个人 Webhook 地址',
+            'admin_notify_prefs_webhook_placeholder': '留空则只发送邮件',
+            'admin_notify_prefs_secret': '签名密钥',
+            'admin_notify_prefs_saved': '通知偏好已保存',
+            'admin_notify_prefs_save_failed': '保存通知偏好失败',
+            'admin_notify_prefs_load_failed': '加载通知偏好失败',
+            'admin_notify_event_pending': '新的待回答问题',
+            'admin_notify_event_document_failed': '文档处理失败',
+            'admin_notify_event_security': '安全事件（文件隔离、账号锁定）',
+            'admin_notify_event_schedule': '文档按计划发布或下线',
+            'admin_notify_event_budget': '模型费用预算告警',
+            'admin_notify_event_digest': '每日摘要（每天 9 点）',
+            'admin_password_expired': '密码已过期，请立即修改密码',
+            'admin_password_current': '请输入当前密码',
+            'admin_password_new': '请输入新密码',
+            'admin_password_confirm': '请再次输入新密码',
+            'admin_password_mismatch': '两次输入的新密码不一致',
+            'admin_password_changed': '密码已修改',
+            'admin_password_change_failed': '修改密码失败',
             'admin_settings_product_intro': '产品介绍',
             'admin_settings_product_intro_label': '欢迎信息',
             'admin_settings_product_intro_placeholder': '输入产品简介，用户登录后将作为欢迎信息显示',
             'admin_settings_product_intro_hint': '用户登录后在聊天页面显示此信息',
+            'admin_settings_small_talk': '闲聊应答',
+            'admin_settings_small_talk_hint': '“谢谢”“好的”等简单寒暄直接按下面的短语列表回复，不调用大模型；问候回复产品介绍',
+            'admin_settings_small_talk_enabled': '本地闲聊应答',
+            'admin_settings_small_talk_on': '开启',
+            'admin_settings_small_talk_off': '关闭（交给意图识别）',
+            'admin_settings_small_talk_interval': '产品介绍间隔（分钟）',
+            'admin_settings_small_talk_interval_hint': '同一用户在此时间内再次问候时只回复简短问候语，不重复产品介绍，默认 30 分钟',
+            'admin_settings_small_talk_rules': '短语列表',
+            'admin_settings_small_talk_rules_hint': '每行一条：语言|类型|短语1,短语2|回复。类型为 greeting（问候）、thanks（感谢）、ack（确认）或 goodbye（告别）；整条消息与某个短语相同（忽略大小写、标点和空格）时匹配',
             'admin_settings_product_name': '产品名称',
             'admin_settings_product_name_label': '产品名称',
             'admin_settings_product_name_placeholder': '输入产品名称，如：XX自助服务系统',
@@ -368,6 +761,19 @@
             'admin_settings_oauth_hint': '配置第三方OAuth登录，设置完成后用户可在登录页看到对应的登录按钮',
             'admin_settings_oauth_add': '添加 OAuth 平台',
             'admin_settings_oauth_add_btn': '添加',
+            'admin_settings_external_auth': '外部账号登录',
+            'admin_settings_external_auth_hint': '对接非 OAuth 的自建单点登录：用户在登录页输入账号和密码，系统以 POST 请求将 {"credentials": {"username", "password"}} 发送到校验地址，校验通过时应返回 200 和 {"id", "email", "name"}，账号或密码错误时返回 401 或 403',
+            'admin_settings_external_auth_enabled': '启用',
+            'admin_settings_external_auth_off': '关闭',
+            'admin_settings_external_auth_on': '开启',
+            'admin_settings_external_auth_label': '按钮文字',
+            'admin_settings_external_auth_label_placeholder': '公司账号',
+            'admin_settings_external_auth_name': '标识',
+            'admin_settings_external_auth_name_hint': '用户 ID 为“标识_校验返回的 id”，启用后请勿修改，否则用户会被当作新用户',
+            'admin_settings_external_auth_url': '校验地址',
+            'admin_settings_external_auth_secret': '访问密钥',
+            'admin_settings_external_auth_secret_hint': '设置后以 Authorization: Bearer <密钥> 请求头发送',
+            'admin_settings_external_auth_timeout': '超时（秒）',
             'admin_settings_oauth_empty': '暂未配置任何 OAuth 登录平台',
             'admin_settings_oauth_status_ok': '已配置',
             'admin_settings_oauth_status_incomplete': '未完成',
@@ -414,6 +820,9 @@
             'login_divider_or': '或',
             'login_oauth_with': '使用',
             'login_oauth_failed': 'OAuth 登录失败',
+            'external_login_default_label': '企业账号',
+            'external_login_username': '账号',
+            'external_login_error_empty': '请输入账号和密码',
 
             // Admin - knowledge
             'admin_knowledge_title': '知识录入',
@@ -423,6 +832,8 @@
             'admin_knowledge_title_placeholder': '知识条目标题',
             'admin_knowledge_content_label': '内容',
             'admin_knowledge_content_placeholder': '输入知识内容（支持详细描述）',
+            'admin_knowledge_markdown_label': 'Markdown 格式',
+            'admin_knowledge_markdown_hint': '启用后，上传的图片以 ![说明](地址) 插入到光标处，检索时图片与其前后文字保持关联',
             'admin_knowledge_image_label': '图片（可选）',
             'admin_knowledge_image_upload': '点击上传图片、拖拽图片到此处，或从剪贴板粘贴',
             'admin_knowledge_image_hint': '支持 JPG、PNG、GIF、WebP、BMP 格式',
@@ -430,11 +841,73 @@
             'admin_knowledge_video_upload': '点击上传视频、拖拽视频到此处，或从剪贴板粘贴',
             'admin_knowledge_video_hint': '支持 MP4、AVI、MKV、MOV、WebM 格式',
             'admin_knowledge_submit': '提交录入',
+            'admin_announcement_legend': '产品公告',
+            'admin_announcement_hint': '公告在生效期内显示在对话页顶部，同时作为文档索引，用户可以询问“新版本有哪些变化”。',
+            'admin_announcement_title_label': '标题',
+            'admin_announcement_title_placeholder': '例如：2.1 版本发布',
+            'admin_announcement_version_label': '版本号（可选）',
+            'admin_announcement_content_label': '内容',
+            'admin_announcement_content_placeholder': '本次更新的主要变化',
+            'admin_announcement_publish': '发布公告',
+            'admin_announcement_save': '保存修改',
+            'admin_announcement_cancel': '取消编辑',
+            'admin_announcement_edit': '编辑',
+            'admin_announcement_th_title': '标题',
+            'admin_announcement_th_period': '生效期',
+            'admin_announcement_always': '长期',
+            'admin_announcement_empty': '暂无公告',
+            'admin_announcement_empty_fields': '请填写标题和内容',
+            'admin_announcement_saved': '公告已保存',
+            'admin_announcement_save_failed': '保存公告失败',
+            'admin_announcement_delete_confirm': '确定要删除公告"{name}"吗？其索引内容也会被删除。',
+            'admin_announcement_deleted': '公告已删除',
+            'admin_template_btn': '回答模板',
+            'admin_template_legend': '回答模板',
+            'admin_template_hint': '回答问题时可插入模板。内容中的 {question} 和 {product_name} 按问题自动填写，其他 {变量名}（如 {download_url}）使用下方的默认值，未填写的保留原样供修改。',
+            'admin_template_name_label': '名称',
+            'admin_template_name_placeholder': '例如：下载安装包',
+            'admin_template_content_label': '内容',
+            'admin_template_content_placeholder': '您好，{product_name} 的最新安装包可从 {download_url} 下载。',
+            'admin_template_variables_label': '变量默认值（可选，每行一个 name=value）',
+            'admin_template_variables_invalid': '变量默认值格式应为 name=value：{line}',
+            'admin_template_th_variables': '变量',
+            'admin_template_empty': '暂无回答模板',
+            'admin_template_create': '添加模板',
+            'admin_template_save': '保存修改',
+            'admin_template_cancel': '取消编辑',
+            'admin_template_edit': '编辑',
+            'admin_template_empty_fields': '请填写模板名称和内容',
+            'admin_template_saved': '模板已保存',
+            'admin_template_save_failed': '保存模板失败',
+            'admin_template_delete_confirm': '确定删除模板“{name}”吗？',
+            'admin_template_deleted': '模板已删除',
+            'admin_template_delete_failed': '删除模板失败',
+            'admin_answer_template_label': '使用模板（可选）',
+            'admin_answer_template_none': '不使用模板',
+            'admin_answer_template_adapt': '按问题调整（AI）',
+            'admin_answer_template_insert': '插入',
+            'admin_answer_template_adapting': '调整中...',
+            'admin_answer_template_pick': '请先选择模板',
+            'admin_answer_template_failed': '插入模板失败',
+            'admin_answer_template_missing': '以下变量未填写，请在回答中修改：{names}',
+            'admin_announcement_delete_failed': '删除公告失败',
             'admin_knowledge_empty': '请输入标题和内容',
             'admin_knowledge_submitting': '正在录入知识...',
             'admin_knowledge_submitting_btn': '提交中...',
             'admin_knowledge_success': '知识录入成功',
             'admin_knowledge_failed': '录入失败',
+            'admin_knowledge_cancel_edit': '取消编辑',
+            'admin_knowledge_save_edit': '保存修改',
+            'admin_knowledge_updated': '知识条目已更新',
+            'admin_knowledge_list_legend': '已录入的知识',
+            'admin_knowledge_list_hint': '按上方目标产品筛选。编辑后只有改动的段落会重新向量化。',
+            'admin_knowledge_list_empty': '暂无知识条目',
+            'admin_knowledge_th_updated': '更新时间',
+            'admin_knowledge_edit': '编辑',
+            'admin_knowledge_load_failed': '加载知识条目失败',
+            'admin_knowledge_delete_confirm': '确定要删除知识条目"{name}"吗？',
+            'admin_knowledge_deleted': '知识条目已删除',
+            'admin_knowledge_delete_failed': '删除知识条目失败',
 
             // Admin - users
             'admin_users_title': '用户管理',
@@ -459,8 +932,26 @@
             'admin_users_delete_btn': '删除',
             'admin_users_delete_confirm': '确定要删除用户 "{name}" 吗？',
             'admin_users_deleted': '用户已删除',
+            'admin_apikeys_legend': 'API 密钥',
+            'admin_apikeys_name': '名称',
+            'admin_apikeys_name_placeholder': '如：门户后端',
+            'admin_apikeys_scopes': '权限范围',
+            'admin_apikeys_scopes_hint': '请求头携带 Authorization: ApiKey <密钥> 调用接口；写权限包含对应的读权限',
+            'admin_apikeys_expires': '有效期（天）',
+            'admin_apikeys_expires_hint': '0 表示永不过期',
+            'admin_apikeys_create_btn': '创建密钥',
+            'admin_apikeys_th_prefix': '密钥',
+            'admin_apikeys_th_last_used': '最近使用',
+            'admin_apikeys_th_expires': '过期时间',
+            'admin_apikeys_empty': '暂无 API 密钥',
+            'admin_apikeys_never': '永不过期',
+            'admin_apikeys_revoke_btn': '吊销',
+            'admin_apikeys_revoke_confirm': '确定吊销 API 密钥「{name}」吗？使用该密钥的集成将立即失效。',
+            'admin_apikeys_revoked': 'API 密钥已吊销',
+            'admin_apikeys_create_empty': '请填写名称并至少选择一个权限范围',
+            'admin_apikeys_create_failed': '创建 API 密钥失败',
+            'admin_apikeys_created': 'API 密钥已创建。请立即复制保存，关闭后将无法再次查看：',
             'admin_users_create_empty': '请输入用户名和密码',
-            'admin_users_create_password_short': '密码至少6位',
             'admin_users_created': '用户创建成功',
             'admin_users_create_failed': '创建失败',
             'admin_users_products': '关联产品',
@@ -522,8 +1013,30 @@
             'admin_products_welcome': '欢迎消息',
             'admin_products_welcome_placeholder': '用户选择该产品后显示的欢迎消息（可选）',
             'admin_products_allow_download': '允许下载参考文件',
+            'admin_products_isolated_storage': '独立存储',
+            'admin_products_isolated_storage_hint': '知识分块保存在该产品专属的数据库文件中，创建后不可更改',
+            'admin_products_isolated_storage_badge': '独立存储',
+            'admin_products_ticket_url': '工单链接模板',
+            'admin_products_ticket_url_placeholder': '如 https://jira.example.com/browse/{ref}（可选）',
+            'admin_products_disclaimer': '回答免责声明',
+            'admin_products_disclaimer_placeholder': '追加在每条回答末尾，如“以上内容不构成法律意见，请以官方文档为准”（可选）',
+            'admin_products_disclaimer_translations': '免责声明译文',
+            'admin_products_disclaimer_translations_placeholder': '每行一种语言，如 en: This is not legal advice.（可选）',
+            'admin_products_disclaimer_translation_invalid': '免责声明译文格式应为“语言代码: 文本”，第 {line} 行有误',
             'admin_products_allow_download_hint': '启用后，用户可在聊天中下载 PDF/Word/Excel/PPT/视频 等参考文件',
             'admin_products_add_btn': '添加产品',
+            'admin_products_csv_legend': '批量导入/导出',
+            'admin_products_csv_hint': 'CSV 列：external_id、name、type、description、welcome_message、allow_download、explain_sources、allow_share、isolated_storage、ocr_language、ticket_url_template，仅 name 必填。按 external_id 或名称匹配已有产品，重复导入不会产生重复数据',
+            'admin_products_import_btn': '导入 CSV',
+            'admin_products_export_btn': '导出 CSV',
+            'admin_products_export_failed': '导出产品失败',
+            'admin_products_import_no_file': '请先选择 CSV 文件',
+            'admin_products_import_failed': '导入产品失败',
+            'admin_products_import_invalid': '{count} 行有误，未导入任何产品：',
+            'admin_products_import_row_error': '第 {line} 行（{name}）：{message}',
+            'admin_products_import_nothing': '没有需要导入的变更（{unchanged} 个产品无变化）',
+            'admin_products_import_confirm': '将新建 {created} 个产品、更新 {updated} 个产品（{unchanged} 个无变化），确认导入？',
+            'admin_products_import_done': '导入完成：新建 {created} 个，更新 {updated} 个，{unchanged} 个无变化',
             'admin_products_list_legend': '产品列表',
             'admin_products_th_name': '名称',
             'admin_products_th_type': '类型',
@@ -541,6 +1054,17 @@
             'admin_products_edit_failed': '修改失败',
             'admin_products_delete_confirm': '确定要删除产品"{name}"吗？关联的文档和知识也会被删除。',
             'admin_products_deleted': '产品已删除',
+            'admin_products_status_all': '全部产品',
+            'admin_products_status_active': '使用中',
+            'admin_products_status_archived': '已归档',
+            'admin_products_archived_badge': '已归档',
+            'admin_products_archived_suffix': '（已归档）',
+            'admin_products_archive_btn': '归档',
+            'admin_products_unarchive_btn': '取消归档',
+            'admin_products_archive_confirm': '归档后该产品对用户隐藏，也不能再上传文档或添加知识，数据会保留。确定归档吗？',
+            'admin_products_archived': '产品已归档',
+            'admin_products_unarchived': '产品已取消归档',
+            'admin_products_archive_failed': '更新归档状态失败',
             'admin_products_name_required': '请输入产品名称',
             'admin_products_created': '产品创建成功',
             'admin_products_create_failed': '创建失败',
@@ -604,6 +1128,12 @@
             'admin_multimodal_max_upload_hint': '视频和文档上传的最大文件大小，默认 500MB',
             'admin_multimodal_processing_timeout': '处理超时时间（分钟）',
             'admin_multimodal_processing_timeout_hint': '视频和PDF文件后台处理的最大等待时间，默认 120 分钟',
+            'admin_multimodal_ytdlp_path': 'yt-dlp 路径',
+            'admin_multimodal_ytdlp_hint': '用于通过 URL 导入 YouTube、Vimeo 视频，有字幕时直接使用字幕代替语音识别；留空则仅支持视频文件直链',
+            'admin_multimodal_url_max_duration': 'URL 视频时长限制（分钟）',
+            'admin_multimodal_url_max_duration_hint': '通过 URL 导入的视频的最大时长，大小受文件上传大小限制约束，默认 120 分钟',
+            'admin_multimodal_diarization_command': '说话人分离程序',
+            'admin_multimodal_diarization_command_hint': '可选，用于区分通话录音中的客户和客服。程序以 WAV 文件路径为参数，输出 [{"start","end","speaker"}] JSON；留空则不区分说话人',
             'admin_multimodal_supported': '支持的视频格式',
             'admin_multimodal_formats': 'MP4、AVI、MKV、MOV、WebM',
             'admin_multimodal_workflow': '上传视频后，系统将自动：1) 使用 FFmpeg 提取音频和关键帧 → 2) 使用 RapidSpeech 将语音转为文字 → 3) 对文字和图像分别生成向量嵌入 → 4) 存入知识库供检索',
@@ -634,6 +1164,159 @@
             'admin_logs_clear_confirm': '确定要清空所有日志吗？此操作不可恢复。',
             'admin_logs_clear_failed': '清空日志失败',
             'admin_logs_clear_done': '日志已清空',
+            'admin_maintenance_title': '数据库维护',
+            'admin_maintenance_window': '维护时段',
+            'admin_maintenance_enabled': '每晚自动维护',
+            'admin_maintenance_disabled': '关闭自动维护',
+            'admin_maintenance_run': '立即维护',
+            'admin_maintenance_hint': '在维护时段内执行 WAL 检查点截断、ANALYZE 统计更新和增量 VACUUM，每晚一次',
+            'admin_maintenance_next_run': '下次维护',
+            'admin_maintenance_running': '维护进行中...',
+            'admin_maintenance_started': '数据库维护已开始',
+            'admin_maintenance_saved': '维护设置已保存',
+            'admin_maintenance_failed': '数据库维护失败',
+            'admin_maintenance_load_failed': '加载维护记录失败',
+            'admin_maintenance_empty': '暂无维护记录',
+            'admin_maintenance_col_time': '开始时间',
+            'admin_maintenance_col_trigger': '触发方式',
+            'admin_maintenance_col_duration': '耗时',
+            'admin_maintenance_col_db': '数据库大小',
+            'admin_maintenance_col_wal': 'WAL 大小',
+            'admin_maintenance_col_freed': '释放页数',
+            'admin_maintenance_col_result': '结果',
+            'admin_maintenance_trigger_scheduled': '定时',
+            'admin_maintenance_trigger_manual': '手动',
+            'admin_maintenance_ok': '成功',
+            'admin_maintenance_full_vacuum': '成功（已执行完整 VACUUM）',
+            'admin_export_title': '数据导出',
+            'admin_export_schedule': '导出计划',
+            'admin_export_enabled': '定时导出',
+            'admin_export_disabled': '关闭定时导出',
+            'admin_export_every': '每',
+            'admin_export_hours': '小时',
+            'admin_export_hint': '每次导出上次成功导出以来的问答记录（queries）、用户评价（feedback）和按天、按产品汇总的使用指标（usage），每类一个文件',
+            'admin_export_dir': '导出目录',
+            'admin_export_s3': '上传到对象存储',
+            'admin_export_s3_off': '不上传',
+            'admin_export_s3_on': '上传',
+            'admin_export_s3_hint': '使用备份设置中的对象存储连接和存储桶，文件保存在此前缀下',
+            'admin_export_webhook': '推送 Webhook',
+            'admin_export_secret': '签名密钥',
+            'admin_export_webhook_hint': '每个文件以 POST 请求推送，请求头 X-Askflow-Dataset 标明数据类型；设置密钥后附带 X-Askflow-Signature: sha256=<HMAC>',
+            'admin_export_run': '立即导出',
+            'admin_export_next_run': '下次导出',
+            'admin_export_running': '导出进行中...',
+            'admin_export_started': '数据导出已开始',
+            'admin_export_saved': '导出设置已保存',
+            'admin_budget_title': '模型预算',
+            'admin_budget_limit': '每月预算',
+            'admin_budget_block_optional': '达到上限后暂停翻译、标签、建议等非必要调用',
+            'admin_budget_degrade': '达到上限后同时切换为仅缓存答案和关键词检索',
+            'admin_budget_hint': '费用按估算的 token 数和模型设置中的每百万 token 价格计算，0 表示不限；在 80% 和 100% 时通过团队通知提醒管理员。产品预算只统计该产品问答产生的费用',
+            'admin_budget_col_scope': '范围',
+            'admin_budget_col_spent': '本月已用',
+            'admin_budget_col_limit': '预算',
+            'admin_budget_col_percent': '比例',
+            'admin_budget_empty': '暂无用量',
+            'admin_budget_deployment': '整个部署',
+            'admin_budget_unlimited': '不限',
+            'admin_budget_summary': '{month}：LLM 约 {llm} tokens，向量模型约 {embedding} tokens',
+            'admin_budget_load_failed': '加载预算用量失败',
+            'admin_budget_saved': '预算设置已保存',
+            'admin_export_failed': '数据导出失败',
+            'admin_export_load_failed': '加载导出记录失败',
+            'admin_export_empty': '暂无导出记录',
+            'admin_export_col_period': '数据区间',
+            'admin_export_col_rows': '记录数',
+            'admin_export_period_all': '全部历史',
+            'admin_export_rows': '问答 {queries} / 评价 {feedback} / 汇总 {usage}',
+            'admin_backup_title': '在线备份',
+            'admin_backup_mode': '备份模式',
+            'admin_backup_mode_full': '全量备份',
+            'admin_backup_mode_incremental': '增量备份',
+            'admin_backup_save': '备份到服务器',
+            'admin_backup_download': '备份并下载',
+            'admin_backup_hint': '备份期间服务照常运行；服务器端备份保存在 data/backups 并上传到备份对象存储（如已配置），增量备份以最近一次服务器端备份为基准',
+            'admin_backup_col_target': '保存位置',
+            'admin_backup_col_size': '大小',
+            'admin_backup_target_server': '服务器',
+            'admin_backup_target_download': '下载',
+            'admin_backup_running': '备份进行中...',
+            'admin_backup_done': '备份完成',
+            'admin_backup_failed': '备份失败',
+            'admin_backup_load_failed': '加载备份记录失败',
+            'admin_backup_empty': '暂无备份记录',
+            'admin_jobs_title': '后台任务',
+            'admin_jobs_concurrency': '并发任务数',
+            'admin_jobs_refresh': '刷新',
+            'admin_jobs_hint': '文档处理（视频、PDF、PPT）、批量导入和向量索引重建在后台运行，同时处理的文档数不超过并发任务数',
+            'admin_jobs_summary': '运行中 {running} 个，排队 {queued} 个',
+            'admin_jobs_empty': '暂无后台任务',
+            'admin_jobs_load_failed': '加载后台任务失败',
+            'admin_jobs_col_time': '创建时间',
+            'admin_jobs_col_type': '类型',
+            'admin_jobs_col_label': '名称',
+            'admin_jobs_col_status': '状态',
+            'admin_jobs_col_progress': '进度',
+            'admin_jobs_col_actions': '操作',
+            'admin_jobs_type_document': '文档处理',
+            'admin_jobs_type_batch_import': '批量导入',
+            'admin_jobs_type_reindex': '重建向量索引',
+            'admin_jobs_type_crawl': '整站抓取',
+            'admin_jobs_type_bulk_answer': '批量回答',
+            'admin_replay_title': '查询回放',
+            'admin_replay_new_sample': '新建样本',
+            'admin_replay_name_placeholder': '样本名称',
+            'admin_replay_create': '抽取样本',
+            'admin_replay_hint': '从查询日志中随机抽取问题，用当前的模型和检索设置重新回答，并与原答案或上一次回放对比。回放不会创建待回答问题或触发意图通知，但会计入模型预算',
+            'admin_replay_all_products': '全部产品',
+            'admin_replay_col_time': '创建时间',
+            'admin_replay_col_name': '样本名称',
+            'admin_replay_col_product': '产品',
+            'admin_replay_col_size': '问题数',
+            'admin_replay_col_actions': '操作',
+            'admin_replay_col_settings': '模型设置',
+            'admin_replay_col_status': '状态',
+            'admin_replay_col_question': '问题',
+            'admin_replay_col_baseline_answer': '基准回答',
+            'admin_replay_col_answer': '回放回答',
+            'admin_replay_col_similarity': '相似度',
+            'admin_replay_col_sources': '引用变化',
+            'admin_replay_empty': '暂无回放样本',
+            'admin_replay_runs_empty': '该样本尚未回放',
+            'admin_replay_load_failed': '加载查询回放失败',
+            'admin_replay_create_failed': '抽取样本失败',
+            'admin_replay_created': '已抽取 {size} 个问题',
+            'admin_replay_delete': '删除',
+            'admin_replay_delete_confirm': '确定删除该样本及其全部回放记录吗？',
+            'admin_replay_delete_failed': '删除样本失败',
+            'admin_replay_deleted': '回放样本已删除',
+            'admin_replay_run': '回放',
+            'admin_replay_run_confirm': '将用当前设置重新回答样本中的全部问题，产生的模型调用计入预算。确定开始吗？',
+            'admin_replay_run_failed': '启动回放失败',
+            'admin_replay_started': '回放已加入后台任务',
+            'admin_replay_runs': '回放记录',
+            'admin_replay_progress': '已回放 {done} 个',
+            'admin_replay_threshold': '阈值',
+            'admin_replay_report': '对比报告',
+            'admin_replay_baseline': '对比基准',
+            'admin_replay_baseline_original': '原始回答',
+            'admin_replay_show_all': '显示未变化的问题',
+            'admin_replay_summary': '已回放 {replayed}/{total}：未变化 {unchanged}，回答变化 {answer}，引用变化 {sources}，新转人工 {pending}，新能回答 {answered}，失败 {failed}，平均相似度 {similarity}',
+            'admin_replay_pending': '转人工',
+            'admin_replay_no_changes': '没有变化的问题',
+            'admin_jobs_type_replay': '查询回放',
+            'admin_jobs_status_queued': '排队中',
+            'admin_jobs_status_running': '运行中',
+            'admin_jobs_status_succeeded': '已完成',
+            'admin_jobs_status_failed': '失败',
+            'admin_jobs_status_canceled': '已取消',
+            'admin_jobs_cancel': '取消',
+            'admin_jobs_cancel_confirm': '确定要取消该任务吗？',
+            'admin_jobs_canceled': '任务已取消',
+            'admin_jobs_cancel_failed': '取消任务失败',
+            'admin_jobs_concurrency_invalid': '并发任务数须在 1 到 16 之间',
+            'admin_jobs_saved': '后台任务设置已保存',
 
             // Batch import
             'batch_product_public': '公共区',
@@ -643,10 +1326,28 @@
             'batch_preparing': '准备中...',
             'batch_import_failed': '批量导入失败',
             'batch_start_text': '共 {total} 个文件，开始导入...',
+            'batch_filtered_text': '（按筛选条件排除 {n} 个）',
             'batch_done_text': '导入完成',
             'batch_report_total': '总文件数',
             'batch_report_success': '成功',
             'batch_report_failed': '失败',
+            'batch_estimate_btn': '预估',
+            'batch_estimating': '预估中...',
+            'batch_estimate_start_text': '共 {total} 个文件，开始预估（不写入任何数据）...',
+            'batch_estimate_done_text': '预估完成',
+            'batch_estimate_line': '分块 {chunks}，嵌入 {embeddings}（约 {tokens} tokens），预计费用 {cost}',
+            'batch_estimate_ocr': '，OCR {pages} 页',
+            'batch_report_planned': '将导入',
+            'batch_report_skipped': '跳过',
+            'batch_report_cost': '预计费用',
+            'batch_report_estimate_summary': '分块 {chunks}，嵌入 {embeddings} 段（约 {tokens} tokens），图片 {images} 张，OCR {pages} 页，LLM 约 {llm} tokens。费用按设置中的每百万 tokens 单价估算，不含图片嵌入。',
+            'batch_report_failed_title': '失败文件列表',
+            'batch_report_skipped_title': '跳过或无法导入的文件',
+            'batch_classify_btn': '自动分类',
+            'batch_classifying': '分类中...',
+            'batch_classify_start_text': '共 {total} 个文件，正在按产品自动分类...',
+            'batch_classify_done_text': '分类完成，请确认每个文件的归属产品',
+            'batch_classify_failed': '自动分类失败',
 
             // Language
             'lang_switch': 'EN'
@@ -690,7 +1391,6 @@
             'register_login_link': 'Sign In',
             'register_error_email': 'Please enter email',
             'register_error_password': 'Please enter password',
-            'register_error_password_length': 'Password must be at least 8 characters',
             'register_error_password_mismatch': 'Passwords do not match',
             'register_error_captcha': 'Please enter captcha',
             'register_failed': 'Registration failed',
@@ -713,7 +1413,6 @@
             'reset_confirm_password': 'Confirm new password',
             'reset_btn': 'Reset Password',
             'reset_error_password': 'Please enter a new password',
-            'reset_error_password_length': 'Password must be at least 8 characters',
             'reset_error_password_mismatch': 'Passwords do not match',
             'reset_invalid_link': 'Invalid reset link',
             'reset_failed': 'Reset failed',
@@ -741,7 +1440,6 @@
             'admin_setup_btn': 'Create Admin',
             'admin_error_username': 'Please enter username',
             'admin_error_password': 'Please enter password',
-            'admin_error_password_length': 'Password must be at least 6 characters',
             'admin_error_password_mismatch': 'Passwords do not match',
             'admin_error_credentials': 'Please enter username and password',
             'admin_error_captcha': 'Please enter captcha',
@@ -769,7 +1467,26 @@
             'chat_image_upload_title': 'Upload image',
             'chat_image_recognize': 'Please search for technical documents related to this image',
             'chat_request_failed': 'Request failed',
+            'chat_history_btn': 'Chat history',
+            'chat_history_title': 'Chat History',
+            'chat_history_empty': 'No chat history yet',
+            'chat_history_more': 'Load more',
+            'chat_history_load_failed': 'Failed to load chat history',
+            'chat_history_delete': 'Delete',
+            'chat_history_delete_confirm': 'Delete this chat history entry?',
+            'chat_history_delete_failed': 'Failed to delete chat history',
+            'chat_announcement_dismiss': 'Dismiss',
+            'chat_degraded_banner': 'Knowledge search is temporarily unavailable. Answers are based on keyword matching and may be less accurate',
+            'chat_degraded_answer': 'Degraded mode: this answer is based on keyword matching and may be less accurate',
+            'chat_budget_answer': 'The monthly model budget is used up: this answer quotes the most relevant passages without AI summarization',
+            'chat_code_copy': 'Copy',
+            'chat_code_copied': 'Copied',
+            'chat_rate_warning': "You're sending messages quickly: {remaining} more question(s) allowed for now, more in about {seconds}s",
             'chat_no_answer': 'No answer available',
+            'chat_unsupported_claims': 'The following statements could not be verified against the sources:',
+            'chat_flow_start': 'Guided troubleshooting: {title}',
+            'chat_flow_escalate': 'Hand off to support',
+            'chat_queue_position': 'Queued, position {n}',
             'chat_pending_message': 'This question has been forwarded to support staff, please check back later',
             'chat_error_prefix': 'Sorry, an error occurred: ',
             'chat_error_suffix': '. Please try again later.',
@@ -781,6 +1498,7 @@
             'chat_source_unknown': 'Unknown document',
             'chat_source_image': '📷 Image source',
             'chat_source_download': 'Click to download document',
+            'chat_source_open_page': 'Open the cited section of the web page',
             'chat_media_seek_hint': 'Click to seek to this time',
             'chat_play_audio': 'Play audio',
             'chat_play_video': 'Play video',
@@ -790,7 +1508,22 @@
             'chat_not_satisfied_confirm_no': 'Cancel',
             'chat_not_satisfied_success': 'Your question has been forwarded to support staff. We will get back to you soon.',
             'chat_not_satisfied_fail': 'Operation failed. Please try again later.',
+            'chat_correction_btn': 'Suggest a correction',
+            'chat_correction_title': 'Point out what is wrong in this answer',
+            'chat_correction_sentence': 'Incorrect sentence',
+            'chat_correction_sentence_placeholder': 'Select the sentence in the answer before clicking, or paste it here',
+            'chat_correction_sentence_required': 'Please enter the incorrect sentence',
+            'chat_correction_suggestion': 'Correct information (optional)',
+            'chat_correction_suggestion_placeholder': 'If you know what is correct, describe it here',
+            'chat_correction_source': 'Related source',
+            'chat_correction_source_unknown': 'Not sure',
+            'chat_correction_submit': 'Submit',
+            'chat_correction_success': 'Thanks! An admin will review it and update the knowledge base.',
+            'chat_correction_failed': 'Submission failed. Please try again later.',
             'session_expired': 'Session expired. Please log in again.',
+            'session_expiring': 'You have been inactive; your session expires in {minutes} min',
+            'session_expiring_max': 'Maximum sign-in time reached; you will be signed out in {minutes} min. Save your work',
+            'session_extend_btn': 'Stay signed in',
 
             // Admin panel - sidebar
             'admin_panel_title': 'Admin Panel',
@@ -833,8 +1566,10 @@
             // Admin - documents
             'admin_doc_title': 'Document Management',
             'admin_doc_drop_text': 'Drag files here, or click to select',
-            'admin_doc_drop_hint': 'Supports PDF, Word, Excel, PPT, Markdown, Video',
-            'admin_doc_url_placeholder': 'Enter document URL',
+            'admin_doc_drop_hint': 'Supports PDF, Word, Excel, PPT, Markdown, TXT, CSV, Video',
+            'admin_doc_url_placeholder': 'Enter document or video URL',
+            'admin_doc_call_recording': 'Import as call recording: extract customer questions and agent answers as knowledge entries pending review (MP3, WAV, M4A and video)',
+            'admin_doc_call_candidates': '{n} candidate Q&A entries were extracted from this call; handle them in Content Review',
             'admin_doc_url_submit': 'Submit URL',
             'admin_doc_url_preview': 'Preview Content',
             'admin_doc_url_preview_hint': 'Below is the content fetched from the URL. Confirm and submit:',
@@ -843,6 +1578,24 @@
             'admin_doc_url_fetching': 'Fetching URL content...',
             'admin_doc_url_fetched': 'Content fetched, please review and submit',
             'admin_doc_url_fetch_failed': 'Failed to fetch URL content',
+            'admin_doc_crawl_title': 'Crawl site: import the pages linked from the URL above on the same site',
+            'admin_doc_crawl_depth': 'Depth',
+            'admin_doc_crawl_max_pages': 'Max pages',
+            'admin_doc_crawl_delay': 'Delay between requests (ms)',
+            'admin_doc_crawl_include': 'Only import paths',
+            'admin_doc_crawl_exclude': 'Exclude paths',
+            'admin_doc_crawl_hint': 'Comma-separated patterns matched against the URL path (without the leading /); * and ** are supported. Excluded pages are not visited; with "Only import paths" set, other pages are only used to discover links. The site\'s robots.txt is honored.',
+            'admin_doc_crawl_start': 'Start crawl',
+            'admin_doc_crawl_running': 'Crawling...',
+            'admin_doc_crawl_url_required': 'Enter the start URL above first',
+            'admin_doc_crawl_progress': '{fetched} pages fetched, {queued} queued',
+            'admin_doc_crawl_done': 'Crawl finished: {fetched} pages visited, {imported} imported, {duplicates} duplicates, {skipped} skipped, {failed} failed',
+            'admin_doc_crawl_canceled': 'Crawl canceled',
+            'admin_doc_crawl_failed': 'Site crawl failed',
+            'admin_doc_crawl_status_imported': 'imported',
+            'admin_doc_crawl_status_duplicate': 'duplicate',
+            'admin_doc_crawl_status_skipped': 'skipped',
+            'admin_doc_crawl_status_failed': 'failed',
             'admin_doc_list_title': 'Document List',
             'admin_doc_th_name': 'Document Name',
             'admin_doc_th_type': 'File Type',
@@ -856,8 +1609,170 @@
             'admin_doc_status_processing': 'Processing',
             'admin_doc_status_success': 'Success',
             'admin_doc_status_failed': 'Failed',
+            'admin_doc_status_quarantined': 'Quarantined',
+            'admin_doc_eta_minutes': '~{n} min left',
+            'admin_doc_eta_soon': 'almost done',
+            'admin_doc_queue_position': '#{n} in queue',
             'admin_doc_delete_btn': 'Delete',
             'admin_doc_review_btn': 'Review',
+            'admin_doc_chunks_btn': 'Chunks',
+            'admin_doc_chunks_title': 'Document Chunks',
+            'admin_doc_chunks_hint': 'Fix misrecognized text or delete boilerplate that pollutes retrieval; edited chunks are re-embedded automatically. Image chunks cannot be edited.',
+            'admin_doc_chunks_filter': 'Filter chunk text',
+            'admin_doc_chunks_empty': 'No matching chunks',
+            'admin_doc_chunks_load_failed': 'Failed to load document chunks',
+            'admin_doc_chunks_translation': 'Translation of #{n}',
+            'admin_doc_chunks_image': 'Image',
+            'admin_doc_chunks_edit': 'Edit',
+            'admin_doc_chunks_text_empty': 'Chunk text cannot be empty',
+            'admin_doc_chunks_saved': 'Chunk saved and re-embedded',
+            'admin_doc_chunks_save_failed': 'Failed to save chunk',
+            'admin_doc_chunks_delete_confirm': 'Delete chunk #{n}? Its content will no longer be retrieved.',
+            'admin_doc_chunks_deleted': 'Chunk deleted',
+            'admin_doc_chunks_delete_failed': 'Failed to delete chunk',
+            'admin_doc_versions_btn': 'Versions',
+            'admin_doc_versions_title': 'Document versions',
+            'admin_doc_versions_hint': 'A new version keeps the document ID, citation stats and effective period; answers use the current version until the new one is processed.',
+            'admin_doc_versions_file': 'New version file',
+            'admin_doc_versions_note': 'Version note (optional)',
+            'admin_doc_versions_upload': 'Upload new version',
+            'admin_doc_versions_loading': 'Loading...',
+            'admin_doc_versions_empty': 'Never replaced; the current file is version 1.',
+            'admin_doc_versions_load_failed': 'Failed to load document versions',
+            'admin_doc_versions_current': 'Current',
+            'admin_doc_versions_status_success': 'Previous',
+            'admin_doc_versions_status_processing': 'Processing',
+            'admin_doc_versions_status_failed': 'Failed',
+            'admin_doc_versions_restore': 'Restore',
+            'admin_doc_versions_restore_confirm': 'Restore version {n}? Its file becomes a new version.',
+            'admin_doc_versions_no_file': 'Please choose the new version file',
+            'admin_doc_versions_processing': 'New version uploaded and processing in the background',
+            'admin_doc_versions_replaced': 'Document updated to the new version',
+            'admin_doc_versions_failed': 'Failed to process the new version',
+            'admin_doc_effective_btn': 'Validity',
+            'admin_doc_effective_title': 'Effective period',
+            'admin_doc_effective_hint': 'Outside this period the document no longer appears in user answers; admins can still search it. Leave empty for no limit.',
+            'admin_doc_effective_from': 'Effective from',
+            'admin_doc_effective_until': 'Effective until',
+            'admin_doc_effective_save': 'Save',
+            'admin_doc_effective_saved': 'Effective period updated',
+            'admin_doc_effective_failed': 'Failed to update effective period',
+            'admin_doc_effective_period': 'Effective {from} – {until}',
+            'admin_doc_effective_inactive': 'not in effect',
+            'admin_schedule_btn': 'Schedule',
+            'admin_schedule_title': 'Publish schedule',
+            'admin_schedule_label': 'Publish schedule (optional)',
+            'admin_schedule_hint': 'Before the publish time and after the unpublish time the entry is left out of user answers and the documentation portal; the admin who set the schedule is told through the team notification channels when it fires. Leave empty for no limit.',
+            'admin_schedule_publish_at': 'Publish at',
+            'admin_schedule_unpublish_at': 'Unpublish at',
+            'admin_schedule_saved': 'Publish schedule updated',
+            'admin_schedule_failed': 'Failed to update publish schedule',
+            'admin_schedule_period': 'Scheduled {from} ~ {until}',
+            'admin_schedule_state_scheduled': 'Scheduled',
+            'admin_schedule_state_published': 'Published',
+            'admin_schedule_state_unpublished': 'Unpublished',
+            'admin_doc_url_estimate': 'Import estimate: {chunks} chunks, ~{tokens} embedding tokens, est. cost {cost}',
+            'admin_doc_url_duplicate': 'This content duplicates an existing document (ID: {id}) and will be rejected',
+            'admin_settings_llm_price': 'Price (per million tokens)',
+            'admin_settings_emb_price': 'Price (per million tokens)',
+            'admin_settings_price_hint': 'Only used to estimate import costs; 0 = not counted',
+            'admin_nav_review': 'Review',
+            'admin_nav_corrections': 'Corrections',
+            'admin_review_title': 'Content Review',
+            'admin_review_hint': 'With review before publishing enabled, new knowledge entries and answers are saved as drafts and are only used in answers after another admin approves them.',
+            'admin_review_filter_all': 'All unpublished',
+            'admin_review_status_draft': 'Draft',
+            'admin_review_status_in_review': 'In review',
+            'admin_review_assigned_me': 'Assigned to me',
+            'admin_review_select_all': 'Select all',
+            'admin_review_pick_reviewer': 'Choose a reviewer',
+            'admin_review_submit_btn': 'Submit for review',
+            'admin_review_note_placeholder': 'Review note (optional)',
+            'admin_review_approve_btn': 'Approve & publish',
+            'admin_review_reject_btn': 'Reject',
+            'admin_review_empty': 'Nothing awaiting review',
+            'admin_corrections_title': 'Correction Suggestions',
+            'admin_corrections_hint': 'Users can flag an incorrect sentence of an answer and suggest the correct information. When accepting, edit the cited chunk directly or add a knowledge entry.',
+            'admin_corrections_empty': 'No correction suggestions',
+            'admin_corrections_filter_all': 'All',
+            'admin_corrections_status_pending': 'Pending',
+            'admin_corrections_status_accepted': 'Accepted',
+            'admin_corrections_status_rejected': 'Rejected',
+            'admin_corrections_load_failed': 'Failed to load correction suggestions',
+            'admin_corrections_source': 'Source',
+            'admin_corrections_question': 'Question',
+            'admin_corrections_sentence': 'Incorrect sentence',
+            'admin_corrections_suggestion': 'Suggestion',
+            'admin_corrections_handle_btn': 'Handle',
+            'admin_corrections_apply_as': 'Apply as',
+            'admin_corrections_applied_chunk': 'Edit cited chunk',
+            'admin_corrections_applied_knowledge': 'Add knowledge entry',
+            'admin_corrections_apply_none': 'Mark as accepted only',
+            'admin_corrections_entry_title': 'Knowledge entry title',
+            'admin_corrections_text': 'Content',
+            'admin_corrections_note_placeholder': 'Note (optional)',
+            'admin_corrections_accept_btn': 'Accept',
+            'admin_corrections_reject_btn': 'Reject',
+            'admin_corrections_accepted': 'Suggestion accepted',
+            'admin_corrections_rejected': 'Suggestion rejected',
+            'admin_corrections_action_failed': 'Failed to handle the suggestion',
+            'admin_review_load_failed': 'Failed to load review queue',
+            'admin_review_author': 'Author',
+            'admin_review_reviewer': 'Reviewer',
+            'admin_review_note_label': 'Review note',
+            'admin_review_view_btn': 'View full text',
+            'admin_review_select_first': 'Select entries first',
+            'admin_review_action_failed': 'Review action failed',
+            'admin_review_done': '{n} entries processed',
+            'admin_review_partial': '{ok} succeeded, {failed} failed:',
+            'admin_review_saved_draft': 'Saved as draft; it goes live once approved',
+            'admin_settings_review_required': 'Review before publishing',
+            'admin_settings_review_off': 'Off (entries go live immediately)',
+            'admin_settings_review_on': 'On (entries go live after approval)',
+            'admin_settings_review_hint': 'New knowledge entries and answers start as drafts that must be submitted under Review and approved by another admin before they are used in answers',
+            'admin_settings_tagging_enabled': 'Auto tagging',
+            'admin_settings_tagging_off': 'Off',
+            'admin_settings_tagging_on': 'On',
+            'admin_settings_tagging_hint': 'After import, the LLM identifies the document type (manual, FAQ, release note...), topic tags and mentioned products for document filters and scoped retrieval. Costs one LLM call per document',
+            'admin_settings_audit_enabled': 'Answer audit',
+            'admin_settings_audit_on': 'On',
+            'admin_settings_audit_off': 'Off',
+            'admin_settings_audit_hint': 'Keeps an immutable record of every answer (final prompt, retrieved chunks and scores, model parameters and answer), retrievable by request ID via /api/admin/audits for resolving disputes',
+            'admin_settings_audit_retention': 'Audit retention (days)',
+            'admin_settings_audit_retention_hint': 'Audit records older than this are deleted automatically; 0 keeps them forever',
+            'admin_settings_portal_enabled': 'Documentation Portal',
+            'admin_settings_portal_off': 'Off',
+            'admin_settings_portal_on': 'On (browsable without login)',
+            'admin_settings_portal_hint': 'When on, published and currently effective knowledge entries and Markdown documents can be browsed and searched by product through the /api/portal endpoints',
+            'admin_settings_html_main_content': 'Web Page Main Content',
+            'admin_settings_html_main_content_on': 'On (strip navigation, banners and footers)',
+            'admin_settings_html_main_content_off': 'Off (index the whole page)',
+            'admin_settings_html_main_content_hint': 'URL imports and HTML files keep only the main content of the page, so navigation bars, cookie notices and footers stay out of chunks',
+            'admin_settings_html_selectors': 'Site Content Selectors',
+            'admin_settings_html_selectors_hint': 'One "host=CSS selector" per line to pick the content area of sites that are detected poorly; a host also matches its subdomains',
+            'admin_doc_sort_label': 'Sort by',
+            'admin_doc_sort_newest': 'Newest',
+            'admin_doc_sort_cited': 'Most cited',
+            'admin_doc_sort_clicked': 'Most clicked',
+            'admin_doc_sort_least_cited': 'Least cited',
+            'admin_doc_category_label': 'Type',
+            'admin_doc_category_all': 'All',
+            'admin_doc_category_manual': 'Manual',
+            'admin_doc_category_faq': 'FAQ',
+            'admin_doc_category_release_note': 'Release note',
+            'admin_doc_category_troubleshooting': 'Troubleshooting',
+            'admin_doc_category_other': 'Other',
+            'admin_doc_tag_label': 'Tag',
+            'admin_doc_tag_all': 'All',
+            'admin_doc_tags_failed': 'Failed to load document tags',
+            'admin_doc_retag_btn': 'Retag',
+            'admin_doc_retag_success': 'Tags updated',
+            'admin_doc_retag_failed': 'Tagging failed',
+            'admin_doc_usage': 'Cited {cited} times · clicked {clicked} times',
+            'admin_doc_last_cited': 'last cited {time}',
+            'admin_doc_citations_btn': 'Per-chunk stats',
+            'admin_doc_citations_failed': 'Failed to load citation stats',
+            'admin_doc_citation_chunk': 'Chunk {n}: cited {cited}, clicked {clicked}',
             'admin_doc_review_title': 'Document Analysis Review',
             'admin_doc_review_loading': 'Loading analysis results...',
             'admin_doc_review_load_failed': 'Failed to load analysis results',
@@ -894,14 +1809,34 @@
             'admin_pending_filter_all': 'All',
             'admin_pending_filter_pending': 'Pending',
             'admin_pending_filter_answered': 'Answered',
+            'admin_pending_import_btn': 'Import answers',
+            'admin_pending_import_hint': 'CSV or JSON with question_id and answer columns',
+            'admin_pending_import_started': 'Importing {count} answers...',
+            'admin_pending_import_progress': 'Importing {progress}%: {answered} answered, {skipped} skipped, {failed} failed',
+            'admin_pending_import_done': 'Import finished: {answered} answered, {skipped} skipped, {failed} failed',
+            'admin_pending_import_row': 'Row {row} ({id}): {error}',
+            'admin_pending_import_failed': 'Failed to import answers',
             'admin_pending_empty': 'No questions',
             'admin_pending_user': 'User',
+            'admin_pending_origin_auto': 'Auto',
+            'admin_pending_origin_auto_hint': 'The knowledge base could not answer this question, so it was routed here automatically',
+            'admin_pending_missing': 'Missing information',
+            'admin_pending_context': 'Retrieved context ({n}, not enough to answer)',
             'admin_pending_answer_prefix': 'Answer',
             'admin_pending_answer_btn': 'Answer',
             'admin_pending_edit_btn': 'Edit',
             'admin_pending_delete_btn': 'Delete',
             'admin_pending_delete_confirm': 'Are you sure you want to delete this question?',
             'admin_pending_deleted': 'Deleted',
+            'admin_pending_ticket': 'Ticket',
+            'admin_pending_ticket_link_btn': 'Link ticket',
+            'admin_pending_ticket_unlink_btn': 'Unlink',
+            'admin_pending_ticket_prompt': 'Enter the external ticket ID',
+            'admin_pending_ticket_saved': 'Ticket link updated',
+            'admin_pending_ticket_failed': 'Failed to update ticket link',
+            'admin_pending_ticket_filter_all': 'All tickets',
+            'admin_pending_ticket_filter_linked': 'Linked to a ticket',
+            'admin_pending_ticket_filter_unlinked': 'No ticket',
 
             // Admin - answer dialog
             'admin_answer_title': 'Answer Question',
@@ -931,6 +1866,10 @@
             'admin_settings_api_key': 'API Key',
             'admin_settings_temperature': 'Temperature',
             'admin_settings_max_tokens': 'Max Tokens',
+            'admin_settings_llm_max_concurrency': 'Max concurrent generations',
+            'admin_settings_llm_max_queue': 'Max queued requests',
+            'admin_settings_llm_max_queued_per_user': 'Max queued per user',
+            'admin_settings_llm_queue_timeout': 'Queue timeout (s)',
             'admin_settings_embedding': 'Embedding Configuration',
             'admin_settings_emb_endpoint': 'Embedding Endpoint',
             'admin_settings_emb_model': 'Embedding Model',
@@ -940,7 +1879,65 @@
             'admin_settings_emb_multimodal_hint': 'Enable for Doubao vision embedding model',
             'admin_settings_get_api_key': 'Get API Key',
             'admin_settings_test_llm': 'Test LLM Connection',
+            'admin_settings_llm_provider': 'LLM protocol',
+            'admin_settings_llm_provider_openai': 'OpenAI-compatible API',
+            'admin_settings_llm_provider_ollama': 'Ollama (local models)',
+            'admin_settings_llm_provider_hint': 'Ollama uses its native API: enter the server address as the endpoint (e.g. http://localhost:11434), no API key is needed, suited to air-gapped deployments. OCR requires a vision model (e.g. qwen2.5vl, llava)',
+            'admin_llm_profiles_title': 'LLM Fallback Profiles & Task Routing',
+            'admin_llm_profiles_hint': 'When a call times out or fails with a network error or server 5xx, the next profile by priority is tried (lower first; the main profile is 0). Profiles that failed in the last 30 seconds are tried last',
+            'admin_llm_profiles_col_name': 'Name',
+            'admin_llm_profiles_col_model': 'Model',
+            'admin_llm_profiles_col_endpoint': 'Endpoint',
+            'admin_llm_profiles_col_priority': 'Priority',
+            'admin_llm_profiles_col_actions': 'Actions',
+            'admin_llm_profiles_main': 'main',
+            'admin_llm_profiles_edit': 'Add or Edit Profile',
+            'admin_llm_profiles_name_placeholder': 'Name, e.g. backup',
+            'admin_llm_profiles_model_placeholder': 'Model name',
+            'admin_llm_profiles_timeout': 'Timeout (s)',
+            'admin_llm_profiles_disabled': 'Disabled',
+            'admin_llm_profiles_save': 'Save Profile',
+            'admin_llm_profiles_form_hint': 'A profile with the same name is replaced; Max Tokens 0 falls back to the main profile; leave the API key empty when editing to keep the saved one',
+            'admin_llm_profiles_test': 'Test',
+            'admin_llm_profiles_test_ok': '{name} is reachable, took {ms} ms',
+            'admin_llm_profiles_edit_btn': 'Edit',
+            'admin_llm_profiles_delete': 'Delete',
+            'admin_llm_profiles_delete_confirm': 'Delete LLM profile {name}? Tasks routed to it will pick profiles by priority.',
+            'admin_llm_profiles_deleted': 'LLM profile deleted',
+            'admin_llm_profiles_delete_failed': 'Failed to delete LLM profile',
+            'admin_llm_profiles_saved': 'LLM profile saved',
+            'admin_llm_profiles_save_failed': 'Failed to save LLM profile',
+            'admin_llm_profiles_load_failed': 'Failed to load LLM profiles',
+            'admin_llm_routes_title': 'Task Routing',
+            'admin_llm_task_answer': 'Answers',
+            'admin_llm_task_intent': 'Intent classification',
+            'admin_llm_task_vision': 'Image recognition (OCR)',
+            'admin_llm_routes_by_priority': 'By priority',
+            'admin_llm_routes_save': 'Save Routes',
+            'admin_llm_routes_hint': 'A task tries the selected profile first and fails over to the others by priority. Image recognition covers OCR of scans, video keyframes and questions with images, so pick a vision model; an intent model set on a product takes precedence',
+            'admin_llm_routes_saved': 'Task routes saved',
+            'admin_llm_routes_save_failed': 'Failed to save task routes',
             'admin_settings_test_embedding': 'Test Embedding Connection',
+            'admin_settings_reindex': 'Re-embed documents with these settings',
+            'admin_settings_reindex_cancel': 'Cancel re-embedding',
+            'admin_settings_reindex_hint': 'Vectors from a previous embedding model are incompatible with a new one. Re-embedding recomputes the vectors of all documents in the background with the settings above; search keeps using the old vectors until it completes, then the model settings are switched and saved',
+            'admin_settings_reindex_confirm': 'Recompute the vectors of all documents with model {model}? This calls the embedding API for every chunk.',
+            'admin_settings_reindex_embedding': 'Re-embedding with {model}: {done}/{total} documents, {failed} failed',
+            'admin_settings_reindex_swapping': 'Switching to the new {model} vectors: {done}/{total}',
+            'admin_settings_reindex_done': 'Switched to {model}, {total} documents',
+            'admin_settings_reindex_canceled': 'Canceled after {done}/{total} documents; starting again resumes from there',
+            'admin_settings_reindex_failed': 'Re-embedding failed',
+            'admin_settings_rerank': 'Rerank',
+            'admin_settings_rerank_enabled': 'Enable reranking',
+            'admin_settings_rerank_off': 'Off',
+            'admin_settings_rerank_on': 'On',
+            'admin_settings_rerank_hint': 'Re-score retrieved chunks with a rerank model and answer from the most relevant top-K; the vector order is kept if the API fails',
+            'admin_settings_rerank_endpoint': 'Rerank Endpoint',
+            'admin_settings_rerank_model': 'Rerank Model',
+            'admin_settings_rerank_top_n': 'Candidates',
+            'admin_settings_rerank_top_n_hint': 'Vector hits sent for reranking; 0 uses the default (20)',
+            'admin_settings_test_rerank': 'Test Rerank Connection',
+            'admin_settings_rerank_test_misranked': 'Connected, but the sample passages were ranked wrongly; check that the model is a rerank model',
             'admin_settings_test_testing': 'Testing...',
             'admin_settings_test_success': 'Connection successful',
             'admin_settings_test_failed': 'Connection failed',
@@ -951,17 +1948,33 @@
             'admin_settings_topk': 'Top-K',
             'admin_settings_threshold': 'Similarity Threshold',
             'admin_settings_content_priority': 'Content Priority',
+            'admin_settings_verify_mode': 'Answer Verification',
+            'admin_settings_verify_off': 'Off',
+            'admin_settings_verify_flag': 'Flag unsupported sentences',
+            'admin_settings_verify_remove': 'Remove unsupported sentences',
+            'admin_settings_verify_hint': 'After generating an answer, a second LLM call checks each sentence against the sources and records a faithfulness score (adds LLM cost)',
             'admin_settings_priority_image': 'Prefer image+text (prioritize results with images)',
             'admin_settings_priority_text': 'Prefer text only (prioritize plain text results)',
             'admin_settings_priority_hint': 'Set whether to prioritize image+text or plain text in answers',
+            'admin_settings_language_filter': 'Retrieval Language Filter',
+            'admin_settings_language_filter_off': 'Off (ignore language)',
+            'admin_settings_language_filter_prefer': 'Prefer (sources in the question language first)',
+            'admin_settings_language_filter_strict': 'Strict (only sources in the question language)',
+            'admin_settings_language_filter_hint': 'Filters search results by the document language detected at import, so sources in another language do not crowd out those matching the question in mixed-language knowledge bases. In strict mode sources in other languages are still used when none matches',
+            'admin_doc_language': 'Document language (detected at import)',
             'admin_settings_text_match': '3-Level Text Matching',
             'admin_settings_text_match_on': 'On (prefer text matching, save API costs)',
             'admin_settings_text_match_off': 'Off (always use full RAG pipeline)',
             'admin_settings_text_match_hint': 'When enabled, queries go through 3 levels: L1 text match (free) → L2 vector confirm + cached answer (embedding only) → L3 full RAG (embedding + LLM)',
             'admin_settings_debug_mode': 'Debug Mode',
             'admin_settings_debug_off': 'Off',
-            'admin_settings_debug_on': 'On (query results include diagnostics)',
-            'admin_settings_debug_hint': 'When enabled, chat replies show detailed 3-level search process for troubleshooting',
+            'admin_settings_debug_on': 'On (admin query results include diagnostics)',
+            'admin_settings_debug_hint': 'When enabled, chat replies to admins show the detailed 3-level search process by default for troubleshooting; regular users never see diagnostics',
+            'admin_settings_debug_token': 'Debug Link',
+            'admin_settings_debug_token_issue': 'Create 1-hour debug link',
+            'admin_settings_debug_token_hint': 'Questions asked from this link with a regular user account include search diagnostics; it only applies to that browser tab and stops working when it expires',
+            'admin_settings_debug_token_issued': 'Debug link created, valid until {time}',
+            'admin_settings_debug_token_failed': 'Failed to create debug link',
             'admin_settings_smtp': 'Email Server (SMTP)',
             'admin_settings_smtp_host': 'SMTP Server',
             'admin_settings_smtp_port': 'Port',
@@ -984,13 +1997,94 @@
             'admin_settings_smtp_test_sending': 'Sending...',
             'admin_settings_smtp_test_success': 'Test email sent, please check inbox',
             'admin_settings_smtp_test_failed': 'Send failed',
+            'admin_settings_email_ingest': 'Email Ingestion',
+            'admin_settings_email_ingest_hint': 'Point the inbound webhook of your mail provider to /api/inbound-email?token=TOKEN. Emails sent or forwarded to the designated mailbox become draft knowledge entries, published once approved in Content Review',
+            'admin_settings_email_ingest_enabled': 'Email Ingestion',
+            'admin_settings_email_ingest_off': 'Off',
+            'admin_settings_email_ingest_on': 'On',
+            'admin_settings_email_ingest_token': 'Webhook Token',
+            'admin_settings_email_ingest_token_hint': 'At least 16 characters; leave empty to keep the current token',
+            'admin_settings_email_ingest_recipients': 'Designated Mailboxes',
+            'admin_settings_email_ingest_recipients_hint': 'Comma-separated; only emails sent to these addresses are imported. Empty accepts all',
+            'admin_settings_email_ingest_senders': 'Allowed Senders',
+            'admin_settings_email_ingest_senders_hint': 'Comma-separated addresses or @domains. Empty accepts all',
+            'admin_settings_email_ingest_product': 'Product ID',
+            'admin_settings_email_ingest_product_placeholder': 'Empty for the public library',
+            'admin_settings_notify': 'Pending Question Notifications',
+            'admin_settings_notify_hint': 'Post a message to team chat when a question is added to the pending queue, with the question, the user and a link to answer it (requires the external base URL). Leave the webhook URL and signing secret empty to keep them unchanged',
+            'admin_settings_notify_slack': 'Slack',
+            'admin_settings_notify_lark': 'Lark',
+            'admin_settings_notify_dingtalk': 'DingTalk',
+            'admin_settings_notify_off': 'Off',
+            'admin_settings_notify_on': 'On',
+            'admin_settings_notify_webhook': 'Webhook URL',
+            'admin_settings_notify_secret': 'Signing Secret',
+            'admin_settings_notify_secret_hint': 'Required when the bot has signature verification enabled',
+            'admin_settings_notify_test_btn': 'Send Test Message',
+            'admin_settings_notify_test_sending': 'Sending...',
+            'admin_settings_notify_test_success': 'Test message sent',
+            'admin_settings_notify_test_failed': 'Failed to send test message',
             'admin_settings_admin': 'Admin Settings',
+            'admin_settings_external_base_url': 'External Base URL',
+            'admin_settings_external_base_url_hint': 'Set this when running behind a reverse proxy or under a path prefix. Used for email links, OAuth callbacks, ticket-login redirects and share links; leave empty to derive it from each request',
             'admin_settings_login_route': 'Admin Login Route',
             'admin_settings_login_route_hint': 'Access this hidden route to reach admin login page',
+            'admin_settings_password_policy': 'Password Policy',
+            'admin_settings_password_min_length': 'Minimum length',
+            'admin_settings_password_require': 'Must contain',
+            'admin_settings_password_class_letter': 'Letter',
+            'admin_settings_password_class_upper': 'Uppercase',
+            'admin_settings_password_class_lower': 'Lowercase',
+            'admin_settings_password_class_digit': 'Digit',
+            'admin_settings_password_class_symbol': 'Symbol',
+            'admin_settings_password_breach_list': 'Breached password list',
+            'admin_settings_password_breach_list_hint': 'SHA-1 leaked password list on the server, sorted by hash (Have I Been Pwned format); passwords found in it are rejected. Leave empty to skip the check',
+            'admin_settings_password_max_age': 'Password lifetime (days)',
+            'admin_settings_password_max_age_hint': 'Expired passwords must be reset via "Forgot password" by users; admins are asked to change theirs right after signing in. 0 means passwords never expire',
+            'admin_settings_session': 'Sign-in Sessions',
+            'admin_settings_session_idle': 'Idle timeout (minutes)',
+            'admin_settings_session_idle_hint': 'Users and admins must sign in again after this long without activity; every action restarts the timer',
+            'admin_settings_session_max': 'Maximum session length (hours)',
+            'admin_settings_session_max_hint': 'Sessions end after this long regardless of activity',
+            'admin_sidebar_change_password': 'Change Password',
+            'admin_sidebar_notify_prefs': 'My Notifications',
+            'admin_notify_prefs_title': 'My Notifications',
+            'admin_notify_prefs_hint': 'Choose the events you want to receive. You only get notifications for the products you manage. Team channels in the system settings are not affected.',
+            'admin_notify_prefs_events': 'Events',
+            'admin_notify_prefs_email': 'Email',
+            'admin_notify_prefs_channel': 'Personal Webhook Type',
+            'admin_notify_prefs_webhook': 'Personal Webhook URL',
+            'admin_notify_prefs_webhook_placeholder': 'Leave empty to use email only',
+            'admin_notify_prefs_secret': 'Signing Secret',
+            'admin_notify_prefs_saved': 'Notification preferences saved',
+            'admin_notify_prefs_save_failed': 'Failed to save notification preferences',
+            'admin_notify_prefs_load_failed': 'Failed to load notification preferences',
+            'admin_notify_event_pending': 'New pending questions',
+            'admin_notify_event_document_failed': 'Failed documents',
+            'admin_notify_event_security': 'Security events (quarantined files, locked accounts)',
+            'admin_notify_event_schedule': 'Scheduled publish or unpublish',
+            'admin_notify_event_budget': 'Model budget alerts',
+            'admin_notify_event_digest': 'Daily digest (at 9:00)',
+            'admin_password_expired': 'Your password has expired. Please change it now.',
+            'admin_password_current': 'Enter your current password',
+            'admin_password_new': 'Enter a new password',
+            'admin_password_confirm': 'Enter the new password again',
+            'admin_password_mismatch': 'The new passwords do not match',
+            'admin_password_changed': 'Password changed',
+            'admin_password_change_failed': 'Failed to change password',
             'admin_settings_product_intro': 'Product Introduction',
             'admin_settings_product_intro_label': 'Welcome Message',
             'admin_settings_product_intro_placeholder': 'Enter product intro, shown as welcome message after login',
             'admin_settings_product_intro_hint': 'Displayed on chat page after user login',
+            'admin_settings_small_talk': 'Small Talk',
+            'admin_settings_small_talk_hint': 'Simple messages such as "thanks" or "ok" are answered from the phrase lists below without calling the LLM; greetings get the product intro',
+            'admin_settings_small_talk_enabled': 'Local Small Talk Replies',
+            'admin_settings_small_talk_on': 'On',
+            'admin_settings_small_talk_off': 'Off (use intent classification)',
+            'admin_settings_small_talk_interval': 'Intro Interval (minutes)',
+            'admin_settings_small_talk_interval_hint': 'A user greeting again within this time gets a short greeting instead of the product intro. Default 30 minutes',
+            'admin_settings_small_talk_rules': 'Phrase Lists',
+            'admin_settings_small_talk_rules_hint': 'One per line: language|kind|phrase1,phrase2|reply. Kind is greeting, thanks, ack or goodbye. A message matches when it equals a phrase, ignoring case, punctuation and spaces',
             'admin_settings_product_name': 'Product Name',
             'admin_settings_product_name_label': 'Product Name',
             'admin_settings_product_name_placeholder': 'Enter product name, e.g.: XX Self-Service System',
@@ -1012,6 +2106,19 @@
             'admin_settings_oauth_hint': 'Configure third-party OAuth login. Users will see login buttons for configured providers.',
             'admin_settings_oauth_add': 'Add OAuth Provider',
             'admin_settings_oauth_add_btn': 'Add',
+            'admin_settings_external_auth': 'External Account Login',
+            'admin_settings_external_auth_hint': 'Connects a custom single sign-on that is not OAuth: users enter an account and password on the login page, which are POSTed to the verify URL as {"credentials": {"username", "password"}}. It should answer 200 with {"id", "email", "name"} for valid credentials, or 401 or 403 for invalid ones',
+            'admin_settings_external_auth_enabled': 'Enabled',
+            'admin_settings_external_auth_off': 'Off',
+            'admin_settings_external_auth_on': 'On',
+            'admin_settings_external_auth_label': 'Button text',
+            'admin_settings_external_auth_label_placeholder': 'Company account',
+            'admin_settings_external_auth_name': 'Identifier',
+            'admin_settings_external_auth_name_hint': 'User IDs are "<identifier>_<id returned by the verifier>"; do not change it once in use or users will be treated as new users',
+            'admin_settings_external_auth_url': 'Verify URL',
+            'admin_settings_external_auth_secret': 'Access secret',
+            'admin_settings_external_auth_secret_hint': 'Sent as the header Authorization: Bearer <secret> when set',
+            'admin_settings_external_auth_timeout': 'Timeout (seconds)',
             'admin_settings_oauth_empty': 'No OAuth providers configured',
             'admin_settings_oauth_status_ok': 'Configured',
             'admin_settings_oauth_status_incomplete': 'Incomplete',
@@ -1058,6 +2165,9 @@
             'login_divider_or': 'or',
             'login_oauth_with': 'Sign in with',
             'login_oauth_failed': 'OAuth login failed',
+            'external_login_default_label': 'company account',
+            'external_login_username': 'Account',
+            'external_login_error_empty': 'Please enter your account and password',
 
             // Admin - knowledge
             'admin_knowledge_title': 'Knowledge Entry',
@@ -1067,6 +2177,8 @@
             'admin_knowledge_title_placeholder': 'Knowledge entry title',
             'admin_knowledge_content_label': 'Content',
             'admin_knowledge_content_placeholder': 'Enter knowledge content (detailed description supported)',
+            'admin_knowledge_markdown_label': 'Markdown format',
+            'admin_knowledge_markdown_hint': 'Uploaded images are inserted at the cursor as ![caption](url) and stay linked to the surrounding text in search',
             'admin_knowledge_image_label': 'Images (optional)',
             'admin_knowledge_image_upload': 'Click to upload, drag images here, or paste from clipboard',
             'admin_knowledge_image_hint': 'Supports JPG, PNG, GIF, WebP, BMP formats',
@@ -1074,11 +2186,73 @@
             'admin_knowledge_video_upload': 'Click to upload, drag videos here, or paste from clipboard',
             'admin_knowledge_video_hint': 'Supports MP4, AVI, MKV, MOV, WebM formats',
             'admin_knowledge_submit': 'Submit Entry',
+            'admin_announcement_legend': 'Product Announcements',
+            'admin_announcement_hint': 'Announcements appear at the top of the chat while in effect and are indexed as documents, so users can ask what changed in a release.',
+            'admin_announcement_title_label': 'Title',
+            'admin_announcement_title_placeholder': 'e.g. Version 2.1 released',
+            'admin_announcement_version_label': 'Version (optional)',
+            'admin_announcement_content_label': 'Content',
+            'admin_announcement_content_placeholder': 'Main changes in this release',
+            'admin_announcement_publish': 'Publish',
+            'admin_announcement_save': 'Save Changes',
+            'admin_announcement_cancel': 'Cancel Edit',
+            'admin_announcement_edit': 'Edit',
+            'admin_announcement_th_title': 'Title',
+            'admin_announcement_th_period': 'Effective',
+            'admin_announcement_always': 'Always',
+            'admin_announcement_empty': 'No announcements',
+            'admin_announcement_empty_fields': 'Please enter a title and content',
+            'admin_announcement_saved': 'Announcement saved',
+            'admin_announcement_save_failed': 'Failed to save announcement',
+            'admin_announcement_delete_confirm': 'Delete announcement "{name}"? Its indexed content will also be removed.',
+            'admin_announcement_deleted': 'Announcement deleted',
+            'admin_template_btn': 'Answer templates',
+            'admin_template_legend': 'Answer Templates',
+            'admin_template_hint': 'Templates can be inserted while answering questions. {question} and {product_name} are filled in from the question; other {variables} (such as {download_url}) use the defaults below, and unfilled ones are kept for you to edit.',
+            'admin_template_name_label': 'Name',
+            'admin_template_name_placeholder': 'e.g. Download installer',
+            'admin_template_content_label': 'Content',
+            'admin_template_content_placeholder': 'Hi, the latest {product_name} installer can be downloaded from {download_url}.',
+            'admin_template_variables_label': 'Variable defaults (optional, one name=value per line)',
+            'admin_template_variables_invalid': 'Variable defaults must be name=value: {line}',
+            'admin_template_th_variables': 'Variables',
+            'admin_template_empty': 'No answer templates',
+            'admin_template_create': 'Add template',
+            'admin_template_save': 'Save changes',
+            'admin_template_cancel': 'Cancel edit',
+            'admin_template_edit': 'Edit',
+            'admin_template_empty_fields': 'Please enter a template name and content',
+            'admin_template_saved': 'Template saved',
+            'admin_template_save_failed': 'Failed to save template',
+            'admin_template_delete_confirm': 'Delete template "{name}"?',
+            'admin_template_deleted': 'Template deleted',
+            'admin_template_delete_failed': 'Failed to delete template',
+            'admin_answer_template_label': 'Use a template (optional)',
+            'admin_answer_template_none': 'No template',
+            'admin_answer_template_adapt': 'Adapt to question (AI)',
+            'admin_answer_template_insert': 'Insert',
+            'admin_answer_template_adapting': 'Adapting...',
+            'admin_answer_template_pick': 'Please select a template first',
+            'admin_answer_template_failed': 'Failed to insert template',
+            'admin_answer_template_missing': 'These variables are not filled in, please edit them in the answer: {names}',
+            'admin_announcement_delete_failed': 'Failed to delete announcement',
             'admin_knowledge_empty': 'Please enter title and content',
             'admin_knowledge_submitting': 'Submitting knowledge...',
             'admin_knowledge_submitting_btn': 'Submitting...',
             'admin_knowledge_success': 'Knowledge entry submitted',
             'admin_knowledge_failed': 'Submission failed',
+            'admin_knowledge_cancel_edit': 'Cancel edit',
+            'admin_knowledge_save_edit': 'Save changes',
+            'admin_knowledge_updated': 'Knowledge entry updated',
+            'admin_knowledge_list_legend': 'Knowledge Entries',
+            'admin_knowledge_list_hint': 'Filtered by the target product above. After an edit only the changed passages are embedded again.',
+            'admin_knowledge_list_empty': 'No knowledge entries',
+            'admin_knowledge_th_updated': 'Updated',
+            'admin_knowledge_edit': 'Edit',
+            'admin_knowledge_load_failed': 'Failed to load knowledge entry',
+            'admin_knowledge_delete_confirm': 'Delete knowledge entry "{name}"?',
+            'admin_knowledge_deleted': 'Knowledge entry deleted',
+            'admin_knowledge_delete_failed': 'Failed to delete knowledge entry',
 
             // Admin - users
             'admin_users_title': 'User Management',
@@ -1103,8 +2277,26 @@
             'admin_users_delete_btn': 'Delete',
             'admin_users_delete_confirm': 'Are you sure you want to delete user "{name}"?',
             'admin_users_deleted': 'User deleted',
+            'admin_apikeys_legend': 'API Keys',
+            'admin_apikeys_name': 'Name',
+            'admin_apikeys_name_placeholder': 'e.g. Portal backend',
+            'admin_apikeys_scopes': 'Scopes',
+            'admin_apikeys_scopes_hint': 'Send Authorization: ApiKey <key> with requests; a write scope includes the matching read scope',
+            'admin_apikeys_expires': 'Expires in (days)',
+            'admin_apikeys_expires_hint': '0 means the key never expires',
+            'admin_apikeys_create_btn': 'Create Key',
+            'admin_apikeys_th_prefix': 'Key',
+            'admin_apikeys_th_last_used': 'Last Used',
+            'admin_apikeys_th_expires': 'Expires',
+            'admin_apikeys_empty': 'No API keys',
+            'admin_apikeys_never': 'Never',
+            'admin_apikeys_revoke_btn': 'Revoke',
+            'admin_apikeys_revoke_confirm': 'Revoke API key "{name}"? Integrations using it will stop working immediately.',
+            'admin_apikeys_revoked': 'API key revoked',
+            'admin_apikeys_create_empty': 'Enter a name and select at least one scope',
+            'admin_apikeys_create_failed': 'Failed to create API key',
+            'admin_apikeys_created': 'API key created. Copy it now; it cannot be shown again:',
             'admin_users_create_empty': 'Please enter username and password',
-            'admin_users_create_password_short': 'Password must be at least 6 characters',
             'admin_users_created': 'User created successfully',
             'admin_users_create_failed': 'Creation failed',
             'admin_users_products': 'Assigned Products',
@@ -1166,8 +2358,30 @@
             'admin_products_welcome': 'Welcome Message',
             'admin_products_welcome_placeholder': 'Welcome message shown when user selects this product (optional)',
             'admin_products_allow_download': 'Allow document download',
+            'admin_products_isolated_storage': 'Isolated storage',
+            'admin_products_isolated_storage_hint': "Keep this product's knowledge chunks in a database file of its own. Cannot be changed after creation",
+            'admin_products_isolated_storage_badge': 'Isolated storage',
+            'admin_products_ticket_url': 'Ticket URL template',
+            'admin_products_ticket_url_placeholder': 'e.g. https://jira.example.com/browse/{ref} (optional)',
+            'admin_products_disclaimer': 'Answer disclaimer',
+            'admin_products_disclaimer_placeholder': 'Appended to every answer, e.g. "This is not legal advice; verify with the official documentation" (optional)',
+            'admin_products_disclaimer_translations': 'Disclaimer translations',
+            'admin_products_disclaimer_translations_placeholder': 'One language per line, e.g. zh: 以上内容不构成法律意见。(optional)',
+            'admin_products_disclaimer_translation_invalid': 'Disclaimer translations must be "language code: text"; line {line} is invalid',
             'admin_products_allow_download_hint': 'When enabled, users can download PDF/Word/Excel/PPT/Video source documents from chat',
             'admin_products_add_btn': 'Add Product',
+            'admin_products_csv_legend': 'Bulk Import/Export',
+            'admin_products_csv_hint': 'CSV columns: external_id, name, type, description, welcome_message, allow_download, explain_sources, allow_share, isolated_storage, ocr_language, ticket_url_template; only name is required. Rows match existing products by external_id or name, so importing a file again creates no duplicates',
+            'admin_products_import_btn': 'Import CSV',
+            'admin_products_export_btn': 'Export CSV',
+            'admin_products_export_failed': 'Failed to export products',
+            'admin_products_import_no_file': 'Choose a CSV file first',
+            'admin_products_import_failed': 'Failed to import products',
+            'admin_products_import_invalid': '{count} rows are invalid; no products were imported:',
+            'admin_products_import_row_error': 'Line {line} ({name}): {message}',
+            'admin_products_import_nothing': 'Nothing to import ({unchanged} products unchanged)',
+            'admin_products_import_confirm': 'Create {created} and update {updated} products ({unchanged} unchanged)?',
+            'admin_products_import_done': 'Import finished: {created} created, {updated} updated, {unchanged} unchanged',
             'admin_products_list_legend': 'Product List',
             'admin_products_th_name': 'Name',
             'admin_products_th_type': 'Type',
@@ -1185,6 +2399,17 @@
             'admin_products_edit_failed': 'Update failed',
             'admin_products_delete_confirm': 'Delete product "{name}"? Associated documents and knowledge will also be removed.',
             'admin_products_deleted': 'Product deleted',
+            'admin_products_status_all': 'All products',
+            'admin_products_status_active': 'Active',
+            'admin_products_status_archived': 'Archived',
+            'admin_products_archived_badge': 'Archived',
+            'admin_products_archived_suffix': ' (archived)',
+            'admin_products_archive_btn': 'Archive',
+            'admin_products_unarchive_btn': 'Unarchive',
+            'admin_products_archive_confirm': 'An archived product is hidden from users and takes no new documents or knowledge; its data is kept. Archive it?',
+            'admin_products_archived': 'Product archived',
+            'admin_products_unarchived': 'Product unarchived',
+            'admin_products_archive_failed': 'Failed to update archive state',
             'admin_products_name_required': 'Please enter a product name',
             'admin_products_created': 'Product created successfully',
             'admin_products_create_failed': 'Creation failed',
@@ -1248,6 +2473,12 @@
             'admin_multimodal_max_upload_hint': 'Maximum file size for video and document uploads, default 500MB',
             'admin_multimodal_processing_timeout': 'Processing Timeout (minutes)',
             'admin_multimodal_processing_timeout_hint': 'Maximum wait time for video and PDF background processing, default 120 minutes',
+            'admin_multimodal_ytdlp_path': 'yt-dlp Path',
+            'admin_multimodal_ytdlp_hint': 'Imports YouTube and Vimeo videos from their URL, using their captions instead of speech recognition when available; leave empty to support direct video file links only',
+            'admin_multimodal_url_max_duration': 'URL Video Duration Limit (minutes)',
+            'admin_multimodal_url_max_duration_hint': 'Maximum duration of videos imported from a URL; their size is bound by the upload size limit. Default 120 minutes',
+            'admin_multimodal_diarization_command': 'Speaker Diarization Program',
+            'admin_multimodal_diarization_command_hint': 'Optional; tells customer and agent apart in call recordings. Called with a WAV file path, it must print [{"start","end","speaker"}] JSON. Leave empty to transcribe without speakers',
             'admin_multimodal_supported': 'Supported Video Formats',
             'admin_multimodal_formats': 'MP4, AVI, MKV, MOV, WebM',
             'admin_multimodal_workflow': 'After uploading a video, the system will: 1) Extract audio and keyframes with FFmpeg → 2) Transcribe speech to text with RapidSpeech → 3) Generate vector embeddings for text and images → 4) Store in knowledge base for retrieval',
@@ -1278,6 +2509,159 @@
             'admin_logs_clear_confirm': 'Are you sure you want to clear all logs? This action cannot be undone.',
             'admin_logs_clear_failed': 'Failed to clear logs',
             'admin_logs_clear_done': 'Logs cleared',
+            'admin_maintenance_title': 'Database Maintenance',
+            'admin_maintenance_window': 'Maintenance window',
+            'admin_maintenance_enabled': 'Run nightly',
+            'admin_maintenance_disabled': 'Disabled',
+            'admin_maintenance_run': 'Run Now',
+            'admin_maintenance_hint': 'Once a night within the window: truncate the WAL, refresh ANALYZE statistics and run an incremental VACUUM',
+            'admin_maintenance_next_run': 'Next run',
+            'admin_maintenance_running': 'Maintenance in progress...',
+            'admin_maintenance_started': 'Database maintenance started',
+            'admin_maintenance_saved': 'Maintenance settings saved',
+            'admin_maintenance_failed': 'Database maintenance failed',
+            'admin_maintenance_load_failed': 'Failed to load maintenance runs',
+            'admin_maintenance_empty': 'No maintenance runs yet',
+            'admin_maintenance_col_time': 'Started',
+            'admin_maintenance_col_trigger': 'Trigger',
+            'admin_maintenance_col_duration': 'Duration',
+            'admin_maintenance_col_db': 'Database size',
+            'admin_maintenance_col_wal': 'WAL size',
+            'admin_maintenance_col_freed': 'Freed pages',
+            'admin_maintenance_col_result': 'Result',
+            'admin_maintenance_trigger_scheduled': 'Scheduled',
+            'admin_maintenance_trigger_manual': 'Manual',
+            'admin_maintenance_ok': 'OK',
+            'admin_maintenance_full_vacuum': 'OK (full VACUUM)',
+            'admin_export_title': 'Analytics Export',
+            'admin_export_schedule': 'Schedule',
+            'admin_export_enabled': 'Export periodically',
+            'admin_export_disabled': 'Disabled',
+            'admin_export_every': 'every',
+            'admin_export_hours': 'hours',
+            'admin_export_hint': 'Each run exports the query log (queries), ratings (feedback) and daily per-product usage metrics (usage) added since the last successful export, one file per dataset',
+            'admin_export_dir': 'Export directory',
+            'admin_export_s3': 'Upload to object storage',
+            'admin_export_s3_off': 'Off',
+            'admin_export_s3_on': 'Upload',
+            'admin_export_s3_hint': 'Uses the object storage connection and bucket from the backup settings; files are stored under this prefix',
+            'admin_export_webhook': 'Push webhook',
+            'admin_export_secret': 'Signing secret',
+            'admin_export_webhook_hint': 'Each file is POSTed with an X-Askflow-Dataset header; with a secret, X-Askflow-Signature: sha256=<HMAC> is added',
+            'admin_export_run': 'Export Now',
+            'admin_export_next_run': 'Next export',
+            'admin_export_running': 'Export in progress...',
+            'admin_export_started': 'Analytics export started',
+            'admin_export_saved': 'Export settings saved',
+            'admin_budget_title': 'Model Budget',
+            'admin_budget_limit': 'Monthly budget',
+            'admin_budget_block_optional': 'At the cap, pause non-essential calls such as translation, tagging and suggestions',
+            'admin_budget_degrade': 'At the cap, also answer from cached answers and keyword search only',
+            'admin_budget_hint': 'Spend is estimated from token counts and the per-million-token prices in the model settings; 0 means no cap. Admins are alerted through team notifications at 80% and 100%. Product budgets count the spend of that product\'s questions only',
+            'admin_budget_col_scope': 'Scope',
+            'admin_budget_col_spent': 'Spent this month',
+            'admin_budget_col_limit': 'Budget',
+            'admin_budget_col_percent': 'Share',
+            'admin_budget_empty': 'No usage yet',
+            'admin_budget_deployment': 'Whole deployment',
+            'admin_budget_unlimited': 'No cap',
+            'admin_budget_summary': '{month}: LLM about {llm} tokens, embedding about {embedding} tokens',
+            'admin_budget_load_failed': 'Failed to load budget usage',
+            'admin_budget_saved': 'Budget settings saved',
+            'admin_export_failed': 'Analytics export failed',
+            'admin_export_load_failed': 'Failed to load export runs',
+            'admin_export_empty': 'No exports yet',
+            'admin_export_col_period': 'Period',
+            'admin_export_col_rows': 'Records',
+            'admin_export_period_all': 'All history',
+            'admin_export_rows': 'queries {queries} / feedback {feedback} / usage {usage}',
+            'admin_backup_title': 'Online Backup',
+            'admin_backup_mode': 'Backup mode',
+            'admin_backup_mode_full': 'Full',
+            'admin_backup_mode_incremental': 'Incremental',
+            'admin_backup_save': 'Back up to server',
+            'admin_backup_download': 'Back up and download',
+            'admin_backup_hint': 'The service keeps running during a backup. Server backups are saved in data/backups and uploaded to the backup object storage when configured; incremental backups are based on the latest server backup',
+            'admin_backup_col_target': 'Target',
+            'admin_backup_col_size': 'Size',
+            'admin_backup_target_server': 'Server',
+            'admin_backup_target_download': 'Download',
+            'admin_backup_running': 'Backup in progress...',
+            'admin_backup_done': 'Backup finished',
+            'admin_backup_failed': 'Backup failed',
+            'admin_backup_load_failed': 'Failed to load backups',
+            'admin_backup_empty': 'No backups yet',
+            'admin_jobs_title': 'Background Jobs',
+            'admin_jobs_concurrency': 'Concurrent jobs',
+            'admin_jobs_refresh': 'Refresh',
+            'admin_jobs_hint': 'Document processing (video, PDF, PPT), batch imports and vector reindexing run in the background; no more documents than the concurrent job count are processed at once',
+            'admin_jobs_summary': '{running} running, {queued} queued',
+            'admin_jobs_empty': 'No background jobs yet',
+            'admin_jobs_load_failed': 'Failed to load background jobs',
+            'admin_jobs_col_time': 'Created',
+            'admin_jobs_col_type': 'Type',
+            'admin_jobs_col_label': 'Name',
+            'admin_jobs_col_status': 'Status',
+            'admin_jobs_col_progress': 'Progress',
+            'admin_jobs_col_actions': 'Actions',
+            'admin_jobs_type_document': 'Document processing',
+            'admin_jobs_type_batch_import': 'Batch import',
+            'admin_jobs_type_reindex': 'Vector reindex',
+            'admin_jobs_type_crawl': 'Site crawl',
+            'admin_jobs_type_bulk_answer': 'Bulk answers',
+            'admin_replay_title': 'Query Replay',
+            'admin_replay_new_sample': 'New sample',
+            'admin_replay_name_placeholder': 'Sample name',
+            'admin_replay_create': 'Draw sample',
+            'admin_replay_hint': 'Draws random questions from the query log, answers them again with the current model and retrieval settings, and compares the answers with the original ones or the previous replay. Replays create no pending questions and fire no intent webhooks, but count toward the model budget',
+            'admin_replay_all_products': 'All products',
+            'admin_replay_col_time': 'Created',
+            'admin_replay_col_name': 'Sample name',
+            'admin_replay_col_product': 'Product',
+            'admin_replay_col_size': 'Questions',
+            'admin_replay_col_actions': 'Actions',
+            'admin_replay_col_settings': 'Model settings',
+            'admin_replay_col_status': 'Status',
+            'admin_replay_col_question': 'Question',
+            'admin_replay_col_baseline_answer': 'Baseline answer',
+            'admin_replay_col_answer': 'Replayed answer',
+            'admin_replay_col_similarity': 'Similarity',
+            'admin_replay_col_sources': 'Source changes',
+            'admin_replay_empty': 'No replay samples',
+            'admin_replay_runs_empty': 'This sample has not been replayed yet',
+            'admin_replay_load_failed': 'Failed to load query replays',
+            'admin_replay_create_failed': 'Failed to draw sample',
+            'admin_replay_created': 'Drew {size} questions',
+            'admin_replay_delete': 'Delete',
+            'admin_replay_delete_confirm': 'Delete this sample and all of its replays?',
+            'admin_replay_delete_failed': 'Failed to delete sample',
+            'admin_replay_deleted': 'Replay sample deleted',
+            'admin_replay_run': 'Replay',
+            'admin_replay_run_confirm': 'All questions of the sample will be answered again with the current settings, and the model calls count toward the budget. Start?',
+            'admin_replay_run_failed': 'Failed to start replay',
+            'admin_replay_started': 'Replay queued as a background job',
+            'admin_replay_runs': 'Replays',
+            'admin_replay_progress': '{done} replayed',
+            'admin_replay_threshold': 'threshold',
+            'admin_replay_report': 'Report',
+            'admin_replay_baseline': 'Baseline',
+            'admin_replay_baseline_original': 'Original answers',
+            'admin_replay_show_all': 'Show unchanged questions',
+            'admin_replay_summary': 'Replayed {replayed}/{total}: {unchanged} unchanged, {answer} answers changed, {sources} sources changed, {pending} newly pending, {answered} newly answered, {failed} failed, average similarity {similarity}',
+            'admin_replay_pending': 'Sent to pending',
+            'admin_replay_no_changes': 'No changed questions',
+            'admin_jobs_type_replay': 'Query replay',
+            'admin_jobs_status_queued': 'Queued',
+            'admin_jobs_status_running': 'Running',
+            'admin_jobs_status_succeeded': 'Succeeded',
+            'admin_jobs_status_failed': 'Failed',
+            'admin_jobs_status_canceled': 'Canceled',
+            'admin_jobs_cancel': 'Cancel',
+            'admin_jobs_cancel_confirm': 'Cancel this job?',
+            'admin_jobs_canceled': 'Job canceled',
+            'admin_jobs_cancel_failed': 'Failed to cancel the job',
+            'admin_jobs_concurrency_invalid': 'Concurrent jobs must be between 1 and 16',
+            'admin_jobs_saved': 'Background job settings saved',
 
             // Batch import
             'batch_product_public': 'Public Library',
@@ -1287,10 +2671,28 @@
             'batch_preparing': 'Preparing...',
             'batch_import_failed': 'Batch import failed',
             'batch_start_text': '{total} files, starting import...',
+            'batch_filtered_text': '({n} excluded by filters)',
             'batch_done_text': 'Import complete',
             'batch_report_total': 'Total Files',
             'batch_report_success': 'Success',
             'batch_report_failed': 'Failed',
+            'batch_estimate_btn': 'Estimate',
+            'batch_estimating': 'Estimating...',
+            'batch_estimate_start_text': '{total} files, estimating (nothing will be written)...',
+            'batch_estimate_done_text': 'Estimate complete',
+            'batch_estimate_line': '{chunks} chunks, {embeddings} embeddings (~{tokens} tokens), est. cost {cost}',
+            'batch_estimate_ocr': ', OCR {pages} pages',
+            'batch_report_planned': 'To Import',
+            'batch_report_skipped': 'Skipped',
+            'batch_report_cost': 'Est. Cost',
+            'batch_report_estimate_summary': '{chunks} chunks, {embeddings} embeddings (~{tokens} tokens), {images} images, OCR {pages} pages, LLM ~{llm} tokens. Cost uses the per-million-token prices in Settings and excludes image embeddings.',
+            'batch_report_failed_title': 'Failed Files',
+            'batch_report_skipped_title': 'Skipped or Unimportable Files',
+            'batch_classify_btn': 'Auto-classify',
+            'batch_classifying': 'Classifying...',
+            'batch_classify_start_text': '{total} files, classifying by product...',
+            'batch_classify_done_text': 'Classification complete, please confirm each file\'s product',
+            'batch_classify_failed': 'Auto-classification failed',
 
             // Language
             'lang_switch': '中文'
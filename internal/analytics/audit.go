@@ -0,0 +1,149 @@
+package analytics
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AnswerAudit is the immutable record of how one query was answered: the
+// prompt sent to the model, the retrieved chunks and their scores, the model
+// and its parameters, and the answer given.
+type AnswerAudit struct {
+	RequestID   string          `json:"request_id"`
+	QueryID     string          `json:"query_id,omitempty"` // query log ID
+	UserID      string          `json:"user_id"`
+	ProductID   string          `json:"product_id"`
+	Question    string          `json:"question"`
+	Kind        string          `json:"kind"`             // generated, cached, canned or pending
+	Prompt      json.RawMessage `json:"prompt,omitempty"` // chat messages sent to the model
+	Chunks      json.RawMessage `json:"chunks"`           // retrieved chunk IDs and scores
+	Model       string          `json:"model"`
+	Endpoint    string          `json:"endpoint"`
+	Temperature float64         `json:"temperature"`
+	MaxTokens   int             `json:"max_tokens"`
+	Answer      string          `json:"answer"`
+	ModelOutput string          `json:"model_output,omitempty"` // model reply when it differs from the answer
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// AuditFilter selects answer audits to list. Zero fields do not filter.
+type AuditFilter struct {
+	UserID    string
+	ProductID string
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+// RecordAudit stores the audit record of an answer. Records cannot be
+// changed afterwards; they are only removed by PruneAudits.
+func (s *Service) RecordAudit(a *AnswerAudit) error {
+	prompt := ""
+	if len(a.Prompt) > 0 {
+		prompt = string(a.Prompt)
+	}
+	chunks := "[]"
+	if len(a.Chunks) > 0 {
+		chunks = string(a.Chunks)
+	}
+	_, err := s.writeDB.Exec(
+		`INSERT INTO answer_audits (request_id, query_id, user_id, product_id, question, kind, prompt, chunks, model, endpoint, temperature, max_tokens, answer, model_output, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.RequestID, a.QueryID, a.UserID, a.ProductID, a.Question, a.Kind, prompt, chunks, a.Model, a.Endpoint,
+		a.Temperature, a.MaxTokens, a.Answer, a.ModelOutput, time.Now().UTC().Format(sqliteTimeLayout),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record answer audit: %w", err)
+	}
+	return nil
+}
+
+const auditColumns = `request_id, query_id, user_id, product_id, question, kind, prompt, chunks, model, endpoint, temperature, max_tokens, answer, model_output, created_at`
+
+// GetAudit returns the audit record with a request ID or query log ID, or
+// nil if there is none.
+func (s *Service) GetAudit(id string) (*AnswerAudit, error) {
+	rows, err := s.readDB.Query(`SELECT `+auditColumns+` FROM answer_audits WHERE request_id = ? OR query_id = ? LIMIT 1`, id, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query answer audit: %w", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return scanAudit(rows, true)
+}
+
+// ListAudits returns the audit records matching f, newest first, without
+// their prompts.
+func (s *Service) ListAudits(f AuditFilter) ([]AnswerAudit, error) {
+	where := []string{"1=1"}
+	var args []interface{}
+	if f.UserID != "" {
+		where = append(where, "user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.ProductID != "" {
+		where = append(where, "product_id = ?")
+		args = append(args, f.ProductID)
+	}
+	if !f.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.From.UTC().Format(sqliteTimeLayout))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.To.UTC().Format(sqliteTimeLayout))
+	}
+	limit := f.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	args = append(args, limit)
+	rows, err := s.readDB.Query(`SELECT `+auditColumns+` FROM answer_audits WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY created_at DESC LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query answer audits: %w", err)
+	}
+	defer rows.Close()
+	audits := []AnswerAudit{}
+	for rows.Next() {
+		a, err := scanAudit(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		audits = append(audits, *a)
+	}
+	return audits, rows.Err()
+}
+
+func scanAudit(rows *sql.Rows, withPrompt bool) (*AnswerAudit, error) {
+	var a AnswerAudit
+	var prompt, chunks string
+	if err := rows.Scan(&a.RequestID, &a.QueryID, &a.UserID, &a.ProductID, &a.Question, &a.Kind, &prompt, &chunks,
+		&a.Model, &a.Endpoint, &a.Temperature, &a.MaxTokens, &a.Answer, &a.ModelOutput, &a.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to scan answer audit: %w", err)
+	}
+	if withPrompt && prompt != "" {
+		a.Prompt = json.RawMessage(prompt)
+	}
+	a.Chunks = json.RawMessage(chunks)
+	return &a, nil
+}
+
+// PruneAudits deletes audit records older than retentionDays and returns
+// how many were deleted. 0 keeps records forever.
+func (s *Service) PruneAudits(retentionDays int) (int64, error) {
+	if retentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -retentionDays).Format(sqliteTimeLayout)
+	result, err := s.writeDB.Exec(`DELETE FROM answer_audits WHERE created_at < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune answer audits: %w", err)
+	}
+	return result.RowsAffected()
+}
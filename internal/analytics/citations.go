@@ -0,0 +1,93 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Citation identifies a document chunk cited by an answer.
+type Citation struct {
+	DocumentID string `json:"document_id"`
+	ChunkIndex int    `json:"chunk_index"`
+}
+
+// RecordCitations counts one citation for each distinct chunk cited by an answer.
+func (s *Service) RecordCitations(cites []Citation) error {
+	if len(cites) == 0 {
+		return nil
+	}
+	now := time.Now().UTC().Format(sqliteTimeLayout)
+	tx, err := s.writeDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	seen := make(map[Citation]bool, len(cites))
+	for _, c := range cites {
+		if c.DocumentID == "" || seen[c] {
+			continue
+		}
+		seen[c] = true
+		if _, err := tx.Exec(
+			`INSERT INTO citation_stats (document_id, chunk_index, cited, last_cited_at) VALUES (?, ?, 1, ?)
+			 ON CONFLICT(document_id, chunk_index) DO UPDATE SET cited = cited + 1, last_cited_at = excluded.last_cited_at`,
+			c.DocumentID, c.ChunkIndex, now,
+		); err != nil {
+			return fmt.Errorf("failed to record citation: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// RecordCitationClick counts a user opening a citation of an answer. Only the
+// user who asked may report clicks, the chunk must be among the answer's
+// sources, and each citation of an answer counts at most once.
+func (s *Service) RecordCitationClick(queryID, userID string, c Citation) error {
+	var sources string
+	err := s.readDB.QueryRow("SELECT COALESCE(sources, '') FROM query_logs WHERE id = ? AND user_id = ?", queryID, userID).Scan(&sources)
+	if err != nil {
+		return fmt.Errorf("query not found")
+	}
+	var cited []Citation
+	if sources != "" {
+		if err := json.Unmarshal([]byte(sources), &cited); err != nil {
+			return fmt.Errorf("failed to decode sources: %w", err)
+		}
+	}
+	found := false
+	for _, src := range cited {
+		if src == c {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("citation not found")
+	}
+
+	now := time.Now().UTC().Format(sqliteTimeLayout)
+	tx, err := s.writeDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(
+		"INSERT OR IGNORE INTO citation_clicks (query_id, document_id, chunk_index, created_at) VALUES (?, ?, ?, ?)",
+		queryID, c.DocumentID, c.ChunkIndex, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record click: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO citation_stats (document_id, chunk_index, clicked, last_clicked_at) VALUES (?, ?, 1, ?)
+		 ON CONFLICT(document_id, chunk_index) DO UPDATE SET clicked = clicked + 1, last_clicked_at = excluded.last_clicked_at`,
+		c.DocumentID, c.ChunkIndex, now,
+	); err != nil {
+		return fmt.Errorf("failed to record click: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,261 @@
+package analytics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DeflectionSessionGap is the idle time after which a user's next question
+// starts a new support session, and after which a session counts as ended.
+const DeflectionSessionGap = 30 * time.Minute
+
+// Session outcomes, in the order they take precedence.
+const (
+	OutcomeEscalated = "escalated" // handed to a human: no answer found, or the user asked for one
+	OutcomeAbandoned = "abandoned" // the user left after rating the last answer down
+	OutcomeResolved  = "resolved"  // the user left after an answer without escalating
+	OutcomeActive    = "active"    // still within the session gap; not counted in the rates
+)
+
+// DeflectionFilter selects the queries whose sessions feed a deflection
+// report. Zero From/To means unbounded.
+type DeflectionFilter struct {
+	ProductID string
+	From      time.Time
+	To        time.Time
+}
+
+// FunnelRow is the session funnel of one product (or of all products).
+type FunnelRow struct {
+	ProductID   string `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Sessions    int    `json:"sessions"` // ended sessions; active ones are reported separately
+	Active      int    `json:"active"`
+	// Answered sessions got at least one answer from the knowledge base.
+	Answered          int `json:"answered"`
+	Resolved          int `json:"resolved"`
+	ConfirmedResolved int `json:"confirmed_resolved"` // resolved with a thumbs-up
+	Escalated         int `json:"escalated"`
+	AutoEscalated     int `json:"auto_escalated"`   // no answer found, question queued for a human
+	ManualEscalated   int `json:"manual_escalated"` // the user asked for a human after an answer
+	Abandoned         int `json:"abandoned"`
+	// DeflectionRate is resolved / sessions: the share of support sessions
+	// handled without a human.
+	DeflectionRate float64 `json:"deflection_rate"`
+	EscalationRate float64 `json:"escalation_rate"`
+	AbandonRate    float64 `json:"abandon_rate"`
+}
+
+// DeflectionReport is the session funnel overall and per product.
+type DeflectionReport struct {
+	SessionGapMinutes int         `json:"session_gap_minutes"`
+	Total             FunnelRow   `json:"total"`
+	Products          []FunnelRow `json:"products"`
+}
+
+// supportSession is a run of one user's questions about one product with no
+// gap longer than DeflectionSessionGap.
+type supportSession struct {
+	userID, productID string
+	start, end        time.Time
+	answered          bool
+	autoPending       int
+	pendingCreated    int
+	anyPositive       bool
+	lastRating        int
+}
+
+// outcome classifies the session as of now.
+func (ss *supportSession) outcome(now time.Time) string {
+	switch {
+	case ss.autoPending > 0 || ss.pendingCreated > ss.autoPending:
+		return OutcomeEscalated
+	case now.Sub(ss.end) < DeflectionSessionGap:
+		return OutcomeActive
+	case ss.lastRating < 0:
+		return OutcomeAbandoned
+	}
+	return OutcomeResolved
+}
+
+// DeflectionReport groups each user's queries into support sessions and
+// reports, per product, how many ended with an answer (deflected), were
+// escalated to a pending question, or were abandoned after a bad answer.
+// Pending questions the user created by hand during a session count as
+// escalations of that session.
+func (s *Service) DeflectionReport(f DeflectionFilter) (*DeflectionReport, error) {
+	where := []string{"1=1"}
+	var args []interface{}
+	if f.ProductID != "" {
+		where = append(where, "product_id = ?")
+		args = append(args, f.ProductID)
+	}
+	if !f.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.From.UTC().Format(sqliteTimeLayout))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.To.UTC().Format(sqliteTimeLayout))
+	}
+	cond := strings.Join(where, " AND ")
+
+	rows, err := s.readDB.Query(`SELECT user_id, COALESCE(product_id, ''), created_at, is_pending, rating
+		FROM query_logs WHERE `+cond+`
+		ORDER BY user_id, product_id, created_at`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query logs: %w", err)
+	}
+	var sessions []*supportSession
+	var cur *supportSession
+	for rows.Next() {
+		var userID, productID string
+		var createdAt time.Time
+		var isPending bool
+		var rating int
+		if err := rows.Scan(&userID, &productID, &createdAt, &isPending, &rating); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan query log: %w", err)
+		}
+		if cur == nil || cur.userID != userID || cur.productID != productID || createdAt.Sub(cur.end) > DeflectionSessionGap {
+			cur = &supportSession{userID: userID, productID: productID, start: createdAt}
+			sessions = append(sessions, cur)
+		}
+		cur.end = createdAt
+		if isPending {
+			cur.autoPending++
+		} else {
+			cur.answered = true
+		}
+		if rating > 0 {
+			cur.anyPositive = true
+		}
+		cur.lastRating = rating
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate query logs: %w", err)
+	}
+
+	// Attach pending questions to the session they were raised in
+	if len(sessions) > 0 {
+		byUser := make(map[string][]*supportSession)
+		for _, ss := range sessions {
+			key := ss.userID + "\x00" + ss.productID
+			byUser[key] = append(byUser[key], ss)
+		}
+		prows, err := s.readDB.Query(`SELECT user_id, COALESCE(product_id, ''), created_at
+			FROM pending_questions WHERE `+cond, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query pending questions: %w", err)
+		}
+		for prows.Next() {
+			var userID, productID string
+			var createdAt time.Time
+			if err := prows.Scan(&userID, &productID, &createdAt); err != nil {
+				prows.Close()
+				return nil, fmt.Errorf("failed to scan pending question: %w", err)
+			}
+			for _, ss := range byUser[userID+"\x00"+productID] {
+				if !createdAt.Before(ss.start) && createdAt.Sub(ss.end) <= DeflectionSessionGap {
+					ss.pendingCreated++
+					break
+				}
+			}
+		}
+		prows.Close()
+		if err := prows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to iterate pending questions: %w", err)
+		}
+	}
+
+	now := time.Now()
+	report := &DeflectionReport{SessionGapMinutes: int(DeflectionSessionGap / time.Minute)}
+	byProduct := make(map[string]*FunnelRow)
+	for _, ss := range sessions {
+		row, ok := byProduct[ss.productID]
+		if !ok {
+			row = &FunnelRow{ProductID: ss.productID}
+			byProduct[ss.productID] = row
+		}
+		for _, r := range []*FunnelRow{row, &report.Total} {
+			r.add(ss, now)
+		}
+	}
+
+	names := s.productNames()
+	report.Products = make([]FunnelRow, 0, len(byProduct))
+	for id, row := range byProduct {
+		row.ProductName = names[id]
+		row.computeRates()
+		report.Products = append(report.Products, *row)
+	}
+	report.Total.computeRates()
+	sort.Slice(report.Products, func(i, j int) bool {
+		if report.Products[i].Sessions != report.Products[j].Sessions {
+			return report.Products[i].Sessions > report.Products[j].Sessions
+		}
+		return report.Products[i].ProductID < report.Products[j].ProductID
+	})
+	return report, nil
+}
+
+// add counts a session in the funnel.
+func (r *FunnelRow) add(ss *supportSession, now time.Time) {
+	outcome := ss.outcome(now)
+	if outcome == OutcomeActive {
+		r.Active++
+		return
+	}
+	r.Sessions++
+	if ss.answered {
+		r.Answered++
+	}
+	switch outcome {
+	case OutcomeEscalated:
+		r.Escalated++
+		if ss.autoPending > 0 {
+			r.AutoEscalated++
+		} else {
+			r.ManualEscalated++
+		}
+	case OutcomeAbandoned:
+		r.Abandoned++
+	case OutcomeResolved:
+		r.Resolved++
+		if ss.anyPositive {
+			r.ConfirmedResolved++
+		}
+	}
+}
+
+// computeRates derives the rates from the counts.
+func (r *FunnelRow) computeRates() {
+	if r.Sessions == 0 {
+		return
+	}
+	n := float64(r.Sessions)
+	r.DeflectionRate = float64(r.Resolved) / n
+	r.EscalationRate = float64(r.Escalated) / n
+	r.AbandonRate = float64(r.Abandoned) / n
+}
+
+// productNames maps product IDs to names. Errors yield an empty map: names
+// are only labels.
+func (s *Service) productNames() map[string]string {
+	names := make(map[string]string)
+	rows, err := s.readDB.Query("SELECT id, name FROM products")
+	if err != nil {
+		return names
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, name string
+		if rows.Scan(&id, &name) == nil {
+			names[id] = name
+		}
+	}
+	return names
+}
@@ -0,0 +1,264 @@
+package analytics
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxFeedbackDocuments caps the weakest documents listed in a feedback report.
+const maxFeedbackDocuments = 20
+
+// FeedbackFilter selects the rated queries that feed a feedback report.
+// Zero From/To means unbounded. Rating limits the listed entries to
+// RatingUp or RatingDown; RatingNone lists both.
+type FeedbackFilter struct {
+	ProductID string
+	From      time.Time
+	To        time.Time
+	Rating    int
+	Limit     int // entries listed, default 50, max 500
+}
+
+// FeedbackRow is the helpfulness of the answers of one product (or of all
+// products).
+type FeedbackRow struct {
+	ProductID   string `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Rated       int    `json:"rated"`
+	Helpful     int    `json:"helpful"`
+	Unhelpful   int    `json:"unhelpful"`
+	Commented   int    `json:"commented"`
+	// HelpfulnessRate is helpful / rated, 0 when nothing was rated.
+	HelpfulnessRate float64 `json:"helpfulness_rate"`
+}
+
+// FeedbackDocument is the helpfulness of the answers citing a document.
+type FeedbackDocument struct {
+	DocumentID      string  `json:"document_id"`
+	DocumentName    string  `json:"document_name"`
+	Helpful         int     `json:"helpful"`
+	Unhelpful       int     `json:"unhelpful"`
+	HelpfulnessRate float64 `json:"helpfulness_rate"`
+}
+
+// FeedbackEntry is one rated answer.
+type FeedbackEntry struct {
+	QueryID   string          `json:"query_id"`
+	UserID    string          `json:"user_id"`
+	ProductID string          `json:"product_id"`
+	Question  string          `json:"question"`
+	Answer    string          `json:"answer"`
+	Sources   json.RawMessage `json:"sources"`
+	Rating    int             `json:"rating"`
+	Comment   string          `json:"comment"`
+	CreatedAt time.Time       `json:"created_at"`
+	RatedAt   *time.Time      `json:"rated_at,omitempty"` // unset for ratings given before it was recorded
+}
+
+// FeedbackReport aggregates answer ratings overall and per product, lists
+// the documents cited by the most unhelpful answers, and the latest rated
+// answers with their comments.
+type FeedbackReport struct {
+	Total     FeedbackRow        `json:"total"`
+	Products  []FeedbackRow      `json:"products"`
+	Documents []FeedbackDocument `json:"documents"` // most unhelpful first
+	Entries   []FeedbackEntry    `json:"entries"`   // newest first
+}
+
+// FeedbackReport builds the feedback report of the queries matching f, by
+// the date the questions were asked.
+func (s *Service) FeedbackReport(f FeedbackFilter) (*FeedbackReport, error) {
+	where := []string{"rating != 0"}
+	var args []interface{}
+	if f.ProductID != "" {
+		where = append(where, "product_id = ?")
+		args = append(args, f.ProductID)
+	}
+	if !f.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.From.UTC().Format(sqliteTimeLayout))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.To.UTC().Format(sqliteTimeLayout))
+	}
+	cond := strings.Join(where, " AND ")
+
+	rows, err := s.readDB.Query(`SELECT COALESCE(product_id, ''), rating, COALESCE(feedback_comment, ''), COALESCE(sources, '')
+		FROM query_logs WHERE `+cond, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feedback: %w", err)
+	}
+	report := &FeedbackReport{}
+	byProduct := make(map[string]*FeedbackRow)
+	byDocument := make(map[string]*FeedbackDocument)
+	for rows.Next() {
+		var productID, comment, sources string
+		var rating int
+		if err := rows.Scan(&productID, &rating, &comment, &sources); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan feedback: %w", err)
+		}
+		row, ok := byProduct[productID]
+		if !ok {
+			row = &FeedbackRow{ProductID: productID}
+			byProduct[productID] = row
+		}
+		for _, r := range []*FeedbackRow{row, &report.Total} {
+			r.Rated++
+			if rating > 0 {
+				r.Helpful++
+			} else {
+				r.Unhelpful++
+			}
+			if comment != "" {
+				r.Commented++
+			}
+		}
+		for _, src := range citedDocuments(sources) {
+			doc, ok := byDocument[src.DocumentID]
+			if !ok {
+				doc = &FeedbackDocument{DocumentID: src.DocumentID, DocumentName: src.DocumentName}
+				byDocument[src.DocumentID] = doc
+			}
+			if rating > 0 {
+				doc.Helpful++
+			} else {
+				doc.Unhelpful++
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate feedback: %w", err)
+	}
+
+	names := s.productNames()
+	report.Products = make([]FeedbackRow, 0, len(byProduct))
+	for id, row := range byProduct {
+		row.ProductName = names[id]
+		row.HelpfulnessRate = ratio(row.Helpful, row.Rated)
+		report.Products = append(report.Products, *row)
+	}
+	report.Total.HelpfulnessRate = ratio(report.Total.Helpful, report.Total.Rated)
+	// Weakest products first
+	sort.Slice(report.Products, func(i, j int) bool {
+		a, b := report.Products[i], report.Products[j]
+		if a.HelpfulnessRate != b.HelpfulnessRate {
+			return a.HelpfulnessRate < b.HelpfulnessRate
+		}
+		if a.Rated != b.Rated {
+			return a.Rated > b.Rated
+		}
+		return a.ProductID < b.ProductID
+	})
+
+	report.Documents = make([]FeedbackDocument, 0, len(byDocument))
+	for _, doc := range byDocument {
+		if doc.Unhelpful == 0 {
+			continue
+		}
+		doc.HelpfulnessRate = ratio(doc.Helpful, doc.Helpful+doc.Unhelpful)
+		report.Documents = append(report.Documents, *doc)
+	}
+	sort.Slice(report.Documents, func(i, j int) bool {
+		a, b := report.Documents[i], report.Documents[j]
+		if a.Unhelpful != b.Unhelpful {
+			return a.Unhelpful > b.Unhelpful
+		}
+		if a.HelpfulnessRate != b.HelpfulnessRate {
+			return a.HelpfulnessRate < b.HelpfulnessRate
+		}
+		return a.DocumentID < b.DocumentID
+	})
+	if len(report.Documents) > maxFeedbackDocuments {
+		report.Documents = report.Documents[:maxFeedbackDocuments]
+	}
+
+	if report.Entries, err = s.feedbackEntries(f, where, args); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// feedbackEntries lists the rated answers matching the report conditions,
+// newest first.
+func (s *Service) feedbackEntries(f FeedbackFilter, where []string, args []interface{}) ([]FeedbackEntry, error) {
+	if f.Rating == RatingUp || f.Rating == RatingDown {
+		where = append(where, "rating = ?")
+		args = append(args, f.Rating)
+	}
+	limit := f.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	args = append(args, limit)
+	rows, err := s.readDB.Query(`SELECT id, user_id, COALESCE(product_id, ''), question, COALESCE(answer, ''), COALESCE(sources, ''),
+			rating, COALESCE(feedback_comment, ''), created_at, rated_at
+		FROM query_logs WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY COALESCE(rated_at, created_at) DESC LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feedback entries: %w", err)
+	}
+	defer rows.Close()
+	entries := []FeedbackEntry{}
+	for rows.Next() {
+		var e FeedbackEntry
+		var sources string
+		var ratedAt sql.NullTime
+		if err := rows.Scan(&e.QueryID, &e.UserID, &e.ProductID, &e.Question, &e.Answer, &sources,
+			&e.Rating, &e.Comment, &e.CreatedAt, &ratedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan feedback entry: %w", err)
+		}
+		if sources == "" || !json.Valid([]byte(sources)) {
+			sources = "[]"
+		}
+		e.Sources = json.RawMessage(sources)
+		if ratedAt.Valid {
+			e.RatedAt = &ratedAt.Time
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// citedDocument is the part of a logged answer source needed to attribute
+// feedback to documents.
+type citedDocument struct {
+	DocumentID   string `json:"document_id"`
+	DocumentName string `json:"document_name"`
+}
+
+// citedDocuments returns the distinct documents in the sources JSON of a
+// logged answer.
+func citedDocuments(sources string) []citedDocument {
+	if sources == "" {
+		return nil
+	}
+	var refs []citedDocument
+	if json.Unmarshal([]byte(sources), &refs) != nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(refs))
+	docs := refs[:0]
+	for _, ref := range refs {
+		if ref.DocumentID == "" || seen[ref.DocumentID] {
+			continue
+		}
+		seen[ref.DocumentID] = true
+		docs = append(docs, ref)
+	}
+	return docs
+}
+
+// ratio returns n / d, or 0 when d is 0.
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
@@ -0,0 +1,249 @@
+package analytics
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Health factor names reported in ProductHealth.Factors.
+const (
+	FactorFreshness = "freshness"
+	FactorCoverage  = "query_coverage"
+	FactorOrphans   = "orphaned_chunks"
+	FactorFailed    = "failed_documents"
+	FactorFeedback  = "feedback"
+)
+
+const (
+	// healthStaleAfter is the document age after which content counts as stale.
+	healthStaleAfter = 365 * 24 * time.Hour
+	// healthQueryWindow is the look-back window for query coverage and feedback.
+	healthQueryWindow = 90 * 24 * time.Hour
+	// healthTopQueries is how many of the most frequent questions are checked for coverage.
+	healthTopQueries = 20
+)
+
+// healthWeights sets each factor's share of the overall score. Factors without
+// data are skipped and the remaining weights are renormalised.
+var healthWeights = map[string]float64{
+	FactorFreshness: 0.20,
+	FactorCoverage:  0.30,
+	FactorOrphans:   0.15,
+	FactorFailed:    0.15,
+	FactorFeedback:  0.20,
+}
+
+// HealthFactor is one contributor to a product's health score.
+type HealthFactor struct {
+	Name      string  `json:"name"`
+	Score     float64 `json:"score"`  // 0-100
+	Weight    float64 `json:"weight"` // share of the overall score, 0 when unavailable
+	Available bool    `json:"available"`
+	Detail    string  `json:"detail"`
+}
+
+// UncoveredQuery is a frequent question that mostly ended up as a pending (unanswered) question.
+type UncoveredQuery struct {
+	Question string `json:"question"`
+	Count    int    `json:"count"`
+	Pending  int    `json:"pending"`
+}
+
+// ProductHealth is the computed knowledge base health of a product.
+type ProductHealth struct {
+	ProductID        string           `json:"product_id"`
+	Score            float64          `json:"score"` // 0-100, weighted over available factors
+	Factors          []HealthFactor   `json:"factors"`
+	UncoveredQueries []UncoveredQuery `json:"uncovered_queries"`
+	Documents        int              `json:"documents"`
+	Chunks           int              `json:"chunks"`
+	ComputedAt       time.Time        `json:"computed_at"`
+}
+
+// ProductHealth computes the health score of a product's knowledge base from
+// document freshness, coverage of frequent questions, orphaned chunks, failed
+// imports and user feedback.
+func (s *Service) ProductHealth(productID string) (*ProductHealth, error) {
+	now := time.Now().UTC()
+	h := &ProductHealth{ProductID: productID, ComputedAt: now, UncoveredQueries: []UncoveredQuery{}}
+
+	// Documents: freshness and failures
+	rows, err := s.readDB.Query("SELECT status, created_at FROM documents WHERE product_id = ?", productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query documents: %w", err)
+	}
+	var ok, stale, failed int
+	for rows.Next() {
+		var status string
+		var createdAt time.Time
+		if err := rows.Scan(&status, &createdAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		h.Documents++
+		switch status {
+		case "success":
+			ok++
+			if now.Sub(createdAt) > healthStaleAfter {
+				stale++
+			}
+		case "failed", "password_protected", "quarantined":
+			failed++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate documents: %w", err)
+	}
+
+	freshness := HealthFactor{Name: FactorFreshness, Detail: "没有已导入的文档"}
+	if ok > 0 {
+		freshness.Available = true
+		freshness.Score = ratioScore(ok-stale, ok)
+		freshness.Detail = fmt.Sprintf("%d/%d 个文档超过 %d 天未更新", stale, ok, int(healthStaleAfter.Hours()/24))
+	}
+	failedFactor := HealthFactor{Name: FactorFailed, Detail: "没有文档"}
+	if h.Documents > 0 {
+		failedFactor.Available = true
+		failedFactor.Score = ratioScore(h.Documents-failed, h.Documents)
+		failedFactor.Detail = fmt.Sprintf("%d/%d 个文档导入失败", failed, h.Documents)
+	}
+
+	// Orphaned chunks: chunks whose document record no longer exists. An
+	// isolated product's chunks are in its storage partition.
+	var orphans int
+	var pdb *sql.DB
+	if s.partitionDB != nil {
+		pdb = s.partitionDB(productID)
+	}
+	if pdb != nil {
+		h.Chunks, orphans, err = s.countPartitionChunks(pdb)
+	} else {
+		err = s.readDB.QueryRow(`SELECT COUNT(*), COALESCE(SUM(CASE WHEN d.id IS NULL THEN 1 ELSE 0 END), 0)
+			FROM chunks c LEFT JOIN documents d ON d.id = c.document_id
+			WHERE c.product_id = ?`, productID).Scan(&h.Chunks, &orphans)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to count chunks: %w", err)
+	}
+	orphanFactor := HealthFactor{Name: FactorOrphans, Detail: "没有分块"}
+	if h.Chunks > 0 {
+		orphanFactor.Available = true
+		orphanFactor.Score = ratioScore(h.Chunks-orphans, h.Chunks)
+		orphanFactor.Detail = fmt.Sprintf("%d/%d 个分块没有对应文档", orphans, h.Chunks)
+	}
+
+	since := now.Add(-healthQueryWindow).Format(sqliteTimeLayout)
+
+	// Coverage of the most frequent questions
+	qrows, err := s.readDB.Query(`SELECT LOWER(TRIM(question)) AS q, COUNT(*) AS n, SUM(CASE WHEN is_pending = 1 THEN 1 ELSE 0 END)
+		FROM query_logs WHERE product_id = ? AND created_at >= ?
+		GROUP BY q ORDER BY n DESC LIMIT ?`, productID, since, healthTopQueries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top questions: %w", err)
+	}
+	var asked, pending int
+	for qrows.Next() {
+		var uq UncoveredQuery
+		if err := qrows.Scan(&uq.Question, &uq.Count, &uq.Pending); err != nil {
+			qrows.Close()
+			return nil, fmt.Errorf("failed to scan top question: %w", err)
+		}
+		asked += uq.Count
+		pending += uq.Pending
+		if uq.Pending*2 > uq.Count {
+			h.UncoveredQueries = append(h.UncoveredQueries, uq)
+		}
+	}
+	qrows.Close()
+	if err := qrows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate top questions: %w", err)
+	}
+	coverage := HealthFactor{Name: FactorCoverage, Detail: "近期没有提问"}
+	if asked > 0 {
+		coverage.Available = true
+		coverage.Score = ratioScore(asked-pending, asked)
+		coverage.Detail = fmt.Sprintf("前 %d 个高频问题中 %d/%d 次提问未能回答", healthTopQueries, pending, asked)
+	}
+
+	// Feedback ratio
+	var rated, positive int
+	err = s.readDB.QueryRow(`SELECT COALESCE(SUM(CASE WHEN rating != 0 THEN 1 ELSE 0 END), 0), COALESCE(SUM(CASE WHEN rating > 0 THEN 1 ELSE 0 END), 0)
+		FROM query_logs WHERE product_id = ? AND created_at >= ?`, productID, since).Scan(&rated, &positive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feedback: %w", err)
+	}
+	feedback := HealthFactor{Name: FactorFeedback, Detail: "近期没有评价"}
+	if rated > 0 {
+		feedback.Available = true
+		feedback.Score = ratioScore(positive, rated)
+		feedback.Detail = fmt.Sprintf("%d/%d 条评价为好评", positive, rated)
+	}
+
+	h.Factors = []HealthFactor{freshness, coverage, orphanFactor, failedFactor, feedback}
+
+	var totalWeight, weighted float64
+	for _, f := range h.Factors {
+		if f.Available {
+			totalWeight += healthWeights[f.Name]
+		}
+	}
+	for i := range h.Factors {
+		f := &h.Factors[i]
+		if !f.Available || totalWeight == 0 {
+			continue
+		}
+		f.Weight = round1(healthWeights[f.Name]/totalWeight*100) / 100
+		weighted += f.Score * healthWeights[f.Name] / totalWeight
+	}
+	h.Score = round1(weighted)
+	return h, nil
+}
+
+// ratioScore converts good/total into a 0-100 score rounded to one decimal.
+// countPartitionChunks counts the chunks in the storage partition pdb and,
+// among them, those whose document record no longer exists.
+func (s *Service) countPartitionChunks(pdb *sql.DB) (chunks, orphans int, err error) {
+	rows, err := pdb.Query(`SELECT document_id, COUNT(*) FROM chunks GROUP BY document_id`)
+	if err != nil {
+		return 0, 0, err
+	}
+	perDoc := make(map[string]int)
+	for rows.Next() {
+		var docID string
+		var n int
+		if err := rows.Scan(&docID, &n); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		perDoc[docID] = n
+		chunks += n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	for docID, n := range perDoc {
+		var exists int
+		err := s.readDB.QueryRow(`SELECT 1 FROM documents WHERE id = ?`, docID).Scan(&exists)
+		if err == sql.ErrNoRows {
+			orphans += n
+		} else if err != nil {
+			return 0, 0, err
+		}
+	}
+	return chunks, orphans, nil
+}
+
+func ratioScore(good, total int) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return round1(float64(good) / float64(total) * 100)
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -0,0 +1,217 @@
+// Package analytics records per-query events and aggregates them into usage reports.
+package analytics
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"askflow/internal/idgen"
+)
+
+// Rating values stored in query_logs.rating.
+const (
+	RatingNone = 0
+	RatingUp   = 1
+	RatingDown = -1
+)
+
+// Report grouping modes.
+const (
+	GroupByUser = "user"
+	GroupByOrg  = "org"
+)
+
+// sqliteTimeLayout matches the format produced by CURRENT_TIMESTAMP.
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// UsageFilter selects the query log rows that feed a usage report.
+// Zero From/To means unbounded.
+type UsageFilter struct {
+	ProductID string
+	From      time.Time
+	To        time.Time
+	GroupBy   string // "user" (default) or "org" (email domain)
+}
+
+// UsageRow is one line of a usage report, keyed by customer or organisation.
+type UsageRow struct {
+	Key            string  `json:"key"`
+	Label          string  `json:"label"`
+	Queries        int     `json:"queries"`
+	UniqueUsers    int     `json:"unique_users"`
+	Escalations    int     `json:"escalations"`
+	EscalationRate float64 `json:"escalation_rate"`
+	Rated          int     `json:"rated"`
+	Positive       int     `json:"positive"`
+	Satisfaction   float64 `json:"satisfaction"` // positive / rated, 0 when nothing rated
+	Verified       int     `json:"verified"`     // answers checked against their sources
+	Faithfulness   float64 `json:"faithfulness"` // mean faithfulness score of verified answers, 0 when none
+}
+
+// Service records query events and builds usage reports.
+type Service struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+	// partitionDB returns the storage partition of a product with isolated
+	// storage, or nil; see SetPartitionDB.
+	partitionDB func(productID string) *sql.DB
+}
+
+// NewService creates a new analytics Service with separate read and write database connections.
+func NewService(readDB, writeDB *sql.DB) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB}
+}
+
+// SetPartitionDB sets how to find the storage partition holding the chunks
+// of a product with isolated storage. fn returns nil for products whose
+// chunks are in the main database.
+func (s *Service) SetPartitionDB(fn func(productID string) *sql.DB) {
+	s.partitionDB = fn
+}
+
+// LogQuery records a processed query together with the answer given and its
+// sources (JSON) and returns its log ID, which the client can later use to
+// submit a rating or share the answer. faithfulness is the answer's
+// verification score, nil when it was not verified.
+func (s *Service) LogQuery(userID, productID, question, answer, sources string, isPending bool, faithfulness *float64) (string, error) {
+	id, err := idgen.New()
+	if err != nil {
+		return "", err
+	}
+	_, err = s.writeDB.Exec(
+		"INSERT INTO query_logs (id, user_id, product_id, question, answer, sources, is_pending, faithfulness, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		id, userID, productID, question, answer, sources, isPending, faithfulness, time.Now().UTC().Format(sqliteTimeLayout),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to log query: %w", err)
+	}
+	return id, nil
+}
+
+// SetRating stores a thumbs up/down rating for a logged query, with an
+// optional comment. Only the user who asked the question may rate it;
+// RatingNone withdraws the rating and its comment.
+func (s *Service) SetRating(queryID, userID string, rating int, comment string) error {
+	if rating != RatingUp && rating != RatingDown && rating != RatingNone {
+		return fmt.Errorf("invalid rating")
+	}
+	var ratedAt interface{}
+	if rating == RatingNone {
+		comment = ""
+	} else {
+		ratedAt = time.Now().UTC().Format(sqliteTimeLayout)
+	}
+	result, err := s.writeDB.Exec("UPDATE query_logs SET rating = ?, feedback_comment = ?, rated_at = ? WHERE id = ? AND user_id = ?",
+		rating, comment, ratedAt, queryID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to save rating: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rating result: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("query not found")
+	}
+	return nil
+}
+
+// UsageReport aggregates queries, unique users, escalations and satisfaction
+// per customer (user) or per organisation (email domain), sorted by query count.
+func (s *Service) UsageReport(f UsageFilter) ([]UsageRow, error) {
+	where := []string{"1=1"}
+	var args []interface{}
+	if f.ProductID != "" {
+		where = append(where, "q.product_id = ?")
+		args = append(args, f.ProductID)
+	}
+	if !f.From.IsZero() {
+		where = append(where, "q.created_at >= ?")
+		args = append(args, f.From.UTC().Format(sqliteTimeLayout))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "q.created_at < ?")
+		args = append(args, f.To.UTC().Format(sqliteTimeLayout))
+	}
+
+	rows, err := s.readDB.Query(`SELECT q.user_id, COALESCE(u.email, ''), COALESCE(u.name, ''),
+			COUNT(*), SUM(CASE WHEN q.is_pending = 1 THEN 1 ELSE 0 END),
+			SUM(CASE WHEN q.rating != 0 THEN 1 ELSE 0 END), SUM(CASE WHEN q.rating > 0 THEN 1 ELSE 0 END),
+			COUNT(q.faithfulness), COALESCE(SUM(q.faithfulness), 0)
+		FROM query_logs q LEFT JOIN users u ON u.id = q.user_id
+		WHERE `+strings.Join(where, " AND ")+`
+		GROUP BY q.user_id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	byKey := make(map[string]*UsageRow)
+	for rows.Next() {
+		var userID, email, name string
+		var queries, escalations, rated, positive, verified int
+		var faithfulnessSum float64
+		if err := rows.Scan(&userID, &email, &name, &queries, &escalations, &rated, &positive, &verified, &faithfulnessSum); err != nil {
+			return nil, fmt.Errorf("failed to scan usage row: %w", err)
+		}
+		key, label := userID, email
+		if label == "" {
+			label = name
+		}
+		if label == "" {
+			label = userID
+		}
+		if f.GroupBy == GroupByOrg {
+			key = orgOf(email)
+			label = key
+		}
+		row, ok := byKey[key]
+		if !ok {
+			row = &UsageRow{Key: key, Label: label}
+			byKey[key] = row
+		}
+		row.Queries += queries
+		row.UniqueUsers++
+		row.Escalations += escalations
+		row.Rated += rated
+		row.Positive += positive
+		row.Verified += verified
+		row.Faithfulness += faithfulnessSum // summed here, averaged below
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate usage rows: %w", err)
+	}
+
+	report := make([]UsageRow, 0, len(byKey))
+	for _, row := range byKey {
+		if row.Queries > 0 {
+			row.EscalationRate = float64(row.Escalations) / float64(row.Queries)
+		}
+		if row.Rated > 0 {
+			row.Satisfaction = float64(row.Positive) / float64(row.Rated)
+		}
+		if row.Verified > 0 {
+			row.Faithfulness /= float64(row.Verified)
+		}
+		report = append(report, *row)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Queries != report[j].Queries {
+			return report[i].Queries > report[j].Queries
+		}
+		return report[i].Key < report[j].Key
+	})
+	return report, nil
+}
+
+// orgOf derives an organisation key from an email address (its domain).
+// Users without an email are grouped under "(unknown)".
+func orgOf(email string) string {
+	if i := strings.LastIndex(email, "@"); i >= 0 && i < len(email)-1 {
+		return strings.ToLower(email[i+1:])
+	}
+	return "(unknown)"
+}
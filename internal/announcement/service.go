@@ -0,0 +1,274 @@
+// Package announcement manages short product announcements such as release
+// notes. Active announcements are shown at the top of the chat, and each one
+// is also indexed as a document so the bot can answer questions like "what's
+// new in version X" after the announcement itself has expired.
+package announcement
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"askflow/internal/document"
+	"askflow/internal/idgen"
+)
+
+const (
+	// DocumentType is the type of the documents announcements are indexed as.
+	DocumentType = "announcement"
+	// documentNamePrefix is prepended to the title in the document name.
+	documentNamePrefix = "产品公告: "
+
+	maxTitleRunes   = 200
+	maxContentRunes = 5000
+	maxVersionRunes = 50
+	// maxActive caps the announcements shown in the chat at once.
+	maxActive = 5
+)
+
+// Announcement is a product announcement. An empty ProductID shows it for
+// every product. The effective dates are inclusive and bound when it is
+// shown in the chat; either may be empty for an open bound.
+type Announcement struct {
+	ID             string    `json:"id"`
+	ProductID      string    `json:"product_id"`
+	Title          string    `json:"title"`
+	Content        string    `json:"content"`
+	Version        string    `json:"version,omitempty"`
+	EffectiveFrom  string    `json:"effective_from,omitempty"`
+	EffectiveUntil string    `json:"effective_until,omitempty"`
+	DocumentID     string    `json:"document_id,omitempty"` // indexed copy; empty in the public listing
+	CreatedBy      string    `json:"created_by,omitempty"`  // empty in the public listing
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Input holds the editable fields of an announcement.
+type Input struct {
+	ProductID      string `json:"product_id"`
+	Title          string `json:"title"`
+	Content        string `json:"content"`
+	Version        string `json:"version"`
+	EffectiveFrom  string `json:"effective_from"`
+	EffectiveUntil string `json:"effective_until"`
+}
+
+// Indexer is the subset of DocumentManager used to index announcements.
+type Indexer interface {
+	AddTextDocument(docType, name, text, productID, effectiveFrom string) (string, error)
+	DeleteDocument(docID string) error
+}
+
+// Service stores announcements and keeps their indexed documents in sync.
+type Service struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+	indexer Indexer
+}
+
+// NewService creates a new announcement Service.
+func NewService(readDB, writeDB *sql.DB, indexer Indexer) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB, indexer: indexer}
+}
+
+// normalize validates an announcement and trims its fields.
+func normalize(in Input) (Input, error) {
+	in.Title = strings.TrimSpace(in.Title)
+	in.Content = strings.TrimSpace(in.Content)
+	in.Version = strings.TrimSpace(in.Version)
+	if in.Title == "" || in.Content == "" {
+		return in, fmt.Errorf("标题和内容不能为空")
+	}
+	if len([]rune(in.Title)) > maxTitleRunes {
+		return in, fmt.Errorf("标题长度不能超过 %d 个字符", maxTitleRunes)
+	}
+	if len([]rune(in.Content)) > maxContentRunes {
+		return in, fmt.Errorf("内容长度不能超过 %d 个字符", maxContentRunes)
+	}
+	if len([]rune(in.Version)) > maxVersionRunes {
+		return in, fmt.Errorf("版本号长度不能超过 %d 个字符", maxVersionRunes)
+	}
+	from, until, err := document.NormalizeEffectiveDates(in.EffectiveFrom, in.EffectiveUntil)
+	if err != nil {
+		return in, err
+	}
+	in.EffectiveFrom, in.EffectiveUntil = from, until
+	return in, nil
+}
+
+// index stores the announcement as a document and returns its ID. The
+// document stays citable after the announcement expires, since release
+// notes remain true, but not before it takes effect.
+func (s *Service) index(in Input, published time.Time) (string, error) {
+	var b strings.Builder
+	b.WriteString(in.Title)
+	b.WriteString("\n")
+	if in.Version != "" {
+		b.WriteString("版本 " + in.Version + " · ")
+	}
+	date := in.EffectiveFrom
+	if date == "" {
+		date = published.Format(document.EffectiveDateLayout)
+	}
+	b.WriteString(date + "\n\n")
+	b.WriteString(in.Content)
+	docID, err := s.indexer.AddTextDocument(DocumentType, documentNamePrefix+in.Title, b.String(), in.ProductID, in.EffectiveFrom)
+	if err != nil {
+		return "", fmt.Errorf("存储公告内容失败: %w", err)
+	}
+	return docID, nil
+}
+
+// removeDocument deletes an announcement's indexed document. Admins may
+// already have deleted it from the document list, so failures are logged.
+func (s *Service) removeDocument(docID string) {
+	if docID == "" {
+		return
+	}
+	if err := s.indexer.DeleteDocument(docID); err != nil {
+		log.Printf("[Announcement] failed to delete document %s: %v", docID, err)
+	}
+}
+
+// Create publishes an announcement.
+func (s *Service) Create(in Input, createdBy string) (*Announcement, error) {
+	in, err := normalize(in)
+	if err != nil {
+		return nil, err
+	}
+	id, err := idgen.New()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	docID, err := s.index(in, now)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.writeDB.Exec(
+		`INSERT INTO announcements (id, product_id, title, content, version, effective_from, effective_until,
+			document_id, created_by, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, in.ProductID, in.Title, in.Content, in.Version, in.EffectiveFrom, in.EffectiveUntil,
+		docID, createdBy, now, now,
+	); err != nil {
+		s.removeDocument(docID)
+		return nil, fmt.Errorf("failed to insert announcement: %w", err)
+	}
+	return s.Get(id)
+}
+
+// Update replaces an announcement's fields and re-indexes it.
+func (s *Service) Update(id string, in Input) (*Announcement, error) {
+	old, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	in, err = normalize(in)
+	if err != nil {
+		return nil, err
+	}
+	docID, err := s.index(in, old.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.writeDB.Exec(
+		`UPDATE announcements SET product_id = ?, title = ?, content = ?, version = ?, effective_from = ?,
+			effective_until = ?, document_id = ?, updated_at = ? WHERE id = ?`,
+		in.ProductID, in.Title, in.Content, in.Version, in.EffectiveFrom,
+		in.EffectiveUntil, docID, time.Now().UTC(), id,
+	); err != nil {
+		s.removeDocument(docID)
+		return nil, fmt.Errorf("failed to update announcement: %w", err)
+	}
+	s.removeDocument(old.DocumentID)
+	return s.Get(id)
+}
+
+// Delete removes an announcement and its indexed document.
+func (s *Service) Delete(id string) error {
+	a, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.writeDB.Exec("DELETE FROM announcements WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete announcement: %w", err)
+	}
+	s.removeDocument(a.DocumentID)
+	return nil
+}
+
+const announcementColumns = `id, product_id, title, content, version, effective_from, effective_until,
+	document_id, created_by, created_at, updated_at`
+
+func scanAnnouncement(scan func(dest ...interface{}) error) (*Announcement, error) {
+	var a Announcement
+	if err := scan(&a.ID, &a.ProductID, &a.Title, &a.Content, &a.Version, &a.EffectiveFrom, &a.EffectiveUntil,
+		&a.DocumentID, &a.CreatedBy, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// Get returns a single announcement.
+func (s *Service) Get(id string) (*Announcement, error) {
+	a, err := scanAnnouncement(s.writeDB.QueryRow("SELECT "+announcementColumns+" FROM announcements WHERE id = ?", id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("公告不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get announcement: %w", err)
+	}
+	return a, nil
+}
+
+// List returns announcements newest first: all of them when productID is
+// empty, otherwise the product's own and the global ones.
+func (s *Service) List(productID string) ([]Announcement, error) {
+	query := "SELECT " + announcementColumns + " FROM announcements"
+	var args []interface{}
+	if productID != "" {
+		query += " WHERE product_id = ? OR product_id = ''"
+		args = append(args, productID)
+	}
+	return s.query(query+" ORDER BY created_at DESC", args...)
+}
+
+// Active returns the announcements to show in the chat of a product today,
+// most recently effective first, without the admin-only fields.
+func (s *Service) Active(productID string) ([]Announcement, error) {
+	today := time.Now().Format(document.EffectiveDateLayout)
+	list, err := s.query(
+		"SELECT "+announcementColumns+` FROM announcements
+		 WHERE (product_id = ? OR product_id = '')
+		   AND (effective_from = '' OR effective_from <= ?)
+		   AND (effective_until = '' OR effective_until >= ?)
+		 ORDER BY CASE WHEN effective_from = '' THEN substr(created_at, 1, 10) ELSE effective_from END DESC, created_at DESC
+		 LIMIT ?`,
+		productID, today, today, maxActive,
+	)
+	for i := range list {
+		list[i].DocumentID = ""
+		list[i].CreatedBy = ""
+	}
+	return list, err
+}
+
+func (s *Service) query(query string, args ...interface{}) ([]Announcement, error) {
+	rows, err := s.readDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list announcements: %w", err)
+	}
+	defer rows.Close()
+	list := []Announcement{}
+	for rows.Next() {
+		a, err := scanAnnouncement(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan announcement: %w", err)
+		}
+		list = append(list, *a)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,275 @@
+// Package answertemplate manages canned responses: reusable answers admins
+// insert while answering pending questions. A template's content may hold
+// {name} placeholders, filled in from the question being answered, from
+// values the admin types and from the template's own defaults; an LLM can
+// then adapt the filled-in text to the specific question.
+package answertemplate
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"askflow/internal/idgen"
+	"askflow/internal/llm"
+)
+
+const (
+	maxNameRunes    = 100
+	maxContentRunes = 10000
+	maxVariables    = 20
+	maxValueRunes   = 1000
+)
+
+// Variables filled in from the question a template is rendered for.
+const (
+	VarProductName = "product_name"
+	VarQuestion    = "question"
+)
+
+// placeholderRe matches a {name} placeholder; names are lower-case ASCII.
+var placeholderRe = regexp.MustCompile(`\{([a-z][a-z0-9_]{0,39})\}`)
+
+// variableNameRe matches a valid variable name.
+var variableNameRe = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// Template is a canned response. An empty ProductID offers it for every
+// product. Variables holds default values of placeholders, such as a
+// product's download_url, used when the admin leaves them empty.
+type Template struct {
+	ID        string            `json:"id"`
+	ProductID string            `json:"product_id"`
+	Name      string            `json:"name"`
+	Content   string            `json:"content"`
+	Variables map[string]string `json:"variables"`
+	// Placeholders lists the names of the placeholders in Content.
+	Placeholders []string  `json:"placeholders"`
+	CreatedBy    string    `json:"created_by,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Input holds the editable fields of a template.
+type Input struct {
+	ProductID string            `json:"product_id"`
+	Name      string            `json:"name"`
+	Content   string            `json:"content"`
+	Variables map[string]string `json:"variables"`
+}
+
+// Service stores answer templates.
+type Service struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+}
+
+// NewService creates a new answer template Service.
+func NewService(readDB, writeDB *sql.DB) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB}
+}
+
+// normalize validates a template and trims its fields.
+func normalize(in Input) (Input, error) {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Content = strings.TrimSpace(in.Content)
+	if in.Name == "" || in.Content == "" {
+		return in, fmt.Errorf("模板名称和内容不能为空")
+	}
+	if len([]rune(in.Name)) > maxNameRunes {
+		return in, fmt.Errorf("模板名称长度不能超过 %d 个字符", maxNameRunes)
+	}
+	if len([]rune(in.Content)) > maxContentRunes {
+		return in, fmt.Errorf("模板内容长度不能超过 %d 个字符", maxContentRunes)
+	}
+	if len(in.Variables) > maxVariables {
+		return in, fmt.Errorf("变量默认值最多 %d 个", maxVariables)
+	}
+	vars := make(map[string]string, len(in.Variables))
+	for name, value := range in.Variables {
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+		if !variableNameRe.MatchString(name) {
+			return in, fmt.Errorf("变量名 %q 无效，只能包含小写字母、数字和下划线，且以字母开头", name)
+		}
+		if name == VarProductName || name == VarQuestion {
+			return in, fmt.Errorf("变量 %s 由问题自动填写，不能设置默认值", name)
+		}
+		if len([]rune(value)) > maxValueRunes {
+			return in, fmt.Errorf("变量 %s 的默认值长度不能超过 %d 个字符", name, maxValueRunes)
+		}
+		if value != "" {
+			vars[name] = value
+		}
+	}
+	in.Variables = vars
+	return in, nil
+}
+
+// Create stores a new template.
+func (s *Service) Create(in Input, createdBy string) (*Template, error) {
+	in, err := normalize(in)
+	if err != nil {
+		return nil, err
+	}
+	id, err := idgen.New()
+	if err != nil {
+		return nil, err
+	}
+	vars, err := json.Marshal(in.Variables)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if _, err := s.writeDB.Exec(
+		`INSERT INTO answer_templates (id, product_id, name, content, variables, created_by, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, in.ProductID, in.Name, in.Content, string(vars), createdBy, now, now,
+	); err != nil {
+		return nil, fmt.Errorf("failed to insert answer template: %w", err)
+	}
+	return s.Get(id)
+}
+
+// Update replaces a template's fields.
+func (s *Service) Update(id string, in Input) (*Template, error) {
+	in, err := normalize(in)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := json.Marshal(in.Variables)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.writeDB.Exec(
+		`UPDATE answer_templates SET product_id = ?, name = ?, content = ?, variables = ?, updated_at = ? WHERE id = ?`,
+		in.ProductID, in.Name, in.Content, string(vars), time.Now().UTC(), id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update answer template: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("模板不存在")
+	}
+	return s.Get(id)
+}
+
+// Delete removes a template.
+func (s *Service) Delete(id string) error {
+	res, err := s.writeDB.Exec("DELETE FROM answer_templates WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete answer template: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("模板不存在")
+	}
+	return nil
+}
+
+const templateColumns = `id, product_id, name, content, variables, created_by, created_at, updated_at`
+
+func scanTemplate(scan func(dest ...interface{}) error) (*Template, error) {
+	var t Template
+	var vars string
+	if err := scan(&t.ID, &t.ProductID, &t.Name, &t.Content, &vars, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(vars), &t.Variables); err != nil || t.Variables == nil {
+		t.Variables = map[string]string{}
+	}
+	t.Placeholders = Placeholders(t.Content)
+	return &t, nil
+}
+
+// Get returns a single template.
+func (s *Service) Get(id string) (*Template, error) {
+	t, err := scanTemplate(s.writeDB.QueryRow("SELECT "+templateColumns+" FROM answer_templates WHERE id = ?", id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("模板不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get answer template: %w", err)
+	}
+	return t, nil
+}
+
+// List returns templates by name: all of them when productID is empty,
+// otherwise the product's own and the global ones.
+func (s *Service) List(productID string) ([]Template, error) {
+	query := "SELECT " + templateColumns + " FROM answer_templates"
+	var args []interface{}
+	if productID != "" {
+		query += " WHERE product_id = ? OR product_id = ''"
+		args = append(args, productID)
+	}
+	rows, err := s.readDB.Query(query+" ORDER BY name", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list answer templates: %w", err)
+	}
+	defer rows.Close()
+	list := []Template{}
+	for rows.Next() {
+		t, err := scanTemplate(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan answer template: %w", err)
+		}
+		list = append(list, *t)
+	}
+	return list, rows.Err()
+}
+
+// Placeholders returns the names of the placeholders in content, each once,
+// in order of appearance.
+func Placeholders(content string) []string {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, m := range placeholderRe.FindAllStringSubmatch(content, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// Render fills the placeholders of t with values, falling back to the
+// template's defaults, and returns the text with the names of the
+// placeholders left unfilled.
+func (t *Template) Render(values map[string]string) (string, []string) {
+	missing := []string{}
+	seen := make(map[string]bool)
+	text := placeholderRe.ReplaceAllStringFunc(t.Content, func(p string) string {
+		name := p[1 : len(p)-1]
+		if v := strings.TrimSpace(values[name]); v != "" {
+			return v
+		}
+		if v := t.Variables[name]; v != "" {
+			return v
+		}
+		if !seen[name] {
+			seen[name] = true
+			missing = append(missing, name)
+		}
+		return p
+	})
+	return text, missing
+}
+
+// Adapt asks ls to rewrite a rendered template so it answers question
+// directly, keeping its facts, links and steps and any unfilled placeholders.
+func Adapt(ls llm.LLMService, text, question string) (string, error) {
+	prompt := "你是一名客服助手。参考资料是管理员选用的标准回答模板，请根据用户的具体问题调整措辞和内容顺序，使其直接回应该问题。" +
+		"保留模板中的事实、链接、步骤和联系方式，不要添加模板中没有的信息；与问题无关的段落可以删去；形如 {变量名} 的占位符原样保留。" +
+		"使用与用户问题相同的语言，只输出调整后的回答，不要添加任何解释。"
+	answer, err := ls.Generate(prompt, []string{text}, question)
+	if err != nil {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return "", fmt.Errorf("模型未返回内容")
+	}
+	return answer, nil
+}
@@ -0,0 +1,262 @@
+// Package apikey manages API keys for programmatic access. A key carries a
+// set of scopes limiting which endpoints it may call; only its SHA-256 hash
+// is stored, so a key is shown once when created and cannot be recovered.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// keyPrefix starts every key so that leaked keys are easy to recognize.
+	keyPrefix = "afk_"
+	// keyBytes is the amount of randomness in a key.
+	keyBytes = 24
+	// displayLen is the number of leading key characters kept for display.
+	displayLen = 12
+	// touchInterval limits how often last_used_at is written for a key.
+	touchInterval = time.Minute
+	// MaxTTL is the longest lifetime a key may be given.
+	MaxTTL = 3650 * 24 * time.Hour
+)
+
+// Scopes a key can be granted. A ":write" scope includes the matching
+// ":read" scope.
+const (
+	ScopeQuery          = "query"
+	ScopeDocumentsRead  = "documents:read"
+	ScopeDocumentsWrite = "documents:write"
+	ScopePendingRead    = "pending:read"
+	ScopePendingWrite   = "pending:write"
+	ScopeProductsRead   = "products:read"
+	ScopeReportsRead    = "reports:read"
+)
+
+// AllScopes lists the valid scopes.
+var AllScopes = []string{
+	ScopeQuery,
+	ScopeDocumentsRead, ScopeDocumentsWrite,
+	ScopePendingRead, ScopePendingWrite,
+	ScopeProductsRead,
+	ScopeReportsRead,
+}
+
+// ErrNotFound is returned for unknown key IDs.
+var ErrNotFound = fmt.Errorf("API 密钥不存在")
+
+// ErrInvalid is returned by Authenticate for unknown, revoked or expired keys.
+var ErrInvalid = fmt.Errorf("API 密钥无效或已过期")
+
+// Key describes an API key without its secret.
+type Key struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // leading characters of the key, for display
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope reports whether the key was granted scope, directly or through
+// the matching ":write" scope.
+func (k *Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+		if res, ok := strings.CutSuffix(scope, ":read"); ok && s == res+":write" {
+			return true
+		}
+	}
+	return false
+}
+
+// UserID returns the user ID requests made with key id act as.
+func UserID(id string) string {
+	return "apikey_" + id
+}
+
+// Service manages API keys.
+type Service struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+}
+
+// NewService creates a new API key Service.
+func NewService(readDB, writeDB *sql.DB) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB}
+}
+
+// Create creates a key named name with the given scopes, valid for ttl (zero
+// means no expiry), and returns it with its secret.
+func (s *Service) Create(name string, scopes []string, createdBy string, ttl time.Duration) (string, *Key, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, fmt.Errorf("名称不能为空")
+	}
+	if len([]rune(name)) > 100 {
+		return "", nil, fmt.Errorf("名称过长")
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	if ttl < 0 || ttl > MaxTTL {
+		return "", nil, fmt.Errorf("有效期无效")
+	}
+
+	raw := make([]byte, keyBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	secret := keyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, fmt.Errorf("failed to generate key ID: %w", err)
+	}
+
+	now := time.Now().UTC()
+	k := &Key{
+		ID:        hex.EncodeToString(idBytes),
+		Name:      name,
+		Prefix:    secret[:displayLen],
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+	}
+	var expiresAt interface{}
+	if ttl > 0 {
+		t := now.Add(ttl)
+		k.ExpiresAt = &t
+		expiresAt = t
+	}
+	_, err = s.writeDB.Exec(
+		`INSERT INTO api_keys (id, name, key_prefix, key_hash, scopes, created_by, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		k.ID, k.Name, k.Prefix, hashKey(secret), strings.Join(scopes, ","), createdBy, expiresAt, now,
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+	return secret, k, nil
+}
+
+// List returns all keys, newest first.
+func (s *Service) List() ([]Key, error) {
+	rows, err := s.readDB.Query(`SELECT id, name, key_prefix, scopes, COALESCE(created_by, ''), expires_at, last_used_at, created_at
+		FROM api_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+	keys := []Key{}
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// Delete revokes a key.
+func (s *Service) Delete(id string) error {
+	res, err := s.writeDB.Exec(`DELETE FROM api_keys WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the key whose secret is secret and records its use.
+func (s *Service) Authenticate(secret string) (*Key, error) {
+	if !strings.HasPrefix(secret, keyPrefix) {
+		return nil, ErrInvalid
+	}
+	row := s.readDB.QueryRow(`SELECT id, name, key_prefix, scopes, COALESCE(created_by, ''), expires_at, last_used_at, created_at
+		FROM api_keys WHERE key_hash = ?`, hashKey(secret))
+	k, err := scanKey(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if k.ExpiresAt != nil && now.After(*k.ExpiresAt) {
+		return nil, ErrInvalid
+	}
+	// Integrations call often; a coarse timestamp is enough and spares writes
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= touchInterval {
+		s.writeDB.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, now, k.ID)
+	}
+	return k, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanKey(row scanner) (*Key, error) {
+	var k Key
+	var scopes string
+	var expiresAt, lastUsedAt, createdAt sql.NullTime
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, &scopes, &k.CreatedBy, &expiresAt, &lastUsedAt, &createdAt); err != nil {
+		return nil, err
+	}
+	k.Scopes = []string{}
+	if scopes != "" {
+		k.Scopes = strings.Split(scopes, ",")
+	}
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	k.CreatedAt = createdAt.Time
+	return &k, nil
+}
+
+// normalizeScopes validates scopes and removes duplicates.
+func normalizeScopes(scopes []string) ([]string, error) {
+	valid := make(map[string]bool, len(AllScopes))
+	for _, s := range AllScopes {
+		valid[s] = true
+	}
+	out := make([]string, 0, len(scopes))
+	seen := make(map[string]bool)
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		if !valid[s] {
+			return nil, fmt.Errorf("未知的权限范围: %s", s)
+		}
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("至少选择一个权限范围")
+	}
+	return out, nil
+}
+
+// hashKey returns the hex SHA-256 of a key secret. Keys are long random
+// strings, so a fast hash is as safe as a password hash and allows lookup.
+func hashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
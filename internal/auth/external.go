@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"askflow/internal/config"
+)
+
+// ErrInvalidCredentials is returned by an AuthProvider that rejects the
+// credentials it was given.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// AuthProvider verifies login credentials against a login backend other than
+// OAuth or local accounts, and returns the identity of the user. Credentials
+// are what the user entered, typically "username" and "password".
+type AuthProvider interface {
+	Verify(credentials map[string]string) (*OAuthUser, error)
+}
+
+// HTTPAuthProvider is an AuthProvider backed by an external HTTP verifier.
+// Each login is posted as {"credentials": {...}}; the verifier answers 200
+// with {"id": "...", "email": "...", "name": "..."} for valid credentials
+// (id is required), or 401 or 403 for invalid ones.
+type HTTPAuthProvider struct {
+	name   string
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewHTTPAuthProvider creates an HTTPAuthProvider from the external_auth
+// config.
+func NewHTTPAuthProvider(cfg config.ExternalAuthConfig) *HTTPAuthProvider {
+	return &HTTPAuthProvider{
+		name:   cfg.EffectiveName(),
+		url:    cfg.VerifyURL,
+		secret: cfg.Secret,
+		client: &http.Client{Timeout: cfg.Timeout()},
+	}
+}
+
+// Verify posts credentials to the verifier and returns the identity it
+// reports. Rejected credentials fail with ErrInvalidCredentials.
+func (p *HTTPAuthProvider) Verify(credentials map[string]string) (*OAuthUser, error) {
+	body, err := json.Marshal(map[string]interface{}{"credentials": credentials})
+	if err != nil {
+		return nil, fmt.Errorf("encode credentials: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create verify request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if p.secret != "" {
+		req.Header.Set("Authorization", "Bearer "+p.secret)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("call verifier: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20)) // 1MB limit
+	if err != nil {
+		return nil, fmt.Errorf("read verifier response: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, ErrInvalidCredentials
+	default:
+		return nil, fmt.Errorf("verifier returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var user OAuthUser
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, fmt.Errorf("parse verifier response: %w", err)
+	}
+	user.ID = strings.TrimSpace(user.ID)
+	if user.ID == "" {
+		return nil, fmt.Errorf("verifier response has no user id")
+	}
+	user.Email = strings.TrimSpace(user.Email)
+	user.Name = strings.TrimSpace(user.Name)
+	user.Provider = p.name
+	return &user, nil
+}
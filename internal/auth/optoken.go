@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// OperationTokenTTL is how long an operation token stays valid. It is
+// independent of the session the token was minted with, so a download or
+// media stream that outlives its session keeps working.
+const OperationTokenTTL = 2 * time.Hour
+
+// OperationToken authorizes requests of one method and path, e.g. the range
+// requests of a video or a resumed download, on behalf of a user. It is
+// passed as the op_token query parameter where a header cannot be set.
+// Tokens for methods other than GET change data and authorize a single
+// request, so one seen in a proxy or access log cannot be replayed.
+type OperationToken struct {
+	Token     string    `json:"token"`
+	UserID    string    `json:"-"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// OperationTokens stores operation tokens.
+type OperationTokens struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+}
+
+// NewOperationTokens creates an OperationTokens store.
+func NewOperationTokens(readDB, writeDB *sql.DB) *OperationTokens {
+	return &OperationTokens{readDB: readDB, writeDB: writeDB}
+}
+
+// Issue mints a token for userID that authorizes method and path until
+// OperationTokenTTL from now. The caller checks that the user may perform
+// the operation.
+func (o *OperationTokens) Issue(userID, method, path string) (*OperationToken, error) {
+	token, err := generateSessionID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	t := &OperationToken{Token: token, UserID: userID, Method: method, Path: path, ExpiresAt: now.Add(OperationTokenTTL)}
+	_, err = o.writeDB.Exec(
+		"INSERT INTO operation_tokens (token, user_id, method, path, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		t.Token, userID, method, path, t.ExpiresAt.Format(time.RFC3339), now.Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert operation token: %w", err)
+	}
+	return t, nil
+}
+
+// Verify returns the user a token was issued to, if it is valid for method
+// and path and the user account still exists. A token for a method other
+// than GET is used up by the first request it verifies.
+func (o *OperationTokens) Verify(token, method, path string) (string, error) {
+	var userID, tokMethod, tokPath, expiresAtStr string
+	var exists bool
+	err := o.readDB.QueryRow(
+		`SELECT t.user_id, t.method, t.path, t.expires_at, u.id IS NOT NULL
+		 FROM operation_tokens t LEFT JOIN users u ON u.id = t.user_id WHERE t.token = ?`, token,
+	).Scan(&userID, &tokMethod, &tokPath, &expiresAtStr, &exists)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("operation token not found")
+	}
+	if err != nil {
+		return "", fmt.Errorf("query operation token: %w", err)
+	}
+	if !exists {
+		return "", fmt.Errorf("operation token user no longer exists")
+	}
+	expiresAt, err := parseSessionTime(expiresAtStr)
+	if err != nil {
+		return "", fmt.Errorf("parse expires_at: %w", err)
+	}
+	if time.Now().UTC().After(expiresAt) {
+		return "", fmt.Errorf("operation token expired")
+	}
+	if tokMethod != method || tokPath != path {
+		return "", fmt.Errorf("operation token not valid for this request")
+	}
+	if method != http.MethodGet {
+		// The row stays until it expires so Revoked keeps reporting on the
+		// request that used it
+		result, err := o.writeDB.Exec(
+			"UPDATE operation_tokens SET used_at = ? WHERE token = ? AND used_at IS NULL",
+			time.Now().UTC().Format(time.RFC3339), token,
+		)
+		if err != nil {
+			return "", fmt.Errorf("use operation token: %w", err)
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return "", fmt.Errorf("operation token already used")
+		}
+	}
+	return userID, nil
+}
+
+// Revoked reports whether token no longer authorizes anything: it was
+// revoked, removed after expiring, or its user was deleted.
+func (o *OperationTokens) Revoked(token string) bool {
+	var n int
+	err := o.readDB.QueryRow(
+		`SELECT COUNT(*) FROM operation_tokens t JOIN users u ON u.id = t.user_id WHERE t.token = ?`, token,
+	).Scan(&n)
+	return err == nil && n == 0
+}
+
+// RevokeUser deletes the tokens of a user, e.g. when they sign out, their
+// password is reset or their account is banned or deleted.
+func (o *OperationTokens) RevokeUser(userID string) error {
+	if _, err := o.writeDB.Exec("DELETE FROM operation_tokens WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("delete operation tokens: %w", err)
+	}
+	return nil
+}
+
+// CleanExpired removes expired tokens and returns how many were removed.
+func (o *OperationTokens) CleanExpired() (int64, error) {
+	result, err := o.writeDB.Exec("DELETE FROM operation_tokens WHERE expires_at <= ?", time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, fmt.Errorf("delete expired operation tokens: %w", err)
+	}
+	return result.RowsAffected()
+}
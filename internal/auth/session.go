@@ -8,21 +8,27 @@ import (
 	"sync"
 	"time"
 
+	"askflow/internal/config"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
-// DefaultSessionExpiry is the default session duration (24 hours).
-const DefaultSessionExpiry = 24 * time.Hour
-
 // sessionCacheSize is the maximum number of sessions to cache in memory.
 const sessionCacheSize = 1024
 
-// Session represents a user session stored in the database.
+// sessionTouchInterval limits how often a session's activity is written.
+const sessionTouchInterval = time.Minute
+
+// Session represents a user session stored in the database. ExpiresAt moves
+// forward with activity (see SessionManager.ValidateSession) up to
+// MaxExpiresAt.
 type Session struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	ExpiresAt time.Time `json:"expires_at"`
-	CreatedAt time.Time `json:"created_at"`
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	MaxExpiresAt time.Time `json:"max_expires_at"`
+	LastActivity time.Time `json:"last_activity"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 // sessionCacheEntry wraps a cached session with a fetch timestamp for TTL.
@@ -35,7 +41,7 @@ type sessionCacheEntry struct {
 type SessionManager struct {
 	readDB  *sql.DB
 	writeDB *sql.DB
-	expiry  time.Duration
+	policy  func() config.SessionConfig
 
 	// In-memory LRU-like cache for ValidateSession hot path.
 	// Key: session ID, Value: sessionCacheEntry.
@@ -45,16 +51,16 @@ type SessionManager struct {
 	cacheTTL time.Duration
 }
 
-// NewSessionManager creates a SessionManager with the given database and expiry duration.
-// If expiry is zero, DefaultSessionExpiry is used.
-func NewSessionManager(readDB, writeDB *sql.DB, expiry time.Duration) *SessionManager {
-	if expiry <= 0 {
-		expiry = DefaultSessionExpiry
+// NewSessionManager creates a SessionManager with the given database. policy
+// returns the current session lifetimes; if nil, the defaults are used.
+func NewSessionManager(readDB, writeDB *sql.DB, policy func() config.SessionConfig) *SessionManager {
+	if policy == nil {
+		policy = func() config.SessionConfig { return config.SessionConfig{} }
 	}
 	return &SessionManager{
 		readDB:   readDB,
 		writeDB:  writeDB,
-		expiry:   expiry,
+		policy:   policy,
 		cache:    make(map[string]sessionCacheEntry, sessionCacheSize),
 		cacheTTL: 2 * time.Minute,
 	}
@@ -68,66 +74,85 @@ func (sm *SessionManager) CreateSession(userID string) (*Session, error) {
 	}
 
 	now := time.Now().UTC()
-	expiresAt := now.Add(sm.expiry)
+	s := &Session{
+		ID:           id,
+		UserID:       userID,
+		LastActivity: now,
+		CreatedAt:    now,
+	}
+	sm.applyPolicy(s)
 
 	_, err = sm.writeDB.Exec(
-		"INSERT INTO sessions (id, user_id, expires_at, created_at) VALUES (?, ?, ?, ?)",
-		id, userID, expiresAt.Format(time.RFC3339), now.Format(time.RFC3339),
+		"INSERT INTO sessions (id, user_id, expires_at, last_activity, created_at) VALUES (?, ?, ?, ?, ?)",
+		id, userID, s.ExpiresAt.Format(time.RFC3339), now.Format(time.RFC3339), now.Format(time.RFC3339),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("insert session: %w", err)
 	}
 
-	s := &Session{
-		ID:        id,
-		UserID:    userID,
-		ExpiresAt: expiresAt,
-		CreatedAt: now,
-	}
-
 	// Pre-populate cache for the new session
 	sm.cacheSet(id, s)
 
 	return s, nil
 }
 
-// ValidateSession checks if a session exists and has not expired.
-// Returns the session if valid, or an error if not found or expired.
-// Uses an in-memory cache to avoid DB hits on every authenticated request.
+// ValidateSession checks if a session exists and has not expired, and
+// records the activity: the session then lasts for the idle timeout from now,
+// capped at its maximum lifetime. Returns the session if valid, or an error
+// if not found or expired. Uses an in-memory cache to avoid DB hits on every
+// authenticated request.
 func (sm *SessionManager) ValidateSession(sessionID string) (*Session, error) {
-	// Check cache first
-	if s, ok := sm.cacheGet(sessionID); ok {
-		// Re-validate expiry on cached session
-		if time.Now().UTC().After(s.ExpiresAt) {
-			sm.cacheDelete(sessionID)
-			return nil, fmt.Errorf("session expired")
-		}
-		const maxSessionAge = 7 * 24 * time.Hour
-		if time.Now().UTC().Sub(s.CreatedAt) > maxSessionAge {
-			sm.cacheDelete(sessionID)
-			sm.writeDB.Exec("DELETE FROM sessions WHERE id = ?", sessionID)
-			return nil, fmt.Errorf("session expired (max age)")
-		}
-		// Sliding window: extend session expiry on each successful validation
-		remaining := time.Until(s.ExpiresAt)
-		if remaining < sm.expiry/2 {
-			newExpiry := time.Now().UTC().Add(sm.expiry)
-			sm.writeDB.Exec("UPDATE sessions SET expires_at = ? WHERE id = ?",
-				newExpiry.Format(time.RFC3339), sessionID)
-			s.ExpiresAt = newExpiry
-			sm.cacheSet(sessionID, s)
+	s, ok := sm.cacheGet(sessionID)
+	if !ok {
+		var err error
+		s, err = sm.loadSession(sessionID)
+		if err != nil {
+			return nil, err
 		}
-		return s, nil
 	}
 
-	// Cache miss: query from read DB
+	// Expiry is recomputed from the current policy so that changed timeouts
+	// also apply to existing sessions. s is this request's own copy, never
+	// the cached entry, which only cacheSet replaces under cacheMu.
+	sm.applyPolicy(s)
+	now := time.Now().UTC()
+	if now.After(s.ExpiresAt) {
+		sm.cacheDelete(sessionID)
+		sm.writeDB.Exec("DELETE FROM sessions WHERE id = ?", sessionID)
+		return nil, fmt.Errorf("session expired")
+	}
+
+	// Writes are coarse: activity within sessionTouchInterval is not recorded
+	if now.Sub(s.LastActivity) >= sessionTouchInterval {
+		s.LastActivity = now
+		sm.applyPolicy(s)
+		sm.writeDB.Exec("UPDATE sessions SET last_activity = ?, expires_at = ? WHERE id = ?",
+			now.Format(time.RFC3339), s.ExpiresAt.Format(time.RFC3339), sessionID)
+	}
+	sm.cacheSet(sessionID, s)
+	return s, nil
+}
+
+// applyPolicy sets the expiry times of s from its creation and last activity.
+func (sm *SessionManager) applyPolicy(s *Session) {
+	p := sm.policy()
+	s.MaxExpiresAt = s.CreatedAt.Add(p.MaxLifetime())
+	s.ExpiresAt = s.LastActivity.Add(p.IdleTimeout())
+	if s.ExpiresAt.After(s.MaxExpiresAt) {
+		s.ExpiresAt = s.MaxExpiresAt
+	}
+}
+
+// loadSession reads a session from the database.
+func (sm *SessionManager) loadSession(sessionID string) (*Session, error) {
 	var s Session
 	var expiresAtStr, createdAtStr string
+	var lastActivityStr sql.NullString
 
 	err := sm.readDB.QueryRow(
-		"SELECT id, user_id, expires_at, created_at FROM sessions WHERE id = ?",
+		"SELECT id, user_id, expires_at, last_activity, created_at FROM sessions WHERE id = ?",
 		sessionID,
-	).Scan(&s.ID, &s.UserID, &expiresAtStr, &createdAtStr)
+	).Scan(&s.ID, &s.UserID, &expiresAtStr, &lastActivityStr, &createdAtStr)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("session not found")
 	}
@@ -135,47 +160,39 @@ func (sm *SessionManager) ValidateSession(sessionID string) (*Session, error) {
 		return nil, fmt.Errorf("query session: %w", err)
 	}
 
-	expiresAt, err := time.Parse(time.RFC3339, expiresAtStr)
+	createdAt, err := parseSessionTime(createdAtStr)
 	if err != nil {
-		expiresAt, err = time.Parse("2006-01-02T15:04:05Z", expiresAtStr)
+		return nil, fmt.Errorf("parse created_at: %w", err)
+	}
+	s.CreatedAt = createdAt
+	if lastActivityStr.Valid && lastActivityStr.String != "" {
+		s.LastActivity, err = parseSessionTime(lastActivityStr.String)
 		if err != nil {
-			return nil, fmt.Errorf("parse expires_at: %w", err)
+			return nil, fmt.Errorf("parse last_activity: %w", err)
 		}
+		return &s, nil
 	}
-	s.ExpiresAt = expiresAt
 
-	createdAt, err := time.Parse(time.RFC3339, createdAtStr)
+	// Sessions from before activity tracking: their expiry was last set to
+	// the idle timeout from their latest activity
+	expiresAt, err := parseSessionTime(expiresAtStr)
 	if err != nil {
-		createdAt, err = time.Parse("2006-01-02T15:04:05Z", createdAtStr)
-		if err != nil {
-			return nil, fmt.Errorf("parse created_at: %w", err)
-		}
+		return nil, fmt.Errorf("parse expires_at: %w", err)
 	}
-	s.CreatedAt = createdAt
-
-	if time.Now().UTC().After(s.ExpiresAt) {
-		return nil, fmt.Errorf("session expired")
-	}
-
-	const maxSessionAge = 7 * 24 * time.Hour
-	if time.Now().UTC().Sub(s.CreatedAt) > maxSessionAge {
-		sm.writeDB.Exec("DELETE FROM sessions WHERE id = ?", sessionID)
-		return nil, fmt.Errorf("session expired (max age)")
+	s.LastActivity = expiresAt.Add(-sm.policy().IdleTimeout())
+	if s.LastActivity.Before(createdAt) {
+		s.LastActivity = createdAt
 	}
+	return &s, nil
+}
 
-	// Sliding window: extend session expiry on each successful validation
-	remaining := time.Until(s.ExpiresAt)
-	if remaining < sm.expiry/2 {
-		newExpiry := time.Now().UTC().Add(sm.expiry)
-		sm.writeDB.Exec("UPDATE sessions SET expires_at = ? WHERE id = ?",
-			newExpiry.Format(time.RFC3339), sessionID)
-		s.ExpiresAt = newExpiry
+// parseSessionTime parses a timestamp of the sessions table.
+func parseSessionTime(v string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		t, err = time.Parse("2006-01-02T15:04:05Z", v)
 	}
-
-	// Cache the valid session
-	sm.cacheSet(sessionID, &s)
-
-	return &s, nil
+	return t, err
 }
 
 // CleanExpired removes all expired sessions from the database.
@@ -253,6 +270,12 @@ func generateSessionID() (string, error) {
 func (sm *SessionManager) cacheGet(sessionID string) (*Session, bool) {
 	sm.cacheMu.RLock()
 	entry, ok := sm.cache[sessionID]
+	var s Session
+	if ok {
+		// Copied under the lock so the caller owns its session: requests
+		// for the same session must not share one *Session
+		s = *entry.session
+	}
 	sm.cacheMu.RUnlock()
 	if !ok {
 		return nil, false
@@ -262,8 +285,6 @@ func (sm *SessionManager) cacheGet(sessionID string) (*Session, bool) {
 		sm.cacheDelete(sessionID)
 		return nil, false
 	}
-	// Return a copy to avoid data races on the caller side
-	s := *entry.session
 	return &s, true
 }
 
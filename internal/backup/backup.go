@@ -3,23 +3,34 @@
 // Backup strategy (data-level, not file-level):
 //
 //	Full mode:
-//	  - SQLite online backup API for a consistent DB snapshot
+//	  - VACUUM INTO snapshot of the DB: consistent while the service is
+//	    running and streamed into the archive from a temporary file
 //	  - All upload files
 //	  - Config + encryption key
 //
 //	Incremental mode:
-//	  - Insert-only tables (documents, chunks, video_segments, admin_users):
+//	  - Insert-only tables (documents, chunks, video_segments, video_chapters, chunk_translations, image_refs, chunk_locations, document_texts, feed_items, admin_users, answer_audits):
 //	    export only rows with created_at > last backup time
-//	  - Mutable tables (pending_questions, users, products, admin_user_products):
+//	  - Mutable tables (pending_questions, users, products, admin_user_products, feeds, glossary_terms, troubleshooting_flows, shared_answers, document_tags, chat_history, api_keys):
 //	    full table dump (rows may be updated)
-//	  - Ephemeral tables (sessions, email_tokens): skipped
+//	  - All tables are read in one transaction and the SQL is spooled row by
+//	    row to a temporary file, so memory use does not grow with the DB
+//	  - Ephemeral tables (sessions, email_tokens, chat_states): skipped
 //	  - Upload files: only new directories since last backup
 //	  - Config + encryption key: always included
 //
+//	Both modes:
+//	  - Storage partitions of products with isolated storage: a snapshot of
+//	    each partition DB, like the main DB in full mode
+//	  - Optional upload of the archive and manifest to S3-compatible object
+//	    storage (backup.s3 in config); Restore accepts archives downloaded
+//	    from there with Download
+//
 // Archive layout (tar.gz):
 //
 //	askflow.db              — full DB copy (full mode only)
 //	db_delta.sql             — SQL statements for changed data (incremental only)
+//	partitions/<id>.db       — chunks of a product with isolated storage
 //	uploads/<hash>/file      — uploaded document files
 //	config.json              — system configuration
 //	encryption.key           — AES encryption key
@@ -27,6 +38,7 @@ package backup
 
 import (
 	"archive/tar"
+	"bufio"
 	"compress/gzip"
 	"database/sql"
 	"encoding/json"
@@ -36,6 +48,10 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"askflow/internal/config"
+	"askflow/internal/datadir"
+	"askflow/internal/textutil"
 )
 
 // Manifest records backup metadata and is saved alongside the archive.
@@ -44,6 +60,7 @@ type Manifest struct {
 	Mode        string         `json:"mode"`                  // "full" or "incremental"
 	BasedOn     string         `json:"based_on,omitempty"`    // parent manifest (incremental)
 	UploadDirs  []string       `json:"upload_dirs"`           // upload subdirs included
+	Partitions  []string       `json:"partitions,omitempty"`  // product storage partitions included
 	DBRowCounts map[string]int `json:"db_row_counts"`         // table -> rows exported
 	DataDir     string         `json:"data_dir"`              // original data directory path
 }
@@ -54,6 +71,10 @@ type Options struct {
 	OutputDir  string // output directory for archive (default ".")
 	Mode       string // "full" or "incremental"
 	ManifestIn string // previous manifest path (required for incremental)
+	TempDir    string // directory for temporary snapshot files (default OutputDir)
+	// S3 is an object storage the archive and manifest are uploaded to after
+	// they are written, unless it is not configured.
+	S3 config.S3Config
 }
 
 // Result holds backup results.
@@ -63,13 +84,17 @@ type Result struct {
 	FilesWritten int
 	DBRows       int
 	BytesWritten int64
+	// RemoteArchive and RemoteManifest are the s3:// locations of the
+	// uploaded archive and manifest, if uploaded.
+	RemoteArchive  string
+	RemoteManifest string
 }
 
 // insertOnlyTables are append-only; incremental exports rows by created_at.
-var insertOnlyTables = []string{"documents", "chunks", "video_segments", "admin_users"}
+var insertOnlyTables = []string{"documents", "chunks", "video_segments", "video_chapters", "chunk_translations", "image_refs", "chunk_locations", "document_texts", "feed_items", "admin_users", "answer_audits"}
 
 // mutableTables may have row updates; incremental does full dump of these.
-var mutableTables = []string{"pending_questions", "users", "products", "admin_user_products"}
+var mutableTables = []string{"pending_questions", "users", "products", "admin_user_products", "feeds", "glossary_terms", "troubleshooting_flows", "shared_answers", "document_tags", "chat_history", "api_keys"}
 
 // allDataTables is the union used for full backup SQL export verification.
 // Built via explicit concatenation to avoid mutating insertOnlyTables' underlying array.
@@ -80,11 +105,9 @@ var allDataTables = func() []string {
 	return all
 }()
 
-// Run executes a backup.
+// Run executes a backup into an archive and manifest in opts.OutputDir and
+// uploads them to opts.S3 when configured.
 func Run(db *sql.DB, opts Options) (*Result, error) {
-	if opts.DataDir == "" {
-		opts.DataDir = "./data"
-	}
 	if opts.OutputDir == "" {
 		opts.OutputDir = "."
 	}
@@ -92,40 +115,86 @@ func Run(db *sql.DB, opts Options) (*Result, error) {
 		opts.Mode = "full"
 	}
 
-	// Checkpoint WAL for consistency
-	if db != nil {
-		if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
-			fmt.Printf("警告: WAL checkpoint 失败: %v\n", err)
+	now := time.Now()
+	archivePath := filepath.Join(opts.OutputDir, ArchiveName(opts.Mode, now))
+	manifestPath := strings.TrimSuffix(archivePath, ".tar.gz") + ".manifest.json"
+
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("创建归档文件失败: %w", err)
+	}
+	manifest, result, err := write(out, db, opts, now)
+	if err == nil {
+		err = out.Close()
+	} else {
+		out.Close()
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return nil, err
+	}
+	result.ArchivePath, result.ManifestPath = archivePath, manifestPath
+
+	// Save manifest alongside archive, then upload both to object storage
+	manifestData, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := datadir.WriteFile(manifestPath, manifestData); err != nil {
+		return nil, fmt.Errorf("保存 manifest 失败: %w", err)
+	}
+	if opts.S3.Enabled() {
+		result.RemoteArchive, result.RemoteManifest, err = upload(opts.S3, archivePath, manifestPath)
+		if err != nil {
+			return nil, fmt.Errorf("上传到对象存储失败（本地归档已保留: %s）: %w", archivePath, err)
 		}
 	}
+	return result, nil
+}
+
+// ArchiveName returns the file name of an archive made at t:
+// askflow_<mode>_<hostname>_<timestamp>.tar.gz.
+func ArchiveName(mode string, t time.Time) string {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "local"
+	}
+	return fmt.Sprintf("askflow_%s_%s_%s.tar.gz", mode, hostname, t.Format("20060102-150405"))
+}
+
+// Write writes a backup archive to out without saving or uploading anything,
+// e.g. to stream it as a download, and returns its manifest, which is also
+// embedded in the archive. Temporary files go to opts.TempDir.
+func Write(out io.Writer, db *sql.DB, opts Options) (*Manifest, *Result, error) {
+	if opts.Mode == "" {
+		opts.Mode = "full"
+	}
+	return write(out, db, opts, time.Now())
+}
+
+// write writes the archive of a backup made at now to out.
+func write(out io.Writer, db *sql.DB, opts Options, now time.Time) (*Manifest, *Result, error) {
+	if opts.DataDir == "" {
+		opts.DataDir = datadir.Root()
+	}
+	tmpDir := opts.TempDir
+	if tmpDir == "" {
+		tmpDir = opts.OutputDir
+	}
+	if tmpDir == "" {
+		tmpDir = "."
+	}
 
 	// Load previous manifest for incremental
 	var prev *Manifest
 	if opts.Mode == "incremental" {
 		if opts.ManifestIn == "" {
-			return nil, fmt.Errorf("增量备份需要指定基准 manifest (--base)")
+			return nil, nil, fmt.Errorf("增量备份需要指定基准 manifest (--base)")
 		}
 		m, err := loadManifest(opts.ManifestIn)
 		if err != nil {
-			return nil, fmt.Errorf("加载基准 manifest 失败: %w", err)
+			return nil, nil, fmt.Errorf("加载基准 manifest 失败: %w", err)
 		}
 		prev = m
 	}
 
-	now := time.Now()
-	timestamp := now.Format("20060102-150405")
-	modeLabel := opts.Mode
-	hostname, _ := os.Hostname()
-	if hostname == "" {
-		hostname = "local"
-	}
-
-	// Archive name: askflow_<mode>_<hostname>_<timestamp>.tar.gz
-	archiveName := fmt.Sprintf("askflow_%s_%s_%s.tar.gz", modeLabel, hostname, timestamp)
-	manifestName := fmt.Sprintf("askflow_%s_%s_%s.manifest.json", modeLabel, hostname, timestamp)
-	archivePath := filepath.Join(opts.OutputDir, archiveName)
-	manifestPath := filepath.Join(opts.OutputDir, manifestName)
-
 	manifest := &Manifest{
 		Timestamp:   now.Format(time.RFC3339),
 		Mode:        opts.Mode,
@@ -137,18 +206,12 @@ func Run(db *sql.DB, opts Options) (*Result, error) {
 		manifest.BasedOn = opts.ManifestIn
 	}
 
-	out, err := os.Create(archivePath)
-	if err != nil {
-		return nil, fmt.Errorf("创建归档文件失败: %w", err)
-	}
-	defer out.Close()
-
 	gw := gzip.NewWriter(out)
 	defer gw.Close()
 	tw := tar.NewWriter(gw)
 	defer tw.Close()
 
-	result := &Result{ArchivePath: archivePath, ManifestPath: manifestPath}
+	result := &Result{}
 
 	// 1. Config + encryption key (always)
 	for _, name := range []string{"config.json", "encryption.key"} {
@@ -156,7 +219,7 @@ func Run(db *sql.DB, opts Options) (*Result, error) {
 		if _, err := os.Stat(p); err == nil {
 			n, err := addFileToTar(tw, p, name)
 			if err != nil {
-				return nil, fmt.Errorf("添加 %s 失败: %w", name, err)
+				return nil, nil, fmt.Errorf("添加 %s 失败: %w", name, err)
 			}
 			result.BytesWritten += n
 			result.FilesWritten++
@@ -165,44 +228,47 @@ func Run(db *sql.DB, opts Options) (*Result, error) {
 
 	// 2. Database
 	if opts.Mode == "full" {
-		// Full: copy the entire DB file
+		// Full: a snapshot of the DB, with row counts taken from the
+		// snapshot for reference
 		dbPath := filepath.Join(opts.DataDir, "askflow.db")
 		if _, err := os.Stat(dbPath); err == nil {
-			n, err := addFileToTar(tw, dbPath, "askflow.db")
+			n, err := addDBSnapshot(tw, db, dbPath, tmpDir, "askflow.db", func(snap *sql.DB) {
+				for _, t := range allDataTables {
+					if cnt, err := countRows(snap, t); err == nil {
+						manifest.DBRowCounts[t] = cnt
+						result.DBRows += cnt
+					}
+				}
+			})
 			if err != nil {
-				return nil, fmt.Errorf("添加数据库失败: %w", err)
+				return nil, nil, fmt.Errorf("添加数据库失败: %w", err)
 			}
 			result.BytesWritten += n
 			result.FilesWritten++
-			// Record row counts for reference
-			for _, t := range allDataTables {
-				if cnt, err := countRows(db, t); err == nil {
-					manifest.DBRowCounts[t] = cnt
-					result.DBRows += cnt
-				}
-			}
 		}
 	} else {
-		// Incremental: generate SQL delta
-		sinceTime := prev.Timestamp
-		sqlData, rowCounts, err := generateDeltaSQL(db, sinceTime)
+		// Incremental: SQL delta
+		n, rowCounts, err := addDeltaSQL(tw, db, prev.Timestamp, tmpDir)
 		if err != nil {
-			return nil, fmt.Errorf("生成增量 SQL 失败: %w", err)
-		}
-		if len(sqlData) > 0 {
-			n, err := addBytesToTar(tw, sqlData, "db_delta.sql")
-			if err != nil {
-				return nil, fmt.Errorf("添加增量 SQL 失败: %w", err)
-			}
-			result.BytesWritten += n
-			result.FilesWritten++
+			return nil, nil, fmt.Errorf("生成增量 SQL 失败: %w", err)
 		}
+		result.BytesWritten += n
+		result.FilesWritten++
 		manifest.DBRowCounts = rowCounts
 		for _, c := range rowCounts {
 			result.DBRows += c
 		}
 	}
 
+	// 2b. Storage partitions: always copied whole, they have no delta export
+	partitions, n, err := addPartitions(tw, opts.DataDir, tmpDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("添加产品独立存储失败: %w", err)
+	}
+	manifest.Partitions = partitions
+	result.BytesWritten += n
+	result.FilesWritten += len(partitions)
+
 	// 3. Upload files
 	uploadsDir := filepath.Join(opts.DataDir, "uploads")
 	if info, err := os.Stat(uploadsDir); err == nil && info.IsDir() {
@@ -215,7 +281,7 @@ func Run(db *sql.DB, opts Options) (*Result, error) {
 
 		entries, err := os.ReadDir(uploadsDir)
 		if err != nil {
-			return nil, fmt.Errorf("读取 uploads 目录失败: %w", err)
+			return nil, nil, fmt.Errorf("读取 uploads 目录失败: %w", err)
 		}
 		for _, entry := range entries {
 			if !entry.IsDir() {
@@ -244,7 +310,7 @@ func Run(db *sql.DB, opts Options) (*Result, error) {
 				return nil
 			})
 			if err != nil {
-				return nil, fmt.Errorf("添加上传文件失败: %w", err)
+				return nil, nil, fmt.Errorf("添加上传文件失败: %w", err)
 			}
 		}
 
@@ -262,29 +328,132 @@ func Run(db *sql.DB, opts Options) (*Result, error) {
 	// 4. Embed manifest in archive
 	manifestData, _ := json.MarshalIndent(manifest, "", "  ")
 	if _, err := addBytesToTar(tw, manifestData, "manifest.json"); err != nil {
-		return nil, fmt.Errorf("嵌入 manifest 失败: %w", err)
+		return nil, nil, fmt.Errorf("嵌入 manifest 失败: %w", err)
 	}
 
-	// 5. Save manifest alongside archive
-	if err := os.WriteFile(manifestPath, manifestData, 0644); err != nil {
-		return nil, fmt.Errorf("保存 manifest 失败: %w", err)
+	if err := tw.Close(); err != nil {
+		return nil, nil, fmt.Errorf("写入归档文件失败: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return nil, nil, fmt.Errorf("写入归档文件失败: %w", err)
 	}
+	return manifest, result, nil
+}
 
-	return result, nil
+// addPartitions adds snapshots of the storage partitions of products with
+// isolated storage to the archive. It returns the product IDs of the
+// partitions added.
+func addPartitions(tw *tar.Writer, dataDir, tmpDir string) ([]string, int64, error) {
+	entries, err := os.ReadDir(filepath.Join(dataDir, "partitions"))
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	var ids []string
+	var written int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".db") {
+			continue
+		}
+		path := filepath.Join(dataDir, "partitions", name)
+		n, err := addDBSnapshot(tw, nil, path, tmpDir, "partitions/"+name, nil)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", name, err)
+		}
+		written += n
+		ids = append(ids, strings.TrimSuffix(name, ".db"))
+	}
+	return ids, written, nil
+}
+
+// addDBSnapshot adds a consistent copy of the SQLite database at dbPath to
+// the archive. db, if not nil, is an open handle to the same database. The
+// copy is made with VACUUM INTO a temporary file in tmpDir: it reads the
+// database in a single read transaction, WAL included, so a running
+// service's writers are not blocked and its uncommitted changes are not
+// captured. The file is then streamed into the archive. inspect, if not
+// nil, is called with the snapshot before it is removed.
+func addDBSnapshot(tw *tar.Writer, db *sql.DB, dbPath, tmpDir, archiveName string, inspect func(snap *sql.DB)) (int64, error) {
+	if db == nil {
+		src, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			return 0, err
+		}
+		defer src.Close()
+		db = src
+	}
+	// VACUUM INTO accepts an existing file only if it is empty
+	tmp, err := os.CreateTemp(tmpDir, ".askflow-snapshot-*.db")
+	if err != nil {
+		return 0, fmt.Errorf("创建快照文件失败: %w", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+	if _, err := db.Exec("VACUUM INTO ?", tmpPath); err != nil {
+		return 0, fmt.Errorf("生成数据库快照失败: %w", err)
+	}
+	if inspect != nil {
+		if snap, err := sql.Open("sqlite3", tmpPath); err == nil {
+			inspect(snap)
+			snap.Close()
+		}
+	}
+	return addFileToTar(tw, tmpPath, archiveName)
 }
 
-// generateDeltaSQL produces INSERT OR REPLACE statements for incremental backup.
-func generateDeltaSQL(db *sql.DB, sinceTime string) ([]byte, map[string]int, error) {
-	var buf strings.Builder
+// addDeltaSQL adds the incremental SQL delta to the archive. The delta is
+// spooled to a temporary file in tmpDir so the size needed for the tar
+// header is known without holding the SQL in memory.
+func addDeltaSQL(tw *tar.Writer, db *sql.DB, sinceTime, tmpDir string) (int64, map[string]int, error) {
+	tmp, err := os.CreateTemp(tmpDir, ".askflow-delta-*.sql")
+	if err != nil {
+		return 0, nil, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriterSize(tmp, 256<<10)
+	rowCounts, err := writeDeltaSQL(w, db, sinceTime)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := addFileToTar(tw, tmp.Name(), "db_delta.sql")
+	return n, rowCounts, err
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// writeDeltaSQL writes INSERT OR REPLACE statements for incremental backup
+// to w, one row at a time. All tables are read in one transaction so the
+// delta is consistent while the service keeps writing. Write errors are
+// kept by w and reported by its Flush.
+func writeDeltaSQL(w *bufio.Writer, db *sql.DB, sinceTime string) (map[string]int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
 	rowCounts := make(map[string]int)
 
-	buf.WriteString("-- Askflow incremental backup delta\n")
-	buf.WriteString(fmt.Sprintf("-- Since: %s\n\n", sinceTime))
-	buf.WriteString("BEGIN TRANSACTION;\n\n")
+	w.WriteString("-- Askflow incremental backup delta\n")
+	fmt.Fprintf(w, "-- Since: %s\n\n", sinceTime)
+	w.WriteString("BEGIN TRANSACTION;\n\n")
 
 	// Insert-only tables: export rows created after sinceTime
 	for _, table := range insertOnlyTables {
-		cols, err := getColumns(db, table)
+		cols, err := getColumns(tx, table)
 		if err != nil {
 			continue // table may not exist yet
 		}
@@ -309,14 +478,14 @@ func generateDeltaSQL(db *sql.DB, sinceTime string) ([]byte, map[string]int, err
 			}
 		}
 
-		rows, err := db.Query(query, sinceTime)
+		rows, err := tx.Query(query, sinceTime)
 		if err != nil {
-			return nil, nil, fmt.Errorf("查询表 %s 失败: %w", table, err)
+			return nil, fmt.Errorf("查询表 %s 失败: %w", table, err)
 		}
-		count, err := writeInserts(&buf, table, cols, rows)
+		count, err := writeInserts(w, table, cols, rows)
 		rows.Close()
 		if err != nil {
-			return nil, nil, fmt.Errorf("导出表 %s 失败: %w", table, err)
+			return nil, fmt.Errorf("导出表 %s 失败: %w", table, err)
 		}
 		if count > 0 {
 			rowCounts[table] = count
@@ -325,33 +494,33 @@ func generateDeltaSQL(db *sql.DB, sinceTime string) ([]byte, map[string]int, err
 
 	// Mutable tables: full dump (DELETE + INSERT)
 	for _, table := range mutableTables {
-		cols, err := getColumns(db, table)
+		cols, err := getColumns(tx, table)
 		if err != nil {
 			continue
 		}
-		buf.WriteString(fmt.Sprintf("DELETE FROM %s;\n", table))
-		rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s", table))
+		fmt.Fprintf(w, "DELETE FROM %s;\n", table)
+		rows, err := tx.Query(fmt.Sprintf("SELECT * FROM %s", table))
 		if err != nil {
-			return nil, nil, fmt.Errorf("查询表 %s 失败: %w", table, err)
+			return nil, fmt.Errorf("查询表 %s 失败: %w", table, err)
 		}
-		count, err := writeInserts(&buf, table, cols, rows)
+		count, err := writeInserts(w, table, cols, rows)
 		rows.Close()
 		if err != nil {
-			return nil, nil, fmt.Errorf("导出表 %s 失败: %w", table, err)
+			return nil, fmt.Errorf("导出表 %s 失败: %w", table, err)
 		}
 		if count > 0 {
 			rowCounts[table] = count
 		}
-		buf.WriteString("\n")
+		w.WriteString("\n")
 	}
 
-	buf.WriteString("COMMIT;\n")
-	return []byte(buf.String()), rowCounts, nil
+	w.WriteString("COMMIT;\n")
+	return rowCounts, nil
 }
 
 // writeInserts writes INSERT OR REPLACE statements for rows and returns the count.
-func writeInserts(buf *strings.Builder, table string, cols []string, rows *sql.Rows) (int, error) {
-	colList := strings.Join(cols, ", ")
+func writeInserts(w *bufio.Writer, table string, cols []string, rows *sql.Rows) (int, error) {
+	prefix := fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (", table, strings.Join(cols, ", "))
 	count := 0
 	scanDest := make([]interface{}, len(cols))
 	scanPtrs := make([]interface{}, len(cols))
@@ -363,12 +532,14 @@ func writeInserts(buf *strings.Builder, table string, cols []string, rows *sql.R
 		if err := rows.Scan(scanPtrs...); err != nil {
 			return count, err
 		}
-		vals := make([]string, len(cols))
+		w.WriteString(prefix)
 		for i, v := range scanDest {
-			vals[i] = sqlQuote(v)
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			w.WriteString(sqlQuote(v))
 		}
-		buf.WriteString(fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (%s);\n",
-			table, colList, strings.Join(vals, ", ")))
+		w.WriteString(");\n")
 		count++
 	}
 	return count, rows.Err()
@@ -396,13 +567,13 @@ func sqlQuote(v interface{}) string {
 
 // validBackupTables is a whitelist of tables allowed in backup operations.
 var validBackupTables = map[string]bool{
-	"documents": true, "chunks": true, "video_segments": true, "admin_users": true,
-	"pending_questions": true, "users": true, "products": true, "admin_user_products": true,
+	"documents": true, "chunks": true, "video_segments": true, "video_chapters": true, "chunk_translations": true, "image_refs": true, "chunk_locations": true, "document_texts": true, "feed_items": true, "admin_users": true, "answer_audits": true,
+	"pending_questions": true, "users": true, "products": true, "admin_user_products": true, "feeds": true, "glossary_terms": true, "troubleshooting_flows": true, "shared_answers": true, "document_tags": true, "chat_history": true, "api_keys": true,
 	"login_attempts": true, "login_bans": true,
 }
 
 // getColumns returns column names for a table.
-func getColumns(db *sql.DB, table string) ([]string, error) {
+func getColumns(db queryer, table string) ([]string, error) {
 	if !validBackupTables[table] {
 		return nil, fmt.Errorf("invalid table name: %s", table)
 	}
@@ -430,7 +601,7 @@ func getColumns(db *sql.DB, table string) ([]string, error) {
 }
 
 // countRows returns the row count for a table.
-func countRows(db *sql.DB, table string) (int, error) {
+func countRows(db queryer, table string) (int, error) {
 	if !validBackupTables[table] {
 		return 0, fmt.Errorf("invalid table name: %s", table)
 	}
@@ -444,7 +615,7 @@ func countRows(db *sql.DB, table string) (int, error) {
 // The db_delta.sql is NOT auto-executed — it is extracted as a file for the user to review and apply.
 func Restore(archivePath, targetDir string) error {
 	if targetDir == "" {
-		targetDir = "./data"
+		targetDir = datadir.Root()
 	}
 
 	f, err := os.Open(archivePath)
@@ -493,18 +664,18 @@ func Restore(archivePath, targetDir string) error {
 
 		switch header.Typeflag {
 		case tar.TypeDir:
-			if err := os.MkdirAll(target, 0755); err != nil {
+			if err := datadir.MkdirAll(target); err != nil {
 				return fmt.Errorf("创建目录失败 %s: %w", target, err)
 			}
 		case tar.TypeReg:
-			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			if err := datadir.MkdirAll(filepath.Dir(target)); err != nil {
 				return fmt.Errorf("创建目录失败: %w", err)
 			}
 			// Limit individual file extraction to 2GB to prevent zip bombs
 			if header.Size > 2<<30 {
 				return fmt.Errorf("文件过大，跳过: %s (%d bytes)", header.Name, header.Size)
 			}
-			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode)&0755)
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, datadir.FileMode())
 			if err != nil {
 				return fmt.Errorf("创建文件失败 %s: %w", target, err)
 			}
@@ -564,7 +735,7 @@ func RestoreDelta(db *sql.DB, deltaPath string) error {
 			!strings.HasPrefix(upper, "REPLACE ") &&
 			upper != "BEGIN TRANSACTION" &&
 			upper != "COMMIT" {
-			return fmt.Errorf("增量 SQL 包含不允许的语句类型: %s", truncateForLog(trimmed, 50))
+			return fmt.Errorf("增量 SQL 包含不允许的语句类型: %s", textutil.Ellipsize(trimmed, 50))
 		}
 	}
 
@@ -574,14 +745,6 @@ func RestoreDelta(db *sql.DB, deltaPath string) error {
 	return nil
 }
 
-// truncateForLog truncates a string for safe logging.
-func truncateForLog(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
-	}
-	return s[:maxLen] + "..."
-}
-
 // --- tar helpers ---
 
 func addFileToTar(tw *tar.Writer, absPath, archiveName string) (int64, error) {
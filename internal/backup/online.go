@@ -0,0 +1,271 @@
+package backup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"askflow/internal/config"
+	"askflow/internal/datadir"
+	"askflow/internal/errlog"
+)
+
+// keepRuns is the number of online backup records kept for the admin panel.
+const keepRuns = 100
+
+// Targets of an online backup.
+const (
+	TargetServer   = "server"   // saved in the backups directory and uploaded to backup.s3
+	TargetDownload = "download" // streamed to the admin who requested it
+)
+
+// ErrRunning is returned while another online backup is in progress.
+var ErrRunning = errors.New("backup already running")
+
+// Record is one online backup in the history.
+type Record struct {
+	ID            int64     `json:"id"`
+	Mode          string    `json:"mode"`
+	Target        string    `json:"target"`
+	CreatedBy     string    `json:"created_by"`
+	StartedAt     time.Time `json:"started_at"`
+	DurationMs    int64     `json:"duration_ms"`
+	ArchivePath   string    `json:"archive_path,omitempty"`
+	ManifestPath  string    `json:"manifest_path,omitempty"`
+	RemoteArchive string    `json:"remote_archive,omitempty"`
+	SizeBytes     int64     `json:"size_bytes"` // compressed archive size
+	Files         int       `json:"files"`
+	DBRows        int       `json:"db_rows"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Service makes backups while the server is running and records them. The
+// database is read through the read-only pool: snapshots and deltas are
+// taken in a single read transaction, so the service keeps answering
+// queries and writing while a backup runs.
+type Service struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+	s3      func() config.S3Config
+
+	mu      sync.Mutex
+	running bool
+}
+
+// NewService creates an online backup service. s3 returns the current
+// backup object storage so config changes apply without a restart.
+func NewService(readDB, writeDB *sql.DB, s3 func() config.S3Config) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB, s3: s3}
+}
+
+// Dir is where server-side online backups are written.
+func Dir() string {
+	return datadir.Path("backups")
+}
+
+// acquire marks a backup as in progress, or returns ErrRunning.
+func (s *Service) acquire() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return ErrRunning
+	}
+	s.running = true
+	return nil
+}
+
+func (s *Service) release() {
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+}
+
+func validMode(mode string) error {
+	if mode != "full" && mode != "incremental" {
+		return fmt.Errorf("备份模式无效，可选 full 或 incremental")
+	}
+	return nil
+}
+
+// baseManifest returns the manifest of the latest successful server-side
+// backup that still exists, the base of an incremental backup.
+func (s *Service) baseManifest() (string, error) {
+	rows, err := s.readDB.Query(
+		`SELECT manifest_path FROM backup_runs WHERE target = ? AND COALESCE(error, '') = '' AND manifest_path != ''
+		 ORDER BY id DESC LIMIT 10`, TargetServer)
+	if err != nil {
+		return "", fmt.Errorf("failed to query backup history: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("没有可作为基准的服务器端备份，请先执行一次全量备份")
+}
+
+// options returns the backup options of mode, with the base manifest of an
+// incremental backup.
+func (s *Service) options(mode string) (Options, error) {
+	opts := Options{Mode: mode, DataDir: datadir.Root(), OutputDir: Dir()}
+	if err := datadir.MkdirAll(opts.OutputDir); err != nil {
+		return opts, fmt.Errorf("创建备份目录失败: %w", err)
+	}
+	if mode == "incremental" {
+		base, err := s.baseManifest()
+		if err != nil {
+			return opts, err
+		}
+		opts.ManifestIn = base
+	}
+	return opts, nil
+}
+
+// Save writes a backup to the backups directory, uploads it to the backup
+// object storage when configured and records it. It returns ErrRunning if
+// another backup is in progress.
+func (s *Service) Save(mode, createdBy string) (*Record, error) {
+	if err := validMode(mode); err != nil {
+		return nil, err
+	}
+	if err := s.acquire(); err != nil {
+		return nil, err
+	}
+	defer s.release()
+
+	rec := &Record{Mode: mode, Target: TargetServer, CreatedBy: createdBy, StartedAt: time.Now().UTC()}
+	err := func() error {
+		opts, err := s.options(mode)
+		if err != nil {
+			return err
+		}
+		opts.S3 = s.s3()
+		result, err := Run(s.readDB, opts)
+		if err != nil {
+			return err
+		}
+		rec.ArchivePath, rec.ManifestPath = result.ArchivePath, result.ManifestPath
+		rec.RemoteArchive = result.RemoteArchive
+		rec.Files, rec.DBRows = result.FilesWritten, result.DBRows
+		if info, err := os.Stat(result.ArchivePath); err == nil {
+			rec.SizeBytes = info.Size()
+		}
+		return nil
+	}()
+	s.finish(rec, err)
+	return rec, err
+}
+
+// Stream writes a backup archive to w, e.g. an HTTP response, and records
+// it; nothing is kept on the server. An incremental backup is based on the
+// latest server-side backup. It returns ErrRunning if another backup is in
+// progress; Record.SizeBytes tells whether anything was written to w.
+func (s *Service) Stream(w io.Writer, mode, createdBy string) (*Record, error) {
+	if err := validMode(mode); err != nil {
+		return nil, err
+	}
+	if err := s.acquire(); err != nil {
+		return nil, err
+	}
+	defer s.release()
+
+	rec := &Record{Mode: mode, Target: TargetDownload, CreatedBy: createdBy, StartedAt: time.Now().UTC()}
+	err := func() error {
+		opts, err := s.options(mode)
+		if err != nil {
+			return err
+		}
+		opts.TempDir, opts.OutputDir = opts.OutputDir, ""
+		cw := &countingWriter{w: w}
+		_, result, err := Write(cw, s.readDB, opts)
+		rec.SizeBytes = cw.n
+		if err != nil {
+			return err
+		}
+		rec.Files, rec.DBRows = result.FilesWritten, result.DBRows
+		return nil
+	}()
+	s.finish(rec, err)
+	return rec, err
+}
+
+// finish logs and records a backup.
+func (s *Service) finish(rec *Record, err error) {
+	rec.DurationMs = time.Since(rec.StartedAt).Milliseconds()
+	if err != nil {
+		rec.Error = err.Error()
+		errlog.Logf("[Backup] %s %s backup failed: %v", rec.Mode, rec.Target, err)
+	} else {
+		log.Printf("[Backup] %s %s backup done in %dms: files=%d db_rows=%d size=%d",
+			rec.Mode, rec.Target, rec.DurationMs, rec.Files, rec.DBRows, rec.SizeBytes)
+	}
+	res, dbErr := s.writeDB.Exec(
+		`INSERT INTO backup_runs (mode, target, created_by, started_at, duration_ms, archive_path, manifest_path,
+			remote_archive, size_bytes, files, db_rows, error)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.Mode, rec.Target, rec.CreatedBy, rec.StartedAt, rec.DurationMs, rec.ArchivePath, rec.ManifestPath,
+		rec.RemoteArchive, rec.SizeBytes, rec.Files, rec.DBRows, rec.Error,
+	)
+	if dbErr != nil {
+		log.Printf("[Backup] failed to record backup: %v", dbErr)
+		return
+	}
+	rec.ID, _ = res.LastInsertId()
+	if _, dbErr := s.writeDB.Exec(`DELETE FROM backup_runs WHERE id NOT IN (SELECT id FROM backup_runs ORDER BY id DESC LIMIT ?)`, keepRuns); dbErr != nil {
+		log.Printf("[Backup] failed to prune backup history: %v", dbErr)
+	}
+}
+
+// Running reports whether a backup is in progress.
+func (s *Service) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// History returns the most recent backups, newest first.
+func (s *Service) History(limit int) ([]Record, error) {
+	rows, err := s.readDB.Query(
+		`SELECT id, mode, target, COALESCE(created_by, ''), started_at, duration_ms, COALESCE(archive_path, ''),
+			COALESCE(manifest_path, ''), COALESCE(remote_archive, ''), size_bytes, files, db_rows, COALESCE(error, '')
+		 FROM backup_runs ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query backup history: %w", err)
+	}
+	defer rows.Close()
+	records := []Record{}
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(&r.ID, &r.Mode, &r.Target, &r.CreatedBy, &r.StartedAt, &r.DurationMs, &r.ArchivePath,
+			&r.ManifestPath, &r.RemoteArchive, &r.SizeBytes, &r.Files, &r.DBRows, &r.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan backup record: %w", err)
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
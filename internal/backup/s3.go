@@ -0,0 +1,258 @@
+package backup
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"askflow/internal/config"
+)
+
+// s3Scheme prefixes object storage locations, e.g. s3://bucket/key.
+const s3Scheme = "s3://"
+
+// s3Timeout bounds a single object transfer; archives can be large.
+const s3Timeout = 2 * time.Hour
+
+// IsS3URI reports whether location names an object in object storage.
+func IsS3URI(location string) bool {
+	return strings.HasPrefix(location, s3Scheme)
+}
+
+// ParseS3URI splits s3://bucket/key into its bucket and key.
+func ParseS3URI(uri string) (bucket, key string, err error) {
+	if !IsS3URI(uri) {
+		return "", "", fmt.Errorf("不是对象存储地址: %s", uri)
+	}
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(uri, s3Scheme), "/")
+	if bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return "", "", fmt.Errorf("对象存储地址格式应为 s3://<bucket>/<key>: %s", uri)
+	}
+	return bucket, key, nil
+}
+
+// s3Client uploads and downloads objects of an S3-compatible object storage
+// with AWS Signature Version 4. Objects are transferred with a single request,
+// so an object is limited to the single-PUT size of the service (5 GB on S3).
+type s3Client struct {
+	cfg      config.S3Config
+	endpoint *url.URL
+	http     *http.Client
+}
+
+func newS3Client(cfg config.S3Config) (*s3Client, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("未配置对象存储 endpoint (backup.s3.endpoint)")
+	}
+	u, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("对象存储 endpoint 无效: %s", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &s3Client{cfg: cfg, endpoint: u, http: &http.Client{Timeout: s3Timeout}}, nil
+}
+
+// objectURL returns the URL of key in bucket, virtual-hosted unless the
+// client is configured for path-style addressing.
+func (c *s3Client) objectURL(bucket, key string) *url.URL {
+	u := *c.endpoint
+	escaped := s3EscapePath(key)
+	if c.cfg.PathStyle {
+		u.Path = u.Path + "/" + bucket + "/" + key
+		u.RawPath = c.endpoint.EscapedPath() + "/" + s3EscapePath(bucket) + "/" + escaped
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+		u.RawPath = c.endpoint.EscapedPath() + "/" + escaped
+	}
+	return &u
+}
+
+// putFile uploads the local file at localPath as key in bucket.
+func (c *s3Client) putFile(bucket, key, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// The payload hash is part of the signature, so the file is read twice
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, c.objectURL(bucket, key).String(), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	c.sign(req, hex.EncodeToString(h.Sum(nil)))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// getFile downloads key in bucket to the local file at localPath.
+func (c *s3Client) getFile(bucket, key, localPath string) error {
+	req, err := http.NewRequest(http.MethodGet, c.objectURL(bucket, key).String(), nil)
+	if err != nil {
+		return err
+	}
+	c.sign(req, emptyPayloadHash)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	out, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		os.Remove(localPath)
+		return err
+	}
+	return out.Close()
+}
+
+// emptyPayloadHash is the hex SHA-256 of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds the AWS Signature Version 4 authorization headers to req.
+func (c *s3Client) sign(req *http.Request, payloadHash string) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"", // no query string
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + c.cfg.Region + "/s3/aws4_request"
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretKey), day)
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// s3EscapePath URI-encodes an object key as SigV4 expects: every byte except
+// unreserved characters and '/' is percent-encoded.
+func s3EscapePath(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		ch := key[i]
+		if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || ch == '/' {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// s3Error turns an error response of the object storage into an error,
+// including the start of its XML error document.
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("对象存储返回 %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+// upload uploads the archive and manifest of a backup under the configured
+// prefix and returns their s3:// locations.
+func upload(cfg config.S3Config, archivePath, manifestPath string) (archiveURI, manifestURI string, err error) {
+	c, err := newS3Client(cfg)
+	if err != nil {
+		return "", "", err
+	}
+	prefix := strings.Trim(cfg.Prefix, "/")
+	keyFor := func(p string) string { return path.Join(prefix, filepath.Base(p)) }
+	if err := c.putFile(cfg.Bucket, keyFor(archivePath), archivePath); err != nil {
+		return "", "", fmt.Errorf("上传归档文件失败: %w", err)
+	}
+	if err := c.putFile(cfg.Bucket, keyFor(manifestPath), manifestPath); err != nil {
+		return "", "", fmt.Errorf("上传 manifest 失败: %w", err)
+	}
+	return s3Scheme + cfg.Bucket + "/" + keyFor(archivePath), s3Scheme + cfg.Bucket + "/" + keyFor(manifestPath), nil
+}
+
+// PutFile uploads localPath to key in the configured bucket and returns its
+// s3:// location. Other features reuse the backup object storage with it.
+func PutFile(cfg config.S3Config, key, localPath string) (string, error) {
+	c, err := newS3Client(cfg)
+	if err != nil {
+		return "", err
+	}
+	key = strings.TrimLeft(key, "/")
+	if err := c.putFile(cfg.Bucket, key, localPath); err != nil {
+		return "", err
+	}
+	return s3Scheme + cfg.Bucket + "/" + key, nil
+}
+
+// Download fetches the backup archive at an s3://bucket/key location into
+// dir and returns the local path. The bucket in the location overrides the
+// configured one; the endpoint and credentials come from cfg.
+func Download(cfg config.S3Config, uri, dir string) (string, error) {
+	bucket, key, err := ParseS3URI(uri)
+	if err != nil {
+		return "", err
+	}
+	c, err := newS3Client(cfg)
+	if err != nil {
+		return "", err
+	}
+	localPath := filepath.Join(dir, path.Base(key))
+	if err := c.getFile(bucket, key, localPath); err != nil {
+		return "", fmt.Errorf("下载备份文件失败: %w", err)
+	}
+	return localPath, nil
+}
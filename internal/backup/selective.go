@@ -0,0 +1,539 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"askflow/internal/datadir"
+)
+
+// Selection is the part of a backup a selective restore brings back.
+type Selection struct {
+	Config    bool   // config.json and encryption.key
+	Users     bool   // end users and admin accounts with their product assignments
+	ProductID string // one product with its documents, their chunks and uploaded files, and its sources, glossary, flows, announcements and templates
+}
+
+// ParseSelection parses restore scopes: "config", "users" and
+// "product:<id>", each possibly a comma-separated list.
+func ParseSelection(specs []string) (Selection, error) {
+	var sel Selection
+	for _, spec := range specs {
+		for _, s := range strings.Split(spec, ",") {
+			s = strings.TrimSpace(s)
+			switch {
+			case s == "config":
+				sel.Config = true
+			case s == "users":
+				sel.Users = true
+			case strings.HasPrefix(s, "product:"):
+				id := strings.TrimPrefix(s, "product:")
+				if id == "" || strings.ContainsAny(id, `/\.`) {
+					return sel, fmt.Errorf("无效的产品 ID: %q", id)
+				}
+				if sel.ProductID != "" && sel.ProductID != id {
+					return sel, fmt.Errorf("一次只能恢复一个产品")
+				}
+				sel.ProductID = id
+			case s == "":
+			default:
+				return sel, fmt.Errorf("未知的恢复范围: %s（可选 config、users、product:<产品ID>）", s)
+			}
+		}
+	}
+	if !sel.Config && !sel.Users && sel.ProductID == "" {
+		return sel, fmt.Errorf("请指定恢复范围")
+	}
+	return sel, nil
+}
+
+// TableChange is what a selective restore does to one table. Rows are
+// matched by primary key; rows that exist only in the current database are
+// kept.
+type TableChange struct {
+	Table     string `json:"table"`
+	Backup    int    `json:"backup"`    // rows of the selection in the backup
+	Overwrite int    `json:"overwrite"` // current rows that differ from the backup and are replaced
+	Add       int    `json:"add"`       // backup rows missing from the current database
+	Keep      int    `json:"keep"`      // current rows of the selection not in the backup, left as they are
+}
+
+// FileChange is what a selective restore does to one file.
+type FileChange struct {
+	Path   string `json:"path"`   // relative to the data directory
+	Action string `json:"action"` // "add", "overwrite" or "unchanged"
+}
+
+// Preview lists the changes of a selective restore.
+type Preview struct {
+	Tables []TableChange `json:"tables"`
+	Files  []FileChange  `json:"files"`
+}
+
+// scopedTable is a table restored by a selection. filter limits the rows
+// to the selection; it is formatted with the schema (main or bk) and a row
+// alias prefix, and takes the product ID as its only argument, if any.
+type scopedTable struct {
+	table  string
+	filter string
+}
+
+var userTables = []scopedTable{
+	{"users", ""},
+	{"admin_users", ""},
+	// Assignments to products that no longer exist are not restored
+	{"admin_user_products", "%[2]sproduct_id IN (SELECT id FROM main.products)"},
+}
+
+const productDocsFilter = "%[2]sdocument_id IN (SELECT id FROM %[1]s.documents WHERE product_id = ?)"
+
+var productTables = []scopedTable{
+	{"products", "%[2]sid = ?"},
+	{"documents", "%[2]sproduct_id = ?"},
+	{"chunks", productDocsFilter},
+	{"chunk_translations", productDocsFilter},
+	{"chunk_locations", productDocsFilter},
+	{"document_texts", productDocsFilter},
+	{"document_tags", productDocsFilter},
+	{"image_refs", productDocsFilter},
+	{"video_segments", productDocsFilter},
+	{"video_chapters", productDocsFilter},
+	{"document_versions", productDocsFilter},
+	{"glossary_terms", "%[2]sproduct_id = ?"},
+	{"troubleshooting_flows", "%[2]sproduct_id = ?"},
+	{"announcements", "%[2]sproduct_id = ?"},
+	{"answer_templates", "%[2]sproduct_id = ?"},
+	{"feeds", "%[2]sproduct_id = ?"},
+	{"feed_items", "%[2]sfeed_id IN (SELECT id FROM %[1]s.feeds WHERE product_id = ?)"},
+	{"live_sources", "%[2]sproduct_id = ?"},
+	{"live_source_pages", "%[2]ssource_id IN (SELECT id FROM %[1]s.live_sources WHERE product_id = ?)"},
+	{"git_sources", "%[2]sproduct_id = ?"},
+	{"git_source_files", "%[2]ssource_id IN (SELECT id FROM %[1]s.git_sources WHERE product_id = ?)"},
+}
+
+// PreviewRestore reports what RestoreSelected would change in targetDir,
+// without changing anything.
+func PreviewRestore(archivePath, targetDir string, sel Selection) (*Preview, error) {
+	return restoreSelected(archivePath, targetDir, sel, false)
+}
+
+// RestoreSelected restores only the selected parts of a backup into the
+// data directory targetDir, leaving everything else as it is. Database rows
+// come from the database snapshot of a full backup and are written in one
+// transaction; rows added since the backup are kept. Files of the selection
+// replace the current ones. The service must not be running.
+func RestoreSelected(archivePath, targetDir string, sel Selection) (*Preview, error) {
+	return restoreSelected(archivePath, targetDir, sel, true)
+}
+
+func restoreSelected(archivePath, targetDir string, sel Selection, apply bool) (*Preview, error) {
+	if targetDir == "" {
+		targetDir = datadir.Root()
+	}
+	preview := &Preview{Tables: []TableChange{}, Files: []FileChange{}}
+
+	wanted := map[string]bool{}
+	if sel.Config {
+		wanted["config.json"] = true
+		wanted["encryption.key"] = true
+	}
+
+	// The product first: restored admin accounts may be assigned to it
+	var tables []scopedTable
+	if sel.ProductID != "" {
+		tables = append(tables, productTables...)
+	}
+	if sel.Users {
+		tables = append(tables, userTables...)
+	}
+	if len(tables) > 0 {
+		tmpDir, err := os.MkdirTemp("", "askflow-restore-")
+		if err != nil {
+			return nil, fmt.Errorf("创建临时目录失败: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+		snapPath := filepath.Join(tmpDir, "askflow.db")
+		found, err := extractEntry(archivePath, "askflow.db", snapPath)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("备份中没有数据库快照，选择性恢复用户或产品需要全量备份")
+		}
+		if sel.ProductID != "" {
+			docIDs, err := productDocuments(snapPath, sel.ProductID)
+			if err != nil {
+				return nil, err
+			}
+			wanted["partitions/"+sel.ProductID+".db"] = true
+			for _, id := range docIDs {
+				wanted["uploads/"+id+"/"] = true
+			}
+		}
+		changes, err := restoreTables(filepath.Join(targetDir, "askflow.db"), snapPath, tables, sel.ProductID, apply)
+		if err != nil {
+			return nil, err
+		}
+		preview.Tables = changes
+	}
+
+	files, err := restoreFiles(archivePath, targetDir, wanted, apply)
+	if err != nil {
+		return nil, err
+	}
+	preview.Files = files
+	return preview, nil
+}
+
+// extractEntry writes the archive entry name to dest and reports whether
+// the archive has it.
+func extractEntry(archivePath, name, dest string) (bool, error) {
+	found := false
+	err := walkArchive(archivePath, func(header *tar.Header, r io.Reader) error {
+		if found || header.Name != name {
+			return nil
+		}
+		found = true
+		out, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, r); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+	if err != nil {
+		return false, fmt.Errorf("解压 %s 失败: %w", name, err)
+	}
+	return found, nil
+}
+
+// walkArchive calls fn with each regular file of a backup archive.
+func walkArchive(archivePath string, fn func(header *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("打开备份文件失败: %w", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("解压失败: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取归档失败: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Limit individual file extraction to 2GB to prevent zip bombs
+		if header.Size > 2<<30 {
+			return fmt.Errorf("文件过大: %s (%d bytes)", header.Name, header.Size)
+		}
+		if err := fn(header, io.LimitReader(tr, header.Size)); err != nil {
+			return err
+		}
+	}
+}
+
+// productDocuments returns the IDs of a product's documents in a snapshot.
+func productDocuments(snapPath, productID string) ([]string, error) {
+	snap, err := sql.Open("sqlite3", snapPath)
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Close()
+	var n int
+	if err := snap.QueryRow(`SELECT COUNT(*) FROM products WHERE id = ?`, productID).Scan(&n); err != nil {
+		return nil, fmt.Errorf("读取备份中的产品失败: %w", err)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("备份中没有产品 %s", productID)
+	}
+	rows, err := snap.Query(`SELECT id FROM documents WHERE product_id = ?`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("读取备份中的文档失败: %w", err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// restoreTables compares the selected rows of the snapshot with the database
+// at dbPath and, if apply is set, copies them over in one transaction.
+func restoreTables(dbPath, snapPath string, tables []scopedTable, productID string, apply bool) ([]TableChange, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("目标数据目录中没有数据库 %s，请使用完整恢复", dbPath)
+	}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	}
+	defer db.Close()
+	// ATTACH applies to one connection
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`ATTACH DATABASE ? AS bk`, snapPath); err != nil {
+		return nil, fmt.Errorf("打开备份数据库失败: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	changes := []TableChange{}
+	for _, t := range tables {
+		cols, keys, err := sharedColumns(tx, t.table)
+		if err != nil {
+			return nil, err
+		}
+		if cols == nil {
+			continue // not in the backup
+		}
+		var args []interface{}
+		if strings.Contains(t.filter, "?") {
+			args = append(args, productID)
+		}
+		where := func(schema, alias string) string {
+			if t.filter == "" {
+				return "1"
+			}
+			return fmt.Sprintf(t.filter, schema, alias)
+		}
+		keyMatch := make([]string, len(keys))
+		for i, k := range keys {
+			keyMatch[i] = fmt.Sprintf("m.%[1]s = b.%[1]s", k)
+		}
+		same := make([]string, len(cols))
+		for i, c := range cols {
+			same[i] = fmt.Sprintf("b.%[1]s IS m.%[1]s", c)
+		}
+		match := strings.Join(keyMatch, " AND ")
+
+		c := TableChange{Table: t.table}
+		counts := []struct {
+			dest  *int
+			query string
+		}{
+			{&c.Backup, fmt.Sprintf(`SELECT COUNT(*) FROM bk.%s b WHERE %s`, t.table, where("bk", "b."))},
+			{&c.Add, fmt.Sprintf(`SELECT COUNT(*) FROM bk.%[1]s b WHERE %[2]s AND NOT EXISTS (SELECT 1 FROM main.%[1]s m WHERE %[3]s)`,
+				t.table, where("bk", "b."), match)},
+			{&c.Overwrite, fmt.Sprintf(`SELECT COUNT(*) FROM bk.%[1]s b JOIN main.%[1]s m ON %[3]s WHERE %[2]s AND NOT (%[4]s)`,
+				t.table, where("bk", "b."), match, strings.Join(same, " AND "))},
+			{&c.Keep, fmt.Sprintf(`SELECT COUNT(*) FROM main.%[1]s m WHERE %[2]s AND NOT EXISTS (SELECT 1 FROM bk.%[1]s b WHERE %[3]s)`,
+				t.table, where("main", "m."), match)},
+		}
+		for _, q := range counts {
+			if err := tx.QueryRow(q.query, args...).Scan(q.dest); err != nil {
+				return nil, fmt.Errorf("比较表 %s 失败: %w", t.table, err)
+			}
+		}
+		changes = append(changes, c)
+
+		if apply && c.Add+c.Overwrite > 0 {
+			colList := strings.Join(cols, ", ")
+			if _, err := tx.Exec(fmt.Sprintf(`INSERT OR REPLACE INTO main.%s (%s) SELECT %s FROM bk.%s b WHERE %s`,
+				t.table, colList, colList, t.table, where("bk", "b.")), args...); err != nil {
+				return nil, fmt.Errorf("恢复表 %s 失败: %w", t.table, err)
+			}
+		}
+	}
+	if apply {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("提交恢复失败: %w", err)
+		}
+	}
+	return changes, nil
+}
+
+// sharedColumns returns the columns of table present in both the current
+// database and the backup, and the current primary key. cols is nil if the
+// backup has no such table.
+func sharedColumns(tx *sql.Tx, table string) (cols, keys []string, err error) {
+	info := func(schema string) (map[string]int, []string, error) {
+		rows, err := tx.Query(fmt.Sprintf("PRAGMA %s.table_info(%s)", schema, table))
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rows.Close()
+		pks := map[string]int{}
+		var names []string
+		for rows.Next() {
+			var cid, notnull, pk int
+			var name, ctype string
+			var dflt *string
+			if err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk); err != nil {
+				return nil, nil, err
+			}
+			pks[name] = pk
+			names = append(names, name)
+		}
+		return pks, names, rows.Err()
+	}
+	current, names, err := info("main")
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取表 %s 结构失败: %w", table, err)
+	}
+	backed, _, err := info("bk")
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取备份表 %s 结构失败: %w", table, err)
+	}
+	if len(current) == 0 {
+		return nil, nil, fmt.Errorf("表 %s 不存在", table)
+	}
+	if len(backed) == 0 {
+		return nil, nil, nil
+	}
+	for _, name := range names {
+		if _, ok := backed[name]; !ok {
+			continue
+		}
+		cols = append(cols, name)
+	}
+	// Primary key columns in key order
+	for i := 1; ; i++ {
+		found := false
+		for _, name := range names {
+			if current[name] == i {
+				keys = append(keys, name)
+				found = true
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil, fmt.Errorf("表 %s 没有主键", table)
+	}
+	for _, k := range keys {
+		if _, ok := backed[k]; !ok {
+			return nil, nil, fmt.Errorf("备份表 %s 缺少主键列 %s", table, k)
+		}
+	}
+	return cols, keys, nil
+}
+
+// restoreFiles compares the wanted archive files (a name ending in "/" is a
+// directory prefix) with those in targetDir and, if apply is set, writes
+// the ones that differ.
+func restoreFiles(archivePath, targetDir string, wanted map[string]bool, apply bool) ([]FileChange, error) {
+	changes := []FileChange{}
+	if len(wanted) == 0 {
+		return changes, nil
+	}
+	selected := func(name string) bool {
+		if wanted[name] {
+			return true
+		}
+		if rest, ok := strings.CutPrefix(name, "uploads/"); ok {
+			dir, _, _ := strings.Cut(rest, "/")
+			return wanted["uploads/"+dir+"/"]
+		}
+		return false
+	}
+	err := walkArchive(archivePath, func(header *tar.Header, r io.Reader) error {
+		if !selected(header.Name) {
+			return nil
+		}
+		target := filepath.Join(targetDir, filepath.FromSlash(header.Name))
+		// Security: prevent path traversal
+		if !strings.HasPrefix(filepath.Clean(target), filepath.Clean(targetDir)) {
+			return fmt.Errorf("非法路径: %s", header.Name)
+		}
+		current, exists := fileSum(target)
+		change := FileChange{Path: header.Name, Action: "add"}
+		if exists {
+			change.Action = "overwrite"
+		}
+
+		if !apply {
+			h := sha256.New()
+			if _, err := io.Copy(h, r); err != nil {
+				return err
+			}
+			if exists && hex.EncodeToString(h.Sum(nil)) == current {
+				change.Action = "unchanged"
+			}
+			changes = append(changes, change)
+			return nil
+		}
+
+		if err := datadir.MkdirAll(filepath.Dir(target)); err != nil {
+			return fmt.Errorf("创建目录失败: %w", err)
+		}
+		tmp := target + ".restore-tmp"
+		out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, datadir.FileMode())
+		if err != nil {
+			return fmt.Errorf("创建文件失败 %s: %w", tmp, err)
+		}
+		h := sha256.New()
+		_, err = io.Copy(io.MultiWriter(out, h), r)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("写入文件失败 %s: %w", target, err)
+		}
+		if exists && hex.EncodeToString(h.Sum(nil)) == current {
+			os.Remove(tmp)
+			change.Action = "unchanged"
+			changes = append(changes, change)
+			return nil
+		}
+		if err := os.Rename(tmp, target); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("替换文件失败 %s: %w", target, err)
+		}
+		if strings.HasSuffix(target, ".db") {
+			// A journal left from the replaced database must not be applied to the restored one
+			os.Remove(target + "-wal")
+			os.Remove(target + "-shm")
+		}
+		changes = append(changes, change)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// fileSum returns the SHA-256 of a file and whether it exists.
+func fileSum(path string) (string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", true
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
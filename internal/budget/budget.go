@@ -0,0 +1,354 @@
+// Package budget meters the LLM and embedding spend of each calendar month
+// and enforces the monthly budget caps of the deployment and of products.
+//
+// Token counts are estimated from the text sent to and received from the
+// models, and priced with llm.price_per_m_tokens and
+// embedding.price_per_m_tokens. Once a cap is reached, calls marked Optional
+// fail with ErrLimitReached, and with the degrade action queries stop calling
+// the models altogether (see Meter.Degraded).
+package budget
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+	"unicode"
+
+	"askflow/internal/config"
+)
+
+// Kinds of metered calls.
+const (
+	KindLLM       = "llm"
+	KindEmbedding = "embedding"
+)
+
+// AlertPercents are the shares of a cap, in percent, at which admins are
+// alerted, once per cap and month.
+var AlertPercents = []int{80, 100}
+
+// MonthLayout is the format of the months usage is recorded under, in local
+// time.
+const MonthLayout = "2006-01"
+
+// Alert reports that the spend of a month reached a share of a cap.
+type Alert struct {
+	Month     string  `json:"month"`
+	ProductID string  `json:"product_id"` // "" for the deployment cap
+	Percent   int     `json:"percent"`    // one of AlertPercents
+	Spent     float64 `json:"spent"`
+	Limit     float64 `json:"limit"`
+}
+
+// Meter records model usage and answers whether a budget cap is reached. A
+// nil Meter records nothing and never limits.
+type Meter struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+	cfg     func() config.Config
+	onAlert func(Alert)
+
+	mu      sync.Mutex
+	month   string             // month of spent and alerted, "" before the first load
+	spent   map[string]float64 // cost of the month by product ID, "" for work not tied to a product
+	alerted map[string]bool    // alerts sent this month, by alertKey
+}
+
+// NewMeter creates a Meter reading prices, caps and the limit action from cfg
+// on every call, so configuration changes apply immediately.
+func NewMeter(readDB, writeDB *sql.DB, cfg func() config.Config) *Meter {
+	return &Meter{readDB: readDB, writeDB: writeDB, cfg: cfg}
+}
+
+// OnAlert sets the function told when spend reaches 80% or 100% of a cap. It
+// is called in its own goroutine and must be set before the Meter is used.
+func (m *Meter) OnAlert(fn func(Alert)) {
+	m.onAlert = fn
+}
+
+// Record adds a call of kind using tokens to the usage of productID ("" when
+// the call is not tied to a product) for the current month, and sends the
+// alerts of the caps it made reach 80% or 100%.
+func (m *Meter) Record(productID, kind string, tokens int) {
+	if m == nil || tokens <= 0 {
+		return
+	}
+	cfg := m.cfg()
+	price := cfg.LLM.PricePerMTokens
+	if kind == KindEmbedding {
+		price = cfg.Embedding.PricePerMTokens
+	}
+	cost := float64(tokens) / 1e6 * price
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	month := currentMonth()
+	loadErr := m.loadLocked(month)
+	if _, err := m.writeDB.Exec(`INSERT INTO model_usage (month, product_id, kind, calls, tokens, cost) VALUES (?, ?, ?, 1, ?, ?)
+		ON CONFLICT(month, product_id, kind) DO UPDATE SET calls = calls + 1, tokens = tokens + excluded.tokens, cost = cost + excluded.cost`,
+		month, productID, kind, tokens, cost); err != nil {
+		log.Printf("[Budget] failed to record usage: %v", err)
+		return
+	}
+	if loadErr != nil {
+		log.Printf("[Budget] failed to load usage of %s: %v", month, loadErr)
+		return
+	}
+	if cost == 0 {
+		return
+	}
+	m.spent[productID] += cost
+	m.checkLocked(month, "", m.totalLocked(), cfg.Budget.MonthlyLimit)
+	if productID != "" {
+		m.checkLocked(month, productID, m.spent[productID], cfg.Budget.ProductLimit(productID))
+	}
+}
+
+// Limited reports whether the deployment cap or the cap of productID is
+// reached this month.
+func (m *Meter) Limited(productID string) bool {
+	if m == nil {
+		return false
+	}
+	cfg := m.cfg()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.loadLocked(currentMonth()); err != nil {
+		log.Printf("[Budget] failed to load usage: %v", err)
+		return false
+	}
+	if limit := cfg.Budget.MonthlyLimit; limit > 0 && m.totalLocked() >= limit {
+		return true
+	}
+	if limit := cfg.Budget.ProductLimit(productID); limit > 0 && m.spent[productID] >= limit {
+		return true
+	}
+	return false
+}
+
+// Degraded reports whether queries of productID must be answered without
+// model calls: a cap is reached and the limit action is config.BudgetDegrade.
+func (m *Meter) Degraded(productID string) bool {
+	if m == nil || m.cfg().Budget.EffectiveOnLimit() != config.BudgetDegrade {
+		return false
+	}
+	return m.Limited(productID)
+}
+
+// loadLocked reads the spend of month from the database when month differs
+// from the loaded one. m.mu must be held.
+func (m *Meter) loadLocked(month string) error {
+	if m.month == month {
+		return nil
+	}
+	spent := make(map[string]float64)
+	rows, err := m.readDB.Query(`SELECT product_id, SUM(cost) FROM model_usage WHERE month = ? GROUP BY product_id`, month)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id string
+		var cost float64
+		if err := rows.Scan(&id, &cost); err != nil {
+			rows.Close()
+			return err
+		}
+		spent[id] = cost
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	alerted := make(map[string]bool)
+	rows, err = m.readDB.Query(`SELECT product_id, percent FROM budget_alerts WHERE month = ?`, month)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id string
+		var percent int
+		if err := rows.Scan(&id, &percent); err != nil {
+			rows.Close()
+			return err
+		}
+		alerted[alertKey(id, percent)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	m.month, m.spent, m.alerted = month, spent, alerted
+	return nil
+}
+
+// checkLocked records the alerts of a cap that spent reached and that were
+// not sent this month yet, and sends the highest of them; a single call
+// crossing both 80% and 100% sends one alert. m.mu must be held.
+func (m *Meter) checkLocked(month, productID string, spent, limit float64) {
+	if limit <= 0 {
+		return
+	}
+	reached := 0
+	for _, percent := range AlertPercents {
+		key := alertKey(productID, percent)
+		if m.alerted[key] || spent < limit*float64(percent)/100 {
+			continue
+		}
+		m.alerted[key] = true
+		if _, err := m.writeDB.Exec(`INSERT OR IGNORE INTO budget_alerts (month, product_id, percent, spent, budget_limit, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			month, productID, percent, spent, limit, time.Now().UTC()); err != nil {
+			log.Printf("[Budget] failed to record alert: %v", err)
+		}
+		reached = percent
+	}
+	if reached == 0 {
+		return
+	}
+	log.Printf("[Budget] %s spend of %s reached %d%% of the cap (%.2f of %.2f)", scopeName(productID), month, reached, spent, limit)
+	if m.onAlert != nil {
+		go m.onAlert(Alert{Month: month, ProductID: productID, Percent: reached, Spent: spent, Limit: limit})
+	}
+}
+
+// totalLocked returns the spend of the loaded month. m.mu must be held.
+func (m *Meter) totalLocked() float64 {
+	var total float64
+	for _, cost := range m.spent {
+		total += cost
+	}
+	return total
+}
+
+// Usage is the recorded usage of one kind of call by a product in a month.
+type Usage struct {
+	ProductID string  `json:"product_id"`
+	Kind      string  `json:"kind"`
+	Calls     int64   `json:"calls"`
+	Tokens    int64   `json:"tokens"`
+	Cost      float64 `json:"cost"`
+}
+
+// Scope is the spend of a month against one cap.
+type Scope struct {
+	ProductID string  `json:"product_id"`     // "" for the deployment
+	Name      string  `json:"name,omitempty"` // product name, filled in by callers
+	Spent     float64 `json:"spent"`
+	Limit     float64 `json:"limit"`   // 0 when there is no cap
+	Percent   float64 `json:"percent"` // share of the cap spent, 0 without a cap
+	Limited   bool    `json:"limited"`
+}
+
+// Report is the spend of a month against the configured caps.
+type Report struct {
+	Month      string  `json:"month"`
+	OnLimit    string  `json:"on_limit"`
+	Deployment Scope   `json:"deployment"`
+	Products   []Scope `json:"products"` // products with a cap or with usage
+	Usage      []Usage `json:"usage"`
+	Alerts     []Alert `json:"alerts"`
+}
+
+// Report returns the usage of month ("" for the current month) against the
+// current caps.
+func (m *Meter) Report(month string) (*Report, error) {
+	if month == "" {
+		month = currentMonth()
+	} else if _, err := time.Parse(MonthLayout, month); err != nil {
+		return nil, fmt.Errorf("月份格式无效，应为 YYYY-MM")
+	}
+	cfg := m.cfg()
+	rep := &Report{Month: month, OnLimit: cfg.Budget.EffectiveOnLimit(), Products: []Scope{}, Usage: []Usage{}, Alerts: []Alert{}}
+
+	rows, err := m.readDB.Query(`SELECT product_id, kind, calls, tokens, cost FROM model_usage WHERE month = ? ORDER BY product_id, kind`, month)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	spent := make(map[string]float64)
+	for rows.Next() {
+		var u Usage
+		if err := rows.Scan(&u.ProductID, &u.Kind, &u.Calls, &u.Tokens, &u.Cost); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		rep.Usage = append(rep.Usage, u)
+		spent[u.ProductID] += u.Cost
+		rep.Deployment.Spent += u.Cost
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rep.Deployment.Limit = cfg.Budget.MonthlyLimit
+	rep.Deployment.fill()
+	ids := make(map[string]bool)
+	for id := range spent {
+		if id != "" {
+			ids[id] = true
+		}
+	}
+	for id := range cfg.Budget.ProductLimits {
+		ids[id] = true
+	}
+	for id := range ids {
+		s := Scope{ProductID: id, Spent: spent[id], Limit: cfg.Budget.ProductLimit(id)}
+		s.fill()
+		rep.Products = append(rep.Products, s)
+	}
+	sort.Slice(rep.Products, func(i, j int) bool { return rep.Products[i].ProductID < rep.Products[j].ProductID })
+
+	rows, err = m.readDB.Query(`SELECT product_id, percent, spent, budget_limit FROM budget_alerts WHERE month = ? ORDER BY created_at`, month)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a := Alert{Month: month}
+		if err := rows.Scan(&a.ProductID, &a.Percent, &a.Spent, &a.Limit); err != nil {
+			return nil, fmt.Errorf("failed to scan alert: %w", err)
+		}
+		rep.Alerts = append(rep.Alerts, a)
+	}
+	return rep, rows.Err()
+}
+
+// fill sets Percent and Limited from Spent and Limit.
+func (s *Scope) fill() {
+	if s.Limit <= 0 {
+		return
+	}
+	s.Percent = s.Spent / s.Limit * 100
+	s.Limited = s.Spent >= s.Limit
+}
+
+// EstimateTokens approximates the token count of s: about one token per CJK
+// character and one per four other characters.
+func EstimateTokens(s string) int {
+	var cjk, other int
+	for _, r := range s {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+func currentMonth() string {
+	return time.Now().Format(MonthLayout)
+}
+
+func alertKey(productID string, percent int) string {
+	return fmt.Sprintf("%s|%d", productID, percent)
+}
+
+func scopeName(productID string) string {
+	if productID == "" {
+		return "deployment"
+	}
+	return "product " + productID
+}
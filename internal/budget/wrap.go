@@ -0,0 +1,181 @@
+package budget
+
+import (
+	"errors"
+
+	"askflow/internal/embedding"
+	"askflow/internal/llm"
+)
+
+// imageTokens is the rough token count of an image sent to a model.
+const imageTokens = 1000
+
+// ErrLimitReached is returned by Optional calls once a budget cap is reached.
+var ErrLimitReached = errors.New("本月模型预算已达上限，已暂停非必要的模型调用")
+
+// meteredLLM records the usage of an LLM service with a Meter.
+type meteredLLM struct {
+	next      llm.LLMService
+	m         *Meter
+	productID string
+	optional  bool
+}
+
+// WrapLLM returns ls recording its usage with m. Use ForProduct and Optional
+// to attribute calls to a product and mark non-essential calls.
+func (m *Meter) WrapLLM(ls llm.LLMService) llm.LLMService {
+	if m == nil || ls == nil {
+		return ls
+	}
+	if s, ok := ls.(*meteredLLM); ok {
+		ls = s.next
+	}
+	return &meteredLLM{next: ls, m: m}
+}
+
+// WrapEmbedding returns es recording its usage with m.
+func (m *Meter) WrapEmbedding(es embedding.EmbeddingService) embedding.EmbeddingService {
+	if m == nil || es == nil {
+		return es
+	}
+	if s, ok := es.(*meteredEmbedding); ok {
+		es = s.next
+	}
+	return &meteredEmbedding{next: es, m: m}
+}
+
+// ForProduct returns ls with its calls counted toward the budget of
+// productID. Services not wrapped by a Meter are returned unchanged.
+func ForProduct(ls llm.LLMService, productID string) llm.LLMService {
+	s, ok := ls.(*meteredLLM)
+	if !ok {
+		return ls
+	}
+	c := *s
+	c.productID = productID
+	return &c
+}
+
+// Optional returns ls with its calls marked non-essential: once the
+// deployment cap or the cap of its product is reached they fail with
+// ErrLimitReached instead of calling the model. Services not wrapped by a
+// Meter are returned unchanged.
+func Optional(ls llm.LLMService) llm.LLMService {
+	s, ok := ls.(*meteredLLM)
+	if !ok {
+		return ls
+	}
+	c := *s
+	c.optional = true
+	return &c
+}
+
+// Rewrap returns next metered like ls, for calls that go to another model
+// than ls, e.g. a product's own intent classification model.
+func Rewrap(ls, next llm.LLMService) llm.LLMService {
+	s, ok := ls.(*meteredLLM)
+	if !ok || next == nil {
+		return next
+	}
+	c := *s
+	c.next = next
+	return &c
+}
+
+// ForTask returns the service ls uses for task, metered like ls.
+func (s *meteredLLM) ForTask(task string) llm.LLMService {
+	r, ok := s.next.(llm.TaskRouter)
+	if !ok {
+		return s
+	}
+	c := *s
+	c.next = r.ForTask(task)
+	return &c
+}
+
+// EmbeddingForProduct returns es with its calls counted toward the budget of
+// productID. Services not wrapped by a Meter are returned unchanged.
+func EmbeddingForProduct(es embedding.EmbeddingService, productID string) embedding.EmbeddingService {
+	s, ok := es.(*meteredEmbedding)
+	if !ok {
+		return es
+	}
+	c := *s
+	c.productID = productID
+	return &c
+}
+
+// Unwrap returns the metered service.
+func (s *meteredLLM) Unwrap() llm.LLMService { return s.next }
+
+func (s *meteredLLM) Generate(prompt string, context []string, question string) (string, error) {
+	if s.optional && s.m.Limited(s.productID) {
+		return "", ErrLimitReached
+	}
+	answer, err := s.next.Generate(prompt, context, question)
+	if err == nil {
+		s.m.Record(s.productID, KindLLM, promptTokens(prompt, context, question)+EstimateTokens(answer))
+	}
+	return answer, err
+}
+
+func (s *meteredLLM) GenerateWithImage(prompt string, context []string, question string, imageDataURL string) (string, error) {
+	if s.optional && s.m.Limited(s.productID) {
+		return "", ErrLimitReached
+	}
+	answer, err := s.next.GenerateWithImage(prompt, context, question, imageDataURL)
+	if err == nil {
+		tokens := promptTokens(prompt, context, question) + EstimateTokens(answer)
+		if imageDataURL != "" {
+			tokens += imageTokens
+		}
+		s.m.Record(s.productID, KindLLM, tokens)
+	}
+	return answer, err
+}
+
+func promptTokens(prompt string, context []string, question string) int {
+	n := EstimateTokens(prompt) + EstimateTokens(question)
+	for _, c := range context {
+		n += EstimateTokens(c)
+	}
+	return n
+}
+
+// meteredEmbedding records the usage of an embedding service with a Meter.
+type meteredEmbedding struct {
+	next      embedding.EmbeddingService
+	m         *Meter
+	productID string
+}
+
+// Unwrap returns the metered service.
+func (s *meteredEmbedding) Unwrap() embedding.EmbeddingService { return s.next }
+
+func (s *meteredEmbedding) Embed(text string) ([]float64, error) {
+	vec, err := s.next.Embed(text)
+	if err == nil {
+		s.m.Record(s.productID, KindEmbedding, EstimateTokens(text))
+	}
+	return vec, err
+}
+
+func (s *meteredEmbedding) EmbedBatch(texts []string) ([][]float64, error) {
+	vecs, err := s.next.EmbedBatch(texts)
+	if err == nil {
+		var tokens int
+		for _, t := range texts {
+			tokens += EstimateTokens(t)
+		}
+		s.m.Record(s.productID, KindEmbedding, tokens)
+	}
+	return vecs, err
+}
+
+func (s *meteredEmbedding) EmbedImageURL(imageURL string) ([]float64, error) {
+	vec, err := s.next.EmbedImageURL(imageURL)
+	if err == nil {
+		s.m.Record(s.productID, KindEmbedding, imageTokens)
+	}
+	return vec, err
+}
@@ -0,0 +1,111 @@
+// Package chathistory keeps every question a user asked together with the
+// answer given, so users can revisit past answers after the chat UI state of
+// their session is gone. History is kept until the user deletes it.
+package chathistory
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned when deleting an entry that does not exist or
+// belongs to another user.
+var ErrNotFound = errors.New("聊天记录不存在")
+
+// Entry is one question and the answer given to it.
+type Entry struct {
+	ID        string          `json:"id"`
+	QueryID   string          `json:"query_id,omitempty"` // query log ID, used for feedback and sharing
+	ProductID string          `json:"product_id"`
+	Question  string          `json:"question"`
+	Answer    string          `json:"answer"`
+	Sources   json.RawMessage `json:"sources"`
+	IsPending bool            `json:"is_pending"` // handed over to staff; Answer holds the notice shown
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Service stores chat history per user.
+type Service struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+}
+
+// NewService creates a new chat history Service.
+func NewService(readDB, writeDB *sql.DB) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB}
+}
+
+// Record stores a question and its answer in the user's history and returns
+// the entry ID.
+func (s *Service) Record(userID string, e Entry) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	id := hex.EncodeToString(b)
+	sources := "[]"
+	if len(e.Sources) > 0 && string(e.Sources) != "null" {
+		sources = string(e.Sources)
+	}
+	_, err := s.writeDB.Exec(
+		`INSERT INTO chat_history (id, user_id, product_id, query_id, question, answer, sources, is_pending, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, userID, e.ProductID, e.QueryID, e.Question, e.Answer, sources, e.IsPending, time.Now().UTC(),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to record chat history: %w", err)
+	}
+	return id, nil
+}
+
+// List returns one page of the user's history, newest first, and the total
+// number of entries. An empty productID lists all products.
+func (s *Service) List(userID, productID string, offset, limit int) ([]Entry, int, error) {
+	where := "user_id = ?"
+	args := []interface{}{userID}
+	if productID != "" {
+		where += " AND product_id = ?"
+		args = append(args, productID)
+	}
+	var total int
+	if err := s.readDB.QueryRow("SELECT COUNT(*) FROM chat_history WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count chat history: %w", err)
+	}
+	rows, err := s.readDB.Query(
+		`SELECT id, query_id, product_id, question, answer, sources, is_pending, created_at
+		 FROM chat_history WHERE `+where+` ORDER BY created_at DESC, id LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query chat history: %w", err)
+	}
+	defer rows.Close()
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		var sources string
+		if err := rows.Scan(&e.ID, &e.QueryID, &e.ProductID, &e.Question, &e.Answer, &sources, &e.IsPending, &e.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan chat history: %w", err)
+		}
+		e.Sources = json.RawMessage(sources)
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+// Delete removes an entry from the user's history.
+func (s *Service) Delete(userID, id string) error {
+	result, err := s.writeDB.Exec("DELETE FROM chat_history WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete chat history: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// Package chatstate persists the chat UI state of a login session — the
+// current conversation and the unsent draft question — so a page reload does
+// not lose it. State lives only as long as its session and is dropped after
+// a period without updates.
+package chatstate
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// MaxDraftRunes bounds the saved draft question.
+	MaxDraftRunes = 10000
+	// MaxMessages caps the number of saved conversation messages.
+	MaxMessages = 200
+	// MaxMessagesBytes bounds the encoded size of the saved conversation.
+	MaxMessagesBytes = 512 << 10
+	// TTL is how long state is kept after its last update.
+	TTL = 7 * 24 * time.Hour
+)
+
+// State is the saved chat state of a session. Messages is stored as given by
+// the client (a JSON array) and returned unchanged.
+type State struct {
+	ProductID string          `json:"product_id"`
+	Draft     string          `json:"draft"`
+	Messages  json.RawMessage `json:"messages"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Service stores chat state per session.
+type Service struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+}
+
+// NewService creates a new chat state Service.
+func NewService(readDB, writeDB *sql.DB) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB}
+}
+
+// validate checks the size limits of a state and normalises empty messages to [].
+func validate(st *State) error {
+	if len([]rune(st.Draft)) > MaxDraftRunes {
+		return fmt.Errorf("草稿过长（最多 %d 个字符）", MaxDraftRunes)
+	}
+	msgs := bytes.TrimSpace(st.Messages)
+	if len(msgs) == 0 || bytes.Equal(msgs, []byte("null")) {
+		st.Messages = json.RawMessage("[]")
+		return nil
+	}
+	if len(msgs) > MaxMessagesBytes {
+		return fmt.Errorf("会话内容过大（最多 %d KB）", MaxMessagesBytes>>10)
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(msgs, &items); err != nil {
+		return fmt.Errorf("messages 必须是 JSON 数组")
+	}
+	if len(items) > MaxMessages {
+		return fmt.Errorf("会话消息过多（最多 %d 条）", MaxMessages)
+	}
+	st.Messages = msgs
+	return nil
+}
+
+// Save stores the chat state of a session, replacing any previous state.
+func (s *Service) Save(sessionID, userID string, st State) (*State, error) {
+	if err := validate(&st); err != nil {
+		return nil, err
+	}
+	st.UpdatedAt = time.Now().UTC()
+	_, err := s.writeDB.Exec(
+		`INSERT INTO chat_states (session_id, user_id, product_id, draft, messages, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(session_id) DO UPDATE SET product_id = excluded.product_id, draft = excluded.draft,
+		 messages = excluded.messages, updated_at = excluded.updated_at
+		 WHERE chat_states.user_id = excluded.user_id`,
+		sessionID, userID, st.ProductID, st.Draft, string(st.Messages), st.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save chat state: %w", err)
+	}
+	return &st, nil
+}
+
+// Get returns the saved chat state of a session, or nil when there is none
+// or it has expired.
+func (s *Service) Get(sessionID, userID string) (*State, error) {
+	var st State
+	var messages string
+	err := s.readDB.QueryRow(
+		"SELECT COALESCE(product_id, ''), draft, messages, updated_at FROM chat_states WHERE session_id = ? AND user_id = ?",
+		sessionID, userID,
+	).Scan(&st.ProductID, &st.Draft, &messages, &st.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chat state: %w", err)
+	}
+	if time.Since(st.UpdatedAt) > TTL {
+		return nil, nil
+	}
+	st.Messages = json.RawMessage(messages)
+	return &st, nil
+}
+
+// Delete removes the saved chat state of a session.
+func (s *Service) Delete(sessionID, userID string) error {
+	if _, err := s.writeDB.Exec("DELETE FROM chat_states WHERE session_id = ? AND user_id = ?", sessionID, userID); err != nil {
+		return fmt.Errorf("failed to delete chat state: %w", err)
+	}
+	return nil
+}
+
+// CleanExpired removes state older than TTL and state whose session no
+// longer exists. Returns the number of rows deleted.
+func (s *Service) CleanExpired() (int64, error) {
+	result, err := s.writeDB.Exec(
+		"DELETE FROM chat_states WHERE updated_at < ? OR session_id NOT IN (SELECT id FROM sessions)",
+		time.Now().UTC().Add(-TTL),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clean chat states: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -19,6 +19,14 @@ type Chunk struct {
 	Text       string `json:"text"`
 	Index      int    `json:"index"`
 	DocumentID string `json:"document_id"`
+	Start      int    `json:"start"` // rune offset of the chunk in the split text
+	End        int    `json:"end"`   // rune offset just past the chunk
+	// CodeLangs lists the languages of the fenced code blocks in the chunk,
+	// CodeLangText for blocks without a language hint.
+	CodeLangs []string `json:"code_langs,omitempty"`
+	// OpenCode is the language of the code block the chunk starts inside,
+	// when a block too long for one chunk was cut; see FenceCode.
+	OpenCode string `json:"open_code,omitempty"`
 }
 
 // NewTextChunker creates a TextChunker with default settings.
@@ -37,6 +45,11 @@ func NewTextChunker() *TextChunker {
 // Returns an empty slice for empty text.
 // Returns a single chunk if text is shorter than or equal to ChunkSize.
 // The last chunk may be shorter than ChunkSize.
+//
+// Fenced code blocks are kept intact: a chunk grows up to twice ChunkSize to
+// hold a block whole, a longer block starts a chunk of its own and is only
+// cut between lines, and the overlap never starts inside a block. Chunks
+// record the code blocks they hold in CodeLangs and OpenCode.
 func (tc *TextChunker) Split(text string, documentID string) []Chunk {
 	if len(text) == 0 {
 		return []Chunk{}
@@ -57,20 +70,23 @@ func (tc *TextChunker) Split(text string, documentID string) []Chunk {
 		overlap = chunkSize - 1
 	}
 
-	step := chunkSize - overlap
+	blocks := findCodeBlocks(runes)
 	var chunks []Chunk
 	index := 0
 
-	for start := 0; start < len(runes); start += step {
+	for start := 0; start < len(runes); {
 		end := start + chunkSize
 		if end > len(runes) {
 			end = len(runes)
 		}
+		end, moved := fitCode(blocks, runes, start, end, chunkSize)
 
 		chunks = append(chunks, Chunk{
 			Text:       string(runes[start:end]),
 			Index:      index,
 			DocumentID: documentID,
+			Start:      start,
+			End:        end,
 		})
 		index++
 
@@ -78,7 +94,14 @@ func (tc *TextChunker) Split(text string, documentID string) []Chunk {
 		if end == len(runes) {
 			break
 		}
+
+		next := codeOverlap(blocks, runes, start, end, end-overlap, moved)
+		if next <= start {
+			next = end
+		}
+		start = next
 	}
 
+	markCode(chunks, blocks)
 	return chunks
 }
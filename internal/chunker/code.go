@@ -0,0 +1,190 @@
+package chunker
+
+import (
+	"strings"
+)
+
+// CodeLangText is the language recorded for fenced code blocks without a
+// language hint.
+const CodeLangText = "text"
+
+// codeBlock is a fenced code block (``` or ~~~): the rune span from the start
+// of its opening fence line to the end of its closing fence line, or to the
+// end of the text when it is never closed.
+type codeBlock struct {
+	span
+	lang   string // language hint of the opening fence, CodeLangText if none
+	closed bool
+}
+
+// fence reports whether line is a code fence of at least three backticks or
+// tildes, indented by up to three spaces, and returns the fence marker and
+// the info string after it.
+func fence(line string) (marker, info string, ok bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 {
+		return "", "", false
+	}
+	c := trimmed[0]
+	if c != '`' && c != '~' {
+		return "", "", false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == c {
+		n++
+	}
+	if n < 3 {
+		return "", "", false
+	}
+	info = strings.TrimSpace(trimmed[n:])
+	if c == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	return trimmed[:n], info, true
+}
+
+// codeLang returns the language hint of a fence info string, such as "bash"
+// for "bash title=install.sh".
+func codeLang(info string) string {
+	if f := strings.Fields(info); len(f) > 0 {
+		return strings.ToLower(strings.TrimPrefix(f[0], "."))
+	}
+	return CodeLangText
+}
+
+// findCodeBlocks returns the fenced code blocks of runes in order. A block is
+// closed by a fence of the same character at least as long as its opening
+// fence and without an info string.
+func findCodeBlocks(runes []rune) []codeBlock {
+	var blocks []codeBlock
+	var open *codeBlock
+	var openMarker string
+	for pos := 0; pos < len(runes); {
+		end := pos
+		for end < len(runes) && runes[end] != '\n' {
+			end++
+		}
+		next := min(end+1, len(runes))
+		marker, info, ok := fence(string(runes[pos:end]))
+		switch {
+		case !ok:
+		case open == nil:
+			open = &codeBlock{span: span{start: pos}, lang: codeLang(info)}
+			openMarker = marker
+		case info == "" && marker[0] == openMarker[0] && len(marker) >= len(openMarker):
+			open.end, open.closed = next, true
+			blocks = append(blocks, *open)
+			open = nil
+		}
+		pos = next
+	}
+	if open != nil {
+		open.end = len(runes)
+		blocks = append(blocks, *open)
+	}
+	return blocks
+}
+
+// codeAt returns the code block strictly containing boundary i.
+func codeAt(blocks []codeBlock, i int) (codeBlock, bool) {
+	for _, b := range blocks {
+		if b.start < i && i < b.end {
+			return b, true
+		}
+		if b.start >= i {
+			break
+		}
+	}
+	return codeBlock{}, false
+}
+
+// fitCode moves the end of a chunk starting at start out of a code block, so
+// commands and config snippets are not cut in the middle:
+//   - a block that ends within twice chunkSize of start is kept whole, the
+//     chunk growing past chunkSize if needed;
+//   - otherwise a block starting after start is left to the next chunk, and
+//     moved reports this;
+//   - a block too long for one chunk is cut after its last full line.
+func fitCode(blocks []codeBlock, runes []rune, start, end, chunkSize int) (int, bool) {
+	b, ok := codeAt(blocks, end)
+	if !ok {
+		return end, false
+	}
+	if b.end-start <= 2*chunkSize {
+		return b.end, false
+	}
+	if b.start > start {
+		return b.start, true
+	}
+	for i := end - 1; i > start; i-- {
+		if runes[i-1] == '\n' {
+			return i, false
+		}
+	}
+	return end, false
+}
+
+// codeOverlap moves the start of the chunk after [start, end) out of a code
+// block the overlap would begin in: past a block that ended in the previous
+// chunk, or to a line start of a block continued from it. After a chunk cut
+// short before a long block (moved), the next chunk starts with the block.
+func codeOverlap(blocks []codeBlock, runes []rune, start, end, next int, moved bool) int {
+	if moved {
+		return end
+	}
+	b, ok := codeAt(blocks, next)
+	if !ok {
+		return next
+	}
+	if b.end <= end {
+		return b.end
+	}
+	for i := next; i > start; i-- {
+		if runes[i-1] == '\n' {
+			return i
+		}
+	}
+	return end
+}
+
+// markCode records the code blocks each chunk holds.
+func markCode(chunks []Chunk, blocks []codeBlock) {
+	for i := range chunks {
+		c := &chunks[i]
+		seen := make(map[string]bool)
+		for _, b := range blocks {
+			if b.start >= c.End {
+				break
+			}
+			if b.end <= c.Start {
+				continue
+			}
+			if !seen[b.lang] {
+				seen[b.lang] = true
+				c.CodeLangs = append(c.CodeLangs, b.lang)
+			}
+			if b.start < c.Start {
+				c.OpenCode = b.lang
+			}
+		}
+	}
+}
+
+// HasCode reports whether text holds a fenced code block.
+func HasCode(text string) bool {
+	return len(findCodeBlocks([]rune(text))) > 0
+}
+
+// FenceCode returns chunk text with its code blocks fenced, for chunks cut
+// from a long block: openLang, the chunk's OpenCode, reopens the block the
+// text starts inside, and a block still open at the end is closed.
+func FenceCode(text, openLang string) string {
+	if openLang != "" {
+		text = "```" + openLang + "\n" + text
+	}
+	blocks := findCodeBlocks([]rune(text))
+	if n := len(blocks); n > 0 && !blocks[n-1].closed {
+		text = strings.TrimRight(text, "\n") + "\n```"
+	}
+	return text
+}
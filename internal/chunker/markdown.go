@@ -0,0 +1,177 @@
+package chunker
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MediaKindImage and MediaKindVideo are the kinds of inline media references.
+const (
+	MediaKindImage = "image"
+	MediaKindVideo = "video"
+)
+
+// mediaRefRe matches markdown media references: ![alt](url) or ![alt](url "title").
+var mediaRefRe = regexp.MustCompile(`!\[([^\]]*)\]\(\s*([^)\s]+)(?:\s+"[^"]*")?\s*\)`)
+
+// MediaRef is an image or video referenced inline in markdown text.
+type MediaRef struct {
+	Kind       string `json:"kind"` // MediaKindImage or MediaKindVideo
+	URL        string `json:"url"`
+	Alt        string `json:"alt"`
+	ChunkIndex int    `json:"chunk_index"` // index of the text chunk containing the reference
+	Context    string `json:"context"`     // text surrounding the reference, including its placeholder
+}
+
+// mediaPlaceholder returns the text that stands in for a media reference in
+// chunk text, e.g. "[图片: 接线示意图]".
+func mediaPlaceholder(kind, alt string) string {
+	label := "图片"
+	if kind == MediaKindVideo {
+		label = "视频"
+	}
+	if alt = strings.TrimSpace(alt); alt != "" {
+		return "[" + label + ": " + alt + "]"
+	}
+	return "[" + label + "]"
+}
+
+// mediaKind classifies a media URL. Knowledge videos are served under
+// /api/videos/; everything else is treated as an image.
+func mediaKind(url string) string {
+	if strings.HasPrefix(url, "/api/videos/") {
+		return MediaKindVideo
+	}
+	return MediaKindImage
+}
+
+// span is a half-open rune range [start, end).
+type span struct{ start, end int }
+
+// MediaRefs returns the media references in markdown text, in order. Only
+// Kind, URL and Alt are set.
+func MediaRefs(text string) []MediaRef {
+	_, refs, _ := extractMedia(text)
+	return refs
+}
+
+// extractMedia replaces the media references in text with placeholders and
+// returns the resulting text, the references and the rune span of each
+// placeholder.
+func extractMedia(text string) (string, []MediaRef, []span) {
+	var sb strings.Builder
+	var refs []MediaRef
+	var spans []span
+	last, pos := 0, 0
+	for _, m := range mediaRefRe.FindAllStringSubmatchIndex(text, -1) {
+		before := text[last:m[0]]
+		sb.WriteString(before)
+		pos += len([]rune(before))
+
+		alt, url := text[m[2]:m[3]], text[m[4]:m[5]]
+		kind := mediaKind(url)
+		ph := mediaPlaceholder(kind, alt)
+		sb.WriteString(ph)
+		n := len([]rune(ph))
+		spans = append(spans, span{pos, pos + n})
+		refs = append(refs, MediaRef{Kind: kind, URL: url, Alt: strings.TrimSpace(alt)})
+		pos += n
+		last = m[1]
+	}
+	sb.WriteString(text[last:])
+	return sb.String(), refs, spans
+}
+
+// SplitMarkdown splits markdown text like Split, but first replaces inline
+// media references (![alt](url)) with short placeholders so the raw URLs are
+// not embedded. Chunk boundaries never cut through a placeholder, so each
+// reference stays in the same chunk as the text around it. For every
+// reference the returned MediaRef records the chunk it landed in and a window
+// of surrounding text (about ChunkSize runes) that callers can embed alongside
+// the media, so "see the figure below" style content retrieves the figure.
+// Fenced code blocks are kept intact as in Split.
+func (tc *TextChunker) SplitMarkdown(text string, documentID string) ([]Chunk, []MediaRef) {
+	clean, refs, spans := extractMedia(text)
+	runes := []rune(clean)
+	if len(runes) == 0 {
+		return []Chunk{}, refs
+	}
+
+	chunkSize := tc.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	overlap := tc.Overlap
+	if overlap < 0 {
+		overlap = 0
+	}
+	if overlap >= chunkSize {
+		overlap = chunkSize - 1
+	}
+
+	// inside returns the placeholder span strictly containing boundary i.
+	inside := func(i int) (span, bool) {
+		for _, s := range spans {
+			if s.start < i && i < s.end {
+				return s, true
+			}
+		}
+		return span{}, false
+	}
+
+	blocks := findCodeBlocks(runes)
+	var chunks []Chunk
+	for start := 0; start < len(runes); {
+		end := start + chunkSize
+		if end > len(runes) {
+			end = len(runes)
+		}
+		end, moved := fitCode(blocks, runes, start, end, chunkSize)
+		if s, ok := inside(end); ok {
+			if s.start > start {
+				end = s.start
+			} else {
+				end = s.end
+			}
+		}
+		chunks = append(chunks, Chunk{
+			Text:       string(runes[start:end]),
+			Index:      len(chunks),
+			DocumentID: documentID,
+			Start:      start,
+			End:        end,
+		})
+		if end == len(runes) {
+			break
+		}
+
+		next := codeOverlap(blocks, runes, start, end, end-overlap, moved)
+		if s, ok := inside(next); ok {
+			next = s.start
+		}
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	markCode(chunks, blocks)
+
+	half := chunkSize / 2
+	for i, s := range spans {
+		for _, c := range chunks {
+			if c.Start <= s.start && s.end <= c.End {
+				refs[i].ChunkIndex = c.Index
+				break
+			}
+		}
+		from, to := s.start-half, s.end+half
+		if from < 0 {
+			from = 0
+		}
+		if to > len(runes) {
+			to = len(runes)
+		}
+		refs[i].Context = strings.TrimSpace(string(runes[from:to]))
+	}
+	return chunks, refs
+}
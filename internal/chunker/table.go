@@ -0,0 +1,75 @@
+package chunker
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// SplitTable divides the rows of a table into chunks of whole consecutive
+// rows, each starting with the header line so every chunk says what its
+// columns mean. A chunk holds as many rows as fit in ChunkSize runes together
+// with the header; a row too long for that is split on its own, and each
+// piece again gets the header. The header is cut to half of ChunkSize so rows
+// always have room.
+//
+// The split text is the header line followed by the rows, one per line;
+// Start and End of each chunk are rune offsets of its rows in that text.
+// Returns an empty slice when there are no rows.
+func (tc *TextChunker) SplitTable(header string, rows []string, documentID string) []Chunk {
+	if len(rows) == 0 {
+		return []Chunk{}
+	}
+
+	chunkSize := tc.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	offset := utf8.RuneCountInString(header) + 1 // first row, after the full header
+	if r := []rune(header); len(r) > chunkSize/2 {
+		header = string(r[:chunkSize/2])
+	}
+	room := chunkSize - utf8.RuneCountInString(header) - 1
+
+	var chunks []Chunk
+	var group []string
+	groupStart, groupLen := 0, 0
+	flush := func(end int) {
+		if len(group) == 0 {
+			return
+		}
+		chunks = append(chunks, Chunk{
+			Text:       header + "\n" + strings.Join(group, "\n"),
+			Index:      len(chunks),
+			DocumentID: documentID,
+			Start:      groupStart,
+			End:        end,
+		})
+		group, groupLen = nil, 0
+	}
+
+	for _, row := range rows {
+		n := utf8.RuneCountInString(row)
+		if groupLen > 0 && groupLen+1+n > room {
+			flush(offset - 1)
+		}
+		if n > room {
+			runes := []rune(row)
+			for start := 0; start < len(runes); start += room {
+				end := min(start+room, len(runes))
+				group, groupStart = []string{string(runes[start:end])}, offset+start
+				flush(offset + end)
+			}
+		} else {
+			if len(group) == 0 {
+				groupStart = offset
+				groupLen = n
+			} else {
+				groupLen += 1 + n
+			}
+			group = append(group, row)
+		}
+		offset += n + 1
+	}
+	flush(offset - 1)
+	return chunks
+}
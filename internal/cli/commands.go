@@ -1,45 +1,108 @@
 package cli
 
 import (
+	"bufio"
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"askflow/internal/backup"
+	"askflow/internal/config"
+	"askflow/internal/datadir"
 	"askflow/internal/document"
 	"askflow/internal/handler"
+	"askflow/internal/pending"
 	"askflow/internal/product"
+	"askflow/internal/textutil"
+	"askflow/internal/vectorstore"
 )
 
-// RunBatchImport scans directories and imports supported files.
+// RunBatchImport scans directories and imports supported files. Progress is
+// kept in a manifest keyed by file content hash: --resume skips files an
+// earlier run already handled, --retry-failed skips only the successful ones.
+// With --auto-product each file is assigned to the product the LLM proposes,
+// after the user confirms the assignments.
 func RunBatchImport(args []string, dm *document.DocumentManager, ps *product.ProductService) {
-	// Parse --product flag
-	var productID string
+	const usage = "用法: askflow import [--product <product_id>] [--include <模式>] [--exclude <模式>] [--max-size <大小>] [--modified-since <日期>] [--manifest <文件>] [--resume | --retry-failed] [--report <文件>] [--dry-run] [--auto-product [--yes]] <目录> [...]"
+	var productID, manifestPath, reportPath, maxSize, modifiedSince string
+	var include, exclude []string
+	var resume, retryFailed, dryRun, autoProduct, yes bool
 	var dirs []string
 	for i := 0; i < len(args); i++ {
-		if args[i] == "--product" {
+		switch args[i] {
+		case "--product", "--manifest", "--report", "--include", "--exclude", "--max-size", "--modified-since":
 			if i+1 >= len(args) {
-				fmt.Println("错误: --product 参数需要指定产品 ID")
-				fmt.Println("用法: askflow import [--product <product_id>] <目录> [...]")
+				fmt.Printf("错误: %s 参数需要指定值\n", args[i])
+				fmt.Println(usage)
 				os.Exit(1)
 			}
-			productID = args[i+1]
+			switch v := args[i+1]; args[i] {
+			case "--product":
+				productID = v
+			case "--manifest":
+				manifestPath = v
+			case "--report":
+				reportPath = v
+			case "--include":
+				include = append(include, v)
+			case "--exclude":
+				exclude = append(exclude, v)
+			case "--max-size":
+				maxSize = v
+			default:
+				modifiedSince = v
+			}
 			i++ // skip the value
-		} else {
+		case "--resume":
+			resume = true
+		case "--retry-failed":
+			resume, retryFailed = true, true
+		case "--dry-run":
+			dryRun = true
+		case "--auto-product":
+			autoProduct = true
+		case "--yes", "-y":
+			yes = true
+		default:
+			if strings.HasPrefix(args[i], "--") {
+				fmt.Printf("未知参数: %s\n", args[i])
+				fmt.Println(usage)
+				os.Exit(1)
+			}
 			dirs = append(dirs, args[i])
 		}
 	}
 
 	if len(dirs) == 0 {
 		fmt.Println("错误: 请指定至少一个目录路径")
-		fmt.Println("用法: askflow import [--product <product_id>] <目录> [...]")
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+	filter, err := document.ParseImportFilter(include, exclude, maxSize, modifiedSince)
+	if err != nil {
+		fmt.Printf("错误: %v\n", err)
+		os.Exit(1)
+	}
+
+	if autoProduct && (productID != "" || dryRun) {
+		fmt.Println("错误: --auto-product 不能与 --product 或 --dry-run 同时使用")
 		os.Exit(1)
 	}
 
 	// Validate product ID if provided
-	if productID != "" {
+	if autoProduct {
+		fmt.Println("目标: 按内容自动分类到产品")
+		productID = importAutoProduct
+	} else if productID != "" {
 		p, err := ps.GetByID(productID)
 		if err != nil || p == nil {
 			fmt.Printf("错误: 指定的产品不存在 (ID: %s)\n", productID)
@@ -50,8 +113,30 @@ func RunBatchImport(args []string, dm *document.DocumentManager, ps *product.Pro
 		fmt.Println("目标: 公共库")
 	}
 
+	if manifestPath == "" {
+		manifestPath = defaultImportManifest
+	}
+	manifest := &importManifest{ProductID: productID, Files: make(map[string]*importEntry), path: manifestPath}
+	if resume {
+		m, err := loadImportManifest(manifestPath)
+		if err != nil {
+			fmt.Printf("错误: 无法读取导入清单 %s: %v\n", manifestPath, err)
+			os.Exit(1)
+		}
+		if len(m.Files) > 0 && m.ProductID != productID {
+			fmt.Printf("错误: 导入清单 %s 属于其他产品 (ID: %s)，请用 --manifest 指定新的清单\n", manifestPath, m.ProductID)
+			os.Exit(1)
+		}
+		m.ProductID = productID
+		manifest = m
+		fmt.Printf("继续导入，清单中已有 %d 个文件记录\n", len(m.Files))
+	} else if _, err := os.Stat(manifestPath); err == nil && !dryRun {
+		fmt.Printf("提示: 将覆盖已有导入清单 %s（使用 --resume 可跳过已导入的文件）\n", manifestPath)
+	}
+
 	// Collect all files to import
 	var files []string
+	var filtered int
 	for _, dir := range dirs {
 		info, err := os.Stat(dir)
 		if err != nil {
@@ -60,10 +145,12 @@ func RunBatchImport(args []string, dm *document.DocumentManager, ps *product.Pro
 		}
 		if !info.IsDir() {
 			// Single file
-			if _, ok := handler.SupportedExtensions[strings.ToLower(filepath.Ext(dir))]; ok {
+			if _, ok := handler.SupportedExtensions[strings.ToLower(filepath.Ext(dir))]; !ok {
+				fmt.Printf("跳过: 不支持的文件格式 %s\n", dir)
+			} else if ok, _ := filter.Match(filepath.Base(dir), info); ok {
 				files = append(files, dir)
 			} else {
-				fmt.Printf("跳过: 不支持的文件格式 %s\n", dir)
+				filtered++
 			}
 			continue
 		}
@@ -73,94 +160,267 @@ func RunBatchImport(args []string, dm *document.DocumentManager, ps *product.Pro
 				fmt.Printf("警告: 无法访问 %s: %v\n", path, err)
 				return nil
 			}
+			rel, _ := filepath.Rel(dir, path)
 			if fi.IsDir() {
+				if filter.SkipDir(rel) {
+					return filepath.SkipDir
+				}
 				return nil
 			}
 			ext := strings.ToLower(filepath.Ext(fi.Name()))
-			if _, ok := handler.SupportedExtensions[ext]; ok {
-				files = append(files, path)
+			if _, ok := handler.SupportedExtensions[ext]; !ok {
+				return nil
+			}
+			if ok, _ := filter.Match(rel, fi); !ok {
+				filtered++
+				return nil
 			}
+			files = append(files, path)
 			return nil
 		})
 	}
 
+	if filtered > 0 {
+		fmt.Printf("按筛选条件排除 %d 个文件\n", filtered)
+	}
 	if len(files) == 0 {
 		fmt.Println("未找到支持的文件")
 		return
 	}
 
-	fmt.Printf("找到 %d 个文件，开始导入...\n\n", len(files))
+	if dryRun {
+		dryRunImport(files, filtered, dm, manifest, resume, retryFailed, reportPath)
+		return
+	}
 
-	type failedFile struct {
-		Path   string
-		Reason string
+	var assignments map[string]string
+	if autoProduct {
+		var ok bool
+		if assignments, ok = classifyImportFiles(files, dm, ps, manifest, resume, retryFailed, yes); !ok {
+			fmt.Println("已取消导入")
+			return
+		}
+		fmt.Println()
 	}
-	var success, failed int
-	var failedFiles []failedFile
+
+	fmt.Printf("找到 %d 个文件，开始导入...\n\n", len(files))
+
+	// Stop after the current file on Ctrl+C so the manifest is saved; a
+	// second Ctrl+C terminates immediately.
+	var interrupted atomic.Bool
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		signal.Stop(sigCh)
+		interrupted.Store(true)
+		fmt.Println("\n收到中断信号，完成当前文件后停止...")
+	}()
+	defer signal.Stop(sigCh)
+
+	report := &importReport{ProductID: productID, Manifest: manifestPath, StartedAt: time.Now().UTC(), Filtered: filtered}
 	for i, filePath := range files {
+		if interrupted.Load() {
+			break
+		}
 		fileName := filepath.Base(filePath)
 		ext := strings.ToLower(filepath.Ext(fileName))
 		fileType := handler.SupportedExtensions[ext]
+		entry := &importEntry{Path: filePath}
+		report.Files = append(report.Files, entry)
 
 		fmt.Printf("[%d/%d] %s ... ", i+1, len(files), filePath)
 
 		fileData, err := os.ReadFile(filePath)
 		if err != nil {
-			reason := fmt.Sprintf("读取失败: %v", err)
-			fmt.Println(reason)
-			failed++
-			failedFiles = append(failedFiles, failedFile{Path: filePath, Reason: reason})
+			entry.Status, entry.Error, entry.UpdatedAt = importFailed, fmt.Sprintf("读取失败: %v", err), time.Now().UTC()
+			fmt.Println(entry.Error)
+			report.Failed++
+			continue
+		}
+		entry.Hash = hashFileData(fileData)
+		if prev := manifest.Files[entry.Hash]; resume && prev != nil && (prev.Status == importSuccess || !retryFailed) {
+			entry.Status, entry.DocID, entry.Error, entry.UpdatedAt = importSkipped, prev.DocID, prev.Error, prev.UpdatedAt
+			fmt.Printf("跳过 (上次%s)\n", map[string]string{importSuccess: "已导入", importFailed: "失败"}[prev.Status])
+			report.Skipped++
 			continue
 		}
 
+		docProductID := productID
+		if autoProduct {
+			docProductID = assignments[filePath]
+			entry.ProductID = docProductID
+		}
 		req := document.UploadFileRequest{
 			FileName:  fileName,
 			FileData:  fileData,
 			FileType:  fileType,
-			ProductID: productID,
+			ProductID: docProductID,
 		}
 		doc, err := dm.UploadFile(req)
-		if err != nil {
-			reason := fmt.Sprintf("导入失败: %v", err)
-			fmt.Println(reason)
-			failed++
-			failedFiles = append(failedFiles, failedFile{Path: filePath, Reason: reason})
-			continue
+		entry.UpdatedAt = time.Now().UTC()
+		switch {
+		case err != nil:
+			entry.Status, entry.Error = importFailed, fmt.Sprintf("导入失败: %v", err)
+		case doc.Status == "failed" || doc.Status == "password_protected" || doc.Status == "quarantined":
+			entry.Status, entry.DocID, entry.Error = importFailed, doc.ID, fmt.Sprintf("处理失败: %s", doc.Error)
+		default:
+			entry.Status, entry.DocID = importSuccess, doc.ID
 		}
-		if doc.Status == "failed" {
-			reason := fmt.Sprintf("处理失败: %s", doc.Error)
-			fmt.Println(reason)
-			failed++
-			failedFiles = append(failedFiles, failedFile{Path: filePath, Reason: reason})
-			continue
+		if entry.Status == importSuccess {
+			fmt.Printf("成功 (ID: %s)\n", doc.ID)
+			report.Success++
+		} else {
+			fmt.Println(entry.Error)
+			report.Failed++
+		}
+		if err := manifest.record(entry); err != nil {
+			fmt.Printf("警告: 写入导入清单失败: %v\n", err)
 		}
-
-		fmt.Printf("成功 (ID: %s)\n", doc.ID)
-		success++
 	}
+	if err := manifest.save(); err != nil {
+		fmt.Printf("警告: 写入导入清单失败: %v\n", err)
+	}
+	// Documents are tagged in the background; finish before exiting
+	dm.WaitTagging()
+	report.Total = len(files)
+	report.FinishedAt = time.Now().UTC()
 
 	fmt.Println("\n========== 导入报告 ==========")
 	fmt.Printf("总文件数: %d\n", len(files))
-	fmt.Printf("成功文件数: %d\n", success)
-	fmt.Printf("失败文件数: %d\n", failed)
-	if len(failedFiles) > 0 {
+	fmt.Printf("成功文件数: %d\n", report.Success)
+	fmt.Printf("失败文件数: %d\n", report.Failed)
+	if report.Skipped > 0 {
+		fmt.Printf("跳过文件数: %d\n", report.Skipped)
+	}
+	if remaining := len(files) - len(report.Files); remaining > 0 {
+		fmt.Printf("未处理文件数: %d（使用 --resume 继续）\n", remaining)
+	}
+	if report.Failed > 0 {
 		fmt.Println("\n失败文件列表:")
-		for _, f := range failedFiles {
+		for _, f := range report.Files {
+			if f.Status != importFailed {
+				continue
+			}
 			absPath, err := filepath.Abs(f.Path)
 			if err != nil {
 				absPath = f.Path
 			}
-			fmt.Printf("  %s\n    原因: %s\n", absPath, f.Reason)
+			fmt.Printf("  %s\n    原因: %s\n", absPath, f.Error)
+		}
+		fmt.Println("\n使用 --retry-failed 重新导入失败的文件")
+	}
+	fmt.Printf("导入清单: %s\n", manifestPath)
+	fmt.Println("==============================")
+
+	if reportPath != "" {
+		if err := writeImportReport(reportPath, report); err != nil {
+			fmt.Printf("警告: 写入 JSON 报告失败: %v\n", err)
+		} else {
+			fmt.Printf("JSON 报告: %s\n", reportPath)
+		}
+	}
+	if interrupted.Load() {
+		os.Exit(130)
+	}
+}
+
+// dryRunImport parses the files an import would pick up and prints the
+// estimated chunks, embeddings and cost of each without importing anything
+// or touching the manifest.
+func dryRunImport(files []string, filtered int, dm *document.DocumentManager, manifest *importManifest, resume, retryFailed bool, reportPath string) {
+	fmt.Printf("找到 %d 个文件，预估导入（不写入任何数据）...\n\n", len(files))
+
+	report := &importReport{ProductID: manifest.ProductID, DryRun: true, StartedAt: time.Now().UTC(), Filtered: filtered, Estimate: &document.ImportEstimate{}}
+	for i, filePath := range files {
+		fileType := handler.SupportedExtensions[strings.ToLower(filepath.Ext(filePath))]
+		entry := &importEntry{Path: filePath}
+		report.Files = append(report.Files, entry)
+		fmt.Printf("[%d/%d] %s ... ", i+1, len(files), filePath)
+
+		fileData, err := os.ReadFile(filePath)
+		entry.UpdatedAt = time.Now().UTC()
+		if err != nil {
+			entry.Status, entry.Error = importFailed, fmt.Sprintf("读取失败: %v", err)
+			fmt.Println(entry.Error)
+			report.Failed++
+			continue
+		}
+		entry.Hash = hashFileData(fileData)
+		if prev := manifest.Files[entry.Hash]; resume && prev != nil && (prev.Status == importSuccess || !retryFailed) {
+			entry.Status, entry.DocID = importSkipped, prev.DocID
+			fmt.Println("跳过 (清单中已处理)")
+			report.Skipped++
+			continue
+		}
+		est, err := dm.EstimateFile(fileType, fileData)
+		switch {
+		case err != nil:
+			entry.Status, entry.Error = importFailed, fmt.Sprintf("无法导入: %v", err)
+			fmt.Println(entry.Error)
+			report.Failed++
+		case est.DuplicateOf != "":
+			entry.Status, entry.DocID = importSkipped, est.DuplicateOf
+			fmt.Printf("跳过 (与已有文档重复, ID: %s)\n", est.DuplicateOf)
+			report.Skipped++
+		default:
+			entry.Status, entry.Estimate = importPlanned, est
+			report.Estimate.Add(est)
+			report.Planned++
+			fmt.Println(formatImportEstimate(est))
 		}
 	}
+	report.Total = len(files)
+	report.FinishedAt = time.Now().UTC()
+
+	total := report.Estimate
+	fmt.Println("\n========== 预估报告 ==========")
+	fmt.Printf("总文件数: %d\n", len(files))
+	fmt.Printf("将导入文件数: %d\n", report.Planned)
+	fmt.Printf("跳过文件数: %d\n", report.Skipped)
+	fmt.Printf("无法导入文件数: %d\n", report.Failed)
+	fmt.Printf("分块数: %d\n", total.Chunks)
+	fmt.Printf("嵌入调用: %d 段文本（约 %d tokens），%d 张图片\n", total.Embeddings, total.EmbeddingTokens, total.Images)
+	if total.OCRPages > 0 || total.LLMTokens > 0 {
+		fmt.Printf("LLM 调用: OCR %d 页，约 %d tokens\n", total.OCRPages, total.LLMTokens)
+	}
+	fmt.Printf("预计费用: %.4f（按配置的每百万 tokens 单价，不含图片嵌入）\n", total.Cost)
 	fmt.Println("==============================")
+
+	if reportPath != "" {
+		if err := writeImportReport(reportPath, report); err != nil {
+			fmt.Printf("警告: 写入 JSON 报告失败: %v\n", err)
+		} else {
+			fmt.Printf("JSON 报告: %s\n", reportPath)
+		}
+	}
+}
+
+func formatImportEstimate(est *document.ImportEstimate) string {
+	s := fmt.Sprintf("分块 %d，嵌入 %d（约 %d tokens）", est.Chunks, est.Embeddings, est.EmbeddingTokens)
+	if est.Images > 0 {
+		s += fmt.Sprintf("，图片 %d", est.Images)
+	}
+	if est.OCRPages > 0 {
+		s += fmt.Sprintf("，OCR %d 页", est.OCRPages)
+	}
+	if est.LLMTokens > 0 {
+		s += fmt.Sprintf("，LLM 约 %d tokens", est.LLMTokens)
+	}
+	s += fmt.Sprintf("，预计费用 %.4f", est.Cost)
+	if est.Note != "" {
+		s += "（" + est.Note + "）"
+	}
+	return s
 }
 
-// RunBackup executes a full or incremental backup of the data directory.
-func RunBackup(args []string, db *sql.DB) {
+// RunBackup executes a full or incremental backup of the data directory and
+// uploads it to the object storage configured in s3, if any.
+func RunBackup(args []string, db *sql.DB, s3 config.S3Config) {
 	opts := backup.Options{
-		DataDir: "./data",
+		DataDir: datadir.Root(),
 		Mode:    "full",
+		S3:      s3,
 	}
 
 	for i := 0; i < len(args); i++ {
@@ -181,9 +441,11 @@ func RunBackup(args []string, db *sql.DB) {
 			}
 			opts.ManifestIn = args[i+1]
 			i++
+		case "--no-upload":
+			opts.S3 = config.S3Config{}
 		default:
 			fmt.Printf("未知参数: %s\n", args[i])
-			fmt.Println("用法: askflow backup [--output <目录>] [--incremental --base <manifest>]")
+			fmt.Println("用法: askflow backup [--output <目录>] [--incremental --base <manifest>] [--no-upload]")
 			os.Exit(1)
 		}
 	}
@@ -208,12 +470,21 @@ func RunBackup(args []string, db *sql.DB) {
 	fmt.Printf("  Manifest: %s\n", result.ManifestPath)
 	fmt.Printf("  文件数: %d, 数据库行数: %d\n", result.FilesWritten, result.DBRows)
 	fmt.Printf("  归档大小: %.2f MB\n", float64(result.BytesWritten)/(1024*1024))
+	if result.RemoteArchive != "" {
+		fmt.Printf("  已上传: %s\n", result.RemoteArchive)
+		fmt.Printf("          %s\n", result.RemoteManifest)
+	}
 }
 
-// RunRestore restores data from a backup archive.
+// RunRestore restores data from a backup archive, either a local file or an
+// s3://bucket/key object in the object storage configured in the data
+// directory's config.json. With --only, only the selected parts are restored
+// after a preview of what would be overwritten.
 func RunRestore(args []string) {
-	targetDir := "./data"
+	targetDir := datadir.Root()
 	var archivePath string
+	var only []string
+	previewOnly, yes := false, false
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -224,6 +495,17 @@ func RunRestore(args []string) {
 			}
 			targetDir = args[i+1]
 			i++
+		case "--only":
+			if i+1 >= len(args) {
+				fmt.Println("错误: --only 需要指定恢复范围")
+				os.Exit(1)
+			}
+			only = append(only, args[i+1])
+			i++
+		case "--preview":
+			previewOnly = true
+		case "--yes", "-y":
+			yes = true
 		default:
 			if archivePath != "" {
 				fmt.Printf("未知参数: %s\n", args[i])
@@ -235,17 +517,159 @@ func RunRestore(args []string) {
 
 	if archivePath == "" {
 		fmt.Println("错误: 请指定备份文件路径")
-		fmt.Println("用法: askflow restore [--target <目录>] <备份文件>")
+		fmt.Println("用法: askflow restore [--target <目录>] [--only config|users|product:<产品ID> [--preview] [--yes]] <备份文件|s3://<bucket>/<key>>")
+		os.Exit(1)
+	}
+	var sel backup.Selection
+	if len(only) > 0 {
+		var err error
+		if sel, err = backup.ParseSelection(only); err != nil {
+			fmt.Printf("错误: %v\n", err)
+			os.Exit(1)
+		}
+	} else if previewOnly {
+		fmt.Println("错误: --preview 需要与 --only 一起使用")
 		os.Exit(1)
 	}
 
-	fmt.Printf("从 %s 恢复数据到 %s ...\n", archivePath, targetDir)
-	if err := backup.Restore(archivePath, targetDir); err != nil {
+	// os.Exit skips deferred calls, so the download is removed explicitly
+	var tmpDir string
+	if backup.IsS3URI(archivePath) {
+		s3, err := loadBackupS3Config()
+		if err != nil {
+			fmt.Printf("读取对象存储配置失败: %v\n", err)
+			os.Exit(1)
+		}
+		tmpDir, err = os.MkdirTemp("", "askflow-restore-")
+		if err != nil {
+			fmt.Printf("创建临时目录失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("从对象存储下载 %s ...\n", archivePath)
+		local, err := backup.Download(s3, archivePath, tmpDir)
+		if err != nil {
+			fmt.Printf("恢复失败: %v\n", err)
+			os.RemoveAll(tmpDir)
+			os.Exit(1)
+		}
+		archivePath = local
+	}
+
+	var err error
+	if len(only) > 0 {
+		err = restoreSelected(archivePath, targetDir, sel, previewOnly, yes)
+	} else {
+		fmt.Printf("从 %s 恢复数据到 %s ...\n", archivePath, targetDir)
+		err = backup.Restore(archivePath, targetDir)
+	}
+	if tmpDir != "" {
+		os.RemoveAll(tmpDir)
+	}
+	if err != nil {
 		fmt.Printf("恢复失败: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// restoreSelected previews a selective restore and, unless previewOnly,
+// applies it once the user confirms (or right away with yes).
+func restoreSelected(archivePath, targetDir string, sel backup.Selection, previewOnly, yes bool) error {
+	fmt.Printf("比较 %s 与 %s ...\n", archivePath, targetDir)
+	preview, err := backup.PreviewRestore(archivePath, targetDir, sel)
+	if err != nil {
+		return err
+	}
+	printRestorePreview(preview)
+	if previewOnly {
+		return nil
+	}
+	if !yes && !confirmRestore(os.Stdin) {
+		fmt.Println("已取消")
+		return nil
+	}
+	result, err := backup.RestoreSelected(archivePath, targetDir, sel)
+	if err != nil {
+		return err
+	}
+	rows, files := 0, 0
+	for _, t := range result.Tables {
+		rows += t.Add + t.Overwrite
+	}
+	for _, f := range result.Files {
+		if f.Action != "unchanged" {
+			files++
+		}
+	}
+	fmt.Printf("恢复完成，共写入 %d 行数据、%d 个文件\n", rows, files)
+	if sel.ProductID != "" {
+		fmt.Println("如使用外部向量检索引擎，请重新执行 askflow migrate-vectors 同步恢复的分块")
+	}
+	return nil
+}
+
+// printRestorePreview prints the changes of a selective restore. Upload
+// files are counted per action rather than listed.
+func printRestorePreview(p *backup.Preview) {
+	actions := map[string]string{"add": "新增", "overwrite": "覆盖", "unchanged": "不变"}
+	fmt.Println("\n========== 恢复预览 ==========")
+	if len(p.Tables) > 0 {
+		fmt.Printf("  %-22s %8s %8s %8s %8s\n", "表", "备份行数", "覆盖", "新增", "保留")
+		for _, t := range p.Tables {
+			fmt.Printf("  %-22s %8d %8d %8d %8d\n", t.Table, t.Backup, t.Overwrite, t.Add, t.Keep)
+		}
+		fmt.Println("  （保留: 当前存在但备份中没有的行，恢复后保持不变）")
+	}
+	uploads := map[string]int{}
+	for _, f := range p.Files {
+		if strings.HasPrefix(f.Path, "uploads/") {
+			uploads[f.Action]++
+			continue
+		}
+		fmt.Printf("  %s  %s\n", actions[f.Action], f.Path)
+	}
+	if n := uploads["add"] + uploads["overwrite"] + uploads["unchanged"]; n > 0 {
+		fmt.Printf("  上传文件 %d 个: 新增 %d，覆盖 %d，不变 %d\n", n, uploads["add"], uploads["overwrite"], uploads["unchanged"])
+	}
+	if len(p.Tables) == 0 && len(p.Files) == 0 {
+		fmt.Println("  备份中没有可恢复的内容")
+	}
+	fmt.Println("==============================")
+}
+
+// confirmRestore asks whether to apply the previewed restore.
+func confirmRestore(in io.Reader) bool {
+	fmt.Print("输入 y 执行恢复，其他键取消: ")
+	scanner := bufio.NewScanner(in)
+	if !scanner.Scan() {
+		fmt.Println()
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return answer == "y" || answer == "yes"
+}
+
+// loadBackupS3Config reads the object storage settings from the config.json
+// of the data directory without initializing the application, which must not
+// hold the data directory open while it is restored.
+func loadBackupS3Config() (config.S3Config, error) {
+	configPath := datadir.Path("config.json")
+	if _, err := os.Stat(configPath); err != nil {
+		return config.S3Config{}, fmt.Errorf("未找到配置文件 %s，无法获取对象存储设置", configPath)
+	}
+	cm, err := config.NewConfigManager(configPath)
+	if err != nil {
+		return config.S3Config{}, err
+	}
+	if err := cm.Load(); err != nil {
+		return config.S3Config{}, err
+	}
+	s3 := cm.Get().Backup.S3
+	if s3.Endpoint == "" {
+		return config.S3Config{}, fmt.Errorf("未配置对象存储 (backup.s3)")
+	}
+	return s3, nil
+}
+
 // RunListProducts lists all products with their IDs.
 func RunListProducts(ps *product.ProductService) {
 	products, err := ps.List()
@@ -260,11 +684,222 @@ func RunListProducts(ps *product.ProductService) {
 	fmt.Printf("%-34s  %-20s  %s\n", "产品 ID", "名称", "描述")
 	fmt.Println(strings.Repeat("-", 80))
 	for _, p := range products {
-		desc := p.Description
-		if len(desc) > 30 {
-			desc = desc[:30] + "..."
-		}
-		fmt.Printf("%-34s  %-20s  %s\n", p.ID, p.Name, desc)
+		fmt.Printf("%-34s  %-20s  %s\n", p.ID, p.Name, textutil.Ellipsize(p.Description, 30))
 	}
 	fmt.Printf("\n共 %d 个产品\n", len(products))
 }
+
+// RunSafeMode shows or toggles read-only (demo) mode. This is the only way to
+// change the flag; the HTTP config API refuses it.
+func RunSafeMode(args []string, cm *config.ConfigManager) {
+	if len(args) == 0 || args[0] == "status" {
+		if cm.IsReadOnly() {
+			fmt.Println("只读演示模式: 已开启")
+		} else {
+			fmt.Println("只读演示模式: 已关闭")
+		}
+		return
+	}
+	var enabled bool
+	switch args[0] {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		fmt.Printf("未知参数: %s\n", args[0])
+		fmt.Println("用法: askflow safemode [on|off|status]")
+		os.Exit(1)
+	}
+	if err := cm.SetReadOnly(enabled); err != nil {
+		fmt.Printf("保存配置失败: %v\n", err)
+		os.Exit(1)
+	}
+	if enabled {
+		fmt.Println("已开启只读演示模式，重启服务后生效")
+	} else {
+		fmt.Println("已关闭只读演示模式，重启服务后生效")
+	}
+}
+
+// pendingImportReport is the machine-readable summary written by
+// "pending import --report".
+type pendingImportReport struct {
+	File       string               `json:"file"`
+	StartedAt  time.Time            `json:"started_at"`
+	FinishedAt time.Time            `json:"finished_at"`
+	Total      int                  `json:"total"`
+	Answered   int                  `json:"answered"`
+	Skipped    int                  `json:"skipped"`
+	Failed     int                  `json:"failed"`
+	Rows       []pending.BulkResult `json:"rows"`
+}
+
+// RunPending dispatches the pending question subcommands.
+func RunPending(args []string, pm *pending.PendingQuestionManager, cm *config.ConfigManager) {
+	if len(args) == 0 || args[0] != "import" {
+		fmt.Println("用法: askflow pending import [--author <name>] [--report <file>] <answers.csv|answers.json>")
+		os.Exit(1)
+	}
+	runPendingImport(args[1:], pm, cm)
+}
+
+// runPendingImport answers pending questions from a CSV or JSON of
+// question_id → answer pairs through the same pipeline as the admin UI, so
+// each answer is embedded and stored as knowledge, and prints one line per
+// row. Ctrl+C stops after the current row.
+func runPendingImport(args []string, pm *pending.PendingQuestionManager, cm *config.ConfigManager) {
+	author := "cli"
+	var reportPath, file string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--author", "--report":
+			if i+1 >= len(args) {
+				fmt.Printf("错误: %s 需要指定参数值\n", args[i])
+				os.Exit(1)
+			}
+			if args[i] == "--author" {
+				author = args[i+1]
+			} else {
+				reportPath = args[i+1]
+			}
+			i++
+		default:
+			if strings.HasPrefix(args[i], "--") || file != "" {
+				fmt.Printf("未知参数: %s\n", args[i])
+				os.Exit(1)
+			}
+			file = args[i]
+		}
+	}
+	if file == "" {
+		fmt.Println("用法: askflow pending import [--author <name>] [--report <file>] <answers.csv|answers.json>")
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Printf("读取文件失败: %v\n", err)
+		os.Exit(1)
+	}
+	items, err := pending.ParseBulkAnswers(data, file)
+	if err != nil {
+		fmt.Printf("解析文件失败: %v\n", err)
+		os.Exit(1)
+	}
+	reviewStatus := ""
+	if cfg := cm.Get(); cfg != nil && cfg.Review.Required {
+		reviewStatus = document.ReviewDraft
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report := &pendingImportReport{File: file, StartedAt: time.Now().UTC(), Total: len(items)}
+	fmt.Printf("正在导入 %d 条回答 ...\n", len(items))
+	results, err := pm.AnswerBulk(ctx, items, reviewStatus, author, func(done int, r pending.BulkResult) {
+		switch r.Status {
+		case pending.BulkAnswered:
+			report.Answered++
+			fmt.Printf("  [%d/%d] %s 已回答\n", done, len(items), r.QuestionID)
+		case pending.BulkSkipped:
+			report.Skipped++
+			fmt.Printf("  [%d/%d] %s 跳过: %s\n", done, len(items), r.QuestionID, r.Error)
+		default:
+			report.Failed++
+			fmt.Printf("  [%d/%d] %s 失败: %s\n", done, len(items), r.QuestionID, r.Error)
+		}
+	})
+	report.Rows = results
+	report.FinishedAt = time.Now().UTC()
+	if err != nil {
+		fmt.Printf("\n已中断，处理了 %d/%d 行\n", len(results), len(items))
+	}
+	fmt.Printf("\n完成: 成功 %d，跳过 %d，失败 %d\n", report.Answered, report.Skipped, report.Failed)
+	if reviewStatus != "" && report.Answered > 0 {
+		fmt.Println("回答已保存为草稿，需在审核队列中发布")
+	}
+	if reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(reportPath, data, 0644)
+		}
+		if err != nil {
+			fmt.Printf("写入报告失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("报告已写入: %s\n", reportPath)
+	}
+	if err != nil || report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// RunMigrateVectors copies the chunk vectors of vs into the search backend
+// named by --to and then selects it in vector.backend. SQLite keeps all
+// chunks, so switching back with --to sqlite needs no copy.
+func RunMigrateVectors(args []string, db *sql.DB, vs *vectorstore.SQLiteVectorStore, cm *config.ConfigManager) {
+	var target string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--to":
+			if i+1 >= len(args) {
+				fmt.Println("错误: --to 需要指定向量检索后端")
+				os.Exit(1)
+			}
+			target = strings.ToLower(args[i+1])
+			i++
+		default:
+			fmt.Printf("未知参数: %s\n", args[i])
+			fmt.Println("用法: askflow migrate-vectors --to <backend>")
+			os.Exit(1)
+		}
+	}
+	if target == "" {
+		fmt.Println("用法: askflow migrate-vectors --to <backend>")
+		fmt.Printf("可用后端: %s\n", strings.Join(vectorstore.BackendNames(), ", "))
+		os.Exit(1)
+	}
+
+	if target != vectorstore.DefaultBackend {
+		vcfg := cm.Get().Vector
+		vcfg.Backend = target
+		b, err := vectorstore.OpenBackend(vcfg)
+		if err != nil {
+			fmt.Printf("连接向量检索后端失败: %v\n", err)
+			os.Exit(1)
+		}
+		total, err := vs.CountChunks(db)
+		if err != nil {
+			b.Close()
+			fmt.Printf("统计分块失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("正在迁移 %d 个分块到 %s ...\n", total, target)
+		start := time.Now()
+		copied, err := vs.Migrate(db, b, func(done int) {
+			fmt.Printf("\r  已迁移 %d/%d", done, total)
+		})
+		fmt.Println()
+		if err != nil {
+			b.Close()
+			fmt.Printf("迁移失败（已迁移 %d 个分块，可重新执行以继续）: %v\n", copied, err)
+			os.Exit(1)
+		}
+		held, err := b.Count()
+		b.Close()
+		if err != nil {
+			fmt.Printf("校验失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("迁移完成: %d 个分块，后端现有 %d 个向量，耗时 %s\n", copied, held, time.Since(start).Round(time.Second))
+		if held < copied {
+			fmt.Println("错误: 后端向量数少于已迁移的分块数，未切换后端")
+			os.Exit(1)
+		}
+	}
+
+	if err := cm.Update(map[string]interface{}{"vector.backend": target}); err != nil {
+		fmt.Printf("保存配置失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("已切换向量检索后端为 %s，重启服务后生效\n", target)
+}
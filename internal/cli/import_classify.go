@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"askflow/internal/document"
+	"askflow/internal/handler"
+	"askflow/internal/product"
+)
+
+// importAutoProduct is the manifest and report product ID of an import run
+// with --auto-product, whose files each carry their own product.
+const importAutoProduct = "auto"
+
+// classifyImportFiles proposes a product for each file the import will
+// process and, unless yes is set, lets the user review and change the
+// proposals before anything is imported. It returns the product ID of each
+// file by path ("" = public library), or false if the user cancelled.
+func classifyImportFiles(files []string, dm *document.DocumentManager, ps *product.ProductService, manifest *importManifest, resume, retryFailed, yes bool) (map[string]string, bool) {
+	products, err := ps.List()
+	if err != nil {
+		fmt.Printf("错误: 无法读取产品列表: %v\n", err)
+		os.Exit(1)
+	}
+	if len(products) == 0 {
+		fmt.Println("错误: 系统中没有产品，无法自动分类")
+		os.Exit(1)
+	}
+	candidates := make([]document.ProductCandidate, len(products))
+	names := map[string]string{"": "公共库"}
+	for i, p := range products {
+		candidates[i] = document.ProductCandidate{ID: p.ID, Name: p.Name, Description: p.Description}
+		names[p.ID] = p.Name
+	}
+
+	fmt.Printf("正在按 %d 个产品自动分类 %d 个文件...\n\n", len(products), len(files))
+	assignments := make(map[string]string, len(files))
+	var pending []string // files shown for confirmation, in order
+	for i, filePath := range files {
+		fmt.Printf("[%d/%d] %s ... ", i+1, len(files), filePath)
+		fileData, err := os.ReadFile(filePath)
+		if err != nil {
+			// Reported again when the import reads the file
+			fmt.Printf("读取失败: %v\n", err)
+			continue
+		}
+		if prev := manifest.Files[hashFileData(fileData)]; resume && prev != nil && (prev.Status == importSuccess || !retryFailed) {
+			fmt.Println("跳过 (清单中已处理)")
+			continue
+		}
+		fileType := handler.SupportedExtensions[strings.ToLower(filepath.Ext(filePath))]
+		s, err := dm.ClassifyProduct(filepath.Base(filePath), fileType, fileData, candidates)
+		if err != nil {
+			fmt.Printf("分类失败，归入公共库: %v\n", err)
+			s = &document.ProductSuggestion{}
+		} else {
+			fmt.Println(names[s.ProductID])
+		}
+		assignments[filePath] = s.ProductID
+		pending = append(pending, filePath)
+	}
+	if yes || len(pending) == 0 {
+		return assignments, true
+	}
+	return assignments, confirmImportProducts(os.Stdin, pending, assignments, products, names)
+}
+
+// confirmImportProducts prints the proposed assignments and reads commands
+// from in until the user accepts (y) or cancels (n). "<file no.>=<product
+// no.>" reassigns a file, product number 0 being the public library.
+func confirmImportProducts(in io.Reader, files []string, assignments map[string]string, products []product.Product, names map[string]string) bool {
+	printAssignments := func() {
+		fmt.Println("\n========== 产品分类建议 ==========")
+		for i, f := range files {
+			fmt.Printf("  %d. %s → %s\n", i+1, f, names[assignments[f]])
+		}
+		fmt.Println("\n产品编号:")
+		fmt.Println("  0. 公共库")
+		for i, p := range products {
+			fmt.Printf("  %d. %s (%s)\n", i+1, p.Name, p.ID)
+		}
+		fmt.Println("==================================")
+	}
+	printAssignments()
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Print("输入 y 按上述归属导入，n 取消，或 <文件序号>=<产品编号> 修改归属: ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return false
+		}
+		line := strings.TrimSpace(scanner.Text())
+		switch strings.ToLower(line) {
+		case "y", "yes":
+			return true
+		case "n", "no", "q":
+			return false
+		case "":
+			continue
+		}
+		fileNo, productNo, ok := strings.Cut(line, "=")
+		fi, err1 := strconv.Atoi(strings.TrimSpace(fileNo))
+		pi, err2 := strconv.Atoi(strings.TrimSpace(productNo))
+		if !ok || err1 != nil || err2 != nil || fi < 1 || fi > len(files) || pi < 0 || pi > len(products) {
+			fmt.Println("无效输入")
+			continue
+		}
+		if pi == 0 {
+			assignments[files[fi-1]] = ""
+		} else {
+			assignments[files[fi-1]] = products[pi-1].ID
+		}
+		printAssignments()
+	}
+}
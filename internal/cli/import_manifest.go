@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"askflow/internal/document"
+)
+
+// defaultImportManifest is the progress manifest written to the current
+// directory when --manifest is not given.
+const defaultImportManifest = "askflow-import.manifest.json"
+
+// Import statuses recorded in the manifest and the JSON report.
+const (
+	importSuccess = "success"
+	importFailed  = "failed"
+	importSkipped = "skipped" // already handled by an earlier run (report only)
+	importPlanned = "planned" // would be imported (--dry-run report only)
+)
+
+// importManifestSaveEvery bounds how many files are imported between two
+// manifest writes, so an interrupted import redoes at most that many.
+const importManifestSaveEvery = 10
+
+// importEntry is the outcome of importing one file.
+type importEntry struct {
+	Path      string    `json:"path"`
+	Hash      string    `json:"hash,omitempty"`
+	Status    string    `json:"status"`
+	ProductID string    `json:"product_id,omitempty"` // --auto-product only
+	DocID     string    `json:"doc_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Estimate *document.ImportEstimate `json:"estimate,omitempty"` // --dry-run only
+}
+
+// importManifest records the outcome of each file of an import by content
+// hash, so a re-run can skip files that were already handled even if they
+// moved.
+type importManifest struct {
+	ProductID string                  `json:"product_id"`
+	UpdatedAt time.Time               `json:"updated_at"`
+	Files     map[string]*importEntry `json:"files"` // sha256 of the content → outcome
+
+	path    string
+	pending int
+}
+
+// loadImportManifest reads the manifest at path. A missing file yields an
+// empty manifest.
+func loadImportManifest(path string) (*importManifest, error) {
+	m := &importManifest{Files: make(map[string]*importEntry), path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("解析导入清单失败: %w", err)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]*importEntry)
+	}
+	m.path = path
+	return m, nil
+}
+
+// record stores the outcome of a file and writes the manifest every
+// importManifestSaveEvery records.
+func (m *importManifest) record(e *importEntry) error {
+	m.Files[e.Hash] = e
+	m.pending++
+	if m.pending < importManifestSaveEvery {
+		return nil
+	}
+	return m.save()
+}
+
+// save writes the manifest atomically: a crash mid-write leaves the previous
+// version in place.
+func (m *importManifest) save() error {
+	m.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	m.pending = 0
+	return nil
+}
+
+// importReport is the machine-readable summary written by --report.
+type importReport struct {
+	ProductID  string         `json:"product_id"`
+	DryRun     bool           `json:"dry_run,omitempty"`
+	Manifest   string         `json:"manifest,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Total      int            `json:"total"`
+	Success    int            `json:"success"`
+	Planned    int            `json:"planned,omitempty"` // would be imported (--dry-run)
+	Failed     int            `json:"failed"`
+	Skipped    int            `json:"skipped"`
+	Filtered   int            `json:"filtered"` // excluded by --include/--exclude/--max-size/--modified-since
+	Files      []*importEntry `json:"files"`
+
+	Estimate *document.ImportEstimate `json:"estimate,omitempty"` // totals of a --dry-run
+}
+
+func writeImportReport(path string, r *importReport) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func hashFileData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
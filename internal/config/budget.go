@@ -0,0 +1,105 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BudgetConfig caps the estimated LLM and embedding spend of a calendar
+// month, for the whole deployment and per product. Spend is counted in the
+// currency of llm.price_per_m_tokens and embedding.price_per_m_tokens, so
+// caps only take effect once those prices are set. Admins are alerted at 80%
+// and 100% of each cap.
+type BudgetConfig struct {
+	// MonthlyLimit caps the spend of the deployment; 0 means no cap.
+	MonthlyLimit float64 `json:"monthly_limit"`
+	// ProductLimits caps the spend of queries of single products, by product
+	// ID. Import and other work not tied to a product counts toward
+	// MonthlyLimit only.
+	ProductLimits map[string]float64 `json:"product_limits,omitempty"`
+	// OnLimit is what happens once a cap is reached: BudgetBlockOptional
+	// (default) stops non-essential LLM calls such as translations, tagging
+	// and suggestions; BudgetDegrade also answers questions from cached
+	// answers and keyword search only, without any model call.
+	OnLimit string `json:"on_limit"`
+}
+
+// Budget actions.
+const (
+	BudgetBlockOptional = "block_optional"
+	BudgetDegrade       = "degrade"
+)
+
+// maxBudgetLimit bounds monthly caps.
+const maxBudgetLimit = 1e9
+
+// EffectiveOnLimit returns OnLimit, or BudgetBlockOptional when unset.
+func (b BudgetConfig) EffectiveOnLimit() string {
+	if b.OnLimit == BudgetDegrade {
+		return BudgetDegrade
+	}
+	return BudgetBlockOptional
+}
+
+// ProductLimit returns the cap of a product, 0 when it has none.
+func (b BudgetConfig) ProductLimit(productID string) float64 {
+	if productID == "" {
+		return 0
+	}
+	return b.ProductLimits[productID]
+}
+
+// applyBudgetUpdate handles budget keys like "budget.monthly_limit".
+func (cm *ConfigManager) applyBudgetUpdate(key string, val interface{}) error {
+	b := &cm.config.Budget
+	switch strings.TrimPrefix(key, "budget.") {
+	case "monthly_limit":
+		f, err := toFloat64(val)
+		if err != nil {
+			return err
+		}
+		if f < 0 || f > maxBudgetLimit {
+			return errors.New("budget monthly_limit must be between 0 and 1e9")
+		}
+		b.MonthlyLimit = f
+	case "on_limit":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s != BudgetBlockOptional && s != BudgetDegrade {
+			return errors.New("budget on_limit must be block_optional or degrade")
+		}
+		b.OnLimit = s
+	case "product_limits":
+		raw, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		var limits map[string]float64
+		if err := json.Unmarshal(raw, &limits); err != nil {
+			return errors.New("expected object of product ID to monthly limit")
+		}
+		for id, f := range limits {
+			if strings.TrimSpace(id) == "" {
+				return errors.New("budget product_limits keys must be product IDs")
+			}
+			if f < 0 || f > maxBudgetLimit {
+				return fmt.Errorf("budget limit of product %s must be between 0 and 1e9", id)
+			}
+			if f == 0 {
+				delete(limits, id)
+			}
+		}
+		if len(limits) == 0 {
+			limits = nil
+		}
+		b.ProductLimits = limits
+	default:
+		return fmt.Errorf("unknown config key: %s", key)
+	}
+	return nil
+}
@@ -5,16 +5,27 @@ package config
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
+	"time"
+
+	"askflow/internal/datadir"
+	"askflow/internal/langdetect"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -27,17 +38,44 @@ const encryptedPrefix = "enc:"
 
 // Config holds all system configuration.
 type Config struct {
-	Server       ServerConfig    `json:"server"`
-	LLM          LLMConfig       `json:"llm"`
-	Embedding    EmbeddingConfig `json:"embedding"`
-	Vector       VectorConfig    `json:"vector"`
-	OAuth        OAuthConfig     `json:"oauth"`
-	Admin        AdminConfig     `json:"admin"`
-	SMTP         SMTPConfig      `json:"smtp"`
-	ProductIntro string          `json:"product_intro"`
-	ProductName  string          `json:"product_name"`
-	Video        VideoConfig     `json:"video"`
-	AuthServer   string          `json:"auth_server"` // license verification server host, e.g. "license.vantagedata.chat"
+	Server       ServerConfig      `json:"server"`
+	LLM          LLMConfig         `json:"llm"`
+	Embedding    EmbeddingConfig   `json:"embedding"`
+	Vector       VectorConfig      `json:"vector"`
+	OAuth        OAuthConfig       `json:"oauth"`
+	Admin        AdminConfig       `json:"admin"`
+	SMTP         SMTPConfig        `json:"smtp"`
+	ProductIntro string            `json:"product_intro"`
+	ProductName  string            `json:"product_name"`
+	Video        VideoConfig       `json:"video"`
+	Scan         ScanConfig        `json:"scan"`
+	Maintenance  MaintenanceConfig `json:"maintenance"`
+	Jobs         JobsConfig        `json:"jobs"`
+	Files        FilesConfig       `json:"files"`
+	Verify       VerifyConfig      `json:"verify"`
+	Review       ReviewConfig      `json:"review"`
+	Portal       PortalConfig      `json:"portal"`
+	HTML         HTMLConfig        `json:"html"`
+	EmailIngest  EmailIngestConfig `json:"email_ingest"`
+	Tagging      TaggingConfig     `json:"tagging"`
+	Audit        AuditConfig       `json:"audit"`
+	Rerank       RerankConfig      `json:"rerank"`
+	Backup       BackupConfig      `json:"backup"`
+	Password     PasswordConfig    `json:"password"`
+	Session      SessionConfig     `json:"session"`
+	// Notifications pushes new pending questions to team chat.
+	Notifications NotificationsConfig `json:"notifications"`
+	// SmallTalk answers greetings, thanks and the like without an LLM call.
+	SmallTalk SmallTalkConfig `json:"small_talk"`
+	// Export periodically exports analytics for BI tools.
+	Export ExportConfig `json:"export"`
+	// Budget caps the monthly LLM and embedding spend.
+	Budget BudgetConfig `json:"budget"`
+	// ExternalAuth signs users in through an external HTTP verifier.
+	ExternalAuth ExternalAuthConfig `json:"external_auth"`
+	// SourceCredentials authenticates URL imports and feeds per domain.
+	SourceCredentials map[string]SourceCredential `json:"source_credentials,omitempty"`
+	AuthServer   string            `json:"auth_server"` // license verification server host, e.g. "license.vantagedata.chat"
 }
 
 
@@ -47,16 +85,84 @@ type ServerConfig struct {
 	Port    int    `json:"port"`
 	SSLCert string `json:"ssl_cert"` // path to SSL certificate file (PEM)
 	SSLKey  string `json:"ssl_key"`  // path to SSL private key file (PEM)
+	// ReadOnly enables demo/safe mode: config writes, uploads and destructive endpoints
+	// are rejected while queries keep working. It can only be toggled from the CLI.
+	ReadOnly bool `json:"read_only"`
+	// ExternalBaseURL is the URL users reach the service at, e.g.
+	// "https://help.example.com/askflow" behind a path-prefixed reverse proxy.
+	// When set it is used for email links, OAuth redirects, ticket-login
+	// redirects and share links instead of the request's Host header.
+	ExternalBaseURL string `json:"external_base_url"`
 }
 
 
 // LLMConfig holds LLM service configuration.
 type LLMConfig struct {
+	// Provider is the protocol of the endpoint: LLMProviderOpenAI or
+	// LLMProviderOllama.
+	Provider    string  `json:"provider"`
 	Endpoint    string  `json:"endpoint"`
 	APIKey      string  `json:"api_key"`
 	ModelName   string  `json:"model_name"`
 	Temperature float64 `json:"temperature"`
 	MaxTokens   int     `json:"max_tokens"`
+	// MaxConcurrency bounds how many queries generate answers at the same
+	// time; further queries wait in a queue. MaxQueue caps that queue and
+	// MaxQueuedPerUser how many of one user's queries may wait in it;
+	// requests beyond either are refused with "busy". A query waiting longer
+	// than QueueTimeoutSec gives up.
+	MaxConcurrency   int `json:"max_concurrency"`
+	MaxQueue         int `json:"max_queue"`
+	MaxQueuedPerUser int `json:"max_queued_per_user"`
+	QueueTimeoutSec  int `json:"queue_timeout_sec"`
+	// PricePerMTokens is the price of one million tokens, used only to
+	// estimate the cost of imports (OCR of scanned PDFs). 0 = unknown.
+	PricePerMTokens float64 `json:"price_per_m_tokens"`
+	// Profiles are further LLM endpoints besides the one above, which is the
+	// profile named DefaultLLMProfile with priority 0. Calls that fail with a
+	// timeout, network error or 5xx move on to the next profile by priority.
+	Profiles []LLMProfile `json:"profiles,omitempty"`
+	// Routes sends a task (see LLMTasks) to a profile first, e.g. intent
+	// classification to a cheap model and OCR to a vision model. Tasks
+	// without a route start with the profile of lowest priority.
+	Routes map[string]string `json:"routes,omitempty"`
+}
+
+// DefaultLLMProfile is the profile name of the main LLM endpoint.
+const DefaultLLMProfile = "default"
+
+// LLM providers, see LLMConfig.Provider.
+const (
+	LLMProviderOpenAI = "openai" // OpenAI-compatible Chat Completion API
+	LLMProviderOllama = "ollama" // native Ollama API, e.g. http://localhost:11434
+)
+
+// Tasks LLM calls can be routed by.
+const (
+	LLMTaskAnswer = "answer" // answer generation
+	LLMTaskIntent = "intent" // intent classification of questions
+	LLMTaskVision = "vision" // OCR, video keyframes and questions with images
+)
+
+// LLMTasks lists the tasks that can be routed to a profile.
+var LLMTasks = []string{LLMTaskAnswer, LLMTaskIntent, LLMTaskVision}
+
+// LLMProfile is a named LLM endpoint. Its API key is encrypted in the config
+// file.
+type LLMProfile struct {
+	Name        string  `json:"name"`
+	Provider    string  `json:"provider"` // "" = LLMProviderOpenAI
+	Endpoint    string  `json:"endpoint"`
+	APIKey      string  `json:"api_key"`
+	ModelName   string  `json:"model_name"`
+	Temperature float64 `json:"temperature"`
+	MaxTokens   int     `json:"max_tokens"` // 0 = that of the main endpoint
+	// Priority orders failover, lowest first; the main endpoint has 0.
+	Priority int `json:"priority"`
+	// TimeoutSec bounds one call before failing over. 0 = 120, or 300 for
+	// Ollama.
+	TimeoutSec int  `json:"timeout_sec"`
+	Disabled   bool `json:"disabled"`
 }
 
 // EmbeddingConfig holds embedding service configuration.
@@ -65,18 +171,47 @@ type EmbeddingConfig struct {
 	APIKey        string `json:"api_key"`
 	ModelName     string `json:"model_name"`
 	UseMultimodal bool   `json:"use_multimodal"`
+	// PricePerMTokens is the price of one million embedding tokens, used to
+	// estimate the cost of imports. 0 = unknown.
+	PricePerMTokens float64 `json:"price_per_m_tokens"`
 }
 
 // VectorConfig holds vector store configuration.
 type VectorConfig struct {
-	DBPath          string  `json:"db_path"`
-	ChunkSize       int     `json:"chunk_size"`
-	Overlap         int     `json:"overlap"`
-	TopK            int     `json:"top_k"`
-	Threshold       float64 `json:"threshold"`
-	ContentPriority string  `json:"content_priority"` // "image_text" (default) or "text_only"
-	DebugMode       bool    `json:"debug_mode"`       // when true, query responses include search diagnostics
-	TextMatchEnabled bool   `json:"text_match_enabled"` // enable 3-level text similarity processing to save API costs
+	DBPath             string   `json:"db_path"`
+	ChunkSize          int      `json:"chunk_size"`
+	Overlap            int      `json:"overlap"`
+	TopK               int      `json:"top_k"`
+	Threshold          float64  `json:"threshold"`
+	ContentPriority    string   `json:"content_priority"`    // "image_text" (default) or "text_only"
+	DebugMode          bool     `json:"debug_mode"`          // when true, admin query responses include search diagnostics by default
+	TextMatchEnabled   bool     `json:"text_match_enabled"`  // enable 3-level text similarity processing to save API costs
+	TranslateLanguages []string `json:"translate_languages"` // languages chunks are machine-translated into at ingestion time; empty disables translation
+	// LanguageFilter sets how strongly retrieval favors chunks in the
+	// language of the question, judged by the language detected for each
+	// document at ingestion: LanguageFilterOff, Prefer or Strict.
+	LanguageFilter string `json:"language_filter"`
+	// Backend selects the engine answering vector searches: "sqlite" (the
+	// default in-process scan) or an external engine such as "qdrant". Chunks
+	// are always kept in SQLite as well. Changing it requires a restart.
+	Backend string       `json:"backend"`
+	Qdrant  QdrantConfig `json:"qdrant"`
+}
+
+// Retrieval language filters, see VectorConfig.LanguageFilter.
+const (
+	LanguageFilterOff    = "off"    // rank chunks regardless of their language
+	LanguageFilterPrefer = "prefer" // chunks in the question's language first, others fill the remaining slots
+	LanguageFilterStrict = "strict" // only chunks in the question's language, unless none was found
+)
+
+// QdrantConfig locates the Qdrant server used when vector.backend is
+// "qdrant". Vectors go to one collection per embedding dimension, named
+// <collection>_<dim>. The API key is encrypted in the config file.
+type QdrantConfig struct {
+	URL        string `json:"url"`        // REST endpoint, e.g. http://localhost:6333
+	APIKey     string `json:"api_key"`    // optional
+	Collection string `json:"collection"` // collection name prefix, default "askflow_chunks"
 }
 
 // SMTPConfig holds SMTP email server configuration.
@@ -116,6 +251,458 @@ type VideoConfig struct {
 	KeyframeOCREnabled    bool   `json:"keyframe_ocr_enabled"`     // enable LLM-based OCR on keyframes for text search
 	KeyframeOCRMaxFrames  int    `json:"keyframe_ocr_max_frames"`  // max keyframes to OCR (0=unlimited), default 20
 	ProcessingTimeoutMin  int    `json:"processing_timeout_min"`   // async processing timeout in minutes, default 120
+	OCRLanguage           string `json:"ocr_language"`             // OCR/keyframe prompt language: "zh" (default), "en", "ja" or "auto"
+	KeyframeMode          string  `json:"keyframe_mode"`           // "interval" (default, one frame every KeyframeInterval s) or "scene" (scene-change detection)
+	SceneThreshold        float64 `json:"scene_threshold"`         // scene-change score (0-1) above which a frame is kept in scene mode, default 0.3
+	KeyframeMinInterval   int     `json:"keyframe_min_interval"`   // minimum seconds between two scene-mode keyframes, default 2
+	KeyframeMaxFrames     int     `json:"keyframe_max_frames"`     // max keyframes kept per video, evenly sampled (0=unlimited), default 300
+	ChapteringEnabled     bool    `json:"chaptering_enabled"`      // split long transcripts into LLM-titled chapters
+	YtDlpPath             string  `json:"ytdlp_path"`              // yt-dlp executable path for YouTube/Vimeo URL imports, empty means platform URLs are not supported
+	URLMaxDurationMin     int     `json:"url_max_duration_min"`    // max duration of media imported from a URL in minutes, default 120
+	DiarizationCommand    string  `json:"diarization_command"`     // optional speaker diarization executable for call recordings, called with a WAV path; prints [{"start","end","speaker"}] JSON
+}
+
+// ScanConfig holds the optional malware scanning stage for uploaded files.
+type ScanConfig struct {
+	Mode          string `json:"mode"`           // "" (disabled), "clamav" (clamd socket) or "command" (external scanner)
+	ClamAVAddress string `json:"clamav_address"` // clamd address: a unix socket path or host:port, default "127.0.0.1:3310"
+	Command       string `json:"command"`        // scanner executable, called with the file path; exit 0 = clean, 1 = infected
+	TimeoutSec    int    `json:"timeout_sec"`    // per-file scan timeout in seconds, default 120
+	BlockOnError  bool   `json:"block_on_error"` // quarantine files that could not be scanned instead of accepting them
+	AlertEmail    string `json:"alert_email"`    // administrator address notified when a file is quarantined
+}
+
+// FilesConfig controls how files are created in the data directory. It is
+// read at startup only and can only be changed in the config file.
+type FilesConfig struct {
+	Umask             string `json:"umask"`                // octal process umask, e.g. "0027"; empty keeps the inherited umask
+	DirMode           string `json:"dir_mode"`             // octal mode for new directories, default "0755"
+	FileMode          string `json:"file_mode"`            // octal mode for new files, default "0644"
+	RestrictToDataDir bool   `json:"restrict_to_data_dir"` // reject batch-import paths outside the data directory
+}
+
+// VerifyConfig controls the faithfulness check of generated answers: a second
+// LLM call checks each sentence of the answer against the retrieved chunks.
+type VerifyConfig struct {
+	Mode string `json:"mode"` // "" (off), "flag" (mark unsupported sentences) or "remove" (drop them from the answer)
+}
+
+// Answer verification modes for VerifyConfig.Mode.
+const (
+	VerifyModeFlag   = "flag"
+	VerifyModeRemove = "remove"
+)
+
+// ReviewConfig controls the approval workflow for knowledge entries and
+// answers to pending questions.
+type ReviewConfig struct {
+	// Required makes new entries and answers start as drafts that another
+	// admin must approve before they are used in answers.
+	Required bool `json:"required"`
+}
+
+// PortalConfig controls the read-only documentation portal API, which
+// publishes knowledge entries and markdown documents as browsable articles
+// without login.
+type PortalConfig struct {
+	Enabled bool `json:"enabled"`
+	// ProductIDs limits the portal to these products; empty publishes all
+	// products. The public library is always included.
+	ProductIDs []string `json:"product_ids"`
+}
+
+// HTMLConfig controls how HTML pages and URL imports are reduced to their
+// main content before chunking, leaving out navigation, banners and footers.
+type HTMLConfig struct {
+	MainContentEnabled bool `json:"main_content_enabled"` // extract the main content instead of indexing the whole page
+	// Selectors overrides the detection for specific sites: a CSS selector
+	// (tag, #id, .class, descendant and comma lists) per host. A host also
+	// matches its subdomains, e.g. "example.com" matches "docs.example.com".
+	Selectors map[string]string `json:"selectors"`
+}
+
+// EmailIngestConfig controls the inbound email webhook, which converts
+// messages sent to a designated mailbox, typically support staff forwarding
+// useful answers, into draft knowledge entries for review.
+type EmailIngestConfig struct {
+	Enabled bool `json:"enabled"`
+	// Token is the shared secret the mail provider presents to the webhook;
+	// it is encrypted in the config file.
+	Token string `json:"token"`
+	// Recipients are the designated mailbox addresses; messages not sent to
+	// one of them are ignored. Empty accepts all messages.
+	Recipients []string `json:"recipients"`
+	// AllowedSenders are the sender addresses or domains ("@example.com")
+	// accepted. Empty accepts all senders.
+	AllowedSenders []string `json:"allowed_senders"`
+	ProductID      string   `json:"product_id"` // product of the entries; empty for the public library
+}
+
+// TaggingConfig controls LLM tagging at ingestion: each processed document
+// gets a category (manual, FAQ, release note...), topic tags and the products
+// it mentions, used by document filters and scoped queries. Off by default as
+// it costs one LLM call per document.
+type TaggingConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// AuditConfig controls the answer audit trail: an immutable record per
+// answered query of the prompt, retrieved chunks, model and answer, kept for
+// resolving disputes about what the bot told a customer.
+type AuditConfig struct {
+	Disabled bool `json:"disabled"` // stop recording audits (existing records are kept)
+	// RetentionDays is how long audit records are kept; 0 keeps them forever.
+	RetentionDays int `json:"retention_days"`
+}
+
+// RerankConfig configures the optional reranking stage of queries: the top
+// vector search hits are re-scored against the question by a cross-encoder
+// rerank API (Cohere/Jina-style /rerank) and the best top_k of them kept.
+type RerankConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Endpoint  string `json:"endpoint"` // base URL, e.g. https://api.jina.ai/v1; "/rerank" is appended unless present
+	APIKey    string `json:"api_key"`
+	ModelName string `json:"model_name"`
+	// TopN is how many vector hits are sent for reranking; 0 uses the default
+	// (20, at least vector.top_k).
+	TopN int `json:"top_n"`
+}
+
+// BackupConfig configures where `askflow backup` stores archives besides the
+// local output directory.
+type BackupConfig struct {
+	S3 S3Config `json:"s3"`
+}
+
+// S3Config is an S3-compatible object storage target (AWS S3, MinIO, Aliyun
+// OSS, ...). Backup archives and manifests are uploaded under Prefix in
+// Bucket when Endpoint and Bucket are set. The secret key is encrypted in the
+// config file.
+type S3Config struct {
+	Endpoint  string `json:"endpoint"` // e.g. https://s3.amazonaws.com, http://minio:9000, https://oss-cn-hangzhou.aliyuncs.com
+	Region    string `json:"region"`   // signing region, default "us-east-1"
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	Prefix    string `json:"prefix"` // object key prefix, e.g. "askflow/"
+	// PathStyle addresses objects as endpoint/bucket/key instead of
+	// bucket.endpoint/key, as MinIO usually requires.
+	PathStyle bool `json:"path_style"`
+}
+
+// Enabled reports whether backups are uploaded to object storage.
+func (c S3Config) Enabled() bool {
+	return c.Endpoint != "" && c.Bucket != ""
+}
+
+// SourceCredential is attached to requests fetching source URLs of one
+// domain and its subdomains, for sites such as internal wikis that require
+// login. It is only sent over HTTPS. Cookies, the password and header values
+// are encrypted in the config file.
+type SourceCredential struct {
+	Headers  map[string]string `json:"headers,omitempty"`  // extra request headers, e.g. an API token header
+	Cookies  string            `json:"cookies,omitempty"`  // Cookie header value, e.g. "session=abc; lang=zh"
+	Username string            `json:"username,omitempty"` // HTTP basic auth
+	Password string            `json:"password,omitempty"`
+}
+
+// MaintenanceConfig holds the nightly database maintenance schedule.
+type MaintenanceConfig struct {
+	Disabled    bool   `json:"disabled"`     // turn off scheduled maintenance (it can still be run manually)
+	WindowStart string `json:"window_start"` // local time "HH:MM" the maintenance window opens, default "03:00"
+	WindowEnd   string `json:"window_end"`   // local time "HH:MM" after which no run is started, default "05:00"
+}
+
+// JobsConfig holds the background job queue settings.
+type JobsConfig struct {
+	Concurrency int `json:"concurrency"` // background jobs (e.g. document processing) run at once, 1-16, default 2
+}
+
+// NormalizeBaseURL validates an external base URL and strips the trailing
+// slash. An empty string is valid and means "derive from the request".
+func NormalizeBaseURL(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("external_base_url must be an absolute http(s) URL")
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", errors.New("external_base_url must not contain credentials, a query or a fragment")
+	}
+	return strings.TrimRight(u.Scheme+"://"+u.Host+u.EscapedPath(), "/"), nil
+}
+
+// EffectiveOAuthProviders returns the OAuth providers with redirect URLs
+// resolved against Server.ExternalBaseURL: an empty redirect URL becomes
+// <base>/oauth/callback and a relative one is prefixed with the base.
+func (c *Config) EffectiveOAuthProviders() map[string]OAuthProviderConfig {
+	base := c.Server.ExternalBaseURL
+	if base == "" {
+		return c.OAuth.Providers
+	}
+	out := make(map[string]OAuthProviderConfig, len(c.OAuth.Providers))
+	for name, p := range c.OAuth.Providers {
+		switch {
+		case p.RedirectURL == "":
+			p.RedirectURL = base + "/oauth/callback"
+		case strings.HasPrefix(p.RedirectURL, "/"):
+			p.RedirectURL = base + p.RedirectURL
+		}
+		out[name] = p
+	}
+	return out
+}
+
+// ParseClock parses a "HH:MM" time of day into minutes after midnight.
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q (expected HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Malware scan modes for ScanConfig.Mode.
+const (
+	ScanModeClamAV  = "clamav"
+	ScanModeCommand = "command"
+)
+
+// Keyframe extraction modes for VideoConfig.KeyframeMode.
+const (
+	KeyframeModeInterval = "interval"
+	KeyframeModeScene    = "scene"
+)
+
+// KeyframeOverrides holds per-product keyframe extraction settings.
+// Zero-valued fields inherit the deployment-wide VideoConfig value.
+type KeyframeOverrides struct {
+	Mode           string  `json:"mode,omitempty"`
+	Interval       int     `json:"interval,omitempty"`
+	SceneThreshold float64 `json:"scene_threshold,omitempty"`
+	MinInterval    int     `json:"min_interval,omitempty"`
+	MaxFrames      int     `json:"max_frames,omitempty"`
+}
+
+// Validate checks that every non-zero field is within the same bounds enforced for VideoConfig.
+func (o *KeyframeOverrides) Validate() error {
+	if o.Mode != "" && o.Mode != KeyframeModeInterval && o.Mode != KeyframeModeScene {
+		return errors.New("keyframe mode must be 'interval' or 'scene'")
+	}
+	if o.Interval < 0 || o.Interval > 300 {
+		return errors.New("keyframe interval must be between 1 and 300 seconds")
+	}
+	if o.SceneThreshold < 0 || o.SceneThreshold >= 1 {
+		return errors.New("scene_threshold must be between 0 and 1")
+	}
+	if o.MinInterval < 0 || o.MinInterval > 300 {
+		return errors.New("keyframe min_interval must be between 0 and 300 seconds")
+	}
+	if o.MaxFrames < 0 || o.MaxFrames > 2000 {
+		return errors.New("keyframe max_frames must be between 0 and 2000")
+	}
+	return nil
+}
+
+// Apply returns cfg with the non-zero override fields applied.
+func (o *KeyframeOverrides) Apply(cfg VideoConfig) VideoConfig {
+	if o == nil {
+		return cfg
+	}
+	if o.Mode != "" {
+		cfg.KeyframeMode = o.Mode
+	}
+	if o.Interval > 0 {
+		cfg.KeyframeInterval = o.Interval
+	}
+	if o.SceneThreshold > 0 {
+		cfg.SceneThreshold = o.SceneThreshold
+	}
+	if o.MinInterval > 0 {
+		cfg.KeyframeMinInterval = o.MinInterval
+	}
+	if o.MaxFrames > 0 {
+		cfg.KeyframeMaxFrames = o.MaxFrames
+	}
+	return cfg
+}
+
+// Built-in intent classification categories.
+const (
+	IntentGreeting   = "greeting"
+	IntentProduct    = "product"
+	IntentIrrelevant = "irrelevant"
+)
+
+// MaxIntentCategories caps the number of custom intent categories per product.
+const MaxIntentCategories = 10
+
+// IntentCategory is a custom intent class added to the classifier. Questions
+// classified into it are posted to WebhookURL (when set) and answered with
+// Response; an empty Response lets the question continue to the RAG pipeline.
+type IntentCategory struct {
+	Name        string `json:"name"`        // identifier returned by the classifier, e.g. "sales_inquiry"
+	Description string `json:"description"` // tells the classifier which questions belong here
+	Response    string `json:"response,omitempty"`
+	WebhookURL  string `json:"webhook_url,omitempty"`
+}
+
+// IntentSettings holds per-product intent classification settings.
+// A nil *IntentSettings keeps the default behaviour.
+type IntentSettings struct {
+	Disabled           bool             `json:"disabled,omitempty"`            // skip classification, every question goes to RAG
+	IrrelevantResponse string           `json:"irrelevant_response,omitempty"` // replaces the default off-topic reply
+	Model              string           `json:"model,omitempty"`               // model used for the classification call, empty uses llm.model_name
+	Categories         []IntentCategory `json:"categories,omitempty"`
+}
+
+// Validate checks the settings for well-formed category names, sizes and webhook URLs.
+func (s *IntentSettings) Validate() error {
+	if len(s.IrrelevantResponse) > 2000 {
+		return errors.New("irrelevant_response too long (max 2000 characters)")
+	}
+	if len(s.Model) > 100 {
+		return errors.New("intent model name too long (max 100 characters)")
+	}
+	if len(s.Categories) > MaxIntentCategories {
+		return fmt.Errorf("too many intent categories (max %d)", MaxIntentCategories)
+	}
+	seen := make(map[string]bool)
+	for _, c := range s.Categories {
+		if c.Name == "" || len(c.Name) > 50 {
+			return errors.New("intent category name must be 1-50 characters")
+		}
+		for _, r := range c.Name {
+			if !(r == '_' || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')) {
+				return fmt.Errorf("intent category name %q may only contain a-z, 0-9 and _", c.Name)
+			}
+		}
+		if c.Name == IntentGreeting || c.Name == IntentProduct || c.Name == IntentIrrelevant {
+			return fmt.Errorf("intent category name %q is reserved", c.Name)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("duplicate intent category %q", c.Name)
+		}
+		seen[c.Name] = true
+		if strings.TrimSpace(c.Description) == "" || len(c.Description) > 500 {
+			return fmt.Errorf("intent category %q needs a description (max 500 characters)", c.Name)
+		}
+		if len(c.Response) > 2000 {
+			return fmt.Errorf("intent category %q response too long (max 2000 characters)", c.Name)
+		}
+		if c.WebhookURL != "" {
+			u := strings.ToLower(c.WebhookURL)
+			if !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+				return fmt.Errorf("intent category %q webhook_url must be an http(s) URL", c.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Category returns the custom category with the given name, or nil.
+func (s *IntentSettings) Category(name string) *IntentCategory {
+	if s == nil {
+		return nil
+	}
+	for i := range s.Categories {
+		if s.Categories[i].Name == name {
+			return &s.Categories[i]
+		}
+	}
+	return nil
+}
+
+// AnswerDisclaimer is a per-product notice appended to every answer, such as
+// "not legal advice". A nil *AnswerDisclaimer adds nothing.
+type AnswerDisclaimer struct {
+	Text         string            `json:"text"`                   // used when no translation matches the answer's language
+	Translations map[string]string `json:"translations,omitempty"` // language code (see langdetect) → text
+}
+
+// Validate checks the text sizes and translation language codes.
+func (d *AnswerDisclaimer) Validate() error {
+	if strings.TrimSpace(d.Text) == "" {
+		return errors.New("disclaimer text is required")
+	}
+	if len(d.Text) > 2000 {
+		return errors.New("disclaimer text too long (max 2000 characters)")
+	}
+	for lang, text := range d.Translations {
+		if !langdetect.IsSupported(lang) {
+			return fmt.Errorf("unsupported disclaimer language %q", lang)
+		}
+		if strings.TrimSpace(text) == "" || len(text) > 2000 {
+			return fmt.Errorf("disclaimer translation %q must be 1-2000 characters", lang)
+		}
+	}
+	return nil
+}
+
+// For returns the disclaimer text for an answer in lang, falling back to
+// Text. It returns "" for a nil disclaimer.
+func (d *AnswerDisclaimer) For(lang string) string {
+	if d == nil {
+		return ""
+	}
+	if t, ok := d.Translations[lang]; ok {
+		return t
+	}
+	return d.Text
+}
+
+// OCR language codes accepted by VideoConfig.OCRLanguage and the per-product override.
+const (
+	OCRLanguageChinese  = "zh"
+	OCRLanguageEnglish  = "en"
+	OCRLanguageJapanese = "ja"
+	OCRLanguageAuto     = "auto"
+)
+
+// IsValidOCRLanguage reports whether lang is a supported OCR language code.
+func IsValidOCRLanguage(lang string) bool {
+	switch lang {
+	case OCRLanguageChinese, OCRLanguageEnglish, OCRLanguageJapanese, OCRLanguageAuto:
+		return true
+	}
+	return false
+}
+
+// toLanguageList accepts a JSON array or a comma-separated string of language
+// codes and returns the validated, de-duplicated list.
+func toLanguageList(val interface{}) ([]string, error) {
+	var raw []string
+	switch v := val.(type) {
+	case string:
+		raw = strings.Split(v, ",")
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, errors.New("expected string array")
+			}
+			raw = append(raw, s)
+		}
+	default:
+		return nil, errors.New("expected string array")
+	}
+	langs := make([]string, 0, len(raw))
+	seen := make(map[string]bool)
+	for _, s := range raw {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" || seen[s] {
+			continue
+		}
+		if !langdetect.IsSupported(s) {
+			return nil, fmt.Errorf("unsupported language: %s", s)
+		}
+		seen[s] = true
+		langs = append(langs, s)
+	}
+	return langs, nil
 }
 
 // AdminConfig holds admin authentication configuration.
@@ -125,6 +712,9 @@ type AdminConfig struct {
 	LoginRoute        string `json:"login_route"`
 	AnonymousMode     bool   `json:"anonymous_mode"`
 	AnonymousFrontend bool   `json:"anonymous_frontend"`
+	// PasswordChangedAt is when the password was last set (RFC 3339), for
+	// password.max_age_days; empty for passwords set before it was recorded.
+	PasswordChangedAt string `json:"password_changed_at,omitempty"`
 }
 
 // ConfigManager manages loading, saving, and updating configuration.
@@ -170,11 +760,16 @@ func DefaultConfig() *Config {
 			Port: 8080,
 		},
 		LLM: LLMConfig{
+			Provider:    LLMProviderOpenAI,
 			Endpoint:    "",
 			APIKey:      "",
 			ModelName:   "",
-			Temperature: 0.3,
-			MaxTokens:   2048,
+			Temperature:      0.3,
+			MaxTokens:        2048,
+			MaxConcurrency:   8,
+			MaxQueue:         100,
+			MaxQueuedPerUser: 3,
+			QueueTimeoutSec:  60,
 		},
 		Embedding: EmbeddingConfig{
 			Endpoint:      "",
@@ -190,6 +785,7 @@ func DefaultConfig() *Config {
 			Threshold:        0.5,
 			ContentPriority:  "image_text",
 			TextMatchEnabled: true,
+			LanguageFilter:   LanguageFilterOff,
 		},
 		OAuth: OAuthConfig{
 			Providers: make(map[string]OAuthProviderConfig),
@@ -210,6 +806,39 @@ func DefaultConfig() *Config {
 			KeyframeOCREnabled:   true,
 			KeyframeOCRMaxFrames: 20,
 			ProcessingTimeoutMin: 120,
+			OCRLanguage:          OCRLanguageChinese,
+			KeyframeMode:         KeyframeModeInterval,
+			SceneThreshold:       0.3,
+			KeyframeMinInterval:  2,
+			KeyframeMaxFrames:    300,
+			ChapteringEnabled:    true,
+			URLMaxDurationMin:    120,
+		},
+		Scan: ScanConfig{
+			ClamAVAddress: "127.0.0.1:3310",
+			TimeoutSec:    120,
+		},
+		Maintenance: MaintenanceConfig{
+			WindowStart: "03:00",
+			WindowEnd:   "05:00",
+		},
+		Jobs: JobsConfig{
+			Concurrency: 2,
+		},
+		SmallTalk: SmallTalkConfig{
+			IntroIntervalMin: 30,
+			Rules:            DefaultSmallTalkRules(),
+		},
+		Export: ExportConfig{
+			Format:        ExportNDJSON,
+			IntervalHours: defaultExportIntervalHours,
+			S3Prefix:      defaultExportS3Prefix,
+		},
+		HTML: HTMLConfig{
+			MainContentEnabled: true,
+		},
+		Audit: AuditConfig{
+			RetentionDays: 180,
 		},
 	}
 }
@@ -238,6 +867,11 @@ func (cm *ConfigManager) Load() error {
 	if cfg.LLM.APIKey, err = cm.decryptIfNeeded(cfg.LLM.APIKey); err != nil {
 		return fmt.Errorf("decrypt LLM API key: %w", err)
 	}
+	for i, p := range cfg.LLM.Profiles {
+		if cfg.LLM.Profiles[i].APIKey, err = cm.decryptIfNeeded(p.APIKey); err != nil {
+			return fmt.Errorf("decrypt LLM profile %s API key: %w", p.Name, err)
+		}
+	}
 	if cfg.Embedding.APIKey, err = cm.decryptIfNeeded(cfg.Embedding.APIKey); err != nil {
 		return fmt.Errorf("decrypt Embedding API key: %w", err)
 	}
@@ -250,6 +884,59 @@ func (cm *ConfigManager) Load() error {
 	if cfg.SMTP.Password, err = cm.decryptIfNeeded(cfg.SMTP.Password); err != nil {
 		return fmt.Errorf("decrypt SMTP password: %w", err)
 	}
+	if cfg.EmailIngest.Token, err = cm.decryptIfNeeded(cfg.EmailIngest.Token); err != nil {
+		return fmt.Errorf("decrypt email ingest token: %w", err)
+	}
+	if cfg.Rerank.APIKey, err = cm.decryptIfNeeded(cfg.Rerank.APIKey); err != nil {
+		return fmt.Errorf("decrypt rerank API key: %w", err)
+	}
+	if cfg.Vector.Qdrant.APIKey, err = cm.decryptIfNeeded(cfg.Vector.Qdrant.APIKey); err != nil {
+		return fmt.Errorf("decrypt Qdrant API key: %w", err)
+	}
+	if cfg.Backup.S3.SecretKey, err = cm.decryptIfNeeded(cfg.Backup.S3.SecretKey); err != nil {
+		return fmt.Errorf("decrypt backup S3 secret key: %w", err)
+	}
+	for _, name := range NotifyChannels {
+		ch := cfg.Notifications.Channel(name)
+		if ch.WebhookURL, err = cm.decryptIfNeeded(ch.WebhookURL); err != nil {
+			return fmt.Errorf("decrypt %s notification webhook URL: %w", name, err)
+		}
+		if ch.Secret, err = cm.decryptIfNeeded(ch.Secret); err != nil {
+			return fmt.Errorf("decrypt %s notification secret: %w", name, err)
+		}
+	}
+	for id, p := range cfg.Notifications.Admins {
+		if p.WebhookURL, err = cm.decryptIfNeeded(p.WebhookURL); err != nil {
+			return fmt.Errorf("decrypt notification webhook URL of %s: %w", id, err)
+		}
+		if p.Secret, err = cm.decryptIfNeeded(p.Secret); err != nil {
+			return fmt.Errorf("decrypt notification secret of %s: %w", id, err)
+		}
+		cfg.Notifications.Admins[id] = p
+	}
+	if cfg.Export.WebhookURL, err = cm.decryptIfNeeded(cfg.Export.WebhookURL); err != nil {
+		return fmt.Errorf("decrypt export webhook URL: %w", err)
+	}
+	if cfg.Export.WebhookSecret, err = cm.decryptIfNeeded(cfg.Export.WebhookSecret); err != nil {
+		return fmt.Errorf("decrypt export webhook secret: %w", err)
+	}
+	if cfg.ExternalAuth.Secret, err = cm.decryptIfNeeded(cfg.ExternalAuth.Secret); err != nil {
+		return fmt.Errorf("decrypt external auth secret: %w", err)
+	}
+	for domain, cred := range cfg.SourceCredentials {
+		if cred.Cookies, err = cm.decryptIfNeeded(cred.Cookies); err != nil {
+			return fmt.Errorf("decrypt %s source cookies: %w", domain, err)
+		}
+		if cred.Password, err = cm.decryptIfNeeded(cred.Password); err != nil {
+			return fmt.Errorf("decrypt %s source password: %w", domain, err)
+		}
+		for name, value := range cred.Headers {
+			if cred.Headers[name], err = cm.decryptIfNeeded(value); err != nil {
+				return fmt.Errorf("decrypt %s source header %s: %w", domain, name, err)
+			}
+		}
+		cfg.SourceCredentials[domain] = cred
+	}
 
 	cm.applyDefaults(&cfg)
 	cm.config = &cfg
@@ -273,6 +960,13 @@ func (cm *ConfigManager) saveLocked() error {
 	out := *cm.config
 	out.LLM.APIKey = cm.encryptIfNeeded(cm.config.LLM.APIKey)
 	out.Embedding.APIKey = cm.encryptIfNeeded(cm.config.Embedding.APIKey)
+	if cm.config.LLM.Profiles != nil {
+		out.LLM.Profiles = make([]LLMProfile, len(cm.config.LLM.Profiles))
+		for i, p := range cm.config.LLM.Profiles {
+			p.APIKey = cm.encryptIfNeeded(p.APIKey)
+			out.LLM.Profiles[i] = p
+		}
+	}
 
 	if cm.config.OAuth.Providers != nil {
 		out.OAuth.Providers = make(map[string]OAuthProviderConfig, len(cm.config.OAuth.Providers))
@@ -284,6 +978,40 @@ func (cm *ConfigManager) saveLocked() error {
 	}
 
 	out.SMTP.Password = cm.encryptIfNeeded(cm.config.SMTP.Password)
+	out.EmailIngest.Token = cm.encryptIfNeeded(cm.config.EmailIngest.Token)
+	out.Rerank.APIKey = cm.encryptIfNeeded(cm.config.Rerank.APIKey)
+	out.Vector.Qdrant.APIKey = cm.encryptIfNeeded(cm.config.Vector.Qdrant.APIKey)
+	out.Backup.S3.SecretKey = cm.encryptIfNeeded(cm.config.Backup.S3.SecretKey)
+	for _, name := range NotifyChannels {
+		ch := out.Notifications.Channel(name)
+		ch.WebhookURL = cm.encryptIfNeeded(ch.WebhookURL)
+		ch.Secret = cm.encryptIfNeeded(ch.Secret)
+	}
+	if cm.config.Notifications.Admins != nil {
+		out.Notifications.Admins = make(map[string]AdminNotifyPrefs, len(cm.config.Notifications.Admins))
+		for id, p := range cm.config.Notifications.Admins {
+			p = p.clone()
+			p.WebhookURL = cm.encryptIfNeeded(p.WebhookURL)
+			p.Secret = cm.encryptIfNeeded(p.Secret)
+			out.Notifications.Admins[id] = p
+		}
+	}
+	out.Export.WebhookURL = cm.encryptIfNeeded(cm.config.Export.WebhookURL)
+	out.Export.WebhookSecret = cm.encryptIfNeeded(cm.config.Export.WebhookSecret)
+	out.ExternalAuth.Secret = cm.encryptIfNeeded(cm.config.ExternalAuth.Secret)
+
+	if cm.config.SourceCredentials != nil {
+		out.SourceCredentials = make(map[string]SourceCredential, len(cm.config.SourceCredentials))
+		for domain, cred := range cm.config.SourceCredentials {
+			c := cred.clone()
+			c.Cookies = cm.encryptIfNeeded(c.Cookies)
+			c.Password = cm.encryptIfNeeded(c.Password)
+			for name, value := range c.Headers {
+				c.Headers[name] = cm.encryptIfNeeded(value)
+			}
+			out.SourceCredentials[domain] = c
+		}
+	}
 
 	data, err := json.MarshalIndent(out, "", "  ")
 	if err != nil {
@@ -316,18 +1044,67 @@ func (cm *ConfigManager) Get() *Config {
 			c.OAuth.Providers[k] = p
 		}
 	}
+	if cm.config.SourceCredentials != nil {
+		c.SourceCredentials = make(map[string]SourceCredential, len(cm.config.SourceCredentials))
+		for domain, cred := range cm.config.SourceCredentials {
+			c.SourceCredentials[domain] = cred.clone()
+		}
+	}
+	if cm.config.LLM.Profiles != nil {
+		c.LLM.Profiles = append([]LLMProfile(nil), cm.config.LLM.Profiles...)
+	}
+	if cm.config.LLM.Routes != nil {
+		c.LLM.Routes = make(map[string]string, len(cm.config.LLM.Routes))
+		for task, name := range cm.config.LLM.Routes {
+			c.LLM.Routes[task] = name
+		}
+	}
+	if cm.config.Notifications.Admins != nil {
+		c.Notifications.Admins = make(map[string]AdminNotifyPrefs, len(cm.config.Notifications.Admins))
+		for id, p := range cm.config.Notifications.Admins {
+			c.Notifications.Admins[id] = p.clone()
+		}
+	}
 	return &c
 }
 
-// IsReady returns true if both LLM and Embedding API keys are configured (non-empty).
+// IsReadOnly reports whether read-only (demo) mode is enabled.
+func (cm *ConfigManager) IsReadOnly() bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.config != nil && cm.config.Server.ReadOnly
+}
+
+// SetReadOnly toggles read-only (demo) mode and saves to disk.
+// Intentionally not reachable through Update so the HTTP API cannot lift it.
+func (cm *ConfigManager) SetReadOnly(enabled bool) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.config == nil {
+		cm.config = DefaultConfig()
+	}
+	cm.config.Server.ReadOnly = enabled
+	return cm.saveLocked()
+}
+
+// IsReady returns true if both LLM and Embedding API keys are configured
+// (non-empty). A local Ollama server needs no LLM API key, only its address.
 func (cm *ConfigManager) IsReady() bool {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
 	if cm.config == nil {
 		return false
 	}
-	return strings.TrimSpace(cm.config.LLM.APIKey) != "" &&
-		strings.TrimSpace(cm.config.Embedding.APIKey) != ""
+	llmReady := strings.TrimSpace(cm.config.LLM.APIKey) != ""
+	if cm.config.LLM.Provider == LLMProviderOllama {
+		llmReady = strings.TrimSpace(cm.config.LLM.Endpoint) != ""
+	}
+	return llmReady && strings.TrimSpace(cm.config.Embedding.APIKey) != ""
+}
+
+// validLLMProvider reports whether p is a supported LLM provider.
+func validLLMProvider(p string) bool {
+	return p == LLMProviderOpenAI || p == LLMProviderOllama
 }
 
 // Update applies partial updates to the configuration and saves to disk.
@@ -372,6 +1149,15 @@ func (cm *ConfigManager) applyUpdate(key string, val interface{}) error {
 			return errors.New("expected string")
 		}
 		cm.config.LLM.APIKey = s
+	case "llm.provider":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		if !validLLMProvider(s) {
+			return errors.New("provider must be 'openai' or 'ollama'")
+		}
+		cm.config.LLM.Provider = s
 	case "llm.model_name":
 		s, ok := val.(string)
 		if !ok {
@@ -396,6 +1182,51 @@ func (cm *ConfigManager) applyUpdate(key string, val interface{}) error {
 			return errors.New("max_tokens must be between 1 and 128000")
 		}
 		cm.config.LLM.MaxTokens = n
+	case "llm.max_concurrency":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 1 || n > 1000 {
+			return errors.New("max_concurrency must be between 1 and 1000")
+		}
+		cm.config.LLM.MaxConcurrency = n
+	case "llm.max_queue":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 1 || n > 10000 {
+			return errors.New("max_queue must be between 1 and 10000")
+		}
+		cm.config.LLM.MaxQueue = n
+	case "llm.max_queued_per_user":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 1 || n > 100 {
+			return errors.New("max_queued_per_user must be between 1 and 100")
+		}
+		cm.config.LLM.MaxQueuedPerUser = n
+	case "llm.queue_timeout_sec":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 1 || n > 600 {
+			return errors.New("queue_timeout_sec must be between 1 and 600")
+		}
+		cm.config.LLM.QueueTimeoutSec = n
+	case "llm.price_per_m_tokens":
+		f, err := toFloat64(val)
+		if err != nil {
+			return err
+		}
+		if f < 0 || f > 10000 {
+			return errors.New("price_per_m_tokens must be between 0 and 10000")
+		}
+		cm.config.LLM.PricePerMTokens = f
 
 	// Embedding fields
 	case "embedding.endpoint":
@@ -422,6 +1253,15 @@ func (cm *ConfigManager) applyUpdate(key string, val interface{}) error {
 			return errors.New("expected boolean")
 		}
 		cm.config.Embedding.UseMultimodal = b
+	case "embedding.price_per_m_tokens":
+		f, err := toFloat64(val)
+		if err != nil {
+			return err
+		}
+		if f < 0 || f > 10000 {
+			return errors.New("price_per_m_tokens must be between 0 and 10000")
+		}
+		cm.config.Embedding.PricePerMTokens = f
 
 	// Vector fields
 	case "vector.db_path":
@@ -479,6 +1319,15 @@ func (cm *ConfigManager) applyUpdate(key string, val interface{}) error {
 			return errors.New("content_priority must be 'image_text' or 'text_only'")
 		}
 		cm.config.Vector.ContentPriority = s
+	case "vector.language_filter":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		if s != LanguageFilterOff && s != LanguageFilterPrefer && s != LanguageFilterStrict {
+			return errors.New("language_filter must be 'off', 'prefer' or 'strict'")
+		}
+		cm.config.Vector.LanguageFilter = s
 	case "vector.debug_mode":
 		b, ok := val.(bool)
 		if !ok {
@@ -491,45 +1340,89 @@ func (cm *ConfigManager) applyUpdate(key string, val interface{}) error {
 			return errors.New("expected boolean")
 		}
 		cm.config.Vector.TextMatchEnabled = b
-
-	// Admin fields
-	case "admin.username":
+	case "vector.translate_languages":
+		langs, err := toLanguageList(val)
+		if err != nil {
+			return err
+		}
+		cm.config.Vector.TranslateLanguages = langs
+	case "vector.backend":
 		s, ok := val.(string)
 		if !ok {
 			return errors.New("expected string")
 		}
-		cm.config.Admin.Username = s
-	case "admin.login_route":
+		s = strings.ToLower(strings.TrimSpace(s))
+		if !vectorBackendRe.MatchString(s) {
+			return errors.New("invalid vector backend name")
+		}
+		cm.config.Vector.Backend = s
+	case "vector.qdrant.url":
 		s, ok := val.(string)
 		if !ok {
 			return errors.New("expected string")
 		}
-		if s == "" || s[0] != '/' {
-			return errors.New("login_route must start with /")
+		s = strings.TrimRight(strings.TrimSpace(s), "/")
+		if s != "" {
+			u, err := url.Parse(s)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.New("qdrant url must be an http(s) URL")
+			}
 		}
-		cm.config.Admin.LoginRoute = s
-	case "admin.password_hash":
+		cm.config.Vector.Qdrant.URL = s
+	case "vector.qdrant.api_key":
 		s, ok := val.(string)
 		if !ok {
 			return errors.New("expected string")
 		}
-		cm.config.Admin.PasswordHash = s
-	case "admin.password":
+		cm.config.Vector.Qdrant.APIKey = strings.TrimSpace(s)
+	case "vector.qdrant.collection":
 		s, ok := val.(string)
 		if !ok {
 			return errors.New("expected string")
 		}
-		if len(s) < 8 {
-			return errors.New("密码至少8位")
+		s = strings.TrimSpace(s)
+		if s != "" && !qdrantCollectionRe.MatchString(s) {
+			return errors.New("qdrant collection may only contain letters, digits, '_' and '-'")
 		}
-		if len(s) > 72 {
-			return errors.New("密码不能超过72位") // bcrypt max input length
+		cm.config.Vector.Qdrant.Collection = s
+
+	// Admin fields
+	case "admin.username":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		cm.config.Admin.Username = s
+	case "admin.login_route":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		if s == "" || s[0] != '/' {
+			return errors.New("login_route must start with /")
+		}
+		cm.config.Admin.LoginRoute = s
+	case "admin.password_hash":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		cm.config.Admin.PasswordHash = s
+		cm.config.Admin.PasswordChangedAt = time.Now().UTC().Format(time.RFC3339)
+	case "admin.password":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		if err := cm.config.Password.Check(s); err != nil {
+			return err
 		}
 		hash, err := bcrypt.GenerateFromPassword([]byte(s), bcrypt.DefaultCost)
 		if err != nil {
 			return fmt.Errorf("hash password: %w", err)
 		}
 		cm.config.Admin.PasswordHash = string(hash)
+		cm.config.Admin.PasswordChangedAt = time.Now().UTC().Format(time.RFC3339)
 	case "admin.anonymous_mode":
 		b, ok := val.(bool)
 		if !ok {
@@ -729,8 +1622,476 @@ func (cm *ConfigManager) applyUpdate(key string, val interface{}) error {
 			return errors.New("processing_timeout_min must be between 1 and 1440")
 		}
 		cm.config.Video.ProcessingTimeoutMin = n
+	case "video.ocr_language":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		if !IsValidOCRLanguage(s) {
+			return errors.New("ocr_language must be one of 'zh', 'en', 'ja' or 'auto'")
+		}
+		cm.config.Video.OCRLanguage = s
+	case "video.keyframe_mode":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		if s != KeyframeModeInterval && s != KeyframeModeScene {
+			return errors.New("keyframe_mode must be 'interval' or 'scene'")
+		}
+		cm.config.Video.KeyframeMode = s
+	case "video.scene_threshold":
+		f, err := toFloat64(val)
+		if err != nil {
+			return err
+		}
+		if f <= 0 || f >= 1 {
+			return errors.New("scene_threshold must be between 0 and 1")
+		}
+		cm.config.Video.SceneThreshold = f
+	case "video.keyframe_min_interval":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 0 || n > 300 {
+			return errors.New("keyframe_min_interval must be between 0 and 300 seconds")
+		}
+		cm.config.Video.KeyframeMinInterval = n
+	case "video.keyframe_max_frames":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 0 || n > 2000 {
+			return errors.New("keyframe_max_frames must be between 0 and 2000")
+		}
+		cm.config.Video.KeyframeMaxFrames = n
+	case "video.chaptering_enabled":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		cm.config.Video.ChapteringEnabled = b
+	case "video.ytdlp_path":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		// Validate path doesn't contain shell metacharacters
+		if strings.ContainsAny(s, "|;&$`") {
+			return errors.New("yt-dlp path contains invalid characters")
+		}
+		cm.config.Video.YtDlpPath = strings.TrimSpace(s)
+	case "video.url_max_duration_min":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 1 || n > 1440 {
+			return errors.New("url_max_duration_min must be between 1 and 1440")
+		}
+		cm.config.Video.URLMaxDurationMin = n
+	case "video.diarization_command":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		// Validate path doesn't contain shell metacharacters
+		if strings.ContainsAny(s, "|;&$`") {
+			return errors.New("diarization command contains invalid characters")
+		}
+		cm.config.Video.DiarizationCommand = strings.TrimSpace(s)
+
+	// Scan fields
+	case "scan.mode":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		if s != "" && s != ScanModeClamAV && s != ScanModeCommand {
+			return errors.New("scan mode must be '', 'clamav' or 'command'")
+		}
+		cm.config.Scan.Mode = s
+	case "scan.clamav_address":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		cm.config.Scan.ClamAVAddress = strings.TrimSpace(s)
+	case "scan.command":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		// Validate path doesn't contain shell metacharacters
+		if strings.ContainsAny(s, "|;&$`") {
+			return errors.New("scan command contains invalid characters")
+		}
+		cm.config.Scan.Command = s
+	case "scan.timeout_sec":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 1 || n > 3600 {
+			return errors.New("scan timeout_sec must be between 1 and 3600")
+		}
+		cm.config.Scan.TimeoutSec = n
+	case "scan.block_on_error":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		cm.config.Scan.BlockOnError = b
+	case "scan.alert_email":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		s = strings.TrimSpace(s)
+		if s != "" && (!strings.Contains(s, "@") || strings.ContainsAny(s, "\r\n")) {
+			return errors.New("invalid alert email address")
+		}
+		cm.config.Scan.AlertEmail = s
+
+	// Answer verification fields
+	case "verify.mode":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		if s != "" && s != VerifyModeFlag && s != VerifyModeRemove {
+			return errors.New("verify mode must be '', 'flag' or 'remove'")
+		}
+		cm.config.Verify.Mode = s
+
+	// Review workflow fields
+	case "review.required":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		cm.config.Review.Required = b
+
+	// Documentation portal fields
+	case "portal.enabled":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		cm.config.Portal.Enabled = b
+	case "portal.product_ids":
+		items, ok := val.([]interface{})
+		if !ok {
+			return errors.New("expected string array")
+		}
+		ids := make([]string, 0, len(items))
+		for _, item := range items {
+			id, ok := item.(string)
+			if !ok {
+				return errors.New("expected string array")
+			}
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		cm.config.Portal.ProductIDs = ids
+
+	// HTML fields
+	case "html.main_content_enabled":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		cm.config.HTML.MainContentEnabled = b
+	case "html.selectors":
+		items, ok := val.(map[string]interface{})
+		if !ok {
+			return errors.New("expected object of host to CSS selector")
+		}
+		selectors := make(map[string]string, len(items))
+		for host, item := range items {
+			selector, ok := item.(string)
+			if !ok {
+				return errors.New("expected object of host to CSS selector")
+			}
+			host = strings.ToLower(strings.TrimSpace(host))
+			if selector = strings.TrimSpace(selector); host != "" && selector != "" {
+				selectors[host] = selector
+			}
+		}
+		cm.config.HTML.Selectors = selectors
+
+	// Email ingestion fields
+	case "email_ingest.enabled":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		cm.config.EmailIngest.Enabled = b
+	case "email_ingest.token":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		if s = strings.TrimSpace(s); s != "" && len(s) < 16 {
+			return errors.New("email ingest token must be at least 16 characters")
+		}
+		cm.config.EmailIngest.Token = s
+	case "email_ingest.recipients", "email_ingest.allowed_senders":
+		items, ok := val.([]interface{})
+		if !ok {
+			return errors.New("expected string array")
+		}
+		addrs := make([]string, 0, len(items))
+		for _, item := range items {
+			addr, ok := item.(string)
+			if !ok {
+				return errors.New("expected string array")
+			}
+			if addr = strings.ToLower(strings.TrimSpace(addr)); addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+		if key == "email_ingest.recipients" {
+			cm.config.EmailIngest.Recipients = addrs
+		} else {
+			cm.config.EmailIngest.AllowedSenders = addrs
+		}
+	case "email_ingest.product_id":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		cm.config.EmailIngest.ProductID = strings.TrimSpace(s)
+
+	// Tagging fields
+	case "tagging.enabled":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		cm.config.Tagging.Enabled = b
+
+	// Answer audit fields
+	case "audit.disabled":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		cm.config.Audit.Disabled = b
+	case "audit.retention_days":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 0 || n > 3650 {
+			return errors.New("audit retention_days must be between 0 and 3650")
+		}
+		cm.config.Audit.RetentionDays = n
+
+	// Rerank fields
+	case "rerank.enabled":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		cm.config.Rerank.Enabled = b
+	case "rerank.endpoint", "rerank.api_key", "rerank.model_name":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		s = strings.TrimSpace(s)
+		switch key {
+		case "rerank.endpoint":
+			cm.config.Rerank.Endpoint = s
+		case "rerank.api_key":
+			cm.config.Rerank.APIKey = s
+		default:
+			cm.config.Rerank.ModelName = s
+		}
+	case "rerank.top_n":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 0 || n > 200 {
+			return errors.New("rerank top_n must be between 0 and 200")
+		}
+		cm.config.Rerank.TopN = n
+
+	// Backup fields
+	case "backup.s3.endpoint":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		s = strings.TrimRight(strings.TrimSpace(s), "/")
+		if s != "" {
+			u, err := url.Parse(s)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.New("backup s3 endpoint must be an http(s) URL")
+			}
+		}
+		cm.config.Backup.S3.Endpoint = s
+	case "backup.s3.region", "backup.s3.bucket", "backup.s3.access_key", "backup.s3.secret_key", "backup.s3.prefix":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		s = strings.TrimSpace(s)
+		switch key {
+		case "backup.s3.region":
+			cm.config.Backup.S3.Region = s
+		case "backup.s3.bucket":
+			cm.config.Backup.S3.Bucket = s
+		case "backup.s3.access_key":
+			cm.config.Backup.S3.AccessKey = s
+		case "backup.s3.secret_key":
+			cm.config.Backup.S3.SecretKey = s
+		default:
+			cm.config.Backup.S3.Prefix = strings.TrimLeft(s, "/")
+		}
+	case "backup.s3.path_style":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		cm.config.Backup.S3.PathStyle = b
+
+	// Password policy fields
+	case "password.min_length":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n != 0 && (n < 6 || n > maxPasswordLength) {
+			return errors.New("password min_length must be between 6 and 72")
+		}
+		cm.config.Password.MinLength = n
+	case "password.require":
+		classes, err := toPasswordClasses(val)
+		if err != nil {
+			return err
+		}
+		cm.config.Password.Require = classes
+	case "password.breach_list":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		s = strings.TrimSpace(s)
+		if s != "" {
+			if info, err := os.Stat(s); err != nil || info.IsDir() {
+				return fmt.Errorf("breach list file not found: %s", s)
+			}
+		}
+		cm.config.Password.BreachList = s
+	case "password.max_age_days":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 0 || n > 3650 {
+			return errors.New("password max_age_days must be between 0 and 3650")
+		}
+		cm.config.Password.MaxAgeDays = n
+
+	// Session fields
+	case "session.idle_timeout_minutes":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n != 0 && (n < minSessionIdleTimeoutMinutes || n > 30*24*60) {
+			return errors.New("session idle_timeout_minutes must be between 10 and 43200")
+		}
+		cm.config.Session.IdleTimeoutMinutes = n
+	case "session.max_lifetime_hours":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 0 || n > 8760 {
+			return errors.New("session max_lifetime_hours must be between 0 and 8760")
+		}
+		cm.config.Session.MaxLifetimeHours = n
+
+	// Maintenance fields
+	case "maintenance.disabled":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		cm.config.Maintenance.Disabled = b
+	case "maintenance.window_start", "maintenance.window_end":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		if _, err := ParseClock(s); err != nil {
+			return err
+		}
+		if key == "maintenance.window_start" {
+			cm.config.Maintenance.WindowStart = strings.TrimSpace(s)
+		} else {
+			cm.config.Maintenance.WindowEnd = strings.TrimSpace(s)
+		}
+
+	// Job queue fields
+	case "jobs.concurrency":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 1 || n > 16 {
+			return errors.New("jobs concurrency must be between 1 and 16")
+		}
+		cm.config.Jobs.Concurrency = n
+
+	// Small talk fields
+	case "small_talk.disabled":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		cm.config.SmallTalk.Disabled = b
+	case "small_talk.intro_interval_min":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 1 || n > 1440 {
+			return errors.New("intro_interval_min must be between 1 and 1440")
+		}
+		cm.config.SmallTalk.IntroIntervalMin = n
+	case "small_talk.rules":
+		raw, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		var rules []SmallTalkRule
+		if err := json.Unmarshal(raw, &rules); err != nil {
+			return errors.New("expected array of small talk rules")
+		}
+		if rules, err = validateSmallTalkRules(rules); err != nil {
+			return err
+		}
+		cm.config.SmallTalk.Rules = rules
 
 	// Server fields
+	case "server.external_base_url":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		base, err := NormalizeBaseURL(s)
+		if err != nil {
+			return err
+		}
+		cm.config.Server.ExternalBaseURL = base
 	case "server.bind":
 		s, ok := val.(string)
 		if !ok {
@@ -764,12 +2125,26 @@ func (cm *ConfigManager) applyUpdate(key string, val interface{}) error {
 			return errors.New("ssl_key path must not contain '..'")
 		}
 		cm.config.Server.SSLKey = s
+	case "server.read_only":
+		return errors.New("read_only can only be changed from the CLI (askflow safemode)")
 
 	default:
 		// Handle OAuth provider config: oauth.providers.<name>.<field>
 		if strings.HasPrefix(key, "oauth.providers.") {
 			return cm.applyOAuthUpdate(key, val)
 		}
+		if strings.HasPrefix(key, "notifications.") {
+			return cm.applyNotificationsUpdate(key, val)
+		}
+		if strings.HasPrefix(key, "export.") {
+			return cm.applyExportUpdate(key, val)
+		}
+		if strings.HasPrefix(key, "budget.") {
+			return cm.applyBudgetUpdate(key, val)
+		}
+		if strings.HasPrefix(key, "external_auth.") {
+			return cm.applyExternalAuthUpdate(key, val)
+		}
 		return fmt.Errorf("unknown config key: %s", key)
 	}
 	return nil
@@ -847,6 +2222,188 @@ func (cm *ConfigManager) DeleteOAuthProvider(provider string) error {
 	return cm.saveLocked()
 }
 
+// vectorBackendRe matches vector.backend names; empty selects the default.
+var vectorBackendRe = regexp.MustCompile(`^[a-z0-9_-]{0,64}$`)
+
+// qdrantCollectionRe matches Qdrant collection name prefixes.
+var qdrantCollectionRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// sourceDomainRe matches a lowercase host name without port.
+var sourceDomainRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)+$`)
+
+// headerNameRe matches an HTTP header field name.
+var headerNameRe = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// Headers a source credential may not set; the client sets them itself.
+var reservedSourceHeaders = map[string]bool{
+	"Host": true, "Content-Length": true, "Transfer-Encoding": true, "Connection": true,
+	"Cookie": true, "Authorization": true,
+}
+
+// clone returns a copy of c that shares no map with it.
+func (c SourceCredential) clone() SourceCredential {
+	if c.Headers != nil {
+		headers := make(map[string]string, len(c.Headers))
+		for k, v := range c.Headers {
+			headers[k] = v
+		}
+		c.Headers = headers
+	}
+	return c
+}
+
+// SetSourceCredential sets the credential attached to fetches from domain and
+// its subdomains, and saves.
+func (cm *ConfigManager) SetSourceCredential(domain string, cred SourceCredential) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if !sourceDomainRe.MatchString(domain) {
+		return errors.New("无效的域名")
+	}
+	headers := make(map[string]string, len(cred.Headers))
+	for name, value := range cred.Headers {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if !headerNameRe.MatchString(name) || reservedSourceHeaders[name] {
+			return fmt.Errorf("不允许的请求头: %s", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("请求头 %s 的值不能包含换行", name)
+		}
+		headers[name] = value
+	}
+	if strings.ContainsAny(cred.Cookies+cred.Username+cred.Password, "\r\n") {
+		return errors.New("凭据不能包含换行")
+	}
+	if strings.Contains(cred.Username, ":") {
+		return errors.New("用户名不能包含冒号")
+	}
+	if len(headers) == 0 && cred.Cookies == "" && cred.Username == "" {
+		return errors.New("请至少设置请求头、Cookie 或用户名之一")
+	}
+	cred.Headers = headers
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.config == nil {
+		return errors.New("no config loaded")
+	}
+	if cm.config.SourceCredentials == nil {
+		cm.config.SourceCredentials = make(map[string]SourceCredential)
+	}
+	cm.config.SourceCredentials[domain] = cred
+	return cm.saveLocked()
+}
+
+// DeleteSourceCredential removes the credential of domain and saves.
+func (cm *ConfigManager) DeleteSourceCredential(domain string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.config == nil || cm.config.SourceCredentials == nil {
+		return nil
+	}
+	delete(cm.config.SourceCredentials, strings.ToLower(domain))
+	return cm.saveLocked()
+}
+
+// llmProfileNameRe matches an LLM profile name.
+var llmProfileNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// SetLLMProfile adds an LLM profile or replaces the one of the same name, and
+// saves.
+func (cm *ConfigManager) SetLLMProfile(p LLMProfile) error {
+	p.Name = strings.ToLower(strings.TrimSpace(p.Name))
+	p.Endpoint = strings.TrimSpace(p.Endpoint)
+	p.ModelName = strings.TrimSpace(p.ModelName)
+	if !llmProfileNameRe.MatchString(p.Name) {
+		return errors.New("配置名称只能包含小写字母、数字、下划线和连字符，最长 32 个字符")
+	}
+	if p.Name == DefaultLLMProfile {
+		return errors.New("default 是主 LLM 配置的名称，请在 LLM 设置中修改")
+	}
+	if u, err := url.Parse(p.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("无效的 API 地址")
+	}
+	if p.ModelName == "" {
+		return errors.New("请填写模型名称")
+	}
+	if p.Provider != "" && !validLLMProvider(p.Provider) {
+		return errors.New("不支持的 LLM 协议")
+	}
+	if p.Temperature < 0 || p.Temperature > 2 {
+		return errors.New("温度必须在 0 到 2 之间")
+	}
+	if p.MaxTokens < 0 || p.TimeoutSec < 0 || p.TimeoutSec > 600 {
+		return errors.New("最大 Token 数和超时时间不能为负数，超时时间不超过 600 秒")
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.config == nil {
+		return errors.New("no config loaded")
+	}
+	for i, old := range cm.config.LLM.Profiles {
+		if old.Name == p.Name {
+			cm.config.LLM.Profiles[i] = p
+			return cm.saveLocked()
+		}
+	}
+	if len(cm.config.LLM.Profiles) >= 20 {
+		return errors.New("最多只能添加 20 个 LLM 配置")
+	}
+	cm.config.LLM.Profiles = append(cm.config.LLM.Profiles, p)
+	return cm.saveLocked()
+}
+
+// DeleteLLMProfile removes an LLM profile and the routes to it, and saves.
+func (cm *ConfigManager) DeleteLLMProfile(name string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.config == nil {
+		return nil
+	}
+	profiles := cm.config.LLM.Profiles[:0]
+	for _, p := range cm.config.LLM.Profiles {
+		if p.Name != name {
+			profiles = append(profiles, p)
+		}
+	}
+	cm.config.LLM.Profiles = profiles
+	for task, to := range cm.config.LLM.Routes {
+		if to == name {
+			delete(cm.config.LLM.Routes, task)
+		}
+	}
+	return cm.saveLocked()
+}
+
+// SetLLMRoutes replaces the task routes of LLM calls and saves. A task
+// routed to "" starts with the profile of lowest priority.
+func (cm *ConfigManager) SetLLMRoutes(routes map[string]string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.config == nil {
+		return errors.New("no config loaded")
+	}
+	known := map[string]bool{DefaultLLMProfile: true}
+	for _, p := range cm.config.LLM.Profiles {
+		known[p.Name] = true
+	}
+	out := make(map[string]string, len(routes))
+	for task, name := range routes {
+		if !slices.Contains(LLMTasks, task) {
+			return fmt.Errorf("未知的任务: %s", task)
+		}
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			return fmt.Errorf("LLM 配置不存在: %s", name)
+		}
+		out[task] = name
+	}
+	cm.config.LLM.Routes = out
+	return cm.saveLocked()
+}
+
 // applyDefaults fills in zero-value fields with defaults.
 func (cm *ConfigManager) applyDefaults(cfg *Config) {
 	defaults := DefaultConfig()
@@ -862,6 +2419,9 @@ func (cm *ConfigManager) applyDefaults(cfg *Config) {
 	if cfg.LLM.ModelName == "" {
 		cfg.LLM.ModelName = defaults.LLM.ModelName
 	}
+	if cfg.LLM.Provider == "" {
+		cfg.LLM.Provider = defaults.LLM.Provider
+	}
 	// Temperature 0 is valid (deterministic output), only default if negative (impossible from JSON).
 	// For fresh configs, DefaultConfig() already sets 0.3.
 	if cfg.LLM.Temperature < 0 {
@@ -870,6 +2430,18 @@ func (cm *ConfigManager) applyDefaults(cfg *Config) {
 	if cfg.LLM.MaxTokens == 0 {
 		cfg.LLM.MaxTokens = defaults.LLM.MaxTokens
 	}
+	if cfg.LLM.MaxConcurrency <= 0 {
+		cfg.LLM.MaxConcurrency = defaults.LLM.MaxConcurrency
+	}
+	if cfg.LLM.MaxQueue <= 0 {
+		cfg.LLM.MaxQueue = defaults.LLM.MaxQueue
+	}
+	if cfg.LLM.MaxQueuedPerUser <= 0 {
+		cfg.LLM.MaxQueuedPerUser = defaults.LLM.MaxQueuedPerUser
+	}
+	if cfg.LLM.QueueTimeoutSec <= 0 {
+		cfg.LLM.QueueTimeoutSec = defaults.LLM.QueueTimeoutSec
+	}
 	if cfg.Embedding.Endpoint == "" {
 		cfg.Embedding.Endpoint = defaults.Embedding.Endpoint
 	}
@@ -894,6 +2466,9 @@ func (cm *ConfigManager) applyDefaults(cfg *Config) {
 	if cfg.Vector.ContentPriority == "" {
 		cfg.Vector.ContentPriority = defaults.Vector.ContentPriority
 	}
+	if cfg.Vector.LanguageFilter == "" {
+		cfg.Vector.LanguageFilter = defaults.Vector.LanguageFilter
+	}
 	if cfg.OAuth.Providers == nil {
 		cfg.OAuth.Providers = make(map[string]OAuthProviderConfig)
 	}
@@ -912,8 +2487,72 @@ func (cm *ConfigManager) applyDefaults(cfg *Config) {
 	if cfg.Video.ProcessingTimeoutMin == 0 {
 		cfg.Video.ProcessingTimeoutMin = defaults.Video.ProcessingTimeoutMin
 	}
+	if cfg.Video.URLMaxDurationMin == 0 {
+		cfg.Video.URLMaxDurationMin = defaults.Video.URLMaxDurationMin
+	}
+	if cfg.Video.OCRLanguage == "" {
+		cfg.Video.OCRLanguage = defaults.Video.OCRLanguage
+	}
+	if cfg.Video.KeyframeMode == "" {
+		cfg.Video.KeyframeMode = defaults.Video.KeyframeMode
+	}
+	if cfg.Video.SceneThreshold == 0 {
+		cfg.Video.SceneThreshold = defaults.Video.SceneThreshold
+	}
+	if cfg.Scan.ClamAVAddress == "" {
+		cfg.Scan.ClamAVAddress = defaults.Scan.ClamAVAddress
+	}
+	if cfg.Scan.TimeoutSec == 0 {
+		cfg.Scan.TimeoutSec = defaults.Scan.TimeoutSec
+	}
+	if base, err := NormalizeBaseURL(cfg.Server.ExternalBaseURL); err == nil {
+		cfg.Server.ExternalBaseURL = base
+	}
+	if cfg.Maintenance.WindowStart == "" {
+		cfg.Maintenance.WindowStart = defaults.Maintenance.WindowStart
+	}
+	if cfg.Maintenance.WindowEnd == "" {
+		cfg.Maintenance.WindowEnd = defaults.Maintenance.WindowEnd
+	}
+	if cfg.Jobs.Concurrency <= 0 {
+		cfg.Jobs.Concurrency = defaults.Jobs.Concurrency
+	}
+	if cfg.SmallTalk.IntroIntervalMin <= 0 {
+		cfg.SmallTalk.IntroIntervalMin = defaults.SmallTalk.IntroIntervalMin
+	}
+	if cfg.SmallTalk.Rules == nil {
+		cfg.SmallTalk.Rules = defaults.SmallTalk.Rules
+	}
+	if cfg.Export.Format == "" {
+		cfg.Export.Format = defaults.Export.Format
+	}
+	if cfg.Export.IntervalHours <= 0 {
+		cfg.Export.IntervalHours = defaults.Export.IntervalHours
+	}
+	if cfg.Export.S3Prefix == "" {
+		cfg.Export.S3Prefix = defaults.Export.S3Prefix
+	}
+}
+
+
+// SigningKey derives a key for signing tokens the server issues. Each
+// purpose gets its own key, and none reveals the encryption key.
+func (cm *ConfigManager) SigningKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, cm.encryptionKey)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
 }
 
+// Seal encrypts a secret that is stored outside the config file, such as a
+// repository access token in the database, with the config encryption key.
+func (cm *ConfigManager) Seal(plaintext string) (string, error) {
+	return cm.encrypt(plaintext)
+}
+
+// Open decrypts a value produced by Seal.
+func (cm *ConfigManager) Open(sealed string) (string, error) {
+	return cm.decrypt(sealed)
+}
 
 // --- AES-GCM encryption helpers ---
 
@@ -1010,8 +2649,18 @@ func getOrCreateEncryptionKey() ([]byte, error) {
 	}
 
 	// 2. Try to read from persistent key file
-	keyFile := "./data/encryption.key"
-	if data, err := os.ReadFile(keyFile); err == nil {
+	keyFile := datadir.Path("encryption.key")
+	data, err := os.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		// Older versions always kept the key in ./data, whatever --datadir said
+		if legacy, lerr := os.ReadFile(filepath.Join(".", "data", "encryption.key")); lerr == nil {
+			data, err = legacy, nil
+			if werr := os.WriteFile(keyFile, legacy, 0600); werr == nil {
+				fmt.Println("Note: copied encryption.key from ./data into the data directory " + datadir.Root())
+			}
+		}
+	}
+	if err == nil {
 		keyHex = strings.TrimSpace(string(data))
 		if key, err := hex.DecodeString(keyHex); err == nil && len(key) == 32 {
 			// Ensure file permissions are restrictive
@@ -1031,7 +2680,7 @@ func getOrCreateEncryptionKey() ([]byte, error) {
 		return nil, fmt.Errorf("generate encryption key: %w", err)
 	}
 	keyHex = hex.EncodeToString(key)
-	os.MkdirAll("./data", 0700)
+	os.MkdirAll(datadir.Root(), 0700)
 	if err := os.WriteFile(keyFile, []byte(keyHex+"\n"), 0600); err != nil {
 		return nil, fmt.Errorf("save encryption key: %w", err)
 	}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ExportConfig schedules the export of query logs, feedback and usage
+// metrics for analysis in external tools. Each run exports the records
+// added since the previous successful run as files in Dir, optionally
+// uploaded to the backup object storage and pushed to a webhook.
+type ExportConfig struct {
+	Enabled bool `json:"enabled"`
+	// Format is ExportNDJSON (default) or ExportCSV.
+	Format string `json:"format"`
+	// IntervalHours is how often to export, 1-168, default 24.
+	IntervalHours int `json:"interval_hours"`
+	// Dir is the directory export files are written to; empty means
+	// "exports" in the data directory.
+	Dir string `json:"dir"`
+	// S3 uploads the files to the bucket of backup.s3 under S3Prefix.
+	S3       bool   `json:"s3"`
+	S3Prefix string `json:"s3_prefix"`
+	// WebhookURL receives each file as a POST request. It may contain an
+	// access token and is kept encrypted.
+	WebhookURL string `json:"webhook_url"`
+	// WebhookSecret signs webhook requests (X-Askflow-Signature:
+	// sha256=<hex HMAC-SHA256 of the body>) when set; kept encrypted.
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+}
+
+// Export file formats.
+const (
+	ExportNDJSON = "ndjson"
+	ExportCSV    = "csv"
+)
+
+const (
+	defaultExportIntervalHours = 24
+	maxExportIntervalHours     = 168
+	defaultExportS3Prefix      = "askflow-export/"
+)
+
+// EffectiveFormat returns Format, or ExportNDJSON when unset.
+func (e ExportConfig) EffectiveFormat() string {
+	if e.Format == ExportCSV {
+		return ExportCSV
+	}
+	return ExportNDJSON
+}
+
+// applyExportUpdate handles export keys like "export.interval_hours".
+func (cm *ConfigManager) applyExportUpdate(key string, val interface{}) error {
+	e := &cm.config.Export
+	switch strings.TrimPrefix(key, "export.") {
+	case "enabled", "s3":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		if key == "export.enabled" {
+			e.Enabled = b
+		} else {
+			e.S3 = b
+		}
+	case "format":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s != ExportNDJSON && s != ExportCSV {
+			return errors.New("export format must be ndjson or csv")
+		}
+		e.Format = s
+	case "interval_hours":
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 1 || n > maxExportIntervalHours {
+			return fmt.Errorf("export interval_hours must be between 1 and %d", maxExportIntervalHours)
+		}
+		e.IntervalHours = n
+	case "dir":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		e.Dir = strings.TrimSpace(s)
+	case "s3_prefix":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		e.S3Prefix = strings.TrimLeft(strings.TrimSpace(s), "/")
+	case "webhook_url":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		s = strings.TrimSpace(s)
+		if s != "" {
+			u, err := url.Parse(s)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.New("export webhook_url must be an http(s) URL")
+			}
+		}
+		e.WebhookURL = s
+	case "webhook_secret":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		e.WebhookSecret = strings.TrimSpace(s)
+	default:
+		return fmt.Errorf("unknown config key: %s", key)
+	}
+	return nil
+}
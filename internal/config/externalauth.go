@@ -0,0 +1,121 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ExternalAuthConfig lets users sign in through a login backend that is
+// neither OAuth nor a local account, such as a bespoke company SSO. The
+// credentials entered on the login page are posted to VerifyURL, which
+// returns the identity of the user; the user and session are then created
+// the same way as for OAuth logins.
+type ExternalAuthConfig struct {
+	Enabled bool `json:"enabled"`
+	// Name identifies the backend in users.provider and prefixes user IDs
+	// ("<name>_<id>"); lowercase letters, digits, "-" and "_". Default "sso".
+	Name string `json:"name"`
+	// Label is the text of the login page button, e.g. "公司账号".
+	Label string `json:"label"`
+	// VerifyURL receives each login as a POST request with a JSON body
+	// {"credentials": {"username": "...", "password": "..."}}.
+	VerifyURL string `json:"verify_url"`
+	// Secret, when set, is sent as "Authorization: Bearer <secret>" so the
+	// verifier can reject other callers; kept encrypted.
+	Secret string `json:"secret,omitempty"`
+	// TimeoutSec limits each verification request; 0 means 10.
+	TimeoutSec int `json:"timeout_sec"`
+}
+
+const (
+	defaultExternalAuthName    = "sso"
+	defaultExternalAuthTimeout = 10 * time.Second
+	maxExternalAuthTimeoutSec  = 60
+)
+
+// externalAuthNameRe matches valid backend names.
+var externalAuthNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// reservedAuthProviders are users.provider values of built-in logins.
+var reservedAuthProviders = map[string]bool{"local": true, "sn": true, "admin": true}
+
+// EffectiveName returns Name, or "sso" when unset.
+func (e ExternalAuthConfig) EffectiveName() string {
+	if e.Name == "" {
+		return defaultExternalAuthName
+	}
+	return e.Name
+}
+
+// Timeout returns the verification request timeout.
+func (e ExternalAuthConfig) Timeout() time.Duration {
+	if e.TimeoutSec <= 0 {
+		return defaultExternalAuthTimeout
+	}
+	return time.Duration(e.TimeoutSec) * time.Second
+}
+
+// Active reports whether external login is enabled and has a verifier.
+func (e ExternalAuthConfig) Active() bool {
+	return e.Enabled && e.VerifyURL != ""
+}
+
+// applyExternalAuthUpdate handles keys like "external_auth.verify_url".
+func (cm *ConfigManager) applyExternalAuthUpdate(key string, val interface{}) error {
+	e := &cm.config.ExternalAuth
+	field := strings.TrimPrefix(key, "external_auth.")
+	if field == "enabled" {
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		e.Enabled = b
+		return nil
+	}
+	if field == "timeout_sec" {
+		n, err := toInt(val)
+		if err != nil {
+			return err
+		}
+		if n < 0 || n > maxExternalAuthTimeoutSec {
+			return fmt.Errorf("external_auth timeout_sec must be between 0 and %d", maxExternalAuthTimeoutSec)
+		}
+		e.TimeoutSec = n
+		return nil
+	}
+	s, ok := val.(string)
+	if !ok {
+		return errors.New("expected string")
+	}
+	s = strings.TrimSpace(s)
+	switch field {
+	case "name":
+		s = strings.ToLower(s)
+		if s != "" && (!externalAuthNameRe.MatchString(s) || reservedAuthProviders[s]) {
+			return errors.New("external_auth name must be 1-32 lowercase letters, digits, '-' or '_' and not local, sn or admin")
+		}
+		e.Name = s
+	case "label":
+		if len([]rune(s)) > 50 {
+			return errors.New("external_auth label must be at most 50 characters")
+		}
+		e.Label = s
+	case "verify_url":
+		if s != "" {
+			u, err := url.Parse(s)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.New("external_auth verify_url must be an http(s) URL")
+			}
+		}
+		e.VerifyURL = s
+	case "secret":
+		e.Secret = s
+	default:
+		return fmt.Errorf("unknown config key: %s", key)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// NotificationsConfig pushes a message to team chat whenever a question is
+// added to the pending queue, so it gets answered without watching the admin
+// panel.
+type NotificationsConfig struct {
+	Slack    NotifyChannel `json:"slack"`
+	Lark     NotifyChannel `json:"lark"`
+	DingTalk NotifyChannel `json:"dingtalk"`
+	// Admins holds what each admin wants to be told about and where, by
+	// session user ID: "admin" for the super admin, "admin_<id>" for
+	// sub-accounts. The team chat channels above are not affected.
+	Admins map[string]AdminNotifyPrefs `json:"admins,omitempty"`
+}
+
+// AdminNotifyPrefs are the notification preferences of one admin: the events
+// (see NotifyEvents) sent to their email address and personal chat webhook.
+type AdminNotifyPrefs struct {
+	Events []string `json:"events"`
+	Email  string   `json:"email,omitempty"`
+	// Channel names the kind of WebhookURL (see NotifyChannels), e.g. a Lark
+	// bot in a chat of one. WebhookURL and Secret are kept encrypted.
+	Channel    string `json:"channel,omitempty"`
+	WebhookURL string `json:"webhook_url,omitempty"`
+	Secret     string `json:"secret,omitempty"`
+}
+
+// Events admins can subscribe to.
+const (
+	NotifyEventPending        = "pending"         // new pending questions of their products
+	NotifyEventDocumentFailed = "document_failed" // documents of their products that failed to process
+	NotifyEventSecurity       = "security"        // quarantined uploads and locked admin accounts
+	NotifyEventSchedule       = "schedule"        // documents they scheduled being published or unpublished
+	NotifyEventBudget         = "budget"          // model spend reaching a budget cap
+	NotifyEventDigest         = "digest"          // daily summary of open questions and failed documents
+)
+
+// NotifyEvents lists the events in display order.
+var NotifyEvents = []string{
+	NotifyEventPending, NotifyEventDocumentFailed, NotifyEventSecurity,
+	NotifyEventSchedule, NotifyEventBudget, NotifyEventDigest,
+}
+
+// Wants reports whether p subscribes to event and has somewhere to send it.
+func (p AdminNotifyPrefs) Wants(event string) bool {
+	return (p.Email != "" || p.WebhookURL != "") && slices.Contains(p.Events, event)
+}
+
+func (p AdminNotifyPrefs) clone() AdminNotifyPrefs {
+	p.Events = append([]string(nil), p.Events...)
+	return p
+}
+
+// NotifyChannel is a chat webhook.
+type NotifyChannel struct {
+	Enabled bool `json:"enabled"`
+	// WebhookURL is the Slack incoming webhook, Lark custom bot or DingTalk
+	// robot URL. It contains the access token and is kept encrypted.
+	WebhookURL string `json:"webhook_url"`
+	// Secret is the signing secret of a Lark bot or DingTalk robot with
+	// signature verification enabled; Slack does not use it.
+	Secret string `json:"secret,omitempty"`
+}
+
+// Notification channel names.
+const (
+	NotifySlack    = "slack"
+	NotifyLark     = "lark"
+	NotifyDingTalk = "dingtalk"
+)
+
+// NotifyChannels lists the channel names in display order.
+var NotifyChannels = []string{NotifySlack, NotifyLark, NotifyDingTalk}
+
+// Channel returns the channel named name, or nil for unknown names.
+func (n *NotificationsConfig) Channel(name string) *NotifyChannel {
+	switch name {
+	case NotifySlack:
+		return &n.Slack
+	case NotifyLark:
+		return &n.Lark
+	case NotifyDingTalk:
+		return &n.DingTalk
+	}
+	return nil
+}
+
+// Active reports whether any channel is enabled with a webhook URL.
+func (n NotificationsConfig) Active() bool {
+	for _, name := range NotifyChannels {
+		if ch := n.Channel(name); ch.Enabled && ch.WebhookURL != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyNotificationsUpdate handles notification keys like
+// "notifications.slack.webhook_url".
+func (cm *ConfigManager) applyNotificationsUpdate(key string, val interface{}) error {
+	parts := strings.Split(key, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("unknown config key: %s", key)
+	}
+	ch := cm.config.Notifications.Channel(parts[1])
+	if ch == nil {
+		return fmt.Errorf("unknown notification channel: %s", parts[1])
+	}
+	switch parts[2] {
+	case "enabled":
+		b, ok := val.(bool)
+		if !ok {
+			return errors.New("expected boolean")
+		}
+		ch.Enabled = b
+	case "webhook_url":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		s = strings.TrimSpace(s)
+		if s != "" {
+			u, err := url.Parse(s)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.New("notification webhook_url must be an http(s) URL")
+			}
+		}
+		ch.WebhookURL = s
+	case "secret":
+		s, ok := val.(string)
+		if !ok {
+			return errors.New("expected string")
+		}
+		ch.Secret = strings.TrimSpace(s)
+	default:
+		return fmt.Errorf("unknown config key: %s", key)
+	}
+	return nil
+}
+
+// SetAdminNotifyPrefs replaces the notification preferences of the admin
+// with session user ID adminID and saves.
+func (cm *ConfigManager) SetAdminNotifyPrefs(adminID string, p AdminNotifyPrefs) error {
+	var events []string
+	for _, e := range p.Events {
+		if !slices.Contains(NotifyEvents, e) {
+			return fmt.Errorf("未知的通知事件: %s", e)
+		}
+		if !slices.Contains(events, e) {
+			events = append(events, e)
+		}
+	}
+	p.Events = events
+	p.Email = strings.TrimSpace(p.Email)
+	if p.Email != "" && (!strings.Contains(p.Email, "@") || strings.ContainsAny(p.Email, "\r\n ,;") || len(p.Email) > 254) {
+		return errors.New("邮箱格式不正确")
+	}
+	p.WebhookURL = strings.TrimSpace(p.WebhookURL)
+	p.Secret = strings.TrimSpace(p.Secret)
+	if p.WebhookURL == "" {
+		p.Channel, p.Secret = "", ""
+	} else {
+		if !slices.Contains(NotifyChannels, p.Channel) {
+			return fmt.Errorf("未知的通知渠道: %s", p.Channel)
+		}
+		if u, err := url.Parse(p.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("Webhook 地址必须是 http(s) URL")
+		}
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.config == nil {
+		return errors.New("no config loaded")
+	}
+	if cm.config.Notifications.Admins == nil {
+		cm.config.Notifications.Admins = make(map[string]AdminNotifyPrefs)
+	}
+	cm.config.Notifications.Admins[adminID] = p
+	return cm.saveLocked()
+}
+
+// DeleteAdminNotifyPrefs removes the notification preferences of an admin,
+// e.g. a deleted sub-account, and saves.
+func (cm *ConfigManager) DeleteAdminNotifyPrefs(adminID string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.config == nil {
+		return nil
+	}
+	if _, ok := cm.config.Notifications.Admins[adminID]; !ok {
+		return nil
+	}
+	delete(cm.config.Notifications.Admins, adminID)
+	return cm.saveLocked()
+}
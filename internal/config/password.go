@@ -0,0 +1,220 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PasswordConfig is the password policy applied to user registrations and
+// resets, the admin account and admin sub-accounts.
+type PasswordConfig struct {
+	// MinLength is the minimum password length in bytes; 0 means 8.
+	MinLength int `json:"min_length"`
+	// Require lists the character classes a password must contain: "letter",
+	// "upper", "lower", "digit" and "symbol". Nil means letter and digit.
+	Require []string `json:"require"`
+	// BreachList is a local file of leaked password SHA-1 hashes in the Have I
+	// Been Pwned "ordered by hash" format (HASH or HASH:COUNT per line, sorted).
+	// Passwords found in it are rejected. Empty disables the check.
+	BreachList string `json:"breach_list"`
+	// MaxAgeDays is how long a password is valid before it has to be changed;
+	// 0 disables rotation.
+	MaxAgeDays int `json:"max_age_days"`
+}
+
+const (
+	defaultPasswordMinLength = 8
+	// maxPasswordLength is the bcrypt input limit.
+	maxPasswordLength = 72
+)
+
+// passwordClasses maps the Require class names to their checks and messages.
+var passwordClasses = map[string]struct {
+	match func(rune) bool
+	msg   string
+}{
+	"letter": {func(c rune) bool { return c < unicode.MaxASCII && unicode.IsLetter(c) }, "字母"},
+	"upper":  {func(c rune) bool { return c >= 'A' && c <= 'Z' }, "大写字母"},
+	"lower":  {func(c rune) bool { return c >= 'a' && c <= 'z' }, "小写字母"},
+	"digit":  {func(c rune) bool { return c >= '0' && c <= '9' }, "数字"},
+	"symbol": {func(c rune) bool { return unicode.IsPunct(c) || unicode.IsSymbol(c) }, "特殊符号"},
+}
+
+// passwordClassOrder is the order classes are listed in error messages.
+var passwordClassOrder = []string{"letter", "upper", "lower", "digit", "symbol"}
+
+// EffectiveMinLength returns MinLength, or the default when unset.
+func (p PasswordConfig) EffectiveMinLength() int {
+	if p.MinLength <= 0 {
+		return defaultPasswordMinLength
+	}
+	return p.MinLength
+}
+
+// EffectiveRequire returns Require, or the default classes when unset.
+func (p PasswordConfig) EffectiveRequire() []string {
+	if p.Require == nil {
+		return []string{"letter", "digit"}
+	}
+	return p.Require
+}
+
+// Check returns an error describing why password violates the policy, or nil.
+func (p PasswordConfig) Check(password string) error {
+	if min := p.EffectiveMinLength(); len(password) < min {
+		return fmt.Errorf("密码至少%d位", min)
+	}
+	if len(password) > maxPasswordLength {
+		return errors.New("密码不能超过72位")
+	}
+	var missing []string
+	required := make(map[string]bool)
+	for _, class := range p.EffectiveRequire() {
+		required[class] = true
+	}
+	for _, class := range passwordClassOrder {
+		if !required[class] || strings.IndexFunc(password, passwordClasses[class].match) >= 0 {
+			continue
+		}
+		missing = append(missing, passwordClasses[class].msg)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("密码必须包含%s", strings.Join(missing, "、"))
+	}
+	if p.BreachList != "" {
+		found, err := breachListContains(p.BreachList, password)
+		if err != nil {
+			return fmt.Errorf("检查泄露密码库失败: %w", err)
+		}
+		if found {
+			return errors.New("该密码已出现在泄露密码库中，请换一个密码")
+		}
+	}
+	return nil
+}
+
+// Expired reports whether a password last changed at changedAt has to be
+// changed. A zero changedAt never expires.
+func (p PasswordConfig) Expired(changedAt time.Time) bool {
+	if p.MaxAgeDays <= 0 || changedAt.IsZero() {
+		return false
+	}
+	return time.Since(changedAt) > time.Duration(p.MaxAgeDays)*24*time.Hour
+}
+
+// toPasswordClasses converts a password.require update value.
+func toPasswordClasses(val interface{}) ([]string, error) {
+	items, ok := val.([]interface{})
+	if !ok {
+		return nil, errors.New("expected string array")
+	}
+	classes := make([]string, 0, len(items))
+	seen := make(map[string]bool)
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, errors.New("expected string array")
+		}
+		s = strings.ToLower(strings.TrimSpace(s))
+		if _, known := passwordClasses[s]; !known {
+			return nil, fmt.Errorf("unknown password character class: %s", s)
+		}
+		if !seen[s] {
+			seen[s] = true
+			classes = append(classes, s)
+		}
+	}
+	return classes, nil
+}
+
+// breachListContains binary-searches the sorted hash file at path for the
+// SHA-1 of password, so lists of any size can be used without loading them.
+func breachListContains(path, password string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	sum := sha1.Sum([]byte(password))
+	target := []byte(strings.ToUpper(hex.EncodeToString(sum[:])))
+
+	// Invariant: if target is in the file, its line starts in [lo, hi)
+	lo, hi := int64(0), info.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := lineAfter(f, mid)
+		if err != nil {
+			return false, err
+		}
+		if line == nil || start >= hi {
+			hi = mid
+			continue
+		}
+		switch bytes.Compare(hashField(line), target) {
+		case 0:
+			return true, nil
+		case -1:
+			lo = start + int64(len(line)) + 1
+		default:
+			hi = mid
+		}
+	}
+	return false, nil
+}
+
+// lineAfter returns the first line starting at or after offset (offset 0
+// is a line start), with its start offset, or a nil line at end of file.
+func lineAfter(f *os.File, offset int64) (int64, []byte, error) {
+	if offset == 0 {
+		line, err := readLine(bufio.NewReader(io.NewSectionReader(f, 0, 1<<62)))
+		return 0, line, err
+	}
+	r := bufio.NewReader(io.NewSectionReader(f, offset-1, 1<<62))
+	skipped, err := r.ReadBytes('\n')
+	if err == io.EOF {
+		return offset - 1 + int64(len(skipped)), nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	start := offset - 1 + int64(len(skipped))
+	line, err := readLine(r)
+	return start, line, err
+}
+
+// readLine reads a line without its terminator; nil at end of file.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err == io.EOF {
+		if len(line) == 0 {
+			return nil, nil
+		}
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(line, []byte("\n")), nil
+}
+
+// hashField returns the upper-cased hash of a breach list line, dropping the
+// ":COUNT" suffix and a trailing carriage return.
+func hashField(line []byte) []byte {
+	if i := bytes.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	return bytes.ToUpper(bytes.TrimSpace(line))
+}
@@ -0,0 +1,39 @@
+package config
+
+import "time"
+
+// SessionConfig controls how long user and admin login sessions last. Each
+// authenticated request extends a session to IdleTimeoutMinutes from then,
+// but never past MaxLifetimeHours after login.
+type SessionConfig struct {
+	// IdleTimeoutMinutes is how long a session lasts without activity; 0 means
+	// 1440 (24 hours).
+	IdleTimeoutMinutes int `json:"idle_timeout_minutes"`
+	// MaxLifetimeHours is how long a session lasts at most, however active;
+	// 0 means 168 (7 days).
+	MaxLifetimeHours int `json:"max_lifetime_hours"`
+}
+
+const (
+	defaultSessionIdleTimeout = 24 * time.Hour
+	defaultSessionMaxLifetime = 7 * 24 * time.Hour
+	// minSessionIdleTimeoutMinutes leaves the frontend time to warn before
+	// an idle session expires.
+	minSessionIdleTimeoutMinutes = 10
+)
+
+// IdleTimeout returns the idle timeout, or the default when unset.
+func (s SessionConfig) IdleTimeout() time.Duration {
+	if s.IdleTimeoutMinutes <= 0 {
+		return defaultSessionIdleTimeout
+	}
+	return time.Duration(s.IdleTimeoutMinutes) * time.Minute
+}
+
+// MaxLifetime returns the maximum session lifetime, or the default when unset.
+func (s SessionConfig) MaxLifetime() time.Duration {
+	if s.MaxLifetimeHours <= 0 {
+		return defaultSessionMaxLifetime
+	}
+	return time.Duration(s.MaxLifetimeHours) * time.Hour
+}
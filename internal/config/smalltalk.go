@@ -0,0 +1,118 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SmallTalkConfig controls the local handling of trivial messages such as
+// greetings, thanks and acknowledgements: they are answered from phrase
+// lists without any LLM call.
+type SmallTalkConfig struct {
+	// Disabled sends small talk through intent classification like any
+	// other message.
+	Disabled bool `json:"disabled"`
+	// IntroIntervalMin is how often, in minutes, a user is greeted with the
+	// product intro; repeated greetings within it get the short greeting
+	// reply instead. 0 means 30.
+	IntroIntervalMin int `json:"intro_interval_min"`
+	// Rules are the phrase lists by language and kind. Nil means
+	// DefaultSmallTalkRules.
+	Rules []SmallTalkRule `json:"rules"`
+}
+
+// SmallTalkRule answers messages that consist of one of Phrases, compared
+// case-insensitively and ignoring punctuation, symbols and spaces.
+type SmallTalkRule struct {
+	Language string   `json:"language"` // language code of the phrases, e.g. "zh" or "en"
+	Kind     string   `json:"kind"`     // one of the SmallTalk* kinds
+	Phrases  []string `json:"phrases"`
+	// Reply is the answer. Greetings are answered with the product intro
+	// and get Reply only when the user saw the intro recently.
+	Reply string `json:"reply"`
+}
+
+// Small talk kinds.
+const (
+	SmallTalkGreeting = "greeting"
+	SmallTalkThanks   = "thanks"
+	SmallTalkAck      = "ack"
+	SmallTalkGoodbye  = "goodbye"
+)
+
+// SmallTalkKinds lists the small talk kinds in display order.
+var SmallTalkKinds = []string{SmallTalkGreeting, SmallTalkThanks, SmallTalkAck, SmallTalkGoodbye}
+
+const (
+	defaultSmallTalkIntroIntervalMin = 30
+	maxSmallTalkRules                = 100
+	maxSmallTalkPhrases              = 200
+	// MaxSmallTalkPhraseRunes bounds phrase length; longer messages are
+	// never small talk.
+	MaxSmallTalkPhraseRunes = 30
+)
+
+// EffectiveIntroIntervalMin returns IntroIntervalMin, or the default when unset.
+func (s SmallTalkConfig) EffectiveIntroIntervalMin() int {
+	if s.IntroIntervalMin <= 0 {
+		return defaultSmallTalkIntroIntervalMin
+	}
+	return s.IntroIntervalMin
+}
+
+// DefaultSmallTalkRules returns the built-in Chinese and English phrase lists.
+func DefaultSmallTalkRules() []SmallTalkRule {
+	return []SmallTalkRule{
+		{Language: "zh", Kind: SmallTalkGreeting, Phrases: []string{"你好", "您好", "你好呀", "嗨", "哈喽", "在吗", "在不在", "早", "早上好", "上午好", "中午好", "下午好", "晚上好"}, Reply: "您好，请问有什么可以帮您？"},
+		{Language: "zh", Kind: SmallTalkThanks, Phrases: []string{"谢谢", "谢谢你", "谢谢您", "多谢", "感谢", "非常感谢", "谢啦", "谢了", "好的谢谢"}, Reply: "不客气！还有其他问题随时问我。"},
+		{Language: "zh", Kind: SmallTalkAck, Phrases: []string{"好", "好的", "好滴", "嗯", "嗯嗯", "哦", "噢", "明白", "明白了", "知道了", "了解", "收到", "可以", "行"}, Reply: "好的，还有其他问题随时问我。"},
+		{Language: "zh", Kind: SmallTalkGoodbye, Phrases: []string{"再见", "拜拜", "回见", "没事了"}, Reply: "好的，祝您使用愉快，再见！"},
+		{Language: "en", Kind: SmallTalkGreeting, Phrases: []string{"hi", "hello", "hey", "hi there", "hello there", "good morning", "good afternoon", "good evening"}, Reply: "Hello, how can I help you?"},
+		{Language: "en", Kind: SmallTalkThanks, Phrases: []string{"thanks", "thank you", "thx", "ty", "thanks a lot", "thank you very much", "many thanks", "ok thanks", "ok thank you"}, Reply: "You're welcome! Let me know if you have any other questions."},
+		{Language: "en", Kind: SmallTalkAck, Phrases: []string{"ok", "okay", "k", "got it", "i see", "understood", "cool", "great", "nice", "sure", "alright"}, Reply: "Great! Let me know if there's anything else I can help with."},
+		{Language: "en", Kind: SmallTalkGoodbye, Phrases: []string{"bye", "goodbye", "bye bye", "see you", "that's all", "thats all"}, Reply: "Goodbye, have a nice day!"},
+	}
+}
+
+// validateSmallTalkRules checks and normalises rules set through the API.
+func validateSmallTalkRules(rules []SmallTalkRule) ([]SmallTalkRule, error) {
+	if len(rules) > maxSmallTalkRules {
+		return nil, fmt.Errorf("at most %d small talk rules are allowed", maxSmallTalkRules)
+	}
+	out := make([]SmallTalkRule, 0, len(rules))
+	for _, r := range rules {
+		r.Language = strings.ToLower(strings.TrimSpace(r.Language))
+		r.Kind = strings.TrimSpace(r.Kind)
+		r.Reply = strings.TrimSpace(r.Reply)
+		valid := false
+		for _, k := range SmallTalkKinds {
+			valid = valid || r.Kind == k
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown small talk kind %q", r.Kind)
+		}
+		if r.Reply == "" && r.Kind != SmallTalkGreeting {
+			return nil, errors.New("small talk reply must not be empty")
+		}
+		phrases := make([]string, 0, len(r.Phrases))
+		for _, p := range r.Phrases {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			if len([]rune(p)) > MaxSmallTalkPhraseRunes {
+				return nil, fmt.Errorf("small talk phrase %q is longer than %d characters", p, MaxSmallTalkPhraseRunes)
+			}
+			phrases = append(phrases, p)
+		}
+		if len(phrases) == 0 {
+			continue
+		}
+		if len(phrases) > maxSmallTalkPhrases {
+			return nil, fmt.Errorf("at most %d phrases are allowed per small talk rule", maxSmallTalkPhrases)
+		}
+		r.Phrases = phrases
+		out = append(out, r)
+	}
+	return out, nil
+}
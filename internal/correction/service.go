@@ -0,0 +1,270 @@
+// Package correction stores corrections that end users suggest for answers:
+// a sentence of the answer flagged as wrong, optionally with the correct
+// information, tied to the cited chunk it came from. Suggestions wait in a
+// moderation queue until an admin accepts or rejects them.
+package correction
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"askflow/internal/idgen"
+)
+
+// Suggestion states.
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusRejected = "rejected"
+)
+
+// How an accepted suggestion was applied to the knowledge base.
+const (
+	AppliedChunk     = "chunk"     // the cited chunk was edited
+	AppliedKnowledge = "knowledge" // a knowledge entry was added
+)
+
+const (
+	maxSentenceRunes   = 1000
+	maxSuggestionRunes = 2000
+	// maxPendingPerQuery caps the open suggestions a user has on one answer.
+	maxPendingPerQuery = 3
+	// maxPendingPerUser caps the open suggestions of a user overall, so one
+	// account cannot flood the queue.
+	maxPendingPerUser = 20
+)
+
+// Suggestion is a correction suggested for a sentence of an answer.
+// DocumentID is empty when the user did not tie it to a cited source.
+type Suggestion struct {
+	ID           string     `json:"id"`
+	QueryID      string     `json:"query_id"`
+	UserID       string     `json:"user_id"`
+	ProductID    string     `json:"product_id"`
+	Question     string     `json:"question"`
+	Sentence     string     `json:"sentence"`
+	Suggestion   string     `json:"suggestion"`
+	DocumentID   string     `json:"document_id,omitempty"`
+	DocumentName string     `json:"document_name,omitempty"`
+	ChunkIndex   int        `json:"chunk_index"`
+	Status       string     `json:"status"`
+	AppliedAs    string     `json:"applied_as,omitempty"`   // AppliedChunk or AppliedKnowledge
+	KnowledgeID  string     `json:"knowledge_id,omitempty"` // entry added for the suggestion
+	Note         string     `json:"note,omitempty"`         // moderator's note
+	ResolvedBy   string     `json:"resolved_by,omitempty"`  // admin who accepted or rejected it
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Input is a suggestion submitted by the user who received the answer.
+type Input struct {
+	QueryID    string `json:"query_id"`
+	Sentence   string `json:"sentence"`
+	Suggestion string `json:"suggestion"`
+	DocumentID string `json:"document_id"`
+	ChunkIndex int    `json:"chunk_index"`
+}
+
+// Resolution records how a moderator handled a suggestion.
+type Resolution struct {
+	Status      string
+	AppliedAs   string
+	KnowledgeID string
+	Note        string
+	ResolvedBy  string
+}
+
+// ValidStatusFilter reports whether s is an accepted queue filter: empty for
+// all suggestions, or one of the states.
+func ValidStatusFilter(s string) bool {
+	return s == "" || s == StatusPending || s == StatusAccepted || s == StatusRejected
+}
+
+// Service stores correction suggestions.
+type Service struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+}
+
+// NewService creates a new correction Service.
+func NewService(readDB, writeDB *sql.DB) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB}
+}
+
+// citation is the part of a query log source that identifies a chunk.
+type citation struct {
+	DocumentID string `json:"document_id"`
+	ChunkIndex int    `json:"chunk_index"`
+}
+
+// Submit stores a suggestion for an answer the user received. The flagged
+// sentence is required; when a document is given it must be one of the
+// answer's sources.
+func (s *Service) Submit(userID string, in Input) (*Suggestion, error) {
+	in.Sentence = strings.TrimSpace(in.Sentence)
+	in.Suggestion = strings.TrimSpace(in.Suggestion)
+	if in.Sentence == "" {
+		return nil, fmt.Errorf("请选择有误的句子")
+	}
+	if len([]rune(in.Sentence)) > maxSentenceRunes {
+		return nil, fmt.Errorf("句子长度不能超过 %d 个字符", maxSentenceRunes)
+	}
+	if len([]rune(in.Suggestion)) > maxSuggestionRunes {
+		return nil, fmt.Errorf("建议内容不能超过 %d 个字符", maxSuggestionRunes)
+	}
+
+	var productID, sources string
+	err := s.readDB.QueryRow(
+		"SELECT COALESCE(product_id, ''), COALESCE(sources, '') FROM query_logs WHERE id = ? AND user_id = ?",
+		in.QueryID, userID,
+	).Scan(&productID, &sources)
+	if err != nil {
+		return nil, fmt.Errorf("回答不存在")
+	}
+	if in.DocumentID != "" {
+		var cited []citation
+		if sources != "" {
+			if err := json.Unmarshal([]byte(sources), &cited); err != nil {
+				return nil, fmt.Errorf("failed to decode sources: %w", err)
+			}
+		}
+		found := false
+		for _, c := range cited {
+			if c.DocumentID == in.DocumentID && c.ChunkIndex == in.ChunkIndex {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("引用来源不存在")
+		}
+	} else {
+		in.ChunkIndex = 0
+	}
+
+	var perQuery, perUser int
+	if err := s.readDB.QueryRow(
+		`SELECT COALESCE(SUM(CASE WHEN query_id = ? THEN 1 ELSE 0 END), 0), COUNT(*)
+		 FROM correction_suggestions WHERE user_id = ? AND status = ?`,
+		in.QueryID, userID, StatusPending,
+	).Scan(&perQuery, &perUser); err != nil {
+		return nil, fmt.Errorf("failed to count suggestions: %w", err)
+	}
+	if perQuery >= maxPendingPerQuery {
+		return nil, fmt.Errorf("该回答已有 %d 条待处理的纠错建议", perQuery)
+	}
+	if perUser >= maxPendingPerUser {
+		return nil, fmt.Errorf("您的待处理纠错建议过多，请等待管理员处理后再提交")
+	}
+
+	id, err := idgen.New()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if _, err := s.writeDB.Exec(
+		`INSERT INTO correction_suggestions (id, query_id, user_id, product_id, sentence, suggestion, document_id, chunk_index, status, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, in.QueryID, userID, productID, in.Sentence, in.Suggestion, in.DocumentID, in.ChunkIndex, StatusPending, now,
+	); err != nil {
+		return nil, fmt.Errorf("failed to store suggestion: %w", err)
+	}
+	return &Suggestion{
+		ID: id, QueryID: in.QueryID, UserID: userID, ProductID: productID,
+		Sentence: in.Sentence, Suggestion: in.Suggestion, DocumentID: in.DocumentID, ChunkIndex: in.ChunkIndex,
+		Status: StatusPending, CreatedAt: now,
+	}, nil
+}
+
+const suggestionColumns = `s.id, s.query_id, s.user_id, s.product_id, COALESCE(q.question, ''),
+	s.sentence, s.suggestion, s.document_id, COALESCE(d.name, ''), s.chunk_index, s.status,
+	s.applied_as, s.knowledge_id, s.note, s.resolved_by, s.resolved_at, s.created_at`
+
+const suggestionFrom = ` FROM correction_suggestions s
+	LEFT JOIN query_logs q ON q.id = s.query_id
+	LEFT JOIN documents d ON d.id = s.document_id AND s.document_id != ''`
+
+func scanSuggestion(scan func(dest ...interface{}) error) (*Suggestion, error) {
+	var sg Suggestion
+	var resolvedAt sql.NullTime
+	if err := scan(&sg.ID, &sg.QueryID, &sg.UserID, &sg.ProductID, &sg.Question,
+		&sg.Sentence, &sg.Suggestion, &sg.DocumentID, &sg.DocumentName, &sg.ChunkIndex, &sg.Status,
+		&sg.AppliedAs, &sg.KnowledgeID, &sg.Note, &sg.ResolvedBy, &resolvedAt, &sg.CreatedAt); err != nil {
+		return nil, err
+	}
+	if resolvedAt.Valid {
+		t := resolvedAt.Time
+		sg.ResolvedAt = &t
+	}
+	return &sg, nil
+}
+
+// Get returns a single suggestion.
+func (s *Service) Get(id string) (*Suggestion, error) {
+	sg, err := scanSuggestion(s.writeDB.QueryRow("SELECT "+suggestionColumns+suggestionFrom+" WHERE s.id = ?", id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("纠错建议不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get suggestion: %w", err)
+	}
+	return sg, nil
+}
+
+// List returns the suggestions in the given state (all when empty) and of a
+// product (all when empty). Pending suggestions are listed oldest first, as
+// a queue; handled ones newest first.
+func (s *Service) List(status, productID string) ([]Suggestion, error) {
+	query := "SELECT " + suggestionColumns + suggestionFrom + " WHERE 1 = 1"
+	var args []interface{}
+	if status != "" {
+		query += " AND s.status = ?"
+		args = append(args, status)
+	}
+	if productID != "" {
+		query += " AND s.product_id = ?"
+		args = append(args, productID)
+	}
+	if status == StatusPending {
+		query += " ORDER BY s.created_at"
+	} else {
+		query += " ORDER BY s.created_at DESC"
+	}
+	rows, err := s.readDB.Query(query+" LIMIT 500", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list suggestions: %w", err)
+	}
+	defer rows.Close()
+	list := []Suggestion{}
+	for rows.Next() {
+		sg, err := scanSuggestion(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan suggestion: %w", err)
+		}
+		list = append(list, *sg)
+	}
+	return list, rows.Err()
+}
+
+// Resolve closes a pending suggestion. It fails when the suggestion does
+// not exist or was already handled.
+func (s *Service) Resolve(id string, r Resolution) error {
+	if r.Status != StatusAccepted && r.Status != StatusRejected {
+		return fmt.Errorf("invalid status: %s", r.Status)
+	}
+	res, err := s.writeDB.Exec(
+		`UPDATE correction_suggestions SET status = ?, applied_as = ?, knowledge_id = ?, note = ?, resolved_by = ?, resolved_at = ?
+		 WHERE id = ? AND status = ?`,
+		r.Status, r.AppliedAs, r.KnowledgeID, r.Note, r.ResolvedBy, time.Now().UTC(), id, StatusPending,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to resolve suggestion: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("纠错建议不存在或已处理")
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Package datadir locates the data directory and controls how files are
+// created in it. Paths are resolved against an absolute root set at startup,
+// so the service no longer depends on its working directory, and every file
+// and directory it creates uses the configured permission modes.
+package datadir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AllowWorldWritableEnvVar lets the service start with a world-writable data
+// directory. It is an environment variable rather than a config option
+// because the config file itself lives in that directory.
+const AllowWorldWritableEnvVar = "ASKFLOW_ALLOW_WORLD_WRITABLE_DATADIR"
+
+// ErrOutsideDataDir is returned by Contain for paths outside the data
+// directory while access is restricted to it.
+var ErrOutsideDataDir = errors.New("path is outside the data directory")
+
+var (
+	mu       sync.RWMutex
+	root                 = "./data"
+	dirMode  os.FileMode = 0755
+	fileMode os.FileMode = 0644
+	confined bool
+)
+
+// SetRoot sets the data directory. Relative paths are made absolute against
+// the current working directory once, here.
+func SetRoot(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve data directory: %w", err)
+	}
+	mu.Lock()
+	root = abs
+	mu.Unlock()
+	return nil
+}
+
+// Root returns the data directory.
+func Root() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return root
+}
+
+// Path joins elem onto the data directory.
+func Path(elem ...string) string {
+	return filepath.Join(append([]string{Root()}, elem...)...)
+}
+
+// DirMode returns the permission mode for directories created in the data directory.
+func DirMode() os.FileMode {
+	mu.RLock()
+	defer mu.RUnlock()
+	return dirMode
+}
+
+// FileMode returns the permission mode for files created in the data directory.
+func FileMode() os.FileMode {
+	mu.RLock()
+	defer mu.RUnlock()
+	return fileMode
+}
+
+// ParseMode parses an octal permission string such as "0750". An empty
+// string yields def.
+func ParseMode(s string, def os.FileMode) (os.FileMode, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n > 0777 {
+		return 0, fmt.Errorf("invalid permission mode %q (expected octal, e.g. 0750)", s)
+	}
+	return os.FileMode(n), nil
+}
+
+// Settings are the file permission options applied at startup.
+type Settings struct {
+	Umask    string // octal process umask, "" keeps the inherited one
+	DirMode  string // octal mode for new directories, default "0755"
+	FileMode string // octal mode for new files, default "0644"
+	Confine  bool   // reject user-supplied paths outside the data directory
+}
+
+// Apply validates and applies s.
+func Apply(s Settings) error {
+	dm, err := ParseMode(s.DirMode, 0755)
+	if err != nil {
+		return err
+	}
+	fm, err := ParseMode(s.FileMode, 0644)
+	if err != nil {
+		return err
+	}
+	if s.Umask != "" {
+		mask, err := ParseMode(s.Umask, 0)
+		if err != nil {
+			return fmt.Errorf("invalid umask: %w", err)
+		}
+		setUmask(int(mask))
+	}
+	mu.Lock()
+	dirMode, fileMode, confined = dm, fm, s.Confine
+	mu.Unlock()
+	return nil
+}
+
+// MkdirAll creates dir and its parents with the configured directory mode.
+func MkdirAll(dir string) error {
+	return os.MkdirAll(dir, DirMode())
+}
+
+// WriteFile writes data to name with the configured file mode.
+func WriteFile(name string, data []byte) error {
+	return os.WriteFile(name, data, FileMode())
+}
+
+// Confined reports whether user-supplied paths are restricted to the data directory.
+func Confined() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return confined
+}
+
+// Contain returns the absolute form of path, or ErrOutsideDataDir if access
+// is restricted to the data directory and path resolves outside it.
+// Symlinks are resolved so a link inside the data directory cannot point out
+// of it.
+func Contain(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if !Confined() {
+		return abs, nil
+	}
+	resolved := abs
+	if r, err := filepath.EvalSymlinks(abs); err == nil {
+		resolved = r
+	}
+	base := Root()
+	if r, err := filepath.EvalSymlinks(base); err == nil {
+		base = r
+	}
+	rel, err := filepath.Rel(base, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrOutsideDataDir
+	}
+	return abs, nil
+}
+
+// CheckPermissions refuses a data directory that other users can write to,
+// since anyone could then replace the config, database or encryption key.
+// Setting AllowWorldWritableEnvVar=1 downgrades the error to a warning,
+// returned as ok=false with a nil error.
+func CheckPermissions(dir string) (ok bool, err error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat data directory: %w", err)
+	}
+	if !worldWritable(info) {
+		return true, nil
+	}
+	if os.Getenv(AllowWorldWritableEnvVar) == "1" {
+		return false, nil
+	}
+	return false, fmt.Errorf("data directory %s is world-writable (mode %04o); run chmod o-w on it, or set %s=1 to start anyway",
+		dir, info.Mode().Perm(), AllowWorldWritableEnvVar)
+}
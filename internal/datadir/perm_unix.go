@@ -0,0 +1,19 @@
+//go:build !windows
+
+package datadir
+
+import (
+	"os"
+	"syscall"
+)
+
+// setUmask sets the process umask.
+func setUmask(mask int) {
+	syscall.Umask(mask)
+}
+
+// worldWritable reports whether others may write to the file. The sticky bit
+// (as on /tmp) does not make a shared directory safe for our files either.
+func worldWritable(info os.FileInfo) bool {
+	return info.Mode().Perm()&0002 != 0
+}
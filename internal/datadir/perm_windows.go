@@ -0,0 +1,14 @@
+//go:build windows
+
+package datadir
+
+import "os"
+
+// setUmask is a no-op: Windows has no umask; access is governed by ACLs.
+func setUmask(mask int) {}
+
+// worldWritable always reports false on Windows, where the permission bits
+// returned by os.Stat do not reflect ACLs.
+func worldWritable(info os.FileInfo) bool {
+	return false
+}
@@ -4,6 +4,7 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -38,8 +39,24 @@ func (p *DBPair) Close() error {
 // foreign keys, and creates all required tables idempotently.
 // Returns a DBPair with separate read and write pools for optimal concurrency.
 func InitDB(dbPath string) (*DBPair, error) {
+	return initDB(dbPath, dbPath+"?mode=ro")
+}
+
+// memoryDBSeq numbers in-memory databases so each InitMemoryDB call gets its own.
+var memoryDBSeq atomic.Int64
+
+// InitMemoryDB creates a database that lives only in memory, with the same
+// schema and read/write pools as InitDB, for integration tests. It uses
+// SQLite's memdb VFS so both pools see the same data; journaling falls back
+// from WAL to memory mode. The data is gone once the DBPair is closed.
+func InitMemoryDB() (*DBPair, error) {
+	dsn := fmt.Sprintf("file:/askflow-memory-%d?vfs=memdb", memoryDBSeq.Add(1))
+	return initDB(dsn, dsn+"&mode=ro")
+}
+
+func initDB(writeDSN, readDSN string) (*DBPair, error) {
 	// --- Write connection: single connection, exclusive writer ---
-	writeDB, err := sql.Open("sqlite3", dbPath)
+	writeDB, err := sql.Open("sqlite3", writeDSN)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open write database: %w", err)
 	}
@@ -59,7 +76,7 @@ func InitDB(dbPath string) (*DBPair, error) {
 	}
 
 	// --- Read connection pool: multiple connections for concurrent reads ---
-	readDB, err := sql.Open("sqlite3", dbPath+"?mode=ro")
+	readDB, err := sql.Open("sqlite3", readDSN)
 	if err != nil {
 		writeDB.Close()
 		return nil, fmt.Errorf("failed to open read database: %w", err)
@@ -130,6 +147,9 @@ func InitDB(dbPath string) (*DBPair, error) {
 // configureWritePragmas sets pragmas for the write connection.
 func configureWritePragmas(db *sql.DB) error {
 	pragmas := []string{
+		// Only takes effect on a new database; the nightly maintenance converts
+		// existing ones with a one-off VACUUM
+		"PRAGMA auto_vacuum=INCREMENTAL",
 		"PRAGMA journal_mode=WAL",
 		"PRAGMA foreign_keys=ON",
 		"PRAGMA busy_timeout=30000",
@@ -228,10 +248,11 @@ func createTables(db *sql.DB) error {
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
 		`CREATE TABLE IF NOT EXISTS sessions (
-			id         TEXT PRIMARY KEY,
-			user_id    TEXT NOT NULL,
-			expires_at DATETIME NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			id            TEXT PRIMARY KEY,
+			user_id       TEXT NOT NULL,
+			expires_at    DATETIME NOT NULL,
+			last_activity DATETIME,
+			created_at    DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
 		`CREATE TABLE IF NOT EXISTS video_segments (
@@ -244,6 +265,49 @@ func createTables(db *sql.DB) error {
 			chunk_id     TEXT NOT NULL,
 			FOREIGN KEY (document_id) REFERENCES documents(id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS video_chapters (
+			id            TEXT PRIMARY KEY,
+			document_id   TEXT NOT NULL,
+			chapter_index INTEGER NOT NULL,
+			title         TEXT NOT NULL,
+			summary       TEXT DEFAULT '',
+			start_time    REAL NOT NULL,
+			end_time      REAL NOT NULL,
+			created_at    DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (document_id) REFERENCES documents(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS chunk_translations (
+			document_id  TEXT NOT NULL,
+			chunk_index  INTEGER NOT NULL,
+			source_index INTEGER NOT NULL,
+			language     TEXT NOT NULL,
+			created_at   DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (document_id, chunk_index),
+			FOREIGN KEY (document_id) REFERENCES documents(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS image_refs (
+			filename    TEXT NOT NULL,
+			document_id TEXT NOT NULL,
+			created_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (filename, document_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS chunk_locations (
+			document_id  TEXT NOT NULL,
+			chunk_index  INTEGER NOT NULL,
+			page         INTEGER DEFAULT 0,
+			char_start   INTEGER DEFAULT -1,
+			char_end     INTEGER DEFAULT -1,
+			heading_path TEXT DEFAULT '',
+			created_at   DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (document_id, chunk_index),
+			FOREIGN KEY (document_id) REFERENCES documents(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS document_texts (
+			document_id TEXT PRIMARY KEY,
+			content     TEXT NOT NULL,
+			created_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (document_id) REFERENCES documents(id)
+		)`,
 		`CREATE TABLE IF NOT EXISTS sn_users (
 			id             INTEGER PRIMARY KEY AUTOINCREMENT,
 			email          TEXT UNIQUE NOT NULL,
@@ -260,6 +324,403 @@ func createTables(db *sql.DB) error {
 			expires_at  DATETIME NOT NULL,
 			FOREIGN KEY (user_id) REFERENCES sn_users(id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS operation_tokens (
+			token       TEXT PRIMARY KEY,
+			user_id     TEXT NOT NULL,
+			method      TEXT NOT NULL,
+			path        TEXT NOT NULL,
+			expires_at  DATETIME NOT NULL,
+			used_at     DATETIME,
+			created_at  DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS query_logs (
+			id          TEXT PRIMARY KEY,
+			user_id     TEXT NOT NULL,
+			product_id  TEXT DEFAULT '',
+			question    TEXT NOT NULL,
+			is_pending  INTEGER DEFAULT 0,
+			rating      INTEGER DEFAULT 0,
+			created_at  DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS feeds (
+			id              TEXT PRIMARY KEY,
+			product_id      TEXT DEFAULT '',
+			url             TEXT NOT NULL,
+			title           TEXT DEFAULT '',
+			interval_min    INTEGER NOT NULL DEFAULT 60,
+			enabled         INTEGER DEFAULT 1,
+			last_fetched_at DATETIME,
+			last_error      TEXT DEFAULT '',
+			created_at      DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS feed_items (
+			id          TEXT PRIMARY KEY,
+			feed_id     TEXT NOT NULL,
+			guid        TEXT NOT NULL,
+			title       TEXT DEFAULT '',
+			link        TEXT DEFAULT '',
+			document_id TEXT DEFAULT '',
+			error       TEXT DEFAULT '',
+			created_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (feed_id, guid),
+			FOREIGN KEY (feed_id) REFERENCES feeds(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS live_sources (
+			id              TEXT PRIMARY KEY,
+			product_id      TEXT DEFAULT '',
+			url             TEXT NOT NULL,
+			kind            TEXT NOT NULL,
+			title           TEXT DEFAULT '',
+			interval_min    INTEGER NOT NULL DEFAULT 1440,
+			enabled         INTEGER DEFAULT 1,
+			last_fetched_at DATETIME,
+			last_error      TEXT DEFAULT '',
+			created_at      DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS live_source_pages (
+			id           TEXT PRIMARY KEY,
+			source_id    TEXT NOT NULL,
+			url          TEXT NOT NULL,
+			document_id  TEXT DEFAULT '',
+			content_hash TEXT DEFAULT '',
+			lastmod      TEXT DEFAULT '',
+			error        TEXT DEFAULT '',
+			checked_at   DATETIME,
+			updated_at   DATETIME,
+			UNIQUE (source_id, url),
+			FOREIGN KEY (source_id) REFERENCES live_sources(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS git_sources (
+			id             TEXT PRIMARY KEY,
+			product_id     TEXT DEFAULT '',
+			repo_url       TEXT NOT NULL,
+			branch         TEXT DEFAULT '',
+			path           TEXT DEFAULT '',
+			access_token   TEXT DEFAULT '',
+			interval_min   INTEGER NOT NULL DEFAULT 1440,
+			enabled        INTEGER DEFAULT 1,
+			last_commit    TEXT DEFAULT '',
+			last_synced_at DATETIME,
+			last_error     TEXT DEFAULT '',
+			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS git_source_files (
+			id           TEXT PRIMARY KEY,
+			source_id    TEXT NOT NULL,
+			path         TEXT NOT NULL,
+			document_id  TEXT DEFAULT '',
+			content_hash TEXT DEFAULT '',
+			error        TEXT DEFAULT '',
+			updated_at   DATETIME,
+			UNIQUE (source_id, path),
+			FOREIGN KEY (source_id) REFERENCES git_sources(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS shared_answers (
+			token          TEXT PRIMARY KEY,
+			query_id       TEXT NOT NULL,
+			user_id        TEXT NOT NULL,
+			product_id     TEXT DEFAULT '',
+			question       TEXT NOT NULL,
+			answer         TEXT NOT NULL,
+			sources        TEXT NOT NULL DEFAULT '[]',
+			view_count     INTEGER DEFAULT 0,
+			expires_at     DATETIME NOT NULL,
+			last_viewed_at DATETIME,
+			created_at     DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS chat_states (
+			session_id TEXT PRIMARY KEY,
+			user_id    TEXT NOT NULL,
+			product_id TEXT DEFAULT '',
+			draft      TEXT NOT NULL DEFAULT '',
+			messages   TEXT NOT NULL DEFAULT '[]',
+			updated_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS chat_history (
+			id         TEXT PRIMARY KEY,
+			user_id    TEXT NOT NULL,
+			product_id TEXT DEFAULT '',
+			query_id   TEXT NOT NULL DEFAULT '',
+			question   TEXT NOT NULL,
+			answer     TEXT NOT NULL DEFAULT '',
+			sources    TEXT NOT NULL DEFAULT '[]',
+			is_pending INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id           TEXT PRIMARY KEY,
+			name         TEXT NOT NULL,
+			key_prefix   TEXT NOT NULL,
+			key_hash     TEXT NOT NULL UNIQUE,
+			scopes       TEXT NOT NULL DEFAULT '',
+			created_by   TEXT DEFAULT '',
+			expires_at   DATETIME,
+			last_used_at DATETIME,
+			created_at   DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS glossary_terms (
+			id         TEXT PRIMARY KEY,
+			product_id TEXT DEFAULT '',
+			term       TEXT NOT NULL,
+			deprecated TEXT NOT NULL DEFAULT '[]',
+			note       TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS troubleshooting_flows (
+			id          TEXT PRIMARY KEY,
+			product_id  TEXT DEFAULT '',
+			title       TEXT NOT NULL,
+			description TEXT DEFAULT '',
+			enabled     INTEGER NOT NULL DEFAULT 1,
+			start_node  TEXT NOT NULL,
+			nodes       TEXT NOT NULL DEFAULT '[]',
+			created_at  DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at  DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS citation_stats (
+			document_id     TEXT NOT NULL,
+			chunk_index     INTEGER NOT NULL,
+			cited           INTEGER NOT NULL DEFAULT 0,
+			clicked         INTEGER NOT NULL DEFAULT 0,
+			last_cited_at   DATETIME,
+			last_clicked_at DATETIME,
+			PRIMARY KEY (document_id, chunk_index)
+		)`,
+		`CREATE TABLE IF NOT EXISTS citation_clicks (
+			query_id    TEXT NOT NULL,
+			document_id TEXT NOT NULL,
+			chunk_index INTEGER NOT NULL,
+			created_at  DATETIME NOT NULL,
+			PRIMARY KEY (query_id, document_id, chunk_index)
+		)`,
+		`CREATE TABLE IF NOT EXISTS maintenance_runs (
+			id              INTEGER PRIMARY KEY AUTOINCREMENT,
+			trigger_type    TEXT NOT NULL,
+			started_at      DATETIME NOT NULL,
+			duration_ms     INTEGER NOT NULL DEFAULT 0,
+			freed_pages     INTEGER NOT NULL DEFAULT 0,
+			full_vacuum     INTEGER NOT NULL DEFAULT 0,
+			db_size_before  INTEGER NOT NULL DEFAULT 0,
+			db_size_after   INTEGER NOT NULL DEFAULT 0,
+			wal_size_before INTEGER NOT NULL DEFAULT 0,
+			wal_size_after  INTEGER NOT NULL DEFAULT 0,
+			error           TEXT DEFAULT ''
+		)`,
+		`CREATE TABLE IF NOT EXISTS document_tags (
+			document_id TEXT NOT NULL,
+			kind        TEXT NOT NULL,
+			tag         TEXT NOT NULL,
+			PRIMARY KEY (document_id, kind, tag)
+		)`,
+		`CREATE TABLE IF NOT EXISTS inbound_emails (
+			message_id  TEXT PRIMARY KEY,
+			sender      TEXT NOT NULL DEFAULT '',
+			subject     TEXT NOT NULL DEFAULT '',
+			document_id TEXT NOT NULL DEFAULT '',
+			created_at  DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS answer_audits (
+			request_id  TEXT PRIMARY KEY,
+			query_id    TEXT NOT NULL DEFAULT '',
+			user_id     TEXT NOT NULL DEFAULT '',
+			product_id  TEXT NOT NULL DEFAULT '',
+			question    TEXT NOT NULL,
+			kind        TEXT NOT NULL,
+			prompt      TEXT NOT NULL DEFAULT '',
+			chunks      TEXT NOT NULL DEFAULT '[]',
+			model       TEXT NOT NULL DEFAULT '',
+			endpoint    TEXT NOT NULL DEFAULT '',
+			temperature REAL NOT NULL DEFAULT 0,
+			max_tokens  INTEGER NOT NULL DEFAULT 0,
+			answer      TEXT NOT NULL DEFAULT '',
+			model_output TEXT NOT NULL DEFAULT '',
+			created_at  DATETIME NOT NULL
+		)`,
+		// Re-embedding job state: per-document progress towards a target
+		// model and the staged vectors swapped in when the job completes
+		`CREATE TABLE IF NOT EXISTS reindex_documents (
+			document_id TEXT PRIMARY KEY,
+			model       TEXT NOT NULL,
+			status      TEXT NOT NULL,
+			chunks      INTEGER NOT NULL DEFAULT 0,
+			error       TEXT NOT NULL DEFAULT '',
+			updated_at  DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS reindex_vectors (
+			document_id TEXT NOT NULL,
+			chunk_index INTEGER NOT NULL,
+			text_hash   TEXT NOT NULL,
+			embedding   BLOB NOT NULL,
+			PRIMARY KEY (document_id, chunk_index)
+		)`,
+		`CREATE TABLE IF NOT EXISTS jobs (
+			id          TEXT PRIMARY KEY,
+			type        TEXT NOT NULL,
+			target      TEXT NOT NULL DEFAULT '',
+			label       TEXT NOT NULL DEFAULT '',
+			status      TEXT NOT NULL,
+			progress    INTEGER NOT NULL DEFAULT 0,
+			message     TEXT NOT NULL DEFAULT '',
+			error       TEXT NOT NULL DEFAULT '',
+			created_at  DATETIME NOT NULL,
+			started_at  DATETIME,
+			finished_at DATETIME
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_status_created ON jobs(status, created_at)`,
+		`CREATE TABLE IF NOT EXISTS pending_bulk_results (
+			job_id      TEXT NOT NULL,
+			row         INTEGER NOT NULL,
+			question_id TEXT NOT NULL DEFAULT '',
+			status      TEXT NOT NULL,
+			error       TEXT DEFAULT '',
+			PRIMARY KEY (job_id, row)
+		)`,
+		`CREATE TABLE IF NOT EXISTS replay_samples (
+			id         TEXT PRIMARY KEY,
+			name       TEXT NOT NULL,
+			product_id TEXT NOT NULL DEFAULT '',
+			size       INTEGER NOT NULL,
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS replay_sample_queries (
+			sample_id  TEXT NOT NULL,
+			position   INTEGER NOT NULL,
+			query_id   TEXT NOT NULL,
+			product_id TEXT NOT NULL DEFAULT '',
+			question   TEXT NOT NULL,
+			answer     TEXT NOT NULL DEFAULT '',
+			sources    TEXT NOT NULL DEFAULT '',
+			is_pending INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (sample_id, position)
+		)`,
+		`CREATE TABLE IF NOT EXISTS replay_runs (
+			id         TEXT PRIMARY KEY,
+			sample_id  TEXT NOT NULL,
+			settings   TEXT NOT NULL DEFAULT '',
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_replay_runs_sample ON replay_runs(sample_id)`,
+		`CREATE TABLE IF NOT EXISTS replay_results (
+			run_id     TEXT NOT NULL,
+			position   INTEGER NOT NULL,
+			answer     TEXT NOT NULL DEFAULT '',
+			sources    TEXT NOT NULL DEFAULT '',
+			is_pending INTEGER NOT NULL DEFAULT 0,
+			error      TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (run_id, position)
+		)`,
+		`CREATE TABLE IF NOT EXISTS model_usage (
+			month      TEXT NOT NULL,
+			product_id TEXT NOT NULL DEFAULT '',
+			kind       TEXT NOT NULL,
+			calls      INTEGER NOT NULL DEFAULT 0,
+			tokens     INTEGER NOT NULL DEFAULT 0,
+			cost       REAL NOT NULL DEFAULT 0,
+			PRIMARY KEY (month, product_id, kind)
+		)`,
+		`CREATE TABLE IF NOT EXISTS budget_alerts (
+			month        TEXT NOT NULL,
+			product_id   TEXT NOT NULL DEFAULT '',
+			percent      INTEGER NOT NULL,
+			spent        REAL NOT NULL,
+			budget_limit REAL NOT NULL,
+			created_at   DATETIME NOT NULL,
+			PRIMARY KEY (month, product_id, percent)
+		)`,
+		`CREATE TABLE IF NOT EXISTS document_versions (
+			document_id TEXT NOT NULL,
+			version     INTEGER NOT NULL,
+			name        TEXT NOT NULL,
+			type        TEXT NOT NULL,
+			file_size   INTEGER NOT NULL DEFAULT 0,
+			status      TEXT NOT NULL,
+			error       TEXT NOT NULL DEFAULT '',
+			staged_id   TEXT NOT NULL DEFAULT '',
+			note        TEXT NOT NULL DEFAULT '',
+			created_by  TEXT NOT NULL DEFAULT '',
+			created_at  DATETIME NOT NULL,
+			PRIMARY KEY (document_id, version)
+		)`,
+		`CREATE TABLE IF NOT EXISTS announcements (
+			id              TEXT PRIMARY KEY,
+			product_id      TEXT NOT NULL DEFAULT '',
+			title           TEXT NOT NULL,
+			content         TEXT NOT NULL,
+			version         TEXT NOT NULL DEFAULT '',
+			effective_from  TEXT NOT NULL DEFAULT '',
+			effective_until TEXT NOT NULL DEFAULT '',
+			document_id     TEXT NOT NULL DEFAULT '',
+			created_by      TEXT NOT NULL DEFAULT '',
+			created_at      DATETIME NOT NULL,
+			updated_at      DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_announcements_product ON announcements(product_id)`,
+		`CREATE TABLE IF NOT EXISTS answer_templates (
+			id         TEXT PRIMARY KEY,
+			product_id TEXT NOT NULL DEFAULT '',
+			name       TEXT NOT NULL,
+			content    TEXT NOT NULL,
+			variables  TEXT NOT NULL DEFAULT '{}',
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_answer_templates_product ON answer_templates(product_id)`,
+		`CREATE TABLE IF NOT EXISTS export_runs (
+			id           INTEGER PRIMARY KEY AUTOINCREMENT,
+			trigger_type TEXT NOT NULL,
+			started_at   DATETIME NOT NULL,
+			period_from  DATETIME,
+			period_to    DATETIME NOT NULL,
+			queries      INTEGER NOT NULL DEFAULT 0,
+			feedback     INTEGER NOT NULL DEFAULT 0,
+			usage_rows   INTEGER NOT NULL DEFAULT 0,
+			files        TEXT DEFAULT '',
+			duration_ms  INTEGER NOT NULL DEFAULT 0,
+			error        TEXT DEFAULT ''
+		)`,
+		`CREATE TABLE IF NOT EXISTS backup_runs (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			mode           TEXT NOT NULL,
+			target         TEXT NOT NULL,
+			created_by     TEXT DEFAULT '',
+			started_at     DATETIME NOT NULL,
+			duration_ms    INTEGER NOT NULL DEFAULT 0,
+			archive_path   TEXT DEFAULT '',
+			manifest_path  TEXT DEFAULT '',
+			remote_archive TEXT DEFAULT '',
+			size_bytes     INTEGER NOT NULL DEFAULT 0,
+			files          INTEGER NOT NULL DEFAULT 0,
+			db_rows        INTEGER NOT NULL DEFAULT 0,
+			error          TEXT DEFAULT ''
+		)`,
+		`CREATE TABLE IF NOT EXISTS correction_suggestions (
+			id           TEXT PRIMARY KEY,
+			query_id     TEXT NOT NULL,
+			user_id      TEXT NOT NULL,
+			product_id   TEXT NOT NULL DEFAULT '',
+			sentence     TEXT NOT NULL,
+			suggestion   TEXT NOT NULL DEFAULT '',
+			document_id  TEXT NOT NULL DEFAULT '',
+			chunk_index  INTEGER NOT NULL DEFAULT 0,
+			status       TEXT NOT NULL,
+			applied_as   TEXT NOT NULL DEFAULT '',
+			knowledge_id TEXT NOT NULL DEFAULT '',
+			note         TEXT NOT NULL DEFAULT '',
+			resolved_by  TEXT NOT NULL DEFAULT '',
+			resolved_at  DATETIME,
+			created_at   DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_correction_suggestions_status ON correction_suggestions(status, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_correction_suggestions_user ON correction_suggestions(user_id, status)`,
+		// Audit records are immutable; only retention may delete them
+		`CREATE TRIGGER IF NOT EXISTS answer_audits_immutable BEFORE UPDATE ON answer_audits
+		BEGIN
+			SELECT RAISE(ABORT, 'answer audits are immutable');
+		END`,
 	}
 
 	tx, err := db.Begin()
@@ -330,6 +791,20 @@ func migrateProductTables(db *sql.DB) error {
 		{"products", "welcome_message", "ALTER TABLE products ADD COLUMN welcome_message TEXT DEFAULT ''"},
 		{"products", "type", "ALTER TABLE products ADD COLUMN type TEXT DEFAULT 'service'"},
 		{"products", "allow_download", "ALTER TABLE products ADD COLUMN allow_download INTEGER DEFAULT 0"},
+		{"products", "explain_sources", "ALTER TABLE products ADD COLUMN explain_sources INTEGER DEFAULT 0"},
+		{"products", "allow_share", "ALTER TABLE products ADD COLUMN allow_share INTEGER DEFAULT 0"},
+		{"products", "ocr_language", "ALTER TABLE products ADD COLUMN ocr_language TEXT DEFAULT ''"},
+		{"products", "keyframe_overrides", "ALTER TABLE products ADD COLUMN keyframe_overrides TEXT DEFAULT ''"},
+		{"products", "intent_settings", "ALTER TABLE products ADD COLUMN intent_settings TEXT DEFAULT ''"},
+		{"products", "disclaimer", "ALTER TABLE products ADD COLUMN disclaimer TEXT DEFAULT ''"},
+		{"products", "isolated_storage", "ALTER TABLE products ADD COLUMN isolated_storage INTEGER DEFAULT 0"},
+		{"products", "ticket_url_template", "ALTER TABLE products ADD COLUMN ticket_url_template TEXT DEFAULT ''"},
+		{"products", "external_id", "ALTER TABLE products ADD COLUMN external_id TEXT DEFAULT ''"},
+		{"products", "archived_at", "ALTER TABLE products ADD COLUMN archived_at DATETIME"},
+		{"query_logs", "answer", "ALTER TABLE query_logs ADD COLUMN answer TEXT DEFAULT ''"},
+		{"query_logs", "sources", "ALTER TABLE query_logs ADD COLUMN sources TEXT DEFAULT ''"},
+		{"query_logs", "feedback_comment", "ALTER TABLE query_logs ADD COLUMN feedback_comment TEXT DEFAULT ''"},
+		{"query_logs", "rated_at", "ALTER TABLE query_logs ADD COLUMN rated_at DATETIME"},
 	}
 
 	for _, m := range migrations {
@@ -375,14 +850,37 @@ func createIndexes(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_email_tokens_token ON email_tokens(token)`,
 		`CREATE INDEX IF NOT EXISTS idx_documents_product_id ON documents(product_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_review_status ON documents(review_status)`,
+		`CREATE INDEX IF NOT EXISTS idx_document_tags_tag ON document_tags(kind, tag)`,
 		`CREATE INDEX IF NOT EXISTS idx_chunks_product_id ON chunks(product_id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_products_external_id ON products(external_id) WHERE external_id != ''`,
+		`CREATE INDEX IF NOT EXISTS idx_chunks_embedding_model ON chunks(embedding_model)`,
 		`CREATE INDEX IF NOT EXISTS idx_video_segments_chunk_id ON video_segments(chunk_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_video_segments_document_id ON video_segments(document_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_video_chapters_document_id ON video_chapters(document_id, chapter_index)`,
+		`CREATE INDEX IF NOT EXISTS idx_chunk_translations_source ON chunk_translations(document_id, source_index)`,
+		`CREATE INDEX IF NOT EXISTS idx_image_refs_document ON image_refs(document_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_pending_questions_status ON pending_questions(status)`,
 		`CREATE INDEX IF NOT EXISTS idx_pending_questions_product_id ON pending_questions(product_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_pending_questions_external_ref ON pending_questions(external_ref)`,
 		`CREATE INDEX IF NOT EXISTS idx_sn_users_email ON sn_users(email)`,
 		`CREATE INDEX IF NOT EXISTS idx_login_tickets_user_id ON login_tickets(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_operation_tokens_user_id ON operation_tokens(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_operation_tokens_expires_at ON operation_tokens(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_query_logs_product_created ON query_logs(product_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_query_logs_user_id ON query_logs(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_history_user_product_created ON chat_history(user_id, product_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_history_user_created ON chat_history(user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_answer_audits_query_id ON answer_audits(query_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_answer_audits_user_created ON answer_audits(user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_answer_audits_created ON answer_audits(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_feeds_product_id ON feeds(product_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_live_sources_product_id ON live_sources(product_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_git_sources_product_id ON git_sources(product_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_glossary_terms_product_id ON glossary_terms(product_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_troubleshooting_flows_product_id ON troubleshooting_flows(product_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_shared_answers_expires_at ON shared_answers(expires_at)`,
 
 		// Composite indexes for login_attempts covering CheckAllowed correlated subqueries
 		`CREATE INDEX IF NOT EXISTS idx_login_attempts_username_success ON login_attempts(username, success, created_at)`,
@@ -417,9 +915,43 @@ func migrateTables(db *sql.DB) error {
 		{"documents", "content_hash", "ALTER TABLE documents ADD COLUMN content_hash TEXT DEFAULT ''"},
 		{"pending_questions", "image_data", "ALTER TABLE pending_questions ADD COLUMN image_data TEXT DEFAULT ''"},
 		{"documents", "product_id", "ALTER TABLE documents ADD COLUMN product_id TEXT DEFAULT ''"},
+		{"documents", "file_size", "ALTER TABLE documents ADD COLUMN file_size INTEGER DEFAULT 0"},
+		{"documents", "processed_at", "ALTER TABLE documents ADD COLUMN processed_at DATETIME"},
 		{"chunks", "product_id", "ALTER TABLE chunks ADD COLUMN product_id TEXT DEFAULT ''"},
 		{"pending_questions", "product_id", "ALTER TABLE pending_questions ADD COLUMN product_id TEXT DEFAULT ''"},
 		{"admin_users", "permissions", "ALTER TABLE admin_users ADD COLUMN permissions TEXT DEFAULT ''"},
+		{"chunks", "embedding_model", "ALTER TABLE chunks ADD COLUMN embedding_model TEXT DEFAULT ''"},
+		{"chunks", "embedding_dim", "ALTER TABLE chunks ADD COLUMN embedding_dim INTEGER DEFAULT 0"},
+		{"documents", "effective_from", "ALTER TABLE documents ADD COLUMN effective_from TEXT DEFAULT ''"},
+		{"documents", "effective_until", "ALTER TABLE documents ADD COLUMN effective_until TEXT DEFAULT ''"},
+		{"query_logs", "faithfulness", "ALTER TABLE query_logs ADD COLUMN faithfulness REAL"},
+		{"glossary_terms", "do_not_translate", "ALTER TABLE glossary_terms ADD COLUMN do_not_translate INTEGER DEFAULT 0"},
+		{"documents", "review_status", "ALTER TABLE documents ADD COLUMN review_status TEXT DEFAULT ''"},
+		{"documents", "review_author", "ALTER TABLE documents ADD COLUMN review_author TEXT DEFAULT ''"},
+		{"documents", "reviewer_id", "ALTER TABLE documents ADD COLUMN reviewer_id TEXT DEFAULT ''"},
+		{"documents", "review_note", "ALTER TABLE documents ADD COLUMN review_note TEXT DEFAULT ''"},
+		{"documents", "reviewed_by", "ALTER TABLE documents ADD COLUMN reviewed_by TEXT DEFAULT ''"},
+		{"documents", "reviewed_at", "ALTER TABLE documents ADD COLUMN reviewed_at DATETIME"},
+		{"documents", "source_url", "ALTER TABLE documents ADD COLUMN source_url TEXT DEFAULT ''"},
+		{"chunk_locations", "anchor", "ALTER TABLE chunk_locations ADD COLUMN anchor TEXT DEFAULT ''"},
+		{"documents", "category", "ALTER TABLE documents ADD COLUMN category TEXT DEFAULT ''"},
+		{"pending_questions", "external_ref", "ALTER TABLE pending_questions ADD COLUMN external_ref TEXT DEFAULT ''"},
+		{"pending_questions", "external_ref_at", "ALTER TABLE pending_questions ADD COLUMN external_ref_at DATETIME"},
+		{"users", "password_changed_at", "ALTER TABLE users ADD COLUMN password_changed_at DATETIME"},
+		{"admin_users", "password_changed_at", "ALTER TABLE admin_users ADD COLUMN password_changed_at DATETIME"},
+		{"sessions", "last_activity", "ALTER TABLE sessions ADD COLUMN last_activity DATETIME"},
+		{"documents", "video_urls", "ALTER TABLE documents ADD COLUMN video_urls TEXT DEFAULT ''"},
+		{"pending_questions", "origin", "ALTER TABLE pending_questions ADD COLUMN origin TEXT DEFAULT ''"},
+		{"pending_questions", "context", "ALTER TABLE pending_questions ADD COLUMN context TEXT DEFAULT ''"},
+		{"pending_questions", "missing_summary", "ALTER TABLE pending_questions ADD COLUMN missing_summary TEXT DEFAULT ''"},
+		{"documents", "publish_at", "ALTER TABLE documents ADD COLUMN publish_at TEXT DEFAULT ''"},
+		{"documents", "unpublish_at", "ALTER TABLE documents ADD COLUMN unpublish_at TEXT DEFAULT ''"},
+		{"documents", "scheduled_by", "ALTER TABLE documents ADD COLUMN scheduled_by TEXT DEFAULT ''"},
+		{"documents", "schedule_state", "ALTER TABLE documents ADD COLUMN schedule_state TEXT DEFAULT ''"},
+		{"chunk_locations", "code_langs", "ALTER TABLE chunk_locations ADD COLUMN code_langs TEXT DEFAULT ''"},
+		{"chunk_locations", "open_code", "ALTER TABLE chunk_locations ADD COLUMN open_code TEXT DEFAULT ''"},
+		{"documents", "language", "ALTER TABLE documents ADD COLUMN language TEXT DEFAULT ''"},
+		{"operation_tokens", "used_at", "ALTER TABLE operation_tokens ADD COLUMN used_at DATETIME"},
 	}
 
 	for _, m := range migrations {
@@ -441,7 +973,9 @@ func columnExists(db *sql.DB, table, column string) bool {
 		"pending_questions": true, "sessions": true,
 		"email_tokens": true, "admin_users": true,
 		"products": true, "admin_user_products": true,
-		"video_segments": true,
+		"video_segments": true, "query_logs": true,
+		"glossary_terms": true, "chunk_locations": true,
+		"operation_tokens": true,
 	}
 	if !validTables[table] {
 		return false
@@ -0,0 +1,307 @@
+// Package document — Q&A extraction from recorded support calls.
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"askflow/internal/datadir"
+	"askflow/internal/errlog"
+	"askflow/internal/idgen"
+	"askflow/internal/video"
+)
+
+// CallAuthorPrefix prefixes the review author of knowledge entries drafted
+// from a call recording; the rest is the recording's document ID.
+const CallAuthorPrefix = "call:"
+
+const (
+	// callWindowRunes bounds the transcript text sent to the LLM per request;
+	// longer calls are split at line boundaries.
+	callWindowRunes = 12000
+	// callMaxCandidates caps the Q&A pairs drafted from one recording.
+	callMaxCandidates = 30
+	// callMaxTurns caps the diarized turns transcribed one by one; calls
+	// with more turns fall back to a single transcript.
+	callMaxTurns = 400
+)
+
+// audioFileTypes are the audio formats accepted for call recordings.
+var audioFileTypes = map[string]bool{
+	"mp3": true, "wav": true, "m4a": true,
+}
+
+// IsCallRecordingType reports whether files of fileType can be imported as
+// call recordings: audio files and videos.
+func IsCallRecordingType(fileType string) bool {
+	return audioFileTypes[fileType] || videoFileTypes[fileType]
+}
+
+// CallQA is a customer question and the agent's answer extracted from a call.
+type CallQA struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// SetCallQAHandler registers fn to receive the Q&A pairs extracted from a
+// call recording, e.g. to store them as draft knowledge entries. fn returns
+// how many pairs it kept.
+func (dm *DocumentManager) SetCallQAHandler(fn func(docID, docName, productID string, pairs []CallQA) int) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.onCallQA = fn
+}
+
+// processCallRecording transcribes a support call — per speaker when a
+// diarization command is configured — stores the transcript as the
+// document's review segments and hands the customer questions and agent
+// answers the LLM finds in it to the Q&A handler. The call itself is not
+// indexed for search; only reviewed entries drafted from it are.
+func (dm *DocumentManager) processCallRecording(ctx context.Context, docID, docName string, fileData []byte, productID string) error {
+	dm.mu.RLock()
+	cfg := dm.videoConfig
+	hasLLM := dm.llmService != nil
+	dm.mu.RUnlock()
+	if cfg.FFmpegPath == "" || cfg.RapidSpeechPath == "" || cfg.RapidSpeechModel == "" {
+		return fmt.Errorf("通话录音需要配置 ffmpeg 和 RapidSpeech 语音识别")
+	}
+	if !hasLLM {
+		return fmt.Errorf("通话录音问答提取需要配置大模型")
+	}
+
+	uploadDir := datadir.Path("uploads", docID)
+	mediaPath := dm.findSavedFile(uploadDir)
+	if mediaPath == "" {
+		if err := dm.saveOriginalFile(docID, docName, fileData); err != nil {
+			return fmt.Errorf("保存录音文件失败: %w", err)
+		}
+		mediaPath = dm.findSavedFile(uploadDir)
+	}
+
+	tempDir, err := os.MkdirTemp("", "call-*")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	vp := video.NewParser(cfg)
+	audioPath := filepath.Join(tempDir, "audio.wav")
+	if err := vp.ExtractAudio(mediaPath, audioPath); err != nil {
+		return err
+	}
+	segments, err := dm.transcribeCall(ctx, docID, vp, cfg.DiarizationCommand, audioPath, tempDir)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return fmt.Errorf("录音中未识别到语音内容")
+	}
+	if err := dm.storeCallSegments(docID, segments); err != nil {
+		return err
+	}
+
+	pairs, err := dm.extractCallQA(ctx, docID, segments)
+	if err != nil {
+		return err
+	}
+	dm.mu.RLock()
+	onCallQA := dm.onCallQA
+	dm.mu.RUnlock()
+	kept := 0
+	if onCallQA != nil && len(pairs) > 0 {
+		kept = onCallQA(docID, docName, productID, pairs)
+	}
+	log.Printf("[Call] doc=%s: %d 段发言, 提取 %d 条问答, 生成 %d 条候选", docID, len(segments), len(pairs), kept)
+	return nil
+}
+
+// transcribeCall returns the call's transcript. With a diarization command
+// each speaker turn is transcribed separately and its text prefixed with the
+// speaker, numbered in order of first appearance ("说话人1", "说话人2", …).
+// Without one, or when diarization fails, the call is transcribed as a whole.
+func (dm *DocumentManager) transcribeCall(ctx context.Context, docID string, vp *video.Parser, diarize, audioPath, tempDir string) ([]video.TranscriptSegment, error) {
+	var turns []video.SpeakerTurn
+	if diarize != "" {
+		var err error
+		turns, err = video.Diarize(ctx, diarize, audioPath)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("[Call] diarization failed for doc=%s, transcribing without speakers: %v", docID, err)
+			errlog.Logf("[Call] diarization failed doc=%s: %v", docID, err)
+		}
+		if len(turns) > callMaxTurns {
+			log.Printf("[Call] doc=%s has %d speaker turns, transcribing without speakers", docID, len(turns))
+			turns = nil
+		}
+	}
+
+	if len(turns) == 0 {
+		segments, err := vp.Transcribe(audioPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(segments) > 0 && segments[0].End == 0 {
+			segments[0].End = vp.ProbeDuration(audioPath)
+		}
+		return segments, nil
+	}
+
+	labels := make(map[string]string)
+	var segments []video.TranscriptSegment
+	for i, turn := range turns {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		dm.reportProgress(docID, i, len(turns), "分段转写")
+		clipPath := filepath.Join(tempDir, "turn.wav")
+		if err := vp.ExtractClip(audioPath, turn.Start, turn.End, clipPath); err != nil {
+			return nil, err
+		}
+		parts, err := vp.Transcribe(clipPath)
+		if err != nil {
+			return nil, err
+		}
+		var texts []string
+		for _, p := range parts {
+			if t := strings.TrimSpace(p.Text); t != "" {
+				texts = append(texts, t)
+			}
+		}
+		if len(texts) == 0 {
+			continue
+		}
+		label, ok := labels[turn.Speaker]
+		if !ok {
+			label = fmt.Sprintf("说话人%d", len(labels)+1)
+			labels[turn.Speaker] = label
+		}
+		segments = append(segments, video.TranscriptSegment{
+			Start: turn.Start,
+			End:   turn.End,
+			Text:  label + "：" + strings.Join(texts, " "),
+		})
+	}
+	return segments, nil
+}
+
+// storeCallSegments records the call transcript as the document's transcript
+// segments so it can be read in the document review dialog.
+func (dm *DocumentManager) storeCallSegments(docID string, segments []video.TranscriptSegment) error {
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM video_segments WHERE document_id = ?`, docID); err != nil {
+		return fmt.Errorf("failed to clear call segments: %w", err)
+	}
+	for _, seg := range segments {
+		segID, err := idgen.New()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO video_segments (id, document_id, segment_type, start_time, end_time, content, chunk_id) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			segID, docID, "transcript", seg.Start, seg.End, seg.Text, "",
+		); err != nil {
+			return fmt.Errorf("failed to insert call segment: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// extractCallQA asks the LLM for the customer questions answered by the agent
+// in a call transcript. Long calls are sent in windows of callWindowRunes;
+// repeated questions are kept once and at most callMaxCandidates are returned.
+func (dm *DocumentManager) extractCallQA(ctx context.Context, docID string, segments []video.TranscriptSegment) ([]CallQA, error) {
+	dm.mu.RLock()
+	ls := dm.llmService
+	dm.mu.RUnlock()
+	if ls == nil {
+		return nil, nil
+	}
+
+	prompt := "你是一个客服知识库编辑助手。下面是一段客服通话录音的语音转写文本，" +
+		"如果已区分说话人，每行以说话人开头，需要你根据内容判断哪一方是客户、哪一方是客服。\n" +
+		"请找出客户提出、且客服给出了明确解答的问题，整理为可以复用的知识库问答：\n" +
+		"- 问题改写为完整、通用的问法，答案整理为条理清晰的书面表述；\n" +
+		"- 去掉寒暄、身份核实等内容，以及客户姓名、电话、地址、订单号等个人信息；\n" +
+		"- 忽略客服没有解答或只是承诺稍后回复的问题；\n" +
+		"- 问题和答案使用与转写文本相同的语言。\n" +
+		"只输出 JSON 数组，不要输出任何其他内容，格式为：\n" +
+		`[{"question": "问题", "answer": "答案"}]` + "\n" +
+		"没有符合要求的问答时输出 []。"
+
+	windows := callTranscriptWindows(segments, callWindowRunes)
+	seen := make(map[string]bool)
+	var pairs []CallQA
+	for i, window := range windows {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		dm.reportProgress(docID, i, len(windows), "提取问答")
+		text, err := ls.Generate(prompt, nil, window)
+		if err != nil {
+			return nil, fmt.Errorf("问答提取失败: %w", err)
+		}
+		var raw []CallQA
+		if err := json.Unmarshal([]byte(extractJSONArray(text)), &raw); err != nil {
+			errlog.Logf("[Call] Q&A JSON parse failed doc=%s window=%d: %v", docID, i, err)
+			return nil, fmt.Errorf("问答提取结果解析失败: %w", err)
+		}
+		for _, qa := range raw {
+			q := strings.TrimSpace(qa.Question)
+			a := strings.TrimSpace(qa.Answer)
+			key := strings.ToLower(q)
+			if q == "" || a == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			pairs = append(pairs, CallQA{Question: q, Answer: a})
+			if len(pairs) == callMaxCandidates {
+				return pairs, nil
+			}
+		}
+	}
+	return pairs, nil
+}
+
+// callTranscriptWindows joins transcript segments into lines and groups them
+// into texts of at most maxRunes; a single longer line is split on its own.
+func callTranscriptWindows(segments []video.TranscriptSegment, maxRunes int) []string {
+	var windows []string
+	var sb strings.Builder
+	size := 0
+	flush := func() {
+		if size > 0 {
+			windows = append(windows, sb.String())
+			sb.Reset()
+			size = 0
+		}
+	}
+	for _, seg := range segments {
+		line := []rune(strings.TrimSpace(seg.Text))
+		for len(line) > 0 {
+			if size > 0 && size+len(line) > maxRunes {
+				flush()
+			}
+			n := len(line)
+			if n > maxRunes {
+				n = maxRunes
+			}
+			sb.WriteString(string(line[:n]))
+			sb.WriteString("\n")
+			size += n + 1
+			line = line[n:]
+		}
+	}
+	flush()
+	return windows
+}
@@ -0,0 +1,188 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+
+	"askflow/internal/errlog"
+	"askflow/internal/vectorstore"
+)
+
+// maxChunkEditRunes caps the text of a manually edited chunk.
+const maxChunkEditRunes = 20000
+
+// StoredChunk is a chunk as shown in the admin chunk browser.
+type StoredChunk struct {
+	Index    int    `json:"index"`
+	Text     string `json:"text"`
+	ImageURL string `json:"image_url,omitempty"`
+	// SourceIndex is set on translated chunks: the chunk they translate.
+	SourceIndex *int `json:"source_index,omitempty"`
+	// Editable is false for image and keyframe chunks, whose vectors are
+	// image embeddings that a text edit cannot update.
+	Editable bool `json:"editable"`
+}
+
+// ListChunks returns all stored chunks of a document in index order.
+func (dm *DocumentManager) ListChunks(docID string) ([]StoredChunk, error) {
+	info, err := dm.GetDocumentInfo(docID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := dm.chunkDB(info.ProductID).Query(
+		`SELECT chunk_index, chunk_text, COALESCE(image_url, '') FROM chunks WHERE document_id = ? ORDER BY chunk_index`, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunks: %w", err)
+	}
+	defer rows.Close()
+	chunks := []StoredChunk{}
+	for rows.Next() {
+		var c StoredChunk
+		if err := rows.Scan(&c.Index, &c.Text, &c.ImageURL); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		c.Editable = c.ImageURL == ""
+		chunks = append(chunks, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate chunks: %w", err)
+	}
+
+	sources := make(map[int]int)
+	trows, err := dm.db.Query(`SELECT chunk_index, source_index FROM chunk_translations WHERE document_id = ?`, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunk translations: %w", err)
+	}
+	defer trows.Close()
+	for trows.Next() {
+		var idx, src int
+		if err := trows.Scan(&idx, &src); err == nil {
+			sources[idx] = src
+		}
+	}
+	for i := range chunks {
+		if src, ok := sources[chunks[i].Index]; ok {
+			chunks[i].SourceIndex = &src
+		}
+	}
+	return chunks, nil
+}
+
+// loadEditableChunks loads the chunks of a document for a manual edit,
+// rejecting documents that are still being processed.
+func (dm *DocumentManager) loadEditableChunks(docID string) ([]vectorstore.VectorChunk, error) {
+	info, err := dm.GetDocumentInfo(docID)
+	if err != nil {
+		return nil, err
+	}
+	if info.Status != "success" {
+		return nil, fmt.Errorf("文档尚未处理完成，不能编辑分块")
+	}
+	return dm.loadChunks(docID, info.ProductID)
+}
+
+// UpdateChunk replaces the text of a text chunk, for instance to fix bad OCR
+// output, and re-embeds it. Other chunks keep their vectors and indices.
+func (dm *DocumentManager) UpdateChunk(docID string, chunkIndex int, text string) (*StoredChunk, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("分块内容不能为空")
+	}
+	if len([]rune(text)) > maxChunkEditRunes {
+		return nil, fmt.Errorf("分块内容不能超过 %d 个字符", maxChunkEditRunes)
+	}
+	chunks, err := dm.loadEditableChunks(docID)
+	if err != nil {
+		return nil, err
+	}
+	pos := findChunk(chunks, chunkIndex)
+	if pos < 0 {
+		return nil, ErrChunkNotFound
+	}
+	if chunks[pos].ImageURL != "" {
+		return nil, fmt.Errorf("图片分块的向量来自图片，不能编辑文本")
+	}
+	if chunks[pos].ChunkText == text {
+		return &StoredChunk{Index: chunkIndex, Text: text, Editable: true}, nil
+	}
+
+	dm.mu.RLock()
+	es := dm.embeddingService
+	dm.mu.RUnlock()
+	vector, err := es.Embed(text)
+	if err != nil {
+		return nil, fmt.Errorf("embedding error: %w", err)
+	}
+	original := make([]vectorstore.VectorChunk, len(chunks))
+	copy(original, chunks)
+	chunks[pos].ChunkText = text
+	chunks[pos].Vector = vector
+	chunks[pos].EmbeddingModel = ""
+	if err := dm.replaceChunks(docID, chunks, original); err != nil {
+		return nil, err
+	}
+	return &StoredChunk{Index: chunkIndex, Text: text, Editable: true}, nil
+}
+
+// DeleteChunk removes a chunk, such as repeated boilerplate that pollutes
+// retrieval, with its location, citation stats and video segment. The
+// remaining chunks keep their indices so existing citations still resolve.
+func (dm *DocumentManager) DeleteChunk(docID string, chunkIndex int) error {
+	chunks, err := dm.loadEditableChunks(docID)
+	if err != nil {
+		return err
+	}
+	pos := findChunk(chunks, chunkIndex)
+	if pos < 0 {
+		return ErrChunkNotFound
+	}
+	if len(chunks) == 1 {
+		return fmt.Errorf("不能删除文档的最后一个分块，请直接删除文档")
+	}
+	remaining := make([]vectorstore.VectorChunk, 0, len(chunks)-1)
+	remaining = append(remaining, chunks[:pos]...)
+	remaining = append(remaining, chunks[pos+1:]...)
+	if err := dm.replaceChunks(docID, remaining, chunks); err != nil {
+		return err
+	}
+
+	for _, stmt := range []struct {
+		query string
+		arg   interface{}
+	}{
+		{`DELETE FROM chunk_locations WHERE document_id = ? AND chunk_index = ?`, chunkIndex},
+		{`DELETE FROM chunk_translations WHERE document_id = ? AND chunk_index = ?`, chunkIndex},
+		{`DELETE FROM citation_stats WHERE document_id = ? AND chunk_index = ?`, chunkIndex},
+		{`DELETE FROM video_segments WHERE document_id = ? AND chunk_id = ?`, fmt.Sprintf("%s-%d", docID, chunkIndex)},
+	} {
+		if _, err := dm.db.Exec(stmt.query, docID, stmt.arg); err != nil {
+			errlog.Logf("[Chunks] cleanup after deleting chunk %d of doc=%s failed: %v", chunkIndex, docID, err)
+		}
+	}
+	return nil
+}
+
+func findChunk(chunks []vectorstore.VectorChunk, chunkIndex int) int {
+	for i, c := range chunks {
+		if c.ChunkIndex == chunkIndex {
+			return i
+		}
+	}
+	return -1
+}
+
+// replaceChunks stores chunks in place of all chunks of a document, putting
+// original back if the store fails.
+func (dm *DocumentManager) replaceChunks(docID string, chunks, original []vectorstore.VectorChunk) error {
+	if err := dm.vectorStore.DeleteByDocID(docID); err != nil {
+		return fmt.Errorf("failed to delete chunks: %w", err)
+	}
+	if err := dm.vectorStore.Store(docID, chunks); err != nil {
+		errlog.Logf("[Chunks] store edited chunks failed doc=%s: %v", docID, err)
+		if restoreErr := dm.vectorStore.Store(docID, original); restoreErr != nil {
+			errlog.Logf("[Chunks] restore original chunks failed doc=%s: %v", docID, restoreErr)
+		}
+		return fmt.Errorf("vector store error: %w", err)
+	}
+	return nil
+}
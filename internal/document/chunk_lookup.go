@@ -0,0 +1,100 @@
+package document
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// PartitionDB returns the storage partition holding the chunks of a product
+// with isolated storage, or nil when they are in the main database.
+func (dm *DocumentManager) PartitionDB(productID string) *sql.DB {
+	return dm.vectorStore.PartitionDB(productID)
+}
+
+// documentProducts returns the product ID of each document matching where
+// (over documents d), keyed by document ID.
+func (dm *DocumentManager) documentProducts(where string, args ...interface{}) (map[string]string, error) {
+	rows, err := dm.db.Query(`SELECT d.id, COALESCE(d.product_id, '') FROM documents d WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer rows.Close()
+	products := make(map[string]string)
+	for rows.Next() {
+		var id, productID string
+		if err := rows.Scan(&id, &productID); err != nil {
+			return nil, err
+		}
+		products[id] = productID
+	}
+	return products, rows.Err()
+}
+
+// queryDocumentChunks runs query on every database holding chunks of the
+// documents in products (document ID to product ID) and calls scan for each
+// row. query must select from chunks and contain one %s, which becomes the
+// placeholders of the document IDs; args follow the IDs.
+func (dm *DocumentManager) queryDocumentChunks(products map[string]string, query string, scan func(*sql.Rows) error, args ...interface{}) error {
+	idsByDB := make(map[*sql.DB][]interface{})
+	for id, productID := range products {
+		db := dm.chunkDB(productID)
+		idsByDB[db] = append(idsByDB[db], id)
+	}
+	for db, ids := range idsByDB {
+		placeholders := "?" + strings.Repeat(", ?", len(ids)-1)
+		rows, err := db.Query(fmt.Sprintf(query, placeholders), append(ids, args...)...)
+		if err != nil {
+			return fmt.Errorf("failed to query chunks: %w", err)
+		}
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// firstTextChunks returns the first text chunk of each document in products
+// (document ID to product ID), keyed by document ID.
+func (dm *DocumentManager) firstTextChunks(products map[string]string) (map[string]string, error) {
+	first := make(map[string]string)
+	// SQLite takes the bare column from the row holding the minimum
+	err := dm.queryDocumentChunks(products, `SELECT document_id, chunk_text, MIN(chunk_index) FROM chunks
+		WHERE document_id IN (%s) AND COALESCE(image_url, '') = '' GROUP BY document_id`,
+		func(rows *sql.Rows) error {
+			var id, text string
+			var index int
+			if err := rows.Scan(&id, &text, &index); err != nil {
+				return err
+			}
+			first[id] = text
+			return nil
+		})
+	return first, err
+}
+
+// matchingTextChunks returns the first text chunk LIKE pattern (escaped
+// with '\') of each document in products that has one, keyed by document ID.
+func (dm *DocumentManager) matchingTextChunks(products map[string]string, pattern string) (map[string]string, error) {
+	matches := make(map[string]string)
+	err := dm.queryDocumentChunks(products, `SELECT document_id, chunk_text, MIN(chunk_index) FROM chunks
+		WHERE document_id IN (%s) AND chunk_index < 1000 AND chunk_text LIKE ? ESCAPE '\' GROUP BY document_id`,
+		func(rows *sql.Rows) error {
+			var id, text string
+			var index int
+			if err := rows.Scan(&id, &text, &index); err != nil {
+				return err
+			}
+			matches[id] = text
+			return nil
+		}, pattern)
+	return matches, err
+}
@@ -0,0 +1,191 @@
+// Package document — ingestion-time machine translation of chunks.
+package document
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"askflow/internal/budget"
+	"askflow/internal/chunker"
+	"askflow/internal/embedding"
+	"askflow/internal/errlog"
+	"askflow/internal/langdetect"
+	"askflow/internal/vectorstore"
+)
+
+// translationChunkIndexBase is the first chunk index used for translated
+// chunks, keeping them clear of text, image (1000+) and keyframe (10000+/20000+)
+// indices of the same document. Translations are stored under the source
+// document so DeleteByDocID removes them together with the originals.
+const translationChunkIndexBase = 100000
+
+// SetTranslateLanguages sets the languages chunks are translated into at
+// ingestion time. An empty list disables translation.
+func (dm *DocumentManager) SetTranslateLanguages(langs []string) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.translateLanguages = append([]string(nil), langs...)
+}
+
+// SetTermRules sets the source of per-product terminology rules appended to
+// chunk translation prompts, so brand terms survive translation.
+func (dm *DocumentManager) SetTermRules(fn func(productID string) string) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.termRules = fn
+}
+
+// translateChunks stores a machine translation of every chunk in each
+// configured target language as a parallel chunk, recording the language and
+// source chunk in chunk_translations. Chunks already written in a target
+// language are not translated into it. A chunk that fails to translate is
+// skipped; the document keeps its original chunks either way.
+func (dm *DocumentManager) translateChunks(docID, docName string, chunks []chunker.Chunk, productID string) error {
+	dm.mu.RLock()
+	langs := dm.translateLanguages
+	ls := dm.llmService
+	es := dm.embeddingService
+	termRules := dm.termRules
+	dm.mu.RUnlock()
+	if len(langs) == 0 || ls == nil || len(chunks) == 0 {
+		return nil
+	}
+	var rules string
+	if termRules != nil {
+		rules = termRules(productID)
+	}
+	// Translation is skipped once the monthly budget cap is reached
+	ls = budget.Optional(budget.ForProduct(ls, productID))
+
+	var translated []translatedChunk
+	var stored, failed int
+	// Translations are embedded and stored in batches as they are made, so
+	// a large document never holds all of them in memory.
+	flush := func() error {
+		if len(translated) == 0 {
+			return nil
+		}
+		if err := dm.storeTranslations(es, docID, docName, productID, translated); err != nil {
+			return err
+		}
+		stored += len(translated)
+		translated = translated[:0]
+		return nil
+	}
+chunkLoop:
+	for _, c := range chunks {
+		srcLang := langdetect.Detect(c.Text)
+		for _, lang := range langs {
+			if lang == srcLang {
+				continue
+			}
+			text, err := dm.translateText(ls, c.Text, lang, rules)
+			if errors.Is(err, budget.ErrLimitReached) {
+				log.Printf("[Translate] doc=%s: %v", docID, err)
+				break chunkLoop
+			}
+			if err != nil {
+				failed++
+				errlog.Logf("[Translate] chunk %d -> %s failed doc=%s: %v", c.Index, lang, docID, err)
+				continue
+			}
+			if text != "" {
+				translated = append(translated, translatedChunk{sourceIndex: c.Index, lang: lang, text: text})
+			}
+			if len(translated) >= embedStoreBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if stored == 0 {
+		if failed > 0 {
+			return fmt.Errorf("全部 %d 个分块翻译失败", failed)
+		}
+		return nil
+	}
+
+	log.Printf("[Translate] doc=%s: 生成 %d 个译文分块 (%s)，%d 个失败", docID, stored, strings.Join(langs, ","), failed)
+	return nil
+}
+
+// translatedChunk is a machine translation of the chunk at sourceIndex.
+type translatedChunk struct {
+	sourceIndex int
+	lang        string
+	text        string
+}
+
+// storeTranslations embeds and stores a batch of translated chunks after the
+// translated chunks already stored for the document.
+func (dm *DocumentManager) storeTranslations(es embedding.EmbeddingService, docID, docName, productID string, translated []translatedChunk) error {
+	texts := make([]string, len(translated))
+	for i, t := range translated {
+		texts[i] = t.text
+	}
+	vectors, err := es.EmbedBatch(texts)
+	if err != nil {
+		return fmt.Errorf("译文向量化失败: %w", err)
+	}
+
+	var next int
+	if err := dm.db.QueryRow(
+		`SELECT COALESCE(MAX(chunk_index) + 1, ?) FROM chunk_translations WHERE document_id = ?`,
+		translationChunkIndexBase, docID,
+	).Scan(&next); err != nil {
+		return fmt.Errorf("查询译文分块序号失败: %w", err)
+	}
+
+	vectorChunks := make([]vectorstore.VectorChunk, len(translated))
+	for i, t := range translated {
+		vectorChunks[i] = vectorstore.VectorChunk{
+			ChunkText:    t.text,
+			ChunkIndex:   next + i,
+			DocumentID:   docID,
+			DocumentName: docName,
+			Vector:       vectors[i],
+			ProductID:    productID,
+		}
+	}
+
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始 chunk_translations 事务失败: %w", err)
+	}
+	defer tx.Rollback()
+	for i, t := range translated {
+		if _, err := tx.Exec(
+			`INSERT INTO chunk_translations (document_id, chunk_index, source_index, language) VALUES (?, ?, ?, ?)`,
+			docID, next+i, t.sourceIndex, t.lang,
+		); err != nil {
+			return fmt.Errorf("插入 chunk_translations 记录失败: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交 chunk_translations 事务失败: %w", err)
+	}
+	if err := dm.StoreChunks(docID, vectorChunks); err != nil {
+		dm.db.Exec(`DELETE FROM chunk_translations WHERE document_id = ? AND chunk_index >= ?`, docID, next)
+		return fmt.Errorf("vector store error: %w", err)
+	}
+	return nil
+}
+
+// translateText asks the LLM for a plain translation of a chunk into lang,
+// following the given terminology rules.
+func (dm *DocumentManager) translateText(ls LLMService, text, lang, rules string) (string, error) {
+	prompt := fmt.Sprintf("你是一个专业的技术文档翻译助手。请将用户提供的文本完整翻译为%s。\n"+
+		"保持原有的段落、列表和表格结构；产品名称、型号、代码、命令、URL 和数字保持不变。\n"+
+		"只输出译文，不要添加任何解释、注释或前后缀。", langdetect.Names[lang]) + rules
+	out, err := ls.Generate(prompt, nil, text)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
@@ -0,0 +1,142 @@
+package document
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"askflow/internal/textutil"
+)
+
+// Document list orders accepted by SortDocuments.
+const (
+	SortNewest     = ""            // newest first (the ListDocuments order)
+	SortCited      = "cited"       // most cited first
+	SortClicked    = "clicked"     // most opened citations first
+	SortLeastCited = "least_cited" // never or rarely cited first, oldest first among equals
+)
+
+// ValidDocumentSort reports whether s is an order accepted by SortDocuments.
+func ValidDocumentSort(s string) bool {
+	switch s {
+	case SortNewest, SortCited, SortClicked, SortLeastCited:
+		return true
+	}
+	return false
+}
+
+// SortDocuments reorders docs by citation usage. Ties keep the newest-first
+// order of ListDocuments, except for SortLeastCited which lists the oldest
+// documents first as the likeliest dead weight.
+func SortDocuments(docs []DocumentInfo, by string) {
+	switch by {
+	case SortCited:
+		sort.SliceStable(docs, func(i, j int) bool {
+			if docs[i].CitedCount != docs[j].CitedCount {
+				return docs[i].CitedCount > docs[j].CitedCount
+			}
+			return docs[i].ClickCount > docs[j].ClickCount
+		})
+	case SortClicked:
+		sort.SliceStable(docs, func(i, j int) bool {
+			if docs[i].ClickCount != docs[j].ClickCount {
+				return docs[i].ClickCount > docs[j].ClickCount
+			}
+			return docs[i].CitedCount > docs[j].CitedCount
+		})
+	case SortLeastCited:
+		sort.SliceStable(docs, func(i, j int) bool {
+			if docs[i].CitedCount != docs[j].CitedCount {
+				return docs[i].CitedCount < docs[j].CitedCount
+			}
+			return docs[i].CreatedAt.Before(docs[j].CreatedAt)
+		})
+	}
+}
+
+// parseCitationTime parses a citation timestamp read as text. MAX() drops the
+// DATETIME column type, so the driver returns the stored string.
+func parseCitationTime(s sql.NullString) (time.Time, bool) {
+	if !s.Valid || s.String == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00"} {
+		if t, err := time.Parse(layout, s.String); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ChunkCitation is the citation usage of one chunk of a document.
+type ChunkCitation struct {
+	ChunkIndex    int        `json:"chunk_index"`
+	Snippet       string     `json:"snippet"`
+	Cited         int        `json:"cited"`
+	Clicked       int        `json:"clicked"`
+	LastCitedAt   *time.Time `json:"last_cited_at,omitempty"`
+	LastClickedAt *time.Time `json:"last_clicked_at,omitempty"`
+}
+
+// ChunkCitations lists the cited chunks of a document, most cited first.
+func (dm *DocumentManager) ChunkCitations(docID string) ([]ChunkCitation, error) {
+	rows, err := dm.db.Query(
+		`SELECT chunk_index, cited, clicked, CAST(last_cited_at AS TEXT), CAST(last_clicked_at AS TEXT)
+		 FROM citation_stats WHERE document_id = ?
+		 ORDER BY cited DESC, clicked DESC, chunk_index`,
+		docID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query citation stats: %w", err)
+	}
+	defer rows.Close()
+	list := []ChunkCitation{}
+	for rows.Next() {
+		var c ChunkCitation
+		var lastCited, lastClicked sql.NullString
+		if err := rows.Scan(&c.ChunkIndex, &c.Cited, &c.Clicked, &lastCited, &lastClicked); err != nil {
+			return nil, fmt.Errorf("failed to scan citation stats: %w", err)
+		}
+		if t, ok := parseCitationTime(lastCited); ok {
+			c.LastCitedAt = &t
+		}
+		if t, ok := parseCitationTime(lastClicked); ok {
+			c.LastClickedAt = &t
+		}
+		list = append(list, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(list) == 0 {
+		return list, nil
+	}
+
+	// The chunks are in the storage partition of an isolated product
+	args := []interface{}{docID}
+	for _, c := range list {
+		args = append(args, c.ChunkIndex)
+	}
+	crows, err := dm.docChunkDB(docID).Query(`SELECT chunk_index, chunk_text FROM chunks
+		WHERE document_id = ? AND chunk_index IN (?`+strings.Repeat(", ?", len(list)-1)+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cited chunks: %w", err)
+	}
+	defer crows.Close()
+	snippets := make(map[int]string)
+	for crows.Next() {
+		var index int
+		var text string
+		if err := crows.Scan(&index, &text); err != nil {
+			return nil, err
+		}
+		snippets[index] = textutil.Ellipsize(text, 120)
+	}
+	for i := range list {
+		list[i].Snippet = snippets[list[i].ChunkIndex]
+	}
+	return list, crows.Err()
+}
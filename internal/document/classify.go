@@ -0,0 +1,91 @@
+// Package document — LLM classification of imported files against products.
+package document
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"askflow/internal/budget"
+	"askflow/internal/textutil"
+)
+
+// classifyExcerptRunes bounds the document text sent to the LLM for product
+// classification; the beginning of a document usually names its subject.
+const classifyExcerptRunes = 2000
+
+// ProductCandidate is a product a document may be assigned to.
+type ProductCandidate struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ProductSuggestion is the proposed product of a file. An empty ProductID
+// means the public library.
+type ProductSuggestion struct {
+	ProductID   string `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Error       string `json:"error,omitempty"` // classification failed; ProductID is the public library
+}
+
+// classifyReplyRe extracts the product number from the classification reply.
+var classifyReplyRe = regexp.MustCompile(`\d+`)
+
+// ClassifyProduct asks the LLM which of the products a file belongs to, from
+// its name and the beginning of its text. Files the LLM cannot place, and
+// files without text such as videos, are proposed for the public library.
+func (dm *DocumentManager) ClassifyProduct(fileName, fileType string, fileData []byte, products []ProductCandidate) (*ProductSuggestion, error) {
+	dm.mu.RLock()
+	ls := dm.llmService
+	dm.mu.RUnlock()
+	if ls == nil {
+		return nil, fmt.Errorf("LLM service not configured")
+	}
+	// Suggestions are skipped once the monthly budget cap is reached
+	ls = budget.Optional(ls)
+	if len(products) == 0 {
+		return &ProductSuggestion{}, nil
+	}
+
+	var excerpt string
+	if !videoFileTypes[strings.ToLower(fileType)] {
+		if result, err := dm.parser.ParseWithPassword(fileData, fileType, ""); err == nil {
+			excerpt = strings.TrimSpace(result.Text)
+			if excerpt == "" {
+				for _, img := range result.Images {
+					if img.SlideText != "" {
+						excerpt += img.SlideText + "\n"
+					}
+				}
+			}
+		}
+	}
+	excerpt = textutil.Truncate(excerpt, classifyExcerptRunes)
+
+	var list strings.Builder
+	list.WriteString("0. 公共库：通用内容，不属于任何特定产品\n")
+	for i, p := range products {
+		fmt.Fprintf(&list, "%d. %s", i+1, p.Name)
+		if p.Description != "" {
+			fmt.Fprintf(&list, "：%s", p.Description)
+		}
+		list.WriteString("\n")
+	}
+	systemPrompt := "你是一个文档归档助手。以下是知识库中的产品：\n" + list.String() +
+		"\n根据文件名和文档开头的内容，判断文档属于哪个产品。只回复最匹配的产品编号；如果文档是通用内容或无法判断，回复0。不要输出其他内容。"
+	question := "文件名：" + fileName
+	if excerpt != "" {
+		question += "\n\n文档开头：\n" + excerpt
+	}
+	reply, err := ls.Generate(systemPrompt, nil, question)
+	if err != nil {
+		return nil, fmt.Errorf("product classification failed: %w", err)
+	}
+	n, err := strconv.Atoi(classifyReplyRe.FindString(reply))
+	if err != nil || n < 1 || n > len(products) {
+		return &ProductSuggestion{}, nil
+	}
+	return &ProductSuggestion{ProductID: products[n-1].ID, ProductName: products[n-1].Name}, nil
+}
@@ -0,0 +1,44 @@
+package document
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MediaCoverage reports which kinds of media answers for a product can draw
+// on: Images is true when a chunk searchable for the product carries an
+// image, Videos when a processed video is among its documents. Public
+// documents (empty product_id) count for every product, as they do in search.
+type MediaCoverage struct {
+	Images bool `json:"images"`
+	Videos bool `json:"videos"`
+}
+
+// MediaCoverage checks the documents searchable for productID. An empty
+// productID checks the public documents only.
+func (dm *DocumentManager) MediaCoverage(productID string) (*MediaCoverage, error) {
+	types := make([]string, 0, len(videoFileTypes))
+	for t := range videoFileTypes {
+		types = append(types, "'"+t+"'")
+	}
+	sort.Strings(types)
+
+	var images, videos int
+	err := dm.db.QueryRow(
+		`SELECT
+			EXISTS(SELECT 1 FROM chunks WHERE image_url != '' AND (product_id = ? OR product_id = '')),
+			EXISTS(SELECT 1 FROM documents WHERE type IN (`+strings.Join(types, ",")+`) AND status = 'success' AND (product_id = ? OR product_id = ''))`,
+		productID, productID,
+	).Scan(&images, &videos)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check media coverage: %w", err)
+	}
+	// An isolated product's own chunks are in its storage partition
+	if pdb := dm.PartitionDB(productID); images == 0 && pdb != nil {
+		if err := pdb.QueryRow(`SELECT EXISTS(SELECT 1 FROM chunks WHERE image_url != '')`).Scan(&images); err != nil {
+			return nil, fmt.Errorf("failed to check media coverage: %w", err)
+		}
+	}
+	return &MediaCoverage{Images: images == 1, Videos: videos == 1}, nil
+}
@@ -0,0 +1,402 @@
+package document
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"askflow/internal/errlog"
+)
+
+// Crawl limits and defaults.
+const (
+	defaultCrawlDepth   = 2
+	maxCrawlDepth       = 5
+	defaultCrawlPages   = 100
+	maxCrawlPages       = 1000
+	defaultCrawlDelayMs = 1000
+	minCrawlDelayMs     = 200
+	maxCrawlDelayMs     = 60000
+	maxCrawlPageBytes   = 10 << 20
+)
+
+// Crawl page outcomes reported in CrawlEvent.Status.
+const (
+	CrawlImported  = "imported"
+	CrawlDuplicate = "duplicate" // same content as an existing document
+	CrawlSkipped   = "skipped"   // not HTML or text, or only visited for its links
+	CrawlFailed    = "failed"
+)
+
+// CrawlRequest describes a whole-site import. Pages are imported like
+// UploadURL does for a single page.
+//
+// Include and Exclude are patterns as in ImportFilter, matched against the
+// URL path without the leading "/" (e.g. "docs/**", "**/*.pdf",
+// "blog/archive/**"). Excluded pages are neither fetched nor followed. When
+// Include is set, only matching pages are imported; the others are still
+// visited to discover links.
+type CrawlRequest struct {
+	URL       string   `json:"url"`
+	ProductID string   `json:"product_id"`
+	MaxDepth  int      `json:"max_depth"` // link hops from the root page; 0 means 2, at most 5
+	MaxPages  int      `json:"max_pages"` // pages fetched; 0 means 100, at most 1000
+	Include   []string `json:"include"`
+	Exclude   []string `json:"exclude"`
+	DelayMs   int      `json:"delay_ms"` // pause between requests; 0 means 1000, at least 200
+}
+
+// CrawlEvent reports one fetched page.
+type CrawlEvent struct {
+	URL        string `json:"url"`
+	Depth      int    `json:"depth"`
+	Status     string `json:"status"`
+	DocumentID string `json:"document_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Fetched    int    `json:"fetched"` // pages fetched so far
+	Queued     int    `json:"queued"`  // pages waiting to be fetched
+}
+
+// CrawlResult summarizes a crawl.
+type CrawlResult struct {
+	Fetched    int  `json:"fetched"`
+	Imported   int  `json:"imported"`
+	Duplicates int  `json:"duplicates"`
+	Skipped    int  `json:"skipped"`
+	Failed     int  `json:"failed"`
+	Excluded   int  `json:"excluded"` // links left out by Exclude or robots.txt
+	Canceled   bool `json:"canceled,omitempty"`
+}
+
+// crawlTarget is a page waiting to be fetched.
+type crawlTarget struct {
+	url   string
+	depth int
+}
+
+var (
+	crawlLinkRe = regexp.MustCompile(`(?is)<a\s[^>]*?href\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	crawlBaseRe = regexp.MustCompile(`(?i)<base[^>]+href\s*=\s*["']([^"']+)["']`)
+	// crawlSkipExt are link targets that are never pages.
+	crawlSkipExt = map[string]bool{
+		".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".svg": true, ".ico": true, ".bmp": true,
+		".css": true, ".js": true, ".json": true, ".xml": true, ".rss": true,
+		".pdf": true, ".doc": true, ".docx": true, ".xls": true, ".xlsx": true, ".ppt": true, ".pptx": true,
+		".zip": true, ".gz": true, ".tar": true, ".rar": true, ".7z": true, ".exe": true, ".dmg": true,
+		".mp3": true, ".mp4": true, ".avi": true, ".mov": true, ".mkv": true, ".webm": true, ".wav": true,
+		".woff": true, ".woff2": true, ".ttf": true,
+	}
+)
+
+// NormalizeCrawlRequest validates a crawl request and fills in defaults.
+func (dm *DocumentManager) NormalizeCrawlRequest(req CrawlRequest) (CrawlRequest, error) {
+	req.URL = strings.TrimSpace(req.URL)
+	if err := dm.validateURL(req.URL); err != nil {
+		return req, err
+	}
+	if req.MaxDepth < 0 || req.MaxDepth > maxCrawlDepth {
+		return req, fmt.Errorf("抓取深度应在 0 到 %d 之间", maxCrawlDepth)
+	}
+	if req.MaxDepth == 0 {
+		req.MaxDepth = defaultCrawlDepth
+	}
+	if req.MaxPages < 0 || req.MaxPages > maxCrawlPages {
+		return req, fmt.Errorf("最大页面数应在 1 到 %d 之间", maxCrawlPages)
+	}
+	if req.MaxPages == 0 {
+		req.MaxPages = defaultCrawlPages
+	}
+	if req.DelayMs == 0 {
+		req.DelayMs = defaultCrawlDelayMs
+	}
+	if req.DelayMs < minCrawlDelayMs || req.DelayMs > maxCrawlDelayMs {
+		return req, fmt.Errorf("请求间隔应在 %d 到 %d 毫秒之间", minCrawlDelayMs, maxCrawlDelayMs)
+	}
+	f, err := ParseImportFilter(req.Include, req.Exclude, "", "")
+	if err != nil {
+		return req, err
+	}
+	req.Include, req.Exclude = f.Include, f.Exclude
+	return req, nil
+}
+
+// Crawl walks the links of a site breadth-first from req.URL, staying on
+// its host, and imports each HTML or text page as a "url" document. Pages
+// whose content matches an existing document are skipped without creating
+// a document. It honors the site's robots.txt and waits req.DelayMs between
+// requests. progress is called after each fetched page. Canceling ctx stops
+// the crawl after the current page.
+func (dm *DocumentManager) Crawl(ctx context.Context, req CrawlRequest, progress func(CrawlEvent)) (*CrawlResult, error) {
+	req, err := dm.NormalizeCrawlRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	root, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, fmt.Errorf("URL格式无效")
+	}
+	root.Fragment = ""
+	filter := ImportFilter{Include: req.Include, Exclude: req.Exclude}
+	delay := time.Duration(req.DelayMs) * time.Millisecond
+	result := &CrawlResult{}
+
+	robots := dm.fetchRobots(root)
+	queue := []crawlTarget{{url: root.String()}}
+	seen := map[string]bool{root.String(): true}
+	for len(queue) > 0 && result.Fetched < req.MaxPages {
+		if result.Fetched > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+		}
+		if ctx.Err() != nil {
+			result.Canceled = true
+			return result, nil
+		}
+		t := queue[0]
+		queue = queue[1:]
+		result.Fetched++
+
+		ev := CrawlEvent{URL: t.url, Depth: t.depth}
+		links, err := dm.crawlPage(t.url, req.ProductID, filter, &ev)
+		if err != nil {
+			ev.Status, ev.Error = CrawlFailed, err.Error()
+			errlog.Logf("[Crawl] page failed url=%q: %v", t.url, err)
+		}
+		switch ev.Status {
+		case CrawlImported:
+			result.Imported++
+		case CrawlDuplicate:
+			result.Duplicates++
+		case CrawlSkipped:
+			result.Skipped++
+		default:
+			result.Failed++
+		}
+
+		if t.depth < req.MaxDepth {
+			for _, link := range links {
+				u, err := url.Parse(link)
+				if err != nil || !sameCrawlSite(root, u) || seen[u.String()] {
+					continue
+				}
+				seen[u.String()] = true
+				rel := strings.Trim(u.Path, "/")
+				if filter.SkipDir(rel) || robots.disallows(u.EscapedPath()) {
+					result.Excluded++
+					continue
+				}
+				queue = append(queue, crawlTarget{url: u.String(), depth: t.depth + 1})
+			}
+		}
+		ev.Fetched, ev.Queued = result.Fetched, len(queue)
+		if progress != nil {
+			progress(ev)
+		}
+	}
+	return result, nil
+}
+
+// crawlPage fetches a page, imports it unless it is filtered out or a
+// duplicate, and returns the absolute links it contains. The outcome is
+// recorded in ev.
+func (dm *DocumentManager) crawlPage(pageURL, productID string, filter ImportFilter, ev *CrawlEvent) ([]string, error) {
+	if err := dm.validateURL(pageURL); err != nil {
+		return nil, err
+	}
+	resp, err := dm.getSourceURL(pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("URL returned HTTP %d", resp.StatusCode)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.HasPrefix(contentType, "text/html") && !strings.HasPrefix(contentType, "text/plain") &&
+		!strings.HasPrefix(contentType, "application/xhtml") {
+		ev.Status = CrawlSkipped
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCrawlPageBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read URL content: %w", err)
+	}
+	// Links resolve against the page reached after redirects
+	final := resp.Request.URL
+	var links []string
+	if strings.Contains(contentType, "html") || looksLikeHTML(strings.TrimSpace(string(body))) {
+		links = extractCrawlLinks(string(body), final)
+	}
+
+	rel := strings.Trim(final.Path, "/")
+	if len(filter.Include) > 0 && !matchesAnyPattern(filter.Include, rel) {
+		ev.Status = CrawlSkipped
+		return links, nil
+	}
+
+	// Skip duplicates before a document record is created
+	hash, existingID, err := dm.WebContentHash(body, contentType, final.String())
+	if err != nil {
+		return links, err
+	}
+	if hash == "" {
+		ev.Status = CrawlSkipped
+		return links, nil
+	}
+	if existingID != "" {
+		ev.Status, ev.DocumentID = CrawlDuplicate, existingID
+		return links, nil
+	}
+
+	doc, err := dm.ImportWebContent(ImportWebContentRequest{
+		Name:        final.String(),
+		Type:        "url",
+		BaseURL:     final.String(),
+		Content:     body,
+		ContentType: contentType,
+		ProductID:   productID,
+	})
+	if err != nil {
+		return links, err
+	}
+	ev.DocumentID = doc.ID
+	if doc.Status != "success" {
+		return links, fmt.Errorf("%s", doc.Error)
+	}
+	ev.Status = CrawlImported
+	return links, nil
+}
+
+// extractCrawlLinks returns the absolute http(s) links of an HTML page
+// without fragments, resolved against its <base href> or URL, leaving out
+// links to images, archives and other non-page files.
+func extractCrawlLinks(page string, pageURL *url.URL) []string {
+	base := pageURL
+	if m := crawlBaseRe.FindStringSubmatch(page); len(m) >= 2 {
+		if u, err := pageURL.Parse(html.UnescapeString(m[1])); err == nil {
+			base = u
+		}
+	}
+	var links []string
+	for _, m := range crawlLinkRe.FindAllStringSubmatch(page, -1) {
+		href := strings.TrimSpace(html.UnescapeString(m[1] + m[2] + m[3]))
+		if href == "" || strings.HasPrefix(href, "#") {
+			continue
+		}
+		u, err := base.Parse(href)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		u.Fragment = ""
+		if crawlSkipExt[strings.ToLower(path.Ext(u.Path))] {
+			continue
+		}
+		links = append(links, u.String())
+	}
+	return links
+}
+
+// sameCrawlSite reports whether u is on the host of the crawl root.
+func sameCrawlSite(root, u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && strings.EqualFold(u.Host, root.Host)
+}
+
+// matchesAnyPattern reports whether rel matches one of the patterns.
+func matchesAnyPattern(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if matchImportPattern(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// robotsRules are the Allow and Disallow path prefixes of the robots.txt
+// group for all user agents.
+type robotsRules struct {
+	allow    []string
+	disallow []string
+}
+
+// disallows reports whether robots.txt forbids a path; the longest matching
+// rule wins, Allow on ties.
+func (r robotsRules) disallows(p string) bool {
+	if p == "" {
+		p = "/"
+	}
+	best, allowed := -1, true
+	for _, a := range r.allow {
+		if strings.HasPrefix(p, a) && len(a) >= best {
+			best, allowed = len(a), true
+		}
+	}
+	for _, d := range r.disallow {
+		if strings.HasPrefix(p, d) && len(d) > best {
+			best, allowed = len(d), false
+		}
+	}
+	return !allowed
+}
+
+// fetchRobots reads the robots.txt of the crawl root's site. A missing or
+// unreadable file allows everything.
+func (dm *DocumentManager) fetchRobots(root *url.URL) robotsRules {
+	var rules robotsRules
+	robotsURL := (&url.URL{Scheme: root.Scheme, Host: root.Host, Path: "/robots.txt"}).String()
+	resp, err := dm.getSourceURL(robotsURL)
+	if err != nil {
+		return rules
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rules
+	}
+	// Only the group for "*" applies; consecutive User-agent lines share a group
+	inGroup, groupStart := false, true
+	sc := bufio.NewScanner(io.LimitReader(resp.Body, 512<<10))
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, val = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(val)
+		switch key {
+		case "user-agent":
+			if !groupStart {
+				inGroup = false
+			}
+			groupStart = true
+			if val == "*" {
+				inGroup = true
+			}
+		case "allow", "disallow":
+			groupStart = false
+			if !inGroup || val == "" {
+				continue
+			}
+			// Wildcards are not supported; a rule is cut at its first "*"
+			if i := strings.IndexAny(val, "*$"); i >= 0 {
+				val = val[:i]
+			}
+			if key == "allow" {
+				rules.allow = append(rules.allow, val)
+			} else {
+				rules.disallow = append(rules.disallow, val)
+			}
+		default:
+			groupStart = false
+		}
+	}
+	return rules
+}
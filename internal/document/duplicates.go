@@ -0,0 +1,179 @@
+// Package document — near-duplicate document detection.
+package document
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultDuplicateThreshold is the centroid similarity above which two
+// documents are reported as near-duplicates.
+const DefaultDuplicateThreshold = 0.92
+
+// duplicateDeleteThreshold is the similarity above which two documents are
+// taken to be versions of the same content rather than overlapping content.
+const duplicateDeleteThreshold = 0.98
+
+// Suggestions for a pair of near-duplicate documents.
+const (
+	DuplicateDelete = "delete" // delete the other document, keep Keep
+	DuplicateMerge  = "merge"  // merge the other document's content into Keep
+)
+
+// DuplicateDocument is one document of a near-duplicate pair.
+type DuplicateDocument struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	ProductID string    `json:"product_id"`
+	Chunks    int       `json:"chunks"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DuplicatePair is two documents whose content is nearly the same, with a
+// suggestion of which to keep.
+type DuplicatePair struct {
+	A          DuplicateDocument `json:"a"`
+	B          DuplicateDocument `json:"b"`
+	Score      float64           `json:"score"`
+	Suggestion string            `json:"suggestion"` // DuplicateDelete or DuplicateMerge
+	Keep       string            `json:"keep"`       // ID of the document to keep
+	Reason     string            `json:"reason"`
+}
+
+// DuplicateReport lists the near-duplicate pairs among the compared
+// documents, most similar first.
+type DuplicateReport struct {
+	Threshold float64         `json:"threshold"`
+	Documents int             `json:"documents"` // documents compared
+	Pairs     []DuplicatePair `json:"pairs"`
+	Truncated bool            `json:"truncated"` // more than limit pairs were found
+}
+
+// NearDuplicates compares the centroids of all successfully processed
+// documents and reports the pairs at least threshold similar. Documents are
+// only compared within a product, and with the public library whose
+// documents every product retrieves. With productID set, only that product
+// and the public library are compared.
+func (dm *DocumentManager) NearDuplicates(productID string, threshold float64, limit int) (*DuplicateReport, error) {
+	where := `d.status = 'success'`
+	var args []interface{}
+	if productID != "" {
+		where += ` AND COALESCE(d.product_id, '') IN (?, '')`
+		args = append(args, productID)
+	}
+	centroids, err := dm.documentCentroids(where, args...)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := dm.duplicateDocuments(where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(centroids))
+	for id := range centroids {
+		if _, ok := docs[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	report := &DuplicateReport{Threshold: threshold, Documents: len(ids), Pairs: []DuplicatePair{}}
+	for i, idA := range ids {
+		a := docs[idA]
+		for _, idB := range ids[i+1:] {
+			b := docs[idB]
+			if a.ProductID != b.ProductID && a.ProductID != "" && b.ProductID != "" {
+				continue
+			}
+			if score := centroidSimilarity(centroids[idA], centroids[idB]); score >= threshold {
+				report.Pairs = append(report.Pairs, suggestDuplicate(a, b, score))
+			}
+		}
+	}
+	sort.Slice(report.Pairs, func(i, j int) bool { return report.Pairs[i].Score > report.Pairs[j].Score })
+	if len(report.Pairs) > limit {
+		report.Pairs = report.Pairs[:limit]
+		report.Truncated = true
+	}
+	return report, nil
+}
+
+// duplicateDocuments loads the documents matching where by ID.
+func (dm *DocumentManager) duplicateDocuments(where string, args ...interface{}) (map[string]DuplicateDocument, error) {
+	rows, err := dm.db.Query(`SELECT d.id, d.name, d.type, COALESCE(d.product_id, ''), d.created_at
+		FROM documents d WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+	defer rows.Close()
+	docs := make(map[string]DuplicateDocument)
+	products := make(map[string]string)
+	for rows.Next() {
+		var d DuplicateDocument
+		var createdAt sql.NullTime
+		if err := rows.Scan(&d.ID, &d.Name, &d.Type, &d.ProductID, &createdAt); err != nil {
+			return nil, err
+		}
+		if createdAt.Valid {
+			d.CreatedAt = createdAt.Time
+		}
+		docs[d.ID] = d
+		products[d.ID] = d.ProductID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	err = dm.queryDocumentChunks(products, `SELECT document_id, COUNT(*) FROM chunks
+		WHERE document_id IN (%s) AND chunk_index < 1000 GROUP BY document_id`,
+		func(rows *sql.Rows) error {
+			var id string
+			var n int
+			if err := rows.Scan(&id, &n); err != nil {
+				return err
+			}
+			d := docs[id]
+			d.Chunks = n
+			docs[id] = d
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// suggestDuplicate decides what to do with a near-duplicate pair. Nearly
+// identical documents are usually an old and a new version, so the newer
+// one is kept; overlapping documents are merged into the larger one.
+func suggestDuplicate(a, b DuplicateDocument, score float64) DuplicatePair {
+	p := DuplicatePair{A: a, B: b, Score: score}
+	switch {
+	case a.ProductID != b.ProductID:
+		// Product content overrides the public library for its product
+		keep, other := a, b
+		if keep.ProductID == "" {
+			keep, other = b, a
+		}
+		p.Suggestion, p.Keep = DuplicateDelete, keep.ID
+		p.Reason = fmt.Sprintf("公共库文档「%s」与产品文档内容重复，建议删除公共库中的副本，或确认其是否适用于所有产品", other.Name)
+	case score >= duplicateDeleteThreshold:
+		keep, other := a, b
+		if b.CreatedAt.After(a.CreatedAt) {
+			keep, other = b, a
+		}
+		p.Suggestion, p.Keep = DuplicateDelete, keep.ID
+		p.Reason = fmt.Sprintf("内容几乎相同，可能是同一文档的旧版本，建议保留较新的「%s」并删除「%s」", keep.Name, other.Name)
+	default:
+		keep, other := a, b
+		if b.Chunks > a.Chunks {
+			keep, other = b, a
+		}
+		p.Suggestion, p.Keep = DuplicateMerge, keep.ID
+		p.Reason = fmt.Sprintf("内容大量重叠，建议将「%s」中独有的内容合并到「%s」后删除前者", other.Name, keep.Name)
+	}
+	return p
+}
@@ -0,0 +1,61 @@
+package document
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EffectiveDateLayout is the format of document effective dates. Dates are
+// stored as text in this layout so they compare correctly as strings.
+const EffectiveDateLayout = "2006-01-02"
+
+// NormalizeEffectiveDates validates an optional effective period. Both bounds
+// are inclusive dates in EffectiveDateLayout; an empty bound is open. RFC 3339
+// timestamps are accepted and truncated to their date.
+func NormalizeEffectiveDates(from, until string) (string, string, error) {
+	f, err := normalizeEffectiveDate(from)
+	if err != nil {
+		return "", "", fmt.Errorf("生效日期格式无效: %w", err)
+	}
+	u, err := normalizeEffectiveDate(until)
+	if err != nil {
+		return "", "", fmt.Errorf("失效日期格式无效: %w", err)
+	}
+	if f != "" && u != "" && u < f {
+		return "", "", fmt.Errorf("失效日期不能早于生效日期")
+	}
+	return f, u, nil
+}
+
+func normalizeEffectiveDate(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	if t, err := time.Parse(EffectiveDateLayout, s); err == nil {
+		return t.Format(EffectiveDateLayout), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return "", fmt.Errorf("expected YYYY-MM-DD, got %q", s)
+	}
+	return t.Format(EffectiveDateLayout), nil
+}
+
+// SetEffectiveDates sets the period a document is effective in. Outside it,
+// user queries no longer cite the document; admins can still search it.
+func (dm *DocumentManager) SetEffectiveDates(docID, from, until string) (*DocumentInfo, error) {
+	from, until, err := NormalizeEffectiveDates(from, until)
+	if err != nil {
+		return nil, err
+	}
+	result, err := dm.db.Exec(`UPDATE documents SET effective_from = ?, effective_until = ? WHERE id = ?`, from, until, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update effective dates: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("document not found")
+	}
+	return dm.GetDocumentInfo(docID)
+}
@@ -0,0 +1,145 @@
+package document
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	// etaSampleSize is how many recent successful imports of a type are used
+	// to measure processing throughput.
+	etaSampleSize = 20
+	// etaBaseSeconds is the fixed per-document overhead added to estimates.
+	etaBaseSeconds = 2
+)
+
+// defaultThroughput is the assumed processing speed, in bytes per second, of
+// file types without enough history. Videos and scanned PDFs are dominated by
+// transcription and OCR calls, so they are far slower per byte than text.
+var defaultThroughput = map[string]float64{
+	"pdf":      100 << 10,
+	"ppt":      50 << 10,
+	"word":     500 << 10,
+	"excel":    500 << 10,
+	"markdown": 1 << 20,
+	"html":     1 << 20,
+	"text":     1 << 20,
+	"csv":      1 << 20,
+	"video":    1 << 20,
+}
+
+// throughputType groups file types that process at similar speeds.
+func throughputType(docType string) string {
+	if videoFileTypes[docType] {
+		return "video"
+	}
+	return docType
+}
+
+// annotateProcessing fills in the queue position and estimated completion of
+// documents that are still processing. Estimates are based on file size and
+// the throughput of recent imports of the same type; the queue position
+// counts documents that started processing earlier and are still running.
+func (dm *DocumentManager) annotateProcessing(docs []DocumentInfo) {
+	var processing []*DocumentInfo
+	for i := range docs {
+		if docs[i].Status == "processing" {
+			processing = append(processing, &docs[i])
+		}
+	}
+	if len(processing) == 0 {
+		return
+	}
+
+	var started []time.Time
+	rows, err := dm.db.Query(`SELECT created_at FROM documents WHERE status = 'processing'`)
+	if err == nil {
+		for rows.Next() {
+			var t sql.NullTime
+			if rows.Scan(&t) == nil && t.Valid {
+				started = append(started, t.Time)
+			}
+		}
+		rows.Close()
+	}
+
+	throughput := make(map[string]float64)
+	now := time.Now()
+	for _, d := range processing {
+		pos := 1
+		for _, t := range started {
+			if t.Before(d.CreatedAt) {
+				pos++
+			}
+		}
+		d.QueuePosition = pos
+
+		if d.FileSize <= 0 {
+			continue
+		}
+		tt := throughputType(d.Type)
+		bps, ok := throughput[tt]
+		if !ok {
+			bps = dm.measuredThroughput(d.Type)
+			throughput[tt] = bps
+		}
+		est := etaBaseSeconds + int(float64(d.FileSize)/bps+0.5)
+		d.EstimatedSeconds = est
+		eta := d.CreatedAt.Add(time.Duration(est) * time.Second)
+		if eta.Before(now) {
+			eta = now // overdue: expected to finish any moment
+		}
+		d.EstimatedCompletion = &eta
+	}
+}
+
+// measuredThroughput returns the average bytes per second of recent
+// successful imports of docType's throughput group, or the default for the
+// group when there is no history.
+func (dm *DocumentManager) measuredThroughput(docType string) float64 {
+	tt := throughputType(docType)
+	types := []interface{}{docType}
+	placeholders := "?"
+	if tt == "video" {
+		types = types[:0]
+		placeholders = ""
+		for t := range videoFileTypes {
+			if placeholders != "" {
+				placeholders += ", "
+			}
+			placeholders += "?"
+			types = append(types, t)
+		}
+	}
+	args := append(types, etaSampleSize)
+
+	var totalBytes int64
+	var totalSeconds float64
+	rows, err := dm.db.Query(
+		`SELECT file_size, created_at, processed_at FROM documents
+		 WHERE type IN (`+placeholders+`) AND status = 'success' AND file_size > 0 AND processed_at IS NOT NULL
+		 ORDER BY created_at DESC LIMIT ?`, args...)
+	if err == nil {
+		for rows.Next() {
+			var size int64
+			var created, processed sql.NullTime
+			if rows.Scan(&size, &created, &processed) != nil || !created.Valid || !processed.Valid {
+				continue
+			}
+			secs := processed.Time.Sub(created.Time).Seconds()
+			if secs < 1 {
+				secs = 1
+			}
+			totalBytes += size
+			totalSeconds += secs
+		}
+		rows.Close()
+	}
+	if totalBytes > 0 && totalSeconds > 0 {
+		return float64(totalBytes) / totalSeconds
+	}
+	if bps, ok := defaultThroughput[tt]; ok {
+		return bps
+	}
+	return 500 << 10
+}
@@ -0,0 +1,63 @@
+package document
+
+import (
+	"fmt"
+
+	"askflow/internal/vectorstore"
+)
+
+// EmbeddingFingerprints summarises which embedding models and dimensions the
+// stored chunks were produced with, so a model change can be tracked until
+// every chunk has been re-embedded.
+type EmbeddingFingerprints struct {
+	CurrentModel string                    `json:"current_model"`
+	CurrentDim   int                       `json:"current_dim"` // 0 until a chunk is embedded with the current model
+	Mixed        bool                      `json:"mixed"`       // more than one model/dimension in the corpus
+	Groups       []vectorstore.Fingerprint `json:"groups"`
+	// Outdated chunks were embedded by another model or at another
+	// dimension; Search skips them until their documents are re-embedded.
+	OutdatedChunks    int      `json:"outdated_chunks"`
+	OutdatedDocuments []string `json:"outdated_documents"`
+}
+
+// EmbeddingFingerprints reports the embedding fingerprints of the corpus
+// against the configured embedding model.
+func (dm *DocumentManager) EmbeddingFingerprints() (*EmbeddingFingerprints, error) {
+	groups, err := dm.vectorStore.Fingerprints()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load embedding fingerprints: %w", err)
+	}
+	dm.mu.RLock()
+	model := embeddingModelName(dm.embeddingService)
+	dm.mu.RUnlock()
+
+	report := &EmbeddingFingerprints{
+		CurrentModel:      model,
+		Mixed:             len(groups) > 1,
+		Groups:            groups,
+		OutdatedDocuments: []string{},
+	}
+	if model == "" {
+		return report, nil
+	}
+	// Groups are sorted by size, so the first match is the dominant dimension
+	for _, g := range groups {
+		if g.Model == model {
+			report.CurrentDim = g.Dim
+			break
+		}
+	}
+	for _, g := range groups {
+		if g.Model != model || (report.CurrentDim > 0 && g.Dim != report.CurrentDim) {
+			report.OutdatedChunks += g.Chunks
+		}
+	}
+	if report.OutdatedChunks > 0 {
+		docs, err := dm.vectorStore.OutdatedDocuments(model, report.CurrentDim)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list outdated documents: %w", err)
+		}
+		report.OutdatedDocuments = docs
+	}
+	return report, nil
+}
@@ -0,0 +1,194 @@
+package document
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"askflow/internal/datadir"
+)
+
+// Images are stored content-addressed under data/images/ as
+// <sha256 of the bytes><ext>, so importing the same picture again (from a
+// re-import or another document) reuses the existing file. The image_refs
+// table records which documents use each file; a file is removed once the
+// last document referencing it is deleted. Files named before content
+// addressing (random names) have no refs and are never garbage-collected.
+
+// contentImageRe matches the URL of a content-addressed image.
+var contentImageRe = regexp.MustCompile(`^/api/images/([0-9a-f]{64}\.(?:png|jpg|webp|gif|bmp))$`)
+
+// imageDir returns the directory images are stored in.
+func imageDir() string {
+	return datadir.Path("images")
+}
+
+// imageExtension returns the file extension matching the image's magic bytes.
+// Unrecognised data is stored as .png, as extracted images always were.
+func imageExtension(data []byte) string {
+	if len(data) >= 2 && string(data[:2]) == "BM" {
+		return ".bmp"
+	}
+	switch detectImageMIME(data) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	}
+	return ".png"
+}
+
+// writeContentImage writes data under its content hash unless an identical
+// file already exists, and returns the file name. Caller holds dm.imageMu.
+func writeContentImage(data []byte, ext string) (string, error) {
+	sum := sha256.Sum256(data)
+	filename := hex.EncodeToString(sum[:]) + ext
+
+	dir := imageDir()
+	if err := datadir.MkdirAll(dir); err != nil {
+		return "", fmt.Errorf("failed to create image dir: %w", err)
+	}
+	path := filepath.Join(dir, filename)
+	if info, err := os.Stat(path); err == nil && info.Size() == int64(len(data)) {
+		return filename, nil
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return "", fmt.Errorf("failed to write image: %w", err)
+	}
+	generateImageVariants(filename, data)
+	return filename, nil
+}
+
+// writeFileAtomic writes data to a temp file next to path and renames it into
+// place so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), datadir.FileMode()); err != nil {
+		log.Printf("Warning: failed to chmod %s: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// saveExtractedImage saves embedded image data (e.g. from PDF) to data/images/
+// under its content hash, records that docID references it, and returns the
+// URL path for accessing it.
+func (dm *DocumentManager) saveExtractedImage(docID string, data []byte) (string, error) {
+	dm.imageMu.Lock()
+	defer dm.imageMu.Unlock()
+
+	filename, err := writeContentImage(data, imageExtension(data))
+	if err != nil {
+		return "", err
+	}
+	if _, err := dm.db.Exec(
+		`INSERT OR IGNORE INTO image_refs (filename, document_id) VALUES (?, ?)`,
+		filename, docID,
+	); err != nil {
+		return "", fmt.Errorf("failed to record image reference: %w", err)
+	}
+	return "/api/images/" + filename, nil
+}
+
+// SaveUploadedImage stores an image uploaded for a knowledge entry under its
+// content hash and returns its URL. The image is not referenced by any
+// document until AddImageRefs is called for the entry that uses it.
+func (dm *DocumentManager) SaveUploadedImage(data []byte) (string, error) {
+	dm.imageMu.Lock()
+	defer dm.imageMu.Unlock()
+
+	filename, err := writeContentImage(data, imageExtension(data))
+	if err != nil {
+		return "", err
+	}
+	return "/api/images/" + filename, nil
+}
+
+// AddImageRefs records that docID references the given image URLs. URLs that
+// are not content-addressed local images are ignored.
+func (dm *DocumentManager) AddImageRefs(docID string, urls []string) error {
+	dm.imageMu.Lock()
+	defer dm.imageMu.Unlock()
+
+	for _, u := range urls {
+		m := contentImageRe.FindStringSubmatch(strings.TrimSpace(u))
+		if m == nil {
+			continue
+		}
+		if _, err := dm.db.Exec(
+			`INSERT OR IGNORE INTO image_refs (filename, document_id) VALUES (?, ?)`,
+			m[1], docID,
+		); err != nil {
+			return fmt.Errorf("failed to record image reference: %w", err)
+		}
+	}
+	return nil
+}
+
+// releaseImages drops docID's image references and deletes image files that
+// are no longer referenced by any document. Errors are logged, not returned:
+// a leftover file only wastes disk space.
+func (dm *DocumentManager) releaseImages(docID string) {
+	dm.imageMu.Lock()
+	defer dm.imageMu.Unlock()
+
+	rows, err := dm.db.Query(`SELECT filename FROM image_refs WHERE document_id = ?`, docID)
+	if err != nil {
+		log.Printf("Warning: failed to list image refs for doc=%s: %v", docID, err)
+		return
+	}
+	var files []string
+	for rows.Next() {
+		var f string
+		if err := rows.Scan(&f); err == nil {
+			files = append(files, f)
+		}
+	}
+	rows.Close()
+	if len(files) == 0 {
+		return
+	}
+
+	if _, err := dm.db.Exec(`DELETE FROM image_refs WHERE document_id = ?`, docID); err != nil {
+		log.Printf("Warning: failed to delete image refs for doc=%s: %v", docID, err)
+		return
+	}
+	removed := 0
+	for _, f := range files {
+		var n int
+		if err := dm.db.QueryRow(`SELECT COUNT(*) FROM image_refs WHERE filename = ?`, f).Scan(&n); err != nil || n > 0 {
+			continue
+		}
+		if err := os.Remove(filepath.Join(imageDir(), filepath.Base(f))); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to remove image %s: %v", f, err)
+			continue
+		}
+		removeImageVariants(f)
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("[Images] removed %d unreferenced image(s) after deleting doc=%s", removed, docID)
+	}
+}
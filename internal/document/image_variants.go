@@ -0,0 +1,131 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"askflow/internal/datadir"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
+)
+
+// imageVariantSizes maps the ?size= values accepted on /api/images/ to the
+// longest edge, in pixels, of the scaled copy.
+var imageVariantSizes = map[string]int{
+	"thumb":  320,
+	"medium": 800,
+}
+
+// ErrInvalidImageSize is returned by ImageVariantPath for unknown sizes.
+var ErrInvalidImageSize = fmt.Errorf("invalid image size")
+
+// imageVariantDir returns the directory scaled image copies are cached in.
+func imageVariantDir() string {
+	return filepath.Join(imageDir(), "variants")
+}
+
+// imageVariantName returns the file name of the size variant of an image.
+// Variants are always JPEG.
+func imageVariantName(filename, size string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + "_" + size + ".jpg"
+}
+
+// generateImageVariants writes the scaled copies of a newly saved image.
+// Images already smaller than a variant get no copy for that size; requests
+// for it are served the original. Failures are logged, not returned: variants
+// can be regenerated on demand by ImageVariantPath.
+func generateImageVariants(filename string, data []byte) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return // undecodable (e.g. EMF) — always served as-is
+	}
+	for size, edge := range imageVariantSizes {
+		if cfg.Width <= edge && cfg.Height <= edge {
+			continue
+		}
+		if _, err := writeImageVariant(filename, size, data); err != nil {
+			log.Printf("Warning: failed to create %s variant of image %s: %v", size, filename, err)
+		}
+	}
+}
+
+// writeImageVariant scales data for size and caches it. Returns "" when the
+// image does not need scaling or cannot be decoded.
+func writeImageVariant(filename, size string, data []byte) (string, error) {
+	resized := resizeToMaxEdge(data, imageVariantSizes[size])
+	if resized == nil {
+		return "", nil
+	}
+	dir := imageVariantDir()
+	if err := datadir.MkdirAll(dir); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, imageVariantName(filename, size))
+	if err := writeFileAtomic(path, resized); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ImageVariantPath returns the file to serve for an image in data/images/ at
+// the requested size ("thumb" or "medium"; "" means the original). Variants
+// missing from the cache — e.g. for images saved before variants existed —
+// are generated on first request. Images smaller than the requested size, or
+// in formats that cannot be decoded, resolve to the original file. name must
+// already be validated as a plain file name.
+func ImageVariantPath(name, size string) (string, error) {
+	original := filepath.Join(imageDir(), name)
+	if size == "" {
+		return original, nil
+	}
+	edge, ok := imageVariantSizes[size]
+	if !ok {
+		return "", ErrInvalidImageSize
+	}
+
+	cached := filepath.Join(imageVariantDir(), imageVariantName(name, size))
+	if _, err := os.Stat(cached); err == nil {
+		return cached, nil
+	}
+
+	f, err := os.Open(original)
+	if err != nil {
+		return "", err
+	}
+	cfg, _, err := image.DecodeConfig(f)
+	f.Close()
+	if err != nil || (cfg.Width <= edge && cfg.Height <= edge) {
+		return original, nil
+	}
+
+	data, err := os.ReadFile(original)
+	if err != nil {
+		return "", err
+	}
+	path, err := writeImageVariant(name, size, data)
+	if err != nil {
+		log.Printf("Warning: failed to create %s variant of image %s: %v", size, name, err)
+		return original, nil
+	}
+	if path == "" {
+		return original, nil
+	}
+	return path, nil
+}
+
+// removeImageVariants deletes the cached scaled copies of an image.
+func removeImageVariants(filename string) {
+	for size := range imageVariantSizes {
+		path := filepath.Join(imageVariantDir(), imageVariantName(filename, size))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to remove image variant %s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Package document — dry-run estimates of what an import would cost.
+package document
+
+import (
+	"fmt"
+	"strings"
+
+	"askflow/internal/budget"
+	"askflow/internal/langdetect"
+)
+
+// Rough per-call token figures for LLM work whose size is only known once it
+// has run.
+const (
+	ocrPageTokens         = 1500 // page image, prompt and recognised text
+	ocrPageTextTokens     = 500  // recognised text of one page, embedded afterwards
+	translatePromptTokens = 200  // translation instructions around each chunk
+)
+
+// ImportEstimate is what importing a file or URL would do, computed without
+// writing anything. Token counts are approximations; Cost uses the prices set
+// with SetImportPrices and excludes image embeddings, whose price depends on
+// the provider.
+type ImportEstimate struct {
+	Chunks          int     `json:"chunks"`
+	Embeddings      int     `json:"embeddings"` // embedding inputs, excluding chunks whose embedding would be reused
+	EmbeddingTokens int     `json:"embedding_tokens"`
+	Images          int     `json:"images"`     // images embedded separately
+	OCRPages        int     `json:"ocr_pages"`  // scanned PDF pages recognised by the LLM
+	LLMTokens       int     `json:"llm_tokens"` // OCR, chunk translation and tagging
+	Cost            float64 `json:"cost"`
+	DuplicateOf     string  `json:"duplicate_of,omitempty"` // existing document with the same content; nothing would be imported
+	Note            string  `json:"note,omitempty"`
+}
+
+// Add accumulates o into e, for totals over several files.
+func (e *ImportEstimate) Add(o *ImportEstimate) {
+	e.Chunks += o.Chunks
+	e.Embeddings += o.Embeddings
+	e.EmbeddingTokens += o.EmbeddingTokens
+	e.Images += o.Images
+	e.OCRPages += o.OCRPages
+	e.LLMTokens += o.LLMTokens
+	e.Cost += o.Cost
+}
+
+// SetImportPrices sets the prices per million embedding and LLM tokens used
+// for import cost estimates. 0 leaves that part of the cost out.
+func (dm *DocumentManager) SetImportPrices(embeddingPerMTokens, llmPerMTokens float64) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.embeddingPrice = embeddingPerMTokens
+	dm.llmPrice = llmPerMTokens
+}
+
+// EstimateFile parses a file and reports the chunks, embeddings, LLM calls
+// and cost importing it would take, mirroring UploadFile and processFile
+// without storing anything or calling any external API.
+func (dm *DocumentManager) EstimateFile(fileType string, fileData []byte) (*ImportEstimate, error) {
+	fileType = strings.ToLower(fileType)
+	if !supportedFileTypes[fileType] {
+		return nil, fmt.Errorf("不支持的文件格式")
+	}
+	if len(fileData) == 0 {
+		return nil, fmt.Errorf("文件内容为空")
+	}
+	if err := checkFileContent(fileType, fileData); err != nil {
+		return nil, err
+	}
+
+	est := &ImportEstimate{}
+	if existingID := dm.findDocumentByContentHash(fileHash(fileData)); existingID != "" {
+		est.DuplicateOf = existingID
+		return est, nil
+	}
+	if videoFileTypes[fileType] {
+		est.Note = "视频文件需转录后才能分块，无法预估"
+		return est, nil
+	}
+
+	result, err := dm.parser.ParseWithPassword(fileData, fileType, "")
+	if err != nil {
+		return nil, fmt.Errorf("parse error: %w", err)
+	}
+	if result.Text == "" && len(result.Images) == 0 {
+		return nil, fmt.Errorf("文档内容为空")
+	}
+
+	dm.mu.RLock()
+	hasLLM := dm.llmService != nil
+	dm.mu.RUnlock()
+
+	// Scanned PDF: one OCR call and one chunk per page
+	if result.Text == "" && fileType == "pdf" {
+		if !hasLLM {
+			return nil, fmt.Errorf("文档内容为空")
+		}
+		for _, img := range result.Images {
+			if len(img.Data) > 0 {
+				est.OCRPages++
+			}
+		}
+		est.Chunks = est.OCRPages
+		est.Embeddings = est.OCRPages
+		est.EmbeddingTokens = est.OCRPages * ocrPageTextTokens
+		est.LLMTokens = est.OCRPages * ocrPageTokens
+		est.Note = "扫描型PDF，按页OCR估算"
+		dm.estimateTagging(est)
+		dm.priceEstimate(est)
+		return est, nil
+	}
+
+	if result.Text != "" {
+		if existingID := dm.findDocumentByContentHash(contentHash(result.Text)); existingID != "" {
+			est.DuplicateOf = existingID
+			return est, nil
+		}
+	}
+
+	var texts []string
+	if fileType == "ppt" && len(result.Images) > 0 {
+		// One chunk per slide with text, see processFile
+		for _, img := range result.Images {
+			text := img.SlideText
+			if text == "" {
+				text = img.Alt
+			}
+			if text != "" {
+				texts = append(texts, text)
+			}
+		}
+		est.Chunks = len(texts)
+		dm.estimateEmbeddings(est, texts, false)
+	} else {
+		if result.Text != "" {
+			for _, c := range dm.chunker.Split(result.Text, "") {
+				texts = append(texts, c.Text)
+			}
+		}
+		est.Chunks = len(texts)
+		dm.estimateEmbeddings(est, texts, true)
+		for _, img := range result.Images {
+			if img.URL != "" || len(img.Data) > 0 {
+				est.Images++
+			}
+		}
+	}
+	dm.estimateTagging(est)
+	dm.priceEstimate(est)
+	return est, nil
+}
+
+// estimateTextImport estimates importing plain text, such as a fetched URL.
+func (dm *DocumentManager) estimateTextImport(text string, images int) *ImportEstimate {
+	est := &ImportEstimate{Images: images}
+	if existingID := dm.findDocumentByContentHash(contentHash(text)); existingID != "" {
+		est.DuplicateOf = existingID
+		return est
+	}
+	var texts []string
+	for _, c := range dm.chunker.Split(text, "") {
+		texts = append(texts, c.Text)
+	}
+	est.Chunks = len(texts)
+	dm.estimateEmbeddings(est, texts, true)
+	dm.estimateTagging(est)
+	dm.priceEstimate(est)
+	return est
+}
+
+// estimateEmbeddings counts the embedding inputs for the chunk texts, minus
+// those chunk-level dedup would reuse, and, if translate is set, the chunk
+// translations into the configured languages and their embeddings.
+func (dm *DocumentManager) estimateEmbeddings(est *ImportEstimate, texts []string, translate bool) {
+	existing := dm.getExistingChunkEmbeddings(texts, "")
+	for _, t := range texts {
+		if _, ok := existing[t]; !ok {
+			est.Embeddings++
+			est.EmbeddingTokens += estimateTokens(t)
+		}
+	}
+	if !translate {
+		return
+	}
+	dm.mu.RLock()
+	langs := dm.translateLanguages
+	hasLLM := dm.llmService != nil
+	dm.mu.RUnlock()
+	if len(langs) == 0 || !hasLLM {
+		return
+	}
+	for _, t := range texts {
+		srcLang := langdetect.Detect(t)
+		n := estimateTokens(t)
+		for _, lang := range langs {
+			if lang == srcLang {
+				continue
+			}
+			est.LLMTokens += 2*n + translatePromptTokens
+			est.Embeddings++
+			est.EmbeddingTokens += n
+		}
+	}
+}
+
+func (dm *DocumentManager) priceEstimate(est *ImportEstimate) {
+	dm.mu.RLock()
+	embeddingPrice, llmPrice := dm.embeddingPrice, dm.llmPrice
+	dm.mu.RUnlock()
+	est.Cost = float64(est.EmbeddingTokens)/1e6*embeddingPrice + float64(est.LLMTokens)/1e6*llmPrice
+}
+
+// estimateTokens approximates the token count of s: about one token per CJK
+// character and one per four other characters.
+func estimateTokens(s string) int {
+	return budget.EstimateTokens(s)
+}
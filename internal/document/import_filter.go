@@ -0,0 +1,166 @@
+package document
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImportFilter narrows the files a batch import picks up. It is shared by the
+// import CLI and the batch-import endpoint.
+//
+// Patterns use "/" as separator and are matched against the path relative to
+// the import root. "*" and "?" stay within a path segment, "**" spans any
+// number of segments, and a pattern without "/" matches the file name at any
+// depth (e.g. "*.pdf", "**/manuals/*.docx", "archive/**").
+type ImportFilter struct {
+	Include       []string  // if set, a file must match one of these
+	Exclude       []string  // files and directories matching any of these are skipped
+	MaxFileSize   int64     // bytes; 0 = no limit
+	ModifiedSince time.Time // zero = no limit
+}
+
+// ParseImportFilter validates the filter options. maxSize accepts a byte
+// count with an optional KB/MB/GB suffix; modifiedSince a YYYY-MM-DD date
+// (local time) or an RFC 3339 timestamp. Empty values disable the filter.
+func ParseImportFilter(include, exclude []string, maxSize, modifiedSince string) (ImportFilter, error) {
+	f := ImportFilter{}
+	for _, list := range []struct {
+		in  []string
+		out *[]string
+	}{{include, &f.Include}, {exclude, &f.Exclude}} {
+		for _, p := range list.in {
+			p = strings.Trim(strings.TrimSpace(filepath.ToSlash(p)), "/")
+			if p == "" {
+				continue
+			}
+			if _, err := path.Match(strings.ReplaceAll(p, "**", "*"), ""); err != nil {
+				return f, fmt.Errorf("无效的匹配模式 %q", p)
+			}
+			*list.out = append(*list.out, p)
+		}
+	}
+	if s := strings.TrimSpace(maxSize); s != "" {
+		n, err := ParseByteSize(s)
+		if err != nil {
+			return f, err
+		}
+		f.MaxFileSize = n
+	}
+	if s := strings.TrimSpace(modifiedSince); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			t, err = time.Parse(time.RFC3339, s)
+		}
+		if err != nil {
+			return f, fmt.Errorf("修改时间格式无效，应为 YYYY-MM-DD: %q", s)
+		}
+		f.ModifiedSince = t
+	}
+	return f, nil
+}
+
+// ParseByteSize parses sizes like "500", "200KB", "10MB" or "1.5GB".
+func ParseByteSize(s string) (int64, error) {
+	u := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(u, unit.suffix) {
+			u, mult = strings.TrimSpace(strings.TrimSuffix(u, unit.suffix)), unit.mult
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(u, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("文件大小格式无效: %q", s)
+	}
+	return int64(v * float64(mult)), nil
+}
+
+// IsZero reports whether the filter lets every file through.
+func (f ImportFilter) IsZero() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0 && f.MaxFileSize == 0 && f.ModifiedSince.IsZero()
+}
+
+// SkipDir reports whether a directory (path relative to the import root) is
+// excluded, so the walk need not descend into it.
+func (f ImportFilter) SkipDir(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	if rel == "." || rel == "" {
+		return false
+	}
+	for _, p := range f.Exclude {
+		if matchImportPattern(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether a file (path relative to the import root) passes the
+// filter, and why not if it does not.
+func (f ImportFilter) Match(rel string, fi os.FileInfo) (bool, string) {
+	rel = filepath.ToSlash(rel)
+	for _, p := range f.Exclude {
+		if matchImportPattern(p, rel) {
+			return false, "excluded"
+		}
+	}
+	if len(f.Include) > 0 {
+		included := false
+		for _, p := range f.Include {
+			if matchImportPattern(p, rel) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false, "not included"
+		}
+	}
+	if f.MaxFileSize > 0 && fi.Size() > f.MaxFileSize {
+		return false, "too large"
+	}
+	if !f.ModifiedSince.IsZero() && fi.ModTime().Before(f.ModifiedSince) {
+		return false, "not modified"
+	}
+	return true, ""
+}
+
+// matchImportPattern matches a slash-separated relative path against a
+// pattern as described on ImportFilter.
+func matchImportPattern(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") && pattern != "**" {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
@@ -0,0 +1,209 @@
+// Package document — listing and editing knowledge entries entered by admins.
+package document
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"askflow/internal/datadir"
+	"askflow/internal/errlog"
+	"askflow/internal/idgen"
+	"askflow/internal/textutil"
+)
+
+// ErrKnowledgeNotFound is returned for an unknown knowledge entry.
+var ErrKnowledgeNotFound = errors.New("knowledge entry not found")
+
+// KnowledgeEntry is a knowledge entry as listed and edited by admins.
+type KnowledgeEntry struct {
+	ID           string     `json:"id"`
+	Title        string     `json:"title"`
+	ProductID    string     `json:"product_id"`
+	Format       string     `json:"format"`            // "markdown" or "text"
+	Preview      string     `json:"preview,omitempty"` // start of the text, in listings
+	Content      string     `json:"content,omitempty"` // full text, in GetKnowledgeEntry
+	ImageURLs    []string   `json:"image_urls"`        // attached images; inline ones are in Content
+	VideoURLs    []string   `json:"video_urls"`        // attached videos; inline ones are in Content
+	ReviewStatus string     `json:"review_status"`
+	Author       string     `json:"author"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+	// Optional publish schedule, see DocumentInfo.PublishAt.
+	PublishAt     string `json:"publish_at,omitempty"`
+	UnpublishAt   string `json:"unpublish_at,omitempty"`
+	ScheduleState string `json:"schedule_state,omitempty"`
+}
+
+// KnowledgeDocumentName returns the document name of a knowledge entry.
+func KnowledgeDocumentName(title string) string {
+	return knowledgeNamePrefix + title
+}
+
+// EncodeVideoURLs encodes the attached videos of a knowledge entry for the
+// documents.video_urls column.
+func EncodeVideoURLs(urls []string) string {
+	if len(urls) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(urls)
+	return string(data)
+}
+
+func decodeVideoURLs(s string) []string {
+	urls := []string{}
+	if s != "" {
+		json.Unmarshal([]byte(s), &urls)
+	}
+	return urls
+}
+
+// knowledgeFormat returns the format an entry was written in, from the name
+// of its source file.
+func knowledgeFormat(docID string) string {
+	if _, err := os.Stat(datadir.Path("uploads", docID, knowledgeSourceMarkdown)); err == nil {
+		return "markdown"
+	}
+	return "text"
+}
+
+const knowledgeEntryColumns = `d.id, d.name, COALESCE(d.product_id, ''), COALESCE(d.review_status, ''),
+	COALESCE(d.review_author, ''), COALESCE(d.video_urls, ''), d.created_at, CAST(d.processed_at AS TEXT),
+	COALESCE(d.publish_at, ''), COALESCE(d.unpublish_at, '')`
+
+func scanKnowledgeEntry(scan func(...interface{}) error, e *KnowledgeEntry, extra ...interface{}) error {
+	var name, videos string
+	var createdAt sql.NullTime
+	var updatedAt sql.NullString
+	dest := append([]interface{}{&e.ID, &name, &e.ProductID, &e.ReviewStatus, &e.Author, &videos, &createdAt, &updatedAt,
+		&e.PublishAt, &e.UnpublishAt}, extra...)
+	if err := scan(dest...); err != nil {
+		return err
+	}
+	e.Title = portalTitle(name, "knowledge")
+	e.Format = knowledgeFormat(e.ID)
+	e.ImageURLs = []string{}
+	e.VideoURLs = decodeVideoURLs(videos)
+	if createdAt.Valid {
+		e.CreatedAt = createdAt.Time
+	}
+	if t, ok := parseCitationTime(updatedAt); ok {
+		e.UpdatedAt = &t
+	}
+	e.ScheduleState = ScheduleState(e.PublishAt, e.UnpublishAt, time.Now())
+	return nil
+}
+
+// ListKnowledgeEntries returns the knowledge entries newest first: all of
+// them when productID is empty, otherwise the product's own and the public
+// ones.
+func (dm *DocumentManager) ListKnowledgeEntries(productID string) ([]KnowledgeEntry, error) {
+	query := `SELECT ` + knowledgeEntryColumns + `
+		FROM documents d WHERE d.type = 'knowledge' AND d.status = 'success'`
+	var args []interface{}
+	if productID != "" {
+		query += ` AND (d.product_id = ? OR COALESCE(d.product_id, '') = '')`
+		args = append(args, productID)
+	}
+	rows, err := dm.db.Query(query+` ORDER BY d.created_at DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list knowledge entries: %w", err)
+	}
+	defer rows.Close()
+	entries := []KnowledgeEntry{}
+	products := make(map[string]string)
+	for rows.Next() {
+		var e KnowledgeEntry
+		if err := scanKnowledgeEntry(rows.Scan, &e); err != nil {
+			return nil, fmt.Errorf("failed to scan knowledge entry: %w", err)
+		}
+		entries = append(entries, e)
+		products[e.ID] = e.ProductID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	first, err := dm.firstTextChunks(products)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].Preview = textutil.Ellipsize(first[entries[i].ID], portalSummaryRunes)
+	}
+	return entries, nil
+}
+
+// GetKnowledgeEntry returns a knowledge entry with its full text.
+func (dm *DocumentManager) GetKnowledgeEntry(docID string) (*KnowledgeEntry, error) {
+	var e KnowledgeEntry
+	err := scanKnowledgeEntry(dm.db.QueryRow(`SELECT `+knowledgeEntryColumns+`
+		FROM documents d WHERE d.id = ? AND d.type = 'knowledge' AND d.status = 'success'`, docID).Scan, &e)
+	if err == sql.ErrNoRows {
+		return nil, ErrKnowledgeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query knowledge entry: %w", err)
+	}
+	a := PortalArticle{ID: e.ID, Type: "knowledge", Format: "text"}
+	if err := dm.loadArticleText(&a); err != nil {
+		return nil, err
+	}
+	e.Content = a.Content
+	if a.Images != nil {
+		e.ImageURLs = a.Images
+	}
+	return &e, nil
+}
+
+// ReplaceKnowledgeEntry replaces the content of a knowledge entry. store
+// stores the new content under the ID and name it is given: those of a
+// hidden staging record. Chunks whose text did not change reuse the vectors
+// of the current ones, so only edited passages are embedded again. Once
+// store succeeds the staged content replaces the entry's, keeping its ID so
+// citations and feedback stay attached.
+func (dm *DocumentManager) ReplaceKnowledgeEntry(docID, title, content string, markdown bool, store func(stagedID, docName string) error) error {
+	cur, err := dm.GetDocumentInfo(docID)
+	if err != nil || cur.Type != "knowledge" || cur.Status != "success" {
+		return ErrKnowledgeNotFound
+	}
+	stagedID, err := idgen.New()
+	if err != nil {
+		return err
+	}
+	docName := KnowledgeDocumentName(title)
+	staged := &DocumentInfo{
+		ID:        stagedID,
+		Name:      docName,
+		Type:      "knowledge",
+		Status:    StatusStaging,
+		CreatedAt: time.Now(),
+		ProductID: cur.ProductID,
+	}
+	if err := dm.insertDocument(staged, ""); err != nil {
+		return fmt.Errorf("failed to insert staging record: %w", err)
+	}
+
+	fileName := knowledgeSourceText
+	if markdown {
+		fileName = knowledgeSourceMarkdown
+	}
+	err = store(stagedID, docName)
+	if err == nil {
+		err = dm.promoteStaged(docID, stagedID, cur.ProductID, docName, fileName, []byte(content))
+	}
+	if err != nil {
+		dm.discardStaged(stagedID)
+		errlog.Logf("[Knowledge] editing entry doc=%s failed: %v", docID, err)
+		return err
+	}
+	// Videos are saved under the staging record while they are processed
+	if err := os.RemoveAll(datadir.Path("uploads", stagedID)); err != nil {
+		log.Printf("Warning: failed to remove staged uploads %s: %v", stagedID, err)
+	}
+	return nil
+}
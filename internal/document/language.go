@@ -0,0 +1,69 @@
+package document
+
+import (
+	"fmt"
+	"log"
+	"unicode/utf8"
+
+	"askflow/internal/langdetect"
+)
+
+const (
+	// languageDominance is the share of a document's text, by length, one
+	// language must reach to become the language of the document. Mixed
+	// documents get none; their chunks are judged one by one at query time.
+	languageDominance = 0.6
+	// languageSampleRunes bounds how much text is read to detect a language.
+	languageSampleRunes = 200000
+)
+
+// DetectLanguage detects the language of a processed document from its text
+// chunks and stores it, "" when no language dominates. Translated chunks and
+// image chunks are ignored.
+func (dm *DocumentManager) DetectLanguage(docID string) (string, error) {
+	rows, err := dm.docChunkDB(docID).Query(`SELECT chunk_text FROM chunks
+		WHERE document_id = ? AND chunk_index < ? AND COALESCE(image_url, '') = '' ORDER BY chunk_index`,
+		docID, translationChunkIndexBase)
+	if err != nil {
+		return "", fmt.Errorf("failed to query chunks: %w", err)
+	}
+	defer rows.Close()
+	weights := make(map[string]int)
+	total := 0
+	for rows.Next() && total < languageSampleRunes {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			return "", err
+		}
+		lang := langdetect.Detect(text)
+		if lang == "" {
+			continue
+		}
+		n := utf8.RuneCountInString(text)
+		weights[lang] += n
+		total += n
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	rows.Close()
+
+	lang := ""
+	for l, n := range weights {
+		if float64(n) >= languageDominance*float64(total) {
+			lang = l
+		}
+	}
+	if _, err := dm.db.Exec(`UPDATE documents SET language = ? WHERE id = ?`, lang, docID); err != nil {
+		return "", fmt.Errorf("failed to store document language: %w", err)
+	}
+	return lang, nil
+}
+
+// recordLanguage detects and stores the language of a document that just
+// finished processing, logging failures.
+func (dm *DocumentManager) recordLanguage(docID string) {
+	if _, err := dm.DetectLanguage(docID); err != nil {
+		log.Printf("[Language] doc=%s: %v", docID, err)
+	}
+}
@@ -0,0 +1,227 @@
+package document
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"askflow/internal/chunker"
+	"askflow/internal/parser"
+	"askflow/internal/textutil"
+)
+
+// headingPathSep separates the headings of a stored heading path.
+const headingPathSep = "\x1f"
+
+// ErrChunkNotFound is returned by LocateChunk when the document has no chunk
+// with the requested index.
+var ErrChunkNotFound = errors.New("chunk not found")
+
+// ErrTextNotFound is returned by DocumentText for documents without stored
+// text, such as videos, images and documents imported before texts were kept.
+var ErrTextNotFound = errors.New("document text not found")
+
+// ChunkLocation tells a document viewer where a chunk came from, so it can
+// scroll or seek its preview to the cited passage. Only the fields known for
+// the document type are set.
+type ChunkLocation struct {
+	DocumentID   string   `json:"document_id"`
+	DocumentType string   `json:"document_type"`
+	ChunkIndex   int      `json:"chunk_index"`
+	Snippet      string   `json:"snippet"`
+	ImageURL     string   `json:"image_url,omitempty"`
+	Page         int      `json:"page,omitempty"`       // 1-based page or slide number
+	CharStart    *int     `json:"char_start,omitempty"` // rune offsets into the extracted text
+	CharEnd      *int     `json:"char_end,omitempty"`
+	HeadingPath  []string `json:"heading_path,omitempty"` // enclosing headings, outermost first
+	Anchor       string   `json:"anchor,omitempty"`       // fragment of the nearest enclosing heading (HTML)
+	URL          string   `json:"url,omitempty"`          // source page of web documents, with Anchor
+	StartTime    *float64 `json:"start_time,omitempty"`   // video position in seconds
+	EndTime      *float64 `json:"end_time,omitempty"`
+	SourceIndex  *int     `json:"source_index,omitempty"` // original chunk of a translated chunk
+	CodeLangs    []string `json:"code_langs,omitempty"`   // languages of the fenced code blocks in the chunk
+}
+
+// recordTextLocations stores text, the text the chunks were split from, and
+// the character range of each chunk in it together with the page and heading
+// path it starts in, the anchor of the innermost heading that has one, and
+// the code blocks it holds. Failures are logged, not returned: a missing location only disables
+// precise scrolling and highlighting.
+func (dm *DocumentManager) recordTextLocations(docID, text string, chunks []chunker.Chunk, pages []parser.PageMark, headings []parser.Heading) {
+	if _, err := dm.db.Exec(
+		`INSERT OR REPLACE INTO document_texts (document_id, content, created_at) VALUES (?, ?, ?)`,
+		docID, text, time.Now().UTC(),
+	); err != nil {
+		log.Printf("Warning: failed to record document text doc=%s: %v", docID, err)
+	}
+	for _, c := range chunks {
+		page := 0
+		for _, p := range pages {
+			if p.Offset > c.Start {
+				break
+			}
+			page = p.Page
+		}
+		// Headings are in document order; keep the innermost open one per level
+		var path []parser.Heading
+		for _, h := range headings {
+			if h.Offset > c.Start {
+				break
+			}
+			for len(path) > 0 && path[len(path)-1].Level >= h.Level {
+				path = path[:len(path)-1]
+			}
+			path = append(path, h)
+		}
+		titles := make([]string, len(path))
+		anchor := ""
+		for i, h := range path {
+			titles[i] = h.Title
+			if h.Anchor != "" {
+				anchor = h.Anchor
+			}
+		}
+		if _, err := dm.db.Exec(
+			`INSERT OR REPLACE INTO chunk_locations (document_id, chunk_index, page, char_start, char_end, heading_path, anchor, code_langs, open_code) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			docID, c.Index, page, c.Start, c.End, strings.Join(titles, headingPathSep), anchor, strings.Join(c.CodeLangs, ","), c.OpenCode,
+		); err != nil {
+			log.Printf("Warning: failed to record chunk location doc=%s chunk=%d: %v", docID, c.Index, err)
+			return
+		}
+	}
+}
+
+// chunksText rebuilds the text that chunks were split from when every chunk
+// is a slice of it, as with Split and SplitMarkdown; chunks overlap or adjoin.
+func chunksText(chunks []chunker.Chunk) string {
+	var b strings.Builder
+	covered := 0 // runes written so far
+	for _, c := range chunks {
+		if c.End <= covered {
+			continue
+		}
+		runes := []rune(c.Text)
+		b.WriteString(string(runes[min(max(covered-c.Start, 0), len(runes)):]))
+		covered = c.End
+	}
+	return b.String()
+}
+
+// DocumentText returns the text a document's chunks were split from. The
+// char_start and char_end of its chunk locations are rune offsets into it.
+func (dm *DocumentManager) DocumentText(docID string) (string, error) {
+	var text string
+	err := dm.db.QueryRow(`SELECT content FROM document_texts WHERE document_id = ?`, docID).Scan(&text)
+	if err == sql.ErrNoRows {
+		return "", ErrTextNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query document text: %w", err)
+	}
+	return text, nil
+}
+
+// AnchoredURL returns the link to the section anchor of a web page, or the
+// page itself without anchor. It is empty when the page URL is.
+func AnchoredURL(pageURL, anchor string) string {
+	if pageURL == "" || anchor == "" {
+		return pageURL
+	}
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return pageURL
+	}
+	u.Fragment = anchor
+	return u.String()
+}
+
+// recordPageLocation stores the page (or slide) number of a chunk that
+// covers a whole page, such as a PPT slide or an OCR'd scanned PDF page.
+func (dm *DocumentManager) recordPageLocation(docID string, chunkIndex, page int) {
+	if _, err := dm.db.Exec(
+		`INSERT OR REPLACE INTO chunk_locations (document_id, chunk_index, page) VALUES (?, ?, ?)`,
+		docID, chunkIndex, page,
+	); err != nil {
+		log.Printf("Warning: failed to record chunk location doc=%s chunk=%d: %v", docID, chunkIndex, err)
+	}
+}
+
+// LocateChunk returns where chunk chunkIndex of a document came from. Text
+// chunks report character offsets, page and heading path as recorded at
+// import time; video chunks report their time range; image chunks their
+// image. Translated chunks are located through their source chunk.
+func (dm *DocumentManager) LocateChunk(docID string, chunkIndex int) (*ChunkLocation, error) {
+	loc := &ChunkLocation{DocumentID: docID, ChunkIndex: chunkIndex}
+	var imageURL sql.NullString
+	var sourceURL, productID string
+	err := dm.db.QueryRow(
+		`SELECT COALESCE(type, ''), COALESCE(source_url, ''), COALESCE(product_id, '') FROM documents WHERE id = ?`, docID,
+	).Scan(&loc.DocumentType, &sourceURL, &productID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to query document: %w", err)
+	}
+	err = dm.chunkDB(productID).QueryRow(
+		`SELECT chunk_text, image_url FROM chunks WHERE document_id = ? AND chunk_index = ?`, docID, chunkIndex,
+	).Scan(&loc.Snippet, &imageURL)
+	if err == sql.ErrNoRows {
+		return nil, ErrChunkNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunk: %w", err)
+	}
+	loc.ImageURL = imageURL.String
+	loc.Snippet = textutil.Ellipsize(loc.Snippet, 200)
+
+	// Translations share the position of the chunk they were translated from
+	lookupIndex := chunkIndex
+	var source int
+	if err := dm.db.QueryRow(
+		`SELECT source_index FROM chunk_translations WHERE document_id = ? AND chunk_index = ?`,
+		docID, chunkIndex,
+	).Scan(&source); err == nil {
+		loc.SourceIndex = &source
+		lookupIndex = source
+	}
+
+	var page, start, end int
+	var headingPath, codeLangs string
+	err = dm.db.QueryRow(
+		`SELECT page, char_start, char_end, heading_path, COALESCE(anchor, ''), COALESCE(code_langs, '') FROM chunk_locations WHERE document_id = ? AND chunk_index = ?`,
+		docID, lookupIndex,
+	).Scan(&page, &start, &end, &headingPath, &loc.Anchor, &codeLangs)
+	switch {
+	case err == nil:
+		loc.Page = page
+		if start >= 0 && end >= start {
+			loc.CharStart, loc.CharEnd = &start, &end
+		}
+		if headingPath != "" {
+			loc.HeadingPath = strings.Split(headingPath, headingPathSep)
+		}
+		if codeLangs != "" {
+			loc.CodeLangs = strings.Split(codeLangs, ",")
+		}
+	case err == sql.ErrNoRows:
+		// Slides were always stored one chunk per slide at the slide's index
+		if loc.DocumentType == "ppt" && lookupIndex < 1000 {
+			loc.Page = lookupIndex + 1
+		}
+	default:
+		return nil, fmt.Errorf("failed to query chunk location: %w", err)
+	}
+
+	loc.URL = AnchoredURL(sourceURL, loc.Anchor)
+
+	var startTime, endTime float64
+	if err := dm.db.QueryRow(
+		`SELECT start_time, end_time FROM video_segments WHERE chunk_id = ? ORDER BY start_time LIMIT 1`,
+		fmt.Sprintf("%s-%d", docID, lookupIndex),
+	).Scan(&startTime, &endTime); err == nil {
+		loc.StartTime, loc.EndTime = &startTime, &endTime
+	}
+	return loc, nil
+}
@@ -5,7 +5,6 @@ package document
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
@@ -20,16 +19,24 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"askflow/internal/chunker"
 	"askflow/internal/config"
+	"askflow/internal/datadir"
 	"askflow/internal/embedding"
 	"askflow/internal/errlog"
+	"askflow/internal/idgen"
+	"askflow/internal/jobs"
+	"askflow/internal/llm"
 	"askflow/internal/parser"
+	"askflow/internal/textutil"
 	"askflow/internal/vectorstore"
 	"askflow/internal/video"
 
@@ -47,6 +54,8 @@ var supportedFileTypes = map[string]bool{
 	"ppt_legacy":   true,
 	"markdown":     true,
 	"html":         true,
+	"text":         true,
+	"csv":          true,
 	"mp4":          true,
 	"avi":          true,
 	"mkv":          true,
@@ -61,6 +70,7 @@ var videoFileTypes = map[string]bool{
 
 // LLMService defines the subset of LLM capabilities needed by DocumentManager.
 type LLMService interface {
+	Generate(prompt string, context []string, question string) (string, error)
 	GenerateWithImage(prompt string, context []string, question string, imageDataURL string) (string, error)
 }
 
@@ -75,9 +85,47 @@ type DocumentManager struct {
 	httpClient       *http.Client
 	videoConfig      config.VideoConfig
 	llmService       LLMService
+	// translateLanguages lists the languages chunks are translated into at ingestion time.
+	translateLanguages []string
+	// termRules returns a product's terminology rules for translation prompts.
+	termRules func(productID string) string
+	// scanConfig configures the optional malware scan of uploads; onQuarantine is
+	// notified when an upload is quarantined.
+	scanConfig   config.ScanConfig
+	onQuarantine func(doc DocumentInfo, reason string)
+	// onFailure is notified when processing a document fails.
+	onFailure func(doc DocumentInfo, reason string)
+	// onCallQA receives the Q&A pairs extracted from call recordings.
+	onCallQA func(docID, docName, productID string, pairs []CallQA) int
+	// embeddingPrice and llmPrice are prices per million tokens for import
+	// cost estimates.
+	embeddingPrice float64
+	llmPrice       float64
+	// imageMu serialises content-addressed image writes with reference cleanup.
+	imageMu sync.Mutex
 	// validateURL is a hook for URL validation (SSRF protection).
 	// Defaults to validateExternalURL. Tests can override to allow localhost.
 	validateURL func(string) error
+	// sourceCredentials authenticate source URL fetches, by domain.
+	sourceCredentials map[string]config.SourceCredential
+	// taggingEnabled turns on LLM tagging of processed documents; tagMu runs
+	// one tagging call at a time and tagWG tracks the pending ones.
+	taggingEnabled bool
+	tagMu          sync.Mutex
+	tagWG          sync.WaitGroup
+	// reindex is the status of the re-embedding job (see reindex.go),
+	// reindexCancel stops it and reindexJob is its entry in the job list;
+	// all are guarded by reindexMu.
+	reindexMu     sync.Mutex
+	reindex       ReindexStatus
+	reindexCancel context.CancelFunc
+	reindexJob    *jobs.Tracker
+	// jobQueue runs background processing; jobProgress holds the progress
+	// reporter and jobCtx the context of each document being processed,
+	// both guarded by mu.
+	jobQueue    *jobs.Queue
+	jobProgress map[string]*jobs.Progress
+	jobCtx      map[string]context.Context
 }
 
 // ImportStats holds statistics about the imported document content.
@@ -91,11 +139,39 @@ type DocumentInfo struct {
 	ID        string       `json:"id"`
 	Name      string       `json:"name"`
 	Type      string       `json:"type"`
-	Status    string       `json:"status"` // "processing", "success", "failed"
+	Status    string       `json:"status"` // "processing", "success", "failed", "password_protected", "quarantined"
 	Error     string       `json:"error,omitempty"`
 	CreatedAt time.Time    `json:"created_at"`
 	ProductID string       `json:"product_id"`
 	Stats     *ImportStats `json:"stats,omitempty"`
+	FileSize  int64        `json:"file_size,omitempty"`
+	// Optional effective period (inclusive dates, see EffectiveDateLayout).
+	// User queries only cite documents effective today.
+	EffectiveFrom  string `json:"effective_from,omitempty"`
+	EffectiveUntil string `json:"effective_until,omitempty"`
+	// Optional publish and unpublish times (ScheduleLayout). User queries do
+	// not cite the document before PublishAt or from UnpublishAt on.
+	PublishAt     string `json:"publish_at,omitempty"`
+	UnpublishAt   string `json:"unpublish_at,omitempty"`
+	ScheduledBy   string `json:"scheduled_by,omitempty"`   // admin notified when the schedule fires
+	ScheduleState string `json:"schedule_state,omitempty"` // ScheduleWaiting, SchedulePublished or ScheduleUnpublished
+	// How often answers cited the document and users opened those citations.
+	CitedCount  int        `json:"cited_count"`
+	ClickCount  int        `json:"click_count"`
+	LastCitedAt *time.Time `json:"last_cited_at,omitempty"`
+	// Review state of knowledge entries and answers; empty means published.
+	ReviewStatus string `json:"review_status,omitempty"`
+	// Set only while processing: position among running imports (1 = oldest),
+	// estimated total processing time and expected completion time.
+	QueuePosition       int        `json:"queue_position,omitempty"`
+	EstimatedSeconds    int        `json:"estimated_seconds,omitempty"`
+	EstimatedCompletion *time.Time `json:"estimated_completion,omitempty"`
+	// Language detected at ingestion, "" for mixed-language documents.
+	Language string `json:"language,omitempty"`
+	// Metadata extracted by LLM tagging, see TagDocument.
+	Category        string   `json:"category,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+	ProductMentions []string `json:"product_mentions,omitempty"`
 }
 
 
@@ -105,11 +181,42 @@ type UploadFileRequest struct {
 	FileData  []byte `json:"file_data"`
 	FileType  string `json:"file_type"`
 	ProductID string `json:"product_id"`
+	Password  string `json:"password,omitempty"` // optional password for encrypted PDF/Office files; never stored
+	// Optional effective period, see DocumentInfo.EffectiveFrom
+	EffectiveFrom  string `json:"effective_from,omitempty"`
+	EffectiveUntil string `json:"effective_until,omitempty"`
+	// Optional publish schedule, see DocumentInfo.PublishAt. ScheduledBy is
+	// the admin notified when it fires.
+	PublishAt   string `json:"publish_at,omitempty"`
+	UnpublishAt string `json:"unpublish_at,omitempty"`
+	ScheduledBy string `json:"scheduled_by,omitempty"`
+	// CallRecording marks a recorded support call (audio or video): Q&A pairs
+	// are extracted from it as draft knowledge entries instead of indexing it.
+	CallRecording bool `json:"call_recording,omitempty"`
+}
+
+// canceledMessage is the error recorded for documents whose processing was
+// canceled from the job list.
+const canceledMessage = "文档处理已取消"
+
+// failureStatus maps a processing error to the document status to record:
+// password problems get a dedicated status so admins know to re-import with a password.
+func failureStatus(err error) string {
+	if parser.IsPasswordError(err) {
+		return "password_protected"
+	}
+	return "failed"
 }
 
 func (dm *DocumentManager) UploadFile(req UploadFileRequest) (*DocumentInfo, error) {
 	fileType := strings.ToLower(req.FileType)
-	if !supportedFileTypes[fileType] {
+	if req.CallRecording {
+		if !IsCallRecordingType(fileType) {
+			return nil, fmt.Errorf("通话录音仅支持 mp3、wav、m4a 音频或视频文件")
+		}
+	} else if audioFileTypes[fileType] {
+		return nil, fmt.Errorf("音频文件仅支持作为通话录音导入")
+	} else if !supportedFileTypes[fileType] {
 		return nil, fmt.Errorf("不支持的文件格式")
 	}
 
@@ -126,13 +233,34 @@ func (dm *DocumentManager) UploadFile(req UploadFileRequest) (*DocumentInfo, err
 		return nil, fmt.Errorf("文件内容为空")
 	}
 
+	effectiveFrom, effectiveUntil, err := NormalizeEffectiveDates(req.EffectiveFrom, req.EffectiveUntil)
+	if err != nil {
+		return nil, err
+	}
+	publishAt, unpublishAt, err := NormalizeSchedule(req.PublishAt, req.UnpublishAt)
+	if err != nil {
+		return nil, err
+	}
+	scheduledBy := req.ScheduledBy
+	if publishAt == "" && unpublishAt == "" {
+		scheduledBy = ""
+	}
+
+	// Reject content that does not match the extension (e.g. a renamed executable)
+	if err := checkFileContent(fileType, req.FileData); err != nil {
+		log.Printf("[Upload] rejected %q: %v", req.FileName, err)
+		errlog.Logf("[Upload] content/extension mismatch file=%q declared=%s detected=%q size=%d",
+			req.FileName, fileType, sniffContent(req.FileData), len(req.FileData))
+		return nil, err
+	}
+
 	// File-level dedup: check if identical file content already exists (any status except failed)
 	fHash := fileHash(req.FileData)
 	if existingID := dm.findDocumentByContentHash(fHash); existingID != "" {
 		return nil, fmt.Errorf("文档内容重复，与已有文档相同")
 	}
 
-	docID, err := generateID()
+	docID, err := idgen.New()
 	if err != nil {
 		return nil, err
 	}
@@ -144,12 +272,26 @@ func (dm *DocumentManager) UploadFile(req UploadFileRequest) (*DocumentInfo, err
 		Status:    "processing",
 		CreatedAt: time.Now(),
 		ProductID: req.ProductID,
+		FileSize:  int64(len(req.FileData)),
+
+		EffectiveFrom:  effectiveFrom,
+		EffectiveUntil: effectiveUntil,
+
+		PublishAt:     publishAt,
+		UnpublishAt:   unpublishAt,
+		ScheduledBy:   scheduledBy,
+		ScheduleState: ScheduleState(publishAt, unpublishAt, time.Now()),
 	}
 
 	if err := dm.insertDocument(doc, fHash); err != nil {
 		return nil, fmt.Errorf("failed to insert document record: %w", err)
 	}
 
+	// Optional malware scan: flagged files are quarantined and never processed
+	if reason := dm.scanUpload(doc, req.FileData); reason != "" {
+		return doc, nil
+	}
+
 	// Save original file to disk
 	if err := dm.saveOriginalFile(docID, req.FileName, req.FileData); err != nil {
 		// Non-fatal: log but continue processing
@@ -157,75 +299,41 @@ func (dm *DocumentManager) UploadFile(req UploadFileRequest) (*DocumentInfo, err
 		errlog.Logf("[Upload] failed to save original file %q (doc=%s): %v", req.FileName, docID, err)
 	}
 
+	if req.CallRecording {
+		log.Printf("[Async] Starting call recording processing for doc=%s file=%q", docID, req.FileName)
+		dm.processAsync(docID, req.FileName, func(ctx context.Context) error {
+			return dm.processCallRecording(ctx, docID, req.FileName, req.FileData, req.ProductID)
+		})
+		docs := []DocumentInfo{*doc}
+		dm.annotateProcessing(docs)
+		return &docs[0], nil
+	}
+
 	// For video, PDF, and PPT files, process asynchronously to avoid HTTP timeout.
 	// PDF files (especially scanned PDFs) may require per-page OCR via LLM vision API.
 	// PPT files require per-slide rendering which can take 20+ seconds for large decks.
 	if videoFileTypes[fileType] || fileType == "pdf" || fileType == "ppt" || fileType == "ppt_legacy" {
-		go func() {
-			defer func() {
-				if r := recover(); r != nil {
-					dm.updateDocumentStatus(docID, "failed", fmt.Sprintf("panic: %v", r))
-					log.Printf("Async processing panic for %s: %v", docID, r)
-					errlog.Logf("[Async] panic in outer goroutine for doc=%s file=%q: %v", docID, req.FileName, r)
-				}
-			}()
-
-			log.Printf("[Async] Starting async processing for doc=%s file=%q type=%s", docID, req.FileName, fileType)
-
-			// Use configurable timeout for async processing
-			dm.mu.RLock()
-			timeoutMin := dm.videoConfig.ProcessingTimeoutMin
-			dm.mu.RUnlock()
-			if timeoutMin <= 0 {
-				timeoutMin = 120
-			}
-			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutMin)*time.Minute)
-			defer cancel()
-
-			done := make(chan error, 1)
-			go func() {
-				defer func() {
-					if r := recover(); r != nil {
-						log.Printf("[Async] panic in inner goroutine for doc=%s: %v", docID, r)
-						errlog.Logf("[Async] panic in inner goroutine for doc=%s file=%q: %v", docID, req.FileName, r)
-						done <- fmt.Errorf("panic in async processing: %v", r)
-					}
-				}()
-				if videoFileTypes[fileType] {
-					log.Printf("[Async] Processing video for doc=%s", docID)
-					done <- dm.processVideo(docID, req.FileName, req.FileData, req.ProductID)
-				} else {
-					log.Printf("[Async] Processing file (PDF/PPT) for doc=%s", docID)
-					_, processErr := dm.processFile(docID, req.FileName, req.FileData, fileType, req.ProductID)
-					log.Printf("[Async] processFile completed for doc=%s, err=%v", docID, processErr)
-					done <- processErr
-				}
-			}()
-
-			select {
-			case processErr := <-done:
-				if processErr != nil {
-					dm.updateDocumentStatus(docID, "failed", processErr.Error())
-					log.Printf("Async processing failed for %s: %v", docID, processErr)
-					errlog.Logf("[Async] processing failed for doc=%s file=%q: %v", docID, req.FileName, processErr)
-				} else {
-					dm.updateDocumentStatus(docID, "success", "")
-					log.Printf("Async processing completed for %s", docID)
-				}
-			case <-ctx.Done():
-				dm.updateDocumentStatus(docID, "failed", fmt.Sprintf("文档处理超时（%d分钟）", timeoutMin))
-				log.Printf("Async processing timed out for %s (%d min)", docID, timeoutMin)
-				errlog.Logf("[Async] processing timed out for doc=%s file=%q (%d min)", docID, req.FileName, timeoutMin)
+		log.Printf("[Async] Starting async processing for doc=%s file=%q type=%s", docID, req.FileName, fileType)
+		dm.processAsync(docID, req.FileName, func(ctx context.Context) error {
+			if videoFileTypes[fileType] {
+				log.Printf("[Async] Processing video for doc=%s", docID)
+				return dm.processVideo(docID, req.FileName, req.FileData, req.ProductID)
 			}
-		}()
-		return doc, nil
+			log.Printf("[Async] Processing file (PDF/PPT) for doc=%s", docID)
+			_, processErr := dm.processFile(docID, req.FileName, req.FileData, fileType, req.ProductID, req.Password)
+			log.Printf("[Async] processFile completed for doc=%s, err=%v", docID, processErr)
+			return processErr
+		})
+		docs := []DocumentInfo{*doc}
+		dm.annotateProcessing(docs)
+		return &docs[0], nil
 	}
 
 	// Non-video, non-PDF files: process synchronously
-	stats, processErr := dm.processFile(docID, req.FileName, req.FileData, fileType, req.ProductID)
+	stats, processErr := dm.processFile(docID, req.FileName, req.FileData, fileType, req.ProductID, req.Password)
 	if processErr != nil {
-		dm.updateDocumentStatus(docID, "failed", processErr.Error())
-		doc.Status = "failed"
+		doc.Status = failureStatus(processErr)
+		dm.updateDocumentStatus(docID, doc.Status, processErr.Error())
 		doc.Error = processErr.Error()
 		errlog.Logf("[Upload] file processing failed for doc=%s file=%q type=%s: %v", docID, req.FileName, fileType, processErr)
 		return doc, nil
@@ -238,6 +346,144 @@ func (dm *DocumentManager) UploadFile(req UploadFileRequest) (*DocumentInfo, err
 }
 
 
+// SetJobQueue makes background processing run as jobs of q, which bounds
+// how many documents are processed at once and lets admins cancel them.
+func (dm *DocumentManager) SetJobQueue(q *jobs.Queue) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.jobQueue = q
+}
+
+// reportProgress reports the processing progress of a document to its job.
+func (dm *DocumentManager) reportProgress(docID string, done, total int, step string) {
+	dm.mu.RLock()
+	p := dm.jobProgress[docID]
+	dm.mu.RUnlock()
+	p.Set(done, total, step)
+}
+
+// canceled returns the context error of the job processing docID once that
+// job has been canceled or timed out, and nil otherwise. Processing loops
+// check it so they stop instead of storing chunks for an abandoned job.
+func (dm *DocumentManager) canceled(docID string) error {
+	dm.mu.RLock()
+	ctx := dm.jobCtx[docID]
+	dm.mu.RUnlock()
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// processAsync runs process in the background with the configured processing
+// timeout and records the outcome as the document status. name labels the
+// document in logs and in the job list. process should stop when its
+// context is done; the context is also registered for docID so processing
+// code that does not take it checks canceled before storing chunks. Chunks
+// stored by a job that was canceled or timed out are removed once process
+// returns.
+func (dm *DocumentManager) processAsync(docID, name string, process func(ctx context.Context) error) {
+	work := func(jobCtx context.Context, p *jobs.Progress) error {
+		dm.mu.Lock()
+		if dm.jobProgress == nil {
+			dm.jobProgress = make(map[string]*jobs.Progress)
+		}
+		dm.jobProgress[docID] = p
+		dm.mu.Unlock()
+		defer func() {
+			dm.mu.Lock()
+			delete(dm.jobProgress, docID)
+			dm.mu.Unlock()
+		}()
+
+		// Use configurable timeout for async processing
+		dm.mu.RLock()
+		timeoutMin := dm.videoConfig.ProcessingTimeoutMin
+		dm.mu.RUnlock()
+		if timeoutMin <= 0 {
+			timeoutMin = 120
+		}
+		ctx, cancel := context.WithTimeout(jobCtx, time.Duration(timeoutMin)*time.Minute)
+		defer cancel()
+		dm.mu.Lock()
+		if dm.jobCtx == nil {
+			dm.jobCtx = make(map[string]context.Context)
+		}
+		dm.jobCtx[docID] = ctx
+		dm.mu.Unlock()
+
+		done := make(chan error, 1)
+		go func() {
+			// The registration outlives the select below so the work still
+			// sees the cancellation until it has actually stopped.
+			defer func() {
+				dm.mu.Lock()
+				if dm.jobCtx[docID] == ctx {
+					delete(dm.jobCtx, docID)
+				}
+				dm.mu.Unlock()
+				if ctx.Err() != nil {
+					if err := dm.vectorStore.DeleteByDocID(docID); err != nil {
+						log.Printf("Warning: failed to remove chunks of abandoned job doc=%s: %v", docID, err)
+					}
+				}
+			}()
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("[Async] panic in inner goroutine for doc=%s: %v", docID, r)
+					errlog.Logf("[Async] panic in inner goroutine for doc=%s file=%q: %v", docID, name, r)
+					done <- fmt.Errorf("panic in async processing: %v", r)
+				}
+			}()
+			done <- process(ctx)
+		}()
+
+		select {
+		case processErr := <-done:
+			if processErr != nil {
+				dm.updateDocumentStatus(docID, failureStatus(processErr), processErr.Error())
+				log.Printf("Async processing failed for %s: %v", docID, processErr)
+				errlog.Logf("[Async] processing failed for doc=%s file=%q: %v", docID, name, processErr)
+				return processErr
+			}
+			dm.updateDocumentStatus(docID, "success", "")
+			log.Printf("Async processing completed for %s", docID)
+			return nil
+		case <-ctx.Done():
+			if jobCtx.Err() != nil {
+				dm.updateDocumentStatus(docID, "failed", canceledMessage)
+				log.Printf("Async processing canceled for %s", docID)
+				return jobCtx.Err()
+			}
+			dm.updateDocumentStatus(docID, "failed", fmt.Sprintf("文档处理超时（%d分钟）", timeoutMin))
+			log.Printf("Async processing timed out for %s (%d min)", docID, timeoutMin)
+			errlog.Logf("[Async] processing timed out for doc=%s file=%q (%d min)", docID, name, timeoutMin)
+			return fmt.Errorf("文档处理超时（%d分钟）", timeoutMin)
+		}
+	}
+
+	dm.mu.RLock()
+	q := dm.jobQueue
+	dm.mu.RUnlock()
+	if q != nil {
+		_, err := q.Submit(jobs.TypeDocument, docID, name, work)
+		if err == nil {
+			return
+		}
+		log.Printf("[Async] failed to queue doc=%s, processing directly: %v", docID, err)
+	}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				dm.updateDocumentStatus(docID, "failed", fmt.Sprintf("panic: %v", r))
+				log.Printf("Async processing panic for %s: %v", docID, r)
+				errlog.Logf("[Async] panic in outer goroutine for doc=%s file=%q: %v", docID, name, r)
+			}
+		}()
+		work(context.Background(), nil)
+	}()
+}
+
 // UploadURLRequest represents a URL upload request.
 type UploadURLRequest struct {
 	URL       string `json:"url"`
@@ -252,7 +498,8 @@ func NewDocumentManager(
 	vs vectorstore.VectorStore,
 	db *sql.DB,
 ) *DocumentManager {
-	return &DocumentManager{
+	vs.SetEmbeddingModel(embeddingModelName(es))
+	dm := &DocumentManager{
 		parser:           p,
 		chunker:          c,
 		embeddingService: es,
@@ -280,19 +527,11 @@ func NewDocumentManager(
 					return dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].IP.String(), port))
 				},
 			},
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				if len(via) >= 5 {
-					return fmt.Errorf("too many redirects")
-				}
-				// Re-validate each redirect target against SSRF rules
-				if err := validateExternalURL(req.URL.String()); err != nil {
-					return fmt.Errorf("redirect blocked: %w", err)
-				}
-				return nil
-			},
 		},
 		validateURL: validateExternalURL,
 	}
+	dm.httpClient.CheckRedirect = dm.checkRedirect
+	return dm
 }
 
 // UpdateEmbeddingService replaces the embedding service (used after config change).
@@ -300,6 +539,19 @@ func (dm *DocumentManager) UpdateEmbeddingService(es embedding.EmbeddingService)
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
 	dm.embeddingService = es
+	dm.vectorStore.SetEmbeddingModel(embeddingModelName(es))
+}
+
+// embeddingModelName returns the model name of an API embedding service, or
+// "" when it is unknown. Wrappers such as the budget meter are looked through.
+func embeddingModelName(es embedding.EmbeddingService) string {
+	if w, ok := es.(interface{ Unwrap() embedding.EmbeddingService }); ok {
+		es = w.Unwrap()
+	}
+	if api, ok := es.(*embedding.APIEmbeddingService); ok {
+		return api.ModelName
+	}
+	return ""
 }
 
 // SetVideoConfig updates the video processing configuration.
@@ -309,6 +561,12 @@ func (dm *DocumentManager) SetVideoConfig(cfg config.VideoConfig) {
 	dm.videoConfig = cfg
 }
 
+// SetHTMLConfig updates how HTML pages and URL imports are reduced to their
+// main content.
+func (dm *DocumentManager) SetHTMLConfig(cfg config.HTMLConfig) {
+	dm.parser.SetHTMLOptions(parser.HTMLOptions{MainContent: cfg.MainContentEnabled, Selectors: cfg.Selectors})
+}
+
 // SetLLMService sets the LLM service for OCR on scanned PDFs.
 func (dm *DocumentManager) SetLLMService(ls LLMService) {
 	dm.mu.Lock()
@@ -317,8 +575,9 @@ func (dm *DocumentManager) SetLLMService(ls LLMService) {
 }
 
 // ocrImageViaLLM uses the LLM vision API to extract text from an image.
+// lang selects the prompt language (see ocrLanguageFor).
 // The image is resized before sending to reduce payload and improve throughput.
-func (dm *DocumentManager) ocrImageViaLLM(imgData []byte) (string, error) {
+func (dm *DocumentManager) ocrImageViaLLM(imgData []byte, lang string) (string, error) {
 	dm.mu.RLock()
 	ls := dm.llmService
 	dm.mu.RUnlock()
@@ -328,8 +587,8 @@ func (dm *DocumentManager) ocrImageViaLLM(imgData []byte) (string, error) {
 
 	resized := resizeImageForOCR(imgData)
 	dataURL := imageToBase64DataURL(resized)
-	prompt := "你是一个OCR文字识别助手。请仔细识别图片中的所有文字内容，按原始排版顺序输出纯文本。只输出识别到的文字，不要添加任何解释或描述。如果图片中没有文字，输出空字符串。"
-	text, err := ls.GenerateWithImage(prompt, nil, "请识别图片中的所有文字", dataURL)
+	prompt := promptFor(ocrPrompts, lang)
+	text, err := llm.ForTask(ls, config.LLMTaskVision).GenerateWithImage(prompt.system, nil, prompt.question, dataURL)
 	if err != nil {
 		return "", err
 	}
@@ -339,8 +598,9 @@ func (dm *DocumentManager) ocrImageViaLLM(imgData []byte) (string, error) {
 // describeKeyframeViaLLM uses the LLM vision API to both extract text (OCR) and
 // generate a scene description for a video keyframe image. The combined result
 // provides richer searchable content than OCR alone.
+// lang selects the prompt language (see ocrLanguageFor).
 // The image is resized before sending to reduce payload and improve throughput.
-func (dm *DocumentManager) describeKeyframeViaLLM(imgData []byte) (string, error) {
+func (dm *DocumentManager) describeKeyframeViaLLM(imgData []byte, lang string) (string, error) {
 	dm.mu.RLock()
 	ls := dm.llmService
 	dm.mu.RUnlock()
@@ -350,14 +610,8 @@ func (dm *DocumentManager) describeKeyframeViaLLM(imgData []byte) (string, error
 
 	resized := resizeImageForOCR(imgData)
 	dataURL := imageToBase64DataURL(resized)
-	prompt := "你是一个视频内容分析助手。请分析这张视频关键帧图片，完成以下两个任务：\n" +
-		"1. 文字识别：识别图片中出现的所有文字内容（如标题、字幕、界面文字、标签等），按原始排版顺序输出。\n" +
-		"2. 场景描述：用简洁的语言描述画面中的主要内容、场景、人物动作、展示的产品或界面等关键信息。\n\n" +
-		"请按以下格式输出：\n" +
-		"[文字内容]\n（识别到的文字，如果没有文字则写\"无\"）\n\n" +
-		"[场景描述]\n（对画面内容的简要描述）"
-
-	text, err := ls.GenerateWithImage(prompt, nil, "请识别图片中的文字并描述画面内容", dataURL)
+	prompt := promptFor(keyframePrompts, lang)
+	text, err := llm.ForTask(ls, config.LLMTaskVision).GenerateWithImage(prompt.system, nil, prompt.question, dataURL)
 	if err != nil {
 		return "", err
 	}
@@ -372,27 +626,38 @@ func (dm *DocumentManager) describeKeyframeViaLLM(imgData []byte) (string, error
 const ocrImageMaxEdge = 1536
 
 func resizeImageForOCR(imgData []byte) []byte {
+	if resized := resizeToMaxEdge(imgData, ocrImageMaxEdge); resized != nil {
+		return resized
+	}
+	return imgData
+}
+
+// resizeToMaxEdge scales an image down so its longest edge is at most maxEdge
+// pixels and returns it JPEG-encoded. Transparent areas are flattened onto
+// white. Returns nil if the image cannot be decoded, is already within bounds,
+// or encoding fails, so callers can fall back to the original data.
+func resizeToMaxEdge(imgData []byte, maxEdge int) []byte {
 	src, _, err := image.Decode(bytes.NewReader(imgData))
 	if err != nil {
-		return imgData // can't decode → send as-is
+		return nil
 	}
 
 	bounds := src.Bounds()
 	w, h := bounds.Dx(), bounds.Dy()
 
 	// Already within target size
-	if w <= ocrImageMaxEdge && h <= ocrImageMaxEdge {
-		return imgData
+	if w <= maxEdge && h <= maxEdge {
+		return nil
 	}
 
 	// Calculate new dimensions preserving aspect ratio
 	var newW, newH int
 	if w >= h {
-		newW = ocrImageMaxEdge
-		newH = h * ocrImageMaxEdge / w
+		newW = maxEdge
+		newH = h * maxEdge / w
 	} else {
-		newH = ocrImageMaxEdge
-		newW = w * ocrImageMaxEdge / h
+		newH = maxEdge
+		newW = w * maxEdge / h
 	}
 	if newW < 1 {
 		newW = 1
@@ -402,11 +667,12 @@ func resizeImageForOCR(imgData []byte) []byte {
 	}
 
 	dst := image.NewRGBA(image.Rect(0, 0, newW, newH))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
 	draw.BiLinear.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
 
 	var buf bytes.Buffer
 	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
-		return imgData // encode failed → send original
+		return nil
 	}
 	return buf.Bytes()
 }
@@ -513,15 +779,6 @@ func normalizeFileType(ft string) string {
 	}
 }
 
-// generateID creates a random UUID-like hex string.
-func generateID() (string, error) {
-	b := make([]byte, 16)
-	if _, err := rand.Read(b); err != nil {
-		return "", fmt.Errorf("failed to generate ID: %w", err)
-	}
-	return hex.EncodeToString(b), nil
-}
-
 // contentHash computes a SHA-256 hash of the given text for deduplication.
 func contentHash(text string) string {
 	h := sha256.Sum256([]byte(text))
@@ -541,7 +798,7 @@ func fileHash(data []byte) string {
 func (dm *DocumentManager) findDocumentByContentHash(hash string) string {
 	var docID string
 	err := dm.db.QueryRow(
-		`SELECT id FROM documents WHERE content_hash = ? AND status != 'failed' LIMIT 1`, hash,
+		`SELECT id FROM documents WHERE content_hash = ? AND status NOT IN ('failed', 'password_protected', 'quarantined') LIMIT 1`, hash,
 	).Scan(&docID)
 	if err != nil {
 		return ""
@@ -549,10 +806,12 @@ func (dm *DocumentManager) findDocumentByContentHash(hash string) string {
 	return docID
 }
 
-// getExistingChunkEmbeddings looks up embeddings for chunk texts that already exist in the DB.
+// getExistingChunkEmbeddings looks up embeddings for chunk texts that already exist in the DB
+// holding the chunks of productID (see chunkDB).
 // Returns a map of chunk_text -> embedding vector for reuse, saving API calls.
 // Uses batch queries to minimize database round-trips.
-func (dm *DocumentManager) getExistingChunkEmbeddings(texts []string) map[string][]float64 {
+func (dm *DocumentManager) getExistingChunkEmbeddings(texts []string, productID string) map[string][]float64 {
+	db := dm.chunkDB(productID)
 	result := make(map[string][]float64)
 	if len(texts) == 0 {
 		return result
@@ -578,7 +837,7 @@ func (dm *DocumentManager) getExistingChunkEmbeddings(texts []string) map[string
 			`SELECT chunk_text, embedding FROM chunks WHERE chunk_text IN (%s)`,
 			strings.Join(placeholders, ","),
 		)
-		rows, err := dm.db.Query(query, args...)
+		rows, err := db.Query(query, args...)
 		if err != nil {
 			continue
 		}
@@ -607,8 +866,11 @@ func (dm *DocumentManager) UploadURL(req UploadURLRequest) (*DocumentInfo, error
 	if req.URL == "" {
 		return nil, fmt.Errorf("URL不能为空")
 	}
+	if kind := mediaURLKind(req.URL); kind != "" {
+		return dm.uploadMediaURL(req, kind)
+	}
 
-	docID, err := generateID()
+	docID, err := idgen.New()
 	if err != nil {
 		return nil, err
 	}
@@ -642,6 +904,104 @@ func (dm *DocumentManager) UploadURL(req UploadURLRequest) (*DocumentInfo, error
 	return doc, nil
 }
 
+// ImportWebContentRequest describes web content that was fetched elsewhere
+// (e.g. a feed entry) and should be stored as a document.
+type ImportWebContentRequest struct {
+	Name        string // document name shown in the admin list and citations
+	Type        string // document type recorded in the documents table, e.g. "feed"
+	BaseURL     string // source URL, used to resolve relative links in HTML
+	Content     []byte
+	ContentType string // optional; HTML is also detected by sniffing
+	ProductID   string
+}
+
+// ImportWebContent stores already-fetched HTML or plain-text content as a document,
+// following the same chunk → embed → store path (and content dedup) as UploadURL.
+func (dm *DocumentManager) ImportWebContent(req ImportWebContentRequest) (*DocumentInfo, error) {
+	if len(req.Content) == 0 {
+		return nil, fmt.Errorf("内容为空")
+	}
+	docID, err := idgen.New()
+	if err != nil {
+		return nil, err
+	}
+	name := req.Name
+	if name == "" {
+		name = req.BaseURL
+	}
+	doc := &DocumentInfo{
+		ID:        docID,
+		Name:      name,
+		Type:      req.Type,
+		Status:    "processing",
+		CreatedAt: time.Now(),
+		ProductID: req.ProductID,
+	}
+	if err := dm.insertDocument(doc, ""); err != nil {
+		return nil, fmt.Errorf("failed to insert document record: %w", err)
+	}
+
+	stats, err := dm.processWebContent(docID, name, req.BaseURL, req.Content, req.ContentType, req.ProductID)
+	if err != nil {
+		dm.updateDocumentStatus(docID, "failed", err.Error())
+		doc.Status = "failed"
+		doc.Error = err.Error()
+		errlog.Logf("[Upload] web content processing failed for doc=%s url=%q: %v", docID, req.BaseURL, err)
+		return doc, nil
+	}
+
+	dm.updateDocumentStatus(docID, "success", "")
+	doc.Status = "success"
+	doc.Stats = stats
+	return doc, nil
+}
+
+// WebContentHash returns the hash ImportWebContent dedupes web content by
+// (that of the parsed text for HTML), and the ID of an existing document
+// with the same content. The hash is empty when there is no text.
+func (dm *DocumentManager) WebContentHash(body []byte, contentType, baseURL string) (hash, existingID string, err error) {
+	text := strings.TrimSpace(string(body))
+	if text != "" && (strings.Contains(contentType, "text/html") || looksLikeHTML(text)) {
+		result, err := dm.parser.ParseWithBaseURL(body, "html", baseURL)
+		if err != nil {
+			return "", "", fmt.Errorf("HTML parse error: %w", err)
+		}
+		text = result.Text
+	}
+	if text == "" {
+		return "", "", nil
+	}
+	hash = contentHash(text)
+	return hash, dm.findDocumentByContentHash(hash), nil
+}
+
+// ValidateExternalURL applies the SSRF checks of URL imports to a URL that
+// is fetched by other means, e.g. a Git repository cloned with git.
+func (dm *DocumentManager) ValidateExternalURL(url string) error {
+	return dm.validateURL(url)
+}
+
+// FetchExternalURL downloads an external HTTP(S) resource with the same SSRF
+// protection used for URL imports. At most maxBytes are read.
+func (dm *DocumentManager) FetchExternalURL(url string, maxBytes int64) ([]byte, string, error) {
+	if err := dm.validateURL(url); err != nil {
+		return nil, "", err
+	}
+	resp, err := dm.getSourceURL(url)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("URL returned HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read URL content: %w", err)
+	}
+	return body, resp.Header.Get("Content-Type"), nil
+}
+
 // DeleteDocument removes a document's vectors from the vector store, its
 // record from the documents table, and the original file from disk.
 // Uses a transaction for atomicity of database operations.
@@ -666,6 +1026,27 @@ func (dm *DocumentManager) DeleteDocument(docID string) error {
 	if _, err := tx.Exec(`DELETE FROM video_segments WHERE document_id = ?`, docID); err != nil {
 		return fmt.Errorf("failed to delete video segments: %w", err)
 	}
+	if _, err := tx.Exec(`DELETE FROM video_chapters WHERE document_id = ?`, docID); err != nil {
+		return fmt.Errorf("failed to delete video chapters: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM chunk_translations WHERE document_id = ?`, docID); err != nil {
+		return fmt.Errorf("failed to delete chunk translations: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM chunk_locations WHERE document_id = ?`, docID); err != nil {
+		return fmt.Errorf("failed to delete chunk locations: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM document_texts WHERE document_id = ?`, docID); err != nil {
+		return fmt.Errorf("failed to delete document text: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM citation_stats WHERE document_id = ?`, docID); err != nil {
+		return fmt.Errorf("failed to delete citation stats: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM document_tags WHERE document_id = ?`, docID); err != nil {
+		return fmt.Errorf("failed to delete document tags: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM document_versions WHERE document_id = ?`, docID); err != nil {
+		return fmt.Errorf("failed to delete document versions: %w", err)
+	}
 	if _, err := tx.Exec(`DELETE FROM documents WHERE id = ?`, docID); err != nil {
 		return fmt.Errorf("failed to delete document record: %w", err)
 	}
@@ -674,9 +1055,12 @@ func (dm *DocumentManager) DeleteDocument(docID string) error {
 		return fmt.Errorf("failed to commit delete transaction: %w", err)
 	}
 
-	// Remove original file directory (after successful DB commit)
-	dir := filepath.Join(".", "data", "uploads", docID)
+	// Remove original file directory and images no other document uses (after successful DB commit)
+	dir := datadir.Path("uploads", docID)
 	os.RemoveAll(dir)
+	os.RemoveAll(datadir.Path("versions", docID))
+	os.RemoveAll(quarantineDir(docID))
+	dm.releaseImages(docID)
 	return nil
 }
 
@@ -685,13 +1069,17 @@ func (dm *DocumentManager) ListDocuments(productID string) ([]DocumentInfo, erro
 	var rows *sql.Rows
 	var err error
 
+	const listQuery = `SELECT d.id, d.name, d.type, d.status, d.error, d.created_at, d.product_id, COALESCE(d.file_size, 0),
+			COALESCE(d.effective_from, ''), COALESCE(d.effective_until, ''),
+			COALESCE(cs.cited, 0), COALESCE(cs.clicked, 0), cs.last_cited_at, COALESCE(d.review_status, ''), COALESCE(d.category, ''),
+			COALESCE(d.publish_at, ''), COALESCE(d.unpublish_at, ''), COALESCE(d.scheduled_by, ''), COALESCE(d.language, '')
+		FROM documents d
+		LEFT JOIN (SELECT document_id, SUM(cited) AS cited, SUM(clicked) AS clicked, MAX(last_cited_at) AS last_cited_at
+		           FROM citation_stats GROUP BY document_id) cs ON cs.document_id = d.id`
 	if productID != "" {
-		rows, err = dm.db.Query(
-			`SELECT id, name, type, status, error, created_at, product_id FROM documents WHERE product_id = ? OR product_id = '' ORDER BY created_at DESC`,
-			productID,
-		)
+		rows, err = dm.db.Query(listQuery+` WHERE d.status != ? AND (d.product_id = ? OR d.product_id = '') ORDER BY d.created_at DESC`, StatusStaging, productID)
 	} else {
-		rows, err = dm.db.Query(`SELECT id, name, type, status, error, created_at, product_id FROM documents ORDER BY created_at DESC`)
+		rows, err = dm.db.Query(listQuery+` WHERE d.status != ? ORDER BY d.created_at DESC`, StatusStaging)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to query documents: %w", err)
@@ -703,9 +1091,15 @@ func (dm *DocumentManager) ListDocuments(productID string) ([]DocumentInfo, erro
 		var d DocumentInfo
 		var errStr sql.NullString
 		var createdAt sql.NullTime
-		if err := rows.Scan(&d.ID, &d.Name, &d.Type, &d.Status, &errStr, &createdAt, &d.ProductID); err != nil {
+		var lastCited sql.NullString
+		if err := rows.Scan(&d.ID, &d.Name, &d.Type, &d.Status, &errStr, &createdAt, &d.ProductID, &d.FileSize, &d.EffectiveFrom, &d.EffectiveUntil,
+			&d.CitedCount, &d.ClickCount, &lastCited, &d.ReviewStatus, &d.Category, &d.PublishAt, &d.UnpublishAt, &d.ScheduledBy, &d.Language); err != nil {
 			return nil, fmt.Errorf("failed to scan document row: %w", err)
 		}
+		d.ScheduleState = ScheduleState(d.PublishAt, d.UnpublishAt, time.Now())
+		if t, ok := parseCitationTime(lastCited); ok {
+			d.LastCitedAt = &t
+		}
 		if errStr.Valid {
 			d.Error = errStr.String
 		}
@@ -717,6 +1111,11 @@ func (dm *DocumentManager) ListDocuments(productID string) ([]DocumentInfo, erro
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating document rows: %w", err)
 	}
+	rows.Close()
+	dm.annotateProcessing(docs)
+	if err := dm.annotateTags(docs); err != nil {
+		return nil, err
+	}
 	return docs, nil
 }
 
@@ -725,8 +1124,8 @@ func (dm *DocumentManager) ListDocuments(productID string) ([]DocumentInfo, erro
 // It performs content-level deduplication: if a document with the same content
 // hash already exists, the upload is skipped to save API calls.
 // For scanned PDFs (no text but images present), it uses LLM vision OCR to extract text.
-func (dm *DocumentManager) processFile(docID, docName string, fileData []byte, fileType string, productID string) (*ImportStats, error) {
-	result, err := dm.parser.Parse(fileData, fileType)
+func (dm *DocumentManager) processFile(docID, docName string, fileData []byte, fileType string, productID string, password string) (*ImportStats, error) {
+	result, err := dm.parser.ParseWithPassword(fileData, fileType, password)
 	if err != nil {
 		errlog.Logf("[Parse] failed to parse doc=%s file=%q type=%s: %v", docID, docName, fileType, err)
 		return nil, fmt.Errorf("parse error: %w", err)
@@ -742,7 +1141,8 @@ func (dm *DocumentManager) processFile(docID, docName string, fileData []byte, f
 		hasLLM := dm.llmService != nil
 		dm.mu.RUnlock()
 		if hasLLM {
-			log.Printf("扫描型PDF检测: doc=%s, 尝试OCR识别 %d 页图片", docID, len(result.Images))
+			ocrLang := dm.ocrLanguageFor(productID)
+			log.Printf("扫描型PDF检测: doc=%s, 尝试OCR识别 %d 页图片 (语言=%s)", docID, len(result.Images), ocrLang)
 
 			// Concurrent OCR with worker pool (up to 3 concurrent LLM calls)
 			type ocrPageResult struct {
@@ -759,16 +1159,18 @@ func (dm *DocumentManager) processFile(docID, docName string, fileData []byte, f
 			}
 
 			var ocrWg sync.WaitGroup
+			var ocrDone atomic.Int32
 			for w := 0; w < workerCount; w++ {
 				ocrWg.Add(1)
 				go func() {
 					defer ocrWg.Done()
 					for i := range pageCh {
 						img := result.Images[i]
-						if len(img.Data) == 0 {
+						if len(img.Data) == 0 || dm.canceled(docID) != nil {
 							continue
 						}
-						ocrText, ocrErr := dm.ocrImageViaLLM(img.Data)
+						ocrText, ocrErr := dm.ocrImageViaLLM(img.Data, ocrLang)
+						dm.reportProgress(docID, int(ocrDone.Add(1)), len(result.Images), "OCR识别")
 						if ocrErr != nil {
 							log.Printf("Warning: OCR第%d页失败: %v", i+1, ocrErr)
 							errlog.Logf("[OCR] page %d failed for doc=%s file=%q: %v", i+1, docID, docName, ocrErr)
@@ -807,7 +1209,7 @@ func (dm *DocumentManager) processFile(docID, docName string, fileData []byte, f
 				pageImageURLs := make(map[int]string)
 				for i, img := range result.Images {
 					if len(img.Data) > 0 {
-						savedURL, saveErr := dm.saveExtractedImage(img.Data)
+						savedURL, saveErr := dm.saveExtractedImage(docID, img.Data)
 						if saveErr != nil {
 							log.Printf("Warning: failed to save scanned PDF page image %d: %v", i, saveErr)
 							errlog.Logf("[Extract] failed to save scanned PDF page image %d for doc=%s file=%q: %v", i, docID, docName, saveErr)
@@ -817,41 +1219,40 @@ func (dm *DocumentManager) processFile(docID, docName string, fileData []byte, f
 					}
 				}
 
-				// Batch embed all page texts
+				// Embed the page texts in batches and store each page as a
+				// chunk with its page image as soon as its batch is embedded
 				texts := make([]string, len(pageResults))
 				for i, pr := range pageResults {
 					texts[i] = pr.text
 				}
-				const batchSize = 64
-				vectors := make([][]float64, len(texts))
-				for start := 0; start < len(texts); start += batchSize {
-					end := start + batchSize
-					if end > len(texts) {
-						end = len(texts)
+				for start := 0; start < len(texts); start += embedStoreBatchSize {
+					if err := dm.canceled(docID); err != nil {
+						return nil, err
 					}
-					batch, embErr := dm.embeddingService.EmbedBatch(texts[start:end])
+					end := min(start+embedStoreBatchSize, len(texts))
+					vectors, embErr := dm.embeddingService.EmbedBatch(texts[start:end])
 					if embErr != nil {
 						errlog.Logf("[Embed] scanned PDF embedding failed (batch %d-%d) doc=%s file=%q: %v", start, end, docID, docName, embErr)
 						return nil, fmt.Errorf("scanned PDF embedding error (batch %d-%d): %w", start, end, embErr)
 					}
-					copy(vectors[start:end], batch)
-				}
-
-				// Store each page as a chunk with its page image
-				for i, pr := range pageResults {
-					pageChunk := []vectorstore.VectorChunk{{
-						ChunkText:    pr.text,
-						ChunkIndex:   pr.index,
-						DocumentID:   docID,
-						DocumentName: docName,
-						Vector:       vectors[i],
-						ImageURL:     pageImageURLs[pr.index],
-						ProductID:    productID,
-					}}
-					if err := dm.vectorStore.Store(docID, pageChunk); err != nil {
-						log.Printf("Warning: failed to store scanned PDF page %d: %v", pr.index, err)
-						errlog.Logf("[Store] failed to store scanned PDF page %d for doc=%s file=%q: %v", pr.index, docID, docName, err)
+					for i, pr := range pageResults[start:end] {
+						pageChunk := []vectorstore.VectorChunk{{
+							ChunkText:    pr.text,
+							ChunkIndex:   pr.index,
+							DocumentID:   docID,
+							DocumentName: docName,
+							Vector:       vectors[i],
+							ImageURL:     pageImageURLs[pr.index],
+							ProductID:    productID,
+						}}
+						if err := dm.StoreChunks(docID, pageChunk); err != nil {
+							log.Printf("Warning: failed to store scanned PDF page %d: %v", pr.index, err)
+							errlog.Logf("[Store] failed to store scanned PDF page %d for doc=%s file=%q: %v", pr.index, docID, docName, err)
+						} else if page := result.Images[pr.index].Page; page > 0 {
+							dm.recordPageLocation(docID, pr.index, page)
+						}
 					}
+					dm.reportProgress(docID, end, len(texts), "向量化")
 				}
 
 				log.Printf("扫描型PDF存储完成: doc=%s, %d 页 (每页含文本+图片)", docID, len(pageResults))
@@ -911,7 +1312,7 @@ func (dm *DocumentManager) processFile(docID, docName string, fileData []byte, f
 		for i, img := range result.Images {
 			var savedLocalURL string
 			if len(img.Data) > 0 {
-				savedURL, saveErr := dm.saveExtractedImage(img.Data)
+				savedURL, saveErr := dm.saveExtractedImage(docID, img.Data)
 				if saveErr != nil {
 					log.Printf("Warning: failed to save PPT slide image %d: %v", i, saveErr)
 					errlog.Logf("[Extract] failed to save PPT slide image %d for doc=%s file=%q: %v", i, docID, docName, saveErr)
@@ -937,58 +1338,59 @@ func (dm *DocumentManager) processFile(docID, docName string, fileData []byte, f
 
 		log.Printf("[PPT] Phase 1 complete: %d slides with text for doc=%s", len(slides), docID)
 
-		// Phase 2: Batch embed all slide texts (respecting API batch size limit)
+		// Phase 2: Embed the slide texts in batches (respecting API batch size
+		// limit) and store each slide chunk with its image URL as soon as its
+		// batch is embedded
 		texts := make([]string, len(slides))
 		for i, s := range slides {
 			texts[i] = s.text
 		}
-		const batchSize = 64
-		vectors := make([][]float64, len(texts))
-		log.Printf("[PPT] Phase 2: Starting embedding for %d slides, doc=%s", len(texts), docID)
-		for start := 0; start < len(texts); start += batchSize {
-			end := start + batchSize
-			if end > len(texts) {
-				end = len(texts)
+		log.Printf("[PPT] Phase 2: Embedding and storing %d slides, doc=%s", len(texts), docID)
+		imageCount := 0
+		for start := 0; start < len(texts); start += embedStoreBatchSize {
+			if err := dm.canceled(docID); err != nil {
+				return nil, err
 			}
+			end := min(start+embedStoreBatchSize, len(texts))
 			log.Printf("[PPT] Embedding batch %d-%d for doc=%s", start, end, docID)
-			batch, embErr := dm.embeddingService.EmbedBatch(texts[start:end])
+			vectors, embErr := dm.embeddingService.EmbedBatch(texts[start:end])
 			if embErr != nil {
 				log.Printf("[PPT] Embedding failed for batch %d-%d, doc=%s: %v", start, end, docID, embErr)
 				errlog.Logf("[Embed] PPT slide embedding failed (batch %d-%d) doc=%s file=%q: %v", start, end, docID, docName, embErr)
 				return nil, fmt.Errorf("PPT slide embedding error (batch %d-%d): %w", start, end, embErr)
 			}
-			copy(vectors[start:end], batch)
-		}
-		log.Printf("[PPT] Phase 2 complete: embedding done for doc=%s", docID)
-
-		// Phase 3: Store each slide chunk with its image URL
-		log.Printf("[PPT] Phase 3: Storing %d slide chunks for doc=%s", len(slides), docID)
-		imageCount := 0
-		for i, s := range slides {
-			slideChunk := []vectorstore.VectorChunk{{
-				ChunkText:    s.text,
-				ChunkIndex:   s.index,
-				DocumentID:   docID,
-				DocumentName: docName,
-				Vector:       vectors[i],
-				ImageURL:     s.imageURL,
-				ProductID:    productID,
-			}}
-			if err := dm.vectorStore.Store(docID, slideChunk); err != nil {
-				log.Printf("Warning: failed to store PPT slide %d: %v", s.index+1, err)
-				errlog.Logf("[Store] failed to store PPT slide %d for doc=%s file=%q: %v", s.index+1, docID, docName, err)
-			} else {
-				imageCount++
+			for i, s := range slides[start:end] {
+				slideChunk := []vectorstore.VectorChunk{{
+					ChunkText:    s.text,
+					ChunkIndex:   s.index,
+					DocumentID:   docID,
+					DocumentName: docName,
+					Vector:       vectors[i],
+					ImageURL:     s.imageURL,
+					ProductID:    productID,
+				}}
+				if err := dm.StoreChunks(docID, slideChunk); err != nil {
+					log.Printf("Warning: failed to store PPT slide %d: %v", s.index+1, err)
+					errlog.Logf("[Store] failed to store PPT slide %d for doc=%s file=%q: %v", s.index+1, docID, docName, err)
+				} else {
+					dm.recordPageLocation(docID, s.index, s.index+1)
+					imageCount++
+				}
 			}
+			dm.reportProgress(docID, end, len(texts), "向量化")
 		}
 		stats.ImageCount = imageCount
-		log.Printf("[PPT] Phase 3 complete: stored %d slides for doc=%s", imageCount, docID)
+		log.Printf("[PPT] Phase 2 complete: stored %d slides for doc=%s", imageCount, docID)
 		return stats, nil
 	}
 
 	// Store text chunks (for non-PPT documents)
-	if result.Text != "" {
-		if err := dm.chunkEmbedStore(docID, docName, result.Text, productID); err != nil {
+	if result.Table != nil {
+		if err := dm.chunkEmbedStoreTable(docID, docName, result.Table, productID); err != nil {
+			return nil, err
+		}
+	} else if result.Text != "" {
+		if err := dm.chunkEmbedStoreOutline(docID, docName, result.Text, result.Pages, result.Headings, productID); err != nil {
 			return nil, err
 		}
 	}
@@ -1004,7 +1406,7 @@ func (dm *DocumentManager) processFile(docID, docName string, fileData []byte, f
 		// For embedded images (e.g. from PDF/DOCX), save to disk for UI display
 		var savedLocalURL string
 		if imgURL == "" && len(img.Data) > 0 {
-			savedURL, saveErr := dm.saveExtractedImage(img.Data)
+			savedURL, saveErr := dm.saveExtractedImage(docID, img.Data)
 			if saveErr != nil {
 				log.Printf("Warning: failed to save extracted image %d: %v", i, saveErr)
 				errlog.Logf("[Extract] failed to save extracted image %d for doc=%s file=%q: %v", i, docID, docName, saveErr)
@@ -1059,9 +1461,12 @@ func (dm *DocumentManager) processFile(docID, docName string, fileData []byte, f
 						ImageURL:     storeURL,
 						ProductID:    productID,
 					}}
-					if storeErr := dm.vectorStore.Store(docID, imgChunk); storeErr != nil {
+					if storeErr := dm.StoreChunks(docID, imgChunk); storeErr != nil {
 						log.Printf("Warning: failed to store image record %d: %v", i, storeErr)
 					} else {
+						if img.Page > 0 {
+							dm.recordPageLocation(docID, 1000+i, img.Page)
+						}
 						imageCount++
 					}
 				}
@@ -1078,10 +1483,13 @@ func (dm *DocumentManager) processFile(docID, docName string, fileData []byte, f
 			ImageURL:     storeURL,
 			ProductID:    productID,
 		}}
-		if err := dm.vectorStore.Store(docID, imgChunk); err != nil {
+		if err := dm.StoreChunks(docID, imgChunk); err != nil {
 			log.Printf("Warning: failed to store image vector %d: %v", i, err)
 			errlog.Logf("[Store] failed to store image vector %d for doc=%s file=%q: %v", i, docID, docName, err)
 		} else {
+			if img.Page > 0 {
+				dm.recordPageLocation(docID, 1000+i, img.Page)
+			}
 			imageCount++
 		}
 	}
@@ -1151,9 +1559,11 @@ func (dm *DocumentManager) mapChunkToTimeRange(chunkText string, segments []vide
 
 // URLPreviewResult holds the preview of fetched URL content.
 type URLPreviewResult struct {
-	URL   string   `json:"url"`
-	Text  string   `json:"text"`
-	Images []string `json:"images,omitempty"` // image URLs found in HTML
+	URL      string          `json:"url"`
+	Text     string          `json:"text"`
+	Images   []string        `json:"images,omitempty"`   // image URLs found in HTML
+	Estimate *ImportEstimate `json:"estimate,omitempty"` // what importing the URL would take
+	Media    bool            `json:"media,omitempty"`    // the URL is imported as a video
 }
 
 // PreviewURL fetches and parses URL content for user preview before committing.
@@ -1164,15 +1574,18 @@ func (dm *DocumentManager) PreviewURL(rawURL string) (*URLPreviewResult, error)
 	if err := dm.validateURL(rawURL); err != nil {
 		return nil, err
 	}
+	if kind := mediaURLKind(rawURL); kind != "" {
+		return dm.previewMediaURL(rawURL, kind)
+	}
 
-	resp, err := dm.httpClient.Get(rawURL)
+	resp, err := dm.getSourceURL(rawURL)
 	if err != nil {
 		return nil, fmt.Errorf("无法访问该URL: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 403 || resp.StatusCode == 401 {
-		return nil, fmt.Errorf("访问被拒绝 (HTTP %d)，该网站可能禁止抓取", resp.StatusCode)
+		return nil, fmt.Errorf("访问被拒绝 (HTTP %d)，该网站可能禁止抓取或需要登录，可为该域名配置访问凭据", resp.StatusCode)
 	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("请求失败 (HTTP %d)", resp.StatusCode)
@@ -1211,9 +1624,11 @@ func (dm *DocumentManager) PreviewURL(rawURL string) (*URLPreviewResult, error)
 		return nil, fmt.Errorf("解析后内容为空")
 	}
 
+	result.Estimate = dm.estimateTextImport(result.Text, len(result.Images))
+
 	// Truncate preview text to 5000 chars
-	if len(result.Text) > 5000 {
-		result.Text = result.Text[:5000] + "\n...(内容已截断，共 " + fmt.Sprintf("%d", len(text)) + " 字符)"
+	if n := utf8.RuneCountInString(result.Text); n > 5000 {
+		result.Text = textutil.Truncate(result.Text, 5000) + fmt.Sprintf("\n...(内容已截断，共 %d 字符)", n)
 	}
 
 	return result, nil
@@ -1225,7 +1640,7 @@ func (dm *DocumentManager) processURL(docID, url string, productID string) (*Imp
 		return nil, err
 	}
 
-	resp, err := dm.httpClient.Get(url)
+	resp, err := dm.getSourceURL(url)
 	if err != nil {
 		errlog.Logf("[URL] fetch failed doc=%s url=%q: %v", docID, url, err)
 		return nil, fmt.Errorf("failed to fetch URL: %w", err)
@@ -1243,14 +1658,24 @@ func (dm *DocumentManager) processURL(docID, url string, productID string) (*Imp
 		return nil, fmt.Errorf("failed to read URL content: %w", err)
 	}
 
+	return dm.processWebContent(docID, url, url, body, resp.Header.Get("Content-Type"), productID)
+}
+
+// processWebContent chunks, embeds and stores already-fetched web content (HTML or plain
+// text). docName labels the chunks; baseURL resolves relative image links in HTML.
+func (dm *DocumentManager) processWebContent(docID, docName, url string, body []byte, contentType, productID string) (*ImportStats, error) {
 	text := strings.TrimSpace(string(body))
 	if text == "" {
 		errlog.Logf("[URL] empty content doc=%s url=%q", docID, url)
 		return nil, fmt.Errorf("URL内容为空")
 	}
 
+	// Citations link back to the page
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		dm.db.Exec(`UPDATE documents SET source_url = ? WHERE id = ?`, url, docID)
+	}
+
 	// Detect HTML content and parse it with image extraction
-	contentType := resp.Header.Get("Content-Type")
 	isHTML := strings.Contains(contentType, "text/html") || looksLikeHTML(text)
 	if isHTML {
 		result, err := dm.parser.ParseWithBaseURL(body, "html", url)
@@ -1270,7 +1695,7 @@ func (dm *DocumentManager) processURL(docID, url string, productID string) (*Imp
 			dm.db.Exec(`UPDATE documents SET content_hash = ? WHERE id = ?`, hash, docID)
 		}
 		if result.Text != "" {
-			if err := dm.chunkEmbedStore(docID, url, result.Text, productID); err != nil {
+			if err := dm.chunkEmbedStoreOutline(docID, docName, result.Text, nil, result.Headings, productID); err != nil {
 				return nil, err
 			}
 		}
@@ -1290,12 +1715,12 @@ func (dm *DocumentManager) processURL(docID, url string, productID string) (*Imp
 				ChunkText:    fmt.Sprintf("[图片: %s]", img.Alt),
 				ChunkIndex:   1000 + i,
 				DocumentID:   docID,
-				DocumentName: url,
+				DocumentName: docName,
 				Vector:       vec,
 				ImageURL:     img.URL,
 				ProductID:    productID,
 			}}
-			if err := dm.vectorStore.Store(docID, imgChunk); err != nil {
+			if err := dm.StoreChunks(docID, imgChunk); err != nil {
 				log.Printf("Warning: failed to store HTML image vector %d: %v", i, err)
 				errlog.Logf("[Store] failed to store HTML image vector %d for doc=%s url=%q: %v", i, docID, url, err)
 			} else {
@@ -1313,7 +1738,7 @@ func (dm *DocumentManager) processURL(docID, url string, productID string) (*Imp
 	}
 	dm.db.Exec(`UPDATE documents SET content_hash = ? WHERE id = ?`, hash, docID)
 
-	if err := dm.chunkEmbedStore(docID, url, text, productID); err != nil {
+	if err := dm.chunkEmbedStore(docID, docName, text, productID); err != nil {
 		return nil, err
 	}
 	return &ImportStats{TextChars: len([]rune(text))}, nil
@@ -1396,48 +1821,112 @@ func looksLikeHTML(content string) bool {
 // It performs chunk-level deduplication: if a chunk with identical text already exists
 // in the database, its embedding is reused instead of calling the embedding API.
 func (dm *DocumentManager) chunkEmbedStore(docID, docName, text string, productID string) error {
+	return dm.chunkEmbedStoreOutline(docID, docName, text, nil, nil, productID)
+}
+
+// chunkEmbedStoreOutline is chunkEmbedStore for parsed documents whose page
+// and heading positions are known; they are recorded as chunk locations.
+func (dm *DocumentManager) chunkEmbedStoreOutline(docID, docName, text string, pages []parser.PageMark, headings []parser.Heading, productID string) error {
 	chunks := dm.chunker.Split(text, docID)
+	if err := dm.embedStoreChunks(docID, docName, chunks, productID); err != nil {
+		return err
+	}
+	dm.recordTextLocations(docID, text, chunks, pages, headings)
+	return nil
+}
+
+// chunkEmbedStoreTable is chunkEmbedStore for tabular files: rows are
+// chunked in groups with the header repeated in each chunk, so a row such as
+// one product's specs stays readable on its own.
+func (dm *DocumentManager) chunkEmbedStoreTable(docID, docName string, table *parser.Table, productID string) error {
+	header, rows := table.HeaderLine(), table.RowLines()
+	chunks := dm.chunker.SplitTable(header, rows, docID)
+	if err := dm.embedStoreChunks(docID, docName, chunks, productID); err != nil {
+		return err
+	}
+	dm.recordTextLocations(docID, header+"\n"+strings.Join(rows, "\n"), chunks, nil, nil)
+	return nil
+}
+
+// embedStoreBatchSize is how many chunks are embedded and stored at a time.
+// Large documents are stored batch by batch, so their vectors are never all
+// held in memory, and import progress is updated after each batch. It must
+// not exceed the batch limit of the embedding API (256).
+const embedStoreBatchSize = 128
+
+// embedStoreChunks embeds and stores already-split chunks; see chunkEmbedStore.
+// When a batch fails, the batches already stored are removed again so the
+// document is not left half indexed.
+func (dm *DocumentManager) embedStoreChunks(docID, docName string, chunks []chunker.Chunk, productID string) error {
 	if len(chunks) == 0 {
 		return fmt.Errorf("分块结果为空")
 	}
 
-	// Collect chunk texts
+	reused := 0
+	for start := 0; start < len(chunks); start += embedStoreBatchSize {
+		end := min(start+embedStoreBatchSize, len(chunks))
+		n, err := dm.embedStoreBatch(docID, docName, chunks[start:end], productID)
+		if err != nil {
+			if start > 0 {
+				if delErr := dm.vectorStore.DeleteByDocID(docID); delErr != nil {
+					log.Printf("Warning: failed to remove partially stored chunks doc=%s: %v", docID, delErr)
+				}
+			}
+			if len(chunks) > embedStoreBatchSize {
+				err = fmt.Errorf("%w (batch %d-%d)", err, start, end)
+			}
+			return err
+		}
+		reused += n
+		if len(chunks) > embedStoreBatchSize {
+			dm.reportProgress(docID, end, len(chunks), "向量化")
+		}
+	}
+
+	if reused > 0 {
+		log.Printf("去重: %d/%d 个分块复用了已有向量，节省 %d 次API调用", reused, len(chunks), reused)
+	}
+
+	// Parallel translated chunks are best-effort; the document is usable without them.
+	if err := dm.translateChunks(docID, docName, chunks, productID); err != nil {
+		log.Printf("Warning: 分块翻译失败 doc=%s: %v", docID, err)
+		errlog.Logf("[Translate] doc=%s file=%q: %v", docID, docName, err)
+	}
+	return nil
+}
+
+// embedStoreBatch embeds and stores one batch of chunks. It performs
+// chunk-level deduplication: a chunk whose text is already stored, in any
+// document, reuses that embedding instead of calling the embedding API. It
+// returns how many chunks reused an embedding.
+func (dm *DocumentManager) embedStoreBatch(docID, docName string, chunks []chunker.Chunk, productID string) (int, error) {
+	if err := dm.canceled(docID); err != nil {
+		return 0, err
+	}
 	texts := make([]string, len(chunks))
 	for i, c := range chunks {
 		texts[i] = c.Text
 	}
+	embeddings := dm.getExistingChunkEmbeddings(texts, productID)
 
-	// Chunk-level dedup: look up existing embeddings for identical chunk texts
-	existingEmbeddings := dm.getExistingChunkEmbeddings(texts)
-
-	// Identify which chunks need new embeddings
+	// Only call embedding API for chunks that don't have existing embeddings
 	var newTexts []string
-	var newIndices []int
-	for i, t := range texts {
-		if _, ok := existingEmbeddings[t]; !ok {
+	for _, t := range texts {
+		if _, ok := embeddings[t]; !ok && !slices.Contains(newTexts, t) {
 			newTexts = append(newTexts, t)
-			newIndices = append(newIndices, i)
 		}
 	}
-
-	// Only call embedding API for chunks that don't have existing embeddings
 	if len(newTexts) > 0 {
 		newEmbeddings, err := dm.embeddingService.EmbedBatch(newTexts)
 		if err != nil {
 			errlog.Logf("[Embed] batch embedding failed doc=%s file=%q: %v", docID, docName, err)
-			return fmt.Errorf("embedding error: %w", err)
+			return 0, fmt.Errorf("embedding error: %w", err)
 		}
-		for j, idx := range newIndices {
-			existingEmbeddings[texts[idx]] = newEmbeddings[j]
+		for j, t := range newTexts {
+			embeddings[t] = newEmbeddings[j]
 		}
 	}
 
-	if len(newTexts) < len(texts) {
-		log.Printf("去重: %d/%d 个分块复用了已有向量，节省 %d 次API调用",
-			len(texts)-len(newTexts), len(texts), len(texts)-len(newTexts))
-	}
-
-	// Build VectorChunks for storage
 	vectorChunks := make([]vectorstore.VectorChunk, len(chunks))
 	for i, c := range chunks {
 		vectorChunks[i] = vectorstore.VectorChunk{
@@ -1445,30 +1934,36 @@ func (dm *DocumentManager) chunkEmbedStore(docID, docName, text string, productI
 			ChunkIndex:   c.Index,
 			DocumentID:   docID,
 			DocumentName: docName,
-			Vector:       existingEmbeddings[c.Text],
+			Vector:       embeddings[c.Text],
 			ProductID:    productID,
 		}
 	}
-
-	if err := dm.vectorStore.Store(docID, vectorChunks); err != nil {
+	if err := dm.StoreChunks(docID, vectorChunks); err != nil {
 		errlog.Logf("[Store] vector store failed doc=%s file=%q: %v", docID, docName, err)
-		return fmt.Errorf("vector store error: %w", err)
+		return 0, fmt.Errorf("vector store error: %w", err)
 	}
-	return nil
+	return len(texts) - len(newTexts), nil
 }
 
 // insertDocument inserts a new document record into the documents table.
 func (dm *DocumentManager) insertDocument(doc *DocumentInfo, contentHash string) error {
 	_, err := dm.db.Exec(
-		`INSERT INTO documents (id, name, type, status, error, created_at, product_id, content_hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		doc.ID, doc.Name, doc.Type, doc.Status, doc.Error, doc.CreatedAt, doc.ProductID, contentHash,
+		`INSERT INTO documents (id, name, type, status, error, created_at, product_id, content_hash, file_size, effective_from, effective_until,
+			publish_at, unpublish_at, scheduled_by, schedule_state) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		doc.ID, doc.Name, doc.Type, doc.Status, doc.Error, doc.CreatedAt, doc.ProductID, contentHash, doc.FileSize, doc.EffectiveFrom, doc.EffectiveUntil,
+		doc.PublishAt, doc.UnpublishAt, doc.ScheduledBy, doc.ScheduleState,
 	)
 	return err
 }
 
 // updateDocumentStatus updates the status and error fields of a document.
+// Leaving the "processing" status records the completion time used for ETA estimates.
 func (dm *DocumentManager) updateDocumentStatus(docID, status, errMsg string) {
-	result, err := dm.db.Exec(`UPDATE documents SET status = ?, error = ? WHERE id = ?`, status, errMsg, docID)
+	var processedAt interface{}
+	if status != "processing" {
+		processedAt = time.Now()
+	}
+	result, err := dm.db.Exec(`UPDATE documents SET status = ?, error = ?, processed_at = ? WHERE id = ?`, status, errMsg, processedAt, docID)
 	if err != nil {
 		log.Printf("[DB] Failed to update document status for %s: %v", docID, err)
 		errlog.Logf("[DB] Failed to update document status for doc=%s status=%s: %v", docID, status, err)
@@ -1476,9 +1971,33 @@ func (dm *DocumentManager) updateDocumentStatus(docID, status, errMsg string) {
 	}
 	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
 		log.Printf("[DB] Warning: no rows updated for document %s (status=%s)", docID, status)
+		return
+	}
+	if status == "success" {
+		dm.recordLanguage(docID)
+		dm.TagDocumentAsync(docID)
+	}
+	if status == "failed" && errMsg != canceledMessage {
+		dm.mu.RLock()
+		onFailure := dm.onFailure
+		dm.mu.RUnlock()
+		if onFailure != nil {
+			if doc, err := dm.GetDocumentInfo(docID); err == nil {
+				go onFailure(*doc, errMsg)
+			}
+		}
 	}
 }
 
+// SetFailureHandler registers fn to be called (in its own goroutine) when
+// processing a document fails, e.g. to alert administrators. Documents whose
+// processing was canceled are not reported.
+func (dm *DocumentManager) SetFailureHandler(fn func(doc DocumentInfo, reason string)) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.onFailure = fn
+}
+
 // saveOriginalFile saves the uploaded file to data/uploads/{docID}/{filename}.
 func (dm *DocumentManager) saveOriginalFile(docID, filename string, data []byte) error {
 	// Sanitize filename to prevent path traversal
@@ -1494,8 +2013,8 @@ func (dm *DocumentManager) saveOriginalFile(docID, filename string, data []byte)
 		return r
 	}, filename)
 
-	dir := filepath.Join(".", "data", "uploads", docID)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	dir := datadir.Path("uploads", docID)
+	if err := datadir.MkdirAll(dir); err != nil {
 		return fmt.Errorf("failed to create upload dir: %w", err)
 	}
 	filePath := filepath.Join(dir, filename)
@@ -1507,39 +2026,7 @@ func (dm *DocumentManager) saveOriginalFile(docID, filename string, data []byte)
 		return fmt.Errorf("invalid filename: path traversal detected")
 	}
 
-	return os.WriteFile(filePath, data, 0644)
-}
-
-// saveExtractedImage saves embedded image data (e.g. from PDF) to data/images/
-// and returns the URL path for accessing it.
-func (dm *DocumentManager) saveExtractedImage(data []byte) (string, error) {
-	// Map MIME type to file extension
-	mime := detectImageMIME(data)
-	ext := ".png"
-	switch mime {
-	case "image/jpeg":
-		ext = ".jpg"
-	case "image/webp":
-		ext = ".webp"
-	case "image/gif":
-		ext = ".gif"
-	}
-
-	b := make([]byte, 16)
-	if _, err := rand.Read(b); err != nil {
-		return "", fmt.Errorf("failed to generate image ID: %w", err)
-	}
-	filename := hex.EncodeToString(b) + ext
-
-	imgDir := filepath.Join(".", "data", "images")
-	if err := os.MkdirAll(imgDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create image dir: %w", err)
-	}
-	if err := os.WriteFile(filepath.Join(imgDir, filename), data, 0644); err != nil {
-		return "", fmt.Errorf("failed to write image: %w", err)
-	}
-
-	return "/api/images/" + filename, nil
+	return datadir.WriteFile(filePath, data)
 }
 
 // GetDocumentInfo returns metadata for a single document by ID.
@@ -1548,18 +2035,21 @@ func (dm *DocumentManager) GetDocumentInfo(docID string) (*DocumentInfo, error)
 	var errStr sql.NullString
 	var createdAt sql.NullTime
 	err := dm.db.QueryRow(
-		"SELECT id, name, type, status, error, created_at, COALESCE(product_id, '') FROM documents WHERE id = ?", docID,
-	).Scan(&d.ID, &d.Name, &d.Type, &d.Status, &errStr, &createdAt, &d.ProductID)
+		"SELECT id, name, type, status, error, created_at, COALESCE(product_id, ''), COALESCE(file_size, 0), COALESCE(effective_from, ''), COALESCE(effective_until, ''), COALESCE(review_status, ''), COALESCE(publish_at, ''), COALESCE(unpublish_at, ''), COALESCE(scheduled_by, '') FROM documents WHERE id = ?", docID,
+	).Scan(&d.ID, &d.Name, &d.Type, &d.Status, &errStr, &createdAt, &d.ProductID, &d.FileSize, &d.EffectiveFrom, &d.EffectiveUntil, &d.ReviewStatus, &d.PublishAt, &d.UnpublishAt, &d.ScheduledBy)
 	if err != nil {
 		return nil, fmt.Errorf("document not found: %w", err)
 	}
+	d.ScheduleState = ScheduleState(d.PublishAt, d.UnpublishAt, time.Now())
 	if errStr.Valid {
 		d.Error = errStr.String
 	}
 	if createdAt.Valid {
 		d.CreatedAt = createdAt.Time
 	}
-	return &d, nil
+	docs := []DocumentInfo{d}
+	dm.annotateProcessing(docs)
+	return &docs[0], nil
 }
 // ReviewSegment represents a video/audio segment for review display.
 type ReviewSegment struct {
@@ -1576,6 +2066,9 @@ type ReviewData struct {
 	DocName  string          `json:"doc_name"`
 	DocType  string          `json:"doc_type"`
 	Segments []ReviewSegment `json:"segments"`
+	Chapters []VideoChapter  `json:"chapters,omitempty"`
+	// CallCandidates is the number of knowledge entries drafted from a call recording.
+	CallCandidates int `json:"call_candidates,omitempty"`
 }
 
 // GetDocumentReview returns the extracted segments (transcript + keyframes) for review.
@@ -1584,12 +2077,15 @@ func (dm *DocumentManager) GetDocumentReview(docID string) (*ReviewData, error)
 	if err != nil {
 		return nil, err
 	}
+	chunkDB := dm.chunkDB(docInfo.ProductID)
 
 	result := &ReviewData{
 		DocID:   docID,
 		DocName: docInfo.Name,
 		DocType: docInfo.Type,
 	}
+	result.Chapters, _ = dm.GetVideoChapters(docID)
+	dm.db.QueryRow(`SELECT COUNT(*) FROM documents WHERE review_author = ?`, CallAuthorPrefix+docID).Scan(&result.CallCandidates)
 
 	// Query video_segments for transcript and keyframe records
 	rows, err := dm.db.Query(
@@ -1628,7 +2124,7 @@ func (dm *DocumentManager) GetDocumentReview(docID string) (*ReviewData, error)
 			placeholders[i] = "?"
 			args[i] = id
 		}
-		imgRows, imgErr := dm.db.Query(
+		imgRows, imgErr := chunkDB.Query(
 			`SELECT id, image_url FROM chunks WHERE id IN (`+strings.Join(placeholders, ",")+`) AND image_url != '' AND image_url IS NOT NULL`,
 			args...,
 		)
@@ -1657,7 +2153,7 @@ func (dm *DocumentManager) GetDocumentReview(docID string) (*ReviewData, error)
 
 	// Also query OCR description chunks (chunk_index >= 20000) — only for video documents
 	if videoFileTypes[docInfo.Type] {
-		ocrRows, err := dm.db.Query(
+		ocrRows, err := chunkDB.Query(
 			`SELECT chunk_text, chunk_index FROM chunks WHERE document_id = ? AND chunk_index >= 20000 ORDER BY chunk_index ASC`,
 			docID,
 		)
@@ -1679,7 +2175,7 @@ func (dm *DocumentManager) GetDocumentReview(docID string) (*ReviewData, error)
 
 	// For PPT documents: query slide chunks (each slide stored as a chunk with image_url)
 	if docInfo.Type == "ppt" {
-		slideRows, err := dm.db.Query(
+		slideRows, err := chunkDB.Query(
 			`SELECT chunk_text, chunk_index, COALESCE(image_url, '') FROM chunks WHERE document_id = ? AND chunk_index < 20000 ORDER BY chunk_index ASC`,
 			docID,
 		)
@@ -1704,7 +2200,7 @@ func (dm *DocumentManager) GetDocumentReview(docID string) (*ReviewData, error)
 	// For all other document types (PDF, Word, Excel, Markdown, HTML, URL, legacy):
 	// query text chunks and image chunks from the chunks table.
 	if !videoFileTypes[docInfo.Type] && docInfo.Type != "ppt" {
-		chunkRows, err := dm.db.Query(
+		chunkRows, err := chunkDB.Query(
 			`SELECT chunk_text, chunk_index, COALESCE(image_url, '') FROM chunks WHERE document_id = ? ORDER BY chunk_index ASC`,
 			docID,
 		)
@@ -1752,7 +2248,7 @@ func (dm *DocumentManager) GetFilePath(docID string) (string, string, error) {
 		return "", "", fmt.Errorf("document not found: %w", err)
 	}
 
-	dir := filepath.Join(".", "data", "uploads", docID)
+	dir := datadir.Path("uploads", docID)
 	entries, err := os.ReadDir(dir)
 	if err != nil || len(entries) == 0 {
 		return "", name, fmt.Errorf("original file not found")
@@ -1780,6 +2276,49 @@ func (dm *DocumentManager) ChunkEmbedStore(docID, docName, text string, productI
 	return dm.chunkEmbedStore(docID, docName, text, productID)
 }
 
+// ChunkEmbedStoreMarkdown is like ChunkEmbedStore for markdown text with
+// inline media references. The references are replaced by placeholders kept
+// in the chunk of their surrounding text, and are returned so the caller can
+// store the media alongside that text.
+func (dm *DocumentManager) ChunkEmbedStoreMarkdown(docID, docName, text string, productID string) ([]chunker.MediaRef, error) {
+	chunks, refs := dm.chunker.SplitMarkdown(text, docID)
+	if err := dm.embedStoreChunks(docID, docName, chunks, productID); err != nil {
+		return refs, err
+	}
+	dm.recordTextLocations(docID, chunksText(chunks), chunks, nil, nil)
+	return refs, nil
+}
+
+// AddTextDocument stores text written in the admin panel, rather than an
+// uploaded file, as a processed document of docType and indexes it. Before
+// effectiveFrom (a date, may be empty) answers do not cite it. It returns
+// the new document ID.
+func (dm *DocumentManager) AddTextDocument(docType, name, text, productID, effectiveFrom string) (string, error) {
+	docID, err := idgen.New()
+	if err != nil {
+		return "", err
+	}
+	doc := &DocumentInfo{
+		ID:            docID,
+		Name:          name,
+		Type:          docType,
+		Status:        "success",
+		CreatedAt:     time.Now().UTC(),
+		ProductID:     productID,
+		EffectiveFrom: effectiveFrom,
+	}
+	if err := dm.insertDocument(doc, ""); err != nil {
+		return "", fmt.Errorf("failed to insert document: %w", err)
+	}
+	if err := dm.chunkEmbedStore(docID, name, text, productID); err != nil {
+		if delErr := dm.DeleteDocument(docID); delErr != nil {
+			log.Printf("[Document] failed to remove unindexed document %s: %v", docID, delErr)
+		}
+		return "", err
+	}
+	return docID, nil
+}
+
 // GetEmbeddingService returns the current embedding service.
 func (dm *DocumentManager) GetEmbeddingService() embedding.EmbeddingService {
 	dm.mu.RLock()
@@ -1787,11 +2326,84 @@ func (dm *DocumentManager) GetEmbeddingService() embedding.EmbeddingService {
 	return dm.embeddingService
 }
 
-// StoreChunks stores pre-built vector chunks into the vector store.
+// chunkDB returns the database holding the chunks of a product's documents:
+// the product's storage partition when it has isolated storage, otherwise
+// the main database.
+func (dm *DocumentManager) chunkDB(productID string) *sql.DB {
+	if db := dm.vectorStore.PartitionDB(productID); db != nil {
+		return db
+	}
+	return dm.db
+}
+
+// docChunkDB returns the database holding the chunks of a document; see
+// chunkDB.
+func (dm *DocumentManager) docChunkDB(docID string) *sql.DB {
+	var productID string
+	dm.db.QueryRow("SELECT COALESCE(product_id, '') FROM documents WHERE id = ?", docID).Scan(&productID)
+	return dm.chunkDB(productID)
+}
+
+// StoreChunks stores pre-built vector chunks into the vector store. It
+// refuses once the processing job of docID has been canceled.
 func (dm *DocumentManager) StoreChunks(docID string, chunks []vectorstore.VectorChunk) error {
+	if err := dm.canceled(docID); err != nil {
+		return err
+	}
 	return dm.vectorStore.Store(docID, chunks)
 }
 
+// RewriteChunks applies rewrite to the text of every text chunk of a document
+// and re-embeds the chunks whose text changed. Image and keyframe chunks are
+// left untouched because their vectors are image embeddings. Chunk indices
+// (and therefore chunk IDs referenced by video segments) are preserved.
+// Returns the number of rewritten chunks.
+func (dm *DocumentManager) RewriteChunks(docID string, rewrite func(string) string) (int, error) {
+	var productID string
+	if err := dm.db.QueryRow("SELECT COALESCE(product_id, '') FROM documents WHERE id = ?", docID).Scan(&productID); err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to get document: %w", err)
+	}
+	chunks, err := dm.loadChunks(docID, productID)
+	if err != nil {
+		return 0, err
+	}
+
+	var changed []int
+	var texts []string
+	for i, c := range chunks {
+		if c.ImageURL != "" {
+			continue
+		}
+		if text := rewrite(c.ChunkText); text != c.ChunkText {
+			changed = append(changed, i)
+			texts = append(texts, text)
+		}
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+
+	dm.mu.RLock()
+	es := dm.embeddingService
+	dm.mu.RUnlock()
+	vectors, err := es.EmbedBatch(texts)
+	if err != nil {
+		return 0, fmt.Errorf("embedding error: %w", err)
+	}
+	original := make([]vectorstore.VectorChunk, len(chunks))
+	copy(original, chunks)
+	for j, i := range changed {
+		chunks[i].ChunkText = texts[j]
+		chunks[i].Vector = vectors[j]
+		chunks[i].EmbeddingModel = ""
+	}
+
+	if err := dm.replaceChunks(docID, chunks, original); err != nil {
+		return 0, err
+	}
+	return len(changed), nil
+}
+
 // ProcessVideoForKnowledge is a public wrapper for processing video files in knowledge entries.
 // It saves the video file to a permanent location and processes it for transcript and keyframes.
 func (dm *DocumentManager) ProcessVideoForKnowledge(docID, docName string, fileData []byte, videoURL string, productID string) error {
@@ -0,0 +1,302 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"askflow/internal/datadir"
+	"askflow/internal/errlog"
+	"askflow/internal/idgen"
+	"askflow/internal/textutil"
+	"askflow/internal/video"
+)
+
+// Media URLs are imported as videos: platform pages (YouTube, Vimeo) through
+// yt-dlp, using their published captions instead of ASR when there are any,
+// and direct links to video files by plain download. The media is saved like
+// an uploaded video, runs through the same transcript/keyframe pipeline, and
+// the original URL is kept as the document's source_url so citations can
+// link to the video at the cited time.
+
+// Media URL kinds.
+const (
+	mediaURLPlatform = "platform"
+	mediaURLDirect   = "direct"
+)
+
+// videoPlatformHosts are the hosts whose pages are imported through yt-dlp.
+var videoPlatformHosts = map[string]bool{
+	"youtube.com": true, "www.youtube.com": true, "m.youtube.com": true, "youtu.be": true,
+	"vimeo.com": true, "www.vimeo.com": true, "player.vimeo.com": true,
+}
+
+// mediaInfoTimeout bounds the synchronous yt-dlp metadata lookup.
+const mediaInfoTimeout = 60 * time.Second
+
+// mediaURLKind classifies a URL as a video platform page, a direct link to
+// a video file, or "" for other URLs.
+func mediaURLKind(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	if videoPlatformHosts[strings.ToLower(u.Hostname())] {
+		return mediaURLPlatform
+	}
+	if videoFileTypes[strings.TrimPrefix(strings.ToLower(path.Ext(u.Path)), ".")] {
+		return mediaURLDirect
+	}
+	return ""
+}
+
+// TimedURL returns the link to a video URL at second start, in the format of
+// the video's platform. Other URLs are returned unchanged.
+func TimedURL(videoURL string, start float64) string {
+	kind := mediaURLKind(videoURL)
+	if kind == "" || start < 1 {
+		return videoURL
+	}
+	u, err := url.Parse(videoURL)
+	if err != nil {
+		return videoURL
+	}
+	secs := fmt.Sprintf("%d", int(start))
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case strings.Contains(host, "youtu"):
+		q := u.Query()
+		q.Set("t", secs+"s")
+		u.RawQuery = q.Encode()
+	case strings.Contains(host, "vimeo"):
+		u.Fragment = "t=" + secs + "s"
+	default:
+		// Media fragments are understood by browsers playing the file
+		u.Fragment = "t=" + secs
+	}
+	return u.String()
+}
+
+// previewMediaURL describes the video a media URL would import instead of
+// fetching it: its title, duration and the captions that would replace ASR.
+func (dm *DocumentManager) previewMediaURL(rawURL, kind string) (*URLPreviewResult, error) {
+	if kind == mediaURLDirect {
+		u, _ := url.Parse(rawURL)
+		return &URLPreviewResult{URL: rawURL, Media: true, Text: "视频文件: " + path.Base(u.Path)}, nil
+	}
+	dm.mu.RLock()
+	ytdlp := dm.videoConfig.YtDlpPath
+	dm.mu.RUnlock()
+	if ytdlp == "" {
+		return nil, fmt.Errorf("未配置 yt-dlp，无法导入 YouTube/Vimeo 视频")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mediaInfoTimeout)
+	defer cancel()
+	info, err := (&video.Downloader{YtDlpPath: ytdlp}).Info(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "视频: %s\n", info.Title)
+	if info.Duration > 0 {
+		d := int(info.Duration)
+		fmt.Fprintf(&b, "时长: %d:%02d:%02d\n", d/3600, d/60%60, d%60)
+	}
+	switch lang, auto := info.CaptionLanguage(); {
+	case lang == "":
+		b.WriteString("字幕: 无，将使用语音识别")
+	case auto:
+		fmt.Fprintf(&b, "字幕: %s（自动生成）", lang)
+	default:
+		fmt.Fprintf(&b, "字幕: %s", lang)
+	}
+	return &URLPreviewResult{URL: rawURL, Media: true, Text: b.String()}, nil
+}
+
+// uploadMediaURL imports a media URL as a video document. Metadata is read
+// up front so the document gets its title; the download and processing run
+// in the background.
+func (dm *DocumentManager) uploadMediaURL(req UploadURLRequest, kind string) (*DocumentInfo, error) {
+	if err := dm.validateURL(req.URL); err != nil {
+		return nil, err
+	}
+	var existing string
+	if dm.db.QueryRow(`SELECT id FROM documents WHERE source_url = ? AND status NOT IN ('failed', 'quarantined') LIMIT 1`, req.URL).Scan(&existing) == nil {
+		return nil, fmt.Errorf("该视频链接已导入")
+	}
+
+	dm.mu.RLock()
+	cfg := dm.videoConfig
+	dm.mu.RUnlock()
+	maxBytes := int64(cfg.MaxUploadSizeMB) << 20
+	if maxBytes <= 0 {
+		maxBytes = 500 << 20
+	}
+	maxDuration := float64(cfg.URLMaxDurationMin) * 60
+	if maxDuration <= 0 {
+		maxDuration = 120 * 60
+	}
+
+	u, _ := url.Parse(req.URL)
+	name := path.Base(u.Path)
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	fileType := strings.TrimPrefix(strings.ToLower(path.Ext(name)), ".")
+	var dl *video.Downloader
+	var info *video.RemoteInfo
+	if kind == mediaURLPlatform {
+		if cfg.YtDlpPath == "" {
+			return nil, fmt.Errorf("未配置 yt-dlp，无法导入 YouTube/Vimeo 视频")
+		}
+		dl = &video.Downloader{YtDlpPath: cfg.YtDlpPath}
+		ctx, cancel := context.WithTimeout(context.Background(), mediaInfoTimeout)
+		var err error
+		info, err = dl.Info(ctx, req.URL)
+		cancel()
+		if err != nil {
+			errlog.Logf("[MediaURL] info failed url=%q: %v", req.URL, err)
+			return nil, err
+		}
+		if info.Duration > maxDuration {
+			return nil, fmt.Errorf("视频时长超过限制（%d 分钟）", int(maxDuration/60))
+		}
+		fileType = "mp4"
+		name = strings.TrimSpace(info.Title)
+		if name == "" {
+			name = req.URL
+		}
+		name = textutil.Truncate(name, 200) + ".mp4"
+	}
+
+	docID, err := idgen.New()
+	if err != nil {
+		return nil, err
+	}
+	doc := &DocumentInfo{
+		ID:        docID,
+		Name:      name,
+		Type:      fileType,
+		Status:    "processing",
+		CreatedAt: time.Now(),
+		ProductID: req.ProductID,
+	}
+	if err := dm.insertDocument(doc, ""); err != nil {
+		return nil, fmt.Errorf("failed to insert document record: %w", err)
+	}
+	dm.db.Exec(`UPDATE documents SET source_url = ? WHERE id = ?`, req.URL, docID)
+
+	log.Printf("[MediaURL] Starting import of %s url=%q doc=%s", kind, req.URL, docID)
+	dm.processAsync(docID, name, func(ctx context.Context) error {
+		uploadDir := datadir.Path("uploads", docID)
+		if err := datadir.MkdirAll(uploadDir); err != nil {
+			return fmt.Errorf("创建上传目录失败: %w", err)
+		}
+		var captions []video.TranscriptSegment
+		var videoPath string
+		var err error
+		if kind == mediaURLPlatform {
+			captions, videoPath, err = dm.fetchPlatformVideo(ctx, dl, info, req.URL, uploadDir, maxBytes)
+		} else {
+			videoPath = filepath.Join(uploadDir, sanitizeFilename(name, docID))
+			err = dm.downloadMedia(ctx, req.URL, videoPath, maxBytes)
+		}
+		if err != nil {
+			os.RemoveAll(uploadDir)
+			return err
+		}
+		if st, statErr := os.Stat(videoPath); statErr == nil {
+			dm.db.Exec(`UPDATE documents SET file_size = ? WHERE id = ?`, st.Size(), docID)
+		}
+		// The platform may only offer another container than mp4
+		if ext := strings.TrimPrefix(filepath.Ext(videoPath), "."); kind == mediaURLPlatform && ext != fileType && videoFileTypes[ext] {
+			name = strings.TrimSuffix(name, "."+fileType) + "." + ext
+			dm.db.Exec(`UPDATE documents SET name = ?, type = ? WHERE id = ?`, name, ext, docID)
+		}
+		if kind == mediaURLDirect {
+			dm.mu.RLock()
+			vp := video.NewParser(dm.videoConfig)
+			dm.mu.RUnlock()
+			if d := vp.ProbeDuration(videoPath); d > maxDuration {
+				os.RemoveAll(uploadDir)
+				return fmt.Errorf("视频时长超过限制（%d 分钟）", int(maxDuration/60))
+			}
+		}
+		return dm.processVideoWith(docID, name, nil, req.ProductID, captions)
+	})
+	docs := []DocumentInfo{*doc}
+	dm.annotateProcessing(docs)
+	return &docs[0], nil
+}
+
+// fetchPlatformVideo downloads a platform video into dir, with its captions
+// when the platform has any. The captions are only an ASR replacement, so
+// failing to fetch them is not an error.
+func (dm *DocumentManager) fetchPlatformVideo(ctx context.Context, dl *video.Downloader, info *video.RemoteInfo, rawURL, dir string, maxBytes int64) ([]video.TranscriptSegment, string, error) {
+	var captions []video.TranscriptSegment
+	if lang, auto := info.CaptionLanguage(); lang != "" {
+		tmp, err := os.MkdirTemp("", "captions-*")
+		if err == nil {
+			captions, err = dl.Captions(ctx, rawURL, lang, auto, tmp)
+			os.RemoveAll(tmp)
+		}
+		if err != nil {
+			log.Printf("[MediaURL] captions unavailable url=%q: %v", rawURL, err)
+		} else {
+			log.Printf("[MediaURL] %d caption segments (%s) url=%q", len(captions), lang, rawURL)
+		}
+	}
+	videoPath, err := dl.Download(ctx, rawURL, dir, maxBytes)
+	if err != nil {
+		errlog.Logf("[MediaURL] download failed url=%q: %v", rawURL, err)
+		return nil, "", err
+	}
+	return captions, videoPath, nil
+}
+
+// downloadMedia downloads a direct media link to dest, refusing files larger
+// than maxBytes. Unlike page fetches, the download is only bounded by ctx.
+func (dm *DocumentManager) downloadMedia(ctx context.Context, rawURL, dest string, maxBytes int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	dm.applySourceCredential(req)
+	client := *dm.httpClient
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		errlog.Logf("[MediaURL] fetch failed url=%q: %v", rawURL, err)
+		return fmt.Errorf("下载视频失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("下载视频失败: HTTP %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxBytes {
+		return fmt.Errorf("视频超过大小限制（%d MB）", maxBytes>>20)
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("保存视频文件失败: %w", err)
+	}
+	n, err := io.Copy(f, io.LimitReader(resp.Body, maxBytes+1))
+	f.Close()
+	if err != nil {
+		os.Remove(dest)
+		return fmt.Errorf("下载视频失败: %w", err)
+	}
+	if n > maxBytes {
+		os.Remove(dest)
+		return fmt.Errorf("视频超过大小限制（%d MB）", maxBytes>>20)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package document
+
+import (
+	"askflow/internal/config"
+)
+
+// visionPrompt is a system prompt plus the user instruction sent alongside an image.
+type visionPrompt struct {
+	system   string
+	question string
+}
+
+// ocrPrompts holds the page OCR prompt for each supported language.
+// The prompt is written in the target language so the model keeps the
+// original text instead of translating it.
+var ocrPrompts = map[string]visionPrompt{
+	config.OCRLanguageChinese: {
+		system:   "你是一个OCR文字识别助手。请仔细识别图片中的所有文字内容，按原始排版顺序输出纯文本。只输出识别到的文字，不要添加任何解释或描述。如果图片中没有文字，输出空字符串。",
+		question: "请识别图片中的所有文字",
+	},
+	config.OCRLanguageEnglish: {
+		system: "You are an OCR assistant. The document is expected to be in English. " +
+			"Carefully transcribe all text in the image as plain text, following the original reading order. " +
+			"Output only the recognized text without any explanation or description, and do not translate it. " +
+			"If the image contains no text, output an empty string.",
+		question: "Transcribe all text in this image.",
+	},
+	config.OCRLanguageJapanese: {
+		system:   "あなたはOCR文字認識アシスタントです。文書は日本語であることが想定されます。画像内のすべての文字を元のレイアウト順にプレーンテキストとして正確に書き起こしてください。認識した文字のみを出力し、説明や翻訳は加えないでください。画像に文字がない場合は空文字列を出力してください。",
+		question: "画像内のすべての文字を認識してください",
+	},
+	config.OCRLanguageAuto: {
+		system: "You are an OCR assistant. Carefully transcribe all text in the image as plain text, following the original reading order. " +
+			"Keep the text in its original language (it may be Chinese, English, Japanese or mixed); never translate it. " +
+			"Output only the recognized text without any explanation or description. " +
+			"If the image contains no text, output an empty string.",
+		question: "Transcribe all text in this image in its original language.",
+	},
+}
+
+// keyframePrompts holds the video keyframe OCR + scene description prompt for each supported language.
+// The section markers are kept in the target language so the stored chunk reads naturally.
+var keyframePrompts = map[string]visionPrompt{
+	config.OCRLanguageChinese: {
+		system: "你是一个视频内容分析助手。请分析这张视频关键帧图片，完成以下两个任务：\n" +
+			"1. 文字识别：识别图片中出现的所有文字内容（如标题、字幕、界面文字、标签等），按原始排版顺序输出。\n" +
+			"2. 场景描述：用简洁的语言描述画面中的主要内容、场景、人物动作、展示的产品或界面等关键信息。\n\n" +
+			"请按以下格式输出：\n" +
+			"[文字内容]\n（识别到的文字，如果没有文字则写\"无\"）\n\n" +
+			"[场景描述]\n（对画面内容的简要描述）",
+		question: "请识别图片中的文字并描述画面内容",
+	},
+	config.OCRLanguageEnglish: {
+		system: "You are a video content analysis assistant. Analyze this video keyframe and complete two tasks:\n" +
+			"1. Text recognition: transcribe all visible text (titles, subtitles, UI text, labels, etc.) in the original reading order, without translating it.\n" +
+			"2. Scene description: briefly describe the main content, scene, actions, and any product or interface shown.\n\n" +
+			"Use exactly this format:\n" +
+			"[Text]\n(the recognized text, or \"None\" if there is no text)\n\n" +
+			"[Scene]\n(a short description of the frame, in English)",
+		question: "Transcribe the text in this image and describe the scene.",
+	},
+	config.OCRLanguageJapanese: {
+		system: "あなたは動画コンテンツ分析アシスタントです。この動画のキーフレーム画像を分析し、次の2つのタスクを行ってください：\n" +
+			"1. 文字認識：画像内のすべての文字（タイトル、字幕、画面上の文字、ラベルなど）を元のレイアウト順に書き起こしてください。翻訳はしないでください。\n" +
+			"2. シーン説明：画面の主な内容、場面、人物の動作、表示されている製品や画面などを簡潔に日本語で説明してください。\n\n" +
+			"次の形式で出力してください：\n" +
+			"[文字内容]\n（認識した文字。文字がない場合は「なし」）\n\n" +
+			"[シーン説明]\n（画面内容の簡潔な説明）",
+		question: "画像内の文字を認識し、画面の内容を説明してください",
+	},
+	config.OCRLanguageAuto: {
+		system: "You are a video content analysis assistant. Analyze this video keyframe and complete two tasks:\n" +
+			"1. Text recognition: transcribe all visible text (titles, subtitles, UI text, labels, etc.) in the original reading order, keeping its original language; never translate it.\n" +
+			"2. Scene description: briefly describe the main content, scene, actions, and any product or interface shown, in the same language as the visible text (English if there is none).\n\n" +
+			"Use exactly this format:\n" +
+			"[Text]\n(the recognized text, or \"None\" if there is no text)\n\n" +
+			"[Scene]\n(a short description of the frame)",
+		question: "Transcribe the text in this image and describe the scene.",
+	},
+}
+
+// promptFor returns the prompt for lang, falling back to Chinese for unknown codes.
+func promptFor(prompts map[string]visionPrompt, lang string) visionPrompt {
+	if p, ok := prompts[lang]; ok {
+		return p
+	}
+	return prompts[config.OCRLanguageChinese]
+}
+
+// ocrLanguageFor resolves the OCR language for a document: the product's own
+// setting wins, otherwise the deployment-wide video.ocr_language is used.
+func (dm *DocumentManager) ocrLanguageFor(productID string) string {
+	if productID != "" && dm.db != nil {
+		var lang string
+		err := dm.db.QueryRow("SELECT COALESCE(ocr_language, '') FROM products WHERE id = ?", productID).Scan(&lang)
+		if err == nil && config.IsValidOCRLanguage(lang) {
+			return lang
+		}
+	}
+	dm.mu.RLock()
+	lang := dm.videoConfig.OCRLanguage
+	dm.mu.RUnlock()
+	if config.IsValidOCRLanguage(lang) {
+		return lang
+	}
+	return config.OCRLanguageChinese
+}
@@ -0,0 +1,375 @@
+// Package document — read-only documentation portal articles.
+package document
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"askflow/internal/textutil"
+)
+
+// knowledgeNamePrefix is prepended to the document name of knowledge entries.
+const knowledgeNamePrefix = "知识录入: "
+
+// Files the original text of a knowledge entry is kept in under
+// data/uploads/{docID}, see SaveKnowledgeSource.
+const (
+	knowledgeSourceText     = "content.txt"
+	knowledgeSourceMarkdown = "content.md"
+)
+
+// portalSummaryRunes is the length of article summaries and search snippets.
+const portalSummaryRunes = 200
+
+// portalWhere selects the documents published in the portal: successfully
+// processed knowledge entries and markdown documents that are published by
+// review and by their schedule and effective today.
+const portalWhere = `d.type IN ('knowledge', 'markdown') AND d.status = 'success'
+	AND COALESCE(d.review_status, '') NOT IN ('` + ReviewDraft + `', '` + ReviewInReview + `')
+	AND (COALESCE(d.effective_from, '') = '' OR d.effective_from <= ?)
+	AND (COALESCE(d.effective_until, '') = '' OR d.effective_until >= ?)
+	AND NOT (` + ScheduleHiddenWhere + `)`
+
+// PortalArticle is a knowledge entry or markdown document as shown in the
+// documentation portal.
+type PortalArticle struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	ProductID string    `json:"product_id"`
+	Type      string    `json:"type"`              // "knowledge" or "markdown"
+	Format    string    `json:"format"`            // "markdown" or "text"
+	Summary   string    `json:"summary,omitempty"` // start of the text, or the matching passage in search results
+	Content   string    `json:"content,omitempty"` // full text, in GetPortalArticle
+	Images    []string  `json:"images,omitempty"`  // images attached to a knowledge entry
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func portalArgs() []interface{} {
+	now := time.Now()
+	today := now.Format(EffectiveDateLayout)
+	at := now.UTC().Format(ScheduleLayout)
+	return []interface{}{today, today, at, at}
+}
+
+// portalTitle derives the article title from the document name.
+func portalTitle(name, docType string) string {
+	if docType == "knowledge" {
+		return strings.TrimPrefix(name, knowledgeNamePrefix)
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+func scanPortalArticle(scan func(...interface{}) error, a *PortalArticle, extra ...interface{}) error {
+	var name string
+	var createdAt sql.NullTime
+	if err := scan(append([]interface{}{&a.ID, &name, &a.Type, &a.ProductID, &createdAt}, extra...)...); err != nil {
+		return err
+	}
+	a.Title = portalTitle(name, a.Type)
+	a.Format = "text"
+	if a.Type == "markdown" {
+		a.Format = "markdown"
+	}
+	if createdAt.Valid {
+		a.CreatedAt = createdAt.Time
+	}
+	return nil
+}
+
+// PortalArticleCounts returns the number of portal articles per product ID,
+// "" being the public library.
+func (dm *DocumentManager) PortalArticleCounts() (map[string]int, error) {
+	rows, err := dm.db.Query(`SELECT COALESCE(d.product_id, ''), COUNT(*) FROM documents d
+		WHERE `+portalWhere+` GROUP BY COALESCE(d.product_id, '')`, portalArgs()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count portal articles: %w", err)
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var productID string
+		var n int
+		if err := rows.Scan(&productID, &n); err != nil {
+			return nil, err
+		}
+		counts[productID] = n
+	}
+	return counts, rows.Err()
+}
+
+// ListPortalArticles returns one page of the portal articles of a product
+// ("" = public library), newest first, with the total count.
+func (dm *DocumentManager) ListPortalArticles(productID string, offset, limit int) ([]PortalArticle, int, error) {
+	args := append(portalArgs(), productID)
+	var total int
+	if err := dm.db.QueryRow(`SELECT COUNT(*) FROM documents d WHERE `+portalWhere+` AND COALESCE(d.product_id, '') = ?`,
+		args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count portal articles: %w", err)
+	}
+	rows, err := dm.db.Query(`SELECT d.id, d.name, d.type, COALESCE(d.product_id, ''), d.created_at
+		FROM documents d WHERE `+portalWhere+` AND COALESCE(d.product_id, '') = ?
+		ORDER BY d.created_at DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list portal articles: %w", err)
+	}
+	defer rows.Close()
+	articles := []PortalArticle{}
+	products := make(map[string]string)
+	for rows.Next() {
+		var a PortalArticle
+		if err := scanPortalArticle(rows.Scan, &a); err != nil {
+			return nil, 0, err
+		}
+		articles = append(articles, a)
+		products[a.ID] = a.ProductID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+	first, err := dm.firstTextChunks(products)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range articles {
+		articles[i].Summary = textutil.Ellipsize(first[articles[i].ID], portalSummaryRunes)
+	}
+	return articles, total, nil
+}
+
+// GetPortalArticle returns a portal article with its full text. Documents
+// that are not published in the portal are reported as not found.
+func (dm *DocumentManager) GetPortalArticle(docID string) (*PortalArticle, error) {
+	var a PortalArticle
+	err := scanPortalArticle(dm.db.QueryRow(`SELECT d.id, d.name, d.type, COALESCE(d.product_id, ''), d.created_at
+		FROM documents d WHERE d.id = ? AND `+portalWhere, append([]interface{}{docID}, portalArgs()...)...).Scan, &a)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("文章不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query portal article: %w", err)
+	}
+	if err := dm.loadArticleText(&a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// loadArticleText fills in the full text of an article and, for knowledge
+// entries, the images attached to it.
+func (dm *DocumentManager) loadArticleText(a *PortalArticle) error {
+	// Markdown documents and knowledge entries are served from their source
+	// file; entries created before sources were kept are rebuilt from chunks.
+	if path, name, err := dm.GetFilePath(a.ID); err == nil {
+		if data, err := os.ReadFile(path); err == nil && utf8.Valid(data) {
+			a.Content = string(data)
+			if ext := strings.ToLower(filepath.Ext(name)); ext == ".md" || ext == ".markdown" {
+				a.Format = "markdown"
+			}
+		}
+	}
+	starts := make(map[int]int)
+	lrows, err := dm.db.Query(`SELECT chunk_index, char_start FROM chunk_locations
+		WHERE document_id = ? AND chunk_index < 2000 AND char_start IS NOT NULL`, a.ID)
+	if err != nil {
+		return fmt.Errorf("failed to query article chunk locations: %w", err)
+	}
+	for lrows.Next() {
+		var index, start int
+		if err := lrows.Scan(&index, &start); err != nil {
+			lrows.Close()
+			return err
+		}
+		starts[index] = start
+	}
+	err = lrows.Err()
+	lrows.Close()
+	if err != nil {
+		return err
+	}
+
+	rows, err := dm.chunkDB(a.ProductID).Query(`SELECT chunk_text, chunk_index, COALESCE(image_url, '')
+		FROM chunks WHERE document_id = ? AND chunk_index < 2000 ORDER BY chunk_index`, a.ID)
+	if err != nil {
+		return fmt.Errorf("failed to query article content: %w", err)
+	}
+	defer rows.Close()
+	var parts []chunkPart
+	for rows.Next() {
+		p := chunkPart{start: -1}
+		var imageURL string
+		var index int
+		if err := rows.Scan(&p.text, &index, &imageURL); err != nil {
+			return err
+		}
+		if start, ok := starts[index]; ok {
+			p.start = start
+		}
+		switch {
+		case imageURL == "" && index < 1000:
+			parts = append(parts, p)
+		case imageURL != "" && index >= 1000 && a.Type == "knowledge" &&
+			!containsString(a.Images, imageURL) && !strings.Contains(a.Content, imageURL):
+			// Images attached to the entry rather than placed in its text
+			a.Images = append(a.Images, imageURL)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if a.Content == "" {
+		a.Content = joinChunks(parts)
+	}
+	return nil
+}
+
+// SaveKnowledgeSource keeps the original text of a knowledge entry next to
+// uploaded files, so the portal shows it as written: its chunks overlap and
+// have inline media replaced by placeholders.
+func (dm *DocumentManager) SaveKnowledgeSource(docID, content string, markdown bool) error {
+	name := knowledgeSourceText
+	if markdown {
+		name = knowledgeSourceMarkdown
+	}
+	return dm.saveOriginalFile(docID, name, []byte(content))
+}
+
+// SearchPortalArticles returns portal articles whose title or text contains
+// every word of query, restricted to productIDs unless it is nil. Each
+// result's summary is the passage around the first match.
+func (dm *DocumentManager) SearchPortalArticles(query string, productIDs []string, limit int) ([]PortalArticle, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return []PortalArticle{}, nil
+	}
+	if len(terms) > 10 {
+		terms = terms[:10]
+	}
+	where := portalWhere
+	args := portalArgs()
+	if productIDs != nil {
+		if len(productIDs) == 0 {
+			return []PortalArticle{}, nil
+		}
+		where += ` AND COALESCE(d.product_id, '') IN (?` + strings.Repeat(", ?", len(productIDs)-1) + `)`
+		for _, id := range productIDs {
+			args = append(args, id)
+		}
+	}
+	// The name matches are computed here; the text matches are looked up
+	// per storage database, as isolated products keep their chunks apart.
+	var nameMatch string
+	patterns := make([]interface{}, len(terms))
+	for i, t := range terms {
+		nameMatch += `, d.name LIKE ? ESCAPE '\'`
+		patterns[i] = "%" + escapeLike(t) + "%"
+	}
+	rows, err := dm.db.Query(`SELECT d.id, d.name, d.type, COALESCE(d.product_id, ''), d.created_at`+nameMatch+`
+		FROM documents d WHERE `+where+` ORDER BY d.created_at DESC`, append(patterns, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search portal articles: %w", err)
+	}
+	defer rows.Close()
+	type candidate struct {
+		article PortalArticle
+		inName  []bool
+	}
+	var candidates []candidate
+	products := make(map[string]string)
+	for rows.Next() {
+		c := candidate{inName: make([]bool, len(terms))}
+		dest := make([]interface{}, len(terms))
+		for i := range dest {
+			dest[i] = &c.inName[i]
+		}
+		if err := scanPortalArticle(rows.Scan, &c.article, dest...); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+		products[c.article.ID] = c.article.ProductID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Every term must be in the name or the text; the text match of the
+	// first term becomes the summary
+	matches := make([]map[string]string, len(terms))
+	for i, pattern := range patterns {
+		if matches[i], err = dm.matchingTextChunks(products, pattern.(string)); err != nil {
+			return nil, err
+		}
+	}
+	articles := []PortalArticle{}
+	for _, c := range candidates {
+		if len(articles) >= limit {
+			break
+		}
+		found := true
+		for i := range terms {
+			if _, ok := matches[i][c.article.ID]; !ok && !c.inName[i] {
+				found = false
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		c.article.Summary = textutil.SnippetAround(matches[0][c.article.ID], terms[0], portalSummaryRunes)
+		articles = append(articles, c.article)
+	}
+	return articles, nil
+}
+
+// escapeLike escapes the LIKE wildcards of s for use with ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// chunkPart is a text chunk and the rune offset it starts at in the
+// document text, or -1 if unknown.
+type chunkPart struct {
+	text  string
+	start int
+}
+
+// joinChunks rebuilds a text from its consecutive chunks, dropping the
+// overlap each chunk repeats from the end of the previous one. Without
+// recorded offsets, chunks are joined on separate lines.
+func joinChunks(parts []chunkPart) string {
+	var b strings.Builder
+	covered := 0 // runes of the document text written so far
+	for i, p := range parts {
+		switch {
+		case i == 0 || p.start < 0 || parts[i-1].start < 0:
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(p.text)
+		case p.start < covered:
+			runes := []rune(p.text)
+			b.WriteString(string(runes[min(covered-p.start, len(runes)):]))
+		default:
+			b.WriteString(p.text)
+		}
+		if p.start >= 0 {
+			covered = max(covered, p.start+utf8.RuneCountInString(p.text))
+		}
+	}
+	return b.String()
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,545 @@
+package document
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"askflow/internal/embedding"
+	"askflow/internal/errlog"
+	"askflow/internal/jobs"
+	"askflow/internal/vectorstore"
+)
+
+// Re-embedding moves the corpus to a new embedding model without a search
+// outage. Chunk texts are reused as they are (chunking does not depend on the
+// model), so only vectors are recomputed:
+//
+//  1. Every document's chunks are embedded with the target model and staged
+//     in reindex_vectors, while search keeps serving the old vectors.
+//  2. Once all documents are staged, the staged vectors replace the live
+//     ones document by document; chunks that changed since they were staged
+//     are embedded again on the spot.
+//  3. The caller switches the configured model, and documents ingested with
+//     the old model during the swap are re-embedded.
+//
+// Staged vectors survive restarts and cancellation: starting the job again
+// with the same model skips the documents already staged.
+
+// Reindex job states.
+const (
+	ReindexIdle      = "idle"
+	ReindexEmbedding = "embedding"
+	ReindexSwapping  = "swapping"
+	ReindexDone      = "done"
+	ReindexFailed    = "failed"
+	ReindexCanceled  = "canceled"
+)
+
+// Per-document reindex states.
+const (
+	reindexDocStaged  = "staged"
+	reindexDocSwapped = "swapped"
+	reindexDocFailed  = "failed"
+)
+
+// reindexBatchSize is the number of chunk texts embedded per API call.
+const reindexBatchSize = 64
+
+// ErrReindexRunning is returned when a reindex job is already running.
+var ErrReindexRunning = errors.New("reindex already running")
+
+// ReindexStatus reports the progress of the re-embedding job.
+type ReindexStatus struct {
+	State      string     `json:"state"`
+	Model      string     `json:"model"`
+	Total      int        `json:"total"`   // documents to re-embed
+	Done       int        `json:"done"`    // documents staged, including Skipped
+	Skipped    int        `json:"skipped"` // staged by an earlier run
+	Failed     int        `json:"failed"`
+	Swapped    int        `json:"swapped"`
+	Current    string     `json:"current,omitempty"` // document being processed
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Running reports whether the job is in progress.
+func (s ReindexStatus) Running() bool {
+	return s.State == ReindexEmbedding || s.State == ReindexSwapping
+}
+
+// ReindexDocument is the reindex state of one document.
+type ReindexDocument struct {
+	DocumentID   string    `json:"document_id"`
+	DocumentName string    `json:"document_name"`
+	Model        string    `json:"model"`
+	Status       string    `json:"status"`
+	Chunks       int       `json:"chunks"`
+	Error        string    `json:"error,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// reindexDoc identifies a document to re-embed.
+type reindexDoc struct {
+	id, name, productID string
+}
+
+// stagedVector is a vector staged for a chunk, with the hash of the chunk
+// content it was computed from.
+type stagedVector struct {
+	hash   string
+	vector []float64
+}
+
+// ReindexStatus returns the status of the current or last reindex job.
+func (dm *DocumentManager) ReindexStatus() ReindexStatus {
+	dm.reindexMu.Lock()
+	defer dm.reindexMu.Unlock()
+	s := dm.reindex
+	if s.State == "" {
+		s.State = ReindexIdle
+	}
+	return s
+}
+
+// ReindexDocuments lists the per-document state of the reindex job.
+func (dm *DocumentManager) ReindexDocuments() ([]ReindexDocument, error) {
+	rows, err := dm.db.Query(
+		`SELECT r.document_id, COALESCE(d.name, ''), r.model, r.status, r.chunks, r.error, r.updated_at
+		 FROM reindex_documents r LEFT JOIN documents d ON d.id = r.document_id
+		 ORDER BY r.updated_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reindex documents: %w", err)
+	}
+	defer rows.Close()
+	docs := []ReindexDocument{}
+	for rows.Next() {
+		var d ReindexDocument
+		if err := rows.Scan(&d.DocumentID, &d.DocumentName, &d.Model, &d.Status, &d.Chunks, &d.Error, &d.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan reindex document: %w", err)
+		}
+		docs = append(docs, d)
+	}
+	return docs, rows.Err()
+}
+
+// StartReindex re-embeds every document with es in the background. activate
+// is called once the new vectors are live and must switch the configured
+// embedding model to es; until then search keeps using the old vectors.
+func (dm *DocumentManager) StartReindex(es embedding.EmbeddingService, activate func() error) error {
+	model := embeddingModelName(es)
+	if model == "" {
+		return fmt.Errorf("embedding model name is required")
+	}
+	dm.reindexMu.Lock()
+	if dm.reindex.Running() {
+		dm.reindexMu.Unlock()
+		return ErrReindexRunning
+	}
+	now := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	dm.reindex = ReindexStatus{State: ReindexEmbedding, Model: model, StartedAt: &now}
+	dm.reindexCancel = cancel
+	dm.reindexJob = nil
+	dm.reindexMu.Unlock()
+
+	dm.mu.RLock()
+	q := dm.jobQueue
+	dm.mu.RUnlock()
+	job := &jobs.Tracker{}
+	if q != nil {
+		job = q.Track(jobs.TypeReindex, model, "重建向量索引 ("+model+")", func() error {
+			if !dm.CancelReindex() {
+				return jobs.ErrNotCancelable
+			}
+			return nil
+		})
+	}
+	dm.updateReindex(func(*ReindexStatus) { dm.reindexJob = job })
+
+	go func() {
+		defer cancel()
+		err := dm.runReindex(ctx, es, model, activate)
+		job.Finish(err)
+		finished := time.Now()
+		dm.reindexMu.Lock()
+		defer dm.reindexMu.Unlock()
+		dm.reindex.Current = ""
+		dm.reindex.FinishedAt = &finished
+		dm.reindexCancel = nil
+		switch {
+		case errors.Is(err, context.Canceled):
+			dm.reindex.State = ReindexCanceled
+		case err != nil:
+			dm.reindex.State = ReindexFailed
+			dm.reindex.Error = err.Error()
+			errlog.Logf("[Reindex] re-embedding with %s failed: %v", model, err)
+		default:
+			dm.reindex.State = ReindexDone
+		}
+	}()
+	return nil
+}
+
+// CancelReindex stops a running reindex job. Documents staged so far are
+// kept for the next run. Returns false when no job is running or the job is
+// already swapping vectors, which cannot be interrupted.
+func (dm *DocumentManager) CancelReindex() bool {
+	dm.reindexMu.Lock()
+	defer dm.reindexMu.Unlock()
+	if dm.reindex.State != ReindexEmbedding || dm.reindexCancel == nil {
+		return false
+	}
+	dm.reindexCancel()
+	return true
+}
+
+// updateReindex applies fn to the job status under the lock and reports the
+// progress to the job list: staging and swapping each count for half.
+func (dm *DocumentManager) updateReindex(fn func(s *ReindexStatus)) {
+	dm.reindexMu.Lock()
+	fn(&dm.reindex)
+	s, job := dm.reindex, dm.reindexJob
+	dm.reindexMu.Unlock()
+	if job != nil {
+		job.Set(s.Done+s.Swapped, 2*s.Total, s.Current)
+	}
+}
+
+// runReindex runs the staging, swap and catch-up phases of a reindex job.
+func (dm *DocumentManager) runReindex(ctx context.Context, es embedding.EmbeddingService, model string, activate func() error) error {
+	// Progress from another model or from a completed run is stale
+	if _, err := dm.db.Exec(`DELETE FROM reindex_vectors WHERE document_id IN
+		(SELECT document_id FROM reindex_documents WHERE model != ? OR status = ?)`, model, reindexDocSwapped); err != nil {
+		return fmt.Errorf("failed to clear reindex state: %w", err)
+	}
+	if _, err := dm.db.Exec(`DELETE FROM reindex_documents WHERE model != ? OR status = ?`, model, reindexDocSwapped); err != nil {
+		return fmt.Errorf("failed to clear reindex state: %w", err)
+	}
+
+	docs, err := dm.reindexCandidates()
+	if err != nil {
+		return err
+	}
+	staged := make(map[string]bool)
+	if rows, err := dm.db.Query(`SELECT document_id FROM reindex_documents WHERE status = ?`, reindexDocStaged); err == nil {
+		for rows.Next() {
+			var id string
+			if rows.Scan(&id) == nil {
+				staged[id] = true
+			}
+		}
+		rows.Close()
+	}
+	dm.updateReindex(func(s *ReindexStatus) { s.Total = len(docs) })
+
+	// Phase 1: stage new vectors while the old ones keep serving
+	for _, d := range docs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if staged[d.id] {
+			dm.updateReindex(func(s *ReindexStatus) { s.Done++; s.Skipped++ })
+			continue
+		}
+		dm.updateReindex(func(s *ReindexStatus) { s.Current = d.name })
+		n, err := dm.stageDocument(es, d)
+		if err != nil {
+			log.Printf("[Reindex] stage doc=%s failed: %v", d.id, err)
+			dm.setReindexDocument(d.id, model, reindexDocFailed, 0, err.Error())
+			dm.updateReindex(func(s *ReindexStatus) { s.Failed++ })
+			continue
+		}
+		dm.setReindexDocument(d.id, model, reindexDocStaged, n, "")
+		dm.updateReindex(func(s *ReindexStatus) { s.Done++ })
+	}
+	if failed := dm.ReindexStatus().Failed; failed > 0 {
+		return fmt.Errorf("%d 个文档重新向量化失败，未切换模型；可重新启动任务重试失败的文档", failed)
+	}
+
+	// Phase 2: swap the staged vectors in
+	dm.updateReindex(func(s *ReindexStatus) { s.State = ReindexSwapping; s.Current = "" })
+	swapFailed := 0
+	for _, d := range docs {
+		dm.updateReindex(func(s *ReindexStatus) { s.Current = d.name })
+		n, err := dm.swapDocument(es, model, d)
+		if err != nil {
+			swapFailed++
+			errlog.Logf("[Reindex] swap doc=%s failed: %v", d.id, err)
+			dm.setReindexDocument(d.id, model, reindexDocFailed, 0, err.Error())
+			dm.updateReindex(func(s *ReindexStatus) { s.Failed++ })
+			continue
+		}
+		dm.setReindexDocument(d.id, model, reindexDocSwapped, n, "")
+		dm.updateReindex(func(s *ReindexStatus) { s.Swapped++ })
+	}
+	if _, err := dm.db.Exec(`DELETE FROM reindex_vectors`); err != nil {
+		log.Printf("[Reindex] clear staged vectors failed: %v", err)
+	}
+
+	// Phase 3: switch the model, then catch up on documents ingested with
+	// the old model in the meantime
+	if err := activate(); err != nil {
+		return fmt.Errorf("切换向量模型失败: %w", err)
+	}
+	outdated, err := dm.vectorStore.OutdatedDocuments(model, 0)
+	if err != nil {
+		return fmt.Errorf("failed to list outdated documents: %w", err)
+	}
+	for _, id := range outdated {
+		d := reindexDoc{id: id}
+		if err := dm.db.QueryRow("SELECT name, COALESCE(product_id, '') FROM documents WHERE id = ?", id).Scan(&d.name, &d.productID); err != nil {
+			continue
+		}
+		n, err := dm.swapDocument(es, model, d)
+		if err != nil {
+			swapFailed++
+			errlog.Logf("[Reindex] catch-up doc=%s failed: %v", id, err)
+			dm.setReindexDocument(id, model, reindexDocFailed, 0, err.Error())
+			dm.updateReindex(func(s *ReindexStatus) { s.Failed++ })
+			continue
+		}
+		dm.setReindexDocument(id, model, reindexDocSwapped, n, "")
+	}
+	if swapFailed > 0 {
+		return fmt.Errorf("%d 个文档切换失败，仍使用旧向量，需重新启动任务", swapFailed)
+	}
+	return nil
+}
+
+// reindexCandidates lists the documents to re-embed, oldest first.
+func (dm *DocumentManager) reindexCandidates() ([]reindexDoc, error) {
+	rows, err := dm.db.Query(`SELECT id, name, COALESCE(product_id, '') FROM documents WHERE status != ? ORDER BY created_at`, StatusStaging)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query documents: %w", err)
+	}
+	defer rows.Close()
+	var docs []reindexDoc
+	for rows.Next() {
+		var d reindexDoc
+		if err := rows.Scan(&d.id, &d.name, &d.productID); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		docs = append(docs, d)
+	}
+	return docs, rows.Err()
+}
+
+// setReindexDocument records the reindex state of a document.
+func (dm *DocumentManager) setReindexDocument(docID, model, status string, chunks int, errMsg string) {
+	_, err := dm.db.Exec(
+		`INSERT INTO reindex_documents (document_id, model, status, chunks, error, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(document_id) DO UPDATE SET model = excluded.model, status = excluded.status,
+		 chunks = excluded.chunks, error = excluded.error, updated_at = excluded.updated_at`,
+		docID, model, status, chunks, errMsg, time.Now())
+	if err != nil {
+		log.Printf("[Reindex] record state doc=%s failed: %v", docID, err)
+	}
+}
+
+// stageDocument embeds a document's chunks with es into reindex_vectors and
+// returns the number of chunks.
+func (dm *DocumentManager) stageDocument(es embedding.EmbeddingService, d reindexDoc) (int, error) {
+	chunks, err := dm.loadChunks(d.id, d.productID)
+	if err != nil {
+		return 0, err
+	}
+	vectors, err := dm.embedChunks(es, chunks)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM reindex_vectors WHERE document_id = ?`, d.id); err != nil {
+		return 0, fmt.Errorf("failed to clear staged vectors: %w", err)
+	}
+	for i, c := range chunks {
+		if _, err := tx.Exec(`INSERT INTO reindex_vectors (document_id, chunk_index, text_hash, embedding) VALUES (?, ?, ?, ?)`,
+			d.id, c.ChunkIndex, chunkHash(c), vectorstore.SerializeVector(vectors[i])); err != nil {
+			return 0, fmt.Errorf("failed to stage vector: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit staged vectors: %w", err)
+	}
+	return len(chunks), nil
+}
+
+// swapDocument replaces a document's live vectors with vectors from model:
+// the staged ones where the chunk is unchanged, fresh embeddings from es
+// otherwise. Chunk indices, and so chunk IDs, are preserved.
+func (dm *DocumentManager) swapDocument(es embedding.EmbeddingService, model string, d reindexDoc) (int, error) {
+	chunks, err := dm.loadChunks(d.id, d.productID)
+	if err != nil {
+		return 0, err
+	}
+	if len(chunks) == 0 {
+		return 0, nil
+	}
+	staged := make(map[int]stagedVector)
+	rows, err := dm.db.Query(`SELECT chunk_index, text_hash, embedding FROM reindex_vectors WHERE document_id = ?`, d.id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query staged vectors: %w", err)
+	}
+	for rows.Next() {
+		var idx int
+		var sv stagedVector
+		var emb []byte
+		if err := rows.Scan(&idx, &sv.hash, &emb); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan staged vector: %w", err)
+		}
+		sv.vector = vectorstore.DeserializeVector(emb)
+		staged[idx] = sv
+	}
+	rows.Close()
+
+	updated := make([]vectorstore.VectorChunk, len(chunks))
+	copy(updated, chunks)
+	var missing []int
+	for i, c := range updated {
+		if sv, ok := staged[c.ChunkIndex]; ok && sv.hash == chunkHash(c) {
+			updated[i].Vector = sv.vector
+		} else {
+			missing = append(missing, i)
+		}
+		updated[i].EmbeddingModel = model
+	}
+	if len(missing) > 0 {
+		fresh := make([]vectorstore.VectorChunk, len(missing))
+		for j, i := range missing {
+			fresh[j] = chunks[i]
+		}
+		vectors, err := dm.embedChunks(es, fresh)
+		if err != nil {
+			return 0, err
+		}
+		for j, i := range missing {
+			updated[i].Vector = vectors[j]
+		}
+	}
+
+	if err := dm.vectorStore.DeleteByDocID(d.id); err != nil {
+		return 0, fmt.Errorf("failed to delete chunks: %w", err)
+	}
+	if err := dm.vectorStore.Store(d.id, updated); err != nil {
+		if restoreErr := dm.vectorStore.Store(d.id, chunks); restoreErr != nil {
+			errlog.Logf("[Reindex] restore original chunks failed doc=%s: %v", d.id, restoreErr)
+		}
+		return 0, fmt.Errorf("vector store error: %w", err)
+	}
+	return len(updated), nil
+}
+
+// embedChunks embeds chunks with es. Text chunks are embedded in batches;
+// image chunks use image embedding when the service supports it and fall
+// back to their text otherwise, as at ingestion.
+func (dm *DocumentManager) embedChunks(es embedding.EmbeddingService, chunks []vectorstore.VectorChunk) ([][]float64, error) {
+	vectors := make([][]float64, len(chunks))
+	var textIdx []int
+	var texts []string
+	for i, c := range chunks {
+		if c.ImageURL != "" {
+			if vec := dm.embedChunkImage(es, c.ImageURL); len(vec) > 0 {
+				vectors[i] = vec
+				continue
+			}
+		}
+		textIdx = append(textIdx, i)
+		texts = append(texts, c.ChunkText)
+	}
+	for start := 0; start < len(texts); start += reindexBatchSize {
+		end := start + reindexBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := es.EmbedBatch(texts[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("embedding error: %w", err)
+		}
+		if len(batch) != end-start {
+			return nil, fmt.Errorf("embedding API returned %d vectors for %d texts", len(batch), end-start)
+		}
+		for j, vec := range batch {
+			vectors[textIdx[start+j]] = vec
+		}
+	}
+	for i, vec := range vectors {
+		if len(vec) == 0 {
+			return nil, fmt.Errorf("empty embedding for chunk %d", chunks[i].ChunkIndex)
+		}
+	}
+	return vectors, nil
+}
+
+// embedChunkImage embeds the image of an image chunk, or returns nil when
+// the image is unavailable or the service cannot embed images. Local images
+// are sent as data URLs since the embedding API cannot reach them; keyframe
+// chunks already store theirs.
+func (dm *DocumentManager) embedChunkImage(es embedding.EmbeddingService, imageURL string) []float64 {
+	embedURL := imageURL
+	if name, ok := strings.CutPrefix(imageURL, "/api/images/"); ok {
+		name, _, _ = strings.Cut(name, "?")
+		data, err := os.ReadFile(filepath.Join(imageDir(), filepath.Base(name)))
+		if err != nil {
+			return nil
+		}
+		resized := resizeImageForEmbedding(data)
+		if resized == nil {
+			return nil
+		}
+		embedURL = imageToBase64DataURL(resized)
+	} else if !strings.HasPrefix(imageURL, "http://") && !strings.HasPrefix(imageURL, "https://") && !strings.HasPrefix(imageURL, "data:image/") {
+		return nil
+	}
+	vec, err := es.EmbedImageURL(embedURL)
+	if err != nil {
+		return nil
+	}
+	return vec
+}
+
+// loadChunks reads the stored chunks of a document in index order, with the
+// model each was embedded with.
+func (dm *DocumentManager) loadChunks(docID, productID string) ([]vectorstore.VectorChunk, error) {
+	rows, err := dm.chunkDB(productID).Query(
+		`SELECT chunk_index, chunk_text, embedding, COALESCE(image_url, ''), COALESCE(product_id, ''), COALESCE(document_name, ''), COALESCE(embedding_model, '')
+		 FROM chunks WHERE document_id = ? ORDER BY chunk_index`, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunks: %w", err)
+	}
+	defer rows.Close()
+	var chunks []vectorstore.VectorChunk
+	for rows.Next() {
+		var c vectorstore.VectorChunk
+		var emb []byte
+		if err := rows.Scan(&c.ChunkIndex, &c.ChunkText, &emb, &c.ImageURL, &c.ProductID, &c.DocumentName, &c.EmbeddingModel); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		c.DocumentID = docID
+		c.Vector = vectorstore.DeserializeVector(emb)
+		chunks = append(chunks, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate chunks: %w", err)
+	}
+	return chunks, nil
+}
+
+// chunkHash identifies the content a chunk vector is computed from.
+func chunkHash(c vectorstore.VectorChunk) string {
+	sum := sha256.Sum256([]byte(c.ChunkText + "\x00" + c.ImageURL))
+	return hex.EncodeToString(sum[:])
+}
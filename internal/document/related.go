@@ -0,0 +1,173 @@
+// Package document — related documents by embedding centroid similarity.
+package document
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"askflow/internal/vectorstore"
+)
+
+// RelatedDocument is a document similar to another one. Score is the cosine
+// similarity of the two documents' mean text chunk embeddings.
+type RelatedDocument struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	ProductID string  `json:"product_id"`
+	Score     float64 `json:"score"`
+}
+
+// documentCentroids returns the normalized mean embedding of the text chunks
+// of each document matching where (over documents d). Chunks whose dimension
+// differs from the first chunk of their document, left over from a previous
+// embedding model, are ignored.
+func (dm *DocumentManager) documentCentroids(where string, args ...interface{}) (map[string][]float64, error) {
+	products, err := dm.documentProducts(where, args...)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string][]float64)
+	err = dm.queryDocumentChunks(products, `SELECT document_id, embedding FROM chunks
+		WHERE document_id IN (%s) AND chunk_index < 1000 AND COALESCE(image_url, '') = ''`,
+		func(rows *sql.Rows) error {
+			var docID string
+			var emb []byte
+			if err := rows.Scan(&docID, &emb); err != nil {
+				return err
+			}
+			vec := vectorstore.DeserializeVector(emb)
+			if len(vec) == 0 {
+				return nil
+			}
+			sum, ok := sums[docID]
+			if !ok {
+				sum = make([]float64, len(vec))
+				sums[docID] = sum
+			}
+			if len(vec) != len(sum) {
+				return nil
+			}
+			for i, v := range vec {
+				sum[i] += v
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunk embeddings: %w", err)
+	}
+	// Normalized, the cosine similarity of two centroids is their dot product
+	for docID, sum := range sums {
+		var norm float64
+		for _, v := range sum {
+			norm += v * v
+		}
+		if norm == 0 {
+			delete(sums, docID)
+			continue
+		}
+		norm = math.Sqrt(norm)
+		for i := range sum {
+			sum[i] /= norm
+		}
+	}
+	return sums, nil
+}
+
+// centroidSimilarity returns the cosine similarity of two normalized
+// centroids, or 0 if their dimensions differ.
+func centroidSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot
+}
+
+// RelatedDocuments returns up to limit successfully processed documents most
+// similar to docID, best first.
+func (dm *DocumentManager) RelatedDocuments(docID string, limit int) ([]RelatedDocument, error) {
+	var exists int
+	if err := dm.db.QueryRow(`SELECT 1 FROM documents WHERE id = ?`, docID).Scan(&exists); err == sql.ErrNoRows {
+		return nil, fmt.Errorf("文档不存在")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to query document: %w", err)
+	}
+	return dm.relatedDocuments(docID, limit, `(d.status = 'success' OR d.id = ?)`, docID)
+}
+
+// RelatedPortalArticles returns up to limit portal articles most similar to
+// the portal article docID, restricted to productIDs unless it is nil.
+func (dm *DocumentManager) RelatedPortalArticles(docID string, productIDs []string, limit int) ([]RelatedDocument, error) {
+	var exists int
+	err := dm.db.QueryRow(`SELECT 1 FROM documents d WHERE d.id = ? AND `+portalWhere,
+		append([]interface{}{docID}, portalArgs()...)...).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("文章不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query portal article: %w", err)
+	}
+	where := portalWhere
+	args := portalArgs()
+	if productIDs != nil {
+		if len(productIDs) == 0 {
+			return []RelatedDocument{}, nil
+		}
+		// The article itself is in scope whatever its product
+		where += ` AND (d.id = ? OR COALESCE(d.product_id, '') IN (?` + strings.Repeat(", ?", len(productIDs)-1) + `))`
+		args = append(args, docID)
+		for _, id := range productIDs {
+			args = append(args, id)
+		}
+	}
+	related, err := dm.relatedDocuments(docID, limit, where, args...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range related {
+		related[i].Name = portalTitle(related[i].Name, related[i].Type)
+	}
+	return related, nil
+}
+
+// relatedDocuments ranks the documents matching where, which must include
+// docID, by centroid similarity to docID.
+func (dm *DocumentManager) relatedDocuments(docID string, limit int, where string, args ...interface{}) ([]RelatedDocument, error) {
+	centroids, err := dm.documentCentroids(where, args...)
+	if err != nil {
+		return nil, err
+	}
+	related := []RelatedDocument{}
+	target, ok := centroids[docID]
+	if !ok {
+		// No text embeddings to compare, e.g. a video without transcript
+		return related, nil
+	}
+	for id, c := range centroids {
+		if id == docID {
+			continue
+		}
+		if score := centroidSimilarity(target, c); score > 0 {
+			related = append(related, RelatedDocument{ID: id, Score: score})
+		}
+	}
+	sort.Slice(related, func(i, j int) bool { return related[i].Score > related[j].Score })
+	if len(related) > limit {
+		related = related[:limit]
+	}
+	for i := range related {
+		r := &related[i]
+		if err := dm.db.QueryRow(`SELECT name, type, COALESCE(product_id, '') FROM documents WHERE id = ?`, r.ID).
+			Scan(&r.Name, &r.Type, &r.ProductID); err != nil {
+			return nil, fmt.Errorf("failed to query related document: %w", err)
+		}
+	}
+	return related, nil
+}
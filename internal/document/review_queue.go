@@ -0,0 +1,177 @@
+package document
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"askflow/internal/textutil"
+)
+
+// Review states of knowledge entries and pending-question answers. When
+// review is required they start as drafts and are only retrieved for answers
+// once published. An empty state means the document never needed review.
+const (
+	ReviewDraft     = "draft"
+	ReviewInReview  = "in_review"
+	ReviewPublished = "published"
+)
+
+// ReviewItem is an entry of the review queue.
+type ReviewItem struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Type         string     `json:"type"`
+	ProductID    string     `json:"product_id"`
+	ReviewStatus string     `json:"review_status"`
+	Author       string     `json:"author"`
+	ReviewerID   string     `json:"reviewer_id,omitempty"`
+	Note         string     `json:"note,omitempty"`
+	ReviewedBy   string     `json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Preview      string     `json:"preview,omitempty"` // start of the text, in queue listings
+	Content      string     `json:"content,omitempty"` // full text, in GetReviewItem
+}
+
+// ValidReviewFilter reports whether s is an accepted review queue filter:
+// empty for all unpublished entries, draft or in_review.
+func ValidReviewFilter(s string) bool {
+	return s == "" || s == ReviewDraft || s == ReviewInReview
+}
+
+const reviewItemColumns = `d.id, d.name, d.type, COALESCE(d.product_id, ''), d.review_status,
+	COALESCE(d.review_author, ''), COALESCE(d.reviewer_id, ''), COALESCE(d.review_note, ''),
+	COALESCE(d.reviewed_by, ''), CAST(d.reviewed_at AS TEXT), d.created_at`
+
+func scanReviewItem(scan func(...interface{}) error, it *ReviewItem, extra ...interface{}) error {
+	var reviewedAt sql.NullString
+	var createdAt sql.NullTime
+	dest := append([]interface{}{&it.ID, &it.Name, &it.Type, &it.ProductID, &it.ReviewStatus,
+		&it.Author, &it.ReviewerID, &it.Note, &it.ReviewedBy, &reviewedAt, &createdAt}, extra...)
+	if err := scan(dest...); err != nil {
+		return err
+	}
+	if t, ok := parseCitationTime(reviewedAt); ok {
+		it.ReviewedAt = &t
+	}
+	if createdAt.Valid {
+		it.CreatedAt = createdAt.Time
+	}
+	return nil
+}
+
+// ListReviewQueue returns the unpublished entries, oldest first. status
+// narrows the list to drafts or entries in review, reviewerID to the entries
+// assigned to that reviewer.
+func (dm *DocumentManager) ListReviewQueue(status, productID, reviewerID string) ([]ReviewItem, error) {
+	query := `SELECT ` + reviewItemColumns + `
+		FROM documents d WHERE d.review_status IN (?, ?)`
+	args := []interface{}{ReviewDraft, ReviewInReview}
+	if status != "" {
+		query += ` AND d.review_status = ?`
+		args = append(args, status)
+	}
+	if productID != "" {
+		query += ` AND d.product_id = ?`
+		args = append(args, productID)
+	}
+	if reviewerID != "" {
+		query += ` AND d.reviewer_id = ?`
+		args = append(args, reviewerID)
+	}
+	rows, err := dm.db.Query(query+` ORDER BY d.created_at`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query review queue: %w", err)
+	}
+	defer rows.Close()
+	items := []ReviewItem{}
+	products := make(map[string]string)
+	for rows.Next() {
+		var it ReviewItem
+		if err := scanReviewItem(rows.Scan, &it); err != nil {
+			return nil, fmt.Errorf("failed to scan review item: %w", err)
+		}
+		items = append(items, it)
+		products[it.ID] = it.ProductID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	first, err := dm.firstTextChunks(products)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].Preview = textutil.Ellipsize(first[items[i].ID], 200)
+	}
+	return items, nil
+}
+
+// GetReviewItem returns one entry with its review state and full text.
+// Entries that never needed review are reported as not found.
+func (dm *DocumentManager) GetReviewItem(docID string) (*ReviewItem, error) {
+	row := dm.db.QueryRow(`SELECT `+reviewItemColumns+` FROM documents d
+		WHERE d.id = ? AND COALESCE(d.review_status, '') != ''`, docID)
+	var it ReviewItem
+	err := scanReviewItem(row.Scan, &it)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("审核条目不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query review item: %w", err)
+	}
+	rows, err := dm.chunkDB(it.ProductID).Query(
+		`SELECT chunk_text FROM chunks WHERE document_id = ? AND COALESCE(image_url, '') = '' ORDER BY chunk_index`, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query review content: %w", err)
+	}
+	defer rows.Close()
+	var parts []string
+	for rows.Next() {
+		var text string
+		if err := rows.Scan(&text); err == nil {
+			parts = append(parts, text)
+		}
+	}
+	it.Content = strings.Join(parts, "\n")
+	return &it, rows.Err()
+}
+
+// SubmitForReview sends a draft to reviewerID for approval.
+func (dm *DocumentManager) SubmitForReview(docID, reviewerID string) error {
+	return dm.moveReview(ReviewDraft,
+		`UPDATE documents SET review_status = ?, reviewer_id = ?, review_note = '' WHERE id = ? AND review_status = ?`,
+		ReviewInReview, reviewerID, docID, ReviewDraft)
+}
+
+// ApproveReview publishes an entry in review, making it available to answers.
+func (dm *DocumentManager) ApproveReview(docID, reviewer, note string) error {
+	return dm.moveReview(ReviewInReview,
+		`UPDATE documents SET review_status = ?, reviewed_by = ?, reviewed_at = ?, review_note = ? WHERE id = ? AND review_status = ?`,
+		ReviewPublished, reviewer, time.Now().UTC(), note, docID, ReviewInReview)
+}
+
+// RejectReview sends an entry in review back to draft with the reviewer's note.
+func (dm *DocumentManager) RejectReview(docID, reviewer, note string) error {
+	return dm.moveReview(ReviewInReview,
+		`UPDATE documents SET review_status = ?, reviewed_by = ?, reviewed_at = ?, review_note = ? WHERE id = ? AND review_status = ?`,
+		ReviewDraft, reviewer, time.Now().UTC(), note, docID, ReviewInReview)
+}
+
+// moveReview runs a state transition that only applies in state from.
+func (dm *DocumentManager) moveReview(from, query string, args ...interface{}) error {
+	result, err := dm.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update review state: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if from == ReviewDraft {
+			return fmt.Errorf("只有草稿可以提交审核")
+		}
+		return fmt.Errorf("该条目不在审核中")
+	}
+	return nil
+}
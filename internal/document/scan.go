@@ -0,0 +1,98 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"askflow/internal/config"
+	"askflow/internal/datadir"
+	"askflow/internal/errlog"
+	"askflow/internal/scan"
+)
+
+// quarantineDir returns the directory a quarantined upload is kept in. Files
+// are stored under a fixed name with owner-only permissions so they are never
+// served or opened by accident.
+func quarantineDir(docID string) string {
+	return datadir.Path("quarantine", docID)
+}
+
+// SetScanConfig updates the malware scanning configuration for uploads.
+func (dm *DocumentManager) SetScanConfig(cfg config.ScanConfig) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.scanConfig = cfg
+}
+
+// SetQuarantineHandler registers fn to be called (in its own goroutine) when
+// an upload is quarantined, e.g. to alert administrators.
+func (dm *DocumentManager) SetQuarantineHandler(fn func(doc DocumentInfo, reason string)) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.onQuarantine = fn
+}
+
+// scanUpload runs the configured malware scanner on an uploaded file. If the
+// file is flagged — or cannot be scanned while BlockOnError is set — it is
+// moved to quarantine, the document is marked "quarantined" and the reason is
+// returned. An empty reason means the upload may be processed.
+func (dm *DocumentManager) scanUpload(doc *DocumentInfo, data []byte) string {
+	dm.mu.RLock()
+	cfg := dm.scanConfig
+	onQuarantine := dm.onQuarantine
+	dm.mu.RUnlock()
+
+	scanner, err := scan.New(cfg)
+	if scanner == nil && err == nil {
+		return ""
+	}
+
+	var reason string
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), scan.Timeout(cfg))
+		var res *scan.Result
+		res, err = scanner.Scan(ctx, doc.Name, data)
+		cancel()
+		if err == nil && res.Infected {
+			reason = "检测到恶意文件"
+			if res.Signature != "" {
+				reason += ": " + res.Signature
+			}
+		}
+	}
+	if err != nil {
+		errlog.Logf("[Scan] malware scan failed for doc=%s file=%q: %v", doc.ID, doc.Name, err)
+		if !cfg.BlockOnError {
+			log.Printf("[Scan] accepting unscanned file %q (doc=%s): %v", doc.Name, doc.ID, err)
+			return ""
+		}
+		reason = "无法完成恶意软件扫描，文件已隔离"
+	}
+	if reason == "" {
+		return ""
+	}
+
+	if err := dm.quarantineFile(doc.ID, data); err != nil {
+		log.Printf("Warning: failed to store quarantined file for doc=%s: %v", doc.ID, err)
+	}
+	dm.updateDocumentStatus(doc.ID, "quarantined", reason)
+	doc.Status = "quarantined"
+	doc.Error = reason
+	errlog.Logf("[Scan] quarantined upload doc=%s file=%q: %s", doc.ID, doc.Name, reason)
+	if onQuarantine != nil {
+		go onQuarantine(*doc, reason)
+	}
+	return reason
+}
+
+// quarantineFile keeps a flagged upload for later inspection by an administrator.
+func (dm *DocumentManager) quarantineFile(docID string, data []byte) error {
+	dir := quarantineDir(docID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create quarantine dir: %w", err)
+	}
+	return os.WriteFile(filepath.Join(dir, "quarantined.bin"), data, 0600)
+}
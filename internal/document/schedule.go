@@ -0,0 +1,225 @@
+// Package document — scheduled publishing and unpublishing of documents.
+package document
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScheduleLayout is the format of publish_at and unpublish_at. Times are
+// stored in UTC in this layout so they compare correctly as strings.
+const ScheduleLayout = "2006-01-02T15:04:05Z"
+
+// scheduleLocalLayout is the minute-precision local time sent by browser
+// datetime inputs.
+const scheduleLocalLayout = "2006-01-02T15:04"
+
+// scheduleTick is how often the scheduler looks for documents whose
+// visibility changed.
+const scheduleTick = time.Minute
+
+// Schedule states of a document with a publish or unpublish time.
+const (
+	ScheduleWaiting     = "scheduled"   // publish_at not reached yet
+	SchedulePublished   = "published"   // between publish_at and unpublish_at
+	ScheduleUnpublished = "unpublished" // unpublish_at passed
+)
+
+// ScheduleHiddenWhere matches documents hidden by their schedule at a time;
+// it takes the time in ScheduleLayout twice.
+const ScheduleHiddenWhere = `(COALESCE(d.publish_at, '') != '' AND d.publish_at > ?)
+	OR (COALESCE(d.unpublish_at, '') != '' AND d.unpublish_at <= ?)`
+
+// NormalizeSchedule validates optional publish and unpublish times, given as
+// RFC 3339 timestamps or as local times without a zone (YYYY-MM-DDTHH:MM),
+// and returns them in ScheduleLayout. An empty time is unset.
+func NormalizeSchedule(publishAt, unpublishAt string) (string, string, error) {
+	p, err := normalizeScheduleTime(publishAt)
+	if err != nil {
+		return "", "", fmt.Errorf("发布时间格式无效: %w", err)
+	}
+	u, err := normalizeScheduleTime(unpublishAt)
+	if err != nil {
+		return "", "", fmt.Errorf("下线时间格式无效: %w", err)
+	}
+	if p != "" && u != "" && u <= p {
+		return "", "", fmt.Errorf("下线时间必须晚于发布时间")
+	}
+	return p, u, nil
+}
+
+func normalizeScheduleTime(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		if t, err = time.ParseInLocation(scheduleLocalLayout, s, time.Local); err != nil {
+			return "", fmt.Errorf("expected RFC 3339 or YYYY-MM-DDTHH:MM, got %q", s)
+		}
+	}
+	return t.UTC().Format(ScheduleLayout), nil
+}
+
+// ScheduleState returns the schedule state at now of a document with the
+// given publish and unpublish times, or "" when it has neither.
+func ScheduleState(publishAt, unpublishAt string, now time.Time) string {
+	at := now.UTC().Format(ScheduleLayout)
+	switch {
+	case publishAt == "" && unpublishAt == "":
+		return ""
+	case unpublishAt != "" && unpublishAt <= at:
+		return ScheduleUnpublished
+	case publishAt != "" && publishAt > at:
+		return ScheduleWaiting
+	default:
+		return SchedulePublished
+	}
+}
+
+// SetSchedule sets when a document becomes visible to user queries and when
+// it is hidden again, and records by as the owner notified of the changes.
+// Empty times clear the schedule.
+func (dm *DocumentManager) SetSchedule(docID, publishAt, unpublishAt, by string) (*DocumentInfo, error) {
+	publishAt, unpublishAt, err := NormalizeSchedule(publishAt, unpublishAt)
+	if err != nil {
+		return nil, err
+	}
+	if publishAt == "" && unpublishAt == "" {
+		by = ""
+	}
+	result, err := dm.db.Exec(
+		`UPDATE documents SET publish_at = ?, unpublish_at = ?, scheduled_by = ?, schedule_state = ? WHERE id = ?`,
+		publishAt, unpublishAt, by, ScheduleState(publishAt, unpublishAt, time.Now()), docID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update schedule: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("document not found")
+	}
+	return dm.GetDocumentInfo(docID)
+}
+
+// ScheduleChange is a document whose schedule made it visible or hid it.
+type ScheduleChange struct {
+	DocumentID  string
+	Name        string
+	Type        string
+	ProductID   string
+	ScheduledBy string // admin who set the schedule
+	State       string // SchedulePublished or ScheduleUnpublished
+}
+
+// ApplySchedules records the schedule state at now of every scheduled
+// document and returns the documents that were published or unpublished
+// since the last call. Queries check the times themselves, so a document is
+// hidden on time even when the scheduler runs late.
+func (dm *DocumentManager) ApplySchedules(now time.Time) ([]ScheduleChange, error) {
+	rows, err := dm.db.Query(`SELECT id, name, type, COALESCE(product_id, ''), COALESCE(scheduled_by, ''),
+		COALESCE(publish_at, ''), COALESCE(unpublish_at, ''), COALESCE(schedule_state, '')
+		FROM documents WHERE status != ? AND (COALESCE(publish_at, '') != '' OR COALESCE(unpublish_at, '') != '')`, StatusStaging)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled documents: %w", err)
+	}
+	var changes []ScheduleChange
+	for rows.Next() {
+		var c ScheduleChange
+		var publishAt, unpublishAt, prev string
+		if err := rows.Scan(&c.DocumentID, &c.Name, &c.Type, &c.ProductID, &c.ScheduledBy, &publishAt, &unpublishAt, &prev); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan scheduled document: %w", err)
+		}
+		c.State = ScheduleState(publishAt, unpublishAt, now)
+		if c.State != prev && c.State != ScheduleWaiting {
+			changes = append(changes, c)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range changes {
+		if _, err := dm.db.Exec(`UPDATE documents SET schedule_state = ? WHERE id = ?`, c.State, c.DocumentID); err != nil {
+			return nil, fmt.Errorf("failed to update schedule state: %w", err)
+		}
+	}
+	return changes, nil
+}
+
+// Scheduler applies document schedules once a minute and passes the
+// documents that were published or unpublished to a callback.
+type Scheduler struct {
+	dm       *DocumentManager
+	onChange func([]ScheduleChange)
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler for the documents of dm.
+func NewScheduler(dm *DocumentManager) *Scheduler {
+	return &Scheduler{dm: dm}
+}
+
+// OnChange sets the function notified of published and unpublished
+// documents. It must be called before Start.
+func (s *Scheduler) OnChange(fn func([]ScheduleChange)) {
+	s.onChange = fn
+}
+
+// Start launches the scheduler goroutine.
+func (s *Scheduler) Start() {
+	s.stopCh = make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[Schedule] panic in scheduler goroutine: %v", r)
+			}
+		}()
+		s.apply(time.Now())
+		ticker := time.NewTicker(scheduleTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case now := <-ticker.C:
+				s.apply(now)
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler and waits for a run in progress.
+func (s *Scheduler) Stop() {
+	if s.stopCh != nil {
+		select {
+		case <-s.stopCh:
+		default:
+			close(s.stopCh)
+		}
+	}
+	s.wg.Wait()
+}
+
+func (s *Scheduler) apply(now time.Time) {
+	changes, err := s.dm.ApplySchedules(now)
+	if err != nil {
+		log.Printf("[Schedule] apply failed: %v", err)
+		return
+	}
+	for _, c := range changes {
+		log.Printf("[Schedule] doc=%s %s", c.DocumentID, c.State)
+	}
+	if len(changes) > 0 && s.onChange != nil {
+		s.onChange(changes)
+	}
+}
@@ -0,0 +1,127 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// oleMagic is the signature of OLE compound files: legacy Office documents and
+// password-protected Office Open XML documents.
+var oleMagic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// ooxmlParts maps Office Open XML file types to the package folder that
+// identifies them.
+var ooxmlParts = map[string]string{
+	"word":  "word/",
+	"excel": "xl/",
+	"ppt":   "ppt/",
+}
+
+// fileTypeLabels names file types in rejection messages.
+var fileTypeLabels = map[string]string{
+	"pdf":          "PDF",
+	"word":         "Word (.docx)",
+	"word_legacy":  "Word 97-2003 (.doc)",
+	"excel":        "Excel (.xlsx)",
+	"excel_legacy": "Excel 97-2003 (.xls)",
+	"ppt":          "PowerPoint (.pptx)",
+	"ppt_legacy":   "PowerPoint 97-2003 (.ppt)",
+	"markdown":     "Markdown",
+	"html":         "HTML",
+	"text":         "文本 (.txt)",
+	"csv":          "CSV",
+}
+
+// sniffContent describes what data actually contains, for rejection
+// messages and audit logs.
+func sniffContent(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return "PDF"
+	case bytes.HasPrefix(data, oleMagic):
+		return "OLE 复合文档（旧版 Office 或加密 Office 文件）"
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		if t := ooxmlType(data); t != "" {
+			return fileTypeLabels[t]
+		}
+		return "ZIP 压缩包"
+	case bytes.HasPrefix(data, []byte("MZ")):
+		return "Windows 可执行文件"
+	case bytes.HasPrefix(data, []byte("\x7fELF")):
+		return "ELF 可执行文件"
+	case bytes.HasPrefix(data, []byte("\xCA\xFE\xBA\xBE")), bytes.HasPrefix(data, []byte("\xCF\xFA\xED\xFE")):
+		return "macOS 可执行文件"
+	case bytes.HasPrefix(data, []byte("Rar!")), bytes.HasPrefix(data, []byte("7z\xBC\xAF")), bytes.HasPrefix(data, []byte("\x1F\x8B")):
+		return "压缩包"
+	case len(data) >= 4 && (string(data[:4]) == "\x89PNG" || (data[0] == 0xFF && data[1] == 0xD8 && data[2] == 0xFF) || string(data[:3]) == "GIF"):
+		return "图片"
+	case isBinaryContent(data):
+		return "未知二进制文件"
+	}
+	return "文本"
+}
+
+// ooxmlType returns the Office Open XML type ("word", "excel" or "ppt") of a
+// ZIP package, or "" if it is not one.
+func ooxmlType(data []byte) string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return ""
+	}
+	hasContentTypes := false
+	found := ""
+	for _, f := range zr.File {
+		if f.Name == "[Content_Types].xml" {
+			hasContentTypes = true
+		}
+		for t, prefix := range ooxmlParts {
+			if found == "" && strings.HasPrefix(f.Name, prefix) {
+				found = t
+			}
+		}
+	}
+	if !hasContentTypes {
+		return ""
+	}
+	return found
+}
+
+// isBinaryContent reports whether the start of data looks like binary rather
+// than text: it contains NUL bytes and is not UTF-16 with a byte order mark.
+func isBinaryContent(data []byte) bool {
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) {
+		return false
+	}
+	head := data
+	if len(head) > 8192 {
+		head = head[:8192]
+	}
+	return bytes.IndexByte(head, 0) >= 0
+}
+
+// checkFileContent verifies that the content of an uploaded document matches
+// its declared (extension-derived) type, so a renamed executable or archive is
+// rejected up front instead of failing confusingly during parsing. Video types
+// are not checked here.
+func checkFileContent(fileType string, data []byte) error {
+	var ok bool
+	switch fileType {
+	case "pdf":
+		ok = bytes.HasPrefix(data, []byte("%PDF-"))
+	case "word", "excel", "ppt":
+		// Password-protected OOXML files are stored as OLE containers
+		ok = bytes.HasPrefix(data, oleMagic) || ooxmlType(data) == fileType
+	case "word_legacy", "excel_legacy", "ppt_legacy":
+		ok = bytes.HasPrefix(data, oleMagic)
+	case "markdown", "html", "text", "csv":
+		ok = !isBinaryContent(data)
+	default:
+		return nil
+	}
+	if ok {
+		return nil
+	}
+	return fmt.Errorf("文件内容与扩展名不匹配：扩展名为 %s，但文件内容是%s", fileTypeLabels[fileType], sniffContent(data))
+}
@@ -0,0 +1,91 @@
+// Package document — credentials for fetching source URLs that require login.
+package document
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"askflow/internal/config"
+)
+
+// SetSourceCredentials sets the credentials attached to source URL fetches,
+// by domain.
+func (dm *DocumentManager) SetSourceCredentials(creds map[string]config.SourceCredential) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.sourceCredentials = creds
+}
+
+// sourceCredential returns the credential for the host of u and the domain
+// it is configured for, the most specific domain winning. Credentials are
+// only used over HTTPS.
+func (dm *DocumentManager) sourceCredential(u *url.URL) (string, *config.SourceCredential) {
+	if u == nil || u.Scheme != "https" {
+		return "", nil
+	}
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	for host := strings.ToLower(u.Hostname()); host != ""; {
+		if cred, ok := dm.sourceCredentials[host]; ok {
+			return host, &cred
+		}
+		_, rest, ok := strings.Cut(host, ".")
+		if !ok {
+			break
+		}
+		host = rest
+	}
+	return "", nil
+}
+
+// applySourceCredential adds the credential of the request's domain to req.
+func (dm *DocumentManager) applySourceCredential(req *http.Request) {
+	_, cred := dm.sourceCredential(req.URL)
+	if cred == nil {
+		return
+	}
+	for name, value := range cred.Headers {
+		req.Header.Set(name, value)
+	}
+	if cred.Cookies != "" {
+		req.Header.Set("Cookie", cred.Cookies)
+	}
+	if cred.Username != "" {
+		req.SetBasicAuth(cred.Username, cred.Password)
+	}
+}
+
+// getSourceURL fetches a source URL with the credential of its domain. The
+// caller validates the URL against SSRF rules first.
+func (dm *DocumentManager) getSourceURL(rawURL string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	dm.applySourceCredential(req)
+	return dm.httpClient.Do(req)
+}
+
+// checkRedirect re-validates each redirect target against SSRF rules and
+// replaces the credential of the original request by the target's, so a
+// credential never follows a redirect to another domain.
+func (dm *DocumentManager) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 5 {
+		return fmt.Errorf("too many redirects")
+	}
+	if err := validateExternalURL(req.URL.String()); err != nil {
+		return fmt.Errorf("redirect blocked: %w", err)
+	}
+	// Redirects copy the headers of the first request
+	if _, cred := dm.sourceCredential(via[0].URL); cred != nil {
+		for name := range cred.Headers {
+			req.Header.Del(name)
+		}
+		req.Header.Del("Cookie")
+		req.Header.Del("Authorization")
+	}
+	dm.applySourceCredential(req)
+	return nil
+}
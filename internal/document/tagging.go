@@ -0,0 +1,391 @@
+// Package document — LLM tagging of documents at ingestion.
+package document
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"askflow/internal/budget"
+	"askflow/internal/errlog"
+	"askflow/internal/textutil"
+)
+
+// Document categories assigned by tagging.
+const (
+	CategoryManual          = "manual"          // product manuals and user guides
+	CategoryFAQ             = "faq"             // frequently asked questions
+	CategoryReleaseNote     = "release_note"    // release notes and changelogs
+	CategoryTroubleshooting = "troubleshooting" // troubleshooting guides
+	CategoryOther           = "other"
+)
+
+// Kinds of document tags.
+const (
+	TagKindTopic   = "topic"
+	TagKindProduct = "product" // a product or model the document mentions
+)
+
+const (
+	// tagExcerptRunes bounds the document text sent to the LLM for tagging.
+	tagExcerptRunes = 3000
+	// maxTopicTags and maxProductMentions cap the tags kept per document.
+	maxTopicTags       = 8
+	maxProductMentions = 10
+	// tagDocumentTokens is the rough LLM token cost of tagging one document:
+	// excerpt, instructions and reply.
+	tagDocumentTokens = 2500
+)
+
+// ValidCategory reports whether s is a document category, or empty.
+func ValidCategory(s string) bool {
+	switch s {
+	case "", CategoryManual, CategoryFAQ, CategoryReleaseNote, CategoryTroubleshooting, CategoryOther:
+		return true
+	}
+	return false
+}
+
+// DocumentTags is the metadata tagging extracts from a document.
+type DocumentTags struct {
+	Category        string   `json:"category"`
+	Tags            []string `json:"tags"`
+	ProductMentions []string `json:"product_mentions"`
+}
+
+// SetTaggingEnabled turns LLM tagging of documents at ingestion on or off.
+func (dm *DocumentManager) SetTaggingEnabled(enabled bool) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.taggingEnabled = enabled
+}
+
+// TagDocumentAsync tags a document that just finished processing, such as a
+// new knowledge entry, when tagging is enabled. Tagging runs one document at
+// a time in the background so a batch import does not flood the LLM.
+func (dm *DocumentManager) TagDocumentAsync(docID string) {
+	dm.mu.RLock()
+	enabled := dm.taggingEnabled && dm.llmService != nil
+	dm.mu.RUnlock()
+	if !enabled {
+		return
+	}
+	dm.tagWG.Add(1)
+	go func() {
+		defer dm.tagWG.Done()
+		dm.tagMu.Lock()
+		defer dm.tagMu.Unlock()
+		if _, err := dm.TagDocument(docID); err != nil {
+			log.Printf("[Tagging] doc=%s: %v", docID, err)
+			errlog.Logf("[Tagging] failed to tag doc=%s: %v", docID, err)
+		}
+	}()
+}
+
+// WaitTagging waits for the background tagging of processed documents, for
+// callers such as the batch import command that exit when done.
+func (dm *DocumentManager) WaitTagging() {
+	dm.tagWG.Wait()
+}
+
+// TagDocument asks the LLM for the category, topic tags and product mentions
+// of a document from its name and the beginning of its text, and stores them
+// in place of the previous ones.
+func (dm *DocumentManager) TagDocument(docID string) (*DocumentTags, error) {
+	dm.mu.RLock()
+	ls := dm.llmService
+	dm.mu.RUnlock()
+	if ls == nil {
+		return nil, fmt.Errorf("LLM service not configured")
+	}
+	// Tagging is skipped once the monthly budget cap is reached
+	ls = budget.Optional(ls)
+
+	var name string
+	if err := dm.db.QueryRow(`SELECT name FROM documents WHERE id = ?`, docID).Scan(&name); err == sql.ErrNoRows {
+		return nil, fmt.Errorf("文档不存在")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to query document: %w", err)
+	}
+	excerpt, err := dm.documentExcerpt(docID, tagExcerptRunes)
+	if err != nil {
+		return nil, err
+	}
+	if excerpt == "" {
+		return nil, fmt.Errorf("文档没有可用于标签的文本")
+	}
+
+	prompt := "你是一个文档归档助手。根据文档名称和内容，给出文档的类型、主题标签和提到的产品。\n" +
+		"只输出 JSON 对象，不要输出任何其他内容，格式为：\n" +
+		`{"category": "manual", "tags": ["主题标签"], "products": ["产品名称"]}` + "\n" +
+		"category 取以下之一：manual（产品手册、使用说明）、faq（常见问题）、release_note（版本发布说明、更新日志）、troubleshooting（故障排查）、other（其他）。\n" +
+		"tags 为 3 到 8 个简短的主题标签，使用与文档相同的语言。products 为文档中提到的产品或型号名称，没有则为空数组。"
+	reply, err := ls.Generate(prompt, nil, "文档名称："+name+"\n\n文档内容：\n"+excerpt)
+	if err != nil {
+		return nil, fmt.Errorf("标签生成失败: %w", err)
+	}
+	tags, err := parseTagReply(reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := dm.storeDocumentTags(docID, tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// documentExcerpt returns the beginning of a document's text chunks, up to
+// maxRunes.
+func (dm *DocumentManager) documentExcerpt(docID string, maxRunes int) (string, error) {
+	rows, err := dm.docChunkDB(docID).Query(`SELECT chunk_text FROM chunks
+		WHERE document_id = ? AND chunk_index < 1000 AND COALESCE(image_url, '') = '' ORDER BY chunk_index`, docID)
+	if err != nil {
+		return "", fmt.Errorf("failed to query chunks: %w", err)
+	}
+	defer rows.Close()
+	var sb strings.Builder
+	n := 0
+	for rows.Next() && n < maxRunes {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			return "", err
+		}
+		text = textutil.Truncate(text, maxRunes-n)
+		sb.WriteString(text)
+		sb.WriteString("\n")
+		n += len([]rune(text))
+	}
+	return strings.TrimSpace(sb.String()), rows.Err()
+}
+
+// parseTagReply reads the tagging reply, dropping malformed and duplicate
+// tags. An unknown category becomes CategoryOther.
+func parseTagReply(reply string) (*DocumentTags, error) {
+	var raw struct {
+		Category string   `json:"category"`
+		Tags     []string `json:"tags"`
+		Products []string `json:"products"`
+	}
+	if err := json.Unmarshal([]byte(extractJSONObject(reply)), &raw); err != nil {
+		return nil, fmt.Errorf("标签结果解析失败: %w", err)
+	}
+	tags := &DocumentTags{Category: strings.ToLower(strings.TrimSpace(raw.Category))}
+	if tags.Category == "" || !ValidCategory(tags.Category) {
+		tags.Category = CategoryOther
+	}
+	tags.Tags = normalizeTags(raw.Tags, maxTopicTags, 40, true)
+	tags.ProductMentions = normalizeTags(raw.Products, maxProductMentions, 60, false)
+	return tags, nil
+}
+
+// normalizeTags trims and dedupes tags, keeping at most max of at most
+// maxRunes each. lower lowercases them so "VPN" and "vpn" are one tag.
+func normalizeTags(in []string, max, maxRunes int, lower bool) []string {
+	out := []string{}
+	seen := make(map[string]bool)
+	for _, t := range in {
+		t = strings.Join(strings.Fields(t), " ")
+		if lower {
+			t = strings.ToLower(t)
+		}
+		key := strings.ToLower(t)
+		if t == "" || len([]rune(t)) > maxRunes || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, t)
+		if len(out) == max {
+			break
+		}
+	}
+	return out
+}
+
+// extractJSONObject returns the outermost {...} section of an LLM reply,
+// tolerating markdown code fences and surrounding prose.
+func extractJSONObject(s string) string {
+	start := strings.Index(s, "{")
+	end := strings.LastIndex(s, "}")
+	if start < 0 || end <= start {
+		return s
+	}
+	return s[start : end+1]
+}
+
+// storeDocumentTags replaces the category and tags of a document.
+func (dm *DocumentManager) storeDocumentTags(docID string, tags *DocumentTags) error {
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE documents SET category = ? WHERE id = ?`, tags.Category, docID); err != nil {
+		return fmt.Errorf("failed to update document category: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM document_tags WHERE document_id = ?`, docID); err != nil {
+		return fmt.Errorf("failed to delete document tags: %w", err)
+	}
+	insert := func(kind string, values []string) error {
+		for _, v := range values {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO document_tags (document_id, kind, tag) VALUES (?, ?, ?)`, docID, kind, v); err != nil {
+				return fmt.Errorf("failed to insert document tag: %w", err)
+			}
+		}
+		return nil
+	}
+	if err := insert(TagKindTopic, tags.Tags); err != nil {
+		return err
+	}
+	if err := insert(TagKindProduct, tags.ProductMentions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// annotateTags fills the category, tags and product mentions of docs.
+func (dm *DocumentManager) annotateTags(docs []DocumentInfo) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	rows, err := dm.db.Query(`SELECT document_id, kind, tag FROM document_tags ORDER BY rowid`)
+	if err != nil {
+		return fmt.Errorf("failed to query document tags: %w", err)
+	}
+	defer rows.Close()
+	byID := make(map[string]*DocumentInfo, len(docs))
+	for i := range docs {
+		byID[docs[i].ID] = &docs[i]
+	}
+	for rows.Next() {
+		var docID, kind, tag string
+		if err := rows.Scan(&docID, &kind, &tag); err != nil {
+			return err
+		}
+		d := byID[docID]
+		if d == nil {
+			continue
+		}
+		if kind == TagKindProduct {
+			d.ProductMentions = append(d.ProductMentions, tag)
+		} else {
+			d.Tags = append(d.Tags, tag)
+		}
+	}
+	return rows.Err()
+}
+
+// FilterDocuments keeps the documents of a category and with a topic tag or
+// product mention; empty arguments do not filter.
+func FilterDocuments(docs []DocumentInfo, category, tag string) []DocumentInfo {
+	if category == "" && tag == "" {
+		return docs
+	}
+	kept := docs[:0]
+	for _, d := range docs {
+		if category != "" && d.Category != category {
+			continue
+		}
+		if tag != "" && !containsFold(d.Tags, tag) && !containsFold(d.ProductMentions, tag) {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// TagCount is a tag and the number of documents carrying it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// TagSummary lists the categories, topic tags and product mentions in use,
+// most used first, for document filters.
+type TagSummary struct {
+	Categories      map[string]int `json:"categories"`
+	Tags            []TagCount     `json:"tags"`
+	ProductMentions []TagCount     `json:"product_mentions"`
+	Untagged        int            `json:"untagged"` // successfully processed documents without a category
+}
+
+// TagSummary counts the categories and tags of documents, of one product and
+// the public library when productID is set.
+func (dm *DocumentManager) TagSummary(productID string) (*TagSummary, error) {
+	where := `d.status = 'success'`
+	var args []interface{}
+	if productID != "" {
+		where += ` AND COALESCE(d.product_id, '') IN (?, '')`
+		args = append(args, productID)
+	}
+	summary := &TagSummary{Categories: map[string]int{}, Tags: []TagCount{}, ProductMentions: []TagCount{}}
+
+	rows, err := dm.db.Query(`SELECT COALESCE(d.category, ''), COUNT(*) FROM documents d WHERE `+where+` GROUP BY 1`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count categories: %w", err)
+	}
+	for rows.Next() {
+		var category string
+		var n int
+		if err := rows.Scan(&category, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if category == "" {
+			summary.Untagged = n
+		} else {
+			summary.Categories[category] = n
+		}
+	}
+	rows.Close()
+
+	rows, err = dm.db.Query(`SELECT t.kind, t.tag, COUNT(*) FROM document_tags t
+		JOIN documents d ON d.id = t.document_id WHERE `+where+` GROUP BY t.kind, t.tag`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tags: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind string
+		var tc TagCount
+		if err := rows.Scan(&kind, &tc.Tag, &tc.Count); err != nil {
+			return nil, err
+		}
+		if kind == TagKindProduct {
+			summary.ProductMentions = append(summary.ProductMentions, tc)
+		} else {
+			summary.Tags = append(summary.Tags, tc)
+		}
+	}
+	for _, list := range [][]TagCount{summary.Tags, summary.ProductMentions} {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Count != list[j].Count {
+				return list[i].Count > list[j].Count
+			}
+			return list[i].Tag < list[j].Tag
+		})
+	}
+	return summary, rows.Err()
+}
+
+// estimateTagging adds the LLM cost of tagging a document with text to est
+// when tagging is enabled.
+func (dm *DocumentManager) estimateTagging(est *ImportEstimate) {
+	dm.mu.RLock()
+	enabled := dm.taggingEnabled && dm.llmService != nil
+	dm.mu.RUnlock()
+	if enabled && est.Chunks > 0 {
+		est.LLMTokens += tagDocumentTokens
+	}
+}
@@ -0,0 +1,506 @@
+// Package document — document versions: replacing a document's file in place
+// and restoring earlier versions.
+package document
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"askflow/internal/datadir"
+	"askflow/internal/errlog"
+	"askflow/internal/idgen"
+	"askflow/internal/vectorstore"
+)
+
+// StatusStaging is the status of the hidden document record a replacement
+// file is processed under. Staged chunks are excluded from search and the
+// record from document lists until the new version is promoted.
+const StatusStaging = "staging"
+
+// Version statuses.
+const (
+	VersionProcessing = "processing"
+	VersionSuccess    = "success"
+	VersionFailed     = "failed"
+)
+
+// ErrVersionNotFound is returned for an unknown document version.
+var ErrVersionNotFound = errors.New("version not found")
+
+// DocumentVersion is one file version of a document. Version 1 is the file
+// originally uploaded; it is recorded when the document is first replaced.
+type DocumentVersion struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	FileSize  int64     `json:"file_size"`
+	Status    string    `json:"status"` // "processing", "success" or "failed"
+	Error     string    `json:"error,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Current marks the version the document is indexed from: the newest
+	// successful one.
+	Current bool `json:"current"`
+}
+
+// ReplaceFileRequest is a new file for an existing document.
+type ReplaceFileRequest struct {
+	FileName  string `json:"file_name"`
+	FileData  []byte `json:"file_data"`
+	FileType  string `json:"file_type"`
+	Password  string `json:"password,omitempty"` // optional password for encrypted PDF/Office files; never stored
+	Note      string `json:"note,omitempty"`
+	CreatedBy string `json:"created_by,omitempty"`
+}
+
+// maxVersionNoteLen bounds the note of a version.
+const maxVersionNoteLen = 500
+
+// versionDir returns the directory the file of a document version is kept in.
+func versionDir(docID string, version int) string {
+	return datadir.Path("versions", docID, strconv.Itoa(version))
+}
+
+// replaceableType reports whether documents of fileType can be replaced by a
+// new file: uploaded documents other than videos and call recordings.
+func replaceableType(fileType string) bool {
+	return supportedFileTypes[fileType] && !videoFileTypes[fileType]
+}
+
+// ReplaceDocument uploads a new file for docID. The file is processed under a
+// hidden staging record; only when that succeeds are the document's chunks,
+// locations and translations swapped for the new ones, so the document keeps
+// its ID, citations and effective dates, and answers keep using the old
+// version until then. If processing fails, the old version stays live and the
+// failure is recorded on the new version. Files that take long to process —
+// PDF and PPT — are processed in the background, like uploads.
+func (dm *DocumentManager) ReplaceDocument(docID string, req ReplaceFileRequest) (*DocumentVersion, error) {
+	fileType := strings.ToLower(req.FileType)
+	if !replaceableType(fileType) {
+		return nil, fmt.Errorf("新版本文件格式不支持替换")
+	}
+	if req.FileName == "" {
+		return nil, fmt.Errorf("文件名不能为空")
+	}
+	if len(req.FileName) > 500 {
+		return nil, fmt.Errorf("文件名过长")
+	}
+	if len(req.FileData) == 0 {
+		return nil, fmt.Errorf("文件内容为空")
+	}
+	if len([]rune(req.Note)) > maxVersionNoteLen {
+		return nil, fmt.Errorf("版本说明不能超过%d个字符", maxVersionNoteLen)
+	}
+	if err := checkFileContent(fileType, req.FileData); err != nil {
+		log.Printf("[Versions] rejected %q for doc=%s: %v", req.FileName, docID, err)
+		return nil, err
+	}
+
+	var cur DocumentInfo
+	err := dm.db.QueryRow(`SELECT name, type, status, COALESCE(product_id, ''), COALESCE(file_size, 0) FROM documents WHERE id = ?`, docID).
+		Scan(&cur.Name, &cur.Type, &cur.Status, &cur.ProductID, &cur.FileSize)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("文档不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query document: %w", err)
+	}
+	if !replaceableType(cur.Type) {
+		return nil, fmt.Errorf("该类型的文档不支持替换")
+	}
+	if cur.Status != "success" {
+		return nil, fmt.Errorf("文档处理成功后才能替换")
+	}
+	var pending int
+	dm.db.QueryRow(`SELECT COUNT(*) FROM document_versions WHERE document_id = ? AND status = ?`, docID, VersionProcessing).Scan(&pending)
+	if pending > 0 {
+		return nil, fmt.Errorf("该文档有新版本正在处理中")
+	}
+
+	fHash := fileHash(req.FileData)
+	if existingID := dm.findDocumentByContentHash(fHash); existingID == docID {
+		return nil, fmt.Errorf("新文件与当前版本相同")
+	} else if existingID != "" {
+		return nil, fmt.Errorf("文档内容重复，与已有文档相同")
+	}
+
+	if err := dm.recordBaseVersion(docID, cur); err != nil {
+		return nil, err
+	}
+	stagedID, err := idgen.New()
+	if err != nil {
+		return nil, err
+	}
+	v := &DocumentVersion{
+		Name:      req.FileName,
+		Type:      normalizeFileType(fileType),
+		FileSize:  int64(len(req.FileData)),
+		Status:    VersionProcessing,
+		Note:      strings.TrimSpace(req.Note),
+		CreatedBy: req.CreatedBy,
+		CreatedAt: time.Now(),
+	}
+	if err := dm.db.QueryRow(`SELECT COALESCE(MAX(version), 0) + 1 FROM document_versions WHERE document_id = ?`, docID).Scan(&v.Version); err != nil {
+		return nil, fmt.Errorf("failed to number version: %w", err)
+	}
+	if _, err := dm.db.Exec(
+		`INSERT INTO document_versions (document_id, version, name, type, file_size, status, staged_id, note, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		docID, v.Version, v.Name, v.Type, v.FileSize, v.Status, stagedID, v.Note, v.CreatedBy, v.CreatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to record version: %w", err)
+	}
+	if err := saveFileIn(versionDir(docID, v.Version), req.FileName, req.FileData); err != nil {
+		dm.finishVersion(docID, v.Version, fmt.Errorf("保存新版本文件失败: %w", err))
+		return nil, fmt.Errorf("保存新版本文件失败: %w", err)
+	}
+
+	staged := &DocumentInfo{
+		ID:        stagedID,
+		Name:      req.FileName,
+		Type:      v.Type,
+		Status:    StatusStaging,
+		CreatedAt: v.CreatedAt,
+		ProductID: cur.ProductID,
+		FileSize:  v.FileSize,
+	}
+	if err := dm.insertDocument(staged, fHash); err != nil {
+		dm.finishVersion(docID, v.Version, err)
+		return nil, fmt.Errorf("failed to insert staging record: %w", err)
+	}
+	if reason := dm.scanUpload(staged, req.FileData); reason != "" {
+		dm.discardStaged(stagedID)
+		dm.finishVersion(docID, v.Version, errors.New(reason))
+		v.Status, v.Error = VersionFailed, reason
+		return v, nil
+	}
+
+	replace := func(ctx context.Context) error {
+		_, err := dm.processFile(stagedID, req.FileName, req.FileData, fileType, cur.ProductID, req.Password)
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err == nil {
+			err = dm.promoteStaged(docID, stagedID, cur.ProductID, req.FileName, req.FileName, req.FileData)
+		}
+		if err != nil {
+			dm.discardStaged(stagedID)
+			errlog.Logf("[Versions] replacing doc=%s with %q failed: %v", docID, req.FileName, err)
+		}
+		dm.finishVersion(docID, v.Version, err)
+		return err
+	}
+
+	if fileType == "pdf" || fileType == "ppt" || fileType == "ppt_legacy" {
+		log.Printf("[Async] Starting async replacement of doc=%s with %q (staged as %s)", docID, req.FileName, stagedID)
+		dm.processAsync(stagedID, req.FileName, replace)
+		return v, nil
+	}
+	if err := replace(context.Background()); err != nil {
+		v.Status, v.Error = VersionFailed, err.Error()
+		return v, nil
+	}
+	v.Status, v.Current = VersionSuccess, true
+	return v, nil
+}
+
+// recordBaseVersion records the document's current file as version 1 when it
+// has no versions yet, keeping a copy of the file to restore it from.
+func (dm *DocumentManager) recordBaseVersion(docID string, cur DocumentInfo) error {
+	var n int
+	dm.db.QueryRow(`SELECT COUNT(*) FROM document_versions WHERE document_id = ?`, docID).Scan(&n)
+	if n > 0 {
+		return nil
+	}
+	if path := dm.findSavedFile(datadir.Path("uploads", docID)); path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = saveFileIn(versionDir(docID, 1), filepath.Base(path), data)
+		}
+		if err != nil {
+			return fmt.Errorf("保存当前版本文件失败: %w", err)
+		}
+	}
+	var createdAt time.Time
+	if err := dm.db.QueryRow(`SELECT created_at FROM documents WHERE id = ?`, docID).Scan(&createdAt); err != nil {
+		createdAt = time.Now()
+	}
+	if _, err := dm.db.Exec(
+		`INSERT INTO document_versions (document_id, version, name, type, file_size, status, created_at) VALUES (?, 1, ?, ?, ?, ?, ?)`,
+		docID, cur.Name, cur.Type, cur.FileSize, VersionSuccess, createdAt,
+	); err != nil {
+		return fmt.Errorf("failed to record version: %w", err)
+	}
+	return nil
+}
+
+// promoteStaged makes the processed staging record the document's content:
+// the document's chunks are replaced by the staged ones — the old chunks are
+// deleted only once the new ones are stored, and restored if storing fails —
+// then locations, translations, video segments and image references are
+// moved over and the staging record is dropped. fileData is saved as the
+// document's original file under fileName.
+func (dm *DocumentManager) promoteStaged(docID, stagedID, productID, name, fileName string, fileData []byte) error {
+	chunks, err := dm.loadChunks(stagedID, productID)
+	if err != nil {
+		return err
+	}
+	if len(chunks) == 0 {
+		return fmt.Errorf("新版本没有可检索的内容")
+	}
+	for i := range chunks {
+		chunks[i].DocumentID = docID
+		chunks[i].DocumentName = name
+	}
+	old, err := dm.loadChunks(docID, productID)
+	if err != nil {
+		return err
+	}
+
+	if err := dm.vectorStore.DeleteByDocID(docID); err != nil {
+		return fmt.Errorf("failed to delete chunks: %w", err)
+	}
+	if err := dm.vectorStore.Store(docID, chunks); err != nil {
+		dm.restoreChunks(docID, old)
+		return fmt.Errorf("vector store error: %w", err)
+	}
+	if err := dm.moveStaged(docID, stagedID); err != nil {
+		dm.vectorStore.DeleteByDocID(docID)
+		dm.restoreChunks(docID, old)
+		return err
+	}
+	if err := dm.vectorStore.DeleteByDocID(stagedID); err != nil {
+		log.Printf("Warning: failed to delete staged chunks %s: %v", stagedID, err)
+	}
+
+	// Images of the old version that the new one no longer uses are removed
+	dm.releaseImages(docID)
+	if _, err := dm.db.Exec(`UPDATE OR IGNORE image_refs SET document_id = ? WHERE document_id = ?`, docID, stagedID); err != nil {
+		log.Printf("Warning: failed to move image refs of doc=%s: %v", docID, err)
+	}
+	dm.db.Exec(`DELETE FROM image_refs WHERE document_id = ?`, stagedID)
+	if _, err := dm.db.Exec(`DELETE FROM documents WHERE id = ?`, stagedID); err != nil {
+		log.Printf("Warning: failed to delete staging record %s: %v", stagedID, err)
+	}
+
+	// The original file of the document is the current version's file
+	uploadDir := datadir.Path("uploads", docID)
+	for path := dm.findSavedFile(uploadDir); path != ""; path = dm.findSavedFile(uploadDir) {
+		if err := os.Remove(path); err != nil {
+			log.Printf("Warning: failed to remove replaced file %s: %v", path, err)
+			break
+		}
+	}
+	if err := dm.saveOriginalFile(docID, fileName, fileData); err != nil {
+		log.Printf("Warning: failed to save original file of doc=%s: %v", docID, err)
+	}
+	dm.recordLanguage(docID)
+	dm.TagDocumentAsync(docID)
+	log.Printf("[Versions] doc=%s replaced: %d chunks (was %d)", docID, len(chunks), len(old))
+	return nil
+}
+
+// restoreChunks stores chunks again after a failed swap.
+func (dm *DocumentManager) restoreChunks(docID string, chunks []vectorstore.VectorChunk) {
+	if len(chunks) == 0 {
+		return
+	}
+	if err := dm.vectorStore.Store(docID, chunks); err != nil {
+		errlog.Logf("[Versions] restore original chunks failed doc=%s: %v", docID, err)
+	}
+}
+
+// moveStaged moves the chunk locations, text, translations and video segments of
+// the staging record to the document and copies its file metadata, in one
+// transaction.
+func (dm *DocumentManager) moveStaged(docID, stagedID string) error {
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"chunk_locations", "document_texts", "chunk_translations", "video_segments", "video_chapters"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE document_id = ?`, docID); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+		if _, err := tx.Exec(`UPDATE `+table+` SET document_id = ? WHERE document_id = ?`, docID, stagedID); err != nil {
+			return fmt.Errorf("failed to move %s: %w", table, err)
+		}
+	}
+	// Segment chunk IDs are "{docID}-{index}"
+	if _, err := tx.Exec(`UPDATE video_segments SET chunk_id = ? || substr(chunk_id, ?) WHERE document_id = ? AND chunk_id LIKE ?`,
+		docID, len(stagedID)+1, docID, stagedID+"-%"); err != nil {
+		return fmt.Errorf("failed to move video segments: %w", err)
+	}
+	var name, fileType, hash string
+	var size int64
+	if err := tx.QueryRow(`SELECT name, type, COALESCE(file_size, 0), COALESCE(content_hash, '') FROM documents WHERE id = ?`, stagedID).
+		Scan(&name, &fileType, &size, &hash); err != nil {
+		return fmt.Errorf("failed to query staging record: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE documents SET name = ?, type = ?, file_size = ?, content_hash = ?, error = '', processed_at = ? WHERE id = ?`,
+		name, fileType, size, hash, time.Now(), docID); err != nil {
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+	return tx.Commit()
+}
+
+// discardStaged removes a staging record and everything processed under it.
+func (dm *DocumentManager) discardStaged(stagedID string) {
+	if err := dm.DeleteDocument(stagedID); err != nil {
+		log.Printf("Warning: failed to discard staging record %s: %v", stagedID, err)
+		errlog.Logf("[Versions] discard staging record %s failed: %v", stagedID, err)
+	}
+}
+
+// finishVersion records the outcome of processing a version. A failed
+// version's file is not kept: there is nothing to restore.
+func (dm *DocumentManager) finishVersion(docID string, version int, err error) {
+	status, errMsg := VersionSuccess, ""
+	if err != nil {
+		status, errMsg = VersionFailed, err.Error()
+		os.RemoveAll(versionDir(docID, version))
+	}
+	if _, dbErr := dm.db.Exec(`UPDATE document_versions SET status = ?, error = ?, staged_id = '' WHERE document_id = ? AND version = ?`,
+		status, errMsg, docID, version); dbErr != nil {
+		log.Printf("[Versions] failed to record version %d of doc=%s: %v", version, docID, dbErr)
+	}
+}
+
+// ListVersions returns the versions of a document, newest first. Documents
+// that were never replaced have none.
+func (dm *DocumentManager) ListVersions(docID string) ([]DocumentVersion, error) {
+	rows, err := dm.db.Query(`SELECT version, name, type, file_size, status, error, note, created_by, created_at
+		FROM document_versions WHERE document_id = ? ORDER BY version DESC`, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query versions: %w", err)
+	}
+	defer rows.Close()
+	versions := []DocumentVersion{}
+	current := false
+	for rows.Next() {
+		var v DocumentVersion
+		if err := rows.Scan(&v.Version, &v.Name, &v.Type, &v.FileSize, &v.Status, &v.Error, &v.Note, &v.CreatedBy, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan version: %w", err)
+		}
+		if !current && v.Status == VersionSuccess {
+			v.Current, current = true, true
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// RestoreVersion makes an earlier version current again by replacing the
+// document with that version's file. The restore is recorded as a new
+// version, so the history is never rewritten.
+func (dm *DocumentManager) RestoreVersion(docID string, version int, createdBy string) (*DocumentVersion, error) {
+	var name, fileType, status string
+	err := dm.db.QueryRow(`SELECT name, type, status FROM document_versions WHERE document_id = ? AND version = ?`, docID, version).
+		Scan(&name, &fileType, &status)
+	if err == sql.ErrNoRows {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query version: %w", err)
+	}
+	if status != VersionSuccess {
+		return nil, fmt.Errorf("只能恢复处理成功的版本")
+	}
+	path := dm.findSavedFile(versionDir(docID, version))
+	if path == "" {
+		return nil, fmt.Errorf("版本 %d 的文件不存在", version)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取版本文件失败: %w", err)
+	}
+	return dm.ReplaceDocument(docID, ReplaceFileRequest{
+		FileName:  name,
+		FileData:  data,
+		FileType:  versionFileType(fileType, name),
+		Note:      fmt.Sprintf("恢复自版本 %d", version),
+		CreatedBy: createdBy,
+	})
+}
+
+// versionFileType returns the upload file type of a version file: the stored
+// type, or its legacy variant when the file has a legacy extension.
+func versionFileType(fileType, name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".doc":
+		return "word_legacy"
+	case ".xls":
+		return "excel_legacy"
+	case ".ppt":
+		return "ppt_legacy"
+	}
+	return fileType
+}
+
+// RecoverVersions fails the replacements interrupted by a restart and
+// discards their staging records, as well as those of interrupted knowledge
+// entry edits. Called once at startup.
+func (dm *DocumentManager) RecoverVersions() {
+	rows, err := dm.db.Query(`SELECT document_id, version, staged_id FROM document_versions WHERE status = ?`, VersionProcessing)
+	if err != nil {
+		log.Printf("[Versions] failed to query interrupted versions: %v", err)
+		return
+	}
+	type pending struct {
+		docID, stagedID string
+		version         int
+	}
+	var list []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.docID, &p.version, &p.stagedID); err == nil {
+			list = append(list, p)
+		}
+	}
+	rows.Close()
+	for _, p := range list {
+		if p.stagedID != "" {
+			dm.discardStaged(p.stagedID)
+		}
+		dm.finishVersion(p.docID, p.version, errors.New("服务重启，新版本处理已中断"))
+	}
+	if len(list) > 0 {
+		log.Printf("[Versions] %d replacements interrupted by the last shutdown", len(list))
+	}
+
+	// Any staging record left belongs to an interrupted knowledge entry edit
+	var orphans []string
+	if rows, err := dm.db.Query(`SELECT id FROM documents WHERE status = ?`, StatusStaging); err == nil {
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err == nil {
+				orphans = append(orphans, id)
+			}
+		}
+		rows.Close()
+	}
+	for _, id := range orphans {
+		dm.discardStaged(id)
+	}
+}
+
+// saveFileIn writes data to dir/name, creating dir.
+func saveFileIn(dir, name string, data []byte) error {
+	name = filepath.Base(name)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return fmt.Errorf("invalid filename")
+	}
+	if err := datadir.MkdirAll(dir); err != nil {
+		return err
+	}
+	return datadir.WriteFile(filepath.Join(dir, name), data)
+}
@@ -0,0 +1,235 @@
+// Package document — LLM-based chaptering of video transcripts.
+package document
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"askflow/internal/errlog"
+	"askflow/internal/idgen"
+	"askflow/internal/textutil"
+	"askflow/internal/video"
+)
+
+// VideoChapter is a titled section of a video derived from its transcript.
+type VideoChapter struct {
+	Index     int     `json:"index"`
+	Title     string  `json:"title"`
+	Summary   string  `json:"summary,omitempty"`
+	StartTime float64 `json:"start_time"` // 章节起始时间（秒）
+	EndTime   float64 `json:"end_time"`   // 章节结束时间（秒）
+}
+
+const (
+	// chapterMinVideoSeconds is the transcript length below which chaptering is skipped;
+	// short clips gain nothing from a chapter list.
+	chapterMinVideoSeconds = 300
+	// chapterMaxTranscriptRunes bounds the transcript text sent to the LLM.
+	chapterMaxTranscriptRunes = 30000
+	// chapterMaxCount caps the number of chapters kept per video.
+	chapterMaxCount = 50
+)
+
+// generateChapters asks the LLM to split a transcript into titled chapters.
+// Returns nil (no error) when the video is too short, no LLM is configured,
+// or the model proposes fewer than two chapters.
+func (dm *DocumentManager) generateChapters(docID string, transcript []video.TranscriptSegment) ([]VideoChapter, error) {
+	if len(transcript) == 0 {
+		return nil, nil
+	}
+	videoEnd := transcript[len(transcript)-1].End
+	if videoEnd-transcript[0].Start < chapterMinVideoSeconds {
+		return nil, nil
+	}
+	dm.mu.RLock()
+	ls := dm.llmService
+	dm.mu.RUnlock()
+	if ls == nil {
+		return nil, nil
+	}
+
+	prompt := "你是一个视频内容编辑助手。下面是一段培训/讲解视频的语音转录，每行以 [秒数] 开头表示该句的起始时间。\n" +
+		"请根据话题变化将视频划分为若干章节（一般 3-15 个，每章至少 1 分钟），为每个章节给出简短标题和一句话摘要。\n" +
+		"标题和摘要使用与转录文本相同的语言。\n" +
+		"只输出 JSON 数组，不要输出任何其他内容，格式为：\n" +
+		`[{"start": 0, "title": "章节标题", "summary": "一句话摘要"}]` + "\n" +
+		"start 为章节起始秒数，必须取自转录中的某一行的时间，且按时间递增。"
+
+	text, err := ls.Generate(prompt, nil, formatTranscriptForChapters(transcript))
+	if err != nil {
+		return nil, fmt.Errorf("章节生成失败: %w", err)
+	}
+
+	var raw []struct {
+		Start   float64 `json:"start"`
+		Title   string  `json:"title"`
+		Summary string  `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(extractJSONArray(text)), &raw); err != nil {
+		errlog.Logf("[Video] chapter JSON parse failed doc=%s: %v", docID, err)
+		return nil, fmt.Errorf("章节结果解析失败: %w", err)
+	}
+
+	sort.SliceStable(raw, func(i, j int) bool { return raw[i].Start < raw[j].Start })
+	var chapters []VideoChapter
+	for _, r := range raw {
+		title := strings.TrimSpace(r.Title)
+		if title == "" || r.Start < 0 || r.Start >= videoEnd {
+			continue
+		}
+		if n := len(chapters); n > 0 && r.Start-chapters[n-1].StartTime < 1 {
+			continue // duplicate or overlapping start
+		}
+		chapters = append(chapters, VideoChapter{
+			Title:     textutil.Truncate(title, 100),
+			Summary:   textutil.Truncate(strings.TrimSpace(r.Summary), 300),
+			StartTime: r.Start,
+		})
+		if len(chapters) == chapterMaxCount {
+			break
+		}
+	}
+	if len(chapters) < 2 {
+		return nil, nil
+	}
+
+	// The first chapter always starts with the video; each chapter ends where the next begins.
+	chapters[0].StartTime = 0
+	for i := range chapters {
+		chapters[i].Index = i
+		if i+1 < len(chapters) {
+			chapters[i].EndTime = chapters[i+1].StartTime
+		} else {
+			chapters[i].EndTime = videoEnd
+		}
+	}
+	return chapters, nil
+}
+
+// formatTranscriptForChapters renders transcript segments as "[seconds] text" lines.
+// Long transcripts are merged into progressively wider time windows so the
+// prompt stays within chapterMaxTranscriptRunes while still covering the whole video.
+func formatTranscriptForChapters(transcript []video.TranscriptSegment) string {
+	for _, window := range []float64{0, 15, 30, 60, 120, 300} {
+		var sb strings.Builder
+		var lineStart float64
+		var line []string
+		flush := func() {
+			if len(line) > 0 {
+				sb.WriteString(fmt.Sprintf("[%.0f] %s\n", lineStart, strings.Join(line, " ")))
+				line = line[:0]
+			}
+		}
+		for _, seg := range transcript {
+			t := strings.TrimSpace(seg.Text)
+			if t == "" {
+				continue
+			}
+			if len(line) > 0 && seg.Start-lineStart >= window {
+				flush()
+			}
+			if len(line) == 0 {
+				lineStart = seg.Start
+			}
+			line = append(line, t)
+		}
+		flush()
+		if out := sb.String(); len([]rune(out)) <= chapterMaxTranscriptRunes || window == 300 {
+			return textutil.Truncate(out, chapterMaxTranscriptRunes)
+		}
+	}
+	return ""
+}
+
+// extractJSONArray returns the outermost [...] section of an LLM reply,
+// tolerating markdown code fences and surrounding prose.
+func extractJSONArray(s string) string {
+	start := strings.Index(s, "[")
+	end := strings.LastIndex(s, "]")
+	if start < 0 || end <= start {
+		return s
+	}
+	return s[start : end+1]
+}
+
+// chapterSegments returns the transcript segments that start within the chapter.
+func chapterSegments(ch VideoChapter, transcript []video.TranscriptSegment, last bool) []video.TranscriptSegment {
+	var segs []video.TranscriptSegment
+	for _, seg := range transcript {
+		if seg.Start >= ch.StartTime && (seg.Start < ch.EndTime || last) {
+			segs = append(segs, seg)
+		}
+	}
+	return segs
+}
+
+// storeVideoChapters replaces the stored chapters of a document.
+func (dm *DocumentManager) storeVideoChapters(docID string, chapters []VideoChapter) error {
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始 video_chapters 事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM video_chapters WHERE document_id = ?`, docID); err != nil {
+		return fmt.Errorf("清理 video_chapters 失败: %w", err)
+	}
+	for _, ch := range chapters {
+		id, err := idgen.New()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO video_chapters (id, document_id, chapter_index, title, summary, start_time, end_time) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			id, docID, ch.Index, ch.Title, ch.Summary, ch.StartTime, ch.EndTime,
+		); err != nil {
+			return fmt.Errorf("插入 video_chapters 记录失败: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetVideoChapters returns the chapters of a video document ordered by start time.
+func (dm *DocumentManager) GetVideoChapters(docID string) ([]VideoChapter, error) {
+	rows, err := dm.db.Query(
+		`SELECT chapter_index, title, COALESCE(summary, ''), start_time, end_time FROM video_chapters WHERE document_id = ? ORDER BY chapter_index`,
+		docID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query video chapters: %w", err)
+	}
+	defer rows.Close()
+
+	var chapters []VideoChapter
+	for rows.Next() {
+		var ch VideoChapter
+		if err := rows.Scan(&ch.Index, &ch.Title, &ch.Summary, &ch.StartTime, &ch.EndTime); err != nil {
+			return nil, fmt.Errorf("failed to scan video chapter: %w", err)
+		}
+		chapters = append(chapters, ch)
+	}
+	return chapters, rows.Err()
+}
+
+// chapterTranscript runs the chaptering pass for a parsed video and stores the result.
+// Failures are logged and yield nil so transcript processing falls back to plain chunking.
+func (dm *DocumentManager) chapterTranscript(docID string, transcript []video.TranscriptSegment) []VideoChapter {
+	chapters, err := dm.generateChapters(docID, transcript)
+	if err != nil {
+		log.Printf("Warning: 视频章节划分失败 doc=%s: %v", docID, err)
+		errlog.Logf("[Video] chaptering failed doc=%s: %v", docID, err)
+		return nil
+	}
+	if len(chapters) == 0 {
+		return nil
+	}
+	if err := dm.storeVideoChapters(docID, chapters); err != nil {
+		log.Printf("Warning: 保存视频章节失败 doc=%s: %v", docID, err)
+		errlog.Logf("[Video] store chapters failed doc=%s: %v", docID, err)
+	}
+	log.Printf("[Video] 章节划分完成 doc=%s: %d 个章节", docID, len(chapters))
+	return chapters
+}
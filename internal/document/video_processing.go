@@ -3,16 +3,20 @@ package document
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"askflow/internal/config"
+	"askflow/internal/datadir"
 	"askflow/internal/errlog"
+	"askflow/internal/idgen"
 	"askflow/internal/vectorstore"
 	"askflow/internal/video"
 )
@@ -31,25 +35,36 @@ type videoOCRResult struct {
 //
 // Each phase is independent and fault-tolerant: one phase failing does not block others.
 func (dm *DocumentManager) processVideo(docID, docName string, fileData []byte, productID string) error {
+	return dm.processVideoWith(docID, docName, fileData, productID, nil)
+}
+
+// processVideoWith is processVideo with an optional transcript, such as the
+// captions published with a platform video. A non-empty transcript replaces
+// ASR.
+func (dm *DocumentManager) processVideoWith(docID, docName string, fileData []byte, productID string, transcript []video.TranscriptSegment) error {
 	log.Printf("[Video] Starting video processing for doc=%s file=%q", docID, docName)
 
 	dm.mu.RLock()
 	cfg := dm.videoConfig
 	dm.mu.RUnlock()
+	cfg = dm.keyframeOverridesFor(productID).Apply(cfg)
+	if len(transcript) > 0 {
+		cfg.RapidSpeechPath = ""
+	}
 
-	log.Printf("[Video] Config: FFmpegPath=%q, RapidSpeechPath=%q", cfg.FFmpegPath, cfg.RapidSpeechPath)
+	log.Printf("[Video] Config: FFmpegPath=%q, RapidSpeechPath=%q, KeyframeMode=%q", cfg.FFmpegPath, cfg.RapidSpeechPath, cfg.KeyframeMode)
 
 	// Locate or save the video file
-	uploadDir := filepath.Join(".", "data", "uploads", docID)
+	uploadDir := datadir.Path("uploads", docID)
 	videoPath := dm.findSavedFile(uploadDir)
 	if videoPath == "" {
 		log.Printf("[Video] Saving video file to %s", uploadDir)
-		if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		if err := datadir.MkdirAll(uploadDir); err != nil {
 			return fmt.Errorf("创建上传目录失败: %w", err)
 		}
 		safeName := sanitizeFilename(docName, docID)
 		videoPath = filepath.Join(uploadDir, safeName)
-		if err := os.WriteFile(videoPath, fileData, 0644); err != nil {
+		if err := datadir.WriteFile(videoPath, fileData); err != nil {
 			return fmt.Errorf("保存视频文件失败: %w", err)
 		}
 		log.Printf("[Video] Video file saved to %s", videoPath)
@@ -57,7 +72,7 @@ func (dm *DocumentManager) processVideo(docID, docName string, fileData []byte,
 		log.Printf("[Video] Using existing video file at %s", videoPath)
 	}
 
-	if cfg.FFmpegPath == "" && cfg.RapidSpeechPath == "" {
+	if cfg.FFmpegPath == "" && cfg.RapidSpeechPath == "" && len(transcript) == 0 {
 		log.Printf("[Video] 视频检索工具未配置，仅存储文件名作为可搜索文本: %s", docName)
 		fallbackText := fmt.Sprintf("视频文件: %s", docName)
 		if err := dm.chunkEmbedStore(docID, docName, fallbackText, productID); err != nil {
@@ -74,6 +89,9 @@ func (dm *DocumentManager) processVideo(docID, docName string, fileData []byte,
 		errlog.Logf("[Video] parse failed doc=%s file=%q: %v", docID, docName, err)
 		return fmt.Errorf("视频解析失败: %w", err)
 	}
+	if len(transcript) > 0 {
+		parseResult.Transcript = transcript
+	}
 
 	log.Printf("[Video] 视频解析完成 doc=%s: %d 段转录, %d 个关键帧", docID, len(parseResult.Transcript), len(parseResult.Keyframes))
 
@@ -118,7 +136,7 @@ func (dm *DocumentManager) processVideo(docID, docName string, fileData []byte,
 				transcriptCh <- transcriptResult{err: fmt.Errorf("转录处理panic: %v", r)}
 			}
 		}()
-		count, tErr := dm.processTranscript(docID, docName, productID, parseResult)
+		count, tErr := dm.processTranscript(docID, docName, productID, parseResult, cfg.ChapteringEnabled)
 		transcriptCh <- transcriptResult{chunkCount: count, err: tErr}
 	}()
 
@@ -141,7 +159,7 @@ func (dm *DocumentManager) processVideo(docID, docName string, fileData []byte,
 	// ── Phase 3: LLM keyframe OCR + scene description — concurrent worker pool ──
 	var ocrResults []videoOCRResult
 	if len(ocrIndices) > 0 {
-		ocrResults = dm.processKeyframeDescriptions(docID, parseResult.Keyframes, ocrIndices)
+		ocrResults = dm.processKeyframeDescriptions(docID, parseResult.Keyframes, ocrIndices, dm.ocrLanguageFor(productID))
 	}
 
 	// ── Collect results from all phases ──
@@ -184,32 +202,56 @@ func (dm *DocumentManager) processVideo(docID, docName string, fileData []byte,
 	return nil
 }
 
-// processTranscript handles ASR transcript: join → chunk → embed → store → create video_segments.
+// processTranscript handles ASR transcript: chapter → join → chunk → embed → store → create video_segments.
+// When chaptering is enabled and succeeds, each chapter is chunked separately so chunk
+// boundaries follow topic changes, and chunk text is prefixed with the chapter title.
 // Returns the number of chunks stored.
-func (dm *DocumentManager) processTranscript(docID, docName, productID string, parseResult *video.ParseResult) (int, error) {
+func (dm *DocumentManager) processTranscript(docID, docName, productID string, parseResult *video.ParseResult, chaptering bool) (int, error) {
 	if len(parseResult.Transcript) == 0 {
 		return 0, nil
 	}
 
-	var fullText strings.Builder
-	for _, seg := range parseResult.Transcript {
-		if fullText.Len() > 0 {
-			fullText.WriteString(" ")
-		}
-		fullText.WriteString(strings.TrimSpace(seg.Text))
+	type transcriptChunk struct {
+		text       string
+		start, end float64
 	}
-	if fullText.Len() == 0 {
-		return 0, nil
+	var chunks []transcriptChunk
+	splitSegments := func(segs []video.TranscriptSegment, prefix string) {
+		var fullText strings.Builder
+		for _, seg := range segs {
+			if fullText.Len() > 0 {
+				fullText.WriteString(" ")
+			}
+			fullText.WriteString(strings.TrimSpace(seg.Text))
+		}
+		if strings.TrimSpace(fullText.String()) == "" {
+			return
+		}
+		for _, c := range dm.chunker.Split(fullText.String(), docID) {
+			start, end := dm.mapChunkToTimeRange(c.Text, segs)
+			chunks = append(chunks, transcriptChunk{text: prefix + c.Text, start: start, end: end})
+		}
 	}
 
-	chunks := dm.chunker.Split(fullText.String(), docID)
+	var chapters []VideoChapter
+	if chaptering {
+		chapters = dm.chapterTranscript(docID, parseResult.Transcript)
+	}
+	if len(chapters) > 0 {
+		for i, ch := range chapters {
+			segs := chapterSegments(ch, parseResult.Transcript, i == len(chapters)-1)
+			splitSegments(segs, fmt.Sprintf("[章节: %s] ", ch.Title))
+		}
+	} else {
+		splitSegments(parseResult.Transcript, "")
+	}
 	if len(chunks) == 0 {
 		return 0, nil
 	}
 
 	texts := make([]string, len(chunks))
 	for i, c := range chunks {
-		texts[i] = c.Text
+		texts[i] = c.text
 	}
 
 	embeddings, err := dm.embeddingService.EmbedBatch(texts)
@@ -221,7 +263,7 @@ func (dm *DocumentManager) processTranscript(docID, docName, productID string, p
 	vectorChunks := make([]vectorstore.VectorChunk, len(chunks))
 	for i, c := range chunks {
 		vectorChunks[i] = vectorstore.VectorChunk{
-			ChunkText:    c.Text,
+			ChunkText:    c.text,
 			ChunkIndex:   i,
 			DocumentID:   docID,
 			DocumentName: docName,
@@ -229,7 +271,7 @@ func (dm *DocumentManager) processTranscript(docID, docName, productID string, p
 			ProductID:    productID,
 		}
 	}
-	if err := dm.vectorStore.Store(docID, vectorChunks); err != nil {
+	if err := dm.StoreChunks(docID, vectorChunks); err != nil {
 		errlog.Logf("[Video] transcript store failed doc=%s file=%q: %v", docID, docName, err)
 		return 0, fmt.Errorf("转录向量存储失败: %w", err)
 	}
@@ -250,14 +292,13 @@ func (dm *DocumentManager) processTranscript(docID, docName, productID string, p
 	defer stmt.Close()
 
 	for i, c := range chunks {
-		startTime, endTime := dm.mapChunkToTimeRange(c.Text, parseResult.Transcript)
-		segID, err := generateID()
+		segID, err := idgen.New()
 		if err != nil {
 			log.Printf("Warning: 生成 segment ID 失败: %v", err)
 			continue
 		}
 		chunkID := fmt.Sprintf("%s-%d", docID, i)
-		if _, err := stmt.Exec(segID, docID, "transcript", startTime, endTime, c.Text, chunkID); err != nil {
+		if _, err := stmt.Exec(segID, docID, "transcript", c.start, c.end, c.text, chunkID); err != nil {
 			log.Printf("Warning: 插入 video_segments 记录失败: %v", err)
 		}
 	}
@@ -378,7 +419,7 @@ func (dm *DocumentManager) embedSingleKeyframe(docID, docName, productID string,
 	}
 
 	// Save keyframe image to disk instead of storing large base64 in vector store
-	savedURL, saveErr := dm.saveExtractedImage(kf.Data)
+	savedURL, saveErr := dm.saveExtractedImage(docID, kf.Data)
 	imageURL := savedURL
 	if saveErr != nil {
 		log.Printf("Warning: failed to save keyframe %d image to disk: %v", i, saveErr)
@@ -401,13 +442,13 @@ func (dm *DocumentManager) embedSingleKeyframe(docID, docName, productID string,
 		ImageURL:     imageURL,
 		ProductID:    productID,
 	}}
-	if err := dm.vectorStore.Store(docID, frameChunk); err != nil {
+	if err := dm.StoreChunks(docID, frameChunk); err != nil {
 		log.Printf("Warning: failed to store keyframe vector %d: %v", i, err)
 		errlog.Logf("[Video] keyframe %d store failed doc=%s file=%q: %v", i, docID, docName, err)
 		return false
 	}
 
-	segID, err := generateID()
+	segID, err := idgen.New()
 	if err != nil {
 		log.Printf("Warning: failed to generate segment ID for keyframe %d: %v", i, err)
 		return true // vector already stored, segment record is non-critical
@@ -425,8 +466,8 @@ func (dm *DocumentManager) embedSingleKeyframe(docID, docName, productID string,
 
 // processKeyframeDescriptions runs LLM OCR+scene description on sampled keyframes
 // concurrently with a worker pool and per-frame timeout. Returns collected results
-// sorted by frame index for deterministic output.
-func (dm *DocumentManager) processKeyframeDescriptions(docID string, keyframes []video.Keyframe, ocrIndices map[int]bool) []videoOCRResult {
+// sorted by frame index for deterministic output. lang selects the prompt language.
+func (dm *DocumentManager) processKeyframeDescriptions(docID string, keyframes []video.Keyframe, ocrIndices map[int]bool, lang string) []videoOCRResult {
 	type descJob struct {
 		index    int
 		keyframe video.Keyframe
@@ -451,12 +492,17 @@ func (dm *DocumentManager) processKeyframeDescriptions(docID string, keyframes [
 	}
 
 	var wg sync.WaitGroup
+	var described atomic.Int32
 	for w := 0; w < workerCount; w++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for job := range jobs {
-				dm.describeSingleKeyframe(docID, job.index, job.keyframe, resultsCh)
+				if dm.canceled(docID) != nil {
+					continue
+				}
+				dm.describeSingleKeyframe(docID, job.index, job.keyframe, lang, resultsCh)
+				dm.reportProgress(docID, int(described.Add(1)), len(jobList), "关键帧识别")
 			}
 		}()
 	}
@@ -483,7 +529,7 @@ func (dm *DocumentManager) processKeyframeDescriptions(docID string, keyframes [
 
 // describeSingleKeyframe calls LLM vision API for one keyframe with a per-frame
 // timeout and panic recovery. Sends result to ch on success.
-func (dm *DocumentManager) describeSingleKeyframe(docID string, i int, kf video.Keyframe, ch chan<- videoOCRResult) {
+func (dm *DocumentManager) describeSingleKeyframe(docID string, i int, kf video.Keyframe, lang string, ch chan<- videoOCRResult) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("Warning: keyframe %d LLM描述 panic: %v", i, r)
@@ -501,7 +547,7 @@ func (dm *DocumentManager) describeSingleKeyframe(docID string, i int, kf video.
 	}
 	llmCh := make(chan llmResp, 1)
 	go func() {
-		text, err := dm.describeKeyframeViaLLM(kf.Data)
+		text, err := dm.describeKeyframeViaLLM(kf.Data, lang)
 		llmCh <- llmResp{text, err}
 	}()
 
@@ -563,10 +609,29 @@ func (dm *DocumentManager) storeKeyframeDescriptions(docID, docName, productID s
 			ProductID:    productID,
 		}
 	}
-	if storeErr := dm.vectorStore.Store(docID, ocrVectorChunks); storeErr != nil {
+	if storeErr := dm.StoreChunks(docID, ocrVectorChunks); storeErr != nil {
 		log.Printf("Warning: OCR vector store failed for doc=%s: %v", docID, storeErr)
 		errlog.Logf("[Video OCR] vector store failed for doc=%s: %v", docID, storeErr)
 	} else {
 		log.Printf("视频关键帧OCR+描述文本已存储: doc=%s, %d 个分块", docID, len(ocrVectorChunks))
 	}
 }
+
+// keyframeOverridesFor loads the product's keyframe extraction overrides.
+// Returns nil when the product has none (or they cannot be decoded).
+func (dm *DocumentManager) keyframeOverridesFor(productID string) *config.KeyframeOverrides {
+	if productID == "" || dm.db == nil {
+		return nil
+	}
+	var raw string
+	err := dm.db.QueryRow("SELECT COALESCE(keyframe_overrides, '') FROM products WHERE id = ?", productID).Scan(&raw)
+	if err != nil || raw == "" {
+		return nil
+	}
+	var o config.KeyframeOverrides
+	if err := json.Unmarshal([]byte(raw), &o); err != nil {
+		log.Printf("[Video] invalid keyframe overrides for product=%s: %v", productID, err)
+		return nil
+	}
+	return &o
+}
@@ -160,6 +160,58 @@ func (s *Service) SendTest(toEmail string) error {
 	return s.send(cfg, fromAddr, toEmail, msg)
 }
 
+// SendQuarantineAlert notifies an administrator that an uploaded file was
+// quarantined by the malware scan.
+func (s *Service) SendQuarantineAlert(toEmail, fileName, docID, reason string) error {
+	cfg := s.cfg()
+	if cfg.Host == "" {
+		return fmt.Errorf("SMTP 服务器未配置")
+	}
+
+	fromName := cfg.FromName
+	if fromName == "" {
+		fromName = "软件自助服务平台"
+	}
+	fromAddr := cfg.FromAddr
+	if fromAddr == "" {
+		fromAddr = cfg.Username
+	}
+
+	subject := "安全告警：上传文件已被隔离"
+	body := fmt.Sprintf(
+		"管理员您好，\r\n\r\n"+
+			"恶意软件扫描隔离了一个上传的文件，该文件未被导入知识库。\r\n\r\n"+
+			"文件名：%s\r\n文档 ID：%s\r\n原因：%s\r\n时间：%s\r\n\r\n"+
+			"请在文档管理中核实后删除该文档。",
+		fileName, docID, reason, time.Now().Format("2006-01-02 15:04:05"),
+	)
+
+	msg := buildMessage(fromName, fromAddr, toEmail, subject, body)
+	return s.send(cfg, fromAddr, toEmail, msg)
+}
+
+// SendAlert sends a notification an administrator subscribed to. body is
+// plain text with "\n" line breaks.
+func (s *Service) SendAlert(toEmail, subject, body string) error {
+	cfg := s.cfg()
+	if cfg.Host == "" {
+		return fmt.Errorf("SMTP 服务器未配置")
+	}
+
+	fromName := cfg.FromName
+	if fromName == "" {
+		fromName = "软件自助服务平台"
+	}
+	fromAddr := cfg.FromAddr
+	if fromAddr == "" {
+		fromAddr = cfg.Username
+	}
+
+	body = strings.ReplaceAll(body, "\n", "\r\n") + "\r\n\r\n如需调整通知，请在管理后台的“我的通知”中修改。"
+	msg := buildMessage(fromName, fromAddr, toEmail, subject, body)
+	return s.send(cfg, fromAddr, toEmail, msg)
+}
+
 func buildMessage(fromName, fromAddr, to, subject, body string) []byte {
 	// Sanitize headers to prevent email header injection
 	sanitize := func(s string) string {
@@ -0,0 +1,109 @@
+package embedding
+
+import (
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// DefaultFakeDimensions is the vector size of a FakeEmbeddingService created
+// with a non-positive dimension.
+const DefaultFakeDimensions = 64
+
+// FakeEmbeddingService implements EmbeddingService without an API, for
+// integration tests. Vectors are computed from the text alone, so the same
+// text always gets the same vector. Each word (each character for CJK text)
+// is hashed into one of Dimensions buckets, so texts sharing words get
+// similar vectors and searches still return the relevant chunks.
+type FakeEmbeddingService struct {
+	Dimensions int
+}
+
+// NewFakeEmbeddingService creates a FakeEmbeddingService producing vectors of
+// the given size, or DefaultFakeDimensions when dimensions is not positive.
+func NewFakeEmbeddingService(dimensions int) *FakeEmbeddingService {
+	if dimensions <= 0 {
+		dimensions = DefaultFakeDimensions
+	}
+	return &FakeEmbeddingService{Dimensions: dimensions}
+}
+
+// Embed returns the vector of text.
+func (s *FakeEmbeddingService) Embed(text string) ([]float64, error) {
+	return s.vector(fakeTokens(text)), nil
+}
+
+// EmbedBatch returns the vectors of texts in order.
+func (s *FakeEmbeddingService) EmbedBatch(texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, t := range texts {
+		vectors[i] = s.vector(fakeTokens(t))
+	}
+	return vectors, nil
+}
+
+// EmbedImageURL returns a vector derived from the URL itself; the image is
+// not fetched.
+func (s *FakeEmbeddingService) EmbedImageURL(imageURL string) ([]float64, error) {
+	return s.vector([]string{imageURL}), nil
+}
+
+// vector hashes tokens into a unit vector. Text without tokens maps to the
+// first axis so that it never gets a zero vector.
+func (s *FakeEmbeddingService) vector(tokens []string) []float64 {
+	dims := s.Dimensions
+	if dims <= 0 {
+		dims = DefaultFakeDimensions
+	}
+	v := make([]float64, dims)
+	for _, t := range tokens {
+		h := fnv.New64a()
+		h.Write([]byte(t))
+		sum := h.Sum64()
+		if sum>>63 == 0 {
+			v[sum%uint64(dims)]++
+		} else {
+			v[sum%uint64(dims)]--
+		}
+	}
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		v[0] = 1
+		return v
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+// fakeTokens splits text into lower-cased words; Han, Hiragana, Katakana and
+// Hangul characters are tokens of their own.
+func fakeTokens(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
@@ -0,0 +1,156 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"askflow/internal/config"
+)
+
+// dataset is one exported table. query has a single %s for the WHERE
+// conditions, which bound timeColumn to the run's period.
+type dataset struct {
+	name       string
+	timeColumn string
+	columns    []string
+	query      string
+}
+
+var datasets = []dataset{
+	{
+		// Every answered question, with its outcome.
+		name:       DatasetQueries,
+		timeColumn: "q.created_at",
+		columns: []string{"id", "user_id", "product_id", "question", "answer", "is_pending",
+			"rating", "faithfulness", "created_at"},
+		query: `SELECT q.id, q.user_id, COALESCE(q.product_id, ''), q.question, COALESCE(q.answer, ''),
+				q.is_pending, COALESCE(q.rating, 0), q.faithfulness, q.created_at
+			FROM query_logs q WHERE %s ORDER BY q.created_at, q.id`,
+	},
+	{
+		// Ratings given in the period, including those on older answers.
+		name:       DatasetFeedback,
+		timeColumn: "q.rated_at",
+		columns:    []string{"query_id", "user_id", "product_id", "rating", "comment", "rated_at"},
+		query: `SELECT q.id, q.user_id, COALESCE(q.product_id, ''), q.rating,
+				COALESCE(q.feedback_comment, ''), q.rated_at
+			FROM query_logs q WHERE q.rating != 0 AND %s ORDER BY q.rated_at, q.id`,
+	},
+	{
+		// Daily totals per product. A day split across two runs appears in
+		// both with partial counts; sums stay correct, unique users do not.
+		name:       DatasetUsage,
+		timeColumn: "q.created_at",
+		columns: []string{"date", "product_id", "queries", "unique_users", "escalations",
+			"rated", "positive", "verified", "avg_faithfulness"},
+		query: `SELECT substr(q.created_at, 1, 10) AS day, COALESCE(q.product_id, '') AS product,
+				COUNT(*), COUNT(DISTINCT q.user_id), SUM(CASE WHEN q.is_pending = 1 THEN 1 ELSE 0 END),
+				SUM(CASE WHEN q.rating != 0 THEN 1 ELSE 0 END), SUM(CASE WHEN q.rating > 0 THEN 1 ELSE 0 END),
+				COUNT(q.faithfulness), AVG(q.faithfulness)
+			FROM query_logs q WHERE %s GROUP BY day, product ORDER BY day, product`,
+	},
+}
+
+// rowWriter encodes dataset rows in one export format.
+type rowWriter interface {
+	write(vals []interface{}) error
+	flush() error
+}
+
+func newWriter(format string, w io.Writer, columns []string) rowWriter {
+	if format == config.ExportCSV {
+		return &csvWriter{w: csv.NewWriter(w), columns: columns}
+	}
+	return &ndjsonWriter{w: bufio.NewWriter(w), columns: columns}
+}
+
+// ndjsonWriter writes one JSON object per line, keys in column order.
+type ndjsonWriter struct {
+	w       *bufio.Writer
+	columns []string
+}
+
+func (n *ndjsonWriter) write(vals []interface{}) error {
+	n.w.WriteByte('{')
+	for i, col := range n.columns {
+		if i > 0 {
+			n.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(col)
+		val, err := json.Marshal(normalize(vals[i]))
+		if err != nil {
+			return err
+		}
+		n.w.Write(key)
+		n.w.WriteByte(':')
+		n.w.Write(val)
+	}
+	_, err := n.w.WriteString("}\n")
+	return err
+}
+
+func (n *ndjsonWriter) flush() error { return n.w.Flush() }
+
+// csvWriter writes a header row followed by the records; NULL is empty.
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+	started bool
+}
+
+func (c *csvWriter) write(vals []interface{}) error {
+	if !c.started {
+		c.started = true
+		if err := c.w.Write(c.columns); err != nil {
+			return err
+		}
+	}
+	rec := make([]string, len(vals))
+	for i, v := range vals {
+		switch v := normalize(v).(type) {
+		case nil:
+		case string:
+			rec[i] = v
+		case int64:
+			rec[i] = strconv.FormatInt(v, 10)
+		case float64:
+			rec[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			rec[i] = strconv.FormatBool(v)
+		}
+	}
+	return c.w.Write(rec)
+}
+
+func (c *csvWriter) flush() error {
+	if !c.started {
+		// An empty period still gets a header so loaders see the schema
+		c.started = true
+		if err := c.w.Write(c.columns); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// normalize converts a scanned column value to a string, int64, float64,
+// bool or nil. Timestamps are exported as RFC 3339 in UTC.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case string:
+		if t, err := time.Parse(sqliteTimeLayout, v); err == nil {
+			return t.Format(time.RFC3339)
+		}
+		return v
+	}
+	return v
+}
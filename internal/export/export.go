@@ -0,0 +1,390 @@
+// Package export periodically writes query logs, feedback and usage metrics
+// as newline-delimited JSON or CSV files, optionally uploads them to object
+// storage and pushes them to a webhook, so BI teams can analyse support-bot
+// performance in their own tooling. Each run exports the records added since
+// the previous successful run.
+package export
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"askflow/internal/backup"
+	"askflow/internal/config"
+	"askflow/internal/datadir"
+	"askflow/internal/errlog"
+	"askflow/internal/periodic"
+)
+
+const (
+	// fileTimeLayout stamps export file names with the end of their period.
+	fileTimeLayout = "20060102-150405"
+)
+
+// sqliteTimeLayout matches the format query_logs timestamps are stored in.
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// Run triggers.
+const (
+	TriggerScheduled = "scheduled"
+	TriggerManual    = "manual"
+)
+
+// Exported datasets.
+const (
+	DatasetQueries  = "queries"
+	DatasetFeedback = "feedback"
+	DatasetUsage    = "usage"
+)
+
+// ErrRunning is returned by RunNow while an export is in progress.
+var ErrRunning = errors.New("export already running")
+
+var client = &http.Client{Timeout: 60 * time.Second}
+
+// Run is the result of one export run. PeriodFrom is zero for the first
+// run, which exports the whole history.
+type Run struct {
+	ID         int64     `json:"id"`
+	Trigger    string    `json:"trigger"`
+	StartedAt  time.Time `json:"started_at"`
+	PeriodFrom time.Time `json:"period_from"`
+	PeriodTo   time.Time `json:"period_to"`
+	Queries    int       `json:"queries"`
+	Feedback   int       `json:"feedback"`
+	UsageRows  int       `json:"usage_rows"`
+	Files      []string  `json:"files"` // local paths and s3:// locations
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Status is the export state shown in the admin panel.
+type Status struct {
+	Config  config.ExportConfig `json:"config"`
+	Running bool                `json:"running"`
+	NextRun *time.Time          `json:"next_run,omitempty"` // nil when scheduled export is disabled
+	Runs    []Run               `json:"runs"`               // most recent first
+}
+
+// Service runs exports on demand and at the configured interval.
+type Service struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+	cfg     func() config.ExportConfig
+	s3      func() config.S3Config
+
+	runner *periodic.Runner
+}
+
+// NewService creates an export service. cfg and s3 return the current
+// export settings and the backup object storage so config changes apply
+// without a restart.
+func NewService(readDB, writeDB *sql.DB, cfg func() config.ExportConfig, s3 func() config.S3Config) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB, cfg: cfg, s3: s3, runner: periodic.New("Export", ErrRunning)}
+}
+
+// Start launches the scheduler that exports once per interval.
+func (s *Service) Start() {
+	s.runner.Start(func(now time.Time) {
+		if s.due(now) {
+			s.RunNow(TriggerScheduled)
+		}
+	})
+}
+
+// Stop stops scheduled exports and waits for a running export to finish.
+func (s *Service) Stop() {
+	s.runner.Stop()
+}
+
+// due reports whether a scheduled export should start at now.
+func (s *Service) due(now time.Time) bool {
+	cfg := s.cfg()
+	if !cfg.Enabled {
+		return false
+	}
+	next := s.nextRun(cfg)
+	return next != nil && !now.Before(*next)
+}
+
+// nextRun returns when the next scheduled export starts: one interval after
+// the last run, or immediately when nothing was exported yet.
+func (s *Service) nextRun(cfg config.ExportConfig) *time.Time {
+	// Selecting the column rather than MAX() keeps its DATETIME type
+	var last time.Time
+	err := s.readDB.QueryRow(`SELECT started_at FROM export_runs ORDER BY started_at DESC LIMIT 1`).Scan(&last)
+	if err == sql.ErrNoRows {
+		now := time.Now()
+		return &now
+	}
+	if err != nil {
+		log.Printf("[Export] failed to read last run: %v", err)
+		return nil
+	}
+	next := last.Add(time.Duration(cfg.IntervalHours) * time.Hour)
+	return &next
+}
+
+// RunNow exports immediately and records the result. It returns ErrRunning
+// if another run is in progress. A failed step is recorded in Run.Error and
+// also returned.
+func (s *Service) RunNow(trigger string) (run *Run, err error) {
+	if busy := s.runner.Do(func() { run, err = s.run(trigger) }); busy != nil {
+		return nil, busy
+	}
+	return run, err
+}
+
+// RunAsync starts an export in the background; progress is visible through
+// Status. It returns ErrRunning if a run is already in progress.
+func (s *Service) RunAsync(trigger string) error {
+	return s.runner.Go(func() { s.run(trigger) })
+}
+
+// run performs an export.
+func (s *Service) run(trigger string) (*Run, error) {
+	run := &Run{Trigger: trigger, StartedAt: time.Now().UTC(), Files: []string{}}
+	err := s.export(run)
+	run.DurationMs = time.Since(run.StartedAt).Milliseconds()
+	if err != nil {
+		run.Error = err.Error()
+		log.Printf("[Export] %s run failed after %dms: %v", trigger, run.DurationMs, err)
+		errlog.Logf("[Export] %s run failed: %v", trigger, err)
+	} else {
+		log.Printf("[Export] %s run done in %dms: queries=%d feedback=%d usage_rows=%d files=%d",
+			trigger, run.DurationMs, run.Queries, run.Feedback, run.UsageRows, len(run.Files))
+	}
+	if recErr := s.record(run); recErr != nil {
+		log.Printf("[Export] failed to record run: %v", recErr)
+	}
+	return run, err
+}
+
+// export writes every dataset for the period since the last successful run
+// and delivers the files to the configured destinations.
+func (s *Service) export(run *Run) error {
+	cfg := s.cfg()
+	var from time.Time
+	err := s.readDB.QueryRow(
+		`SELECT period_to FROM export_runs WHERE COALESCE(error, '') = '' ORDER BY period_to DESC LIMIT 1`,
+	).Scan(&from)
+	switch {
+	case err == nil:
+		run.PeriodFrom = from.UTC()
+	case err != sql.ErrNoRows:
+		return fmt.Errorf("读取上次导出时间失败: %w", err)
+	}
+	run.PeriodTo = run.StartedAt.Truncate(time.Second)
+
+	dir := cfg.Dir
+	if dir == "" {
+		dir = datadir.Path("exports")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("创建导出目录失败: %w", err)
+	}
+
+	format := cfg.EffectiveFormat()
+	var s3cfg config.S3Config
+	if cfg.S3 {
+		s3cfg = s.s3()
+		if !s3cfg.Enabled() {
+			return errors.New("未配置对象存储 (backup.s3)，无法上传导出文件")
+		}
+	}
+	for _, ds := range datasets {
+		localPath := filepath.Join(dir, ds.name+"-"+run.PeriodTo.Format(fileTimeLayout)+"."+format)
+		n, err := s.writeDataset(ds, run, format, localPath)
+		if err != nil {
+			return fmt.Errorf("导出 %s 失败: %w", ds.name, err)
+		}
+		switch ds.name {
+		case DatasetQueries:
+			run.Queries = n
+		case DatasetFeedback:
+			run.Feedback = n
+		case DatasetUsage:
+			run.UsageRows = n
+		}
+		run.Files = append(run.Files, localPath)
+
+		if cfg.S3 {
+			key := path.Join(strings.Trim(cfg.S3Prefix, "/"), filepath.Base(localPath))
+			uri, err := backup.PutFile(s3cfg, key, localPath)
+			if err != nil {
+				return fmt.Errorf("上传 %s 失败: %w", ds.name, err)
+			}
+			run.Files = append(run.Files, uri)
+		}
+		if cfg.WebhookURL != "" {
+			if err := push(cfg, ds.name, format, run, localPath); err != nil {
+				return fmt.Errorf("推送 %s 失败: %w", ds.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// writeDataset streams the rows of ds for the run's period into localPath
+// and returns the number of rows written.
+func (s *Service) writeDataset(ds dataset, run *Run, format, localPath string) (n int, err error) {
+	where := []string{"1=1"}
+	var args []interface{}
+	if !run.PeriodFrom.IsZero() {
+		where = append(where, ds.timeColumn+" >= ?")
+		args = append(args, run.PeriodFrom.Format(sqliteTimeLayout))
+	}
+	where = append(where, ds.timeColumn+" < ?")
+	args = append(args, run.PeriodTo.Format(sqliteTimeLayout))
+
+	rows, err := s.readDB.Query(fmt.Sprintf(ds.query, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	f, err := os.Create(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(localPath)
+		}
+	}()
+
+	w := newWriter(format, f, ds.columns)
+	vals := make([]interface{}, len(ds.columns))
+	ptrs := make([]interface{}, len(ds.columns))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		if err := w.write(vals); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	return n, w.flush()
+}
+
+// push POSTs an export file to the webhook. The dataset and period travel
+// in headers; with a secret the body is signed with HMAC-SHA256.
+func push(cfg config.ExportConfig, name, format string, run *Run, localPath string) error {
+	body, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if format == config.ExportCSV {
+		req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	req.Header.Set("X-Askflow-Dataset", name)
+	req.Header.Set("X-Askflow-File", filepath.Base(localPath))
+	if !run.PeriodFrom.IsZero() {
+		req.Header.Set("X-Askflow-Period-From", run.PeriodFrom.Format(time.RFC3339))
+	}
+	req.Header.Set("X-Askflow-Period-To", run.PeriodTo.Format(time.RFC3339))
+	if cfg.WebhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(cfg.WebhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Askflow-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook 返回 %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// record stores a run and prunes old records.
+func (s *Service) record(run *Run) error {
+	files, _ := json.Marshal(run.Files)
+	var from interface{}
+	if !run.PeriodFrom.IsZero() {
+		from = run.PeriodFrom
+	}
+	res, err := s.writeDB.Exec(
+		`INSERT INTO export_runs (trigger_type, started_at, period_from, period_to, queries, feedback,
+			usage_rows, files, duration_ms, error)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.Trigger, run.StartedAt, from, run.PeriodTo, run.Queries, run.Feedback,
+		run.UsageRows, string(files), run.DurationMs, run.Error,
+	)
+	if err != nil {
+		return err
+	}
+	run.ID, _ = res.LastInsertId()
+	_, err = s.writeDB.Exec(`DELETE FROM export_runs WHERE id NOT IN (SELECT id FROM export_runs ORDER BY id DESC LIMIT ?)`, periodic.KeepRuns)
+	return err
+}
+
+// Status returns whether exports are scheduled, whether a run is in
+// progress and the most recent runs.
+func (s *Service) Status(limit int) (*Status, error) {
+	cfg := s.cfg()
+	st := &Status{Config: cfg, Running: s.runner.Running(), Runs: []Run{}}
+	if cfg.Enabled {
+		st.NextRun = s.nextRun(cfg)
+	}
+
+	rows, err := s.readDB.Query(
+		`SELECT id, trigger_type, started_at, period_from, period_to, queries, feedback,
+			usage_rows, COALESCE(files, ''), duration_ms, COALESCE(error, '')
+		 FROM export_runs ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query export runs: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r Run
+		var from sql.NullTime
+		var files string
+		if err := rows.Scan(&r.ID, &r.Trigger, &r.StartedAt, &from, &r.PeriodTo, &r.Queries, &r.Feedback,
+			&r.UsageRows, &files, &r.DurationMs, &r.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan export run: %w", err)
+		}
+		if from.Valid {
+			r.PeriodFrom = from.Time
+		}
+		r.Files = []string{}
+		if files != "" {
+			json.Unmarshal([]byte(files), &r.Files)
+		}
+		st.Runs = append(st.Runs, r)
+	}
+	return st, rows.Err()
+}
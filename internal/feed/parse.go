@@ -0,0 +1,196 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Entry is a single item of an RSS or Atom feed, normalised across both formats.
+type Entry struct {
+	GUID      string
+	Title     string
+	Link      string
+	Content   string // full content when the feed provides it, otherwise the summary (may be HTML)
+	Published time.Time
+}
+
+// rssDoc covers RSS 2.0 (and the common RSS 0.9x/1.0 item layout).
+type rssDoc struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items []rssItem `xml:"item"` // RSS 1.0 (RDF) puts items next to the channel
+}
+
+type rssItem struct {
+	GUID        string `xml:"guid"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Encoded     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type atomDoc struct {
+	Title   string      `xml:"title"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Links   []atomLink `xml:"link"`
+	Content atomText   `xml:"content"`
+	Summary atomText   `xml:"summary"`
+	Updated string     `xml:"updated"`
+	Publish string     `xml:"published"`
+}
+
+// atomText is an Atom text construct; type="xhtml" carries markup as child elements.
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t atomText) String() string {
+	if t.Type == "xhtml" {
+		return t.Inner
+	}
+	return t.Text
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+// Parse decodes an RSS or Atom document and returns its title and entries in
+// document order. Entries without any usable identifier are skipped.
+func Parse(data []byte) (string, []Entry, error) {
+	root, err := rootElement(data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch root {
+	case "feed":
+		var doc atomDoc
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return "", nil, fmt.Errorf("invalid Atom feed: %w", err)
+		}
+		entries := make([]Entry, 0, len(doc.Entries))
+		for _, e := range doc.Entries {
+			entry := Entry{
+				GUID:    strings.TrimSpace(e.ID),
+				Title:   strings.TrimSpace(e.Title),
+				Link:    atomAlternateLink(e.Links),
+				Content: e.Content.String(),
+			}
+			if strings.TrimSpace(entry.Content) == "" {
+				entry.Content = e.Summary.String()
+			}
+			entry.Published = parseFeedTime(e.Publish)
+			if entry.Published.IsZero() {
+				entry.Published = parseFeedTime(e.Updated)
+			}
+			if entry.GUID == "" {
+				entry.GUID = entry.Link
+			}
+			if entry.GUID != "" {
+				entries = append(entries, entry)
+			}
+		}
+		return strings.TrimSpace(doc.Title), entries, nil
+
+	case "rss", "RDF":
+		var doc rssDoc
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return "", nil, fmt.Errorf("invalid RSS feed: %w", err)
+		}
+		items := append(doc.Channel.Items, doc.Items...)
+		entries := make([]Entry, 0, len(items))
+		for _, it := range items {
+			entry := Entry{
+				GUID:    strings.TrimSpace(it.GUID),
+				Title:   strings.TrimSpace(it.Title),
+				Link:    strings.TrimSpace(it.Link),
+				Content: it.Encoded,
+			}
+			if strings.TrimSpace(entry.Content) == "" {
+				entry.Content = it.Description
+			}
+			entry.Published = parseFeedTime(it.PubDate)
+			if entry.Published.IsZero() {
+				entry.Published = parseFeedTime(it.Date)
+			}
+			if entry.GUID == "" {
+				entry.GUID = entry.Link
+			}
+			if entry.GUID == "" && entry.Title != "" {
+				entry.GUID = entry.Title + "|" + strings.TrimSpace(it.PubDate)
+			}
+			if entry.GUID != "" {
+				entries = append(entries, entry)
+			}
+		}
+		return strings.TrimSpace(doc.Channel.Title), entries, nil
+	}
+	return "", nil, fmt.Errorf("不是有效的 RSS/Atom 订阅源（根元素 <%s>）", root)
+}
+
+// rootElement returns the local name of the first XML element.
+func rootElement(data []byte) (string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", fmt.Errorf("不是有效的 RSS/Atom 订阅源: %w", err)
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			return se.Name.Local, nil
+		}
+	}
+}
+
+// atomAlternateLink picks the entry's HTML link: rel="alternate" or a link without rel.
+func atomAlternateLink(links []atomLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	return ""
+}
+
+// feedTimeLayouts lists the date formats seen in RSS (RFC 822 variants) and Atom (RFC 3339).
+var feedTimeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02",
+}
+
+// parseFeedTime parses a feed date, returning the zero time when the format is unknown.
+func parseFeedTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
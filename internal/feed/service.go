@@ -0,0 +1,434 @@
+// Package feed implements RSS/Atom feed subscriptions: admins register a feed
+// per product and a background scheduler imports new entries as documents.
+package feed
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"askflow/internal/document"
+	"askflow/internal/errlog"
+	"askflow/internal/idgen"
+)
+
+const (
+	// DefaultIntervalMin is the polling interval used when none is given.
+	DefaultIntervalMin = 60
+	// MinIntervalMin and MaxIntervalMin bound the per-feed polling interval.
+	MinIntervalMin = 5
+	MaxIntervalMin = 7 * 24 * 60
+
+	// maxFeedBytes limits the size of a downloaded feed document.
+	maxFeedBytes = 5 << 20
+	// maxEntriesPerPoll caps how many new entries are imported in one poll so a
+	// freshly added feed with a long history does not flood the knowledge base.
+	maxEntriesPerPoll = 20
+	// minInlineContentRunes is the length above which the content embedded in the
+	// feed is imported directly; shorter entries (summaries) fetch the linked page.
+	minInlineContentRunes = 500
+	// schedulerTick is how often the scheduler looks for feeds that are due.
+	schedulerTick = time.Minute
+
+	// DocumentType is the document type recorded for entries imported from feed content.
+	DocumentType = "feed"
+)
+
+// Feed is a registered RSS/Atom subscription.
+type Feed struct {
+	ID            string     `json:"id"`
+	ProductID     string     `json:"product_id"`
+	URL           string     `json:"url"`
+	Title         string     `json:"title"`
+	IntervalMin   int        `json:"interval_min"`
+	Enabled       bool       `json:"enabled"`
+	LastFetchedAt *time.Time `json:"last_fetched_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	ItemCount     int        `json:"item_count"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// PollResult summarises one poll of a feed.
+type PollResult struct {
+	NewEntries int `json:"new_entries"`
+	Imported   int `json:"imported"`
+	Failed     int `json:"failed"`
+}
+
+// Importer is the subset of DocumentManager used to fetch feeds and import entries.
+type Importer interface {
+	FetchExternalURL(url string, maxBytes int64) ([]byte, string, error)
+	UploadURL(req document.UploadURLRequest) (*document.DocumentInfo, error)
+	ImportWebContent(req document.ImportWebContentRequest) (*document.DocumentInfo, error)
+}
+
+// Service manages feed subscriptions and the polling scheduler.
+type Service struct {
+	readDB   *sql.DB
+	writeDB  *sql.DB
+	importer Importer
+
+	pollMu sync.Mutex // serialises polls so a feed is never imported twice concurrently
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewService creates a new feed Service.
+func NewService(readDB, writeDB *sql.DB, importer Importer) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB, importer: importer}
+}
+
+// Create registers a feed for a product. The feed is fetched once to validate it
+// and to pick up its title; entries are imported by the next scheduler run.
+func (s *Service) Create(productID, url string, intervalMin int) (*Feed, error) {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return nil, fmt.Errorf("订阅源 URL 不能为空")
+	}
+	if intervalMin == 0 {
+		intervalMin = DefaultIntervalMin
+	}
+	if intervalMin < MinIntervalMin || intervalMin > MaxIntervalMin {
+		return nil, fmt.Errorf("轮询间隔必须在 %d 到 %d 分钟之间", MinIntervalMin, MaxIntervalMin)
+	}
+
+	var count int
+	if err := s.writeDB.QueryRow("SELECT COUNT(*) FROM feeds WHERE product_id = ? AND url = ?", productID, url).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to check feed uniqueness: %w", err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("该产品已订阅此订阅源")
+	}
+
+	data, _, err := s.importer.FetchExternalURL(url, maxFeedBytes)
+	if err != nil {
+		return nil, fmt.Errorf("获取订阅源失败: %w", err)
+	}
+	title, _, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := idgen.New()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	_, err = s.writeDB.Exec(
+		"INSERT INTO feeds (id, product_id, url, title, interval_min, enabled, created_at) VALUES (?, ?, ?, ?, ?, 1, ?)",
+		id, productID, url, title, intervalMin, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create feed: %w", err)
+	}
+	return &Feed{ID: id, ProductID: productID, URL: url, Title: title, IntervalMin: intervalMin, Enabled: true, CreatedAt: now}, nil
+}
+
+// Update changes the polling interval and enabled flag of a feed.
+func (s *Service) Update(id string, intervalMin int, enabled bool) (*Feed, error) {
+	if intervalMin < MinIntervalMin || intervalMin > MaxIntervalMin {
+		return nil, fmt.Errorf("轮询间隔必须在 %d 到 %d 分钟之间", MinIntervalMin, MaxIntervalMin)
+	}
+	result, err := s.writeDB.Exec("UPDATE feeds SET interval_min = ?, enabled = ? WHERE id = ?", intervalMin, enabled, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update feed: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("订阅源不存在")
+	}
+	return s.Get(id)
+}
+
+// Delete removes a feed and its GUID history. Documents already imported are kept.
+func (s *Service) Delete(id string) error {
+	tx, err := s.writeDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM feed_items WHERE feed_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete feed items: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM feeds WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete feed: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("订阅源不存在")
+	}
+	return tx.Commit()
+}
+
+const feedColumns = `f.id, f.product_id, f.url, COALESCE(f.title, ''), f.interval_min, f.enabled,
+	f.last_fetched_at, COALESCE(f.last_error, ''), f.created_at,
+	(SELECT COUNT(*) FROM feed_items i WHERE i.feed_id = f.id AND i.document_id != '')`
+
+func scanFeed(scan func(dest ...interface{}) error) (*Feed, error) {
+	var f Feed
+	var enabled int
+	var lastFetched sql.NullTime
+	if err := scan(&f.ID, &f.ProductID, &f.URL, &f.Title, &f.IntervalMin, &enabled,
+		&lastFetched, &f.LastError, &f.CreatedAt, &f.ItemCount); err != nil {
+		return nil, err
+	}
+	f.Enabled = enabled == 1
+	if lastFetched.Valid {
+		t := lastFetched.Time
+		f.LastFetchedAt = &t
+	}
+	return &f, nil
+}
+
+// Get returns a single feed.
+func (s *Service) Get(id string) (*Feed, error) {
+	f, err := scanFeed(s.readDB.QueryRow("SELECT "+feedColumns+" FROM feeds f WHERE f.id = ?", id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("订阅源不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feed: %w", err)
+	}
+	return f, nil
+}
+
+// List returns feeds, optionally filtered by product, newest first.
+func (s *Service) List(productID string) ([]Feed, error) {
+	query := "SELECT " + feedColumns + " FROM feeds f"
+	var args []interface{}
+	if productID != "" {
+		query += " WHERE f.product_id = ?"
+		args = append(args, productID)
+	}
+	query += " ORDER BY f.created_at DESC"
+	rows, err := s.readDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feeds: %w", err)
+	}
+	defer rows.Close()
+	var feeds []Feed
+	for rows.Next() {
+		f, err := scanFeed(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan feed: %w", err)
+		}
+		feeds = append(feeds, *f)
+	}
+	return feeds, rows.Err()
+}
+
+// Poll fetches a feed immediately and imports entries whose GUID has not been seen before.
+func (s *Service) Poll(id string) (*PollResult, error) {
+	f, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.poll(f)
+}
+
+func (s *Service) poll(f *Feed) (*PollResult, error) {
+	s.pollMu.Lock()
+	defer s.pollMu.Unlock()
+
+	result, err := s.fetchAndImport(f)
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+		errlog.Logf("[Feed] poll failed feed=%s url=%q: %v", f.ID, f.URL, err)
+	}
+	if _, dbErr := s.writeDB.Exec("UPDATE feeds SET last_fetched_at = ?, last_error = ? WHERE id = ?",
+		time.Now().UTC(), errMsg, f.ID); dbErr != nil {
+		log.Printf("[Feed] failed to update feed status %s: %v", f.ID, dbErr)
+	}
+	return result, err
+}
+
+func (s *Service) fetchAndImport(f *Feed) (*PollResult, error) {
+	data, _, err := s.importer.FetchExternalURL(f.URL, maxFeedBytes)
+	if err != nil {
+		return nil, fmt.Errorf("获取订阅源失败: %w", err)
+	}
+	_, entries, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	seen, err := s.seenGUIDs(f.ID)
+	if err != nil {
+		return nil, err
+	}
+	var fresh []Entry
+	for _, e := range entries {
+		if !seen[e.GUID] {
+			seen[e.GUID] = true // guards against duplicate GUIDs inside one document
+			fresh = append(fresh, e)
+		}
+	}
+	// Feeds list newest first; keep the newest entries and import them oldest first.
+	if len(fresh) > maxEntriesPerPoll {
+		fresh = fresh[:maxEntriesPerPoll]
+	}
+
+	result := &PollResult{NewEntries: len(fresh)}
+	for i := len(fresh) - 1; i >= 0; i-- {
+		e := fresh[i]
+		docID, importErr := s.importEntry(f, e)
+		if importErr != nil {
+			result.Failed++
+			log.Printf("[Feed] import failed feed=%s guid=%q: %v", f.ID, e.GUID, importErr)
+			errlog.Logf("[Feed] import failed feed=%s guid=%q link=%q: %v", f.ID, e.GUID, e.Link, importErr)
+		} else {
+			result.Imported++
+		}
+		// Record the GUID even on failure (e.g. duplicate content) so it is not retried every poll.
+		itemID, idErr := idgen.New()
+		if idErr != nil {
+			return result, idErr
+		}
+		if _, err := s.writeDB.Exec(
+			"INSERT OR IGNORE INTO feed_items (id, feed_id, guid, title, link, document_id, error, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			itemID, f.ID, e.GUID, e.Title, e.Link, docID, errString(importErr), time.Now().UTC(),
+		); err != nil {
+			return result, fmt.Errorf("failed to record feed item: %w", err)
+		}
+	}
+	if result.NewEntries > 0 {
+		log.Printf("[Feed] %s: %d 条新条目，导入 %d 条，失败 %d 条", f.URL, result.NewEntries, result.Imported, result.Failed)
+	}
+	return result, nil
+}
+
+// importEntry stores one entry as a document. Entries with substantial inline
+// content are imported from the feed itself; otherwise the linked page is fetched.
+func (s *Service) importEntry(f *Feed, e Entry) (string, error) {
+	content := strings.TrimSpace(e.Content)
+	useInline := len([]rune(content)) >= minInlineContentRunes || (e.Link == "" && content != "")
+
+	var doc *document.DocumentInfo
+	var err error
+	if useInline {
+		name := e.Title
+		if name == "" {
+			name = e.Link
+		}
+		body := "<html><head><title>" + html.EscapeString(name) + "</title></head><body><h1>" +
+			html.EscapeString(name) + "</h1>" + content + "</body></html>"
+		doc, err = s.importer.ImportWebContent(document.ImportWebContentRequest{
+			Name:        name,
+			Type:        DocumentType,
+			BaseURL:     firstNonEmpty(e.Link, f.URL),
+			Content:     []byte(body),
+			ContentType: "text/html",
+			ProductID:   f.ProductID,
+		})
+	} else if e.Link != "" {
+		doc, err = s.importer.UploadURL(document.UploadURLRequest{URL: e.Link, ProductID: f.ProductID})
+	} else {
+		return "", fmt.Errorf("条目没有内容也没有链接")
+	}
+	if err != nil {
+		return "", err
+	}
+	if doc.Status == "failed" {
+		return doc.ID, fmt.Errorf("%s", doc.Error)
+	}
+	return doc.ID, nil
+}
+
+func (s *Service) seenGUIDs(feedID string) (map[string]bool, error) {
+	rows, err := s.readDB.Query("SELECT guid FROM feed_items WHERE feed_id = ?", feedID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load feed items: %w", err)
+	}
+	defer rows.Close()
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var guid string
+		if err := rows.Scan(&guid); err != nil {
+			return nil, fmt.Errorf("failed to scan feed item: %w", err)
+		}
+		seen[guid] = true
+	}
+	return seen, rows.Err()
+}
+
+// Start launches the background scheduler that polls enabled feeds when they are due.
+func (s *Service) Start() {
+	s.stopCh = make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[Feed] panic in scheduler goroutine: %v", r)
+			}
+		}()
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				s.pollDue()
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler and waits for an in-progress poll cycle to finish.
+func (s *Service) Stop() {
+	if s.stopCh == nil {
+		return
+	}
+	select {
+	case <-s.stopCh:
+	default:
+		close(s.stopCh)
+	}
+	s.wg.Wait()
+}
+
+// pollDue polls every enabled feed whose interval has elapsed since its last fetch.
+func (s *Service) pollDue() {
+	feeds, err := s.List("")
+	if err != nil {
+		log.Printf("[Feed] failed to list feeds: %v", err)
+		return
+	}
+	now := time.Now()
+	for i := range feeds {
+		f := &feeds[i]
+		if !f.Enabled {
+			continue
+		}
+		if f.LastFetchedAt != nil && now.Sub(*f.LastFetchedAt) < time.Duration(f.IntervalMin)*time.Minute {
+			continue
+		}
+		select {
+		case <-s.stopCh:
+			return
+		default:
+		}
+		s.poll(f)
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
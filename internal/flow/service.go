@@ -0,0 +1,427 @@
+// Package flow manages guided troubleshooting flows: admin-authored decision
+// trees per product. Each node either asks a question with a fixed set of
+// options or ends the flow with an answer or a hand-off to a human. The chat
+// client walks a flow by sending the options chosen so far; the server keeps
+// no per-user state.
+package flow
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"askflow/internal/idgen"
+	"askflow/internal/llm"
+)
+
+// Node types.
+const (
+	NodeQuestion = "question" // asks Text and offers Options
+	NodeAnswer   = "answer"   // ends the flow with Text as the answer
+	NodeEscalate = "escalate" // ends the flow by handing the case to a human
+)
+
+const (
+	// maxNodes caps the size of a flow.
+	maxNodes = 200
+	// maxOptions caps the options of a question node.
+	maxOptions = 10
+	// maxPathLength caps the number of choices a walk may replay, since flows may loop.
+	maxPathLength = 100
+	maxTitleRunes = 100
+	maxDescRunes  = 500
+	maxLabelRunes = 100
+	maxTextRunes  = 4000
+	maxNodeIDLen  = 64
+)
+
+// Option is a choice offered by a question node.
+type Option struct {
+	Label string `json:"label"`
+	Next  string `json:"next"` // ID of the node the option leads to
+}
+
+// Node is one step of a flow.
+type Node struct {
+	ID      string   `json:"id"`
+	Type    string   `json:"type"`
+	Text    string   `json:"text"`
+	Options []Option `json:"options,omitempty"`
+}
+
+// Flow is a troubleshooting decision tree. An empty ProductID makes the flow
+// available for all products. Description is what routing matches questions
+// against, so it should name the symptoms the flow covers.
+type Flow struct {
+	ID          string    `json:"id"`
+	ProductID   string    `json:"product_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Enabled     bool      `json:"enabled"`
+	Start       string    `json:"start"`
+	Nodes       []Node    `json:"nodes"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Input holds the editable fields of a flow.
+type Input struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Start       string `json:"start"` // defaults to the first node
+	Nodes       []Node `json:"nodes"`
+}
+
+// Summary is the part of a flow shown to chat users before they start it.
+type Summary struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// Step is one answered question of a walk.
+type Step struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// Position is where a walk through a flow currently stands.
+type Position struct {
+	FlowID     string `json:"flow_id"`
+	Title      string `json:"title"`
+	Node       Node   `json:"node"`
+	Path       []int  `json:"path"`
+	Transcript []Step `json:"transcript"`
+	Done       bool   `json:"done"` // Node is an answer or escalation
+	// Summary describes the walk for a human agent; set on escalation nodes
+	// so the client can file it as a pending question.
+	Summary string `json:"summary,omitempty"`
+}
+
+// Service manages troubleshooting flows.
+type Service struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+}
+
+// NewService creates a new flow Service.
+func NewService(readDB, writeDB *sql.DB) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB}
+}
+
+// normalize validates a flow definition: node IDs are unique, every option
+// leads to an existing node, terminal nodes have no options and every node
+// can be reached from the start node.
+func normalize(in Input) (Input, error) {
+	in.Title = strings.TrimSpace(in.Title)
+	in.Description = strings.TrimSpace(in.Description)
+	if in.Title == "" {
+		return in, fmt.Errorf("流程标题不能为空")
+	}
+	if len([]rune(in.Title)) > maxTitleRunes {
+		return in, fmt.Errorf("流程标题长度不能超过 %d 个字符", maxTitleRunes)
+	}
+	if len([]rune(in.Description)) > maxDescRunes {
+		return in, fmt.Errorf("流程描述长度不能超过 %d 个字符", maxDescRunes)
+	}
+	if len(in.Nodes) == 0 {
+		return in, fmt.Errorf("流程至少需要一个节点")
+	}
+	if len(in.Nodes) > maxNodes {
+		return in, fmt.Errorf("流程节点不能超过 %d 个", maxNodes)
+	}
+
+	byID := make(map[string]*Node, len(in.Nodes))
+	for i := range in.Nodes {
+		n := &in.Nodes[i]
+		n.ID = strings.TrimSpace(n.ID)
+		n.Text = strings.TrimSpace(n.Text)
+		if n.ID == "" {
+			return in, fmt.Errorf("第 %d 个节点缺少 ID", i+1)
+		}
+		if len(n.ID) > maxNodeIDLen {
+			return in, fmt.Errorf("节点 ID 长度不能超过 %d 个字符", maxNodeIDLen)
+		}
+		if byID[n.ID] != nil {
+			return in, fmt.Errorf("节点 ID 重复: %s", n.ID)
+		}
+		byID[n.ID] = n
+		if n.Text == "" {
+			return in, fmt.Errorf("节点 %s 的内容不能为空", n.ID)
+		}
+		if len([]rune(n.Text)) > maxTextRunes {
+			return in, fmt.Errorf("节点 %s 的内容长度不能超过 %d 个字符", n.ID, maxTextRunes)
+		}
+		switch n.Type {
+		case NodeQuestion:
+			if len(n.Options) == 0 {
+				return in, fmt.Errorf("问题节点 %s 至少需要一个选项", n.ID)
+			}
+			if len(n.Options) > maxOptions {
+				return in, fmt.Errorf("问题节点 %s 的选项不能超过 %d 个", n.ID, maxOptions)
+			}
+		case NodeAnswer, NodeEscalate:
+			if len(n.Options) > 0 {
+				return in, fmt.Errorf("结束节点 %s 不能有选项", n.ID)
+			}
+			n.Options = nil
+		default:
+			return in, fmt.Errorf("节点 %s 的类型无效: %q", n.ID, n.Type)
+		}
+	}
+	for i := range in.Nodes {
+		n := &in.Nodes[i]
+		for j := range n.Options {
+			o := &n.Options[j]
+			o.Label = strings.TrimSpace(o.Label)
+			o.Next = strings.TrimSpace(o.Next)
+			if o.Label == "" {
+				return in, fmt.Errorf("节点 %s 的第 %d 个选项缺少文字", n.ID, j+1)
+			}
+			if len([]rune(o.Label)) > maxLabelRunes {
+				return in, fmt.Errorf("选项文字长度不能超过 %d 个字符", maxLabelRunes)
+			}
+			if byID[o.Next] == nil {
+				return in, fmt.Errorf("节点 %s 的选项“%s”指向不存在的节点 %q", n.ID, o.Label, o.Next)
+			}
+		}
+	}
+
+	in.Start = strings.TrimSpace(in.Start)
+	if in.Start == "" {
+		in.Start = in.Nodes[0].ID
+	}
+	if byID[in.Start] == nil {
+		return in, fmt.Errorf("起始节点不存在: %s", in.Start)
+	}
+	reached := map[string]bool{in.Start: true}
+	queue := []string{in.Start}
+	for len(queue) > 0 {
+		n := byID[queue[0]]
+		queue = queue[1:]
+		for _, o := range n.Options {
+			if !reached[o.Next] {
+				reached[o.Next] = true
+				queue = append(queue, o.Next)
+			}
+		}
+	}
+	for _, n := range in.Nodes {
+		if !reached[n.ID] {
+			return in, fmt.Errorf("节点 %s 无法从起始节点到达", n.ID)
+		}
+	}
+	return in, nil
+}
+
+// Create adds a flow for a product ("" for all products).
+func (s *Service) Create(productID string, in Input) (*Flow, error) {
+	in, err := normalize(in)
+	if err != nil {
+		return nil, err
+	}
+	id, err := idgen.New()
+	if err != nil {
+		return nil, err
+	}
+	nodes, _ := json.Marshal(in.Nodes)
+	if _, err := s.writeDB.Exec(
+		"INSERT INTO troubleshooting_flows (id, product_id, title, description, enabled, start_node, nodes) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		id, productID, in.Title, in.Description, in.Enabled, in.Start, string(nodes),
+	); err != nil {
+		return nil, fmt.Errorf("failed to insert flow: %w", err)
+	}
+	return s.Get(id)
+}
+
+// Update replaces a flow's definition.
+func (s *Service) Update(id string, in Input) (*Flow, error) {
+	in, err := normalize(in)
+	if err != nil {
+		return nil, err
+	}
+	nodes, _ := json.Marshal(in.Nodes)
+	result, err := s.writeDB.Exec(
+		"UPDATE troubleshooting_flows SET title = ?, description = ?, enabled = ?, start_node = ?, nodes = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		in.Title, in.Description, in.Enabled, in.Start, string(nodes), id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update flow: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("流程不存在")
+	}
+	return s.Get(id)
+}
+
+// Delete removes a flow.
+func (s *Service) Delete(id string) error {
+	result, err := s.writeDB.Exec("DELETE FROM troubleshooting_flows WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete flow: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("流程不存在")
+	}
+	return nil
+}
+
+const flowColumns = `id, COALESCE(product_id, ''), title, COALESCE(description, ''), enabled, start_node, nodes, created_at, updated_at`
+
+func scanFlow(scan func(dest ...interface{}) error) (*Flow, error) {
+	var f Flow
+	var nodes string
+	if err := scan(&f.ID, &f.ProductID, &f.Title, &f.Description, &f.Enabled, &f.Start, &nodes, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(nodes), &f.Nodes); err != nil || f.Nodes == nil {
+		f.Nodes = []Node{}
+	}
+	return &f, nil
+}
+
+// Get returns a single flow.
+func (s *Service) Get(id string) (*Flow, error) {
+	f, err := scanFlow(s.writeDB.QueryRow("SELECT "+flowColumns+" FROM troubleshooting_flows WHERE id = ?", id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("流程不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flow: %w", err)
+	}
+	return f, nil
+}
+
+// List returns the flows available for a product: its own flows plus the
+// global ones. An empty productID lists only the global flows. With
+// enabledOnly, disabled flows are left out.
+func (s *Service) List(productID string, enabledOnly bool) ([]Flow, error) {
+	q := "SELECT " + flowColumns + " FROM troubleshooting_flows WHERE (product_id = ? OR product_id = '')"
+	if enabledOnly {
+		q += " AND enabled = 1"
+	}
+	rows, err := s.readDB.Query(q+" ORDER BY title", productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list flows: %w", err)
+	}
+	defer rows.Close()
+	var flows []Flow
+	for rows.Next() {
+		f, err := scanFlow(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan flow: %w", err)
+		}
+		flows = append(flows, *f)
+	}
+	return flows, rows.Err()
+}
+
+// Summaries returns the enabled flows of a product as shown to chat users.
+func (s *Service) Summaries(productID string) ([]Summary, error) {
+	flows, err := s.List(productID, true)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]Summary, 0, len(flows))
+	for _, f := range flows {
+		summaries = append(summaries, Summary{ID: f.ID, Title: f.Title, Description: f.Description})
+	}
+	return summaries, nil
+}
+
+// Walk replays the options chosen so far (indexes into each question node's
+// options, from the start node) and returns the node reached. Disabled flows
+// cannot be walked.
+func (s *Service) Walk(id string, path []int) (*Position, error) {
+	f, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !f.Enabled {
+		return nil, fmt.Errorf("流程不存在")
+	}
+	return f.Walk(path)
+}
+
+// Walk follows path through the flow. See Service.Walk.
+func (f *Flow) Walk(path []int) (*Position, error) {
+	if len(path) > maxPathLength {
+		return nil, fmt.Errorf("步骤过多")
+	}
+	byID := make(map[string]Node, len(f.Nodes))
+	for _, n := range f.Nodes {
+		byID[n.ID] = n
+	}
+	node, ok := byID[f.Start]
+	if !ok {
+		return nil, fmt.Errorf("流程定义无效")
+	}
+	pos := &Position{FlowID: f.ID, Title: f.Title, Path: []int{}, Transcript: []Step{}}
+	for _, choice := range path {
+		if node.Type != NodeQuestion || choice < 0 || choice >= len(node.Options) {
+			return nil, fmt.Errorf("无效的选项")
+		}
+		opt := node.Options[choice]
+		pos.Path = append(pos.Path, choice)
+		pos.Transcript = append(pos.Transcript, Step{Question: node.Text, Answer: opt.Label})
+		if node, ok = byID[opt.Next]; !ok {
+			return nil, fmt.Errorf("流程定义无效")
+		}
+	}
+	pos.Node = node
+	pos.Done = node.Type != NodeQuestion
+	if node.Type == NodeEscalate {
+		pos.Summary = pos.summary()
+	}
+	return pos, nil
+}
+
+// summary renders the walk as text for a human agent.
+func (p *Position) summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[引导排查] %s\n", p.Title)
+	for _, st := range p.Transcript {
+		fmt.Fprintf(&b, "- %s → %s\n", st.Question, st.Answer)
+	}
+	b.WriteString(p.Node.Text)
+	return b.String()
+}
+
+// routeReplyRe extracts the flow number from the routing reply.
+var routeReplyRe = regexp.MustCompile(`\d+`)
+
+// Route asks the LLM which of the given flows, if any, fits a free-text
+// question. It returns nil when none does.
+func Route(ls llm.LLMService, question string, flows []Summary) (*Summary, error) {
+	if ls == nil || len(flows) == 0 || strings.TrimSpace(question) == "" {
+		return nil, nil
+	}
+	var list strings.Builder
+	for i, f := range flows {
+		fmt.Fprintf(&list, "%d. %s", i+1, f.Title)
+		if f.Description != "" {
+			fmt.Fprintf(&list, "：%s", f.Description)
+		}
+		list.WriteString("\n")
+	}
+	systemPrompt := "你是一个客服分流助手。以下是可用的引导式排查流程：\n" + list.String() +
+		"\n判断用户的问题是否属于其中某个流程所处理的故障。只回复最匹配的流程编号；如果都不匹配或问题不是故障排查类问题，回复0。不要输出其他内容。"
+	reply, err := ls.Generate(systemPrompt, nil, question)
+	if err != nil {
+		return nil, fmt.Errorf("flow routing failed: %w", err)
+	}
+	m := routeReplyRe.FindString(reply)
+	if m == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(m)
+	if err != nil || n < 1 || n > len(flows) {
+		return nil, nil
+	}
+	return &flows[n-1], nil
+}
@@ -0,0 +1,727 @@
+// Package gitsource implements Git repository sources: the Markdown docs of
+// a repository (a docs/ folder, or a whole GitHub/GitLab wiki repository)
+// registered for a product and kept in sync with the knowledge base. A
+// background scheduler pulls each repository periodically with the git
+// command, imports new files, re-imports changed ones and deletes the
+// documents of files that were removed from the repository.
+package gitsource
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"askflow/internal/datadir"
+	"askflow/internal/document"
+	"askflow/internal/errlog"
+	"askflow/internal/idgen"
+)
+
+const (
+	// DefaultIntervalMin is the sync interval used when none is given.
+	DefaultIntervalMin = 24 * 60
+	// MinIntervalMin and MaxIntervalMin bound the per-source sync interval.
+	MinIntervalMin = 15
+	MaxIntervalMin = 7 * 24 * 60
+
+	// maxFilesPerSource caps the Markdown files a source keeps in sync;
+	// further files are ignored.
+	maxFilesPerSource = 2000
+	// maxFileBytes skips Markdown files larger than this.
+	maxFileBytes = 5 << 20
+	// gitTimeout bounds a clone or pull.
+	gitTimeout = 5 * time.Minute
+	// schedulerTick is how often the scheduler looks for sources that are due.
+	schedulerTick = time.Minute
+)
+
+// markdownExts are the file extensions imported from a repository.
+var markdownExts = map[string]bool{".md": true, ".markdown": true, ".mdx": true}
+
+// Source is a registered Git repository.
+type Source struct {
+	ID           string     `json:"id"`
+	ProductID    string     `json:"product_id"`
+	RepoURL      string     `json:"repo_url"`
+	Branch       string     `json:"branch"` // empty follows the remote's default branch
+	Path         string     `json:"path"`   // folder within the repository, empty for all of it
+	HasToken     bool       `json:"has_token"`
+	IntervalMin  int        `json:"interval_min"`
+	Enabled      bool       `json:"enabled"`
+	LastCommit   string     `json:"last_commit,omitempty"`
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	FileCount    int        `json:"file_count"` // files with an imported document
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// File is a Markdown file of a source and the document it is imported as.
+type File struct {
+	Path       string     `json:"path"` // relative to the repository root
+	DocumentID string     `json:"document_id,omitempty"`
+	Error      string     `json:"error,omitempty"` // last import error
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// CreateRequest registers a repository.
+type CreateRequest struct {
+	ProductID   string `json:"product_id"`
+	RepoURL     string `json:"repo_url"`
+	Branch      string `json:"branch"`
+	Path        string `json:"path"`
+	AccessToken string `json:"access_token"` // for private repositories; stored encrypted
+	IntervalMin int    `json:"interval_min"`
+}
+
+// SyncResult summarises one sync of a source.
+type SyncResult struct {
+	Commit    string `json:"commit"`
+	Files     int    `json:"files"`     // Markdown files found
+	Added     int    `json:"added"`     // new files imported
+	Updated   int    `json:"updated"`   // changed files re-imported
+	Unchanged int    `json:"unchanged"` // files whose content did not change
+	Removed   int    `json:"removed"`   // files removed from the repository, documents deleted
+	Failed    int    `json:"failed"`
+	Skipped   int    `json:"skipped"` // files over the size or count limit
+}
+
+// Importer is the subset of DocumentManager used to import and delete files.
+type Importer interface {
+	ValidateExternalURL(url string) error
+	UploadFile(req document.UploadFileRequest) (*document.DocumentInfo, error)
+	DeleteDocument(docID string) error
+}
+
+// Secrets encrypts access tokens at rest; *config.ConfigManager implements it.
+type Secrets interface {
+	Seal(plaintext string) (string, error)
+	Open(sealed string) (string, error)
+}
+
+// Service manages Git sources and the sync scheduler.
+type Service struct {
+	readDB   *sql.DB
+	writeDB  *sql.DB
+	importer Importer
+	secrets  Secrets
+
+	syncMu sync.Mutex // serialises syncs so a file is never imported twice concurrently
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewService creates a new Git source Service.
+func NewService(readDB, writeDB *sql.DB, importer Importer, secrets Secrets) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB, importer: importer, secrets: secrets}
+}
+
+func validInterval(intervalMin int) error {
+	if intervalMin < MinIntervalMin || intervalMin > MaxIntervalMin {
+		return fmt.Errorf("同步间隔必须在 %d 到 %d 分钟之间", MinIntervalMin, MaxIntervalMin)
+	}
+	return nil
+}
+
+// validBranch accepts branch names made of letters, digits and ._/- that do
+// not start with '-', so they cannot be taken for git options.
+func validBranch(branch string) bool {
+	if branch == "" {
+		return true
+	}
+	if len(branch) > 200 || strings.HasPrefix(branch, "-") || strings.Contains(branch, "..") {
+		return false
+	}
+	for _, c := range branch {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '/' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// cleanPath normalises the folder of a source to a slash-separated path
+// relative to the repository root; "" and "." mean the whole repository.
+func cleanPath(p string) (string, error) {
+	p = strings.Trim(strings.TrimSpace(strings.ReplaceAll(p, "\\", "/")), "/")
+	if p == "" {
+		return "", nil
+	}
+	p = path.Clean(p)
+	if p == "." {
+		return "", nil
+	}
+	if p == ".." || strings.HasPrefix(p, "../") || len(p) > 500 {
+		return "", fmt.Errorf("目录路径无效")
+	}
+	return p, nil
+}
+
+// Create registers a repository for a product after checking that it is
+// reachable. Files are imported by the next scheduler run or a sync.
+func (s *Service) Create(req CreateRequest) (*Source, error) {
+	repoURL := strings.TrimSpace(req.RepoURL)
+	if repoURL == "" {
+		return nil, fmt.Errorf("仓库地址不能为空")
+	}
+	if !strings.HasPrefix(strings.ToLower(repoURL), "https://") {
+		return nil, fmt.Errorf("仅支持 HTTPS 仓库地址")
+	}
+	if err := s.importer.ValidateExternalURL(repoURL); err != nil {
+		return nil, err
+	}
+	branch := strings.TrimSpace(req.Branch)
+	if !validBranch(branch) {
+		return nil, fmt.Errorf("分支名称无效")
+	}
+	dir, err := cleanPath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	intervalMin := req.IntervalMin
+	if intervalMin == 0 {
+		intervalMin = DefaultIntervalMin
+	}
+	if err := validInterval(intervalMin); err != nil {
+		return nil, err
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("服务器未安装 git")
+	}
+
+	var count int
+	if err := s.writeDB.QueryRow("SELECT COUNT(*) FROM git_sources WHERE product_id = ? AND repo_url = ? AND branch = ? AND path = ?",
+		req.ProductID, repoURL, branch, dir).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to check source uniqueness: %w", err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("该产品已添加此仓库目录")
+	}
+
+	token := strings.TrimSpace(req.AccessToken)
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	if err := checkRemote(ctx, repoURL, branch, token); err != nil {
+		return nil, fmt.Errorf("无法访问仓库: %w", err)
+	}
+	sealed, err := s.secrets.Seal(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt access token: %w", err)
+	}
+
+	id, err := idgen.New()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	_, err = s.writeDB.Exec(
+		"INSERT INTO git_sources (id, product_id, repo_url, branch, path, access_token, interval_min, enabled, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?)",
+		id, req.ProductID, repoURL, branch, dir, sealed, intervalMin, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create source: %w", err)
+	}
+	return &Source{ID: id, ProductID: req.ProductID, RepoURL: repoURL, Branch: branch, Path: dir, HasToken: token != "",
+		IntervalMin: intervalMin, Enabled: true, CreatedAt: now}, nil
+}
+
+// Update changes the sync interval and enabled flag of a source.
+func (s *Service) Update(id string, intervalMin int, enabled bool) (*Source, error) {
+	if err := validInterval(intervalMin); err != nil {
+		return nil, err
+	}
+	result, err := s.writeDB.Exec("UPDATE git_sources SET interval_min = ?, enabled = ? WHERE id = ?", intervalMin, enabled, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update source: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("仓库来源不存在")
+	}
+	return s.Get(id)
+}
+
+// Delete removes a source, its file list and its checkout. Documents
+// already imported are kept.
+func (s *Service) Delete(id string) error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	tx, err := s.writeDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM git_source_files WHERE source_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete source files: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM git_sources WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete source: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("仓库来源不存在")
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(checkoutDir(id)); err != nil {
+		log.Printf("[GitSource] failed to remove checkout of %s: %v", id, err)
+	}
+	return nil
+}
+
+// checkoutDir is where a source's repository is cloned.
+func checkoutDir(id string) string {
+	return datadir.Path("git-sources", id)
+}
+
+const sourceColumns = `s.id, s.product_id, s.repo_url, s.branch, s.path, s.access_token != '', s.interval_min, s.enabled,
+	s.last_commit, s.last_synced_at, COALESCE(s.last_error, ''), s.created_at,
+	(SELECT COUNT(*) FROM git_source_files f WHERE f.source_id = s.id AND f.document_id != '')`
+
+func scanSource(scan func(dest ...interface{}) error) (*Source, error) {
+	var src Source
+	var hasToken, enabled int
+	var lastSynced sql.NullTime
+	if err := scan(&src.ID, &src.ProductID, &src.RepoURL, &src.Branch, &src.Path, &hasToken, &src.IntervalMin, &enabled,
+		&src.LastCommit, &lastSynced, &src.LastError, &src.CreatedAt, &src.FileCount); err != nil {
+		return nil, err
+	}
+	src.HasToken = hasToken == 1
+	src.Enabled = enabled == 1
+	if lastSynced.Valid {
+		t := lastSynced.Time
+		src.LastSyncedAt = &t
+	}
+	return &src, nil
+}
+
+// Get returns a single source.
+func (s *Service) Get(id string) (*Source, error) {
+	src, err := scanSource(s.readDB.QueryRow("SELECT "+sourceColumns+" FROM git_sources s WHERE s.id = ?", id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("仓库来源不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source: %w", err)
+	}
+	return src, nil
+}
+
+// List returns sources, optionally filtered by product, newest first.
+func (s *Service) List(productID string) ([]Source, error) {
+	query := "SELECT " + sourceColumns + " FROM git_sources s"
+	var args []interface{}
+	if productID != "" {
+		query += " WHERE s.product_id = ?"
+		args = append(args, productID)
+	}
+	query += " ORDER BY s.created_at DESC"
+	rows, err := s.readDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sources: %w", err)
+	}
+	defer rows.Close()
+	sources := []Source{}
+	for rows.Next() {
+		src, err := scanSource(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan source: %w", err)
+		}
+		sources = append(sources, *src)
+	}
+	return sources, rows.Err()
+}
+
+// fileRow is a stored file with the content hash a sync compares against.
+type fileRow struct {
+	File
+	ContentHash string
+}
+
+// loadFiles returns the stored files of a source by path.
+func (s *Service) loadFiles(sourceID string) (map[string]*fileRow, error) {
+	rows, err := s.writeDB.Query(
+		"SELECT path, document_id, content_hash, error, updated_at FROM git_source_files WHERE source_id = ?", sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load source files: %w", err)
+	}
+	defer rows.Close()
+	files := make(map[string]*fileRow)
+	for rows.Next() {
+		var f fileRow
+		var updated sql.NullTime
+		if err := rows.Scan(&f.Path, &f.DocumentID, &f.ContentHash, &f.Error, &updated); err != nil {
+			return nil, fmt.Errorf("failed to scan source file: %w", err)
+		}
+		if updated.Valid {
+			t := updated.Time
+			f.UpdatedAt = &t
+		}
+		files[f.Path] = &f
+	}
+	return files, rows.Err()
+}
+
+// Files returns the files of a source, sorted by path.
+func (s *Service) Files(id string) ([]File, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+	stored, err := s.loadFiles(id)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]File, 0, len(stored))
+	for _, f := range stored {
+		files = append(files, f.File)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// Sync pulls a source immediately and syncs its files.
+func (s *Service) Sync(id string) (*SyncResult, error) {
+	src, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.syncSource(src)
+}
+
+func (s *Service) syncSource(src *Source) (*SyncResult, error) {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	result, err := s.sync(src)
+	errMsg, commit := "", src.LastCommit
+	if err != nil {
+		errMsg = err.Error()
+		errlog.Logf("[GitSource] sync failed source=%s repo=%q: %v", src.ID, src.RepoURL, err)
+	} else {
+		commit = result.Commit
+	}
+	if _, dbErr := s.writeDB.Exec("UPDATE git_sources SET last_commit = ?, last_synced_at = ?, last_error = ? WHERE id = ?",
+		commit, time.Now().UTC(), errMsg, src.ID); dbErr != nil {
+		log.Printf("[GitSource] failed to update source status %s: %v", src.ID, dbErr)
+	}
+	return result, err
+}
+
+// repoFile is a Markdown file found in a checkout.
+type repoFile struct {
+	Path    string // relative to the repository root, slash-separated
+	AbsPath string
+}
+
+// listFiles walks the source's folder of a checkout for Markdown files,
+// skipping the .git directory and symlinks. It returns at most
+// maxFilesPerSource files, sorted by path, and how many were left out.
+func listFiles(root, dir string) ([]repoFile, int, error) {
+	base := filepath.Join(root, filepath.FromSlash(dir))
+	info, err := os.Stat(base)
+	if err != nil || !info.IsDir() {
+		return nil, 0, fmt.Errorf("仓库中不存在目录 %s", dir)
+	}
+	var files []repoFile
+	skipped := 0
+	err = filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !markdownExts[strings.ToLower(filepath.Ext(p))] {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if len(files) == maxFilesPerSource {
+			skipped++
+			return nil
+		}
+		files = append(files, repoFile{Path: filepath.ToSlash(rel), AbsPath: p})
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list repository files: %w", err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, skipped, nil
+}
+
+// sync pulls the repository, imports new and changed Markdown files and
+// deletes the documents of removed files. A folder without any Markdown
+// file is treated as an error rather than deleting every document.
+func (s *Service) sync(src *Source) (*SyncResult, error) {
+	var token string
+	if sealed := s.sealedToken(src.ID); sealed != "" {
+		t, err := s.secrets.Open(sealed)
+		if err != nil {
+			return nil, fmt.Errorf("无法解密访问令牌: %w", err)
+		}
+		token = t
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	dir := checkoutDir(src.ID)
+	commit, err := checkout(ctx, dir, src.RepoURL, src.Branch, token)
+	if err != nil {
+		return nil, err
+	}
+
+	files, skipped, err := listFiles(dir, src.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("仓库目录中没有 Markdown 文档")
+	}
+	stored, err := s.loadFiles(src.ID)
+	if err != nil {
+		return nil, err
+	}
+	result := &SyncResult{Commit: commit, Files: len(files), Skipped: skipped}
+
+	present := make(map[string]bool, len(files))
+	for _, f := range files {
+		present[f.Path] = true
+		select {
+		case <-s.stopCh:
+			return result, nil
+		default:
+		}
+		outcome, err := s.syncFile(src, f, stored[f.Path])
+		switch {
+		case errors.Is(err, errTooLarge):
+			result.Skipped++
+		case err != nil:
+			result.Failed++
+			errlog.Logf("[GitSource] file failed source=%s path=%q: %v", src.ID, f.Path, err)
+		case outcome == outcomeAdded:
+			result.Added++
+		case outcome == outcomeUpdated:
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+	}
+
+	for p, old := range stored {
+		if present[p] {
+			continue
+		}
+		if old.DocumentID != "" {
+			if err := s.importer.DeleteDocument(old.DocumentID); err != nil {
+				errlog.Logf("[GitSource] failed to delete document doc=%s path=%q: %v", old.DocumentID, p, err)
+				continue
+			}
+		}
+		if _, err := s.writeDB.Exec("DELETE FROM git_source_files WHERE source_id = ? AND path = ?", src.ID, p); err != nil {
+			return result, fmt.Errorf("failed to delete source file: %w", err)
+		}
+		result.Removed++
+	}
+
+	if result.Added+result.Updated+result.Removed+result.Failed > 0 {
+		log.Printf("[GitSource] %s@%s: 新增 %d，更新 %d，删除 %d，失败 %d", src.RepoURL, shortCommit(commit), result.Added, result.Updated, result.Removed, result.Failed)
+	}
+	return result, nil
+}
+
+// sealedToken returns the encrypted access token of a source, if any.
+func (s *Service) sealedToken(id string) string {
+	var sealed string
+	s.readDB.QueryRow("SELECT COALESCE(access_token, '') FROM git_sources WHERE id = ?", id).Scan(&sealed)
+	return sealed
+}
+
+const (
+	outcomeUnchanged = iota
+	outcomeAdded
+	outcomeUpdated
+)
+
+var errTooLarge = errors.New("文件过大")
+
+// syncFile imports a file when it is new or its content changed. A changed
+// file is imported as a new document before the old one is deleted, so it
+// stays searchable if the import fails.
+func (s *Service) syncFile(src *Source, f repoFile, old *fileRow) (int, error) {
+	now := time.Now().UTC()
+	docID, oldHash, updatedAt := "", "", interface{}(nil)
+	if old != nil {
+		docID, oldHash = old.DocumentID, old.ContentHash
+		if old.UpdatedAt != nil {
+			updatedAt = *old.UpdatedAt
+		}
+	}
+	save := func(docID, hash string, updatedAt interface{}, fileErr error) error {
+		id, err := idgen.New()
+		if err != nil {
+			return err
+		}
+		_, err = s.writeDB.Exec(
+			`INSERT INTO git_source_files (id, source_id, path, document_id, content_hash, error, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT(source_id, path) DO UPDATE SET document_id = excluded.document_id, content_hash = excluded.content_hash,
+			 error = excluded.error, updated_at = excluded.updated_at`,
+			id, src.ID, f.Path, docID, hash, errString(fileErr), updatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record source file: %w", err)
+		}
+		return fileErr
+	}
+
+	info, err := os.Stat(f.AbsPath)
+	if err != nil {
+		return 0, save(docID, oldHash, updatedAt, err)
+	}
+	if info.Size() > maxFileBytes {
+		return 0, save(docID, oldHash, updatedAt, errTooLarge)
+	}
+	data, err := os.ReadFile(f.AbsPath)
+	if err != nil {
+		return 0, save(docID, oldHash, updatedAt, err)
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if docID != "" && hash == oldHash {
+		return outcomeUnchanged, save(docID, hash, updatedAt, nil)
+	}
+
+	doc, err := s.importer.UploadFile(document.UploadFileRequest{
+		FileName:  repoName(src.RepoURL) + "/" + f.Path,
+		FileData:  data,
+		FileType:  "markdown",
+		ProductID: src.ProductID,
+	})
+	if err == nil && doc.Status != "success" {
+		// Failed records would pile up with every sync
+		err = fmt.Errorf("%s", doc.Error)
+		if delErr := s.importer.DeleteDocument(doc.ID); delErr != nil {
+			log.Printf("[GitSource] failed to delete failed document %s: %v", doc.ID, delErr)
+		}
+	}
+	if err != nil {
+		return 0, save(docID, oldHash, updatedAt, err)
+	}
+
+	outcome := outcomeAdded
+	if docID != "" {
+		outcome = outcomeUpdated
+		if err := s.importer.DeleteDocument(docID); err != nil {
+			errlog.Logf("[GitSource] failed to delete old document doc=%s path=%q: %v", docID, f.Path, err)
+		}
+	}
+	return outcome, save(doc.ID, hash, now, nil)
+}
+
+// repoName returns "owner/repo" for a repository URL, used to prefix the
+// names of imported documents.
+func repoName(repoURL string) string {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return repoURL
+	}
+	name := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if name == "" {
+		return u.Host
+	}
+	return name
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
+
+// Start launches the background scheduler that syncs enabled sources when they are due.
+func (s *Service) Start() {
+	s.stopCh = make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[GitSource] panic in scheduler goroutine: %v", r)
+			}
+		}()
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				s.syncDue()
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler and waits for an in-progress sync to finish.
+func (s *Service) Stop() {
+	if s.stopCh == nil {
+		return
+	}
+	select {
+	case <-s.stopCh:
+	default:
+		close(s.stopCh)
+	}
+	s.wg.Wait()
+}
+
+// syncDue syncs every enabled source whose interval has elapsed since its last sync.
+func (s *Service) syncDue() {
+	sources, err := s.List("")
+	if err != nil {
+		log.Printf("[GitSource] failed to list sources: %v", err)
+		return
+	}
+	now := time.Now()
+	for i := range sources {
+		src := &sources[i]
+		if !src.Enabled {
+			continue
+		}
+		if src.LastSyncedAt != nil && now.Sub(*src.LastSyncedAt) < time.Duration(src.IntervalMin)*time.Minute {
+			continue
+		}
+		select {
+		case <-s.stopCh:
+			return
+		default:
+		}
+		s.syncSource(src)
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
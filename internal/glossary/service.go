@@ -0,0 +1,510 @@
+// Package glossary manages per-product terminology: each term records the
+// preferred name of a concept and the deprecated names it replaces. The
+// terminology checker scans a product's chunks for deprecated names and can
+// rewrite and re-embed the affected documents. Terms marked do-not-translate
+// and the preferred names are also given to the LLM as prompt rules, so
+// answers and translations keep brand terms intact.
+package glossary
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"askflow/internal/errlog"
+	"askflow/internal/idgen"
+)
+
+const (
+	// maxTermRunes bounds the length of a term or deprecated name.
+	maxTermRunes = 100
+	// maxDeprecatedPerTerm caps the number of deprecated names per term.
+	maxDeprecatedPerTerm = 20
+	// maxSamplesPerIssue is how many example snippets are reported per document and name.
+	maxSamplesPerIssue = 3
+	// sampleContextRunes is the amount of surrounding text kept around a match in samples.
+	sampleContextRunes = 30
+	// maxPromptTerms caps the terms listed in prompt rules to bound prompt size.
+	maxPromptTerms = 100
+)
+
+// Term is a glossary entry. An empty ProductID makes the term apply to all products.
+type Term struct {
+	ID             string    `json:"id"`
+	ProductID      string    `json:"product_id"`
+	Term           string    `json:"term"`
+	Deprecated     []string  `json:"deprecated"`
+	Note           string    `json:"note"`
+	DoNotTranslate bool      `json:"do_not_translate"` // keep the term verbatim in every language
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TermIssue reports the use of one deprecated name within a document.
+type TermIssue struct {
+	Deprecated string   `json:"deprecated"`
+	Suggested  string   `json:"suggested"`
+	Count      int      `json:"count"`
+	Samples    []string `json:"samples"`
+}
+
+// DocumentIssues groups the terminology issues found in one document.
+type DocumentIssues struct {
+	DocumentID   string      `json:"document_id"`
+	DocumentName string      `json:"document_name"`
+	Chunks       int         `json:"chunks"` // chunks containing at least one deprecated name
+	Issues       []TermIssue `json:"issues"`
+}
+
+// Report is the result of a terminology consistency check.
+type Report struct {
+	ProductID     string           `json:"product_id"`
+	TermsChecked  int              `json:"terms_checked"`
+	ChunksScanned int              `json:"chunks_scanned"`
+	Documents     []DocumentIssues `json:"documents"`
+	CheckedAt     time.Time        `json:"checked_at"`
+}
+
+// RewriteResult summarises an automated rewrite run.
+type RewriteResult struct {
+	Documents int      `json:"documents"`
+	Chunks    int      `json:"chunks"`
+	Failed    []string `json:"failed,omitempty"` // IDs of documents that could not be rewritten
+}
+
+// Rewriter is the subset of DocumentManager used to find, rewrite and
+// re-embed chunks.
+type Rewriter interface {
+	RewriteChunks(docID string, rewrite func(string) string) (int, error)
+	PartitionDB(productID string) *sql.DB
+}
+
+// Service manages glossary terms and runs terminology checks.
+type Service struct {
+	readDB   *sql.DB
+	writeDB  *sql.DB
+	rewriter Rewriter
+}
+
+// NewService creates a new glossary Service.
+func NewService(readDB, writeDB *sql.DB, rewriter Rewriter) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB, rewriter: rewriter}
+}
+
+// chunkDB returns the database holding the chunks of productID: its storage
+// partition when the product has isolated storage, otherwise the main one.
+func (s *Service) chunkDB(productID string) *sql.DB {
+	if db := s.rewriter.PartitionDB(productID); db != nil {
+		return db
+	}
+	return s.readDB
+}
+
+// normalizeTerm validates a term and its deprecated names, dropping blanks,
+// duplicates and names equal to the term itself. A term needs deprecated
+// names unless it only exists to be kept untranslated.
+func normalizeTerm(term string, deprecated []string, doNotTranslate bool) (string, []string, error) {
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return "", nil, fmt.Errorf("术语不能为空")
+	}
+	if len([]rune(term)) > maxTermRunes {
+		return "", nil, fmt.Errorf("术语长度不能超过 %d 个字符", maxTermRunes)
+	}
+	seen := map[string]bool{strings.ToLower(term): true}
+	var names []string
+	for _, d := range deprecated {
+		d = strings.TrimSpace(d)
+		key := strings.ToLower(d)
+		if d == "" || seen[key] {
+			continue
+		}
+		if len([]rune(d)) > maxTermRunes {
+			return "", nil, fmt.Errorf("弃用名称长度不能超过 %d 个字符", maxTermRunes)
+		}
+		seen[key] = true
+		names = append(names, d)
+	}
+	if len(names) == 0 && !doNotTranslate {
+		return "", nil, fmt.Errorf("至少需要一个弃用名称")
+	}
+	if names == nil {
+		names = []string{}
+	}
+	if len(names) > maxDeprecatedPerTerm {
+		return "", nil, fmt.Errorf("弃用名称不能超过 %d 个", maxDeprecatedPerTerm)
+	}
+	return term, names, nil
+}
+
+// Create adds a glossary term for a product ("" for all products).
+func (s *Service) Create(productID, term string, deprecated []string, note string, doNotTranslate bool) (*Term, error) {
+	term, deprecated, err := normalizeTerm(term, deprecated, doNotTranslate)
+	if err != nil {
+		return nil, err
+	}
+	var count int
+	if err := s.writeDB.QueryRow("SELECT COUNT(*) FROM glossary_terms WHERE product_id = ? AND term = ?", productID, term).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to check term uniqueness: %w", err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("该术语已存在")
+	}
+	id, err := idgen.New()
+	if err != nil {
+		return nil, err
+	}
+	data, _ := json.Marshal(deprecated)
+	if _, err := s.writeDB.Exec(
+		"INSERT INTO glossary_terms (id, product_id, term, deprecated, note, do_not_translate) VALUES (?, ?, ?, ?, ?, ?)",
+		id, productID, term, string(data), strings.TrimSpace(note), doNotTranslate,
+	); err != nil {
+		return nil, fmt.Errorf("failed to insert term: %w", err)
+	}
+	return s.Get(id)
+}
+
+// Update replaces a term's preferred name, deprecated names, note and translation flag.
+func (s *Service) Update(id, term string, deprecated []string, note string, doNotTranslate bool) (*Term, error) {
+	term, deprecated, err := normalizeTerm(term, deprecated, doNotTranslate)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := json.Marshal(deprecated)
+	result, err := s.writeDB.Exec(
+		"UPDATE glossary_terms SET term = ?, deprecated = ?, note = ?, do_not_translate = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		term, string(data), strings.TrimSpace(note), doNotTranslate, id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update term: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("术语不存在")
+	}
+	return s.Get(id)
+}
+
+// Delete removes a glossary term.
+func (s *Service) Delete(id string) error {
+	result, err := s.writeDB.Exec("DELETE FROM glossary_terms WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete term: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("术语不存在")
+	}
+	return nil
+}
+
+const termColumns = `id, COALESCE(product_id, ''), term, deprecated, COALESCE(note, ''), COALESCE(do_not_translate, 0), created_at, updated_at`
+
+func scanTerm(scan func(dest ...interface{}) error) (*Term, error) {
+	var t Term
+	var deprecated string
+	if err := scan(&t.ID, &t.ProductID, &t.Term, &deprecated, &t.Note, &t.DoNotTranslate, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(deprecated), &t.Deprecated); err != nil || t.Deprecated == nil {
+		t.Deprecated = []string{}
+	}
+	return &t, nil
+}
+
+// Get returns a single glossary term.
+func (s *Service) Get(id string) (*Term, error) {
+	t, err := scanTerm(s.writeDB.QueryRow("SELECT "+termColumns+" FROM glossary_terms WHERE id = ?", id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("术语不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get term: %w", err)
+	}
+	return t, nil
+}
+
+// List returns the terms that apply to a product: its own terms plus the
+// global ones. An empty productID lists only the global terms.
+func (s *Service) List(productID string) ([]Term, error) {
+	rows, err := s.readDB.Query(
+		"SELECT "+termColumns+" FROM glossary_terms WHERE product_id = ? OR product_id = '' ORDER BY term",
+		productID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list terms: %w", err)
+	}
+	defer rows.Close()
+	var terms []Term
+	for rows.Next() {
+		t, err := scanTerm(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan term: %w", err)
+		}
+		terms = append(terms, *t)
+	}
+	return terms, rows.Err()
+}
+
+// PromptRules returns the terminology rules for a product as text to append
+// to an LLM system prompt: terms to keep untranslated and preferred names to
+// use instead of deprecated ones. It returns "" when the product has no terms
+// or they cannot be loaded; prompts then run without rules.
+func (s *Service) PromptRules(productID string) string {
+	terms, err := s.List(productID)
+	if err != nil {
+		errlog.Logf("[Glossary] failed to load prompt rules for product %q: %v", productID, err)
+		return ""
+	}
+	return promptRules(terms)
+}
+
+func promptRules(terms []Term) string {
+	var keep, prefer []string
+	for _, t := range terms {
+		if len(keep)+len(prefer) >= maxPromptTerms {
+			break
+		}
+		if t.DoNotTranslate {
+			keep = append(keep, "“"+t.Term+"”")
+		}
+		if len(t.Deprecated) > 0 {
+			prefer = append(prefer, fmt.Sprintf("用“%s”代替“%s”", t.Term, strings.Join(t.Deprecated, "”、“")))
+		}
+	}
+	if len(keep) == 0 && len(prefer) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\n术语规则：")
+	if len(keep) > 0 {
+		b.WriteString("\n- 以下是品牌或产品术语，无论使用何种语言都必须保持原文，不得翻译、音译或改写：")
+		b.WriteString(strings.Join(keep, "、"))
+	}
+	if len(prefer) > 0 {
+		b.WriteString("\n- 使用首选术语：")
+		b.WriteString(strings.Join(prefer, "；"))
+	}
+	return b.String()
+}
+
+// replacement maps one deprecated name to its preferred term.
+type replacement struct {
+	deprecated string
+	term       string
+	re         *regexp.Regexp
+	// termRe matches the preferred term when it contains the deprecated name,
+	// so occurrences of the term itself are not reported or rewritten again.
+	termRe *regexp.Regexp
+}
+
+// find returns the [start, end) offsets of the deprecated name in text.
+func (r replacement) find(text string) [][]int {
+	locs := r.re.FindAllStringIndex(text, -1)
+	if r.termRe == nil || len(locs) == 0 {
+		return locs
+	}
+	terms := r.termRe.FindAllStringIndex(text, -1)
+	kept := locs[:0]
+	for _, loc := range locs {
+		inside := false
+		for _, t := range terms {
+			if loc[0] >= t[0] && loc[1] <= t[1] {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			kept = append(kept, loc)
+		}
+	}
+	return kept
+}
+
+// buildReplacements compiles a case-insensitive matcher for every deprecated
+// name. Names starting or ending with a word character only match on word
+// boundaries so "Pro" does not match inside "Project"; CJK names match as
+// substrings. Longer names are tried first so they win over their prefixes.
+func buildReplacements(terms []Term) []replacement {
+	var reps []replacement
+	for _, t := range terms {
+		for _, d := range t.Deprecated {
+			pattern := regexp.QuoteMeta(d)
+			if isASCIIWordByte(d[0]) {
+				pattern = `\b` + pattern
+			}
+			if isASCIIWordByte(d[len(d)-1]) {
+				pattern += `\b`
+			}
+			r := replacement{deprecated: d, term: t.Term, re: regexp.MustCompile("(?i)" + pattern)}
+			if strings.Contains(strings.ToLower(t.Term), strings.ToLower(d)) {
+				r.termRe = regexp.MustCompile("(?i)" + regexp.QuoteMeta(t.Term))
+			}
+			reps = append(reps, r)
+		}
+	}
+	sort.SliceStable(reps, func(i, j int) bool { return len(reps[i].deprecated) > len(reps[j].deprecated) })
+	return reps
+}
+
+func isASCIIWordByte(b byte) bool {
+	return b == '_' || (b >= '0' && b <= '9') || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// rewriteText replaces every deprecated name in text with its preferred term.
+func rewriteText(reps []replacement, text string) string {
+	for _, r := range reps {
+		locs := r.find(text)
+		if len(locs) == 0 {
+			continue
+		}
+		var sb strings.Builder
+		prev := 0
+		for _, loc := range locs {
+			sb.WriteString(text[prev:loc[0]])
+			sb.WriteString(r.term)
+			prev = loc[1]
+		}
+		sb.WriteString(text[prev:])
+		text = sb.String()
+	}
+	return text
+}
+
+// Check scans the chunks of a product for deprecated names and reports, per
+// document, which names are used and what to replace them with.
+func (s *Service) Check(productID string) (*Report, error) {
+	terms, err := s.List(productID)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{ProductID: productID, TermsChecked: len(terms), Documents: []DocumentIssues{}, CheckedAt: time.Now().UTC()}
+	reps := buildReplacements(terms)
+	if len(reps) == 0 {
+		return report, nil
+	}
+
+	rows, err := s.chunkDB(productID).Query(
+		`SELECT document_id, document_name, chunk_text FROM chunks
+		 WHERE COALESCE(product_id, '') = ? AND COALESCE(image_url, '') = ''
+		 ORDER BY document_id, chunk_index`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunks: %w", err)
+	}
+	defer rows.Close()
+
+	byDoc := make(map[string]*DocumentIssues)
+	var order []string
+	for rows.Next() {
+		var docID, docName, text string
+		if err := rows.Scan(&docID, &docName, &text); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		report.ChunksScanned++
+		hit := false
+		for _, r := range reps {
+			locs := r.find(text)
+			if len(locs) == 0 {
+				continue
+			}
+			hit = true
+			doc := byDoc[docID]
+			if doc == nil {
+				doc = &DocumentIssues{DocumentID: docID, DocumentName: docName}
+				byDoc[docID] = doc
+				order = append(order, docID)
+			}
+			issue := findIssue(doc, r)
+			issue.Count += len(locs)
+			for _, loc := range locs {
+				if len(issue.Samples) >= maxSamplesPerIssue {
+					break
+				}
+				issue.Samples = append(issue.Samples, snippet(text, loc[0], loc[1]))
+			}
+		}
+		if hit {
+			byDoc[docID].Chunks++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate chunks: %w", err)
+	}
+	for _, id := range order {
+		report.Documents = append(report.Documents, *byDoc[id])
+	}
+	return report, nil
+}
+
+// findIssue returns the issue entry for a deprecated name, creating it when needed.
+func findIssue(doc *DocumentIssues, r replacement) *TermIssue {
+	for i := range doc.Issues {
+		if doc.Issues[i].Deprecated == r.deprecated {
+			return &doc.Issues[i]
+		}
+	}
+	doc.Issues = append(doc.Issues, TermIssue{Deprecated: r.deprecated, Suggested: r.term, Samples: []string{}})
+	return &doc.Issues[len(doc.Issues)-1]
+}
+
+// snippet returns the match at text[start:end] with some surrounding context.
+func snippet(text string, start, end int) string {
+	before := []rune(text[:start])
+	after := []rune(text[end:])
+	if len(before) > sampleContextRunes {
+		before = append([]rune("…"), before[len(before)-sampleContextRunes:]...)
+	}
+	if len(after) > sampleContextRunes {
+		after = append(after[:sampleContextRunes], []rune("…")...)
+	}
+	return strings.Join(strings.Fields(string(before)+text[start:end]+string(after)), " ")
+}
+
+// Rewrite replaces deprecated names with their preferred terms in the given
+// documents of a product (all documents with issues when documentIDs is empty)
+// and re-embeds the changed chunks.
+func (s *Service) Rewrite(productID string, documentIDs []string) (*RewriteResult, error) {
+	if s.rewriter == nil {
+		return nil, fmt.Errorf("文档服务不可用")
+	}
+	terms, err := s.List(productID)
+	if err != nil {
+		return nil, err
+	}
+	reps := buildReplacements(terms)
+	if len(reps) == 0 {
+		return &RewriteResult{}, nil
+	}
+	if len(documentIDs) == 0 {
+		report, err := s.Check(productID)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range report.Documents {
+			documentIDs = append(documentIDs, d.DocumentID)
+		}
+	}
+
+	result := &RewriteResult{}
+	for _, docID := range documentIDs {
+		var owner string
+		err := s.chunkDB(productID).QueryRow("SELECT COALESCE(product_id, '') FROM chunks WHERE document_id = ? LIMIT 1", docID).Scan(&owner)
+		if err != nil || owner != productID {
+			result.Failed = append(result.Failed, docID)
+			continue
+		}
+		n, err := s.rewriter.RewriteChunks(docID, func(text string) string { return rewriteText(reps, text) })
+		if err != nil {
+			errlog.Logf("[Glossary] rewrite failed doc=%s: %v", docID, err)
+			result.Failed = append(result.Failed, docID)
+			continue
+		}
+		if n > 0 {
+			result.Documents++
+			result.Chunks += n
+		}
+	}
+	return result, nil
+}
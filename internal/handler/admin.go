@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"askflow/internal/auth"
+	"askflow/internal/config"
+	"askflow/internal/errlog"
 )
 
 // --- Admin sub-account handlers ---
@@ -133,6 +135,105 @@ func HandleAdminRole(app *App) http.HandlerFunc {
 	}
 }
 
+// HandleAdminPassword changes the signed-in admin's own password.
+func HandleAdminPassword(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		userID, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		var req struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := app.ChangeAdminPassword(userID, req.CurrentPassword, req.NewPassword); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// --- Notification preference handlers ---
+
+// HandleAdminNotifyPrefs reads (GET) or replaces (PUT) the notification
+// preferences of the signed-in admin: the events they subscribe to and the
+// email address and chat webhook they are sent to. The webhook URL and
+// secret are returned masked; "***" keeps the saved value.
+// GET/PUT /api/admin/notification-prefs
+func HandleAdminNotifyPrefs(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			p, err := app.GetAdminNotifyPrefs(userID)
+			if err != nil {
+				WriteError(w, http.StatusForbidden, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{
+				"prefs":    p,
+				"events":   config.NotifyEvents,
+				"channels": config.NotifyChannels,
+			})
+		case http.MethodPut:
+			var req config.AdminNotifyPrefs
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if err := app.SetAdminNotifyPrefs(userID, req); err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleAdminNotifyPrefsTest sends a test message to the email address and
+// webhook in the request, before or after saving them.
+// POST /api/admin/notification-prefs/test
+func HandleAdminNotifyPrefsTest(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		userID, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		var req config.AdminNotifyPrefs
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := app.TestAdminNotifyPrefs(userID, req); err != nil {
+			errlog.Logf("[Notify] test of personal notifications of %s failed: %v", userID, err)
+			WriteError(w, http.StatusBadRequest, "发送测试消息失败: "+err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok", "message": "测试消息已发送"})
+	}
+}
+
 // --- Login ban management handlers ---
 
 // HandleAdminBans returns the list of current login bans.
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"askflow/internal/announcement"
+)
+
+// HandleAnnouncements returns the announcements shown at the top of the chat.
+// GET /api/announcements?product_id=
+func HandleAnnouncements(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		productID := r.URL.Query().Get("product_id")
+		if !IsValidOptionalID(productID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		list, err := app.ActiveAnnouncements(productID)
+		if err != nil {
+			log.Printf("[Announcement] active list error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取公告失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"announcements": list})
+	}
+}
+
+// HandleAdminAnnouncements handles GET (list) and POST (create) for announcements.
+// GET /api/admin/announcements?product_id=
+// POST /api/admin/announcements {"product_id": "...", "title": "...", "content": "...", "version": "2.1", "effective_from": "2024-06-01", "effective_until": ""}
+func HandleAdminAnnouncements(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			productID := r.URL.Query().Get("product_id")
+			if !IsValidOptionalID(productID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			list, err := app.ListAnnouncements(productID)
+			if err != nil {
+				log.Printf("[Announcement] list error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取公告失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"announcements": list})
+
+		case http.MethodPost:
+			in, ok := readAnnouncementInput(app, w, r)
+			if !ok {
+				return
+			}
+			a, err := app.CreateAnnouncement(in, userID)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, a)
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleAdminAnnouncementByID handles PUT (update) and DELETE for a single announcement.
+func HandleAdminAnnouncementByID(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, "/api/admin/announcements/")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid announcement ID")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			in, ok := readAnnouncementInput(app, w, r)
+			if !ok {
+				return
+			}
+			a, err := app.UpdateAnnouncement(id, in)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, a)
+
+		case http.MethodDelete:
+			if err := app.DeleteAnnouncement(id); err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"message": "公告已删除"})
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// readAnnouncementInput decodes an announcement from the request body and
+// checks its product exists, writing the error response when it fails.
+func readAnnouncementInput(app *App, w http.ResponseWriter, r *http.Request) (announcement.Input, bool) {
+	var in announcement.Input
+	if err := ReadJSONBody(r, &in); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid request body")
+		return in, false
+	}
+	if !IsValidOptionalID(in.ProductID) {
+		WriteError(w, http.StatusBadRequest, "invalid product_id")
+		return in, false
+	}
+	if in.ProductID != "" {
+		if _, err := app.GetProduct(in.ProductID); err != nil {
+			WriteError(w, http.StatusBadRequest, "产品不存在")
+			return in, false
+		}
+	}
+	return in, true
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"askflow/internal/answertemplate"
+	"askflow/internal/budget"
+	"askflow/internal/pending"
+)
+
+// HandleAdminTemplates handles GET (list) and POST (create) for answer templates.
+// GET /api/admin/templates?product_id=
+// POST /api/admin/templates {"product_id": "...", "name": "...", "content": "请从 {download_url} 下载 {product_name}", "variables": {"download_url": "https://..."}}
+func HandleAdminTemplates(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			productID := r.URL.Query().Get("product_id")
+			if !IsValidOptionalID(productID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			list, err := app.ListAnswerTemplates(productID)
+			if err != nil {
+				log.Printf("[Template] list error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取回答模板失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"templates": list})
+
+		case http.MethodPost:
+			in, ok := readTemplateInput(app, w, r)
+			if !ok {
+				return
+			}
+			t, err := app.CreateAnswerTemplate(in, userID)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, t)
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleAdminTemplateByID handles PUT (update) and DELETE for a single answer
+// template, and fills one in for a pending question.
+// POST /api/admin/templates/{id}/render {"question_id": "...", "values": {"download_url": "..."}, "adapt": true}
+func HandleAdminTemplateByID(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, "/api/admin/templates/")
+		render := strings.HasSuffix(id, "/render")
+		id = strings.TrimSuffix(id, "/render")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid template ID")
+			return
+		}
+
+		if render {
+			if r.Method != http.MethodPost {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			var req TemplateRenderRequest
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if req.QuestionID != "" && !IsValidHexID(req.QuestionID) {
+				WriteError(w, http.StatusBadRequest, "invalid question ID")
+				return
+			}
+			out, err := app.RenderAnswerTemplate(id, req)
+			if err != nil {
+				status := http.StatusBadRequest
+				switch {
+				case errors.Is(err, pending.ErrNotFound):
+					status = http.StatusNotFound
+				case errors.Is(err, budget.ErrLimitReached):
+					status = http.StatusTooManyRequests
+				}
+				WriteError(w, status, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, out)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			in, ok := readTemplateInput(app, w, r)
+			if !ok {
+				return
+			}
+			t, err := app.UpdateAnswerTemplate(id, in)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, t)
+
+		case http.MethodDelete:
+			if err := app.DeleteAnswerTemplate(id); err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"message": "模板已删除"})
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// readTemplateInput decodes an answer template from the request body and
+// checks its product exists, writing the error response when it fails.
+func readTemplateInput(app *App, w http.ResponseWriter, r *http.Request) (answertemplate.Input, bool) {
+	var in answertemplate.Input
+	if err := ReadJSONBody(r, &in); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid request body")
+		return in, false
+	}
+	if !IsValidOptionalID(in.ProductID) {
+		WriteError(w, http.StatusBadRequest, "invalid product_id")
+		return in, false
+	}
+	if in.ProductID != "" {
+		if _, err := app.GetProduct(in.ProductID); err != nil {
+			WriteError(w, http.StatusBadRequest, "产品不存在")
+			return in, false
+		}
+	}
+	return in, true
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"askflow/internal/apikey"
+)
+
+// HandleAdminAPIKeys lists and creates API keys. Only the super admin manages
+// keys; the secret of a new key is returned once, in the creation response.
+func HandleAdminAPIKeys(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, role, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		if role != "super_admin" {
+			WriteError(w, http.StatusForbidden, "仅超级管理员可管理 API 密钥")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			keys, err := app.ListAPIKeys()
+			if err != nil {
+				log.Printf("[APIKey] list error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取 API 密钥列表失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"keys": keys, "scopes": apikey.AllScopes})
+
+		case http.MethodPost:
+			var req struct {
+				Name          string   `json:"name"`
+				Scopes        []string `json:"scopes"`
+				ExpiresInDays int      `json:"expires_in_days"`
+			}
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			secret, key, err := app.CreateAPIKey(req.Name, req.Scopes, req.ExpiresInDays, userID)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			log.Printf("[APIKey] created key %s (%s) scopes=%s by %s", key.ID, key.Name, strings.Join(key.Scopes, ","), userID)
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"key": secret, "api_key": key})
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleAdminAPIKeyByID revokes an API key.
+func HandleAdminAPIKeyByID(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, role, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		if role != "super_admin" {
+			WriteError(w, http.StatusForbidden, "仅超级管理员可管理 API 密钥")
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/admin/apikeys/")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid API key ID")
+			return
+		}
+		if r.Method != http.MethodDelete {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if err := app.DeleteAPIKey(id); err != nil {
+			if errors.Is(err, apikey.ErrNotFound) {
+				WriteError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			log.Printf("[APIKey] delete error for %s: %v", id, err)
+			WriteError(w, http.StatusInternalServerError, "删除 API 密钥失败")
+			return
+		}
+		log.Printf("[APIKey] revoked key %s by %s", id, userID)
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
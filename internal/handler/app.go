@@ -3,8 +3,12 @@
 package handler
 
 import (
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -13,22 +17,49 @@ import (
 	"log"
 	mrand "math/rand"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"askflow/internal/analytics"
+	"askflow/internal/announcement"
+	"askflow/internal/answertemplate"
+	"askflow/internal/apikey"
 	"askflow/internal/auth"
+	"askflow/internal/backup"
+	"askflow/internal/budget"
+	"askflow/internal/chathistory"
+	"askflow/internal/chatstate"
+	"askflow/internal/chunker"
 	"askflow/internal/config"
+	"askflow/internal/correction"
+	"askflow/internal/datadir"
 	"askflow/internal/document"
 	"askflow/internal/email"
 	"askflow/internal/embedding"
 	"askflow/internal/errlog"
+	"askflow/internal/export"
+	"askflow/internal/feed"
+	"askflow/internal/livesource"
+	"askflow/internal/flow"
+	"askflow/internal/gitsource"
+	"askflow/internal/glossary"
+	"askflow/internal/jobs"
 	"askflow/internal/llm"
+	"askflow/internal/mailin"
+	"askflow/internal/maintenance"
+	"askflow/internal/notify"
 	"askflow/internal/pending"
 	"askflow/internal/product"
 	"askflow/internal/query"
+	"askflow/internal/replay"
+	"askflow/internal/share"
+	"askflow/internal/status"
+	"askflow/internal/textutil"
 	"askflow/internal/vectorstore"
 )
 
@@ -45,10 +76,39 @@ type App struct {
 	pendingManager *pending.PendingQuestionManager
 	oauthClient    *auth.OAuthClient
 	sessionManager *auth.SessionManager
+	opTokens       *auth.OperationTokens
 	configManager  *config.ConfigManager
 	emailService   *email.Service
 	productService *product.ProductService
 	loginLimiter   *auth.LoginLimiter
+	analytics      *analytics.Service
+	feedService    *feed.Service
+	liveSources    *livesource.Service
+	gitSources     *gitsource.Service
+	glossary       *glossary.Service
+	announcements  *announcement.Service
+	templates      *answertemplate.Service
+	replays        *replay.Service
+	corrections    *correction.Service
+	flows          *flow.Service
+	shares         *share.Service
+	chatStates     *chatstate.Service
+	chatHistory    *chathistory.Service
+	status         *status.Monitor
+	maintenance    *maintenance.Service
+	exporter       *export.Service
+	backups        *backup.Service
+	jobs           *jobs.Queue
+	apiKeys        *apikey.Service
+	notifier       *notify.Service
+
+	// Set by SetAuthProvider: used instead of the external_auth HTTP verifier
+	authProvider auth.AuthProvider
+
+	// Set by PinModelServices: used instead of API clients built from config
+	pinnedEmbedding embedding.EmbeddingService
+	pinnedLLM       llm.LLMService
+	budget          *budget.Meter
 }
 
 // NewApp creates a new App with all service dependencies injected.
@@ -63,8 +123,14 @@ func NewApp(
 	cm *config.ConfigManager,
 	es *email.Service,
 	ps *product.ProductService,
+	fs *feed.Service,
+	lss *livesource.Service,
+	gss *gitsource.Service,
+	ms *maintenance.Service,
+	ex *export.Service,
+	jq *jobs.Queue,
 ) *App {
-	return &App{
+	app := &App{
 		db:             writeDB,
 		readDB:         readDB,
 		queryEngine:    qe,
@@ -72,82 +138,1977 @@ func NewApp(
 		pendingManager: pm,
 		oauthClient:    oc,
 		sessionManager: sm,
+		opTokens:       auth.NewOperationTokens(readDB, writeDB),
 		configManager:  cm,
 		emailService:   es,
 		productService: ps,
 		loginLimiter:   auth.NewLoginLimiterRW(readDB, writeDB),
+		analytics:      analytics.NewService(readDB, writeDB),
+		feedService:    fs,
+		liveSources:    lss,
+		gitSources:     gss,
+		glossary:       glossary.NewService(readDB, writeDB, dm),
+		announcements:  announcement.NewService(readDB, writeDB, dm),
+		templates:      answertemplate.NewService(readDB, writeDB),
+		replays:        replay.NewService(readDB, writeDB),
+		corrections:    correction.NewService(readDB, writeDB),
+		flows:          flow.NewService(readDB, writeDB),
+		shares:         share.NewService(readDB, writeDB),
+		chatStates:     chatstate.NewService(readDB, writeDB),
+		chatHistory:    chathistory.NewService(readDB, writeDB),
+		status:         status.NewMonitor(),
+		maintenance:    ms,
+		exporter:       ex,
+		backups: backup.NewService(readDB, writeDB, func() config.S3Config {
+			if cfg := cm.Get(); cfg != nil {
+				return cfg.Backup.S3
+			}
+			return config.S3Config{}
+		}),
+		jobs:           jq,
+		apiKeys:        apikey.NewService(readDB, writeDB),
+		notifier: notify.NewService(func() config.NotificationsConfig {
+			if cfg := cm.Get(); cfg != nil {
+				return cfg.Notifications
+			}
+			return config.NotificationsConfig{}
+		}),
+	}
+	if es != nil {
+		app.notifier.SetMailer(es)
+	}
+	app.notifier.SetScope(app.notifyScope)
+	if dm != nil {
+		app.notifier.SetURLValidator(dm.ValidateExternalURL)
+		app.analytics.SetPartitionDB(dm.PartitionDB)
+	}
+	// Answers and translations follow each product's glossary
+	if qe != nil {
+		qe.SetTermRules(app.glossary.PromptRules)
+		qe.SetPendingHook(app.notifyPending)
+	}
+	if dm != nil {
+		dm.SetTermRules(app.glossary.PromptRules)
+		dm.SetCallQAHandler(app.addCallCandidates)
+		dm.RecoverVersions()
+	}
+	return app
+}
+// SessionManager returns the session manager for testing purposes.
+func (a *App) SessionManager() *auth.SessionManager {
+	return a.sessionManager
+}
+
+// IssueOperationToken mints a short-lived token that authorizes one method
+// and path for userID without a session header (see auth.OperationToken).
+func (a *App) IssueOperationToken(userID, method, path string) (*auth.OperationToken, error) {
+	return a.opTokens.Issue(userID, method, path)
+}
+
+// VerifyOperationToken returns the user an operation token was issued to if
+// it is valid for the method and path of r.
+func (a *App) VerifyOperationToken(token string, r *http.Request) (string, error) {
+	return a.opTokens.Verify(token, r.Method, r.URL.Path)
+}
+
+// Logout ends a session and revokes the operation tokens of its user, so
+// downloads and streams started from any of their sessions stop working.
+func (a *App) Logout(sessionID string) error {
+	session, err := a.sessionManager.ValidateSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := a.sessionManager.DeleteSession(sessionID); err != nil {
+		return err
+	}
+	return a.opTokens.RevokeUser(session.UserID)
+}
+
+// --- Query Interface ---
+
+// Query processes a user question through the RAG pipeline.
+func (a *App) Query(req query.QueryRequest) (*query.QueryResponse, error) {
+	return a.queryEngine.Query(req)
+}
+
+// debugTokenPurpose selects the signing key of query debug tokens.
+const debugTokenPurpose = "query-debug-token"
+
+// IssueDebugToken signs a token that lets its holder request query
+// diagnostics without an admin session, e.g. to reproduce a problem as an
+// end user. It expires after ttl or when the issuing admin is removed.
+func (a *App) IssueDebugToken(adminID string, ttl time.Duration) (string, time.Time, error) {
+	if role := a.GetAdminRole(adminID); role == "" || role == "anonymous_viewer" {
+		return "", time.Time{}, fmt.Errorf("只有管理员账号可以签发调试令牌")
+	}
+	expires := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(adminID + "|" + strconv.FormatInt(expires.Unix(), 10)))
+	return payload + "." + a.signDebugToken(payload), expires, nil
+}
+
+// ValidDebugToken reports whether token is an unexpired debug token issued
+// by an existing admin.
+func (a *App) ValidDebugToken(token string) bool {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(a.signDebugToken(payload))) {
+		return false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return false
+	}
+	adminID, exp, ok := strings.Cut(string(raw), "|")
+	expUnix, err := strconv.ParseInt(exp, 10, 64)
+	if !ok || err != nil || time.Now().Unix() > expUnix {
+		return false
+	}
+	role := a.GetAdminRole(adminID)
+	return role != "" && role != "anonymous_viewer"
+}
+
+func (a *App) signDebugToken(payload string) string {
+	mac := hmac.New(sha256.New, a.configManager.SigningKey(debugTokenPurpose))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// LogQuery records a processed query and its answer for usage reporting and returns its log ID.
+func (a *App) LogQuery(userID, productID, question string, resp *query.QueryResponse) (string, error) {
+	sources, err := json.Marshal(resp.Sources)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode sources: %w", err)
+	}
+	var faithfulness *float64
+	if resp.Faithfulness != nil {
+		faithfulness = &resp.Faithfulness.Score
+	}
+	id, err := a.analytics.LogQuery(userID, productID, question, resp.Answer, string(sources), resp.IsPending, faithfulness)
+	if err != nil {
+		return "", err
+	}
+	// Count citations of real answers towards document usage
+	if !resp.IsPending && len(resp.Sources) > 0 {
+		cites := make([]analytics.Citation, 0, len(resp.Sources))
+		for _, src := range resp.Sources {
+			cites = append(cites, analytics.Citation{DocumentID: src.DocumentID, ChunkIndex: src.ChunkIndex})
+		}
+		if err := a.analytics.RecordCitations(cites); err != nil {
+			log.Printf("[Analytics] failed to record citations for query %s: %v", id, err)
+		}
+	}
+	return id, nil
+}
+
+// RecordAnswerAudit stores the audit record of an answer under the HTTP
+// request ID, unless audits are disabled, and sets the response's RequestID
+// once recorded.
+func (a *App) RecordAnswerAudit(requestID, queryID, userID string, req query.QueryRequest, resp *query.QueryResponse) error {
+	cfg := a.configManager.Get()
+	if cfg == nil || cfg.Audit.Disabled || resp.Audit == nil || requestID == "" {
+		return nil
+	}
+	chunks, err := json.Marshal(resp.Audit.Chunks)
+	if err != nil {
+		return fmt.Errorf("failed to encode chunks: %w", err)
+	}
+	answer := resp.Answer
+	if answer == "" {
+		answer = resp.Message
+	}
+	err = a.analytics.RecordAudit(&analytics.AnswerAudit{
+		RequestID:   requestID,
+		QueryID:     queryID,
+		UserID:      userID,
+		ProductID:   req.ProductID,
+		Question:    req.Question,
+		Kind:        resp.Audit.Kind,
+		Prompt:      resp.Audit.Prompt,
+		Chunks:      chunks,
+		Model:       resp.Audit.Model,
+		Endpoint:    resp.Audit.Endpoint,
+		Temperature: resp.Audit.Temperature,
+		MaxTokens:   resp.Audit.MaxTokens,
+		Answer:      answer,
+		ModelOutput: resp.Audit.ModelOutput,
+	})
+	if err != nil {
+		return err
+	}
+	resp.RequestID = requestID
+	return nil
+}
+
+// GetAnswerAudit returns the audit record with a request ID or query ID.
+func (a *App) GetAnswerAudit(id string) (*analytics.AnswerAudit, error) {
+	return a.analytics.GetAudit(id)
+}
+
+// ListAnswerAudits lists audit records, newest first.
+func (a *App) ListAnswerAudits(f analytics.AuditFilter) ([]analytics.AnswerAudit, error) {
+	return a.analytics.ListAudits(f)
+}
+
+// RecordCitationClick counts a user opening a citation of one of their answers.
+func (a *App) RecordCitationClick(queryID, userID, documentID string, chunkIndex int) error {
+	return a.analytics.RecordCitationClick(queryID, userID, analytics.Citation{DocumentID: documentID, ChunkIndex: chunkIndex})
+}
+
+// RecordQueryOutcome records whether a query was processed successfully for
+// the public status page.
+func (a *App) RecordQueryOutcome(ok bool) {
+	a.status.Record(ok)
+}
+
+// PublicStatus returns the aggregate availability of the query pipeline,
+// derived from database, configuration and embedding checks and recent query
+// error rates.
+func (a *App) PublicStatus() *status.Status {
+	return a.status.Snapshot(status.Checks{
+		Database: func() bool {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			return a.readDB.PingContext(ctx) == nil
+		},
+		Configured: a.configManager.IsReady,
+		Embedding: func() bool {
+			return !a.queryEngine.EmbeddingHealth().Degraded
+		},
+	})
+}
+
+// EmbeddingHealth reports whether queries are answered in degraded mode
+// because the embedding service is down.
+func (a *App) EmbeddingHealth() query.EmbeddingHealth {
+	return a.queryEngine.EmbeddingHealth()
+}
+
+// ShareAnswer creates an expiring read-only link to the answer of a query the
+// user asked. The query's product must allow sharing.
+func (a *App) ShareAnswer(queryID, userID string, ttl time.Duration) (*share.Link, error) {
+	productID, err := a.shares.QueryProduct(queryID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !a.productAllowsShare(productID) {
+		return nil, fmt.Errorf("该产品未开启回答分享")
+	}
+	return a.shares.Create(queryID, userID, ttl)
+}
+
+// ViewSharedAnswer returns the answer behind a share link and counts the view.
+func (a *App) ViewSharedAnswer(token string) (*share.SharedAnswer, error) {
+	return a.shares.View(token, a.productAllowsShare)
+}
+
+// productAllowsShare reports whether answers of a product may be shared.
+// Queries without a product are not shareable.
+func (a *App) productAllowsShare(productID string) bool {
+	if productID == "" {
+		return false
+	}
+	p, err := a.productService.GetByID(productID)
+	return err == nil && p != nil && p.AllowShare
+}
+
+// GetChatState returns the saved conversation and draft of a login session, or nil.
+func (a *App) GetChatState(sessionID, userID string) (*chatstate.State, error) {
+	return a.chatStates.Get(sessionID, userID)
+}
+
+// SaveChatState stores the conversation and draft of a login session.
+func (a *App) SaveChatState(sessionID, userID string, st chatstate.State) (*chatstate.State, error) {
+	return a.chatStates.Save(sessionID, userID, st)
+}
+
+// DeleteChatState clears the saved chat state of a login session.
+func (a *App) DeleteChatState(sessionID, userID string) error {
+	return a.chatStates.Delete(sessionID, userID)
+}
+
+// RecordChatHistory adds an answered query to the asking user's chat history.
+func (a *App) RecordChatHistory(userID, productID, question string, resp *query.QueryResponse) error {
+	sources, err := json.Marshal(resp.Sources)
+	if err != nil {
+		return fmt.Errorf("failed to encode sources: %w", err)
+	}
+	answer := resp.Answer
+	if answer == "" {
+		answer = resp.Message
+	}
+	_, err = a.chatHistory.Record(userID, chathistory.Entry{
+		QueryID:   resp.QueryID,
+		ProductID: productID,
+		Question:  question,
+		Answer:    answer,
+		Sources:   sources,
+		IsPending: resp.IsPending,
+	})
+	return err
+}
+
+// ListChatHistory returns one page of a user's chat history, newest first,
+// and the total number of entries.
+func (a *App) ListChatHistory(userID, productID string, page, pageSize int) ([]chathistory.Entry, int, error) {
+	if page < 1 {
+		page = 1
+	}
+	return a.chatHistory.List(userID, productID, (page-1)*pageSize, pageSize)
+}
+
+// DeleteChatHistory removes an entry from a user's chat history.
+func (a *App) DeleteChatHistory(userID, id string) error {
+	return a.chatHistory.Delete(userID, id)
+}
+
+// RateQuery stores the asking user's thumbs up/down rating and optional
+// comment for a logged query.
+func (a *App) RateQuery(queryID, userID string, rating int, comment string) error {
+	return a.analytics.SetRating(queryID, userID, rating, comment)
+}
+
+// FeedbackReport aggregates answer ratings per product and document.
+func (a *App) FeedbackReport(f analytics.FeedbackFilter) (*analytics.FeedbackReport, error) {
+	return a.analytics.FeedbackReport(f)
+}
+
+// SubmitCorrection stores the asking user's suggested correction for a
+// sentence of a logged answer.
+func (a *App) SubmitCorrection(userID string, in correction.Input) (*correction.Suggestion, error) {
+	return a.corrections.Submit(userID, in)
+}
+
+// ListCorrections returns the correction suggestions of the moderation queue.
+func (a *App) ListCorrections(status, productID string) ([]correction.Suggestion, error) {
+	return a.corrections.List(status, productID)
+}
+
+// CorrectionDetail is a correction suggestion with the current text of the
+// chunk it cites, which moderators edit when accepting it.
+type CorrectionDetail struct {
+	correction.Suggestion
+	ChunkText     string `json:"chunk_text,omitempty"`
+	ChunkEditable bool   `json:"chunk_editable"`
+}
+
+// GetCorrection returns a correction suggestion with its cited chunk. The
+// chunk text is empty when the document or chunk has since been deleted.
+func (a *App) GetCorrection(id string) (*CorrectionDetail, error) {
+	sg, err := a.corrections.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	d := &CorrectionDetail{Suggestion: *sg}
+	if sg.DocumentID == "" {
+		return d, nil
+	}
+	chunks, err := a.docManager.ListChunks(sg.DocumentID)
+	if err != nil {
+		return d, nil
+	}
+	for _, c := range chunks {
+		if c.Index == sg.ChunkIndex {
+			d.ChunkText = c.Text
+			d.ChunkEditable = c.Editable
+			break
+		}
+	}
+	return d, nil
+}
+
+// CorrectionAcceptRequest says how an accepted suggestion updates the
+// knowledge base.
+type CorrectionAcceptRequest struct {
+	// ApplyAs is "chunk" to replace the text of the cited chunk with Text,
+	// "knowledge" to add a knowledge entry with Title and Text, or empty to
+	// accept the suggestion without changing the knowledge base.
+	ApplyAs string `json:"apply_as"`
+	Title   string `json:"title"`
+	Text    string `json:"text"`
+	Note    string `json:"note"`
+}
+
+// AcceptCorrection applies a pending suggestion to the knowledge base and
+// closes it. A knowledge entry added for it starts as a draft when review is
+// required.
+func (a *App) AcceptCorrection(id string, req CorrectionAcceptRequest, adminID string) (*correction.Suggestion, error) {
+	sg, err := a.corrections.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if sg.Status != correction.StatusPending {
+		return nil, fmt.Errorf("纠错建议已处理")
+	}
+	res := correction.Resolution{Status: correction.StatusAccepted, AppliedAs: req.ApplyAs, Note: req.Note, ResolvedBy: adminID}
+	switch req.ApplyAs {
+	case "":
+	case correction.AppliedChunk:
+		if sg.DocumentID == "" {
+			return nil, fmt.Errorf("该建议未关联引用来源，请改为新增知识条目")
+		}
+		if _, err := a.docManager.UpdateChunk(sg.DocumentID, sg.ChunkIndex, req.Text); err != nil {
+			return nil, err
+		}
+	case correction.AppliedKnowledge:
+		docID, err := a.addKnowledgeEntry(KnowledgeEntryRequest{Title: req.Title, Content: req.Text, ProductID: sg.ProductID}, adminID, a.initialReviewStatus())
+		if err != nil {
+			return nil, err
+		}
+		res.KnowledgeID = docID
+	default:
+		return nil, fmt.Errorf("invalid apply_as: %s", req.ApplyAs)
+	}
+	if err := a.corrections.Resolve(id, res); err != nil {
+		return nil, err
+	}
+	return a.corrections.Get(id)
+}
+
+// RejectCorrection closes a pending suggestion without changes.
+func (a *App) RejectCorrection(id, note, adminID string) (*correction.Suggestion, error) {
+	if err := a.corrections.Resolve(id, correction.Resolution{Status: correction.StatusRejected, Note: note, ResolvedBy: adminID}); err != nil {
+		return nil, err
+	}
+	return a.corrections.Get(id)
+}
+
+// UsageReport aggregates query usage per customer or organisation.
+func (a *App) UsageReport(f analytics.UsageFilter) ([]analytics.UsageRow, error) {
+	return a.analytics.UsageReport(f)
+}
+
+// DeflectionReport returns the support session funnel (resolved, escalated,
+// abandoned) overall and per product.
+func (a *App) DeflectionReport(f analytics.DeflectionFilter) (*analytics.DeflectionReport, error) {
+	return a.analytics.DeflectionReport(f)
+}
+
+// ProductHealth computes the knowledge base health score of a product.
+func (a *App) ProductHealth(productID string) (*analytics.ProductHealth, error) {
+	return a.analytics.ProductHealth(productID)
+}
+
+// --- Feed Subscription Interface ---
+
+// ListFeeds returns feed subscriptions, optionally filtered by product.
+func (a *App) ListFeeds(productID string) ([]feed.Feed, error) {
+	return a.feedService.List(productID)
+}
+
+// CreateFeed subscribes a product to an RSS/Atom feed.
+func (a *App) CreateFeed(productID, url string, intervalMin int) (*feed.Feed, error) {
+	return a.feedService.Create(productID, url, intervalMin)
+}
+
+// UpdateFeed changes a feed's polling interval and enabled flag.
+func (a *App) UpdateFeed(id string, intervalMin int, enabled bool) (*feed.Feed, error) {
+	return a.feedService.Update(id, intervalMin, enabled)
+}
+
+// DeleteFeed removes a feed subscription; imported documents are kept.
+func (a *App) DeleteFeed(id string) error {
+	return a.feedService.Delete(id)
+}
+
+// PollFeed fetches a feed immediately and imports new entries.
+func (a *App) PollFeed(id string) (*feed.PollResult, error) {
+	return a.feedService.Poll(id)
+}
+
+// ListLiveSources returns live sources, optionally filtered by product.
+func (a *App) ListLiveSources(productID string) ([]livesource.Source, error) {
+	return a.liveSources.List(productID)
+}
+
+// GetLiveSource returns a live source.
+func (a *App) GetLiveSource(id string) (*livesource.Source, error) {
+	return a.liveSources.Get(id)
+}
+
+// CreateLiveSource registers a sitemap or feed whose pages are kept in sync
+// with a product's documents.
+func (a *App) CreateLiveSource(productID, url string, intervalMin int) (*livesource.Source, error) {
+	if err := a.checkProductOpen(productID); err != nil {
+		return nil, err
+	}
+	return a.liveSources.Create(productID, url, intervalMin)
+}
+
+// UpdateLiveSource changes a live source's refresh interval and enabled flag.
+func (a *App) UpdateLiveSource(id string, intervalMin int, enabled bool) (*livesource.Source, error) {
+	return a.liveSources.Update(id, intervalMin, enabled)
+}
+
+// DeleteLiveSource removes a live source; imported documents are kept.
+func (a *App) DeleteLiveSource(id string) error {
+	return a.liveSources.Delete(id)
+}
+
+// LiveSourcePages returns the pages of a live source and their documents.
+func (a *App) LiveSourcePages(id string) ([]livesource.Page, error) {
+	return a.liveSources.Pages(id)
+}
+
+// RefreshLiveSource fetches a live source immediately and syncs its pages.
+func (a *App) RefreshLiveSource(id string) (*livesource.RefreshResult, error) {
+	return a.liveSources.Refresh(id)
+}
+
+// ListGitSources returns Git sources, optionally filtered by product.
+func (a *App) ListGitSources(productID string) ([]gitsource.Source, error) {
+	return a.gitSources.List(productID)
+}
+
+// GetGitSource returns a Git source.
+func (a *App) GetGitSource(id string) (*gitsource.Source, error) {
+	return a.gitSources.Get(id)
+}
+
+// CreateGitSource registers a Git repository whose Markdown docs are kept in
+// sync with a product's documents.
+func (a *App) CreateGitSource(req gitsource.CreateRequest) (*gitsource.Source, error) {
+	if err := a.checkProductOpen(req.ProductID); err != nil {
+		return nil, err
+	}
+	return a.gitSources.Create(req)
+}
+
+// UpdateGitSource changes a Git source's sync interval and enabled flag.
+func (a *App) UpdateGitSource(id string, intervalMin int, enabled bool) (*gitsource.Source, error) {
+	return a.gitSources.Update(id, intervalMin, enabled)
+}
+
+// DeleteGitSource removes a Git source; imported documents are kept.
+func (a *App) DeleteGitSource(id string) error {
+	return a.gitSources.Delete(id)
+}
+
+// GitSourceFiles returns the files of a Git source and their documents.
+func (a *App) GitSourceFiles(id string) ([]gitsource.File, error) {
+	return a.gitSources.Files(id)
+}
+
+// SyncGitSource pulls a Git source immediately and syncs its files.
+func (a *App) SyncGitSource(id string) (*gitsource.SyncResult, error) {
+	return a.gitSources.Sync(id)
+}
+
+// --- Announcement Interface ---
+
+// ListAnnouncements returns all announcements, or those shown for a product.
+func (a *App) ListAnnouncements(productID string) ([]announcement.Announcement, error) {
+	return a.announcements.List(productID)
+}
+
+// CreateAnnouncement publishes a product announcement.
+func (a *App) CreateAnnouncement(in announcement.Input, createdBy string) (*announcement.Announcement, error) {
+	if err := a.checkProductOpen(in.ProductID); err != nil {
+		return nil, err
+	}
+	return a.announcements.Create(in, createdBy)
+}
+
+// UpdateAnnouncement replaces an announcement's fields.
+func (a *App) UpdateAnnouncement(id string, in announcement.Input) (*announcement.Announcement, error) {
+	if err := a.checkProductOpen(in.ProductID); err != nil {
+		return nil, err
+	}
+	return a.announcements.Update(id, in)
+}
+
+// DeleteAnnouncement removes an announcement.
+func (a *App) DeleteAnnouncement(id string) error {
+	return a.announcements.Delete(id)
+}
+
+// ActiveAnnouncements returns the announcements the chat of a product shows
+// today; none for archived products.
+func (a *App) ActiveAnnouncements(productID string) ([]announcement.Announcement, error) {
+	if a.productHidden(productID) {
+		return []announcement.Announcement{}, nil
+	}
+	return a.announcements.Active(productID)
+}
+
+// --- Answer Template Interface ---
+
+// ListAnswerTemplates returns all answer templates, or those offered for a
+// product.
+func (a *App) ListAnswerTemplates(productID string) ([]answertemplate.Template, error) {
+	return a.templates.List(productID)
+}
+
+// CreateAnswerTemplate stores a new answer template.
+func (a *App) CreateAnswerTemplate(in answertemplate.Input, createdBy string) (*answertemplate.Template, error) {
+	return a.templates.Create(in, createdBy)
+}
+
+// UpdateAnswerTemplate replaces an answer template's fields.
+func (a *App) UpdateAnswerTemplate(id string, in answertemplate.Input) (*answertemplate.Template, error) {
+	return a.templates.Update(id, in)
+}
+
+// DeleteAnswerTemplate removes an answer template.
+func (a *App) DeleteAnswerTemplate(id string) error {
+	return a.templates.Delete(id)
+}
+
+// TemplateRenderRequest asks for an answer template filled in for a pending
+// question. Values override the template's default variable values; Adapt
+// has the LLM rewrite the filled-in text for the question.
+type TemplateRenderRequest struct {
+	QuestionID string            `json:"question_id"`
+	Values     map[string]string `json:"values"`
+	Adapt      bool              `json:"adapt"`
+}
+
+// TemplateRendering is an answer template filled in for a question. Missing
+// lists the placeholders no value was found for, left in Text as {name}.
+type TemplateRendering struct {
+	Text    string   `json:"text"`
+	Missing []string `json:"missing"`
+	Adapted bool     `json:"adapted"`
+}
+
+// RenderAnswerTemplate fills in an answer template for a pending question:
+// {question} and {product_name} come from the question, other placeholders
+// from req.Values and the template's defaults. Without a question only the
+// product name of the template's own product is filled in.
+func (a *App) RenderAnswerTemplate(id string, req TemplateRenderRequest) (*TemplateRendering, error) {
+	t, err := a.templates.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(req.Values)+2)
+	for k, v := range req.Values {
+		values[k] = v
+	}
+	var question string
+	productID := t.ProductID
+	if req.QuestionID != "" {
+		if question, productID, err = a.pendingManager.GetQuestion(req.QuestionID); err != nil {
+			return nil, err
+		}
+		values[answertemplate.VarQuestion] = question
+	}
+	if productID != "" {
+		if p, err := a.productService.GetByID(productID); err == nil && p != nil {
+			values[answertemplate.VarProductName] = p.Name
+		}
+	}
+	text, missing := t.Render(values)
+	out := &TemplateRendering{Text: text, Missing: missing}
+	if !req.Adapt {
+		return out, nil
+	}
+	if question == "" {
+		return nil, fmt.Errorf("按问题调整模板需要指定问题")
+	}
+	ls := budget.Optional(budget.ForProduct(a.queryEngine.LLMService(), productID))
+	adapted, err := answertemplate.Adapt(ls, text, question)
+	if err != nil {
+		if errors.Is(err, budget.ErrLimitReached) {
+			return nil, err
+		}
+		log.Printf("[Template] adapt %s for question %s failed: %v", id, req.QuestionID, err)
+		return nil, fmt.Errorf("模型调整模板失败，请稍后重试或直接插入模板")
+	}
+	out.Text, out.Adapted = adapted, true
+	out.Missing = out.Missing[:0]
+	for _, name := range missing {
+		if strings.Contains(adapted, "{"+name+"}") {
+			out.Missing = append(out.Missing, name)
+		}
+	}
+	return out, nil
+}
+
+// --- Query Replay Interface ---
+
+// replayCaller is the generation queue caller of replayed queries.
+const replayCaller = "replay"
+
+// replayBusyRetries bounds how often a replayed query waits for a full
+// generation queue before it is recorded as failed.
+const replayBusyRetries = 3
+
+// CreateReplaySample saves a random sample of logged queries for replays.
+func (a *App) CreateReplaySample(in replay.SampleInput, createdBy string) (*replay.Sample, error) {
+	return a.replays.CreateSample(in, createdBy)
+}
+
+// ListReplaySamples returns all saved query samples, newest first.
+func (a *App) ListReplaySamples() ([]replay.Sample, error) {
+	return a.replays.Samples()
+}
+
+// DeleteReplaySample removes a query sample with its runs, unless it is
+// being replayed.
+func (a *App) DeleteReplaySample(id string) error {
+	if a.replayRunning(id) {
+		return replay.ErrRunning
+	}
+	return a.replays.DeleteSample(id)
+}
+
+// ReplayRuns returns the runs of a sample, newest first, with the state of
+// their jobs.
+func (a *App) ReplayRuns(sampleID string) ([]replay.Run, error) {
+	runs, err := a.replays.Runs(sampleID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range runs {
+		if job, err := a.jobs.Get(runs[i].ID); err == nil {
+			runs[i].Status = job.Status
+		}
+	}
+	return runs, nil
+}
+
+// replayRunning reports whether a run of the sample is queued or running.
+func (a *App) replayRunning(sampleID string) bool {
+	runs, err := a.ReplayRuns(sampleID)
+	if err != nil {
+		return false
+	}
+	for _, r := range runs {
+		if r.Status == jobs.StatusQueued || r.Status == jobs.StatusRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// StartReplay asks the queries of a sample again through the current
+// pipeline in a background job and returns the job ID, which is also the ID
+// of the run. Replayed queries create no pending questions, query logs or
+// audit records; their model calls count toward the budget.
+func (a *App) StartReplay(sampleID, createdBy string) (string, error) {
+	sample, queries, err := a.replays.Sample(sampleID)
+	if err != nil {
+		return "", err
+	}
+	if a.replayRunning(sampleID) {
+		return "", replay.ErrRunning
+	}
+	cfg := a.configManager.Get()
+	if cfg == nil {
+		return "", fmt.Errorf("config not loaded")
+	}
+	settings := replay.Settings{
+		LLMModel:       cfg.LLM.ModelName,
+		EmbeddingModel: cfg.Embedding.ModelName,
+		Temperature:    cfg.LLM.Temperature,
+		TopK:           cfg.Vector.TopK,
+		Threshold:      cfg.Vector.Threshold,
+	}
+	label := fmt.Sprintf("回放查询样本「%s」（%d 条）", sample.Name, len(queries))
+	id, err := a.jobs.Submit(jobs.TypeReplay, sampleID, label, func(ctx context.Context, p *jobs.Progress) error {
+		return a.replays.Replay(ctx, p.ID(), queries, a.replayQuery, func(done, failed int) {
+			p.Set(done, len(queries), fmt.Sprintf("已回放 %d/%d，失败 %d", done, len(queries), failed))
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := a.replays.CreateRun(id, sampleID, settings, createdBy); err != nil {
+		a.jobs.Cancel(id)
+		return "", err
+	}
+	return id, nil
+}
+
+// replayQuery answers a sampled query as its user would see it, without
+// side effects, waiting for a full generation queue a few times.
+func (a *App) replayQuery(q replay.Query) (*replay.Outcome, error) {
+	req := query.QueryRequest{
+		Question:  q.Question,
+		UserID:    replayCaller,
+		ProductID: q.ProductID,
+		Caller:    replayCaller,
+		Priority:  llm.PriorityNormal,
+		DryRun:    true,
+	}
+	var resp *query.QueryResponse
+	var err error
+	for attempt := 0; ; attempt++ {
+		resp, err = a.queryEngine.Query(req)
+		if status, _ := queueError(err); status == 0 || attempt == replayBusyRetries {
+			break
+		}
+		time.Sleep(time.Duration(attempt+1) * 5 * time.Second)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if q.ProductID != "" {
+		if p, err := a.GetProduct(q.ProductID); err == nil {
+			resp.AppendDisclaimer(p.Disclaimer)
+		}
+	}
+	out := &replay.Outcome{Answer: resp.Answer, IsPending: resp.IsPending, Sources: make([]replay.Source, 0, len(resp.Sources))}
+	for _, src := range resp.Sources {
+		out.Sources = append(out.Sources, replay.Source{DocumentID: src.DocumentID, DocumentName: src.DocumentName, ChunkIndex: src.ChunkIndex})
+	}
+	return out, nil
+}
+
+// ReplayReport compares a run with baseline: replay.BaselineOriginal, the
+// ID of an earlier run of the same sample, or "" for the newest earlier run
+// that finished, falling back to the original answers.
+func (a *App) ReplayReport(runID, baseline string) (*replay.Report, error) {
+	run, err := a.replays.Run(runID)
+	if err != nil {
+		return nil, err
+	}
+	if baseline == "" {
+		baseline = replay.BaselineOriginal
+		runs, err := a.ReplayRuns(run.SampleID)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range runs {
+			if r.CreatedAt.Before(run.CreatedAt) && (r.Status == jobs.StatusSucceeded || r.Status == "") {
+				baseline = r.ID
+				break
+			}
+		}
+	}
+	rep, err := a.replays.Report(runID, baseline)
+	if err != nil {
+		return nil, err
+	}
+	if job, err := a.jobs.Get(runID); err == nil {
+		rep.Run.Status = job.Status
+	}
+	return rep, nil
+}
+
+// --- Glossary / Terminology Interface ---
+
+// ListGlossaryTerms returns the glossary terms that apply to a product, including global terms.
+func (a *App) ListGlossaryTerms(productID string) ([]glossary.Term, error) {
+	return a.glossary.List(productID)
+}
+
+// CreateGlossaryTerm adds a preferred term with the deprecated names it replaces.
+func (a *App) CreateGlossaryTerm(productID, term string, deprecated []string, note string, doNotTranslate bool) (*glossary.Term, error) {
+	return a.glossary.Create(productID, term, deprecated, note, doNotTranslate)
+}
+
+// UpdateGlossaryTerm replaces a glossary term's names, note and translation flag.
+func (a *App) UpdateGlossaryTerm(id, term string, deprecated []string, note string, doNotTranslate bool) (*glossary.Term, error) {
+	return a.glossary.Update(id, term, deprecated, note, doNotTranslate)
+}
+
+// DeleteGlossaryTerm removes a glossary term.
+func (a *App) DeleteGlossaryTerm(id string) error {
+	return a.glossary.Delete(id)
+}
+
+// CheckTerminology scans a product's chunks for deprecated terminology.
+func (a *App) CheckTerminology(productID string) (*glossary.Report, error) {
+	return a.glossary.Check(productID)
+}
+
+// RewriteTerminology replaces deprecated terminology in a product's documents and re-embeds them.
+func (a *App) RewriteTerminology(productID string, documentIDs []string) (*glossary.RewriteResult, error) {
+	return a.glossary.Rewrite(productID, documentIDs)
+}
+
+// --- Troubleshooting Flow Interface ---
+
+// ListFlows returns the troubleshooting flows of a product, including global flows.
+func (a *App) ListFlows(productID string) ([]flow.Flow, error) {
+	return a.flows.List(productID, false)
+}
+
+// GetFlow returns a troubleshooting flow with its nodes.
+func (a *App) GetFlow(id string) (*flow.Flow, error) {
+	return a.flows.Get(id)
+}
+
+// CreateFlow adds a troubleshooting flow for a product ("" for all products).
+func (a *App) CreateFlow(productID string, in flow.Input) (*flow.Flow, error) {
+	return a.flows.Create(productID, in)
+}
+
+// UpdateFlow replaces a troubleshooting flow's definition.
+func (a *App) UpdateFlow(id string, in flow.Input) (*flow.Flow, error) {
+	return a.flows.Update(id, in)
+}
+
+// DeleteFlow removes a troubleshooting flow.
+func (a *App) DeleteFlow(id string) error {
+	return a.flows.Delete(id)
+}
+
+// AvailableFlows returns the enabled flows chat users of a product can start.
+func (a *App) AvailableFlows(productID string) ([]flow.Summary, error) {
+	return a.flows.Summaries(productID)
+}
+
+// WalkFlow returns the node reached by the given choices in an enabled flow.
+func (a *App) WalkFlow(id string, path []int) (*flow.Position, error) {
+	return a.flows.Walk(id, path)
+}
+
+// RouteToFlow picks the enabled flow of a product that fits a question, or nil.
+func (a *App) RouteToFlow(question, productID string) (*flow.Summary, error) {
+	flows, err := a.flows.Summaries(productID)
+	if err != nil || len(flows) == 0 {
+		return nil, err
+	}
+	return flow.Route(a.queryEngine.LLMService(), question, flows)
+}
+
+// --- Document Management Interface ---
+
+// UploadFile uploads and processes a document file.
+func (a *App) UploadFile(req document.UploadFileRequest) (*document.DocumentInfo, error) {
+	if err := a.checkProductOpen(req.ProductID); err != nil {
+		return nil, err
+	}
+	return a.docManager.UploadFile(req)
+}
+
+// UploadURL fetches and processes content from a URL.
+func (a *App) UploadURL(req document.UploadURLRequest) (*document.DocumentInfo, error) {
+	if err := a.checkProductOpen(req.ProductID); err != nil {
+		return nil, err
+	}
+	return a.docManager.UploadURL(req)
+}
+
+// Crawl imports the pages of a site reachable from req.URL into the product.
+// See document.DocumentManager.Crawl.
+func (a *App) Crawl(ctx context.Context, req document.CrawlRequest, progress func(document.CrawlEvent)) (*document.CrawlResult, error) {
+	if err := a.checkProductOpen(req.ProductID); err != nil {
+		return nil, err
+	}
+	return a.docManager.Crawl(ctx, req, progress)
+}
+
+// CheckCrawl validates a crawl request before it is started and returns it
+// with defaults filled in.
+func (a *App) CheckCrawl(req document.CrawlRequest) (document.CrawlRequest, error) {
+	if err := a.checkProductOpen(req.ProductID); err != nil {
+		return req, err
+	}
+	return a.docManager.NormalizeCrawlRequest(req)
+}
+
+// PreviewURL fetches and parses URL content for preview.
+func (a *App) PreviewURL(url string) (*document.URLPreviewResult, error) {
+	return a.docManager.PreviewURL(url)
+}
+
+// ListDocuments returns uploaded documents, optionally filtered by product ID.
+func (a *App) ListDocuments(productID string) ([]document.DocumentInfo, error) {
+	return a.docManager.ListDocuments(productID)
+}
+
+// DocumentCitations returns how often each chunk of a document was cited and opened.
+func (a *App) DocumentCitations(docID string) ([]document.ChunkCitation, error) {
+	return a.docManager.ChunkCitations(docID)
+}
+
+// DeleteDocument removes a document and its associated vectors.
+func (a *App) DeleteDocument(docID string) error {
+	return a.docManager.DeleteDocument(docID)
+}
+
+// ReplaceDocument uploads a new version of a document's file.
+func (a *App) ReplaceDocument(docID string, req document.ReplaceFileRequest) (*document.DocumentVersion, error) {
+	return a.docManager.ReplaceDocument(docID, req)
+}
+
+// ListDocumentVersions returns the file versions of a document, newest first.
+func (a *App) ListDocumentVersions(docID string) ([]document.DocumentVersion, error) {
+	return a.docManager.ListVersions(docID)
+}
+
+// RestoreDocumentVersion makes an earlier version of a document current again.
+func (a *App) RestoreDocumentVersion(docID string, version int, createdBy string) (*document.DocumentVersion, error) {
+	return a.docManager.RestoreVersion(docID, version, createdBy)
+}
+
+// GetDocumentInfo returns metadata for a single document by ID.
+func (a *App) GetDocumentInfo(docID string) (*document.DocumentInfo, error) {
+	return a.docManager.GetDocumentInfo(docID)
+}
+
+// GetDocumentReview returns extracted segments for reviewing document analysis results.
+func (a *App) GetDocumentReview(docID string) (*document.ReviewData, error) {
+	return a.docManager.GetDocumentReview(docID)
+}
+
+// LocateChunk returns where a cited chunk came from within its document.
+func (a *App) LocateChunk(docID string, chunkIndex int) (*document.ChunkLocation, error) {
+	return a.docManager.LocateChunk(docID, chunkIndex)
+}
+
+// DocumentText returns the text a document's chunks were split from, which
+// the character offsets of its citations point into.
+func (a *App) DocumentText(docID string) (string, error) {
+	return a.docManager.DocumentText(docID)
+}
+
+// ListDocumentChunks returns the stored chunks of a document.
+func (a *App) ListDocumentChunks(docID string) ([]document.StoredChunk, error) {
+	return a.docManager.ListChunks(docID)
+}
+
+// UpdateDocumentChunk replaces the text of a chunk and re-embeds it.
+func (a *App) UpdateDocumentChunk(docID string, chunkIndex int, text string) (*document.StoredChunk, error) {
+	return a.docManager.UpdateChunk(docID, chunkIndex, text)
+}
+
+// DeleteDocumentChunk removes a single chunk of a document.
+func (a *App) DeleteDocumentChunk(docID string, chunkIndex int) error {
+	return a.docManager.DeleteChunk(docID, chunkIndex)
+}
+
+// SetDocumentEffectiveDates sets the period a document is cited in user answers.
+func (a *App) SetDocumentEffectiveDates(docID, from, until string) (*document.DocumentInfo, error) {
+	return a.docManager.SetEffectiveDates(docID, from, until)
+}
+
+// SetDocumentSchedule sets when a document or knowledge entry is published
+// to and hidden from user answers; by is notified when the schedule fires.
+func (a *App) SetDocumentSchedule(docID, publishAt, unpublishAt, by string) (*document.DocumentInfo, error) {
+	return a.docManager.SetSchedule(docID, publishAt, unpublishAt, by)
+}
+
+// TagDocument re-runs LLM tagging of a document.
+func (a *App) TagDocument(docID string) (*document.DocumentTags, error) {
+	return a.docManager.TagDocument(docID)
+}
+
+// DocumentTagSummary counts the categories and tags of documents.
+func (a *App) DocumentTagSummary(productID string) (*document.TagSummary, error) {
+	return a.docManager.TagSummary(productID)
+}
+
+// EmbeddingFingerprints reports the embedding models and dimensions of the
+// stored chunks against the configured embedding model.
+func (a *App) EmbeddingFingerprints() (*document.EmbeddingFingerprints, error) {
+	return a.docManager.EmbeddingFingerprints()
+}
+
+// ReindexRequest selects the embedding model to re-embed the documents with.
+// Empty fields keep the configured values.
+type ReindexRequest struct {
+	Endpoint      string `json:"endpoint"`
+	APIKey        string `json:"api_key"`
+	ModelName     string `json:"model_name"`
+	UseMultimodal *bool  `json:"use_multimodal"`
+}
+
+// StartReindex re-embeds every document with the requested embedding model
+// in the background. The model is checked with a test embedding first; the
+// embedding configuration switches to it once the new vectors are live.
+func (a *App) StartReindex(req ReindexRequest) error {
+	cfg := a.configManager.Get()
+	if cfg == nil {
+		return fmt.Errorf("config not loaded")
+	}
+	target := cfg.Embedding
+	updates := map[string]interface{}{}
+	if v := strings.TrimSpace(req.Endpoint); v != "" {
+		target.Endpoint = v
+		updates["embedding.endpoint"] = v
+	}
+	if v := strings.TrimSpace(req.APIKey); v != "" && v != "***" {
+		target.APIKey = v
+		updates["embedding.api_key"] = v
+	}
+	if v := strings.TrimSpace(req.ModelName); v != "" {
+		target.ModelName = v
+		updates["embedding.model_name"] = v
+	}
+	if req.UseMultimodal != nil {
+		target.UseMultimodal = *req.UseMultimodal
+		updates["embedding.use_multimodal"] = *req.UseMultimodal
+	}
+	if target.ModelName == "" {
+		return fmt.Errorf("请填写向量模型名称")
+	}
+	if a.docManager.ReindexStatus().Running() {
+		return document.ErrReindexRunning
+	}
+	es := embedding.NewAPIEmbeddingService(target.Endpoint, target.APIKey, target.ModelName, target.UseMultimodal)
+	if _, err := es.Embed("test"); err != nil {
+		return fmt.Errorf("向量模型不可用: %w", err)
+	}
+	return a.docManager.StartReindex(a.budget.WrapEmbedding(es), func() error {
+		if len(updates) == 0 {
+			return nil
+		}
+		return a.UpdateConfig(updates)
+	})
+}
+
+// ReindexStatus returns the progress of the re-embedding job.
+func (a *App) ReindexStatus() document.ReindexStatus {
+	return a.docManager.ReindexStatus()
+}
+
+// ReindexDocuments lists the per-document state of the re-embedding job.
+func (a *App) ReindexDocuments() ([]document.ReindexDocument, error) {
+	return a.docManager.ReindexDocuments()
+}
+
+// CancelReindex stops the re-embedding job; see DocumentManager.CancelReindex.
+func (a *App) CancelReindex() bool {
+	return a.docManager.CancelReindex()
+}
+
+// reindexConflict reports whether updates change the embedding model while
+// a re-embedding job is running, which would mix models in the new vectors.
+func (a *App) reindexConflict(updates map[string]interface{}) bool {
+	if !a.docManager.ReindexStatus().Running() {
+		return false
+	}
+	cfg := a.configManager.Get()
+	if cfg == nil {
+		return false
+	}
+	current := map[string]interface{}{
+		"embedding.endpoint":       cfg.Embedding.Endpoint,
+		"embedding.model_name":     cfg.Embedding.ModelName,
+		"embedding.use_multimodal": cfg.Embedding.UseMultimodal,
+	}
+	for key, val := range current {
+		if v, ok := updates[key]; ok && v != val {
+			return true
+		}
+	}
+	if v, ok := updates["embedding.api_key"].(string); ok && v != "" && v != cfg.Embedding.APIKey {
+		return true
+	}
+	return false
+}
+
+// RelatedDocuments returns the documents most similar to docID by embedding
+// centroid similarity, for finding overlapping content.
+func (a *App) RelatedDocuments(docID string, limit int) ([]document.RelatedDocument, error) {
+	return a.docManager.RelatedDocuments(docID, limit)
+}
+
+// NearDuplicates reports the pairs of documents whose content is nearly the
+// same, of one product and the public library when productID is set.
+func (a *App) NearDuplicates(productID string, threshold float64, limit int) (*document.DuplicateReport, error) {
+	return a.docManager.NearDuplicates(productID, threshold, limit)
+}
+
+// --- Pending Questions Interface ---
+
+// ListPendingQuestions returns pending questions filtered by status, productID
+// and link to external tickets. Pass empty filters to list all questions.
+func (a *App) ListPendingQuestions(status string, productID string, ext pending.ExternalRefFilter) ([]pending.PendingQuestion, error) {
+	return a.pendingManager.ListPending(status, productID, ext)
+}
+
+// SetPendingExternalRef links a pending question to a ticket in an external
+// system, or clears the link when ref is empty.
+func (a *App) SetPendingExternalRef(id, ref string) error {
+	return a.pendingManager.SetExternalRef(id, ref)
+}
+
+// AnswerQuestion submits an admin answer to a pending question. It returns
+// the review state the answer starts in: a draft when review is required.
+func (a *App) AnswerQuestion(req pending.AdminAnswerRequest, author string) (string, error) {
+	req.ReviewStatus = a.initialReviewStatus()
+	req.Author = author
+	return req.ReviewStatus, a.pendingManager.AnswerQuestion(req)
+}
+
+// StartBulkAnswer answers pending questions from an imported file in a
+// background job and returns the job ID. Each row goes through the same
+// pipeline as AnswerQuestion; the outcomes are kept for BulkAnswerResults.
+func (a *App) StartBulkAnswer(items []pending.BulkAnswer, author string) (string, error) {
+	a.pendingManager.PruneBulkResults()
+	reviewStatus := a.initialReviewStatus()
+	label := fmt.Sprintf("批量导入 %d 条回答", len(items))
+	return a.jobs.Submit(jobs.TypeBulkAnswer, "", label, func(ctx context.Context, p *jobs.Progress) error {
+		var answered, skipped, failed int
+		_, err := a.pendingManager.AnswerBulk(ctx, items, reviewStatus, author, func(done int, r pending.BulkResult) {
+			switch r.Status {
+			case pending.BulkAnswered:
+				answered++
+			case pending.BulkSkipped:
+				skipped++
+			default:
+				failed++
+			}
+			if err := a.pendingManager.RecordBulkResult(p.ID(), r); err != nil {
+				log.Printf("[Pending] failed to record bulk answer result: %v", err)
+			}
+			p.Set(done, len(items), fmt.Sprintf("成功 %d，跳过 %d，失败 %d", answered, skipped, failed))
+		})
+		return err
+	})
+}
+
+// BulkAnswerResults returns a bulk answer job and its row outcomes so far.
+func (a *App) BulkAnswerResults(jobID string) (*jobs.Job, []pending.BulkResult, error) {
+	job, err := a.jobs.Get(jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.Type != jobs.TypeBulkAnswer {
+		return nil, nil, jobs.ErrNotFound
+	}
+	results, err := a.pendingManager.BulkResults(jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return job, results, nil
+}
+
+// DeletePendingQuestion removes a pending question by ID.
+func (a *App) DeletePendingQuestion(id string) error {
+	return a.pendingManager.DeletePending(id)
+}
+
+// CreatePendingQuestion creates a new pending question from a user who is not satisfied with the answer.
+func (a *App) CreatePendingQuestion(question, userID, imageData, productID string) (*pending.PendingQuestion, error) {
+	pq, err := a.pendingManager.CreatePending(question, userID, imageData, productID)
+	if err != nil {
+		return nil, err
+	}
+	a.notifyPending(pq.ID, pq.Question, pq.UserID, pq.ProductID)
+	return pq, nil
+}
+
+// notifyPending pushes a new pending question to the configured team chat
+// channels and subscribed admins, with a link to answer it when the external base URL is known.
+func (a *App) notifyPending(id, question, userID, productID string) {
+	if !a.notifier.Active() {
+		return
+	}
+	ev := notify.PendingEvent{QuestionID: id, Question: question, User: userID, ProductID: productID}
+	var name string
+	if err := a.readDB.QueryRow("SELECT COALESCE(name, '') FROM users WHERE id = ?", userID).Scan(&name); err == nil && name != "" {
+		ev.User = name
+	}
+	if productID != "" {
+		if p, err := a.productService.GetByID(productID); err == nil && p != nil {
+			ev.Product = p.Name
+		}
+	}
+	if base := a.externalBaseURL(); base != "" {
+		ev.Link = base + "/admin-panel?tab=pending&question=" + url.QueryEscape(id)
+	}
+	a.notifier.PendingCreated(ev)
+}
+
+// NotifyScheduleChanges tells the owners of documents published or
+// unpublished by their schedule, through the team chat channels, and the
+// admins subscribed to schedule changes.
+func (a *App) NotifyScheduleChanges(changes []document.ScheduleChange) {
+	if !a.notifier.Active() {
+		return
+	}
+	base := a.externalBaseURL()
+	for _, c := range changes {
+		ev := notify.ScheduleEvent{
+			DocumentID: c.DocumentID,
+			Name:       c.Name,
+			ProductID:  c.ProductID,
+			Owner:      a.adminDisplayName(c.ScheduledBy),
+			Published:  c.State == document.SchedulePublished,
+		}
+		if c.ProductID != "" {
+			if p, err := a.productService.GetByID(c.ProductID); err == nil && p != nil {
+				ev.Product = p.Name
+			}
+		}
+		if base != "" {
+			tab := "documents"
+			if c.Type == "knowledge" {
+				tab = "knowledge"
+			}
+			ev.Link = base + "/admin-panel?tab=" + tab
+		}
+		a.notifier.ScheduleChanged(ev)
+	}
+}
+
+// notifyBudgetAlert tells admins through the team chat channels and their
+// subscriptions that the model spend of a month reached a share of a budget cap.
+func (a *App) notifyBudgetAlert(al budget.Alert) {
+	if !a.notifier.Active() {
+		return
+	}
+	ev := notify.BudgetEvent{Month: al.Month, ProductID: al.ProductID, Percent: al.Percent, Spent: al.Spent, Limit: al.Limit}
+	if cfg := a.configManager.Get(); cfg != nil {
+		ev.Action = cfg.Budget.EffectiveOnLimit()
+	}
+	if al.ProductID != "" {
+		ev.Product = al.ProductID
+		if p, err := a.productService.GetByID(al.ProductID); err == nil && p != nil {
+			ev.Product = p.Name
+		}
+	}
+	if base := a.externalBaseURL(); base != "" {
+		ev.Link = base + "/admin-panel?tab=settings"
+	}
+	a.notifier.BudgetReached(ev)
+}
+
+// BudgetReport returns the model spend of month ("" for the current month)
+// against the budget caps, with product names filled in.
+func (a *App) BudgetReport(month string) (*budget.Report, error) {
+	if a.budget == nil {
+		return nil, fmt.Errorf("预算统计不可用")
+	}
+	rep, err := a.budget.Report(month)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rep.Products {
+		if p, err := a.productService.GetByID(rep.Products[i].ProductID); err == nil && p != nil {
+			rep.Products[i].Name = p.Name
+		}
+	}
+	return rep, nil
+}
+
+// adminDisplayName returns the username of an admin session user ID, or the
+// ID itself when it names no admin account.
+func (a *App) adminDisplayName(userID string) string {
+	if userID == "admin" {
+		if cfg := a.configManager.Get(); cfg != nil && cfg.Admin.Username != "" {
+			return cfg.Admin.Username
+		}
+		return userID
+	}
+	if subID, ok := strings.CutPrefix(userID, "admin_"); ok {
+		var username string
+		if err := a.readDB.QueryRow(`SELECT username FROM admin_users WHERE id = ?`, subID).Scan(&username); err == nil {
+			return username
+		}
+	}
+	if userID == "" {
+		return "-"
+	}
+	return userID
+}
+
+// TestNotification sends a test message through a notification channel,
+// using the given settings with the saved webhook URL and secret filling in
+// the empty ones.
+func (a *App) TestNotification(name string, ch config.NotifyChannel) error {
+	cfg := a.configManager.Get()
+	if cfg == nil {
+		return fmt.Errorf("config not loaded")
+	}
+	saved := cfg.Notifications.Channel(name)
+	if saved == nil {
+		return fmt.Errorf("未知的通知渠道: %s", name)
+	}
+	if ch.WebhookURL == "" {
+		ch.WebhookURL = saved.WebhookURL
+	}
+	if ch.Secret == "" {
+		ch.Secret = saved.Secret
+	}
+	return a.notifier.Test(name, ch)
+}
+
+// NotifyDocumentFailed tells the admins subscribed to failed documents that
+// processing doc failed.
+func (a *App) NotifyDocumentFailed(doc document.DocumentInfo, reason string) {
+	if !a.notifier.Active() {
+		return
+	}
+	ev := notify.FailureEvent{DocumentID: doc.ID, Name: doc.Name, ProductID: doc.ProductID, Reason: reason}
+	if doc.ProductID != "" {
+		if p, err := a.productService.GetByID(doc.ProductID); err == nil && p != nil {
+			ev.Product = p.Name
+		}
+	}
+	if base := a.externalBaseURL(); base != "" {
+		ev.Link = base + "/admin-panel?tab=documents"
+	}
+	a.notifier.DocumentFailed(ev)
+}
+
+// NotifyQuarantine tells the admins subscribed to security events that an
+// upload was quarantined. alerted is the address sent the scan alert
+// already, if any.
+func (a *App) NotifyQuarantine(doc document.DocumentInfo, reason, alerted string) {
+	ev := notify.SecurityEvent{
+		Title:     "上传文件已被隔离",
+		Details:   []string{"文件名：" + doc.Name, "文档 ID：" + doc.ID, "原因：" + reason},
+		ProductID: doc.ProductID,
+	}
+	if alerted != "" {
+		ev.Skip = []string{alerted}
+	}
+	a.notifier.SecurityAlert(ev)
+}
+
+// recordAdminLoginFailure records a failed admin login and tells the admins
+// subscribed to security events when it locks the account or address.
+func (a *App) recordAdminLoginFailure(username, ip string) {
+	a.loginLimiter.RecordAttempt(username, ip, false)
+	if err := a.loginLimiter.CheckAllowed(username, ip); err != nil {
+		a.notifier.SecurityAlert(notify.SecurityEvent{
+			Title:   "管理员账号多次登录失败已被锁定",
+			Details: []string{"用户名：" + username, "IP：" + ip, "状态：" + err.Error()},
+		})
+	}
+}
+
+// SendNotificationDigest sends the daily digest to the admins subscribed to
+// it: the open pending questions and the documents that failed in the last
+// day, each admin receiving those of their products.
+func (a *App) SendNotificationDigest() error {
+	if !a.notifier.Active() {
+		return nil
+	}
+	names := make(map[string]string)
+	productName := func(id string) string {
+		if id == "" {
+			return ""
+		}
+		if name, ok := names[id]; ok {
+			return name
+		}
+		name := id
+		if p, err := a.productService.GetByID(id); err == nil && p != nil {
+			name = p.Name
+		}
+		names[id] = name
+		return name
+	}
+	collect := func(query string, args ...interface{}) ([]notify.DigestItem, error) {
+		rows, err := a.readDB.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var items []notify.DigestItem
+		for rows.Next() {
+			var it notify.DigestItem
+			if err := rows.Scan(&it.Title, &it.ProductID); err != nil {
+				return nil, err
+			}
+			it.Product = productName(it.ProductID)
+			items = append(items, it)
+		}
+		return items, rows.Err()
+	}
+
+	ev := notify.DigestEvent{Date: time.Now().Format("2006-01-02")}
+	var err error
+	ev.Pending, err = collect(`SELECT question, COALESCE(product_id, '') FROM pending_questions WHERE status = 'pending' ORDER BY created_at`)
+	if err != nil {
+		return fmt.Errorf("query pending questions: %w", err)
+	}
+	ev.Failed, err = collect(`SELECT name, COALESCE(product_id, '') FROM documents WHERE status = 'failed' AND processed_at >= ? ORDER BY processed_at`, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return fmt.Errorf("query failed documents: %w", err)
+	}
+	if base := a.externalBaseURL(); base != "" {
+		ev.Link = base + "/admin-panel"
+	}
+	a.notifier.Digest(ev)
+	return nil
+}
+
+// notifyScope returns the product IDs of an admin session user ID, nil for
+// admins of all products.
+func (a *App) notifyScope(adminID string) []string {
+	if adminID == "admin" {
+		return nil
+	}
+	products, err := a.GetProductsByAdminUserID(adminID)
+	if err != nil {
+		return nil
+	}
+	ids := make([]string, 0, len(products))
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+// isAdminAccount reports whether userID is the session user ID of the super
+// admin or a sub-account, rather than an API key.
+func isAdminAccount(userID string) bool {
+	return userID == "admin" || strings.HasPrefix(userID, "admin_")
+}
+
+// GetAdminNotifyPrefs returns the notification preferences of the admin
+// with session user ID userID, with the webhook URL and secret masked.
+func (a *App) GetAdminNotifyPrefs(userID string) (config.AdminNotifyPrefs, error) {
+	if !isAdminAccount(userID) {
+		return config.AdminNotifyPrefs{}, fmt.Errorf("仅管理员账号可设置个人通知")
+	}
+	cfg := a.configManager.Get()
+	if cfg == nil {
+		return config.AdminNotifyPrefs{}, fmt.Errorf("config not loaded")
+	}
+	p := cfg.Notifications.Admins[userID]
+	if p.Events == nil {
+		p.Events = []string{}
+	}
+	p.WebhookURL = maskSecret(p.WebhookURL)
+	p.Secret = maskSecret(p.Secret)
+	return p, nil
+}
+
+// SetAdminNotifyPrefs saves the notification preferences of the admin with
+// session user ID userID. A webhook URL or secret of "***" keeps the saved
+// one; the webhook must be an external address.
+func (a *App) SetAdminNotifyPrefs(userID string, p config.AdminNotifyPrefs) error {
+	p, _, err := a.resolveAdminNotifyPrefs(userID, p)
+	if err != nil {
+		return err
+	}
+	p.WebhookURL = strings.TrimSpace(p.WebhookURL)
+	if p.WebhookURL != "" {
+		if err := a.notifier.ValidateWebhookURL(p.WebhookURL); err != nil {
+			return err
+		}
+	}
+	return a.configManager.SetAdminNotifyPrefs(userID, p)
+}
+
+// TestAdminNotifyPrefs sends a test message to the webhook in p, with "***"
+// standing for the saved webhook URL and secret of userID, and to the saved
+// email address when p has the same one. Test email only goes to saved
+// addresses so the test cannot be used to send mail to arbitrary ones.
+func (a *App) TestAdminNotifyPrefs(userID string, p config.AdminNotifyPrefs) error {
+	p, saved, err := a.resolveAdminNotifyPrefs(userID, p)
+	if err != nil {
+		return err
+	}
+	p.Email = strings.TrimSpace(p.Email)
+	p.WebhookURL = strings.TrimSpace(p.WebhookURL)
+	if p.Email == "" && p.WebhookURL == "" {
+		return fmt.Errorf("请填写邮箱或 Webhook 地址")
+	}
+	if p.Email != "" {
+		if !strings.EqualFold(p.Email, saved.Email) {
+			return fmt.Errorf("请先保存邮箱再发送测试邮件")
+		}
+		if a.emailService == nil {
+			return fmt.Errorf("邮件服务未配置")
+		}
+		if err := a.emailService.SendAlert(saved.Email, "【AskFlow】测试通知", "【AskFlow】测试消息：个人通知配置正确，订阅的事件将发送到这里。"); err != nil {
+			return fmt.Errorf("邮件: %w", err)
+		}
+	}
+	if p.WebhookURL != "" {
+		if err := a.notifier.TestPersonal(p.Channel, config.NotifyChannel{WebhookURL: p.WebhookURL, Secret: strings.TrimSpace(p.Secret)}); err != nil {
+			return fmt.Errorf("Webhook: %w", err)
+		}
+	}
+	return nil
+}
+
+// resolveAdminNotifyPrefs replaces a webhook URL or secret of "***" in p
+// with the saved one of userID, and returns p with the saved preferences.
+func (a *App) resolveAdminNotifyPrefs(userID string, p config.AdminNotifyPrefs) (config.AdminNotifyPrefs, config.AdminNotifyPrefs, error) {
+	if !isAdminAccount(userID) {
+		return p, config.AdminNotifyPrefs{}, fmt.Errorf("仅管理员账号可设置个人通知")
+	}
+	var saved config.AdminNotifyPrefs
+	if cfg := a.configManager.Get(); cfg != nil {
+		saved = cfg.Notifications.Admins[userID]
+	}
+	if p.WebhookURL == "***" {
+		p.WebhookURL = saved.WebhookURL
+	}
+	if p.Secret == "***" {
+		p.Secret = saved.Secret
+	}
+	return p, saved, nil
+}
+
+// --- Review Workflow Interface ---
+
+// Review actions accepted by ApplyReviewAction.
+const (
+	ReviewActionSubmit  = "submit"
+	ReviewActionApprove = "approve"
+	ReviewActionReject  = "reject"
+)
+
+// Reviewer is an admin who can be assigned to review entries. ID is the
+// admin's session user ID ("admin" or "admin_<id>").
+type Reviewer struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// ReviewResult is the outcome of a review action on one entry.
+type ReviewResult struct {
+	ID    string `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+// initialReviewStatus returns the review state new knowledge entries and
+// answers start in.
+func (a *App) initialReviewStatus() string {
+	if cfg := a.configManager.Get(); cfg != nil && cfg.Review.Required {
+		return document.ReviewDraft
 	}
+	return ""
 }
-// SessionManager returns the session manager for testing purposes.
-func (a *App) SessionManager() *auth.SessionManager {
-	return a.sessionManager
+
+// ListReviewQueue returns unpublished knowledge entries and answers.
+func (a *App) ListReviewQueue(status, productID, reviewerID string) ([]document.ReviewItem, error) {
+	return a.docManager.ListReviewQueue(status, productID, reviewerID)
 }
 
-// --- Query Interface ---
+// GetReviewItem returns one entry of the review queue with its full text.
+func (a *App) GetReviewItem(docID string) (*document.ReviewItem, error) {
+	return a.docManager.GetReviewItem(docID)
+}
 
-// Query processes a user question through the RAG pipeline.
-func (a *App) Query(req query.QueryRequest) (*query.QueryResponse, error) {
-	return a.queryEngine.Query(req)
+// --- Email ingestion ---
+
+// Outcomes of an inbound email.
+const (
+	InboundEmailCreated   = "created"
+	InboundEmailDuplicate = "duplicate"
+	InboundEmailIgnored   = "ignored"
+)
+
+// InboundEmailResult is the outcome of an inbound email. Ignored messages
+// are still acknowledged so the mail provider does not retry them.
+type InboundEmailResult struct {
+	Status     string `json:"status"`
+	DocumentID string `json:"document_id,omitempty"`
+	Reason     string `json:"reason,omitempty"`
 }
 
-// --- Document Management Interface ---
+// EmailIngestToken returns the inbound email webhook token, or "" when email
+// ingestion is disabled or has no token.
+func (a *App) EmailIngestToken() string {
+	cfg := a.configManager.Get()
+	if cfg == nil || !cfg.EmailIngest.Enabled {
+		return ""
+	}
+	return cfg.EmailIngest.Token
+}
 
-// UploadFile uploads and processes a document file.
-func (a *App) UploadFile(req document.UploadFileRequest) (*document.DocumentInfo, error) {
-	return a.docManager.UploadFile(req)
+// IngestEmail converts an inbound email sent to the designated mailbox into
+// a draft knowledge entry, whatever review.required says, so an admin
+// reviews it before it is used in answers. Image attachments are attached
+// to the entry. A message is only imported once, by Message-ID.
+func (a *App) IngestEmail(msg *mailin.Message) (*InboundEmailResult, error) {
+	cfg := a.configManager.Get()
+	if cfg == nil || !cfg.EmailIngest.Enabled {
+		return nil, fmt.Errorf("邮件导入未启用")
+	}
+	ic := cfg.EmailIngest
+	if len(ic.Recipients) > 0 && !matchAnyAddress(msg.To, ic.Recipients) {
+		return &InboundEmailResult{Status: InboundEmailIgnored, Reason: "收件人不是指定的邮箱"}, nil
+	}
+	if msg.From == "" {
+		return &InboundEmailResult{Status: InboundEmailIgnored, Reason: "缺少发件人"}, nil
+	}
+	if len(ic.AllowedSenders) > 0 && !mailin.MatchAddress(msg.From, ic.AllowedSenders) {
+		return &InboundEmailResult{Status: InboundEmailIgnored, Reason: "发件人不在允许列表中"}, nil
+	}
+	body := msg.Body()
+	if body == "" {
+		return &InboundEmailResult{Status: InboundEmailIgnored, Reason: "邮件正文为空"}, nil
+	}
+
+	messageID := msg.MessageID
+	if messageID == "" {
+		sum := sha256.Sum256([]byte(msg.From + "\n" + msg.Subject + "\n" + body))
+		messageID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	var docID string
+	err := a.db.QueryRow(`SELECT document_id FROM inbound_emails WHERE message_id = ?`, messageID).Scan(&docID)
+	if err == nil {
+		return &InboundEmailResult{Status: InboundEmailDuplicate, DocumentID: docID}, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to query inbound email: %w", err)
+	}
+
+	title := mailin.CleanSubject(msg.Subject)
+	if title == "" {
+		title, _, _ = strings.Cut(body, "\n")
+	}
+	req := KnowledgeEntryRequest{
+		Title:     textutil.Truncate(strings.TrimSpace(title), 200),
+		Content:   textutil.Truncate(body, 30000),
+		ProductID: ic.ProductID,
+	}
+	for _, att := range msg.Attachments {
+		if len(req.ImageURLs) >= 20 {
+			break
+		}
+		if !strings.HasPrefix(http.DetectContentType(att.Data), "image/") {
+			continue
+		}
+		url, err := a.docManager.SaveUploadedImage(att.Data)
+		if err != nil {
+			log.Printf("[EmailIngest] failed to save attachment %q: %v", att.Filename, err)
+			continue
+		}
+		req.ImageURLs = appendUnique(req.ImageURLs, url)
+	}
+
+	docID, err = a.addKnowledgeEntry(req, "email:"+msg.From, document.ReviewDraft)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := a.db.Exec(
+		`INSERT OR REPLACE INTO inbound_emails (message_id, sender, subject, document_id, created_at) VALUES (?, ?, ?, ?, ?)`,
+		messageID, msg.From, msg.Subject, docID, time.Now().UTC(),
+	); err != nil {
+		log.Printf("[EmailIngest] failed to record message %s: %v", messageID, err)
+	}
+	log.Printf("[EmailIngest] created draft %s from %s", docID, msg.From)
+	return &InboundEmailResult{Status: InboundEmailCreated, DocumentID: docID}, nil
 }
 
-// UploadURL fetches and processes content from a URL.
-func (a *App) UploadURL(req document.UploadURLRequest) (*document.DocumentInfo, error) {
-	return a.docManager.UploadURL(req)
+// addCallCandidates stores the Q&A pairs extracted from a call recording as
+// draft knowledge entries of the recording's product, whatever
+// review.required says, so an admin reviews them before they are used in
+// answers. It returns the number of drafts created.
+func (a *App) addCallCandidates(docID, docName, productID string, pairs []document.CallQA) int {
+	created := 0
+	for _, qa := range pairs {
+		req := KnowledgeEntryRequest{
+			Title:     textutil.Truncate(qa.Question, 200),
+			Content:   textutil.Truncate(qa.Answer, 30000),
+			ProductID: productID,
+		}
+		if _, err := a.addKnowledgeEntry(req, document.CallAuthorPrefix+docID, document.ReviewDraft); err != nil {
+			log.Printf("[Call] failed to draft entry from %q: %v", docName, err)
+			continue
+		}
+		created++
+	}
+	return created
 }
 
-// PreviewURL fetches and parses URL content for preview.
-func (a *App) PreviewURL(url string) (*document.URLPreviewResult, error) {
-	return a.docManager.PreviewURL(url)
+// matchAnyAddress reports whether one of addrs matches patterns.
+func matchAnyAddress(addrs, patterns []string) bool {
+	for _, addr := range addrs {
+		if mailin.MatchAddress(addr, patterns) {
+			return true
+		}
+	}
+	return false
 }
 
-// ListDocuments returns uploaded documents, optionally filtered by product ID.
-func (a *App) ListDocuments(productID string) ([]document.DocumentInfo, error) {
-	return a.docManager.ListDocuments(productID)
+// --- Documentation portal ---
+
+// PortalCategory is a product, or the public library (empty ProductID), in
+// the documentation portal.
+type PortalCategory struct {
+	ProductID   string `json:"product_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Articles    int    `json:"articles"`
 }
 
-// DeleteDocument removes a document and its associated vectors.
-func (a *App) DeleteDocument(docID string) error {
-	return a.docManager.DeleteDocument(docID)
+// PortalEnabled reports whether the read-only documentation portal is on.
+func (a *App) PortalEnabled() bool {
+	cfg := a.configManager.Get()
+	return cfg != nil && cfg.Portal.Enabled
 }
 
-// GetDocumentInfo returns metadata for a single document by ID.
-func (a *App) GetDocumentInfo(docID string) (*document.DocumentInfo, error) {
-	return a.docManager.GetDocumentInfo(docID)
+// portalProducts returns the IDs of the products published in the portal,
+// including "" for the public library, or nil when all products are.
+// Archived products are never published.
+func (a *App) portalProducts() map[string]bool {
+	cfg := a.configManager.Get()
+	var ids map[string]bool
+	if cfg != nil && len(cfg.Portal.ProductIDs) > 0 {
+		ids = map[string]bool{"": true}
+		for _, id := range cfg.Portal.ProductIDs {
+			ids[id] = true
+		}
+	}
+	products, err := a.productService.List()
+	if err != nil {
+		return ids
+	}
+	var archived []string
+	for _, p := range products {
+		if p.Archived() {
+			archived = append(archived, p.ID)
+		}
+	}
+	if len(archived) == 0 {
+		return ids
+	}
+	if ids == nil {
+		ids = map[string]bool{"": true}
+		for _, p := range products {
+			ids[p.ID] = true
+		}
+	}
+	for _, id := range archived {
+		delete(ids, id)
+	}
+	return ids
 }
 
-// GetDocumentReview returns extracted segments for reviewing document analysis results.
-func (a *App) GetDocumentReview(docID string) (*document.ReviewData, error) {
-	return a.docManager.GetDocumentReview(docID)
+// PortalCategories returns the portal categories that have articles: the
+// public library first, then products by name.
+func (a *App) PortalCategories() ([]PortalCategory, error) {
+	counts, err := a.docManager.PortalArticleCounts()
+	if err != nil {
+		return nil, err
+	}
+	products, err := a.productService.List()
+	if err != nil {
+		return nil, err
+	}
+	allowed := a.portalProducts()
+	categories := []PortalCategory{}
+	if n := counts[""]; n > 0 {
+		categories = append(categories, PortalCategory{Name: "公共库", Articles: n})
+	}
+	for _, p := range products {
+		if n := counts[p.ID]; n > 0 && (allowed == nil || allowed[p.ID]) {
+			categories = append(categories, PortalCategory{ProductID: p.ID, Name: p.Name, Description: p.Description, Articles: n})
+		}
+	}
+	return categories, nil
 }
 
-// --- Pending Questions Interface ---
+// ListPortalArticles returns one page of a portal category's articles and
+// the total count.
+func (a *App) ListPortalArticles(productID string, page, pageSize int) ([]document.PortalArticle, int, error) {
+	if allowed := a.portalProducts(); allowed != nil && !allowed[productID] {
+		return []document.PortalArticle{}, 0, nil
+	}
+	return a.docManager.ListPortalArticles(productID, (page-1)*pageSize, pageSize)
+}
 
-// ListPendingQuestions returns pending questions filtered by status and productID.
-// Pass an empty string to list all questions.
-func (a *App) ListPendingQuestions(status string, productID string) ([]pending.PendingQuestion, error) {
-	return a.pendingManager.ListPending(status, productID)
+// GetPortalArticle returns a portal article with its full text.
+func (a *App) GetPortalArticle(docID string) (*document.PortalArticle, error) {
+	article, err := a.docManager.GetPortalArticle(docID)
+	if err != nil {
+		return nil, err
+	}
+	if allowed := a.portalProducts(); allowed != nil && !allowed[article.ProductID] {
+		return nil, fmt.Errorf("文章不存在")
+	}
+	return article, nil
 }
 
-// AnswerQuestion submits an admin answer to a pending question.
-func (a *App) AnswerQuestion(req pending.AdminAnswerRequest) error {
-	return a.pendingManager.AnswerQuestion(req)
+// SearchPortalArticles searches the portal articles, of one category when
+// productID is set ("" searches all categories; use the public library's
+// articles list to browse it).
+func (a *App) SearchPortalArticles(query, productID string, limit int) ([]document.PortalArticle, error) {
+	var ids []string
+	if productID != "" {
+		if allowed := a.portalProducts(); allowed != nil && !allowed[productID] {
+			return []document.PortalArticle{}, nil
+		}
+		ids = []string{productID}
+	} else if allowed := a.portalProducts(); allowed != nil {
+		ids = make([]string, 0, len(allowed))
+		for id := range allowed {
+			ids = append(ids, id)
+		}
+	}
+	return a.docManager.SearchPortalArticles(query, ids, limit)
 }
 
-// DeletePendingQuestion removes a pending question by ID.
-func (a *App) DeletePendingQuestion(id string) error {
-	return a.pendingManager.DeletePending(id)
+// RelatedPortalArticles returns the portal articles most similar to a portal
+// article, for its "see also" section.
+func (a *App) RelatedPortalArticles(docID string, limit int) ([]document.RelatedDocument, error) {
+	allowed := a.portalProducts()
+	if allowed == nil {
+		return a.docManager.RelatedPortalArticles(docID, nil, limit)
+	}
+	if _, err := a.GetPortalArticle(docID); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(allowed))
+	for id := range allowed {
+		ids = append(ids, id)
+	}
+	return a.docManager.RelatedPortalArticles(docID, ids, limit)
 }
 
-// CreatePendingQuestion creates a new pending question from a user who is not satisfied with the answer.
-func (a *App) CreatePendingQuestion(question, userID, imageData, productID string) (*pending.PendingQuestion, error) {
-	return a.pendingManager.CreatePending(question, userID, imageData, productID)
+// ListReviewers returns the admins that entries can be assigned to.
+func (a *App) ListReviewers() ([]Reviewer, error) {
+	var reviewers []Reviewer
+	if cfg := a.configManager.Get(); cfg != nil && cfg.Admin.Username != "" {
+		reviewers = append(reviewers, Reviewer{ID: "admin", Username: cfg.Admin.Username})
+	}
+	users, err := a.ListAdminUsers()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		reviewers = append(reviewers, Reviewer{ID: "admin_" + u.ID, Username: u.Username})
+	}
+	return reviewers, nil
+}
+
+// ApplyReviewAction applies action to each entry in ids on behalf of actor
+// (a session user ID with the given role) and reports the outcome per entry.
+// Submitting assigns reviewerID, who must not be the entry's author. Only
+// the assigned reviewer or a super admin may approve or reject, and nobody
+// may approve their own entry.
+func (a *App) ApplyReviewAction(ids []string, action, actor, role, reviewerID, note string) ([]ReviewResult, error) {
+	switch action {
+	case ReviewActionSubmit:
+		if r := a.GetAdminRole(reviewerID); r != "super_admin" && r != "editor" {
+			return nil, fmt.Errorf("审核人不存在")
+		}
+	case ReviewActionApprove, ReviewActionReject:
+	default:
+		return nil, fmt.Errorf("不支持的审核操作: %s", action)
+	}
+
+	results := make([]ReviewResult, 0, len(ids))
+	for _, id := range ids {
+		res := ReviewResult{ID: id}
+		if err := a.applyReviewAction(id, action, actor, role, reviewerID, note); err != nil {
+			res.Error = err.Error()
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func (a *App) applyReviewAction(id, action, actor, role, reviewerID, note string) error {
+	item, err := a.docManager.GetReviewItem(id)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case ReviewActionSubmit:
+		if reviewerID == item.Author {
+			return fmt.Errorf("审核人不能是作者本人")
+		}
+		return a.docManager.SubmitForReview(id, reviewerID)
+	case ReviewActionApprove:
+		if actor == item.Author {
+			return fmt.Errorf("不能审核通过自己提交的内容")
+		}
+		if actor != item.ReviewerID && role != "super_admin" {
+			return fmt.Errorf("只有指定的审核人可以审核")
+		}
+		return a.docManager.ApproveReview(id, actor, note)
+	default:
+		if actor != item.ReviewerID && role != "super_admin" {
+			return fmt.Errorf("只有指定的审核人可以审核")
+		}
+		return a.docManager.RejectReview(id, actor, note)
+	}
 }
 
 // --- Authentication Interface ---
@@ -215,6 +2176,98 @@ func (a *App) GetEnabledOAuthProviders() []string {
 	return enabled
 }
 
+// ExternalLoginInfo describes the external login shown on the login page.
+type ExternalLoginInfo struct {
+	Label string `json:"label"`
+}
+
+// GetExternalLogin returns the external login of the login page, or nil when
+// it is off.
+func (a *App) GetExternalLogin() *ExternalLoginInfo {
+	cfg := a.configManager.Get()
+	if cfg == nil || !cfg.ExternalAuth.Enabled || (a.authProvider == nil && cfg.ExternalAuth.VerifyURL == "") {
+		return nil
+	}
+	return &ExternalLoginInfo{Label: cfg.ExternalAuth.Label}
+}
+
+// SetAuthProvider makes external logins verify credentials with p instead
+// of the HTTP verifier of the external_auth config, which must still be
+// enabled. It lets embedding code plug in a login backend directly.
+func (a *App) SetAuthProvider(p auth.AuthProvider) {
+	a.authProvider = p
+}
+
+// externalUserID returns the user ID of an account of the external login
+// backend name. The "ext:" namespace keeps the IDs apart from those of OAuth
+// providers ("<provider>_<id>") and of built-in sessions such as
+// "admin_<id>" and "anonymous_viewer", whatever the backend is named and
+// whatever IDs it returns.
+func externalUserID(name, id string) string {
+	return "ext:" + name + ":" + id
+}
+
+// ExternalLogin signs a user in through the external login backend: the
+// credentials are verified by it, then the user is created or updated and
+// given a session the same way as after an OAuth login.
+func (a *App) ExternalLogin(credentials map[string]string, ip string) (*OAuthCallbackResponse, error) {
+	cfg := a.configManager.Get()
+	if a.GetExternalLogin() == nil {
+		return nil, fmt.Errorf("未启用外部账号登录")
+	}
+	provider := a.authProvider
+	if provider == nil {
+		provider = auth.NewHTTPAuthProvider(cfg.ExternalAuth)
+	}
+	name := cfg.ExternalAuth.EffectiveName()
+
+	// Rate limits and bans apply per account name when one is given
+	account := strings.TrimSpace(credentials["username"])
+	if account != "" {
+		account = name + ":" + account
+		if err := a.loginLimiter.CheckAllowed(account, ip); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := provider.Verify(credentials)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		if account != "" {
+			a.loginLimiter.RecordAttempt(account, ip, false)
+		}
+		return nil, fmt.Errorf("账号或密码错误")
+	}
+	if err != nil {
+		errlog.Logf("[ExternalAuth] verify via %s failed: %v", name, err)
+		return nil, fmt.Errorf("外部认证服务暂时不可用，请稍后重试")
+	}
+	if account != "" {
+		a.loginLimiter.RecordAttempt(account, ip, true)
+	}
+	user.Provider = name
+
+	// Upsert user into the users table; NULL keeps users without an email
+	// clear of the unique constraint on email
+	userID := externalUserID(name, user.ID)
+	_, err = a.db.Exec(
+		`INSERT INTO users (id, email, name, provider, provider_id, email_verified) VALUES (?, NULLIF(?, ''), ?, ?, ?, 1)
+		 ON CONFLICT(id) DO UPDATE SET name=excluded.name, email=excluded.email, last_login=CURRENT_TIMESTAMP`,
+		userID, user.Email, user.Name, name, user.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("upsert external user: %w", err)
+	}
+
+	session, err := a.sessionManager.CreateSession(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthCallbackResponse{
+		User:    user,
+		Session: session,
+	}, nil
+}
+
 // RefreshOAuthClient rebuilds the OAuthClient from the current config.
 // Called after OAuth provider settings are updated.
 func (a *App) RefreshOAuthClient() {
@@ -223,7 +2276,7 @@ func (a *App) RefreshOAuthClient() {
 		return
 	}
 	old := a.oauthClient
-	a.oauthClient = auth.NewOAuthClient(cfg.OAuth.Providers)
+	a.oauthClient = auth.NewOAuthClient(cfg.EffectiveOAuthProviders())
 	if old != nil {
 		old.Stop()
 	}
@@ -245,10 +2298,170 @@ func (a *App) DeleteOAuthProvider(provider string) error {
 	return nil
 }
 
+// SourceCredentialInfo is a source credential with its secrets masked.
+type SourceCredentialInfo struct {
+	Domain   string            `json:"domain"`
+	Headers  map[string]string `json:"headers"`
+	Cookies  string            `json:"cookies"`
+	Username string            `json:"username"`
+	Password string            `json:"password"`
+}
+
+// ListSourceCredentials returns the source credentials by domain, secrets
+// masked.
+func (a *App) ListSourceCredentials() []SourceCredentialInfo {
+	infos := []SourceCredentialInfo{}
+	cfg := a.configManager.Get()
+	if cfg == nil {
+		return infos
+	}
+	for domain, cred := range cfg.SourceCredentials {
+		info := SourceCredentialInfo{
+			Domain:   domain,
+			Headers:  make(map[string]string, len(cred.Headers)),
+			Cookies:  maskSecret(cred.Cookies),
+			Username: cred.Username,
+			Password: maskSecret(cred.Password),
+		}
+		for name, value := range cred.Headers {
+			info.Headers[name] = maskSecret(value)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Domain < infos[j].Domain })
+	return infos
+}
+
+// SetSourceCredential sets the credential used to fetch source URLs of a
+// domain. Masked secrets ("***") keep their saved value.
+func (a *App) SetSourceCredential(domain string, cred config.SourceCredential) error {
+	if cfg := a.configManager.Get(); cfg != nil {
+		if old, ok := cfg.SourceCredentials[strings.ToLower(strings.TrimSpace(domain))]; ok {
+			if cred.Cookies == "***" {
+				cred.Cookies = old.Cookies
+			}
+			if cred.Password == "***" {
+				cred.Password = old.Password
+			}
+			for name, value := range cred.Headers {
+				if value == "***" {
+					cred.Headers[name] = old.Headers[http.CanonicalHeaderKey(name)]
+				}
+			}
+		}
+	}
+	if err := a.configManager.SetSourceCredential(domain, cred); err != nil {
+		return err
+	}
+	a.docManager.SetSourceCredentials(a.configManager.Get().SourceCredentials)
+	return nil
+}
+
+// DeleteSourceCredential removes the credential of a domain.
+func (a *App) DeleteSourceCredential(domain string) error {
+	if err := a.configManager.DeleteSourceCredential(domain); err != nil {
+		return err
+	}
+	a.docManager.SetSourceCredentials(a.configManager.Get().SourceCredentials)
+	return nil
+}
+
+// LLMProfiles returns the LLM profiles, API keys masked, and the task routes.
+func (a *App) LLMProfiles() ([]config.LLMProfile, map[string]string) {
+	cfg := a.configManager.Get()
+	if cfg == nil {
+		return []config.LLMProfile{}, map[string]string{}
+	}
+	profiles := append([]config.LLMProfile{}, cfg.LLM.Profiles...)
+	for i := range profiles {
+		profiles[i].APIKey = maskSecret(profiles[i].APIKey)
+	}
+	routes := cfg.LLM.Routes
+	if routes == nil {
+		routes = map[string]string{}
+	}
+	return profiles, routes
+}
+
+// SetLLMProfile adds or replaces an LLM profile. A masked API key ("***")
+// keeps the saved one.
+func (a *App) SetLLMProfile(p config.LLMProfile) error {
+	if p.APIKey == "***" {
+		p.APIKey = ""
+		if old, ok := a.llmProfile(strings.ToLower(strings.TrimSpace(p.Name))); ok {
+			p.APIKey = old.APIKey
+		}
+	}
+	if err := a.configManager.SetLLMProfile(p); err != nil {
+		return err
+	}
+	a.refreshModelServices(a.configManager.Get())
+	return nil
+}
+
+// DeleteLLMProfile removes an LLM profile and the routes to it.
+func (a *App) DeleteLLMProfile(name string) error {
+	if _, ok := a.llmProfile(name); !ok {
+		return fmt.Errorf("LLM 配置不存在")
+	}
+	if err := a.configManager.DeleteLLMProfile(name); err != nil {
+		return err
+	}
+	a.refreshModelServices(a.configManager.Get())
+	return nil
+}
+
+// SetLLMRoutes sets which profile each task (see config.LLMTasks) tries first.
+func (a *App) SetLLMRoutes(routes map[string]string) error {
+	if err := a.configManager.SetLLMRoutes(routes); err != nil {
+		return err
+	}
+	a.refreshModelServices(a.configManager.Get())
+	return nil
+}
+
+// TestLLMProfile sends a short prompt to one LLM profile, without failover,
+// and returns its reply and how long it took in milliseconds. The name
+// config.DefaultLLMProfile tests the main endpoint.
+func (a *App) TestLLMProfile(name string) (string, int64, error) {
+	cfg := a.configManager.Get()
+	if cfg == nil {
+		return "", 0, fmt.Errorf("config not loaded")
+	}
+	var svc llm.Backend
+	if name == config.DefaultLLMProfile {
+		svc = llm.NewService(cfg.LLM.Provider, cfg.LLM.Endpoint, cfg.LLM.APIKey, cfg.LLM.ModelName, cfg.LLM.Temperature, cfg.LLM.MaxTokens)
+	} else {
+		p, ok := a.llmProfile(name)
+		if !ok {
+			return "", 0, fmt.Errorf("LLM 配置不存在")
+		}
+		svc = llm.NewProfileService(p, cfg.LLM.MaxTokens)
+	}
+	start := time.Now()
+	reply, err := svc.Generate("", nil, "请回复：OK")
+	return reply, time.Since(start).Milliseconds(), err
+}
+
+// llmProfile returns the saved LLM profile of a name.
+func (a *App) llmProfile(name string) (config.LLMProfile, bool) {
+	if cfg := a.configManager.Get(); cfg != nil {
+		for _, p := range cfg.LLM.Profiles {
+			if p.Name == name {
+				return p, true
+			}
+		}
+	}
+	return config.LLMProfile{}, false
+}
+
 // AdminLoginResponse contains the session created after admin login.
 type AdminLoginResponse struct {
 	Session *auth.Session `json:"session"`
 	Role    string        `json:"role,omitempty"`
+	// PasswordExpired is set when password.max_age_days has passed since the
+	// password was changed; the admin is asked to change it right away.
+	PasswordExpired bool `json:"password_expired,omitempty"`
 }
 
 // AdminUserInfo holds info about an admin sub-account.
@@ -284,8 +2497,8 @@ func (a *App) AdminSetup(username, password string) (*AdminLoginResponse, error)
 	if len(username) < 3 {
 		return nil, fmt.Errorf("用户名至少3位")
 	}
-	if msg := ValidatePassword(password); msg != "" {
-		return nil, errors.New(msg)
+	if err := a.checkPassword(password); err != nil {
+		return nil, err
 	}
 	if len(username) > 64 {
 		return nil, fmt.Errorf("用户名不能超过64位")
@@ -388,7 +2601,7 @@ func (a *App) AdminLogin(username, password, ip string) (*AdminLoginResponse, er
 	// Check super admin
 	if cfg.Admin.Username != "" && cfg.Admin.PasswordHash != "" && username == cfg.Admin.Username {
 		if err := auth.VerifyAdminPassword(password, cfg.Admin.PasswordHash); err != nil {
-			a.loginLimiter.RecordAttempt(username, ip, false)
+			a.recordAdminLoginFailure(username, ip)
 			log.Printf("[Auth] failed admin login attempt: username=%q ip=%s", username, ip)
 			return nil, fmt.Errorf("用户名或密码错误")
 		}
@@ -403,21 +2616,23 @@ func (a *App) AdminLogin(username, password, ip string) (*AdminLoginResponse, er
 		if err != nil {
 			return nil, err
 		}
-		return &AdminLoginResponse{Session: session, Role: "super_admin"}, nil
+		changedAt, _ := time.Parse(time.RFC3339, cfg.Admin.PasswordChangedAt)
+		return &AdminLoginResponse{Session: session, Role: "super_admin", PasswordExpired: cfg.Password.Expired(changedAt)}, nil
 	}
 
 	// Check admin sub-accounts
 	var id, passwordHash, role string
+	var changedAt, createdAt sql.NullTime
 	err := a.readDB.QueryRow(
-		`SELECT id, password_hash, role FROM admin_users WHERE username = ?`, username,
-	).Scan(&id, &passwordHash, &role)
+		`SELECT id, password_hash, role, password_changed_at, created_at FROM admin_users WHERE username = ?`, username,
+	).Scan(&id, &passwordHash, &role, &changedAt, &createdAt)
 	if err != nil {
-		a.loginLimiter.RecordAttempt(username, ip, false)
+		a.recordAdminLoginFailure(username, ip)
 		log.Printf("[Auth] failed sub-admin login attempt: username=%q ip=%s (user not found)", username, ip)
 		return nil, fmt.Errorf("用户名或密码错误")
 	}
 	if err := auth.VerifyAdminPassword(password, passwordHash); err != nil {
-		a.loginLimiter.RecordAttempt(username, ip, false)
+		a.recordAdminLoginFailure(username, ip)
 		log.Printf("[Auth] failed sub-admin login attempt: username=%q ip=%s (wrong password)", username, ip)
 		return nil, fmt.Errorf("用户名或密码错误")
 	}
@@ -434,9 +2649,71 @@ func (a *App) AdminLogin(username, password, ip string) (*AdminLoginResponse, er
 	_ = a.sessionManager.DeleteSessionsByUserID("admin_" + id)
 	session, err := a.sessionManager.CreateSession("admin_" + id)
 	if err != nil {
-		return nil, err
+		return nil, err
+	}
+	expired := cfg.Password.Expired(passwordChangedAt(changedAt, createdAt))
+	return &AdminLoginResponse{Session: session, Role: role, PasswordExpired: expired}, nil
+}
+
+// checkPassword checks a new password against the configured password policy.
+func (a *App) checkPassword(password string) error {
+	cfg := a.configManager.Get()
+	if cfg == nil {
+		return config.PasswordConfig{}.Check(password)
+	}
+	return cfg.Password.Check(password)
+}
+
+// passwordChangedAt returns when an account's password was last changed,
+// falling back to the account creation time for passwords set before
+// changes were recorded.
+func passwordChangedAt(changedAt, createdAt sql.NullTime) time.Time {
+	if changedAt.Valid {
+		return changedAt.Time
+	}
+	return createdAt.Time
+}
+
+// ChangeAdminPassword changes the password of the signed-in admin after
+// verifying the current one.
+func (a *App) ChangeAdminPassword(userID, currentPassword, newPassword string) error {
+	if currentPassword == "" || newPassword == "" {
+		return fmt.Errorf("当前密码和新密码不能为空")
+	}
+	if currentPassword == newPassword {
+		return fmt.Errorf("新密码不能与当前密码相同")
+	}
+	if userID == "admin" {
+		cfg := a.configManager.Get()
+		if cfg == nil {
+			return fmt.Errorf("系统配置未加载")
+		}
+		if err := auth.VerifyAdminPassword(currentPassword, cfg.Admin.PasswordHash); err != nil {
+			return fmt.Errorf("当前密码错误")
+		}
+		// admin.password checks the policy, hashes and records the change time
+		return a.configManager.Update(map[string]interface{}{"admin.password": newPassword})
+	}
+	id := strings.TrimPrefix(userID, "admin_")
+	if id == userID {
+		return fmt.Errorf("当前账号不支持修改密码")
+	}
+	var passwordHash string
+	if err := a.readDB.QueryRow(`SELECT password_hash FROM admin_users WHERE id = ?`, id).Scan(&passwordHash); err != nil {
+		return fmt.Errorf("账号不存在")
+	}
+	if err := auth.VerifyAdminPassword(currentPassword, passwordHash); err != nil {
+		return fmt.Errorf("当前密码错误")
+	}
+	if err := a.checkPassword(newPassword); err != nil {
+		return err
+	}
+	hash, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return err
 	}
-	return &AdminLoginResponse{Session: session, Role: role}, nil
+	_, err = a.db.Exec(`UPDATE admin_users SET password_hash = ?, password_changed_at = ? WHERE id = ?`, hash, time.Now().UTC(), id)
+	return err
 }
 
 // AnonymousLogin creates a read-only admin session when anonymous mode is enabled.
@@ -539,8 +2816,8 @@ func (a *App) Register(req RegisterRequest, baseURL string) error {
 	if !strings.Contains(email, "@") || !strings.Contains(email, ".") || len(email) > 254 {
 		return fmt.Errorf("邮箱格式不正确")
 	}
-	if msg := ValidatePassword(password); msg != "" {
-		return errors.New(msg)
+	if err := a.checkPassword(password); err != nil {
+		return err
 	}
 	if len(name) > 200 {
 		return fmt.Errorf("名称过长")
@@ -573,8 +2850,8 @@ func (a *App) Register(req RegisterRequest, baseURL string) error {
 
 	// Insert user (unverified)
 	_, err = a.db.Exec(
-		`INSERT INTO users (id, email, name, provider, provider_id, password_hash, email_verified) VALUES (?, ?, ?, ?, ?, ?, 0)`,
-		userID, email, name, "local", email, hash,
+		`INSERT INTO users (id, email, name, provider, provider_id, password_hash, email_verified, password_changed_at) VALUES (?, ?, ?, ?, ?, ?, 0, ?)`,
+		userID, email, name, "local", email, hash, time.Now().UTC(),
 	)
 	if err != nil {
 		return fmt.Errorf("创建用户失败: %w", err)
@@ -723,8 +3000,8 @@ func (a *App) ResetPassword(token, newPassword string) error {
 	if token == "" {
 		return fmt.Errorf("无效的重置链接")
 	}
-	if msg := ValidatePassword(newPassword); msg != "" {
-		return errors.New(msg)
+	if err := a.checkPassword(newPassword); err != nil {
+		return err
 	}
 
 	var userID, expiresAtStr string
@@ -752,7 +3029,7 @@ func (a *App) ResetPassword(token, newPassword string) error {
 		return fmt.Errorf("密码加密失败: %w", err)
 	}
 
-	_, err = a.db.Exec(`UPDATE users SET password_hash = ?, email_verified = 1 WHERE id = ?`, hash, userID)
+	_, err = a.db.Exec(`UPDATE users SET password_hash = ?, email_verified = 1, password_changed_at = ? WHERE id = ?`, hash, time.Now().UTC(), userID)
 	if err != nil {
 		return fmt.Errorf("更新密码失败: %w", err)
 	}
@@ -760,6 +3037,7 @@ func (a *App) ResetPassword(token, newPassword string) error {
 	// Delete all password reset tokens for this user and invalidate all sessions
 	a.db.Exec(`DELETE FROM email_tokens WHERE user_id = ? AND type = 'password_reset'`, userID)
 	_ = a.sessionManager.DeleteSessionsByUserID(userID)
+	_ = a.opTokens.RevokeUser(userID)
 
 	return nil
 }
@@ -794,11 +3072,12 @@ func (a *App) UserLogin(email, password, ip string) (*UserLoginResponse, error)
 
 	var userID, name, passwordHash, provider string
 	var emailVerified int
+	var changedAt, createdAt sql.NullTime
 	err := a.readDB.QueryRow(
-		`SELECT id, name, password_hash, email_verified, provider FROM users
+		`SELECT id, name, password_hash, email_verified, provider, password_changed_at, created_at FROM users
 		 WHERE email = ? AND password_hash IS NOT NULL AND password_hash != ''`,
 		email,
-	).Scan(&userID, &name, &passwordHash, &emailVerified, &provider)
+	).Scan(&userID, &name, &passwordHash, &emailVerified, &provider, &changedAt, &createdAt)
 	if err == sql.ErrNoRows {
 		a.loginLimiter.RecordAttempt(email, ip, false)
 		return nil, fmt.Errorf("邮箱或密码错误")
@@ -819,6 +3098,11 @@ func (a *App) UserLogin(email, password, ip string) (*UserLoginResponse, error)
 
 	a.loginLimiter.RecordAttempt(email, ip, true)
 
+	// Users change an expired password through the password reset email
+	if cfg := a.configManager.Get(); cfg != nil && cfg.Password.Expired(passwordChangedAt(changedAt, createdAt)) {
+		return nil, fmt.Errorf("密码已过期，请通过“忘记密码”重新设置")
+	}
+
 	// Update last login
 	a.db.Exec(`UPDATE users SET last_login = ? WHERE id = ?`, time.Now().UTC().Format(time.RFC3339), userID)
 
@@ -954,18 +3238,35 @@ func (a *App) TestEmail(toEmail string) error {
 // --- Configuration Interface ---
 
 // MaskedConfig is a copy of Config with API keys replaced by "***".
+
 type MaskedConfig struct {
-	Server       config.ServerConfig    `json:"server"`
-	LLM          config.LLMConfig       `json:"llm"`
-	Embedding    config.EmbeddingConfig `json:"embedding"`
-	Vector       config.VectorConfig    `json:"vector"`
-	OAuth        MaskedOAuthConfig      `json:"oauth"`
-	Admin        config.AdminConfig     `json:"admin"`
-	SMTP         config.SMTPConfig      `json:"smtp"`
-	ProductIntro string                 `json:"product_intro"`
-	ProductName  string                 `json:"product_name"`
-	Video        config.VideoConfig     `json:"video"`
-	AuthServer   string                 `json:"auth_server"`
+	Server        config.ServerConfig        `json:"server"`
+	LLM           config.LLMConfig           `json:"llm"`
+	Embedding     config.EmbeddingConfig     `json:"embedding"`
+	Vector        config.VectorConfig        `json:"vector"`
+	OAuth         MaskedOAuthConfig          `json:"oauth"`
+	Admin         config.AdminConfig         `json:"admin"`
+	SMTP          config.SMTPConfig          `json:"smtp"`
+	ProductIntro  string                     `json:"product_intro"`
+	ProductName   string                     `json:"product_name"`
+	Video         config.VideoConfig         `json:"video"`
+	Verify        config.VerifyConfig        `json:"verify"`
+	Review        config.ReviewConfig        `json:"review"`
+	Portal        config.PortalConfig        `json:"portal"`
+	HTML          config.HTMLConfig          `json:"html"`
+	EmailIngest   config.EmailIngestConfig   `json:"email_ingest"`
+	Tagging       config.TaggingConfig       `json:"tagging"`
+	Audit         config.AuditConfig         `json:"audit"`
+	Rerank        config.RerankConfig        `json:"rerank"`
+	Backup        config.BackupConfig        `json:"backup"`
+	Password      config.PasswordConfig      `json:"password"`
+	Session       config.SessionConfig       `json:"session"`
+	Notifications config.NotificationsConfig `json:"notifications"`
+	SmallTalk     config.SmallTalkConfig     `json:"small_talk"`
+	Export        config.ExportConfig        `json:"export"`
+	Budget        config.BudgetConfig        `json:"budget"`
+	ExternalAuth  config.ExternalAuthConfig  `json:"external_auth"`
+	AuthServer    string                     `json:"auth_server"`
 }
 
 // MaskedOAuthConfig holds OAuth config with secrets masked.
@@ -983,6 +3284,123 @@ type MaskedOAuthProvider struct {
 	Scopes       []string `json:"scopes"`
 }
 
+// MaintenanceStatus returns the database maintenance schedule and recent runs.
+func (a *App) MaintenanceStatus() (*maintenance.Status, error) {
+	return a.maintenance.Status(20)
+}
+
+// StartMaintenance starts a manual database maintenance run in the background.
+func (a *App) StartMaintenance() error {
+	return a.maintenance.RunAsync(maintenance.TriggerManual)
+}
+
+// ExportStatus returns the analytics export settings, with the webhook
+// masked, and recent runs.
+func (a *App) ExportStatus() (*export.Status, error) {
+	st, err := a.exporter.Status(20)
+	if err != nil {
+		return nil, err
+	}
+	st.Config.WebhookURL = maskSecret(st.Config.WebhookURL)
+	st.Config.WebhookSecret = maskSecret(st.Config.WebhookSecret)
+	return st, nil
+}
+
+// StartExport starts a manual analytics export in the background.
+func (a *App) StartExport() error {
+	return a.exporter.RunAsync(export.TriggerManual)
+}
+
+// BackupHistory returns whether an online backup is running and the recent
+// online backups.
+func (a *App) BackupHistory() (bool, []backup.Record, error) {
+	records, err := a.backups.History(20)
+	return a.backups.Running(), records, err
+}
+
+// SaveBackup makes an online backup in the data directory's backups folder.
+func (a *App) SaveBackup(mode, createdBy string) (*backup.Record, error) {
+	return a.backups.Save(mode, createdBy)
+}
+
+// StreamBackup writes an online backup archive to w.
+func (a *App) StreamBackup(w io.Writer, mode, createdBy string) (*backup.Record, error) {
+	return a.backups.Stream(w, mode, createdBy)
+}
+
+// ListJobs returns the background jobs matching f, newest first, with their
+// total count.
+func (a *App) ListJobs(f jobs.ListFilter) ([]jobs.Job, int, error) {
+	return a.jobs.List(f)
+}
+
+// JobCounts returns the number of queued and running background jobs.
+func (a *App) JobCounts() (queued, running int) {
+	return a.jobs.Counts()
+}
+
+// CancelJob cancels a queued or running background job.
+func (a *App) CancelJob(id string) error {
+	return a.jobs.Cancel(id)
+}
+
+// TrackJob records work that runs outside the job pool in the job list.
+// cancel is called when an admin cancels the job.
+func (a *App) TrackJob(typ, target, label string, cancel func() error) *jobs.Tracker {
+	return a.jobs.Track(typ, target, label, cancel)
+}
+
+// PublicBaseURL returns the base URL users reach the service at: the
+// configured external base URL, or one derived from the request.
+func (a *App) PublicBaseURL(r *http.Request) string {
+	if base := a.externalBaseURL(); base != "" {
+		return base
+	}
+	return GetBaseURL(r)
+}
+
+// externalBaseURL returns the configured external base URL, or "".
+func (a *App) externalBaseURL() string {
+	cfg := a.configManager.Get()
+	if cfg == nil {
+		return ""
+	}
+	return cfg.Server.ExternalBaseURL
+}
+
+// ExternalOrigin returns the scheme://host of the configured external base
+// URL, or "" when none is set. Browsers send it as the Origin header.
+func (a *App) ExternalOrigin() string {
+	base := a.externalBaseURL()
+	if base == "" {
+		return ""
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// BasePath returns the path prefix of the configured external base URL
+// (e.g. "/askflow"), or "" when the service is served at the root.
+func (a *App) BasePath() string {
+	base := a.externalBaseURL()
+	if base == "" {
+		return ""
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(u.Path, "/")
+}
+
+// IsReadOnly reports whether the instance runs in read-only demo mode.
+func (a *App) IsReadOnly() bool {
+	return a.configManager.IsReadOnly()
+}
+
 // GetConfig returns the current configuration with API keys masked.
 func (a *App) GetConfig() *MaskedConfig {
 	cfg := a.configManager.Get()
@@ -991,21 +3409,42 @@ func (a *App) GetConfig() *MaskedConfig {
 	}
 
 	masked := &MaskedConfig{
-		Server:       cfg.Server,
-		LLM:          cfg.LLM,
-		Embedding:    cfg.Embedding,
-		Vector:       cfg.Vector,
-		Admin:        cfg.Admin,
-		SMTP:         cfg.SMTP,
-		ProductIntro: cfg.ProductIntro,
-		ProductName:  cfg.ProductName,
-		Video:        cfg.Video,
-		AuthServer:   cfg.AuthServer,
+		Server:        cfg.Server,
+		LLM:           cfg.LLM,
+		Embedding:     cfg.Embedding,
+		Vector:        cfg.Vector,
+		Admin:         cfg.Admin,
+		SMTP:          cfg.SMTP,
+		ProductIntro:  cfg.ProductIntro,
+		ProductName:   cfg.ProductName,
+		Video:         cfg.Video,
+		Verify:        cfg.Verify,
+		Review:        cfg.Review,
+		Portal:        cfg.Portal,
+		HTML:          cfg.HTML,
+		EmailIngest:   cfg.EmailIngest,
+		Tagging:       cfg.Tagging,
+		Audit:         cfg.Audit,
+		Rerank:        cfg.Rerank,
+		Backup:        cfg.Backup,
+		Password:      cfg.Password,
+		Session:       cfg.Session,
+		Notifications: cfg.Notifications,
+		SmallTalk:     cfg.SmallTalk,
+		Export:        cfg.Export,
+		Budget:        cfg.Budget,
+		ExternalAuth:  cfg.ExternalAuth,
+		AuthServer:    cfg.AuthServer,
 	}
 
 	// Mask API keys
 	masked.LLM.APIKey = maskSecret(cfg.LLM.APIKey)
+	for i := range masked.LLM.Profiles {
+		masked.LLM.Profiles[i].APIKey = maskSecret(masked.LLM.Profiles[i].APIKey)
+	}
 	masked.Embedding.APIKey = maskSecret(cfg.Embedding.APIKey)
+	masked.Rerank.APIKey = maskSecret(cfg.Rerank.APIKey)
+	masked.Vector.Qdrant.APIKey = maskSecret(cfg.Vector.Qdrant.APIKey)
 
 	// Mask OAuth secrets
 	masked.OAuth.Providers = make(map[string]MaskedOAuthProvider, len(cfg.OAuth.Providers))
@@ -1025,10 +3464,58 @@ func (a *App) GetConfig() *MaskedConfig {
 
 	// Mask SMTP password
 	masked.SMTP.Password = maskSecret(cfg.SMTP.Password)
+	masked.EmailIngest.Token = maskSecret(cfg.EmailIngest.Token)
+	masked.Backup.S3.SecretKey = maskSecret(cfg.Backup.S3.SecretKey)
+	for _, name := range config.NotifyChannels {
+		ch := masked.Notifications.Channel(name)
+		ch.WebhookURL = maskSecret(ch.WebhookURL)
+		ch.Secret = maskSecret(ch.Secret)
+	}
+	// Each admin manages their own notification preferences
+	masked.Notifications.Admins = nil
+	masked.Export.WebhookURL = maskSecret(cfg.Export.WebhookURL)
+	masked.Export.WebhookSecret = maskSecret(cfg.Export.WebhookSecret)
+	masked.ExternalAuth.Secret = maskSecret(cfg.ExternalAuth.Secret)
 
 	return masked
 }
 
+// PinModelServices makes the app keep using es and ls when the configuration
+// changes, instead of building API clients from the new settings. The
+// service package's testing mode pins its fake models this way.
+func (a *App) PinModelServices(es embedding.EmbeddingService, ls llm.LLMService) {
+	a.pinnedEmbedding = es
+	a.pinnedLLM = ls
+}
+
+// SetBudget sets the meter model calls are counted with and alerts admins
+// through the team chat channels when spend nears a cap.
+func (a *App) SetBudget(m *budget.Meter) {
+	a.budget = m
+	m.OnAlert(a.notifyBudgetAlert)
+}
+
+// modelServices returns the embedding and LLM services for cfg, metered
+// against the budget caps.
+func (a *App) modelServices(cfg *config.Config) (embedding.EmbeddingService, llm.LLMService) {
+	if a.pinnedEmbedding != nil && a.pinnedLLM != nil {
+		return a.budget.WrapEmbedding(a.pinnedEmbedding), a.budget.WrapLLM(a.pinnedLLM)
+	}
+	es := embedding.NewAPIEmbeddingService(cfg.Embedding.Endpoint, cfg.Embedding.APIKey, cfg.Embedding.ModelName, cfg.Embedding.UseMultimodal)
+	ls := llm.NewRouter(cfg.LLM)
+	return a.budget.WrapEmbedding(es), a.budget.WrapLLM(ls)
+}
+
+// refreshModelServices rebuilds the model services from cfg and hands them
+// to the components that call models.
+func (a *App) refreshModelServices(cfg *config.Config) {
+	es, ls := a.modelServices(cfg)
+	a.queryEngine.UpdateServices(es, ls, cfg)
+	a.docManager.UpdateEmbeddingService(es)
+	a.docManager.SetLLMService(ls)
+	a.pendingManager.UpdateServices(es, ls)
+}
+
 // UpdateConfig applies partial configuration updates.
 func (a *App) UpdateConfig(updates map[string]interface{}) error {
 	if err := a.configManager.Update(updates); err != nil {
@@ -1039,11 +3526,7 @@ func (a *App) UpdateConfig(updates map[string]interface{}) error {
 	if cfg == nil {
 		return fmt.Errorf("config not loaded after update")
 	}
-	es := embedding.NewAPIEmbeddingService(cfg.Embedding.Endpoint, cfg.Embedding.APIKey, cfg.Embedding.ModelName, cfg.Embedding.UseMultimodal)
-	ls := llm.NewAPILLMService(cfg.LLM.Endpoint, cfg.LLM.APIKey, cfg.LLM.ModelName, cfg.LLM.Temperature, cfg.LLM.MaxTokens)
-	a.queryEngine.UpdateServices(es, ls, cfg)
-	a.docManager.UpdateEmbeddingService(es)
-	a.pendingManager.UpdateServices(es, ls)
+	a.refreshModelServices(cfg)
 
 	// Propagate video config to DocumentManager if any video settings changed
 	for key := range updates {
@@ -1053,9 +3536,34 @@ func (a *App) UpdateConfig(updates map[string]interface{}) error {
 		}
 	}
 
-	// Refresh OAuth client if any OAuth settings changed
 	for key := range updates {
-		if strings.HasPrefix(key, "oauth.") {
+		if strings.HasPrefix(key, "scan.") {
+			a.docManager.SetScanConfig(cfg.Scan)
+			break
+		}
+	}
+
+	for key := range updates {
+		if strings.HasPrefix(key, "html.") {
+			a.docManager.SetHTMLConfig(cfg.HTML)
+			break
+		}
+	}
+
+	if _, ok := updates["vector.translate_languages"]; ok {
+		a.docManager.SetTranslateLanguages(cfg.Vector.TranslateLanguages)
+	}
+	if _, ok := updates["tagging.enabled"]; ok {
+		a.docManager.SetTaggingEnabled(cfg.Tagging.Enabled)
+	}
+	if _, ok := updates["jobs.concurrency"]; ok {
+		a.jobs.SetConcurrency(cfg.Jobs.Concurrency)
+	}
+	a.docManager.SetImportPrices(cfg.Embedding.PricePerMTokens, cfg.LLM.PricePerMTokens)
+
+	// Refresh OAuth client if any OAuth settings or the base URL changed
+	for key := range updates {
+		if strings.HasPrefix(key, "oauth.") || key == "server.external_base_url" {
 			a.RefreshOAuthClient()
 			break
 		}
@@ -1085,8 +3593,8 @@ func (a *App) CreateAdminUser(username, password, role string, permissions []str
 	if len(username) > 64 {
 		return nil, fmt.Errorf("用户名不能超过64位")
 	}
-	if msg := ValidatePassword(password); msg != "" {
-		return nil, errors.New(msg)
+	if err := a.checkPassword(password); err != nil {
+		return nil, err
 	}
 	if role != "editor" && role != "super_admin" {
 		role = "editor"
@@ -1125,8 +3633,8 @@ func (a *App) CreateAdminUser(username, password, role string, permissions []str
 	permsStr := strings.Join(filteredPerms, ",")
 
 	_, err = a.db.Exec(
-		`INSERT INTO admin_users (id, username, password_hash, role, permissions) VALUES (?, ?, ?, ?, ?)`,
-		id, username, hash, role, permsStr,
+		`INSERT INTO admin_users (id, username, password_hash, role, permissions, password_changed_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		id, username, hash, role, permsStr, time.Now().UTC(),
 	)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE") {
@@ -1195,13 +3703,59 @@ func (a *App) ListAdminUsers() ([]AdminUserInfo, error) {
 func (a *App) DeleteAdminUser(id string) error {
 	// Clean up sessions for this admin user
 	_, _ = a.db.Exec(`DELETE FROM sessions WHERE user_id = ?`, "admin_"+id)
+	_ = a.opTokens.RevokeUser("admin_" + id)
 	// Clean up product assignments
 	_, _ = a.db.Exec(`DELETE FROM admin_user_products WHERE admin_user_id = ?`, id)
+	// Clean up notification preferences
+	_ = a.configManager.DeleteAdminNotifyPrefs("admin_" + id)
 	// Delete the admin user record
 	_, err := a.db.Exec(`DELETE FROM admin_users WHERE id = ?`, id)
 	return err
 }
 
+// --- API Keys ---
+
+// CreateAPIKey creates an API key valid for ttlDays days (0 for no expiry)
+// and returns its secret, which is not stored.
+func (a *App) CreateAPIKey(name string, scopes []string, ttlDays int, createdBy string) (string, *apikey.Key, error) {
+	if ttlDays < 0 {
+		return "", nil, fmt.Errorf("有效期无效")
+	}
+	secret, key, err := a.apiKeys.Create(name, scopes, createdBy, time.Duration(ttlDays)*24*time.Hour)
+	if err != nil {
+		return "", nil, err
+	}
+	// Requests made with the key act as this user; the record satisfies
+	// foreign keys of query logs, documents and answers
+	uid := apikey.UserID(key.ID)
+	if _, err := a.db.Exec(
+		`INSERT OR IGNORE INTO users (id, email, name, provider, provider_id) VALUES (?, ?, ?, ?, ?)`,
+		uid, uid+"@internal", key.Name, "apikey", key.ID,
+	); err != nil {
+		if delErr := a.apiKeys.Delete(key.ID); delErr != nil {
+			log.Printf("[APIKey] failed to roll back key %s: %v", key.ID, delErr)
+		}
+		return "", nil, fmt.Errorf("failed to create API key user: %w", err)
+	}
+	return secret, key, nil
+}
+
+// ListAPIKeys returns all API keys without their secrets.
+func (a *App) ListAPIKeys() ([]apikey.Key, error) {
+	return a.apiKeys.List()
+}
+
+// DeleteAPIKey revokes an API key and removes the user record it acted as.
+func (a *App) DeleteAPIKey(id string) error {
+	if err := a.apiKeys.Delete(id); err != nil {
+		return err
+	}
+	if _, err := a.db.Exec(`DELETE FROM users WHERE id = ?`, apikey.UserID(id)); err != nil {
+		log.Printf("[APIKey] failed to remove user of key %s: %v", id, err)
+	}
+	return nil
+}
+
 // --- Knowledge Entry (直接录入图文) ---
 
 // KnowledgeEntryRequest represents a direct knowledge entry from admin.
@@ -1211,26 +3765,207 @@ type KnowledgeEntryRequest struct {
 	ImageURLs []string `json:"image_urls,omitempty"`
 	VideoURLs []string `json:"video_urls,omitempty"`
 	ProductID string   `json:"product_id"`
+	// Format is "markdown" when Content may embed images and videos inline
+	// as ![说明](/api/images/...); empty means plain text.
+	Format string `json:"format,omitempty"`
+	// Optional publish schedule, see document.NormalizeSchedule. On update
+	// a nil time is left unchanged and "" clears it.
+	PublishAt   *string `json:"publish_at,omitempty"`
+	UnpublishAt *string `json:"unpublish_at,omitempty"`
+}
+
+// knowledgeImage is an image attached to a knowledge entry together with the
+// text its chunk is embedded from.
+type knowledgeImage struct {
+	url     string
+	context string // surrounding text for inline images; empty for attachments
 }
 
 // AddKnowledgeEntry stores a text+image knowledge entry into the vector store.
-func (a *App) AddKnowledgeEntry(req KnowledgeEntryRequest) error {
-	title := strings.TrimSpace(req.Title)
-	content := strings.TrimSpace(req.Content)
-	if title == "" || content == "" {
-		return fmt.Errorf("标题和内容不能为空")
+// Markdown entries keep each inline image next to the text around it: the
+// image chunk is embedded from that text instead of the whole entry, so
+// questions about "the figure below" retrieve the right picture. It returns
+// the review state the entry starts in: a draft when review is required.
+func (a *App) AddKnowledgeEntry(req KnowledgeEntryRequest, author string) (string, error) {
+	reviewStatus := a.initialReviewStatus()
+	if _, err := a.addKnowledgeEntry(req, author, reviewStatus); err != nil {
+		return "", err
+	}
+	return reviewStatus, nil
+}
+
+// addKnowledgeEntry stores a knowledge entry in the given review state and
+// returns its document ID.
+func (a *App) addKnowledgeEntry(req KnowledgeEntryRequest, author, reviewStatus string) (string, error) {
+	req, videos, err := normalizeKnowledgeEntry(req)
+	if err != nil {
+		return "", err
+	}
+	if err := a.checkProductOpen(req.ProductID); err != nil {
+		return "", err
+	}
+	publishAt, unpublishAt, err := knowledgeSchedule(req, "", "")
+	if err != nil {
+		return "", err
 	}
-	if len(title) > 500 {
-		return fmt.Errorf("标题过长（最多500字符）")
+	scheduledBy := author
+	if publishAt == "" && unpublishAt == "" {
+		scheduledBy = ""
 	}
-	if len(content) > 100000 {
-		return fmt.Errorf("内容过长（最多100000字符）")
+
+	docID, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	docName := document.KnowledgeDocumentName(req.Title)
+
+	// Insert document record
+	_, err = a.db.Exec(
+		`INSERT INTO documents (id, name, type, status, product_id, created_at, review_status, review_author, video_urls,
+			publish_at, unpublish_at, scheduled_by, schedule_state) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		docID, docName, "knowledge", "success", req.ProductID, time.Now().UTC(), reviewStatus, author, document.EncodeVideoURLs(videos),
+		publishAt, unpublishAt, scheduledBy, document.ScheduleState(publishAt, unpublishAt, time.Now()),
+	)
+	if err != nil {
+		return "", fmt.Errorf("创建文档记录失败: %w", err)
+	}
+	if err := a.docManager.AddImageRefs(docID, req.ImageURLs); err != nil {
+		log.Printf("Warning: failed to record image refs for doc=%s: %v", docID, err)
+	}
+	if err := a.docManager.SaveKnowledgeSource(docID, req.Content, req.Format == "markdown"); err != nil {
+		log.Printf("Warning: failed to save knowledge source for doc=%s: %v", docID, err)
+	}
+	if err := a.storeKnowledgeContent(docID, docName, req); err != nil {
+		return "", err
+	}
+	if _, err := a.docManager.DetectLanguage(docID); err != nil {
+		log.Printf("Warning: failed to detect language of doc=%s: %v", docID, err)
+	}
+	a.docManager.TagDocumentAsync(docID)
+	return docID, nil
+}
+
+// UpdateKnowledgeEntry replaces the title, text and media of a knowledge
+// entry; its product cannot change. Only the chunks whose text changed are
+// embedded again. When review is required the edited entry goes back to
+// draft. A changed schedule makes editor its owner. It returns the review
+// state the entry is in after the edit.
+func (a *App) UpdateKnowledgeEntry(docID string, req KnowledgeEntryRequest, editor string) (string, error) {
+	cur, err := a.docManager.GetKnowledgeEntry(docID)
+	if err != nil {
+		return "", err
+	}
+	req.ProductID = cur.ProductID
+	req, videos, err := normalizeKnowledgeEntry(req)
+	if err != nil {
+		return "", err
+	}
+	if err := a.checkProductOpen(req.ProductID); err != nil {
+		return "", err
+	}
+	publishAt, unpublishAt, err := knowledgeSchedule(req, cur.PublishAt, cur.UnpublishAt)
+	if err != nil {
+		return "", err
+	}
+	err = a.docManager.ReplaceKnowledgeEntry(docID, req.Title, req.Content, req.Format == "markdown", func(stagedID, docName string) error {
+		if err := a.docManager.AddImageRefs(stagedID, req.ImageURLs); err != nil {
+			log.Printf("Warning: failed to record image refs for doc=%s: %v", stagedID, err)
+		}
+		return a.storeKnowledgeContent(stagedID, docName, req)
+	})
+	if err != nil {
+		return "", err
+	}
+	if _, err := a.docManager.DetectLanguage(docID); err != nil {
+		log.Printf("Warning: failed to detect language of doc=%s: %v", docID, err)
+	}
+	reviewStatus := cur.ReviewStatus
+	if initial := a.initialReviewStatus(); initial != "" {
+		reviewStatus = initial
+	}
+	if _, err := a.db.Exec(`UPDATE documents SET video_urls = ?, review_status = ? WHERE id = ?`,
+		document.EncodeVideoURLs(videos), reviewStatus, docID); err != nil {
+		return "", fmt.Errorf("更新文档记录失败: %w", err)
+	}
+	if publishAt != cur.PublishAt || unpublishAt != cur.UnpublishAt {
+		if _, err := a.docManager.SetSchedule(docID, publishAt, unpublishAt, editor); err != nil {
+			return "", err
+		}
+	}
+	return reviewStatus, nil
+}
+
+// knowledgeSchedule returns the normalized publish schedule of a knowledge
+// entry request, taking the current times for the ones it leaves nil.
+func knowledgeSchedule(req KnowledgeEntryRequest, publishAt, unpublishAt string) (string, string, error) {
+	if req.PublishAt != nil {
+		publishAt = *req.PublishAt
+	}
+	if req.UnpublishAt != nil {
+		unpublishAt = *req.UnpublishAt
+	}
+	return document.NormalizeSchedule(publishAt, unpublishAt)
+}
+
+// ListKnowledgeEntries returns the knowledge entries of a product and the
+// public ones, or all of them when productID is empty.
+func (a *App) ListKnowledgeEntries(productID string) ([]document.KnowledgeEntry, error) {
+	return a.docManager.ListKnowledgeEntries(productID)
+}
+
+// GetKnowledgeEntry returns a knowledge entry with its full text for editing.
+func (a *App) GetKnowledgeEntry(docID string) (*document.KnowledgeEntry, error) {
+	return a.docManager.GetKnowledgeEntry(docID)
+}
+
+// DeleteKnowledgeEntry deletes a knowledge entry. Other documents are
+// reported as not found.
+func (a *App) DeleteKnowledgeEntry(docID string) error {
+	if _, err := a.docManager.GetKnowledgeEntry(docID); err != nil {
+		return err
+	}
+	return a.docManager.DeleteDocument(docID)
+}
+
+// normalizeKnowledgeEntry validates a knowledge entry and trims its title and
+// content. The media placed inline in markdown are added to ImageURLs and
+// VideoURLs; the videos attached besides them are returned.
+func normalizeKnowledgeEntry(req KnowledgeEntryRequest) (KnowledgeEntryRequest, []string, error) {
+	req.Title = strings.TrimSpace(req.Title)
+	req.Content = strings.TrimSpace(req.Content)
+	if req.Title == "" || req.Content == "" {
+		return req, nil, fmt.Errorf("标题和内容不能为空")
+	}
+	if req.Format != "" && req.Format != "markdown" {
+		return req, nil, fmt.Errorf("不支持的内容格式: %s", req.Format)
+	}
+	var attached []string
+	for _, vidURL := range req.VideoURLs {
+		if vidURL = strings.TrimSpace(vidURL); vidURL != "" {
+			attached = appendUnique(attached, vidURL)
+		}
+	}
+	if req.Format == "markdown" {
+		// Inline media count towards the limits and are validated like attachments
+		for _, ref := range chunker.MediaRefs(req.Content) {
+			if ref.Kind == chunker.MediaKindVideo {
+				req.VideoURLs = appendUnique(req.VideoURLs, ref.URL)
+			} else {
+				req.ImageURLs = appendUnique(req.ImageURLs, ref.URL)
+			}
+		}
+	}
+	if len(req.Title) > 500 {
+		return req, nil, fmt.Errorf("标题过长（最多500字符）")
+	}
+	if len(req.Content) > 100000 {
+		return req, nil, fmt.Errorf("内容过长（最多100000字符）")
 	}
 	if len(req.ImageURLs) > 50 {
-		return fmt.Errorf("图片数量过多（最多50张）")
+		return req, nil, fmt.Errorf("图片数量过多（最多50张）")
 	}
 	if len(req.VideoURLs) > 10 {
-		return fmt.Errorf("视频数量过多（最多10个）")
+		return req, nil, fmt.Errorf("视频数量过多（最多10个）")
 	}
 
 	// Validate image URLs (must be local paths or HTTPS)
@@ -1240,7 +3975,7 @@ func (a *App) AddKnowledgeEntry(req KnowledgeEntryRequest) error {
 			continue
 		}
 		if !strings.HasPrefix(imgURL, "/api/") && !strings.HasPrefix(imgURL, "data:image/") {
-			return fmt.Errorf("图片URL格式不正确")
+			return req, nil, fmt.Errorf("图片URL格式不正确")
 		}
 	}
 	// Validate video URLs (must be local paths)
@@ -1250,82 +3985,107 @@ func (a *App) AddKnowledgeEntry(req KnowledgeEntryRequest) error {
 			continue
 		}
 		if !strings.HasPrefix(vidURL, "/api/") {
-			return fmt.Errorf("视频URL格式不正确")
+			return req, nil, fmt.Errorf("视频URL格式不正确")
 		}
 	}
+	return req, attached, nil
+}
 
-	docID, err := generateToken()
-	if err != nil {
-		return err
-	}
-	docName := "知识录入: " + title
-
-	// Insert document record
-	_, err = a.db.Exec(
-		`INSERT INTO documents (id, name, type, status, product_id, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
-		docID, docName, "knowledge", "success", req.ProductID, time.Now().UTC(),
-	)
-	if err != nil {
-		return fmt.Errorf("创建文档记录失败: %w", err)
-	}
+// storeKnowledgeContent chunks, embeds and stores the text, images and
+// videos of a normalized knowledge entry under docID.
+func (a *App) storeKnowledgeContent(docID, docName string, req KnowledgeEntryRequest) error {
+	title, content := req.Title, req.Content
+	markdown := req.Format == "markdown"
 
 	// Embed and store text content
-	if err := a.docManager.ChunkEmbedStore(docID, docName, content, req.ProductID); err != nil {
+	var images []knowledgeImage
+	if markdown {
+		refs, err := a.docManager.ChunkEmbedStoreMarkdown(docID, docName, content, req.ProductID)
+		if err != nil {
+			return fmt.Errorf("存储文本失败: %w", err)
+		}
+		for _, ref := range refs {
+			if ref.Kind == chunker.MediaKindImage && !containsKnowledgeImage(images, ref.URL) {
+				images = append(images, knowledgeImage{url: ref.URL, context: ref.Context})
+			}
+		}
+	} else if err := a.docManager.ChunkEmbedStore(docID, docName, content, req.ProductID); err != nil {
 		return fmt.Errorf("存储文本失败: %w", err)
 	}
+	for _, imgURL := range req.ImageURLs {
+		imgURL = strings.TrimSpace(imgURL)
+		if imgURL != "" && !containsKnowledgeImage(images, imgURL) {
+			images = append(images, knowledgeImage{url: imgURL})
+		}
+	}
 
 	// Store image references — always create text-searchable chunks with image URLs
-	if len(req.ImageURLs) > 0 {
+	if len(images) > 0 {
 		es := a.docManager.GetEmbeddingService()
-		// Embed the text once and reuse for all images (same text → same embedding)
+		// Embed the whole entry once and reuse it for all attached images
+		// (same text → same embedding); inline images use their own context.
 		imgText := fmt.Sprintf("[图片: %s] %s", title, content)
-		imgVec, imgEmbErr := es.Embed(imgText)
-		if imgEmbErr != nil {
-			log.Printf("Warning: failed to embed image text: %v", imgEmbErr)
-		} else {
-			for i, imgURL := range req.ImageURLs {
-				imgURL = strings.TrimSpace(imgURL)
-				if imgURL == "" {
+		var imgVec []float64
+		var imgEmbErr error
+		for i, img := range images {
+			var vec []float64
+			chunkText := fmt.Sprintf("[图片: %s]", title)
+			if img.context != "" {
+				chunkText = img.context
+				v, err := es.Embed(fmt.Sprintf("%s\n%s", title, img.context))
+				if err != nil {
+					log.Printf("Warning: failed to embed image context %d: %v", i, err)
 					continue
 				}
-				// Copy the vector to avoid shared slice mutation
-				vecCopy := make([]float64, len(imgVec))
-				copy(vecCopy, imgVec)
-				imgChunk := []vectorstore.VectorChunk{{
-					ChunkText:    fmt.Sprintf("[图片: %s]", title),
-					ChunkIndex:   1000 + i,
-					DocumentID:   docID,
-					DocumentName: docName,
-					Vector:       vecCopy,
-					ImageURL:     imgURL,
-					ProductID:    req.ProductID,
-				}}
-				if err := a.docManager.StoreChunks(docID, imgChunk); err != nil {
-					log.Printf("Warning: failed to store image chunk %d: %v", i, err)
+				vec = v
+			} else {
+				if imgVec == nil && imgEmbErr == nil {
+					imgVec, imgEmbErr = es.Embed(imgText)
+					if imgEmbErr != nil {
+						log.Printf("Warning: failed to embed image text: %v", imgEmbErr)
+					}
+				}
+				if imgEmbErr != nil {
+					continue
 				}
+				// Copy the vector to avoid shared slice mutation
+				vec = make([]float64, len(imgVec))
+				copy(vec, imgVec)
+			}
+			imgChunk := []vectorstore.VectorChunk{{
+				ChunkText:    chunkText,
+				ChunkIndex:   1000 + i,
+				DocumentID:   docID,
+				DocumentName: docName,
+				Vector:       vec,
+				ImageURL:     img.url,
+				ProductID:    req.ProductID,
+			}}
+			if err := a.docManager.StoreChunks(docID, imgChunk); err != nil {
+				log.Printf("Warning: failed to store image chunk %d: %v", i, err)
 			}
 		}
 
 		// Additionally, if multimodal embedding is available, also store image-embedded vectors
 		cfg := a.configManager.Get()
 		if cfg != nil && cfg.Embedding.UseMultimodal {
-			for i, imgURL := range req.ImageURLs {
-				imgURL = strings.TrimSpace(imgURL)
-				if imgURL == "" {
-					continue
-				}
-				vec, err := es.EmbedImageURL(imgURL)
+			for i, img := range images {
+				vec, err := es.EmbedImageURL(img.url)
 				if err != nil {
 					log.Printf("Warning: failed to embed image %d multimodal: %v", i, err)
 					continue
 				}
+				chunkText := fmt.Sprintf("[图片: %s]", title)
+				if img.context != "" {
+					chunkText = img.context
+				}
 				imgChunk := []vectorstore.VectorChunk{{
-					ChunkText:    fmt.Sprintf("[图片: %s]", title),
+					ChunkText:    chunkText,
 					ChunkIndex:   2000 + i,
 					DocumentID:   docID,
 					DocumentName: docName,
 					Vector:       vec,
-					ImageURL:     imgURL,
+					ImageURL:     img.url,
 					ProductID:    req.ProductID,
 				}}
 				if err := a.docManager.StoreChunks(docID, imgChunk); err != nil {
@@ -1349,7 +4109,7 @@ func (a *App) AddKnowledgeEntry(req KnowledgeEntryRequest) error {
 				log.Printf("Warning: invalid video URL format: %s", videoURL)
 				continue
 			}
-			fullPath := filepath.Join(".", "data", "videos", "knowledge", videoPath)
+			fullPath := datadir.Path("videos", "knowledge", videoPath)
 
 			// Read video file data
 			videoData, err := os.ReadFile(fullPath)
@@ -1370,16 +4130,71 @@ func (a *App) AddKnowledgeEntry(req KnowledgeEntryRequest) error {
 	return nil
 }
 
+// containsKnowledgeImage reports whether images already holds url.
+func containsKnowledgeImage(images []knowledgeImage, url string) bool {
+	for _, img := range images {
+		if img.url == url {
+			return true
+		}
+	}
+	return false
+}
+
+// appendUnique appends s to list unless it is already present.
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
 // --- Product Management ---
 
-// CreateProduct creates a new product with the given name, type, description, and welcome message.
-func (a *App) CreateProduct(name, productType, description, welcomeMessage string, allowDownload bool) (*product.Product, error) {
-	return a.productService.Create(name, productType, description, welcomeMessage, allowDownload)
+// CreateProduct creates a new product.
+func (a *App) CreateProduct(in product.Input) (*product.Product, error) {
+	return a.productService.Create(in)
+}
+
+// UpdateProduct updates the fields of an existing product set in patch.
+func (a *App) UpdateProduct(id string, patch product.Patch) (*product.Product, error) {
+	return a.productService.Update(id, patch)
+}
+
+// ExportProductsCSV writes all products as CSV.
+func (a *App) ExportProductsCSV(w io.Writer) error {
+	return a.productService.ExportCSV(w)
+}
+
+// ImportProductsCSV creates or updates products from a CSV file; with dryRun
+// it only reports what the import would do.
+func (a *App) ImportProductsCSV(r io.Reader, dryRun bool) (*product.ImportResult, error) {
+	return a.productService.ImportCSV(r, dryRun)
+}
+
+// SetProductArchived archives or unarchives a product.
+func (a *App) SetProductArchived(id string, archived bool) (*product.Product, error) {
+	return a.productService.SetArchived(id, archived)
+}
+
+// checkProductOpen returns product.ErrArchived when new content must not be
+// added to productID because it is archived.
+func (a *App) checkProductOpen(productID string) error {
+	if productID == "" {
+		return nil
+	}
+	p, err := a.productService.GetByID(productID)
+	if err == nil && p != nil && p.Archived() {
+		return product.ErrArchived
+	}
+	return nil
 }
 
-// UpdateProduct updates an existing product's name, type, description, and welcome message.
-func (a *App) UpdateProduct(id, name, productType, description, welcomeMessage string, allowDownload bool) (*product.Product, error) {
-	return a.productService.Update(id, name, productType, description, welcomeMessage, allowDownload)
+// productHidden reports whether productID is an archived product, which
+// end users must not see.
+func (a *App) productHidden(productID string) bool {
+	return productID != "" && a.checkProductOpen(productID) != nil
 }
 
 // DeleteProduct removes a product by ID.
@@ -1392,6 +4207,68 @@ func (a *App) GetProduct(id string) (*product.Product, error) {
 	return a.productService.GetByID(id)
 }
 
+// ProductCapabilities lists the chat features available for a product, so the
+// chat client and widget can adapt without hard-coding them.
+type ProductCapabilities struct {
+	ProductID      string `json:"product_id"` // "" for the global defaults
+	ProductName    string `json:"product_name"`
+	WelcomeMessage string `json:"welcome_message"`
+	Downloads      bool   `json:"downloads"`       // cited documents can be downloaded
+	Share          bool   `json:"share"`           // answers can be shared by link
+	ExplainSources bool   `json:"explain_sources"` // citations come with a "why cited" note
+	ImageAnswers   bool   `json:"image_answers"`   // answers can include images from documents
+	VideoAnswers   bool   `json:"video_answers"`   // answers can cite video segments
+	ImageQuestions bool   `json:"image_questions"` // questions can carry a pasted image
+	Escalation     bool   `json:"escalation"`      // unanswered questions can be handed to a human
+	Flows          bool   `json:"flows"`           // guided troubleshooting flows are available
+	// EscalationEmail means the user is emailed when a human answers.
+	EscalationEmail bool `json:"escalation_email"`
+	// Languages are the languages documents are machine-translated into, so
+	// questions in them match documents written in another language. Empty
+	// means questions only match documents in the same language.
+	Languages       []string `json:"languages"`
+	MaxUploadSizeMB int      `json:"max_upload_size_mb"`
+}
+
+// ProductCapabilities returns the chat features of a product. An empty
+// productID returns the defaults used when no product is selected.
+func (a *App) ProductCapabilities(productID string) (*ProductCapabilities, error) {
+	caps := &ProductCapabilities{ProductID: productID, Escalation: true, Languages: []string{}}
+	if cfg := a.configManager.Get(); cfg != nil {
+		caps.ProductName = cfg.ProductName
+		caps.WelcomeMessage = cfg.ProductIntro
+		caps.ImageQuestions = cfg.Embedding.UseMultimodal
+		caps.EscalationEmail = cfg.SMTP.Host != ""
+		caps.Languages = append(caps.Languages, cfg.Vector.TranslateLanguages...)
+		caps.MaxUploadSizeMB = cfg.Video.MaxUploadSizeMB
+	}
+	if productID != "" {
+		p, err := a.productService.GetByID(productID)
+		if err != nil {
+			return nil, err
+		}
+		caps.ProductName = p.Name
+		if p.WelcomeMessage != "" {
+			caps.WelcomeMessage = p.WelcomeMessage
+		}
+		caps.Downloads = p.AllowDownload
+		caps.Share = p.AllowShare
+		caps.ExplainSources = p.ExplainSources
+	}
+	media, err := a.docManager.MediaCoverage(productID)
+	if err != nil {
+		return nil, err
+	}
+	caps.ImageAnswers = media.Images
+	caps.VideoAnswers = media.Videos
+	flows, err := a.flows.Summaries(productID)
+	if err != nil {
+		return nil, err
+	}
+	caps.Flows = len(flows) > 0
+	return caps, nil
+}
+
 // ListProducts returns all products.
 func (a *App) ListProducts() ([]product.Product, error) {
 	return a.productService.List()
@@ -1491,9 +4368,9 @@ func (a *App) ListCustomersPaged(page, pageSize int, search string) (*CustomerLi
 	}
 
 	// Build WHERE clause (use table-qualified column names for JOIN compatibility)
-	baseWhere := `provider != 'admin_sub' AND id != 'admin'`
+	baseWhere := `provider NOT IN ('admin_sub', 'apikey') AND id != 'admin'`
 	// For JOIN queries, we need table-qualified names to avoid ambiguity with login_bans.id
-	joinWhere := `u.provider != 'admin_sub' AND u.id != 'admin'`
+	joinWhere := `u.provider NOT IN ('admin_sub', 'apikey') AND u.id != 'admin'`
 	var args []interface{}
 	if search != "" {
 		baseWhere += ` AND COALESCE(email, '') LIKE ?`
@@ -1560,7 +4437,7 @@ func (a *App) ListCustomersPaged(page, pageSize int, search string) (*CustomerLi
 	err = a.readDB.QueryRow(`
 		SELECT COUNT(DISTINCT u.id) FROM users u
 		INNER JOIN login_bans b ON (b.username = COALESCE(u.email, '') OR b.username = u.id)
-		WHERE u.provider != 'admin_sub' AND u.id != 'admin' AND b.unlocks_at > ?
+		WHERE u.provider NOT IN ('admin_sub', 'apikey') AND u.id != 'admin' AND b.unlocks_at > ?
 	`, now).Scan(&globalBanned)
 	if err == nil {
 		bannedCount = globalBanned
@@ -1592,6 +4469,8 @@ func (a *App) DeleteCustomer(userID string) error {
 	// Delete tokens and sessions first
 	_, _ = tx.Exec(`DELETE FROM email_tokens WHERE user_id = ?`, userID)
 	_, _ = tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+	_, _ = tx.Exec(`DELETE FROM operation_tokens WHERE user_id = ?`, userID)
+	_, _ = tx.Exec(`DELETE FROM chat_history WHERE user_id = ?`, userID)
 	// Delete user record
 	_, err = tx.Exec(`DELETE FROM users WHERE id = ?`, userID)
 	if err != nil {
@@ -1610,6 +4489,12 @@ func (a *App) BanCustomer(email string, reason string, days int) error {
 		days = 3650 // Default to ~10 years
 	}
 	a.loginLimiter.AddManualBan(email, "", reason, time.Duration(days)*24*time.Hour)
+	// A banned account is signed out everywhere
+	var userID string
+	if err := a.readDB.QueryRow(`SELECT id FROM users WHERE email = ?`, email).Scan(&userID); err == nil {
+		_ = a.sessionManager.DeleteSessionsByUserID(userID)
+		_ = a.opTokens.RevokeUser(userID)
+	}
 	return nil
 }
 
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"askflow/internal/analytics"
+)
+
+// HandleAnswerAudits lists answer audit records, newest first, without their
+// prompts. Super admin only: records hold customers' questions.
+// GET /api/admin/audits?user_id=&product_id=&from=&to=&limit=100
+func HandleAnswerAudits(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, role, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		if role != "super_admin" {
+			WriteError(w, http.StatusForbidden, "无权限")
+			return
+		}
+
+		q := r.URL.Query()
+		f := analytics.AuditFilter{UserID: strings.TrimSpace(q.Get("user_id")), ProductID: q.Get("product_id")}
+		if len(f.UserID) > 128 {
+			WriteError(w, http.StatusBadRequest, "invalid user_id")
+			return
+		}
+		if !IsValidOptionalID(f.ProductID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		if f.From, err = parseReportDate(q.Get("from")); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid from date (expected YYYY-MM-DD or RFC3339)")
+			return
+		}
+		if f.To, err = parseReportDate(q.Get("to")); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid to date (expected YYYY-MM-DD or RFC3339)")
+			return
+		}
+		if len(q.Get("to")) == len("2006-01-02") {
+			f.To = f.To.AddDate(0, 0, 1)
+		}
+		if v := q.Get("limit"); v != "" {
+			if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 || f.Limit > 500 {
+				WriteError(w, http.StatusBadRequest, "limit must be between 1 and 500")
+				return
+			}
+		}
+		audits, err := app.ListAnswerAudits(f)
+		if err != nil {
+			log.Printf("[Audit] list error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取回答审计记录失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"audits": audits})
+	}
+}
+
+// HandleAnswerAuditByID returns the full audit record of an answer, prompt
+// included, by the request ID (X-Request-Id of the query) or the query ID.
+// GET /api/admin/audits/{id}
+func HandleAnswerAuditByID(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, role, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		if role != "super_admin" {
+			WriteError(w, http.StatusForbidden, "无权限")
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/admin/audits/")
+		if id == "" || !IsValidOptionalID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid request ID")
+			return
+		}
+		audit, err := app.GetAnswerAudit(id)
+		if err != nil {
+			log.Printf("[Audit] get error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取回答审计记录失败")
+			return
+		}
+		if audit == nil {
+			WriteError(w, http.StatusNotFound, "审计记录不存在")
+			return
+		}
+		WriteJSON(w, http.StatusOK, audit)
+	}
+}
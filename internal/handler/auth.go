@@ -265,7 +265,7 @@ func HandleRegister(app *App) http.HandlerFunc {
 			WriteError(w, http.StatusBadRequest, "验证码错误")
 			return
 		}
-		baseURL := GetBaseURL(r)
+		baseURL := app.PublicBaseURL(r)
 		if err := app.Register(req.RegisterRequest, baseURL); err != nil {
 			WriteError(w, http.StatusBadRequest, err.Error())
 			return
@@ -309,6 +309,57 @@ func HandleUserPreferences(app *App) http.HandlerFunc {
 	}
 }
 
+// HandleSession returns the expiry of the session the request is made with,
+// user or admin. Like any authenticated request it counts as activity, so
+// the frontend also calls it to keep a session alive.
+func HandleSession(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		authHeader := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		if token == "" || token == authHeader {
+			WriteError(w, http.StatusUnauthorized, "未登录")
+			return
+		}
+		session, err := app.sessionManager.ValidateSession(token)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, "会话已过期")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"expires_at":     session.ExpiresAt,
+			"max_expires_at": session.MaxExpiresAt,
+			"last_activity":  session.LastActivity,
+		})
+	}
+}
+
+// HandleLogout ends the session the request is made with, user or admin,
+// and revokes the operation tokens of its user.
+// POST /api/auth/logout
+func HandleLogout(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		authHeader := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		if token == "" || token == authHeader {
+			WriteError(w, http.StatusUnauthorized, "未登录")
+			return
+		}
+		if err := app.Logout(token); err != nil {
+			WriteError(w, http.StatusUnauthorized, "会话已过期")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+	}
+}
+
 // HandleUserLogin authenticates a user with email, password, and captcha.
 func HandleUserLogin(app *App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -339,6 +390,44 @@ func HandleUserLogin(app *App) http.HandlerFunc {
 	}
 }
 
+// HandleExternalLogin signs a user in through the external login backend.
+// POST /api/auth/external-login {"credentials": {"username": "...", "password": "..."}}
+func HandleExternalLogin(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if app.GetExternalLogin() == nil {
+			WriteError(w, http.StatusNotFound, "未启用外部账号登录")
+			return
+		}
+		var req struct {
+			Credentials map[string]string `json:"credentials"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if len(req.Credentials) == 0 || len(req.Credentials) > 10 {
+			WriteError(w, http.StatusBadRequest, "请输入账号和密码")
+			return
+		}
+		for k, v := range req.Credentials {
+			if len(k) > 64 || len(v) > 1024 {
+				WriteError(w, http.StatusBadRequest, "登录信息过长")
+				return
+			}
+		}
+		resp, err := app.ExternalLogin(req.Credentials, middleware.GetClientIP(r))
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, resp)
+	}
+}
+
 // HandleVerifyEmail verifies a user's email using a token from the URL.
 func HandleVerifyEmail(app *App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -374,7 +463,7 @@ func HandleForgotPassword(app *App) http.HandlerFunc {
 			WriteError(w, http.StatusBadRequest, "invalid request body")
 			return
 		}
-		baseURL := GetBaseURL(r)
+		baseURL := app.PublicBaseURL(r)
 		if err := app.RequestPasswordReset(req.Email, baseURL); err != nil {
 			WriteError(w, http.StatusBadRequest, err.Error())
 			return
@@ -437,25 +526,27 @@ func HandleSNLogin(app *App) http.HandlerFunc {
 // SPA with the ticket as a query parameter so the frontend can exchange it via JS.
 func HandleTicketLogin(app *App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Redirect within the path prefix the service is published under
+		base := app.BasePath()
 		if r.Method != http.MethodGet {
-			http.Redirect(w, r, "/login?error=method_not_allowed", http.StatusFound)
+			http.Redirect(w, r, base+"/login?error=method_not_allowed", http.StatusFound)
 			return
 		}
 		ticket := r.URL.Query().Get("ticket")
 		if ticket == "" || len(ticket) > 128 {
-			http.Redirect(w, r, "/login?error=invalid_ticket", http.StatusFound)
+			http.Redirect(w, r, base+"/login?error=invalid_ticket", http.StatusFound)
 			return
 		}
 		// Validate ticket contains only safe characters (hex + dashes)
 		for _, c := range ticket {
 			if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || c == '-') {
-				http.Redirect(w, r, "/login?error=invalid_ticket", http.StatusFound)
+				http.Redirect(w, r, base+"/login?error=invalid_ticket", http.StatusFound)
 				return
 			}
 		}
 		// Pass ticket to frontend — the SPA will call /api/auth/ticket-exchange to
 		// validate it and store the session in localStorage (same pattern as OAuth).
-		http.Redirect(w, r, "/?ticket="+ticket, http.StatusFound)
+		http.Redirect(w, r, base+"/?ticket="+ticket, http.StatusFound)
 	}
 }
 
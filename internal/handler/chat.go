@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"askflow/internal/chathistory"
+	"askflow/internal/chatstate"
+)
+
+// HandleChatState saves and restores the chat UI state (current conversation
+// and unsent draft) of the caller's login session.
+// GET /api/chat/state — returns {"state": {...}} or {"state": null}
+// PUT /api/chat/state {"product_id": "...", "draft": "...", "messages": [...]}
+// DELETE /api/chat/state
+func HandleChatState(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID, userID, err := GetUserSessionID(app, r)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			st, err := app.GetChatState(sessionID, userID)
+			if err != nil {
+				log.Printf("[ChatState] load error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "读取会话状态失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"state": st})
+
+		case http.MethodPut:
+			var req chatstate.State
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if !IsValidOptionalID(req.ProductID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			st, err := app.SaveChatState(sessionID, userID, req)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"updated_at": st.UpdatedAt})
+
+		case http.MethodDelete:
+			if err := app.DeleteChatState(sessionID, userID); err != nil {
+				log.Printf("[ChatState] delete error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "清除会话状态失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleChatHistory lists the caller's past questions and answers, newest
+// first.
+// GET /api/chat/history?product_id=&page=1&page_size=20
+func HandleChatHistory(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		userID, err := GetUserSession(app, r)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		productID := r.URL.Query().Get("product_id")
+		if !IsValidOptionalID(productID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		page := 1
+		pageSize := 20
+		if p := r.URL.Query().Get("page"); p != "" {
+			if v, e := strconv.Atoi(p); e == nil && v > 0 {
+				page = v
+			}
+		}
+		if ps := r.URL.Query().Get("page_size"); ps != "" {
+			if v, e := strconv.Atoi(ps); e == nil && v > 0 {
+				pageSize = v
+			}
+		}
+		if pageSize > 100 {
+			pageSize = 100
+		}
+		entries, total, err := app.ListChatHistory(userID, productID, page, pageSize)
+		if err != nil {
+			log.Printf("[ChatHistory] list error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取聊天记录失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"entries":   entries,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		})
+	}
+}
+
+// HandleChatHistoryItem deletes one entry of the caller's chat history.
+// DELETE /api/chat/history/{id}
+func HandleChatHistoryItem(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		userID, err := GetUserSession(app, r)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/chat/history/")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid history ID")
+			return
+		}
+		if err := app.DeleteChatHistory(userID, id); err != nil {
+			if errors.Is(err, chathistory.ErrNotFound) {
+				WriteError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			log.Printf("[ChatHistory] delete error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "删除聊天记录失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
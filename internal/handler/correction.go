@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"askflow/internal/correction"
+)
+
+// HandleQueryCorrection stores the user's suggested correction for a
+// sentence of one of their answers, optionally tied to a cited chunk.
+// POST /api/query/correction {"query_id": "...", "sentence": "...", "suggestion": "...", "document_id": "...", "chunk_index": 0}
+func HandleQueryCorrection(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		userID, err := GetUserSession(app, r)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		var in correction.Input
+		if err := ReadJSONBody(r, &in); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if !IsValidHexID(in.QueryID) || !IsValidOptionalID(in.DocumentID) || in.ChunkIndex < 0 {
+			WriteError(w, http.StatusBadRequest, "invalid correction")
+			return
+		}
+		sg, err := app.SubmitCorrection(userID, in)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]string{"id": sg.ID, "status": sg.Status})
+	}
+}
+
+// HandleAdminCorrections lists the correction suggestions of the moderation
+// queue.
+// GET /api/admin/corrections?status=pending|accepted|rejected&product_id=
+func HandleAdminCorrections(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, _, err := GetAdminSession(app, r); err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		q := r.URL.Query()
+		status := q.Get("status")
+		if !correction.ValidStatusFilter(status) {
+			WriteError(w, http.StatusBadRequest, "invalid status")
+			return
+		}
+		productID := q.Get("product_id")
+		if !IsValidOptionalID(productID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		list, err := app.ListCorrections(status, productID)
+		if err != nil {
+			log.Printf("[Correction] list error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取纠错建议失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"suggestions": list})
+	}
+}
+
+// HandleAdminCorrectionByID returns a correction suggestion with its cited
+// chunk, or accepts or rejects it.
+// GET  /api/admin/corrections/{id}
+// POST /api/admin/corrections/{id}/accept {"apply_as": "chunk|knowledge|", "title": "...", "text": "...", "note": "..."}
+// POST /api/admin/corrections/{id}/reject {"note": "..."}
+func HandleAdminCorrectionByID(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/admin/corrections/"), "/")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid suggestion ID")
+			return
+		}
+
+		switch {
+		case action == "" && r.Method == http.MethodGet:
+			d, err := app.GetCorrection(id)
+			if err != nil {
+				WriteError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, d)
+
+		case (action == "accept" || action == "reject") && r.Method == http.MethodPost:
+			var req CorrectionAcceptRequest
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			req.Note = strings.TrimSpace(req.Note)
+			if len(req.Note) > 2000 {
+				WriteError(w, http.StatusBadRequest, "处理意见过长（最多2000字符）")
+				return
+			}
+			var sg *correction.Suggestion
+			if action == "accept" {
+				sg, err = app.AcceptCorrection(id, req, userID)
+			} else {
+				sg, err = app.RejectCorrection(id, req.Note, userID)
+			}
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, sg)
+
+		case action == "" || action == "accept" || action == "reject":
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+		default:
+			WriteError(w, http.StatusNotFound, "not found")
+		}
+	}
+}
@@ -1,17 +1,25 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"askflow/internal/datadir"
 	"askflow/internal/document"
 	"askflow/internal/errlog"
+	"askflow/internal/jobs"
+	"askflow/internal/product"
 )
 
 // SupportedExtensions lists file extensions that can be imported.
@@ -27,6 +35,8 @@ var SupportedExtensions = map[string]string{
 	".markdown": "markdown",
 	".html":     "html",
 	".htm":      "html",
+	".txt":      "text",
+	".csv":      "csv",
 }
 
 // HandleDocuments returns the list of documents, optionally filtered by product ID.
@@ -47,6 +57,16 @@ func HandleDocuments(app *App) http.HandlerFunc {
 			WriteError(w, http.StatusBadRequest, "invalid product_id")
 			return
 		}
+		sortBy := r.URL.Query().Get("sort")
+		if !document.ValidDocumentSort(sortBy) {
+			WriteError(w, http.StatusBadRequest, "invalid sort (expected cited, clicked or least_cited)")
+			return
+		}
+		category := r.URL.Query().Get("category")
+		if !document.ValidCategory(category) {
+			WriteError(w, http.StatusBadRequest, "invalid category")
+			return
+		}
 		docs, err := app.ListDocuments(productID)
 		if err != nil {
 			log.Printf("[Documents] list error: %v", err)
@@ -56,6 +76,8 @@ func HandleDocuments(app *App) http.HandlerFunc {
 		if docs == nil {
 			docs = []document.DocumentInfo{}
 		}
+		docs = document.FilterDocuments(docs, category, strings.TrimSpace(r.URL.Query().Get("tag")))
+		document.SortDocuments(docs, sortBy)
 		WriteJSON(w, http.StatusOK, map[string]interface{}{"documents": docs})
 	}
 }
@@ -69,68 +91,34 @@ func HandleDocumentUpload(app *App) http.HandlerFunc {
 		}
 
 		// Require admin session
-		_, _, err := GetAdminSession(app, r)
+		userID, _, err := GetAdminSession(app, r)
 		if err != nil {
 			WriteAdminSessionError(w, err)
 			return
 		}
 
-		// Limit request body size to prevent memory exhaustion
-		cfg := app.configManager.Get()
-		if cfg == nil {
-			WriteError(w, http.StatusInternalServerError, "config not loaded")
-			return
-		}
-		maxUploadSizeMB := cfg.Video.MaxUploadSizeMB
-		maxUploadSize := int64(maxUploadSizeMB)<<20 + 10<<20 // file limit + 10MB overhead
-		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
-
-		// Parse multipart form (32MB in memory, rest goes to temp files)
-		if err := r.ParseMultipartForm(32 << 20); err != nil {
-			WriteError(w, http.StatusBadRequest, "failed to parse multipart form")
-			return
-		}
-
-		file, header, err := r.FormFile("file")
-		if err != nil {
-			WriteError(w, http.StatusBadRequest, "missing file in upload")
-			return
-		}
-		defer file.Close()
-
-		// Check file size against configured max
-		maxSize := int64(maxUploadSizeMB) << 20
-		fileData, err := io.ReadAll(io.LimitReader(file, maxSize+1))
-		if err != nil {
-			WriteError(w, http.StatusInternalServerError, "failed to read file")
-			return
-		}
-		if int64(len(fileData)) > maxSize {
-			WriteError(w, http.StatusBadRequest, fmt.Sprintf("文件大小超过限制 (%dMB)", maxUploadSizeMB))
+		fileData, fileName, fileType, ok := readUploadedFile(app, w, r)
+		if !ok {
 			return
 		}
 
-		// Determine file type from extension
-		fileType := DetectFileType(header.Filename)
-
-		// Validate video files have correct magic bytes to prevent disguised uploads
-		switch fileType {
-		case "mp4", "avi", "mkv", "mov", "webm":
-			if !IsValidVideoMagicBytes(fileData) {
-				WriteError(w, http.StatusBadRequest, "文件内容与扩展名不匹配")
-				return
-			}
-		}
-
 		req := document.UploadFileRequest{
-			FileName:  header.Filename,
+			FileName:  fileName,
 			FileData:  fileData,
 			FileType:  fileType,
 			ProductID: r.FormValue("product_id"),
+			Password:  r.FormValue("password"),
+
+			EffectiveFrom:  r.FormValue("effective_from"),
+			EffectiveUntil: r.FormValue("effective_until"),
+			PublishAt:      r.FormValue("publish_at"),
+			UnpublishAt:    r.FormValue("unpublish_at"),
+			ScheduledBy:    userID,
+			CallRecording:  r.FormValue("call_recording") == "true",
 		}
 		doc, err := app.UploadFile(req)
 		if err != nil {
-			errlog.Logf("[API] file upload rejected file=%q type=%s: %v", header.Filename, fileType, err)
+			errlog.Logf("[API] file upload rejected file=%q type=%s: %v", fileName, fileType, err)
 			WriteError(w, http.StatusBadRequest, err.Error())
 			return
 		}
@@ -138,6 +126,66 @@ func HandleDocumentUpload(app *App) http.HandlerFunc {
 	}
 }
 
+// readUploadedFile reads the "file" field of a multipart upload, enforcing
+// the configured size limit and checking media magic bytes, and returns its
+// data, name and type. On failure it writes the error response and returns
+// false.
+func readUploadedFile(app *App, w http.ResponseWriter, r *http.Request) ([]byte, string, string, bool) {
+	// Limit request body size to prevent memory exhaustion
+	cfg := app.configManager.Get()
+	if cfg == nil {
+		WriteError(w, http.StatusInternalServerError, "config not loaded")
+		return nil, "", "", false
+	}
+	maxUploadSizeMB := cfg.Video.MaxUploadSizeMB
+	maxUploadSize := int64(maxUploadSizeMB)<<20 + 10<<20 // file limit + 10MB overhead
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
+	// Parse multipart form (32MB in memory, rest goes to temp files)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		WriteError(w, http.StatusBadRequest, "failed to parse multipart form")
+		return nil, "", "", false
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "missing file in upload")
+		return nil, "", "", false
+	}
+	defer file.Close()
+
+	// Check file size against configured max
+	maxSize := int64(maxUploadSizeMB) << 20
+	fileData, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "failed to read file")
+		return nil, "", "", false
+	}
+	if int64(len(fileData)) > maxSize {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("文件大小超过限制 (%dMB)", maxUploadSizeMB))
+		return nil, "", "", false
+	}
+
+	// Determine file type from extension
+	fileType := DetectFileType(header.Filename)
+
+	// Validate video files have correct magic bytes to prevent disguised uploads
+	switch fileType {
+	case "mp4", "avi", "mkv", "mov", "webm":
+		if !IsValidVideoMagicBytes(fileData) {
+			WriteError(w, http.StatusBadRequest, "文件内容与扩展名不匹配")
+			return nil, "", "", false
+		}
+	case "mp3", "wav", "m4a":
+		if !IsValidAudioMagicBytes(fileData) {
+			WriteError(w, http.StatusBadRequest, "文件内容与扩展名不匹配")
+			return nil, "", "", false
+		}
+	}
+
+	return fileData, header.Filename, fileType, true
+}
+
 // HandleDocumentURLPreview fetches and parses URL content for preview.
 func HandleDocumentURLPreview(app *App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -194,6 +242,77 @@ func HandleDocumentURL(app *App) http.HandlerFunc {
 	}
 }
 
+// HandleDocumentCrawl imports the pages of a site from a root URL, streaming
+// progress over SSE: a "start" event with the normalized request, a
+// "progress" event per fetched page and a "done" event with the totals.
+// POST /api/documents/crawl {"url": "...", "product_id": "...", "max_depth": 2, "max_pages": 100, "include": [], "exclude": [], "delay_ms": 1000}
+func HandleDocumentCrawl(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, _, err := GetAdminSession(app, r); err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		var req document.CrawlRequest
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		req, err := app.CheckCrawl(req)
+		if err != nil {
+			errlog.Logf("[API] crawl rejected url=%q: %v", req.URL, err)
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			WriteError(w, http.StatusInternalServerError, "streaming not supported")
+			return
+		}
+		// A crawl runs for as long as the site takes; don't cut it at the
+		// server's write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		sendSSE := func(event string, data interface{}) {
+			jsonData, _ := json.Marshal(data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, jsonData)
+			flusher.Flush()
+		}
+
+		sendSSE("start", req)
+
+		// The crawl shows in the job list, where it can be canceled too
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		job := app.TrackJob(jobs.TypeCrawl, "", req.URL, func() error { cancel(); return nil })
+
+		result, err := app.Crawl(ctx, req, func(ev document.CrawlEvent) {
+			job.Set(ev.Fetched, ev.Fetched+ev.Queued, ev.URL)
+			sendSSE("progress", ev)
+		})
+		if err != nil {
+			job.Finish(err)
+			sendSSE("error", map[string]string{"message": err.Error()})
+			return
+		}
+		if result.Canceled {
+			job.Finish(context.Canceled)
+		} else {
+			job.Finish(nil)
+		}
+		sendSSE("done", result)
+	}
+}
+
 // HandlePublicDocumentDownload allows regular users to download source documents
 // if the product has allow_download enabled and the document type is downloadable.
 func HandlePublicDocumentDownload(app *App) http.HandlerFunc {
@@ -210,21 +329,10 @@ func HandlePublicDocumentDownload(app *App) http.HandlerFunc {
 			return
 		}
 		// Require user session (support token in query param for direct download links)
-		authHeader := r.Header.Get("Authorization")
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if token == "" || token == authHeader {
-			token = r.URL.Query().Get("token")
-		}
-		if token == "" {
-			WriteError(w, http.StatusUnauthorized, "未登录")
-			return
-		}
-		session, sErr := app.sessionManager.ValidateSession(token)
-		if sErr != nil {
-			WriteError(w, http.StatusUnauthorized, "会话已过期")
+		if _, err := getLinkSession(app, r); err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
 			return
 		}
-		_ = session
 		docID := strings.TrimPrefix(r.URL.Path, "/api/documents/public-download/")
 		if docID == "" || !IsValidHexID(docID) {
 			WriteError(w, http.StatusBadRequest, "invalid document ID")
@@ -264,7 +372,7 @@ func HandlePublicDocumentDownload(app *App) http.HandlerFunc {
 		}
 		// Verify file path stays within expected data directory (resolve symlinks to prevent bypass)
 		absPath, _ := filepath.Abs(filePath)
-		absDataDir, _ := filepath.Abs(filepath.Join(".", "data"))
+		absDataDir, _ := filepath.Abs(datadir.Root())
 		// Resolve symlinks to prevent symlink-based path traversal
 		if realPath, err := filepath.EvalSymlinks(absPath); err == nil {
 			absPath = realPath
@@ -322,7 +430,7 @@ func HandleDocumentByID(app *App) http.HandlerFunc {
 			}
 			// Verify file path stays within expected data directory (resolve symlinks to prevent bypass)
 			absPath, _ := filepath.Abs(filePath)
-			absDataDir, _ := filepath.Abs(filepath.Join(".", "data"))
+			absDataDir, _ := filepath.Abs(datadir.Root())
 			if realPath, err := filepath.EvalSymlinks(absPath); err == nil {
 				absPath = realPath
 			}
@@ -346,6 +454,383 @@ func HandleDocumentByID(app *App) http.HandlerFunc {
 			return
 		}
 
+		// Handle /api/documents/{id}/locate?chunk_index=N
+		if strings.HasSuffix(path, "/locate") {
+			docID := strings.TrimSuffix(path, "/locate")
+			if !IsValidHexID(docID) {
+				WriteError(w, http.StatusBadRequest, "invalid document ID")
+				return
+			}
+			if r.Method != http.MethodGet {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			// Citations are shown to both chat users and admins
+			if _, _, err := GetAdminSession(app, r); err != nil {
+				if _, uErr := GetUserSession(app, r); uErr != nil {
+					WriteError(w, http.StatusUnauthorized, "未登录")
+					return
+				}
+			}
+			chunkIndex, err := strconv.Atoi(r.URL.Query().Get("chunk_index"))
+			if err != nil || chunkIndex < 0 {
+				WriteError(w, http.StatusBadRequest, "invalid chunk_index")
+				return
+			}
+			loc, err := app.LocateChunk(docID, chunkIndex)
+			if errors.Is(err, document.ErrChunkNotFound) {
+				WriteError(w, http.StatusNotFound, "引用片段未找到")
+				return
+			}
+			if err != nil {
+				WriteError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, loc)
+			return
+		}
+
+		// Handle /api/documents/{id}/content
+		if strings.HasSuffix(path, "/content") {
+			docID := strings.TrimSuffix(path, "/content")
+			if !IsValidHexID(docID) {
+				WriteError(w, http.StatusBadRequest, "invalid document ID")
+				return
+			}
+			if r.Method != http.MethodGet {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			// Citations are highlighted for both chat users and admins
+			if _, _, err := GetAdminSession(app, r); err != nil {
+				if _, uErr := GetUserSession(app, r); uErr != nil {
+					WriteError(w, http.StatusUnauthorized, "未登录")
+					return
+				}
+			}
+			text, err := app.DocumentText(docID)
+			if errors.Is(err, document.ErrTextNotFound) {
+				WriteError(w, http.StatusNotFound, "该文档没有可用的提取文本")
+				return
+			}
+			if err != nil {
+				WriteError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{
+				"document_id": docID,
+				"content":     text,
+				"length":      utf8.RuneCountInString(text),
+			})
+			return
+		}
+
+		// Handle /api/documents/{id}/related?limit=N
+		if strings.HasSuffix(path, "/related") {
+			docID := strings.TrimSuffix(path, "/related")
+			if !IsValidHexID(docID) {
+				WriteError(w, http.StatusBadRequest, "invalid document ID")
+				return
+			}
+			if r.Method != http.MethodGet {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			if _, _, err := GetAdminSession(app, r); err != nil {
+				WriteAdminSessionError(w, err)
+				return
+			}
+			related, err := app.RelatedDocuments(docID, relatedLimit(r))
+			if err != nil {
+				WriteError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"documents": related})
+			return
+		}
+
+		// Handle /api/documents/{id}/citations
+		if strings.HasSuffix(path, "/citations") {
+			docID := strings.TrimSuffix(path, "/citations")
+			if !IsValidHexID(docID) {
+				WriteError(w, http.StatusBadRequest, "invalid document ID")
+				return
+			}
+			if r.Method != http.MethodGet {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			if _, _, err := GetAdminSession(app, r); err != nil {
+				WriteAdminSessionError(w, err)
+				return
+			}
+			chunks, err := app.DocumentCitations(docID)
+			if err != nil {
+				log.Printf("[Documents] citations error for %s: %v", docID, err)
+				WriteError(w, http.StatusInternalServerError, "获取引用统计失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"chunks": chunks})
+			return
+		}
+
+		// Handle GET /api/documents/{id}/chunks
+		if strings.HasSuffix(path, "/chunks") {
+			docID := strings.TrimSuffix(path, "/chunks")
+			if !IsValidHexID(docID) {
+				WriteError(w, http.StatusBadRequest, "invalid document ID")
+				return
+			}
+			if r.Method != http.MethodGet {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			if _, _, err := GetAdminSession(app, r); err != nil {
+				WriteAdminSessionError(w, err)
+				return
+			}
+			chunks, err := app.ListDocumentChunks(docID)
+			if err != nil {
+				WriteError(w, http.StatusNotFound, "文档未找到")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"chunks": chunks})
+			return
+		}
+
+		// Handle PUT/DELETE /api/documents/{id}/chunks/{index}
+		if strings.Contains(path, "/chunks/") {
+			parts := strings.SplitN(path, "/chunks/", 2)
+			chunkIndex, convErr := strconv.Atoi(parts[1])
+			if !IsValidHexID(parts[0]) || convErr != nil || chunkIndex < 0 {
+				WriteError(w, http.StatusBadRequest, "invalid document chunk")
+				return
+			}
+			userID, _, err := GetAdminSession(app, r)
+			if err != nil {
+				WriteAdminSessionError(w, err)
+				return
+			}
+			switch r.Method {
+			case http.MethodPut:
+				var req struct {
+					Text string `json:"text"`
+				}
+				if err := ReadJSONBody(r, &req); err != nil {
+					WriteError(w, http.StatusBadRequest, "invalid request body")
+					return
+				}
+				chunk, err := app.UpdateDocumentChunk(parts[0], chunkIndex, req.Text)
+				if errors.Is(err, document.ErrChunkNotFound) {
+					WriteError(w, http.StatusNotFound, "分块不存在")
+					return
+				}
+				if err != nil {
+					WriteError(w, http.StatusBadRequest, err.Error())
+					return
+				}
+				log.Printf("[Documents] chunk %d of %s edited by %s", chunkIndex, parts[0], userID)
+				WriteJSON(w, http.StatusOK, chunk)
+			case http.MethodDelete:
+				err := app.DeleteDocumentChunk(parts[0], chunkIndex)
+				if errors.Is(err, document.ErrChunkNotFound) {
+					WriteError(w, http.StatusNotFound, "分块不存在")
+					return
+				}
+				if err != nil {
+					WriteError(w, http.StatusBadRequest, err.Error())
+					return
+				}
+				log.Printf("[Documents] chunk %d of %s deleted by %s", chunkIndex, parts[0], userID)
+				WriteJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+			default:
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			}
+			return
+		}
+
+		// Handle /api/documents/{id}/effective
+		if strings.HasSuffix(path, "/effective") {
+			docID := strings.TrimSuffix(path, "/effective")
+			if !IsValidHexID(docID) {
+				WriteError(w, http.StatusBadRequest, "invalid document ID")
+				return
+			}
+			if r.Method != http.MethodPut {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			if _, _, err := GetAdminSession(app, r); err != nil {
+				WriteAdminSessionError(w, err)
+				return
+			}
+			var req struct {
+				EffectiveFrom  string `json:"effective_from"`
+				EffectiveUntil string `json:"effective_until"`
+			}
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			doc, err := app.SetDocumentEffectiveDates(docID, req.EffectiveFrom, req.EffectiveUntil)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, doc)
+			return
+		}
+
+		// Handle /api/documents/{id}/schedule
+		if strings.HasSuffix(path, "/schedule") {
+			docID := strings.TrimSuffix(path, "/schedule")
+			if !IsValidHexID(docID) {
+				WriteError(w, http.StatusBadRequest, "invalid document ID")
+				return
+			}
+			if r.Method != http.MethodPut {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			userID, _, err := GetAdminSession(app, r)
+			if err != nil {
+				WriteAdminSessionError(w, err)
+				return
+			}
+			var req struct {
+				PublishAt   string `json:"publish_at"`
+				UnpublishAt string `json:"unpublish_at"`
+			}
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			doc, err := app.SetDocumentSchedule(docID, req.PublishAt, req.UnpublishAt, userID)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			log.Printf("[Documents] schedule of %s set by %s: publish=%q unpublish=%q", docID, userID, doc.PublishAt, doc.UnpublishAt)
+			WriteJSON(w, http.StatusOK, doc)
+			return
+		}
+
+		// Handle /api/documents/{id}/tags
+		if strings.HasSuffix(path, "/tags") {
+			docID := strings.TrimSuffix(path, "/tags")
+			if !IsValidHexID(docID) {
+				WriteError(w, http.StatusBadRequest, "invalid document ID")
+				return
+			}
+			if r.Method != http.MethodPost {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			if _, _, err := GetAdminSession(app, r); err != nil {
+				WriteAdminSessionError(w, err)
+				return
+			}
+			tags, err := app.TagDocument(docID)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, tags)
+			return
+		}
+
+		// Handle POST /api/documents/{id}/versions/{n}/restore
+		if strings.HasSuffix(path, "/restore") && strings.Contains(path, "/versions/") {
+			parts := strings.Split(strings.TrimSuffix(path, "/restore"), "/versions/")
+			version, convErr := strconv.Atoi(parts[len(parts)-1])
+			if len(parts) != 2 || !IsValidHexID(parts[0]) || convErr != nil || version < 1 {
+				WriteError(w, http.StatusBadRequest, "invalid document version")
+				return
+			}
+			if r.Method != http.MethodPost {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			userID, _, err := GetAdminSession(app, r)
+			if err != nil {
+				WriteAdminSessionError(w, err)
+				return
+			}
+			v, err := app.RestoreDocumentVersion(parts[0], version, userID)
+			if errors.Is(err, document.ErrVersionNotFound) {
+				WriteError(w, http.StatusNotFound, "版本不存在")
+				return
+			}
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, v)
+			return
+		}
+
+		// Handle GET /api/documents/{id}/versions
+		if strings.HasSuffix(path, "/versions") {
+			docID := strings.TrimSuffix(path, "/versions")
+			if !IsValidHexID(docID) {
+				WriteError(w, http.StatusBadRequest, "invalid document ID")
+				return
+			}
+			if r.Method != http.MethodGet {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			if _, _, err := GetAdminSession(app, r); err != nil {
+				WriteAdminSessionError(w, err)
+				return
+			}
+			versions, err := app.ListDocumentVersions(docID)
+			if err != nil {
+				log.Printf("[Documents] versions error for %s: %v", docID, err)
+				WriteError(w, http.StatusInternalServerError, "获取文档版本失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"versions": versions})
+			return
+		}
+
+		// Handle POST /api/documents/{id}/replace (multipart, like uploads)
+		if strings.HasSuffix(path, "/replace") {
+			docID := strings.TrimSuffix(path, "/replace")
+			if !IsValidHexID(docID) {
+				WriteError(w, http.StatusBadRequest, "invalid document ID")
+				return
+			}
+			if r.Method != http.MethodPost {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			userID, _, err := GetAdminSession(app, r)
+			if err != nil {
+				WriteAdminSessionError(w, err)
+				return
+			}
+			fileData, fileName, fileType, ok := readUploadedFile(app, w, r)
+			if !ok {
+				return
+			}
+			v, err := app.ReplaceDocument(docID, document.ReplaceFileRequest{
+				FileName:  fileName,
+				FileData:  fileData,
+				FileType:  fileType,
+				Password:  r.FormValue("password"),
+				Note:      r.FormValue("note"),
+				CreatedBy: userID,
+			})
+			if err != nil {
+				errlog.Logf("[API] document replace rejected doc=%s file=%q type=%s: %v", docID, fileName, fileType, err)
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, v)
+			return
+		}
+
 		// Handle /api/documents/{id}/review
 		if strings.HasSuffix(path, "/review") {
 			docID := strings.TrimSuffix(path, "/review")
@@ -399,89 +884,272 @@ func HandleDocumentByID(app *App) http.HandlerFunc {
 	}
 }
 
-// HandleBatchImport handles batch file import via SSE (Server-Sent Events).
-func HandleBatchImport(app *App) http.HandlerFunc {
+// duplicatePairsLimit caps the pairs of a near-duplicate report.
+const duplicatePairsLimit = 500
+
+// HandleDocumentDuplicates reports near-duplicate documents by embedding
+// centroid similarity, with a suggestion for each pair.
+// GET /api/documents/duplicates?product_id=&threshold=0.92
+func HandleDocumentDuplicates(app *App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
+		if r.Method != http.MethodGet {
 			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
 			return
 		}
-
-		// Require admin session with batch_import permission
-		userID, role, err := GetAdminSession(app, r)
-		if err != nil {
+		if _, _, err := GetAdminSession(app, r); err != nil {
 			WriteAdminSessionError(w, err)
 			return
 		}
-		if role != "super_admin" {
-			perms := app.GetAdminPermissions(userID)
-			hasPerm := false
-			for _, p := range perms {
-				if p == "batch_import" {
-					hasPerm = true
-					break
-				}
-			}
-			if !hasPerm {
-				WriteError(w, http.StatusForbidden, "无批量导入权限")
+		productID := r.URL.Query().Get("product_id")
+		if !IsValidOptionalID(productID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		threshold := document.DefaultDuplicateThreshold
+		if v := r.URL.Query().Get("threshold"); v != "" {
+			t, err := strconv.ParseFloat(v, 64)
+			if err != nil || t < 0.5 || t > 1 {
+				WriteError(w, http.StatusBadRequest, "threshold 必须在 0.5 到 1 之间")
 				return
 			}
+			threshold = t
 		}
+		report, err := app.NearDuplicates(productID, threshold, duplicatePairsLimit)
+		if err != nil {
+			log.Printf("[Documents] near-duplicate report error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "生成重复文档报告失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, report)
+	}
+}
 
-		var req struct {
-			Path      string `json:"path"`
-			ProductID string `json:"product_id"`
+// HandleDocumentTags lists the document categories, topic tags and product
+// mentions in use, with document counts, for the document filters.
+// GET /api/documents/tags?product_id=
+func HandleDocumentTags(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
 		}
-		if err := ReadJSONBody(r, &req); err != nil {
-			WriteError(w, http.StatusBadRequest, "invalid request body")
+		if _, _, err := GetAdminSession(app, r); err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		productID := r.URL.Query().Get("product_id")
+		if !IsValidOptionalID(productID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
 			return
 		}
-		if req.Path == "" {
-			WriteError(w, http.StatusBadRequest, "path is required")
+		summary, err := app.DocumentTagSummary(productID)
+		if err != nil {
+			log.Printf("[Documents] tag summary error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取文档标签失败")
 			return
 		}
+		WriteJSON(w, http.StatusOK, summary)
+	}
+}
 
-		// Validate product ID if provided
-		if req.ProductID != "" {
-			p, err := app.productService.GetByID(req.ProductID)
-			if err != nil || p == nil {
-				WriteError(w, http.StatusBadRequest, fmt.Sprintf("产品不存在(ID: %s)", req.ProductID))
-				return
-			}
-		}
+// relatedLimit returns the limit query parameter of a related documents
+// request: 5 by default, at most 20.
+func relatedLimit(r *http.Request) int {
+	limit := 5
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = min(v, 20)
+	}
+	return limit
+}
 
-		// Validate path exists
-		info, err := os.Stat(req.Path)
+// HandleEmbeddingFingerprints reports which embedding models and dimensions
+// the stored chunks were produced with, and which documents still need to be
+// re-embedded with the configured model.
+// GET /api/admin/embedding/fingerprints
+func HandleEmbeddingFingerprints(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, _, err := GetAdminSession(app, r)
 		if err != nil {
-			WriteError(w, http.StatusBadRequest, fmt.Sprintf("无法访问路径: %v", err))
+			WriteAdminSessionError(w, err)
+			return
+		}
+		report, err := app.EmbeddingFingerprints()
+		if err != nil {
+			log.Printf("[Documents] embedding fingerprints error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取向量模型统计失败")
 			return
 		}
+		WriteJSON(w, http.StatusOK, report)
+	}
+}
 
-		// Collect files
-		var files []string
-		if !info.IsDir() {
-			ext := strings.ToLower(filepath.Ext(req.Path))
-			if _, ok := SupportedExtensions[ext]; ok {
-				files = append(files, req.Path)
-			} else {
-				WriteError(w, http.StatusBadRequest, "不支持的文件格式")
-				return
+// batchImportRequest is the body of /api/batch-import and
+// /api/batch-import/classify.
+type batchImportRequest struct {
+	Path          string   `json:"path"`
+	ProductID     string   `json:"product_id"`
+	Include       []string `json:"include"`
+	Exclude       []string `json:"exclude"`
+	MaxFileSize   string   `json:"max_file_size"`  // e.g. "50MB"
+	ModifiedSince string   `json:"modified_since"` // YYYY-MM-DD
+	DryRun        bool     `json:"dry_run"`        // only estimate, import nothing
+	// Assignments overrides ProductID per file, by absolute path ("" = public
+	// library), typically the reviewed result of /api/batch-import/classify.
+	Assignments map[string]string `json:"assignments"`
+}
+
+// authorizeBatchImport requires an admin session with the batch_import
+// permission. On failure it writes the error response and returns false.
+func authorizeBatchImport(app *App, w http.ResponseWriter, r *http.Request) bool {
+	userID, role, err := GetAdminSession(app, r)
+	if err != nil {
+		WriteAdminSessionError(w, err)
+		return false
+	}
+	if role != "super_admin" {
+		perms := app.GetAdminPermissions(userID)
+		hasPerm := false
+		for _, p := range perms {
+			if p == "batch_import" {
+				hasPerm = true
+				break
 			}
+		}
+		if !hasPerm {
+			WriteError(w, http.StatusForbidden, "无批量导入权限")
+			return false
+		}
+	}
+	return true
+}
+
+// collectBatchImportFiles validates a batch import request and lists the
+// files it selects. On failure it writes the error response and returns false.
+func collectBatchImportFiles(app *App, w http.ResponseWriter, req *batchImportRequest) ([]string, int, bool) {
+	if req.Path == "" {
+		WriteError(w, http.StatusBadRequest, "path is required")
+		return nil, 0, false
+	}
+	if len(req.Include) > 50 || len(req.Exclude) > 50 {
+		WriteError(w, http.StatusBadRequest, "too many patterns")
+		return nil, 0, false
+	}
+	filter, err := document.ParseImportFilter(req.Include, req.Exclude, req.MaxFileSize, req.ModifiedSince)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return nil, 0, false
+	}
+
+	// Validate product IDs if provided
+	productIDs := map[string]bool{req.ProductID: true}
+	for _, id := range req.Assignments {
+		productIDs[id] = true
+	}
+	for id := range productIDs {
+		if id == "" {
+			continue
+		}
+		p, err := app.productService.GetByID(id)
+		if err != nil || p == nil {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("产品不存在(ID: %s)", id))
+			return nil, 0, false
+		}
+		if p.Archived() {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s(%s)", product.ErrArchived.Error(), p.Name))
+			return nil, 0, false
+		}
+	}
+
+	// With files.restrict_to_data_dir, only paths inside the data directory may be imported
+	if _, err := datadir.Contain(req.Path); err != nil {
+		WriteError(w, http.StatusForbidden, "路径不在数据目录内")
+		return nil, 0, false
+	}
+
+	// Validate path exists
+	info, err := os.Stat(req.Path)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, fmt.Sprintf("无法访问路径: %v", err))
+		return nil, 0, false
+	}
+
+	// Collect files
+	var files []string
+	var filtered int
+	if !info.IsDir() {
+		ext := strings.ToLower(filepath.Ext(req.Path))
+		if _, ok := SupportedExtensions[ext]; !ok {
+			WriteError(w, http.StatusBadRequest, "不支持的文件格式")
+			return nil, 0, false
+		}
+		if ok, _ := filter.Match(filepath.Base(req.Path), info); ok {
+			files = append(files, req.Path)
 		} else {
-			filepath.Walk(req.Path, func(path string, fi os.FileInfo, err error) error {
-				if err != nil || fi.IsDir() {
-					return nil
-				}
-				ext := strings.ToLower(filepath.Ext(fi.Name()))
-				if _, ok := SupportedExtensions[ext]; ok {
-					files = append(files, path)
+			filtered++
+		}
+	} else {
+		filepath.Walk(req.Path, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			rel, _ := filepath.Rel(req.Path, path)
+			if fi.IsDir() {
+				if filter.SkipDir(rel) {
+					return filepath.SkipDir
 				}
 				return nil
-			})
+			}
+			ext := strings.ToLower(filepath.Ext(fi.Name()))
+			if _, ok := SupportedExtensions[ext]; !ok {
+				return nil
+			}
+			if ok, _ := filter.Match(rel, fi); !ok {
+				filtered++
+				return nil
+			}
+			// Skip symlinks pointing out of the data directory
+			if _, err := datadir.Contain(path); err == nil {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+
+	if len(files) == 0 {
+		if filtered > 0 {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("未找到符合筛选条件的文件（已排除 %d 个）", filtered))
+			return nil, 0, false
+		}
+		WriteError(w, http.StatusBadRequest, "未找到支持的文件")
+		return nil, 0, false
+	}
+	return files, filtered, true
+}
+
+// HandleBatchImport handles batch file import via SSE (Server-Sent Events).
+func HandleBatchImport(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
 		}
 
-		if len(files) == 0 {
-			WriteError(w, http.StatusBadRequest, "未找到支持的文件")
+		// Require admin session with batch_import permission
+		if !authorizeBatchImport(app, w, r) {
+			return
+		}
+
+		var req batchImportRequest
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		files, filtered, ok := collectBatchImportFiles(app, w, &req)
+		if !ok {
 			return
 		}
 
@@ -496,6 +1164,11 @@ func HandleBatchImport(app *App) http.HandlerFunc {
 			WriteError(w, http.StatusInternalServerError, "streaming not supported")
 			return
 		}
+		// Large imports run past the server's write timeout; the stream was
+		// authorized once above and stays open until the import finishes,
+		// unless the operation token it was authorized with is revoked
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		opToken := r.URL.Query().Get("op_token")
 
 		sendSSE := func(event string, data interface{}) {
 			jsonData, _ := json.Marshal(data)
@@ -504,20 +1177,35 @@ func HandleBatchImport(app *App) http.HandlerFunc {
 		}
 
 		// Send total count
-		sendSSE("start", map[string]int{"total": len(files)})
+		sendSSE("start", map[string]interface{}{"total": len(files), "filtered": filtered, "dry_run": req.DryRun})
+		if req.DryRun {
+			batchImportDryRun(app, r, files, sendSSE)
+			return
+		}
 
 		type failedItem struct {
 			Path   string `json:"path"`
 			Reason string `json:"reason"`
 		}
 
+		// The import shows in the job list, where it can be canceled too
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		job := app.TrackJob(jobs.TypeBatchImport, "", req.Path, func() error { cancel(); return nil })
+
 		var success, failed int
 		var failedFiles []failedItem
 
 		for i, filePath := range files {
-			// Check if client disconnected before processing next file
+			job.Set(i, len(files), filepath.Base(filePath))
+			if opToken != "" && app.opTokens.Revoked(opToken) {
+				cancel()
+			}
+			// Check if client disconnected, the job was canceled or the
+			// token revoked before processing next file
 			select {
-			case <-r.Context().Done():
+			case <-ctx.Done():
+				job.Finish(ctx.Err())
 				sendSSE("done", map[string]interface{}{
 					"total":        len(files),
 					"success":      success,
@@ -548,11 +1236,15 @@ func HandleBatchImport(app *App) http.HandlerFunc {
 				continue
 			}
 
+			productID := req.ProductID
+			if id, ok := req.Assignments[absPath]; ok {
+				productID = id
+			}
 			uploadReq := document.UploadFileRequest{
 				FileName:  fileName,
 				FileData:  fileData,
 				FileType:  fileType,
-				ProductID: req.ProductID,
+				ProductID: productID,
 			}
 			doc, err := app.docManager.UploadFile(uploadReq)
 			if err != nil {
@@ -566,7 +1258,7 @@ func HandleBatchImport(app *App) http.HandlerFunc {
 				})
 				continue
 			}
-			if doc.Status == "failed" {
+			if doc.Status == "failed" || doc.Status == "password_protected" || doc.Status == "quarantined" {
 				reason := fmt.Sprintf("处理失败: %s", doc.Error)
 				failed++
 				failedFiles = append(failedFiles, failedItem{Path: absPath, Reason: reason})
@@ -586,6 +1278,7 @@ func HandleBatchImport(app *App) http.HandlerFunc {
 			})
 		}
 
+		job.Finish(nil)
 		// Send final report
 		sendSSE("done", map[string]interface{}{
 			"total":        len(files),
@@ -595,3 +1288,151 @@ func HandleBatchImport(app *App) http.HandlerFunc {
 		})
 	}
 }
+
+// batchImportDryRun streams the estimate of each file a batch import would
+// pick up, then the totals, without importing anything.
+func batchImportDryRun(app *App, r *http.Request, files []string, sendSSE func(string, interface{})) {
+	type skippedItem struct {
+		Path   string `json:"path"`
+		Reason string `json:"reason"`
+	}
+	var planned, skipped, failed int
+	var skippedFiles []skippedItem
+	total := &document.ImportEstimate{}
+	for i, filePath := range files {
+		if r.Context().Err() != nil {
+			return
+		}
+		absPath, _ := filepath.Abs(filePath)
+		event := map[string]interface{}{
+			"index": i + 1, "total": len(files), "file": absPath,
+			"percent": (i + 1) * 100 / len(files),
+		}
+		fileData, err := os.ReadFile(filePath)
+		var est *document.ImportEstimate
+		if err == nil {
+			est, err = app.docManager.EstimateFile(SupportedExtensions[strings.ToLower(filepath.Ext(filePath))], fileData)
+		}
+		switch {
+		case err != nil:
+			failed++
+			reason := fmt.Sprintf("无法导入: %v", err)
+			skippedFiles = append(skippedFiles, skippedItem{Path: absPath, Reason: reason})
+			event["status"], event["reason"] = "failed", reason
+		case est.DuplicateOf != "":
+			skipped++
+			reason := fmt.Sprintf("与已有文档重复 (ID: %s)", est.DuplicateOf)
+			skippedFiles = append(skippedFiles, skippedItem{Path: absPath, Reason: reason})
+			event["status"], event["reason"] = "skipped", reason
+		default:
+			planned++
+			total.Add(est)
+			event["status"], event["estimate"] = "planned", est
+		}
+		sendSSE("progress", event)
+	}
+	sendSSE("done", map[string]interface{}{
+		"dry_run":       true,
+		"total":         len(files),
+		"planned":       planned,
+		"skipped":       skipped,
+		"failed":        failed,
+		"skipped_files": skippedFiles,
+		"estimate":      total,
+	})
+}
+
+// HandleBatchImportClassify proposes a product for each file a batch import
+// would pick up, streamed via SSE like the import itself. Nothing is
+// imported; the admin reviews the proposals and passes them back to
+// /api/batch-import as assignments.
+func HandleBatchImportClassify(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if !authorizeBatchImport(app, w, r) {
+			return
+		}
+
+		var req batchImportRequest
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		files, filtered, ok := collectBatchImportFiles(app, w, &req)
+		if !ok {
+			return
+		}
+		products, err := app.productService.List()
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "获取产品列表失败")
+			return
+		}
+		// Archived products take no new documents
+		var candidates []document.ProductCandidate
+		for _, p := range products {
+			if !p.Archived() {
+				candidates = append(candidates, document.ProductCandidate{ID: p.ID, Name: p.Name, Description: p.Description})
+			}
+		}
+		if len(candidates) == 0 {
+			WriteError(w, http.StatusBadRequest, "系统中没有产品，无法自动分类")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			WriteError(w, http.StatusInternalServerError, "streaming not supported")
+			return
+		}
+		// Classifying many files with the LLM takes longer than the server's
+		// write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		sendSSE := func(event string, data interface{}) {
+			jsonData, _ := json.Marshal(data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, jsonData)
+			flusher.Flush()
+		}
+
+		type classifiedFile struct {
+			Path string `json:"path"`
+			document.ProductSuggestion
+		}
+		sendSSE("start", map[string]interface{}{"total": len(files), "filtered": filtered})
+		var classified []classifiedFile
+		for i, filePath := range files {
+			if r.Context().Err() != nil {
+				return
+			}
+			absPath, _ := filepath.Abs(filePath)
+			item := classifiedFile{Path: absPath}
+			fileData, err := os.ReadFile(filePath)
+			var s *document.ProductSuggestion
+			if err == nil {
+				s, err = app.docManager.ClassifyProduct(filepath.Base(filePath), SupportedExtensions[strings.ToLower(filepath.Ext(filePath))], fileData, candidates)
+			}
+			if err != nil {
+				item.Error = err.Error()
+			} else {
+				item.ProductSuggestion = *s
+			}
+			classified = append(classified, item)
+			sendSSE("progress", map[string]interface{}{
+				"index": i + 1, "total": len(files), "file": absPath,
+				"percent": (i + 1) * 100 / len(files),
+				"product_id": item.ProductID, "product_name": item.ProductName, "error": item.Error,
+			})
+		}
+		sendSSE("done", map[string]interface{}{
+			"total":    len(files),
+			"files":    classified,
+			"products": candidates,
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"askflow/internal/feed"
+)
+
+// HandleFeeds handles GET (list) and POST (subscribe) for RSS/Atom feeds.
+// GET /api/feeds?product_id=
+// POST /api/feeds {"product_id": "...", "url": "...", "interval_min": 60}
+func HandleFeeds(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			productID := r.URL.Query().Get("product_id")
+			if !IsValidOptionalID(productID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			feeds, err := app.ListFeeds(productID)
+			if err != nil {
+				log.Printf("[Feeds] list error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取订阅源列表失败")
+				return
+			}
+			if feeds == nil {
+				feeds = []feed.Feed{}
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"feeds": feeds})
+
+		case http.MethodPost:
+			var req struct {
+				ProductID   string `json:"product_id"`
+				URL         string `json:"url"`
+				IntervalMin int    `json:"interval_min"`
+			}
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if !IsValidOptionalID(req.ProductID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			if req.ProductID != "" {
+				if _, err := app.GetProduct(req.ProductID); err != nil {
+					WriteError(w, http.StatusBadRequest, "产品不存在")
+					return
+				}
+			}
+			f, err := app.CreateFeed(req.ProductID, req.URL, req.IntervalMin)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, f)
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleFeedByID handles PUT (update), DELETE and POST .../refresh for a single feed.
+func HandleFeedByID(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		rest := strings.TrimPrefix(r.URL.Path, "/api/feeds/")
+		id, action, _ := strings.Cut(rest, "/")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid feed ID")
+			return
+		}
+
+		if action == "refresh" {
+			if r.Method != http.MethodPost {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			result, err := app.PollFeed(id)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, result)
+			return
+		}
+		if action != "" {
+			WriteError(w, http.StatusNotFound, "not found")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			var req struct {
+				IntervalMin int  `json:"interval_min"`
+				Enabled     bool `json:"enabled"`
+			}
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			f, err := app.UpdateFeed(id, req.IntervalMin, req.Enabled)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, f)
+
+		case http.MethodDelete:
+			if err := app.DeleteFeed(id); err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"message": "订阅源已删除"})
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
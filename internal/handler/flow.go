@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"askflow/internal/flow"
+)
+
+// HandleFlows handles GET (list) and POST (create) for troubleshooting flows.
+// GET /api/flows?product_id=
+// POST /api/flows {"product_id": "...", "title": "...", "description": "...", "enabled": true, "start": "...", "nodes": [...]}
+func HandleFlows(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			productID := r.URL.Query().Get("product_id")
+			if !IsValidOptionalID(productID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			flows, err := app.ListFlows(productID)
+			if err != nil {
+				log.Printf("[Flow] list error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取排查流程失败")
+				return
+			}
+			if flows == nil {
+				flows = []flow.Flow{}
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"flows": flows})
+
+		case http.MethodPost:
+			var req struct {
+				ProductID string `json:"product_id"`
+				flow.Input
+			}
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if !IsValidOptionalID(req.ProductID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			if req.ProductID != "" {
+				if _, err := app.GetProduct(req.ProductID); err != nil {
+					WriteError(w, http.StatusBadRequest, "产品不存在")
+					return
+				}
+			}
+			f, err := app.CreateFlow(req.ProductID, req.Input)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, f)
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleFlowByID handles GET, PUT (update) and DELETE for a single troubleshooting flow.
+func HandleFlowByID(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, "/api/flows/")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid flow ID")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			f, err := app.GetFlow(id)
+			if err != nil {
+				WriteError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, f)
+
+		case http.MethodPut:
+			var req flow.Input
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			f, err := app.UpdateFlow(id, req)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, f)
+
+		case http.MethodDelete:
+			if err := app.DeleteFlow(id); err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"message": "流程已删除"})
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleAvailableFlows lists the enabled flows a chat user can start.
+// GET /api/flows/available?product_id=
+func HandleAvailableFlows(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, err := GetUserSession(app, r); err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		productID := r.URL.Query().Get("product_id")
+		if !IsValidOptionalID(productID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		flows, err := app.AvailableFlows(productID)
+		if err != nil {
+			log.Printf("[Flow] available error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取排查流程失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"flows": flows})
+	}
+}
+
+// HandleFlowWalk returns the node reached in a flow by the options chosen so
+// far. An empty path returns the start node.
+// POST /api/flows/walk {"flow_id": "...", "path": [0, 2]}
+func HandleFlowWalk(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, err := GetUserSession(app, r); err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		var req struct {
+			FlowID string `json:"flow_id"`
+			Path   []int  `json:"path"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if !IsValidHexID(req.FlowID) {
+			WriteError(w, http.StatusBadRequest, "invalid flow ID")
+			return
+		}
+		pos, err := app.WalkFlow(req.FlowID, req.Path)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, pos)
+	}
+}
+
+// HandleFlowRoute picks the flow, if any, that fits a free-text question.
+// POST /api/flows/route {"question": "...", "product_id": "..."}
+func HandleFlowRoute(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, err := GetUserSession(app, r); err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		var req struct {
+			Question  string `json:"question"`
+			ProductID string `json:"product_id"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if !IsValidOptionalID(req.ProductID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		if len(req.Question) > 10000 {
+			WriteError(w, http.StatusBadRequest, "question too long")
+			return
+		}
+		match, err := app.RouteToFlow(req.Question, req.ProductID)
+		if err != nil {
+			// Routing is a suggestion; the regular answer still goes through.
+			log.Printf("[Flow] route error: %v", err)
+			match = nil
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"flow": match})
+	}
+}
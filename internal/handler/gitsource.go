@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"askflow/internal/gitsource"
+)
+
+// HandleGitSources handles GET (list) and POST (register) for Git sources.
+// GET /api/git-sources?product_id=
+// POST /api/git-sources {"product_id": "...", "repo_url": "https://...", "branch": "main", "path": "docs", "access_token": "...", "interval_min": 1440}
+func HandleGitSources(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			productID := r.URL.Query().Get("product_id")
+			if !IsValidOptionalID(productID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			sources, err := app.ListGitSources(productID)
+			if err != nil {
+				log.Printf("[GitSources] list error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取仓库列表失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"sources": sources})
+
+		case http.MethodPost:
+			var req gitsource.CreateRequest
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if !IsValidOptionalID(req.ProductID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			if req.ProductID != "" {
+				if _, err := app.GetProduct(req.ProductID); err != nil {
+					WriteError(w, http.StatusBadRequest, "产品不存在")
+					return
+				}
+			}
+			src, err := app.CreateGitSource(req)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, src)
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleGitSourceByID handles a single Git source.
+// GET    /api/git-sources/{id}
+// PUT    /api/git-sources/{id} {"interval_min": 1440, "enabled": true}
+// DELETE /api/git-sources/{id}
+// GET    /api/git-sources/{id}/files
+// POST   /api/git-sources/{id}/sync
+func HandleGitSourceByID(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		rest := strings.TrimPrefix(r.URL.Path, "/api/git-sources/")
+		id, action, _ := strings.Cut(rest, "/")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid source ID")
+			return
+		}
+
+		switch action {
+		case "sync":
+			if r.Method != http.MethodPost {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			// Cloning a large repository takes longer than the server's write timeout
+			http.NewResponseController(w).SetWriteDeadline(time.Time{})
+			result, err := app.SyncGitSource(id)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, result)
+			return
+		case "files":
+			if r.Method != http.MethodGet {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			files, err := app.GitSourceFiles(id)
+			if err != nil {
+				WriteError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"files": files})
+			return
+		case "":
+		default:
+			WriteError(w, http.StatusNotFound, "not found")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			src, err := app.GetGitSource(id)
+			if err != nil {
+				WriteError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, src)
+
+		case http.MethodPut:
+			var req struct {
+				IntervalMin int  `json:"interval_min"`
+				Enabled     bool `json:"enabled"`
+			}
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			src, err := app.UpdateGitSource(id, req.IntervalMin, req.Enabled)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, src)
+
+		case http.MethodDelete:
+			if err := app.DeleteGitSource(id); err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"message": "仓库来源已删除"})
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"askflow/internal/glossary"
+)
+
+// HandleGlossary handles GET (list) and POST (create) for glossary terms.
+// GET /api/glossary?product_id=
+// POST /api/glossary {"product_id": "...", "term": "...", "deprecated": ["..."], "note": "...", "do_not_translate": false}
+func HandleGlossary(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			productID := r.URL.Query().Get("product_id")
+			if !IsValidOptionalID(productID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			terms, err := app.ListGlossaryTerms(productID)
+			if err != nil {
+				log.Printf("[Glossary] list error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取术语表失败")
+				return
+			}
+			if terms == nil {
+				terms = []glossary.Term{}
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"terms": terms})
+
+		case http.MethodPost:
+			var req struct {
+				ProductID      string   `json:"product_id"`
+				Term           string   `json:"term"`
+				Deprecated     []string `json:"deprecated"`
+				Note           string   `json:"note"`
+				DoNotTranslate bool     `json:"do_not_translate"`
+			}
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if !IsValidOptionalID(req.ProductID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			if req.ProductID != "" {
+				if _, err := app.GetProduct(req.ProductID); err != nil {
+					WriteError(w, http.StatusBadRequest, "产品不存在")
+					return
+				}
+			}
+			t, err := app.CreateGlossaryTerm(req.ProductID, req.Term, req.Deprecated, req.Note, req.DoNotTranslate)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, t)
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleGlossaryTermByID handles PUT (update) and DELETE for a single glossary term.
+func HandleGlossaryTermByID(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, "/api/glossary/")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid term ID")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			var req struct {
+				Term           string   `json:"term"`
+				Deprecated     []string `json:"deprecated"`
+				Note           string   `json:"note"`
+				DoNotTranslate bool     `json:"do_not_translate"`
+			}
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			t, err := app.UpdateGlossaryTerm(id, req.Term, req.Deprecated, req.Note, req.DoNotTranslate)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, t)
+
+		case http.MethodDelete:
+			if err := app.DeleteGlossaryTerm(id); err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"message": "术语已删除"})
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleTerminologyCheck scans a product's chunks for deprecated terminology and
+// reports affected documents with suggested replacements.
+// GET /api/glossary/check?product_id=
+func HandleTerminologyCheck(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		productID := r.URL.Query().Get("product_id")
+		if !IsValidOptionalID(productID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		report, err := app.CheckTerminology(productID)
+		if err != nil {
+			log.Printf("[Glossary] check error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "术语检查失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, report)
+	}
+}
+
+// HandleTerminologyRewrite replaces deprecated terminology with the preferred
+// terms and re-embeds the changed chunks. Without document_ids every document
+// reported by the checker is rewritten.
+// POST /api/glossary/rewrite {"product_id": "...", "document_ids": ["..."]}
+func HandleTerminologyRewrite(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		var req struct {
+			ProductID   string   `json:"product_id"`
+			DocumentIDs []string `json:"document_ids"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if !IsValidOptionalID(req.ProductID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		for _, id := range req.DocumentIDs {
+			if !IsValidHexID(id) {
+				WriteError(w, http.StatusBadRequest, "invalid document ID")
+				return
+			}
+		}
+		result, err := app.RewriteTerminology(req.ProductID, req.DocumentIDs)
+		if err != nil {
+			log.Printf("[Glossary] rewrite error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "术语替换失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, result)
+	}
+}
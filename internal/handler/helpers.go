@@ -6,6 +6,9 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
+
+	"askflow/internal/apikey"
 )
 
 // ForbiddenError represents a 403 Forbidden error, distinct from 401 Unauthorized.
@@ -68,8 +71,63 @@ func ReadJSONBody(r *http.Request, v interface{}) error {
 	return nil
 }
 
+// apiKeyScheme is the Authorization scheme of requests made with an API key.
+const apiKeyScheme = "ApiKey "
+
+// apiKeyResources maps admin endpoint prefixes to the resource part of the
+// API key scope they need: <resource>:read for GET, <resource>:write for
+// other methods. Endpoints not listed cannot be called with an API key.
+var apiKeyResources = []struct{ prefix, resource string }{
+	{"/api/documents", "documents"},
+	{"/api/knowledge", "documents"},
+	{"/api/images/upload", "documents"},
+	{"/api/pending", "pending"},
+	{"/api/products", "products"},
+	{"/api/admin/reports/", "reports"},
+}
+
+// adminAPIKeyScope returns the API key scope an admin request needs, or ""
+// when the endpoint is not open to API keys.
+func adminAPIKeyScope(r *http.Request) string {
+	for _, res := range apiKeyResources {
+		if strings.HasPrefix(r.URL.Path, res.prefix) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				return res.resource + ":read"
+			}
+			return res.resource + ":write"
+		}
+	}
+	return ""
+}
+
+// getAPIKey authenticates a request made with "Authorization: ApiKey <key>"
+// and checks that the key grants scope. ok is false when the request does
+// not carry an API key.
+func getAPIKey(app *App, r *http.Request, scope string) (key *apikey.Key, ok bool, err error) {
+	authHeader := r.Header.Get("Authorization")
+	secret, found := strings.CutPrefix(authHeader, apiKeyScheme)
+	if !found {
+		return nil, false, nil
+	}
+	key, err = app.apiKeys.Authenticate(strings.TrimSpace(secret))
+	if err != nil {
+		return nil, true, err
+	}
+	if scope == "" || !key.HasScope(scope) {
+		return nil, true, &ForbiddenError{Message: "API 密钥无权访问此接口"}
+	}
+	return key, true, nil
+}
+
 // GetUserSession validates the Authorization bearer token and returns the user ID.
+// Requests made with an API key need the "query" scope and act as the key's user.
 func GetUserSession(app *App, r *http.Request) (string, error) {
+	if key, ok, err := getAPIKey(app, r, apikey.ScopeQuery); ok {
+		if err != nil {
+			return "", err
+		}
+		return apikey.UserID(key.ID), nil
+	}
 	authHeader := r.Header.Get("Authorization")
 	token := strings.TrimPrefix(authHeader, "Bearer ")
 	if token == "" || token == authHeader {
@@ -83,10 +141,16 @@ func GetUserSession(app *App, r *http.Request) (string, error) {
 	return session.UserID, nil
 }
 
-// GetAdminSession validates the session and checks if it's an admin session.
-// Returns (userID, role, error). role is "super_admin", "editor", or "anonymous_viewer".
-// Anonymous viewers are restricted to GET requests only.
-func GetAdminSession(app *App, r *http.Request) (string, string, error) {
+// GetUserSessionID validates the user session like GetUserSession and also
+// returns the session ID, for state that is scoped to a single login session.
+func GetUserSessionID(app *App, r *http.Request) (sessionID, userID string, err error) {
+	if key, ok, err := getAPIKey(app, r, apikey.ScopeQuery); ok {
+		if err != nil {
+			return "", "", err
+		}
+		// An API key has no login sessions; its state is kept per key
+		return apikey.UserID(key.ID), apikey.UserID(key.ID), nil
+	}
 	authHeader := r.Header.Get("Authorization")
 	token := strings.TrimPrefix(authHeader, "Bearer ")
 	if token == "" || token == authHeader {
@@ -94,12 +158,48 @@ func GetAdminSession(app *App, r *http.Request) (string, string, error) {
 	}
 	session, err := app.sessionManager.ValidateSession(token)
 	if err != nil {
-		return "", "", fmt.Errorf("会话无效")
+		return "", "", fmt.Errorf("会话已过期")
+	}
+	return session.ID, session.UserID, nil
+}
+
+// GetAdminSession validates the session and checks if it's an admin session.
+// Returns (userID, role, error). role is "super_admin", "editor", or "anonymous_viewer".
+// Anonymous viewers are restricted to GET requests only. Requests made with
+// an API key act as an editor and need the scope of the endpoint (see
+// apiKeyResources).
+func GetAdminSession(app *App, r *http.Request) (string, string, error) {
+	if key, ok, err := getAPIKey(app, r, adminAPIKeyScope(r)); ok {
+		if err != nil {
+			return "", "", err
+		}
+		return apikey.UserID(key.ID), "editor", nil
+	}
+	var userID string
+	if opToken := r.URL.Query().Get("op_token"); opToken != "" {
+		// An operation token stands in for the session on the one request it
+		// was minted for; the admin's role is still checked as of now.
+		uid, err := app.VerifyOperationToken(opToken, r)
+		if err != nil {
+			return "", "", fmt.Errorf("操作令牌无效或已过期")
+		}
+		userID = uid
+	} else {
+		authHeader := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		if token == "" || token == authHeader {
+			return "", "", fmt.Errorf("未登录")
+		}
+		session, err := app.sessionManager.ValidateSession(token)
+		if err != nil {
+			return "", "", fmt.Errorf("会话无效")
+		}
+		userID = session.UserID
 	}
-	if !app.IsAdminSession(session.UserID) {
+	if !app.IsAdminSession(userID) {
 		return "", "", fmt.Errorf("无权限")
 	}
-	role := app.GetAdminRole(session.UserID)
+	role := app.GetAdminRole(userID)
 	if role == "" {
 		return "", "", fmt.Errorf("无权限")
 	}
@@ -107,7 +207,7 @@ func GetAdminSession(app *App, r *http.Request) (string, string, error) {
 	if role == "anonymous_viewer" && r.Method != http.MethodGet {
 		return "", "", &ForbiddenError{Message: "此为参观模式，一切更改都不会生效"}
 	}
-	return session.UserID, role, nil
+	return userID, role, nil
 }
 
 // WriteAdminSessionError writes the appropriate HTTP error for a GetAdminSession failure.
@@ -153,6 +253,26 @@ func IsValidVideoMagicBytes(data []byte) bool {
 	return false
 }
 
+// IsValidAudioMagicBytes checks if the file data starts with known audio format magic bytes.
+func IsValidAudioMagicBytes(data []byte) bool {
+	if len(data) < 12 {
+		return false
+	}
+	// MP3: ID3 tag or MPEG audio frame sync
+	if string(data[0:3]) == "ID3" || (data[0] == 0xFF && data[1]&0xE0 == 0xE0) {
+		return true
+	}
+	// WAV: starts with RIFF....WAVE
+	if string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE" {
+		return true
+	}
+	// M4A: MP4 container with ftyp box (offset 4)
+	if string(data[4:8]) == "ftyp" {
+		return true
+	}
+	return false
+}
+
 // IsValidOptionalID validates an optional ID parameter (empty is allowed, non-empty must be hex).
 func IsValidOptionalID(id string) bool {
 	if id == "" {
@@ -191,6 +311,10 @@ func DetectFileType(filename string) string {
 		return "markdown"
 	case strings.HasSuffix(lower, ".html"), strings.HasSuffix(lower, ".htm"):
 		return "html"
+	case strings.HasSuffix(lower, ".txt"):
+		return "text"
+	case strings.HasSuffix(lower, ".csv"):
+		return "csv"
 	case strings.HasSuffix(lower, ".mp4"):
 		return "mp4"
 	case strings.HasSuffix(lower, ".avi"):
@@ -201,32 +325,52 @@ func DetectFileType(filename string) string {
 		return "mov"
 	case strings.HasSuffix(lower, ".webm"):
 		return "webm"
+	case strings.HasSuffix(lower, ".mp3"):
+		return "mp3"
+	case strings.HasSuffix(lower, ".wav"):
+		return "wav"
+	case strings.HasSuffix(lower, ".m4a"):
+		return "m4a"
 	default:
 		return "unknown"
 	}
 }
 
-// ValidatePassword checks password length and complexity requirements.
-// Returns an error message if validation fails, or empty string if valid.
-func ValidatePassword(password string) string {
-	if len(password) < 8 {
-		return "密码至少8位"
-	}
-	if len(password) > 72 {
-		return "密码不能超过72位"
-	}
-	hasLetter := false
-	hasDigit := false
-	for _, c := range password {
-		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
-			hasLetter = true
-		}
-		if c >= '0' && c <= '9' {
-			hasDigit = true
+// SessionActivity wraps a handler so that requests made with a session token
+// count as activity of the session, extending its expiry. The resulting
+// expiry is reported in the X-Session-Expires-At and X-Session-Max-Expires-At
+// headers (RFC 3339) so the frontend can warn before the session ends.
+// Invalid tokens are left for the handler to reject.
+func SessionActivity(app *App) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if token, ok := strings.CutPrefix(authHeader, "Bearer "); ok && token != "" {
+				if session, err := app.sessionManager.ValidateSession(token); err == nil {
+					w.Header().Set("X-Session-Expires-At", session.ExpiresAt.Format(time.RFC3339))
+					w.Header().Set("X-Session-Max-Expires-At", session.MaxExpiresAt.Format(time.RFC3339))
+				}
+			}
+			next(w, r)
 		}
 	}
-	if !hasLetter || !hasDigit {
-		return "密码必须包含字母和数字"
+}
+
+// ReadOnlyGuard wraps a handler so that mutating requests (anything other than
+// GET/HEAD/OPTIONS) are rejected while read-only demo mode is enabled.
+// Read requests pass through unchanged so admin pages stay browsable.
+func ReadOnlyGuard(app *App) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				if app.IsReadOnly() {
+					WriteError(w, http.StatusForbidden, "演示模式（只读）下不允许此操作")
+					return
+				}
+			}
+			next(w, r)
+		}
 	}
-	return ""
 }
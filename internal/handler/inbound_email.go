@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"askflow/internal/mailin"
+)
+
+// maxInboundEmailBytes limits the size of a posted email, attachments included.
+const maxInboundEmailBytes = 25 << 20
+
+// HandleInboundEmail receives emails from the mail provider's inbound
+// webhook and converts them into draft knowledge entries. The provider
+// authenticates with the configured token, as a Bearer token, an
+// X-Inbound-Token header or a token query parameter. Accepted bodies:
+//   - a raw RFC 5322 message (message/rfc822 or text/plain)
+//   - a form with the raw message in "email" or "body-mime", or with fields
+//     from, to/recipient, subject, text/body-plain, html/body-html and image files
+//   - JSON with "raw", or From, To, Subject, TextBody, HtmlBody, MessageID
+//     and Attachments [{Name, ContentType, Content (base64)}]
+//
+// POST /api/inbound-email
+func HandleInboundEmail(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		token := app.EmailIngestToken()
+		if token == "" {
+			WriteError(w, http.StatusNotFound, "邮件导入未启用")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(inboundEmailToken(r)), []byte(token)) != 1 {
+			WriteError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxInboundEmailBytes)
+		msg, err := readInboundEmail(r)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		result, err := app.IngestEmail(msg)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, result)
+	}
+}
+
+// inboundEmailToken returns the token presented by the mail provider.
+func inboundEmailToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if t := r.Header.Get("X-Inbound-Token"); t != "" {
+		return t
+	}
+	return r.URL.Query().Get("token")
+}
+
+// readInboundEmail reads the posted email in any of the accepted formats.
+func readInboundEmail(r *http.Request) (*mailin.Message, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		return readInboundEmailJSON(r.Body)
+	case "multipart/form-data", "application/x-www-form-urlencoded":
+		return readInboundEmailForm(r)
+	default:
+		raw, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, errInboundEmailBody(err)
+		}
+		return mailin.Parse(raw)
+	}
+}
+
+// errInboundEmailBody reports a body that could not be read.
+func errInboundEmailBody(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return errors.New("邮件过大（最大25MB）")
+	}
+	return errors.New("failed to read request body")
+}
+
+// readInboundEmailJSON reads a JSON webhook payload. Field names match case
+// insensitively, so both {"from": ...} and Postmark's {"From": ...} work.
+func readInboundEmailJSON(body io.Reader) (*mailin.Message, error) {
+	var req struct {
+		Raw         string `json:"raw"`
+		MessageID   string `json:"message_id"`
+		From        string `json:"from"`
+		To          string `json:"to"`
+		Subject     string `json:"subject"`
+		Text        string `json:"text"`
+		HTML        string `json:"html"`
+		TextBody    string `json:"textbody"`
+		HTMLBody    string `json:"htmlbody"`
+		Attachments []struct {
+			Name        string `json:"name"`
+			ContentType string `json:"contenttype"`
+			Content     string `json:"content"`
+		} `json:"attachments"`
+	}
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, errInboundEmailBody(err)
+		}
+		return nil, errors.New("invalid request body")
+	}
+	if req.Raw != "" {
+		return mailin.Parse([]byte(req.Raw))
+	}
+	msg := &mailin.Message{
+		MessageID: strings.Trim(strings.TrimSpace(req.MessageID), "<>"),
+		From:      mailin.ParseAddress(req.From),
+		To:        mailin.ParseAddressList(req.To),
+		Subject:   strings.TrimSpace(req.Subject),
+		Text:      firstNonEmpty(req.Text, req.TextBody),
+		HTML:      firstNonEmpty(req.HTML, req.HTMLBody),
+	}
+	for _, a := range req.Attachments {
+		if !strings.HasPrefix(a.ContentType, "image/") {
+			continue
+		}
+		if data, err := base64.StdEncoding.DecodeString(a.Content); err == nil {
+			msg.Attachments = append(msg.Attachments, mailin.Attachment{Filename: a.Name, ContentType: a.ContentType, Data: data})
+		}
+	}
+	return msg, nil
+}
+
+// readInboundEmailForm reads a form webhook payload, as posted by SendGrid
+// and Mailgun.
+func readInboundEmailForm(r *http.Request) (*mailin.Message, error) {
+	if err := r.ParseMultipartForm(maxInboundEmailBytes); err != nil && err != http.ErrNotMultipart {
+		return nil, errInboundEmailBody(err)
+	}
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+	for _, field := range []string{"email", "body-mime", "raw"} {
+		if raw := r.FormValue(field); raw != "" {
+			msg, err := mailin.Parse([]byte(raw))
+			if err != nil {
+				return nil, err
+			}
+			// The mailbox may only be on the envelope, e.g. for Bcc
+			msg.To = append(msg.To, formRecipients(r)...)
+			return msg, nil
+		}
+	}
+	msg := &mailin.Message{
+		MessageID: strings.Trim(strings.TrimSpace(firstNonEmpty(r.FormValue("Message-Id"), r.FormValue("message-id"))), "<>"),
+		From:      mailin.ParseAddress(firstNonEmpty(r.FormValue("from"), r.FormValue("sender"))),
+		To:        formRecipients(r),
+		Subject:   strings.TrimSpace(r.FormValue("subject")),
+		Text:      firstNonEmpty(r.FormValue("text"), r.FormValue("body-plain")),
+		HTML:      firstNonEmpty(r.FormValue("html"), r.FormValue("body-html")),
+	}
+	if r.MultipartForm != nil {
+		for _, files := range r.MultipartForm.File {
+			for _, fh := range files {
+				f, err := fh.Open()
+				if err != nil {
+					continue
+				}
+				data, err := io.ReadAll(f)
+				f.Close()
+				if err == nil && strings.HasPrefix(http.DetectContentType(data), "image/") {
+					msg.Attachments = append(msg.Attachments, mailin.Attachment{
+						Filename: fh.Filename, ContentType: fh.Header.Get("Content-Type"), Data: data,
+					})
+				}
+			}
+		}
+	}
+	return msg, nil
+}
+
+// formRecipients returns the recipients of a form payload: Mailgun's
+// "recipient", the "to" header and SendGrid's envelope.
+func formRecipients(r *http.Request) []string {
+	addrs := mailin.ParseAddressList(r.FormValue("recipient"))
+	addrs = append(addrs, mailin.ParseAddressList(r.FormValue("to"))...)
+	var envelope struct {
+		To []string `json:"to"`
+	}
+	if json.Unmarshal([]byte(r.FormValue("envelope")), &envelope) == nil {
+		for _, to := range envelope.To {
+			addrs = append(addrs, mailin.ParseAddress(to))
+		}
+	}
+	return addrs
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
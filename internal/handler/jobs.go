@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"askflow/internal/jobs"
+)
+
+// HandleJobs lists background jobs, newest first, with the number of jobs
+// queued and running and the configured concurrency. Optional query parameters: status, type, limit, offset.
+// GET /api/admin/jobs
+func HandleJobs(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, _, err := GetAdminSession(app, r); err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		q := r.URL.Query()
+		f := jobs.ListFilter{Status: q.Get("status"), Type: q.Get("type")}
+		f.Limit, _ = strconv.Atoi(q.Get("limit"))
+		f.Offset, _ = strconv.Atoi(q.Get("offset"))
+		list, total, err := app.ListJobs(f)
+		if err != nil {
+			log.Printf("[Jobs] list error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取后台任务失败")
+			return
+		}
+		queued, running := app.JobCounts()
+		concurrency := jobs.DefaultConcurrency
+		if cfg := app.configManager.Get(); cfg != nil {
+			concurrency = cfg.Jobs.Concurrency
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"jobs":        list,
+			"total":       total,
+			"queued":      queued,
+			"running":     running,
+			"concurrency": concurrency,
+		})
+	}
+}
+
+// HandleJobCancel cancels a queued or running background job.
+// POST /api/admin/jobs/{id}/cancel
+func HandleJobCancel(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		userID, role, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		if role != "super_admin" {
+			WriteError(w, http.StatusForbidden, "仅超级管理员可取消后台任务")
+			return
+		}
+		id, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/admin/jobs/"), "/cancel")
+		if !ok || !IsValidHexID(id) {
+			WriteError(w, http.StatusNotFound, "not found")
+			return
+		}
+		if err := app.CancelJob(id); err != nil {
+			switch {
+			case errors.Is(err, jobs.ErrNotFound):
+				WriteError(w, http.StatusNotFound, "任务不存在")
+			case errors.Is(err, jobs.ErrFinished):
+				WriteError(w, http.StatusConflict, "任务已结束")
+			case errors.Is(err, jobs.ErrNotCancelable):
+				WriteError(w, http.StatusConflict, "任务当前阶段无法取消")
+			default:
+				log.Printf("[Jobs] cancel error for %s: %v", id, err)
+				WriteError(w, http.StatusInternalServerError, "取消任务失败")
+			}
+			return
+		}
+		log.Printf("[Jobs] job %s canceled by %s", id, userID)
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
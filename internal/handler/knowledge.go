@@ -2,12 +2,16 @@ package handler
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
+
+	"askflow/internal/datadir"
+	"askflow/internal/document"
 )
 
 // --- Knowledge entry handler ---
@@ -69,26 +73,13 @@ func HandleImageUpload(app *App) http.HandlerFunc {
 			return
 		}
 
-		// Generate unique filename
-		b := make([]byte, 16)
-		if _, err := rand.Read(b); err != nil {
-			WriteError(w, http.StatusInternalServerError, "failed to generate ID")
-			return
-		}
-		filename := fmt.Sprintf("%x%s", b, ext)
-
-		// Save to data/images/
-		imgDir := filepath.Join(".", "data", "images")
-		if err := os.MkdirAll(imgDir, 0755); err != nil {
-			WriteError(w, http.StatusInternalServerError, "failed to create image dir")
-			return
-		}
-		if err := os.WriteFile(filepath.Join(imgDir, filename), data, 0644); err != nil {
+		// Save to data/images/ under its content hash so identical uploads share one file
+		url, err := app.docManager.SaveUploadedImage(data)
+		if err != nil {
+			log.Printf("[Knowledge] failed to save image: %v", err)
 			WriteError(w, http.StatusInternalServerError, "failed to save image")
 			return
 		}
-
-		url := "/api/images/" + filename
 		WriteJSON(w, http.StatusOK, map[string]string{"url": url})
 	}
 }
@@ -160,12 +151,12 @@ func HandleKnowledgeVideoUpload(app *App) http.HandlerFunc {
 		filename := fmt.Sprintf("%x%s", b, ext)
 
 		// Save to data/videos/knowledge/
-		videoDir := filepath.Join(".", "data", "videos", "knowledge")
-		if err := os.MkdirAll(videoDir, 0755); err != nil {
+		videoDir := datadir.Path("videos", "knowledge")
+		if err := datadir.MkdirAll(videoDir); err != nil {
 			WriteError(w, http.StatusInternalServerError, "failed to create video dir")
 			return
 		}
-		if err := os.WriteFile(filepath.Join(videoDir, filename), data, 0644); err != nil {
+		if err := datadir.WriteFile(filepath.Join(videoDir, filename), data); err != nil {
 			WriteError(w, http.StatusInternalServerError, "failed to save video")
 			return
 		}
@@ -175,27 +166,112 @@ func HandleKnowledgeVideoUpload(app *App) http.HandlerFunc {
 	}
 }
 
-// HandleKnowledgeEntry handles direct knowledge entry creation (text + images).
+// HandleKnowledgeEntry handles GET (list) and POST (create) for knowledge
+// entries entered directly (text + images).
+// GET /api/knowledge?product_id=
 func HandleKnowledgeEntry(app *App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		userID, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
 			return
 		}
-		_, _, err := GetAdminSession(app, r)
+		switch r.Method {
+		case http.MethodGet:
+			productID := r.URL.Query().Get("product_id")
+			if !IsValidOptionalID(productID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			entries, err := app.ListKnowledgeEntries(productID)
+			if err != nil {
+				log.Printf("[Knowledge] list error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取知识条目失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+
+		case http.MethodPost:
+			var req KnowledgeEntryRequest
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			reviewStatus, err := app.AddKnowledgeEntry(req, userID)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"status": "ok", "review_status": reviewStatus})
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleKnowledgeEntryByID handles GET, PUT (edit) and DELETE for a single
+// knowledge entry.
+// PUT /api/knowledge/{id} {"title": "...", "content": "...", "image_urls": [...], "video_urls": [...], "format": "markdown", "publish_at": "", "unpublish_at": ""}
+func HandleKnowledgeEntryByID(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _, err := GetAdminSession(app, r)
 		if err != nil {
 			WriteAdminSessionError(w, err)
 			return
 		}
-		var req KnowledgeEntryRequest
-		if err := ReadJSONBody(r, &req); err != nil {
-			WriteError(w, http.StatusBadRequest, "invalid request body")
+		id := strings.TrimPrefix(r.URL.Path, "/api/knowledge/")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid knowledge entry ID")
 			return
 		}
-		if err := app.AddKnowledgeEntry(req); err != nil {
-			WriteError(w, http.StatusBadRequest, err.Error())
-			return
+
+		switch r.Method {
+		case http.MethodGet:
+			entry, err := app.GetKnowledgeEntry(id)
+			if errors.Is(err, document.ErrKnowledgeNotFound) {
+				WriteError(w, http.StatusNotFound, "知识条目不存在")
+				return
+			}
+			if err != nil {
+				log.Printf("[Knowledge] get error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取知识条目失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, entry)
+
+		case http.MethodPut:
+			var req KnowledgeEntryRequest
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			reviewStatus, err := app.UpdateKnowledgeEntry(id, req, userID)
+			if errors.Is(err, document.ErrKnowledgeNotFound) {
+				WriteError(w, http.StatusNotFound, "知识条目不存在")
+				return
+			}
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"status": "ok", "review_status": reviewStatus})
+
+		case http.MethodDelete:
+			err := app.DeleteKnowledgeEntry(id)
+			if errors.Is(err, document.ErrKnowledgeNotFound) {
+				WriteError(w, http.StatusNotFound, "知识条目不存在")
+				return
+			}
+			if err != nil {
+				log.Printf("[Knowledge] delete error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "删除知识条目失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"message": "知识条目已删除"})
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
 		}
-		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 	}
 }
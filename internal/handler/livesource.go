@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// HandleLiveSources handles GET (list) and POST (register) for live sources.
+// GET /api/live-sources?product_id=
+// POST /api/live-sources {"product_id": "...", "url": "...", "interval_min": 1440}
+func HandleLiveSources(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			productID := r.URL.Query().Get("product_id")
+			if !IsValidOptionalID(productID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			sources, err := app.ListLiveSources(productID)
+			if err != nil {
+				log.Printf("[LiveSources] list error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取来源列表失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"sources": sources})
+
+		case http.MethodPost:
+			var req struct {
+				ProductID   string `json:"product_id"`
+				URL         string `json:"url"`
+				IntervalMin int    `json:"interval_min"`
+			}
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if !IsValidOptionalID(req.ProductID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			if req.ProductID != "" {
+				if _, err := app.GetProduct(req.ProductID); err != nil {
+					WriteError(w, http.StatusBadRequest, "产品不存在")
+					return
+				}
+			}
+			src, err := app.CreateLiveSource(req.ProductID, req.URL, req.IntervalMin)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, src)
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleLiveSourceByID handles a single live source.
+// GET    /api/live-sources/{id}
+// PUT    /api/live-sources/{id} {"interval_min": 1440, "enabled": true}
+// DELETE /api/live-sources/{id}
+// GET    /api/live-sources/{id}/pages
+// POST   /api/live-sources/{id}/refresh
+func HandleLiveSourceByID(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		rest := strings.TrimPrefix(r.URL.Path, "/api/live-sources/")
+		id, action, _ := strings.Cut(rest, "/")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid source ID")
+			return
+		}
+
+		switch action {
+		case "refresh":
+			if r.Method != http.MethodPost {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			result, err := app.RefreshLiveSource(id)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, result)
+			return
+		case "pages":
+			if r.Method != http.MethodGet {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			pages, err := app.LiveSourcePages(id)
+			if err != nil {
+				WriteError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"pages": pages})
+			return
+		case "":
+		default:
+			WriteError(w, http.StatusNotFound, "not found")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			src, err := app.GetLiveSource(id)
+			if err != nil {
+				WriteError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, src)
+
+		case http.MethodPut:
+			var req struct {
+				IntervalMin int  `json:"interval_min"`
+				Enabled     bool `json:"enabled"`
+			}
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			src, err := app.UpdateLiveSource(id, req.IntervalMin, req.Enabled)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, src)
+
+		case http.MethodDelete:
+			if err := app.DeleteLiveSource(id); err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"message": "来源已删除"})
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"askflow/internal/config"
+)
+
+// HandleLLMProfiles lists and sets the named LLM profiles calls fail over to
+// and tasks are routed to. API keys are returned masked; a masked key keeps
+// the saved one.
+// GET /api/llm-profiles
+// PUT /api/llm-profiles {"name","endpoint","api_key","model_name","temperature","max_tokens","priority","timeout_sec","disabled"}
+func HandleLLMProfiles(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSuperAdmin(app, w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			profiles, routes := app.LLMProfiles()
+			WriteJSON(w, http.StatusOK, map[string]interface{}{
+				"profiles": profiles,
+				"routes":   routes,
+				"tasks":    config.LLMTasks,
+			})
+		case http.MethodPut:
+			var p config.LLMProfile
+			if err := ReadJSONBody(r, &p); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if err := app.SetLLMProfile(p); err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleLLMProfileDelete removes an LLM profile and the routes to it.
+// DELETE /api/llm-profiles/{name}
+func HandleLLMProfileDelete(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if !requireSuperAdmin(app, w, r) {
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/api/llm-profiles/")
+		if err := app.DeleteLLMProfile(name); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// HandleLLMRoutes sets which profile each task tries first; a task routed
+// to "" starts with the profile of lowest priority.
+// PUT /api/llm-routes {"routes": {"answer": "", "intent": "cheap", "vision": "vl"}}
+func HandleLLMRoutes(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if !requireSuperAdmin(app, w, r) {
+			return
+		}
+		var req struct {
+			Routes map[string]string `json:"routes"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := app.SetLLMRoutes(req.Routes); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// HandleTestLLMProfile tests one saved LLM profile, or the main endpoint
+// with the name "default", without failing over.
+// POST /api/test/llm-profile {"name": "..."}
+func HandleTestLLMProfile(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if !requireSuperAdmin(app, w, r) {
+			return
+		}
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil || req.Name == "" {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		reply, ms, err := app.TestLLMProfile(req.Name)
+		if err != nil {
+			log.Printf("[TestLLM] profile %s error: %v", req.Name, err)
+			WriteError(w, http.StatusBadRequest, "LLM 连接测试失败，请检查配置")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "reply": reply, "latency_ms": ms})
+	}
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// operationTokenScope reports whether an operation token may be minted for
+// method and path, and whether the operation needs an admin. Only downloads,
+// media streams and the batch import stream qualify: they are the requests
+// a browser makes without an Authorization header or that may outlive the
+// session.
+func operationTokenScope(method, path string) (admin, ok bool) {
+	if method == http.MethodPost && path == "/api/batch-import" {
+		return true, true
+	}
+	if method != http.MethodGet {
+		return false, false
+	}
+	if path == "/api/logs/download" {
+		return true, true
+	}
+	if id, found := strings.CutPrefix(path, "/api/media/"); found {
+		return false, IsValidHexID(id)
+	}
+	if id, found := strings.CutPrefix(path, "/api/documents/public-download/"); found {
+		return false, IsValidHexID(id)
+	}
+	if rest, found := strings.CutPrefix(path, "/api/documents/"); found {
+		if id, found := strings.CutSuffix(rest, "/download"); found {
+			return true, IsValidHexID(id)
+		}
+	}
+	return false, false
+}
+
+// getLinkSession authenticates a request made from a link or a media
+// element: an operation token in ?op_token=, or a session token in the
+// Authorization header or ?token=. Returns the user ID.
+func getLinkSession(app *App, r *http.Request) (string, error) {
+	if opToken := r.URL.Query().Get("op_token"); opToken != "" {
+		userID, err := app.VerifyOperationToken(opToken, r)
+		if err != nil {
+			return "", fmt.Errorf("操作令牌无效或已过期")
+		}
+		return userID, nil
+	}
+	authHeader := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+	if token == "" || token == authHeader {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return "", fmt.Errorf("未登录")
+	}
+	session, err := app.sessionManager.ValidateSession(token)
+	if err != nil {
+		return "", fmt.Errorf("会话已过期")
+	}
+	return session.UserID, nil
+}
+
+// HandleOperationToken mints an operation token for a download or media
+// stream, so the request keeps working if the session expires or is
+// rotated while it runs.
+// POST /api/auth/operation-token {"method": "GET", "path": "/api/media/{id}"}
+func HandleOperationToken(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		authHeader := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		if token == "" || token == authHeader {
+			WriteError(w, http.StatusUnauthorized, "未登录")
+			return
+		}
+		session, err := app.sessionManager.ValidateSession(token)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, "会话已过期")
+			return
+		}
+
+		var req struct {
+			Method string `json:"method"`
+			Path   string `json:"path"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if req.Method == "" {
+			req.Method = http.MethodGet
+		}
+		admin, ok := operationTokenScope(req.Method, req.Path)
+		if !ok {
+			WriteError(w, http.StatusBadRequest, "该操作不支持操作令牌")
+			return
+		}
+		// The endpoint itself still checks the role (e.g. super_admin for
+		// logs); here it is enough that the caller could reach it at all.
+		if admin && (!app.IsAdminSession(session.UserID) || app.GetAdminRole(session.UserID) == "") {
+			WriteError(w, http.StatusForbidden, "无权限")
+			return
+		}
+
+		t, err := app.IssueOperationToken(session.UserID, req.Method, req.Path)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "生成操作令牌失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, t)
+	}
+}
@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"errors"
+	"io"
 	"log"
 	"net/http"
 	"strings"
 
+	"askflow/internal/jobs"
 	"askflow/internal/pending"
 )
 
@@ -34,7 +37,21 @@ func HandlePending(app *App) http.HandlerFunc {
 			WriteError(w, http.StatusBadRequest, "invalid product_id")
 			return
 		}
-		questions, err := app.ListPendingQuestions(status, productID)
+		var ext pending.ExternalRefFilter
+		switch r.URL.Query().Get("has_external_ref") {
+		case "":
+		case "true":
+			has := true
+			ext.Has = &has
+		case "false":
+			has := false
+			ext.Has = &has
+		default:
+			WriteError(w, http.StatusBadRequest, "invalid has_external_ref parameter")
+			return
+		}
+		ext.Ref = strings.TrimSpace(r.URL.Query().Get("external_ref"))
+		questions, err := app.ListPendingQuestions(status, productID, ext)
 		if err != nil {
 			log.Printf("[Pending] list error: %v", err)
 			WriteError(w, http.StatusInternalServerError, "获取问题列表失败")
@@ -55,7 +72,7 @@ func HandlePendingAnswer(app *App) http.HandlerFunc {
 			return
 		}
 		// Require admin session
-		_, _, err := GetAdminSession(app, r)
+		userID, _, err := GetAdminSession(app, r)
 		if err != nil {
 			WriteAdminSessionError(w, err)
 			return
@@ -65,12 +82,104 @@ func HandlePendingAnswer(app *App) http.HandlerFunc {
 			WriteError(w, http.StatusBadRequest, "invalid request body")
 			return
 		}
-		if err := app.AnswerQuestion(req); err != nil {
+		reviewStatus, err := app.AnswerQuestion(req, userID)
+		if err != nil {
 			log.Printf("[Pending] answer error: %v", err)
 			WriteError(w, http.StatusInternalServerError, "回答问题失败")
 			return
 		}
-		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok", "review_status": reviewStatus})
+	}
+}
+
+// maxBulkAnswerSize bounds a bulk answer upload.
+const maxBulkAnswerSize = 20 << 20
+
+// HandlePendingBulkAnswer starts a background job answering pending
+// questions from a CSV or JSON of question_id → answer pairs, sent as the
+// multipart "file" field or as the request body.
+// POST /api/pending/bulk-answer
+func HandlePendingBulkAnswer(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		userID, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBulkAnswerSize)
+		var data []byte
+		name := "answers.json"
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			file, header, err := r.FormFile("file")
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, "请上传回答文件")
+				return
+			}
+			defer file.Close()
+			name = header.Filename
+			data, err = io.ReadAll(file)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, "读取文件失败")
+				return
+			}
+		} else {
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+				name = "answers.csv"
+			}
+			data, err = io.ReadAll(r.Body)
+			if err != nil {
+				WriteError(w, http.StatusRequestEntityTooLarge, "文件过大")
+				return
+			}
+		}
+		items, err := pending.ParseBulkAnswers(data, name)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		jobID, err := app.StartBulkAnswer(items, userID)
+		if err != nil {
+			log.Printf("[Pending] bulk answer error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "创建批量回答任务失败")
+			return
+		}
+		WriteJSON(w, http.StatusAccepted, map[string]interface{}{"job_id": jobID, "rows": len(items)})
+	}
+}
+
+// HandlePendingBulkAnswerResults returns a bulk answer job and the outcome
+// of each row processed so far.
+// GET /api/pending/bulk-answer/{job_id}
+func HandlePendingBulkAnswerResults(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, _, err := GetAdminSession(app, r); err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/pending/bulk-answer/")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusNotFound, "not found")
+			return
+		}
+		job, results, err := app.BulkAnswerResults(id)
+		if errors.Is(err, jobs.ErrNotFound) {
+			WriteError(w, http.StatusNotFound, "任务不存在")
+			return
+		}
+		if err != nil {
+			log.Printf("[Pending] bulk answer results error for %s: %v", id, err)
+			WriteError(w, http.StatusInternalServerError, "获取批量回答结果失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"job": job, "results": results})
 	}
 }
 
@@ -120,10 +229,52 @@ func HandlePendingCreate(app *App) http.HandlerFunc {
 	}
 }
 
-// HandlePendingByID handles deleting a pending question by ID (admin only).
+// HandlePendingByID handles deleting a pending question by ID and setting or
+// clearing its external ticket reference (admin only).
 func HandlePendingByID(app *App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := strings.TrimPrefix(r.URL.Path, "/api/pending/")
+
+		// Handle /api/pending/{id}/external-ref
+		if strings.HasSuffix(id, "/external-ref") {
+			id = strings.TrimSuffix(id, "/external-ref")
+			if !IsValidHexID(id) {
+				WriteError(w, http.StatusBadRequest, "invalid question ID")
+				return
+			}
+			if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			if _, _, err := GetAdminSession(app, r); err != nil {
+				WriteAdminSessionError(w, err)
+				return
+			}
+			var req struct {
+				ExternalRef string `json:"external_ref"`
+			}
+			if r.Method == http.MethodPut {
+				if err := ReadJSONBody(r, &req); err != nil {
+					WriteError(w, http.StatusBadRequest, "invalid request body")
+					return
+				}
+				if strings.TrimSpace(req.ExternalRef) == "" {
+					WriteError(w, http.StatusBadRequest, "external_ref is required")
+					return
+				}
+			}
+			if err := app.SetPendingExternalRef(id, req.ExternalRef); err != nil {
+				if errors.Is(err, pending.ErrNotFound) {
+					WriteError(w, http.StatusNotFound, err.Error())
+					return
+				}
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"status": "ok", "external_ref": strings.TrimSpace(req.ExternalRef)})
+			return
+		}
+
 		if id == "" || id == "answer" || id == "create" {
 			WriteError(w, http.StatusBadRequest, "missing question ID")
 			return
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// portalSearchLimit caps the results of a portal search.
+const portalSearchLimit = 50
+
+// portalGuard rejects portal requests while the portal is disabled or the
+// method is not GET. It writes the error response and returns false.
+func portalGuard(app *App, w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	if !app.PortalEnabled() {
+		WriteError(w, http.StatusNotFound, "文档门户未启用")
+		return false
+	}
+	return true
+}
+
+// HandlePortalCategories lists the categories of the documentation portal.
+// GET /api/portal/categories
+func HandlePortalCategories(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !portalGuard(app, w, r) {
+			return
+		}
+		categories, err := app.PortalCategories()
+		if err != nil {
+			log.Printf("[Portal] list categories error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取分类失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"categories": categories})
+	}
+}
+
+// HandlePortalArticles lists the articles of a portal category, or returns
+// one article with its full text or its related articles.
+// GET /api/portal/articles?product_id=&page=&page_size=
+// GET /api/portal/articles/{id}
+// GET /api/portal/articles/{id}/related?limit=
+func HandlePortalArticles(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !portalGuard(app, w, r) {
+			return
+		}
+
+		if id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/portal/articles"), "/"); id != "" {
+			if docID, ok := strings.CutSuffix(id, "/related"); ok {
+				if !IsValidHexID(docID) {
+					WriteError(w, http.StatusBadRequest, "invalid article id")
+					return
+				}
+				related, err := app.RelatedPortalArticles(docID, relatedLimit(r))
+				if err != nil {
+					WriteError(w, http.StatusNotFound, err.Error())
+					return
+				}
+				WriteJSON(w, http.StatusOK, map[string]interface{}{"articles": related})
+				return
+			}
+			if !IsValidHexID(id) {
+				WriteError(w, http.StatusBadRequest, "invalid article id")
+				return
+			}
+			article, err := app.GetPortalArticle(id)
+			if err != nil {
+				WriteError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, article)
+			return
+		}
+
+		productID := r.URL.Query().Get("product_id")
+		if !IsValidOptionalID(productID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		page := 1
+		pageSize := 20
+		if p := r.URL.Query().Get("page"); p != "" {
+			if v, e := strconv.Atoi(p); e == nil && v > 0 {
+				page = v
+			}
+		}
+		if ps := r.URL.Query().Get("page_size"); ps != "" {
+			if v, e := strconv.Atoi(ps); e == nil && v > 0 {
+				pageSize = v
+			}
+		}
+		if pageSize > 100 {
+			pageSize = 100
+		}
+		articles, total, err := app.ListPortalArticles(productID, page, pageSize)
+		if err != nil {
+			log.Printf("[Portal] list articles error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取文章列表失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"articles":  articles,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		})
+	}
+}
+
+// HandlePortalSearch searches the titles and text of portal articles.
+// GET /api/portal/search?q=&product_id=
+func HandlePortalSearch(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !portalGuard(app, w, r) {
+			return
+		}
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		if q == "" {
+			WriteError(w, http.StatusBadRequest, "q is required")
+			return
+		}
+		if len(q) > 200 {
+			WriteError(w, http.StatusBadRequest, "搜索词过长")
+			return
+		}
+		productID := r.URL.Query().Get("product_id")
+		if !IsValidOptionalID(productID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		articles, err := app.SearchPortalArticles(q, productID, portalSearchLimit)
+		if err != nil {
+			log.Printf("[Portal] search error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "搜索失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"articles": articles})
+	}
+}
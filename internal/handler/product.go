@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
 	"log"
 	"net/http"
 	"strings"
@@ -16,16 +19,33 @@ func HandleProducts(app *App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
+			// status filters by archive state: "active", "archived" or "all".
+			// Archived products are only listed for admins, who get all by default.
+			status := r.URL.Query().Get("status")
+			if _, _, err := GetAdminSession(app, r); err != nil {
+				status = "active"
+			}
+			switch status {
+			case "":
+				status = "all"
+			case "active", "archived", "all":
+			default:
+				WriteError(w, http.StatusBadRequest, "invalid status")
+				return
+			}
 			products, err := app.ListProducts()
 			if err != nil {
 				log.Printf("[Products] list error: %v", err)
 				WriteError(w, http.StatusInternalServerError, "获取产品列表失败")
 				return
 			}
-			if products == nil {
-				products = []product.Product{}
+			filtered := []product.Product{}
+			for _, p := range products {
+				if status == "all" || p.Archived() == (status == "archived") {
+					filtered = append(filtered, p)
+				}
 			}
-			WriteJSON(w, http.StatusOK, map[string]interface{}{"products": products})
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"products": filtered})
 
 		case http.MethodPost:
 			_, role, err := GetAdminSession(app, r)
@@ -37,18 +57,12 @@ func HandleProducts(app *App) http.HandlerFunc {
 				WriteError(w, http.StatusForbidden, "仅超级管理员可管理产品")
 				return
 			}
-			var req struct {
-				Name           string `json:"name"`
-				Type           string `json:"type"`
-				Description    string `json:"description"`
-				WelcomeMessage string `json:"welcome_message"`
-				AllowDownload  bool   `json:"allow_download"`
-			}
+			var req product.Input
 			if err := ReadJSONBody(r, &req); err != nil {
 				WriteError(w, http.StatusBadRequest, "invalid request body")
 				return
 			}
-			p, err := app.CreateProduct(req.Name, req.Type, req.Description, req.WelcomeMessage, req.AllowDownload)
+			p, err := app.CreateProduct(req)
 			if err != nil {
 				WriteError(w, http.StatusBadRequest, err.Error())
 				return
@@ -61,6 +75,93 @@ func HandleProducts(app *App) http.HandlerFunc {
 	}
 }
 
+// maxProductCSVSize limits the size of an uploaded product CSV.
+const maxProductCSVSize = 10 << 20
+
+// HandleProductsExport downloads all products as CSV.
+// GET /api/products/export
+func HandleProductsExport(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, role, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		if role != "super_admin" {
+			WriteError(w, http.StatusForbidden, "仅超级管理员可管理产品")
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=products.csv")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// UTF-8 BOM so spreadsheet tools detect the encoding of non-ASCII names
+		w.Write([]byte("\xEF\xBB\xBF"))
+		if err := app.ExportProductsCSV(w); err != nil {
+			log.Printf("[Products] export error: %v", err)
+		}
+	}
+}
+
+// HandleProductsImport creates or updates products from a CSV file, sent as
+// the "file" field of a multipart form or as the request body. With
+// ?dry_run=true nothing is written and the response only reports what the
+// import would do.
+// POST /api/products/import
+func HandleProductsImport(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, role, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		if role != "super_admin" {
+			WriteError(w, http.StatusForbidden, "仅超级管理员可管理产品")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxProductCSVSize+1<<20)
+		var body io.Reader = r.Body
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, "missing file in upload")
+				return
+			}
+			defer file.Close()
+			body = file
+		}
+		data, err := io.ReadAll(io.LimitReader(body, maxProductCSVSize+1))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "failed to read file")
+			return
+		}
+		if len(data) > maxProductCSVSize {
+			WriteError(w, http.StatusBadRequest, "文件大小超过限制 (10MB)")
+			return
+		}
+		dryRun := r.URL.Query().Get("dry_run") == "true"
+		result, err := app.ImportProductsCSV(bytes.NewReader(data), dryRun)
+		if err != nil && result == nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			// Some rows were written before the failure; report them with the error
+			log.Printf("[Products] import error: %v", err)
+			WriteJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": err.Error(), "result": result})
+			return
+		}
+		WriteJSON(w, http.StatusOK, result)
+	}
+}
+
 // HandleProductByID handles PUT (update) and DELETE for a specific product.
 func HandleProductByID(app *App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -69,6 +170,75 @@ func HandleProductByID(app *App) http.HandlerFunc {
 			WriteError(w, http.StatusBadRequest, "missing product ID")
 			return
 		}
+
+		// Handle /api/products/{id}/capabilities (public, used by the chat client and widget)
+		if strings.HasSuffix(id, "/capabilities") {
+			id = strings.TrimSuffix(id, "/capabilities")
+			if !IsValidHexID(id) {
+				WriteError(w, http.StatusBadRequest, "invalid product ID")
+				return
+			}
+			if r.Method != http.MethodGet {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			p, err := app.GetProduct(id)
+			if err != nil || p == nil {
+				WriteError(w, http.StatusNotFound, "产品不存在")
+				return
+			}
+			if p.Archived() {
+				if _, _, err := GetAdminSession(app, r); err != nil {
+					WriteError(w, http.StatusNotFound, "产品不存在")
+					return
+				}
+			}
+			caps, err := app.ProductCapabilities(id)
+			if err != nil {
+				log.Printf("[Products] capabilities error for %s: %v", id, err)
+				WriteError(w, http.StatusInternalServerError, "获取产品功能失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, caps)
+			return
+		}
+
+		// Handle POST /api/products/{id}/archive and /api/products/{id}/unarchive
+		for suffix, archived := range map[string]bool{"/archive": true, "/unarchive": false} {
+			if !strings.HasSuffix(id, suffix) {
+				continue
+			}
+			id = strings.TrimSuffix(id, suffix)
+			if !IsValidHexID(id) {
+				WriteError(w, http.StatusBadRequest, "invalid product ID")
+				return
+			}
+			if r.Method != http.MethodPost {
+				WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+				return
+			}
+			_, role, err := GetAdminSession(app, r)
+			if err != nil {
+				WriteAdminSessionError(w, err)
+				return
+			}
+			if role != "super_admin" {
+				WriteError(w, http.StatusForbidden, "仅超级管理员可管理产品")
+				return
+			}
+			if p, err := app.GetProduct(id); err != nil || p == nil {
+				WriteError(w, http.StatusNotFound, "产品不存在")
+				return
+			}
+			p, err := app.SetProductArchived(id, archived)
+			if err != nil {
+				log.Printf("[Products] archive error for %s: %v", id, err)
+				WriteError(w, http.StatusInternalServerError, "更新产品归档状态失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, p)
+			return
+		}
 		if !IsValidHexID(id) {
 			WriteError(w, http.StatusBadRequest, "invalid product ID")
 			return
@@ -85,18 +255,13 @@ func HandleProductByID(app *App) http.HandlerFunc {
 				WriteError(w, http.StatusForbidden, "仅超级管理员可管理产品")
 				return
 			}
-			var req struct {
-				Name           string `json:"name"`
-				Type           string `json:"type"`
-				Description    string `json:"description"`
-				WelcomeMessage string `json:"welcome_message"`
-				AllowDownload  bool   `json:"allow_download"`
-			}
+			// Fields left out of the body keep their stored value
+			var req product.Patch
 			if err := ReadJSONBody(r, &req); err != nil {
 				WriteError(w, http.StatusBadRequest, "invalid request body")
 				return
 			}
-			p, err := app.UpdateProduct(id, req.Name, req.Type, req.Description, req.WelcomeMessage, req.AllowDownload)
+			p, err := app.UpdateProduct(id, req)
 			if err != nil {
 				WriteError(w, http.StatusBadRequest, err.Error())
 				return
@@ -130,6 +295,10 @@ func HandleProductByID(app *App) http.HandlerFunc {
 				}
 			}
 			if err := app.DeleteProduct(id); err != nil {
+				if errors.Is(err, product.ErrIsolatedStorageHasDocuments) {
+					WriteError(w, http.StatusConflict, err.Error())
+					return
+				}
 				log.Printf("[Products] delete error for %s: %v", id, err)
 				WriteError(w, http.StatusInternalServerError, "删除产品失败")
 				return
@@ -181,7 +350,7 @@ func HandleProductIntro(app *App) http.HandlerFunc {
 				return
 			}
 			p, err := app.GetProduct(productID)
-			if err == nil && p != nil && p.WelcomeMessage != "" {
+			if err == nil && p != nil && !p.Archived() && p.WelcomeMessage != "" {
 				WriteJSON(w, http.StatusOK, map[string]string{"product_intro": p.WelcomeMessage})
 				return
 			}
@@ -195,7 +364,8 @@ func HandleProductIntro(app *App) http.HandlerFunc {
 	}
 }
 
-// HandleAppInfo returns public app info (product_name, enabled OAuth providers) for frontend display.
+// HandleAppInfo returns public app info (product_name, enabled OAuth providers,
+// default capabilities) for frontend display.
 func HandleAppInfo(app *App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -213,10 +383,20 @@ func HandleAppInfo(app *App) http.HandlerFunc {
 			productName = cfg.ProductName
 			maxUploadSizeMB = cfg.Video.MaxUploadSizeMB
 		}
+		// Defaults for when no product is selected; per-product values are
+		// served by /api/products/{id}/capabilities
+		caps, err := app.ProductCapabilities("")
+		if err != nil {
+			log.Printf("[AppInfo] capabilities error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取功能信息失败")
+			return
+		}
 		WriteJSON(w, http.StatusOK, map[string]interface{}{
 			"product_name":       productName,
 			"oauth_providers":    providers,
+			"external_login":     app.GetExternalLogin(),
 			"max_upload_size_mb": maxUploadSizeMB,
+			"capabilities":       caps,
 		})
 	}
 }
@@ -287,7 +467,7 @@ func HandleTranslateProductName(app *App) http.HandlerFunc {
 		}
 		ch := make(chan result, 1)
 		go func() {
-			translated, err := app.queryEngine.TranslateText(name, lang)
+			translated, err := app.queryEngine.TranslateText(name, lang, "")
 			select {
 			case ch <- result{translated, err}:
 			case <-llmCtx.Done():
@@ -1,12 +1,20 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"askflow/internal/analytics"
+	"askflow/internal/document"
 	"askflow/internal/errlog"
+	"askflow/internal/llm"
+	"askflow/internal/product"
 	"askflow/internal/query"
+	"askflow/internal/share"
 )
 
 // HandleQuery processes a user question through the RAG pipeline.
@@ -17,7 +25,7 @@ func HandleQuery(app *App) http.HandlerFunc {
 			return
 		}
 		// Validate user session
-		_, err := GetUserSession(app, r)
+		userID, err := GetUserSession(app, r)
 		if err != nil {
 			WriteError(w, http.StatusUnauthorized, err.Error())
 			return
@@ -43,6 +51,37 @@ func HandleQuery(app *App) http.HandlerFunc {
 			WriteError(w, http.StatusBadRequest, "invalid product_id")
 			return
 		}
+		// Archived products are hidden from end users
+		if app.productHidden(req.ProductID) {
+			if _, _, adminErr := GetAdminSession(app, r); adminErr != nil {
+				WriteError(w, http.StatusNotFound, "产品不存在")
+				return
+			}
+		}
+		// Only admins may search documents outside their effective period
+		if req.Effective != "" {
+			if _, _, adminErr := GetAdminSession(app, r); adminErr != nil {
+				req.Effective = ""
+			} else if !query.ValidEffective(req.Effective) {
+				WriteError(w, http.StatusBadRequest, "invalid effective (expected \"all\" or YYYY-MM-DD)")
+				return
+			}
+		}
+		if !document.ValidCategory(req.Category) {
+			WriteError(w, http.StatusBadRequest, "invalid category")
+			return
+		}
+		tags := req.Tags[:0]
+		for _, tag := range req.Tags {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		req.Tags = tags
+		if len(req.Tags) > query.MaxQueryTags {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("too many tags (max %d)", query.MaxQueryTags))
+			return
+		}
 		// Default to first product if no product_id specified
 		if req.ProductID == "" {
 			firstID, pErr := app.GetFirstProductID()
@@ -50,27 +89,338 @@ func HandleQuery(app *App) http.HandlerFunc {
 				req.ProductID = firstID
 			}
 		}
+		if req.Ticket != "" && !isValidTicket(req.Ticket) {
+			WriteError(w, http.StatusBadRequest, "invalid ticket")
+			return
+		}
+		// Queue fairness is per authenticated user; admins are served first
+		req.Caller = userID
+		req.Priority = llm.PriorityNormal
+		_, _, adminErr := GetAdminSession(app, r)
+		if adminErr == nil {
+			req.Priority = llm.PriorityHigh
+		}
+		req.Debug = queryDebug(app, r, req.Debug, adminErr == nil)
 		resp, err := app.queryEngine.Query(req)
+		if status, msg := queueError(err); status != 0 {
+			// Backpressure, not a failure of the pipeline
+			log.Printf("[Query] not queued for %s: %v", userID, err)
+			w.Header().Set("Retry-After", "10")
+			WriteError(w, status, msg)
+			return
+		}
+		app.RecordQueryOutcome(err == nil)
 		if err != nil {
 			log.Printf("[Query] error: %v", err)
 			errlog.Logf("[Query] query processing failed: %v", err)
 			WriteError(w, http.StatusInternalServerError, "查询处理失败，请稍后重试")
 			return
 		}
-		// Strip debug info for non-admin users to prevent information leakage
-		if resp.DebugInfo != nil {
-			_, _, adminErr := GetAdminSession(app, r)
-			if adminErr != nil {
-				resp.DebugInfo = nil
+		var prod *product.Product
+		if req.ProductID != "" {
+			if p, pErr := app.GetProduct(req.ProductID); pErr == nil {
+				prod = p
 			}
 		}
+		// The disclaimer becomes part of the answer before it is recorded, so
+		// history, share links and exports carry it too
+		if prod != nil {
+			resp.AppendDisclaimer(prod.Disclaimer)
+		}
+		// Record the query for usage reporting; failures must not break the answer
+		if queryID, logErr := app.LogQuery(userID, req.ProductID, req.Question, resp); logErr != nil {
+			log.Printf("[Query] failed to log query: %v", logErr)
+		} else {
+			resp.QueryID = queryID
+		}
+		// Keep an immutable record of how the answer was produced, under the request ID
+		requestID := w.Header().Get("X-Request-Id")
+		if auditErr := app.RecordAnswerAudit(requestID, resp.QueryID, userID, req, resp); auditErr != nil {
+			log.Printf("[Query] failed to record answer audit: %v", auditErr)
+			errlog.Logf("[Query] failed to record answer audit request=%s: %v", requestID, auditErr)
+		}
+		if histErr := app.RecordChatHistory(userID, req.ProductID, req.Question, resp); histErr != nil {
+			log.Printf("[Query] failed to record chat history: %v", histErr)
+		}
+		// Diagnostics never reach callers that were not allowed to debug
+		if !req.Debug {
+			resp.DebugInfo = nil
+		}
 		// Check if product allows document download
-		if req.ProductID != "" {
-			p, pErr := app.GetProduct(req.ProductID)
-			if pErr == nil && p != nil {
-				resp.AllowDownload = p.AllowDownload
-			}
+		if prod != nil {
+			resp.AllowDownload = prod.AllowDownload
 		}
 		WriteJSON(w, http.StatusOK, resp)
 	}
 }
+
+// debugTokenHeader carries a debug token issued by an admin.
+const debugTokenHeader = "X-Debug-Token"
+
+// queryDebug decides whether a query returns search diagnostics. Admins get
+// them on request, or by default when vector.debug_mode is on. Other callers
+// only with a valid debug token, so the global flag never exposes them.
+func queryDebug(app *App, r *http.Request, requested, isAdmin bool) bool {
+	if isAdmin {
+		cfg := app.configManager.Get()
+		return requested || (cfg != nil && cfg.Vector.DebugMode)
+	}
+	token := r.Header.Get(debugTokenHeader)
+	return token != "" && app.ValidDebugToken(token)
+}
+
+// Debug tokens last an hour by default and a day at most.
+const (
+	defaultDebugTokenMinutes = 60
+	maxDebugTokenMinutes     = 24 * 60
+)
+
+// HandleDebugToken issues a signed debug token, for reproducing an answer
+// with search diagnostics from a non-admin chat session.
+// POST /api/admin/debug-token {"minutes": 60}
+func HandleDebugToken(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		adminID, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		var req struct {
+			Minutes int `json:"minutes"`
+		}
+		if r.ContentLength != 0 {
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+		}
+		if req.Minutes == 0 {
+			req.Minutes = defaultDebugTokenMinutes
+		}
+		if req.Minutes < 1 || req.Minutes > maxDebugTokenMinutes {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("有效期须在 1 到 %d 分钟之间", maxDebugTokenMinutes))
+			return
+		}
+		token, expires, err := app.IssueDebugToken(adminID, time.Duration(req.Minutes)*time.Minute)
+		if err != nil {
+			WriteError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		log.Printf("[Query] debug token issued by %s, expires %s", adminID, expires.Format(time.RFC3339))
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"token": token, "expires_at": expires})
+	}
+}
+
+// queueError maps generation queue errors to an HTTP status and message; a
+// zero status means err is not a queue error.
+func queueError(err error) (int, string) {
+	for _, qe := range []error{llm.ErrUserQueueFull, llm.ErrBusy, llm.ErrQueueTimeout} {
+		if errors.Is(err, qe) {
+			if qe == llm.ErrUserQueueFull {
+				return http.StatusTooManyRequests, qe.Error()
+			}
+			return http.StatusServiceUnavailable, qe.Error()
+		}
+	}
+	return 0, ""
+}
+
+// isValidTicket checks a client-chosen queue ticket: 8 to 64 letters, digits, '-' or '_'.
+func isValidTicket(t string) bool {
+	if len(t) < 8 || len(t) > 64 {
+		return false
+	}
+	for _, c := range t {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// HandleQueryQueue reports where a query stands in the generation queue, so
+// the chat client can show the position while the answer is pending.
+// GET /api/query/queue?ticket=
+func HandleQueryQueue(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, err := GetUserSession(app, r); err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		ticket := r.URL.Query().Get("ticket")
+		if !isValidTicket(ticket) {
+			WriteError(w, http.StatusBadRequest, "invalid ticket")
+			return
+		}
+		pos, ok := app.queryEngine.QueuePosition(ticket)
+		stats := app.queryEngine.QueueStats()
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"known":    ok, // false before the query reaches the queue or after it finished
+			"position": pos,
+			"active":   stats.Active,
+			"queued":   stats.Queued,
+			"size":     stats.Size,
+		})
+	}
+}
+
+// HandleCitationClick records that the user opened a citation of an answer,
+// for per-document usage statistics.
+// POST /api/query/citation-click {"query_id": "...", "document_id": "...", "chunk_index": 3}
+func HandleCitationClick(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		userID, err := GetUserSession(app, r)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		var req struct {
+			QueryID    string `json:"query_id"`
+			DocumentID string `json:"document_id"`
+			ChunkIndex int    `json:"chunk_index"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if !IsValidHexID(req.QueryID) || !IsValidHexID(req.DocumentID) || req.ChunkIndex < 0 {
+			WriteError(w, http.StatusBadRequest, "invalid citation")
+			return
+		}
+		if err := app.RecordCitationClick(req.QueryID, userID, req.DocumentID, req.ChunkIndex); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]string{"message": "ok"})
+	}
+}
+
+// HandleQueryFeedback records the user's thumbs up/down rating for an answer,
+// with an optional comment. "helpful" may be given instead of "rating".
+// POST /api/query/feedback {"query_id": "...", "rating": 1|-1|0, "comment": "..."}
+func HandleQueryFeedback(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		userID, err := GetUserSession(app, r)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		var req struct {
+			QueryID string `json:"query_id"`
+			Rating  int    `json:"rating"`
+			Helpful *bool  `json:"helpful"`
+			Comment string `json:"comment"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if !IsValidHexID(req.QueryID) {
+			WriteError(w, http.StatusBadRequest, "invalid query_id")
+			return
+		}
+		if req.Helpful != nil {
+			req.Rating = analytics.RatingDown
+			if *req.Helpful {
+				req.Rating = analytics.RatingUp
+			}
+		}
+		req.Comment = strings.TrimSpace(req.Comment)
+		if len(req.Comment) > 2000 {
+			WriteError(w, http.StatusBadRequest, "comment too long (max 2000 characters)")
+			return
+		}
+		if err := app.RateQuery(req.QueryID, userID, req.Rating, req.Comment); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// HandleQueryShare creates an expiring read-only share link for an answer the user received.
+// POST /api/query/share {"query_id": "...", "expires_in_hours": 168}
+func HandleQueryShare(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		userID, err := GetUserSession(app, r)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		var req struct {
+			QueryID        string `json:"query_id"`
+			ExpiresInHours int    `json:"expires_in_hours"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if !IsValidHexID(req.QueryID) {
+			WriteError(w, http.StatusBadRequest, "invalid query_id")
+			return
+		}
+		if req.ExpiresInHours < 0 {
+			WriteError(w, http.StatusBadRequest, "invalid expires_in_hours")
+			return
+		}
+		link, err := app.ShareAnswer(req.QueryID, userID, time.Duration(req.ExpiresInHours)*time.Hour)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"token":      link.Token,
+			"url":        app.BasePath() + "/api/share/" + link.Token,
+			"share_url":  app.PublicBaseURL(r) + "/api/share/" + link.Token,
+			"expires_at": link.ExpiresAt,
+		})
+	}
+}
+
+// HandleSharedAnswer returns a shared answer with its citations. No login is
+// required; the unguessable token is the credential.
+// GET /api/share/{token}
+func HandleSharedAnswer(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		token := strings.TrimPrefix(r.URL.Path, "/api/share/")
+		if token == "" || len(token) > 64 || strings.ContainsAny(token, "/?#") {
+			WriteError(w, http.StatusNotFound, "not found")
+			return
+		}
+		answer, err := app.ViewSharedAnswer(token)
+		if err != nil {
+			if err == share.ErrNotFound {
+				WriteError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			log.Printf("[Share] view error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取分享内容失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, answer)
+	}
+}
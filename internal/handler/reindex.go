@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"askflow/internal/document"
+)
+
+// reindexPollInterval is how often the progress stream reports the job status.
+const reindexPollInterval = time.Second
+
+// HandleReindex starts (POST), inspects (GET) and cancels (DELETE) the
+// re-embedding of all documents with a new embedding model.
+// /api/admin/reindex
+func HandleReindex(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, role, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		if role != "super_admin" {
+			WriteError(w, http.StatusForbidden, "仅超级管理员可重建向量索引")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			docs, err := app.ReindexDocuments()
+			if err != nil {
+				log.Printf("[Reindex] list documents error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取重建索引状态失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{
+				"status":    app.ReindexStatus(),
+				"documents": docs,
+			})
+		case http.MethodPost:
+			var req ReindexRequest
+			if r.ContentLength != 0 {
+				if err := ReadJSONBody(r, &req); err != nil {
+					WriteError(w, http.StatusBadRequest, "invalid request body")
+					return
+				}
+			}
+			if err := app.StartReindex(req); err != nil {
+				if errors.Is(err, document.ErrReindexRunning) {
+					WriteError(w, http.StatusConflict, "重建索引任务正在进行中")
+					return
+				}
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusAccepted, app.ReindexStatus())
+		case http.MethodDelete:
+			if !app.CancelReindex() {
+				WriteError(w, http.StatusConflict, "没有可取消的重建索引任务")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleReindexEvents streams the progress of the re-embedding job as SSE
+// "progress" events, ending with a "done" event once the job stops.
+// GET /api/admin/reindex/events
+func HandleReindexEvents(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, role, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		if role != "super_admin" {
+			WriteError(w, http.StatusForbidden, "仅超级管理员可重建向量索引")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			WriteError(w, http.StatusInternalServerError, "streaming not supported")
+			return
+		}
+		// A large corpus takes longer than the server's write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		sendSSE := func(event string, data interface{}) {
+			jsonData, _ := json.Marshal(data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, jsonData)
+			flusher.Flush()
+		}
+
+		ticker := time.NewTicker(reindexPollInterval)
+		defer ticker.Stop()
+		for {
+			status := app.ReindexStatus()
+			if !status.Running() {
+				sendSSE("done", status)
+				return
+			}
+			sendSSE("progress", status)
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
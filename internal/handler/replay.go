@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"askflow/internal/replay"
+)
+
+// HandleReplaySamples lists (GET) and creates (POST) samples of logged
+// queries for replays.
+// POST /api/admin/replay/samples {"name": "...", "product_id": "", "size": 50, "from": "2024-06-01", "to": ""}
+func HandleReplaySamples(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requireReplayAdmin(app, w, r)
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			list, err := app.ListReplaySamples()
+			if err != nil {
+				log.Printf("[Replay] list samples error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取回放样本失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"samples": list})
+		case http.MethodPost:
+			var in replay.SampleInput
+			if err := ReadJSONBody(r, &in); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if !IsValidOptionalID(in.ProductID) {
+				WriteError(w, http.StatusBadRequest, "invalid product_id")
+				return
+			}
+			sample, err := app.CreateReplaySample(in, userID)
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, sample)
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleReplaySampleByID deletes a sample (DELETE /api/admin/replay/samples/{id}),
+// and lists (GET) and starts (POST) its runs at /api/admin/replay/samples/{id}/runs.
+func HandleReplaySampleByID(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := requireReplayAdmin(app, w, r)
+		if !ok {
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/admin/replay/samples/")
+		runs := strings.HasSuffix(id, "/runs")
+		id = strings.TrimSuffix(id, "/runs")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid sample ID")
+			return
+		}
+
+		switch {
+		case runs && r.Method == http.MethodGet:
+			list, err := app.ReplayRuns(id)
+			if err != nil {
+				log.Printf("[Replay] list runs error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取回放记录失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"runs": list})
+		case runs && r.Method == http.MethodPost:
+			runID, err := app.StartReplay(id, userID)
+			if err != nil {
+				writeReplayError(w, err)
+				return
+			}
+			WriteJSON(w, http.StatusAccepted, map[string]string{"run_id": runID, "job_id": runID})
+		case !runs && r.Method == http.MethodDelete:
+			if err := app.DeleteReplaySample(id); err != nil {
+				writeReplayError(w, err)
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"message": "回放样本已删除"})
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleReplayRun returns the change report of a run against a baseline:
+// "original" for the answers logged when users asked, the ID of an earlier
+// run, or by default the previous finished run.
+// GET /api/admin/replay/runs/{id}?baseline=
+func HandleReplayRun(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireReplayAdmin(app, w, r); !ok {
+			return
+		}
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/admin/replay/runs/")
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid run ID")
+			return
+		}
+		baseline := r.URL.Query().Get("baseline")
+		if baseline != "" && baseline != replay.BaselineOriginal && !IsValidHexID(baseline) {
+			WriteError(w, http.StatusBadRequest, "invalid baseline")
+			return
+		}
+		rep, err := app.ReplayReport(id, baseline)
+		if err != nil {
+			writeReplayError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, rep)
+	}
+}
+
+// requireReplayAdmin checks for a super admin session, since replays read
+// the questions of all users and spend model calls, writing the error
+// response when it fails.
+func requireReplayAdmin(app *App, w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID, role, err := GetAdminSession(app, r)
+	if err != nil {
+		WriteAdminSessionError(w, err)
+		return "", false
+	}
+	if role != "super_admin" {
+		WriteError(w, http.StatusForbidden, "仅超级管理员可使用查询回放")
+		return "", false
+	}
+	return userID, true
+}
+
+func writeReplayError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, replay.ErrNotFound):
+		WriteError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, replay.ErrRunning):
+		WriteError(w, http.StatusConflict, err.Error())
+	default:
+		log.Printf("[Replay] error: %v", err)
+		WriteError(w, http.StatusInternalServerError, "查询回放失败")
+	}
+}
@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"askflow/internal/analytics"
+)
+
+// parseReportDate accepts either YYYY-MM-DD or RFC3339. An empty string yields the zero time.
+func parseReportDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// HandleUsageReport returns per-customer (or per-organisation) usage statistics.
+// GET /api/admin/reports/usage?product_id=&from=&to=&group_by=user|org&format=json|csv
+// The "to" date is exclusive when given with a time; a bare date includes that whole day.
+func HandleUsageReport(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		q := r.URL.Query()
+		productID := q.Get("product_id")
+		if !IsValidOptionalID(productID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		from, err := parseReportDate(q.Get("from"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid from date (expected YYYY-MM-DD or RFC3339)")
+			return
+		}
+		to, err := parseReportDate(q.Get("to"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid to date (expected YYYY-MM-DD or RFC3339)")
+			return
+		}
+		if len(q.Get("to")) == len("2006-01-02") {
+			to = to.AddDate(0, 0, 1)
+		}
+		groupBy := q.Get("group_by")
+		switch groupBy {
+		case "", analytics.GroupByUser:
+			groupBy = analytics.GroupByUser
+		case analytics.GroupByOrg:
+		default:
+			WriteError(w, http.StatusBadRequest, "group_by must be user or org")
+			return
+		}
+
+		report, err := app.UsageReport(analytics.UsageFilter{
+			ProductID: productID,
+			From:      from,
+			To:        to,
+			GroupBy:   groupBy,
+		})
+		if err != nil {
+			log.Printf("[Report] usage report error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "生成使用报表失败")
+			return
+		}
+
+		if q.Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=usage_%s.csv", groupBy))
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			// UTF-8 BOM so spreadsheet tools detect the encoding of non-ASCII labels
+			w.Write([]byte("\xEF\xBB\xBF"))
+			cw := csv.NewWriter(w)
+			cw.Write([]string{"key", "label", "queries", "unique_users", "escalations", "escalation_rate", "rated", "positive", "satisfaction", "verified", "faithfulness"})
+			for _, row := range report {
+				cw.Write([]string{
+					row.Key, row.Label,
+					strconv.Itoa(row.Queries), strconv.Itoa(row.UniqueUsers), strconv.Itoa(row.Escalations),
+					strconv.FormatFloat(row.EscalationRate, 'f', 4, 64),
+					strconv.Itoa(row.Rated), strconv.Itoa(row.Positive),
+					strconv.FormatFloat(row.Satisfaction, 'f', 4, 64),
+					strconv.Itoa(row.Verified), strconv.FormatFloat(row.Faithfulness, 'f', 4, 64),
+				})
+			}
+			cw.Flush()
+			return
+		}
+
+		WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"group_by": groupBy,
+			"rows":     report,
+		})
+	}
+}
+
+// HandleDeflectionReport returns the question deflection funnel: how many
+// support sessions ended with an answer, were escalated to a human, or were
+// abandoned, overall and per product.
+// GET /api/admin/reports/deflection?product_id=&from=&to=&format=json|csv
+func HandleDeflectionReport(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		q := r.URL.Query()
+		productID := q.Get("product_id")
+		if !IsValidOptionalID(productID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		from, err := parseReportDate(q.Get("from"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid from date (expected YYYY-MM-DD or RFC3339)")
+			return
+		}
+		to, err := parseReportDate(q.Get("to"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid to date (expected YYYY-MM-DD or RFC3339)")
+			return
+		}
+		if len(q.Get("to")) == len("2006-01-02") {
+			to = to.AddDate(0, 0, 1)
+		}
+
+		report, err := app.DeflectionReport(analytics.DeflectionFilter{
+			ProductID: productID,
+			From:      from,
+			To:        to,
+		})
+		if err != nil {
+			log.Printf("[Report] deflection report error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "生成问题分流报表失败")
+			return
+		}
+
+		if q.Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", "attachment; filename=deflection.csv")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Write([]byte("\xEF\xBB\xBF"))
+			cw := csv.NewWriter(w)
+			cw.Write([]string{"product_id", "product_name", "sessions", "answered", "resolved", "confirmed_resolved",
+				"escalated", "auto_escalated", "manual_escalated", "abandoned", "active",
+				"deflection_rate", "escalation_rate", "abandon_rate"})
+			writeRow := func(id, name string, row analytics.FunnelRow) {
+				cw.Write([]string{
+					id, name,
+					strconv.Itoa(row.Sessions), strconv.Itoa(row.Answered), strconv.Itoa(row.Resolved), strconv.Itoa(row.ConfirmedResolved),
+					strconv.Itoa(row.Escalated), strconv.Itoa(row.AutoEscalated), strconv.Itoa(row.ManualEscalated),
+					strconv.Itoa(row.Abandoned), strconv.Itoa(row.Active),
+					strconv.FormatFloat(row.DeflectionRate, 'f', 4, 64),
+					strconv.FormatFloat(row.EscalationRate, 'f', 4, 64),
+					strconv.FormatFloat(row.AbandonRate, 'f', 4, 64),
+				})
+			}
+			for _, row := range report.Products {
+				writeRow(row.ProductID, row.ProductName, row)
+			}
+			writeRow("*", "total", report.Total)
+			cw.Flush()
+			return
+		}
+
+		WriteJSON(w, http.StatusOK, report)
+	}
+}
+
+// HandleFeedbackReport returns answer helpfulness per product, the documents
+// cited by the most unhelpful answers, and the latest rated answers.
+// GET /api/admin/feedback?product_id=&from=&to=&rating=1|-1&limit=50&format=json|csv
+// The csv format exports the per-product rows only.
+func HandleFeedbackReport(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		q := r.URL.Query()
+		f := analytics.FeedbackFilter{ProductID: q.Get("product_id")}
+		if !IsValidOptionalID(f.ProductID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		if f.From, err = parseReportDate(q.Get("from")); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid from date (expected YYYY-MM-DD or RFC3339)")
+			return
+		}
+		if f.To, err = parseReportDate(q.Get("to")); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid to date (expected YYYY-MM-DD or RFC3339)")
+			return
+		}
+		if len(q.Get("to")) == len("2006-01-02") {
+			f.To = f.To.AddDate(0, 0, 1)
+		}
+		switch q.Get("rating") {
+		case "":
+		case "1":
+			f.Rating = analytics.RatingUp
+		case "-1":
+			f.Rating = analytics.RatingDown
+		default:
+			WriteError(w, http.StatusBadRequest, "rating must be 1 or -1")
+			return
+		}
+		if v := q.Get("limit"); v != "" {
+			if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 || f.Limit > 500 {
+				WriteError(w, http.StatusBadRequest, "limit must be between 1 and 500")
+				return
+			}
+		}
+
+		report, err := app.FeedbackReport(f)
+		if err != nil {
+			log.Printf("[Report] feedback report error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "生成回答评价报表失败")
+			return
+		}
+
+		if q.Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", "attachment; filename=feedback.csv")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Write([]byte("\xEF\xBB\xBF"))
+			cw := csv.NewWriter(w)
+			cw.Write([]string{"product_id", "product_name", "rated", "helpful", "unhelpful", "commented", "helpfulness_rate"})
+			writeRow := func(id, name string, row analytics.FeedbackRow) {
+				cw.Write([]string{
+					id, name,
+					strconv.Itoa(row.Rated), strconv.Itoa(row.Helpful), strconv.Itoa(row.Unhelpful), strconv.Itoa(row.Commented),
+					strconv.FormatFloat(row.HelpfulnessRate, 'f', 4, 64),
+				})
+			}
+			for _, row := range report.Products {
+				writeRow(row.ProductID, row.ProductName, row)
+			}
+			writeRow("*", "total", report.Total)
+			cw.Flush()
+			return
+		}
+
+		WriteJSON(w, http.StatusOK, report)
+	}
+}
+
+// HandleProductHealth returns the knowledge base health score of a product with its contributing factors.
+// GET /api/admin/products/{id}/health
+func HandleProductHealth(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+
+		rest := strings.TrimPrefix(r.URL.Path, "/api/admin/products/")
+		id, action, _ := strings.Cut(rest, "/")
+		if action != "health" {
+			WriteError(w, http.StatusNotFound, "not found")
+			return
+		}
+		if !IsValidHexID(id) {
+			WriteError(w, http.StatusBadRequest, "invalid product ID")
+			return
+		}
+		if _, err := app.GetProduct(id); err != nil {
+			WriteError(w, http.StatusNotFound, "产品不存在")
+			return
+		}
+
+		health, err := app.ProductHealth(id)
+		if err != nil {
+			log.Printf("[Report] product health error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "计算知识库健康度失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, health)
+	}
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"askflow/internal/document"
+)
+
+// HandleReviewQueue lists knowledge entries and answers awaiting review.
+// GET /api/review?status=draft|in_review&product_id=&assigned=me
+func HandleReviewQueue(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		userID, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		q := r.URL.Query()
+		status := q.Get("status")
+		if !document.ValidReviewFilter(status) {
+			WriteError(w, http.StatusBadRequest, "invalid status")
+			return
+		}
+		productID := q.Get("product_id")
+		if !IsValidOptionalID(productID) {
+			WriteError(w, http.StatusBadRequest, "invalid product_id")
+			return
+		}
+		reviewerID := ""
+		if q.Get("assigned") == "me" {
+			reviewerID = userID
+		}
+		items, err := app.ListReviewQueue(status, productID, reviewerID)
+		if err != nil {
+			log.Printf("[Review] list error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取审核队列失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+	}
+}
+
+// HandleReviewItem returns one entry of the review queue with its full text.
+// GET /api/review/{id}
+func HandleReviewItem(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, _, err := GetAdminSession(app, r); err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/review/")
+		if id == "" || len(id) > 128 || strings.ContainsAny(id, "/\\") {
+			WriteError(w, http.StatusBadRequest, "invalid ID")
+			return
+		}
+		item, err := app.GetReviewItem(id)
+		if err != nil {
+			WriteError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, item)
+	}
+}
+
+// HandleReviewers lists the admins entries can be assigned to for review.
+// GET /api/review/reviewers
+func HandleReviewers(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, _, err := GetAdminSession(app, r); err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		reviewers, err := app.ListReviewers()
+		if err != nil {
+			log.Printf("[Review] reviewers error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取审核人失败")
+			return
+		}
+		if reviewers == nil {
+			reviewers = []Reviewer{}
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"reviewers": reviewers})
+	}
+}
+
+// HandleReviewAction submits, approves or rejects one or more entries.
+// POST /api/review/action {"ids": ["..."], "action": "submit|approve|reject", "reviewer_id": "...", "note": "..."}
+func HandleReviewAction(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		userID, role, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		var req struct {
+			IDs        []string `json:"ids"`
+			Action     string   `json:"action"`
+			ReviewerID string   `json:"reviewer_id"`
+			Note       string   `json:"note"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if len(req.IDs) == 0 || len(req.IDs) > 200 {
+			WriteError(w, http.StatusBadRequest, "请选择1到200个条目")
+			return
+		}
+		if len(req.Note) > 2000 {
+			WriteError(w, http.StatusBadRequest, "审核意见过长（最多2000字符）")
+			return
+		}
+		results, err := app.ApplyReviewAction(req.IDs, req.Action, userID, role, req.ReviewerID, strings.TrimSpace(req.Note))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"askflow/internal/config"
+)
+
+// requireSuperAdmin requires a super admin session. On failure it writes the
+// error response and returns false.
+func requireSuperAdmin(app *App, w http.ResponseWriter, r *http.Request) bool {
+	_, role, err := GetAdminSession(app, r)
+	if err != nil {
+		WriteAdminSessionError(w, err)
+		return false
+	}
+	if role != "super_admin" {
+		WriteError(w, http.StatusForbidden, "无权限")
+		return false
+	}
+	return true
+}
+
+// HandleSourceCredentials lists and sets the credentials attached to source
+// URL fetches of a domain, for URL imports and feeds from sites that require
+// login. Secrets are returned masked; a masked value keeps the saved secret.
+// GET /api/source-credentials
+// PUT /api/source-credentials {"domain","headers","cookies","username","password"}
+func HandleSourceCredentials(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireSuperAdmin(app, w, r) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"credentials": app.ListSourceCredentials()})
+		case http.MethodPut:
+			var req struct {
+				Domain string `json:"domain"`
+				config.SourceCredential
+			}
+			if err := ReadJSONBody(r, &req); err != nil {
+				WriteError(w, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if len(req.Headers) > 20 {
+				WriteError(w, http.StatusBadRequest, "请求头过多")
+				return
+			}
+			if err := app.SetSourceCredential(req.Domain, req.SourceCredential); err != nil {
+				WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// HandleSourceCredentialDelete removes the credential of a domain.
+// DELETE /api/source-credentials/{domain}
+func HandleSourceCredentialDelete(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if !requireSuperAdmin(app, w, r) {
+			return
+		}
+		domain := strings.TrimPrefix(r.URL.Path, "/api/source-credentials/")
+		if domain == "" || len(domain) > 253 || strings.ContainsAny(domain, "/<>\"'\\") {
+			WriteError(w, http.StatusBadRequest, "invalid domain")
+			return
+		}
+		if err := app.DeleteSourceCredential(domain); err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
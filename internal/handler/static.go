@@ -5,6 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"askflow/internal/datadir"
+	"askflow/internal/document"
 )
 
 // NoDirListing wraps an http.Handler to prevent directory listing.
@@ -91,19 +94,10 @@ func HandleMediaStream(app *App) http.HandlerFunc {
 			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
 			return
 		}
-		// Authenticate: support both Authorization header and ?token= query param
-		// (query param needed for <video> src attributes that can't set headers)
-		authHeader := r.Header.Get("Authorization")
-		token := strings.TrimPrefix(authHeader, "Bearer ")
-		if token == "" || token == authHeader {
-			token = r.URL.Query().Get("token")
-		}
-		if token == "" {
-			WriteError(w, http.StatusUnauthorized, "未登录")
-			return
-		}
-		if _, sErr := app.sessionManager.ValidateSession(token); sErr != nil {
-			WriteError(w, http.StatusUnauthorized, "会话已过期")
+		// Authenticate: support the Authorization header, ?token= and ?op_token=
+		// (query params needed for <video> src attributes that can't set headers)
+		if _, err := getLinkSession(app, r); err != nil {
+			WriteError(w, http.StatusUnauthorized, err.Error())
 			return
 		}
 		docID := strings.TrimPrefix(r.URL.Path, "/api/media/")
@@ -125,7 +119,7 @@ func HandleMediaStream(app *App) http.HandlerFunc {
 		}
 		// Verify file path stays within expected data directory
 		absPath, _ := filepath.Abs(filePath)
-		absDataDir, _ := filepath.Abs(filepath.Join(".", "data"))
+		absDataDir, _ := filepath.Abs(datadir.Root())
 		if realPath, err := filepath.EvalSymlinks(absPath); err == nil {
 			absPath = realPath
 		}
@@ -177,17 +171,54 @@ func ServeImages() http.HandlerFunc {
 			http.NotFound(w, r)
 			return
 		}
-		filePath := filepath.Join(".", "data", "images", name)
+		filePath := datadir.Path("images", name)
 		// Verify the resolved path stays within the images directory
-		absDir, _ := filepath.Abs(filepath.Join(".", "data", "images"))
+		absDir, _ := filepath.Abs(datadir.Path("images"))
 		absFile, _ := filepath.Abs(filePath)
 		if !strings.HasPrefix(absFile, absDir+string(filepath.Separator)) && absFile != absDir {
 			http.NotFound(w, r)
 			return
 		}
+		// ?size=thumb|medium serves a scaled copy, generated and cached on first use
+		servePath, err := document.ImageVariantPath(name, r.URL.Query().Get("size"))
+		if err == document.ErrInvalidImageSize {
+			http.Error(w, "invalid size", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		// Never list directories (e.g. the variants cache)
+		if info, statErr := os.Stat(servePath); statErr != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		// Content-addressed names never change content, so they can be cached for good;
+		// legacy random names are cached for a day.
+		if isContentAddressedImage(name) {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age=86400")
+		}
 		w.Header().Set("X-Content-Type-Options", "nosniff")
-		http.ServeFile(w, r, filePath)
+		http.ServeFile(w, r, servePath)
+	}
+}
+
+// isContentAddressedImage reports whether an image file name is a SHA-256 hex
+// digest plus extension, i.e. its content can never change.
+func isContentAddressedImage(name string) bool {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if len(base) != 64 {
+		return false
+	}
+	for _, c := range base {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
 	}
+	return true
 }
 
 // ServeKnowledgeVideos returns an http.HandlerFunc that serves uploaded knowledge videos
@@ -199,9 +230,9 @@ func ServeKnowledgeVideos() http.HandlerFunc {
 			http.NotFound(w, r)
 			return
 		}
-		filePath := filepath.Join(".", "data", "videos", "knowledge", name)
+		filePath := datadir.Path("videos", "knowledge", name)
 		// Verify the resolved path stays within the videos directory
-		absDir, _ := filepath.Abs(filepath.Join(".", "data", "videos", "knowledge"))
+		absDir, _ := filepath.Abs(datadir.Path("videos", "knowledge"))
 		absFile, _ := filepath.Abs(filePath)
 		if !strings.HasPrefix(absFile, absDir+string(filepath.Separator)) && absFile != absDir {
 			http.NotFound(w, r)
@@ -2,22 +2,32 @@ package handler
 
 import (
 	"compress/gzip"
+	"errors"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"askflow/internal/backup"
 	"askflow/internal/config"
 	"askflow/internal/email"
 	"askflow/internal/embedding"
 	"askflow/internal/errlog"
+	"askflow/internal/export"
 	"askflow/internal/llm"
+	"askflow/internal/maintenance"
+	"askflow/internal/query"
+	"askflow/internal/status"
 )
 
 // --- System status handler (public) ---
 
-// HandleSystemStatus returns whether the system is ready (configured and has products).
+// HandleSystemStatus returns whether the system is ready (configured and has products)
+// and whether answers are degraded because the embedding service is down.
 func HandleSystemStatus(app *App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -34,12 +44,44 @@ func HandleSystemStatus(app *App) http.HandlerFunc {
 				ready = false
 			}
 		}
+		health := app.EmbeddingHealth()
 		WriteJSON(w, http.StatusOK, map[string]interface{}{
-			"ready": ready,
+			"ready":          ready,
+			"read_only":      app.IsReadOnly(),
+			"degraded":       health.Degraded,
+			"degraded_since": health.Since,
 		})
 	}
 }
 
+// HandlePublicStatus returns the aggregate availability of the service for the
+// public status page. No authentication is required, so only overall states
+// and the 24h availability percentage are exposed. Results are cached briefly
+// so the endpoint stays cheap under polling.
+// GET /api/status
+func HandlePublicStatus(app *App) http.HandlerFunc {
+	const cacheTTL = 30 * time.Second
+	var cacheMu sync.Mutex
+	var cached *status.Status
+	var cachedAt time.Time
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		cacheMu.Lock()
+		if cached == nil || time.Since(cachedAt) > cacheTTL {
+			cached = app.PublicStatus()
+			cachedAt = time.Now()
+		}
+		st := cached
+		cacheMu.Unlock()
+		w.Header().Set("Cache-Control", "public, max-age=30")
+		WriteJSON(w, http.StatusOK, st)
+	}
+}
+
 // --- LLM test handler (admin only) ---
 
 // HandleTestLLM tests LLM connectivity with the provided or saved configuration.
@@ -55,6 +97,7 @@ func HandleTestLLM(app *App) http.HandlerFunc {
 			return
 		}
 		var req struct {
+			Provider    string  `json:"provider"`
 			Endpoint    string  `json:"endpoint"`
 			APIKey      string  `json:"api_key"`
 			ModelName   string  `json:"model_name"`
@@ -72,7 +115,8 @@ func HandleTestLLM(app *App) http.HandlerFunc {
 				req.APIKey = cfg.LLM.APIKey
 			}
 		}
-		if req.Endpoint == "" || req.APIKey == "" || req.ModelName == "" {
+		// A local Ollama server needs no API key
+		if req.Endpoint == "" || req.ModelName == "" || (req.APIKey == "" && req.Provider != config.LLMProviderOllama) {
 			WriteError(w, http.StatusBadRequest, "endpoint, api_key, model_name are required")
 			return
 		}
@@ -82,7 +126,7 @@ func HandleTestLLM(app *App) http.HandlerFunc {
 		if req.MaxTokens == 0 {
 			req.MaxTokens = 64
 		}
-		svc := llm.NewAPILLMService(req.Endpoint, req.APIKey, req.ModelName, req.Temperature, req.MaxTokens)
+		svc := llm.NewService(req.Provider, req.Endpoint, req.APIKey, req.ModelName, req.Temperature, req.MaxTokens)
 		answer, err := svc.Generate("", nil, "请回复：OK")
 		if err != nil {
 			log.Printf("[TestLLM] error: %v", err)
@@ -139,6 +183,57 @@ func HandleTestEmbedding(app *App) http.HandlerFunc {
 	}
 }
 
+// --- Rerank test handler (admin only) ---
+
+// HandleTestRerank tests the rerank API with the provided or saved
+// configuration by ranking two sample passages against a sample question.
+func HandleTestRerank(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, _, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		var req struct {
+			Endpoint  string `json:"endpoint"`
+			APIKey    string `json:"api_key"`
+			ModelName string `json:"model_name"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		// If API key is empty, fall back to saved config (user didn't re-enter it)
+		if req.APIKey == "" {
+			cfg := app.configManager.Get()
+			if cfg != nil {
+				req.APIKey = cfg.Rerank.APIKey
+			}
+		}
+		// Self-hosted rerank servers often need no key
+		if req.Endpoint == "" || req.ModelName == "" {
+			WriteError(w, http.StatusBadRequest, "endpoint, model_name are required")
+			return
+		}
+		rr := query.NewReranker(req.Endpoint, req.APIKey, req.ModelName)
+		results, err := rr.Rerank("如何重置密码？", []string{
+			"本产品支持 Windows、macOS 和 Linux 操作系统。",
+			"在登录页点击“忘记密码”，按邮件中的链接即可重置密码。",
+		}, 2)
+		if err != nil {
+			log.Printf("[TestRerank] error: %v", err)
+			WriteError(w, http.StatusBadRequest, "Rerank 连接测试失败，请检查配置")
+			return
+		}
+		// The second passage answers the question and should rank first
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "results": results, "ranked_correctly": results[0].Index == 1})
+	}
+}
+
 // --- Config handler with role check ---
 
 // HandleConfigWithRole handles GET (read config) and PUT (update config, super_admin only).
@@ -168,6 +263,10 @@ func HandleConfigWithRole(app *App) http.HandlerFunc {
 				WriteError(w, http.StatusBadRequest, "invalid request body")
 				return
 			}
+			if app.reindexConflict(updates) {
+				WriteError(w, http.StatusConflict, "正在重建向量索引，暂不能修改向量模型设置")
+				return
+			}
 			if err := app.UpdateConfig(updates); err != nil {
 				log.Printf("[Config] update error: %v", err)
 				errlog.Logf("[Config] update failed: %v", err)
@@ -253,6 +352,42 @@ func HandleEmailTest(app *App) http.HandlerFunc {
 	}
 }
 
+// --- Notification test handler ---
+
+// HandleNotificationTest sends a test message through a notification channel.
+// The webhook URL and secret in the request allow testing before saving; when
+// empty, the saved ones are used.
+// POST /api/notifications/test
+func HandleNotificationTest(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, _, err := GetAdminSession(app, r); err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		var req struct {
+			Channel    string `json:"channel"`
+			WebhookURL string `json:"webhook_url"`
+			Secret     string `json:"secret"`
+		}
+		if err := ReadJSONBody(r, &req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		ch := config.NotifyChannel{WebhookURL: strings.TrimSpace(req.WebhookURL), Secret: strings.TrimSpace(req.Secret)}
+		if err := app.TestNotification(req.Channel, ch); err != nil {
+			log.Printf("[NotifyTest] %s error: %v", req.Channel, err)
+			errlog.Logf("[Notify] test send to %s failed: %v", req.Channel, err)
+			WriteError(w, http.StatusBadRequest, "发送测试消息失败: "+err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, map[string]string{"status": "ok", "message": "测试消息已发送"})
+	}
+}
+
 // --- Log handlers (super_admin only) ---
 
 // HandleLogsRecent returns the most recent log lines.
@@ -333,6 +468,226 @@ func HandleLogsRotation(app *App) http.HandlerFunc {
 	}
 }
 
+// HandleMaintenance returns the database maintenance schedule and the
+// results of recent runs.
+// GET /api/admin/maintenance
+func HandleMaintenance(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, _, err := GetAdminSession(app, r); err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		st, err := app.MaintenanceStatus()
+		if err != nil {
+			log.Printf("[Maintenance] status error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取数据库维护记录失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, st)
+	}
+}
+
+// HandleMaintenanceRun starts a database maintenance run immediately.
+// POST /api/admin/maintenance/run
+func HandleMaintenanceRun(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, role, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		if role != "super_admin" {
+			WriteError(w, http.StatusForbidden, "无权限")
+			return
+		}
+		if err := app.StartMaintenance(); err != nil {
+			if errors.Is(err, maintenance.ErrRunning) {
+				WriteError(w, http.StatusConflict, "数据库维护正在进行中")
+				return
+			}
+			WriteError(w, http.StatusInternalServerError, "启动数据库维护失败")
+			return
+		}
+		WriteJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+	}
+}
+
+// HandleExport returns the analytics export schedule and the results of
+// recent runs.
+// GET /api/admin/export
+func HandleExport(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, _, err := GetAdminSession(app, r); err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		st, err := app.ExportStatus()
+		if err != nil {
+			log.Printf("[Export] status error: %v", err)
+			WriteError(w, http.StatusInternalServerError, "获取数据导出记录失败")
+			return
+		}
+		WriteJSON(w, http.StatusOK, st)
+	}
+}
+
+// HandleBudget returns the model spend of a month against the budget caps.
+// Caps are set through the config keys budget.*.
+// GET /api/admin/budget?month=YYYY-MM
+func HandleBudget(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if _, _, err := GetAdminSession(app, r); err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		rep, err := app.BudgetReport(r.URL.Query().Get("month"))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		WriteJSON(w, http.StatusOK, rep)
+	}
+}
+
+// HandleExportRun starts an analytics export immediately, whether or not
+// scheduled export is enabled.
+// POST /api/admin/export/run
+func HandleExportRun(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		_, role, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		if role != "super_admin" {
+			WriteError(w, http.StatusForbidden, "无权限")
+			return
+		}
+		if err := app.StartExport(); err != nil {
+			if errors.Is(err, export.ErrRunning) {
+				WriteError(w, http.StatusConflict, "数据导出正在进行中")
+				return
+			}
+			WriteError(w, http.StatusInternalServerError, "启动数据导出失败")
+			return
+		}
+		WriteJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+	}
+}
+
+// HandleBackup makes online backups while the service keeps running and
+// lists recent ones. A server backup is saved under data/backups (and
+// uploaded to backup.s3 when configured); a download backup is streamed as
+// the response body. Incremental backups are based on the latest server backup.
+// GET  /api/admin/backup
+// POST /api/admin/backup {"mode": "full|incremental", "target": "server|download"}
+func HandleBackup(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, role, err := GetAdminSession(app, r)
+		if err != nil {
+			WriteAdminSessionError(w, err)
+			return
+		}
+		if role != "super_admin" {
+			WriteError(w, http.StatusForbidden, "无权限")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			running, records, err := app.BackupHistory()
+			if err != nil {
+				log.Printf("[Backup] history error: %v", err)
+				WriteError(w, http.StatusInternalServerError, "获取备份记录失败")
+				return
+			}
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"running": running, "records": records})
+
+		case http.MethodPost:
+			var req struct {
+				Mode   string `json:"mode"`
+				Target string `json:"target"`
+			}
+			if r.ContentLength != 0 {
+				if err := ReadJSONBody(r, &req); err != nil {
+					WriteError(w, http.StatusBadRequest, "invalid request body")
+					return
+				}
+			}
+			if req.Mode == "" {
+				req.Mode = "full"
+			}
+			if req.Target == "" {
+				req.Target = backup.TargetServer
+			}
+			if req.Mode != "full" && req.Mode != "incremental" {
+				WriteError(w, http.StatusBadRequest, "备份模式无效，可选 full 或 incremental")
+				return
+			}
+			if req.Target != backup.TargetServer && req.Target != backup.TargetDownload {
+				WriteError(w, http.StatusBadRequest, "备份目标无效，可选 server 或 download")
+				return
+			}
+			// A large database takes longer than the server's write timeout
+			http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+			if req.Target == backup.TargetServer {
+				rec, err := app.SaveBackup(req.Mode, userID)
+				if err != nil {
+					writeBackupError(w, err)
+					return
+				}
+				WriteJSON(w, http.StatusOK, rec)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+backup.ArchiveName(req.Mode, time.Now())+`"`)
+			rec, err := app.StreamBackup(w, req.Mode, userID)
+			if err != nil {
+				if rec != nil && rec.SizeBytes > 0 {
+					// Part of the archive is sent: abort so the client sees a broken download
+					panic(http.ErrAbortHandler)
+				}
+				w.Header().Del("Content-Disposition")
+				writeBackupError(w, err)
+			}
+
+		default:
+			WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// writeBackupError reports a failed online backup.
+func writeBackupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, backup.ErrRunning) {
+		WriteError(w, http.StatusConflict, "备份正在进行中")
+		return
+	}
+	WriteError(w, http.StatusInternalServerError, "备份失败: "+err.Error())
+}
+
 // HandleLogsDownload streams the current error.log as a gzip download.
 // GET /api/logs/download
 func HandleLogsDownload(app *App) http.HandlerFunc {
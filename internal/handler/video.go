@@ -15,6 +15,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"askflow/internal/textutil"
 	"askflow/internal/video"
 )
 
@@ -265,10 +266,7 @@ func HandleVideoAutoSetup(app *App) http.HandlerFunc {
 				if strings.Contains(line, "[sudo]") || strings.Contains(line, "password for") {
 					continue
 				}
-				if len(line) > 500 {
-					line = line[:500] + "..."
-				}
-				sendSSE("log", line, -1)
+				sendSSE("log", textutil.Ellipsize(line, 500), -1)
 			}
 			return cmd.Wait()
 		}
@@ -0,0 +1,18 @@
+// Package idgen generates the random identifiers used as primary keys of
+// products, documents, jobs and the other stored records.
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// New returns a random 32-character hex string.
+func New() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
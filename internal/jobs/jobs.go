@@ -0,0 +1,422 @@
+// Package jobs runs long background work — document processing, batch
+// imports, re-embedding — on a bounded worker pool and records every job in
+// the database, so admins can see what is running and cancel it.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"askflow/internal/errlog"
+	"askflow/internal/idgen"
+)
+
+// Job states.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// Job types.
+const (
+	TypeDocument    = "document"     // processing of an uploaded or imported document
+	TypeBatchImport = "batch_import" // import of a server directory from the admin panel
+	TypeReindex     = "reindex"      // re-embedding of all documents with a new model
+	TypeCrawl       = "crawl"        // whole-site import from a root URL
+	TypeBulkAnswer  = "bulk_answer"  // import of answers to pending questions
+	TypeReplay      = "replay"       // replay of a sample of logged queries
+)
+
+const (
+	// DefaultConcurrency is the number of pooled jobs run at the same time
+	// when the config does not set it.
+	DefaultConcurrency = 2
+	// MaxConcurrency bounds the configurable worker count.
+	MaxConcurrency = 16
+	// keepDays is how long finished jobs stay listed.
+	keepDays = 30
+)
+
+var (
+	// ErrNotFound is returned for an unknown job ID.
+	ErrNotFound = errors.New("job not found")
+	// ErrFinished is returned when canceling a job that already stopped.
+	ErrFinished = errors.New("job already finished")
+	// ErrNotCancelable is returned by the cancel function of a tracked job
+	// that cannot be stopped at this point.
+	ErrNotCancelable = errors.New("job cannot be canceled now")
+)
+
+// Job is the record of one background job.
+type Job struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	Target     string     `json:"target,omitempty"` // the object worked on, e.g. a document ID
+	Label      string     `json:"label,omitempty"`  // human-readable name, e.g. the file name
+	Status     string     `json:"status"`
+	Progress   int        `json:"progress"` // percent
+	Message    string     `json:"message,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Func is the work of a pooled job. It should stop when ctx is canceled and
+// may report its progress through p.
+type Func func(ctx context.Context, p *Progress) error
+
+// ListFilter selects jobs for List. Empty fields match everything.
+type ListFilter struct {
+	Status string
+	Type   string
+	Limit  int
+	Offset int
+}
+
+// task is a pooled job waiting for or holding a worker.
+type task struct {
+	id     string
+	label  string
+	fn     Func
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Queue runs pooled jobs with bounded concurrency and tracks jobs that run
+// elsewhere, such as an import streamed to the admin panel.
+type Queue struct {
+	db *sql.DB
+
+	mu          sync.Mutex
+	concurrency int
+	active      int
+	pending     []*task
+	cancels     map[string]func() error // started jobs, pooled or tracked
+	canceled    map[string]bool         // started jobs an admin canceled
+}
+
+// NewQueue creates a queue that runs up to concurrency pooled jobs at once.
+// Jobs left queued or running by a previous process are marked failed: their
+// work died with that process.
+func NewQueue(db *sql.DB, concurrency int) *Queue {
+	q := &Queue{
+		db:       db,
+		cancels:  make(map[string]func() error),
+		canceled: make(map[string]bool),
+	}
+	q.concurrency = clampConcurrency(concurrency)
+	if res, err := db.Exec(
+		`UPDATE jobs SET status = ?, error = ?, finished_at = ? WHERE status IN (?, ?)`,
+		StatusFailed, "服务重启，任务中断", time.Now().UTC(), StatusQueued, StatusRunning,
+	); err != nil {
+		log.Printf("[Jobs] failed to close interrupted jobs: %v", err)
+	} else if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("[Jobs] %d jobs interrupted by the last shutdown", n)
+	}
+	db.Exec(`DELETE FROM jobs WHERE finished_at < ?`, time.Now().UTC().AddDate(0, 0, -keepDays))
+	return q
+}
+
+// clampConcurrency returns n within 1..MaxConcurrency, or the default for 0.
+func clampConcurrency(n int) int {
+	switch {
+	case n <= 0:
+		return DefaultConcurrency
+	case n > MaxConcurrency:
+		return MaxConcurrency
+	}
+	return n
+}
+
+// SetConcurrency changes the number of pooled jobs run at once. Running jobs
+// are not interrupted when it shrinks.
+func (q *Queue) SetConcurrency(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.concurrency = clampConcurrency(n)
+	q.dispatchLocked()
+}
+
+// Submit queues fn as a job of the given type and returns its ID. target and
+// label identify what the job works on in the job list.
+func (q *Queue) Submit(typ, target, label string, fn Func) (string, error) {
+	id, err := q.insert(typ, target, label, StatusQueued)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q.mu.Lock()
+	q.pending = append(q.pending, &task{id: id, label: label, fn: fn, ctx: ctx, cancel: cancel})
+	q.dispatchLocked()
+	q.mu.Unlock()
+	return id, nil
+}
+
+// Track records a job that runs outside the pool, for work with its own
+// lifecycle such as a streamed import. cancel is called when an admin
+// cancels the job and returns ErrNotCancelable when the work cannot stop at
+// that point. The caller must call Finish when the work ends.
+func (q *Queue) Track(typ, target, label string, cancel func() error) *Tracker {
+	id, err := q.insert(typ, target, label, StatusRunning)
+	if err != nil {
+		// The work runs untracked rather than not at all
+		log.Printf("[Jobs] failed to record %s job: %v", typ, err)
+		return &Tracker{}
+	}
+	q.mu.Lock()
+	q.cancels[id] = cancel
+	q.mu.Unlock()
+	return &Tracker{Progress: Progress{q: q, id: id, last: -1}}
+}
+
+// dispatchLocked starts pending jobs while workers are free.
+func (q *Queue) dispatchLocked() {
+	for q.active < q.concurrency && len(q.pending) > 0 {
+		t := q.pending[0]
+		q.pending = q.pending[1:]
+		q.active++
+		cancel := t.cancel
+		q.cancels[t.id] = func() error { cancel(); return nil }
+		go q.run(t)
+	}
+}
+
+// run executes a pooled job and records its outcome.
+func (q *Queue) run(t *task) {
+	now := time.Now().UTC()
+	q.db.Exec(`UPDATE jobs SET status = ?, started_at = ? WHERE id = ?`, StatusRunning, now, t.id)
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				errlog.Logf("[Jobs] panic in job %s (%s): %v", t.id, t.label, r)
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return t.fn(t.ctx, &Progress{q: q, id: t.id, last: -1})
+	}()
+	q.finish(t.id, err)
+	t.cancel()
+
+	q.mu.Lock()
+	q.active--
+	q.dispatchLocked()
+	q.mu.Unlock()
+}
+
+// finish records the final state of a started job.
+func (q *Queue) finish(id string, err error) {
+	q.mu.Lock()
+	canceled := q.canceled[id]
+	delete(q.canceled, id)
+	delete(q.cancels, id)
+	q.mu.Unlock()
+
+	now := time.Now().UTC()
+	switch {
+	case canceled || errors.Is(err, context.Canceled):
+		q.db.Exec(`UPDATE jobs SET status = ?, finished_at = ? WHERE id = ?`, StatusCanceled, now, id)
+	case err != nil:
+		q.db.Exec(`UPDATE jobs SET status = ?, error = ?, finished_at = ? WHERE id = ?`, StatusFailed, err.Error(), now, id)
+	default:
+		q.db.Exec(`UPDATE jobs SET status = ?, progress = 100, finished_at = ? WHERE id = ?`, StatusSucceeded, now, id)
+	}
+}
+
+// Cancel stops a job. A queued job is dropped; a started job is asked to stop
+// and is marked canceled once its work returns.
+func (q *Queue) Cancel(id string) error {
+	q.mu.Lock()
+	for i, t := range q.pending {
+		if t.id == id {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			q.mu.Unlock()
+			t.cancel()
+			_, err := q.db.Exec(`UPDATE jobs SET status = ?, finished_at = ? WHERE id = ?`, StatusCanceled, time.Now().UTC(), id)
+			return err
+		}
+	}
+	cancel, ok := q.cancels[id]
+	q.mu.Unlock()
+	if ok {
+		if err := cancel(); err != nil {
+			return err
+		}
+		q.mu.Lock()
+		if _, running := q.cancels[id]; running {
+			q.canceled[id] = true
+		}
+		q.mu.Unlock()
+		return nil
+	}
+
+	if _, err := q.Get(id); err != nil {
+		return err
+	}
+	return ErrFinished
+}
+
+// Get returns a job by ID.
+func (q *Queue) Get(id string) (*Job, error) {
+	rows, err := q.db.Query(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job: %w", err)
+	}
+	defer rows.Close()
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &jobs[0], nil
+}
+
+// List returns the jobs matching f, newest first, with their total count.
+func (q *Queue) List(f ListFilter) ([]Job, int, error) {
+	where := ` WHERE 1=1`
+	var args []interface{}
+	if f.Status != "" {
+		where += ` AND status = ?`
+		args = append(args, f.Status)
+	}
+	if f.Type != "" {
+		where += ` AND type = ?`
+		args = append(args, f.Type)
+	}
+	var total int
+	if err := q.db.QueryRow(`SELECT COUNT(*) FROM jobs`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count jobs: %w", err)
+	}
+	if f.Limit <= 0 || f.Limit > 200 {
+		f.Limit = 50
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	rows, err := q.db.Query(`SELECT `+jobColumns+` FROM jobs`+where+` ORDER BY created_at DESC, id LIMIT ? OFFSET ?`,
+		append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return jobs, total, nil
+}
+
+// Counts returns the number of queued and running jobs.
+func (q *Queue) Counts() (queued, running int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending), len(q.cancels)
+}
+
+const jobColumns = `id, type, target, label, status, progress, message, error, created_at, started_at, finished_at`
+
+func scanJobs(rows *sql.Rows) ([]Job, error) {
+	jobs := []Job{}
+	for rows.Next() {
+		var j Job
+		var started, finished sql.NullTime
+		if err := rows.Scan(&j.ID, &j.Type, &j.Target, &j.Label, &j.Status, &j.Progress, &j.Message, &j.Error,
+			&j.CreatedAt, &started, &finished); err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		if started.Valid {
+			j.StartedAt = &started.Time
+		}
+		if finished.Valid {
+			j.FinishedAt = &finished.Time
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// insert records a new job.
+func (q *Queue) insert(typ, target, label, status string) (string, error) {
+	id, err := idgen.New()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	var started interface{}
+	if status == StatusRunning {
+		started = now
+	}
+	if _, err := q.db.Exec(
+		`INSERT INTO jobs (id, type, target, label, status, created_at, started_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id, typ, target, label, status, now, started,
+	); err != nil {
+		return "", fmt.Errorf("failed to record job: %w", err)
+	}
+	return id, nil
+}
+
+// Progress reports the progress of a running job. A nil Progress, as passed
+// to work run without a queue, ignores reports.
+type Progress struct {
+	q       *Queue
+	id      string
+	mu      sync.Mutex
+	last    int
+	message string
+}
+
+// Set reports that done of total steps are complete, with an optional
+// description of the current step. Only changes are written.
+func (p *Progress) Set(done, total int, message string) {
+	if p == nil || p.q == nil {
+		return
+	}
+	percent := 0
+	if total > 0 {
+		percent = done * 100 / total
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if percent == p.last && message == p.message {
+		return
+	}
+	p.last, p.message = percent, message
+	p.q.db.Exec(`UPDATE jobs SET progress = ?, message = ? WHERE id = ?`, percent, message, p.id)
+}
+
+// ID returns the job ID, or "" when the job could not be recorded or the
+// work runs without a queue.
+func (p *Progress) ID() string {
+	if p == nil {
+		return ""
+	}
+	return p.id
+}
+
+// Tracker is the handle of a tracked job.
+type Tracker struct {
+	Progress
+}
+
+// Finish records the outcome of a tracked job. A context.Canceled error
+// marks the job canceled.
+func (t *Tracker) Finish(err error) {
+	if t.q == nil {
+		return
+	}
+	t.q.finish(t.id, err)
+}
@@ -0,0 +1,122 @@
+// Package langdetect provides a lightweight, dependency-free guess of the
+// language of a piece of text. It is script based for CJK languages and uses
+// common function words to tell apart the major Latin-script languages.
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Language codes returned by Detect.
+const (
+	Chinese    = "zh"
+	English    = "en"
+	Japanese   = "ja"
+	Korean     = "ko"
+	French     = "fr"
+	German     = "de"
+	Spanish    = "es"
+	Portuguese = "pt"
+	Russian    = "ru"
+)
+
+// Names maps each supported language code to its display name.
+var Names = map[string]string{
+	Chinese:    "简体中文",
+	English:    "English",
+	Japanese:   "日本語",
+	Korean:     "한국어",
+	French:     "Français",
+	German:     "Deutsch",
+	Spanish:    "Español",
+	Portuguese: "Português",
+	Russian:    "Русский",
+}
+
+// IsSupported reports whether code is a language code known to this package.
+func IsSupported(code string) bool {
+	_, ok := Names[code]
+	return ok
+}
+
+// stopwords are frequent function words used to tell Latin-script languages apart.
+var stopwords = map[string][]string{
+	English:    {"the", "and", "is", "are", "of", "to", "in", "with", "for", "how", "what", "this", "that", "can", "not"},
+	French:     {"le", "la", "les", "des", "est", "et", "une", "un", "pour", "dans", "avec", "que", "qui", "pas", "comment"},
+	German:     {"der", "die", "das", "und", "ist", "nicht", "mit", "ein", "eine", "für", "wie", "auf", "ich", "zu", "den"},
+	Spanish:    {"el", "la", "los", "las", "es", "y", "una", "por", "para", "con", "que", "del", "cómo", "qué", "se"},
+	Portuguese: {"o", "os", "as", "é", "e", "uma", "um", "para", "com", "que", "do", "da", "não", "como", "em"},
+}
+
+// Detect returns the most likely language code of text, or "" when the text
+// contains no letters. Latin-script text that matches no stopword list is
+// reported as English.
+func Detect(text string) string {
+	var han, kana, hangul, cyrillic, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	// Japanese text mixes kanji with kana; a small share of kana is decisive.
+	if kana > 0 && kana*5 >= han {
+		return Japanese
+	}
+	// A single CJK character weighs roughly as much as a short Latin word.
+	cjk := (han + kana + hangul) * 3
+	switch {
+	case cjk == 0 && cyrillic == 0 && latin == 0:
+		return ""
+	case cjk >= latin && cjk >= cyrillic:
+		if hangul > han {
+			return Korean
+		}
+		if han == 0 {
+			return Japanese
+		}
+		return Chinese
+	case cyrillic >= latin:
+		return Russian
+	}
+	return detectLatin(text)
+}
+
+// detectLatin picks the Latin-script language whose stopwords occur most often.
+func detectLatin(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	counts := make(map[string]int, len(stopwords))
+	for _, w := range words {
+		for lang, list := range stopwords {
+			for _, sw := range list {
+				if w == sw {
+					counts[lang]++
+					break
+				}
+			}
+		}
+	}
+	// Inverted punctuation and ñ are unique to Spanish.
+	if strings.ContainsAny(text, "¿¡ñ") {
+		counts[Spanish] += 2
+	}
+	best, bestCount := English, counts[English]
+	for _, lang := range []string{French, German, Spanish, Portuguese} {
+		if counts[lang] > bestCount {
+			best, bestCount = lang, counts[lang]
+		}
+	}
+	return best
+}
@@ -0,0 +1,144 @@
+package livesource
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"askflow/internal/feed"
+)
+
+// listedPage is a page URL listed by a source, with its last-modified date
+// when the source gives one.
+type listedPage struct {
+	URL     string
+	LastMod string
+}
+
+type sitemapURLSet struct {
+	URLs []sitemapLoc `xml:"url"`
+}
+
+type sitemapIndex struct {
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// gunzipIfNeeded decompresses gzipped sitemaps (sitemap.xml.gz).
+func gunzipIfNeeded(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解压站点地图失败: %w", err)
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, maxListingBytes))
+	if err != nil {
+		return nil, fmt.Errorf("解压站点地图失败: %w", err)
+	}
+	return out, nil
+}
+
+// rootElement returns the local name of the first XML element.
+func rootElement(data []byte) string {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			return se.Name.Local
+		}
+	}
+}
+
+// detectKind tells a sitemap from an RSS/Atom feed and returns the feed
+// title, if any.
+func detectKind(data []byte) (kind, title string, err error) {
+	data, err = gunzipIfNeeded(data)
+	if err != nil {
+		return "", "", err
+	}
+	switch rootElement(data) {
+	case "urlset", "sitemapindex":
+		return KindSitemap, "", nil
+	}
+	title, _, err = feed.Parse(data)
+	if err != nil {
+		return "", "", fmt.Errorf("不是有效的站点地图或 RSS/Atom 订阅源")
+	}
+	return KindFeed, title, nil
+}
+
+// parseSitemap returns the pages of a <urlset>, or for a <sitemapindex> the
+// URLs of the child sitemaps in nested.
+func parseSitemap(data []byte) (pages []listedPage, nested []string, err error) {
+	data, err = gunzipIfNeeded(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	dec := func(v interface{}) error {
+		d := xml.NewDecoder(bytes.NewReader(data))
+		d.Strict = false
+		return d.Decode(v)
+	}
+	switch root := rootElement(data); root {
+	case "urlset":
+		var set sitemapURLSet
+		if err := dec(&set); err != nil {
+			return nil, nil, fmt.Errorf("解析站点地图失败: %w", err)
+		}
+		for _, u := range set.URLs {
+			if loc := strings.TrimSpace(u.Loc); loc != "" {
+				pages = append(pages, listedPage{URL: loc, LastMod: strings.TrimSpace(u.LastMod)})
+			}
+		}
+		return pages, nil, nil
+	case "sitemapindex":
+		var idx sitemapIndex
+		if err := dec(&idx); err != nil {
+			return nil, nil, fmt.Errorf("解析站点地图索引失败: %w", err)
+		}
+		for _, s := range idx.Sitemaps {
+			if loc := strings.TrimSpace(s.Loc); loc != "" {
+				nested = append(nested, loc)
+			}
+		}
+		return nil, nested, nil
+	default:
+		return nil, nil, fmt.Errorf("不是有效的站点地图（根元素 <%s>）", root)
+	}
+}
+
+// parseFeedPages returns the linked pages of a feed's entries. Entries
+// without a link are left out.
+func parseFeedPages(data []byte) ([]listedPage, error) {
+	_, entries, err := feed.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	var pages []listedPage
+	for _, e := range entries {
+		if e.Link == "" {
+			continue
+		}
+		p := listedPage{URL: e.Link}
+		if !e.Published.IsZero() {
+			p.LastMod = e.Published.UTC().Format(time.RFC3339)
+		}
+		pages = append(pages, p)
+	}
+	return pages, nil
+}
@@ -0,0 +1,636 @@
+// Package livesource implements live sources: a sitemap or RSS/Atom feed
+// registered for a product whose pages are kept in sync with the knowledge
+// base. A background scheduler re-fetches each source periodically, imports
+// new pages, re-imports pages whose content changed and deletes the
+// documents of pages that are no longer listed.
+//
+// Unlike package feed, which only ever adds entries, a live source mirrors
+// its listing.
+package livesource
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"askflow/internal/document"
+	"askflow/internal/errlog"
+	"askflow/internal/idgen"
+)
+
+// Source kinds.
+const (
+	KindSitemap = "sitemap" // sitemap.xml <urlset> or <sitemapindex>, optionally gzipped
+	KindFeed    = "feed"    // RSS or Atom; entry links are the pages
+)
+
+const (
+	// DefaultIntervalMin is the refresh interval used when none is given.
+	DefaultIntervalMin = 24 * 60
+	// MinIntervalMin and MaxIntervalMin bound the per-source refresh interval.
+	MinIntervalMin = 15
+	MaxIntervalMin = 7 * 24 * 60
+
+	// maxListingBytes limits the size of a downloaded sitemap or feed.
+	maxListingBytes = 10 << 20
+	// maxPageBytes limits the size of a downloaded page.
+	maxPageBytes = 10 << 20
+	// maxNestedSitemaps caps the child sitemaps read from a sitemap index.
+	maxNestedSitemaps = 50
+	// maxPagesPerSource caps the pages a source keeps in sync; further
+	// listed URLs are ignored.
+	maxPagesPerSource = 1000
+	// maxFetchesPerRefresh caps the pages fetched in one refresh so a large
+	// sitemap is synced over several runs; new pages are fetched first.
+	maxFetchesPerRefresh = 100
+	// fetchDelay is the pause between page fetches.
+	fetchDelay = 200 * time.Millisecond
+	// schedulerTick is how often the scheduler looks for sources that are due.
+	schedulerTick = time.Minute
+
+	// DocumentType is the document type recorded for imported pages.
+	DocumentType = "url"
+)
+
+// Source is a registered sitemap or feed.
+type Source struct {
+	ID            string     `json:"id"`
+	ProductID     string     `json:"product_id"`
+	URL           string     `json:"url"`
+	Kind          string     `json:"kind"`
+	Title         string     `json:"title"`
+	IntervalMin   int        `json:"interval_min"`
+	Enabled       bool       `json:"enabled"`
+	LastFetchedAt *time.Time `json:"last_fetched_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	PageCount     int        `json:"page_count"` // pages with an imported document
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Page is a page of a source and the document it is imported as.
+type Page struct {
+	URL        string     `json:"url"`
+	DocumentID string     `json:"document_id,omitempty"`
+	LastMod    string     `json:"lastmod,omitempty"` // as listed by the source
+	Error      string     `json:"error,omitempty"`   // last import error
+	CheckedAt  *time.Time `json:"checked_at,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"` // when the document was last (re)imported
+}
+
+// RefreshResult summarises one refresh of a source.
+type RefreshResult struct {
+	Listed    int `json:"listed"`    // pages listed by the source
+	Added     int `json:"added"`     // new pages imported
+	Updated   int `json:"updated"`   // changed pages re-imported
+	Unchanged int `json:"unchanged"` // pages whose content or lastmod did not change
+	Removed   int `json:"removed"`   // pages no longer listed, documents deleted
+	Failed    int `json:"failed"`
+	Deferred  int `json:"deferred"` // pages left for the next refresh
+}
+
+// Importer is the subset of DocumentManager used to fetch, import and delete pages.
+type Importer interface {
+	FetchExternalURL(url string, maxBytes int64) ([]byte, string, error)
+	WebContentHash(body []byte, contentType, baseURL string) (hash, existingID string, err error)
+	ImportWebContent(req document.ImportWebContentRequest) (*document.DocumentInfo, error)
+	DeleteDocument(docID string) error
+}
+
+// Service manages live sources and the refresh scheduler.
+type Service struct {
+	readDB   *sql.DB
+	writeDB  *sql.DB
+	importer Importer
+
+	refreshMu sync.Mutex // serialises refreshes so a page is never imported twice concurrently
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewService creates a new live source Service.
+func NewService(readDB, writeDB *sql.DB, importer Importer) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB, importer: importer}
+}
+
+func validInterval(intervalMin int) error {
+	if intervalMin < MinIntervalMin || intervalMin > MaxIntervalMin {
+		return fmt.Errorf("刷新间隔必须在 %d 到 %d 分钟之间", MinIntervalMin, MaxIntervalMin)
+	}
+	return nil
+}
+
+// Create registers a sitemap or feed for a product. It is fetched once to
+// tell which it is; pages are imported by the next scheduler run or a
+// refresh.
+func (s *Service) Create(productID, url string, intervalMin int) (*Source, error) {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return nil, fmt.Errorf("来源 URL 不能为空")
+	}
+	if intervalMin == 0 {
+		intervalMin = DefaultIntervalMin
+	}
+	if err := validInterval(intervalMin); err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := s.writeDB.QueryRow("SELECT COUNT(*) FROM live_sources WHERE product_id = ? AND url = ?", productID, url).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to check source uniqueness: %w", err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("该产品已添加此来源")
+	}
+
+	data, _, err := s.importer.FetchExternalURL(url, maxListingBytes)
+	if err != nil {
+		return nil, fmt.Errorf("获取来源失败: %w", err)
+	}
+	kind, title, err := detectKind(data)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := idgen.New()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	_, err = s.writeDB.Exec(
+		"INSERT INTO live_sources (id, product_id, url, kind, title, interval_min, enabled, created_at) VALUES (?, ?, ?, ?, ?, ?, 1, ?)",
+		id, productID, url, kind, title, intervalMin, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create source: %w", err)
+	}
+	return &Source{ID: id, ProductID: productID, URL: url, Kind: kind, Title: title, IntervalMin: intervalMin, Enabled: true, CreatedAt: now}, nil
+}
+
+// Update changes the refresh interval and enabled flag of a source.
+func (s *Service) Update(id string, intervalMin int, enabled bool) (*Source, error) {
+	if err := validInterval(intervalMin); err != nil {
+		return nil, err
+	}
+	result, err := s.writeDB.Exec("UPDATE live_sources SET interval_min = ?, enabled = ? WHERE id = ?", intervalMin, enabled, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update source: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("来源不存在")
+	}
+	return s.Get(id)
+}
+
+// Delete removes a source and its page list. Documents already imported are kept.
+func (s *Service) Delete(id string) error {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	tx, err := s.writeDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM live_source_pages WHERE source_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete source pages: %w", err)
+	}
+	result, err := tx.Exec("DELETE FROM live_sources WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete source: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("来源不存在")
+	}
+	return tx.Commit()
+}
+
+const sourceColumns = `s.id, s.product_id, s.url, s.kind, COALESCE(s.title, ''), s.interval_min, s.enabled,
+	s.last_fetched_at, COALESCE(s.last_error, ''), s.created_at,
+	(SELECT COUNT(*) FROM live_source_pages p WHERE p.source_id = s.id AND p.document_id != '')`
+
+func scanSource(scan func(dest ...interface{}) error) (*Source, error) {
+	var src Source
+	var enabled int
+	var lastFetched sql.NullTime
+	if err := scan(&src.ID, &src.ProductID, &src.URL, &src.Kind, &src.Title, &src.IntervalMin, &enabled,
+		&lastFetched, &src.LastError, &src.CreatedAt, &src.PageCount); err != nil {
+		return nil, err
+	}
+	src.Enabled = enabled == 1
+	if lastFetched.Valid {
+		t := lastFetched.Time
+		src.LastFetchedAt = &t
+	}
+	return &src, nil
+}
+
+// Get returns a single source.
+func (s *Service) Get(id string) (*Source, error) {
+	src, err := scanSource(s.readDB.QueryRow("SELECT "+sourceColumns+" FROM live_sources s WHERE s.id = ?", id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("来源不存在")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source: %w", err)
+	}
+	return src, nil
+}
+
+// List returns sources, optionally filtered by product, newest first.
+func (s *Service) List(productID string) ([]Source, error) {
+	query := "SELECT " + sourceColumns + " FROM live_sources s"
+	var args []interface{}
+	if productID != "" {
+		query += " WHERE s.product_id = ?"
+		args = append(args, productID)
+	}
+	query += " ORDER BY s.created_at DESC"
+	rows, err := s.readDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sources: %w", err)
+	}
+	defer rows.Close()
+	sources := []Source{}
+	for rows.Next() {
+		src, err := scanSource(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan source: %w", err)
+		}
+		sources = append(sources, *src)
+	}
+	return sources, rows.Err()
+}
+
+// pageRow is a stored page with the fields a refresh compares against.
+type pageRow struct {
+	Page
+	ContentHash string
+}
+
+// loadPages returns the stored pages of a source by URL.
+func (s *Service) loadPages(sourceID string) (map[string]*pageRow, error) {
+	rows, err := s.writeDB.Query(
+		"SELECT url, document_id, content_hash, lastmod, error, checked_at, updated_at FROM live_source_pages WHERE source_id = ?", sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load source pages: %w", err)
+	}
+	defer rows.Close()
+	pages := make(map[string]*pageRow)
+	for rows.Next() {
+		var p pageRow
+		var checked, updated sql.NullTime
+		if err := rows.Scan(&p.URL, &p.DocumentID, &p.ContentHash, &p.LastMod, &p.Error, &checked, &updated); err != nil {
+			return nil, fmt.Errorf("failed to scan source page: %w", err)
+		}
+		if checked.Valid {
+			t := checked.Time
+			p.CheckedAt = &t
+		}
+		if updated.Valid {
+			t := updated.Time
+			p.UpdatedAt = &t
+		}
+		pages[p.URL] = &p
+	}
+	return pages, rows.Err()
+}
+
+// Pages returns the pages of a source, sorted by URL.
+func (s *Service) Pages(id string) ([]Page, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+	stored, err := s.loadPages(id)
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]Page, 0, len(stored))
+	for _, p := range stored {
+		pages = append(pages, p.Page)
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].URL < pages[j].URL })
+	return pages, nil
+}
+
+// Refresh fetches a source immediately and syncs its pages.
+func (s *Service) Refresh(id string) (*RefreshResult, error) {
+	src, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.refresh(src)
+}
+
+func (s *Service) refresh(src *Source) (*RefreshResult, error) {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	result, err := s.sync(src)
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+		errlog.Logf("[LiveSource] refresh failed source=%s url=%q: %v", src.ID, src.URL, err)
+	}
+	if _, dbErr := s.writeDB.Exec("UPDATE live_sources SET last_fetched_at = ?, last_error = ? WHERE id = ?",
+		time.Now().UTC(), errMsg, src.ID); dbErr != nil {
+		log.Printf("[LiveSource] failed to update source status %s: %v", src.ID, dbErr)
+	}
+	return result, err
+}
+
+// list fetches a source and returns the pages it lists, without duplicates
+// and at most maxPagesPerSource.
+func (s *Service) list(src *Source) ([]listedPage, error) {
+	data, _, err := s.importer.FetchExternalURL(src.URL, maxListingBytes)
+	if err != nil {
+		return nil, fmt.Errorf("获取来源失败: %w", err)
+	}
+	var listed []listedPage
+	if src.Kind == KindFeed {
+		if listed, err = parseFeedPages(data); err != nil {
+			return nil, err
+		}
+	} else {
+		pages, nested, err := parseSitemap(data)
+		if err != nil {
+			return nil, err
+		}
+		listed = pages
+		if len(nested) > maxNestedSitemaps {
+			nested = nested[:maxNestedSitemaps]
+		}
+		for _, u := range nested {
+			child, _, err := s.importer.FetchExternalURL(u, maxListingBytes)
+			if err != nil {
+				return nil, fmt.Errorf("获取子站点地图 %s 失败: %w", u, err)
+			}
+			pages, _, err := parseSitemap(child)
+			if err != nil {
+				return nil, fmt.Errorf("子站点地图 %s: %w", u, err)
+			}
+			listed = append(listed, pages...)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var out []listedPage
+	for _, p := range listed {
+		lower := strings.ToLower(p.URL)
+		if seen[p.URL] || (!strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://")) {
+			continue
+		}
+		seen[p.URL] = true
+		out = append(out, p)
+		if len(out) == maxPagesPerSource {
+			break
+		}
+	}
+	return out, nil
+}
+
+// sync imports new and changed pages of a source and deletes the documents
+// of pages that are no longer listed. An empty listing is treated as an
+// error rather than deleting every page.
+func (s *Service) sync(src *Source) (*RefreshResult, error) {
+	listed, err := s.list(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(listed) == 0 {
+		return nil, fmt.Errorf("来源中没有页面")
+	}
+	stored, err := s.loadPages(src.ID)
+	if err != nil {
+		return nil, err
+	}
+	result := &RefreshResult{Listed: len(listed)}
+
+	// Pages whose listed lastmod is unchanged are not fetched again
+	var due []listedPage
+	for _, p := range listed {
+		old := stored[p.URL]
+		if old != nil && old.DocumentID != "" && p.LastMod != "" && p.LastMod == old.LastMod {
+			result.Unchanged++
+			continue
+		}
+		due = append(due, p)
+	}
+	// New pages first, then those checked longest ago
+	sort.SliceStable(due, func(i, j int) bool {
+		a, b := stored[due[i].URL], stored[due[j].URL]
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		if a.CheckedAt == nil || b.CheckedAt == nil {
+			return a.CheckedAt == nil && b.CheckedAt != nil
+		}
+		return a.CheckedAt.Before(*b.CheckedAt)
+	})
+	if len(due) > maxFetchesPerRefresh {
+		result.Deferred = len(due) - maxFetchesPerRefresh
+		due = due[:maxFetchesPerRefresh]
+	}
+
+	for i, p := range due {
+		if i > 0 {
+			select {
+			case <-s.stopCh:
+				result.Deferred += len(due) - i
+				return result, nil
+			case <-time.After(fetchDelay):
+			}
+		}
+		outcome, err := s.syncPage(src, p, stored[p.URL])
+		switch {
+		case err != nil:
+			result.Failed++
+			errlog.Logf("[LiveSource] page failed source=%s url=%q: %v", src.ID, p.URL, err)
+		case outcome == outcomeAdded:
+			result.Added++
+		case outcome == outcomeUpdated:
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+	}
+
+	listedSet := make(map[string]bool, len(listed))
+	for _, p := range listed {
+		listedSet[p.URL] = true
+	}
+	for url, old := range stored {
+		if listedSet[url] {
+			continue
+		}
+		if old.DocumentID != "" {
+			if err := s.importer.DeleteDocument(old.DocumentID); err != nil {
+				errlog.Logf("[LiveSource] failed to delete document doc=%s url=%q: %v", old.DocumentID, url, err)
+				continue
+			}
+		}
+		if _, err := s.writeDB.Exec("DELETE FROM live_source_pages WHERE source_id = ? AND url = ?", src.ID, url); err != nil {
+			return result, fmt.Errorf("failed to delete source page: %w", err)
+		}
+		result.Removed++
+	}
+
+	if result.Added+result.Updated+result.Removed+result.Failed > 0 {
+		log.Printf("[LiveSource] %s: 新增 %d，更新 %d，删除 %d，失败 %d", src.URL, result.Added, result.Updated, result.Removed, result.Failed)
+	}
+	return result, nil
+}
+
+const (
+	outcomeUnchanged = iota
+	outcomeAdded
+	outcomeUpdated
+)
+
+// syncPage fetches a listed page and imports it when it is new or its
+// content changed. A changed page is imported as a new document before the
+// old one is deleted, so the page stays searchable if the import fails.
+func (s *Service) syncPage(src *Source, p listedPage, old *pageRow) (int, error) {
+	now := time.Now().UTC()
+	docID, oldHash, updatedAt := "", "", interface{}(nil)
+	if old != nil {
+		docID, oldHash = old.DocumentID, old.ContentHash
+		if old.UpdatedAt != nil {
+			updatedAt = *old.UpdatedAt
+		}
+	}
+	save := func(docID, hash string, updatedAt interface{}, pageErr error) error {
+		id, err := idgen.New()
+		if err != nil {
+			return err
+		}
+		_, err = s.writeDB.Exec(
+			`INSERT INTO live_source_pages (id, source_id, url, document_id, content_hash, lastmod, error, checked_at, updated_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT(source_id, url) DO UPDATE SET document_id = excluded.document_id, content_hash = excluded.content_hash,
+			 lastmod = excluded.lastmod, error = excluded.error, checked_at = excluded.checked_at, updated_at = excluded.updated_at`,
+			id, src.ID, p.URL, docID, hash, p.LastMod, errString(pageErr), now, updatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record source page: %w", err)
+		}
+		return pageErr
+	}
+
+	data, contentType, err := s.importer.FetchExternalURL(p.URL, maxPageBytes)
+	if err != nil {
+		return 0, save(docID, oldHash, updatedAt, err)
+	}
+	hash, existingID, err := s.importer.WebContentHash(data, contentType, p.URL)
+	if err != nil {
+		return 0, save(docID, oldHash, updatedAt, err)
+	}
+	if hash == "" {
+		return 0, save(docID, oldHash, updatedAt, fmt.Errorf("页面内容为空"))
+	}
+	if docID != "" && existingID == docID {
+		return outcomeUnchanged, save(docID, hash, updatedAt, nil)
+	}
+	if existingID != "" {
+		return 0, save(docID, oldHash, updatedAt, fmt.Errorf("内容与已有文档 %s 重复", existingID))
+	}
+
+	doc, err := s.importer.ImportWebContent(document.ImportWebContentRequest{
+		Name:        p.URL,
+		Type:        DocumentType,
+		BaseURL:     p.URL,
+		Content:     data,
+		ContentType: contentType,
+		ProductID:   src.ProductID,
+	})
+	if err == nil && doc.Status == "failed" {
+		// Failed records would pile up with every refresh
+		err = fmt.Errorf("%s", doc.Error)
+		if delErr := s.importer.DeleteDocument(doc.ID); delErr != nil {
+			log.Printf("[LiveSource] failed to delete failed document %s: %v", doc.ID, delErr)
+		}
+	}
+	if err != nil {
+		return 0, save(docID, oldHash, updatedAt, err)
+	}
+
+	outcome := outcomeAdded
+	if docID != "" {
+		outcome = outcomeUpdated
+		if err := s.importer.DeleteDocument(docID); err != nil {
+			errlog.Logf("[LiveSource] failed to delete old document doc=%s url=%q: %v", docID, p.URL, err)
+		}
+	}
+	return outcome, save(doc.ID, hash, now, nil)
+}
+
+// Start launches the background scheduler that refreshes enabled sources when they are due.
+func (s *Service) Start() {
+	s.stopCh = make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[LiveSource] panic in scheduler goroutine: %v", r)
+			}
+		}()
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				s.refreshDue()
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler and waits for an in-progress refresh to finish.
+func (s *Service) Stop() {
+	if s.stopCh == nil {
+		return
+	}
+	select {
+	case <-s.stopCh:
+	default:
+		close(s.stopCh)
+	}
+	s.wg.Wait()
+}
+
+// refreshDue refreshes every enabled source whose interval has elapsed since its last fetch.
+func (s *Service) refreshDue() {
+	sources, err := s.List("")
+	if err != nil {
+		log.Printf("[LiveSource] failed to list sources: %v", err)
+		return
+	}
+	now := time.Now()
+	for i := range sources {
+		src := &sources[i]
+		if !src.Enabled {
+			continue
+		}
+		if src.LastFetchedAt != nil && now.Sub(*src.LastFetchedAt) < time.Duration(src.IntervalMin)*time.Minute {
+			continue
+		}
+		select {
+		case <-s.stopCh:
+			return
+		default:
+		}
+		s.refresh(src)
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
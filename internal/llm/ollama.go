@@ -0,0 +1,284 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"askflow/internal/errlog"
+)
+
+// OllamaLLMService implements LLMService with the native API of Ollama, for
+// models served locally without API keys. Calls go to /api/chat; servers
+// too old to have it are sent to /api/generate instead. Replies are read in
+// the streaming format, one JSON object per line, which also covers servers
+// that answer in a single object.
+type OllamaLLMService struct {
+	Endpoint    string
+	APIKey      string // sent as a bearer token when set, e.g. to a proxy in front of Ollama
+	ModelName   string
+	Temperature float64
+	MaxTokens   int
+	client      *http.Client
+	// generateOnly is set once /api/chat was not found.
+	generateOnly atomic.Bool
+}
+
+// NewOllamaLLMService creates an OllamaLLMService. endpoint is the server
+// address, e.g. http://localhost:11434.
+func NewOllamaLLMService(endpoint, apiKey, modelName string, temperature float64, maxTokens int) *OllamaLLMService {
+	return &OllamaLLMService{
+		Endpoint:    endpoint,
+		APIKey:      apiKey,
+		ModelName:   modelName,
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
+		client: &http.Client{
+			// Local models load on the first call and answer more slowly
+			// than hosted ones.
+			Timeout: 300 * time.Second,
+		},
+	}
+}
+
+// SetTimeout sets how long one call may take, 300 seconds by default.
+func (s *OllamaLLMService) SetTimeout(d time.Duration) {
+	s.client.Timeout = d
+}
+
+// ollamaMessage is a message of the /api/chat request. Images are base64
+// without the data URL prefix.
+type ollamaMessage struct {
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  []string `json:"images,omitempty"`
+}
+
+// ollamaOptions holds the model parameters of a request.
+type ollamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+}
+
+// ollamaChatRequest is the request body of /api/chat.
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  ollamaOptions   `json:"options"`
+}
+
+// ollamaGenerateRequest is the request body of /api/generate.
+type ollamaGenerateRequest struct {
+	Model   string        `json:"model"`
+	System  string        `json:"system,omitempty"`
+	Prompt  string        `json:"prompt"`
+	Images  []string      `json:"images,omitempty"`
+	Stream  bool          `json:"stream"`
+	Options ollamaOptions `json:"options"`
+}
+
+// ollamaChunk is one line of a streamed reply: Message for /api/chat,
+// Response for /api/generate.
+type ollamaChunk struct {
+	Message  *ollamaMessage `json:"message,omitempty"`
+	Response string         `json:"response"`
+	Done     bool           `json:"done"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// Generate implements LLMService.
+func (s *OllamaLLMService) Generate(prompt string, context []string, question string) (string, error) {
+	answer, err, _ := s.callAPIWithRetry(BuildMessages(prompt, context, question), maxAttempts)
+	if err != nil {
+		return "服务暂时不可用，请稍后重试", fmt.Errorf("LLM API failed after retries: %w", err)
+	}
+	return answer, nil
+}
+
+// GenerateWithImage implements LLMService for vision models such as llava
+// or qwen2.5vl.
+func (s *OllamaLLMService) GenerateWithImage(prompt string, context []string, question string, imageDataURL string) (string, error) {
+	if imageDataURL == "" {
+		return s.Generate(prompt, context, question)
+	}
+	answer, err, _ := s.callAPIWithRetry(BuildMessagesWithImage(prompt, context, question, imageDataURL), maxAttempts)
+	if err != nil {
+		return "", fmt.Errorf("LLM vision API failed: %w", err)
+	}
+	return answer, nil
+}
+
+// callAPIWithRetry calls the API up to maxRetries times, with backoff
+// between attempts, on transient errors. The third return value reports
+// whether the last error was transient.
+func (s *OllamaLLMService) callAPIWithRetry(messages []chatMessage, maxRetries int) (string, error, bool) {
+	msgs := toOllamaMessages(messages)
+	var lastErr error
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 5 * time.Second)
+		}
+		answer, err, retryable := s.callAPI(msgs)
+		if err == nil {
+			return answer, nil, false
+		}
+		lastErr = err
+		if !retryable {
+			return "", err, false
+		}
+	}
+	errlog.Logf("[LLM] Ollama API failed after %d retries: %v", maxRetries, lastErr)
+	return "", lastErr, true
+}
+
+// callAPI sends one request to /api/chat, or /api/generate once the server
+// turned out not to have /api/chat. The third return value reports whether
+// the error is retryable.
+func (s *OllamaLLMService) callAPI(msgs []ollamaMessage) (string, error, bool) {
+	opts := ollamaOptions{Temperature: s.Temperature, NumPredict: s.MaxTokens}
+	if !s.generateOnly.Load() {
+		answer, err, retryable, found := s.post("/api/chat", ollamaChatRequest{
+			Model: s.ModelName, Messages: msgs, Stream: true, Options: opts,
+		})
+		if found {
+			return answer, err, retryable
+		}
+		s.generateOnly.Store(true)
+	}
+	req := ollamaGenerateRequest{Model: s.ModelName, Stream: true, Options: opts}
+	var parts []string
+	for _, m := range msgs {
+		if m.Role == "system" {
+			req.System = m.Content
+			continue
+		}
+		parts = append(parts, m.Content)
+		req.Images = append(req.Images, m.Images...)
+	}
+	req.Prompt = strings.Join(parts, "\n\n")
+	answer, err, retryable, found := s.post("/api/generate", req)
+	if !found {
+		return "", fmt.Errorf("Ollama API not found at %s", s.Endpoint), false
+	}
+	return answer, err, retryable
+}
+
+// post sends body to path and reads the streamed reply. found is false when
+// the server has no such path, as opposed to a 404 for an unknown model,
+// which Ollama reports with a JSON error.
+func (s *OllamaLLMService) post(path string, body interface{}) (answer string, err error, retryable, found bool) {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err), false, true
+	}
+	base := strings.TrimSuffix(strings.TrimRight(s.Endpoint, "/"), "/api")
+	req, err := http.NewRequest(http.MethodPost, base+path, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err), false, true
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Ollama API request failed: %w", err), true, true
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		var chunk ollamaChunk
+		jsonErr := json.Unmarshal(respBody, &chunk) == nil && chunk.Error != ""
+		if resp.StatusCode == http.StatusNotFound && !jsonErr {
+			return "", nil, false, false
+		}
+		msg := string(respBody)
+		if jsonErr {
+			msg = chunk.Error
+		}
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return "", fmt.Errorf("Ollama API error (HTTP %d): %s", resp.StatusCode, msg), retryable, true
+	}
+
+	answer, err = readOllamaStream(io.LimitReader(resp.Body, 10<<20)) // 10MB max response
+	if err != nil {
+		// A stream cut off midway is a network failure
+		return "", err, true, true
+	}
+	return answer, nil, false, true
+}
+
+// readOllamaStream joins the text of a streamed reply, one JSON object per
+// line, up to the object marked done.
+func readOllamaStream(r io.Reader) (string, error) {
+	var b strings.Builder
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 10<<20)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk ollamaChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return "", fmt.Errorf("failed to decode response: %w", err)
+		}
+		if chunk.Error != "" {
+			return "", fmt.Errorf("Ollama API error: %s", chunk.Error)
+		}
+		if chunk.Message != nil {
+			b.WriteString(chunk.Message.Content)
+		} else {
+			b.WriteString(chunk.Response)
+		}
+		if chunk.Done {
+			return b.String(), nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+	return "", fmt.Errorf("Ollama API reply ended before done")
+}
+
+// toOllamaMessages converts chat messages, whose content may be OpenAI
+// vision parts, to Ollama messages with the images as plain base64.
+func toOllamaMessages(messages []chatMessage) []ollamaMessage {
+	out := make([]ollamaMessage, 0, len(messages))
+	for _, m := range messages {
+		om := ollamaMessage{Role: m.Role}
+		switch c := m.Content.(type) {
+		case string:
+			om.Content = c
+		case []visionContentPart:
+			var texts []string
+			for _, p := range c {
+				if p.ImageURL != nil {
+					om.Images = append(om.Images, imageBase64(p.ImageURL.URL))
+				} else if p.Text != "" {
+					texts = append(texts, p.Text)
+				}
+			}
+			om.Content = strings.Join(texts, "\n")
+		}
+		out = append(out, om)
+	}
+	return out
+}
+
+// imageBase64 returns the base64 payload of a data URL.
+func imageBase64(dataURL string) string {
+	if i := strings.Index(dataURL, ";base64,"); i >= 0 && strings.HasPrefix(dataURL, "data:") {
+		return dataURL[i+len(";base64,"):]
+	}
+	return dataURL
+}
@@ -0,0 +1,224 @@
+package llm
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Priorities for Pool.Acquire. Higher priorities are served first.
+const (
+	PriorityNormal = 0
+	PriorityHigh   = 1 // admins testing or answering from the console
+)
+
+var (
+	// ErrBusy is returned when the generation queue is full.
+	ErrBusy = errors.New("当前咨询人数较多，请稍后再试")
+	// ErrUserQueueFull is returned when a user already has the maximum number of queued requests.
+	ErrUserQueueFull = errors.New("您的问题正在排队处理，请等待之前的问题完成后再提问")
+	// ErrQueueTimeout is returned when a request waited too long for a generation slot.
+	ErrQueueTimeout = errors.New("排队等待超时，请稍后再试")
+)
+
+// Pool bounds the number of concurrent generation requests. Requests beyond
+// the limit wait in a queue that serves higher priorities first and, within
+// a priority, takes users round-robin: a request's round is the number of
+// requests its user already had running or queued when it arrived, so one
+// busy user cannot starve the others. Ties go to the earliest arrival.
+type Pool struct {
+	mu         sync.Mutex
+	size       int
+	maxQueue   int
+	maxPerUser int
+	timeout    time.Duration
+	seq        uint64
+	active     int
+	running    map[string]int // running requests per user
+	waiters    []*waiter
+	tickets    map[string]*waiter
+}
+
+type waiter struct {
+	user     string
+	ticket   string
+	priority int
+	round    int
+	seq      uint64
+	ready    chan struct{}
+	granted  bool
+}
+
+// PoolStats is a snapshot of a Pool's load.
+type PoolStats struct {
+	Size    int `json:"size"`
+	Active  int `json:"active"`
+	Queued  int `json:"queued"`
+	MaxWait int `json:"max_wait_sec"`
+}
+
+// NewPool creates a Pool running at most size requests at a time, with at
+// most maxQueue waiting (maxPerUser per user) for up to timeout each.
+func NewPool(size, maxQueue, maxPerUser int, timeout time.Duration) *Pool {
+	p := &Pool{running: make(map[string]int), tickets: make(map[string]*waiter)}
+	p.Resize(size, maxQueue, maxPerUser, timeout)
+	return p
+}
+
+// Resize changes the pool limits. Requests already running or queued are
+// kept; a larger size starts queued requests immediately.
+func (p *Pool) Resize(size, maxQueue, maxPerUser int, timeout time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if size < 1 {
+		size = 1
+	}
+	p.size = size
+	p.maxQueue = maxQueue
+	p.maxPerUser = maxPerUser
+	p.timeout = timeout
+	p.dispatchLocked()
+}
+
+// Acquire waits for a generation slot for user and returns the function that
+// gives it back. ticket, if not empty, lets Position report the request's
+// place in the queue while it waits.
+func (p *Pool) Acquire(user, ticket string, priority int) (func(), error) {
+	p.mu.Lock()
+	p.seq++
+	w := &waiter{user: user, priority: priority, seq: p.seq, ready: make(chan struct{})}
+	if ticket != "" && p.tickets[ticket] == nil {
+		w.ticket = ticket
+		p.tickets[ticket] = w
+	}
+	if p.active < p.size && len(p.waiters) == 0 {
+		p.grantLocked(w)
+		p.mu.Unlock()
+		return p.releaser(w), nil
+	}
+	if len(p.waiters) >= p.maxQueue {
+		p.forgetLocked(w)
+		p.mu.Unlock()
+		return nil, ErrBusy
+	}
+	queued := 0
+	for _, o := range p.waiters {
+		if o.user == user {
+			queued++
+		}
+	}
+	if p.maxPerUser > 0 && queued >= p.maxPerUser {
+		p.forgetLocked(w)
+		p.mu.Unlock()
+		return nil, ErrUserQueueFull
+	}
+	w.round = p.running[user] + queued
+	p.waiters = append(p.waiters, w)
+	timeout := p.timeout
+	p.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+		return p.releaser(w), nil
+	case <-timer.C:
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if w.granted {
+		// Granted while the timer fired
+		return p.releaser(w), nil
+	}
+	for i, o := range p.waiters {
+		if o == w {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			break
+		}
+	}
+	p.forgetLocked(w)
+	return nil, ErrQueueTimeout
+}
+
+// Position reports the place of the request with the given ticket: 0 once
+// it is running, 1 for the next in line. ok is false for unknown tickets.
+func (p *Pool) Position(ticket string) (pos int, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w := p.tickets[ticket]
+	if w == nil {
+		return 0, false
+	}
+	if w.granted {
+		return 0, true
+	}
+	pos = 1
+	for _, o := range p.waiters {
+		if o != w && p.before(o, w) {
+			pos++
+		}
+	}
+	return pos, true
+}
+
+// Stats returns the current load of the pool.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolStats{Size: p.size, Active: p.active, Queued: len(p.waiters), MaxWait: int(p.timeout / time.Second)}
+}
+
+// before reports whether a is served before b.
+func (p *Pool) before(a, b *waiter) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	if a.round != b.round {
+		return a.round < b.round
+	}
+	return a.seq < b.seq
+}
+
+func (p *Pool) dispatchLocked() {
+	for p.active < p.size && len(p.waiters) > 0 {
+		best := 0
+		for i := 1; i < len(p.waiters); i++ {
+			if p.before(p.waiters[i], p.waiters[best]) {
+				best = i
+			}
+		}
+		w := p.waiters[best]
+		p.waiters = append(p.waiters[:best], p.waiters[best+1:]...)
+		p.grantLocked(w)
+		close(w.ready)
+	}
+}
+
+func (p *Pool) grantLocked(w *waiter) {
+	w.granted = true
+	p.active++
+	p.running[w.user]++
+}
+
+func (p *Pool) forgetLocked(w *waiter) {
+	if w.ticket != "" && p.tickets[w.ticket] == w {
+		delete(p.tickets, w.ticket)
+	}
+}
+
+func (p *Pool) releaser(w *waiter) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.active--
+			if p.running[w.user]--; p.running[w.user] <= 0 {
+				delete(p.running, w.user)
+			}
+			p.forgetLocked(w)
+			p.dispatchLocked()
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package llm
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"askflow/internal/config"
+)
+
+// failoverCooldown is how long a profile that was unavailable is tried only
+// after the others.
+const failoverCooldown = 30 * time.Second
+
+// TaskRouter is implemented by LLM services that send some tasks to other
+// models than the rest.
+type TaskRouter interface {
+	ForTask(task string) LLMService
+}
+
+// ForTask returns the service ls uses for task (see config.LLMTasks), or ls
+// itself when it does not route tasks.
+func ForTask(ls LLMService, task string) LLMService {
+	if r, ok := ls.(TaskRouter); ok {
+		return r.ForTask(task)
+	}
+	return ls
+}
+
+// Backend is an LLM service for one endpoint, speaking the protocol of its
+// provider, that a Router can fail over from.
+type Backend interface {
+	LLMService
+	SetTimeout(d time.Duration)
+	callAPIWithRetry(messages []chatMessage, maxRetries int) (string, error, bool)
+}
+
+// NewService creates the client of an LLM endpoint for its provider:
+// config.LLMProviderOllama for the native Ollama API, otherwise an
+// OpenAI-compatible Chat Completion API.
+func NewService(provider, endpoint, apiKey, modelName string, temperature float64, maxTokens int) Backend {
+	if provider == config.LLMProviderOllama {
+		return NewOllamaLLMService(endpoint, apiKey, modelName, temperature, maxTokens)
+	}
+	return NewAPILLMService(endpoint, apiKey, modelName, temperature, maxTokens)
+}
+
+// Profile is a named LLM endpoint of a Router.
+type Profile struct {
+	Name     string
+	Priority int
+	Service  Backend
+}
+
+// Router is an LLM service over the named profiles of the LLM config. A call
+// goes to the profiles in order and moves on to the next one when a profile
+// is unavailable: a timeout, network error, 429 or 5xx. Every profile but
+// the last gets a single attempt, so failing over is not held up by backoff,
+// and profiles that were unavailable in the last 30 seconds are tried last.
+type Router struct {
+	profiles []Profile
+	routes   map[string]string
+	health   *profileHealth
+}
+
+// NewRouter creates a Router for cfg: the main endpoint, named
+// config.DefaultLLMProfile, and the enabled profiles ordered by priority.
+func NewRouter(cfg config.LLMConfig) *Router {
+	profiles := []Profile{{
+		Name:    config.DefaultLLMProfile,
+		Service: NewService(cfg.Provider, cfg.Endpoint, cfg.APIKey, cfg.ModelName, cfg.Temperature, cfg.MaxTokens),
+	}}
+	for _, p := range cfg.Profiles {
+		if p.Disabled {
+			continue
+		}
+		profiles = append(profiles, Profile{Name: p.Name, Priority: p.Priority, Service: NewProfileService(p, cfg.MaxTokens)})
+	}
+	sort.SliceStable(profiles, func(i, j int) bool { return profiles[i].Priority < profiles[j].Priority })
+	return &Router{
+		profiles: profiles,
+		routes:   cfg.Routes,
+		health:   &profileHealth{down: make(map[string]time.Time)},
+	}
+}
+
+// NewProfileService creates the API client of a profile; maxTokens applies
+// when the profile sets none.
+func NewProfileService(p config.LLMProfile, maxTokens int) Backend {
+	if p.MaxTokens > 0 {
+		maxTokens = p.MaxTokens
+	}
+	s := NewService(p.Provider, p.Endpoint, p.APIKey, p.ModelName, p.Temperature, maxTokens)
+	if p.TimeoutSec > 0 {
+		s.SetTimeout(time.Duration(p.TimeoutSec) * time.Second)
+	}
+	return s
+}
+
+// ForTask returns the router for task: the profile the task is routed to
+// first, then the others by priority. Tasks without a route, or routed to a
+// disabled or missing profile, use r itself.
+func (r *Router) ForTask(task string) LLMService {
+	name := r.routes[task]
+	if name == "" || name == r.profiles[0].Name {
+		return r
+	}
+	for i, p := range r.profiles {
+		if p.Name != name {
+			continue
+		}
+		order := make([]Profile, 0, len(r.profiles))
+		order = append(order, p)
+		order = append(order, r.profiles[:i]...)
+		order = append(order, r.profiles[i+1:]...)
+		return &Router{profiles: order, health: r.health}
+	}
+	return r
+}
+
+// Generate implements LLMService.
+func (r *Router) Generate(prompt string, context []string, question string) (string, error) {
+	answer, err := r.call(BuildMessages(prompt, context, question))
+	if err != nil {
+		return "服务暂时不可用，请稍后重试", fmt.Errorf("LLM API failed after retries: %w", err)
+	}
+	return answer, nil
+}
+
+// GenerateWithImage implements LLMService.
+func (r *Router) GenerateWithImage(prompt string, context []string, question string, imageDataURL string) (string, error) {
+	if imageDataURL == "" {
+		return r.Generate(prompt, context, question)
+	}
+	answer, err := r.call(BuildMessagesWithImage(prompt, context, question, imageDataURL))
+	if err != nil {
+		return "", fmt.Errorf("LLM vision API failed: %w", err)
+	}
+	return answer, nil
+}
+
+// call sends messages to the profiles in order until one answers. Errors
+// other than unavailability, such as a rejected API key or a prompt too
+// long, are returned without failing over.
+func (r *Router) call(messages []chatMessage) (string, error) {
+	order := r.health.order(r.profiles)
+	var lastErr error
+	for i, p := range order {
+		attempts := 1
+		if i == len(order)-1 {
+			attempts = maxAttempts
+		}
+		answer, err, unavailable := p.Service.callAPIWithRetry(messages, attempts)
+		if err == nil {
+			r.health.up(p.Name)
+			return answer, nil
+		}
+		if len(order) > 1 {
+			err = fmt.Errorf("%s: %w", p.Name, err)
+		}
+		lastErr = err
+		if !unavailable {
+			return "", err
+		}
+		r.health.fail(p.Name)
+		if i < len(order)-1 {
+			log.Printf("[LLM] profile %s unavailable, failing over to %s: %v", p.Name, order[i+1].Name, err)
+		}
+	}
+	return "", lastErr
+}
+
+// profileHealth remembers which profiles were unavailable recently. It is
+// shared by a Router and its task routers.
+type profileHealth struct {
+	mu   sync.Mutex
+	down map[string]time.Time // profile name -> end of its cooldown
+}
+
+func (h *profileHealth) fail(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.down[name] = time.Now().Add(failoverCooldown)
+}
+
+func (h *profileHealth) up(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.down, name)
+}
+
+// order returns profiles with those in cooldown moved to the end.
+func (h *profileHealth) order(profiles []Profile) []Profile {
+	if len(profiles) < 2 {
+		return profiles
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.down) == 0 {
+		return profiles
+	}
+	now := time.Now()
+	ordered := make([]Profile, 0, len(profiles))
+	var cooling []Profile
+	for _, p := range profiles {
+		if until, ok := h.down[p.Name]; ok && now.Before(until) {
+			cooling = append(cooling, p)
+			continue
+		}
+		ordered = append(ordered, p)
+	}
+	return append(ordered, cooling...)
+}
@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"strings"
+	"sync"
+)
+
+// DefaultScriptedReply is what a ScriptedLLMService created without a
+// default reply answers when no rule matches.
+const DefaultScriptedReply = "这是测试模式的回答。"
+
+// ScriptedReply is a rule of a ScriptedLLMService: calls whose question or
+// prompt contains Match get Reply, or fail with Err when it is set. An empty
+// Match matches every call.
+type ScriptedReply struct {
+	Match string
+	Reply string
+	Err   error
+}
+
+// ScriptedCall records a call made to a ScriptedLLMService.
+type ScriptedCall struct {
+	Prompt   string
+	Context  []string
+	Question string
+	Image    string // image data URL of GenerateWithImage calls
+}
+
+// ScriptedLLMService implements LLMService without an API, for integration
+// tests: replies come from rules added with On and OnError, checked in the
+// order they were added, and every call is recorded for assertions. It is
+// safe for concurrent use.
+type ScriptedLLMService struct {
+	mu           sync.Mutex
+	rules        []ScriptedReply
+	defaultReply string
+	calls        []ScriptedCall
+}
+
+// NewScriptedLLMService creates a ScriptedLLMService answering defaultReply,
+// or DefaultScriptedReply when it is empty, to calls no rule matches.
+func NewScriptedLLMService(defaultReply string) *ScriptedLLMService {
+	if defaultReply == "" {
+		defaultReply = DefaultScriptedReply
+	}
+	return &ScriptedLLMService{defaultReply: defaultReply}
+}
+
+// On adds a rule answering reply to calls whose question or prompt contains
+// match. It returns s so rules can be chained.
+func (s *ScriptedLLMService) On(match, reply string) *ScriptedLLMService {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, ScriptedReply{Match: match, Reply: reply})
+	return s
+}
+
+// OnError adds a rule failing calls whose question or prompt contains match
+// with err, to test how API failures are handled.
+func (s *ScriptedLLMService) OnError(match string, err error) *ScriptedLLMService {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, ScriptedReply{Match: match, Err: err})
+	return s
+}
+
+// Calls returns the calls made so far, oldest first.
+func (s *ScriptedLLMService) Calls() []ScriptedCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ScriptedCall(nil), s.calls...)
+}
+
+// Reset removes all rules and recorded calls.
+func (s *ScriptedLLMService) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = nil
+	s.calls = nil
+}
+
+// Generate answers from the script.
+func (s *ScriptedLLMService) Generate(prompt string, context []string, question string) (string, error) {
+	return s.reply(ScriptedCall{Prompt: prompt, Context: context, Question: question})
+}
+
+// GenerateWithImage answers from the script; the image is only recorded.
+func (s *ScriptedLLMService) GenerateWithImage(prompt string, context []string, question string, imageDataURL string) (string, error) {
+	return s.reply(ScriptedCall{Prompt: prompt, Context: context, Question: question, Image: imageDataURL})
+}
+
+func (s *ScriptedLLMService) reply(call ScriptedCall) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, call)
+	for _, r := range s.rules {
+		if strings.Contains(call.Question, r.Match) || strings.Contains(call.Prompt, r.Match) {
+			if r.Err != nil {
+				return "", r.Err
+			}
+			return r.Reply, nil
+		}
+	}
+	return s.defaultReply, nil
+}
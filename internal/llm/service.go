@@ -49,6 +49,11 @@ func NewAPILLMService(endpoint, apiKey, modelName string, temperature float64, m
 	}
 }
 
+// SetTimeout sets how long one call may take, 120 seconds by default.
+func (s *APILLMService) SetTimeout(d time.Duration) {
+	s.client.Timeout = d
+}
+
 // chatRequest is the request body for the OpenAI-compatible chat completion API.
 type chatRequest struct {
 	Model       string        `json:"model"`
@@ -99,15 +104,19 @@ type apiError struct {
 	Type    string `json:"type"`
 }
 
+// DefaultAnswerPrompt is the system prompt used when Generate is called with
+// an empty prompt.
+const DefaultAnswerPrompt = "你是一个专业的软件技术支持助手。请根据提供的参考资料回答用户的问题。" +
+	"如果参考资料中没有相关信息，请如实告知用户。回答应简洁、准确、有条理。" +
+	"\n\n重要规则：你必须使用与用户提问相同的语言来回答。如果用户用英文提问，你必须用英文回答；如果用户用中文提问，你必须用中文回答；其他语言同理。无论参考资料是什么语言，都要翻译成用户提问的语言来回答。" +
+	"\n\n格式规则：使用有序列表时，请使用递增的序号（1. 2. 3.），不要所有条目都用1.开头。"
+
 // BuildMessages constructs the chat messages from the prompt, context chunks, and question.
 // It returns a system message and a user message.
 func BuildMessages(prompt string, context []string, question string) []chatMessage {
 	systemContent := prompt
 	if systemContent == "" {
-		systemContent = "你是一个专业的软件技术支持助手。请根据提供的参考资料回答用户的问题。" +
-			"如果参考资料中没有相关信息，请如实告知用户。回答应简洁、准确、有条理。" +
-			"\n\n重要规则：你必须使用与用户提问相同的语言来回答。如果用户用英文提问，你必须用英文回答；如果用户用中文提问，你必须用中文回答；其他语言同理。无论参考资料是什么语言，都要翻译成用户提问的语言来回答。" +
-			"\n\n格式规则：使用有序列表时，请使用递增的序号（1. 2. 3.），不要所有条目都用1.开头。"
+		systemContent = DefaultAnswerPrompt
 	}
 
 	var userParts []string
@@ -131,16 +140,20 @@ func BuildMessages(prompt string, context []string, question string) []chatMessa
 func (s *APILLMService) Generate(prompt string, context []string, question string) (string, error) {
 	messages := BuildMessages(prompt, context, question)
 
-	answer, err := s.callAPIWithRetry(messages)
+	answer, err, _ := s.callAPIWithRetry(messages, maxAttempts)
 	if err != nil {
 		return "服务暂时不可用，请稍后重试", fmt.Errorf("LLM API failed after retries: %w", err)
 	}
 	return answer, nil
 }
 
-// callAPIWithRetry calls the LLM API with retry and exponential backoff for transient errors.
-func (s *APILLMService) callAPIWithRetry(messages []chatMessage) (string, error) {
-	const maxRetries = 3
+// maxAttempts is how many times a call is tried on transient errors.
+const maxAttempts = 3
+
+// callAPIWithRetry calls the LLM API up to maxRetries times, with backoff
+// between attempts, on transient errors. The third return value reports
+// whether the last error was transient.
+func (s *APILLMService) callAPIWithRetry(messages []chatMessage, maxRetries int) (string, error, bool) {
 	var lastErr error
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		if attempt > 0 {
@@ -151,17 +164,17 @@ func (s *APILLMService) callAPIWithRetry(messages []chatMessage) (string, error)
 
 		answer, err, retryable := s.callAPI(messages)
 		if err == nil {
-			return answer, nil
+			return answer, nil, false
 		}
 		lastErr = err
 		if !retryable {
-			return "", err
+			return "", err, false
 		}
 		log.Printf("[LLM] attempt %d/%d failed (retryable): %v", attempt+1, maxRetries, err)
 	}
 
 	errlog.Logf("[LLM] API failed after %d retries: %v", maxRetries, lastErr)
-	return "", lastErr
+	return "", lastErr, true
 }
 
 // callAPI sends the chat completion request to the API and returns the generated text.
@@ -267,7 +280,7 @@ func (s *APILLMService) GenerateWithImage(prompt string, context []string, quest
 
 	messages := BuildMessagesWithImage(prompt, context, question, imageDataURL)
 
-	answer, err := s.callAPIWithRetry(messages)
+	answer, err, _ := s.callAPIWithRetry(messages, maxAttempts)
 	if err != nil {
 		return "", fmt.Errorf("LLM vision API failed: %w", err)
 	}
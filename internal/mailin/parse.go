@@ -0,0 +1,313 @@
+// Package mailin converts inbound emails, posted by a mail provider's inbound
+// webhook, into the parts of a knowledge entry: sender, recipients, subject,
+// body text and image attachments.
+package mailin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+
+	"askflow/internal/parser"
+)
+
+const (
+	// maxPartDepth bounds the nesting of multipart bodies and attached
+	// messages.
+	maxPartDepth = 10
+	// maxAttachments caps the image attachments kept from one message.
+	maxAttachments = 20
+	// maxAttachmentBytes is the largest image attachment kept.
+	maxAttachmentBytes = 10 << 20
+)
+
+// Attachment is an image attached to, or embedded in, a message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Message is an inbound email reduced to what a knowledge entry needs.
+// Addresses are lowercased.
+type Message struct {
+	MessageID   string
+	From        string
+	To          []string // To, Cc and delivery recipients
+	Subject     string
+	Text        string // text/plain body
+	HTML        string // text/html body, used when there is no plain text
+	Attachments []Attachment
+	// Forwarded holds the bodies of messages forwarded as attachments.
+	Forwarded []string
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// charsetReader decodes text in a non-UTF-8 charset such as GBK or Big5.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if charset == "" || charset == "utf-8" || charset == "us-ascii" {
+		return input, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("不支持的字符集: %s", charset)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// decodeHeader decodes RFC 2047 encoded words, keeping the raw value when it
+// cannot be decoded.
+func decodeHeader(s string) string {
+	if d, err := wordDecoder.DecodeHeader(s); err == nil {
+		s = d
+	}
+	return strings.TrimSpace(s)
+}
+
+// ParseAddressList returns the lowercased addresses of an address list such
+// as a To header.
+func ParseAddressList(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	ap := mail.AddressParser{WordDecoder: wordDecoder}
+	list, err := ap.ParseList(s)
+	if err != nil {
+		// Fall back to anything that looks like an address
+		var addrs []string
+		for _, m := range addressRe.FindAllString(s, -1) {
+			addrs = append(addrs, strings.ToLower(m))
+		}
+		return addrs
+	}
+	addrs := make([]string, 0, len(list))
+	for _, a := range list {
+		addrs = append(addrs, strings.ToLower(a.Address))
+	}
+	return addrs
+}
+
+var addressRe = regexp.MustCompile(`[^\s<>,;:"()]+@[^\s<>,;:"()]+`)
+
+// ParseAddress returns the lowercased address of a From value such as
+// `"张三" <zhang@example.com>`, or "" if there is none.
+func ParseAddress(s string) string {
+	if addrs := ParseAddressList(s); len(addrs) > 0 {
+		return addrs[0]
+	}
+	return ""
+}
+
+// Parse parses a raw RFC 5322 message.
+func Parse(raw []byte) (*Message, error) {
+	return parse(raw, 0)
+}
+
+func parse(raw []byte, depth int) (*Message, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("邮件格式无效: %w", err)
+	}
+	h := msg.Header
+	m := &Message{
+		MessageID: strings.Trim(strings.TrimSpace(h.Get("Message-Id")), "<>"),
+		From:      ParseAddress(h.Get("From")),
+		Subject:   decodeHeader(h.Get("Subject")),
+	}
+	for _, name := range []string{"To", "Cc", "Delivered-To", "X-Original-To"} {
+		for _, v := range h[name] {
+			m.To = appendUnique(m.To, ParseAddressList(v)...)
+		}
+	}
+	if err := m.readPart(textproto.MIMEHeader(h), msg.Body, depth); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// readPart adds the content of one MIME part, descending into multipart
+// bodies and attached messages.
+func (m *Message) readPart(h textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > maxPartDepth {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("邮件正文解析失败: %w", err)
+			}
+			if err := m.readPart(p.Header, p, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(transferDecoder(h.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return fmt.Errorf("邮件正文解码失败: %w", err)
+	}
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := decodeHeader(dparams["filename"])
+	if filename == "" {
+		filename = decodeHeader(params["name"])
+	}
+
+	switch {
+	case mediaType == "message/rfc822":
+		inner, err := parse(data, depth+1)
+		if err != nil {
+			return nil
+		}
+		if body := inner.Body(); body != "" {
+			m.Forwarded = append(m.Forwarded, body)
+		}
+		for _, a := range inner.Attachments {
+			m.addAttachment(a)
+		}
+	case strings.HasPrefix(mediaType, "image/"):
+		m.addAttachment(Attachment{Filename: filename, ContentType: mediaType, Data: data})
+	case disposition == "attachment" || filename != "":
+		// Other attachments (documents, archives) are not imported
+	case mediaType == "text/plain" && m.Text == "":
+		m.Text = decodeCharset(params["charset"], data)
+	case mediaType == "text/html" && m.HTML == "":
+		m.HTML = decodeCharset(params["charset"], data)
+	}
+	return nil
+}
+
+func (m *Message) addAttachment(a Attachment) {
+	if len(m.Attachments) < maxAttachments && len(a.Data) > 0 && len(a.Data) <= maxAttachmentBytes {
+		m.Attachments = append(m.Attachments, a)
+	}
+}
+
+// transferDecoder decodes a Content-Transfer-Encoding.
+func transferDecoder(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// decodeCharset converts body text to UTF-8, keeping it as is when the
+// charset is unknown.
+func decodeCharset(charset string, data []byte) string {
+	r, err := charsetReader(charset, bytes.NewReader(data))
+	if err != nil {
+		return string(data)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return string(data)
+	}
+	return string(out)
+}
+
+var blankLinesRe = regexp.MustCompile(`\n{3,}`)
+
+// Body returns the message text: the plain text body, or the HTML body
+// converted to text, followed by the bodies of messages forwarded as
+// attachments. Signatures are kept: a forwarded answer often comes after the
+// forwarder's signature.
+func (m *Message) Body() string {
+	text := m.Text
+	if strings.TrimSpace(text) == "" && m.HTML != "" {
+		if res, err := (&parser.DocumentParser{}).Parse([]byte(m.HTML), "html"); err == nil {
+			text = res.Text
+		}
+	}
+	parts := make([]string, 0, 1+len(m.Forwarded))
+	if text = cleanBody(text); text != "" {
+		parts = append(parts, text)
+	}
+	parts = append(parts, m.Forwarded...)
+	return strings.Join(parts, "\n\n")
+}
+
+func cleanBody(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.TrimSpace(blankLinesRe.ReplaceAllString(text, "\n\n"))
+}
+
+var subjectPrefixRe = regexp.MustCompile(`(?i)^\s*(?:(?:re|fw|fwd|aw|wg|sv|回复|答复|转发)\s*[:：]|\[(?:fwd|fw)\]|[(（](?:fwd|fw|转发)[)）])\s*`)
+
+// CleanSubject strips reply and forward prefixes such as "Re:", "Fwd:" and
+// "转发：" from a subject.
+func CleanSubject(s string) string {
+	for {
+		loc := subjectPrefixRe.FindStringIndex(s)
+		if loc == nil {
+			return strings.TrimSpace(s)
+		}
+		s = s[loc[1]:]
+	}
+}
+
+// MatchAddress reports whether addr matches one of patterns: a full address,
+// or a domain written as "@example.com" or "example.com" that also matches
+// its subdomains.
+func MatchAddress(addr string, patterns []string) bool {
+	addr = strings.ToLower(addr)
+	_, domain, ok := strings.Cut(addr, "@")
+	if !ok {
+		return false
+	}
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if strings.Contains(strings.TrimPrefix(p, "@"), "@") {
+			if p == addr {
+				return true
+			}
+			continue
+		}
+		p = strings.TrimPrefix(p, "@")
+		if domain == p || strings.HasSuffix(domain, "."+p) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		found := false
+		for _, s := range list {
+			if s == item {
+				found = true
+				break
+			}
+		}
+		if !found && item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,294 @@
+// Package maintenance runs the nightly SQLite upkeep: it truncates the WAL,
+// refreshes the query planner statistics and returns free pages to the file
+// system, so long-running instances do not slow down as the database grows.
+package maintenance
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"askflow/internal/config"
+	"askflow/internal/errlog"
+	"askflow/internal/periodic"
+)
+
+const (
+	// minScheduledGap keeps a window from running maintenance twice, e.g. when
+	// the window is longer than the tick or the server restarts inside it.
+	minScheduledGap = 12 * time.Hour
+
+	// autoVacuumIncremental is the PRAGMA auto_vacuum value of incremental mode.
+	autoVacuumIncremental = 2
+)
+
+// Run triggers.
+const (
+	TriggerScheduled = "scheduled"
+	TriggerManual    = "manual"
+)
+
+// ErrRunning is returned by RunNow while a maintenance run is in progress.
+var ErrRunning = errors.New("maintenance already running")
+
+// Run is the result of one maintenance run.
+type Run struct {
+	ID         int64     `json:"id"`
+	Trigger    string    `json:"trigger"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	FreedPages int       `json:"freed_pages"`
+	// FullVacuum is set on the run that switched the database to incremental
+	// auto-vacuum, which needs one full VACUUM.
+	FullVacuum    bool   `json:"full_vacuum"`
+	DBSizeBefore  int64  `json:"db_size_before"`
+	DBSizeAfter   int64  `json:"db_size_after"`
+	WALSizeBefore int64  `json:"wal_size_before"`
+	WALSizeAfter  int64  `json:"wal_size_after"`
+	Error         string `json:"error,omitempty"`
+}
+
+// Status is the maintenance state shown in the admin panel.
+type Status struct {
+	Config  config.MaintenanceConfig `json:"config"`
+	Running bool                     `json:"running"`
+	NextRun *time.Time               `json:"next_run,omitempty"` // nil when scheduled maintenance is disabled
+	Runs    []Run                    `json:"runs"`               // most recent first
+}
+
+// Service runs maintenance on demand and in the configured nightly window.
+type Service struct {
+	db     *sql.DB // write connection: checkpoint and vacuum need it
+	dbPath string
+	cfg    func() config.MaintenanceConfig
+
+	runner *periodic.Runner
+}
+
+// NewService creates a maintenance service for the database at dbPath. cfg
+// returns the current schedule so config changes apply without a restart.
+func NewService(db *sql.DB, dbPath string, cfg func() config.MaintenanceConfig) *Service {
+	return &Service{db: db, dbPath: dbPath, cfg: cfg, runner: periodic.New("Maintenance", ErrRunning)}
+}
+
+// Start launches the scheduler that runs maintenance once per window.
+func (s *Service) Start() {
+	s.runner.Start(func(now time.Time) {
+		if s.due(now) {
+			s.RunNow(TriggerScheduled)
+		}
+	})
+}
+
+// Stop stops scheduled maintenance and waits for a running pass to finish.
+func (s *Service) Stop() {
+	s.runner.Stop()
+}
+
+// due reports whether scheduled maintenance should start at now: the window
+// is open and no scheduled run happened recently.
+func (s *Service) due(now time.Time) bool {
+	cfg := s.cfg()
+	if cfg.Disabled || !inWindow(cfg, now) {
+		return false
+	}
+	var last sql.NullTime
+	if err := s.db.QueryRow(
+		`SELECT MAX(started_at) FROM maintenance_runs WHERE trigger_type = ?`, TriggerScheduled,
+	).Scan(&last); err != nil {
+		log.Printf("[Maintenance] failed to read last run: %v", err)
+		return false
+	}
+	return !last.Valid || now.Sub(last.Time) >= minScheduledGap
+}
+
+// inWindow reports whether now falls in the maintenance window. A window
+// whose end is before its start spans midnight.
+func inWindow(cfg config.MaintenanceConfig, now time.Time) bool {
+	start, err1 := config.ParseClock(cfg.WindowStart)
+	end, err2 := config.ParseClock(cfg.WindowEnd)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	m := now.Hour()*60 + now.Minute()
+	if start <= end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
+
+// nextRun returns the next time the window opens after now.
+func nextRun(cfg config.MaintenanceConfig, now time.Time) *time.Time {
+	start, err := config.ParseClock(cfg.WindowStart)
+	if err != nil {
+		return nil
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), start/60, start%60, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return &next
+}
+
+// RunNow runs maintenance immediately and records the result. It returns
+// ErrRunning if another run is in progress. A failed step is recorded in
+// Run.Error and also returned.
+func (s *Service) RunNow(trigger string) (run *Run, err error) {
+	if busy := s.runner.Do(func() { run, err = s.run(trigger) }); busy != nil {
+		return nil, busy
+	}
+	return run, err
+}
+
+// RunAsync starts a maintenance run in the background; progress is visible
+// through Status. It returns ErrRunning if a run is already in progress.
+func (s *Service) RunAsync(trigger string) error {
+	return s.runner.Go(func() { s.run(trigger) })
+}
+
+// run performs a maintenance run.
+func (s *Service) run(trigger string) (*Run, error) {
+	run := &Run{Trigger: trigger, StartedAt: time.Now().UTC()}
+	run.DBSizeBefore, run.WALSizeBefore = s.fileSizes()
+	err := s.maintain(run)
+	run.DBSizeAfter, run.WALSizeAfter = s.fileSizes()
+	run.DurationMs = time.Since(run.StartedAt).Milliseconds()
+	if err != nil {
+		run.Error = err.Error()
+		log.Printf("[Maintenance] %s run failed after %dms: %v", trigger, run.DurationMs, err)
+		errlog.Logf("[Maintenance] %s run failed: %v", trigger, err)
+	} else {
+		log.Printf("[Maintenance] %s run done in %dms: freed_pages=%d full_vacuum=%v db=%d->%d bytes wal=%d->%d bytes",
+			trigger, run.DurationMs, run.FreedPages, run.FullVacuum,
+			run.DBSizeBefore, run.DBSizeAfter, run.WALSizeBefore, run.WALSizeAfter)
+	}
+	if recErr := s.record(run); recErr != nil {
+		log.Printf("[Maintenance] failed to record run: %v", recErr)
+	}
+	return run, err
+}
+
+// maintain checkpoints the WAL, runs ANALYZE and reclaims free pages.
+func (s *Service) maintain(run *Run) error {
+	if err := s.checkpoint(); err != nil {
+		return err
+	}
+
+	if _, err := s.db.Exec("ANALYZE"); err != nil {
+		return fmt.Errorf("ANALYZE failed: %w", err)
+	}
+
+	var mode int
+	if err := s.db.QueryRow("PRAGMA auto_vacuum").Scan(&mode); err != nil {
+		return fmt.Errorf("failed to read auto_vacuum: %w", err)
+	}
+	var freeBefore, freeAfter int
+	if err := s.db.QueryRow("PRAGMA freelist_count").Scan(&freeBefore); err != nil {
+		return fmt.Errorf("failed to read freelist_count: %w", err)
+	}
+	if mode != autoVacuumIncremental {
+		// Databases created before incremental auto-vacuum was enabled need a
+		// full VACUUM once to switch modes
+		if _, err := s.db.Exec("PRAGMA auto_vacuum=INCREMENTAL"); err != nil {
+			return fmt.Errorf("failed to set auto_vacuum: %w", err)
+		}
+		if _, err := s.db.Exec("VACUUM"); err != nil {
+			return fmt.Errorf("VACUUM failed: %w", err)
+		}
+		run.FullVacuum = true
+	} else if err := s.incrementalVacuum(); err != nil {
+		return fmt.Errorf("incremental vacuum failed: %w", err)
+	}
+	if err := s.db.QueryRow("PRAGMA freelist_count").Scan(&freeAfter); err != nil {
+		return fmt.Errorf("failed to read freelist_count: %w", err)
+	}
+	run.FreedPages = freeBefore - freeAfter
+
+	// Vacuuming writes through the WAL; truncate it again
+	return s.checkpoint()
+}
+
+// incrementalVacuum frees all pages on the freelist. The pragma frees one
+// page per result row, so the rows must be read to the end.
+func (s *Service) incrementalVacuum() error {
+	rows, err := s.db.Query("PRAGMA incremental_vacuum")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// checkpoint runs PRAGMA wal_checkpoint(TRUNCATE), which copies the WAL into
+// the database and truncates the WAL file.
+func (s *Service) checkpoint() error {
+	var busy, logFrames, checkpointed int
+	if err := s.db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return fmt.Errorf("WAL checkpoint failed: %w", err)
+	}
+	if busy != 0 {
+		return fmt.Errorf("WAL checkpoint incomplete: database busy (%d/%d frames)", checkpointed, logFrames)
+	}
+	return nil
+}
+
+// fileSizes returns the size of the database and its WAL file in bytes.
+func (s *Service) fileSizes() (dbSize, walSize int64) {
+	if fi, err := os.Stat(s.dbPath); err == nil {
+		dbSize = fi.Size()
+	}
+	if fi, err := os.Stat(s.dbPath + "-wal"); err == nil {
+		walSize = fi.Size()
+	}
+	return dbSize, walSize
+}
+
+// record stores a run and prunes old records.
+func (s *Service) record(run *Run) error {
+	res, err := s.db.Exec(
+		`INSERT INTO maintenance_runs (trigger_type, started_at, duration_ms, freed_pages, full_vacuum,
+			db_size_before, db_size_after, wal_size_before, wal_size_after, error)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.Trigger, run.StartedAt, run.DurationMs, run.FreedPages, run.FullVacuum,
+		run.DBSizeBefore, run.DBSizeAfter, run.WALSizeBefore, run.WALSizeAfter, run.Error,
+	)
+	if err != nil {
+		return err
+	}
+	run.ID, _ = res.LastInsertId()
+	_, err = s.db.Exec(`DELETE FROM maintenance_runs WHERE id NOT IN (SELECT id FROM maintenance_runs ORDER BY id DESC LIMIT ?)`, periodic.KeepRuns)
+	return err
+}
+
+// Status returns the schedule, whether a run is in progress and the most
+// recent runs.
+func (s *Service) Status(limit int) (*Status, error) {
+	cfg := s.cfg()
+	st := &Status{Config: cfg, Running: s.runner.Running(), Runs: []Run{}}
+	if !cfg.Disabled {
+		st.NextRun = nextRun(cfg, time.Now())
+	}
+
+	rows, err := s.db.Query(
+		`SELECT id, trigger_type, started_at, duration_ms, freed_pages, full_vacuum,
+			db_size_before, db_size_after, wal_size_before, wal_size_after, COALESCE(error, '')
+		 FROM maintenance_runs ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query maintenance runs: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r Run
+		if err := rows.Scan(&r.ID, &r.Trigger, &r.StartedAt, &r.DurationMs, &r.FreedPages, &r.FullVacuum,
+			&r.DBSizeBefore, &r.DBSizeAfter, &r.WALSizeBefore, &r.WALSizeAfter, &r.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan maintenance run: %w", err)
+		}
+		st.Runs = append(st.Runs, r)
+	}
+	return st, rows.Err()
+}
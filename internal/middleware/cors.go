@@ -4,8 +4,10 @@ import "net/http"
 
 // CORS 返回处理跨域请求的中间件。
 // 仅允许同源请求：验证 Origin 头与请求 Host 是否匹配。
+// externalOrigin 返回配置的外部访问地址（scheme://host），反向代理改写 Host 时
+// 该来源同样放行；返回空字符串表示未配置。
 // 对 OPTIONS 预检请求返回 204 No Content。
-func CORS() Middleware {
+func CORS(externalOrigin func() string) Middleware {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			// Only allow same-origin requests — reflect the Host as allowed origin
@@ -14,11 +16,13 @@ func CORS() Middleware {
 				// Validate that the origin matches the request host
 				// This prevents cross-origin requests from arbitrary domains
 				requestHost := r.Host
-				if requestHost != "" && (origin == "http://"+requestHost || origin == "https://"+requestHost) {
+				sameHost := requestHost != "" && (origin == "http://"+requestHost || origin == "https://"+requestHost)
+				if sameHost || (externalOrigin != nil && origin == externalOrigin()) {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
 					w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-					w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+					w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Debug-Token")
 					w.Header().Set("Access-Control-Allow-Credentials", "true")
+					w.Header().Set("Access-Control-Expose-Headers", "X-Request-Id, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, X-RateLimit-Warning, X-Session-Expires-At, X-Session-Max-Expires-At")
 					w.Header().Set("Access-Control-Max-Age", "3600")
 					w.Header().Set("Vary", "Origin")
 				}
@@ -4,17 +4,23 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
 // RateLimiter provides per-IP rate limiting using a sliding window counter.
+// Responses of limited endpoints report the client's remaining requests in
+// X-RateLimit-* headers, and carry X-RateLimit-Warning once the remaining
+// requests drop to the warning threshold, so clients can ask users to slow
+// down before they are blocked.
 type RateLimiter struct {
 	mu       sync.Mutex
 	requests map[string][]time.Time
 	limit    int           // max requests per window
 	window   time.Duration // time window
+	warnAt   int           // remaining requests at which to warn; 0 = never
 	stopCh   chan struct{} // signal to stop the cleanup goroutine
 }
 
@@ -58,9 +64,28 @@ func (rl *RateLimiter) Stop() {
 	}
 }
 
+// SetWarnThreshold sets how many remaining requests in the window trigger
+// the X-RateLimit-Warning header. 0 disables the warning.
+func (rl *RateLimiter) SetWarnThreshold(remaining int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if remaining < 0 {
+		remaining = 0
+	}
+	rl.warnAt = remaining
+}
+
 // Allow checks whether the given IP is allowed to make a request
 // under the configured rate limit.
 func (rl *RateLimiter) Allow(ip string) bool {
+	allowed, _, _ := rl.take(ip)
+	return allowed
+}
+
+// take records a request of ip if it is within the limit. It returns
+// whether the request is allowed, how many requests remain in the window,
+// and how long until the oldest counted request leaves the window.
+func (rl *RateLimiter) take(ip string) (allowed bool, remaining int, reset time.Duration) {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
@@ -88,11 +113,22 @@ func (rl *RateLimiter) Allow(ip string) bool {
 
 	if len(valid) >= rl.limit {
 		rl.requests[ip] = valid
-		return false
+		if len(valid) > 0 {
+			reset = valid[0].Add(rl.window).Sub(now)
+		}
+		return false, 0, reset
 	}
 
-	rl.requests[ip] = append(valid, now)
-	return true
+	valid = append(valid, now)
+	rl.requests[ip] = valid
+	return true, rl.limit - len(valid), valid[0].Add(rl.window).Sub(now)
+}
+
+// warnThreshold returns the remaining requests at which to warn.
+func (rl *RateLimiter) warnThreshold() int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.warnAt
 }
 
 // cleanup removes expired entries from the requests map.
@@ -136,18 +172,30 @@ func GetClientIP(r *http.Request) string {
 }
 
 // Limit returns a Middleware that enforces the rate limit.
-// When the limit is exceeded, it responds with 429 Too Many Requests.
+// Every response carries X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset (seconds until a request slot frees up); near the limit
+// it also carries X-RateLimit-Warning. When the limit is exceeded, it
+// responds with 429 Too Many Requests.
 func (rl *RateLimiter) Limit() Middleware {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			ip := GetClientIP(r)
-			if !rl.Allow(ip) {
+			allowed, remaining, reset := rl.take(ip)
+			// Round up so clients never retry before the slot is free
+			resetSec := strconv.Itoa(int((reset + time.Second - 1) / time.Second))
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rl.limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("X-RateLimit-Reset", resetSec)
+			if !allowed {
 				w.Header().Set("Content-Type", "application/json")
-				w.Header().Set("Retry-After", "60")
+				w.Header().Set("Retry-After", resetSec)
 				w.WriteHeader(http.StatusTooManyRequests)
 				w.Write([]byte(`{"error":"请求过于频繁，请稍后再试"}`))
 				return
 			}
+			if warnAt := rl.warnThreshold(); warnAt > 0 && remaining <= warnAt {
+				w.Header().Set("X-RateLimit-Warning", "approaching-limit")
+			}
 			next(w, r)
 		}
 	}
@@ -0,0 +1,554 @@
+// Package notify pushes new pending questions, scheduled publishing of
+// documents and budget alerts to team chat through Slack incoming webhooks, Lark (Feishu)
+// custom bots and DingTalk robots. Each admin can also subscribe to events of
+// the products they manage, delivered to their own email address and chat
+// webhook (see config.AdminNotifyPrefs).
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"askflow/internal/config"
+	"askflow/internal/errlog"
+	"askflow/internal/textutil"
+)
+
+// maxQuestionRunes limits how much of a question is quoted in a message.
+const maxQuestionRunes = 500
+
+// client posts webhook messages; the timeout keeps a slow receiver from
+// piling up goroutines.
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// PendingEvent describes a question added to the pending queue.
+type PendingEvent struct {
+	QuestionID string
+	Question   string
+	User       string // display name, or user ID when there is none
+	ProductID  string
+	Product    string // product name, "" for the public library
+	Link       string // admin page answering the question, "" when unknown
+}
+
+// ScheduleEvent describes a document published or unpublished by its
+// schedule.
+type ScheduleEvent struct {
+	DocumentID string
+	Name       string
+	ProductID  string
+	Product    string // product name, "" for the public library
+	Owner      string // admin who set the schedule
+	Published  bool   // false when the document was unpublished
+	Link       string // admin page listing the document, "" when unknown
+}
+
+// BudgetEvent describes monthly model spend reaching a share of a cap.
+type BudgetEvent struct {
+	Month     string
+	ProductID string
+	Product   string // product name, "" for the deployment cap
+	Percent   int
+	Spent     float64
+	Limit     float64
+	Action    string // config.BudgetBlockOptional or config.BudgetDegrade
+	Link      string // admin page showing the spend, "" when unknown
+}
+
+// FailureEvent describes a document whose processing failed.
+type FailureEvent struct {
+	DocumentID string
+	Name       string
+	ProductID  string
+	Product    string // product name, "" for the public library
+	Reason     string
+	Link       string // admin page listing the document, "" when unknown
+}
+
+// SecurityEvent describes an upload quarantined by the malware scan or an
+// admin account locked after failed logins.
+type SecurityEvent struct {
+	Title     string // what happened, e.g. "上传文件已被隔离"
+	Details   []string
+	ProductID string // product of a quarantined upload, "" for events of no product
+	// Skip lists email addresses alerted already, e.g. the scan alert address.
+	Skip []string
+}
+
+// DigestItem is a pending question or failed document in a digest.
+type DigestItem struct {
+	ProductID string
+	Product   string // product name, "" for the public library
+	Title     string
+}
+
+// DigestEvent summarizes what needs attention: the open pending questions
+// and the documents that failed in the last day. Each admin receives the
+// items of their own products.
+type DigestEvent struct {
+	Date    string
+	Pending []DigestItem
+	Failed  []DigestItem
+	Link    string // admin panel, "" when unknown
+}
+
+// maxDigestItems limits how many items of each kind a digest lists, and
+// maxDigestTitleRunes how much of each title is quoted.
+const (
+	maxDigestItems      = 10
+	maxDigestTitleRunes = 80
+)
+
+// Mailer sends plain-text email to one address.
+type Mailer interface {
+	SendAlert(to, subject, body string) error
+}
+
+// Service sends notifications to the configured channels.
+type Service struct {
+	cfg func() config.NotificationsConfig
+	// mailer sends the email of admin subscriptions; scope returns the
+	// product IDs an admin manages, none meaning all products.
+	mailer Mailer
+	scope  func(adminID string) []string
+	// validateURL checks personal webhook URLs, and every redirect they
+	// lead to, against SSRF rules.
+	validateURL func(string) error
+}
+
+// NewService creates a notification Service reading its channels from cfg on
+// every send, so configuration changes apply immediately.
+func NewService(cfg func() config.NotificationsConfig) *Service {
+	return &Service{cfg: cfg}
+}
+
+// SetMailer sets how subscription email is sent; without one admins only
+// receive their subscriptions through their chat webhook.
+func (s *Service) SetMailer(m Mailer) {
+	s.mailer = m
+}
+
+// SetScope sets how the products an admin manages are looked up, so admins
+// only receive the events of their products. Without it every subscriber
+// receives every event.
+func (s *Service) SetScope(fn func(adminID string) []string) {
+	s.scope = fn
+}
+
+// SetURLValidator sets the SSRF check of personal webhook URLs. Personal
+// webhooks are set by any admin, unlike the team channels, so they are
+// checked before every send and on every redirect.
+func (s *Service) SetURLValidator(fn func(string) error) {
+	s.validateURL = fn
+}
+
+// ValidateWebhookURL checks a personal webhook URL against SSRF rules.
+func (s *Service) ValidateWebhookURL(u string) error {
+	if s.validateURL == nil {
+		return nil
+	}
+	return s.validateURL(u)
+}
+
+// Active reports whether any channel is enabled or any admin subscribed to
+// an event.
+func (s *Service) Active() bool {
+	cfg := s.cfg()
+	if cfg.Active() {
+		return true
+	}
+	for _, p := range cfg.Admins {
+		if len(p.Events) > 0 && (p.Email != "" || p.WebhookURL != "") {
+			return true
+		}
+	}
+	return false
+}
+
+// PendingCreated notifies every enabled channel and subscribed admin of ev
+// in the background. Failures are logged and never affect the caller.
+func (s *Service) PendingCreated(ev PendingEvent) {
+	text, subject := pendingText(ev), "pending question "+ev.QuestionID
+	s.broadcast(text, subject)
+	s.deliver(config.NotifyEventPending, ev.ProductID, "新的待回答问题", text, subject, nil)
+}
+
+// ScheduleChanged notifies every enabled channel and subscribed admin of ev
+// in the background, addressing the schedule's owner. Failures are logged
+// and never affect the caller.
+func (s *Service) ScheduleChanged(ev ScheduleEvent) {
+	text, subject := scheduleText(ev), "schedule of document "+ev.DocumentID
+	s.broadcast(text, subject)
+	title := "文档已按计划下线"
+	if ev.Published {
+		title = "文档已按计划发布"
+	}
+	s.deliver(config.NotifyEventSchedule, ev.ProductID, title, text, subject, nil)
+}
+
+// BudgetReached notifies every enabled channel and subscribed admin of ev in
+// the background. Failures are logged and never affect the caller.
+func (s *Service) BudgetReached(ev BudgetEvent) {
+	text, subject := budgetText(ev), fmt.Sprintf("budget %s %d%%", ev.Month, ev.Percent)
+	s.broadcast(text, subject)
+	s.deliver(config.NotifyEventBudget, ev.ProductID, "模型费用预算告警", text, subject, nil)
+}
+
+// DocumentFailed notifies subscribed admins of ev in the background. The
+// team chat channels are not used: failures matter to the admins of the
+// product. Failures to notify are logged and never affect the caller.
+func (s *Service) DocumentFailed(ev FailureEvent) {
+	s.deliver(config.NotifyEventDocumentFailed, ev.ProductID, "文档处理失败", failureText(ev), "failed document "+ev.DocumentID, nil)
+}
+
+// SecurityAlert notifies subscribed admins of ev in the background. Failures
+// to notify are logged and never affect the caller.
+func (s *Service) SecurityAlert(ev SecurityEvent) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "【AskFlow】安全告警：%s", ev.Title)
+	for _, d := range ev.Details {
+		b.WriteString("\n" + d)
+	}
+	fmt.Fprintf(&b, "\n时间：%s", time.Now().Format("2006-01-02 15:04:05"))
+	s.deliver(config.NotifyEventSecurity, ev.ProductID, "安全告警："+ev.Title, b.String(), "security alert", ev.Skip)
+}
+
+// Digest sends each admin subscribed to digests the items of ev in their
+// products, in the background. Admins with nothing to attend to receive
+// nothing.
+func (s *Service) Digest(ev DigestEvent) {
+	cfg := s.cfg()
+	for id, p := range cfg.Admins {
+		if !p.Wants(config.NotifyEventDigest) {
+			continue
+		}
+		products := s.products(id)
+		pending := filterItems(ev.Pending, products)
+		failed := filterItems(ev.Failed, products)
+		if len(pending) == 0 && len(failed) == 0 {
+			continue
+		}
+		text := digestText(ev, pending, failed)
+		s.send(id, p, "每日摘要 "+ev.Date, text, "digest "+ev.Date)
+	}
+}
+
+// deliver sends text to every admin subscribed to event who manages
+// productID, in the background; title is the email subject and subject
+// names the event in failure logs. Email addresses in skip were alerted
+// already.
+func (s *Service) deliver(event, productID, title, text, subject string, skip []string) {
+	cfg := s.cfg()
+	for id, p := range cfg.Admins {
+		if !p.Wants(event) || !inScope(productID, s.products(id)) {
+			continue
+		}
+		if slices.ContainsFunc(skip, func(addr string) bool { return strings.EqualFold(addr, p.Email) }) {
+			p.Email = ""
+		}
+		s.send(id, p, title, text, subject)
+	}
+}
+
+// send delivers text to an admin's email address and personal webhook in
+// the background.
+func (s *Service) send(adminID string, p config.AdminNotifyPrefs, title, text, subject string) {
+	if p.Email != "" && s.mailer != nil {
+		go func() {
+			if err := s.mailer.SendAlert(p.Email, "【AskFlow】"+title, text); err != nil {
+				errlog.Logf("[Notify] email to %s for %s failed: %v", adminID, subject, err)
+			}
+		}()
+	}
+	if p.WebhookURL != "" {
+		ch := config.NotifyChannel{Enabled: true, WebhookURL: p.WebhookURL, Secret: p.Secret}
+		go func() {
+			if err := send(p.Channel, ch, text, s.validateURL); err != nil {
+				errlog.Logf("[Notify] %s webhook of %s for %s failed: %v", p.Channel, adminID, subject, err)
+			}
+		}()
+	}
+}
+
+// products returns the product IDs adminID manages, nil meaning all.
+func (s *Service) products(adminID string) []string {
+	if s.scope == nil {
+		return nil
+	}
+	return s.scope(adminID)
+}
+
+// inScope reports whether an event of productID concerns an admin managing
+// products. Events of the public library or of no product concern everyone.
+func inScope(productID string, products []string) bool {
+	return productID == "" || len(products) == 0 || slices.Contains(products, productID)
+}
+
+// filterItems returns the items concerning an admin managing products.
+func filterItems(items []DigestItem, products []string) []DigestItem {
+	var out []DigestItem
+	for _, it := range items {
+		if inScope(it.ProductID, products) {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+// broadcast sends text to every enabled channel in the background; subject
+// names the event in failure logs.
+func (s *Service) broadcast(text, subject string) {
+	cfg := s.cfg()
+	for _, name := range config.NotifyChannels {
+		ch := *cfg.Channel(name)
+		if !ch.Enabled || ch.WebhookURL == "" {
+			continue
+		}
+		go func(name string) {
+			if err := send(name, ch, text, nil); err != nil {
+				errlog.Logf("[Notify] %s notification for %s failed: %v", name, subject, err)
+			}
+		}(name)
+	}
+}
+
+// Test sends a test message through channel name with the given settings,
+// enabled or not, and returns the delivery error.
+func (s *Service) Test(name string, ch config.NotifyChannel) error {
+	if ch.WebhookURL == "" {
+		return fmt.Errorf("未配置 Webhook 地址")
+	}
+	return send(name, ch, "【AskFlow】测试消息：通知配置正确，新的待回答问题将推送到这里。", nil)
+}
+
+// TestPersonal sends a test message to a personal webhook, checking it and
+// its redirects against SSRF rules.
+func (s *Service) TestPersonal(name string, ch config.NotifyChannel) error {
+	if ch.WebhookURL == "" {
+		return fmt.Errorf("未配置 Webhook 地址")
+	}
+	return send(name, ch, "【AskFlow】测试消息：个人通知配置正确，订阅的事件将发送到这里。", s.validateURL)
+}
+
+// pendingText formats the message for a new pending question.
+func pendingText(ev PendingEvent) string {
+	question := textutil.Ellipsize(strings.TrimSpace(ev.Question), maxQuestionRunes)
+	product := ev.Product
+	if product == "" {
+		product = "公共库"
+	}
+	var b strings.Builder
+	b.WriteString("【AskFlow】新的待回答问题\n")
+	fmt.Fprintf(&b, "产品：%s\n", product)
+	fmt.Fprintf(&b, "用户：%s\n", ev.User)
+	fmt.Fprintf(&b, "问题：%s", question)
+	if ev.Link != "" {
+		fmt.Fprintf(&b, "\n去回答：%s", ev.Link)
+	}
+	return b.String()
+}
+
+// failureText formats the message for a failed document.
+func failureText(ev FailureEvent) string {
+	product := ev.Product
+	if product == "" {
+		product = "公共库"
+	}
+	var b strings.Builder
+	b.WriteString("【AskFlow】文档处理失败\n")
+	fmt.Fprintf(&b, "文档：%s\n", ev.Name)
+	fmt.Fprintf(&b, "产品：%s\n", product)
+	fmt.Fprintf(&b, "原因：%s", ev.Reason)
+	if ev.Link != "" {
+		fmt.Fprintf(&b, "\n查看：%s", ev.Link)
+	}
+	return b.String()
+}
+
+// digestText formats a digest of the given items.
+func digestText(ev DigestEvent, pending, failed []DigestItem) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "【AskFlow】每日摘要 %s", ev.Date)
+	section := func(heading string, items []DigestItem) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n\n%s（%d）：", heading, len(items))
+		for i, it := range items {
+			if i == maxDigestItems {
+				fmt.Fprintf(&b, "\n…… 另有 %d 项", len(items)-maxDigestItems)
+				break
+			}
+			title := textutil.Ellipsize(strings.TrimSpace(it.Title), maxDigestTitleRunes)
+			product := it.Product
+			if product == "" {
+				product = "公共库"
+			}
+			fmt.Fprintf(&b, "\n- [%s] %s", product, title)
+		}
+	}
+	section("待回答问题", pending)
+	section("近 24 小时处理失败的文档", failed)
+	if ev.Link != "" {
+		fmt.Fprintf(&b, "\n\n去处理：%s", ev.Link)
+	}
+	return b.String()
+}
+
+// scheduleText formats the message for a scheduled publish or unpublish.
+func scheduleText(ev ScheduleEvent) string {
+	product := ev.Product
+	if product == "" {
+		product = "公共库"
+	}
+	var b strings.Builder
+	if ev.Published {
+		b.WriteString("【AskFlow】文档已按计划发布，现在可以被检索和引用\n")
+	} else {
+		b.WriteString("【AskFlow】文档已按计划下线，不再被检索和引用\n")
+	}
+	fmt.Fprintf(&b, "文档：%s\n", ev.Name)
+	fmt.Fprintf(&b, "产品：%s\n", product)
+	fmt.Fprintf(&b, "负责人：%s", ev.Owner)
+	if ev.Link != "" {
+		fmt.Fprintf(&b, "\n查看：%s", ev.Link)
+	}
+	return b.String()
+}
+
+// budgetText formats the message for spend reaching a share of a cap.
+func budgetText(ev BudgetEvent) string {
+	scope := "整个部署"
+	if ev.Product != "" {
+		scope = "产品 " + ev.Product
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "【AskFlow】%s %s 的模型费用已达到预算的 %d%%\n", ev.Month, scope, ev.Percent)
+	fmt.Fprintf(&b, "已用：%.2f / 预算：%.2f", ev.Spent, ev.Limit)
+	if ev.Percent >= 100 {
+		if ev.Action == config.BudgetDegrade {
+			b.WriteString("\n已暂停翻译等非必要调用，问答改为仅使用缓存答案和关键词检索")
+		} else {
+			b.WriteString("\n已暂停翻译、标签、建议等非必要的模型调用")
+		}
+	}
+	if ev.Link != "" {
+		fmt.Fprintf(&b, "\n查看：%s", ev.Link)
+	}
+	return b.String()
+}
+
+// send posts text to a channel in its message format. A non-nil validate
+// checks the target and every redirect before they are requested.
+func send(name string, ch config.NotifyChannel, text string, validate func(string) error) error {
+	target := ch.WebhookURL
+	var payload map[string]interface{}
+	switch name {
+	case config.NotifySlack:
+		payload = map[string]interface{}{"text": text}
+	case config.NotifyLark:
+		payload = map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": text},
+		}
+		if ch.Secret != "" {
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			payload["timestamp"] = ts
+			payload["sign"] = larkSign(ts, ch.Secret)
+		}
+	case config.NotifyDingTalk:
+		payload = map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": text},
+		}
+		if ch.Secret != "" {
+			ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+			sep := "?"
+			if strings.Contains(target, "?") {
+				sep = "&"
+			}
+			target += sep + "timestamp=" + ts + "&sign=" + url.QueryEscape(dingTalkSign(ts, ch.Secret))
+		}
+	default:
+		return fmt.Errorf("未知的通知渠道: %s", name)
+	}
+
+	c := client
+	if validate != nil {
+		if err := validate(target); err != nil {
+			return err
+		}
+		c = &http.Client{
+			Timeout: client.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 5 {
+					return fmt.Errorf("too many redirects")
+				}
+				if err := validate(req.URL.String()); err != nil {
+					return fmt.Errorf("redirect blocked: %w", err)
+				}
+				return nil
+			},
+		}
+	}
+
+	body, _ := json.Marshal(payload)
+	resp, err := c.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	// The body is not echoed: it may come from a server the sender cannot
+	// otherwise read
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return checkReply(name, respBody)
+}
+
+// checkReply reports the errors Lark and DingTalk return with status 200.
+func checkReply(name string, body []byte) error {
+	var reply struct {
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if name == config.NotifySlack || json.Unmarshal(body, &reply) != nil {
+		return nil
+	}
+	if reply.Code != nil && *reply.Code != 0 {
+		return fmt.Errorf("code %d: %s", *reply.Code, reply.Msg)
+	}
+	if reply.ErrCode != nil && *reply.ErrCode != 0 {
+		return fmt.Errorf("errcode %d: %s", *reply.ErrCode, reply.ErrMsg)
+	}
+	return nil
+}
+
+// larkSign computes the signature of a Lark bot request: the HMAC-SHA256
+// of an empty message keyed with "timestamp\nsecret".
+func larkSign(ts, secret string) string {
+	mac := hmac.New(sha256.New, []byte(ts+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// dingTalkSign computes the signature of a DingTalk robot request: the
+// HMAC-SHA256 of "timestamp\nsecret" keyed with the secret.
+func dingTalkSign(ts, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
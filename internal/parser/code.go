@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Pre-compiled regexes for code blocks in HTML.
+var (
+	htmlPreRe      = regexp.MustCompile(`(?is)<pre\b([^>]*)>(.*?)</pre\s*>`)
+	htmlCodeOpenRe = regexp.MustCompile(`(?is)^\s*<code\b([^>]*)>`)
+	htmlCodeLangRe = regexp.MustCompile(`(?i)\b(?:language|lang)-([a-z0-9_+#.-]+)`)
+	codeMarkRe     = regexp.MustCompile(`\x{E000}(\d+)\x{E001}`) // marker of an extracted <pre> block
+)
+
+// mdFence reports whether line opens or closes a fenced code block: three or
+// more backticks or tildes indented by up to three spaces. It returns the
+// fence marker and the info string after it.
+func mdFence(line string) (marker, info string, ok bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return "", "", false
+	}
+	n := strings.IndexFunc(trimmed, func(r rune) bool { return r != rune(trimmed[0]) })
+	if n < 0 {
+		n = len(trimmed)
+	}
+	if n < 3 {
+		return "", "", false
+	}
+	info = strings.TrimSpace(trimmed[n:])
+	if trimmed[0] == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	return trimmed[:n], info, true
+}
+
+// mapProse applies fn to the parts of markdown text outside fenced code
+// blocks and keeps the blocks, fences included, verbatim. An unclosed block
+// runs to the end of the text.
+func mapProse(text string, fn func(string) string) string {
+	var out, prose, code strings.Builder
+	var open string
+	for _, line := range strings.SplitAfter(text, "\n") {
+		marker, info, ok := mdFence(strings.TrimRight(line, "\r\n"))
+		switch {
+		case open == "" && ok:
+			out.WriteString(fn(prose.String()))
+			prose.Reset()
+			open = marker
+			code.WriteString(line)
+		case open == "":
+			prose.WriteString(line)
+		default:
+			code.WriteString(line)
+			if ok && info == "" && marker[0] == open[0] && len(marker) >= len(open) {
+				out.WriteString(code.String())
+				code.Reset()
+				open = ""
+			}
+		}
+	}
+	out.WriteString(fn(prose.String()))
+	out.WriteString(code.String())
+	return out.String()
+}
+
+// extractPreBlocks replaces the <pre> blocks of an HTML page with markers, so
+// their text survives tag stripping and whitespace cleanup, and returns them
+// as fenced code blocks with the language hint of a language-xxx or lang-xxx
+// class. restorePreBlocks puts them back into the cleaned text.
+func extractPreBlocks(html string) (string, []string) {
+	var blocks []string
+	html = htmlPreRe.ReplaceAllStringFunc(html, func(m string) string {
+		sub := htmlPreRe.FindStringSubmatch(m)
+		attrs, inner := sub[1], sub[2]
+		if c := htmlCodeOpenRe.FindStringSubmatch(inner); c != nil {
+			attrs += " " + c[1]
+		}
+		lang := ""
+		if l := htmlCodeLangRe.FindStringSubmatch(attrs); l != nil {
+			lang = strings.ToLower(l[1])
+		}
+		code := htmlBrRe.ReplaceAllString(inner, "\n")
+		code = decodeHTMLEntities(htmlTagRe.ReplaceAllString(code, ""))
+		code = strings.Trim(strings.ReplaceAll(code, "\r\n", "\n"), "\n")
+		if strings.TrimSpace(code) == "" {
+			return "\n"
+		}
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		blocks = append(blocks, fence+lang+"\n"+code+"\n"+fence)
+		return fmt.Sprintf("\n\uE000%d\uE001\n", len(blocks)-1)
+	})
+	return html, blocks
+}
+
+// restorePreBlocks replaces the markers left by extractPreBlocks with the
+// code blocks.
+func restorePreBlocks(text string, blocks []string) string {
+	if len(blocks) == 0 {
+		return text
+	}
+	return codeMarkRe.ReplaceAllStringFunc(text, func(m string) string {
+		i, err := strconv.Atoi(codeMarkRe.FindStringSubmatch(m)[1])
+		if err != nil || i >= len(blocks) {
+			return ""
+		}
+		return blocks[i]
+	})
+}
@@ -0,0 +1,532 @@
+// Package parser — detection and decryption of password-protected documents.
+// OOXML (docx/xlsx/pptx) files encrypted with ECMA-376 Agile or Standard
+// encryption are decrypted in-process; encrypted PDFs are read through
+// ledongthuc/pdf, which supports the RC4/AES security handlers. Legacy binary
+// formats (.doc/.xls/.ppt) are only detected, not decrypted.
+package parser
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	lpdf "github.com/ledongthuc/pdf"
+	"github.com/richardlehane/mscfb"
+)
+
+var (
+	// ErrPasswordProtected means the document is encrypted and no password (or no usable one) was supplied.
+	ErrPasswordProtected = errors.New("文档受密码保护，请提供密码后重新导入")
+	// ErrWrongPassword means a password was supplied but it does not open the document.
+	ErrWrongPassword = errors.New("文档密码错误")
+	// ErrUnsupportedEncryption means the document is encrypted with a scheme we cannot decrypt.
+	ErrUnsupportedEncryption = errors.New("不支持该文档的加密方式，请移除密码后再导入")
+	// ErrCorruptDocument means the file content does not match its declared format.
+	ErrCorruptDocument = errors.New("文档已损坏或格式无效")
+)
+
+// IsPasswordError reports whether err indicates that the document needs a (correct) password.
+func IsPasswordError(err error) bool {
+	return errors.Is(err, ErrPasswordProtected) || errors.Is(err, ErrWrongPassword)
+}
+
+// excelDefaultPassword is the well-known password Excel uses for workbooks that are
+// "encrypted" only to enforce read-only structure protection.
+const excelDefaultPassword = "VelvetSweatshop"
+
+var (
+	ole2Magic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// prepareOOXML checks an OOXML (docx/xlsx/pptx) payload. Plain files are returned
+// unchanged; encrypted files (an OLE2 container holding EncryptedPackage) are
+// decrypted with the given password.
+func prepareOOXML(data []byte, fileType, password string) ([]byte, error) {
+	if bytes.HasPrefix(data, zipMagic) {
+		return data, nil
+	}
+	if !bytes.HasPrefix(data, ole2Magic) {
+		return nil, ErrCorruptDocument
+	}
+	if password == "" && fileType == "excel" {
+		if dec, err := decryptOOXML(data, excelDefaultPassword); err == nil {
+			return dec, nil
+		}
+	}
+	if password == "" {
+		if _, _, err := readEncryptedOOXMLStreams(data); err != nil {
+			return nil, err
+		}
+		return nil, ErrPasswordProtected
+	}
+	return decryptOOXML(data, password)
+}
+
+// readEncryptedOOXMLStreams extracts the EncryptionInfo and EncryptedPackage streams
+// from an OLE2 container. An OLE2 file without them is a legacy binary document
+// saved with an OOXML extension, which we report as corrupt.
+func readEncryptedOOXMLStreams(data []byte) (info, pkg []byte, err error) {
+	doc, err := mscfb.New(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrCorruptDocument, err)
+	}
+	for {
+		entry, nextErr := doc.Next()
+		if nextErr != nil {
+			break
+		}
+		switch entry.Name {
+		case "EncryptionInfo":
+			info, _ = io.ReadAll(entry)
+		case "EncryptedPackage":
+			pkg, _ = io.ReadAll(entry)
+		}
+	}
+	if info == nil || pkg == nil {
+		return nil, nil, fmt.Errorf("%w: 文件扩展名与内容不符（可能是旧版Office格式）", ErrCorruptDocument)
+	}
+	return info, pkg, nil
+}
+
+// decryptOOXML decrypts an ECMA-376 encrypted OOXML container and returns the inner ZIP package.
+func decryptOOXML(data []byte, password string) ([]byte, error) {
+	info, pkg, err := readEncryptedOOXMLStreams(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(info) < 8 || len(pkg) < 8 {
+		return nil, ErrCorruptDocument
+	}
+	major := binary.LittleEndian.Uint16(info[0:2])
+	minor := binary.LittleEndian.Uint16(info[2:4])
+	var out []byte
+	switch {
+	case major == 4 && minor == 4:
+		out, err = decryptAgile(info[8:], pkg, password)
+	case (major == 2 || major == 3 || major == 4) && minor == 2:
+		out, err = decryptStandard(info, pkg, password)
+	default:
+		return nil, fmt.Errorf("%w (version %d.%d)", ErrUnsupportedEncryption, major, minor)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(out, zipMagic) {
+		return nil, ErrWrongPassword
+	}
+	return out, nil
+}
+
+// agileEncryptionInfo mirrors the XML descriptor used by Agile encryption (Office 2010+).
+type agileEncryptionInfo struct {
+	KeyData struct {
+		SaltValue       string `xml:"saltValue,attr"`
+		BlockSize       int    `xml:"blockSize,attr"`
+		KeyBits         int    `xml:"keyBits,attr"`
+		CipherAlgorithm string `xml:"cipherAlgorithm,attr"`
+		HashAlgorithm   string `xml:"hashAlgorithm,attr"`
+	} `xml:"keyData"`
+	EncryptedKey struct {
+		SpinCount                  int    `xml:"spinCount,attr"`
+		SaltValue                  string `xml:"saltValue,attr"`
+		BlockSize                  int    `xml:"blockSize,attr"`
+		KeyBits                    int    `xml:"keyBits,attr"`
+		HashSize                   int    `xml:"hashSize,attr"`
+		CipherAlgorithm            string `xml:"cipherAlgorithm,attr"`
+		HashAlgorithm              string `xml:"hashAlgorithm,attr"`
+		EncryptedVerifierHashInput string `xml:"encryptedVerifierHashInput,attr"`
+		EncryptedVerifierHashValue string `xml:"encryptedVerifierHashValue,attr"`
+		EncryptedKeyValue          string `xml:"encryptedKeyValue,attr"`
+	} `xml:"keyEncryptors>keyEncryptor>encryptedKey"`
+}
+
+// Block keys from MS-OFFCRYPTO 2.3.4.13 used to derive the three password-based keys.
+var (
+	blockKeyVerifierInput = []byte{0xfe, 0xa7, 0xd2, 0x76, 0x3b, 0x4b, 0x9e, 0x79}
+	blockKeyVerifierValue = []byte{0xd7, 0xaa, 0x0f, 0x6d, 0x30, 0x61, 0x34, 0x4e}
+	blockKeyEncryptedKey  = []byte{0x14, 0x6e, 0x0b, 0xe7, 0xab, 0xac, 0xd0, 0xd6}
+)
+
+// newHash returns a constructor for the named hash algorithm.
+func newHash(name string) (func() hash.Hash, error) {
+	switch strings.ToUpper(name) {
+	case "SHA1", "SHA-1":
+		return sha1.New, nil
+	case "SHA256", "SHA-256":
+		return sha256.New, nil
+	case "SHA384", "SHA-384":
+		return sha512.New384, nil
+	case "SHA512", "SHA-512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("%w (hash %s)", ErrUnsupportedEncryption, name)
+}
+
+func hashOf(newH func() hash.Hash, parts ...[]byte) []byte {
+	h := newH()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+// fitLength truncates b to n bytes, or pads it with pad bytes up to n.
+func fitLength(b []byte, n int, pad byte) []byte {
+	if len(b) >= n {
+		return b[:n]
+	}
+	out := make([]byte, n)
+	copy(out, b)
+	for i := len(b); i < n; i++ {
+		out[i] = pad
+	}
+	return out
+}
+
+func utf16LE(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, len(u)*2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	return b
+}
+
+func le32(i uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, i)
+	return b
+}
+
+// validAESKeyLen reports whether n bytes is an AES key size.
+func validAESKeyLen(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
+
+func aesCBCDecrypt(key, iv, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%aes.BlockSize != 0 {
+		return nil, ErrCorruptDocument
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	return out, nil
+}
+
+func aesECBDecrypt(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%aes.BlockSize != 0 {
+		return nil, ErrCorruptDocument
+	}
+	out := make([]byte, len(data))
+	for i := 0; i < len(data); i += aes.BlockSize {
+		block.Decrypt(out[i:i+aes.BlockSize], data[i:i+aes.BlockSize])
+	}
+	return out, nil
+}
+
+// decryptAgile implements ECMA-376 Agile encryption (password key encryptor, AES only).
+func decryptAgile(descriptor, pkg []byte, password string) ([]byte, error) {
+	var ai agileEncryptionInfo
+	if err := xml.Unmarshal(descriptor, &ai); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptDocument, err)
+	}
+	ek := ai.EncryptedKey
+	if ek.CipherAlgorithm != "AES" || ai.KeyData.CipherAlgorithm != "AES" {
+		return nil, fmt.Errorf("%w (cipher %s)", ErrUnsupportedEncryption, ek.CipherAlgorithm)
+	}
+	if ek.SpinCount < 0 || ek.SpinCount > 10000000 {
+		return nil, ErrCorruptDocument
+	}
+	newH, err := newHash(ek.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	dataHash, err := newHash(ai.KeyData.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	decode := base64.StdEncoding.DecodeString
+	salt, err1 := decode(ek.SaltValue)
+	verifierInput, err2 := decode(ek.EncryptedVerifierHashInput)
+	verifierValue, err3 := decode(ek.EncryptedVerifierHashValue)
+	keyValue, err4 := decode(ek.EncryptedKeyValue)
+	dataSalt, err5 := decode(ai.KeyData.SaltValue)
+	if err := errors.Join(err1, err2, err3, err4, err5); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptDocument, err)
+	}
+
+	// Password hash: H0 = H(salt + password), then spinCount rounds of H(iterator + H).
+	h := hashOf(newH, salt, utf16LE(password))
+	for i := 0; i < ek.SpinCount; i++ {
+		h = hashOf(newH, le32(uint32(i)), h)
+	}
+	keyLen := ek.KeyBits / 8
+	if !validAESKeyLen(keyLen) || !validAESKeyLen(ai.KeyData.KeyBits/8) || ek.BlockSize != aes.BlockSize || ai.KeyData.BlockSize != aes.BlockSize {
+		return nil, ErrCorruptDocument
+	}
+	iv := fitLength(salt, ek.BlockSize, 0x36)
+	deriveKey := func(blockKey []byte) []byte {
+		return fitLength(hashOf(newH, h, blockKey), keyLen, 0x36)
+	}
+
+	// Decryption keeps lengths, so fields too short for what they must hold
+	// are corrupt whatever the password
+	if len(verifierInput) < len(salt) || len(verifierValue) < newH().Size() || len(keyValue) < ai.KeyData.KeyBits/8 {
+		return nil, ErrCorruptDocument
+	}
+	input, err := aesCBCDecrypt(deriveKey(blockKeyVerifierInput), iv, verifierInput)
+	if err != nil {
+		return nil, err
+	}
+	value, err := aesCBCDecrypt(deriveKey(blockKeyVerifierValue), iv, verifierValue)
+	if err != nil {
+		return nil, err
+	}
+	expected := hashOf(newH, input[:len(salt)])
+	if !bytes.Equal(value[:len(expected)], expected) {
+		return nil, ErrWrongPassword
+	}
+	secret, err := aesCBCDecrypt(deriveKey(blockKeyEncryptedKey), iv, keyValue)
+	if err != nil {
+		return nil, err
+	}
+	secret = secret[:ai.KeyData.KeyBits/8]
+
+	// Package is encrypted in 4096-byte segments, each with IV = H(keyDataSalt + segmentIndex).
+	size := binary.LittleEndian.Uint64(pkg[:8])
+	body := pkg[8:]
+	out := make([]byte, 0, len(body))
+	const segmentSize = 4096
+	for i := 0; i*segmentSize < len(body); i++ {
+		end := (i + 1) * segmentSize
+		if end > len(body) {
+			end = len(body)
+		}
+		seg := body[i*segmentSize : end]
+		if rem := len(seg) % aes.BlockSize; rem != 0 {
+			seg = seg[:len(seg)-rem]
+		}
+		segIV := fitLength(hashOf(dataHash, dataSalt, le32(uint32(i))), ai.KeyData.BlockSize, 0x36)
+		dec, err := aesCBCDecrypt(secret, segIV, seg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dec...)
+	}
+	if size > uint64(len(out)) {
+		return nil, ErrCorruptDocument
+	}
+	return out[:size], nil
+}
+
+// decryptStandard implements ECMA-376 Standard encryption (Office 2007, AES-ECB + SHA-1).
+func decryptStandard(info, pkg []byte, password string) ([]byte, error) {
+	if len(info) < 12 {
+		return nil, ErrCorruptDocument
+	}
+	headerSize := int(binary.LittleEndian.Uint32(info[8:12]))
+	if headerSize < 32 || 12+headerSize+4+16+16+4+32 > len(info) {
+		return nil, ErrCorruptDocument
+	}
+	header := info[12 : 12+headerSize]
+	algID := binary.LittleEndian.Uint32(header[8:12])
+	keyBits := int(binary.LittleEndian.Uint32(header[16:20]))
+	if keyBits != 128 && keyBits != 192 && keyBits != 256 {
+		return nil, ErrCorruptDocument
+	}
+	if algID != 0x660E && algID != 0x660F && algID != 0x6610 {
+		return nil, fmt.Errorf("%w (algorithm 0x%x)", ErrUnsupportedEncryption, algID)
+	}
+	v := info[12+headerSize:]
+	saltSize := int(binary.LittleEndian.Uint32(v[0:4]))
+	if saltSize != 16 {
+		return nil, ErrCorruptDocument
+	}
+	salt := v[4:20]
+	encVerifier := v[20:36]
+	encVerifierHash := v[40:72]
+
+	h := hashOf(sha1.New, salt, utf16LE(password))
+	for i := 0; i < 50000; i++ {
+		h = hashOf(sha1.New, le32(uint32(i)), h)
+	}
+	h = hashOf(sha1.New, h, le32(0))
+	buf1 := bytes.Repeat([]byte{0x36}, 64)
+	buf2 := bytes.Repeat([]byte{0x5c}, 64)
+	for i := range h {
+		buf1[i] ^= h[i]
+		buf2[i] ^= h[i]
+	}
+	x := append(hashOf(sha1.New, buf1), hashOf(sha1.New, buf2)...)
+	key := x[:keyBits/8]
+
+	verifier, err := aesECBDecrypt(key, encVerifier)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	verifierHash, err := aesECBDecrypt(key, encVerifierHash)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	if !bytes.Equal(hashOf(sha1.New, verifier), verifierHash[:sha1.Size]) {
+		return nil, ErrWrongPassword
+	}
+
+	size := binary.LittleEndian.Uint64(pkg[:8])
+	body := pkg[8:]
+	if rem := len(body) % aes.BlockSize; rem != 0 {
+		body = body[:len(body)-rem]
+	}
+	out, err := aesECBDecrypt(key, body)
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(len(out)) {
+		return nil, ErrCorruptDocument
+	}
+	return out[:size], nil
+}
+
+// checkLegacyOfficeEncryption detects encryption in legacy OLE2 binary documents.
+// Decryption of these formats (RC4 CryptoAPI / XOR obfuscation) is not supported.
+func checkLegacyOfficeEncryption(data []byte, fileType string) error {
+	if !bytes.HasPrefix(data, ole2Magic) {
+		return ErrCorruptDocument
+	}
+	doc, err := mscfb.New(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptDocument, err)
+	}
+	encrypted := false
+	for {
+		entry, nextErr := doc.Next()
+		if nextErr != nil {
+			break
+		}
+		switch {
+		case entry.Name == "EncryptionInfo" || entry.Name == "EncryptedPackage":
+			// OOXML encrypted container saved with a legacy extension
+			encrypted = true
+		case fileType == "word_legacy" && entry.Name == "WordDocument":
+			fib := make([]byte, 12)
+			if n, _ := io.ReadFull(entry, fib); n == 12 && binary.LittleEndian.Uint16(fib[10:12])&0x0100 != 0 {
+				encrypted = true // FIB fEncrypted
+			}
+		case fileType == "excel_legacy" && (entry.Name == "Workbook" || entry.Name == "Book"):
+			stream, _ := io.ReadAll(io.LimitReader(entry, 1<<20))
+			encrypted = encrypted || xlsHasFilePass(stream)
+		case fileType == "ppt_legacy" && entry.Name == "EncryptedSummary":
+			encrypted = true
+		}
+	}
+	if encrypted {
+		return fmt.Errorf("%w（旧版Office格式的加密文档暂不支持密码解密，请另存为新格式后导入）", ErrPasswordProtected)
+	}
+	return nil
+}
+
+// xlsHasFilePass scans the BIFF globals substream for a FILEPASS record (0x002F).
+func xlsHasFilePass(stream []byte) bool {
+	for pos := 0; pos+4 <= len(stream); {
+		recType := binary.LittleEndian.Uint16(stream[pos:])
+		recLen := int(binary.LittleEndian.Uint16(stream[pos+2:]))
+		switch recType {
+		case 0x002F:
+			return true
+		case 0x000A: // EOF of globals substream
+			return false
+		}
+		pos += 4 + recLen
+	}
+	return false
+}
+
+// rePDFEncrypt matches an /Encrypt reference in a trailer or cross-reference stream dictionary.
+var rePDFEncrypt = regexp.MustCompile(`/Encrypt\s+\d+\s+\d+\s+R`)
+
+// checkPDFEncryption reports whether the PDF needs a user password to be read.
+// PDFs protected only by an owner password (empty user password) open normally.
+func checkPDFEncryption(data []byte) (needsPassword bool, err error) {
+	if !rePDFEncrypt.Match(data) {
+		return false, nil
+	}
+	_, openErr := lpdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if openErr == nil {
+		return false, nil
+	}
+	if errors.Is(openErr, lpdf.ErrInvalidPassword) {
+		return true, nil
+	}
+	return false, fmt.Errorf("%w: %v", ErrUnsupportedEncryption, openErr)
+}
+
+// parseEncryptedPDF extracts text from a user-password-protected PDF.
+// Images are not extracted for encrypted PDFs.
+func (dp *DocumentParser) parseEncryptedPDF(data []byte, password string) (*ParseResult, error) {
+	if password == "" {
+		return nil, ErrPasswordProtected
+	}
+	tried := false
+	reader, err := lpdf.NewReaderEncrypted(bytes.NewReader(data), int64(len(data)), func() string {
+		if tried {
+			return ""
+		}
+		tried = true
+		return password
+	})
+	if err != nil {
+		if errors.Is(err, lpdf.ErrInvalidPassword) {
+			return nil, ErrWrongPassword
+		}
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedEncryption, err)
+	}
+
+	pageCount := reader.NumPage()
+	var sb strings.Builder
+	var pages []PageMark
+	for i := 1; i <= pageCount; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil || text == "" {
+			continue
+		}
+		pages = appendPage(&sb, pages, i, text)
+	}
+	log.Printf("[PDF] decrypted password-protected PDF: %d pages (images skipped)", pageCount)
+
+	return &ParseResult{
+		Text: CleanText(sb.String()),
+		Metadata: map[string]string{
+			"type":        "pdf",
+			"page_count":  fmt.Sprintf("%d", pageCount),
+			"image_count": "0",
+			"encrypted":   "true",
+		},
+		Pages: pages,
+	}, nil
+}
@@ -18,21 +18,46 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"unicode/utf8"
 
 	gopdf "github.com/VantageDataChat/GoPDF2"
 	goexcel "github.com/VantageDataChat/GoExcel"
 	goppt "github.com/VantageDataChat/GoPPT"
 	goword "github.com/VantageDataChat/GoWord"
+
+	"askflow/internal/textutil"
 )
 
 // DocumentParser handles parsing of various document formats.
-type DocumentParser struct{}
+type DocumentParser struct {
+	mu          sync.RWMutex
+	htmlOptions HTMLOptions
+}
 
 // ParseResult holds the extracted text and metadata from a parsed document.
 type ParseResult struct {
 	Text     string            `json:"text"`
 	Metadata map[string]string `json:"metadata"`
 	Images   []ImageRef        `json:"images,omitempty"`
+	Pages    []PageMark        `json:"pages,omitempty"`    // where each page with text starts (PDF)
+	Headings []Heading         `json:"headings,omitempty"` // document headings in order (Markdown, HTML)
+	Table    *Table            `json:"table,omitempty"`    // header and rows of tabular files (CSV)
+}
+
+// PageMark records that page Page (1-based) starts at rune offset Offset of
+// ParseResult.Text. Pages without text have no mark.
+type PageMark struct {
+	Page   int `json:"page"`
+	Offset int `json:"offset"`
+}
+
+// Heading is a section heading and the rune offset of its text in
+// ParseResult.Text.
+type Heading struct {
+	Level  int    `json:"level"`
+	Title  string `json:"title"`
+	Offset int    `json:"offset"`
+	Anchor string `json:"anchor,omitempty"` // fragment linking to the heading (HTML id)
 }
 
 // ImageRef represents an image extracted from a document.
@@ -41,14 +66,36 @@ type ImageRef struct {
 	URL       string `json:"url"`       // external URL or relative path
 	Data      []byte `json:"-"`         // raw image data (for embedded images)
 	SlideText string `json:"slide_text,omitempty"` // per-slide text (for PPT: the text content of this slide)
+	Page      int    `json:"page,omitempty"`       // 1-based page the image is on (for PDF)
 }
 
 // Parse dispatches to the correct parser based on fileType.
 // Supported types: "pdf", "word", "excel", "ppt".
 func (dp *DocumentParser) Parse(fileData []byte, fileType string) (*ParseResult, error) {
-	switch strings.ToLower(fileType) {
+	return dp.ParseWithPassword(fileData, fileType, "")
+}
+
+// ParseWithPassword is like Parse but can open password-protected documents.
+// Encrypted files without a usable password fail with ErrPasswordProtected or
+// ErrWrongPassword so callers can report a dedicated status.
+func (dp *DocumentParser) ParseWithPassword(fileData []byte, fileType string, password string) (*ParseResult, error) {
+	fileType = strings.ToLower(fileType)
+	switch fileType {
+	case "word", "excel", "ppt":
+		data, err := prepareOOXML(fileData, fileType, password)
+		if err != nil {
+			return nil, err
+		}
+		fileData = data
+	case "word_legacy", "excel_legacy", "ppt_legacy":
+		if err := checkLegacyOfficeEncryption(fileData, fileType); err != nil {
+			return nil, err
+		}
+	}
+
+	switch fileType {
 	case "pdf":
-		return dp.parsePDF(fileData)
+		return dp.parsePDF(fileData, password)
 	case "word":
 		return dp.parseWord(fileData)
 	case "word_legacy":
@@ -65,6 +112,10 @@ func (dp *DocumentParser) Parse(fileData []byte, fileType string) (*ParseResult,
 		return dp.parseMarkdown(fileData)
 	case "html":
 		return dp.parseHTML(fileData, "")
+	case "text":
+		return dp.parseText(fileData)
+	case "csv":
+		return dp.parseCSV(fileData)
 	default:
 		return nil, fmt.Errorf("不支持的文件格式: %s", fileType)
 	}
@@ -79,7 +130,7 @@ func (dp *DocumentParser) ParseWithBaseURL(fileData []byte, fileType string, bas
 }
 
 // parsePDF extracts text and images from PDF data using GoPDF2.
-func (dp *DocumentParser) parsePDF(data []byte) (result *ParseResult, err error) {
+func (dp *DocumentParser) parsePDF(data []byte, password string) (result *ParseResult, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			result = nil
@@ -89,7 +140,16 @@ func (dp *DocumentParser) parsePDF(data []byte) (result *ParseResult, err error)
 
 	// Validate PDF magic bytes
 	if len(data) < 5 || string(data[:5]) != "%PDF-" {
-		return nil, fmt.Errorf("pdf解析错误: 不是有效的PDF文件")
+		return nil, fmt.Errorf("pdf解析错误: %w", ErrCorruptDocument)
+	}
+
+	// Password-protected PDFs need the user password; GoPDF2 cannot read them
+	needsPassword, encErr := checkPDFEncryption(data)
+	if encErr != nil {
+		return nil, encErr
+	}
+	if needsPassword {
+		return dp.parseEncryptedPDF(data, password)
 	}
 
 	// Get page count
@@ -98,19 +158,15 @@ func (dp *DocumentParser) parsePDF(data []byte) (result *ParseResult, err error)
 		return nil, fmt.Errorf("pdf解析错误: %w", err)
 	}
 
-	// Extract text page by page
+	// Extract text page by page, recording where each page starts
 	var sb strings.Builder
+	var pages []PageMark
 	for i := 0; i < pageCount; i++ {
 		text, err := gopdf.ExtractPageText(data, i)
 		if err != nil {
 			continue
 		}
-		if text != "" {
-			if sb.Len() > 0 {
-				sb.WriteString("\n\n")
-			}
-			sb.WriteString(text)
-		}
+		pages = appendPage(&sb, pages, i+1, text)
 	}
 
 	// Extract images (best-effort, non-fatal)
@@ -198,6 +254,7 @@ func (dp *DocumentParser) parsePDF(data []byte) (result *ParseResult, err error)
 				images = append(images, ImageRef{
 					Alt:  fmt.Sprintf("PDF第%d页图片%d", pageIdx+1, pageKept),
 					Data: imgData,
+					Page: pageIdx + 1,
 				})
 			}
 		}
@@ -213,9 +270,48 @@ func (dp *DocumentParser) parsePDF(data []byte) (result *ParseResult, err error)
 			"image_count": fmt.Sprintf("%d", len(images)),
 		},
 		Images: images,
+		Pages:  pages,
 	}, nil
 }
 
+// appendPage appends the cleaned text of a page to sb, separated from earlier
+// pages by a blank line, and records where it starts. Pages are cleaned one at
+// a time so that cleaning the joined text again leaves the offsets intact.
+func appendPage(sb *strings.Builder, pages []PageMark, page int, text string) []PageMark {
+	text = CleanText(text)
+	if text == "" {
+		return pages
+	}
+	if sb.Len() > 0 {
+		sb.WriteString("\n\n")
+	}
+	pages = append(pages, PageMark{Page: page, Offset: utf8.RuneCountInString(sb.String())})
+	sb.WriteString(text)
+	return pages
+}
+
+// locateHeadings sets the offset of each heading to the position of its
+// title in text, searching forward from the previous heading. Headings whose
+// title cannot be found are dropped.
+func locateHeadings(text string, headings []Heading) []Heading {
+	var out []Heading
+	from := 0
+	for _, h := range headings {
+		if h.Title == "" {
+			continue
+		}
+		i := strings.Index(text[from:], h.Title)
+		if i < 0 {
+			continue
+		}
+		from += i
+		h.Offset = utf8.RuneCountInString(text[:from])
+		out = append(out, h)
+		from += len(h.Title)
+	}
+	return out
+}
+
 // rawPixelsToJPEG converts raw decompressed pixel data from a PDF image to JPEG.
 // Handles both plain pixel data and PNG-predictor-encoded data (common in FlateDecode
 // streams where the PDF uses Predictor=10..15). PNG predictor adds 1 filter-type byte
@@ -597,11 +693,7 @@ func (dp *DocumentParser) parsePPT(data []byte) (result *ParseResult, err error)
 		text := slideTexts[i]
 		alt := fmt.Sprintf("PPT第%d页", i+1)
 		if text != "" {
-			t := strings.TrimSpace(text)
-			if len(t) > 200 {
-				t = t[:200] + "..."
-			}
-			alt = fmt.Sprintf("PPT第%d页: %s", i+1, t)
+			alt = fmt.Sprintf("PPT第%d页: %s", i+1, textutil.Ellipsize(strings.TrimSpace(text), 200))
 		}
 
 		images = append(images, ImageRef{
@@ -635,6 +727,7 @@ var (
 var (
 	mdImgRe        = regexp.MustCompile(`!\[([^\]]*)\]\(([^)]+)\)`)
 	mdHeadingRe    = regexp.MustCompile(`(?m)^#{1,6}\s+`)
+	mdHeadingLineRe = regexp.MustCompile(`(?m)^(#{1,6})\s+(.+?)\s*#*\s*$`)
 	mdBoldRe       = regexp.MustCompile(`\*\*(.+?)\*\*`)
 	mdUnderBoldRe  = regexp.MustCompile(`__(.+?)__`)
 	mdItalicRe     = regexp.MustCompile(`\*(.+?)\*`)
@@ -646,6 +739,9 @@ var (
 // Pre-compiled regexes for parseHTML.
 var (
 	htmlBaseRe    = regexp.MustCompile(`(?i)<base[^>]+href\s*=\s*["']([^"']+)["']`)
+	htmlHeadingRe = regexp.MustCompile(`(?is)<h([1-6])\b([^>]*)>(.*?)</h[1-6]\s*>`)
+	htmlIDRe      = regexp.MustCompile(`(?i)(?:^|\s)(?:id|name)\s*=\s*["']?([^"'\s>]+)`)
+	htmlAnchorRe  = regexp.MustCompile(`(?i)<a\b([^>]*)>`)
 	htmlImgRe     = regexp.MustCompile(`(?i)<img[^>]*\bsrc\s*=\s*["']([^"']+)["'][^>]*>`)
 	htmlAltRe     = regexp.MustCompile(`(?i)\balt\s*=\s*["']([^"']*)["']`)
 	htmlScriptRe  = regexp.MustCompile(`(?is)<script[^>]*>.*?</script>`)
@@ -892,6 +988,7 @@ func compositeOnePage(imgs []gopdf.ExtractedImage, pageIdx int) *ImageRef {
 	return &ImageRef{
 		Alt:  fmt.Sprintf("PDF第%d页", pageIdx+1),
 		Data: buf.Bytes(),
+		Page: pageIdx + 1,
 	}
 }
 
@@ -936,7 +1033,9 @@ func CleanText(text string) string {
 }
 
 // parseMarkdown extracts plain text from Markdown content.
-// Strips common Markdown syntax while preserving the text structure.
+// Strips common Markdown syntax while preserving the text structure. Fenced
+// code blocks are kept verbatim, fences and language hints included, so
+// commands and config snippets reach the chunks unchanged.
 func (dp *DocumentParser) parseMarkdown(data []byte) (*ParseResult, error) {
 	text := string(data)
 	if strings.TrimSpace(text) == "" {
@@ -952,8 +1051,35 @@ func (dp *DocumentParser) parseMarkdown(data []byte) (*ParseResult, error) {
 		}
 	}
 
+	// Collect headings (with inline markup stripped like the body text),
+	// leaving out comment lines of shell snippets
+	var headings []Heading
+	mapProse(text, func(prose string) string {
+		for _, m := range mdHeadingLineRe.FindAllStringSubmatch(prose, -1) {
+			headings = append(headings, Heading{Level: len(m[1]), Title: stripMarkdownInline(m[2])})
+		}
+		return prose
+	})
+
 	// Strip common markdown syntax for cleaner text
-	text = mdHeadingRe.ReplaceAllString(text, "")
+	text = mapProse(text, func(prose string) string {
+		prose = mdHeadingRe.ReplaceAllString(prose, "")
+		prose = stripMarkdownInline(prose)
+		return multiNewlineRe.ReplaceAllString(prose, "\n\n")
+	})
+	text = strings.TrimSpace(text)
+
+	return &ParseResult{
+		Text:     text,
+		Metadata: map[string]string{"format": "markdown"},
+		Images:   images,
+		Headings: locateHeadings(text, headings),
+	}, nil
+}
+
+// stripMarkdownInline removes inline markdown markup (emphasis, code, links,
+// images) and keeps the text.
+func stripMarkdownInline(text string) string {
 	text = mdBoldRe.ReplaceAllString(text, "$1")
 	text = mdUnderBoldRe.ReplaceAllString(text, "$1")
 	text = mdItalicRe.ReplaceAllString(text, "$1")
@@ -962,20 +1088,14 @@ func (dp *DocumentParser) parseMarkdown(data []byte) (*ParseResult, error) {
 	text = mdLinkRe.ReplaceAllString(text, "$1")
 
 	// Replace image syntax with alt text
-	text = mdImgRe.ReplaceAllString(text, "$1")
-
-	text = multiNewlineRe.ReplaceAllString(text, "\n\n")
-
-	return &ParseResult{
-		Text:     strings.TrimSpace(text),
-		Metadata: map[string]string{"format": "markdown"},
-		Images:   images,
-	}, nil
+	return mdImgRe.ReplaceAllString(text, "$1")
 }
 
 // parseHTML extracts text and images from HTML content.
 // It strips HTML tags while preserving text structure, and collects <img> src URLs.
 // If baseURL is provided, relative image URLs are resolved to absolute URLs.
+// With HTMLOptions.MainContent set, only the main content of the page is kept.
+// <pre> blocks become fenced code blocks with their whitespace kept.
 func (dp *DocumentParser) parseHTML(data []byte, baseURL string) (*ParseResult, error) {
 	html := string(data)
 	if strings.TrimSpace(html) == "" {
@@ -1001,6 +1121,11 @@ func (dp *DocumentParser) parseHTML(data []byte, baseURL string) (*ParseResult,
 		}
 	}
 
+	// Leave out navigation, banners and footers
+	if opts := dp.getHTMLOptions(); opts.MainContent {
+		html = ExtractMainContent(html, siteSelector(opts.Selectors, baseURL))
+	}
+
 	// Extract images from <img> tags before stripping HTML
 	var images []ImageRef
 	for _, m := range htmlImgRe.FindAllStringSubmatch(html, -1) {
@@ -1027,6 +1152,17 @@ func (dp *DocumentParser) parseHTML(data []byte, baseURL string) (*ParseResult,
 		images = append(images, ImageRef{Alt: alt, URL: imgSrc})
 	}
 
+	// Collect headings before the tags are stripped
+	var headings []Heading
+	for _, m := range htmlHeadingRe.FindAllStringSubmatch(html, -1) {
+		title := CleanText(decodeHTMLEntities(htmlTagRe.ReplaceAllString(m[3], "")))
+		headings = append(headings, Heading{
+			Level:  int(m[1][0] - '0'),
+			Title:  strings.ReplaceAll(title, "\n", " "),
+			Anchor: headingAnchor(m[2], m[3]),
+		})
+	}
+
 	// --- Strip HTML to extract text ---
 
 	// Remove <script> and <style> blocks entirely
@@ -1036,6 +1172,9 @@ func (dp *DocumentParser) parseHTML(data []byte, baseURL string) (*ParseResult,
 	// Remove HTML comments
 	html = htmlCommentRe.ReplaceAllString(html, "")
 
+	// Set code blocks aside so tag stripping and cleanup leave them intact
+	html, codeBlocks := extractPreBlocks(html)
+
 	// Replace block-level tags with newlines for structure preservation
 	for _, tag := range blockTags {
 		html = blockOpenRe[tag].ReplaceAllString(html, "\n")
@@ -1054,7 +1193,7 @@ func (dp *DocumentParser) parseHTML(data []byte, baseURL string) (*ParseResult,
 	// Decode common HTML entities
 	html = decodeHTMLEntities(html)
 
-	text := CleanText(html)
+	text := restorePreBlocks(CleanText(html), codeBlocks)
 	if text == "" && len(images) == 0 {
 		return nil, fmt.Errorf("HTML文件内容为空")
 	}
@@ -1065,10 +1204,25 @@ func (dp *DocumentParser) parseHTML(data []byte, baseURL string) (*ParseResult,
 			"type":        "html",
 			"image_count": fmt.Sprintf("%d", len(images)),
 		},
-		Images: images,
+		Images:   images,
+		Headings: locateHeadings(text, headings),
 	}, nil
 }
 
+// headingAnchor returns the fragment that links to an HTML heading: its id,
+// or the id or name of an anchor inside it.
+func headingAnchor(attrs, inner string) string {
+	if m := htmlIDRe.FindStringSubmatch(attrs); m != nil {
+		return decodeHTMLEntities(m[1])
+	}
+	for _, a := range htmlAnchorRe.FindAllStringSubmatch(inner, -1) {
+		if m := htmlIDRe.FindStringSubmatch(a[1]); m != nil {
+			return decodeHTMLEntities(m[1])
+		}
+	}
+	return ""
+}
+
 // resolveURL resolves a potentially relative URL against a base URL.
 // Returns the original src if base is nil or resolution fails.
 func resolveURL(src string, base *url.URL) string {
@@ -0,0 +1,475 @@
+package parser
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// HTMLOptions controls the main content extraction of parseHTML.
+type HTMLOptions struct {
+	MainContent bool              // keep only the main content of pages
+	Selectors   map[string]string // CSS selector of the main content per host
+}
+
+// SetHTMLOptions sets how HTML pages are reduced to their main content.
+func (dp *DocumentParser) SetHTMLOptions(opts HTMLOptions) {
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	dp.htmlOptions = opts
+}
+
+func (dp *DocumentParser) getHTMLOptions() HTMLOptions {
+	dp.mu.RLock()
+	defer dp.mu.RUnlock()
+	return dp.htmlOptions
+}
+
+// siteSelector returns the configured selector for the host of pageURL, the
+// most specific host entry winning.
+func siteSelector(selectors map[string]string, pageURL string) string {
+	if len(selectors) == 0 || pageURL == "" {
+		return ""
+	}
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	for host != "" {
+		if sel, ok := selectors[host]; ok {
+			return sel
+		}
+		_, rest, ok := strings.Cut(host, ".")
+		if !ok {
+			break
+		}
+		host = rest
+	}
+	return ""
+}
+
+// Pre-compiled regexes for main content extraction.
+var (
+	htmlTokenRe = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9-]*)\b([^>]*)>`)
+	htmlAttrRe  = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+)))?`)
+	// Class and id words of page chrome rather than content
+	htmlBoilerplateRe = regexp.MustCompile(`(?i)cookie|consent|gdpr|banner|breadcrumb|sidebar|side-bar|menu|navbar|\bnav\b|navigation|masthead|footer|\bheader\b|comment|share|social|advert|\bads?\b|sponsor|promo|popup|modal|newsletter|subscribe|related|pagination|pager|toolbar|skip-link|\btoc\b`)
+	// Class and id words that mark content even when chrome words also match
+	htmlContentRe = regexp.MustCompile(`(?i)article|content|\bmain\b|\bbody\b|entry|markdown|prose`)
+	htmlHiddenRe  = regexp.MustCompile(`(?i)display\s*:\s*none|visibility\s*:\s*hidden`)
+)
+
+// Elements that never contain page content.
+var htmlBoilerplateTags = map[string]bool{
+	"head": true, "nav": true, "aside": true, "form": true, "noscript": true, "iframe": true,
+	"button": true, "select": true, "svg": true, "dialog": true, "template": true,
+}
+
+// Landmark roles of page chrome.
+var htmlBoilerplateRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "complementary": true,
+	"search": true, "dialog": true, "alertdialog": true, "menu": true, "menubar": true,
+}
+
+// Elements without content or closing tag.
+var htmlVoidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// Elements whose text counts as a paragraph when scoring content.
+var htmlParagraphTags = map[string]bool{
+	"p": true, "pre": true, "td": true, "blockquote": true, "li": true, "dd": true,
+	"div": true, "section": true,
+}
+
+// htmlNode is an element of a page, located by byte offsets into the page.
+type htmlNode struct {
+	tag                  string
+	attrs                map[string]string
+	start, end           int // outer HTML: from the open tag to after the close tag
+	innerStart, innerEnd int
+	parent               *htmlNode
+	children             []*htmlNode
+
+	ownText  int  // runes of text directly inside the element
+	commas   int  // commas and full stops in that text
+	text     int  // runes of text inside the element, boilerplate excluded
+	linkText int  // runes of that text inside links
+	removed  bool // page chrome
+	score    float64
+}
+
+// parseHTMLTree builds the element tree of page. Unclosed elements end where
+// their parent does.
+func parseHTMLTree(page string) *htmlNode {
+	root := &htmlNode{tag: "#root", end: len(page), innerEnd: len(page)}
+	stack := []*htmlNode{root}
+	last := 0
+	addText := func(s string) {
+		n := stack[len(stack)-1]
+		s = strings.TrimSpace(decodeHTMLEntities(s))
+		n.ownText += utf8.RuneCountInString(s)
+		n.commas += strings.Count(s, ",") + strings.Count(s, "，") + strings.Count(s, "。")
+	}
+	for _, m := range htmlTokenRe.FindAllStringSubmatchIndex(page, -1) {
+		addText(page[last:m[0]])
+		last = m[1]
+		closing := m[3] > m[2]
+		tag := strings.ToLower(page[m[4]:m[5]])
+		if closing {
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].tag != tag {
+					continue
+				}
+				stack[i].innerEnd, stack[i].end = m[0], m[1]
+				// Elements left open inside end with the closed one
+				for _, n := range stack[i+1:] {
+					n.innerEnd, n.end = m[0], m[0]
+				}
+				stack = stack[:i]
+				break
+			}
+			continue
+		}
+		attrText := page[m[6]:m[7]]
+		n := &htmlNode{tag: tag, attrs: parseHTMLAttrs(attrText), start: m[0], end: m[1], innerStart: m[1], innerEnd: m[1]}
+		n.parent = stack[len(stack)-1]
+		n.parent.children = append(n.parent.children, n)
+		if !htmlVoidTags[tag] && !strings.HasSuffix(strings.TrimSpace(attrText), "/") {
+			stack = append(stack, n)
+		}
+	}
+	addText(page[last:])
+	for _, n := range stack[1:] {
+		n.innerEnd, n.end = len(page), len(page)
+	}
+	return root
+}
+
+func parseHTMLAttrs(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range htmlAttrRe.FindAllStringSubmatch(s, -1) {
+		name := strings.ToLower(m[1])
+		if _, ok := attrs[name]; !ok {
+			attrs[name] = m[2] + m[3] + m[4]
+		}
+	}
+	return attrs
+}
+
+// walk calls fn for n and its descendants, skipping the descendants of
+// nodes for which fn returns false.
+func (n *htmlNode) walk(fn func(*htmlNode) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, c := range n.children {
+		c.walk(fn)
+	}
+}
+
+// hasAncestor reports whether an ancestor of n has one of tags.
+func (n *htmlNode) hasAncestor(tags ...string) bool {
+	for p := n.parent; p != nil; p = p.parent {
+		for _, t := range tags {
+			if p.tag == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isBoilerplate reports whether n is page chrome: navigation, banners,
+// footers, hidden elements and the like.
+func (n *htmlNode) isBoilerplate() bool {
+	switch n.tag {
+	case "html", "body", "main", "article", "#root":
+		return false
+	case "header", "footer":
+		// The header of an article holds its title
+		return !n.hasAncestor("article", "main")
+	}
+	if htmlBoilerplateTags[n.tag] || htmlBoilerplateRoles[strings.ToLower(n.attrs["role"])] {
+		return true
+	}
+	if _, ok := n.attrs["hidden"]; ok || n.attrs["aria-hidden"] == "true" || htmlHiddenRe.MatchString(n.attrs["style"]) {
+		return true
+	}
+	names := n.attrs["id"] + " " + n.attrs["class"]
+	return htmlBoilerplateRe.MatchString(names) && !htmlContentRe.MatchString(names)
+}
+
+// measure marks the page chrome under n and totals the text of n.
+func (n *htmlNode) measure(inLink bool) {
+	n.text = n.ownText
+	if inLink || n.tag == "a" {
+		n.linkText = n.ownText
+	}
+	for _, c := range n.children {
+		if c.isBoilerplate() {
+			c.removed = true
+			continue
+		}
+		c.measure(inLink || n.tag == "a")
+		n.text += c.text
+		n.linkText += c.linkText
+	}
+}
+
+func (n *htmlNode) linkDensity() float64 {
+	if n.text == 0 {
+		return 0
+	}
+	return float64(n.linkText) / float64(n.text)
+}
+
+// ExtractMainContent returns the main content of an HTML page with page
+// chrome removed. selector, if set, picks the content explicitly; otherwise
+// the <main> element or the best scoring container is used, in the manner of
+// readability. The page is returned unchanged when no content is found.
+func ExtractMainContent(page, selector string) string {
+	page = htmlScriptRe.ReplaceAllString(page, "")
+	page = htmlStyleRe.ReplaceAllString(page, "")
+	page = htmlCommentRe.ReplaceAllString(page, "")
+	root := parseHTMLTree(page)
+	root.measure(false)
+
+	if selector != "" {
+		if nodes := selectHTMLNodes(root, selector); len(nodes) > 0 {
+			var b strings.Builder
+			for _, n := range nodes {
+				b.WriteString(renderHTMLNode(page, n, false))
+				b.WriteString("\n")
+			}
+			return b.String()
+		}
+	}
+
+	content := findMainContent(root)
+	if content == nil || content.text < 100 {
+		body := root
+		root.walk(func(n *htmlNode) bool {
+			if n.tag == "body" {
+				body = n
+				return false
+			}
+			return body == root
+		})
+		if body.text == 0 {
+			return page
+		}
+		return renderHTMLNode(page, body, true)
+	}
+
+	out := renderHTMLNode(page, content, true)
+	// Keep the page title when the content starts below it
+	hasH1 := false
+	content.walk(func(n *htmlNode) bool {
+		hasH1 = hasH1 || n.tag == "h1"
+		return !hasH1
+	})
+	if !hasH1 {
+		var h1 *htmlNode
+		root.walk(func(n *htmlNode) bool {
+			if n.removed {
+				return false
+			}
+			if n.tag == "h1" && h1 == nil {
+				h1 = n
+			}
+			return h1 == nil
+		})
+		if h1 != nil && (h1.end <= content.start || h1.start >= content.end) {
+			out = page[h1.start:h1.end] + "\n" + out
+		}
+	}
+	return out
+}
+
+// findMainContent returns the element holding the main content of the page.
+func findMainContent(root *htmlNode) *htmlNode {
+	var main *htmlNode
+	var articles []*htmlNode
+	root.walk(func(n *htmlNode) bool {
+		if n.removed {
+			return false
+		}
+		if main == nil && (n.tag == "main" || strings.EqualFold(n.attrs["role"], "main")) {
+			main = n
+		}
+		if n.tag == "article" {
+			articles = append(articles, n)
+			return false
+		}
+		return true
+	})
+	// Use the page's own markup when it covers most of the text
+	if main != nil && main.text*2 >= root.text {
+		return main
+	}
+	if len(articles) == 1 && articles[0].text*2 >= root.text {
+		return articles[0]
+	}
+
+	// Score containers by the paragraphs they hold: a paragraph counts fully
+	// for its parent and half for its grandparent.
+	var candidates []*htmlNode
+	root.walk(func(n *htmlNode) bool {
+		if n.removed {
+			return false
+		}
+		if !htmlParagraphTags[n.tag] || n.ownText < 25 {
+			return true
+		}
+		score := 1 + float64(n.commas) + min(float64(n.ownText)/100, 3)
+		for i, p := 0, n.parent; i < 2 && p != nil && p != root; i, p = i+1, p.parent {
+			if p.score == 0 {
+				candidates = append(candidates, p)
+			}
+			p.score += score / float64(i+1)
+		}
+		return true
+	})
+	var best *htmlNode
+	bestScore := 0.0
+	for _, c := range candidates {
+		if s := c.score * (1 - c.linkDensity()); s > bestScore {
+			best, bestScore = c, s
+		}
+	}
+	if best == nil {
+		return main
+	}
+	// Climb to the parent while it is mostly made of the best candidate, so
+	// content split over sibling containers is kept together.
+	for best.parent != nil && best.parent != root && best.parent.tag != "body" &&
+		float64(best.text) >= 0.6*float64(best.parent.text) {
+		best = best.parent
+	}
+	return best
+}
+
+// renderHTMLNode returns the HTML inside n, with page chrome cut out when
+// strip is set.
+func renderHTMLNode(page string, n *htmlNode, strip bool) string {
+	if !strip {
+		return page[n.innerStart:n.innerEnd]
+	}
+	var cuts [][2]int
+	n.walk(func(c *htmlNode) bool {
+		if c.removed {
+			cuts = append(cuts, [2]int{c.start, c.end})
+			return false
+		}
+		return true
+	})
+	sort.Slice(cuts, func(i, j int) bool { return cuts[i][0] < cuts[j][0] })
+	var b strings.Builder
+	pos := n.innerStart
+	for _, c := range cuts {
+		if c[0] < pos {
+			continue
+		}
+		b.WriteString(page[pos:min(c[0], n.innerEnd)])
+		// Keep the cut from joining the text around it
+		b.WriteString("\n")
+		pos = c[1]
+	}
+	if pos < n.innerEnd {
+		b.WriteString(page[pos:n.innerEnd])
+	}
+	return b.String()
+}
+
+// htmlSimpleSelector is one compound selector: tag#id.class.class.
+type htmlSimpleSelector struct {
+	tag     string
+	id      string
+	classes []string
+}
+
+var htmlSelectorPartRe = regexp.MustCompile(`([#.]?)([-_a-zA-Z0-9]+)`)
+
+func parseSimpleSelector(s string) htmlSimpleSelector {
+	var sel htmlSimpleSelector
+	for _, m := range htmlSelectorPartRe.FindAllStringSubmatch(s, -1) {
+		switch m[1] {
+		case "#":
+			sel.id = m[2]
+		case ".":
+			sel.classes = append(sel.classes, m[2])
+		default:
+			sel.tag = strings.ToLower(m[2])
+		}
+	}
+	return sel
+}
+
+func (s htmlSimpleSelector) matches(n *htmlNode) bool {
+	if s.tag != "" && s.tag != "*" && s.tag != n.tag {
+		return false
+	}
+	if s.id != "" && n.attrs["id"] != s.id {
+		return false
+	}
+	classes := strings.Fields(n.attrs["class"])
+	for _, want := range s.classes {
+		found := false
+		for _, c := range classes {
+			if c == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// selectHTMLNodes returns the outermost elements matching a CSS selector
+// list of compound selectors and descendant combinators, in page order.
+func selectHTMLNodes(root *htmlNode, selector string) []*htmlNode {
+	var chains [][]htmlSimpleSelector
+	for _, group := range strings.Split(selector, ",") {
+		var chain []htmlSimpleSelector
+		for _, part := range strings.Fields(strings.ReplaceAll(group, ">", " ")) {
+			chain = append(chain, parseSimpleSelector(part))
+		}
+		if len(chain) > 0 {
+			chains = append(chains, chain)
+		}
+	}
+	var nodes []*htmlNode
+	root.walk(func(n *htmlNode) bool {
+		for _, chain := range chains {
+			if matchesSelectorChain(n, chain) {
+				nodes = append(nodes, n)
+				return false
+			}
+		}
+		return true
+	})
+	return nodes
+}
+
+// matchesSelectorChain reports whether n matches the last selector of chain
+// and its ancestors match the others in order.
+func matchesSelectorChain(n *htmlNode, chain []htmlSimpleSelector) bool {
+	if n.tag == "#root" || !chain[len(chain)-1].matches(n) {
+		return false
+	}
+	i := len(chain) - 2
+	for p := n.parent; p != nil && i >= 0; p = p.parent {
+		if p.tag != "#root" && chain[i].matches(p) {
+			i--
+		}
+	}
+	return i < 0
+}
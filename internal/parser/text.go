@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// TableColumnSeparator separates the cells of a table row in ParseResult.Text.
+const TableColumnSeparator = " | "
+
+// Table is the content of a tabular file such as CSV, kept by row so the
+// chunker can repeat the header in every chunk.
+type Table struct {
+	Header []string   `json:"header"`
+	Rows   [][]string `json:"rows"`
+}
+
+// HeaderLine returns the header as rendered in ParseResult.Text.
+func (t *Table) HeaderLine() string {
+	return strings.Join(t.Header, TableColumnSeparator)
+}
+
+// RowLines returns the rows as rendered in ParseResult.Text, one per line
+// after the header line.
+func (t *Table) RowLines() []string {
+	lines := make([]string, len(t.Rows))
+	for i, row := range t.Rows {
+		lines[i] = strings.Join(row, TableColumnSeparator)
+	}
+	return lines
+}
+
+// decodeText converts plain text to UTF-8. Files with a byte order mark are
+// decoded accordingly; other files that are not valid UTF-8 are taken to be
+// GB18030 (a superset of GBK), the usual encoding of Chinese text files
+// saved on Windows.
+func decodeText(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		data = data[3:]
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		decoded, err := unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder().Bytes(data)
+		if err != nil {
+			return "", fmt.Errorf("UTF-16 解码失败: %w", err)
+		}
+		data = decoded
+	case !utf8.Valid(data):
+		decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(data)
+		if err != nil {
+			return "", fmt.Errorf("文本编码无法识别: %w", err)
+		}
+		data = decoded
+	}
+	return strings.ReplaceAll(string(data), "\r\n", "\n"), nil
+}
+
+// parseText reads a plain text file.
+func (dp *DocumentParser) parseText(data []byte) (*ParseResult, error) {
+	text, err := decodeText(data)
+	if err != nil {
+		return nil, err
+	}
+	text = multiNewlineRe.ReplaceAllString(strings.TrimSpace(text), "\n\n")
+	if text == "" {
+		return nil, fmt.Errorf("文本文件内容为空")
+	}
+	return &ParseResult{
+		Text:     text,
+		Metadata: map[string]string{"format": "text"},
+	}, nil
+}
+
+// parseCSV reads a CSV file into a Table; its first row is the header. The
+// delimiter (comma, semicolon or tab) is detected from the first line. Blank
+// rows are skipped and rows with fewer cells than the header are padded.
+func (dp *DocumentParser) parseCSV(data []byte) (*ParseResult, error) {
+	text, err := decodeText(data)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = detectCSVDelimiter(text)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	table := &Table{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv解析错误: %w", err)
+		}
+		row := make([]string, 0, len(record))
+		empty := true
+		for _, cell := range record {
+			cell = strings.Join(strings.Fields(cell), " ")
+			if cell != "" {
+				empty = false
+			}
+			row = append(row, cell)
+		}
+		if empty {
+			continue
+		}
+		if table.Header == nil {
+			table.Header = row
+			continue
+		}
+		for len(row) < len(table.Header) {
+			row = append(row, "")
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	if table.Header == nil {
+		return nil, fmt.Errorf("CSV文件内容为空")
+	}
+
+	lines := append([]string{table.HeaderLine()}, table.RowLines()...)
+	return &ParseResult{
+		Text:     strings.Join(lines, "\n"),
+		Metadata: map[string]string{"format": "csv", "rows": fmt.Sprintf("%d", len(table.Rows))},
+		Table:    table,
+	}, nil
+}
+
+// detectCSVDelimiter picks the most frequent of comma, semicolon and tab in
+// the first line of text, defaulting to comma.
+func detectCSVDelimiter(text string) rune {
+	first, _, _ := strings.Cut(text, "\n")
+	best, bestCount := ',', strings.Count(first, ",")
+	for _, d := range []rune{';', '\t'} {
+		if n := strings.Count(first, string(d)); n > bestCount {
+			best, bestCount = d, n
+		}
+	}
+	return best
+}
@@ -0,0 +1,214 @@
+package pending
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// MaxBulkAnswers bounds the rows of one bulk answer import.
+const MaxBulkAnswers = 5000
+
+// Outcomes of a bulk answer row.
+const (
+	BulkAnswered = "answered"
+	BulkSkipped  = "skipped" // already answered, e.g. a duplicate row
+	BulkFailed   = "failed"
+)
+
+// BulkAnswer is one row of a bulk answer import.
+type BulkAnswer struct {
+	QuestionID string `json:"question_id"`
+	Answer     string `json:"answer"`
+}
+
+// BulkResult is the outcome of one row of a bulk answer import.
+type BulkResult struct {
+	Row        int    `json:"row"` // 1-based, header excluded
+	QuestionID string `json:"question_id"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ParseBulkAnswers reads question ID → answer pairs from JSON, either an
+// array of {"question_id", "answer"} objects or an object mapping IDs to
+// answers, or from CSV with a header row naming the question_id (or id) and
+// answer columns. name is the file name, used to tell the formats apart
+// along with the content.
+func ParseBulkAnswers(data []byte, name string) ([]BulkAnswer, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	trimmed := bytes.TrimSpace(data)
+	var items []BulkAnswer
+	var err error
+	if strings.HasSuffix(strings.ToLower(name), ".json") || bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")) {
+		items, err = parseBulkJSON(trimmed)
+	} else {
+		items, err = parseBulkCSV(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("文件中没有回答")
+	}
+	if len(items) > MaxBulkAnswers {
+		return nil, fmt.Errorf("回答过多（最多 %d 条）", MaxBulkAnswers)
+	}
+	return items, nil
+}
+
+func parseBulkJSON(data []byte) ([]BulkAnswer, error) {
+	if bytes.HasPrefix(data, []byte("{")) {
+		var m map[string]string
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("JSON 格式错误: %w", err)
+		}
+		ids := make([]string, 0, len(m))
+		for id := range m {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		items := make([]BulkAnswer, len(ids))
+		for i, id := range ids {
+			items[i] = BulkAnswer{QuestionID: id, Answer: m[id]}
+		}
+		return items, nil
+	}
+	var items []BulkAnswer
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("JSON 格式错误: %w", err)
+	}
+	return items, nil
+}
+
+func parseBulkCSV(data []byte) ([]BulkAnswer, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("CSV 格式错误: %w", err)
+	}
+	idCol, answerCol := -1, -1
+	for i, h := range header {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case "question_id", "id":
+			idCol = i
+		case "answer":
+			answerCol = i
+		}
+	}
+	if idCol < 0 || answerCol < 0 {
+		return nil, fmt.Errorf("CSV 首行需包含 question_id 和 answer 列")
+	}
+	var items []BulkAnswer
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CSV 格式错误: %w", err)
+		}
+		var item BulkAnswer
+		if idCol < len(rec) {
+			item.QuestionID = rec[idCol]
+		}
+		if answerCol < len(rec) {
+			item.Answer = rec[answerCol]
+		}
+		items = append(items, item)
+	}
+}
+
+// AnswerBulk answers pending questions one row at a time through
+// AnswerQuestion, so each answer is embedded and stored as knowledge like a
+// manual one. Questions already answered are skipped. onRow, if not nil, is
+// called after each row. It stops when ctx is canceled and returns the
+// results so far with the context's error.
+func (pm *PendingQuestionManager) AnswerBulk(ctx context.Context, items []BulkAnswer, reviewStatus, author string, onRow func(done int, r BulkResult)) ([]BulkResult, error) {
+	results := make([]BulkResult, 0, len(items))
+	for i, item := range items {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		r := BulkResult{Row: i + 1, QuestionID: strings.TrimSpace(item.QuestionID), Status: BulkAnswered}
+		if err := pm.answerBulkRow(r.QuestionID, strings.TrimSpace(item.Answer), reviewStatus, author); err != nil {
+			r.Status, r.Error = BulkFailed, err.Error()
+			if errors.Is(err, errAlreadyAnswered) {
+				r.Status = BulkSkipped
+			}
+		}
+		results = append(results, r)
+		if onRow != nil {
+			onRow(i+1, r)
+		}
+	}
+	return results, nil
+}
+
+var errAlreadyAnswered = errors.New("问题已回答")
+
+func (pm *PendingQuestionManager) answerBulkRow(id, answer, reviewStatus, author string) error {
+	if id == "" {
+		return fmt.Errorf("缺少 question_id")
+	}
+	if answer == "" {
+		return fmt.Errorf("回答为空")
+	}
+	var status string
+	err := pm.db.QueryRow(`SELECT status FROM pending_questions WHERE id = ?`, id).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("查询问题失败: %w", err)
+	}
+	if status == "answered" {
+		return errAlreadyAnswered
+	}
+	return pm.AnswerQuestion(AdminAnswerRequest{QuestionID: id, Text: answer, ReviewStatus: reviewStatus, Author: author})
+}
+
+// RecordBulkResult stores the outcome of a row of the bulk answer job jobID.
+func (pm *PendingQuestionManager) RecordBulkResult(jobID string, r BulkResult) error {
+	_, err := pm.db.Exec(
+		`INSERT OR REPLACE INTO pending_bulk_results (job_id, row, question_id, status, error) VALUES (?, ?, ?, ?, ?)`,
+		jobID, r.Row, r.QuestionID, r.Status, r.Error,
+	)
+	return err
+}
+
+// BulkResults returns the row outcomes recorded for a bulk answer job.
+func (pm *PendingQuestionManager) BulkResults(jobID string) ([]BulkResult, error) {
+	rows, err := pm.db.Query(
+		`SELECT row, question_id, status, COALESCE(error, '') FROM pending_bulk_results WHERE job_id = ? ORDER BY row`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bulk answer results: %w", err)
+	}
+	defer rows.Close()
+	results := []BulkResult{}
+	for rows.Next() {
+		var r BulkResult
+		if err := rows.Scan(&r.Row, &r.QuestionID, &r.Status, &r.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan bulk answer result: %w", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// PruneBulkResults removes the results of bulk answer jobs that are no
+// longer listed.
+func (pm *PendingQuestionManager) PruneBulkResults() {
+	pm.db.Exec(`DELETE FROM pending_bulk_results WHERE job_id NOT IN (SELECT id FROM jobs)`)
+}
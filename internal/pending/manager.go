@@ -3,17 +3,22 @@
 package pending
 
 import (
-	"crypto/rand"
 	"database/sql"
-	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"askflow/internal/chunker"
 	"askflow/internal/embedding"
+	"askflow/internal/idgen"
 	"askflow/internal/llm"
+	"askflow/internal/product"
+	"askflow/internal/textutil"
 	"askflow/internal/vectorstore"
 )
 
@@ -29,8 +34,49 @@ type PendingQuestion struct {
 	ProductID   string    `json:"product_id"`
 	ProductName string    `json:"product_name"`
 	CreatedAt   time.Time `json:"created_at"`
+	// ExternalRef is the ID of the ticket the question was escalated to in an
+	// external system, and ExternalURL its link built from the product's
+	// ticket URL template.
+	ExternalRef   string     `json:"external_ref,omitempty"`
+	ExternalRefAt *time.Time `json:"external_ref_at,omitempty"`
+	ExternalURL   string     `json:"external_url,omitempty"`
+	// Origin is OriginAuto for questions the query engine routed here itself,
+	// empty for questions users submitted. Context holds what the engine
+	// retrieved and MissingSummary the LLM's note on what it lacked.
+	Origin         string         `json:"origin,omitempty"`
+	Context        []ContextChunk `json:"context,omitempty"`
+	MissingSummary string         `json:"missing_summary,omitempty"`
 }
 
+// OriginAuto marks pending questions created by the query engine when it
+// could not answer.
+const OriginAuto = "auto"
+
+// ContextChunk is a retrieved chunk that was not enough to answer a pending
+// question.
+type ContextChunk struct {
+	DocumentID   string  `json:"document_id"`
+	DocumentName string  `json:"document_name"`
+	ChunkIndex   int     `json:"chunk_index"`
+	Score        float64 `json:"score"`
+	Text         string  `json:"text"`
+}
+
+// ExternalRefFilter narrows ListPending by the link of questions to external
+// tickets. The zero value matches all questions.
+type ExternalRefFilter struct {
+	// Has selects questions with (true) or without (false) a ticket, nil both.
+	Has *bool
+	// Ref selects the questions linked to this ticket ID.
+	Ref string
+}
+
+// ErrNotFound is returned when a pending question does not exist.
+var ErrNotFound = errors.New("待处理问题不存在")
+
+// maxExternalRefLen bounds the length of ticket IDs.
+const maxExternalRefLen = 200
+
 
 
 // AdminAnswerRequest represents an admin's answer to a pending question.
@@ -41,6 +87,11 @@ type AdminAnswerRequest struct {
 	URL        string   `json:"url,omitempty"`
 	ImageURLs  []string `json:"image_urls,omitempty"`
 	IsEdit     bool     `json:"is_edit,omitempty"`
+	// ReviewStatus is the review state the answer starts in ("" for live
+	// immediately, "draft" when review is required) and Author the admin
+	// who wrote it. Both are set by the server.
+	ReviewStatus string `json:"-"`
+	Author       string `json:"-"`
 }
 
 // PendingQuestionManager handles the lifecycle of pending questions.
@@ -78,15 +129,6 @@ func (pm *PendingQuestionManager) UpdateServices(es embedding.EmbeddingService,
 	pm.llmService = ls
 }
 
-// generateID creates a random hex string for use as a unique identifier.
-func generateID() (string, error) {
-	b := make([]byte, 16)
-	if _, err := rand.Read(b); err != nil {
-		return "", fmt.Errorf("failed to generate ID: %w", err)
-	}
-	return hex.EncodeToString(b), nil
-}
-
 // CreatePending inserts a new pending question record with status="pending".
 func (pm *PendingQuestionManager) CreatePending(question string, userID string, imageData string, productID string) (*PendingQuestion, error) {
 	// Validate input lengths
@@ -97,7 +139,7 @@ func (pm *PendingQuestionManager) CreatePending(question string, userID string,
 		return nil, fmt.Errorf("image data too large (max 5MB)")
 	}
 
-	id, err := generateID()
+	id, err := idgen.New()
 	if err != nil {
 		return nil, err
 	}
@@ -151,8 +193,9 @@ func (pm *PendingQuestionManager) DeletePending(id string) error {
 // ListPending returns pending questions filtered by status and/or productID,
 // ordered by created_at DESC. When productID is non-empty, only questions matching
 // that product or the public library (empty product_id) are returned.
-// Product names are resolved via LEFT JOIN with the products table.
-func (pm *PendingQuestionManager) ListPending(status string, productID string) ([]PendingQuestion, error) {
+// Product names and ticket URL templates are resolved via LEFT JOIN with the
+// products table.
+func (pm *PendingQuestionManager) ListPending(status string, productID string, ext ExternalRefFilter) ([]PendingQuestion, error) {
 	// Validate status to prevent unexpected values
 	if status != "" && status != "pending" && status != "answered" {
 		return nil, fmt.Errorf("invalid status filter: %s", status)
@@ -161,7 +204,9 @@ func (pm *PendingQuestionManager) ListPending(status string, productID string) (
 	var rows *sql.Rows
 	var err error
 
-	baseSelect := `SELECT pq.id, pq.question, pq.user_id, COALESCE(u.name, '') AS user_name, pq.status, pq.answer, pq.image_data, pq.product_id, COALESCE(p.name, '') AS product_name, pq.created_at
+	baseSelect := `SELECT pq.id, pq.question, pq.user_id, COALESCE(u.name, '') AS user_name, pq.status, pq.answer, pq.image_data, pq.product_id, COALESCE(p.name, '') AS product_name, pq.created_at,
+		COALESCE(pq.external_ref, ''), pq.external_ref_at, COALESCE(p.ticket_url_template, ''),
+		COALESCE(pq.origin, ''), COALESCE(pq.context, ''), COALESCE(pq.missing_summary, '')
 		FROM pending_questions pq
 		LEFT JOIN products p ON pq.product_id = p.id
 		LEFT JOIN users u ON pq.user_id = u.id`
@@ -177,6 +222,17 @@ func (pm *PendingQuestionManager) ListPending(status string, productID string) (
 		conditions = append(conditions, "(pq.product_id = ? OR pq.product_id = '')")
 		args = append(args, productID)
 	}
+	if ext.Has != nil {
+		if *ext.Has {
+			conditions = append(conditions, "COALESCE(pq.external_ref, '') != ''")
+		} else {
+			conditions = append(conditions, "COALESCE(pq.external_ref, '') = ''")
+		}
+	}
+	if ext.Ref != "" {
+		conditions = append(conditions, "pq.external_ref = ?")
+		args = append(args, ext.Ref)
+	}
 
 	query := baseSelect
 	if len(conditions) > 0 {
@@ -200,10 +256,17 @@ func (pm *PendingQuestionManager) ListPending(status string, productID string) (
 		var imageData sql.NullString
 		var userName sql.NullString
 		var productName sql.NullString
-		var createdAt sql.NullTime
-		if err := rows.Scan(&q.ID, &q.Question, &q.UserID, &userName, &q.Status, &answer, &imageData, &q.ProductID, &productName, &createdAt); err != nil {
+		var createdAt, externalRefAt sql.NullTime
+		var ticketURLTemplate, contextJSON string
+		if err := rows.Scan(&q.ID, &q.Question, &q.UserID, &userName, &q.Status, &answer, &imageData, &q.ProductID, &productName, &createdAt,
+			&q.ExternalRef, &externalRefAt, &ticketURLTemplate, &q.Origin, &contextJSON, &q.MissingSummary); err != nil {
 			return nil, fmt.Errorf("failed to scan pending question row: %w", err)
 		}
+		if contextJSON != "" {
+			if err := json.Unmarshal([]byte(contextJSON), &q.Context); err != nil {
+				log.Printf("[Pending] invalid context of question %s: %v", q.ID, err)
+			}
+		}
 		if answer.Valid {
 			q.Answer = answer.String
 		}
@@ -216,6 +279,11 @@ func (pm *PendingQuestionManager) ListPending(status string, productID string) (
 		if createdAt.Valid {
 			q.CreatedAt = createdAt.Time
 		}
+		if externalRefAt.Valid {
+			t := externalRefAt.Time
+			q.ExternalRefAt = &t
+		}
+		q.ExternalURL = product.TicketURL(ticketURLTemplate, q.ExternalRef)
 		if q.ProductID == "" {
 			q.ProductName = "公共库"
 		} else if productName.Valid && productName.String != "" {
@@ -229,6 +297,44 @@ func (pm *PendingQuestionManager) ListPending(status string, productID string) (
 	return questions, nil
 }
 
+// GetQuestion returns the text and product of a pending question.
+func (pm *PendingQuestionManager) GetQuestion(id string) (question, productID string, err error) {
+	err = pm.db.QueryRow(`SELECT question, COALESCE(product_id, '') FROM pending_questions WHERE id = ?`, id).Scan(&question, &productID)
+	if err == sql.ErrNoRows {
+		return "", "", ErrNotFound
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to query pending question: %w", err)
+	}
+	return question, productID, nil
+}
+
+// SetExternalRef links a pending question to the ticket ref in an external
+// system, or clears the link when ref is empty.
+func (pm *PendingQuestionManager) SetExternalRef(id, ref string) error {
+	ref = strings.TrimSpace(ref)
+	if len(ref) > maxExternalRefLen {
+		return fmt.Errorf("工单号过长（最多 %d 个字符）", maxExternalRefLen)
+	}
+	if strings.ContainsFunc(ref, unicode.IsControl) {
+		return fmt.Errorf("工单号包含无效字符")
+	}
+	var res sql.Result
+	var err error
+	if ref == "" {
+		res, err = pm.db.Exec(`UPDATE pending_questions SET external_ref = '', external_ref_at = NULL WHERE id = ?`, id)
+	} else {
+		res, err = pm.db.Exec(`UPDATE pending_questions SET external_ref = ?, external_ref_at = ? WHERE id = ?`, ref, time.Now().UTC(), id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update external ref: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 // AnswerQuestion processes an admin's answer to a pending question:
 // 1. Retrieves the question from DB
 // 2. Stores the answer text in the pending_questions record
@@ -287,7 +393,7 @@ func (pm *PendingQuestionManager) AnswerQuestion(req AdminAnswerRequest) error {
 
 	// Step 3: Chunk the Q&A content → embed → store in vector store
 	docID := "pending-answer-" + req.QuestionID
-	docName := "管理员回答: " + truncate(question, 50)
+	docName := "管理员回答: " + textutil.Ellipsize(question, 50)
 	docCreated := false
 
 	if answerText != "" {
@@ -308,8 +414,8 @@ func (pm *PendingQuestionManager) AnswerQuestion(req AdminAnswerRequest) error {
 
 			// Insert a document record so the chunks FK constraint is satisfied
 			_, err = pm.db.Exec(
-				`INSERT OR REPLACE INTO documents (id, name, type, status, product_id, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
-				docID, docName, "answer", "success", productID, time.Now().UTC(),
+				`INSERT OR REPLACE INTO documents (id, name, type, status, product_id, created_at, review_status, review_author) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				docID, docName, "answer", "success", productID, time.Now().UTC(), req.ReviewStatus, req.Author,
 			)
 			if err != nil {
 				return fmt.Errorf("failed to insert document record for answer: %w", err)
@@ -338,15 +444,15 @@ func (pm *PendingQuestionManager) AnswerQuestion(req AdminAnswerRequest) error {
 	if len(req.ImageURLs) > 0 {
 		if !docCreated {
 			_, err = pm.db.Exec(
-				`INSERT OR REPLACE INTO documents (id, name, type, status, product_id, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
-				docID, docName, "answer", "success", productID, time.Now().UTC(),
+				`INSERT OR REPLACE INTO documents (id, name, type, status, product_id, created_at, review_status, review_author) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				docID, docName, "answer", "success", productID, time.Now().UTC(), req.ReviewStatus, req.Author,
 			)
 			if err != nil {
 				return fmt.Errorf("failed to insert document record for answer images: %w", err)
 			}
 		}
 
-		imgText := fmt.Sprintf("[图片回答: %s] %s", truncate(question, 50), answerText)
+		imgText := fmt.Sprintf("[图片回答: %s] %s", textutil.Ellipsize(question, 50), answerText)
 		// Embed the text once and reuse the vector for all images (same text → same embedding)
 		imgVec, embErr := pm.embeddingService.Embed(imgText)
 		if embErr != nil {
@@ -360,7 +466,7 @@ func (pm *PendingQuestionManager) AnswerQuestion(req AdminAnswerRequest) error {
 				vecCopy := make([]float64, len(imgVec))
 				copy(vecCopy, imgVec)
 				imgChunk := []vectorstore.VectorChunk{{
-					ChunkText:    fmt.Sprintf("[图片回答: %s]", truncate(question, 50)),
+					ChunkText:    fmt.Sprintf("[图片回答: %s]", textutil.Ellipsize(question, 50)),
 					ChunkIndex:   1000 + i,
 					DocumentID:   docID,
 					DocumentName: docName,
@@ -397,12 +503,3 @@ func (pm *PendingQuestionManager) AnswerQuestion(req AdminAnswerRequest) error {
 
 	return nil
 }
-
-// truncate shortens a string to maxLen characters, appending "..." if truncated.
-func truncate(s string, maxLen int) string {
-	runes := []rune(s)
-	if len(runes) <= maxLen {
-		return s
-	}
-	return string(runes[:maxLen]) + "..."
-}
@@ -0,0 +1,126 @@
+// Package periodic runs a background job, such as database maintenance or a
+// data export, one run at a time: on demand from the admin panel or from a
+// scheduler that checks every minute whether a run is due.
+package periodic
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// Tick is how often the scheduler checks whether a run is due.
+	Tick = time.Minute
+	// KeepRuns is the number of run records kept for the admin panel.
+	KeepRuns = 100
+)
+
+// Runner tracks the run in progress and the scheduler of one job.
+type Runner struct {
+	name string // log prefix, e.g. "Export"
+	busy error  // returned while a run is in progress
+
+	mu      sync.Mutex
+	running bool
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New creates a Runner for the job name; busy is returned by Do and Go
+// while a run is in progress.
+func New(name string, busy error) *Runner {
+	return &Runner{name: name, busy: busy}
+}
+
+// Start launches the scheduler, which calls tick every Tick until Stop.
+// tick decides whether a run is due and starts it with Do.
+func (r *Runner) Start(tick func(now time.Time)) {
+	r.stopCh = make(chan struct{})
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("[%s] panic in scheduler goroutine: %v", r.name, p)
+			}
+		}()
+		ticker := time.NewTicker(Tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stopCh:
+				return
+			case now := <-ticker.C:
+				tick(now)
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler and waits for a run in progress to finish.
+func (r *Runner) Stop() {
+	if r.stopCh != nil {
+		select {
+		case <-r.stopCh:
+		default:
+			close(r.stopCh)
+		}
+	}
+	r.wg.Wait()
+}
+
+// Running reports whether a run is in progress.
+func (r *Runner) Running() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.running
+}
+
+// acquire marks a run as in progress, or returns the busy error.
+func (r *Runner) acquire() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running {
+		return r.busy
+	}
+	r.running = true
+	return nil
+}
+
+func (r *Runner) release() {
+	r.mu.Lock()
+	r.running = false
+	r.mu.Unlock()
+}
+
+// Do runs fn and waits for it, or returns the busy error without running
+// it if another run is in progress.
+func (r *Runner) Do(fn func()) error {
+	if err := r.acquire(); err != nil {
+		return err
+	}
+	defer r.release()
+	fn()
+	return nil
+}
+
+// Go runs fn in the background, or returns the busy error without running
+// it if another run is in progress. Stop waits for fn to return.
+func (r *Runner) Go(fn func()) error {
+	if err := r.acquire(); err != nil {
+		return err
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer r.release()
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("[%s] panic in run: %v", r.name, p)
+			}
+		}()
+		fn()
+	}()
+	return nil
+}
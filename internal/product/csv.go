@@ -0,0 +1,361 @@
+package product
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CSVColumns are the columns of a product CSV, in export order. Imports
+// need the name column; the others are optional.
+var CSVColumns = []string{
+	"external_id", "name", "type", "description", "welcome_message",
+	"allow_download", "explain_sources", "allow_share", "isolated_storage",
+	"ocr_language", "ticket_url_template",
+}
+
+// maxImportRows limits the size of a CSV import.
+const maxImportRows = 5000
+
+// Actions of an ImportRow.
+const (
+	ImportCreate    = "create"
+	ImportUpdate    = "update"
+	ImportUnchanged = "unchanged"
+	ImportInvalid   = "invalid"
+)
+
+// ImportRow is the outcome of one CSV data row.
+type ImportRow struct {
+	Line      int    `json:"line"` // line number in the file, the header being line 1
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+	ProductID string `json:"product_id,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// ImportResult summarizes a CSV import. When Invalid is not zero nothing
+// was written.
+type ImportResult struct {
+	DryRun    bool        `json:"dry_run"`
+	Created   int         `json:"created"`
+	Updated   int         `json:"updated"`
+	Unchanged int         `json:"unchanged"`
+	Invalid   int         `json:"invalid"`
+	Rows      []ImportRow `json:"rows"`
+}
+
+// ExportCSV writes all products as CSV, with a CSVColumns header.
+func (s *ProductService) ExportCSV(w io.Writer) error {
+	products, err := s.List()
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CSVColumns); err != nil {
+		return err
+	}
+	for _, p := range products {
+		if err := cw.Write([]string{
+			p.ExternalID, p.Name, p.Type, p.Description, p.WelcomeMessage,
+			strconv.FormatBool(p.AllowDownload), strconv.FormatBool(p.ExplainSources),
+			strconv.FormatBool(p.AllowShare), strconv.FormatBool(p.IsolatedStorage),
+			p.OCRLanguage, p.TicketURLTemplate,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// plannedRow is a validated CSV row and the product it results in.
+type plannedRow struct {
+	row      ImportRow
+	existing *Product // nil when the row creates a product
+	want     Product
+}
+
+// ImportCSV creates or updates products from CSV rows, so that importing the
+// same file again changes nothing. A row updates the product with its
+// external_id, or else the product with its name, and creates a product when
+// there is none. Columns missing from the file keep their current values;
+// present columns are applied as they are, so an empty cell clears a field.
+// All rows are validated before anything is written, and no row is written
+// if any is invalid or dryRun is set.
+func (s *ProductService) ImportCSV(r io.Reader, dryRun bool) (*ImportResult, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV 文件为空")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("CSV 格式错误: %w", err)
+	}
+	cols, err := parseCSVHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Product, len(existing))
+	byExternalID := make(map[string]*Product)
+	for i := range existing {
+		p := &existing[i]
+		byName[p.Name] = p
+		if p.ExternalID != "" {
+			byExternalID[p.ExternalID] = p
+		}
+	}
+
+	result := &ImportResult{DryRun: dryRun, Rows: []ImportRow{}}
+	var plan []plannedRow
+	seenNames := make(map[string]int)
+	seenExternalIDs := make(map[string]int)
+	seenProducts := make(map[string]int)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CSV 格式错误: %w", err)
+		}
+		if len(plan) >= maxImportRows {
+			return nil, fmt.Errorf("CSV 最多 %d 行", maxImportRows)
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(col string) (string, bool) {
+			i, ok := cols[col]
+			if !ok {
+				return "", false
+			}
+			return record[i], true
+		}
+		pr := s.planRow(get, byName, byExternalID)
+		pr.row.Line = line
+		if pr.row.Action != ImportInvalid {
+			if prev, dup := seenNames[pr.want.Name]; dup {
+				pr.row.Action, pr.row.Message = ImportInvalid, fmt.Sprintf("名称与第 %d 行重复", prev)
+			} else if prev, dup := seenExternalIDs[pr.want.ExternalID]; dup && pr.want.ExternalID != "" {
+				pr.row.Action, pr.row.Message = ImportInvalid, fmt.Sprintf("external_id 与第 %d 行重复", prev)
+			} else if prev, dup := seenProducts[pr.row.ProductID]; dup && pr.row.ProductID != "" {
+				pr.row.Action, pr.row.Message = ImportInvalid, fmt.Sprintf("与第 %d 行对应同一个产品", prev)
+			}
+			seenNames[pr.want.Name] = line
+			if pr.want.ExternalID != "" {
+				seenExternalIDs[pr.want.ExternalID] = line
+			}
+			if pr.row.ProductID != "" {
+				seenProducts[pr.row.ProductID] = line
+			}
+		}
+		plan = append(plan, pr)
+	}
+
+	for _, pr := range plan {
+		switch pr.row.Action {
+		case ImportCreate:
+			result.Created++
+		case ImportUpdate:
+			result.Updated++
+		case ImportUnchanged:
+			result.Unchanged++
+		case ImportInvalid:
+			result.Invalid++
+		}
+		result.Rows = append(result.Rows, pr.row)
+	}
+	if dryRun || result.Invalid > 0 {
+		return result, nil
+	}
+
+	for i, pr := range plan {
+		if err := s.applyRow(&pr); err != nil {
+			result.Rows[i].Action = ImportInvalid
+			result.Rows[i].Message = err.Error()
+			return result, fmt.Errorf("第 %d 行导入失败，之前的行已导入: %w", pr.row.Line, err)
+		}
+		result.Rows[i].ProductID = pr.row.ProductID
+	}
+	return result, nil
+}
+
+// parseCSVHeader maps the column names of a CSV header to their positions.
+func parseCSVHeader(header []string) (map[string]int, error) {
+	known := make(map[string]bool, len(CSVColumns))
+	for _, c := range CSVColumns {
+		known[c] = true
+	}
+	cols := make(map[string]int, len(header))
+	for i, h := range header {
+		if i == 0 {
+			// Spreadsheet tools prepend a byte order mark to UTF-8 files
+			h = strings.TrimPrefix(h, "\ufeff")
+		}
+		h = strings.ToLower(strings.TrimSpace(h))
+		if !known[h] {
+			return nil, fmt.Errorf("未知的列: %s", h)
+		}
+		if _, dup := cols[h]; dup {
+			return nil, fmt.Errorf("重复的列: %s", h)
+		}
+		cols[h] = i
+	}
+	if _, ok := cols["name"]; !ok {
+		return nil, errors.New("CSV 缺少 name 列")
+	}
+	return cols, nil
+}
+
+// planRow validates a CSV row and works out what importing it does. get
+// returns a cell and whether its column is present.
+func (s *ProductService) planRow(get func(col string) (string, bool), byName, byExternalID map[string]*Product) plannedRow {
+	var pr plannedRow
+	name, _ := get("name")
+	name = strings.TrimSpace(name)
+	externalID, hasExternalID := get("external_id")
+	externalID = strings.TrimSpace(externalID)
+	pr.row.Name = name
+	invalid := func(msg string) plannedRow {
+		pr.row.Action, pr.row.Message = ImportInvalid, msg
+		return pr
+	}
+
+	if externalID != "" {
+		pr.existing = byExternalID[externalID]
+	}
+	if pr.existing == nil {
+		pr.existing = byName[name]
+		if pr.existing != nil && externalID != "" && pr.existing.ExternalID != "" {
+			return invalid(fmt.Sprintf("名称已被 external_id 为 %s 的产品使用", pr.existing.ExternalID))
+		}
+	}
+	if pr.existing != nil {
+		pr.want = *pr.existing
+	} else {
+		pr.want.Type = ProductTypeService
+	}
+
+	pr.want.Name = name
+	if hasExternalID {
+		pr.want.ExternalID = externalID
+	}
+	if v, ok := get("type"); ok {
+		switch t := strings.TrimSpace(v); t {
+		case "":
+			pr.want.Type = ProductTypeService
+		case ProductTypeService, ProductTypeKnowledgeBase:
+			pr.want.Type = t
+		default:
+			return invalid(fmt.Sprintf("未知的产品类型: %s", t))
+		}
+	}
+	if v, ok := get("description"); ok {
+		pr.want.Description = v
+	}
+	if v, ok := get("welcome_message"); ok {
+		pr.want.WelcomeMessage = v
+	}
+	if v, ok := get("ocr_language"); ok {
+		pr.want.OCRLanguage = strings.TrimSpace(v)
+	}
+	if v, ok := get("ticket_url_template"); ok {
+		pr.want.TicketURLTemplate = strings.TrimSpace(v)
+	}
+	flags := []struct {
+		col string
+		dst *bool
+	}{
+		{"allow_download", &pr.want.AllowDownload},
+		{"explain_sources", &pr.want.ExplainSources},
+		{"allow_share", &pr.want.AllowShare},
+		{"isolated_storage", &pr.want.IsolatedStorage},
+	}
+	for _, f := range flags {
+		v, ok := get(f.col)
+		if !ok {
+			continue
+		}
+		b, err := parseCSVBool(v)
+		if err != nil {
+			return invalid(fmt.Sprintf("%s 的值无效: %s", f.col, v))
+		}
+		*f.dst = b
+	}
+
+	if err := validateFields(pr.want.Name, pr.want.Description, pr.want.WelcomeMessage, pr.want.OCRLanguage, pr.want.TicketURLTemplate); err != nil {
+		return invalid(err.Error())
+	}
+	if other := byName[pr.want.Name]; other != nil && (pr.existing == nil || other.ID != pr.existing.ID) {
+		return invalid("product name already exists")
+	}
+
+	switch {
+	case pr.existing == nil:
+		if pr.want.IsolatedStorage && s.storage == nil {
+			return invalid("isolated storage is not available")
+		}
+		pr.row.Action = ImportCreate
+	case pr.want.IsolatedStorage != pr.existing.IsolatedStorage:
+		return invalid("isolated_storage 仅可在创建产品时设置")
+	case pr.want == *pr.existing:
+		pr.row.Action = ImportUnchanged
+	default:
+		pr.row.Action = ImportUpdate
+	}
+	if pr.existing != nil {
+		pr.row.ProductID = pr.existing.ID
+	}
+	return pr
+}
+
+// applyRow writes a planned row and sets pr.row.ProductID.
+func (s *ProductService) applyRow(pr *plannedRow) error {
+	w := pr.want
+	switch pr.row.Action {
+	case ImportCreate:
+		p, err := s.Create(Input{
+			Name: w.Name, Type: w.Type, Description: w.Description, WelcomeMessage: w.WelcomeMessage,
+			AllowDownload: w.AllowDownload, ExplainSources: w.ExplainSources, AllowShare: w.AllowShare,
+			IsolatedStorage: w.IsolatedStorage, OCRLanguage: w.OCRLanguage, TicketURLTemplate: w.TicketURLTemplate,
+		})
+		if err != nil {
+			return err
+		}
+		pr.row.ProductID = p.ID
+	case ImportUpdate:
+		if _, err := s.Update(pr.existing.ID, Patch{
+			Name: &w.Name, Type: &w.Type, Description: &w.Description, WelcomeMessage: &w.WelcomeMessage,
+			AllowDownload: &w.AllowDownload, ExplainSources: &w.ExplainSources, AllowShare: &w.AllowShare,
+			OCRLanguage: &w.OCRLanguage, TicketURLTemplate: &w.TicketURLTemplate,
+		}); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	if pr.existing == nil || w.ExternalID != pr.existing.ExternalID {
+		if _, err := s.writeDB.Exec("UPDATE products SET external_id = ? WHERE id = ?", w.ExternalID, pr.row.ProductID); err != nil {
+			return fmt.Errorf("failed to set external ID: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseCSVBool parses a flag cell; an empty cell is false.
+func parseCSVBool(v string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", "0", "false", "no", "n", "否":
+		return false, nil
+	case "1", "true", "yes", "y", "是":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", v)
+}
@@ -2,25 +2,46 @@
 package product
 
 import (
-	"crypto/rand"
 	"database/sql"
-	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
+
+	"askflow/internal/config"
+	"askflow/internal/idgen"
 )
 
 // Product represents a product entity in the system.
 // Type can be "service" (产品服务, requires intent classification) or "knowledge_base" (知识库, no intent filtering).
 type Product struct {
-	ID             string    `json:"id"`
-	Name           string    `json:"name"`
-	Type           string    `json:"type"`
-	Description    string    `json:"description"`
-	WelcomeMessage string    `json:"welcome_message"`
-	AllowDownload  bool      `json:"allow_download"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	Description    string `json:"description"`
+	WelcomeMessage string `json:"welcome_message"`
+	AllowDownload  bool   `json:"allow_download"`
+	ExplainSources bool   `json:"explain_sources"` // 为每条引用生成"为何引用"说明
+	AllowShare     bool   `json:"allow_share"`     // 允许用户为回答生成分享链接
+	OCRLanguage    string `json:"ocr_language"`    // OCR 提示语言，空表示使用全局设置
+	// IsolatedStorage 表示产品的知识分块保存在独立的 SQLite 文件中，仅可在创建时设置
+	IsolatedStorage bool `json:"isolated_storage"`
+	// TicketURLTemplate 是外部工单系统的链接模板，{ref} 替换为待处理问题关联的工单号
+	TicketURLTemplate string `json:"ticket_url_template,omitempty"`
+	// ExternalID 是产品在外部目录中的标识，CSV 导入时用于匹配已有产品
+	ExternalID string `json:"external_id,omitempty"`
+	// ArchivedAt 非空表示产品已归档：对终端用户隐藏、不再接受新内容，数据保留供管理员查询
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	// KeyframeOverrides 覆盖全局视频关键帧提取设置，nil 表示使用全局设置
+	KeyframeOverrides *config.KeyframeOverrides `json:"keyframe_overrides,omitempty"`
+	// IntentSettings 控制意图分类（禁用、自定义类别、分类模型），nil 表示默认行为
+	IntentSettings *config.IntentSettings `json:"intent_settings,omitempty"`
+	// Disclaimer 追加在每条回答之后（如"不构成法律意见"），nil 表示不追加
+	Disclaimer *config.AnswerDisclaimer `json:"disclaimer,omitempty"`
+	CreatedAt  time.Time                `json:"created_at"`
+	UpdatedAt  time.Time                `json:"updated_at"`
 }
 
 const (
@@ -28,11 +49,128 @@ const (
 	ProductTypeKnowledgeBase = "knowledge_base"
 )
 
+// productColumns is the column list shared by all product SELECT queries; keep in sync with scanProduct.
+const productColumns = "id, name, COALESCE(type, 'service'), description, welcome_message, COALESCE(allow_download, 0), COALESCE(explain_sources, 0), COALESCE(allow_share, 0), COALESCE(isolated_storage, 0), COALESCE(ocr_language, ''), COALESCE(ticket_url_template, ''), COALESCE(external_id, ''), archived_at, COALESCE(keyframe_overrides, ''), COALESCE(intent_settings, ''), COALESCE(disclaimer, ''), created_at, updated_at"
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanProduct scans a row selected with productColumns into a Product.
+func scanProduct(row rowScanner) (*Product, error) {
+	var p Product
+	var allowDL, explain, share, isolated int
+	var keyframeJSON, intentJSON, disclaimerJSON string
+	var archivedAt sql.NullTime
+	if err := row.Scan(&p.ID, &p.Name, &p.Type, &p.Description, &p.WelcomeMessage, &allowDL, &explain, &share, &isolated, &p.OCRLanguage, &p.TicketURLTemplate, &p.ExternalID, &archivedAt, &keyframeJSON, &intentJSON, &disclaimerJSON, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if archivedAt.Valid {
+		p.ArchivedAt = &archivedAt.Time
+	}
+	p.AllowDownload = allowDL == 1
+	p.ExplainSources = explain == 1
+	p.AllowShare = share == 1
+	p.IsolatedStorage = isolated == 1
+	if keyframeJSON != "" {
+		var o config.KeyframeOverrides
+		if json.Unmarshal([]byte(keyframeJSON), &o) == nil {
+			p.KeyframeOverrides = &o
+		}
+	}
+	if intentJSON != "" {
+		var is config.IntentSettings
+		if json.Unmarshal([]byte(intentJSON), &is) == nil {
+			p.IntentSettings = &is
+		}
+	}
+	if disclaimerJSON != "" {
+		var d config.AnswerDisclaimer
+		if json.Unmarshal([]byte(disclaimerJSON), &d) == nil {
+			p.Disclaimer = &d
+		}
+	}
+	return &p, nil
+}
+
+// ErrIsolatedStorageHasDocuments is returned when deleting a product with
+// isolated storage that still has documents: their chunks live in the
+// product's own file and cannot be moved to the public library.
+var ErrIsolatedStorageHasDocuments = errors.New("该产品使用独立存储，请先删除其下的文档和知识条目")
+
+// validateFields checks the text fields of a product; name and
+// ticketURLTemplate must already be trimmed.
+func validateFields(name, description, welcomeMessage, ocrLanguage, ticketURLTemplate string) error {
+	if name == "" {
+		return fmt.Errorf("product name cannot be empty")
+	}
+	if len(name) > 200 {
+		return fmt.Errorf("product name too long (max 200 characters)")
+	}
+	if len(description) > 5000 {
+		return fmt.Errorf("description too long (max 5000 characters)")
+	}
+	if len(welcomeMessage) > 10000 {
+		return fmt.Errorf("welcome message too long (max 10000 characters)")
+	}
+	if ocrLanguage != "" && !config.IsValidOCRLanguage(ocrLanguage) {
+		return fmt.Errorf("invalid OCR language %q", ocrLanguage)
+	}
+	return validateTicketURLTemplate(ticketURLTemplate)
+}
+
+// ErrArchived is returned when content is added to an archived product.
+var ErrArchived = errors.New("该产品已归档，不能添加新内容")
+
+// Archived reports whether the product is archived.
+func (p *Product) Archived() bool {
+	return p.ArchivedAt != nil
+}
+
+// TicketRefPlaceholder is replaced by the ticket ID in a ticket URL template.
+const TicketRefPlaceholder = "{ref}"
+
+// validateTicketURLTemplate checks a ticket URL template: empty, or an
+// http(s) URL containing TicketRefPlaceholder.
+func validateTicketURLTemplate(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+	if len(tmpl) > 2000 {
+		return fmt.Errorf("ticket URL template too long (max 2000 characters)")
+	}
+	if !strings.Contains(tmpl, TicketRefPlaceholder) {
+		return fmt.Errorf("工单链接模板必须包含 %s", TicketRefPlaceholder)
+	}
+	u, err := url.Parse(strings.ReplaceAll(tmpl, TicketRefPlaceholder, "ref"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("工单链接模板必须是 http(s) 地址")
+	}
+	return nil
+}
+
+// TicketURL expands a ticket URL template for the ticket ID ref. It returns
+// "" when either is empty.
+func TicketURL(tmpl, ref string) string {
+	if tmpl == "" || ref == "" {
+		return ""
+	}
+	return strings.ReplaceAll(tmpl, TicketRefPlaceholder, url.PathEscape(ref))
+}
+
+// Storage opens and removes the storage partitions of products with
+// isolated storage.
+type Storage interface {
+	OpenPartition(productID string) error
+	RemovePartition(productID string) error
+}
 
 // ProductService handles CRUD operations for products.
 type ProductService struct {
 	readDB  *sql.DB
 	writeDB *sql.DB
+	storage Storage // nil when isolated storage is unavailable
 }
 
 // NewProductService creates a new ProductService with separate read and write database connections.
@@ -40,90 +178,240 @@ func NewProductService(readDB, writeDB *sql.DB) *ProductService {
 	return &ProductService{readDB: readDB, writeDB: writeDB}
 }
 
-// Create creates a new product with the given name, description, and welcome message.
-// Returns an error if the name is empty or already exists.
-func (s *ProductService) Create(name, productType, description, welcomeMessage string, allowDownload bool) (*Product, error) {
-	name = strings.TrimSpace(name)
-	if name == "" {
-		return nil, fmt.Errorf("product name cannot be empty")
+// SetStorage sets the storage managing the partitions of products with
+// isolated storage.
+func (s *ProductService) SetStorage(st Storage) {
+	s.storage = st
+}
+
+// OpenPartitions opens the storage partitions of all products with isolated
+// storage. Called once at startup.
+func (s *ProductService) OpenPartitions() error {
+	if s.storage == nil {
+		return nil
 	}
-	if len(name) > 200 {
-		return nil, fmt.Errorf("product name too long (max 200 characters)")
+	rows, err := s.readDB.Query("SELECT id FROM products WHERE isolated_storage = 1")
+	if err != nil {
+		return fmt.Errorf("failed to list products with isolated storage: %w", err)
 	}
-	if len(description) > 5000 {
-		return nil, fmt.Errorf("description too long (max 5000 characters)")
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan product: %w", err)
+		}
+		ids = append(ids, id)
 	}
-	if len(welcomeMessage) > 10000 {
-		return nil, fmt.Errorf("welcome message too long (max 10000 characters)")
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.storage.OpenPartition(id); err != nil {
+			return fmt.Errorf("failed to open storage of product %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Input holds the fields of a new product.
+type Input struct {
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	Description    string `json:"description"`
+	WelcomeMessage string `json:"welcome_message"`
+	AllowDownload  bool   `json:"allow_download"`
+	ExplainSources bool   `json:"explain_sources"`
+	AllowShare     bool   `json:"allow_share"`
+	// IsolatedStorage keeps the product's chunks in their own storage
+	// partition; it cannot be changed later.
+	IsolatedStorage   bool                      `json:"isolated_storage"`
+	OCRLanguage       string                    `json:"ocr_language"`
+	TicketURLTemplate string                    `json:"ticket_url_template"`
+	KeyframeOverrides *config.KeyframeOverrides `json:"keyframe_overrides"`
+	IntentSettings    *config.IntentSettings    `json:"intent_settings"`
+	Disclaimer        *config.AnswerDisclaimer  `json:"disclaimer"`
+}
+
+// Patch holds the fields of a product update. Nil fields keep the stored
+// value; KeyframeOverrides, IntentSettings and Disclaimer are cleared with an
+// empty object.
+type Patch struct {
+	Name              *string                   `json:"name"`
+	Type              *string                   `json:"type"`
+	Description       *string                   `json:"description"`
+	WelcomeMessage    *string                   `json:"welcome_message"`
+	AllowDownload     *bool                     `json:"allow_download"`
+	ExplainSources    *bool                     `json:"explain_sources"`
+	AllowShare        *bool                     `json:"allow_share"`
+	OCRLanguage       *string                   `json:"ocr_language"`
+	TicketURLTemplate *string                   `json:"ticket_url_template"`
+	KeyframeOverrides *config.KeyframeOverrides `json:"keyframe_overrides"`
+	IntentSettings    *config.IntentSettings    `json:"intent_settings"`
+	Disclaimer        *config.AnswerDisclaimer  `json:"disclaimer"`
+}
+
+// apply returns the fields of p with the patch applied.
+func (pt Patch) apply(p *Product) Input {
+	in := Input{
+		Name:              p.Name,
+		Type:              p.Type,
+		Description:       p.Description,
+		WelcomeMessage:    p.WelcomeMessage,
+		AllowDownload:     p.AllowDownload,
+		ExplainSources:    p.ExplainSources,
+		AllowShare:        p.AllowShare,
+		IsolatedStorage:   p.IsolatedStorage,
+		OCRLanguage:       p.OCRLanguage,
+		TicketURLTemplate: p.TicketURLTemplate,
+		KeyframeOverrides: p.KeyframeOverrides,
+		IntentSettings:    p.IntentSettings,
+		Disclaimer:        p.Disclaimer,
+	}
+	setString := func(dst *string, v *string) {
+		if v != nil {
+			*dst = *v
+		}
 	}
+	setBool := func(dst *bool, v *bool) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+	setString(&in.Name, pt.Name)
+	setString(&in.Type, pt.Type)
+	setString(&in.Description, pt.Description)
+	setString(&in.WelcomeMessage, pt.WelcomeMessage)
+	setBool(&in.AllowDownload, pt.AllowDownload)
+	setBool(&in.ExplainSources, pt.ExplainSources)
+	setBool(&in.AllowShare, pt.AllowShare)
+	setString(&in.OCRLanguage, pt.OCRLanguage)
+	setString(&in.TicketURLTemplate, pt.TicketURLTemplate)
+	if pt.KeyframeOverrides != nil {
+		in.KeyframeOverrides = pt.KeyframeOverrides
+	}
+	if pt.IntentSettings != nil {
+		in.IntentSettings = pt.IntentSettings
+	}
+	if pt.Disclaimer != nil {
+		in.Disclaimer = pt.Disclaimer
+	}
+	return in
+}
 
+// encodedInput holds the JSON columns of a product.
+type encodedInput struct {
+	keyframe, intent, disclaimer string
+}
+
+// normalize trims and validates in, defaults its type and encodes its JSON
+// columns.
+func (in *Input) normalize() (encodedInput, error) {
+	var enc encodedInput
+	in.Name = strings.TrimSpace(in.Name)
+	in.TicketURLTemplate = strings.TrimSpace(in.TicketURLTemplate)
+	if err := validateFields(in.Name, in.Description, in.WelcomeMessage, in.OCRLanguage, in.TicketURLTemplate); err != nil {
+		return enc, err
+	}
+	var err error
+	if enc.keyframe, err = encodeKeyframeOverrides(in.KeyframeOverrides); err != nil {
+		return enc, err
+	}
+	if enc.intent, err = encodeIntentSettings(in.IntentSettings); err != nil {
+		return enc, err
+	}
+	if enc.disclaimer, err = encodeDisclaimer(in.Disclaimer); err != nil {
+		return enc, err
+	}
 	// Validate product type
-	if productType != ProductTypeService && productType != ProductTypeKnowledgeBase {
-		productType = ProductTypeService // default to service
+	if in.Type != ProductTypeService && in.Type != ProductTypeKnowledgeBase {
+		in.Type = ProductTypeService // default to service
+	}
+	return enc, nil
+}
+
+// Create creates a new product.
+// Returns an error if the name is empty or already exists.
+func (s *ProductService) Create(in Input) (*Product, error) {
+	enc, err := in.normalize()
+	if err != nil {
+		return nil, err
 	}
 
 	// Check uniqueness via writeDB to avoid TOCTOU race between read pool and write pool.
 	// If two concurrent creates pass the readDB check simultaneously, both would succeed.
 	var count int
-	err := s.writeDB.QueryRow("SELECT COUNT(*) FROM products WHERE name = ?", name).Scan(&count)
+	err = s.writeDB.QueryRow("SELECT COUNT(*) FROM products WHERE name = ?", in.Name).Scan(&count)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check product name uniqueness: %w", err)
 	}
 	if count > 0 {
 		return nil, fmt.Errorf("product name already exists")
 	}
+	if in.IsolatedStorage && s.storage == nil {
+		return nil, fmt.Errorf("isolated storage is not available")
+	}
 
-	id, err := generateID()
+	id, err := idgen.New()
 	if err != nil {
 		return nil, err
 	}
 
 	now := time.Now()
 	_, err = s.writeDB.Exec(
-		"INSERT INTO products (id, name, type, description, welcome_message, allow_download, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-		id, name, productType, description, welcomeMessage, allowDownload, now, now,
+		"INSERT INTO products (id, name, type, description, welcome_message, allow_download, explain_sources, allow_share, isolated_storage, ocr_language, ticket_url_template, keyframe_overrides, intent_settings, disclaimer, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		id, in.Name, in.Type, in.Description, in.WelcomeMessage, in.AllowDownload, in.ExplainSources, in.AllowShare, in.IsolatedStorage, in.OCRLanguage, in.TicketURLTemplate, enc.keyframe, enc.intent, enc.disclaimer, now, now,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create product: %w", err)
 	}
+	// Open the partition before the product is used, so no chunk of it ever
+	// lands in the main database
+	if in.IsolatedStorage {
+		if err := s.storage.OpenPartition(id); err != nil {
+			s.writeDB.Exec("DELETE FROM products WHERE id = ?", id)
+			return nil, fmt.Errorf("failed to create isolated storage: %w", err)
+		}
+	}
 
 	return &Product{
-		ID:             id,
-		Name:           name,
-		Type:           productType,
-		Description:    description,
-		WelcomeMessage: welcomeMessage,
-		AllowDownload:  allowDownload,
-		CreatedAt:      now,
-		UpdatedAt:      now,
+		ID:                id,
+		Name:              in.Name,
+		Type:              in.Type,
+		Description:       in.Description,
+		WelcomeMessage:    in.WelcomeMessage,
+		AllowDownload:     in.AllowDownload,
+		ExplainSources:    in.ExplainSources,
+		AllowShare:        in.AllowShare,
+		IsolatedStorage:   in.IsolatedStorage,
+		OCRLanguage:       in.OCRLanguage,
+		TicketURLTemplate: in.TicketURLTemplate,
+		KeyframeOverrides: in.KeyframeOverrides,
+		IntentSettings:    in.IntentSettings,
+		Disclaimer:        in.Disclaimer,
+		CreatedAt:         now,
+		UpdatedAt:         now,
 	}, nil
 }
 
-// Update updates an existing product's name, description, and welcome message.
-// Returns an error if the name is empty or already used by another product.
-func (s *ProductService) Update(id, name, productType, description, welcomeMessage string, allowDownload bool) (*Product, error) {
-	name = strings.TrimSpace(name)
-	if name == "" {
-		return nil, fmt.Errorf("product name cannot be empty")
-	}
-	if len(name) > 200 {
-		return nil, fmt.Errorf("product name too long (max 200 characters)")
-	}
-	if len(description) > 5000 {
-		return nil, fmt.Errorf("description too long (max 5000 characters)")
-	}
-	if len(welcomeMessage) > 10000 {
-		return nil, fmt.Errorf("welcome message too long (max 10000 characters)")
+// Update applies a patch to an existing product; fields left nil keep their
+// stored value. Returns an error if the name is empty or already used by
+// another product.
+func (s *ProductService) Update(id string, patch Patch) (*Product, error) {
+	existing, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
 	}
-
-	// Validate product type
-	if productType != ProductTypeService && productType != ProductTypeKnowledgeBase {
-		productType = ProductTypeService
+	in := patch.apply(existing)
+	enc, err := in.normalize()
+	if err != nil {
+		return nil, err
 	}
 
 	// Check uniqueness excluding self (use writeDB to avoid TOCTOU race)
 	var count int
-	err := s.writeDB.QueryRow("SELECT COUNT(*) FROM products WHERE name = ? AND id != ?", name, id).Scan(&count)
+	err = s.writeDB.QueryRow("SELECT COUNT(*) FROM products WHERE name = ? AND id != ?", in.Name, id).Scan(&count)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check product name uniqueness: %w", err)
 	}
@@ -133,8 +421,8 @@ func (s *ProductService) Update(id, name, productType, description, welcomeMessa
 
 	now := time.Now()
 	result, err := s.writeDB.Exec(
-		"UPDATE products SET name = ?, type = ?, description = ?, welcome_message = ?, allow_download = ?, updated_at = ? WHERE id = ?",
-		name, productType, description, welcomeMessage, allowDownload, now, id,
+		"UPDATE products SET name = ?, type = ?, description = ?, welcome_message = ?, allow_download = ?, explain_sources = ?, allow_share = ?, ocr_language = ?, ticket_url_template = ?, keyframe_overrides = ?, intent_settings = ?, disclaimer = ?, updated_at = ? WHERE id = ?",
+		in.Name, in.Type, in.Description, in.WelcomeMessage, in.AllowDownload, in.ExplainSources, in.AllowShare, in.OCRLanguage, in.TicketURLTemplate, enc.keyframe, enc.intent, enc.disclaimer, now, id,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update product: %w", err)
@@ -151,9 +439,94 @@ func (s *ProductService) Update(id, name, productType, description, welcomeMessa
 	return s.GetByID(id)
 }
 
+// SetArchived archives or unarchives a product. Archiving keeps all of the
+// product's documents and knowledge.
+func (s *ProductService) SetArchived(id string, archived bool) (*Product, error) {
+	var archivedAt interface{}
+	now := time.Now()
+	if archived {
+		archivedAt = now
+	}
+	// Archiving an archived product keeps its original archive time
+	result, err := s.writeDB.Exec(
+		"UPDATE products SET archived_at = CASE WHEN ? IS NOT NULL AND archived_at IS NOT NULL THEN archived_at ELSE ? END, updated_at = ? WHERE id = ?",
+		archivedAt, archivedAt, now, id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update product: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("product not found")
+	}
+	return s.GetByID(id)
+}
+
+// encodeKeyframeOverrides validates and serializes per-product keyframe settings.
+// A nil or all-zero value is stored as an empty string (inherit global settings).
+func encodeKeyframeOverrides(o *config.KeyframeOverrides) (string, error) {
+	if o == nil || *o == (config.KeyframeOverrides{}) {
+		return "", nil
+	}
+	if err := o.Validate(); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode keyframe overrides: %w", err)
+	}
+	return string(data), nil
+}
+
+// encodeIntentSettings validates and serializes per-product intent classification settings.
+// A nil or empty value is stored as an empty string (default behaviour).
+func encodeIntentSettings(s *config.IntentSettings) (string, error) {
+	if s == nil || (!s.Disabled && s.IrrelevantResponse == "" && s.Model == "" && len(s.Categories) == 0) {
+		return "", nil
+	}
+	if err := s.Validate(); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode intent settings: %w", err)
+	}
+	return string(data), nil
+}
+
+// encodeDisclaimer validates and serializes a product's answer disclaimer.
+// A nil value or one without any text is stored as an empty string (none).
+func encodeDisclaimer(d *config.AnswerDisclaimer) (string, error) {
+	if d == nil || (strings.TrimSpace(d.Text) == "" && len(d.Translations) == 0) {
+		return "", nil
+	}
+	if err := d.Validate(); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode disclaimer: %w", err)
+	}
+	return string(data), nil
+}
+
 // Delete removes a product and disassociates all related documents and chunks.
-// Uses a transaction to ensure atomicity.
+// Uses a transaction to ensure atomicity. A product with isolated storage
+// must have no documents left; its storage partition is removed.
 func (s *ProductService) Delete(id string) error {
+	var isolated bool
+	if err := s.writeDB.QueryRow("SELECT COALESCE(isolated_storage, 0) FROM products WHERE id = ?", id).Scan(&isolated); err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get product: %w", err)
+	}
+	if isolated {
+		var hasDocs bool
+		if err := s.writeDB.QueryRow("SELECT EXISTS(SELECT 1 FROM documents WHERE product_id = ?)", id).Scan(&hasDocs); err != nil {
+			return fmt.Errorf("failed to check documents: %w", err)
+		}
+		if hasDocs {
+			return ErrIsolatedStorageHasDocuments
+		}
+	}
+
 	tx, err := s.writeDB.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -189,29 +562,30 @@ func (s *ProductService) Delete(id string) error {
 		return fmt.Errorf("product not found")
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if isolated && s.storage != nil {
+		return s.storage.RemovePartition(id)
+	}
+	return nil
 }
 
 // GetByID returns a product by its ID.
 func (s *ProductService) GetByID(id string) (*Product, error) {
-	var p Product
-	var allowDL int
-	err := s.readDB.QueryRow(
-		"SELECT id, name, COALESCE(type, 'service'), description, welcome_message, COALESCE(allow_download, 0), created_at, updated_at FROM products WHERE id = ?", id,
-	).Scan(&p.ID, &p.Name, &p.Type, &p.Description, &p.WelcomeMessage, &allowDL, &p.CreatedAt, &p.UpdatedAt)
+	p, err := scanProduct(s.readDB.QueryRow("SELECT "+productColumns+" FROM products WHERE id = ?", id))
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("product not found")
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get product: %w", err)
 	}
-	p.AllowDownload = allowDL == 1
-	return &p, nil
+	return p, nil
 }
 
 // List returns all products ordered by created_at.
 func (s *ProductService) List() ([]Product, error) {
-	rows, err := s.readDB.Query("SELECT id, name, COALESCE(type, 'service'), description, welcome_message, COALESCE(allow_download, 0), created_at, updated_at FROM products ORDER BY created_at")
+	rows, err := s.readDB.Query("SELECT " + productColumns + " FROM products ORDER BY created_at")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list products: %w", err)
 	}
@@ -219,13 +593,11 @@ func (s *ProductService) List() ([]Product, error) {
 
 	var products []Product
 	for rows.Next() {
-		var p Product
-		var allowDL int
-		if err := rows.Scan(&p.ID, &p.Name, &p.Type, &p.Description, &p.WelcomeMessage, &allowDL, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		p, err := scanProduct(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan product: %w", err)
 		}
-		p.AllowDownload = allowDL == 1
-		products = append(products, p)
+		products = append(products, *p)
 	}
 	return products, rows.Err()
 }
@@ -258,7 +630,7 @@ func (s *ProductService) HasProducts() (bool, error) {
 // This is more efficient than List() when only the default product ID is needed.
 func (s *ProductService) GetFirstID() (string, error) {
 	var id string
-	err := s.readDB.QueryRow("SELECT id FROM products ORDER BY created_at LIMIT 1").Scan(&id)
+	err := s.readDB.QueryRow("SELECT id FROM products WHERE archived_at IS NULL ORDER BY created_at LIMIT 1").Scan(&id)
 	if err == sql.ErrNoRows {
 		return "", nil
 	}
@@ -333,8 +705,8 @@ func (s *ProductService) GetByAdminUserID(adminUserID string) ([]Product, error)
 	}
 
 	query := fmt.Sprintf(
-		"SELECT id, name, COALESCE(type, 'service'), description, welcome_message, COALESCE(allow_download, 0), created_at, updated_at FROM products WHERE id IN (%s) ORDER BY created_at",
-		strings.Join(placeholders, ", "),
+		"SELECT %s FROM products WHERE id IN (%s) ORDER BY created_at",
+		productColumns, strings.Join(placeholders, ", "),
 	)
 
 	productRows, err := s.readDB.Query(query, args...)
@@ -345,23 +717,11 @@ func (s *ProductService) GetByAdminUserID(adminUserID string) ([]Product, error)
 
 	var products []Product
 	for productRows.Next() {
-		var p Product
-		var allowDL int
-		if err := productRows.Scan(&p.ID, &p.Name, &p.Type, &p.Description, &p.WelcomeMessage, &allowDL, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		p, err := scanProduct(productRows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan product: %w", err)
 		}
-		p.AllowDownload = allowDL == 1
-		products = append(products, p)
+		products = append(products, *p)
 	}
 	return products, productRows.Err()
 }
-
-
-// generateID creates a random hex string for use as a unique identifier.
-func generateID() (string, error) {
-	b := make([]byte, 16)
-	if _, err := rand.Read(b); err != nil {
-		return "", fmt.Errorf("failed to generate ID: %w", err)
-	}
-	return hex.EncodeToString(b), nil
-}
@@ -0,0 +1,93 @@
+package query
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"askflow/internal/config"
+	"askflow/internal/llm"
+	"askflow/internal/vectorstore"
+)
+
+// Kinds of answers recorded in an AnswerAudit.
+const (
+	AuditKindGenerated = "generated" // generated by the LLM from retrieved chunks
+	AuditKindCached    = "cached"    // reused answer of a matching answered question
+	AuditKindCanned    = "canned"    // configured greeting, off-topic or intent reply
+	AuditKindPending   = "pending"   // not answered, handed over to staff
+	AuditKindExcerpt   = "excerpt"   // retrieved passages quoted without the LLM, once the budget cap is reached
+)
+
+// AnswerAudit records how the answer to a query was produced, for the
+// answer audit trail. The question and final answer are taken from the
+// request and response.
+type AnswerAudit struct {
+	Kind string `json:"kind"`
+	// Prompt holds the chat messages sent to the model for the answer, as
+	// JSON; empty when the answer was not generated.
+	Prompt json.RawMessage `json:"prompt,omitempty"`
+	Chunks []AuditChunk    `json:"chunks"`
+	// Model, endpoint host and generation parameters of the answer model.
+	Model       string  `json:"model,omitempty"`
+	Endpoint    string  `json:"endpoint,omitempty"`
+	Temperature float64 `json:"temperature"`
+	MaxTokens   int     `json:"max_tokens"`
+	// ModelOutput is the model's reply when it differs from the answer
+	// given, e.g. after verification removed sentences or when the model
+	// could not answer.
+	ModelOutput string `json:"model_output,omitempty"`
+}
+
+// AuditChunk is a retrieved chunk the answer was based on.
+type AuditChunk struct {
+	ChunkID      string  `json:"chunk_id"`
+	DocumentID   string  `json:"document_id"`
+	DocumentName string  `json:"document_name"`
+	ChunkIndex   int     `json:"chunk_index"`
+	Score        float64 `json:"score"`
+	RerankScore  float64 `json:"rerank_score,omitempty"`
+}
+
+// newAudit starts the audit of an answer of the given kind based on results.
+// The model is recorded for kinds where the LLM wrote or translated the reply.
+func newAudit(kind string, cfg *config.Config, results []vectorstore.SearchResult) *AnswerAudit {
+	a := &AnswerAudit{Kind: kind, Chunks: make([]AuditChunk, 0, len(results))}
+	for _, r := range results {
+		a.Chunks = append(a.Chunks, AuditChunk{
+			// Chunk IDs are "<document ID>-<chunk index>", see vectorstore
+			ChunkID:      fmt.Sprintf("%s-%d", r.DocumentID, r.ChunkIndex),
+			DocumentID:   r.DocumentID,
+			DocumentName: r.DocumentName,
+			ChunkIndex:   r.ChunkIndex,
+			Score:        r.Score,
+			RerankScore:  r.RerankScore,
+		})
+	}
+	if cfg != nil && kind != AuditKindCached && kind != AuditKindExcerpt {
+		a.Model = cfg.LLM.ModelName
+		if u, err := url.Parse(cfg.LLM.Endpoint); err == nil {
+			a.Endpoint = u.Host
+		}
+		a.Temperature = cfg.LLM.Temperature
+		a.MaxTokens = cfg.LLM.MaxTokens
+	}
+	return a
+}
+
+// setPrompt records the chat messages of an answer generated from context.
+// An attached image is recorded by its SHA-256 digest rather than its data.
+func (a *AnswerAudit) setPrompt(prompt string, context []string, question, imageData string) {
+	var messages interface{}
+	if imageData != "" {
+		sum := sha256.Sum256([]byte(imageData))
+		messages = llm.BuildMessagesWithImage(prompt, context, question, "sha256:"+hex.EncodeToString(sum[:]))
+	} else {
+		messages = llm.BuildMessages(prompt, context, question)
+	}
+	if data, err := json.Marshal(messages); err == nil {
+		a.Prompt = data
+	}
+}
@@ -0,0 +1,63 @@
+package query
+
+import (
+	"strings"
+
+	"askflow/internal/config"
+	"askflow/internal/textutil"
+	"askflow/internal/vectorstore"
+)
+
+const (
+	// excerptCount is how many passages an answer given without the LLM
+	// quotes.
+	excerptCount = 3
+	// excerptRunes limits the length of each quoted passage.
+	excerptRunes = 400
+)
+
+// excerptAnswer answers from keyword search results without any model call,
+// once the budget cap is reached: with the cached answer of the best match
+// when it is an answered question, otherwise by quoting the best passages.
+func (qe *QueryEngine) excerptAnswer(results []vectorstore.SearchResult, dbg *DebugInfo, cfg *config.Config) *QueryResponse {
+	if cached := qe.findCachedAnswer(results[0].DocumentID); cached != "" {
+		return &QueryResponse{
+			Answer:        cached,
+			Sources:       qe.buildSourceRefs(results),
+			DebugInfo:     dbg,
+			BudgetLimited: true,
+			Audit:         newAudit(AuditKindCached, cfg, results),
+		}
+	}
+	if len(results) > excerptCount {
+		results = results[:excerptCount]
+	}
+	var b strings.Builder
+	b.WriteString("以下是与您的问题最相关的资料摘录：")
+	for _, r := range results {
+		text := strings.TrimSpace(r.ChunkText)
+		if text == "" {
+			continue
+		}
+		r.ChunkText = textutil.Ellipsize(text, excerptRunes)
+		if fenced, code := qe.codeChunk(r); code {
+			// Quote marks would end up inside the code; show it as is
+			b.WriteString("\n\n")
+			b.WriteString(fenced)
+		} else {
+			b.WriteString("\n\n> ")
+			b.WriteString(strings.ReplaceAll(r.ChunkText, "\n", "\n> "))
+		}
+		if r.DocumentName != "" {
+			b.WriteString("\n\n—— ")
+			b.WriteString(r.DocumentName)
+		}
+	}
+	return &QueryResponse{
+		Answer:        b.String(),
+		Sources:       qe.buildSourceRefs(results),
+		DebugInfo:     dbg,
+		BudgetLimited: true,
+		Audit:         newAudit(AuditKindExcerpt, cfg, results),
+	}
+}
@@ -0,0 +1,31 @@
+package query
+
+import (
+	"askflow/internal/chunker"
+	"askflow/internal/vectorstore"
+)
+
+// codeAnswerRule is added to the answer prompt when the sources hold code
+// blocks, so commands and config snippets reach users ready to copy.
+const codeAnswerRule = "\n\n代码规则：参考资料中的命令、代码和配置片段必须逐字保留，不要改写、翻译、合并或省略其中的任何字符。" +
+	"在回答中把它们放在带语言标注的 Markdown 代码块中（如 ```bash、```yaml），与参考资料中的语言标注一致；" +
+	"代码块中只放可以直接复制执行或粘贴的内容，说明文字写在代码块之外。"
+
+// codeChunk returns the text of a search result with its code blocks fenced,
+// and whether it holds code. Chunks cut from a code block too long for one
+// chunk get the opening or closing fence they lack, using the code blocks
+// recorded for the chunk at import time.
+func (qe *QueryEngine) codeChunk(r vectorstore.SearchResult) (string, bool) {
+	var langs, open string
+	if qe.readDB != nil && r.DocumentID != "" {
+		// Chunks imported before code blocks were recorded have no row or empty columns
+		_ = qe.readDB.QueryRow(
+			`SELECT COALESCE(code_langs, ''), COALESCE(open_code, '') FROM chunk_locations WHERE document_id = ? AND chunk_index = ?`,
+			r.DocumentID, r.ChunkIndex,
+		).Scan(&langs, &open)
+	}
+	if langs == "" && !chunker.HasCode(r.ChunkText) {
+		return r.ChunkText, false
+	}
+	return chunker.FenceCode(r.ChunkText, open), true
+}
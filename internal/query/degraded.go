@@ -0,0 +1,84 @@
+package query
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// degradedTextThreshold is the minimum keyword similarity of chunks used
+	// to answer while the embedding service is down. It is lower than the
+	// Level 1 text match threshold since the hits are still passed to the LLM.
+	degradedTextThreshold = 0.3
+	// embedRetryInterval is how long embedding calls are skipped after a
+	// failure, so queries do not each wait for the embedding timeout during
+	// an outage.
+	embedRetryInterval = 30 * time.Second
+)
+
+// errEmbeddingUnavailable is returned by cachedEmbed while embedding calls
+// are skipped after a recent failure.
+var errEmbeddingUnavailable = errors.New("embedding service unavailable, retrying later")
+
+// EmbeddingHealth is the state of the embedding service as seen by the latest
+// embedding calls of queries.
+type EmbeddingHealth struct {
+	// Degraded is set while the latest embedding call failed; queries are then
+	// answered from keyword search.
+	Degraded bool `json:"degraded"`
+	// Since is when the embedding service started failing.
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// embedHealth tracks embedding call outcomes.
+type embedHealth struct {
+	mu         sync.Mutex
+	failing    bool
+	since      time.Time // first failure of the current outage
+	lastFailed time.Time
+}
+
+// record notes the outcome of an embedding call.
+func (h *embedHealth) record(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		h.failing = false
+		return
+	}
+	now := time.Now()
+	if !h.failing {
+		h.failing = true
+		h.since = now
+	}
+	h.lastFailed = now
+}
+
+// skip reports whether embedding calls should be skipped because one failed
+// less than embedRetryInterval ago.
+func (h *embedHealth) skip() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failing && time.Since(h.lastFailed) < embedRetryInterval
+}
+
+// reset forgets past failures, e.g. after the embedding service was
+// reconfigured.
+func (h *embedHealth) reset() {
+	h.mu.Lock()
+	h.failing = false
+	h.mu.Unlock()
+}
+
+// EmbeddingHealth reports whether queries are currently answered in degraded
+// mode because the embedding service is down.
+func (qe *QueryEngine) EmbeddingHealth() EmbeddingHealth {
+	qe.embedHealth.mu.Lock()
+	defer qe.embedHealth.mu.Unlock()
+	if !qe.embedHealth.failing {
+		return EmbeddingHealth{}
+	}
+	since := qe.embedHealth.since.UTC()
+	return EmbeddingHealth{Degraded: true, Since: &since}
+}
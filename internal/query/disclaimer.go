@@ -0,0 +1,26 @@
+package query
+
+import (
+	"strings"
+
+	"askflow/internal/config"
+	"askflow/internal/langdetect"
+)
+
+// disclaimerSeparator separates an answer from its product disclaimer; the
+// chat renders it as a horizontal rule.
+const disclaimerSeparator = "\n\n---\n"
+
+// AppendDisclaimer appends a product's disclaimer, in the language of the
+// answer, so that it is logged, shared and exported along with the answer.
+// Pending responses carry no answer and are left alone.
+func (r *QueryResponse) AppendDisclaimer(d *config.AnswerDisclaimer) {
+	if r.IsPending || strings.TrimSpace(r.Answer) == "" {
+		return
+	}
+	text := strings.TrimSpace(d.For(langdetect.Detect(r.Answer)))
+	if text == "" {
+		return
+	}
+	r.Answer += disclaimerSeparator + text
+}
@@ -0,0 +1,148 @@
+package query
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"askflow/internal/document"
+	"askflow/internal/vectorstore"
+)
+
+// EffectiveAll disables the effective-date filter of a query. QueryRequest.Effective
+// otherwise holds a date (document.EffectiveDateLayout) to answer as of, or ""
+// for today.
+const EffectiveAll = "all"
+
+// MaxQueryTags caps the tags of a scoped query.
+const MaxQueryTags = 10
+
+// maxEffectiveOverfetch caps how many extra chunks a filtered search fetches
+// to make up for chunks of documents that are not effective.
+const maxEffectiveOverfetch = 1000
+
+// ValidEffective reports whether s is an accepted QueryRequest.Effective value.
+func ValidEffective(s string) bool {
+	if s == "" || s == EffectiveAll {
+		return true
+	}
+	_, err := time.Parse(document.EffectiveDateLayout, s)
+	return err == nil
+}
+
+// effectiveStore hides chunks of documents outside their effective period
+// from searches of one query. It fetches extra results so that dropping them
+// still leaves topK candidates.
+type effectiveStore struct {
+	vectorstore.VectorStore
+	excluded map[string]bool
+	extra    int
+}
+
+func (s *effectiveStore) Search(queryVector []float64, topK int, threshold float64, productID string) ([]vectorstore.SearchResult, error) {
+	results, err := s.VectorStore.Search(queryVector, topK+s.extra, threshold, productID)
+	if err != nil {
+		return nil, err
+	}
+	return s.filter(results, topK), nil
+}
+
+func (s *effectiveStore) TextSearch(query string, topK int, threshold float64, productID string) ([]vectorstore.SearchResult, error) {
+	results, err := s.VectorStore.TextSearch(query, topK+s.extra, threshold, productID)
+	if err != nil {
+		return nil, err
+	}
+	return s.filter(results, topK), nil
+}
+
+func (s *effectiveStore) filter(results []vectorstore.SearchResult, topK int) []vectorstore.SearchResult {
+	kept := results[:0]
+	for _, r := range results {
+		if !s.excluded[r.DocumentID] {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) > topK {
+		kept = kept[:topK]
+	}
+	return kept
+}
+
+// searchStore returns the vector store to search for req: the engine's store
+// wrapped to skip documents that are not effective on the requested date,
+// entries not yet published by review or by their schedule, replacement
+// files still being processed and documents outside the requested category
+// and tags. Unpublished entries are hidden even when the date filter is off.
+// The second result is the number of documents hidden.
+func (qe *QueryEngine) searchStore(req QueryRequest) (vectorstore.VectorStore, int) {
+	if qe.readDB == nil {
+		return qe.vectorStore, 0
+	}
+	query := `SELECT d.id, COALESCE(d.product_id, ''), (SELECT COUNT(*) FROM chunks c WHERE c.document_id = d.id)
+		 FROM documents d
+		 WHERE d.review_status IN (?, ?) OR d.status = ?
+		    OR ` + document.ScheduleHiddenWhere
+	now := time.Now().UTC().Format(document.ScheduleLayout)
+	args := []interface{}{document.ReviewDraft, document.ReviewInReview, document.StatusStaging, now, now}
+	if req.Effective != EffectiveAll {
+		asOf := req.Effective
+		if asOf == "" {
+			asOf = time.Now().Format(document.EffectiveDateLayout)
+		}
+		query += `
+		    OR (COALESCE(d.effective_from, '') != '' AND d.effective_from > ?)
+		    OR (COALESCE(d.effective_until, '') != '' AND d.effective_until < ?)`
+		args = append(args, asOf, asOf)
+	}
+	if req.Category != "" {
+		query += `
+		    OR COALESCE(d.category, '') != ?`
+		args = append(args, req.Category)
+	}
+	if len(req.Tags) > 0 {
+		query += `
+		    OR NOT EXISTS (SELECT 1 FROM document_tags t WHERE t.document_id = d.id AND LOWER(t.tag) IN (?` +
+			strings.Repeat(", ?", len(req.Tags)-1) + `))`
+		for _, tag := range req.Tags {
+			args = append(args, strings.ToLower(strings.TrimSpace(tag)))
+		}
+	}
+	rows, err := qe.readDB.Query(query, args...)
+	if err != nil {
+		log.Printf("[Query] effective/review/schedule/scope lookup failed, not filtering: %v", err)
+		return qe.vectorStore, 0
+	}
+	defer rows.Close()
+
+	s := &effectiveStore{VectorStore: qe.vectorStore, excluded: make(map[string]bool)}
+	// Chunks of products with isolated storage are counted in the product's
+	// storage partition
+	partitioned := make(map[*sql.DB][]interface{})
+	for rows.Next() {
+		var id, productID string
+		var chunks int
+		if err := rows.Scan(&id, &productID, &chunks); err != nil {
+			continue
+		}
+		s.excluded[id] = true
+		s.extra += chunks
+		if pdb := qe.vectorStore.PartitionDB(productID); pdb != nil {
+			partitioned[pdb] = append(partitioned[pdb], id)
+		}
+	}
+	for pdb, ids := range partitioned {
+		var chunks int
+		if err := pdb.QueryRow(`SELECT COUNT(*) FROM chunks WHERE document_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`,
+			ids...).Scan(&chunks); err == nil {
+			s.extra += chunks
+		}
+	}
+	if len(s.excluded) == 0 {
+		return qe.vectorStore, 0
+	}
+	if s.extra > maxEffectiveOverfetch {
+		s.extra = maxEffectiveOverfetch
+	}
+	return s, len(s.excluded)
+}
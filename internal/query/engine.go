@@ -3,9 +3,7 @@
 package query
 
 import (
-	"crypto/rand"
 	"database/sql"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -14,10 +12,15 @@ import (
 	"sync"
 	"time"
 
+	"askflow/internal/budget"
 	"askflow/internal/config"
+	"askflow/internal/document"
 	"askflow/internal/embedding"
 	"askflow/internal/errlog"
+	"askflow/internal/idgen"
 	"askflow/internal/llm"
+	"askflow/internal/pending"
+	"askflow/internal/textutil"
 	"askflow/internal/vectorstore"
 )
 
@@ -27,6 +30,28 @@ type QueryRequest struct {
 	UserID    string `json:"user_id"`
 	ProductID string `json:"product_id"`
 	ImageData string `json:"image_data,omitempty"` // base64 data URL from clipboard paste
+	// Effective selects documents by effective date: "" answers from documents
+	// effective today, a YYYY-MM-DD date as of that day, EffectiveAll from all
+	// documents. Only admins may set it.
+	Effective string `json:"effective,omitempty"`
+	// Category and Tags scope the search to documents of that category
+	// (document.CategoryManual...) carrying any of the topic tags or product
+	// mentions, as assigned by LLM tagging. Empty means no scope.
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	// Ticket is an optional client-chosen ID for following the query's place
+	// in the generation queue (GET /api/query/queue).
+	Ticket string `json:"ticket,omitempty"`
+	// Debug asks for search diagnostics in DebugInfo. The handler only keeps
+	// it for admins and holders of a debug token.
+	Debug bool `json:"debug,omitempty"`
+	// Caller and Priority place the query in the generation queue. They are
+	// set by the handler from the session, never from the request body.
+	Caller   string `json:"-"`
+	Priority int    `json:"-"`
+	// DryRun answers without side effects: no pending question is created
+	// and no intent webhook is called. Set by query replays.
+	DryRun bool `json:"-"`
 }
 
 
@@ -38,6 +63,19 @@ type QueryResponse struct {
 	AllowDownload bool        `json:"allow_download"`
 	Message       string      `json:"message,omitempty"`
 	DebugInfo     *DebugInfo  `json:"debug_info,omitempty"`
+	QueryID       string      `json:"query_id,omitempty"` // query log ID, used for feedback
+	// Faithfulness is set when verify.mode is on and the answer was checked
+	Faithfulness *Faithfulness `json:"faithfulness,omitempty"`
+	// RequestID identifies the answer's audit record, when recorded
+	RequestID string `json:"request_id,omitempty"`
+	// Degraded is set when the embedding service was down and the answer was
+	// built from keyword search instead of vector search
+	Degraded bool `json:"degraded,omitempty"`
+	// BudgetLimited is set when the monthly budget cap was reached and the
+	// answer was given without model calls
+	BudgetLimited bool `json:"budget_limited,omitempty"`
+	// Audit records how the answer was produced, for the answer audit trail
+	Audit *AnswerAudit `json:"-"`
 }
 
 // DebugInfo holds diagnostic information for debugging the query pipeline.
@@ -51,6 +89,7 @@ type DebugInfo struct {
 	RelaxedResults  []DebugSearchHit  `json:"relaxed_results,omitempty"`
 	TopResults      []DebugSearchHit  `json:"top_results,omitempty"`
 	LLMUnableAnswer bool              `json:"llm_unable_answer"`
+	Faithfulness    *Faithfulness     `json:"faithfulness,omitempty"`
 	Steps           []string          `json:"steps"`
 }
 
@@ -62,8 +101,26 @@ type SourceRef struct {
 	ChunkIndex   int     `json:"chunk_index"`
 	Snippet      string  `json:"snippet"`
 	ImageURL     string  `json:"image_url,omitempty"`
-	StartTime    float64 `json:"start_time,omitempty"` // 视频起始时间（秒）
-	EndTime      float64 `json:"end_time,omitempty"`   // 视频结束时间（秒）
+	StartTime    float64 `json:"start_time,omitempty"`  // 视频起始时间（秒）
+	EndTime      float64 `json:"end_time,omitempty"`    // 视频结束时间（秒）
+	Explanation  string  `json:"explanation,omitempty"` // 引用说明：该片段与问题的关联
+	// URL links web documents to the page section the chunk came from.
+	URL string `json:"url,omitempty"`
+	// Chapter is the title of the video chapter containing StartTime; Chapters lists all
+	// chapters of the video and is only set on the first source from each video.
+	Chapter  string       `json:"chapter,omitempty"`
+	Chapters []ChapterRef `json:"chapters,omitempty"`
+	// CharStart and CharEnd are the rune offsets of a text chunk in the
+	// document text served by GET /api/documents/{id}/content.
+	CharStart *int `json:"char_start,omitempty"`
+	CharEnd   *int `json:"char_end,omitempty"`
+}
+
+// ChapterRef is a titled section of a video with its time range in seconds.
+type ChapterRef struct {
+	Title     string  `json:"title"`
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
 }
 
 
@@ -72,6 +129,8 @@ type DebugSearchHit struct {
 	DocName  string  `json:"doc_name"`
 	Score    float64 `json:"score"`
 	DimMatch bool    `json:"dim_match"`
+	// RerankScore is the reranker's relevance score, when reranking is on.
+	RerankScore float64 `json:"rerank_score,omitempty"`
 }
 
 // embeddingCacheEntry holds a cached embedding vector with expiry.
@@ -140,6 +199,13 @@ type QueryEngine struct {
 	readDB           *sql.DB // readDB for read-only queries
 	config           *config.Config
 	embedCache       *embeddingCache // caches embedding API results to avoid redundant calls
+	pool             *llm.Pool       // bounds concurrent generation across queries
+	reranker         *Reranker       // nil when reranking is disabled
+	embedHealth      embedHealth     // embedding outages switch queries to keyword search
+	greeted          greetedLog      // when users were last greeted with the product intro
+	termRules        func(productID string) string
+	pendingHook      func(id, question, userID, productID string)
+	budget           *budget.Meter // nil when model calls are not metered
 }
 
 // NewQueryEngine creates a new QueryEngine with the given dependencies.
@@ -159,15 +225,22 @@ func NewQueryEngine(
 		readDB:           readDB,
 		config:           cfg,
 		embedCache:       newEmbeddingCache(512, 10*time.Minute),
+		pool:             newPool(cfg),
+		reranker:         newRerankerFromConfig(cfg),
 	}
 }
 
 // cachedEmbed returns the embedding for text, using cache when available.
+// Shortly after a failed call it fails fast with errEmbeddingUnavailable.
 func (qe *QueryEngine) cachedEmbed(text string, es embedding.EmbeddingService) ([]float64, error) {
 	if vec, ok := qe.embedCache.get(text); ok {
 		return vec, nil
 	}
+	if qe.embedHealth.skip() {
+		return nil, errEmbeddingUnavailable
+	}
 	vec, err := es.Embed(text)
+	qe.embedHealth.record(err)
 	if err != nil {
 		return nil, err
 	}
@@ -182,6 +255,11 @@ func (qe *QueryEngine) UpdateServices(es embedding.EmbeddingService, ls llm.LLMS
 	qe.embeddingService = es
 	qe.llmService = ls
 	qe.config = cfg
+	qe.reranker = newRerankerFromConfig(cfg)
+	qe.embedHealth.reset()
+	if cfg != nil {
+		qe.pool.Resize(cfg.LLM.MaxConcurrency, cfg.LLM.MaxQueue, cfg.LLM.MaxQueuedPerUser, time.Duration(cfg.LLM.QueueTimeoutSec)*time.Second)
+	}
 }
 
 // getServices returns a snapshot of the current services under read lock.
@@ -191,12 +269,73 @@ func (qe *QueryEngine) getServices() (embedding.EmbeddingService, llm.LLMService
 	return qe.embeddingService, qe.llmService, qe.config
 }
 
-// TranslateText translates the given text to the target language using LLM.
-func (qe *QueryEngine) TranslateText(text, targetLang string) (string, error) {
+// getReranker returns the current reranker, or nil when reranking is off.
+func (qe *QueryEngine) getReranker() *Reranker {
+	qe.mu.RLock()
+	defer qe.mu.RUnlock()
+	return qe.reranker
+}
+
+// LLMService returns the current LLM service, for features outside the query
+// pipeline that share its configuration.
+func (qe *QueryEngine) LLMService() llm.LLMService {
+	_, ls, _ := qe.getServices()
+	return ls
+}
+
+// SetTermRules sets the source of per-product terminology rules (terms to
+// keep untranslated, preferred names) appended to answer and translation
+// prompts.
+func (qe *QueryEngine) SetTermRules(fn func(productID string) string) {
+	qe.mu.Lock()
+	defer qe.mu.Unlock()
+	qe.termRules = fn
+}
+
+// SetPendingHook sets a function called after a question the engine could
+// not answer is added to the pending queue.
+func (qe *QueryEngine) SetPendingHook(fn func(id, question, userID, productID string)) {
+	qe.mu.Lock()
+	defer qe.mu.Unlock()
+	qe.pendingHook = fn
+}
+
+// SetBudget sets the meter whose caps decide when queries are answered
+// without model calls.
+func (qe *QueryEngine) SetBudget(m *budget.Meter) {
+	qe.mu.Lock()
+	defer qe.mu.Unlock()
+	qe.budget = m
+}
+
+// budgetDegraded reports whether questions about productID must be answered
+// without model calls because a budget cap is reached.
+func (qe *QueryEngine) budgetDegraded(productID string) bool {
+	qe.mu.RLock()
+	m := qe.budget
+	qe.mu.RUnlock()
+	return m.Degraded(productID)
+}
+
+// termRulesFor returns the terminology prompt rules of a product, or "".
+func (qe *QueryEngine) termRulesFor(productID string) string {
+	qe.mu.RLock()
+	fn := qe.termRules
+	qe.mu.RUnlock()
+	if fn == nil {
+		return ""
+	}
+	return fn(productID)
+}
+
+// TranslateText translates the given text to the target language using LLM,
+// following the terminology rules of the product ("" for global terms only).
+func (qe *QueryEngine) TranslateText(text, targetLang, productID string) (string, error) {
 	if text == "" {
 		return "", nil
 	}
 	_, ls, _ := qe.getServices()
+	ls = budget.Optional(budget.ForProduct(ls, productID))
 	langName := targetLang
 	switch targetLang {
 	case "zh-CN":
@@ -204,7 +343,8 @@ func (qe *QueryEngine) TranslateText(text, targetLang string) (string, error) {
 	case "en-US", "en":
 		langName = "English"
 	}
-	prompt := fmt.Sprintf("你是一个翻译助手。将以下文本翻译为%s。只输出翻译结果，不要添加任何解释或引号。如果文本已经是目标语言，直接原样输出。", langName)
+	prompt := fmt.Sprintf("你是一个翻译助手。将以下文本翻译为%s。只输出翻译结果，不要添加任何解释或引号。如果文本已经是目标语言，直接原样输出。", langName) +
+		qe.termRulesFor(productID)
 	translated, err := ls.Generate(prompt, []string{text}, text)
 	if err != nil {
 		return "", err
@@ -214,12 +354,13 @@ func (qe *QueryEngine) TranslateText(text, targetLang string) (string, error) {
 
 // IntentResult represents the result of intent classification.
 type IntentResult struct {
-	Intent string // "greeting", "product", or "irrelevant"
+	Intent string // "greeting", "product", "irrelevant" or a custom category name
 	Reason string
 }
 
-// classifyIntent uses the LLM to determine the user's intent.
-func (qe *QueryEngine) classifyIntent(question string, ls llm.LLMService, cfg *config.Config) (*IntentResult, error) {
+// classifyIntent uses the LLM to determine the user's intent. Custom categories
+// from the product's intent settings are offered alongside the built-in ones.
+func (qe *QueryEngine) classifyIntent(question string, ls llm.LLMService, cfg *config.Config, settings *config.IntentSettings) (*IntentResult, error) {
 	productIntro := ""
 	if cfg != nil {
 		productIntro = cfg.ProductIntro
@@ -233,8 +374,13 @@ func (qe *QueryEngine) classifyIntent(question string, ls llm.LLMService, cfg *c
 		"\n\n意图类别：" +
 		"\n- greeting: 仅限纯粹的打招呼和问候语（如：你好、hi、hello、在吗）" +
 		"\n- product: 任何与产品相关的问题，包括但不限于：功能介绍、下载、安装、使用方法、技术问题、故障排查、价格、版本等" +
-		"\n- irrelevant: 与产品完全无关的问题（如天气、笑话、新闻、个人情感等）" +
-		"\n\n重要规则：如果用户在询问任何具体信息（即使很简短），都应归类为product而非greeting。" +
+		"\n- irrelevant: 与产品完全无关的问题（如天气、笑话、新闻、个人情感等）"
+	if settings != nil {
+		for _, c := range settings.Categories {
+			systemPrompt += "\n- " + c.Name + ": " + c.Description
+		}
+	}
+	systemPrompt += "\n\n重要规则：如果用户在询问任何具体信息（即使很简短），都应归类为product而非greeting。" +
 		"\n\n示例：" +
 		"\n\"你好\" → {\"intent\":\"greeting\"}" +
 		"\n\"hi\" → {\"intent\":\"greeting\"}" +
@@ -282,9 +428,20 @@ func (qe *QueryEngine) classifyIntent(question string, ls llm.LLMService, cfg *c
 func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 	// Snapshot services under read lock for concurrency safety
 	es, ls, cfg := qe.getServices()
-
-	// Initialize debug info if debug mode is enabled
-	debugMode := cfg != nil && cfg.Vector.DebugMode
+	// Model calls count toward the product's budget. Translations of canned
+	// replies and other extras stop first when a cap is reached; with the
+	// degrade action the question is answered without any model call.
+	es, ls = budget.EmbeddingForProduct(es, req.ProductID), budget.ForProduct(ls, req.ProductID)
+	optional := budget.Optional(ls)
+	budgetLimited := qe.budgetDegraded(req.ProductID)
+
+	// LLM calls wait for a slot in the generation pool; answers served from
+	// cache never queue.
+	slot := qe.newGenerationSlot(req)
+	defer slot.done()
+
+	// Initialize debug info if the request asked for diagnostics
+	debugMode := req.Debug && cfg != nil
 	var dbg *DebugInfo
 	if debugMode {
 		dbg = &DebugInfo{
@@ -293,25 +450,62 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 		}
 	}
 
+	// Step 0: Trivial small talk ("thanks", "ok") is answered from the configured phrase lists without any LLM call
+	if req.ImageData == "" && cfg != nil && !cfg.SmallTalk.Disabled {
+		if rule := matchSmallTalk(cfg.SmallTalk.Rules, req.Question); rule != nil {
+			if debugMode {
+				dbg.Intent = rule.Kind
+				dbg.Steps = append(dbg.Steps, "Step 0: small talk matched locally, kind="+rule.Kind+", language="+rule.Language)
+			}
+			answer, translate := qe.smallTalkReply(rule, req.UserID, cfg)
+			if translate {
+				if err := slot.acquire(); err != nil {
+					return nil, err
+				}
+				answer = qe.replyInQuestionLanguage(optional, answer, req.Question)
+			}
+			return &QueryResponse{Answer: answer, DebugInfo: dbg, Audit: newAudit(AuditKindCanned, cfg, nil)}, nil
+		}
+	}
+
 	// Step 0: Intent classification (skip if image is attached — image may contain product info)
 	// Also skip for knowledge_base products — they should answer all questions without filtering
-	skipIntentClassification := req.ImageData != ""
+	skipIntentClassification := req.ImageData != "" || budgetLimited
+	if budgetLimited && debugMode {
+		dbg.Steps = append(dbg.Steps, "Step 0: monthly budget cap reached, answering from cached answers and keyword search only")
+	}
+	var intentSettings *config.IntentSettings
 	if !skipIntentClassification && req.ProductID != "" {
-		var pType string
-		err := qe.readDB.QueryRow("SELECT COALESCE(type, 'service') FROM products WHERE id = ?", req.ProductID).Scan(&pType)
+		var pType, intentJSON string
+		err := qe.readDB.QueryRow("SELECT COALESCE(type, 'service'), COALESCE(intent_settings, '') FROM products WHERE id = ?", req.ProductID).Scan(&pType, &intentJSON)
+		if err == nil && intentJSON != "" {
+			var is config.IntentSettings
+			if json.Unmarshal([]byte(intentJSON), &is) == nil {
+				intentSettings = &is
+			}
+		}
 		if err == nil && pType == "knowledge_base" {
 			skipIntentClassification = true
 			if debugMode {
 				dbg.Intent = "product"
 				dbg.Steps = append(dbg.Steps, "Step 0: product type=knowledge_base, skipping intent classification")
 			}
+		} else if intentSettings != nil && intentSettings.Disabled {
+			skipIntentClassification = true
+			if debugMode {
+				dbg.Intent = "product"
+				dbg.Steps = append(dbg.Steps, "Step 0: intent classification disabled for product")
+			}
 		}
 	}
 	if !skipIntentClassification {
-		intent, err := qe.classifyIntent(req.Question, ls, cfg)
+		if err := slot.acquire(); err != nil {
+			return nil, err
+		}
+		intent, err := qe.classifyIntent(req.Question, qe.intentLLM(ls, cfg, intentSettings), cfg, intentSettings)
 		if err == nil {
 			switch intent.Intent {
-			case "greeting":
+			case config.IntentGreeting:
 				if debugMode {
 					dbg.Intent = "greeting"
 					dbg.Steps = append(dbg.Steps, "Step 0: intent=greeting, returning product intro")
@@ -321,43 +515,47 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 				if cfg != nil && cfg.ProductIntro != "" {
 					intro = cfg.ProductIntro
 				}
-				// Use LLM to translate the greeting to match the user's question language
-				translated, tErr := ls.Generate(
-					"你是一个翻译助手。将以下内容翻译为与用户提问相同的语言。如果用户用英文提问，翻译为英文；如果用户用中文提问，保持中文。只输出翻译结果，不要添加任何解释。",
-					[]string{intro},
-					req.Question,
-				)
-				if tErr == nil && translated != "" {
-					intro = translated
-				}
-				return &QueryResponse{Answer: intro, DebugInfo: dbg}, nil
-			case "irrelevant":
+				return &QueryResponse{Answer: qe.replyInQuestionLanguage(optional, intro, req.Question), DebugInfo: dbg, Audit: newAudit(AuditKindCanned, cfg, nil)}, nil
+			case config.IntentIrrelevant:
 				if debugMode {
 					dbg.Intent = "irrelevant"
 					dbg.Steps = append(dbg.Steps, "Step 0: intent=irrelevant, reason="+intent.Reason)
 				}
 				msg := "抱歉，这个问题与我们的产品无关。请问有什么产品方面的问题需要帮助吗？"
-				if intent.Reason != "" {
+				if intentSettings != nil && intentSettings.IrrelevantResponse != "" {
+					msg = intentSettings.IrrelevantResponse
+				} else if intent.Reason != "" {
 					msg = "抱歉，" + intent.Reason + "。请问有什么产品方面的问题需要帮助吗？"
 				}
-				translated, tErr := ls.Generate(
-					"你是一个翻译助手。将以下内容翻译为与用户提问相同的语言。如果用户用英文提问，翻译为英文；如果用户用中文提问，保持中文。只输出翻译结果，不要添加任何解释。",
-					[]string{msg},
-					req.Question,
-				)
-				if tErr == nil && translated != "" {
-					msg = translated
+				return &QueryResponse{Answer: qe.replyInQuestionLanguage(optional, msg, req.Question), DebugInfo: dbg, Audit: newAudit(AuditKindCanned, cfg, nil)}, nil
+			default:
+				if cat := intentSettings.Category(intent.Intent); cat != nil {
+					if debugMode {
+						dbg.Intent = cat.Name
+						dbg.Steps = append(dbg.Steps, "Step 0: intent="+cat.Name+" (custom category)")
+					}
+					if cat.WebhookURL != "" && !req.DryRun {
+						go notifyIntentWebhook(*cat, req)
+					}
+					if cat.Response != "" {
+						return &QueryResponse{Answer: qe.replyInQuestionLanguage(optional, cat.Response, req.Question), DebugInfo: dbg, Audit: newAudit(AuditKindCanned, cfg, nil)}, nil
+					}
 				}
-				return &QueryResponse{Answer: msg, DebugInfo: dbg}, nil
 			}
 		}
 	}
 
-	if debugMode {
+	if debugMode && (dbg.Intent == "" || dbg.Intent == "product") {
 		dbg.Intent = "product"
 		dbg.Steps = append(dbg.Steps, "Step 0: intent=product, proceeding to RAG pipeline")
 	}
 
+	// Documents outside their effective period, awaiting review or out of the requested scope are hidden from every search below
+	vs, hidden := qe.searchStore(req)
+	if debugMode && hidden > 0 {
+		dbg.Steps = append(dbg.Steps, fmt.Sprintf("Effective dates/review/scope: %d document(s) not effective, unpublished or out of scope, excluded from search", hidden))
+	}
+
 	// ===== 3-Level Text Similarity Processing =====
 	// Level 1: Text-based matching (free — no API calls)
 	// Level 2: Vector search + cached answer reuse (embedding API only, no LLM)
@@ -370,7 +568,7 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 		}
 
 		// Level 1: Text-based search against chunk cache
-		textResults, textErr := qe.vectorStore.TextSearch(req.Question, 3, 0.65, req.ProductID)
+		textResults, textErr := vs.TextSearch(req.Question, 3, 0.65, req.ProductID)
 		if textErr == nil && len(textResults) > 0 && textResults[0].Score >= 0.75 {
 			log.Printf("[Query] Level 1 text match hit: score=%.4f doc=%q", textResults[0].Score, textResults[0].DocumentName)
 			if debugMode {
@@ -386,7 +584,7 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 				}
 				textResults = qe.enrichVideoTimeInfo(textResults)
 				sources := qe.buildSourceRefs(textResults)
-				return &QueryResponse{Answer: cachedAnswer, Sources: sources, DebugInfo: dbg}, nil
+				return &QueryResponse{Answer: cachedAnswer, Sources: sources, DebugInfo: dbg, Audit: newAudit(AuditKindCached, cfg, textResults)}, nil
 			}
 
 			// Level 2: We have a good text match but no cached answer.
@@ -394,9 +592,13 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 			if debugMode {
 				dbg.Steps = append(dbg.Steps, "TextMatch: Level 2 — confirming with embedding (embedding API only)")
 			}
-			queryVector, embErr := qe.cachedEmbed(req.Question, es)
+			var queryVector []float64
+			embErr := budget.ErrLimitReached
+			if !budgetLimited {
+				queryVector, embErr = qe.cachedEmbed(req.Question, es)
+			}
 			if embErr == nil {
-				vecResults, vecErr := qe.vectorStore.Search(queryVector, cfg.Vector.TopK, cfg.Vector.Threshold, req.ProductID)
+				vecResults, vecErr := vs.Search(queryVector, cfg.Vector.TopK, cfg.Vector.Threshold, req.ProductID)
 				if vecErr == nil && len(vecResults) > 0 && vecResults[0].Score >= 0.75 {
 					log.Printf("[Query] Level 2 vector confirmed: score=%.4f", vecResults[0].Score)
 					if debugMode {
@@ -413,7 +615,7 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 						}
 						vecResults = qe.enrichVideoTimeInfo(vecResults)
 						sources := qe.buildSourceRefs(vecResults)
-						return &QueryResponse{Answer: cachedAnswer, Sources: sources, DebugInfo: dbg}, nil
+						return &QueryResponse{Answer: cachedAnswer, Sources: sources, DebugInfo: dbg, Audit: newAudit(AuditKindCached, cfg, vecResults)}, nil
 					}
 				}
 			}
@@ -433,25 +635,65 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 
 	// ===== Level 3: Full RAG Pipeline =====
 
-	// Step 1: Embed the question
-	queryVector, err := qe.cachedEmbed(req.Question, es)
-	if err != nil {
-		errlog.Logf("[Query] failed to embed question: %v", err)
-		return nil, fmt.Errorf("failed to embed question: %w", err)
-	}
-	log.Printf("[Query] question_len=%d, vector_dim=%d", len(req.Question), len(queryVector))
-	if debugMode {
-		dbg.VectorDim = len(queryVector)
-		dbg.Steps = append(dbg.Steps, fmt.Sprintf("Step 1: embedded question, vector_dim=%d", len(queryVector)))
+	// Step 1: Embed the question. When the embedding service is down, the
+	// query is answered in degraded mode from keyword search instead; past
+	// the budget cap keyword search is used without trying.
+	degraded := false
+	var queryVector []float64
+	var err error
+	if budgetLimited {
+		if debugMode {
+			dbg.Steps = append(dbg.Steps, "Step 1: budget cap reached, keyword search without embedding")
+		}
+	} else if queryVector, err = qe.cachedEmbed(req.Question, es); err != nil {
+		errlog.Logf("[Query] failed to embed question, falling back to keyword search: %v", err)
+		degraded = true
+		if debugMode {
+			dbg.Steps = append(dbg.Steps, fmt.Sprintf("Step 1: embedding failed, degraded mode (keyword search): %v", err))
+		}
+	} else {
+		log.Printf("[Query] question_len=%d, vector_dim=%d", len(req.Question), len(queryVector))
+		if debugMode {
+			dbg.VectorDim = len(queryVector)
+			dbg.Steps = append(dbg.Steps, fmt.Sprintf("Step 1: embedded question, vector_dim=%d", len(queryVector)))
+		}
 	}
 
-	// Step 2: Search vector store
+	// Step 2: Search vector store. With reranking, a larger pool of hits is
+	// retrieved and the reranker picks the best topK of them.
 	topK := cfg.Vector.TopK
 	threshold := cfg.Vector.Threshold
-	results, err := qe.vectorStore.Search(queryVector, topK, threshold, req.ProductID)
+	reranker := qe.getReranker()
+	candidates := topK
+	if reranker != nil {
+		candidates = rerankPoolSize(cfg, topK)
+	}
+	keywordOnly := degraded || budgetLimited
+	var results []vectorstore.SearchResult
+	if keywordOnly {
+		threshold = degradedTextThreshold
+		results, err = vs.TextSearch(req.Question, searchPoolSize(candidates, cfg.Vector), threshold, req.ProductID)
+	} else {
+		results, err = vs.Search(queryVector, searchPoolSize(candidates, cfg.Vector), threshold, req.ProductID)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to search vector store: %w", err)
 	}
+	// Collapse parallel translations, preferring chunks in the question's language
+	results = qe.routeByLanguage(req.Question, results, candidates, cfg.Vector.LanguageFilter)
+	if reranker != nil {
+		hits := len(results)
+		var rerankErr error
+		results, rerankErr = rerankResults(reranker, req.Question, results, topK)
+		log.Printf("[Query] rerank candidates=%d kept=%d err=%v", hits, len(results), rerankErr)
+		if debugMode {
+			if rerankErr != nil {
+				dbg.Steps = append(dbg.Steps, fmt.Sprintf("Step 2: rerank of %d hits failed, kept vector order: %v", hits, rerankErr))
+			} else {
+				dbg.Steps = append(dbg.Steps, fmt.Sprintf("Step 2: reranked %d hits, kept %d", hits, len(results)))
+			}
+		}
+	}
 	log.Printf("[Query] search topK=%d threshold=%.2f results=%d", topK, threshold, len(results))
 	if debugMode {
 		dbg.ResultCount = len(results)
@@ -460,13 +702,13 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 			if i >= 5 {
 				break
 			}
-			dbg.TopResults = append(dbg.TopResults, DebugSearchHit{DocName: r.DocumentName, Score: r.Score, DimMatch: true})
+			dbg.TopResults = append(dbg.TopResults, DebugSearchHit{DocName: r.DocumentName, Score: r.Score, DimMatch: true, RerankScore: r.RerankScore})
 		}
 	}
 
 	// Step 2.5: If image provided, also search with image embedding and merge results
 	var imgVec []float64
-	if req.ImageData != "" {
+	if req.ImageData != "" && !keywordOnly {
 		var imgErr error
 		imgVec, imgErr = es.EmbedImageURL(req.ImageData)
 		if imgErr != nil {
@@ -479,7 +721,7 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 			if imgThreshold < 0.3 {
 				imgThreshold = 0.3
 			}
-			imgResults, imgSearchErr := qe.vectorStore.Search(imgVec, topK, imgThreshold, req.ProductID)
+			imgResults, imgSearchErr := vs.Search(imgVec, topK, imgThreshold, req.ProductID)
 			if imgSearchErr == nil && len(imgResults) > 0 {
 				log.Printf("[Query] image search results=%d (threshold=%.2f)", len(imgResults), imgThreshold)
 				results = mergeSearchResults(results, imgResults, topK)
@@ -488,12 +730,12 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 	}
 
 	// Step 3: If no results above threshold, try with lower threshold before giving up
-	if len(results) == 0 {
+	if len(results) == 0 && !keywordOnly {
 		if debugMode {
 			dbg.RelaxedSearch = true
 			dbg.Steps = append(dbg.Steps, "Step 3: no results above threshold, trying relaxed search (threshold=0.0, accept>=0.3)")
 		}
-		relaxedResults, _ := qe.vectorStore.Search(queryVector, 3, 0.0, req.ProductID)
+		relaxedResults, _ := vs.Search(queryVector, 3, 0.0, req.ProductID)
 		log.Printf("[Query] relaxed search results=%d", len(relaxedResults))
 		for i, r := range relaxedResults {
 			log.Printf("[Query]   relaxed[%d] score=%.4f doc=%q dim_match=%v", i, r.Score, r.DocumentName, true)
@@ -513,7 +755,7 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 
 		// Also try relaxed search with image vector
 		if len(results) == 0 && len(imgVec) > 0 {
-			imgRelaxed, _ := qe.vectorStore.Search(imgVec, 3, 0.0, req.ProductID)
+			imgRelaxed, _ := vs.Search(imgVec, 3, 0.0, req.ProductID)
 			log.Printf("[Query] relaxed image search results=%d", len(imgRelaxed))
 			for i, r := range imgRelaxed {
 				log.Printf("[Query]   img_relaxed[%d] score=%.4f doc=%q", i, r.Score, r.DocumentName)
@@ -559,6 +801,12 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 	// Step 3.6: Enrich search results with video time information from video_segments table
 	results = qe.enrichVideoTimeInfo(results)
 
+	if !budgetLimited {
+		if err := slot.acquire(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Step 4: If still no results, create pending question
 	if len(results) == 0 {
 		if debugMode {
@@ -570,7 +818,7 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 				dbg.Steps = append(dbg.Steps, "Step 4: found similar pending question, returning 'already processing'")
 			}
 			pendingMsg := "该问题已在处理中，请耐心等待回复"
-			translated, tErr := ls.Generate(
+			translated, tErr := optional.Generate(
 				"你是一个翻译助手。将以下内容翻译为与用户提问相同的语言。如果用户用英文提问，翻译为英文；如果用户用中文提问，保持中文。只输出翻译结果，不要添加任何解释。",
 				[]string{pendingMsg},
 				req.Question,
@@ -579,20 +827,25 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 				pendingMsg = translated
 			}
 			return &QueryResponse{
-				IsPending: true,
-				Message:   pendingMsg,
-				DebugInfo: dbg,
+				IsPending:     true,
+				Message:       pendingMsg,
+				DebugInfo:     dbg,
+				Degraded:      degraded,
+				BudgetLimited: budgetLimited,
+				Audit:         newAudit(AuditKindPending, cfg, nil),
 			}, nil
 		}
 
-		if err := qe.createPendingQuestion(req.Question, req.UserID, req.ImageData, req.ProductID); err != nil {
-			return nil, fmt.Errorf("failed to create pending question: %w", err)
+		if !req.DryRun {
+			if _, err := qe.createPendingQuestion(req.Question, req.UserID, req.ImageData, req.ProductID, nil); err != nil {
+				return nil, fmt.Errorf("failed to create pending question: %w", err)
+			}
 		}
 		if debugMode {
 			dbg.Steps = append(dbg.Steps, "Step 4: created new pending question, returning 'transferred to manual'")
 		}
 		pendingMsg := "该问题已转交人工处理，请稍后查看回复"
-		translated, tErr := ls.Generate(
+		translated, tErr := optional.Generate(
 			"你是一个翻译助手。将以下内容翻译为与用户提问相同的语言。如果用户用英文提问，翻译为英文；如果用户用中文提问，保持中文。只输出翻译结果，不要添加任何解释。",
 			[]string{pendingMsg},
 			req.Question,
@@ -601,9 +854,12 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 			pendingMsg = translated
 		}
 		return &QueryResponse{
-			IsPending: true,
-			Message:   pendingMsg,
-			DebugInfo: dbg,
+			IsPending:     true,
+			Message:       pendingMsg,
+			DebugInfo:     dbg,
+			Degraded:      degraded,
+			BudgetLimited: budgetLimited,
+			Audit:         newAudit(AuditKindPending, cfg, nil),
 		}, nil
 	}
 
@@ -611,6 +867,15 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 		dbg.Steps = append(dbg.Steps, fmt.Sprintf("Step 4: skipped (have %d results), proceeding to LLM", len(results)))
 	}
 
+	// Step 4.2: Past the budget cap, answer with the cached answer of the best
+	// match or quote the best passages instead of calling the LLM
+	if budgetLimited {
+		if debugMode {
+			dbg.Steps = append(dbg.Steps, fmt.Sprintf("Step 4.2: budget cap reached, answering from %d keyword results without the LLM", len(results)))
+		}
+		return qe.excerptAnswer(results, dbg, cfg), nil
+	}
+
 	// Step 4.5: Enrich search results with images from the same documents
 	// If search results don't include image chunks, look up image URLs
 	// from the same documents in the database.
@@ -619,12 +884,15 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 	// Step 5: Build context from search results and call LLM
 	context := make([]string, len(results))
 	hasImages := len(docImages) > 0
+	hasCode := false
 	for i, r := range results {
+		text, code := qe.codeChunk(r)
+		hasCode = hasCode || code
 		if r.ImageURL != "" {
-			context[i] = r.ChunkText + " (图片已附带，将自动展示给用户)"
+			context[i] = text + " (图片已附带，将自动展示给用户)"
 			hasImages = true
 		} else {
-			context[i] = r.ChunkText
+			context[i] = text
 		}
 	}
 
@@ -637,8 +905,30 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 			"\n\n关于图片：参考资料中标记为[图片已附带]的内容，对应的图片会自动展示在你的回答下方。请在回答中自然地引导用户查看图片（例如：如下图所示、请参考下方图片），不要说无法提供图片或无法展示图片。"
 	}
 
+	// Keep brand terms intact and use the preferred names in the answer
+	rules := qe.termRulesFor(req.ProductID)
+	if rules != "" && debugMode {
+		dbg.Steps = append(dbg.Steps, "Step 5: applied product terminology rules to the answer prompt")
+	}
+	// Keep commands and config snippets verbatim in fenced blocks
+	if hasCode {
+		rules += codeAnswerRule
+		if debugMode {
+			dbg.Steps = append(dbg.Steps, "Step 5: sources hold code blocks, asked to keep them verbatim")
+		}
+	}
+	if rules != "" {
+		if systemPrompt == "" && req.ImageData == "" {
+			systemPrompt = llm.DefaultAnswerPrompt
+		}
+		if systemPrompt != "" {
+			systemPrompt += rules
+		}
+	}
+
 	// Use vision LLM when user attached an image
 	var answer string
+	audit := newAudit(AuditKindGenerated, cfg, results)
 	if req.ImageData != "" {
 		visionPrompt := systemPrompt
 		if visionPrompt == "" {
@@ -646,11 +936,14 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 				"请结合图片内容和提供的参考资料来回答用户的问题。" +
 				"如果参考资料中没有相关信息，请根据图片内容尽可能回答。回答应简洁、准确、有条理。" +
 				"\n\n重要规则：你必须使用与用户提问相同的语言来回答。" +
-				"\n\n格式规则：使用有序列表时，请使用递增的序号（1. 2. 3.），不要所有条目都用1.开头。"
+				"\n\n格式规则：使用有序列表时，请使用递增的序号（1. 2. 3.），不要所有条目都用1.开头。" +
+				rules
 		}
-		answer, err = ls.GenerateWithImage(visionPrompt, context, req.Question, req.ImageData)
+		audit.setPrompt(visionPrompt, context, req.Question, req.ImageData)
+		answer, err = llm.ForTask(ls, config.LLMTaskVision).GenerateWithImage(visionPrompt, context, req.Question, req.ImageData)
 	} else {
-		answer, err = ls.Generate(systemPrompt, context, req.Question)
+		audit.setPrompt(systemPrompt, context, req.Question, "")
+		answer, err = llm.ForTask(ls, config.LLMTaskAnswer).Generate(systemPrompt, context, req.Question)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate answer: %w", err)
@@ -664,15 +957,19 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 			dbg.LLMUnableAnswer = true
 			dbg.Steps = append(dbg.Steps, "Step 5.5: LLM indicated unable to answer, creating pending question")
 		}
-		if existing := qe.findSimilarPendingQuestion(req.Question, queryVector); existing != "" {
+		if existing := qe.findSimilarPendingQuestion(req.Question, queryVector); existing != "" || req.DryRun {
 			isPending = true
 		} else {
-			_ = qe.createPendingQuestion(req.Question, req.UserID, req.ImageData, req.ProductID)
+			// Keep what was retrieved and let the LLM note what it lacked, so
+			// admins know which documents to add
+			if id, err := qe.createPendingQuestion(req.Question, req.UserID, req.ImageData, req.ProductID, results); err == nil {
+				go qe.summarizeMissing(id, req.Question, context, optional)
+			}
 			isPending = true
 		}
 		// When unable to answer, don't return sources/images — they are irrelevant noise
 		pendingMsg := "该问题已转交人工处理，请稍后查看回复"
-		translated, tErr := ls.Generate(
+		translated, tErr := optional.Generate(
 			"你是一个翻译助手。将以下内容翻译为与用户提问相同的语言。如果用户用英文提问，翻译为英文；如果用户用中文提问，保持中文。只输出翻译结果，不要添加任何解释。",
 			[]string{pendingMsg},
 			req.Question,
@@ -680,28 +977,62 @@ func (qe *QueryEngine) Query(req QueryRequest) (*QueryResponse, error) {
 		if tErr == nil && translated != "" {
 			pendingMsg = translated
 		}
+		audit.Kind, audit.ModelOutput = AuditKindPending, answer
 		return &QueryResponse{
 			Answer:    pendingMsg,
 			IsPending: true,
 			DebugInfo: dbg,
+			Degraded:  degraded,
+			Audit:     audit,
 		}, nil
 	} else if debugMode {
 		dbg.Steps = append(dbg.Steps, "Step 5.5: LLM answered successfully")
 	}
 
+	// Step 5.6: Optionally check every sentence of the answer against the sources.
+	// Answers to image questions may rely on the image itself and are not checked.
+	var faithfulness *Faithfulness
+	if mode := cfg.Verify.Mode; mode != "" && req.ImageData == "" {
+		generated := answer
+		answer, faithfulness = qe.verifyAnswer(mode, req.Question, answer, results, ls)
+		if answer != generated {
+			audit.ModelOutput = generated
+		}
+		if debugMode {
+			dbg.Faithfulness = faithfulness
+			if faithfulness != nil {
+				dbg.Steps = append(dbg.Steps, fmt.Sprintf("Step 5.6: verified answer, faithfulness=%.2f (%d/%d sentences unsupported, removed=%v)",
+					faithfulness.Score, len(faithfulness.Unsupported), faithfulness.Checked, faithfulness.Removed))
+			} else {
+				dbg.Steps = append(dbg.Steps, "Step 5.6: answer verification skipped or failed")
+			}
+		}
+	}
+
 	// Step 6: Build source references
 	sources := qe.buildSourceRefs(results)
 
+	// Step 6.5: Optionally explain why each source was cited (per-product toggle)
+	if qe.productExplainSources(req.ProductID) {
+		qe.explainSources(req.Question, results, sources, optional)
+		if debugMode {
+			dbg.Steps = append(dbg.Steps, fmt.Sprintf("Step 6.5: generated source explanations for %d sources", len(sources)))
+		}
+	}
+
 	// Append document images that weren't already in search results
 	for _, img := range docImages {
 		sources = append(sources, img)
 	}
 
 	return &QueryResponse{
-		Answer:    answer,
-		Sources:   sources,
-		IsPending: isPending,
-		DebugInfo: dbg,
+		Answer:       answer,
+		Sources:      sources,
+		IsPending:    isPending,
+		Faithfulness: faithfulness,
+		DebugInfo:    dbg,
+		Degraded:     degraded,
+		Audit:        audit,
 	}, nil
 }
 
@@ -720,6 +1051,7 @@ func (qe *QueryEngine) findDocumentImages(results []vectorstore.SearchResult) []
 	// Collect unique document IDs and the chunk indices/times that were hit
 	type docHit struct {
 		name      string
+		productID string
 		indices   []int
 		timeRanges [][2]float64 // [start, end] pairs from search results
 	}
@@ -730,7 +1062,7 @@ func (qe *QueryEngine) findDocumentImages(results []vectorstore.SearchResult) []
 		}
 		h, ok := docHits[r.DocumentID]
 		if !ok {
-			h = &docHit{name: r.DocumentName}
+			h = &docHit{name: r.DocumentName, productID: r.ProductID}
 			docHits[r.DocumentID] = h
 		}
 		h.indices = append(h.indices, r.ChunkIndex)
@@ -742,25 +1074,16 @@ func (qe *QueryEngine) findDocumentImages(results []vectorstore.SearchResult) []
 		return nil
 	}
 
-	// Batch query
-	ids := make([]string, 0, len(docHits))
-	for id := range docHits {
-		ids = append(ids, id)
-	}
-	placeholders := make([]string, len(ids))
-	args := make([]interface{}, len(ids))
-	for i, id := range ids {
-		placeholders[i] = "?"
-		args[i] = id
-	}
-
-	query := `SELECT document_id, chunk_index, image_url, chunk_text FROM chunks WHERE document_id IN (` +
-		strings.Join(placeholders, ",") + `) AND image_url != '' AND image_url IS NOT NULL`
-	rows, err := qe.readDB.Query(query, args...)
-	if err != nil {
-		return nil
+	// Batch query per database: chunks of products with isolated storage
+	// are in the product's storage partition
+	idsByDB := make(map[*sql.DB][]string)
+	for id, h := range docHits {
+		db := qe.readDB
+		if pdb := qe.vectorStore.PartitionDB(h.productID); pdb != nil {
+			db = pdb
+		}
+		idsByDB[db] = append(idsByDB[db], id)
 	}
-	defer rows.Close()
 
 	// Collect all candidate images
 	type imgCandidate struct {
@@ -770,15 +1093,30 @@ func (qe *QueryEngine) findDocumentImages(results []vectorstore.SearchResult) []
 		text  string
 	}
 	var candidates []imgCandidate
-	for rows.Next() {
-		var c imgCandidate
-		if err := rows.Scan(&c.docID, &c.idx, &c.imgURL, &c.text); err != nil {
-			continue
+	for db, ids := range idsByDB {
+		placeholders := make([]string, len(ids))
+		args := make([]interface{}, len(ids))
+		for i, id := range ids {
+			placeholders[i] = "?"
+			args[i] = id
 		}
-		if c.imgURL == "" {
+		query := `SELECT document_id, chunk_index, image_url, chunk_text FROM chunks WHERE document_id IN (` +
+			strings.Join(placeholders, ",") + `) AND image_url != '' AND image_url IS NOT NULL`
+		rows, err := db.Query(query, args...)
+		if err != nil {
 			continue
 		}
-		candidates = append(candidates, c)
+		for rows.Next() {
+			var c imgCandidate
+			if err := rows.Scan(&c.docID, &c.idx, &c.imgURL, &c.text); err != nil {
+				continue
+			}
+			if c.imgURL == "" {
+				continue
+			}
+			candidates = append(candidates, c)
+		}
+		rows.Close()
 	}
 
 	if len(candidates) == 0 {
@@ -970,17 +1308,62 @@ func charBigrams(s string) map[string]bool {
 }
 
 
-// createPendingQuestion inserts a new pending question record into the database.
-func (qe *QueryEngine) createPendingQuestion(question, userID, imageData, productID string) error {
-	id, err := generateID()
+// createPendingQuestion inserts a pending question the engine could not
+// answer, tagged pending.OriginAuto, with the chunks it retrieved for it.
+func (qe *QueryEngine) createPendingQuestion(question, userID, imageData, productID string, results []vectorstore.SearchResult) (string, error) {
+	id, err := idgen.New()
 	if err != nil {
-		return err
+		return "", err
+	}
+	contextJSON := ""
+	if len(results) > 0 {
+		chunks := make([]pending.ContextChunk, len(results))
+		for i, r := range results {
+			chunks[i] = pending.ContextChunk{
+				DocumentID:   r.DocumentID,
+				DocumentName: r.DocumentName,
+				ChunkIndex:   r.ChunkIndex,
+				Score:        r.Score,
+				Text:         textutil.Ellipsize(r.ChunkText, 500),
+			}
+		}
+		if data, err := json.Marshal(chunks); err == nil {
+			contextJSON = string(data)
+		}
 	}
 	_, err = qe.db.Exec(
-		`INSERT INTO pending_questions (id, question, user_id, status, image_data, product_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		id, question, userID, "pending", imageData, productID, time.Now().UTC(),
+		`INSERT INTO pending_questions (id, question, user_id, status, image_data, product_id, origin, context, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, question, userID, "pending", imageData, productID, pending.OriginAuto, contextJSON, time.Now().UTC(),
 	)
-	return err
+	if err != nil {
+		return "", err
+	}
+	qe.mu.RLock()
+	hook := qe.pendingHook
+	qe.mu.RUnlock()
+	if hook != nil {
+		hook(id, question, userID, productID)
+	}
+	return id, nil
+}
+
+// summarizeMissing asks the LLM what the retrieved context lacks to answer
+// a pending question and stores the note for admins. Failures are logged:
+// the question stays in the queue without a summary.
+func (qe *QueryEngine) summarizeMissing(id, question string, context []string, ls llm.LLMService) {
+	summary, err := ls.Generate(
+		"你是知识库维护助手。系统为用户的问题检索到了以下参考资料，但它们不足以回答该问题。"+
+			"请用一到两句话说明回答该问题还缺少哪些信息，便于管理员补充文档。只输出说明，使用中文。",
+		context, question,
+	)
+	if err != nil {
+		log.Printf("[Query] failed to summarize missing information for pending question %s: %v", id, err)
+		return
+	}
+	summary = textutil.Ellipsize(strings.TrimSpace(summary), 1000)
+	if _, err := qe.db.Exec(`UPDATE pending_questions SET missing_summary = ? WHERE id = ?`, summary, id); err != nil {
+		log.Printf("[Query] failed to store missing information summary for pending question %s: %v", id, err)
+	}
 }
 
 // isUnableToAnswer detects if the LLM response indicates it could not find
@@ -1008,16 +1391,6 @@ func isUnableToAnswer(answer string) bool {
 	return false
 }
 
-
-// generateID creates a random hex string for use as a unique identifier.
-func generateID() (string, error) {
-	b := make([]byte, 16)
-	if _, err := rand.Read(b); err != nil {
-		return "", fmt.Errorf("failed to generate ID: %w", err)
-	}
-	return hex.EncodeToString(b), nil
-}
-
 // mergeSearchResults merges two search result sets, deduplicating by (documentID, chunkIndex),
 // keeping the higher score, and returning the top-K results sorted by score descending.
 func mergeSearchResults(a, b []vectorstore.SearchResult, topK int) []vectorstore.SearchResult {
@@ -1152,20 +1525,165 @@ func (qe *QueryEngine) buildSourceRefs(results []vectorstore.SearchResult) []Sou
 
 	sources := make([]SourceRef, len(results))
 	for i, r := range results {
-		snippet := r.ChunkText
-		if runes := []rune(snippet); len(runes) > 100 {
-			snippet = string(runes[:100])
-		}
 		sources[i] = SourceRef{
 			DocumentID:   r.DocumentID,
 			DocumentName: r.DocumentName,
 			DocumentType: docTypes[r.DocumentID],
 			ChunkIndex:   r.ChunkIndex,
-			Snippet:      snippet,
+			Snippet:      textutil.Ellipsize(r.ChunkText, 100),
 			ImageURL:     r.ImageURL,
 			StartTime:    r.StartTime,
 			EndTime:      r.EndTime,
 		}
 	}
+	qe.attachVideoChapters(sources)
+	qe.attachSourceLocations(sources)
 	return sources
 }
+
+// attachSourceLocations links sources from web documents to their page, at
+// the anchor of the heading the chunk falls under when the page has one.
+// Sources from videos imported from a URL link to the video at the cited
+// time. Text chunks get their character range in the document text.
+// Translated chunks use the location of the chunk they were translated from.
+func (qe *QueryEngine) attachSourceLocations(sources []SourceRef) {
+	if qe.readDB == nil {
+		return
+	}
+	for i := range sources {
+		s := &sources[i]
+		if s.DocumentID == "" {
+			continue
+		}
+		var pageURL, anchor string
+		var start, end int
+		err := qe.readDB.QueryRow(
+			`SELECT COALESCE(d.source_url, ''), COALESCE(l.anchor, ''), COALESCE(l.char_start, -1), COALESCE(l.char_end, -1)
+			FROM documents d LEFT JOIN chunk_locations l ON l.document_id = d.id AND l.chunk_index = COALESCE(
+				(SELECT t.source_index FROM chunk_translations t WHERE t.document_id = d.id AND t.chunk_index = ?), ?)
+			WHERE d.id = ?`,
+			s.ChunkIndex, s.ChunkIndex, s.DocumentID,
+		).Scan(&pageURL, &anchor, &start, &end)
+		if err == nil {
+			s.URL = document.AnchoredURL(pageURL, anchor)
+			if anchor == "" && s.StartTime > 0 {
+				s.URL = document.TimedURL(pageURL, s.StartTime)
+			}
+			if start >= 0 && end >= start {
+				s.CharStart, s.CharEnd = &start, &end
+			}
+		}
+	}
+}
+
+// attachVideoChapters fills in chapter information for sources from chaptered videos. The full chapter
+// list is attached once per video so that answers can show it with timestamps.
+func (qe *QueryEngine) attachVideoChapters(sources []SourceRef) {
+	if qe.readDB == nil {
+		return
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, s := range sources {
+		if s.DocumentID != "" && !seen[s.DocumentID] {
+			seen[s.DocumentID] = true
+			ids = append(ids, s.DocumentID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	rows, err := qe.readDB.Query(
+		`SELECT document_id, title, start_time, end_time FROM video_chapters WHERE document_id IN (`+strings.Join(placeholders, ",")+`) ORDER BY document_id, chapter_index`,
+		args...,
+	)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	chapters := make(map[string][]ChapterRef)
+	for rows.Next() {
+		var docID string
+		var ch ChapterRef
+		if err := rows.Scan(&docID, &ch.Title, &ch.StartTime, &ch.EndTime); err != nil {
+			continue
+		}
+		chapters[docID] = append(chapters[docID], ch)
+	}
+
+	listed := make(map[string]bool)
+	for i := range sources {
+		list := chapters[sources[i].DocumentID]
+		if len(list) == 0 {
+			continue
+		}
+		for _, ch := range list {
+			if sources[i].StartTime >= ch.StartTime && sources[i].StartTime < ch.EndTime {
+				sources[i].Chapter = ch.Title
+				break
+			}
+		}
+		if !listed[sources[i].DocumentID] {
+			listed[sources[i].DocumentID] = true
+			sources[i].Chapters = list
+		}
+	}
+}
+
+// productExplainSources reports whether the product has per-citation explanations enabled.
+func (qe *QueryEngine) productExplainSources(productID string) bool {
+	if productID == "" {
+		return false
+	}
+	var enabled int
+	err := qe.readDB.QueryRow("SELECT COALESCE(explain_sources, 0) FROM products WHERE id = ?", productID).Scan(&enabled)
+	return err == nil && enabled == 1
+}
+
+// explainSources asks the LLM for one short sentence per source describing how the
+// retrieved chunk relates to the question, and stores it in SourceRef.Explanation.
+// All sources are explained in a single LLM call; failures are logged and leave
+// explanations empty so the answer itself is never blocked.
+func (qe *QueryEngine) explainSources(question string, results []vectorstore.SearchResult, sources []SourceRef, ls llm.LLMService) {
+	if len(results) == 0 || ls == nil {
+		return
+	}
+	context := make([]string, len(results))
+	for i, r := range results {
+		context[i] = textutil.Truncate(r.ChunkText, 500)
+	}
+	systemPrompt := "你是一个检索结果解释助手。对于每条参考资料，用一句简短的话（不超过40字）说明它与用户问题的关联，即为什么引用它。" +
+		"如果某条资料与问题无关，请如实说明“与问题关联较弱”。" +
+		"\n\n重要规则：使用与用户提问相同的语言。" +
+		fmt.Sprintf("\n\n请只回复一个JSON字符串数组，按参考资料顺序共%d项，例如：[\"说明1\",\"说明2\"]", len(results))
+
+	answer, err := ls.Generate(systemPrompt, context, question)
+	if err != nil {
+		log.Printf("[Query] source explanation failed: %v", err)
+		errlog.Logf("[Query] source explanation failed: %v", err)
+		return
+	}
+	start := strings.Index(answer, "[")
+	end := strings.LastIndex(answer, "]")
+	if start < 0 || end <= start {
+		log.Printf("[Query] source explanation: unparseable LLM output")
+		return
+	}
+	var explanations []string
+	if err := json.Unmarshal([]byte(answer[start:end+1]), &explanations); err != nil {
+		log.Printf("[Query] source explanation: invalid JSON: %v", err)
+		return
+	}
+	for i := range sources {
+		if i >= len(explanations) {
+			break
+		}
+		sources[i].Explanation = strings.TrimSpace(explanations[i])
+	}
+}
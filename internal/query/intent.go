@@ -0,0 +1,65 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"askflow/internal/budget"
+	"askflow/internal/config"
+	"askflow/internal/errlog"
+	"askflow/internal/llm"
+)
+
+// intentWebhookClient posts custom-intent notifications; the timeout keeps a
+// slow receiver from piling up goroutines.
+var intentWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// intentLLM returns the LLM used for intent classification: the product's
+// configured classification model on the main endpoint, or the profile the
+// intent task is routed to.
+func (qe *QueryEngine) intentLLM(ls llm.LLMService, cfg *config.Config, settings *config.IntentSettings) llm.LLMService {
+	if settings == nil || settings.Model == "" || cfg == nil {
+		return llm.ForTask(ls, config.LLMTaskIntent)
+	}
+	// Classification replies are a short JSON object; keep them deterministic and cheap.
+	return budget.Rewrap(ls, llm.NewService(cfg.LLM.Provider, cfg.LLM.Endpoint, cfg.LLM.APIKey, settings.Model, 0, 200))
+}
+
+// replyInQuestionLanguage translates a canned reply into the language of the
+// user's question, falling back to the original text when translation fails.
+func (qe *QueryEngine) replyInQuestionLanguage(ls llm.LLMService, reply, question string) string {
+	translated, err := ls.Generate(
+		"你是一个翻译助手。将以下内容翻译为与用户提问相同的语言。如果用户用英文提问，翻译为英文；如果用户用中文提问，保持中文。只输出翻译结果，不要添加任何解释。",
+		[]string{reply},
+		question,
+	)
+	if err != nil || translated == "" {
+		return reply
+	}
+	return translated
+}
+
+// notifyIntentWebhook posts a question classified into a custom category to
+// the category's webhook. Failures are logged and never affect the answer.
+func notifyIntentWebhook(cat config.IntentCategory, req QueryRequest) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"event":      "intent",
+		"category":   cat.Name,
+		"question":   req.Question,
+		"product_id": req.ProductID,
+		"user_id":    req.UserID,
+		"timestamp":  time.Now().UTC().Format(time.RFC3339),
+	})
+	resp, err := intentWebhookClient.Post(cat.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		errlog.Logf("[Intent] webhook for %q failed: %v", cat.Name, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[Intent] webhook for %q returned status %d", cat.Name, resp.StatusCode)
+	}
+}
@@ -0,0 +1,191 @@
+package query
+
+import (
+	"strings"
+
+	"askflow/internal/config"
+	"askflow/internal/langdetect"
+	"askflow/internal/vectorstore"
+)
+
+// chunkVariant identifies one language version of a source chunk.
+type chunkVariant struct {
+	sourceIndex int
+	language    string
+}
+
+// searchPoolSize widens the vector search when chunks are stored in several
+// languages, so that parallel translations of one passage do not crowd other
+// passages out of the top-K after routeByLanguage collapses them, and when a
+// language filter may drop or demote part of the hits.
+func searchPoolSize(topK int, v config.VectorConfig) int {
+	n := topK * (1 + len(v.TranslateLanguages))
+	if v.LanguageFilter == config.LanguageFilterPrefer || v.LanguageFilter == config.LanguageFilterStrict {
+		n *= 2
+	}
+	return n
+}
+
+// routeByLanguage collapses parallel translations of the same source chunk
+// into a single result, keeping the version written in the question's
+// language (or the best-scoring one when none matches). The collapsed result
+// keeps the best score of its group, so ranking reflects the closest match in
+// any language. Results without translations pass through unchanged.
+//
+// filter (see config.VectorConfig.LanguageFilter) then favors results in the
+// question's language: "prefer" moves them ahead of the others, "strict"
+// drops the others unless no result is in the question's language. The
+// language of an untranslated chunk is that detected for its document, or of
+// the chunk itself for mixed-language documents and documents imported before
+// languages were recorded. At most topK results are returned.
+func (qe *QueryEngine) routeByLanguage(question string, results []vectorstore.SearchResult, topK int, filter string) []vectorstore.SearchResult {
+	if len(results) == 0 {
+		return results
+	}
+	filtering := filter == config.LanguageFilterPrefer || filter == config.LanguageFilterStrict
+	variants := qe.lookupChunkVariants(results)
+	if len(variants) == 0 && !filtering {
+		if len(results) > topK {
+			results = results[:topK]
+		}
+		return results
+	}
+	var docLangs map[string]string
+	if filtering {
+		docLangs = qe.lookupDocumentLanguages(results)
+	}
+
+	qLang := langdetect.Detect(question)
+	type groupKey struct {
+		docID       string
+		sourceIndex int
+	}
+	type group struct {
+		best    vectorstore.SearchResult
+		score   float64
+		matched bool
+	}
+	groups := make(map[groupKey]*group)
+	var order []groupKey
+	for _, r := range results {
+		v, translated := variants[r.DocumentID][r.ChunkIndex]
+		if !translated {
+			v = chunkVariant{sourceIndex: r.ChunkIndex, language: docLangs[r.DocumentID]}
+			if v.language == "" {
+				v.language = langdetect.Detect(r.ChunkText)
+			}
+		}
+		key := groupKey{docID: r.DocumentID, sourceIndex: v.sourceIndex}
+		g, ok := groups[key]
+		if !ok {
+			groups[key] = &group{best: r, score: r.Score, matched: v.language == qLang}
+			order = append(order, key)
+			continue
+		}
+		if r.Score > g.score {
+			g.score = r.Score
+		}
+		if !g.matched && v.language == qLang {
+			g.best = r
+			g.matched = true
+		}
+	}
+
+	var matched, others []vectorstore.SearchResult
+	for _, key := range order {
+		g := groups[key]
+		r := g.best
+		r.Score = g.score
+		if g.matched || !filtering {
+			matched = append(matched, r)
+		} else {
+			others = append(others, r)
+		}
+	}
+	routed := matched
+	if filter == config.LanguageFilterPrefer || len(matched) == 0 {
+		routed = append(routed, others...)
+	}
+	if len(routed) > topK {
+		routed = routed[:topK]
+	}
+	return routed
+}
+
+// lookupDocumentLanguages returns the languages detected for the documents
+// of results, keyed by document ID. Mixed-language documents and documents
+// imported before languages were recorded are left out.
+func (qe *QueryEngine) lookupDocumentLanguages(results []vectorstore.SearchResult) map[string]string {
+	if qe.readDB == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var ids []interface{}
+	for _, r := range results {
+		if r.DocumentID != "" && !seen[r.DocumentID] {
+			seen[r.DocumentID] = true
+			ids = append(ids, r.DocumentID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	rows, err := qe.readDB.Query(
+		`SELECT id, language FROM documents WHERE COALESCE(language, '') != '' AND id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`,
+		ids...,
+	)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	langs := make(map[string]string)
+	for rows.Next() {
+		var id, lang string
+		if err := rows.Scan(&id, &lang); err != nil {
+			continue
+		}
+		langs[id] = lang
+	}
+	return langs
+}
+
+// lookupChunkVariants returns the translation records of the translated
+// chunks among results, keyed by document ID and chunk index.
+func (qe *QueryEngine) lookupChunkVariants(results []vectorstore.SearchResult) map[string]map[int]chunkVariant {
+	if qe.readDB == nil {
+		return nil
+	}
+	var conds []string
+	var args []interface{}
+	for _, r := range results {
+		if r.DocumentID != "" {
+			conds = append(conds, "(document_id = ? AND chunk_index = ?)")
+			args = append(args, r.DocumentID, r.ChunkIndex)
+		}
+	}
+	if len(conds) == 0 {
+		return nil
+	}
+	rows, err := qe.readDB.Query(
+		`SELECT document_id, chunk_index, source_index, language FROM chunk_translations WHERE `+strings.Join(conds, " OR "),
+		args...,
+	)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	variants := make(map[string]map[int]chunkVariant)
+	for rows.Next() {
+		var docID string
+		var idx int
+		var v chunkVariant
+		if err := rows.Scan(&docID, &idx, &v.sourceIndex, &v.language); err != nil {
+			continue
+		}
+		if variants[docID] == nil {
+			variants[docID] = make(map[int]chunkVariant)
+		}
+		variants[docID][idx] = v
+	}
+	return variants
+}
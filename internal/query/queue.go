@@ -0,0 +1,66 @@
+package query
+
+import (
+	"fmt"
+	"time"
+
+	"askflow/internal/config"
+	"askflow/internal/llm"
+)
+
+// newPool creates the generation pool sized from cfg.
+func newPool(cfg *config.Config) *llm.Pool {
+	d := config.DefaultConfig().LLM
+	if cfg != nil {
+		d = cfg.LLM
+	}
+	return llm.NewPool(d.MaxConcurrency, d.MaxQueue, d.MaxQueuedPerUser, time.Duration(d.QueueTimeoutSec)*time.Second)
+}
+
+// generationSlot holds a query's place in the generation pool. The slot is
+// taken on the first LLM call of the query and kept until the query ends, so
+// a query never waits in the queue twice.
+type generationSlot struct {
+	qe      *QueryEngine
+	req     QueryRequest
+	release func()
+}
+
+func (qe *QueryEngine) newGenerationSlot(req QueryRequest) *generationSlot {
+	return &generationSlot{qe: qe, req: req}
+}
+
+// acquire waits for a slot unless the query already holds one. The error
+// wraps llm.ErrBusy, llm.ErrUserQueueFull or llm.ErrQueueTimeout.
+func (s *generationSlot) acquire() error {
+	if s.release != nil {
+		return nil
+	}
+	caller := s.req.Caller
+	if caller == "" {
+		caller = s.req.UserID
+	}
+	release, err := s.qe.pool.Acquire(caller, s.req.Ticket, s.req.Priority)
+	if err != nil {
+		return fmt.Errorf("generation queue: %w", err)
+	}
+	s.release = release
+	return nil
+}
+
+func (s *generationSlot) done() {
+	if s.release != nil {
+		s.release()
+	}
+}
+
+// QueuePosition reports where the query with the given ticket stands in the
+// generation queue: 0 once it is generating. ok is false for unknown tickets.
+func (qe *QueryEngine) QueuePosition(ticket string) (int, bool) {
+	return qe.pool.Position(ticket)
+}
+
+// QueueStats returns the current load of the generation pool.
+func (qe *QueryEngine) QueueStats() llm.PoolStats {
+	return qe.pool.Stats()
+}
@@ -0,0 +1,218 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"askflow/internal/config"
+	"askflow/internal/errlog"
+	"askflow/internal/vectorstore"
+)
+
+// defaultRerankTopN is how many vector hits are reranked when
+// rerank.top_n is not set.
+const defaultRerankTopN = 20
+
+// Reranker re-scores documents against a query with a cross-encoder rerank
+// API. Requests follow the Cohere/Jina format also served by vLLM, Xinference
+// and most OpenAI-compatible gateways: {model, query, documents, top_n}.
+type Reranker struct {
+	Endpoint  string
+	APIKey    string
+	ModelName string
+	client    *http.Client
+}
+
+// RerankResult is the relevance score of one document, by its index in the
+// documents passed to Rerank.
+type RerankResult struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+}
+
+// NewReranker creates a Reranker for the rerank API at endpoint. "/rerank"
+// is appended to the endpoint unless it already ends with it.
+func NewReranker(endpoint, apiKey, modelName string) *Reranker {
+	if apiKey != "" && !strings.HasPrefix(strings.ToLower(endpoint), "https://") {
+		log.Printf("[WARNING] Rerank API key is being sent over non-HTTPS endpoint: %s", endpoint)
+	}
+	return &Reranker{
+		Endpoint:  endpoint,
+		APIKey:    apiKey,
+		ModelName: modelName,
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// newRerankerFromConfig returns the reranker configured in cfg, or nil when
+// reranking is disabled or not fully configured.
+func newRerankerFromConfig(cfg *config.Config) *Reranker {
+	if cfg == nil || !cfg.Rerank.Enabled || cfg.Rerank.Endpoint == "" || cfg.Rerank.ModelName == "" {
+		return nil
+	}
+	return NewReranker(cfg.Rerank.Endpoint, cfg.Rerank.APIKey, cfg.Rerank.ModelName)
+}
+
+type rerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n"`
+}
+
+// rerankItem accepts both the Cohere/Jina field (relevance_score) and the
+// one used by text-embeddings-inference (score).
+type rerankItem struct {
+	Index          int      `json:"index"`
+	RelevanceScore *float64 `json:"relevance_score"`
+	Score          *float64 `json:"score"`
+}
+
+type rerankResponse struct {
+	Results []rerankItem `json:"results"`
+	Data    []rerankItem `json:"data"`
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Rerank scores documents against query and returns the topN most relevant,
+// best first.
+func (r *Reranker) Rerank(query string, documents []string, topN int) ([]RerankResult, error) {
+	if r.Endpoint == "" {
+		return nil, fmt.Errorf("rerank API endpoint not configured")
+	}
+	if len(documents) == 0 {
+		return nil, nil
+	}
+	if topN <= 0 || topN > len(documents) {
+		topN = len(documents)
+	}
+	body, err := json.Marshal(rerankRequest{Model: r.ModelName, Query: query, Documents: documents, TopN: topN})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	apiURL := strings.TrimRight(r.Endpoint, "/")
+	if !strings.HasSuffix(apiURL, "/rerank") {
+		apiURL += "/rerank"
+	}
+	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.APIKey)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rerank API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var parsed rerankResponse
+	var items []rerankItem
+	// text-embeddings-inference answers with a bare array
+	if trimmed := bytes.TrimSpace(respBody); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &items)
+	} else {
+		err = json.Unmarshal(respBody, &parsed)
+		items = parsed.Results
+		if len(items) == 0 {
+			items = parsed.Data
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		if err == nil && parsed.Error != nil {
+			return nil, fmt.Errorf("rerank API error (HTTP %d): %s", resp.StatusCode, parsed.Error.Message)
+		}
+		return nil, fmt.Errorf("rerank API error (HTTP %d): %s", resp.StatusCode, string(respBody))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	results := make([]RerankResult, 0, len(items))
+	seen := make(map[int]bool, len(items))
+	for _, it := range items {
+		if it.Index < 0 || it.Index >= len(documents) || seen[it.Index] {
+			return nil, fmt.Errorf("rerank API returned invalid index %d", it.Index)
+		}
+		seen[it.Index] = true
+		res := RerankResult{Index: it.Index}
+		switch {
+		case it.RelevanceScore != nil:
+			res.Score = *it.RelevanceScore
+		case it.Score != nil:
+			res.Score = *it.Score
+		default:
+			return nil, fmt.Errorf("rerank API returned no score for index %d", it.Index)
+		}
+		results = append(results, res)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("rerank API returned no results")
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > topN {
+		results = results[:topN]
+	}
+	return results, nil
+}
+
+// rerankPoolSize is how many vector hits are reranked to pick the topK
+// results.
+func rerankPoolSize(cfg *config.Config, topK int) int {
+	n := cfg.Rerank.TopN
+	if n <= 0 {
+		n = defaultRerankTopN
+	}
+	if n < topK {
+		n = topK
+	}
+	return n
+}
+
+// rerankResults reorders results by their rerank score and keeps the best
+// topK. Results keep their vector similarity in Score, which thresholds and
+// confidence checks are calibrated on; the rerank score is set in
+// RerankScore. When the rerank API fails, the vector order is kept.
+func rerankResults(rr *Reranker, question string, results []vectorstore.SearchResult, topK int) ([]vectorstore.SearchResult, error) {
+	if len(results) <= 1 {
+		return results, nil
+	}
+	docs := make([]string, len(results))
+	for i, r := range results {
+		docs[i] = r.ChunkText
+		if strings.TrimSpace(docs[i]) == "" {
+			// Image chunks carry no text; rank them by their document name
+			docs[i] = r.DocumentName
+		}
+	}
+	ranked, err := rr.Rerank(question, docs, topK)
+	if err != nil {
+		errlog.Logf("[Query] rerank failed, keeping vector order: %v", err)
+		if len(results) > topK {
+			results = results[:topK]
+		}
+		return results, err
+	}
+	reranked := make([]vectorstore.SearchResult, 0, len(ranked))
+	for _, rk := range ranked {
+		r := results[rk.Index]
+		r.RerankScore = rk.Score
+		reranked = append(reranked, r)
+	}
+	return reranked, nil
+}
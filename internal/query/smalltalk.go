@@ -0,0 +1,95 @@
+package query
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"askflow/internal/config"
+	"askflow/internal/langdetect"
+)
+
+// greetedLogMax bounds the users remembered by greetedLog; expired entries
+// are pruned once it is reached.
+const greetedLogMax = 10000
+
+// normalizeSmallTalk lowercases s and drops punctuation, symbols (including
+// emoji) and spaces, so "Thanks!!" and "thanks 🙏" compare equal.
+func normalizeSmallTalk(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+// matchSmallTalk returns the rule whose phrase the whole question is, or nil.
+func matchSmallTalk(rules []config.SmallTalkRule, question string) *config.SmallTalkRule {
+	q := normalizeSmallTalk(question)
+	if q == "" || len([]rune(q)) > config.MaxSmallTalkPhraseRunes {
+		return nil
+	}
+	for i := range rules {
+		for _, p := range rules[i].Phrases {
+			if normalizeSmallTalk(p) == q {
+				return &rules[i]
+			}
+		}
+	}
+	return nil
+}
+
+// greetedLog remembers when users were last shown the product intro.
+type greetedLog struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// due reports whether userID should be shown the intro, i.e. was not shown
+// it within interval, and records that it is shown now. Anonymous users are
+// always due.
+func (g *greetedLog) due(userID string, interval time.Duration) bool {
+	if userID == "" {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	if last, ok := g.seen[userID]; ok && now.Sub(last) < interval {
+		return false
+	}
+	if g.seen == nil {
+		g.seen = make(map[string]time.Time)
+	}
+	if len(g.seen) >= greetedLogMax {
+		for id, t := range g.seen {
+			if now.Sub(t) >= interval {
+				delete(g.seen, id)
+			}
+		}
+	}
+	g.seen[userID] = now
+	return true
+}
+
+// smallTalkReply answers a matched small talk rule. Greetings get the
+// product intro, at most once per user and intro interval, and the rule's
+// short reply otherwise. translate is set when the intro is not written in
+// the rule's language and should be translated by the LLM; every other reply
+// needs no LLM call.
+func (qe *QueryEngine) smallTalkReply(rule *config.SmallTalkRule, userID string, cfg *config.Config) (reply string, translate bool) {
+	if rule.Kind != config.SmallTalkGreeting {
+		return rule.Reply, false
+	}
+	interval := time.Duration(cfg.SmallTalk.EffectiveIntroIntervalMin()) * time.Minute
+	if !qe.greeted.due(userID, interval) && rule.Reply != "" {
+		return rule.Reply, false
+	}
+	intro := "您好！欢迎使用我们的产品。"
+	if cfg.ProductIntro != "" {
+		intro = cfg.ProductIntro
+	}
+	return intro, rule.Language != "" && langdetect.Detect(intro) != rule.Language
+}
@@ -0,0 +1,154 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"askflow/internal/config"
+	"askflow/internal/errlog"
+	"askflow/internal/llm"
+	"askflow/internal/textutil"
+	"askflow/internal/vectorstore"
+)
+
+// Faithfulness is the result of checking an answer against its sources.
+type Faithfulness struct {
+	Score       float64  `json:"score"`   // share of checked sentences supported by the sources, 0-1
+	Checked     int      `json:"checked"` // sentences checked; headings and list markers are skipped
+	Unsupported []string `json:"unsupported,omitempty"`
+	Removed     bool     `json:"removed,omitempty"` // unsupported sentences were dropped from the answer
+}
+
+// minCheckedSentenceRunes is the length below which a sentence is not sent
+// for verification (list markers, "Note:", short connectives).
+const minCheckedSentenceRunes = 6
+
+// splitSentences splits an answer into sentences at sentence-ending
+// punctuation and line breaks. Concatenating the pieces yields the answer
+// again, so unsupported sentences can be cut out without touching the rest.
+// A "." ending a number at the start of a piece ("1.", "2.5") does not split.
+func splitSentences(answer string) []string {
+	var pieces []string
+	runes := []rune(answer)
+	start := 0
+	for i, r := range runes {
+		split := false
+		switch r {
+		case '。', '！', '？', '!', '?', '；', '\n':
+			split = true
+		case '.':
+			next := rune(' ')
+			if i+1 < len(runes) {
+				next = runes[i+1]
+			}
+			head := strings.TrimSpace(string(runes[start:i]))
+			split = unicode.IsSpace(next) && strings.TrimFunc(head, unicode.IsDigit) != ""
+		}
+		if !split {
+			continue
+		}
+		// Keep trailing spaces with the sentence they follow
+		end := i + 1
+		for end < len(runes) && runes[end] == ' ' && r != '\n' {
+			end++
+		}
+		if end > start {
+			pieces = append(pieces, string(runes[start:end]))
+			start = end
+		}
+	}
+	if start < len(runes) {
+		pieces = append(pieces, string(runes[start:]))
+	}
+	return pieces
+}
+
+// checkable reports whether a sentence carries a claim worth verifying.
+func checkable(s string) bool {
+	s = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(s), "#>*-•0123456789.) "))
+	return len([]rune(s)) >= minCheckedSentenceRunes
+}
+
+// markerOnlyLineRe matches lines left with only a list marker after sentence removal.
+var markerOnlyLineRe = regexp.MustCompile(`(?m)^[ \t]*(?:[-*•]|\d+[.)])[ \t]*\n`)
+
+// verifyAnswer asks the LLM whether each sentence of the answer is supported
+// by the retrieved chunks. In VerifyModeRemove unsupported sentences are cut
+// from the returned answer, unless that would leave nothing. Failures are
+// logged and return a nil result with the answer unchanged; verification
+// never blocks an answer.
+func (qe *QueryEngine) verifyAnswer(mode, question, answer string, results []vectorstore.SearchResult, ls llm.LLMService) (string, *Faithfulness) {
+	if ls == nil || len(results) == 0 {
+		return answer, nil
+	}
+	pieces := splitSentences(answer)
+	var idx []int
+	var numbered strings.Builder
+	for i, p := range pieces {
+		if checkable(p) {
+			idx = append(idx, i)
+			fmt.Fprintf(&numbered, "[%d] %s\n", len(idx), strings.TrimSpace(p))
+		}
+	}
+	if len(idx) == 0 {
+		return answer, nil
+	}
+
+	context := make([]string, len(results))
+	for i, r := range results {
+		context[i] = textutil.Truncate(r.ChunkText, 1500)
+	}
+	systemPrompt := "你是一个事实核查助手。下面的用户消息是对问题“" + question + "”的回答，已拆分为编号句子。" +
+		"请逐句判断该句内容是否能由参考资料支持（明确陈述或可直接推出）。礼貌用语、引导查看图片等不含事实的句子视为支持。" +
+		fmt.Sprintf("\n\n请只回复一个JSON布尔数组，按句子编号顺序共%d项，true表示有依据，false表示参考资料中没有依据，例如：[true,false]", len(idx))
+
+	reply, err := ls.Generate(systemPrompt, context, numbered.String())
+	if err != nil {
+		log.Printf("[Query] answer verification failed: %v", err)
+		errlog.Logf("[Query] answer verification failed: %v", err)
+		return answer, nil
+	}
+	start := strings.Index(reply, "[")
+	end := strings.LastIndex(reply, "]")
+	if start < 0 || end <= start {
+		log.Printf("[Query] answer verification: unparseable LLM output")
+		return answer, nil
+	}
+	var supported []bool
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &supported); err != nil || len(supported) != len(idx) {
+		log.Printf("[Query] answer verification: expected %d verdicts, got %d (%v)", len(idx), len(supported), err)
+		return answer, nil
+	}
+
+	f := &Faithfulness{Checked: len(idx)}
+	drop := make(map[int]bool)
+	for n, i := range idx {
+		if !supported[n] {
+			f.Unsupported = append(f.Unsupported, strings.TrimSpace(pieces[i]))
+			drop[i] = true
+		}
+	}
+	f.Score = float64(len(idx)-len(drop)) / float64(len(idx))
+	if mode != config.VerifyModeRemove || len(drop) == 0 || len(drop) == len(idx) {
+		return answer, f
+	}
+
+	var b strings.Builder
+	for i, p := range pieces {
+		if !drop[i] {
+			b.WriteString(p)
+		} else if strings.HasSuffix(p, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	cleaned := markerOnlyLineRe.ReplaceAllString(b.String(), "")
+	for strings.Contains(cleaned, "\n\n\n") {
+		cleaned = strings.ReplaceAll(cleaned, "\n\n\n", "\n\n")
+	}
+	f.Removed = true
+	return strings.TrimSpace(cleaned), f
+}
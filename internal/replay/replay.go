@@ -0,0 +1,432 @@
+// Package replay re-asks saved samples of real user queries through the
+// current answer pipeline and compares the answers and sources with an
+// earlier run, so admins can see what a config or model change does to
+// answers before rolling it out.
+//
+// A sample copies a random set of logged queries together with the answers
+// and sources they got at the time, which serve as the baseline of its first
+// run. Each run is recorded under the ID of the background job replaying it.
+package replay
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"askflow/internal/idgen"
+)
+
+const (
+	// DefaultSampleSize is the number of queries sampled when none is given.
+	DefaultSampleSize = 50
+	// MaxSampleSize bounds a sample, since every run asks each query again.
+	MaxSampleSize = 500
+	maxNameRunes  = 100
+
+	dayLayout = "2006-01-02"
+	// logTimeLayout is the format query log times are stored in.
+	logTimeLayout = "2006-01-02 15:04:05"
+)
+
+// BaselineOriginal compares a run with the answers the sampled queries got
+// when users asked them.
+const BaselineOriginal = "original"
+
+var (
+	// ErrNotFound is returned for an unknown sample or run.
+	ErrNotFound = errors.New("回放样本或记录不存在")
+	// ErrRunning is returned when a sample is already being replayed.
+	ErrRunning = errors.New("该样本正在回放中")
+)
+
+// Sample is a saved set of logged queries.
+type Sample struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	ProductID string    `json:"product_id"` // "" samples queries of all products
+	Size      int       `json:"size"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SampleInput selects the queries of a new sample. From and To bound the
+// day the queries were asked (YYYY-MM-DD, inclusive); either may be empty.
+type SampleInput struct {
+	Name      string `json:"name"`
+	ProductID string `json:"product_id"`
+	Size      int    `json:"size"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+}
+
+// Query is a sampled query with the outcome it got when it was logged.
+type Query struct {
+	Position  int    `json:"position"`
+	QueryID   string `json:"query_id"`
+	ProductID string `json:"product_id"`
+	Question  string `json:"question"`
+	Outcome
+}
+
+// Outcome is how a query was answered.
+type Outcome struct {
+	Answer    string   `json:"answer"`
+	Sources   []Source `json:"sources"`
+	IsPending bool     `json:"is_pending"`
+}
+
+// Source is a chunk cited by an answer, in the JSON form of query logs.
+type Source struct {
+	DocumentID   string `json:"document_id,omitempty"`
+	DocumentName string `json:"document_name"`
+	ChunkIndex   int    `json:"chunk_index"`
+}
+
+// key identifies the chunk a source cites.
+func (s Source) key() string {
+	if s.DocumentID != "" {
+		return fmt.Sprintf("%s#%d", s.DocumentID, s.ChunkIndex)
+	}
+	return fmt.Sprintf("%s#%d", s.DocumentName, s.ChunkIndex)
+}
+
+// label names the chunk a source cites in reports.
+func (s Source) label() string {
+	name := s.DocumentName
+	if name == "" {
+		name = s.DocumentID
+	}
+	return fmt.Sprintf("%s #%d", name, s.ChunkIndex)
+}
+
+// Settings records the parts of the config a run answered with, shown next
+// to the change report.
+type Settings struct {
+	LLMModel       string  `json:"llm_model"`
+	EmbeddingModel string  `json:"embedding_model"`
+	Temperature    float64 `json:"temperature"`
+	TopK           int     `json:"top_k"`
+	Threshold      float64 `json:"threshold"`
+}
+
+// Run is one replay of a sample. Its ID is the ID of the background job.
+type Run struct {
+	ID        string    `json:"id"`
+	SampleID  string    `json:"sample_id"`
+	Settings  Settings  `json:"settings"`
+	Replayed  int       `json:"replayed"` // queries answered so far
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	// Status is the state of the run's job, filled in by callers; empty
+	// once the job record was pruned.
+	Status string `json:"status,omitempty"`
+}
+
+// Service stores samples, runs and their results.
+type Service struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+}
+
+// NewService creates a new replay Service.
+func NewService(readDB, writeDB *sql.DB) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB}
+}
+
+// CreateSample copies a random set of logged queries, one per distinct
+// question and product, into a new sample.
+func (s *Service) CreateSample(in SampleInput, createdBy string) (*Sample, error) {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		in.Name = "样本 " + time.Now().Format("2006-01-02 15:04")
+	}
+	if utf8.RuneCountInString(in.Name) > maxNameRunes {
+		return nil, fmt.Errorf("样本名称长度不能超过 %d 个字符", maxNameRunes)
+	}
+	if in.Size == 0 {
+		in.Size = DefaultSampleSize
+	}
+	if in.Size < 1 || in.Size > MaxSampleSize {
+		return nil, fmt.Errorf("样本数量应在 1 到 %d 之间", MaxSampleSize)
+	}
+	where := ` WHERE question != ''`
+	var args []interface{}
+	if in.ProductID != "" {
+		where += ` AND product_id = ?`
+		args = append(args, in.ProductID)
+	}
+	if in.From != "" {
+		t, err := time.ParseInLocation(dayLayout, in.From, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("开始日期格式无效，应为 YYYY-MM-DD")
+		}
+		where += ` AND created_at >= ?`
+		args = append(args, t.UTC().Format(logTimeLayout))
+	}
+	if in.To != "" {
+		t, err := time.ParseInLocation(dayLayout, in.To, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("结束日期格式无效，应为 YYYY-MM-DD")
+		}
+		where += ` AND created_at < ?`
+		args = append(args, t.AddDate(0, 0, 1).UTC().Format(logTimeLayout))
+	}
+	// Oversample so duplicates of frequent questions can be dropped
+	rows, err := s.readDB.Query(`SELECT id, COALESCE(product_id, ''), question, COALESCE(answer, ''), COALESCE(sources, ''), is_pending
+		FROM query_logs`+where+` ORDER BY RANDOM() LIMIT ?`, append(args, in.Size*3)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample queries: %w", err)
+	}
+	var queries []Query
+	seen := make(map[string]bool)
+	for rows.Next() && len(queries) < in.Size {
+		var q Query
+		var sources string
+		if err := rows.Scan(&q.QueryID, &q.ProductID, &q.Question, &q.Answer, &sources, &q.IsPending); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan query: %w", err)
+		}
+		key := q.ProductID + "\x00" + strings.ToLower(strings.Join(strings.Fields(q.Question), " "))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		q.Sources = parseSources(sources)
+		q.Position = len(queries) + 1
+		queries = append(queries, q)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("没有符合条件的查询记录")
+	}
+
+	id, err := idgen.New()
+	if err != nil {
+		return nil, err
+	}
+	sample := &Sample{ID: id, Name: in.Name, ProductID: in.ProductID, Size: len(queries), CreatedBy: createdBy, CreatedAt: time.Now().UTC()}
+	tx, err := s.writeDB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT INTO replay_samples (id, name, product_id, size, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		sample.ID, sample.Name, sample.ProductID, sample.Size, sample.CreatedBy, sample.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to insert sample: %w", err)
+	}
+	for _, q := range queries {
+		sources, _ := json.Marshal(q.Sources)
+		if _, err := tx.Exec(`INSERT INTO replay_sample_queries (sample_id, position, query_id, product_id, question, answer, sources, is_pending)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			sample.ID, q.Position, q.QueryID, q.ProductID, q.Question, q.Answer, string(sources), q.IsPending); err != nil {
+			return nil, fmt.Errorf("failed to insert sampled query: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit sample: %w", err)
+	}
+	return sample, nil
+}
+
+// Samples returns all samples, newest first.
+func (s *Service) Samples() ([]Sample, error) {
+	rows, err := s.readDB.Query(`SELECT id, name, product_id, size, created_by, created_at FROM replay_samples ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list samples: %w", err)
+	}
+	defer rows.Close()
+	list := []Sample{}
+	for rows.Next() {
+		var sm Sample
+		if err := rows.Scan(&sm.ID, &sm.Name, &sm.ProductID, &sm.Size, &sm.CreatedBy, &sm.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sample: %w", err)
+		}
+		list = append(list, sm)
+	}
+	return list, rows.Err()
+}
+
+// Sample returns a sample and its queries in order.
+func (s *Service) Sample(id string) (*Sample, []Query, error) {
+	var sm Sample
+	err := s.writeDB.QueryRow(`SELECT id, name, product_id, size, created_by, created_at FROM replay_samples WHERE id = ?`, id).
+		Scan(&sm.ID, &sm.Name, &sm.ProductID, &sm.Size, &sm.CreatedBy, &sm.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get sample: %w", err)
+	}
+	rows, err := s.readDB.Query(`SELECT position, query_id, product_id, question, answer, sources, is_pending
+		FROM replay_sample_queries WHERE sample_id = ? ORDER BY position`, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query sampled queries: %w", err)
+	}
+	defer rows.Close()
+	var queries []Query
+	for rows.Next() {
+		var q Query
+		var sources string
+		if err := rows.Scan(&q.Position, &q.QueryID, &q.ProductID, &q.Question, &q.Answer, &sources, &q.IsPending); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan sampled query: %w", err)
+		}
+		q.Sources = parseSources(sources)
+		queries = append(queries, q)
+	}
+	return &sm, queries, rows.Err()
+}
+
+// DeleteSample removes a sample with its runs and their results.
+func (s *Service) DeleteSample(id string) error {
+	tx, err := s.writeDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM replay_samples WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete sample: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	for _, stmt := range []string{
+		`DELETE FROM replay_results WHERE run_id IN (SELECT id FROM replay_runs WHERE sample_id = ?)`,
+		`DELETE FROM replay_runs WHERE sample_id = ?`,
+		`DELETE FROM replay_sample_queries WHERE sample_id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return fmt.Errorf("failed to delete sample data: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// CreateRun records a run of a sample under the ID of the job replaying it.
+func (s *Service) CreateRun(id, sampleID string, settings Settings, createdBy string) error {
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if _, err := s.writeDB.Exec(`INSERT INTO replay_runs (id, sample_id, settings, created_by, created_at) VALUES (?, ?, ?, ?, ?)`,
+		id, sampleID, string(raw), createdBy, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to insert replay run: %w", err)
+	}
+	return nil
+}
+
+const runColumns = `r.id, r.sample_id, r.settings, r.created_by, r.created_at,
+	(SELECT COUNT(*) FROM replay_results WHERE run_id = r.id)`
+
+func scanRun(scan func(dest ...interface{}) error) (*Run, error) {
+	var r Run
+	var settings string
+	if err := scan(&r.ID, &r.SampleID, &settings, &r.CreatedBy, &r.CreatedAt, &r.Replayed); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(settings), &r.Settings)
+	return &r, nil
+}
+
+// Run returns a single run.
+func (s *Service) Run(id string) (*Run, error) {
+	r, err := scanRun(s.writeDB.QueryRow(`SELECT `+runColumns+` FROM replay_runs r WHERE r.id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replay run: %w", err)
+	}
+	return r, nil
+}
+
+// Runs returns the runs of a sample, newest first.
+func (s *Service) Runs(sampleID string) ([]Run, error) {
+	rows, err := s.readDB.Query(`SELECT `+runColumns+` FROM replay_runs r WHERE r.sample_id = ? ORDER BY r.created_at DESC`, sampleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replay runs: %w", err)
+	}
+	defer rows.Close()
+	list := []Run{}
+	for rows.Next() {
+		r, err := scanRun(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan replay run: %w", err)
+		}
+		list = append(list, *r)
+	}
+	return list, rows.Err()
+}
+
+// Replay asks the queries again with ask, one at a time, and records each
+// outcome under runID; a failed query is recorded with its error. progress
+// is told the number of queries done and failed after each one. Replay
+// stops early when ctx is canceled.
+func (s *Service) Replay(ctx context.Context, runID string, queries []Query, ask func(Query) (*Outcome, error), progress func(done, failed int)) error {
+	var failed int
+	for i, q := range queries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		out, err := ask(q)
+		var errText string
+		if err != nil {
+			failed++
+			errText = err.Error()
+			out = &Outcome{}
+		}
+		sources, _ := json.Marshal(out.Sources)
+		if _, err := s.writeDB.Exec(`INSERT OR REPLACE INTO replay_results (run_id, position, answer, sources, is_pending, error) VALUES (?, ?, ?, ?, ?, ?)`,
+			runID, q.Position, out.Answer, string(sources), out.IsPending, errText); err != nil {
+			return fmt.Errorf("failed to record replay result: %w", err)
+		}
+		progress(i+1, failed)
+	}
+	return nil
+}
+
+// results returns the recorded outcomes of a run by query position, with
+// the error of each failed query.
+func (s *Service) results(runID string) (map[int]Outcome, map[int]string, error) {
+	rows, err := s.readDB.Query(`SELECT position, answer, sources, is_pending, error FROM replay_results WHERE run_id = ?`, runID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query replay results: %w", err)
+	}
+	defer rows.Close()
+	outcomes := make(map[int]Outcome)
+	errs := make(map[int]string)
+	for rows.Next() {
+		var pos int
+		var o Outcome
+		var sources, errText string
+		if err := rows.Scan(&pos, &o.Answer, &sources, &o.IsPending, &errText); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan replay result: %w", err)
+		}
+		o.Sources = parseSources(sources)
+		outcomes[pos] = o
+		if errText != "" {
+			errs[pos] = errText
+		}
+	}
+	return outcomes, errs, rows.Err()
+}
+
+func parseSources(raw string) []Source {
+	var sources []Source
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &sources)
+	}
+	if sources == nil {
+		sources = []Source{}
+	}
+	return sources
+}
@@ -0,0 +1,216 @@
+package replay
+
+import (
+	"strings"
+)
+
+// Report compares the outcomes of a run with a baseline: an earlier run of
+// the same sample, or BaselineOriginal.
+type Report struct {
+	Run              *Run      `json:"run"`
+	Sample           *Sample   `json:"sample"`
+	Baseline         string    `json:"baseline"` // BaselineOriginal or a run ID
+	BaselineSettings *Settings `json:"baseline_settings,omitempty"`
+	Summary          Summary   `json:"summary"`
+	Items            []Item    `json:"items"`
+}
+
+// Summary counts the changes of a run. Queries not replayed yet are left
+// out of every count but Total.
+type Summary struct {
+	Total          int     `json:"total"`
+	Replayed       int     `json:"replayed"`
+	Unchanged      int     `json:"unchanged"`
+	AnswerChanged  int     `json:"answer_changed"`
+	SourcesChanged int     `json:"sources_changed"`
+	NewlyPending   int     `json:"newly_pending"`  // answered in the baseline, sent to the pending queue now
+	NewlyAnswered  int     `json:"newly_answered"` // pending in the baseline, answered now
+	Failed         int     `json:"failed"`
+	AvgSimilarity  float64 `json:"avg_similarity"` // mean answer similarity of the queries replayed without error
+}
+
+// Item is the change of one query.
+type Item struct {
+	Position        int      `json:"position"`
+	QueryID         string   `json:"query_id"`
+	ProductID       string   `json:"product_id"`
+	Question        string   `json:"question"`
+	Answer          string   `json:"answer"`
+	BaselineAnswer  string   `json:"baseline_answer"`
+	Pending         bool     `json:"pending"`
+	BaselinePending bool     `json:"baseline_pending"`
+	Similarity      float64  `json:"similarity"` // 0–1 overlap of the two answers' character pairs
+	AnswerChanged   bool     `json:"answer_changed"`
+	SourcesChanged  bool     `json:"sources_changed"`
+	AddedSources    []string `json:"added_sources,omitempty"`
+	RemovedSources  []string `json:"removed_sources,omitempty"`
+	Replayed        bool     `json:"replayed"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// Changed reports whether the query was answered differently.
+func (it Item) Changed() bool {
+	return it.AnswerChanged || it.SourcesChanged || it.Pending != it.BaselinePending
+}
+
+// Report compares run runID with baseline, BaselineOriginal or the ID of an
+// earlier run of the same sample.
+func (s *Service) Report(runID, baseline string) (*Report, error) {
+	run, err := s.Run(runID)
+	if err != nil {
+		return nil, err
+	}
+	sample, queries, err := s.Sample(run.SampleID)
+	if err != nil {
+		return nil, err
+	}
+	rep := &Report{Run: run, Sample: sample, Baseline: BaselineOriginal, Items: []Item{}}
+
+	base := make(map[int]Outcome, len(queries))
+	for _, q := range queries {
+		base[q.Position] = q.Outcome
+	}
+	if baseline != "" && baseline != BaselineOriginal {
+		b, err := s.Run(baseline)
+		if err != nil {
+			return nil, err
+		}
+		if b.SampleID != run.SampleID {
+			return nil, ErrNotFound
+		}
+		outcomes, _, err := s.results(b.ID)
+		if err != nil {
+			return nil, err
+		}
+		// Queries the baseline run did not reach keep the original outcome
+		for pos, o := range outcomes {
+			base[pos] = o
+		}
+		rep.Baseline = b.ID
+		rep.BaselineSettings = &b.Settings
+	}
+
+	outcomes, errs, err := s.results(run.ID)
+	if err != nil {
+		return nil, err
+	}
+	var similarity float64
+	var compared int
+	for _, q := range queries {
+		b := base[q.Position]
+		it := Item{
+			Position:        q.Position,
+			QueryID:         q.QueryID,
+			ProductID:       q.ProductID,
+			Question:        q.Question,
+			BaselineAnswer:  b.Answer,
+			BaselinePending: b.IsPending,
+		}
+		rep.Summary.Total++
+		o, ok := outcomes[q.Position]
+		if !ok {
+			rep.Items = append(rep.Items, it)
+			continue
+		}
+		it.Replayed = true
+		rep.Summary.Replayed++
+		if e := errs[q.Position]; e != "" {
+			it.Error = e
+			rep.Summary.Failed++
+			rep.Items = append(rep.Items, it)
+			continue
+		}
+		it.Answer, it.Pending = o.Answer, o.IsPending
+		it.Similarity = Similarity(b.Answer, o.Answer)
+		it.AnswerChanged = normalizeAnswer(b.Answer) != normalizeAnswer(o.Answer)
+		it.AddedSources, it.RemovedSources = diffSources(b.Sources, o.Sources)
+		it.SourcesChanged = len(it.AddedSources) > 0 || len(it.RemovedSources) > 0
+		similarity += it.Similarity
+		compared++
+
+		if it.AnswerChanged {
+			rep.Summary.AnswerChanged++
+		}
+		if it.SourcesChanged {
+			rep.Summary.SourcesChanged++
+		}
+		switch {
+		case it.Pending && !it.BaselinePending:
+			rep.Summary.NewlyPending++
+		case !it.Pending && it.BaselinePending:
+			rep.Summary.NewlyAnswered++
+		}
+		if !it.Changed() {
+			rep.Summary.Unchanged++
+		}
+		rep.Items = append(rep.Items, it)
+	}
+	if compared > 0 {
+		rep.Summary.AvgSimilarity = similarity / float64(compared)
+	}
+	return rep, nil
+}
+
+// diffSources returns the labels of the chunks cited only by now and only
+// by before.
+func diffSources(before, now []Source) (added, removed []string) {
+	had := make(map[string]bool, len(before))
+	for _, s := range before {
+		had[s.key()] = true
+	}
+	has := make(map[string]bool, len(now))
+	for _, s := range now {
+		has[s.key()] = true
+		if !had[s.key()] {
+			added = append(added, s.label())
+		}
+	}
+	for _, s := range before {
+		if !has[s.key()] {
+			removed = append(removed, s.label())
+		}
+	}
+	return added, removed
+}
+
+// normalizeAnswer collapses whitespace, so reflowed answers compare equal.
+func normalizeAnswer(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Similarity returns the Dice coefficient of the character pairs of a and
+// b, ignoring whitespace: 1 for equal texts, 0 for texts without a pair in
+// common. It works the same for CJK and space-separated text.
+func Similarity(a, b string) float64 {
+	pa, pb := charPairs(a), charPairs(b)
+	if len(pa) == 0 && len(pb) == 0 {
+		if normalizeAnswer(a) == normalizeAnswer(b) {
+			return 1
+		}
+		return 0
+	}
+	counts := make(map[string]int, len(pa))
+	for _, p := range pa {
+		counts[p]++
+	}
+	var common int
+	for _, p := range pb {
+		if counts[p] > 0 {
+			counts[p]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(pa)+len(pb))
+}
+
+func charPairs(s string) []string {
+	runes := []rune(strings.ToLower(strings.Join(strings.Fields(s), "")))
+	if len(runes) < 2 {
+		return nil
+	}
+	pairs := make([]string, 0, len(runes)-1)
+	for i := 0; i+1 < len(runes); i++ {
+		pairs = append(pairs, string(runes[i:i+2]))
+	}
+	return pairs
+}
@@ -15,19 +15,29 @@ import (
 // It creates middleware instances internally and groups routes by business domain.
 // Returns a cleanup function that should be called on shutdown to stop background goroutines.
 func Register(app *handler.App) func() {
-	// Build the secure API middleware chain: SecurityHeaders + CORS + RequestID
+	return RegisterMux(http.DefaultServeMux, app)
+}
+
+// RegisterMux is Register for a given mux, so that several apps (e.g. in
+// integration tests) can each serve their own routes.
+func RegisterMux(mux *http.ServeMux, app *handler.App) func() {
+	// Build the secure API middleware chain: SecurityHeaders + CORS + RequestID + SessionActivity
 	secureAPI := middleware.Chain(
 		middleware.SecurityHeaders(),
-		middleware.CORS(),
+		middleware.CORS(app.ExternalOrigin),
 		middleware.RequestID(),
+		handler.SessionActivity(app),
 	)
 
-	// Auth rate limiter: 10 attempts per minute per IP
+	// Auth rate limiter: 10 attempts per minute per IP. It also guards
+	// /api/query; the chat client warns users once 3 or fewer questions remain.
 	authRL := middleware.NewRateLimiter(10, 1*time.Minute)
+	authRL.SetWarnThreshold(3)
 	rateLimit := authRL.Limit()
 
 	// API rate limiter: 60 requests per minute per IP (for non-auth endpoints like translate)
 	apiRL := middleware.NewRateLimiter(60, 1*time.Minute)
+	apiRL.SetWarnThreshold(10)
 	apiRateLimit := apiRL.Limit()
 
 	// Helper to apply secureAPI chain
@@ -45,63 +55,147 @@ func Register(app *handler.App) func() {
 		return secureAPI(apiRateLimit(h))
 	}
 
+	// Read-only (demo) guard: rejects mutating requests on admin/write routes when enabled.
+	// Query, login and other end-user endpoints are deliberately left unguarded.
+	readOnly := handler.ReadOnlyGuard(app)
+
+	// Helper to apply secureAPI + read-only guard
+	secureRO := func(h http.HandlerFunc) http.HandlerFunc {
+		return secureAPI(readOnly(h))
+	}
+
 	// ── OAuth ──
-	http.HandleFunc("/api/oauth/url", secure(handler.HandleOAuthURL(app)))
-	http.HandleFunc("/api/oauth/callback", secureRL(handler.HandleOAuthCallback(app)))
-	http.HandleFunc("/api/oauth/providers/", secure(handler.HandleOAuthProviderDelete(app)))
+	mux.HandleFunc("/api/oauth/url", secure(handler.HandleOAuthURL(app)))
+	mux.HandleFunc("/api/oauth/callback", secureRL(handler.HandleOAuthCallback(app)))
+	mux.HandleFunc("/api/oauth/providers/", secureRO(handler.HandleOAuthProviderDelete(app)))
 
 	// ── Admin login ──
-	http.HandleFunc("/api/admin/login", secureRL(handler.HandleAdminLogin(app)))
-	http.HandleFunc("/api/admin/anonymous-login", secureRL(handler.HandleAnonymousLogin(app)))
-	http.HandleFunc("/api/admin/setup", secureRL(handler.HandleAdminSetup(app)))
-	http.HandleFunc("/api/admin/status", secure(handler.HandleAdminStatus(app)))
+	mux.HandleFunc("/api/admin/login", secureRL(handler.HandleAdminLogin(app)))
+	mux.HandleFunc("/api/admin/anonymous-login", secureRL(handler.HandleAnonymousLogin(app)))
+	mux.HandleFunc("/api/admin/setup", secureRL(handler.HandleAdminSetup(app)))
+	mux.HandleFunc("/api/admin/status", secure(handler.HandleAdminStatus(app)))
 
 	// ── User registration & login ──
-	http.HandleFunc("/api/auth/register", secureRL(handler.HandleRegister(app)))
-	http.HandleFunc("/api/auth/login", secureRL(handler.HandleUserLogin(app)))
-	http.HandleFunc("/api/auth/anonymous-login", secureRL(handler.HandleAnonymousFrontendLogin(app)))
-	http.HandleFunc("/api/auth/verify", secure(handler.HandleVerifyEmail(app)))
-	http.HandleFunc("/api/auth/forgot-password", secureRL(handler.HandleForgotPassword(app)))
-	http.HandleFunc("/api/auth/reset-password", secureRL(handler.HandleResetPassword(app)))
-	http.HandleFunc("/api/auth/sn-login", secureRL(handler.HandleSNLogin(app)))
-	http.HandleFunc("/api/auth/ticket-exchange", secureRL(handler.HandleTicketExchange(app)))
-	http.HandleFunc("/auth/ticket-login", handler.HandleTicketLogin(app))
-	http.HandleFunc("/api/captcha", secure(handler.HandleCaptcha()))
-	http.HandleFunc("/api/captcha/image", secureRL(handler.HandleCaptchaImage()))
+	mux.HandleFunc("/api/auth/register", secureRL(handler.HandleRegister(app)))
+	mux.HandleFunc("/api/auth/login", secureRL(handler.HandleUserLogin(app)))
+	mux.HandleFunc("/api/auth/external-login", secureRL(handler.HandleExternalLogin(app)))
+	mux.HandleFunc("/api/auth/anonymous-login", secureRL(handler.HandleAnonymousFrontendLogin(app)))
+	mux.HandleFunc("/api/auth/verify", secure(handler.HandleVerifyEmail(app)))
+	mux.HandleFunc("/api/auth/forgot-password", secureRL(handler.HandleForgotPassword(app)))
+	mux.HandleFunc("/api/auth/reset-password", secureRL(handler.HandleResetPassword(app)))
+	mux.HandleFunc("/api/auth/sn-login", secureRL(handler.HandleSNLogin(app)))
+	mux.HandleFunc("/api/auth/ticket-exchange", secureRL(handler.HandleTicketExchange(app)))
+	mux.HandleFunc("/api/auth/session", secure(handler.HandleSession(app)))
+	mux.HandleFunc("/api/auth/logout", secure(handler.HandleLogout(app)))
+	mux.HandleFunc("/api/auth/operation-token", secure(handler.HandleOperationToken(app)))
+	mux.HandleFunc("/auth/ticket-login", handler.HandleTicketLogin(app))
+	mux.HandleFunc("/api/captcha", secure(handler.HandleCaptcha()))
+	mux.HandleFunc("/api/captcha/image", secureRL(handler.HandleCaptchaImage()))
 
 	// ── Public info (product) ──
-	http.HandleFunc("/api/product-intro", secure(handler.HandleProductIntro(app)))
-	http.HandleFunc("/api/app-info", secure(handler.HandleAppInfo(app)))
-	http.HandleFunc("/api/translate-product-name", secureAPIRL(handler.HandleTranslateProductName(app)))
+	mux.HandleFunc("/api/product-intro", secure(handler.HandleProductIntro(app)))
+	mux.HandleFunc("/api/app-info", secure(handler.HandleAppInfo(app)))
+	mux.HandleFunc("/api/announcements", secure(handler.HandleAnnouncements(app)))
+	mux.HandleFunc("/api/translate-product-name", secureAPIRL(handler.HandleTranslateProductName(app)))
+
+	// ── Documentation portal (public, read-only, off unless portal.enabled) ──
+	mux.HandleFunc("/api/portal/categories", secure(handler.HandlePortalCategories(app)))
+	mux.HandleFunc("/api/portal/articles", secure(handler.HandlePortalArticles(app)))
+	mux.HandleFunc("/api/portal/articles/", secure(handler.HandlePortalArticles(app)))
+	mux.HandleFunc("/api/portal/search", secureAPIRL(handler.HandlePortalSearch(app)))
 
 	// ── Query ──
-	http.HandleFunc("/api/query", secureRL(handler.HandleQuery(app)))
+	mux.HandleFunc("/api/query", secureRL(handler.HandleQuery(app)))
+	mux.HandleFunc("/api/query/queue", secure(handler.HandleQueryQueue(app)))
+	mux.HandleFunc("/api/query/citation-click", secureAPIRL(handler.HandleCitationClick(app)))
+	mux.HandleFunc("/api/query/feedback", secureAPIRL(handler.HandleQueryFeedback(app)))
+	mux.HandleFunc("/api/query/correction", secureAPIRL(handler.HandleQueryCorrection(app)))
+	mux.HandleFunc("/api/query/share", secureAPIRL(handler.HandleQueryShare(app)))
+	mux.HandleFunc("/api/share/", secureAPIRL(handler.HandleSharedAnswer(app)))
+	mux.HandleFunc("/api/chat/state", secureAPIRL(handler.HandleChatState(app)))
+	mux.HandleFunc("/api/chat/history", secureAPIRL(handler.HandleChatHistory(app)))
+	mux.HandleFunc("/api/chat/history/", secureAPIRL(handler.HandleChatHistoryItem(app)))
 
 	// ── User preferences ──
-	http.HandleFunc("/api/user/preferences", secure(handler.HandleUserPreferences(app)))
+	mux.HandleFunc("/api/user/preferences", secure(handler.HandleUserPreferences(app)))
 
 	// ── Documents ──
-	http.HandleFunc("/api/documents/public-download/", secure(handler.HandlePublicDocumentDownload(app)))
-	http.HandleFunc("/api/documents/upload", secure(handler.HandleDocumentUpload(app)))
-	http.HandleFunc("/api/documents/url/preview", secure(handler.HandleDocumentURLPreview(app)))
-	http.HandleFunc("/api/documents/url", secure(handler.HandleDocumentURL(app)))
-	http.HandleFunc("/api/documents", secure(handler.HandleDocuments(app)))
-	http.HandleFunc("/api/documents/", secure(handler.HandleDocumentByID(app)))
+	mux.HandleFunc("/api/documents/public-download/", secure(handler.HandlePublicDocumentDownload(app)))
+	mux.HandleFunc("/api/documents/upload", secureRO(handler.HandleDocumentUpload(app)))
+	mux.HandleFunc("/api/documents/url/preview", secureRO(handler.HandleDocumentURLPreview(app)))
+	mux.HandleFunc("/api/documents/url", secureRO(handler.HandleDocumentURL(app)))
+	mux.HandleFunc("/api/documents/crawl", secureRO(handler.HandleDocumentCrawl(app)))
+	mux.HandleFunc("/api/documents", secure(handler.HandleDocuments(app)))
+	mux.HandleFunc("/api/documents/duplicates", secure(handler.HandleDocumentDuplicates(app)))
+	mux.HandleFunc("/api/documents/tags", secure(handler.HandleDocumentTags(app)))
+	mux.HandleFunc("/api/documents/", secureRO(handler.HandleDocumentByID(app)))
+	mux.HandleFunc("/api/source-credentials", secureRO(handler.HandleSourceCredentials(app)))
+	mux.HandleFunc("/api/source-credentials/", secureRO(handler.HandleSourceCredentialDelete(app)))
+	mux.HandleFunc("/api/admin/embedding/fingerprints", secure(handler.HandleEmbeddingFingerprints(app)))
+	mux.HandleFunc("/api/admin/reindex", secureRO(handler.HandleReindex(app)))
+	mux.HandleFunc("/api/admin/reindex/events", secure(handler.HandleReindexEvents(app)))
+
+	// ── Feed subscriptions (RSS/Atom) ──
+	mux.HandleFunc("/api/feeds", secureRO(handler.HandleFeeds(app)))
+	mux.HandleFunc("/api/feeds/", secureRO(handler.HandleFeedByID(app)))
+
+	// ── Live sources (sitemaps and feeds kept in sync) ──
+	mux.HandleFunc("/api/live-sources", secureRO(handler.HandleLiveSources(app)))
+	mux.HandleFunc("/api/live-sources/", secureRO(handler.HandleLiveSourceByID(app)))
+
+	// ── Git sources (repository docs kept in sync) ──
+	mux.HandleFunc("/api/git-sources", secureRO(handler.HandleGitSources(app)))
+	mux.HandleFunc("/api/git-sources/", secureRO(handler.HandleGitSourceByID(app)))
+
+	// ── Glossary & terminology checker ──
+	mux.HandleFunc("/api/glossary/check", secure(handler.HandleTerminologyCheck(app)))
+	mux.HandleFunc("/api/glossary/rewrite", secureRO(handler.HandleTerminologyRewrite(app)))
+	mux.HandleFunc("/api/glossary", secureRO(handler.HandleGlossary(app)))
+	mux.HandleFunc("/api/glossary/", secureRO(handler.HandleGlossaryTermByID(app)))
+
+	// ── Product announcements (admin) ──
+	mux.HandleFunc("/api/admin/announcements", secureRO(handler.HandleAdminAnnouncements(app)))
+	mux.HandleFunc("/api/admin/announcements/", secureRO(handler.HandleAdminAnnouncementByID(app)))
+
+	// ── Query replay (super admin) ──
+	mux.HandleFunc("/api/admin/replay/samples", secureRO(handler.HandleReplaySamples(app)))
+	mux.HandleFunc("/api/admin/replay/samples/", secureRO(handler.HandleReplaySampleByID(app)))
+	mux.HandleFunc("/api/admin/replay/runs/", secure(handler.HandleReplayRun(app)))
+
+	// ── Answer templates (admin) ──
+	mux.HandleFunc("/api/admin/templates", secureRO(handler.HandleAdminTemplates(app)))
+	mux.HandleFunc("/api/admin/templates/", secureRO(handler.HandleAdminTemplateByID(app)))
+
+	// ── Answer correction suggestions (moderation queue) ──
+	mux.HandleFunc("/api/admin/corrections", secure(handler.HandleAdminCorrections(app)))
+	mux.HandleFunc("/api/admin/corrections/", secureRO(handler.HandleAdminCorrectionByID(app)))
+
+	// ── Troubleshooting flows ──
+	mux.HandleFunc("/api/flows/available", secureAPIRL(handler.HandleAvailableFlows(app)))
+	mux.HandleFunc("/api/flows/walk", secureAPIRL(handler.HandleFlowWalk(app)))
+	mux.HandleFunc("/api/flows/route", secureAPIRL(handler.HandleFlowRoute(app)))
+	mux.HandleFunc("/api/flows", secureRO(handler.HandleFlows(app)))
+	mux.HandleFunc("/api/flows/", secureRO(handler.HandleFlowByID(app)))
 
 	// ── Pending questions ──
-	http.HandleFunc("/api/pending/answer", secure(handler.HandlePendingAnswer(app)))
-	http.HandleFunc("/api/pending/create", secure(handler.HandlePendingCreate(app)))
-	http.HandleFunc("/api/pending/", secure(handler.HandlePendingByID(app)))
-	http.HandleFunc("/api/pending", secure(handler.HandlePending(app)))
+	mux.HandleFunc("/api/pending/answer", secureRO(handler.HandlePendingAnswer(app)))
+	mux.HandleFunc("/api/pending/create", secure(handler.HandlePendingCreate(app)))
+	mux.HandleFunc("/api/pending/bulk-answer", secureRO(handler.HandlePendingBulkAnswer(app)))
+	mux.HandleFunc("/api/pending/bulk-answer/", secure(handler.HandlePendingBulkAnswerResults(app)))
+	mux.HandleFunc("/api/pending/", secureRO(handler.HandlePendingByID(app)))
+	mux.HandleFunc("/api/pending", secure(handler.HandlePending(app)))
 
 	// ── Config ──
-	http.HandleFunc("/api/config", secure(handler.HandleConfigWithRole(app)))
+	mux.HandleFunc("/api/config", secureRO(handler.HandleConfigWithRole(app)))
+	mux.HandleFunc("/api/llm-profiles", secureRO(handler.HandleLLMProfiles(app)))
+	mux.HandleFunc("/api/llm-profiles/", secureRO(handler.HandleLLMProfileDelete(app)))
+	mux.HandleFunc("/api/llm-routes", secureRO(handler.HandleLLMRoutes(app)))
 
 	// ── System ──
-	http.HandleFunc("/api/system/status", secure(handler.HandleSystemStatus(app)))
+	mux.HandleFunc("/api/system/status", secure(handler.HandleSystemStatus(app)))
 
 	// ── Health check ──
-	http.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			handler.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
 			return
@@ -109,65 +203,118 @@ func Register(app *handler.App) func() {
 		handler.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 	})
 
+	// ── Public status page data ──
+	mux.HandleFunc("/api/status", secureAPIRL(handler.HandlePublicStatus(app)))
+
 	// ── LLM / Embedding test (admin only) ──
-	http.HandleFunc("/api/test/llm", secure(handler.HandleTestLLM(app)))
-	http.HandleFunc("/api/test/embedding", secure(handler.HandleTestEmbedding(app)))
+	mux.HandleFunc("/api/test/llm", secure(handler.HandleTestLLM(app)))
+	mux.HandleFunc("/api/test/llm-profile", secure(handler.HandleTestLLMProfile(app)))
+	mux.HandleFunc("/api/test/embedding", secure(handler.HandleTestEmbedding(app)))
+	mux.HandleFunc("/api/test/rerank", secure(handler.HandleTestRerank(app)))
 
 	// ── Email test ──
-	http.HandleFunc("/api/email/test", secureRL(handler.HandleEmailTest(app)))
+	mux.HandleFunc("/api/email/test", secureRL(handler.HandleEmailTest(app)))
+	mux.HandleFunc("/api/notifications/test", secureRL(handler.HandleNotificationTest(app)))
 
 	// ── Video ──
-	http.HandleFunc("/api/video/check-deps", secure(handler.HandleVideoCheckDeps(app)))
-	http.HandleFunc("/api/video/validate-rapidspeech", secure(handler.HandleValidateRapidSpeech(app)))
-	http.HandleFunc("/api/video/auto-setup/check", secure(handler.HandleVideoAutoSetupCheck(app)))
-	http.HandleFunc("/api/video/auto-setup", secure(handler.HandleVideoAutoSetup(app)))
+	mux.HandleFunc("/api/video/check-deps", secure(handler.HandleVideoCheckDeps(app)))
+	mux.HandleFunc("/api/video/validate-rapidspeech", secureRO(handler.HandleValidateRapidSpeech(app)))
+	mux.HandleFunc("/api/video/auto-setup/check", secure(handler.HandleVideoAutoSetupCheck(app)))
+	mux.HandleFunc("/api/video/auto-setup", secureRO(handler.HandleVideoAutoSetup(app)))
 
 	// ── Admin sub-accounts ──
-	http.HandleFunc("/api/admin/users", secure(handler.HandleAdminUsers(app)))
-	http.HandleFunc("/api/admin/users/", secure(handler.HandleAdminUserByID(app)))
-	http.HandleFunc("/api/admin/role", secure(handler.HandleAdminRole(app)))
+	mux.HandleFunc("/api/admin/users", secureRO(handler.HandleAdminUsers(app)))
+	mux.HandleFunc("/api/admin/users/", secureRO(handler.HandleAdminUserByID(app)))
+	mux.HandleFunc("/api/admin/role", secure(handler.HandleAdminRole(app)))
+	mux.HandleFunc("/api/admin/password", secureRO(handler.HandleAdminPassword(app)))
+	mux.HandleFunc("/api/admin/notification-prefs", secureRO(handler.HandleAdminNotifyPrefs(app)))
+	mux.HandleFunc("/api/admin/notification-prefs/test", secureRL(handler.HandleAdminNotifyPrefsTest(app)))
+	mux.HandleFunc("/api/admin/apikeys", secureRO(handler.HandleAdminAPIKeys(app)))
+	mux.HandleFunc("/api/admin/apikeys/", secureRO(handler.HandleAdminAPIKeyByID(app)))
 
 	// ── Customer management ──
-	http.HandleFunc("/api/admin/customers", secure(handler.HandleAdminCustomers(app)))
-	http.HandleFunc("/api/admin/customers/verify", secure(handler.HandleAdminCustomerVerify(app)))
-	http.HandleFunc("/api/admin/customers/ban", secure(handler.HandleAdminCustomerBan(app)))
-	http.HandleFunc("/api/admin/customers/unban", secure(handler.HandleAdminCustomerUnban(app)))
-	http.HandleFunc("/api/admin/customers/delete", secure(handler.HandleAdminCustomerDelete(app)))
+	mux.HandleFunc("/api/admin/customers", secure(handler.HandleAdminCustomers(app)))
+	mux.HandleFunc("/api/admin/customers/verify", secureRO(handler.HandleAdminCustomerVerify(app)))
+	mux.HandleFunc("/api/admin/customers/ban", secureRO(handler.HandleAdminCustomerBan(app)))
+	mux.HandleFunc("/api/admin/customers/unban", secureRO(handler.HandleAdminCustomerUnban(app)))
+	mux.HandleFunc("/api/admin/customers/delete", secureRO(handler.HandleAdminCustomerDelete(app)))
+
+	// ── Reports ──
+	mux.HandleFunc("/api/admin/reports/usage", secure(handler.HandleUsageReport(app)))
+	mux.HandleFunc("/api/admin/reports/deflection", secure(handler.HandleDeflectionReport(app)))
+	mux.HandleFunc("/api/admin/feedback", secure(handler.HandleFeedbackReport(app)))
+	mux.HandleFunc("/api/admin/products/", secure(handler.HandleProductHealth(app)))
+
+	// ── Answer audit trail (super admin) ──
+	mux.HandleFunc("/api/admin/audits", secure(handler.HandleAnswerAudits(app)))
+	mux.HandleFunc("/api/admin/audits/", secure(handler.HandleAnswerAuditByID(app)))
 
 	// ── Login ban management ──
-	http.HandleFunc("/api/admin/bans", secure(handler.HandleAdminBans(app)))
-	http.HandleFunc("/api/admin/bans/unban", secure(handler.HandleAdminUnban(app)))
-	http.HandleFunc("/api/admin/bans/add", secure(handler.HandleAdminAddBan(app)))
+	mux.HandleFunc("/api/admin/bans", secure(handler.HandleAdminBans(app)))
+	mux.HandleFunc("/api/admin/bans/unban", secureRO(handler.HandleAdminUnban(app)))
+	mux.HandleFunc("/api/admin/bans/add", secureRO(handler.HandleAdminAddBan(app)))
 
 	// ── Products ──
-	http.HandleFunc("/api/products/my", secure(handler.HandleMyProducts(app)))
-	http.HandleFunc("/api/products/", secure(handler.HandleProductByID(app)))
-	http.HandleFunc("/api/products", secure(handler.HandleProducts(app)))
+	mux.HandleFunc("/api/products/my", secure(handler.HandleMyProducts(app)))
+	mux.HandleFunc("/api/products/export", secure(handler.HandleProductsExport(app)))
+	mux.HandleFunc("/api/products/import", secureRO(handler.HandleProductsImport(app)))
+	mux.HandleFunc("/api/products/", secureRO(handler.HandleProductByID(app)))
+	mux.HandleFunc("/api/products", secureRO(handler.HandleProducts(app)))
 
 	// ── Knowledge ──
-	http.HandleFunc("/api/knowledge", secure(handler.HandleKnowledgeEntry(app)))
+	mux.HandleFunc("/api/knowledge", secureRO(handler.HandleKnowledgeEntry(app)))
+	mux.HandleFunc("/api/knowledge/", secureRO(handler.HandleKnowledgeEntryByID(app)))
+	mux.HandleFunc("/api/inbound-email", secureRO(handler.HandleInboundEmail(app)))
+
+	// ── Review workflow ──
+	mux.HandleFunc("/api/review/reviewers", secure(handler.HandleReviewers(app)))
+	mux.HandleFunc("/api/review/action", secureRO(handler.HandleReviewAction(app)))
+	mux.HandleFunc("/api/review", secure(handler.HandleReviewQueue(app)))
+	mux.HandleFunc("/api/review/", secure(handler.HandleReviewItem(app)))
 
 	// ── Image upload ──
-	http.HandleFunc("/api/images/upload", secure(handler.HandleImageUpload(app)))
+	mux.HandleFunc("/api/images/upload", secureRO(handler.HandleImageUpload(app)))
 
 	// ── Video upload ──
-	http.HandleFunc("/api/videos/upload", secure(handler.HandleKnowledgeVideoUpload(app)))
+	mux.HandleFunc("/api/videos/upload", secureRO(handler.HandleKnowledgeVideoUpload(app)))
 
 	// ── Static file serving (public, but with security headers) ──
-	http.HandleFunc("/api/images/", secure(handler.ServeImages()))
-	http.HandleFunc("/api/videos/knowledge/", secure(handler.ServeKnowledgeVideos()))
+	mux.HandleFunc("/api/images/", secure(handler.ServeImages()))
+	mux.HandleFunc("/api/videos/knowledge/", secure(handler.ServeKnowledgeVideos()))
 
 	// ── Batch import (SSE streaming) ──
-	http.HandleFunc("/api/batch-import", secure(handler.HandleBatchImport(app)))
+	mux.HandleFunc("/api/batch-import", secureRO(handler.HandleBatchImport(app)))
+	mux.HandleFunc("/api/batch-import/classify", secureRO(handler.HandleBatchImportClassify(app)))
 
 	// ── Log management (admin only) ──
-	http.HandleFunc("/api/logs/recent", secure(handler.HandleLogsRecent(app)))
-	http.HandleFunc("/api/logs/rotation", secure(handler.HandleLogsRotation(app)))
-	http.HandleFunc("/api/logs/download", secure(handler.HandleLogsDownload(app)))
-	http.HandleFunc("/api/logs/clear", secure(handler.HandleLogsClear(app)))
+	mux.HandleFunc("/api/logs/recent", secure(handler.HandleLogsRecent(app)))
+	mux.HandleFunc("/api/logs/rotation", secureRO(handler.HandleLogsRotation(app)))
+	mux.HandleFunc("/api/logs/download", secure(handler.HandleLogsDownload(app)))
+	mux.HandleFunc("/api/logs/clear", secureRO(handler.HandleLogsClear(app)))
+
+	// ── Database maintenance (admin only) ──
+	mux.HandleFunc("/api/admin/maintenance", secure(handler.HandleMaintenance(app)))
+	mux.HandleFunc("/api/admin/maintenance/run", secureRO(handler.HandleMaintenanceRun(app)))
+
+	// ── Analytics export (admin only) ──
+	mux.HandleFunc("/api/admin/export", secure(handler.HandleExport(app)))
+	mux.HandleFunc("/api/admin/export/run", secureRO(handler.HandleExportRun(app)))
+
+	// ── Model spend against the monthly budget caps (admin only) ──
+	mux.HandleFunc("/api/admin/budget", secure(handler.HandleBudget(app)))
+
+	// ── Online backup (super admin only) ──
+	mux.HandleFunc("/api/admin/backup", secureRO(handler.HandleBackup(app)))
+
+	// ── Query debug tokens (admin only) ──
+	mux.HandleFunc("/api/admin/debug-token", secureRO(handler.HandleDebugToken(app)))
+
+	// ── Background jobs (admin only) ──
+	mux.HandleFunc("/api/admin/jobs", secure(handler.HandleJobs(app)))
+	mux.HandleFunc("/api/admin/jobs/", secureRO(handler.HandleJobCancel(app)))
 
 	// ── Public media streaming ──
-	http.HandleFunc("/api/media/", secure(handler.HandleMediaStream(app)))
+	mux.HandleFunc("/api/media/", secure(handler.HandleMediaStream(app)))
 
 	// Return cleanup function to stop rate limiter goroutines
 	return func() {
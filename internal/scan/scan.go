@@ -0,0 +1,179 @@
+// Package scan checks uploaded files for malware, either through a clamd
+// daemon (INSTREAM protocol over a unix or TCP socket) or an external scanner
+// command following the clamscan exit-code convention.
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"askflow/internal/config"
+	"askflow/internal/textutil"
+)
+
+// clamdChunkSize is the size of the chunks streamed to clamd.
+const clamdChunkSize = 64 << 10
+
+// Result is the outcome of scanning one file.
+type Result struct {
+	Infected  bool
+	Signature string // detected malware name, when the scanner reports one
+}
+
+// Scanner scans file contents for malware.
+type Scanner interface {
+	Scan(ctx context.Context, fileName string, data []byte) (*Result, error)
+}
+
+// New returns the scanner configured by cfg, or nil when scanning is disabled.
+func New(cfg config.ScanConfig) (Scanner, error) {
+	switch cfg.Mode {
+	case "":
+		return nil, nil
+	case config.ScanModeClamAV:
+		if cfg.ClamAVAddress == "" {
+			return nil, errors.New("clamav_address is not configured")
+		}
+		return &clamdScanner{address: cfg.ClamAVAddress}, nil
+	case config.ScanModeCommand:
+		if cfg.Command == "" {
+			return nil, errors.New("scan command is not configured")
+		}
+		return &commandScanner{command: cfg.Command}, nil
+	default:
+		return nil, fmt.Errorf("unknown scan mode: %s", cfg.Mode)
+	}
+}
+
+// clamdScanner streams files to a clamd daemon.
+type clamdScanner struct {
+	address string // unix socket path (contains a path separator) or host:port
+}
+
+func (s *clamdScanner) Scan(ctx context.Context, _ string, data []byte) (*Result, error) {
+	network := "tcp"
+	if strings.ContainsAny(s.address, "/\\") {
+		network = "unix"
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, s.address)
+	if err != nil {
+		return nil, fmt.Errorf("connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return nil, fmt.Errorf("send to clamd: %w", err)
+	}
+	var size [4]byte
+	for off := 0; off < len(data); off += clamdChunkSize {
+		end := off + clamdChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		binary.BigEndian.PutUint32(size[:], uint32(end-off))
+		if _, err := conn.Write(size[:]); err != nil {
+			return nil, fmt.Errorf("send to clamd: %w", err)
+		}
+		if _, err := conn.Write(data[off:end]); err != nil {
+			return nil, fmt.Errorf("send to clamd: %w", err)
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	if _, err := conn.Write(size[:]); err != nil {
+		return nil, fmt.Errorf("send to clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return nil, fmt.Errorf("read clamd reply: %w", err)
+	}
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseClamdReply interprets a clamd INSTREAM reply such as "stream: OK" or
+// "stream: Eicar-Test-Signature FOUND".
+func parseClamdReply(reply string) (*Result, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return nil, fmt.Errorf("clamd error: %s", reply)
+	}
+}
+
+// commandScanner runs an external scanner on a temporary copy of the file.
+// Exit code 0 means clean, 1 means infected (the first output line is taken
+// as the signature), anything else is a scan error.
+type commandScanner struct {
+	command string
+}
+
+func (s *commandScanner) Scan(ctx context.Context, fileName string, data []byte) (*Result, error) {
+	tmp, err := os.CreateTemp("", "askflow-scan-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("write temp file: %w", err)
+	}
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.command, tmp.Name())
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err = cmd.Run()
+	if err == nil {
+		return &Result{}, nil
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("scan timed out: %w", ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		sig := firstLine(out.String())
+		// Strip the temp path scanners echo back, e.g. "/tmp/askflow-scan-1: Eicar FOUND".
+		sig = strings.TrimPrefix(sig, tmp.Name()+":")
+		sig = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(sig), "FOUND"))
+		return &Result{Infected: true, Signature: sig}, nil
+	}
+	return nil, fmt.Errorf("scanner failed: %v: %s", err, firstLine(out.String()))
+}
+
+// firstLine returns the first non-empty line of s, at most 200 runes long.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return textutil.Truncate(line, 200)
+		}
+	}
+	return ""
+}
+
+// Timeout returns the per-file scan timeout configured in cfg.
+func Timeout(cfg config.ScanConfig) time.Duration {
+	if cfg.TimeoutSec <= 0 {
+		return 120 * time.Second
+	}
+	return time.Duration(cfg.TimeoutSec) * time.Second
+}
@@ -14,21 +14,32 @@ import (
 	"sync"
 	"time"
 
+	"askflow/internal/analytics"
 	"askflow/internal/auth"
+	"askflow/internal/budget"
+	"askflow/internal/chatstate"
 	"askflow/internal/chunker"
 	"askflow/internal/config"
+	"askflow/internal/datadir"
 	"askflow/internal/db"
 	"askflow/internal/document"
 	"askflow/internal/email"
 	"askflow/internal/embedding"
 	"askflow/internal/errlog"
+	"askflow/internal/export"
+	"askflow/internal/feed"
+	"askflow/internal/livesource"
 	"askflow/internal/fontcheck"
+	"askflow/internal/gitsource"
 	"askflow/internal/handler"
+	"askflow/internal/jobs"
 	"askflow/internal/llm"
+	"askflow/internal/maintenance"
 	"askflow/internal/parser"
 	"askflow/internal/pending"
 	"askflow/internal/product"
 	"askflow/internal/query"
+	"askflow/internal/share"
 	"askflow/internal/vectorstore"
 	"askflow/internal/video"
 )
@@ -38,6 +49,7 @@ type AppService struct {
 	server          *http.Server
 	configManager   *config.ConfigManager
 	dbPair          *db.DBPair
+	vectorStore     *vectorstore.SQLiteVectorStore
 	sessionManager  *auth.SessionManager
 	queryEngine     *query.QueryEngine
 	docManager      *document.DocumentManager
@@ -45,10 +57,20 @@ type AppService struct {
 	oauthClient     *auth.OAuthClient
 	emailService    *email.Service
 	productService  *product.ProductService
+	feedService     *feed.Service
+	liveSources     *livesource.Service
+	gitSources      *gitsource.Service
+	maintenance     *maintenance.Service
+	schedules       *document.Scheduler
+	budget          *budget.Meter
+	exporter        *export.Service
+	jobQueue        *jobs.Queue
 	cfg             *config.Config
 	dataDir         string
 	sessionCleanup  chan struct{}
 	cleanupWg       sync.WaitGroup
+	testing         *testingMode // set by EnableTestingMode
+	digest          func() error // sends the daily notification digest; set by CreateApp
 }
 
 // Initialize sets up all services and prepares the application for running.
@@ -57,18 +79,32 @@ type AppService struct {
 func (as *AppService) Initialize(dataDir string, overrideBind string, overridePort int) error {
 	as.dataDir = dataDir
 
-	// 0. Initialize error logger (/var/log/askflow/error.log)
-	if err := errlog.Init(); err != nil {
-		log.Printf("Warning: error logger init failed: %v (errors will not be persisted to file)", err)
-	}
+	if as.testing == nil {
+		// 0. Initialize error logger (/var/log/askflow/error.log)
+		if err := errlog.Init(); err != nil {
+			log.Printf("Warning: error logger init failed: %v (errors will not be persisted to file)", err)
+		}
 
-	// 0.5 Check CJK fonts (Linux: auto-install if root, otherwise warn)
-	fontcheck.EnsureCJKFonts()
+		// 0.5 Check CJK fonts (Linux: auto-install if root, otherwise warn)
+		fontcheck.EnsureCJKFonts()
+	}
 
-	// 1. Ensure data directory exists
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
+	// 1. Ensure data directory exists and is not writable by other users.
+	// All data paths are resolved against it from here on, not the working directory.
+	if err := datadir.SetRoot(dataDir); err != nil {
+		return err
+	}
+	dataDir = datadir.Root()
+	as.dataDir = dataDir
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
 		return fmt.Errorf("failed to create data directory: %w", err)
 	}
+	if ok, err := datadir.CheckPermissions(dataDir); err != nil {
+		return err
+	} else if !ok {
+		log.Printf("Warning: data directory %s is world-writable (allowed by %s)", dataDir, datadir.AllowWorldWritableEnvVar)
+	}
+	warnLegacyDataDir(dataDir)
 
 	// 2. Initialize ConfigManager and load config
 	configPath := filepath.Join(dataDir, "config.json")
@@ -81,6 +117,14 @@ func (as *AppService) Initialize(dataDir string, overrideBind string, overridePo
 	}
 	as.configManager = cm
 	as.cfg = cm.Get()
+	if err := datadir.Apply(datadir.Settings{
+		Umask:    as.cfg.Files.Umask,
+		DirMode:  as.cfg.Files.DirMode,
+		FileMode: as.cfg.Files.FileMode,
+		Confine:  as.cfg.Files.RestrictToDataDir,
+	}); err != nil {
+		return fmt.Errorf("invalid files config: %w", err)
+	}
 
 	// 3. Initialize database
 	dbPath := as.cfg.Vector.DBPath
@@ -88,7 +132,12 @@ func (as *AppService) Initialize(dataDir string, overrideBind string, overridePo
 	if !filepath.IsAbs(dbPath) {
 		dbPath = filepath.Join(dataDir, dbPath)
 	}
-	database, err := db.InitDB(dbPath)
+	var database *db.DBPair
+	if as.testing != nil {
+		database, err = db.InitMemoryDB()
+	} else {
+		database, err = db.InitDB(dbPath)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
@@ -103,22 +152,38 @@ func (as *AppService) Initialize(dataDir string, overrideBind string, overridePo
 	log.Printf("[SIMD] Vector acceleration: %s", vectorstore.SIMDCapability())
 	tc := &chunker.TextChunker{ChunkSize: as.cfg.Vector.ChunkSize, Overlap: as.cfg.Vector.Overlap}
 	dp := &parser.DocumentParser{}
-	es := embedding.NewAPIEmbeddingService(
-		as.cfg.Embedding.Endpoint,
-		as.cfg.Embedding.APIKey,
-		as.cfg.Embedding.ModelName,
-		as.cfg.Embedding.UseMultimodal,
-	)
-	ls := llm.NewAPILLMService(
-		as.cfg.LLM.Endpoint,
-		as.cfg.LLM.APIKey,
-		as.cfg.LLM.ModelName,
-		as.cfg.LLM.Temperature,
-		as.cfg.LLM.MaxTokens,
-	)
+	var es embedding.EmbeddingService
+	var ls llm.LLMService
+	if as.testing != nil {
+		es, ls = as.testing.embedding, as.testing.llm
+	} else {
+		es = embedding.NewAPIEmbeddingService(
+			as.cfg.Embedding.Endpoint,
+			as.cfg.Embedding.APIKey,
+			as.cfg.Embedding.ModelName,
+			as.cfg.Embedding.UseMultimodal,
+		)
+		ls = llm.NewRouter(as.cfg.LLM)
+	}
+	// Model calls are metered against the monthly budget caps
+	as.budget = budget.NewMeter(readDB, writeDB, func() config.Config {
+		if cfg := as.configManager.Get(); cfg != nil {
+			return *cfg
+		}
+		return config.Config{}
+	})
+	es, ls = as.budget.WrapEmbedding(es), as.budget.WrapLLM(ls)
 	as.docManager = document.NewDocumentManager(dp, tc, es, vs, writeDB)
 	as.docManager.SetVideoConfig(as.cfg.Video)
+	as.docManager.SetHTMLConfig(as.cfg.HTML)
+	as.docManager.SetSourceCredentials(as.cfg.SourceCredentials)
 	as.docManager.SetLLMService(ls)
+	as.docManager.SetTranslateLanguages(as.cfg.Vector.TranslateLanguages)
+	as.docManager.SetTaggingEnabled(as.cfg.Tagging.Enabled)
+	as.docManager.SetImportPrices(as.cfg.Embedding.PricePerMTokens, as.cfg.LLM.PricePerMTokens)
+	// Document processing runs as jobs on a bounded worker pool
+	as.jobQueue = jobs.NewQueue(writeDB, as.cfg.Jobs.Concurrency)
+	as.docManager.SetJobQueue(as.jobQueue)
 
 	// Video dependency check
 	if as.cfg.Video.FFmpegPath != "" || as.cfg.Video.RapidSpeechPath != "" {
@@ -139,10 +204,61 @@ func (as *AppService) Initialize(dataDir string, overrideBind string, overridePo
 	}
 
 	as.productService = product.NewProductService(readDB, writeDB)
+	// Products with isolated storage keep their chunks in data/partitions/<id>.db
+	vs.SetPartitionDir(filepath.Join(dataDir, "partitions"))
+	as.productService.SetStorage(vs)
+	if err := as.productService.OpenPartitions(); err != nil {
+		return fmt.Errorf("failed to open product storage: %w", err)
+	}
+	as.vectorStore = vs
+	// An external search engine answers vector searches; SQLite keeps the chunks
+	backend, err := vectorstore.OpenBackend(as.cfg.Vector)
+	if err != nil {
+		return fmt.Errorf("failed to open vector backend: %w", err)
+	}
+	if backend != nil {
+		vs.SetBackend(backend)
+		log.Printf("[Vector] search backend: %s", as.cfg.Vector.Backend)
+		held, errB := backend.Count()
+		total, errS := vs.CountChunks(writeDB)
+		if errB == nil && errS == nil && held < total {
+			log.Printf("[WARNING] vector backend %s holds %d of %d chunks; run 'askflow migrate-vectors --to %s' to copy the rest",
+				as.cfg.Vector.Backend, held, total, as.cfg.Vector.Backend)
+		}
+	}
+	as.feedService = feed.NewService(readDB, writeDB, as.docManager)
+	as.liveSources = livesource.NewService(readDB, writeDB, as.docManager)
+	as.gitSources = gitsource.NewService(readDB, writeDB, as.docManager, as.configManager)
+	as.schedules = document.NewScheduler(as.docManager)
+	as.maintenance = maintenance.NewService(writeDB, dbPath, func() config.MaintenanceConfig {
+		cfg := as.configManager.Get()
+		if cfg == nil {
+			return config.MaintenanceConfig{Disabled: true}
+		}
+		return cfg.Maintenance
+	})
+	as.exporter = export.NewService(readDB, writeDB, func() config.ExportConfig {
+		if cfg := as.configManager.Get(); cfg != nil {
+			return cfg.Export
+		}
+		return config.ExportConfig{}
+	}, func() config.S3Config {
+		if cfg := as.configManager.Get(); cfg != nil {
+			return cfg.Backup.S3
+		}
+		return config.S3Config{}
+	})
 	as.queryEngine = query.NewQueryEngine(es, vs, ls, writeDB, readDB, as.cfg)
+	as.queryEngine.SetBudget(as.budget)
 	as.pendingManager = pending.NewPendingQuestionManager(writeDB, tc, es, vs, ls)
-	as.oauthClient = auth.NewOAuthClient(as.cfg.OAuth.Providers)
-	as.sessionManager = auth.NewSessionManager(readDB, writeDB, 24*time.Hour)
+	as.oauthClient = auth.NewOAuthClient(as.cfg.EffectiveOAuthProviders())
+	as.sessionManager = auth.NewSessionManager(readDB, writeDB, func() config.SessionConfig {
+		cfg := as.configManager.Get()
+		if cfg == nil {
+			return config.SessionConfig{}
+		}
+		return cfg.Session
+	})
 
 	// Create email service
 	as.emailService = email.NewService(func() config.SMTPConfig {
@@ -153,6 +269,12 @@ func (as *AppService) Initialize(dataDir string, overrideBind string, overridePo
 		return cfg.SMTP
 	})
 
+	// Malware scanning of uploads; quarantined files are reported to the admin alert address
+	as.docManager.SetScanConfig(as.cfg.Scan)
+	as.docManager.SetQuarantineHandler(func(doc document.DocumentInfo, reason string) {
+		as.sendQuarantineAlert(doc, reason)
+	})
+
 	// 5. Create HTTP server
 	bind := as.cfg.Server.Bind
 	if overrideBind != "" {
@@ -181,6 +303,21 @@ func (as *AppService) Initialize(dataDir string, overrideBind string, overridePo
 	return nil
 }
 
+// sendQuarantineAlert emails the scan alert address that doc was quarantined
+// and returns the address, or "" when none was alerted.
+func (as *AppService) sendQuarantineAlert(doc document.DocumentInfo, reason string) string {
+	cfg := as.configManager.Get()
+	if cfg == nil || cfg.Scan.AlertEmail == "" {
+		return ""
+	}
+	if err := as.emailService.SendQuarantineAlert(cfg.Scan.AlertEmail, doc.Name, doc.ID, reason); err != nil {
+		log.Printf("[Scan] failed to send quarantine alert: %v", err)
+		errlog.Logf("[Scan] failed to send quarantine alert for doc=%s: %v", doc.ID, err)
+		return ""
+	}
+	return cfg.Scan.AlertEmail
+}
+
 // Run starts the HTTP server and blocks until the context is cancelled.
 // Implements graceful shutdown when ctx is done.
 func (as *AppService) Run(ctx context.Context) error {
@@ -193,6 +330,22 @@ func (as *AppService) Run(ctx context.Context) error {
 	as.cleanupWg.Add(1)
 	go as.runSessionCleanup(ctx)
 
+	// Start RSS/Atom feed polling
+	as.feedService.Start()
+
+	// Start sitemap/feed live source refresh
+	as.liveSources.Start()
+	as.gitSources.Start()
+
+	// Start nightly database maintenance
+	as.maintenance.Start()
+
+	// Start scheduled publishing of documents
+	as.schedules.Start()
+
+	// Start scheduled analytics export
+	as.exporter.Start()
+
 	// Start server in a goroutine
 	errCh := make(chan error, 1)
 	go func() {
@@ -218,6 +371,10 @@ func (as *AppService) Run(ctx context.Context) error {
 	}
 }
 
+// digestHour is the local hour in which the daily notification digest is
+// sent.
+const digestHour = 9
+
 // runSessionCleanup runs periodic session cleanup in the background.
 func (as *AppService) runSessionCleanup(ctx context.Context) {
 	defer as.cleanupWg.Done()
@@ -228,8 +385,13 @@ func (as *AppService) runSessionCleanup(ctx context.Context) {
 	}()
 	// Create a single LoginLimiter instance for reuse across cleanup cycles
 	ll := auth.NewLoginLimiter(as.dbPair.Write)
+	shares := share.NewService(as.dbPair.Read, as.dbPair.Write)
+	opTokens := auth.NewOperationTokens(as.dbPair.Read, as.dbPair.Write)
+	chatStates := chatstate.NewService(as.dbPair.Read, as.dbPair.Write)
+	audits := analytics.NewService(as.dbPair.Read, as.dbPair.Write)
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
+	var digestDay string
 	for {
 		select {
 		case <-ctx.Done():
@@ -240,8 +402,29 @@ func (as *AppService) runSessionCleanup(ctx context.Context) {
 			if n, err := as.sessionManager.CleanExpired(); err == nil && n > 0 {
 				log.Printf("Cleaned %d expired sessions", n)
 			}
+			if n, err := opTokens.CleanExpired(); err == nil && n > 0 {
+				log.Printf("Cleaned %d expired operation tokens", n)
+			}
 			// Clean old login attempt records (older than 30 days)
 			ll.CleanOld()
+			if n, err := shares.DeleteExpired(); err == nil && n > 0 {
+				log.Printf("Cleaned %d expired share links", n)
+			}
+			if n, err := chatStates.CleanExpired(); err == nil && n > 0 {
+				log.Printf("Cleaned %d expired chat states", n)
+			}
+			if cfg := as.configManager.Get(); cfg != nil {
+				if n, err := audits.PruneAudits(cfg.Audit.RetentionDays); err == nil && n > 0 {
+					log.Printf("Pruned %d answer audits past retention", n)
+				}
+			}
+			// The notification digest goes out once a day, in the hour of digestHour
+			if now := time.Now(); as.digest != nil && now.Hour() == digestHour && digestDay != now.Format("2006-01-02") {
+				digestDay = now.Format("2006-01-02")
+				if err := as.digest(); err != nil {
+					errlog.Logf("[Notify] daily digest failed: %v", err)
+				}
+			}
 		}
 	}
 }
@@ -266,6 +449,34 @@ func (as *AppService) Shutdown(timeout time.Duration) error {
 		as.oauthClient.Stop()
 	}
 
+	// Stop feed scheduler (waits for an in-progress poll)
+	if as.feedService != nil {
+		as.feedService.Stop()
+	}
+
+	// Stop live source scheduler (waits for an in-progress refresh)
+	if as.liveSources != nil {
+		as.liveSources.Stop()
+	}
+	if as.gitSources != nil {
+		as.gitSources.Stop()
+	}
+
+	// Stop database maintenance (waits for an in-progress run)
+	if as.maintenance != nil {
+		as.maintenance.Stop()
+	}
+
+	// Stop document scheduling (waits for an in-progress run)
+	if as.schedules != nil {
+		as.schedules.Stop()
+	}
+
+	// Stop analytics export (waits for an in-progress run)
+	if as.exporter != nil {
+		as.exporter.Stop()
+	}
+
 	// Wait for cleanup goroutine to finish before closing database
 	as.cleanupWg.Wait()
 
@@ -276,7 +487,13 @@ func (as *AppService) Shutdown(timeout time.Duration) error {
 		}
 	}
 
-	// Close database (only once)
+	// Close product storage partitions, then the database (only once)
+	if as.vectorStore != nil {
+		if err := as.vectorStore.Close(); err != nil {
+			log.Printf("Storage partition close error: %v", err)
+		}
+		as.vectorStore = nil
+	}
 	if as.dbPair != nil {
 		if err := as.dbPair.Close(); err != nil {
 			log.Printf("Database close error: %v", err)
@@ -292,7 +509,7 @@ func (as *AppService) Shutdown(timeout time.Duration) error {
 // CreateApp creates an App facade instance with all dependencies injected internally.
 // This replaces the previous pattern of externally fetching each dependency via getters.
 func (as *AppService) CreateApp() *handler.App {
-	return handler.NewApp(
+	app := handler.NewApp(
 		as.dbPair.Write,
 		as.dbPair.Read,
 		as.queryEngine,
@@ -303,7 +520,25 @@ func (as *AppService) CreateApp() *handler.App {
 		as.configManager,
 		as.emailService,
 		as.productService,
+		as.feedService,
+		as.liveSources,
+		as.gitSources,
+		as.maintenance,
+		as.exporter,
+		as.jobQueue,
 	)
+	if as.testing != nil {
+		app.PinModelServices(as.testing.embedding, as.testing.llm)
+	}
+	as.schedules.OnChange(app.NotifyScheduleChanges)
+	// Admins subscribed to failed documents, security events and digests
+	as.docManager.SetFailureHandler(app.NotifyDocumentFailed)
+	as.docManager.SetQuarantineHandler(func(doc document.DocumentInfo, reason string) {
+		app.NotifyQuarantine(doc, reason, as.sendQuarantineAlert(doc, reason))
+	})
+	as.digest = app.SendNotificationDigest
+	app.SetBudget(as.budget)
+	return app
 }
 
 // GetDatabase returns the write database connection (for backward compatibility and CLI usage).
@@ -329,7 +564,33 @@ func (as *AppService) GetDocManager() *document.DocumentManager {
 	return as.docManager
 }
 
+// GetPendingManager returns the pending question manager.
+func (as *AppService) GetPendingManager() *pending.PendingQuestionManager {
+	return as.pendingManager
+}
+
 // GetProductService returns the product service.
 func (as *AppService) GetProductService() *product.ProductService {
 	return as.productService
 }
+
+// GetVectorStore returns the vector store.
+func (as *AppService) GetVectorStore() *vectorstore.SQLiteVectorStore {
+	return as.vectorStore
+}
+
+// warnLegacyDataDir warns when files were written under ./data of the working
+// directory while the data directory is elsewhere. Older versions stored
+// uploads and images there regardless of --datadir; they must be moved into
+// the data directory to stay reachable.
+func warnLegacyDataDir(dataDir string) {
+	legacy, err := filepath.Abs("data")
+	if err != nil || legacy == dataDir {
+		return
+	}
+	for _, sub := range []string{"uploads", "images", "videos"} {
+		if info, err := os.Stat(filepath.Join(legacy, sub)); err == nil && info.IsDir() {
+			log.Printf("Warning: found %s from an older version; move it into %s", filepath.Join(legacy, sub), dataDir)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package service_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"askflow/internal/service"
+)
+
+// client sends JSON requests to a test server, as the admin once logged in.
+type client struct {
+	t     *testing.T
+	url   string
+	token string
+}
+
+// do sends body (if any) as JSON and decodes the response into out (if
+// any), returning the status code.
+func (c *client) do(method, path string, body, out interface{}) int {
+	c.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, c.url+path, &buf)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			c.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// solveCaptcha fetches a math captcha and returns its ID and answer.
+func (c *client) solveCaptcha() (string, string) {
+	c.t.Helper()
+	var captcha struct {
+		ID       string `json:"id"`
+		Question string `json:"question"`
+	}
+	if code := c.do(http.MethodGet, "/api/captcha", nil, &captcha); code != http.StatusOK {
+		c.t.Fatalf("GET /api/captcha: status %d", code)
+	}
+	var a, b int
+	var op string
+	if _, err := fmt.Sscanf(captcha.Question, "%d %s %d = ?", &a, &op, &b); err != nil {
+		c.t.Fatalf("unexpected captcha %q: %v", captcha.Question, err)
+	}
+	answer := map[string]int{"+": a + b, "-": a - b, "×": a * b}[op]
+	return captcha.ID, fmt.Sprint(answer)
+}
+
+func newTestServer(t *testing.T) *client {
+	t.Helper()
+	as := &service.AppService{}
+	as.EnableTestingMode(service.TestingOptions{})
+	if err := as.Initialize(t.TempDir(), "", 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { as.Shutdown(time.Second) })
+	h, cleanup := as.Handler()
+	t.Cleanup(cleanup)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return &client{t: t, url: srv.URL}
+}
+
+func TestAdminLoginAndProductCRUD(t *testing.T) {
+	c := newTestServer(t)
+	const username, password = "admin", "Str0ng!Passw0rd"
+
+	if code := c.do(http.MethodPost, "/api/admin/setup", map[string]string{
+		"username": username, "password": password,
+	}, nil); code != http.StatusOK {
+		t.Fatalf("admin setup: status %d", code)
+	}
+
+	if code := c.do(http.MethodPost, "/api/products", map[string]string{"name": "未登录"}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("create product without session: status %d, want 401", code)
+	}
+
+	captchaID, answer := c.solveCaptcha()
+	var login struct {
+		Session struct {
+			ID string `json:"id"`
+		} `json:"session"`
+		Role string `json:"role"`
+	}
+	if code := c.do(http.MethodPost, "/api/admin/login", map[string]string{
+		"username": username, "password": password,
+		"captcha_id": captchaID, "captcha_answer": answer,
+	}, &login); code != http.StatusOK {
+		t.Fatalf("admin login: status %d", code)
+	}
+	if login.Session.ID == "" || login.Role != "super_admin" {
+		t.Fatalf("admin login: got session %q role %q", login.Session.ID, login.Role)
+	}
+	c.token = login.Session.ID
+
+	type product struct {
+		ID             string `json:"id"`
+		Name           string `json:"name"`
+		Description    string `json:"description"`
+		WelcomeMessage string `json:"welcome_message"`
+		AllowDownload  bool   `json:"allow_download"`
+	}
+	var created product
+	if code := c.do(http.MethodPost, "/api/products", map[string]interface{}{
+		"name": "路由器", "description": "家用路由器", "welcome_message": "你好", "allow_download": true,
+	}, &created); code != http.StatusOK {
+		t.Fatalf("create product: status %d", code)
+	}
+	if created.ID == "" || created.Name != "路由器" {
+		t.Fatalf("create product: got %+v", created)
+	}
+
+	// Fields left out of a PUT keep their stored value
+	var updated product
+	if code := c.do(http.MethodPut, "/api/products/"+created.ID, map[string]string{
+		"description": "企业路由器",
+	}, &updated); code != http.StatusOK {
+		t.Fatalf("update product: status %d", code)
+	}
+	want := created
+	want.Description = "企业路由器"
+	if updated != want {
+		t.Fatalf("update product: got %+v, want %+v", updated, want)
+	}
+
+	var list struct {
+		Products []product `json:"products"`
+	}
+	if code := c.do(http.MethodGet, "/api/products", nil, &list); code != http.StatusOK {
+		t.Fatalf("list products: status %d", code)
+	}
+	if len(list.Products) != 1 || list.Products[0] != want {
+		t.Fatalf("list products: got %+v, want [%+v]", list.Products, want)
+	}
+
+	if code := c.do(http.MethodDelete, "/api/products/"+created.ID, nil, nil); code != http.StatusOK {
+		t.Fatalf("delete product: status %d", code)
+	}
+	list.Products = nil
+	if code := c.do(http.MethodGet, "/api/products", nil, &list); code != http.StatusOK {
+		t.Fatalf("list products after delete: status %d", code)
+	}
+	if len(list.Products) != 0 {
+		t.Fatalf("list products after delete: got %+v", list.Products)
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"net/http"
+
+	"askflow/internal/embedding"
+	"askflow/internal/llm"
+	"askflow/internal/router"
+)
+
+// TestingOptions configures the testing mode enabled by EnableTestingMode.
+type TestingOptions struct {
+	// Embedding replaces the configured embedding API. Nil uses a
+	// FakeEmbeddingService with deterministic vectors.
+	Embedding embedding.EmbeddingService
+	// LLM replaces the configured LLM API. Nil uses a ScriptedLLMService
+	// that answers every call with its default reply.
+	LLM llm.LLMService
+}
+
+// testingMode holds the services of an AppService in testing mode.
+type testingMode struct {
+	embedding embedding.EmbeddingService
+	llm       llm.LLMService
+}
+
+// EnableTestingMode makes Initialize set the service up for integration
+// tests against the HTTP API without external services: the database lives
+// in memory, embeddings and answers come from opts instead of the configured
+// APIs (also after config updates), and the error log file and CJK font
+// check are skipped. config.json, uploads and product partitions still live
+// in the data directory, which tests usually point at t.TempDir(). The data
+// directory is process-wide, so services in one process share it. Call
+// EnableTestingMode before Initialize, then serve Handler with
+// httptest.NewServer:
+//
+//	as := &service.AppService{}
+//	as.EnableTestingMode(service.TestingOptions{LLM: llm.NewScriptedLLMService("").On("退款", "7 天内可退款")})
+//	if err := as.Initialize(t.TempDir(), "", 0); err != nil {
+//		t.Fatal(err)
+//	}
+//	defer as.Shutdown(time.Second)
+//	h, cleanup := as.Handler()
+//	defer cleanup()
+//	srv := httptest.NewServer(h)
+//	defer srv.Close()
+func (as *AppService) EnableTestingMode(opts TestingOptions) {
+	tm := &testingMode{embedding: opts.Embedding, llm: opts.LLM}
+	if tm.embedding == nil {
+		tm.embedding = embedding.NewFakeEmbeddingService(0)
+	}
+	if tm.llm == nil {
+		tm.llm = llm.NewScriptedLLMService("")
+	}
+	as.testing = tm
+}
+
+// Handler returns a handler serving the API routes of an initialized
+// service on a mux of its own, for httptest servers. The returned function
+// stops the router's rate limiters.
+func (as *AppService) Handler() (http.Handler, func()) {
+	mux := http.NewServeMux()
+	cleanup := router.RegisterMux(mux, as.CreateApp())
+	return mux, cleanup
+}
@@ -0,0 +1,168 @@
+// Package share creates read-only, expiring links to an answer and its
+// citations so users can paste them into tickets or chats. The answer is
+// snapshotted when the link is created; later edits to the knowledge base do
+// not change what a link shows.
+package share
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultTTL is the lifetime of a link when none is requested.
+	DefaultTTL = 7 * 24 * time.Hour
+	// MaxTTL is the longest lifetime a link may be given.
+	MaxTTL = 30 * 24 * time.Hour
+	// tokenBytes is the amount of randomness in a share token.
+	tokenBytes = 24
+)
+
+// ErrNotFound is returned for unknown, expired or disabled links.
+var ErrNotFound = fmt.Errorf("分享链接不存在或已过期")
+
+// Link describes a created share link.
+type Link struct {
+	Token     string    `json:"token"`
+	QueryID   string    `json:"query_id"`
+	ProductID string    `json:"product_id"`
+	ViewCount int       `json:"view_count"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SharedAnswer is the content shown to whoever opens a share link.
+type SharedAnswer struct {
+	Question  string          `json:"question"`
+	Answer    string          `json:"answer"`
+	Sources   json.RawMessage `json:"sources"`
+	ProductID string          `json:"product_id"`
+	ViewCount int             `json:"view_count"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Service manages share links.
+type Service struct {
+	readDB  *sql.DB
+	writeDB *sql.DB
+}
+
+// NewService creates a new share Service.
+func NewService(readDB, writeDB *sql.DB) *Service {
+	return &Service{readDB: readDB, writeDB: writeDB}
+}
+
+// QueryProduct returns the product of a logged query asked by userID, so the
+// caller can check whether the product allows sharing before creating a link.
+func (s *Service) QueryProduct(queryID, userID string) (string, error) {
+	var productID string
+	err := s.readDB.QueryRow("SELECT COALESCE(product_id, '') FROM query_logs WHERE id = ? AND user_id = ?", queryID, userID).Scan(&productID)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("query not found")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up query: %w", err)
+	}
+	return productID, nil
+}
+
+// Create snapshots the answer of a logged query asked by userID and returns a
+// link valid for ttl (DefaultTTL when zero, at most MaxTTL).
+func (s *Service) Create(queryID, userID string, ttl time.Duration) (*Link, error) {
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if ttl < time.Hour || ttl > MaxTTL {
+		return nil, fmt.Errorf("有效期必须在 1 到 %d 小时之间", int(MaxTTL.Hours()))
+	}
+
+	var productID, question, answer, sources string
+	var isPending bool
+	err := s.writeDB.QueryRow(
+		"SELECT COALESCE(product_id, ''), question, COALESCE(answer, ''), COALESCE(sources, ''), is_pending FROM query_logs WHERE id = ? AND user_id = ?",
+		queryID, userID,
+	).Scan(&productID, &question, &answer, &sources, &isPending)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("query not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up query: %w", err)
+	}
+	if isPending || answer == "" {
+		return nil, fmt.Errorf("该问题尚无可分享的回答")
+	}
+	if sources == "" || sources == "null" {
+		sources = "[]"
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	link := &Link{
+		Token:     token,
+		QueryID:   queryID,
+		ProductID: productID,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if _, err := s.writeDB.Exec(
+		`INSERT INTO shared_answers (token, query_id, user_id, product_id, question, answer, sources, expires_at, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		token, queryID, userID, productID, question, answer, sources, link.ExpiresAt, now,
+	); err != nil {
+		return nil, fmt.Errorf("failed to create share link: %w", err)
+	}
+	return link, nil
+}
+
+// View returns the shared answer for a token and increments its view count.
+// allowed reports whether sharing is (still) enabled for the answer's product;
+// links of products that disabled sharing behave like unknown links.
+func (s *Service) View(token string, allowed func(productID string) bool) (*SharedAnswer, error) {
+	var a SharedAnswer
+	var sources string
+	err := s.writeDB.QueryRow(
+		"SELECT question, answer, sources, COALESCE(product_id, ''), view_count, expires_at, created_at FROM shared_answers WHERE token = ?",
+		token,
+	).Scan(&a.Question, &a.Answer, &sources, &a.ProductID, &a.ViewCount, &a.ExpiresAt, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up share link: %w", err)
+	}
+	if time.Now().After(a.ExpiresAt) || !allowed(a.ProductID) {
+		return nil, ErrNotFound
+	}
+	if _, err := s.writeDB.Exec("UPDATE shared_answers SET view_count = view_count + 1, last_viewed_at = ? WHERE token = ?", time.Now().UTC(), token); err != nil {
+		return nil, fmt.Errorf("failed to record view: %w", err)
+	}
+	a.ViewCount++
+	a.Sources = json.RawMessage(sources)
+	return &a, nil
+}
+
+// DeleteExpired removes links that expired before now and returns how many were deleted.
+func (s *Service) DeleteExpired() (int64, error) {
+	result, err := s.writeDB.Exec("DELETE FROM shared_answers WHERE expires_at < ?", time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired share links: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// generateToken returns an unguessable URL-safe token.
+func generateToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
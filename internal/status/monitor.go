@@ -0,0 +1,175 @@
+// Package status tracks the availability of the query pipeline for the public
+// status page. It only ever reports aggregate states and percentages — never
+// error messages, hostnames or configuration — so the data is safe to expose
+// to unauthenticated visitors.
+package status
+
+import (
+	"sync"
+	"time"
+)
+
+// Overall and component states.
+const (
+	StateOperational = "operational"
+	StateDegraded    = "degraded"
+	StateOutage      = "outage"
+)
+
+const (
+	// bucketSize is the granularity of recorded query outcomes.
+	bucketSize = 5 * time.Minute
+	// historyWindow is how far back availability is reported.
+	historyWindow = 24 * time.Hour
+	// recentWindow is the window used to judge the current state of the pipeline.
+	recentWindow = 15 * time.Minute
+	// minRecentSamples is the number of recent queries needed before the error
+	// rate is trusted; with fewer queries the pipeline counts as operational.
+	minRecentSamples = 5
+	// degradedErrorRate and outageErrorRate are the recent error rates at which
+	// the query pipeline is reported degraded or down.
+	degradedErrorRate = 0.10
+	outageErrorRate   = 0.50
+)
+
+// bucket counts query outcomes within one bucketSize interval.
+type bucket struct {
+	start  time.Time
+	ok     int
+	failed int
+}
+
+// Component is the state of one part of the service.
+type Component struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// Status is the public availability summary.
+type Status struct {
+	Status     string      `json:"status"`
+	Components []Component `json:"components"`
+	// Availability is the percentage of successful queries over the last 24
+	// hours, or nil when no queries were made.
+	Availability *float64  `json:"availability_24h"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Checks are the health checks evaluated together with the recorded query
+// outcomes. Each returns true when the dependency is healthy.
+type Checks struct {
+	Database   func() bool
+	Configured func() bool
+	// Embedding reports whether the embedding service is up; while it is
+	// down queries are answered from keyword search and count as degraded.
+	Embedding func() bool
+}
+
+// Monitor records query outcomes in fixed-size time buckets.
+type Monitor struct {
+	mu      sync.Mutex
+	buckets []bucket // oldest first, at most historyWindow/bucketSize entries
+	now     func() time.Time
+}
+
+// NewMonitor creates an empty Monitor.
+func NewMonitor() *Monitor {
+	return &Monitor{now: time.Now}
+}
+
+// Record adds the outcome of one query.
+func (m *Monitor) Record(ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	start := m.now().Truncate(bucketSize)
+	if n := len(m.buckets); n == 0 || !m.buckets[n-1].start.Equal(start) {
+		m.buckets = append(m.buckets, bucket{start: start})
+		m.pruneLocked()
+	}
+	b := &m.buckets[len(m.buckets)-1]
+	if ok {
+		b.ok++
+	} else {
+		b.failed++
+	}
+}
+
+// pruneLocked drops buckets older than historyWindow. Caller holds mu.
+func (m *Monitor) pruneLocked() {
+	cutoff := m.now().Add(-historyWindow)
+	i := 0
+	for i < len(m.buckets) && m.buckets[i].start.Before(cutoff) {
+		i++
+	}
+	if i > 0 {
+		m.buckets = append(m.buckets[:0], m.buckets[i:]...)
+	}
+}
+
+// counts returns the successful and failed queries since the given time.
+func (m *Monitor) counts(since time.Time) (ok, failed int) {
+	for _, b := range m.buckets {
+		if b.start.Add(bucketSize).After(since) {
+			ok += b.ok
+			failed += b.failed
+		}
+	}
+	return ok, failed
+}
+
+// Snapshot evaluates the health checks and recorded outcomes into a Status.
+func (m *Monitor) Snapshot(checks Checks) *Status {
+	m.mu.Lock()
+	now := m.now()
+	m.pruneLocked()
+	recentOK, recentFailed := m.counts(now.Add(-recentWindow))
+	dayOK, dayFailed := m.counts(now.Add(-historyWindow))
+	m.mu.Unlock()
+
+	st := &Status{UpdatedAt: now.UTC()}
+	if total := dayOK + dayFailed; total > 0 {
+		pct := float64(dayOK) * 100 / float64(total)
+		pct = float64(int(pct*100+0.5)) / 100
+		st.Availability = &pct
+	}
+
+	dbState := StateOperational
+	if checks.Database != nil && !checks.Database() {
+		dbState = StateOutage
+	}
+
+	queryState := StateOperational
+	if checks.Configured != nil && !checks.Configured() {
+		queryState = StateOutage
+	} else if total := recentOK + recentFailed; total >= minRecentSamples {
+		rate := float64(recentFailed) / float64(total)
+		switch {
+		case rate >= outageErrorRate:
+			queryState = StateOutage
+		case rate >= degradedErrorRate:
+			queryState = StateDegraded
+		}
+	}
+	if queryState == StateOperational && checks.Embedding != nil && !checks.Embedding() {
+		queryState = StateDegraded
+	}
+	if dbState == StateOutage {
+		queryState = StateOutage
+	}
+
+	st.Components = []Component{
+		{Name: "query", Status: queryState},
+		{Name: "database", Status: dbState},
+	}
+	st.Status = StateOperational
+	for _, c := range st.Components {
+		if c.Status == StateOutage {
+			st.Status = StateOutage
+			break
+		}
+		if c.Status == StateDegraded {
+			st.Status = StateDegraded
+		}
+	}
+	return st
+}
@@ -0,0 +1,58 @@
+// Package textutil shortens text for display: titles, previews, snippets and
+// log lines. Lengths are counted in runes rather than bytes, so multi-byte
+// characters such as Chinese are never cut in half.
+package textutil
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Ellipsis marks where text was cut.
+const Ellipsis = "..."
+
+// Truncate cuts s to at most n runes.
+func Truncate(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	count := 0
+	for i := range s {
+		if count == n {
+			return s[:i]
+		}
+		count++
+	}
+	return s
+}
+
+// Ellipsize cuts s to at most n runes, appending Ellipsis when it was cut.
+func Ellipsize(s string, n int) string {
+	if t := Truncate(s, n); len(t) < len(s) {
+		return t + Ellipsis
+	}
+	return s
+}
+
+// SnippetAround returns about n runes of text around the first occurrence of
+// term, ignoring case, or the start of text if it does not occur. Cut ends
+// are marked with Ellipsis.
+func SnippetAround(text, term string, n int) string {
+	lower := strings.ToLower(text)
+	i := strings.Index(lower, strings.ToLower(term))
+	if i < 0 {
+		return Ellipsize(text, n)
+	}
+	// ToLower maps rune to rune, so rune offsets in lower match text
+	runes := []rune(text)
+	start := max(utf8.RuneCountInString(lower[:i])-n/4, 0)
+	end := min(start+n, len(runes))
+	s := string(runes[start:end])
+	if start > 0 {
+		s = Ellipsis + s
+	}
+	if end < len(runes) {
+		s += Ellipsis
+	}
+	return s
+}
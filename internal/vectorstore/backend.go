@@ -0,0 +1,131 @@
+package vectorstore
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"askflow/internal/config"
+)
+
+// Backend is an external vector search engine holding a copy of the chunk
+// vectors. When one is set, Search is answered by it instead of the
+// in-process cosine scan. The SQLite chunks table stays the record of all
+// chunks: text search, fingerprints, isolated storage and admin queries keep
+// reading it, and a backend can always be rebuilt from it (see Migrate).
+type Backend interface {
+	// Upsert adds or replaces chunk vectors; chunks are identified by
+	// document ID and chunk index.
+	Upsert(chunks []BackendChunk) error
+	// Search returns the chunks closest to vector with a cosine similarity of
+	// at least threshold, restricted to productID and the public library
+	// unless productID is empty, and to chunks embedded by model (or by an
+	// unknown model) unless model is empty.
+	Search(vector []float64, topK int, threshold float64, productID, model string) ([]SearchResult, error)
+	DeleteByDocID(docID string) error
+	// Count returns the number of chunk vectors held.
+	Count() (int, error)
+	Close() error
+}
+
+// BackendChunk is a chunk vector with the metadata a Backend returns in
+// search results.
+type BackendChunk struct {
+	DocumentID   string
+	DocumentName string
+	ChunkIndex   int
+	ChunkText    string
+	ImageURL     string
+	ProductID    string
+	Model        string
+	Vector       []float64
+}
+
+// BackendOpener opens a Backend from the vector configuration.
+type BackendOpener func(cfg config.VectorConfig) (Backend, error)
+
+// DefaultBackend is the vector.backend name of the built-in in-process
+// search, which needs no Backend.
+const DefaultBackend = "sqlite"
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]BackendOpener)
+)
+
+// RegisterBackend makes a vector search backend selectable by name in
+// vector.backend. It panics if the name is registered twice.
+func RegisterBackend(name string, open BackendOpener) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if _, dup := backends[name]; dup || name == DefaultBackend {
+		panic("vectorstore: backend registered twice: " + name)
+	}
+	backends[name] = open
+}
+
+// BackendNames returns the selectable backend names, sorted, including the
+// default one.
+func BackendNames() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := []string{DefaultBackend}
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenBackend opens the backend selected by cfg.Backend. It returns nil for
+// the default in-process search.
+func OpenBackend(cfg config.VectorConfig) (Backend, error) {
+	if cfg.Backend == "" || cfg.Backend == DefaultBackend {
+		return nil, nil
+	}
+	backendsMu.RLock()
+	open, ok := backends[cfg.Backend]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown vector backend %q (available: %v)", cfg.Backend, BackendNames())
+	}
+	return open(cfg)
+}
+
+// SetBackend routes searches to b and mirrors chunk writes into it; nil
+// restores the in-process search.
+func (s *SQLiteVectorStore) SetBackend(b Backend) {
+	s.mu.Lock()
+	s.backend = b
+	s.mu.Unlock()
+}
+
+// getBackend returns the backend set with SetBackend, or nil.
+func (s *SQLiteVectorStore) getBackend() Backend {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.backend
+}
+
+// toBackendChunks converts chunks of docID for a Backend. Chunks without an
+// embedding model are stamped with model, as in SQLite.
+func toBackendChunks(docID string, chunks []VectorChunk, model string) []BackendChunk {
+	out := make([]BackendChunk, len(chunks))
+	for i, c := range chunks {
+		m := c.EmbeddingModel
+		if m == "" {
+			m = model
+		}
+		out[i] = BackendChunk{
+			DocumentID:   docID,
+			DocumentName: c.DocumentName,
+			ChunkIndex:   c.ChunkIndex,
+			ChunkText:    c.ChunkText,
+			ImageURL:     c.ImageURL,
+			ProductID:    c.ProductID,
+			Model:        m,
+			Vector:       c.Vector,
+		}
+	}
+	return out
+}
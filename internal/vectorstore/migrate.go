@@ -0,0 +1,84 @@
+package vectorstore
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrateBatch is the number of chunks read from SQLite per backend write.
+const migrateBatch = 256
+
+// CountChunks returns the number of chunks in db and the open partitions.
+func (s *SQLiteVectorStore) CountChunks(db *sql.DB) (int, error) {
+	total := 0
+	for _, d := range s.chunkDBs(db) {
+		var n int
+		if err := d.QueryRow("SELECT COUNT(*) FROM chunks").Scan(&n); err != nil {
+			return 0, fmt.Errorf("failed to count chunks: %w", err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Migrate copies every chunk of db, the main database, and of the open
+// partitions into b, calling progress with the running count after each
+// batch. Chunks already in b are overwritten, so an interrupted migration can
+// simply be run again. It returns the number of chunks copied.
+func (s *SQLiteVectorStore) Migrate(db *sql.DB, b Backend, progress func(done int)) (int, error) {
+	done := 0
+	for _, d := range s.chunkDBs(db) {
+		var lastRowID int64
+		for {
+			batch, last, err := readChunkBatch(d, lastRowID)
+			if err != nil {
+				return done, err
+			}
+			if len(batch) == 0 {
+				break
+			}
+			if err := b.Upsert(batch); err != nil {
+				return done, err
+			}
+			lastRowID = last
+			done += len(batch)
+			if progress != nil {
+				progress(done)
+			}
+		}
+	}
+	return done, nil
+}
+
+// chunkDBs returns db followed by the partition databases.
+func (s *SQLiteVectorStore) chunkDBs(db *sql.DB) []*sql.DB {
+	dbs := []*sql.DB{db}
+	for _, p := range s.allPartitions() {
+		dbs = append(dbs, p.db)
+	}
+	return dbs
+}
+
+// readChunkBatch reads up to migrateBatch chunks with a rowid above after and
+// returns them with the rowid of the last one.
+func readChunkBatch(db *sql.DB, after int64) ([]BackendChunk, int64, error) {
+	rows, err := db.Query(`SELECT rowid, document_id, document_name, chunk_index, chunk_text, embedding,
+		COALESCE(image_url, ''), COALESCE(product_id, ''), COALESCE(embedding_model, '')
+		FROM chunks WHERE rowid > ? ORDER BY rowid LIMIT ?`, after, migrateBatch)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read chunks: %w", err)
+	}
+	defer rows.Close()
+	var batch []BackendChunk
+	last := after
+	for rows.Next() {
+		var c BackendChunk
+		var embedding []byte
+		if err := rows.Scan(&last, &c.DocumentID, &c.DocumentName, &c.ChunkIndex, &c.ChunkText, &embedding, &c.ImageURL, &c.ProductID, &c.Model); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		c.Vector = DeserializeVector(embedding)
+		batch = append(batch, c)
+	}
+	return batch, last, rows.Err()
+}
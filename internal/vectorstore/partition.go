@@ -0,0 +1,201 @@
+package vectorstore
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	_ "github.com/mattn/go-sqlite3"
+	sqlitevec "github.com/nicexipi/sqlite-vec"
+)
+
+// partition is the chunk storage of a product with isolated storage: its own
+// SQLite file with a chunks table and in-memory index.
+type partition struct {
+	db    *sql.DB
+	store *sqlitevec.SQLiteVectorStore
+}
+
+// PartitionFile returns the path of the SQLite file holding the chunks of an
+// isolated product, under the partition directory dir.
+func PartitionFile(dir, productID string) string {
+	return filepath.Join(dir, productID+".db")
+}
+
+// SetPartitionDir sets the directory holding the SQLite files of products
+// with isolated storage. It must be called before OpenPartition.
+func (s *SQLiteVectorStore) SetPartitionDir(dir string) {
+	s.mu.Lock()
+	s.partitionDir = dir
+	s.mu.Unlock()
+}
+
+// OpenPartition stores the chunks of productID in a separate SQLite file
+// from now on, creating the file if needed. Opening an open partition is a
+// no-op.
+func (s *SQLiteVectorStore) OpenPartition(productID string) error {
+	if productID == "" || filepath.Base(productID) != productID {
+		return fmt.Errorf("invalid product ID for storage partition: %q", productID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.partitions[productID]; ok {
+		return nil
+	}
+	if s.partitionDir == "" {
+		return fmt.Errorf("storage partition directory not configured")
+	}
+	if err := os.MkdirAll(s.partitionDir, 0700); err != nil {
+		return fmt.Errorf("failed to create partition directory: %w", err)
+	}
+	db, err := sql.Open("sqlite3", PartitionFile(s.partitionDir, productID))
+	if err != nil {
+		return fmt.Errorf("failed to open partition database: %w", err)
+	}
+	// Like the main write pool, a single connection serializes writers
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	for _, p := range []string{"PRAGMA journal_mode=WAL", "PRAGMA busy_timeout=30000", "PRAGMA synchronous=NORMAL"} {
+		if _, err := db.Exec(p); err != nil {
+			db.Close()
+			return fmt.Errorf("failed to execute %s on partition database: %w", p, err)
+		}
+	}
+	if err := sqlitevec.EnsureTable(db); err != nil {
+		db.Close()
+		return err
+	}
+	store := sqlitevec.NewSQLiteVectorStore(db)
+	store.SetActiveModel(s.model)
+	if s.partitions == nil {
+		s.partitions = make(map[string]*partition)
+	}
+	s.partitions[productID] = &partition{db: db, store: store}
+	return nil
+}
+
+// RemovePartition closes the partition of productID and deletes its file.
+// The product must no longer have chunks.
+func (s *SQLiteVectorStore) RemovePartition(productID string) error {
+	s.mu.Lock()
+	p, ok := s.partitions[productID]
+	delete(s.partitions, productID)
+	dir := s.partitionDir
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if err := p.db.Close(); err != nil {
+		return fmt.Errorf("failed to close partition database: %w", err)
+	}
+	file := PartitionFile(dir, productID)
+	for _, f := range []string{file, file + "-wal", file + "-shm"} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove partition file: %w", err)
+		}
+	}
+	return nil
+}
+
+// PartitionDB returns the database holding the chunks of productID when the
+// product has isolated storage, or nil when they are in the main database.
+func (s *SQLiteVectorStore) PartitionDB(productID string) *sql.DB {
+	if p := s.partition(productID); p != nil {
+		return p.db
+	}
+	return nil
+}
+
+// Close closes the partition databases and the Backend, if any. The main
+// database is owned by the caller.
+func (s *SQLiteVectorStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	if s.backend != nil {
+		firstErr = s.backend.Close()
+		s.backend = nil
+	}
+	for id, p := range s.partitions {
+		if err := p.db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.partitions, id)
+	}
+	return firstErr
+}
+
+// partition returns the partition of productID, or nil.
+func (s *SQLiteVectorStore) partition(productID string) *partition {
+	if productID == "" {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.partitions[productID]
+}
+
+// allPartitions returns the open partitions.
+func (s *SQLiteVectorStore) allPartitions() []*partition {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*partition, 0, len(s.partitions))
+	for _, p := range s.partitions {
+		out = append(out, p)
+	}
+	return out
+}
+
+// searchPartitions runs search on the stores a query for productID covers —
+// the main store (the product's chunks unless isolated, plus the public
+// library) and the product's partition, or every partition for a search
+// across all products — and merges the results by score.
+func (s *SQLiteVectorStore) searchPartitions(productID string, topK int, search func(*sqlitevec.SQLiteVectorStore) ([]sqlitevec.SearchResult, error)) ([]SearchResult, error) {
+	results, err := search(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	var parts []*partition
+	if productID == "" {
+		parts = s.allPartitions()
+	} else if p := s.partition(productID); p != nil {
+		parts = []*partition{p}
+	}
+	if len(parts) == 0 {
+		return fromLibResults(results), nil
+	}
+	for _, p := range parts {
+		more, err := search(p.store)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, more...)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if topK > 0 && len(results) > topK {
+		results = results[:topK]
+	}
+	return fromLibResults(results), nil
+}
+
+// mergeFingerprints adds the fingerprint counts of b into a.
+func mergeFingerprints(a, b []Fingerprint) []Fingerprint {
+	for _, fb := range b {
+		found := false
+		for i := range a {
+			if a[i].Model == fb.Model && a[i].Dim == fb.Dim {
+				a[i].Chunks += fb.Chunks
+				a[i].Documents += fb.Documents
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, fb)
+		}
+	}
+	return a
+}
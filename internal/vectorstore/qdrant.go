@@ -0,0 +1,340 @@
+package vectorstore
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"askflow/internal/config"
+	"askflow/internal/textutil"
+)
+
+// defaultQdrantCollection is the collection name prefix used when
+// vector.qdrant.collection is empty.
+const defaultQdrantCollection = "askflow_chunks"
+
+// qdrantUpsertBatch is the number of points written per upsert request.
+const qdrantUpsertBatch = 256
+
+func init() {
+	RegisterBackend("qdrant", openQdrant)
+}
+
+// qdrantBackend is a Backend on the Qdrant REST API. Each embedding
+// dimension has its own collection, <prefix>_<dim>, created on first write,
+// since a Qdrant collection has a fixed vector size.
+type qdrantBackend struct {
+	baseURL string
+	apiKey  string
+	prefix  string
+	client  *http.Client
+
+	mu    sync.Mutex
+	ready map[int]bool // dimensions whose collection exists
+}
+
+func openQdrant(cfg config.VectorConfig) (Backend, error) {
+	if cfg.Qdrant.URL == "" {
+		return nil, fmt.Errorf("vector.qdrant.url not configured")
+	}
+	prefix := cfg.Qdrant.Collection
+	if prefix == "" {
+		prefix = defaultQdrantCollection
+	}
+	if cfg.Qdrant.APIKey != "" && !strings.HasPrefix(strings.ToLower(cfg.Qdrant.URL), "https://") {
+		log.Printf("[WARNING] Qdrant API key is being sent over non-HTTPS endpoint: %s", cfg.Qdrant.URL)
+	}
+	q := &qdrantBackend{
+		baseURL: strings.TrimRight(cfg.Qdrant.URL, "/"),
+		apiKey:  cfg.Qdrant.APIKey,
+		prefix:  prefix,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		ready:   make(map[int]bool),
+	}
+	// Fail at startup rather than on the first query when Qdrant is unreachable
+	if _, err := q.collections(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// qdrantPoint is a point of the upsert API.
+type qdrantPoint struct {
+	ID      string                 `json:"id"`
+	Vector  []float64              `json:"vector"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// qdrantPointID derives the point ID of a chunk from the SQLite chunk ID
+// (<document ID>-<chunk index>): Qdrant only accepts integers and UUIDs.
+func qdrantPointID(docID string, chunkIndex int) string {
+	h := sha1.Sum([]byte(fmt.Sprintf("%s-%d", docID, chunkIndex)))
+	h[6] = (h[6] & 0x0f) | 0x50 // version 5
+	h[8] = (h[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+func (q *qdrantBackend) collectionName(dim int) string {
+	return fmt.Sprintf("%s_%d", q.prefix, dim)
+}
+
+// collections returns the names of this backend's collections.
+func (q *qdrantBackend) collections() ([]string, error) {
+	var resp struct {
+		Result struct {
+			Collections []struct {
+				Name string `json:"name"`
+			} `json:"collections"`
+		} `json:"result"`
+	}
+	if err := q.do(http.MethodGet, "/collections", nil, &resp); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, c := range resp.Result.Collections {
+		if strings.HasPrefix(c.Name, q.prefix+"_") {
+			names = append(names, c.Name)
+		}
+	}
+	return names, nil
+}
+
+// ensureCollection creates the collection for vectors of dimension dim, with
+// keyword indexes on the payload fields searches and deletes filter on.
+func (q *qdrantBackend) ensureCollection(dim int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ready[dim] {
+		return nil
+	}
+	name := q.collectionName(dim)
+	err := q.do(http.MethodGet, "/collections/"+name, nil, nil)
+	if err != nil && !isQdrantNotFound(err) {
+		return err
+	}
+	if err != nil {
+		body := map[string]interface{}{"vectors": map[string]interface{}{"size": dim, "distance": "Cosine"}}
+		if err := q.do(http.MethodPut, "/collections/"+name, body, nil); err != nil {
+			return fmt.Errorf("failed to create Qdrant collection %s: %w", name, err)
+		}
+		for _, field := range []string{"document_id", "product_id", "model"} {
+			body := map[string]interface{}{"field_name": field, "field_schema": "keyword"}
+			if err := q.do(http.MethodPut, "/collections/"+name+"/index?wait=true", body, nil); err != nil {
+				return fmt.Errorf("failed to index Qdrant payload field %s: %w", field, err)
+			}
+		}
+	}
+	q.ready[dim] = true
+	return nil
+}
+
+// Upsert writes chunk vectors, grouped by dimension.
+func (q *qdrantBackend) Upsert(chunks []BackendChunk) error {
+	byDim := make(map[int][]qdrantPoint)
+	for _, c := range chunks {
+		if len(c.Vector) == 0 {
+			continue
+		}
+		byDim[len(c.Vector)] = append(byDim[len(c.Vector)], qdrantPoint{
+			ID:     qdrantPointID(c.DocumentID, c.ChunkIndex),
+			Vector: c.Vector,
+			Payload: map[string]interface{}{
+				"document_id":   c.DocumentID,
+				"document_name": c.DocumentName,
+				"chunk_index":   c.ChunkIndex,
+				"chunk_text":    c.ChunkText,
+				"image_url":     c.ImageURL,
+				"product_id":    c.ProductID,
+				"model":         c.Model,
+			},
+		})
+	}
+	for dim, points := range byDim {
+		if err := q.ensureCollection(dim); err != nil {
+			return err
+		}
+		// Batches keep requests under Qdrant's request size limit
+		for start := 0; start < len(points); start += qdrantUpsertBatch {
+			end := min(start+qdrantUpsertBatch, len(points))
+			body := map[string]interface{}{"points": points[start:end]}
+			if err := q.do(http.MethodPut, "/collections/"+q.collectionName(dim)+"/points?wait=true", body, nil); err != nil {
+				return fmt.Errorf("failed to upsert Qdrant points: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Search queries the collection of the query vector's dimension.
+func (q *qdrantBackend) Search(vector []float64, topK int, threshold float64, productID, model string) ([]SearchResult, error) {
+	if len(vector) == 0 || topK <= 0 {
+		return nil, nil
+	}
+	var must []interface{}
+	if productID != "" {
+		must = append(must, map[string]interface{}{"key": "product_id", "match": map[string]interface{}{"any": []string{productID, ""}}})
+	}
+	if model != "" {
+		must = append(must, map[string]interface{}{"key": "model", "match": map[string]interface{}{"any": []string{model, ""}}})
+	}
+	body := map[string]interface{}{
+		"vector":          vector,
+		"limit":           topK,
+		"score_threshold": threshold,
+		"with_payload":    true,
+	}
+	if len(must) > 0 {
+		body["filter"] = map[string]interface{}{"must": must}
+	}
+	var resp struct {
+		Result []struct {
+			Score   float64 `json:"score"`
+			Payload struct {
+				DocumentID   string `json:"document_id"`
+				DocumentName string `json:"document_name"`
+				ChunkIndex   int    `json:"chunk_index"`
+				ChunkText    string `json:"chunk_text"`
+				ImageURL     string `json:"image_url"`
+				ProductID    string `json:"product_id"`
+			} `json:"payload"`
+		} `json:"result"`
+	}
+	err := q.do(http.MethodPost, "/collections/"+q.collectionName(len(vector))+"/points/search", body, &resp)
+	if isQdrantNotFound(err) {
+		// Nothing was stored at this dimension yet
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Qdrant search failed: %w", err)
+	}
+	results := make([]SearchResult, len(resp.Result))
+	for i, r := range resp.Result {
+		results[i] = SearchResult{
+			ChunkText:    r.Payload.ChunkText,
+			ChunkIndex:   r.Payload.ChunkIndex,
+			DocumentID:   r.Payload.DocumentID,
+			DocumentName: r.Payload.DocumentName,
+			Score:        r.Score,
+			ImageURL:     r.Payload.ImageURL,
+			ProductID:    r.Payload.ProductID,
+		}
+	}
+	return results, nil
+}
+
+// DeleteByDocID deletes the document's points from every collection.
+func (q *qdrantBackend) DeleteByDocID(docID string) error {
+	names, err := q.collections()
+	if err != nil {
+		return err
+	}
+	body := map[string]interface{}{
+		"filter": map[string]interface{}{
+			"must": []interface{}{map[string]interface{}{"key": "document_id", "match": map[string]interface{}{"value": docID}}},
+		},
+	}
+	for _, name := range names {
+		if err := q.do(http.MethodPost, "/collections/"+name+"/points/delete?wait=true", body, nil); err != nil {
+			return fmt.Errorf("failed to delete Qdrant points: %w", err)
+		}
+	}
+	return nil
+}
+
+// Count sums the points of every collection.
+func (q *qdrantBackend) Count() (int, error) {
+	names, err := q.collections()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, name := range names {
+		var resp struct {
+			Result struct {
+				Count int `json:"count"`
+			} `json:"result"`
+		}
+		if err := q.do(http.MethodPost, "/collections/"+name+"/points/count", map[string]interface{}{"exact": true}, &resp); err != nil {
+			return 0, err
+		}
+		total += resp.Result.Count
+	}
+	return total, nil
+}
+
+func (q *qdrantBackend) Close() error {
+	q.client.CloseIdleConnections()
+	return nil
+}
+
+// qdrantError is an error response of the Qdrant API.
+type qdrantError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *qdrantError) Error() string {
+	return fmt.Sprintf("Qdrant API error (HTTP %d): %s", e.StatusCode, e.Message)
+}
+
+func isQdrantNotFound(err error) bool {
+	qe, ok := err.(*qdrantError)
+	return ok && qe.StatusCode == http.StatusNotFound
+}
+
+// do sends a JSON request to the Qdrant API and decodes the response into
+// out, if not nil.
+func (q *qdrantBackend) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, q.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if q.apiKey != "" {
+		req.Header.Set("api-key", q.apiKey)
+	}
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Qdrant request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var parsed struct {
+			Status struct {
+				Error string `json:"error"`
+			} `json:"status"`
+		}
+		msg := strings.TrimSpace(string(respBody))
+		if json.Unmarshal(respBody, &parsed) == nil && parsed.Status.Error != "" {
+			msg = parsed.Status.Error
+		}
+		return &qdrantError{StatusCode: resp.StatusCode, Message: textutil.Truncate(msg, 500)}
+	}
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+	return nil
+}
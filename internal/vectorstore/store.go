@@ -5,6 +5,9 @@ package vectorstore
 
 import (
 	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
 
 	sqlitevec "github.com/nicexipi/sqlite-vec"
 )
@@ -15,8 +18,20 @@ type VectorStore interface {
 	Search(queryVector []float64, topK int, threshold float64, productID string) ([]SearchResult, error)
 	TextSearch(query string, topK int, threshold float64, productID string) ([]SearchResult, error)
 	DeleteByDocID(docID string) error
+	// PartitionDB returns the database holding the chunks of a product with
+	// isolated storage, or nil when they are in the main database.
+	PartitionDB(productID string) *sql.DB
+	// SetEmbeddingModel records the model that produces new chunk and query
+	// vectors. Stored chunks are stamped with it and Search skips chunks
+	// embedded by another model.
+	SetEmbeddingModel(model string)
+	Fingerprints() ([]Fingerprint, error)
+	OutdatedDocuments(model string, dim int) ([]string, error)
 }
 
+// Fingerprint counts the chunks embedded by one model at one dimension.
+type Fingerprint = sqlitevec.Fingerprint
+
 // VectorChunk represents a document chunk with its embedding vector.
 type VectorChunk struct {
 	ChunkText    string    `json:"chunk_text"`
@@ -26,6 +41,9 @@ type VectorChunk struct {
 	Vector       []float64 `json:"vector"`
 	ImageURL     string    `json:"image_url,omitempty"`
 	ProductID    string    `json:"product_id"`
+	// EmbeddingModel is the model that produced Vector; empty means the
+	// store's current embedding model.
+	EmbeddingModel string `json:"embedding_model,omitempty"`
 }
 
 // SearchResult represents a search result with similarity score.
@@ -39,11 +57,20 @@ type SearchResult struct {
 	ProductID    string  `json:"product_id"`
 	StartTime    float64 `json:"start_time,omitempty"`
 	EndTime      float64 `json:"end_time,omitempty"`
+	RerankScore  float64 `json:"rerank_score,omitempty"` // set when the query reranked its results
 }
 
-// SQLiteVectorStore wraps the sqlite-vec library's implementation.
+// SQLiteVectorStore wraps the sqlite-vec library's implementation. Chunks of
+// products with isolated storage are kept in per-product SQLite files (see
+// OpenPartition); everything else is in the main database. Vector searches
+// go to an external engine instead when a Backend is set.
 type SQLiteVectorStore struct {
-	inner *sqlitevec.SQLiteVectorStore
+	inner        *sqlitevec.SQLiteVectorStore
+	mu           sync.RWMutex
+	model        string
+	partitionDir string
+	partitions   map[string]*partition // product ID -> isolated storage
+	backend      Backend               // external search engine, nil for in-process search
 }
 
 // SIMDCapability returns a human-readable string describing the active SIMD
@@ -60,9 +87,14 @@ func NewSQLiteVectorStore(db *sql.DB) *SQLiteVectorStore {
 }
 
 // toLibChunks converts local VectorChunk slice to library VectorChunk slice.
-func toLibChunks(chunks []VectorChunk) []sqlitevec.VectorChunk {
+// Chunks without an embedding model are stamped with model.
+func toLibChunks(chunks []VectorChunk, model string) []sqlitevec.VectorChunk {
 	out := make([]sqlitevec.VectorChunk, len(chunks))
 	for i, c := range chunks {
+		m := c.EmbeddingModel
+		if m == "" {
+			m = model
+		}
 		out[i] = sqlitevec.VectorChunk{
 			ChunkText:    c.ChunkText,
 			ChunkIndex:   c.ChunkIndex,
@@ -71,6 +103,7 @@ func toLibChunks(chunks []VectorChunk) []sqlitevec.VectorChunk {
 			Vector:       c.Vector,
 			ImageURL:     c.ImageURL,
 			PartitionID:  c.ProductID,
+			Model:        m,
 		}
 	}
 	return out
@@ -95,30 +128,145 @@ func fromLibResults(results []sqlitevec.SearchResult) []SearchResult {
 	return out
 }
 
-// Store inserts a batch of VectorChunks into the chunks table and updates the cache.
+// Store inserts a batch of VectorChunks into the chunks table and updates the
+// cache. Chunks of products with isolated storage go to their partition. With
+// a Backend the vectors are also written to it, after SQLite.
 func (s *SQLiteVectorStore) Store(docID string, chunks []VectorChunk) error {
-	return s.inner.Store(docID, toLibChunks(chunks))
+	s.mu.RLock()
+	model := s.model
+	s.mu.RUnlock()
+	if err := s.storeSQLite(docID, chunks, model); err != nil {
+		return err
+	}
+	if b := s.getBackend(); b != nil && len(chunks) > 0 {
+		if err := b.Upsert(toBackendChunks(docID, chunks, model)); err != nil {
+			return fmt.Errorf("failed to write vectors to search backend: %w", err)
+		}
+	}
+	return nil
 }
 
-// Search performs cosine similarity search against stored vectors.
+// storeSQLite inserts chunks into the main database or their partition.
+func (s *SQLiteVectorStore) storeSQLite(docID string, chunks []VectorChunk, model string) error {
+	var main []VectorChunk
+	isolated := make(map[*partition][]VectorChunk)
+	for _, c := range chunks {
+		if p := s.partition(c.ProductID); p != nil {
+			isolated[p] = append(isolated[p], c)
+		} else {
+			main = append(main, c)
+		}
+	}
+	for p, cs := range isolated {
+		if err := p.store.Store(docID, toLibChunks(cs, model)); err != nil {
+			return err
+		}
+	}
+	if len(main) == 0 && len(isolated) > 0 {
+		return nil
+	}
+	return s.inner.Store(docID, toLibChunks(main, model))
+}
+
+// Search performs cosine similarity search against stored vectors, in the
+// Backend if one is set.
 func (s *SQLiteVectorStore) Search(queryVector []float64, topK int, threshold float64, productID string) ([]SearchResult, error) {
-	results, err := s.inner.Search(queryVector, topK, threshold, productID)
-	if err != nil {
-		return nil, err
+	if b := s.getBackend(); b != nil {
+		s.mu.RLock()
+		model := s.model
+		s.mu.RUnlock()
+		return b.Search(queryVector, topK, threshold, productID, model)
 	}
-	return fromLibResults(results), nil
+	return s.searchPartitions(productID, topK, func(st *sqlitevec.SQLiteVectorStore) ([]sqlitevec.SearchResult, error) {
+		return st.Search(queryVector, topK, threshold, productID)
+	})
 }
 
 // TextSearch performs text-based similarity search.
 func (s *SQLiteVectorStore) TextSearch(query string, topK int, threshold float64, productID string) ([]SearchResult, error) {
-	results, err := s.inner.TextSearch(query, topK, threshold, productID)
+	return s.searchPartitions(productID, topK, func(st *sqlitevec.SQLiteVectorStore) ([]sqlitevec.SearchResult, error) {
+		return st.TextSearch(query, topK, threshold, productID)
+	})
+}
+
+// DeleteByDocID removes all chunks for the given document.
+func (s *SQLiteVectorStore) DeleteByDocID(docID string) error {
+	if err := s.inner.DeleteByDocID(docID); err != nil {
+		return err
+	}
+	for _, p := range s.allPartitions() {
+		if err := p.store.DeleteByDocID(docID); err != nil {
+			return err
+		}
+	}
+	if b := s.getBackend(); b != nil {
+		if err := b.DeleteByDocID(docID); err != nil {
+			return fmt.Errorf("failed to delete vectors from search backend: %w", err)
+		}
+	}
+	return nil
+}
+
+// SetEmbeddingModel sets the model stamped on stored chunks and used to
+// filter search results.
+func (s *SQLiteVectorStore) SetEmbeddingModel(model string) {
+	s.mu.Lock()
+	s.model = model
+	s.mu.Unlock()
+	s.inner.SetActiveModel(model)
+	for _, p := range s.allPartitions() {
+		p.store.SetActiveModel(model)
+	}
+}
+
+// Fingerprints groups the stored chunks by embedding model and dimension,
+// largest group first.
+func (s *SQLiteVectorStore) Fingerprints() ([]Fingerprint, error) {
+	groups, err := s.inner.Fingerprints()
 	if err != nil {
 		return nil, err
 	}
-	return fromLibResults(results), nil
+	parts := s.allPartitions()
+	if len(parts) == 0 {
+		return groups, nil
+	}
+	for _, p := range parts {
+		more, err := p.store.Fingerprints()
+		if err != nil {
+			return nil, err
+		}
+		groups = mergeFingerprints(groups, more)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Chunks != groups[j].Chunks {
+			return groups[i].Chunks > groups[j].Chunks
+		}
+		if groups[i].Model != groups[j].Model {
+			return groups[i].Model < groups[j].Model
+		}
+		return groups[i].Dim < groups[j].Dim
+	})
+	return groups, nil
 }
 
-// DeleteByDocID removes all chunks for the given document.
-func (s *SQLiteVectorStore) DeleteByDocID(docID string) error {
-	return s.inner.DeleteByDocID(docID)
+// OutdatedDocuments returns the documents with chunks not embedded by model
+// at dimension dim (0 for any), sorted.
+func (s *SQLiteVectorStore) OutdatedDocuments(model string, dim int) ([]string, error) {
+	ids, err := s.inner.OutdatedDocuments(model, dim)
+	if err != nil {
+		return nil, err
+	}
+	parts := s.allPartitions()
+	if len(parts) == 0 {
+		return ids, nil
+	}
+	for _, p := range parts {
+		more, err := p.store.OutdatedDocuments(model, dim)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, more...)
+	}
+	sort.Strings(ids)
+	return ids, nil
 }
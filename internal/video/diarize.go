@@ -0,0 +1,87 @@
+package video
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SpeakerTurn 说话人分离结果中的一段发言
+type SpeakerTurn struct {
+	Start   float64 `json:"start"`   // 起始时间（秒）
+	End     float64 `json:"end"`     // 结束时间（秒）
+	Speaker string  `json:"speaker"` // 说话人标识，如 "SPEAKER_00"
+}
+
+// minTurnSeconds 短于此时长的发言（多为附和声或噪声）不单独转录
+const minTurnSeconds = 0.5
+
+// Diarize 调用外部说话人分离程序处理 WAV 音频。程序以音频路径为唯一参数，
+// 在 stdout 输出 JSON 数组 [{"start": 0.0, "end": 3.2, "speaker": "SPEAKER_00"}]。
+// 返回按时间排序、且已合并同一说话人连续发言的结果。
+func Diarize(ctx context.Context, command, audioPath string) ([]SpeakerTurn, error) {
+	if strings.ContainsAny(audioPath, "|;&$`") {
+		return nil, fmt.Errorf("音频路径包含非法字符")
+	}
+	out, err := exec.CommandContext(ctx, command, audioPath).Output()
+	if err != nil {
+		return nil, fmt.Errorf("说话人分离失败: %s", commandError(err))
+	}
+	var turns []SpeakerTurn
+	if err := json.Unmarshal(out, &turns); err != nil {
+		return nil, fmt.Errorf("解析说话人分离结果失败: %w", err)
+	}
+	return MergeTurns(turns), nil
+}
+
+// MergeTurns 按时间排序发言，丢弃过短的发言并合并同一说话人的连续发言，
+// 以减少逐段转录的次数
+func MergeTurns(turns []SpeakerTurn) []SpeakerTurn {
+	sort.SliceStable(turns, func(i, j int) bool { return turns[i].Start < turns[j].Start })
+	var merged []SpeakerTurn
+	for _, t := range turns {
+		t.Speaker = strings.TrimSpace(t.Speaker)
+		if t.End-t.Start < minTurnSeconds {
+			continue
+		}
+		if n := len(merged); n > 0 && merged[n-1].Speaker == t.Speaker {
+			if t.End > merged[n-1].End {
+				merged[n-1].End = t.End
+			}
+			continue
+		}
+		merged = append(merged, t)
+	}
+	return merged
+}
+
+// ExtractClip 调用 ffmpeg 截取音频中 [start, end) 的片段，输出为 16kHz 单声道 WAV 文件
+func (p *Parser) ExtractClip(audioPath string, start, end float64, outputPath string) error {
+	if p.FFmpegPath == "" {
+		return fmt.Errorf("ffmpeg 路径未配置")
+	}
+	for _, path := range []string{audioPath, outputPath} {
+		if strings.ContainsAny(path, "|;&$`") {
+			return fmt.Errorf("路径包含非法字符: %s", path)
+		}
+	}
+	cmd := exec.Command(p.FFmpegPath,
+		"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+		"-to", strconv.FormatFloat(end, 'f', 3, 64),
+		"-i", audioPath,
+		"-acodec", "pcm_s16le",
+		"-ar", "16000",
+		"-ac", "1",
+		"-y",
+		outputPath,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg 音频截取失败: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+	return nil
+}
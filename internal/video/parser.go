@@ -8,8 +8,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 
 	"askflow/internal/config"
@@ -190,6 +192,10 @@ type Parser struct {
 	RapidSpeechPath   string
 	KeyframeInterval  int
 	RapidSpeechModel  string
+	KeyframeMode      string  // "interval" 或 "scene"
+	SceneThreshold    float64 // 场景切换阈值（0-1），仅 scene 模式
+	MinInterval       int     // scene 模式下相邻关键帧的最小间隔（秒）
+	MaxFrames         int     // 每个视频保留的最大关键帧数（0=不限制）
 }
 
 // NewParser 根据 VideoConfig 创建 Parser 实例
@@ -198,11 +204,23 @@ func NewParser(cfg config.VideoConfig) *Parser {
 	if interval <= 0 {
 		interval = 10
 	}
+	mode := cfg.KeyframeMode
+	if mode != config.KeyframeModeScene {
+		mode = config.KeyframeModeInterval
+	}
+	threshold := cfg.SceneThreshold
+	if threshold <= 0 || threshold >= 1 {
+		threshold = 0.3
+	}
 	return &Parser{
 		FFmpegPath:       cfg.FFmpegPath,
 		RapidSpeechPath:  cfg.RapidSpeechPath,
 		KeyframeInterval: interval,
 		RapidSpeechModel: cfg.RapidSpeechModel,
+		KeyframeMode:     mode,
+		SceneThreshold:   threshold,
+		MinInterval:      cfg.KeyframeMinInterval,
+		MaxFrames:        cfg.KeyframeMaxFrames,
 	}
 }
 
@@ -387,7 +405,9 @@ func (p *Parser) Transcribe(audioPath string) ([]TranscriptSegment, error) {
 	}, nil
 }
 
-// ExtractKeyframes 调用 ffmpeg 按 KeyframeInterval 间隔从视频中提取关键帧图像
+// ExtractKeyframes 调用 ffmpeg 从视频中提取关键帧图像。
+// interval 模式按 KeyframeInterval 固定间隔抽帧；scene 模式使用 select 滤镜在场景切换处抽帧，
+// 并保证相邻关键帧间隔不小于 MinInterval。结果超过 MaxFrames 时均匀抽样保留。
 func (p *Parser) ExtractKeyframes(videoPath, outputDir string) ([]Keyframe, error) {
 	if p.FFmpegPath == "" {
 		return nil, fmt.Errorf("ffmpeg 路径未配置")
@@ -399,13 +419,32 @@ func (p *Parser) ExtractKeyframes(videoPath, outputDir string) ([]Keyframe, erro
 		}
 	}
 
+	sceneMode := p.KeyframeMode == config.KeyframeModeScene
 	outputPattern := filepath.Join(outputDir, "frame_%04d.jpg")
-	cmd := exec.Command(p.FFmpegPath,
-		"-i", videoPath,
-		"-vf", fmt.Sprintf("fps=1/%d", p.KeyframeInterval),
-		"-q:v", "2",
-		outputPattern,
-	)
+	var args []string
+	if sceneMode {
+		// The first frame is always kept so that videos without cuts still get a keyframe.
+		// showinfo logs pts_time for every selected frame, which gives the real timestamps.
+		expr := fmt.Sprintf("eq(n,0)+gt(scene,%.3f)", p.SceneThreshold)
+		if p.MinInterval > 0 {
+			expr = fmt.Sprintf("eq(n,0)+gt(scene,%.3f)*gte(t-prev_selected_t,%d)", p.SceneThreshold, p.MinInterval)
+		}
+		args = []string{
+			"-i", videoPath,
+			"-vf", fmt.Sprintf("select='%s',showinfo", expr),
+			"-vsync", "vfr",
+			"-q:v", "2",
+			outputPattern,
+		}
+	} else {
+		args = []string{
+			"-i", videoPath,
+			"-vf", fmt.Sprintf("fps=1/%d", p.KeyframeInterval),
+			"-q:v", "2",
+			outputPattern,
+		}
+	}
+	cmd := exec.Command(p.FFmpegPath, args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("ffmpeg 关键帧提取失败: %s: %w", strings.TrimSpace(string(output)), err)
@@ -425,12 +464,14 @@ func (p *Parser) ExtractKeyframes(videoPath, outputDir string) ([]Keyframe, erro
 	}
 
 	// If no frames extracted (video shorter than keyframe interval), extract one frame from the middle
+	var fallbackTime float64
 	if len(frameFiles) == 0 {
 		duration := p.ProbeDuration(videoPath)
 		seekTime := duration / 2
 		if seekTime < 0 {
 			seekTime = 0
 		}
+		fallbackTime = seekTime
 		singleFrame := filepath.Join(outputDir, "frame_0001.jpg")
 		fallbackCmd := exec.Command(p.FFmpegPath,
 			"-ss", fmt.Sprintf("%.2f", seekTime),
@@ -441,6 +482,7 @@ func (p *Parser) ExtractKeyframes(videoPath, outputDir string) ([]Keyframe, erro
 		)
 		if fbOut, fbErr := fallbackCmd.CombinedOutput(); fbErr == nil {
 			frameFiles = append(frameFiles, "frame_0001.jpg")
+			sceneMode = false
 		} else {
 			// Log but don't fail — video may have no video stream
 			_ = fbOut
@@ -449,15 +491,62 @@ func (p *Parser) ExtractKeyframes(videoPath, outputDir string) ([]Keyframe, erro
 
 	sort.Strings(frameFiles)
 
+	var sceneTimes []float64
+	if sceneMode {
+		sceneTimes = parseShowinfoTimes(string(output))
+	}
+
 	keyframes := make([]Keyframe, 0, len(frameFiles))
 	for i, name := range frameFiles {
+		ts := float64(i * p.KeyframeInterval)
+		switch {
+		case fallbackTime > 0:
+			ts = fallbackTime
+		case sceneMode && i < len(sceneTimes):
+			ts = sceneTimes[i]
+		case sceneMode && len(sceneTimes) > 0:
+			ts = sceneTimes[len(sceneTimes)-1]
+		}
 		keyframes = append(keyframes, Keyframe{
-			Timestamp: float64(i * p.KeyframeInterval),
+			Timestamp: ts,
 			FilePath:  filepath.Join(outputDir, name),
 		})
 	}
 
-	return keyframes, nil
+	return limitKeyframes(keyframes, p.MaxFrames), nil
+}
+
+// showinfoPTSRe matches the pts_time field of an ffmpeg showinfo log line.
+var showinfoPTSRe = regexp.MustCompile(`Parsed_showinfo.*\bpts_time:\s*([0-9.]+)`)
+
+// parseShowinfoTimes extracts the timestamps (seconds) of selected frames, in output order,
+// from ffmpeg showinfo log output.
+func parseShowinfoTimes(output string) []float64 {
+	var times []float64
+	for _, line := range strings.Split(output, "\n") {
+		m := showinfoPTSRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if t, err := strconv.ParseFloat(m[1], 64); err == nil {
+			times = append(times, t)
+		}
+	}
+	return times
+}
+
+// limitKeyframes evenly samples keyframes down to maxFrames (0 = unlimited),
+// always keeping the first frame so coverage stays spread across the whole video.
+func limitKeyframes(keyframes []Keyframe, maxFrames int) []Keyframe {
+	if maxFrames <= 0 || len(keyframes) <= maxFrames {
+		return keyframes
+	}
+	kept := make([]Keyframe, 0, maxFrames)
+	step := float64(len(keyframes)) / float64(maxFrames)
+	for i := 0; i < maxFrames; i++ {
+		kept = append(kept, keyframes[int(float64(i)*step)])
+	}
+	return kept
 }
 
 // ProbeDuration 调用 ffmpeg 获取视频时长（秒）。
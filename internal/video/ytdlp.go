@@ -0,0 +1,194 @@
+package video
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Downloader 通过 yt-dlp 获取视频平台（YouTube、Vimeo）的视频信息、字幕和视频文件
+type Downloader struct {
+	YtDlpPath string
+}
+
+// RemoteInfo 平台视频的元信息
+type RemoteInfo struct {
+	Title             string                       `json:"title"`
+	Duration          float64                      `json:"duration"` // 秒，未知时为 0
+	Language          string                       `json:"language"` // 视频原始语言，可能为空
+	Subtitles         map[string][]json.RawMessage `json:"subtitles"`
+	AutomaticCaptions map[string][]json.RawMessage `json:"automatic_captions"`
+}
+
+// Info 读取视频元信息，不下载视频
+func (d *Downloader) Info(ctx context.Context, url string) (*RemoteInfo, error) {
+	cmd := exec.CommandContext(ctx, d.YtDlpPath, "--dump-single-json", "--no-playlist", "--skip-download", "--", url)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("获取视频信息失败: %s", commandError(err))
+	}
+	var info RemoteInfo
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, fmt.Errorf("解析视频信息失败: %w", err)
+	}
+	return &info, nil
+}
+
+// CaptionLanguage 选择要使用的字幕：优先人工字幕，其次视频原始语言的自动字幕。
+// 依次尝试视频原始语言、中文和英文，人工字幕再退而取任一语言。没有可用字幕时 lang 为空。
+func (info *RemoteInfo) CaptionLanguage() (lang string, auto bool) {
+	prefs := []string{info.Language, "zh-Hans", "zh-CN", "zh", "en"}
+	for _, l := range prefs {
+		if _, ok := info.Subtitles[l]; ok && l != "" {
+			return l, false
+		}
+	}
+	if len(info.Subtitles) > 0 {
+		langs := make([]string, 0, len(info.Subtitles))
+		for l := range info.Subtitles {
+			if l != "live_chat" {
+				langs = append(langs, l)
+			}
+		}
+		if len(langs) > 0 {
+			sort.Strings(langs)
+			return langs[0], false
+		}
+	}
+	// 自动字幕包含大量机器翻译版本，只取原始语言的识别结果
+	if _, ok := info.AutomaticCaptions[info.Language]; ok && info.Language != "" {
+		return info.Language, true
+	}
+	return "", false
+}
+
+// Captions 下载 lang 字幕（WebVTT）并解析为转录片段。平台没有 WebVTT 格式的字幕时返回 nil。
+func (d *Downloader) Captions(ctx context.Context, url, lang string, auto bool, dir string) ([]TranscriptSegment, error) {
+	flag := "--write-subs"
+	if auto {
+		flag = "--write-auto-subs"
+	}
+	cmd := exec.CommandContext(ctx, d.YtDlpPath, "--skip-download", flag, "--sub-langs", lang, "--sub-format", "vtt",
+		"--no-playlist", "-o", filepath.Join(dir, "captions.%(ext)s"), "--", url)
+	if _, err := cmd.Output(); err != nil {
+		return nil, fmt.Errorf("下载字幕失败: %s", commandError(err))
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "captions*.vtt"))
+	if len(files) == 0 {
+		return nil, nil
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		return nil, fmt.Errorf("读取字幕失败: %w", err)
+	}
+	return ParseVTT(string(data)), nil
+}
+
+// Download 下载视频到 dir，优先 mp4 格式，超过 maxBytes 的视频不下载。返回视频文件路径。
+func (d *Downloader) Download(ctx context.Context, url, dir string, maxBytes int64) (string, error) {
+	cmd := exec.CommandContext(ctx, d.YtDlpPath, "-f", "b[ext=mp4]/b", "--max-filesize", strconv.FormatInt(maxBytes, 10),
+		"--no-playlist", "--no-part", "-o", filepath.Join(dir, "video.%(ext)s"), "--", url)
+	if _, err := cmd.Output(); err != nil {
+		return "", fmt.Errorf("下载视频失败: %s", commandError(err))
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "video.*"))
+	if len(files) == 0 {
+		// yt-dlp 跳过超过 --max-filesize 的视频时不报错
+		return "", fmt.Errorf("视频超过大小限制（%d MB）", maxBytes>>20)
+	}
+	if info, err := os.Stat(files[0]); err == nil && info.Size() > maxBytes {
+		os.Remove(files[0])
+		return "", fmt.Errorf("视频超过大小限制（%d MB）", maxBytes>>20)
+	}
+	return files[0], nil
+}
+
+// commandError 返回命令失败的原因，优先使用 stderr 的最后一行
+func commandError(err error) string {
+	if ee, ok := err.(*exec.ExitError); ok {
+		lines := strings.Split(strings.TrimSpace(string(ee.Stderr)), "\n")
+		if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+			return last
+		}
+	}
+	return err.Error()
+}
+
+var vttTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// ParseVTT 将 WebVTT 字幕解析为转录片段。自动字幕逐条滚动时会重复上一条的文字，
+// 与上一条重复的行只保留一次。
+func ParseVTT(data string) []TranscriptSegment {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	var segments []TranscriptSegment
+	prev := map[string]bool{}
+	for _, block := range strings.Split(data, "\n\n") {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		timing := -1
+		for i, line := range lines {
+			if strings.Contains(line, "-->") {
+				timing = i
+				break
+			}
+		}
+		if timing < 0 {
+			continue
+		}
+		parts := strings.Fields(strings.Replace(lines[timing], "-->", " ", 1))
+		if len(parts) < 2 {
+			continue
+		}
+		start, ok1 := parseVTTTime(parts[0])
+		end, ok2 := parseVTTTime(parts[1])
+		if !ok1 || !ok2 {
+			continue
+		}
+		cur := map[string]bool{}
+		var text []string
+		for _, line := range lines[timing+1:] {
+			line = strings.TrimSpace(html.UnescapeString(vttTagRe.ReplaceAllString(line, "")))
+			if line == "" {
+				continue
+			}
+			cur[line] = true
+			if !prev[line] {
+				text = append(text, line)
+			}
+		}
+		prev = cur
+		if len(text) == 0 {
+			continue
+		}
+		segments = append(segments, TranscriptSegment{Start: start, End: end, Text: strings.Join(text, " ")})
+	}
+	return segments
+}
+
+// parseVTTTime 解析 "hh:mm:ss.mmm" 或 "mm:ss.mmm" 格式的时间
+func parseVTTTime(s string) (float64, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+	var total float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.Replace(p, ",", ".", 1), 64)
+		if err != nil {
+			return 0, false
+		}
+		if i < len(parts)-1 {
+			total = (total + v) * 60
+		} else {
+			total += v
+		}
+	}
+	return total, true
+}
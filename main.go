@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"askflow/internal/cli"
+	"askflow/internal/datadir"
 	"askflow/internal/handler"
 	"askflow/internal/router"
 	"askflow/internal/service"
@@ -31,6 +32,9 @@ func main() {
 
 	// Parse datadir flag from command line
 	dataDir := parseDataDirFlag()
+	if err := datadir.SetRoot(dataDir); err != nil {
+		log.Fatalf("Invalid data directory: %v", err)
+	}
 
 	// Handle command-line commands
 	if len(os.Args) >= 2 && !isService {
@@ -57,7 +61,7 @@ func main() {
 			return
 		case "backup":
 			runCLICommand(dataDir, func(appSvc *service.AppService) {
-				cli.RunBackup(os.Args[2:], appSvc.GetDatabase())
+				cli.RunBackup(os.Args[2:], appSvc.GetDatabase(), appSvc.GetConfigManager().Get().Backup.S3)
 			})
 			return
 		case "restore":
@@ -68,6 +72,21 @@ func main() {
 				cli.RunListProducts(appSvc.GetProductService())
 			})
 			return
+		case "migrate-vectors":
+			runCLICommand(dataDir, func(appSvc *service.AppService) {
+				cli.RunMigrateVectors(os.Args[2:], appSvc.GetDatabase(), appSvc.GetVectorStore(), appSvc.GetConfigManager())
+			})
+			return
+		case "pending":
+			runCLICommand(dataDir, func(appSvc *service.AppService) {
+				cli.RunPending(os.Args[2:], appSvc.GetPendingManager(), appSvc.GetConfigManager())
+			})
+			return
+		case "safemode":
+			runCLICommand(dataDir, func(appSvc *service.AppService) {
+				cli.RunSafeMode(os.Args[2:], appSvc.GetConfigManager())
+			})
+			return
 		case "help", "-h", "--help":
 			printUsage()
 			return
@@ -195,7 +214,10 @@ CLI Commands:
   askflow import [--product <product_id>] <目录> [...]  批量导入目录下的文档到知识库
   askflow products                                         List all products and their IDs
   askflow backup [options]                                 Backup all system data
-  askflow restore <backup_file>                            Restore data from backup
+  askflow restore <backup_file|s3://bucket/key>            Restore data from backup
+  askflow pending import <answers.csv|answers.json>        Answer pending questions from a file
+  askflow safemode [on|off|status]                         Toggle read-only demo mode
+  askflow migrate-vectors --to <backend>                   Copy vectors to a search backend and select it
   askflow help                                             Show this help information
 
 import command:
@@ -203,9 +225,29 @@ import command:
   (PDF, Word, Excel, PPT, Markdown, HTML), parse them, and store in vector database.
   Multiple directories can be specified.
 
+  Patterns are matched against the path relative to the scanned directory:
+  "*" stays within a directory, "**" spans directories, and a pattern without
+  "/" matches the file name at any depth.
+
+  Progress is recorded in a manifest (file content hash → status), so an
+  interrupted import can be continued without re-importing finished files.
+
   Options:
     --product <product_id>  Specify target product ID. Imported documents will be associated
                             with this product. If not specified, they will be imported to the public library.
+    --include <pattern>     Only import files matching the pattern (repeatable)
+    --exclude <pattern>     Skip files and directories matching the pattern (repeatable)
+    --max-size <size>       Skip files larger than this, e.g. 50MB
+    --modified-since <date> Skip files last modified before this date (YYYY-MM-DD)
+    --manifest <file>       Progress manifest path (default: ./askflow-import.manifest.json)
+    --resume                Skip files the manifest records as imported or failed
+    --retry-failed          Like --resume, but import the failed files again
+    --report <file>         Write a machine-readable JSON report of the run
+    --dry-run               List the files that would be imported with estimated chunks,
+                            embeddings and API cost, without importing anything
+    --auto-product          Let the LLM propose a product for each file from its name and
+                            content, review and change the proposals, then import
+    --yes                   With --auto-product, import the proposals without asking
 
   Supported formats: .pdf .doc .docx .xls .xlsx .ppt .pptx .md .markdown .html .htm
 
@@ -213,6 +255,11 @@ import command:
     askflow import ./docs
     askflow import ./docs ./manuals /path/to/files
     askflow import --product abc123 ./docs
+    askflow import --include "*.pdf" --exclude "archive/**" --max-size 50MB ./docs
+    askflow import --resume ./docs
+    askflow import --retry-failed --report ./import-report.json ./docs
+    askflow import --dry-run ./docs
+    askflow import --auto-product ./mixed-docs
 
 products command:
   List all products' IDs, names, and descriptions in the system.
@@ -238,15 +285,59 @@ backup command:
     askflow backup --output ./backups                 Full backup to specified directory
     askflow backup --incremental --base ./backups/askflow_full_myserver_20260212-143000.manifest.json
 
+pending import command:
+  Answer pending questions from a CSV (header row with question_id and answer
+  columns) or JSON file (an array of {"question_id", "answer"} objects, or an
+  object mapping question IDs to answers). Each answer is embedded and stored
+  as knowledge like one given in the admin UI; questions already answered are
+  skipped. One line is printed per row.
+
+  Options:
+    --author <name>    Author recorded on the answers (default: cli)
+    --report <file>    Write a machine-readable JSON report of the run
+
+  Examples:
+    askflow pending import answers.csv
+    askflow pending import --report ./pending-report.json answers.json
+
+safemode command:
+  Read-only demo mode blocks config changes, uploads, and destructive admin
+  endpoints while keeping queries and logins working. It can only be toggled
+  here, not from the web UI. Restart the service for the change to take effect.
+
+  Examples:
+    askflow safemode status
+    askflow safemode on
+    askflow safemode off
+
+migrate-vectors command:
+  Copy all chunk vectors into an external vector search engine (e.g. qdrant,
+  configured under vector.qdrant) and set vector.backend to it. SQLite keeps
+  every chunk, so the migration can be run again after an interruption and
+  "--to sqlite" switches back without copying. Restart the service afterwards.
+
+  Examples:
+    askflow migrate-vectors --to qdrant
+    askflow migrate-vectors --to sqlite
+
 restore command:
   Restore data from a backup archive to the data directory.
   Full restore: Extract and run directly.
   Incremental restore: Restore full backup first, then apply db_delta.sql from incremental backups.
 
+  Selective restore: Restore only config, users or one product's documents,
+  after a preview of the rows and files that would be overwritten. Rows added
+  since the backup are kept.
+
   Options:
     --target <dir>     Target restore directory (default: ./data)
+    --only <scope>     Restore only config, users or product:<product_id> (repeatable, comma-separated)
+    --preview          With --only, show what would change without restoring
+    --yes              With --only, restore without asking for confirmation
 
   Examples:
     askflow restore askflow_full_myserver_20260212-143000.tar.gz
-    askflow restore --target ./data-new backup.tar.gz`)
+    askflow restore --target ./data-new backup.tar.gz
+    askflow restore --only product:abc123 --preview backup.tar.gz
+    askflow restore --only config,users backup.tar.gz`)
 }
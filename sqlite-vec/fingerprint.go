@@ -0,0 +1,107 @@
+package sqlitevec
+
+import "sort"
+
+// Fingerprint counts the chunks embedded in one embedding space, identified
+// by model name and vector dimension. Model is "" for chunks stored before
+// fingerprints were recorded.
+type Fingerprint struct {
+	Model     string `json:"model"`
+	Dim       int    `json:"dim"`
+	Chunks    int    `json:"chunks"`
+	Documents int    `json:"documents"`
+}
+
+// SetActiveModel sets the embedding model of query vectors. Search then
+// skips chunks embedded by a different model, so a corpus being migrated to
+// a new model only returns comparable results. Chunks without a recorded
+// model are kept as long as their dimension matches the query. An empty
+// model disables the filter.
+func (s *SQLiteVectorStore) SetActiveModel(model string) {
+	s.mu.Lock()
+	changed := s.activeModel != model
+	s.activeModel = model
+	s.mu.Unlock()
+	if changed {
+		s.searchCache.invalidate()
+	}
+}
+
+// ensureLoaded loads the in-memory cache if needed. Callers must not hold s.mu.
+func (s *SQLiteVectorStore) ensureLoaded() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loaded {
+		return nil
+	}
+	return s.loadCache()
+}
+
+// Fingerprints groups the stored chunks by embedding model and dimension,
+// largest group first. More than one group means the corpus mixes models.
+func (s *SQLiteVectorStore) Fingerprints() ([]Fingerprint, error) {
+	if err := s.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	type key struct {
+		model string
+		dim   int
+	}
+	groups := make(map[key]*Fingerprint)
+	docs := make(map[key]map[string]bool)
+	s.mu.RLock()
+	for i := range s.meta {
+		m := &s.meta[i]
+		k := key{m.model, m.dim}
+		fp, ok := groups[k]
+		if !ok {
+			fp = &Fingerprint{Model: m.model, Dim: m.dim}
+			groups[k] = fp
+			docs[k] = make(map[string]bool)
+		}
+		fp.Chunks++
+		docs[k][m.documentID] = true
+	}
+	s.mu.RUnlock()
+
+	result := make([]Fingerprint, 0, len(groups))
+	for k, fp := range groups {
+		fp.Documents = len(docs[k])
+		result = append(result, *fp)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Chunks != result[j].Chunks {
+			return result[i].Chunks > result[j].Chunks
+		}
+		if result[i].Model != result[j].Model {
+			return result[i].Model < result[j].Model
+		}
+		return result[i].Dim < result[j].Dim
+	})
+	return result, nil
+}
+
+// OutdatedDocuments returns the IDs of documents with at least one chunk not
+// embedded by model at dimension dim, sorted. A re-embed job can process
+// just these documents. A dim of 0 matches any dimension.
+func (s *SQLiteVectorStore) OutdatedDocuments(model string, dim int) ([]string, error) {
+	if err := s.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	s.mu.RLock()
+	for i := range s.meta {
+		m := &s.meta[i]
+		if m.model != model || (dim > 0 && m.dim != dim) {
+			seen[m.documentID] = true
+		}
+	}
+	s.mu.RUnlock()
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -44,6 +44,9 @@ type VectorChunk struct {
 	Vector       []float64 `json:"vector"`
 	ImageURL     string    `json:"image_url,omitempty"`
 	PartitionID  string    `json:"partition_id"`
+	// Model names the embedding model that produced Vector. Together with
+	// the vector length it fingerprints the embedding space of the chunk.
+	Model string `json:"model,omitempty"`
 }
 
 // SearchResult represents a search result with similarity score.
@@ -69,31 +72,26 @@ type chunkMeta struct {
 	partitionID  string
 	textLower    string
 	bigrams      map[string]bool
+	model        string // embedding model, "" when unknown (stored before fingerprints)
+	vecOff       int    // offset of the vector in the arena
+	dim          int    // vector length
 }
 
 // vectorArena stores all vectors contiguously in a single []float32 for
-// CPU cache-friendly sequential access.
+// CPU cache-friendly sequential access. Each chunk records the offset and
+// length of its vector, so corpora mixing embedding dimensions (e.g. during a
+// model migration) stay addressable.
 type vectorArena struct {
 	data []float32
-	dim  int
 }
 
-func (a *vectorArena) getVector(idx int) []float32 {
-	if a.dim == 0 {
+// vector returns the vector of m.
+func (a *vectorArena) vector(m *chunkMeta) []float32 {
+	end := m.vecOff + m.dim
+	if m.dim == 0 || end > len(a.data) {
 		return nil
 	}
-	start := idx * a.dim
-	end := start + a.dim
-	if end > len(a.data) {
-		return nil
-	}
-	return a.data[start:end]
-}
-
-func (a *vectorArena) append(vec []float32) int {
-	idx := len(a.data) / a.dim
-	a.data = append(a.data, vec...)
-	return idx
+	return a.data[m.vecOff:end]
 }
 
 // queryCache provides an LRU cache for recent vector search results.
@@ -310,6 +308,7 @@ type SQLiteVectorStore struct {
 	globalIndex    []int // pre-built [0..n) index for unpartitioned search
 	loaded         bool
 	searchCache    *queryCache
+	activeModel    string // Search skips chunks embedded by another model
 }
 
 // SIMDCapability returns a human-readable string describing the active SIMD
@@ -340,6 +339,8 @@ func EnsureTable(db *sql.DB) error {
 		embedding     BLOB NOT NULL,
 		image_url     TEXT DEFAULT '',
 		product_id    TEXT DEFAULT '',
+		embedding_model TEXT DEFAULT '',
+		embedding_dim   INTEGER DEFAULT 0,
 		created_at    DATETIME DEFAULT CURRENT_TIMESTAMP
 	)`)
 	if err != nil {
@@ -374,7 +375,7 @@ func (s *SQLiteVectorStore) loadCache() error {
 		return nil
 	}
 
-	rows, err := s.db.Query(`SELECT document_id, document_name, chunk_index, chunk_text, embedding, COALESCE(image_url,''), COALESCE(product_id,'') FROM chunks`)
+	rows, err := s.db.Query(`SELECT document_id, document_name, chunk_index, chunk_text, embedding, COALESCE(image_url,''), COALESCE(product_id,''), COALESCE(embedding_model,'') FROM chunks`)
 	if err != nil {
 		return fmt.Errorf("failed to query chunks: %w", err)
 	}
@@ -383,25 +384,22 @@ func (s *SQLiteVectorStore) loadCache() error {
 	meta := make([]chunkMeta, 0, count)
 	norms := make([]float32, 0, count)
 	partitionIndex := make(map[string][]int)
-	dimDetected := false
 	// Pre-allocate arena assuming a common dimension; will grow if needed.
 	var arenaData []float32
 
 	for rows.Next() {
-		var docID, docName, chunkText, imageURL, partitionID string
+		var docID, docName, chunkText, imageURL, partitionID, model string
 		var chunkIndex int
 		var embeddingBytes []byte
 
-		if err := rows.Scan(&docID, &docName, &chunkIndex, &chunkText, &embeddingBytes, &imageURL, &partitionID); err != nil {
+		if err := rows.Scan(&docID, &docName, &chunkIndex, &chunkText, &embeddingBytes, &imageURL, &partitionID, &model); err != nil {
 			return fmt.Errorf("failed to scan row: %w", err)
 		}
 
 		vec32 := DeserializeVectorF32(embeddingBytes)
 
-		if !dimDetected && len(vec32) > 0 {
-			s.arena.dim = len(vec32)
+		if arenaData == nil && len(vec32) > 0 {
 			arenaData = make([]float32, 0, count*len(vec32))
-			dimDetected = true
 		}
 
 		textLower := strings.ToLower(chunkText)
@@ -422,6 +420,9 @@ func (s *SQLiteVectorStore) loadCache() error {
 			partitionID:  partitionID,
 			textLower:    textLower,
 			bigrams:      charBigrams(textLower),
+			model:        model,
+			vecOff:       len(arenaData),
+			dim:          len(vec32),
 		})
 		norms = append(norms, invNorm)
 		arenaData = append(arenaData, vec32...)
@@ -504,8 +505,8 @@ func (s *SQLiteVectorStore) Store(docID string, chunks []VectorChunk) error {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
-	stmt, err := tx.Prepare(`INSERT INTO chunks (id, document_id, document_name, chunk_index, chunk_text, embedding, image_url, product_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	stmt, err := tx.Prepare(`INSERT INTO chunks (id, document_id, document_name, chunk_index, chunk_text, embedding, image_url, product_id, embedding_model, embedding_dim)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to prepare statement: %w", err)
@@ -524,7 +525,7 @@ func (s *SQLiteVectorStore) Store(docID string, chunks []VectorChunk) error {
 		chunkID := fmt.Sprintf("%s-%d", docID, chunk.ChunkIndex)
 		embeddingBytes := SerializeVector(chunk.Vector)
 
-		_, err := stmt.Exec(chunkID, docID, chunk.DocumentName, chunk.ChunkIndex, chunk.ChunkText, embeddingBytes, chunk.ImageURL, chunk.PartitionID)
+		_, err := stmt.Exec(chunkID, docID, chunk.DocumentName, chunk.ChunkIndex, chunk.ChunkText, embeddingBytes, chunk.ImageURL, chunk.PartitionID, chunk.Model, len(chunk.Vector))
 		if err != nil {
 			tx.Rollback()
 			return fmt.Errorf("failed to insert chunk %s: %w", chunkID, err)
@@ -547,6 +548,8 @@ func (s *SQLiteVectorStore) Store(docID string, chunks []VectorChunk) error {
 				partitionID:  chunk.PartitionID,
 				textLower:    textLower,
 				bigrams:      charBigrams(textLower),
+				model:        chunk.Model,
+				dim:          len(vec32),
 			},
 			invNorm:     invNorm,
 			vec32:       vec32,
@@ -565,11 +568,9 @@ func (s *SQLiteVectorStore) Store(docID string, chunks []VectorChunk) error {
 		s.clearMergedPartitionCache()
 		for _, ne := range newEntries {
 			idx := len(s.meta)
+			ne.meta.vecOff = len(s.arena.data)
 			s.meta = append(s.meta, ne.meta)
 			s.norms = append(s.norms, ne.invNorm)
-			if s.arena.dim == 0 && len(ne.vec32) > 0 {
-				s.arena.dim = len(ne.vec32)
-			}
 			s.arena.data = append(s.arena.data, ne.vec32...)
 			s.partitionIndex[ne.partitionID] = append(s.partitionIndex[ne.partitionID], idx)
 			s.globalIndex = append(s.globalIndex, idx)
@@ -710,7 +711,10 @@ func adaptiveWorkers(n int) int {
 func (s *SQLiteVectorStore) Search(queryVector []float64, topK int, threshold float64, partitionID string) ([]SearchResult, error) {
 	queryF32 := toFloat32(queryVector)
 
-	cacheKey := hashQueryVector(queryF32, topK, threshold, partitionID)
+	s.mu.RLock()
+	activeModel := s.activeModel
+	s.mu.RUnlock()
+	cacheKey := hashQueryVector(queryF32, topK, threshold, partitionID+"\x00"+activeModel)
 	if cached, ok := s.searchCache.get(cacheKey); ok {
 		return cached, nil
 	}
@@ -735,7 +739,7 @@ func (s *SQLiteVectorStore) Search(queryVector []float64, topK int, threshold fl
 	indices := s.getRelevantIndices(partitionID)
 	s.mu.RUnlock()
 
-	if len(meta) == 0 || len(indices) == 0 || arena.dim == 0 {
+	if len(meta) == 0 || len(indices) == 0 || len(arena.data) == 0 {
 		return nil, nil
 	}
 
@@ -746,7 +750,7 @@ func (s *SQLiteVectorStore) Search(queryVector []float64, topK int, threshold fl
 
 	invQueryNorm := float32(1.0) / queryNorm
 	thresholdF32 := float32(threshold)
-	dim := arena.dim
+	dim := len(queryF32)
 
 	numWorkers := adaptiveWorkers(len(indices))
 	chunkSize := (len(indices) + numWorkers - 1) / numWorkers
@@ -772,12 +776,16 @@ func (s *SQLiteVectorStore) Search(queryVector []float64, topK int, threshold fl
 				if invNorm == 0 {
 					continue
 				}
-				vecStart := idx * dim
-				vecEnd := vecStart + dim
+				// Vectors from another embedding space are not comparable
+				m := &meta[idx]
+				if m.dim != dim || (activeModel != "" && m.model != "" && m.model != activeModel) {
+					continue
+				}
+				vecEnd := m.vecOff + dim
 				if vecEnd > len(arenaData) {
 					continue
 				}
-				vec := arenaData[vecStart:vecEnd]
+				vec := arenaData[m.vecOff:vecEnd]
 
 				dot := dotProductSIMD(queryF32, vec)
 				score := dot * invQueryNorm * invNorm
@@ -1017,29 +1025,22 @@ func (s *SQLiteVectorStore) DeleteByDocID(docID string) error {
 	// Only hold the lock for the fast in-memory cache rebuild
 	s.mu.Lock()
 	if s.loaded {
-		dim := s.arena.dim
 		newMeta := make([]chunkMeta, 0, len(s.meta))
 		newNorms := make([]float32, 0, len(s.norms))
-		var newArenaData []float32
-		if dim > 0 {
-			newArenaData = make([]float32, 0, len(s.arena.data))
-		}
+		newArenaData := make([]float32, 0, len(s.arena.data))
 		newPartitionIndex := make(map[string][]int)
 
 		for i, m := range s.meta {
 			if m.documentID != docID {
 				idx := len(newMeta)
+				vec := s.arena.vector(&m)
+				m.vecOff = len(newArenaData)
+				m.dim = len(vec)
+				newArenaData = append(newArenaData, vec...)
 				newMeta = append(newMeta, m)
 				if i < len(s.norms) {
 					newNorms = append(newNorms, s.norms[i])
 				}
-				if dim > 0 {
-					vecStart := i * dim
-					vecEnd := vecStart + dim
-					if vecEnd <= len(s.arena.data) {
-						newArenaData = append(newArenaData, s.arena.data[vecStart:vecEnd]...)
-					}
-				}
 				newPartitionIndex[m.partitionID] = append(newPartitionIndex[m.partitionID], idx)
 			}
 		}